@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiClient 管理 API 客户端
+type apiClient struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newAPIClient(opts *globalOptions) *apiClient {
+	return &apiClient{
+		server: strings.TrimRight(opts.server, "/"),
+		token:  opts.token,
+		http:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// requireToken 需要登录的命令在未提供 token 时给出提示
+func (c *apiClient) requireToken() error {
+	if c.token == "" {
+		return errors.New("未提供 token，请先执行 ampctl login 并设置 AMPCTL_TOKEN，或使用 --token")
+	}
+	return nil
+}
+
+// do 发送 JSON 请求，out 非 nil 时解析响应体
+func (c *apiClient) do(method, path string, body, out interface{}) error {
+	resp, err := c.send(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	return nil
+}
+
+// send 发送请求并检查状态码，成功时由调用方负责关闭响应体
+func (c *apiClient) send(method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.server+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 %s 失败: %w", c.server, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, apiError(resp)
+	}
+	return resp, nil
+}
+
+// apiError 提取管理 API 的 {"error","details"} 错误信息
+func apiError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var payload struct {
+		Error   string `json:"error"`
+		Details string `json:"details"`
+	}
+	if json.Unmarshal(data, &payload) == nil && payload.Error != "" {
+		if payload.Details != "" {
+			return fmt.Errorf("%s (HTTP %d): %s", payload.Error, resp.StatusCode, payload.Details)
+		}
+		if retry := resp.Header.Get("Retry-After"); retry != "" {
+			return fmt.Errorf("%s (HTTP %d，%s 秒后重试)", payload.Error, resp.StatusCode, retry)
+		}
+		return fmt.Errorf("%s (HTTP %d)", payload.Error, resp.StatusCode)
+	}
+	return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"ampmanager/internal/model"
+
+	"nhooyr.io/websocket"
+)
+
+func runLogin(opts *globalOptions, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	username := fs.String("username", os.Getenv("AMPCTL_USERNAME"), "用户名（AMPCTL_USERNAME）")
+	password := fs.String("password", os.Getenv("AMPCTL_PASSWORD"), "密码（AMPCTL_PASSWORD）")
+	parseFlags(fs, args)
+	if *username == "" || *password == "" {
+		return errors.New("需要 --username 和 --password")
+	}
+
+	var resp model.AuthResponse
+	if err := newAPIClient(opts).do(http.MethodPost, "/api/manage/auth/login", model.LoginRequest{Username: *username, Password: *password}, &resp); err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(resp)
+	}
+	if !resp.IsAdmin {
+		fmt.Fprintln(os.Stderr, "提示: 当前账户不是管理员，仅可使用 keys 相关命令")
+	}
+	fmt.Println(resp.Token)
+	return nil
+}
+
+func runChannelsList(opts *globalOptions, args []string) error {
+	var channels []*model.ChannelResponse
+	if opts.direct {
+		d, err := openDirect(opts)
+		if err != nil {
+			return err
+		}
+		defer d.close()
+		if channels, err = d.channels.List(); err != nil {
+			return err
+		}
+	} else {
+		c := newAPIClient(opts)
+		if err := c.requireToken(); err != nil {
+			return err
+		}
+		var resp struct {
+			Channels []*model.ChannelResponse `json:"channels"`
+		}
+		if err := c.do(http.MethodGet, "/api/admin/channels", nil, &resp); err != nil {
+			return err
+		}
+		channels = resp.Channels
+	}
+
+	if opts.json {
+		return printJSON(channels)
+	}
+	w := newTable("ID", "NAME", "TYPE", "ENABLED", "PRIORITY", "MODELS", "GROUPS")
+	for _, ch := range channels {
+		models := "默认匹配"
+		if len(ch.Models) > 0 {
+			models = strconv.Itoa(len(ch.Models))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%d\t%s\t%s\n", ch.ID, ch.Name, ch.Type, ch.Enabled, ch.Priority, models, strings.Join(ch.GroupNames, ","))
+	}
+	return w.Flush()
+}
+
+func runChannelsCreate(opts *globalOptions, args []string) error {
+	fs := flag.NewFlagSet("channels create", flag.ExitOnError)
+	file := fs.String("file", "", "渠道 JSON 文件，- 表示标准输入")
+	parseFlags(fs, args)
+	if *file == "" {
+		return errors.New("需要 --file")
+	}
+
+	data, err := readInput(*file)
+	if err != nil {
+		return err
+	}
+	var req model.ChannelRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("解析渠道 JSON 失败: %w", err)
+	}
+
+	c := newAPIClient(opts)
+	if err := c.requireToken(); err != nil {
+		return err
+	}
+	var channel model.ChannelResponse
+	if err := c.do(http.MethodPost, "/api/admin/channels", &req, &channel); err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(channel)
+	}
+	fmt.Printf("渠道已创建: %s (%s)\n", channel.Name, channel.ID)
+	return nil
+}
+
+func runChannelsEnable(opts *globalOptions, args []string) error {
+	return setChannelEnabled(opts, args, true)
+}
+
+func runChannelsDisable(opts *globalOptions, args []string) error {
+	return setChannelEnabled(opts, args, false)
+}
+
+func setChannelEnabled(opts *globalOptions, args []string, enabled bool) error {
+	if len(args) != 1 {
+		return errors.New("需要渠道 ID")
+	}
+	id := args[0]
+	if opts.direct {
+		d, err := openDirect(opts)
+		if err != nil {
+			return err
+		}
+		defer d.close()
+		if err := d.channels.SetEnabled(id, enabled); err != nil {
+			return err
+		}
+	} else {
+		c := newAPIClient(opts)
+		if err := c.requireToken(); err != nil {
+			return err
+		}
+		body := map[string]bool{"enabled": enabled}
+		if err := c.do(http.MethodPatch, "/api/admin/channels/"+url.PathEscape(id)+"/enabled", body, nil); err != nil {
+			return err
+		}
+	}
+	fmt.Println("渠道状态已更新")
+	return nil
+}
+
+func runUsersList(opts *globalOptions, args []string) error {
+	var users []*model.UserInfo
+	if opts.direct {
+		d, err := openDirect(opts)
+		if err != nil {
+			return err
+		}
+		defer d.close()
+		if users, err = d.users.ListUsers(); err != nil {
+			return err
+		}
+	} else {
+		c := newAPIClient(opts)
+		if err := c.requireToken(); err != nil {
+			return err
+		}
+		if err := c.do(http.MethodGet, "/api/admin/users", nil, &users); err != nil {
+			return err
+		}
+	}
+
+	if opts.json {
+		return printJSON(users)
+	}
+	w := newTable("ID", "USERNAME", "ADMIN", "BALANCE(USD)", "GROUPS", "CREATED")
+	for _, u := range users {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%s\n", u.ID, u.Username, u.IsAdmin, u.BalanceUsd, strings.Join(u.GroupNames, ","), u.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func runUsersCreate(opts *globalOptions, args []string) error {
+	fs := flag.NewFlagSet("users create", flag.ExitOnError)
+	username := fs.String("username", "", "用户名")
+	password := fs.String("password", "", "密码（至少 6 位）")
+	admin := fs.Bool("admin", false, "设为管理员")
+	parseFlags(fs, args)
+	if *username == "" || *password == "" {
+		return errors.New("需要 --username 和 --password")
+	}
+	req := &model.RegisterRequest{Username: *username, Password: *password}
+
+	var userID string
+	if opts.direct {
+		d, err := openDirect(opts)
+		if err != nil {
+			return err
+		}
+		defer d.close()
+		user, err := d.users.Register(req)
+		if err != nil {
+			return err
+		}
+		userID = user.ID
+		if *admin {
+			if err := d.users.SetAdmin(userID, true); err != nil {
+				return err
+			}
+		}
+	} else {
+		// 注册接口不需要登录；设置管理员需要管理员 token
+		c := newAPIClient(opts)
+		if *admin {
+			if err := c.requireToken(); err != nil {
+				return err
+			}
+		}
+		var resp model.AuthResponse
+		if err := c.do(http.MethodPost, "/api/manage/auth/register", req, &resp); err != nil {
+			return err
+		}
+		userID = resp.ID
+		if *admin {
+			if err := c.do(http.MethodPatch, "/api/admin/users/"+url.PathEscape(userID)+"/admin", model.SetAdminRequest{IsAdmin: true}, nil); err != nil {
+				return fmt.Errorf("用户已创建，但设置管理员失败: %w", err)
+			}
+		}
+	}
+	fmt.Printf("用户已创建: %s (%s)\n", *username, userID)
+	return nil
+}
+
+func runUsersResetPassword(opts *globalOptions, args []string) error {
+	fs := flag.NewFlagSet("users reset-password", flag.ExitOnError)
+	password := fs.String("password", "", "新密码（至少 6 位）")
+	forceChange := fs.Bool("force-change", false, "要求用户登录后先修改密码")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 || *password == "" {
+		return errors.New("需要用户 ID 和 --password")
+	}
+	if len(*password) < 6 {
+		return errors.New("密码至少 6 位")
+	}
+
+	if opts.direct {
+		d, err := openDirect(opts)
+		if err != nil {
+			return err
+		}
+		defer d.close()
+		if err := d.users.ResetPassword("ampctl", positional[0], *password, *forceChange); err != nil {
+			return err
+		}
+	} else {
+		c := newAPIClient(opts)
+		if err := c.requireToken(); err != nil {
+			return err
+		}
+		path := "/api/admin/users/" + url.PathEscape(positional[0]) + "/reset-password"
+		if err := c.do(http.MethodPost, path, model.ResetPasswordRequest{NewPassword: *password, ForceChange: *forceChange}, nil); err != nil {
+			return err
+		}
+	}
+	fmt.Println("密码已重置")
+	return nil
+}
+
+func runUsersSetAdmin(opts *globalOptions, args []string) error {
+	fs := flag.NewFlagSet("users set-admin", flag.ExitOnError)
+	admin := fs.Bool("admin", true, "是否为管理员")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		return errors.New("需要用户 ID")
+	}
+
+	if opts.direct {
+		d, err := openDirect(opts)
+		if err != nil {
+			return err
+		}
+		defer d.close()
+		if err := d.users.SetAdmin(positional[0], *admin); err != nil {
+			return err
+		}
+	} else {
+		c := newAPIClient(opts)
+		if err := c.requireToken(); err != nil {
+			return err
+		}
+		path := "/api/admin/users/" + url.PathEscape(positional[0]) + "/admin"
+		if err := c.do(http.MethodPatch, path, model.SetAdminRequest{IsAdmin: *admin}, nil); err != nil {
+			return err
+		}
+	}
+	fmt.Println("权限设置成功")
+	return nil
+}
+
+func runKeysList(opts *globalOptions, args []string) error {
+	c := newAPIClient(opts)
+	if err := c.requireToken(); err != nil {
+		return err
+	}
+	var resp struct {
+		APIKeys []model.APIKeyListItem `json:"apiKeys"`
+	}
+	if err := c.do(http.MethodGet, "/api/me/amp/api-keys", nil, &resp); err != nil {
+		return err
+	}
+
+	if opts.json {
+		return printJSON(resp.APIKeys)
+	}
+	w := newTable("ID", "NAME", "PREFIX", "ACTIVE", "LAST USED", "CREATED")
+	for _, k := range resp.APIKeys {
+		lastUsed := "-"
+		if k.LastUsed != nil {
+			lastUsed = k.LastUsed.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.IsActive, lastUsed, k.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func runKeysCreate(opts *globalOptions, args []string) error {
+	fs := flag.NewFlagSet("keys create", flag.ExitOnError)
+	name := fs.String("name", "", "API Key 名称")
+	parseFlags(fs, args)
+	if *name == "" {
+		return errors.New("需要 --name")
+	}
+
+	c := newAPIClient(opts)
+	if err := c.requireToken(); err != nil {
+		return err
+	}
+	var resp model.CreateAPIKeyResponse
+	if err := c.do(http.MethodPost, "/api/me/amp/api-keys", model.CreateAPIKeyRequest{Name: *name}, &resp); err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(resp)
+	}
+	fmt.Fprintf(os.Stderr, "API Key 已创建: %s (%s)\n", resp.Name, resp.ID)
+	fmt.Println(resp.APIKey)
+	return nil
+}
+
+func runLogsTail(opts *globalOptions, args []string) error {
+	fs := flag.NewFlagSet("logs tail", flag.ExitOnError)
+	limit := fs.Int("n", 20, "先输出最近的日志条数")
+	follow := fs.Bool("follow", false, "持续输出新完成的请求日志")
+	parseFlags(fs, args)
+
+	c := newAPIClient(opts)
+	if err := c.requireToken(); err != nil {
+		return err
+	}
+
+	if *limit > 0 {
+		var resp model.RequestLogListResponse
+		if err := c.do(http.MethodGet, "/api/admin/request-logs?page=1&pageSize="+strconv.Itoa(*limit), nil, &resp); err != nil {
+			return err
+		}
+		// 接口按时间倒序返回，tail 需按时间正序输出
+		for i := len(resp.Items) - 1; i >= 0; i-- {
+			printLogEntry(opts, resp.Items[i])
+		}
+	}
+	if !*follow {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	wsURL := strings.Replace(c.server, "http", "ws", 1) + "/api/admin/request-logs/ws?token=" + url.QueryEscape(c.token)
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		return fmt.Errorf("连接实时日志失败: %w", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	conn.SetReadLimit(1 << 20)
+
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("实时日志连接中断: %w", err)
+		}
+		var msg struct {
+			Type string           `json:"type"`
+			Data model.RequestLog `json:"data"`
+		}
+		if json.Unmarshal(data, &msg) != nil || msg.Type != "request_log_completed" {
+			continue
+		}
+		printLogEntry(opts, msg.Data)
+	}
+}
+
+func printLogEntry(opts *globalOptions, entry model.RequestLog) {
+	if opts.json {
+		data, _ := json.Marshal(entry)
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Printf("%s  %-9s %3d %6dms  %-10s %-28s %-16s in=%s out=%s cost=%s\n",
+		entry.CreatedAt, entry.Status, entry.StatusCode, entry.LatencyMs,
+		derefString(entry.Username), derefString(entry.OriginalModel), derefString(entry.ChannelName),
+		derefInt(entry.InputTokens), derefInt(entry.OutputTokens), derefString(entry.CostUsd))
+}
+
+func runBackup(opts *globalOptions, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("output", "", "输出文件，默认按时间生成文件名")
+	parseFlags(fs, args)
+
+	if opts.direct {
+		d, err := openDirect(opts)
+		if err != nil {
+			return err
+		}
+		defer d.close()
+		path, err := d.backup(*output)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("备份已写入 %s\n", path)
+		return nil
+	}
+
+	c := newAPIClient(opts)
+	if err := c.requireToken(); err != nil {
+		return err
+	}
+	c.http.Timeout = 0 // 大数据库下载不设总超时
+	resp, err := c.send(http.MethodGet, "/api/admin/system/database/download", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	path := *output
+	if path == "" {
+		path = "ampmanager_" + time.Now().Format("20060102150405") + ".db"
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			path = params["filename"]
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("写入备份失败: %w", err)
+	}
+	fmt.Printf("备份已写入 %s (%d 字节)\n", path, n)
+	return nil
+}
+
+func runRouteExplain(opts *globalOptions, args []string) error {
+	fs := flag.NewFlagSet("route explain", flag.ExitOnError)
+	groups := fs.String("groups", "", "按用户分组视角过滤（逗号分隔分组 ID，传 none 表示无分组用户）")
+	models := parseFlags(fs, args)
+
+	var groupIDs []string
+	switch *groups {
+	case "":
+	case "none":
+		groupIDs = []string{}
+	default:
+		groupIDs = strings.Split(*groups, ",")
+	}
+
+	var routing []model.ModelRoutingPreview
+	if opts.direct {
+		d, err := openDirect(opts)
+		if err != nil {
+			return err
+		}
+		defer d.close()
+		if routing, err = d.channels.PreviewModelRouting(models, groupIDs); err != nil {
+			return err
+		}
+	} else {
+		c := newAPIClient(opts)
+		if err := c.requireToken(); err != nil {
+			return err
+		}
+		query := url.Values{}
+		if len(models) > 0 {
+			query.Set("models", strings.Join(models, ","))
+		}
+		if groupIDs != nil {
+			query.Set("groupIds", strings.Join(groupIDs, ","))
+		}
+		var resp struct {
+			Routing []model.ModelRoutingPreview `json:"routing"`
+		}
+		if err := c.do(http.MethodGet, "/api/admin/channels/models/routing?"+query.Encode(), nil, &resp); err != nil {
+			return err
+		}
+		routing = resp.Routing
+	}
+
+	if opts.json {
+		return printJSON(routing)
+	}
+	for _, preview := range routing {
+		fmt.Printf("%s\n", preview.Model)
+		if len(preview.Channels) == 0 {
+			fmt.Println("  （无可用渠道，请求将返回错误）")
+			continue
+		}
+		for _, ch := range preview.Channels {
+			status := "备用"
+			if ch.Active {
+				status = fmt.Sprintf("生效 %.0f%%", ch.TrafficShare*100)
+			}
+			match := ch.MatchKind
+			if ch.MatchedEntry != "" {
+				match += " " + ch.MatchedEntry
+			}
+			fmt.Printf("  [%s] %s (%s) priority=%d match=%s\n", status, ch.ChannelName, ch.Type, ch.Priority, match)
+		}
+	}
+	return nil
+}
+
+func newTable(headers ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	return w
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func derefString(s *string) string {
+	if s == nil || *s == "" {
+		return "-"
+	}
+	return *s
+}
+
+func derefInt(i *int) string {
+	if i == nil {
+		return "-"
+	}
+	return strconv.Itoa(*i)
+}
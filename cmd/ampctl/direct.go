@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"ampmanager/internal/config"
+	"ampmanager/internal/database"
+	"ampmanager/internal/repository"
+	"ampmanager/internal/service"
+)
+
+// directBackend 直连数据库执行管理操作，用于服务不可用时的恢复
+type directBackend struct {
+	users    *service.UserService
+	channels *service.ChannelService
+}
+
+func openDirect(opts *globalOptions) (*directBackend, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	options := cfg.DatabaseOptions()
+	if opts.dbPath != "" {
+		if _, err := os.Stat(opts.dbPath); err != nil {
+			return nil, fmt.Errorf("数据库文件不可用: %w", err)
+		}
+		options = database.Options{Type: database.DBTypeSQLite, SQLitePath: opts.dbPath}
+	}
+	options, err = options.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.InitWithOptions(options); err != nil {
+		return nil, fmt.Errorf("数据库初始化失败: %w", err)
+	}
+	// 读写渠道密钥时与服务端一致地加解密
+	repository.SetEncryptionKeyProvider(cfg.GetEncryptionKey)
+	return &directBackend{
+		users:    service.NewUserService(),
+		channels: service.NewChannelService(),
+	}, nil
+}
+
+func (d *directBackend) close() {
+	_ = database.Close()
+}
+
+// backup SQLite 使用 VACUUM INTO 生成一致性快照，PostgreSQL 导出 SQL dump，MySQL 需使用 mysqldump
+func (d *directBackend) backup(output string) (string, error) {
+	stamp := time.Now().Format("20060102150405")
+	if database.IsMySQL() {
+		return "", errors.New("MySQL 不支持直连备份，请使用 mysqldump")
+	}
+	if database.IsPostgres() {
+		if output == "" {
+			output = "ampmanager_" + stamp + ".sql"
+		}
+		dump, err := database.DumpPostgresDatabase(context.Background(), database.GetOptions())
+		if err != nil {
+			return "", fmt.Errorf("导出 PostgreSQL dump 失败: %w", err)
+		}
+		if err := writeNewFile(output, dump); err != nil {
+			return "", err
+		}
+		return output, nil
+	}
+
+	if output == "" {
+		output = "ampmanager_" + stamp + ".db"
+	}
+	if _, err := os.Stat(output); err == nil {
+		return "", errors.New("输出文件已存在: " + output)
+	}
+	if _, err := database.GetDB().Exec("VACUUM INTO ?", output); err != nil {
+		return "", fmt.Errorf("生成 SQLite 快照失败: %w", err)
+	}
+	return output, nil
+}
+
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// globalOptions 所有子命令共享的连接参数
+type globalOptions struct {
+	server string
+	token  string
+	direct bool
+	dbPath string
+	json   bool
+}
+
+type command struct {
+	usage  string
+	run    func(opts *globalOptions, args []string) error
+	direct bool // 支持 --direct 直连数据库
+}
+
+var commands = map[string]command{
+	"login":                {usage: "login --username <name> --password <pwd>    登录并输出 token（export AMPCTL_TOKEN=...）", run: runLogin},
+	"channels list":        {usage: "channels list                                列出渠道", run: runChannelsList, direct: true},
+	"channels create":      {usage: "channels create --file <channel.json>        按 JSON 创建渠道（格式同管理 API）", run: runChannelsCreate},
+	"channels enable":      {usage: "channels enable <id>                         启用渠道", run: runChannelsEnable, direct: true},
+	"channels disable":     {usage: "channels disable <id>                        禁用渠道", run: runChannelsDisable, direct: true},
+	"users list":           {usage: "users list                                   列出用户", run: runUsersList, direct: true},
+	"users create":         {usage: "users create --username <name> --password <pwd> [--admin]  创建用户", run: runUsersCreate, direct: true},
+	"users reset-password": {usage: "users reset-password <id> --password <pwd> [--force-change]   重置用户密码", run: runUsersResetPassword, direct: true},
+	"users set-admin":      {usage: "users set-admin <id> [--admin=false]         设置/取消管理员", run: runUsersSetAdmin, direct: true},
+	"keys list":            {usage: "keys list                                    列出当前账户的 API Key", run: runKeysList},
+	"keys create":          {usage: "keys create --name <name>                    为当前账户创建 API Key", run: runKeysCreate},
+	"logs tail":            {usage: "logs tail [-n 20] [--follow]                 查看最近请求日志，--follow 持续输出新日志", run: runLogsTail},
+	"backup":               {usage: "backup [--output <file>]                     下载数据库备份（SQLite 文件或 PostgreSQL dump）", run: runBackup, direct: true},
+	"route explain":        {usage: "route explain <model>... [--groups g1,g2]    解释模型会被路由到哪些渠道", run: runRouteExplain, direct: true},
+}
+
+var commandOrder = []string{
+	"login",
+	"channels list", "channels create", "channels enable", "channels disable",
+	"users list", "users create", "users reset-password", "users set-admin",
+	"keys list", "keys create",
+	"logs tail",
+	"backup",
+	"route explain",
+}
+
+func main() {
+	_ = godotenv.Load()
+
+	opts := &globalOptions{}
+	flags := flag.NewFlagSet("ampctl", flag.ExitOnError)
+	flags.StringVar(&opts.server, "server", envOr("AMPCTL_SERVER", "http://127.0.0.1:16823"), "管理 API 地址（AMPCTL_SERVER）")
+	flags.StringVar(&opts.token, "token", os.Getenv("AMPCTL_TOKEN"), "管理 API 的 JWT（AMPCTL_TOKEN）")
+	flags.BoolVar(&opts.direct, "direct", false, "直连数据库（恢复场景，服务无需运行），连接参数读取 DB_TYPE/SQLITE_PATH/DATABASE_URL")
+	flags.StringVar(&opts.dbPath, "db", "", "直连指定的 SQLite 文件（隐含 --direct）")
+	flags.BoolVar(&opts.json, "json", false, "以 JSON 输出")
+	flags.Usage = printUsage
+	flags.Parse(os.Args[1:])
+	if opts.dbPath != "" {
+		opts.direct = true
+	}
+
+	name, cmd, rest, ok := resolveCommand(flags.Args())
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+	if opts.direct && !cmd.direct {
+		fatalf("%s 不支持 --direct 模式", name)
+	}
+	if err := cmd.run(opts, rest); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// resolveCommand 依次尝试两段式与单段式命令名
+func resolveCommand(args []string) (string, command, []string, bool) {
+	if len(args) >= 2 {
+		name := args[0] + " " + args[1]
+		if cmd, ok := commands[name]; ok {
+			return name, cmd, args[2:], true
+		}
+	}
+	if len(args) >= 1 {
+		if cmd, ok := commands[args[0]]; ok {
+			return args[0], cmd, args[1:], true
+		}
+	}
+	return "", command{}, nil, false
+}
+
+func printUsage() {
+	var b strings.Builder
+	b.WriteString("用法: ampctl [--server URL] [--token JWT] [--direct | --db data.db] [--json] <命令>\n\n命令:\n")
+	for _, name := range commandOrder {
+		cmd := commands[name]
+		marker := "  "
+		if cmd.direct {
+			marker = "* "
+		}
+		b.WriteString("  " + marker + cmd.usage + "\n")
+	}
+	b.WriteString("\n标 * 的命令支持 --direct 直连数据库。\n")
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "错误: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// parseFlags 解析子命令参数，允许位置参数与 flag 混排
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			os.Exit(2)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
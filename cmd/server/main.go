@@ -1,17 +1,31 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"time"
+	// 内置时区数据库，用户报表时区不依赖运行环境的 zoneinfo（如 Windows）
+	_ "time/tzdata"
 
 	"ampmanager/internal/amp"
+	"ampmanager/internal/autotls"
 	"ampmanager/internal/billing"
 	"ampmanager/internal/config"
 	"ampmanager/internal/database"
+	"ampmanager/internal/health"
+	"ampmanager/internal/mail"
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
 	"ampmanager/internal/realtime"
 	"ampmanager/internal/repository"
 	"ampmanager/internal/router"
+	"ampmanager/internal/secrets"
 	"ampmanager/internal/service"
+	"ampmanager/internal/tokenizer"
+	"ampmanager/internal/tracing"
 	"ampmanager/internal/translator"
 	"ampmanager/internal/translator/filters"
 
@@ -28,17 +42,73 @@ func main() {
 	_ = translator.DefaultRegistry()
 	filters.RegisterFilters()
 
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("配置加载失败: %v", err)
+	}
 
 	if err := config.ValidateSecurityConfig(cfg); err != nil {
 		log.Fatalf("Security check failed: %v", err)
 	}
 
+	if err := autotls.Configure(autotls.Options{
+		Enabled:      cfg.ACMEEnabled,
+		Domains:      cfg.ACMEDomains,
+		Email:        cfg.ACMEEmail,
+		CacheDir:     cfg.ACMECacheDir,
+		DirectoryURL: cfg.ACMEDirectoryURL,
+		HTTPPort:     cfg.ACMEHTTPPort,
+		TLSPort:      cfg.ACMETLSPort,
+	}); err != nil {
+		log.Fatalf("ACME 配置无效: %v", err)
+	}
+
+	// OpenTelemetry 追踪（配置 OTLP 导出地址时启用）
+	if err := tracing.Init(tracing.Options{
+		Endpoint:    cfg.OTLPEndpoint,
+		Headers:     tracing.ParseHeaders(cfg.OTLPHeaders),
+		ServiceName: cfg.OTelServiceName,
+		SampleRatio: cfg.OTelSampleRatio,
+	}); err != nil {
+		log.Fatalf("追踪配置无效: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		tracing.Shutdown(ctx)
+	}()
+
+	// SMTP 发信（邮箱验证、找回密码与凭据变更通知，未配置 SMTP_HOST 时关闭）
+	if err := mail.Configure(mail.Options{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.GetSMTPPassword,
+		From:     cfg.SMTPFrom,
+		TLS:      cfg.SMTPTLS,
+	}); err != nil {
+		log.Fatalf("SMTP 配置无效: %v", err)
+	}
+
+	// 定期从外部密钥存储刷新密钥引用（JWT 密钥、渠道 API Key 等）
+	secrets.StartRefresher()
+
 	if err := database.InitWithOptions(cfg.DatabaseOptions()); err != nil {
 		log.Fatalf("数据库初始化失败: %v", err)
 	}
 	defer database.Close()
 
+	// 渠道与上游 API Key 在 repository 层以 DATA_ENCRYPTION_KEY 信封加密，启动时加密存量明文
+	repository.SetEncryptionKeyProvider(cfg.GetEncryptionKey)
+	if migrated, err := repository.EncryptStoredSecrets(); err != nil {
+		log.Fatalf("密钥加密迁移失败: %v", err)
+	} else if migrated > 0 {
+		log.Printf("已加密 %d 条记录中的明文 API Key", migrated)
+	}
+	if cfg.GetEncryptionKey() == nil {
+		log.Println("[WARN] DATA_ENCRYPTION_KEY 未配置，渠道与上游 API Key 以明文存储")
+	}
+
 	// 初始化日志写入器
 	amp.InitLogWriter(database.GetDB())
 	defer amp.StopLogWriter()
@@ -51,11 +121,86 @@ func main() {
 	billing.InitPriceStore()
 	defer billing.StopPriceStore()
 	billing.InitCostCalculator()
+	// 上游缺少用量时的 token 估算词表
+	tokenizer.Init(cfg.TokenizerDir)
 
-	// 初始化 pending 请求清理器
+	// 初始化 pending 请求清理器（先加载配置，避免首次清理使用默认阈值）
+	if configJSON, err := service.NewSystemConfigService().GetPendingCleanerConfigJSON(); err == nil && configJSON != "" {
+		amp.InitPendingCleanerConfig(configJSON)
+	}
 	amp.InitPendingCleaner(database.GetDB())
 	defer amp.StopPendingCleaner()
 
+	// 初始化请求日志保留策略清理器
+	if configJSON, err := service.NewSystemConfigService().GetLogRetentionConfigJSON(); err == nil && configJSON != "" {
+		amp.InitLogRetentionConfig(configJSON)
+	}
+	amp.InitLogRetentionPruner(database.GetDB())
+	defer amp.StopLogRetentionPruner()
+
+	// 初始化计费一致性检查任务
+	if configJSON, err := service.NewSystemConfigService().GetBillingAuditConfigJSON(); err == nil && configJSON != "" {
+		service.InitBillingAuditConfig(configJSON)
+	}
+	service.InitBillingAuditor()
+	defer service.StopBillingAuditor()
+
+	// 初始化分组月度预算告警
+	if configJSON, err := service.NewSystemConfigService().GetGroupBudgetAlertConfigJSON(); err == nil && configJSON != "" {
+		service.InitGroupBudgetAlertConfig(configJSON)
+	}
+	service.InitGroupBudgetChecker()
+	defer service.StopGroupBudgetChecker()
+
+	// 初始化新用户默认配置（自动分配分组、套餐与 Amp 设置）
+	if configJSON, err := service.NewSystemConfigService().GetNewUserDefaultsConfigJSON(); err == nil && configJSON != "" {
+		service.InitNewUserDefaultsConfig(configJSON)
+	}
+
+	// 初始化渠道健康检查（连续探测失败的渠道熔断，选路时跳过）
+	if configJSON, err := service.NewSystemConfigService().GetChannelHealthConfigJSON(); err == nil && configJSON != "" {
+		health.InitConfig(configJSON)
+	}
+	amp.InitChannelHealthChecker()
+	defer amp.StopChannelHealthChecker()
+
+	// 初始化渠道密钥有效性检查（所有密钥认证失败的渠道选路时跳过）
+	if configJSON, err := service.NewSystemConfigService().GetChannelKeyCheckConfigJSON(); err == nil && configJSON != "" {
+		health.InitKeyCheckConfig(configJSON)
+	}
+	amp.InitChannelKeyChecker()
+	defer amp.StopChannelKeyChecker()
+
+	// 初始化批处理结算任务（批处理结束后逐条记录请求日志并按批处理价格结算）
+	amp.InitBatchSettler()
+	defer amp.StopBatchSettler()
+
+	// 初始化渠道权重自动调整任务（仅在开启 autoAdjust 时调整）
+	if configJSON, err := service.NewSystemConfigService().GetChannelCapacityConfigJSON(); err == nil && configJSON != "" {
+		service.InitChannelCapacityConfig(configJSON)
+	}
+	service.InitChannelCapacityAdjuster()
+	defer service.StopChannelCapacityAdjuster()
+
+	// 初始化上游模型同步任务
+	if configJSON, err := service.NewSystemConfigService().GetModelSyncConfigJSON(); err == nil && configJSON != "" {
+		service.InitModelSyncConfig(configJSON)
+	}
+	service.InitModelSyncRunner()
+	defer service.StopModelSyncRunner()
+
+	// 初始化定时变更执行任务
+	service.InitScheduledChangeRunner()
+	defer service.StopScheduledChangeRunner()
+
+	// 初始化用量汇总任务（长周期趋势图）
+	service.InitUsageRollupRunner()
+	defer service.StopUsageRollupRunner()
+
+	// 初始化 claude_oauth 渠道的令牌刷新任务
+	service.InitChannelOAuthRefresher()
+	defer service.StopChannelOAuthRefresher()
+
 	// 初始化实时推送 hub
 	logRepo := repository.NewRequestLogRepository()
 	realtime.InitHub(func(id string) (interface{}, error) {
@@ -69,6 +214,18 @@ func main() {
 
 	r := router.Setup()
 
+	// 演示模式：写入合成数据，渠道指向内置假上游
+	if cfg.DemoMode {
+		demoPort := cfg.ServerPort
+		if envPort := os.Getenv("PORT"); envPort != "" {
+			demoPort = envPort
+		}
+		if err := service.SeedDemoData("http://127.0.0.1:" + demoPort + amp.DemoProviderPrefix); err != nil {
+			log.Printf("警告: 演示数据写入失败: %v", err)
+		}
+		log.Printf("演示模式已启用，破坏性操作将被拒绝")
+	}
+
 	// 加载重试配置
 	sysConfigService := service.NewSystemConfigService()
 	if configJSON, err := sysConfigService.GetRetryConfigJSON(); err == nil && configJSON != "" {
@@ -85,18 +242,169 @@ func main() {
 		amp.SetRequestDetailEnabled(enabled)
 	}
 
+	// 加载上游响应结构校验配置
+	if enabled, err := sysConfigService.GetResponseValidationEnabled(); err == nil && enabled {
+		amp.SetResponseValidationEnabled(true)
+	}
+
 	// 加载缓存 TTL 配置
 	if cacheTTL, err := sysConfigService.GetCacheTTLOverride(); err == nil && cacheTTL != "" {
 		filters.SetCacheTTLOverride(cacheTTL)
 	}
 
+	// 加载维护模式配置（重启前处于维护中时继续保持）
+	if configJSON, err := sysConfigService.GetMaintenanceConfigJSON(); err == nil && configJSON != "" {
+		amp.InitMaintenanceConfig(configJSON)
+	}
+
+	// 加载上游响应头透传策略
+	if configJSON, err := sysConfigService.GetResponseHeaderConfigJSON(); err == nil && configJSON != "" {
+		amp.InitResponseHeaderConfig(configJSON)
+	}
+
+	// 加载计费影子模式（开启期间只记录费用不扣费）
+	if configJSON, err := sysConfigService.GetBillingShadowConfigJSON(); err == nil && configJSON != "" {
+		service.InitBillingShadowConfig(configJSON)
+	}
+	if configJSON, err := sysConfigService.GetQuotaEnforcementConfigJSON(); err == nil && configJSON != "" {
+		service.InitQuotaEnforcementConfig(configJSON)
+	}
+	if configJSON, err := sysConfigService.GetPasswordPolicyConfigJSON(); err == nil && configJSON != "" {
+		service.InitPasswordPolicyConfig(configJSON)
+	}
+	if configJSON, err := sysConfigService.GetOIDCConfigJSON(); err == nil && configJSON != "" {
+		service.InitOIDCConfig(configJSON)
+	}
+	if configJSON, err := sysConfigService.GetRuntimeDebugConfigJSON(); err == nil && configJSON != "" {
+		service.InitRuntimeDebugConfig(configJSON)
+	}
+
+	// 加载渠道故障转移配置
+	if configJSON, err := sysConfigService.GetChannelFailoverConfigJSON(); err == nil && configJSON != "" {
+		amp.InitChannelFailoverConfig(configJSON)
+	}
+
+	// 加载会话粘性配置
+	if configJSON, err := sysConfigService.GetChannelStickyConfigJSON(); err == nil && configJSON != "" {
+		amp.InitChannelStickyConfig(configJSON)
+	}
+
+	// 加载并发上限处理策略（拒绝 / 排队）
+	if configJSON, err := sysConfigService.GetConcurrencyLimitConfigJSON(); err == nil && configJSON != "" {
+		amp.InitConcurrencyLimitConfig(configJSON)
+	}
+
+	// 加载流式响应刷新合并配置
+	if configJSON, err := sysConfigService.GetStreamFlushConfigJSON(); err == nil && configJSON != "" {
+		amp.InitStreamFlushConfig(configJSON)
+	}
+
+	// 加载内存保护配置并启动进程内存水位监控
+	if configJSON, err := sysConfigService.GetMemoryGuardConfigJSON(); err == nil && configJSON != "" {
+		amp.InitMemoryGuardConfig(configJSON)
+	}
+	amp.InitMemoryGuard()
+	defer amp.StopMemoryGuard()
+
+	// 加载跨格式翻译配置（严格 / 宽松模式）
+	if configJSON, err := sysConfigService.GetTranslationConfigJSON(); err == nil && configJSON != "" {
+		amp.InitTranslationConfig(configJSON)
+	}
+
+	// 加载工具调用循环检测配置
+	if configJSON, err := sysConfigService.GetToolLoopConfigJSON(); err == nil && configJSON != "" {
+		amp.InitToolLoopConfig(configJSON)
+	}
+
+	// 加载请求日志策略
+	if configJSON, err := sysConfigService.GetRequestLogPolicyJSON(); err == nil && configJSON != "" {
+		amp.InitRequestLogPolicy(configJSON)
+	}
+	if configJSON, err := sysConfigService.GetFederationConfigJSON(); err == nil && configJSON != "" {
+		amp.InitFederationConfig(configJSON)
+	}
+
+	// 加载输出过滤配置
+	if configJSON, err := sysConfigService.GetOutputFilterConfigJSON(); err == nil && configJSON != "" {
+		amp.InitOutputFilterConfig(configJSON)
+	}
+	if configJSON, err := sysConfigService.GetDetailRedactionConfigJSON(); err == nil && configJSON != "" {
+		amp.InitDetailRedactionConfig(configJSON)
+	}
+	if configJSON, err := sysConfigService.GetPIIRedactionConfigJSON(); err == nil && configJSON != "" {
+		amp.InitPIIRedactionConfig(configJSON)
+	}
+
+	// 加载 CORS 与嵌入策略（需在 router.Setup 设置默认值之后）
+	if configJSON, err := sysConfigService.GetHTTPPolicyJSON(); err == nil && configJSON != "" {
+		if err := middleware.InitHTTPPolicy(configJSON); err != nil {
+			log.Printf("警告: HTTP 策略配置无效，使用默认值: %v", err)
+		}
+	}
+
+	// 加载访问日志配置（需在 router.Setup 设置默认路径之后）
+	if configJSON, err := sysConfigService.GetAccessLogConfigJSON(); err == nil && configJSON != "" {
+		if err := middleware.InitAccessLog(configJSON); err != nil {
+			log.Printf("警告: 访问日志配置无效，未启用访问日志: %v", err)
+		}
+	}
+	defer middleware.CloseAccessLog()
+
 	port := cfg.ServerPort
 	if envPort := os.Getenv("PORT"); envPort != "" {
 		port = envPort
 	}
 
+	// 先监听端口，再执行自检，确保指向本服务的渠道（如演示模式）可被探测
+	listener, err := net.Listen("tcp", "0.0.0.0:"+port)
+	if err != nil {
+		log.Fatalf("服务器启动失败: %v", err)
+	}
+	go runStartupDiagnostics()
+
+	// 内置 ACME：HTTPS 端口使用自动申请的证书，HTTP 端口处理 HTTP-01 质询并跳转
+	if autotls.Enabled() {
+		tlsListener, err := autotls.Listen()
+		if err != nil {
+			log.Fatalf("HTTPS 端口监听失败: %v", err)
+		}
+		go func() {
+			if err := http.Serve(tlsListener, r); err != nil {
+				log.Fatalf("HTTPS 服务异常退出: %v", err)
+			}
+		}()
+		go func() {
+			if err := autotls.ServeHTTP(); err != nil {
+				log.Printf("警告: ACME HTTP 端口不可用，仅能通过 TLS-ALPN-01 验证域名: %v", err)
+			}
+		}()
+		autotls.InitRenewal()
+		defer autotls.StopRenewal()
+		log.Printf("HTTPS 已启用（ACME），域名: %v，端口 %s", cfg.ACMEDomains, cfg.ACMETLSPort)
+	}
+
 	log.Printf("服务器启动在 http://0.0.0.0:%s", port)
-	if err := r.Run("0.0.0.0:" + port); err != nil {
+	if err := r.RunListener(listener); err != nil {
 		log.Fatalf("服务器启动失败: %v", err)
 	}
 }
+
+// runStartupDiagnostics 启动自检，问题写入日志，完整报告通过 /api/admin/system/diagnostics 查看
+func runStartupDiagnostics() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	report := service.NewDiagnosticsService().Run(ctx, "startup")
+	if report.Status == model.DiagnosticStatusOK {
+		log.Printf("启动自检通过（%d ms）", report.DurationMs)
+		return
+	}
+	log.Printf("启动自检发现 %d 个问题，详见 GET /api/admin/system/diagnostics", len(report.Issues))
+	for _, check := range report.Checks {
+		if check.Error != "" {
+			log.Printf("  [%s] 检查失败: %s", check.Name, check.Error)
+		}
+	}
+	for _, issue := range report.Issues {
+		log.Printf("  [%s] %s: %s", issue.Severity, issue.Subject, issue.Message)
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	log "github.com/sirupsen/logrus"
 )
 
 var requiredAnthropicBetas = []string{
@@ -38,3 +43,58 @@ func ensureRequiredAnthropicBetas(req *http.Request) {
 	sort.Strings(list)
 	req.Header.Set("Anthropic-Beta", strings.Join(list, ","))
 }
+
+// applyAnthropicBetaPolicy 按渠道策略过滤客户端携带的 Anthropic-Beta，有移除时记录日志
+// 只用于渠道转发路径，ampcode.com 代理路径保持原样透传
+func applyAnthropicBetaPolicy(req *http.Request, channel *model.Channel) {
+	header := req.Header.Get("Anthropic-Beta")
+	if header == "" {
+		return
+	}
+
+	kept, removed := filterAnthropicBetas(header, service.ChannelAnthropicBetaPolicy(channel))
+	if len(removed) == 0 {
+		return
+	}
+	if len(kept) > 0 {
+		req.Header.Set("Anthropic-Beta", strings.Join(kept, ","))
+	} else {
+		req.Header.Del("Anthropic-Beta")
+	}
+
+	channelName := ""
+	if channel != nil {
+		channelName = channel.Name
+	}
+	log.Infof("channel proxy: 渠道 %s 按策略移除 Anthropic-Beta: %s（保留: %s）", channelName, strings.Join(removed, ","), strings.Join(kept, ","))
+}
+
+// filterAnthropicBetas 拆分逗号分隔的 beta 列表，返回保留与移除的项
+func filterAnthropicBetas(header string, policy model.AnthropicBetaPolicy) (kept, removed []string) {
+	for _, part := range strings.Split(header, ",") {
+		beta := strings.TrimSpace(part)
+		if beta == "" {
+			continue
+		}
+		listed := matchAnthropicBeta(beta, policy.Betas)
+		if listed == (policy.Mode == model.AnthropicBetaModeAllow) {
+			kept = append(kept, beta)
+		} else {
+			removed = append(removed, beta)
+		}
+	}
+	return kept, removed
+}
+
+func matchAnthropicBeta(beta string, patterns []string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(beta, prefix) {
+				return true
+			}
+		} else if beta == p {
+			return true
+		}
+	}
+	return false
+}
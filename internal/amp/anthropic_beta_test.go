@@ -0,0 +1,52 @@
+package amp
+
+import (
+	"net/http"
+	"testing"
+
+	"ampmanager/internal/model"
+)
+
+func TestApplyAnthropicBetaPolicy_DefaultStripsContext1M(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/v1/messages", nil)
+	req.Header.Set("Anthropic-Beta", "context-1m-2025-08-07, fine-grained-tool-streaming-2025-05-14")
+
+	applyAnthropicBetaPolicy(req, &model.Channel{Name: "default"})
+
+	if got := req.Header.Get("Anthropic-Beta"); got != "fine-grained-tool-streaming-2025-05-14" {
+		t.Fatalf("unexpected header %q", got)
+	}
+}
+
+func TestApplyAnthropicBetaPolicy_AllowList(t *testing.T) {
+	channel := &model.Channel{
+		Name:                    "1m",
+		AnthropicBetaPolicyJSON: `{"mode":"allow","betas":["context-1m-*"]}`,
+	}
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/v1/messages", nil)
+	req.Header.Set("Anthropic-Beta", "context-1m-2025-08-07,fine-grained-tool-streaming-2025-05-14")
+
+	applyAnthropicBetaPolicy(req, channel)
+
+	if got := req.Header.Get("Anthropic-Beta"); got != "context-1m-2025-08-07" {
+		t.Fatalf("unexpected header %q", got)
+	}
+
+	req.Header.Set("Anthropic-Beta", "fine-grained-tool-streaming-2025-05-14")
+	applyAnthropicBetaPolicy(req, channel)
+	if _, ok := req.Header["Anthropic-Beta"]; ok {
+		t.Fatalf("expected header to be removed, got %q", req.Header.Get("Anthropic-Beta"))
+	}
+}
+
+func TestApplyAnthropicBetaPolicy_EmptyDenyPassesThrough(t *testing.T) {
+	channel := &model.Channel{Name: "passthrough", AnthropicBetaPolicyJSON: `{"mode":"deny","betas":[]}`}
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/v1/messages", nil)
+	req.Header.Set("Anthropic-Beta", "context-1m-2025-08-07")
+
+	applyAnthropicBetaPolicy(req, channel)
+
+	if got := req.Header.Get("Anthropic-Beta"); got != "context-1m-2025-08-07" {
+		t.Fatalf("unexpected header %q", got)
+	}
+}
@@ -0,0 +1,205 @@
+package amp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// apiKeyScopeErrorResponse 请求超出 API Key 访问范围时的 403 响应：在标准错误格式上附带范围详情
+type apiKeyScopeErrorResponse struct {
+	Error apiKeyScopeErrorDetail `json:"error"`
+}
+
+type apiKeyScopeErrorDetail struct {
+	ErrorDetail
+	Scope apiKeyScopeViolation `json:"scope"`
+}
+
+type apiKeyScopeViolation struct {
+	Endpoint            string     `json:"endpoint,omitempty"`
+	Model               string     `json:"model,omitempty"`
+	AllowedEndpoints    []string   `json:"allowedEndpoints,omitempty"`
+	AllowedModels       []string   `json:"allowedModels,omitempty"`
+	MonthlyBudgetMicros int64      `json:"monthlyBudgetMicros,omitempty"`
+	SpentMicros         int64      `json:"spentMicros,omitempty"`
+	ResetsAt            *time.Time `json:"resetsAt,omitempty"`
+}
+
+func abortAPIKeyScope(c *gin.Context, code, message string, violation apiKeyScopeViolation) {
+	c.AbortWithStatusJSON(http.StatusForbidden, apiKeyScopeErrorResponse{
+		Error: apiKeyScopeErrorDetail{
+			ErrorDetail: ErrorDetail{
+				Message: message,
+				Type:    "permission_error",
+				Code:    code,
+			},
+			Scope: violation,
+		},
+	})
+}
+
+// apiKeyEndpointCategory 请求所属的接口类别，与 API Key 访问范围中的 endpoints 对应
+func apiKeyEndpointCategory(method, path string) string {
+	p := normalizeProviderPath(strings.TrimSuffix(path, "/"))
+	switch {
+	case isBatchPath(p):
+		return model.APIKeyEndpointBatch
+	case isRealtimePath(path):
+		return model.APIKeyEndpointChat
+	case method == http.MethodGet && (isModelsEndpoint(p) || strings.HasPrefix(p, "/v1beta/models/") || strings.HasPrefix(p, "/v1/models/")):
+		return model.APIKeyEndpointModels
+	case isEmbeddingsPath(path) || strings.HasSuffix(p, ":embedContent") || strings.HasSuffix(p, ":batchEmbedContents"):
+		return model.APIKeyEndpointEmbeddings
+	case isAudioPath(path):
+		return model.APIKeyEndpointAudio
+	case IsModelInvocation(method, path):
+		return model.APIKeyEndpointChat
+	case strings.HasPrefix(p, "/v1/") || strings.HasPrefix(p, "/v1beta/") || strings.HasPrefix(p, "/v1beta1/"):
+		// 其余厂商接口（如 count_tokens、countTokens）随对话类别授权
+		return model.APIKeyEndpointChat
+	default:
+		return model.APIKeyEndpointAmp
+	}
+}
+
+// matchModelScope 模型名是否匹配访问范围中的模型模式，* 匹配任意字符，忽略大小写
+func matchModelScope(pattern, modelName string) bool {
+	pattern = strings.ToLower(pattern)
+	modelName = strings.ToLower(strings.TrimPrefix(modelName, "models/"))
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == modelName
+	}
+	if !strings.HasPrefix(modelName, parts[0]) {
+		return false
+	}
+	rest := modelName[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return strings.HasSuffix(rest, parts[len(parts)-1])
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func apiKeyModelAllowed(patterns []string, modelName string) bool {
+	for _, pattern := range patterns {
+		if matchModelScope(pattern, modelName) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyScopeModels 请求使用的模型：批处理提交返回每条请求的模型，实时会话取查询参数，其余从路径或请求体中提取
+func apiKeyScopeModels(c *gin.Context, endpoint string) []string {
+	if endpoint == model.APIKeyEndpointBatch {
+		route, ok := parseBatchRoute(c.Request.Method, c.Request.URL.Path)
+		if !ok || route.action != batchCreate {
+			return nil
+		}
+		if route.provider == model.BatchProviderGemini {
+			return []string{strings.TrimPrefix(route.model, "models/")}
+		}
+		if c.Request.Body == nil {
+			return nil
+		}
+		body := readJSONRequestBody(c.Request, maxBatchRequestBodySize)
+		if body == nil {
+			return nil
+		}
+		var models []string
+		for _, m := range gjson.GetBytes(body, "requests.#.params.model").Array() {
+			models = append(models, m.String())
+		}
+		return models
+	}
+	if isRealtimePath(c.Request.URL.Path) {
+		if m := c.Query("model"); m != "" {
+			return []string{m}
+		}
+		return nil
+	}
+	if m := extractModelName(c); m != "" {
+		return []string{m}
+	}
+	return nil
+}
+
+// enforceAPIKeyScopes 按 API Key 的访问范围检查接口类别、模型与月度预算，超出范围时以 403 中止请求并返回 false
+func enforceAPIKeyScopes(c *gin.Context, key *model.UserAPIKey) bool {
+	scopes := key.Scopes
+	if scopes.IsEmpty() {
+		return true
+	}
+
+	endpoint := apiKeyEndpointCategory(c.Request.Method, c.Request.URL.Path)
+	if len(scopes.Endpoints) > 0 && !containsString(scopes.Endpoints, endpoint) {
+		log.Warnf("amp api key scope: key %s denied endpoint %s (%s)", key.ID, endpoint, c.Request.URL.Path)
+		abortAPIKeyScope(c, "api_key_endpoint_not_allowed",
+			fmt.Sprintf("this api key is not allowed to access %s endpoints", endpoint),
+			apiKeyScopeViolation{Endpoint: endpoint, AllowedEndpoints: scopes.Endpoints})
+		return false
+	}
+	if endpoint == model.APIKeyEndpointModels || endpoint == model.APIKeyEndpointAmp {
+		return true
+	}
+
+	if len(scopes.Models) > 0 {
+		models := apiKeyScopeModels(c, endpoint)
+		if len(models) == 0 && IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
+			abortAPIKeyScope(c, "api_key_model_not_allowed",
+				"this api key is restricted to specific models but the request does not specify one",
+				apiKeyScopeViolation{Endpoint: endpoint, AllowedModels: scopes.Models})
+			return false
+		}
+		for _, m := range models {
+			if !apiKeyModelAllowed(scopes.Models, m) {
+				log.Warnf("amp api key scope: key %s denied model %s", key.ID, m)
+				abortAPIKeyScope(c, "api_key_model_not_allowed",
+					fmt.Sprintf("this api key is not allowed to use model %s", m),
+					apiKeyScopeViolation{Endpoint: endpoint, Model: m, AllowedModels: scopes.Models})
+				return false
+			}
+		}
+	}
+
+	if scopes.MonthlyBudgetMicros > 0 {
+		now := time.Now().UTC()
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		spent, err := apiKeyRepo.SumCostSince(key.ID, monthStart)
+		if err != nil {
+			// 与余额检查一致，统计失败时放行
+			log.Errorf("amp api key scope: failed to sum monthly cost for key %s: %v", key.ID, err)
+			return true
+		}
+		if spent >= scopes.MonthlyBudgetMicros {
+			resetsAt := monthStart.AddDate(0, 1, 0)
+			log.Warnf("amp api key scope: key %s exceeded monthly budget (%d/%d micros)", key.ID, spent, scopes.MonthlyBudgetMicros)
+			abortAPIKeyScope(c, "api_key_budget_exceeded",
+				fmt.Sprintf("this api key has reached its monthly budget, resets at %s", resetsAt.Format(time.RFC3339)),
+				apiKeyScopeViolation{Endpoint: endpoint, MonthlyBudgetMicros: scopes.MonthlyBudgetMicros, SpentMicros: spent, ResetsAt: &resetsAt})
+			return false
+		}
+	}
+	return true
+}
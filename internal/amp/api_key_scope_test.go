@@ -0,0 +1,131 @@
+package amp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIKeyEndpointCategory(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodPost, "/v1/chat/completions", model.APIKeyEndpointChat},
+		{http.MethodPost, "/api/provider/anthropic/v1/messages", model.APIKeyEndpointChat},
+		{http.MethodPost, "/v1/messages/count_tokens", model.APIKeyEndpointChat},
+		{http.MethodPost, "/v1beta/models/gemini-2.5-pro:generateContent", model.APIKeyEndpointChat},
+		{http.MethodGet, "/v1/realtime", model.APIKeyEndpointChat},
+		{http.MethodPost, "/v1/embeddings", model.APIKeyEndpointEmbeddings},
+		{http.MethodPost, "/v1/audio/transcriptions", model.APIKeyEndpointAudio},
+		{http.MethodPost, "/v1/messages/batches", model.APIKeyEndpointBatch},
+		{http.MethodGet, "/v1beta/batches/abc", model.APIKeyEndpointBatch},
+		{http.MethodGet, "/v1/models", model.APIKeyEndpointModels},
+		{http.MethodGet, "/api/provider/openai/v1/models", model.APIKeyEndpointModels},
+		{http.MethodGet, "/api/user", model.APIKeyEndpointAmp},
+		{http.MethodPost, "/api/threads/T-1", model.APIKeyEndpointAmp},
+		{http.MethodPost, "/api/internal", model.APIKeyEndpointAmp},
+	}
+	for _, tt := range tests {
+		if got := apiKeyEndpointCategory(tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchModelScope(t *testing.T) {
+	tests := []struct {
+		pattern string
+		model   string
+		want    bool
+	}{
+		{"gpt-4o", "gpt-4o", true},
+		{"gpt-4o", "gpt-4o-mini", false},
+		{"claude-*", "claude-sonnet-4", true},
+		{"claude-*", "Claude-Opus-4", true},
+		{"*-mini", "gpt-4o-mini", true},
+		{"*-mini", "gpt-4o", false},
+		{"gemini-*-flash", "gemini-2.5-flash", true},
+		{"gemini-*-flash", "gemini-2.5-pro", false},
+		{"gemini-2.5-pro", "models/gemini-2.5-pro", true},
+		{"*", "anything", true},
+	}
+	for _, tt := range tests {
+		if got := matchModelScope(tt.pattern, tt.model); got != tt.want {
+			t.Errorf("matchModelScope(%q, %q) = %v, want %v", tt.pattern, tt.model, got, tt.want)
+		}
+	}
+}
+
+func runScopeCheck(t *testing.T, scopes *model.APIKeyScopes, method, path, body string) (*httptest.ResponseRecorder, bool) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(method, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return rec, enforceAPIKeyScopes(c, &model.UserAPIKey{ID: "key-1", Scopes: scopes})
+}
+
+func TestEnforceAPIKeyScopes(t *testing.T) {
+	scopes := &model.APIKeyScopes{
+		Models:    []string{"claude-*"},
+		Endpoints: []string{model.APIKeyEndpointChat, model.APIKeyEndpointModels},
+	}
+
+	if _, ok := runScopeCheck(t, scopes, http.MethodPost, "/v1/messages", `{"model":"claude-sonnet-4"}`); !ok {
+		t.Fatal("allowed model on an allowed endpoint should pass")
+	}
+	if _, ok := runScopeCheck(t, scopes, http.MethodGet, "/v1/models", ""); !ok {
+		t.Fatal("model listing should pass when granted")
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   string
+	}{
+		{"endpoint", http.MethodPost, "/api/threads", `{}`, "api_key_endpoint_not_allowed"},
+		{"embeddings", http.MethodPost, "/v1/embeddings", `{"model":"claude-sonnet-4"}`, "api_key_endpoint_not_allowed"},
+		{"model", http.MethodPost, "/v1/chat/completions", `{"model":"gpt-4o"}`, "api_key_model_not_allowed"},
+		{"path model", http.MethodPost, "/v1beta/models/gemini-2.5-pro:generateContent", `{}`, "api_key_model_not_allowed"},
+		{"missing model", http.MethodPost, "/v1/messages", `{}`, "api_key_model_not_allowed"},
+	}
+	for _, tc := range cases {
+		rec, ok := runScopeCheck(t, scopes, tc.method, tc.path, tc.body)
+		if ok {
+			t.Fatalf("%s: request should be rejected", tc.name)
+		}
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("%s: got status %d, want 403", tc.name, rec.Code)
+		}
+		var resp apiKeyScopeErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid error body: %v", tc.name, err)
+		}
+		if resp.Error.Code != tc.code || resp.Error.Type != "permission_error" {
+			t.Errorf("%s: got code %q type %q", tc.name, resp.Error.Code, resp.Error.Type)
+		}
+	}
+}
+
+func TestEnforceAPIKeyScopes_BatchChecksEveryRequestModel(t *testing.T) {
+	scopes := &model.APIKeyScopes{Models: []string{"claude-*"}}
+	body := `{"requests":[{"custom_id":"a","params":{"model":"claude-sonnet-4"}},{"custom_id":"b","params":{"model":"gpt-4o"}}]}`
+	rec, ok := runScopeCheck(t, scopes, http.MethodPost, "/v1/messages/batches", body)
+	if ok || rec.Code != http.StatusForbidden {
+		t.Fatalf("batch with a disallowed model should be rejected, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "gpt-4o") {
+		t.Errorf("error should name the rejected model: %s", rec.Body.String())
+	}
+}
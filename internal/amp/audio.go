@@ -0,0 +1,132 @@
+package amp
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// maxRequestBodySize JSON 请求体读取上限
+	maxRequestBodySize = 10 * 1024 * 1024
+	// maxAudioRequestBodySize 音频 multipart 请求体读取上限（OpenAI 单个音频文件上限 25MB，另留表单字段余量）
+	maxAudioRequestBodySize = 32 * 1024 * 1024
+	// maxMultipartFieldSize multipart 文本字段（如 model）读取上限
+	maxMultipartFieldSize = 1024
+)
+
+// audioProviderInfo 音频请求按 OpenAI 音频响应结构解析用量
+var audioProviderInfo = ProviderInfo{
+	Provider: ProviderOpenAIAudio,
+	Endpoint: "audio",
+}
+
+// audioPaths OpenAI 兼容的音频接口：转写、翻译为 multipart 上传，语音合成为 JSON
+var audioPaths = map[string]bool{
+	"/v1/audio/transcriptions": true,
+	"/v1/audio/translations":   true,
+	"/v1/audio/speech":         true,
+}
+
+// isAudioPath 判断是否为 /v1/audio/* 请求（含 /api/provider/:provider 前缀）
+func isAudioPath(path string) bool {
+	return audioPaths[passthroughEndpointPath(path)]
+}
+
+// isAudioSpeechPath 判断是否为语音合成请求
+func isAudioSpeechPath(path string) bool {
+	return passthroughEndpointPath(path) == "/v1/audio/speech"
+}
+
+// requestBodyLimit 代理读取请求体的上限，音频上传与批处理提交允许更大的请求体
+func requestBodyLimit(path string) int64 {
+	switch {
+	case isAudioPath(path):
+		return maxAudioRequestBodySize
+	case isBatchPath(path):
+		return maxBatchRequestBodySize
+	}
+	return maxRequestBodySize
+}
+
+// isMultipartForm 判断请求体是否为 multipart/form-data，返回 boundary
+func isMultipartForm(contentType string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return "", false
+	}
+	return params["boundary"], true
+}
+
+// extractMultipartModel 从 multipart 表单中读取 model 字段。
+// 只读取到 model 字段为止，已读取的部分与剩余请求体拼接后放回，音频文件不会被完整缓冲
+func extractMultipartModel(c *gin.Context, boundary string) string {
+	body := c.Request.Body
+	var consumed bytes.Buffer
+	reader := multipart.NewReader(io.TeeReader(io.LimitReader(body, maxAudioRequestBodySize), &consumed), boundary)
+	defer func() {
+		c.Request.Body = &multiReaderCloser{
+			Reader: io.MultiReader(&consumed, body),
+			Closer: body,
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() != "model" {
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, maxMultipartFieldSize))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(value))
+	}
+}
+
+// audioDurationSeconds 转写响应中的音频时长：whisper 返回 usage.type=duration，
+// verbose_json 格式另有顶层 duration 字段
+func audioDurationSeconds(body []byte) float64 {
+	if usage := gjson.GetBytes(body, "usage"); usage.Get("type").String() == "duration" {
+		return usage.Get("seconds").Float()
+	}
+	return gjson.GetBytes(body, "duration").Float()
+}
+
+// speechInputCharacters 语音合成请求的输入字符数
+func speechInputCharacters(body []byte) int {
+	return utf8.RuneCountInString(gjson.GetBytes(body, "input").String())
+}
+
+// isAudioPassthroughResponse 语音合成返回的音频数据与转写的 text/srt/vtt 结果不是 JSON，原样透传
+func isAudioPassthroughResponse(resp *http.Response, transInfo *TranslationInfo) bool {
+	if transInfo == nil || transInfo.OutgoingFormat != translator.FormatOpenAIAudio {
+		return false
+	}
+	contentType := resp.Header.Get("Content-Type")
+	return !strings.Contains(contentType, "json") && !strings.Contains(contentType, "text/event-stream")
+}
+
+// handleAudioPassthroughResponse 透传非 JSON 音频响应并在响应结束时写入日志。
+// 语音合成按请求的输入字符数计费，只在上游成功返回后记录
+func handleAudioPassthroughResponse(resp *http.Response, trace *RequestTrace, transInfo *TranslationInfo) {
+	if trace == nil {
+		return
+	}
+	if isAudioSpeechPath(resp.Request.URL.Path) {
+		trace.SetAudioUsage(0, speechInputCharacters(transInfo.OriginalRequestBody))
+	}
+	resp.Body = NewLoggingBodyWrapper(resp.Body, trace, resp.StatusCode, resp.Request.Context())
+}
@@ -0,0 +1,92 @@
+package amp
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsAudioPath(t *testing.T) {
+	cases := map[string]bool{
+		"/v1/audio/transcriptions":                    true,
+		"/api/provider/openai/v1/audio/translations":  true,
+		"/v1/audio/speech/":                           true,
+		"/v1/audio/voices":                            false,
+		"/v1/embeddings":                              false,
+		"/api/provider/openai/v1/audio/transcription": false,
+	}
+	for path, want := range cases {
+		if got := isAudioPath(path); got != want {
+			t.Errorf("isAudioPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if !IsModelInvocation(http.MethodPost, "/api/provider/openai/v1/audio/speech") {
+		t.Error("expected speech POST to be a model invocation")
+	}
+
+	channel := &model.Channel{Type: model.ChannelTypeOpenAI, Endpoint: model.ChannelEndpointResponses}
+	incoming := detectIncomingFormat("/v1/audio/transcriptions")
+	if got := requestChannelFormat(channel, incoming); got != translator.FormatOpenAIAudio {
+		t.Errorf("openai channel format = %s, want %s", got, translator.FormatOpenAIAudio)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/api/provider/openai/v1/audio/transcriptions", nil)
+	if got := getEndpointPath(channel, req); got != "/v1/audio/transcriptions" {
+		t.Errorf("endpoint path = %q, want /v1/audio/transcriptions", got)
+	}
+}
+
+func TestExtractModelName_Multipart(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "speech.mp3")
+	file.Write(bytes.Repeat([]byte{0xff, 0xfb, 0x90}, 4096))
+	form.WriteField("model", "whisper-1")
+	form.WriteField("response_format", "verbose_json")
+	form.Close()
+	raw := bytes.Clone(body.Bytes())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+
+	if got := extractModelName(c); got != "whisper-1" {
+		t.Fatalf("model = %q, want whisper-1", got)
+	}
+	restored, err := io.ReadAll(c.Request.Body)
+	if err != nil || !bytes.Equal(restored, raw) {
+		t.Fatalf("expected request body to be restored intact (err=%v, %d of %d bytes)", err, len(restored), len(raw))
+	}
+}
+
+func TestAudioUsage(t *testing.T) {
+	if got := audioDurationSeconds([]byte(`{"text":"hi","usage":{"type":"duration","seconds":12}}`)); got != 12 {
+		t.Errorf("duration usage = %v, want 12", got)
+	}
+	if got := audioDurationSeconds([]byte(`{"task":"transcribe","duration":8.5,"text":"hi"}`)); got != 8.5 {
+		t.Errorf("verbose_json duration = %v, want 8.5", got)
+	}
+	if got := speechInputCharacters([]byte(`{"model":"tts-1","input":"你好, world","voice":"alloy"}`)); got != 9 {
+		t.Errorf("speech characters = %d, want 9", got)
+	}
+
+	body := []byte(`{"text":"hi","usage":{"type":"tokens","input_tokens":14,"output_tokens":45,"total_tokens":59}}`)
+	usage := ExtractTokenUsage(body, audioProviderInfo)
+	if usage == nil || ptrToInt(usage.InputTokens) != 14 || ptrToInt(usage.OutputTokens) != 45 {
+		t.Fatalf("unexpected token usage: %+v", usage)
+	}
+	if ExtractTokenUsage([]byte(`{"text":"hi","usage":{"type":"duration","seconds":3}}`), audioProviderInfo) != nil {
+		t.Error("expected duration usage not to be reported as tokens")
+	}
+	if issues := validateResponseBody(ProviderOpenAIAudio, []byte("1\n00:00:00,000 --> 00:00:01,000\nhi\n")); len(issues) > 0 {
+		t.Errorf("unexpected validation issues for srt body: %v", issues)
+	}
+}
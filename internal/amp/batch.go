@@ -0,0 +1,879 @@
+package amp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	anthropicBatchesPath     = "/v1/messages/batches"
+	geminiBatchesPath        = "/v1beta/batches"
+	geminiModelsPathPrefix   = "/v1beta/models/"
+	geminiBatchCreateSuffix  = ":batchGenerateContent"
+	geminiBatchCancelSuffix  = ":cancel"
+	maxBatchRequestBodySize  = 256 << 20 // Anthropic Message Batches 的请求体上限
+	maxBatchResponseBodySize = 16 << 20  // 批处理对象与列表响应的读取上限（结果除外）
+	batchListDefaultLimit    = 20
+	batchListMaxLimit        = 100
+	// batchSettleInterval 后台检查未结算批处理任务的间隔
+	batchSettleInterval = 5 * time.Minute
+	// batchSettleTimeout 单个任务拉取结果并结算的超时
+	batchSettleTimeout = 10 * time.Minute
+	// batchResultRetention 上游保留批处理结果的时长（Anthropic 为 29 天），超过后结果无法获取，不再重试结算
+	batchResultRetention = 29 * 24 * time.Hour
+	// batchItemErrorType 批处理条目失败且上游没有给出错误类型时记录的错误类型
+	batchItemErrorType = "batch_item_error"
+)
+
+var batchJobRepo = repository.NewBatchJobRepository()
+
+type batchAction int
+
+const (
+	batchCreate batchAction = iota
+	batchList
+	batchRetrieve
+	batchResults
+	batchCancel
+	batchDelete
+)
+
+// batchRoute 解析后的批处理请求
+type batchRoute struct {
+	provider model.BatchProvider
+	action   batchAction
+	// path 上游路径（去掉 /api/provider/:provider 前缀）
+	path string
+	// id 上游批处理 ID：Anthropic 为 msgbatch_xxx，Gemini 为 batches/xxx
+	id string
+	// model Gemini 创建批处理时路径中的模型
+	model string
+}
+
+// isBatchPath 判断请求是否为批处理接口；批处理不是单次模型调用，模型映射、渠道路由等中间件跳过这些请求
+func isBatchPath(path string) bool {
+	p := normalizeProviderPath(strings.TrimSuffix(path, "/"))
+	return p == anthropicBatchesPath || strings.HasPrefix(p, anthropicBatchesPath+"/") ||
+		p == geminiBatchesPath || strings.HasPrefix(p, geminiBatchesPath+"/") ||
+		(strings.HasPrefix(p, geminiModelsPathPrefix) && strings.HasSuffix(p, geminiBatchCreateSuffix))
+}
+
+// isBatchCreateRequest 创建批处理的请求，与模型调用一样在提交前检查余额与额度
+func isBatchCreateRequest(method, path string) bool {
+	route, ok := parseBatchRoute(method, path)
+	return ok && route.action == batchCreate
+}
+
+func parseBatchRoute(method, path string) (batchRoute, bool) {
+	p := normalizeProviderPath(strings.TrimSuffix(path, "/"))
+	route := batchRoute{path: p}
+
+	switch {
+	case p == anthropicBatchesPath:
+		route.provider = model.BatchProviderAnthropic
+		switch method {
+		case http.MethodPost:
+			route.action = batchCreate
+		case http.MethodGet:
+			route.action = batchList
+		default:
+			return route, false
+		}
+		return route, true
+
+	case strings.HasPrefix(p, anthropicBatchesPath+"/"):
+		route.provider = model.BatchProviderAnthropic
+		id, sub, _ := strings.Cut(strings.TrimPrefix(p, anthropicBatchesPath+"/"), "/")
+		if id == "" {
+			return route, false
+		}
+		route.id = id
+		switch {
+		case sub == "" && method == http.MethodGet:
+			route.action = batchRetrieve
+		case sub == "" && method == http.MethodDelete:
+			route.action = batchDelete
+		case sub == "results" && method == http.MethodGet:
+			route.action = batchResults
+		case sub == "cancel" && method == http.MethodPost:
+			route.action = batchCancel
+		default:
+			return route, false
+		}
+		return route, true
+
+	case strings.HasPrefix(p, geminiModelsPathPrefix) && strings.HasSuffix(p, geminiBatchCreateSuffix):
+		route.provider = model.BatchProviderGemini
+		route.action = batchCreate
+		route.model = strings.TrimSuffix(strings.TrimPrefix(p, geminiModelsPathPrefix), geminiBatchCreateSuffix)
+		return route, method == http.MethodPost && route.model != ""
+
+	case p == geminiBatchesPath:
+		route.provider = model.BatchProviderGemini
+		route.action = batchList
+		return route, method == http.MethodGet
+
+	case strings.HasPrefix(p, geminiBatchesPath+"/"):
+		route.provider = model.BatchProviderGemini
+		name := strings.TrimPrefix(p, geminiBatchesPath+"/")
+		if trimmed, ok := strings.CutSuffix(name, geminiBatchCancelSuffix); ok {
+			if method != http.MethodPost {
+				return route, false
+			}
+			name = trimmed
+			route.action = batchCancel
+		} else {
+			switch method {
+			case http.MethodGet:
+				route.action = batchRetrieve
+			case http.MethodDelete:
+				route.action = batchDelete
+			default:
+				return route, false
+			}
+		}
+		if name == "" || strings.ContainsAny(name, "/:") {
+			return route, false
+		}
+		route.id = "batches/" + name
+		return route, true
+	}
+	return route, false
+}
+
+// batchRetrievePath 查询批处理对象的上游路径
+func batchRetrievePath(provider model.BatchProvider, id string) string {
+	if provider == model.BatchProviderGemini {
+		return "/v1beta/" + id
+	}
+	return anthropicBatchesPath + "/" + id
+}
+
+// batchChannelType 批处理请求原样透传，只能由同格式的渠道处理
+func batchChannelType(provider model.BatchProvider) model.ChannelType {
+	if provider == model.BatchProviderGemini {
+		return model.ChannelTypeGemini
+	}
+	return model.ChannelTypeClaude
+}
+
+// BatchProxyHandler 处理 Anthropic Message Batches 与 Gemini batchGenerateContent 接口。
+// 创建时按模型选择同格式的渠道并记录任务归属，之后的查询、取消、删除与结果下载都发往该渠道，且只允许提交者访问；
+// 批处理结束后拉取结果，每个条目写入一条请求日志并按批处理价格结算
+func BatchProxyHandler(upstreamHandler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsNativeMode(c) {
+			upstreamHandler(c)
+			return
+		}
+		route, ok := parseBatchRoute(c.Request.Method, c.Request.URL.Path)
+		if !ok {
+			c.JSON(http.StatusNotFound, NewStandardError(http.StatusNotFound, "unsupported batch endpoint"))
+			return
+		}
+		proxyCfg := GetProxyConfig(c.Request.Context())
+		if proxyCfg == nil {
+			c.JSON(http.StatusUnauthorized, NewStandardError(http.StatusUnauthorized, "missing API key"))
+			return
+		}
+
+		switch route.action {
+		case batchCreate:
+			handleBatchCreate(c, proxyCfg, route)
+		case batchList:
+			handleBatchList(c, proxyCfg, route)
+		default:
+			handleBatchJobRequest(c, proxyCfg, route)
+		}
+	}
+}
+
+func handleBatchCreate(c *gin.Context, proxyCfg *ProxyConfig, route batchRoute) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBatchRequestBodySize+1))
+	if isRequestBodyTooLarge(err) {
+		c.JSON(http.StatusRequestEntityTooLarge, NewStandardError(http.StatusRequestEntityTooLarge, "batch request body too large"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewStandardError(http.StatusBadRequest, "failed to read request body"))
+		return
+	}
+	if len(body) > maxBatchRequestBodySize {
+		c.JSON(http.StatusRequestEntityTooLarge, NewStandardError(http.StatusRequestEntityTooLarge, "batch request body too large"))
+		return
+	}
+	modelName, requestCount, err := batchRequestModel(route, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewStandardError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	wantType := batchChannelType(route.provider)
+	channel, err := channelService.SelectFailoverChannel(modelName, proxyCfg.GroupIDs, func(ch *model.Channel) bool {
+		return ch.Type != wantType
+	})
+	if err != nil {
+		log.Errorf("batch: failed to select channel for model %s: %v", modelName, err)
+		c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to select channel"))
+		return
+	}
+	if channel == nil {
+		c.JSON(http.StatusNotFound, NewStandardError(http.StatusNotFound, fmt.Sprintf("no %s channel available for batches of model %s", wantType, modelName)))
+		return
+	}
+
+	resp, err := doBatchUpstream(c.Request.Context(), channel, http.MethodPost, route.path, c.Request.URL.RawQuery, body, c.Request.Header, federationOnBehalfOf(proxyCfg))
+	if err != nil {
+		log.Warnf("batch: create request to channel %s failed: %v", channel.Name, err)
+		c.JSON(http.StatusBadGateway, NewStandardError(http.StatusBadGateway, "upstream request failed"))
+		return
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxBatchResponseBodySize))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, NewStandardError(http.StatusBadGateway, "failed to read upstream response"))
+		return
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if upstreamID := batchObjectID(route.provider, respBody); upstreamID != "" {
+			job := &model.BatchJob{
+				Provider:       route.provider,
+				UpstreamID:     upstreamID,
+				UserID:         proxyCfg.UserID,
+				APIKeyID:       proxyCfg.APIKeyID,
+				ChannelID:      channel.ID,
+				Model:          modelName,
+				RateMultiplier: proxyCfg.RateMultiplier,
+				RequestCount:   requestCount,
+			}
+			if err := batchJobRepo.Create(job); err != nil {
+				log.Errorf("batch: failed to record %s batch %s for user %s, it will not be billed: %v", route.provider, upstreamID, proxyCfg.UserID, err)
+			} else {
+				log.Infof("batch: user %s created %s batch %s (%d requests, model %s) on channel %s", proxyCfg.UserID, route.provider, upstreamID, requestCount, modelName, channel.Name)
+			}
+		} else {
+			log.Warnf("batch: %s batch created on channel %s without an id in the response, it will not be billed", route.provider, channel.Name)
+		}
+	}
+	writeBatchResponse(c, resp, respBody)
+}
+
+// batchRequestModel 返回批处理使用的模型与请求条数。
+// Anthropic 批处理的每个请求各自指定模型，经由渠道提交时要求所有请求使用同一模型（渠道按模型选择）
+func batchRequestModel(route batchRoute, body []byte) (string, int, error) {
+	if !gjson.ValidBytes(body) {
+		return "", 0, errors.New("request body must be valid JSON")
+	}
+	if route.provider == model.BatchProviderGemini {
+		count := 0
+		for _, path := range []string{"batch.input_config.requests.requests", "batch.inputConfig.requests.requests"} {
+			if requests := gjson.GetBytes(body, path); requests.IsArray() {
+				count = len(requests.Array())
+				break
+			}
+		}
+		return strings.TrimPrefix(route.model, "models/"), count, nil
+	}
+
+	requests := gjson.GetBytes(body, "requests")
+	if !requests.IsArray() || len(requests.Array()) == 0 {
+		return "", 0, errors.New("requests must be a non-empty array")
+	}
+	var modelName string
+	for i, item := range requests.Array() {
+		m := item.Get("params.model").String()
+		if m == "" {
+			return "", 0, fmt.Errorf("requests[%d].params.model is required", i)
+		}
+		if modelName == "" {
+			modelName = m
+		} else if m != modelName {
+			return "", 0, errors.New("all requests in a batch must use the same model")
+		}
+	}
+	return modelName, len(requests.Array()), nil
+}
+
+// batchObjectID 上游返回的批处理 ID
+func batchObjectID(provider model.BatchProvider, body []byte) string {
+	if provider == model.BatchProviderGemini {
+		if name := gjson.GetBytes(body, "name").String(); strings.HasPrefix(name, "batches/") {
+			return name
+		}
+		return gjson.GetBytes(body, "metadata.name").String()
+	}
+	return gjson.GetBytes(body, "id").String()
+}
+
+// batchEnded 批处理对象是否已结束（结果可以获取）
+func batchEnded(provider model.BatchProvider, body []byte) bool {
+	if provider == model.BatchProviderGemini {
+		if gjson.GetBytes(body, "done").Bool() {
+			return true
+		}
+		state := gjson.GetBytes(body, "metadata.state").String()
+		if state == "" {
+			state = gjson.GetBytes(body, "state").String()
+		}
+		for _, suffix := range []string{"_SUCCEEDED", "_FAILED", "_CANCELLED", "_EXPIRED"} {
+			if strings.HasSuffix(state, suffix) {
+				return true
+			}
+		}
+		return false
+	}
+	return gjson.GetBytes(body, "processing_status").String() == "ended"
+}
+
+func handleBatchJobRequest(c *gin.Context, proxyCfg *ProxyConfig, route batchRoute) {
+	job, channel, ok := loadUserBatchJob(c, proxyCfg, route)
+	if !ok {
+		return
+	}
+
+	// 删除后上游不再提供结果，先结算
+	if route.action == batchDelete && job.Status == model.BatchJobInProgress {
+		if err := settleBatchJob(c.Request.Context(), job); err != nil {
+			log.Warnf("batch: failed to settle %s batch %s before deletion: %v", job.Provider, job.UpstreamID, err)
+			c.JSON(http.StatusBadGateway, NewStandardError(http.StatusBadGateway, "failed to settle batch results before deletion, please retry"))
+			return
+		}
+	}
+
+	var body []byte
+	if route.action == batchCancel {
+		body = []byte("{}")
+	}
+	resp, err := doBatchUpstream(c.Request.Context(), channel, c.Request.Method, route.path, c.Request.URL.RawQuery, body, c.Request.Header, federationOnBehalfOf(proxyCfg))
+	if err != nil {
+		log.Warnf("batch: request to channel %s failed: %v", channel.Name, err)
+		c.JSON(http.StatusBadGateway, NewStandardError(http.StatusBadGateway, "upstream request failed"))
+		return
+	}
+	defer resp.Body.Close()
+
+	// 结果可能很大，直接流式转发
+	if route.action == batchResults {
+		copyBatchResponseHeaders(c, resp)
+		c.Status(resp.StatusCode)
+		if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+			log.Debugf("batch: results download of %s interrupted: %v", job.UpstreamID, err)
+		}
+		return
+	}
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxBatchResponseBodySize))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, NewStandardError(http.StatusBadGateway, "failed to read upstream response"))
+		return
+	}
+	if route.action == batchRetrieve && resp.StatusCode == http.StatusOK && job.Status == model.BatchJobInProgress && batchEnded(job.Provider, respBody) {
+		go settleBatchJobInBackground(job)
+	}
+	writeBatchResponse(c, resp, respBody)
+}
+
+// loadUserBatchJob 查找当前用户提交的批处理任务及其渠道，不存在时写入 404
+func loadUserBatchJob(c *gin.Context, proxyCfg *ProxyConfig, route batchRoute) (*model.BatchJob, *model.Channel, bool) {
+	job, err := batchJobRepo.GetByUpstreamID(route.provider, route.id)
+	if err != nil {
+		log.Errorf("batch: failed to load batch %s: %v", route.id, err)
+		c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to load batch"))
+		return nil, nil, false
+	}
+	if job == nil || job.UserID != proxyCfg.UserID {
+		c.JSON(http.StatusNotFound, NewStandardError(http.StatusNotFound, "batch not found"))
+		return nil, nil, false
+	}
+	channel, err := channelService.GetChannelInternal(job.ChannelID)
+	if err != nil {
+		log.Errorf("batch: failed to load channel %s of batch %s: %v", job.ChannelID, job.UpstreamID, err)
+		c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to load batch channel"))
+		return nil, nil, false
+	}
+	if channel == nil {
+		c.JSON(http.StatusNotFound, NewStandardError(http.StatusNotFound, "the channel that processed this batch no longer exists"))
+		return nil, nil, false
+	}
+	return job, channel, true
+}
+
+// handleBatchList 列出当前用户提交的批处理任务。上游的列表包含同一渠道上其他用户的任务，
+// 因此按本地记录分页，逐个向任务所在渠道查询最新状态
+func handleBatchList(c *gin.Context, proxyCfg *ProxyConfig, route batchRoute) {
+	limitParam, cursorParam := "limit", "after_id"
+	if route.provider == model.BatchProviderGemini {
+		limitParam, cursorParam = "pageSize", "pageToken"
+	}
+	limit := batchListDefaultLimit
+	if v, err := strconv.Atoi(c.Query(limitParam)); err == nil && v > 0 {
+		limit = min(v, batchListMaxLimit)
+	}
+	var before *time.Time
+	if cursor := c.Query(cursorParam); cursor != "" {
+		job, err := batchJobRepo.GetByUpstreamID(route.provider, cursor)
+		if err != nil || job == nil || job.UserID != proxyCfg.UserID {
+			c.JSON(http.StatusBadRequest, NewStandardError(http.StatusBadRequest, "invalid "+cursorParam))
+			return
+		}
+		before = &job.CreatedAt
+	}
+
+	jobs, err := batchJobRepo.ListByUser(proxyCfg.UserID, route.provider, before, limit+1)
+	if err != nil {
+		log.Errorf("batch: failed to list batches of user %s: %v", proxyCfg.UserID, err)
+		c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to list batches"))
+		return
+	}
+	hasMore := len(jobs) > limit
+	if hasMore {
+		jobs = jobs[:limit]
+	}
+
+	items := make([]json.RawMessage, 0, len(jobs))
+	for _, job := range jobs {
+		items = append(items, fetchBatchObject(c.Request.Context(), job, proxyCfg))
+	}
+
+	if route.provider == model.BatchProviderGemini {
+		resp := gin.H{"operations": items}
+		if hasMore {
+			resp["nextPageToken"] = jobs[len(jobs)-1].UpstreamID
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	var firstID, lastID interface{}
+	if len(jobs) > 0 {
+		firstID, lastID = jobs[0].UpstreamID, jobs[len(jobs)-1].UpstreamID
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items, "has_more": hasMore, "first_id": firstID, "last_id": lastID})
+}
+
+// fetchBatchObject 查询任务在上游的最新状态，查询失败时返回只含 ID 的对象
+func fetchBatchObject(ctx context.Context, job *model.BatchJob, proxyCfg *ProxyConfig) json.RawMessage {
+	fallback := func() json.RawMessage {
+		var obj map[string]interface{}
+		if job.Provider == model.BatchProviderGemini {
+			obj = map[string]interface{}{"name": job.UpstreamID}
+		} else {
+			obj = map[string]interface{}{"id": job.UpstreamID, "type": "message_batch", "created_at": job.CreatedAt.Format(time.RFC3339)}
+		}
+		raw, _ := json.Marshal(obj)
+		return raw
+	}
+
+	channel, err := channelService.GetChannelInternal(job.ChannelID)
+	if err != nil || channel == nil {
+		return fallback()
+	}
+	resp, err := doBatchUpstream(ctx, channel, http.MethodGet, batchRetrievePath(job.Provider, job.UpstreamID), "", nil, nil, federationOnBehalfOf(proxyCfg))
+	if err != nil {
+		return fallback()
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBatchResponseBodySize))
+	if err != nil || resp.StatusCode != http.StatusOK || !gjson.ValidBytes(body) {
+		return fallback()
+	}
+	if job.Status == model.BatchJobInProgress && batchEnded(job.Provider, body) {
+		go settleBatchJobInBackground(job)
+	}
+	return body
+}
+
+// doBatchUpstream 向渠道发送批处理请求。clientHeader 不为空时按渠道策略透传客户端的 Anthropic-Beta
+func doBatchUpstream(ctx context.Context, channel *model.Channel, method, path, rawQuery string, body []byte, clientHeader http.Header, onBehalfOf string) (*http.Response, error) {
+	upstreamURL, err := url.Parse(channel.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	upstreamURL.Path = strings.TrimSuffix(upstreamURL.Path, "/") + path
+	if rawQuery != "" {
+		q, _ := url.ParseQuery(rawQuery)
+		// Gemini 客户端可能通过 ?key= 传递本服务的 API Key，不能转发给上游
+		q.Del("key")
+		upstreamURL.RawQuery = q.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, upstreamURL.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if channel.Type == model.ChannelTypeClaude && clientHeader != nil {
+		if beta := clientHeader.Get("Anthropic-Beta"); beta != "" {
+			req.Header.Set("Anthropic-Beta", beta)
+		}
+		applyAnthropicBetaPolicy(req, channel)
+	}
+	applyChannelAuth(channel, req)
+	if channel.FederationIssuer != "" {
+		signChannelRequest(channel, req, onBehalfOf)
+	}
+	return (&http.Client{Transport: channelTransport(channel)}).Do(req)
+}
+
+func copyBatchResponseHeaders(c *gin.Context, resp *http.Response) {
+	for _, name := range []string{"Content-Type", "Content-Disposition", "Request-Id"} {
+		if v := resp.Header.Get(name); v != "" {
+			c.Header(name, v)
+		}
+	}
+}
+
+func writeBatchResponse(c *gin.Context, resp *http.Response, body []byte) {
+	copyBatchResponseHeaders(c, resp)
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	c.Data(resp.StatusCode, contentType, body)
+}
+
+// batchItem 批处理中一个条目的结算信息
+type batchItem struct {
+	key        string
+	model      string
+	usage      *TokenUsage
+	statusCode int
+	errorType  string
+}
+
+func settleBatchJobInBackground(job *model.BatchJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), batchSettleTimeout)
+	defer cancel()
+	if err := settleBatchJob(ctx, job); err != nil {
+		log.Warnf("batch: failed to settle %s batch %s: %v", job.Provider, job.UpstreamID, err)
+	}
+}
+
+// settleBatchJob 批处理结束后拉取全部结果，每个条目写入一条请求日志并按批处理价格结算。
+// 批处理尚未结束时不做处理；通过状态迁移保证同一任务只结算一次
+func settleBatchJob(ctx context.Context, job *model.BatchJob) error {
+	channel, err := channelService.GetChannelInternal(job.ChannelID)
+	if err != nil {
+		return err
+	}
+	proxyCfg := &ProxyConfig{UserID: job.UserID, APIKeyID: job.APIKeyID, RateMultiplier: job.RateMultiplier}
+	onBehalfOf := federationOnBehalfOf(proxyCfg)
+
+	if channel != nil {
+		ended, err := fetchBatchEnded(ctx, channel, job, onBehalfOf)
+		if err != nil && time.Since(job.CreatedAt) > batchResultRetention {
+			// 超过上游保留期仍查询失败（通常已被删除），不再重试
+			if claimed, claimErr := batchJobRepo.MarkSettling(job.ID); claimErr == nil && claimed {
+				_, _ = batchJobRepo.MarkFailed(job.ID, err.Error())
+			}
+			return err
+		}
+		if err != nil || !ended {
+			return err
+		}
+	}
+	claimed, err := batchJobRepo.MarkSettling(job.ID)
+	if err != nil || !claimed {
+		return err
+	}
+	if channel == nil {
+		_, err := batchJobRepo.MarkFailed(job.ID, "渠道已删除，无法获取批处理结果")
+		return err
+	}
+
+	// 先解析全部结果再逐条结算：解析失败时不产生任何扣费，可以安全重试
+	var items []batchItem
+	info := ProviderInfoFromChannel(channel)
+	collect := func(item batchItem) {
+		if item.model == "" {
+			item.model = job.Model
+		}
+		items = append(items, item)
+	}
+	if job.Provider == model.BatchProviderGemini {
+		err = fetchGeminiBatchResults(ctx, channel, job, onBehalfOf, info, collect)
+	} else {
+		err = fetchAnthropicBatchResults(ctx, channel, job, onBehalfOf, info, collect)
+	}
+	if err != nil {
+		if time.Since(job.CreatedAt) > batchResultRetention {
+			_, _ = batchJobRepo.MarkFailed(job.ID, err.Error())
+		} else {
+			_, _ = batchJobRepo.ReleaseSettling(job.ID, err.Error())
+		}
+		return err
+	}
+
+	var totalMicros int64
+	for _, item := range items {
+		totalMicros += recordBatchItem(job, channel, proxyCfg, item)
+	}
+	if _, err := batchJobRepo.MarkSettled(job.ID, len(items), totalMicros, time.Now().UTC()); err != nil {
+		return err
+	}
+	log.Infof("batch: settled %s batch %s of user %s: %d items, cost %d micros", job.Provider, job.UpstreamID, job.UserID, len(items), totalMicros)
+	return nil
+}
+
+func fetchBatchEnded(ctx context.Context, channel *model.Channel, job *model.BatchJob, onBehalfOf string) (bool, error) {
+	resp, err := doBatchUpstream(ctx, channel, http.MethodGet, batchRetrievePath(job.Provider, job.UpstreamID), "", nil, nil, onBehalfOf)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBatchResponseBodySize))
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("查询批处理返回 HTTP %d", resp.StatusCode)
+	}
+	return batchEnded(job.Provider, body), nil
+}
+
+// recordBatchItem 写入条目的请求日志并结算，返回结算金额
+func recordBatchItem(job *model.BatchJob, channel *model.Channel, proxyCfg *ProxyConfig, item batchItem) int64 {
+	trace := NewRequestTrace(uuid.New().String(), job.UserID, job.APIKeyID, http.MethodPost, batchItemLogPath(job, item.key))
+	trace.Batch = true
+	trace.SetModels(job.Model, item.model)
+	trace.SetChannel(channel.ID, string(channel.Type), channel.BaseURL)
+	if item.usage != nil {
+		trace.SetUsage(item.usage.InputTokens, item.usage.OutputTokens, item.usage.CacheReadInputTokens, item.usage.CacheCreationInputTokens)
+	}
+	// 先写入日志记录，结算时需要更新其计费状态
+	writer := GetLogWriter()
+	if writer != nil {
+		writer.WritePendingFromTrace(trace)
+	}
+	trace.SetResponse(item.statusCode)
+	if item.errorType != "" {
+		trace.SetError(item.errorType)
+	}
+	settleTraceCost(trace, proxyCfg)
+	if writer != nil {
+		writer.UpdateFromTrace(trace)
+	}
+	if cost := trace.Clone().CostMicros; cost != nil {
+		return *cost
+	}
+	return 0
+}
+
+// batchItemLogPath 条目请求日志的路径：批处理路径加条目的 custom_id（Gemini 为 key）
+func batchItemLogPath(job *model.BatchJob, key string) string {
+	path := batchRetrievePath(job.Provider, job.UpstreamID)
+	if key == "" {
+		return path
+	}
+	return path + "/" + url.PathEscape(key)
+}
+
+func fetchAnthropicBatchResults(ctx context.Context, channel *model.Channel, job *model.BatchJob, onBehalfOf string, info ProviderInfo, fn func(batchItem)) error {
+	resp, err := doBatchUpstream(ctx, channel, http.MethodGet, anthropicBatchesPath+"/"+job.UpstreamID+"/results", "", nil, nil, onBehalfOf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("获取批处理结果返回 HTTP %d", resp.StatusCode)
+	}
+	return parseAnthropicBatchResults(resp.Body, info, fn)
+}
+
+// parseAnthropicBatchResults 解析 Message Batches 的 JSONL 结果。已取消或过期的条目未经处理，不产生日志
+func parseAnthropicBatchResults(r io.Reader, info ProviderInfo, fn func(batchItem)) error {
+	return readJSONLines(r, func(line []byte) {
+		result := gjson.GetBytes(line, "result")
+		item := batchItem{key: gjson.GetBytes(line, "custom_id").String()}
+		switch result.Get("type").String() {
+		case "succeeded":
+			message := result.Get("message")
+			item.model = message.Get("model").String()
+			item.usage = ExtractTokenUsage([]byte(message.Raw), info)
+			item.statusCode = http.StatusOK
+		case "errored":
+			item.errorType = result.Get("error.error.type").String()
+			if item.errorType == "" {
+				item.errorType = batchItemErrorType
+			}
+			item.statusCode = http.StatusInternalServerError
+			if item.errorType == "invalid_request_error" {
+				item.statusCode = http.StatusBadRequest
+			}
+		default:
+			return
+		}
+		fn(item)
+	})
+}
+
+func fetchGeminiBatchResults(ctx context.Context, channel *model.Channel, job *model.BatchJob, onBehalfOf string, info ProviderInfo, fn func(batchItem)) error {
+	resp, err := doBatchUpstream(ctx, channel, http.MethodGet, batchRetrievePath(job.Provider, job.UpstreamID), "", nil, nil, onBehalfOf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("查询批处理返回 HTTP %d", resp.StatusCode)
+	}
+
+	output := gjson.GetBytes(body, "response")
+	if !output.Exists() {
+		output = gjson.GetBytes(body, "output")
+	}
+	if file := firstGJSON(output, "responsesFile", "responses_file").String(); file != "" {
+		fileResp, err := doBatchUpstream(ctx, channel, http.MethodGet, "/download/v1beta/"+file+":download", "alt=media", nil, nil, onBehalfOf)
+		if err != nil {
+			return err
+		}
+		defer fileResp.Body.Close()
+		if fileResp.StatusCode != http.StatusOK {
+			return fmt.Errorf("下载批处理结果文件返回 HTTP %d", fileResp.StatusCode)
+		}
+		return readJSONLines(fileResp.Body, func(line []byte) {
+			fn(parseGeminiBatchItem(gjson.ParseBytes(line), info))
+		})
+	}
+	firstGJSON(output, "inlinedResponses.inlinedResponses", "inlined_responses.inlined_responses").ForEach(func(_, value gjson.Result) bool {
+		fn(parseGeminiBatchItem(value, info))
+		return true
+	})
+	return nil
+}
+
+// parseGeminiBatchItem 解析 Gemini 批处理的一个结果：内联结果的 key 在 metadata 中，结果文件中为顶层 key
+func parseGeminiBatchItem(value gjson.Result, info ProviderInfo) batchItem {
+	item := batchItem{key: firstGJSON(value, "metadata.key", "key").String()}
+	if response := value.Get("response"); response.Exists() {
+		item.model = response.Get("modelVersion").String()
+		item.usage = ExtractTokenUsage([]byte(response.Raw), info)
+		item.statusCode = http.StatusOK
+		return item
+	}
+	item.statusCode = int(value.Get("error.code").Int())
+	if item.statusCode == 0 {
+		item.statusCode = http.StatusInternalServerError
+	}
+	item.errorType = strings.ToLower(value.Get("error.status").String())
+	if item.errorType == "" {
+		item.errorType = batchItemErrorType
+	}
+	return item
+}
+
+func firstGJSON(value gjson.Result, paths ...string) gjson.Result {
+	for _, path := range paths {
+		if r := value.Get(path); r.Exists() {
+			return r
+		}
+	}
+	return gjson.Result{}
+}
+
+// readJSONLines 逐行读取 JSONL，跳过空行；任意一行不是合法 JSON 时返回错误
+func readJSONLines(r io.Reader, fn func([]byte)) error {
+	reader := bufio.NewReader(r)
+	lineNo := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			lineNo++
+			if !gjson.ValidBytes(line) {
+				return fmt.Errorf("结果第 %d 行不是合法的 JSON", lineNo)
+			}
+			fn(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// BatchSettler 定期检查未结算的批处理任务，客户端不再轮询的任务结束后同样会被结算
+type BatchSettler struct {
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+var globalBatchSettler *BatchSettler
+
+// InitBatchSettler 启动批处理结算任务
+func InitBatchSettler() {
+	globalBatchSettler = &BatchSettler{stopChan: make(chan struct{})}
+	globalBatchSettler.wg.Add(1)
+	go globalBatchSettler.run()
+	log.Info("batch: settler started")
+}
+
+// StopBatchSettler 停止批处理结算任务
+func StopBatchSettler() {
+	if globalBatchSettler == nil {
+		return
+	}
+	globalBatchSettler.stopOnce.Do(func() { close(globalBatchSettler.stopChan) })
+	globalBatchSettler.wg.Wait()
+	log.Info("batch: settler stopped")
+}
+
+func (s *BatchSettler) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(batchSettleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.settlePending()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+func (s *BatchSettler) settlePending() {
+	jobs, err := batchJobRepo.ListByStatus(model.BatchJobInProgress)
+	if err != nil {
+		log.Warnf("batch: failed to list unsettled batches: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		select {
+		case <-s.stopChan:
+			return
+		default:
+		}
+		settleBatchJobInBackground(job)
+	}
+}
@@ -0,0 +1,157 @@
+package amp
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/model"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestParseBatchRoute(t *testing.T) {
+	cases := []struct {
+		method, path string
+		provider     model.BatchProvider
+		action       batchAction
+		id, model    string
+	}{
+		{http.MethodPost, "/v1/messages/batches", model.BatchProviderAnthropic, batchCreate, "", ""},
+		{http.MethodGet, "/api/provider/anthropic/v1/messages/batches", model.BatchProviderAnthropic, batchList, "", ""},
+		{http.MethodGet, "/v1/messages/batches/msgbatch_1", model.BatchProviderAnthropic, batchRetrieve, "msgbatch_1", ""},
+		{http.MethodGet, "/v1/messages/batches/msgbatch_1/results", model.BatchProviderAnthropic, batchResults, "msgbatch_1", ""},
+		{http.MethodPost, "/v1/messages/batches/msgbatch_1/cancel", model.BatchProviderAnthropic, batchCancel, "msgbatch_1", ""},
+		{http.MethodDelete, "/v1/messages/batches/msgbatch_1", model.BatchProviderAnthropic, batchDelete, "msgbatch_1", ""},
+		{http.MethodPost, "/v1beta/models/gemini-2.5-flash:batchGenerateContent", model.BatchProviderGemini, batchCreate, "", "gemini-2.5-flash"},
+		{http.MethodGet, "/v1beta/batches", model.BatchProviderGemini, batchList, "", ""},
+		{http.MethodGet, "/v1beta/batches/abc", model.BatchProviderGemini, batchRetrieve, "batches/abc", ""},
+		{http.MethodPost, "/api/provider/google/v1beta/batches/abc:cancel", model.BatchProviderGemini, batchCancel, "batches/abc", ""},
+		{http.MethodDelete, "/v1beta/batches/abc", model.BatchProviderGemini, batchDelete, "batches/abc", ""},
+	}
+	for _, tc := range cases {
+		route, ok := parseBatchRoute(tc.method, tc.path)
+		if !ok {
+			t.Errorf("%s %s: expected a batch route", tc.method, tc.path)
+			continue
+		}
+		if route.provider != tc.provider || route.action != tc.action || route.id != tc.id || route.model != tc.model {
+			t.Errorf("%s %s: unexpected route %+v", tc.method, tc.path, route)
+		}
+	}
+
+	for _, bad := range [][2]string{
+		{http.MethodPut, "/v1/messages/batches"},
+		{http.MethodGet, "/v1/messages/batches/msgbatch_1/cancel"},
+		{http.MethodGet, "/v1beta/batches/abc:cancel"},
+		{http.MethodPost, "/v1beta/models/gemini-2.5-flash:generateContent"},
+	} {
+		if _, ok := parseBatchRoute(bad[0], bad[1]); ok {
+			t.Errorf("%s %s should not be a batch route", bad[0], bad[1])
+		}
+	}
+}
+
+func TestBatchPathsAreNotModelInvocations(t *testing.T) {
+	if IsModelInvocation(http.MethodPost, "/v1beta/models/gemini-2.5-flash:batchGenerateContent") {
+		t.Error("gemini batch creation must not be treated as a single model invocation")
+	}
+	if IsModelInvocation(http.MethodPost, "/api/provider/anthropic/v1/messages/batches") {
+		t.Error("anthropic batch creation must not be treated as a single model invocation")
+	}
+	if !IsModelInvocation(http.MethodPost, "/v1beta/models/gemini-2.5-flash:generateContent") {
+		t.Error("generateContent is still a model invocation")
+	}
+	if !isBatchCreateRequest(http.MethodPost, "/v1/messages/batches") || isBatchCreateRequest(http.MethodGet, "/v1/messages/batches") {
+		t.Error("only batch submissions should be checked for quota")
+	}
+}
+
+func TestBatchRequestModel(t *testing.T) {
+	route := batchRoute{provider: model.BatchProviderAnthropic}
+	body := `{"requests":[{"custom_id":"a","params":{"model":"claude-sonnet-4","max_tokens":10,"messages":[]}},` +
+		`{"custom_id":"b","params":{"model":"claude-sonnet-4","max_tokens":10,"messages":[]}}]}`
+	modelName, count, err := batchRequestModel(route, []byte(body))
+	if err != nil || modelName != "claude-sonnet-4" || count != 2 {
+		t.Fatalf("unexpected result model=%q count=%d err=%v", modelName, count, err)
+	}
+
+	mixed := strings.Replace(body, `"b","params":{"model":"claude-sonnet-4"`, `"b","params":{"model":"claude-haiku-4"`, 1)
+	if _, _, err := batchRequestModel(route, []byte(mixed)); err == nil {
+		t.Fatal("mixed models should be rejected")
+	}
+
+	gemini := batchRoute{provider: model.BatchProviderGemini, model: "models/gemini-2.5-flash"}
+	geminiBody := `{"batch":{"display_name":"x","input_config":{"requests":{"requests":[{"request":{},"metadata":{"key":"1"}},{"request":{},"metadata":{"key":"2"}}]}}}}`
+	modelName, count, err = batchRequestModel(gemini, []byte(geminiBody))
+	if err != nil || modelName != "gemini-2.5-flash" || count != 2 {
+		t.Fatalf("unexpected gemini result model=%q count=%d err=%v", modelName, count, err)
+	}
+}
+
+func TestBatchEnded(t *testing.T) {
+	if !batchEnded(model.BatchProviderAnthropic, []byte(`{"id":"msgbatch_1","processing_status":"ended"}`)) {
+		t.Error("anthropic batch with processing_status=ended should be ended")
+	}
+	if batchEnded(model.BatchProviderAnthropic, []byte(`{"id":"msgbatch_1","processing_status":"in_progress"}`)) {
+		t.Error("in-progress anthropic batch should not be ended")
+	}
+	if !batchEnded(model.BatchProviderGemini, []byte(`{"name":"batches/1","metadata":{"state":"BATCH_STATE_SUCCEEDED"}}`)) {
+		t.Error("succeeded gemini batch should be ended")
+	}
+	if batchEnded(model.BatchProviderGemini, []byte(`{"name":"batches/1","metadata":{"state":"BATCH_STATE_RUNNING"}}`)) {
+		t.Error("running gemini batch should not be ended")
+	}
+}
+
+func TestParseAnthropicBatchResults(t *testing.T) {
+	results := `{"custom_id":"a","result":{"type":"succeeded","message":{"model":"claude-sonnet-4-20250514","usage":{"input_tokens":100,"output_tokens":20}}}}
+{"custom_id":"b","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}}}
+
+{"custom_id":"c","result":{"type":"canceled"}}
+`
+	var items []batchItem
+	err := parseAnthropicBatchResults(strings.NewReader(results), ProviderInfo{Provider: ProviderAnthropic}, func(item batchItem) {
+		items = append(items, item)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("canceled items should be skipped, got %d items", len(items))
+	}
+	if items[0].key != "a" || items[0].model != "claude-sonnet-4-20250514" || items[0].usage == nil ||
+		ptrToInt(items[0].usage.InputTokens) != 100 || ptrToInt(items[0].usage.OutputTokens) != 20 {
+		t.Errorf("unexpected succeeded item %+v", items[0])
+	}
+	if items[1].statusCode != http.StatusBadRequest || items[1].errorType != "invalid_request_error" || items[1].usage != nil {
+		t.Errorf("unexpected errored item %+v", items[1])
+	}
+
+	if err := parseAnthropicBatchResults(strings.NewReader("{not json}\n"), ProviderInfo{Provider: ProviderAnthropic}, func(batchItem) {}); err == nil {
+		t.Error("malformed results should fail so the batch can be settled later")
+	}
+}
+
+func TestParseGeminiBatchResultFile(t *testing.T) {
+	results := `{"key":"1","response":{"candidates":[],"modelVersion":"gemini-2.5-flash","usageMetadata":{"promptTokenCount":40,"candidatesTokenCount":8,"totalTokenCount":48}}}
+{"key":"2","error":{"code":429,"message":"quota","status":"RESOURCE_EXHAUSTED"}}
+`
+	var items []batchItem
+	info := ProviderInfo{Provider: ProviderGemini}
+	err := readJSONLines(strings.NewReader(results), func(line []byte) {
+		items = append(items, parseGeminiBatchItem(gjson.ParseBytes(line), info))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+	if items[0].key != "1" || items[0].model != "gemini-2.5-flash" || items[0].usage == nil || ptrToInt(items[0].usage.InputTokens) != 40 {
+		t.Errorf("unexpected succeeded item %+v", items[0])
+	}
+	if items[1].statusCode != http.StatusTooManyRequests || items[1].errorType != "resource_exhausted" {
+		t.Errorf("unexpected failed item %+v", items[1])
+	}
+}
@@ -0,0 +1,191 @@
+package amp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultVolatileFields 请求中每次都会变化、不影响语义的字段（点分路径，从根开始）
+// 计算请求指纹时默认剔除，使缓存/合并/幂等层对同一语义的请求得到相同结果
+var DefaultVolatileFields = []string{
+	"metadata.user_id", // Claude Code 会话 ID
+	"user",             // OpenAI 终端用户标识
+	"request_id",
+	"timestamp",
+	"created",
+	"created_at",
+	"stream_options",
+}
+
+// CanonicalOptions 规范化选项
+type CanonicalOptions struct {
+	// StripPaths 需要剔除的字段（点分路径）；为 nil 时使用 DefaultVolatileFields
+	StripPaths []string
+	// KeepAll 为 true 时不剔除任何字段
+	KeepAll bool
+}
+
+// CanonicalizeJSON 将 JSON 规范化为稳定的字节序列：
+// 对象键排序、去除无意义空白、数字统一格式、剔除易变字段
+func CanonicalizeJSON(data []byte, opts CanonicalOptions) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("canonical json: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("canonical json: unexpected trailing data")
+	}
+
+	if !opts.KeepAll {
+		paths := opts.StripPaths
+		if paths == nil {
+			paths = DefaultVolatileFields
+		}
+		for _, path := range paths {
+			stripPath(value, strings.Split(path, "."))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CanonicalHash 返回规范化 JSON 的 SHA-256 十六进制摘要
+func CanonicalHash(data []byte, opts CanonicalOptions) (string, error) {
+	canonical, err := CanonicalizeJSON(data, opts)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// stripPath 从对象中删除指定路径的字段；中间节点不存在或不是对象时忽略
+func stripPath(value any, segments []string) {
+	obj, ok := value.(map[string]any)
+	if !ok || len(segments) == 0 {
+		return
+	}
+	if len(segments) == 1 {
+		delete(obj, segments[0])
+		return
+	}
+	stripPath(obj[segments[0]], segments[1:])
+}
+
+func writeCanonical(buf *bytes.Buffer, value any) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case json.Number:
+		normalized, err := normalizeNumber(v.String())
+		if err != nil {
+			return err
+		}
+		buf.WriteString(normalized)
+	case string:
+		writeCanonicalString(buf, v)
+	case []any:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("canonical json: unsupported type %T", value)
+	}
+	return nil
+}
+
+// writeCanonicalString 写入 JSON 字符串（不转义 HTML 字符，保证与原文一致的可读性）
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	var tmp bytes.Buffer
+	encoder := json.NewEncoder(&tmp)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	buf.Write(bytes.TrimSuffix(tmp.Bytes(), []byte("\n")))
+}
+
+// normalizeNumber 统一数字格式：整数值输出为十进制整数（1.0、1e2 → 1、100），
+// 其余按 float64 最短表示输出
+func normalizeNumber(raw string) (string, error) {
+	// 不含指数的数字用精确有理数处理，避免大整数丢失精度；
+	// 含指数的走 float64，防止 1e999999 之类的输入展开成超大整数
+	if !strings.ContainsAny(raw, "eE") {
+		rat, ok := new(big.Rat).SetString(raw)
+		if !ok {
+			return "", fmt.Errorf("canonical json: invalid number %q", raw)
+		}
+		if rat.IsInt() {
+			return rat.Num().String(), nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return "", fmt.Errorf("canonical json: invalid number %q", raw)
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return strconv.FormatInt(int64(f), 10), nil
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
+
+// RequestFingerprint 计算请求指纹（方法 + 路径 + 规范化请求体），
+// 请求体不是合法 JSON 时退化为原始字节摘要
+func RequestFingerprint(method, path string, body []byte) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(strings.ToUpper(method)))
+	hasher.Write([]byte{0})
+	hasher.Write([]byte(path))
+	hasher.Write([]byte{0})
+	if canonical, err := CanonicalizeJSON(body, CanonicalOptions{}); err == nil {
+		hasher.Write(canonical)
+	} else {
+		hasher.Write(body)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,84 @@
+package amp
+
+import "testing"
+
+func TestCanonicalizeJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  CanonicalOptions
+		want  string
+	}{
+		{
+			name:  "sorts keys and strips whitespace",
+			input: "{ \"b\": 1,\n \"a\": { \"d\": [1, 2], \"c\": null } }",
+			want:  `{"a":{"c":null,"d":[1,2]},"b":1}`,
+		},
+		{
+			name:  "normalizes numbers",
+			input: `{"a":1.0,"b":1e2,"c":0.50,"d":-0,"e":12345678901234567890}`,
+			want:  `{"a":1,"b":100,"c":0.5,"d":0,"e":12345678901234567890}`,
+		},
+		{
+			name:  "strips default volatile fields",
+			input: `{"model":"m","metadata":{"user_id":"session-1","tag":"x"},"user":"u","timestamp":123}`,
+			want:  `{"metadata":{"tag":"x"},"model":"m"}`,
+		},
+		{
+			name:  "custom strip paths",
+			input: `{"model":"m","temperature":0.7,"user":"u"}`,
+			opts:  CanonicalOptions{StripPaths: []string{"temperature"}},
+			want:  `{"model":"m","user":"u"}`,
+		},
+		{
+			name:  "keep all",
+			input: `{"user":"u"}`,
+			opts:  CanonicalOptions{KeepAll: true},
+			want:  `{"user":"u"}`,
+		},
+		{
+			name:  "does not escape html",
+			input: `{"text":"<b>a & b</b>"}`,
+			want:  `{"text":"<b>a & b</b>"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalizeJSON([]byte(tt.input), tt.opts)
+			if err != nil {
+				t.Fatalf("CanonicalizeJSON() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("CanonicalizeJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeJSONRejectsInvalid(t *testing.T) {
+	for _, input := range []string{`{"a":`, `{"a":1} {"b":2}`, ``} {
+		if _, err := CanonicalizeJSON([]byte(input), CanonicalOptions{}); err == nil {
+			t.Errorf("CanonicalizeJSON(%q) expected error", input)
+		}
+	}
+}
+
+func TestRequestFingerprintStable(t *testing.T) {
+	a := RequestFingerprint("post", "/v1/messages", []byte(`{"model":"m","max_tokens":1024,"metadata":{"user_id":"s1"}}`))
+	b := RequestFingerprint("POST", "/v1/messages", []byte(`{"max_tokens":1024.0, "model":"m","metadata":{"user_id":"s2"}}`))
+	if a != b {
+		t.Errorf("fingerprints differ for equivalent requests: %s vs %s", a, b)
+	}
+
+	c := RequestFingerprint("POST", "/v1/messages", []byte(`{"model":"other","max_tokens":1024}`))
+	if a == c {
+		t.Error("fingerprints equal for different requests")
+	}
+
+	raw1 := RequestFingerprint("POST", "/upload", []byte("not json"))
+	raw2 := RequestFingerprint("POST", "/upload", []byte("not json"))
+	if raw1 != raw2 {
+		t.Error("fingerprint for non-JSON body is not stable")
+	}
+}
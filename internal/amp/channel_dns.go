@@ -0,0 +1,306 @@
+package amp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultFallbackDelay 与 net.Dialer 的 Happy Eyeballs 默认等待一致
+const defaultFallbackDelay = 300 * time.Millisecond
+
+// channelDialer 按渠道 DNS 策略建立连接：固定 IP、自定义 DNS 服务器、地址族偏好与解析结果缓存。
+// 地址同时包含 IPv4 与 IPv6 时按 Happy Eyeballs（RFC 8305）先连接首选地址族，
+// 等待 FallbackDelay 后并行连接另一地址族，先成功者胜出
+type channelDialer struct {
+	// host 渠道 Base URL 的主机名，固定 IP 只对该主机生效
+	host   string
+	policy model.ChannelDNSPolicy
+	dialer *net.Dialer
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mu    sync.Mutex
+	cache map[string]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+func newChannelDialer(host string, policy model.ChannelDNSPolicy) *channelDialer {
+	cfg := GetTimeoutConfig()
+	d := &channelDialer{
+		host:   strings.ToLower(host),
+		policy: policy,
+		dialer: &net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		},
+		cache: make(map[string]dnsCacheEntry),
+	}
+	resolver := net.DefaultResolver
+	if policy.Resolver != "" {
+		resolverDialer := &net.Dialer{Timeout: 5 * time.Second}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return resolverDialer.DialContext(ctx, network, policy.Resolver)
+			},
+		}
+	}
+	d.lookup = resolver.LookupIPAddr
+	return d
+}
+
+// DialContext 解析目标主机后按地址族偏好连接
+func (d *channelDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	primaries, fallbacks := partitionIPs(ips, d.policy.IPPreference)
+	if len(primaries) == 0 {
+		return nil, &net.DNSError{Err: fmt.Sprintf("没有符合 ipPreference %s 的地址", d.policy.IPPreference), Name: host, IsNotFound: true}
+	}
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, network, primaries, port)
+	}
+	return d.dialParallel(ctx, network, primaries, fallbacks, port)
+}
+
+// resolve 返回主机的地址：IP 字面量直接使用，渠道主机优先使用固定 IP，其次读取缓存，最后查询 DNS
+func (d *channelDialer) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	host = strings.ToLower(host)
+	if host == d.host && len(d.policy.StaticIPs) > 0 {
+		ips := make([]net.IP, 0, len(d.policy.StaticIPs))
+		for _, raw := range d.policy.StaticIPs {
+			if ip := net.ParseIP(raw); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+		return ips, nil
+	}
+
+	ttl := time.Duration(d.policy.CacheTTLSec) * time.Second
+	if ttl > 0 {
+		d.mu.Lock()
+		entry, ok := d.cache[host]
+		d.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.ips, nil
+		}
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	if ttl > 0 {
+		d.mu.Lock()
+		d.cache[host] = dnsCacheEntry{ips: ips, expires: time.Now().Add(ttl)}
+		d.mu.Unlock()
+	}
+	return ips, nil
+}
+
+// partitionIPs 按地址族偏好拆分为首选与回退地址；auto 时以第一个地址的地址族为首选，
+// ipv4_only / ipv6_only 时丢弃另一地址族
+func partitionIPs(ips []net.IP, preference string) (primaries, fallbacks []net.IP) {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	switch preference {
+	case model.ChannelIPPreferenceIPv4:
+		return v4, v6
+	case model.ChannelIPPreferenceIPv6:
+		return v6, v4
+	case model.ChannelIPPreferenceIPv4Only:
+		return v4, nil
+	case model.ChannelIPPreferenceIPv6Only:
+		return v6, nil
+	default:
+		if len(ips) > 0 && ips[0].To4() == nil {
+			return v6, v4
+		}
+		return v4, v6
+	}
+}
+
+func (d *channelDialer) fallbackDelay() time.Duration {
+	if d.policy.FallbackDelayMs > 0 {
+		return time.Duration(d.policy.FallbackDelayMs) * time.Millisecond
+	}
+	return defaultFallbackDelay
+}
+
+// dialSerial 依次尝试地址，返回第一个成功的连接或第一个错误
+func (d *channelDialer) dialSerial(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// dialParallel 先连接首选地址，等待 FallbackDelay 或首选地址全部失败后并行连接回退地址
+func (d *channelDialer) dialParallel(ctx context.Context, network string, primaries, fallbacks []net.IP, port string) (net.Conn, error) {
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	start := func(ips []net.IP, primary bool) {
+		conn, err := d.dialSerial(ctx, network, ips, port)
+		select {
+		case results <- dialResult{conn: conn, err: err, primary: primary}:
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	go start(primaries, true)
+	timer := time.NewTimer(d.fallbackDelay())
+	defer timer.Stop()
+
+	fallbackStarted := false
+	var primaryErr, fallbackErr error
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				go start(fallbacks, false)
+			}
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryErr = res.err
+			} else {
+				fallbackErr = res.err
+			}
+			if primaryErr != nil && fallbackErr != nil {
+				return nil, primaryErr
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				go start(fallbacks, false)
+			}
+		}
+	}
+}
+
+// channelNetwork 渠道 DNS 策略对应的拨号器与连接池，按主机与策略缓存，策略相同的渠道共享
+type channelNetwork struct {
+	dialer    *channelDialer
+	transport *http.Transport
+
+	wsOnce      sync.Once
+	wsTransport *http.Transport
+}
+
+// channelNetworkCache key: 主机名 + DNS 策略 JSON, value: *channelNetwork
+var channelNetworkCache sync.Map
+
+// getChannelNetwork 返回渠道的独立拨号器与连接池，未配置 DNS 策略时返回 nil（使用共享连接池）
+func getChannelNetwork(channel *model.Channel) *channelNetwork {
+	if channel == nil || channel.DNSPolicyJSON == "" {
+		return nil
+	}
+	parsed, err := url.Parse(channel.BaseURL)
+	if err != nil {
+		return nil
+	}
+	host := strings.ToLower(parsed.Hostname())
+	key := host + "|" + channel.DNSPolicyJSON
+	if cached, ok := channelNetworkCache.Load(key); ok {
+		return cached.(*channelNetwork)
+	}
+	policy := service.ChannelDNSPolicy(channel)
+	if service.IsDefaultDNSPolicy(policy) {
+		return nil
+	}
+
+	dialer := newChannelDialer(host, policy)
+	transport := NewStreamingTransport()
+	transport.DialContext = dialer.DialContext
+	network, loaded := channelNetworkCache.LoadOrStore(key, &channelNetwork{dialer: dialer, transport: transport})
+	if !loaded {
+		log.Infof("channel dns: 渠道 %s 使用独立拨号器 (host=%s, staticIps=%d, resolver=%q, ipPreference=%s)",
+			channel.Name, host, len(policy.StaticIPs), policy.Resolver, policy.IPPreference)
+	}
+	return network.(*channelNetwork)
+}
+
+// channelTransport 返回渠道请求使用的 Transport：配置了 DNS 策略时为渠道独立连接池，否则为共享连接池
+func channelTransport(channel *model.Channel) http.RoundTripper {
+	if network := getChannelNetwork(channel); network != nil {
+		return network.transport
+	}
+	return sharedChannelTransport
+}
+
+// channelWebSocketClient 返回渠道 WebSocket 握手使用的 HTTP 客户端，未配置 DNS 策略时返回 nil（使用默认客户端）。
+// WebSocket 握手要求 HTTP/1.1，因此与普通请求的连接池分开
+func channelWebSocketClient(channel *model.Channel) *http.Client {
+	network := getChannelNetwork(channel)
+	if network == nil {
+		return nil
+	}
+	network.wsOnce.Do(func() {
+		cfg := GetTimeoutConfig()
+		network.wsTransport = &http.Transport{
+			DialContext:         network.dialer.DialContext,
+			TLSClientConfig:     &tls.Config{MinVersion: tls.VersionTLS12},
+			TLSHandshakeTimeout: cfg.TLSHandshakeTimeout,
+		}
+	})
+	return &http.Client{Transport: network.wsTransport}
+}
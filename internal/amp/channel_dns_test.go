@@ -0,0 +1,130 @@
+package amp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+)
+
+func TestChannelTransport_StaticIPPinning(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	channel := &model.Channel{
+		Name:          "pinned",
+		BaseURL:       "http://api.pinned.invalid:" + port,
+		DNSPolicyJSON: `{"staticIps":["127.0.0.1"],"ipPreference":"auto"}`,
+	}
+	transport := channelTransport(channel)
+	if transport == sharedChannelTransport {
+		t.Fatal("channel with dns policy should use its own transport")
+	}
+	if channelTransport(channel) != transport {
+		t.Fatal("transport should be cached per host and policy")
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Get(channel.BaseURL + "/v1/models")
+	if err != nil {
+		t.Fatalf("pinned request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	if channelTransport(&model.Channel{BaseURL: "http://api.example.com"}) != sharedChannelTransport {
+		t.Fatal("channel without dns policy should use the shared transport")
+	}
+}
+
+func TestChannelDialer_ResolveCache(t *testing.T) {
+	d := newChannelDialer("api.example.com", model.ChannelDNSPolicy{CacheTTLSec: 60})
+	lookups := 0
+	d.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups++
+		return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		ips, err := d.resolve(context.Background(), "Other.Example.com")
+		if err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.0.2.1")) {
+			t.Fatalf("unexpected resolve result: %v %v", ips, err)
+		}
+	}
+	if lookups != 1 {
+		t.Fatalf("expected 1 lookup with cache, got %d", lookups)
+	}
+
+	d.cache["other.example.com"] = dnsCacheEntry{ips: []net.IP{net.ParseIP("192.0.2.1")}, expires: time.Now().Add(-time.Second)}
+	if _, err := d.resolve(context.Background(), "other.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 2 {
+		t.Fatalf("expired entry should be looked up again, got %d lookups", lookups)
+	}
+
+	uncached := newChannelDialer("api.example.com", model.ChannelDNSPolicy{})
+	uncached.lookup = d.lookup
+	uncached.resolve(context.Background(), "other.example.com")
+	uncached.resolve(context.Background(), "other.example.com")
+	if lookups != 4 {
+		t.Fatalf("cacheTtlSec 0 should not cache, got %d lookups", lookups)
+	}
+}
+
+func TestPartitionIPs(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	cases := []struct {
+		preference string
+		ips        []net.IP
+		primary    net.IP
+		fallbacks  int
+	}{
+		{model.ChannelIPPreferenceAuto, []net.IP{v6, v4}, v6, 1},
+		{model.ChannelIPPreferenceAuto, []net.IP{v4, v6}, v4, 1},
+		{model.ChannelIPPreferenceIPv4, []net.IP{v6, v4}, v4, 1},
+		{model.ChannelIPPreferenceIPv6, []net.IP{v4, v6}, v6, 1},
+		{model.ChannelIPPreferenceIPv4Only, []net.IP{v6, v4}, v4, 0},
+		{model.ChannelIPPreferenceIPv6Only, []net.IP{v4, v6}, v6, 0},
+	}
+	for _, tc := range cases {
+		primaries, fallbacks := partitionIPs(tc.ips, tc.preference)
+		if len(primaries) != 1 || !primaries[0].Equal(tc.primary) || len(fallbacks) != tc.fallbacks {
+			t.Errorf("%s: got primaries=%v fallbacks=%v", tc.preference, primaries, fallbacks)
+		}
+	}
+}
+
+func TestChannelDialer_FallsBackWhenPrimaryFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	// 服务只监听 127.0.0.1，首选地址 127.0.0.2 拒绝连接，应立即改连回退地址而不必等待 FallbackDelay
+	d := newChannelDialer("api.example.com", model.ChannelDNSPolicy{FallbackDelayMs: 5000})
+	start := time.Now()
+	conn, err := d.dialParallel(context.Background(), "tcp",
+		[]net.IP{net.ParseIP("127.0.0.2")}, []net.IP{net.ParseIP("127.0.0.1")}, u.Port())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("fallback should start as soon as primaries fail, took %v", elapsed)
+	}
+
+	_, err = d.dialParallel(context.Background(), "tcp",
+		[]net.IP{net.ParseIP("127.0.0.2")}, []net.IP{net.ParseIP("127.0.0.3")}, u.Port())
+	if err == nil {
+		t.Fatal("dial should fail when all addresses fail")
+	}
+}
@@ -0,0 +1,140 @@
+package amp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFailoverMaxChannels = 3
+	maxFailoverMaxChannels     = 10
+)
+
+// errChannelFailover 由 ModifyResponse / ErrorHandler 返回，表示本次响应未写给客户端，需改用下一个渠道
+var errChannelFailover = errors.New("channel failover")
+
+var channelFailoverState struct {
+	mu     sync.RWMutex
+	config model.ChannelFailoverConfig
+}
+
+func init() {
+	channelFailoverState.config = DefaultChannelFailoverConfig()
+}
+
+// DefaultChannelFailoverConfig 默认开启，最多尝试 3 个渠道
+func DefaultChannelFailoverConfig() model.ChannelFailoverConfig {
+	return model.ChannelFailoverConfig{
+		Enabled:     true,
+		MaxChannels: defaultFailoverMaxChannels,
+		On429:       true,
+		On5xx:       true,
+	}
+}
+
+// NormalizeChannelFailoverConfig 填充未设置的字段
+func NormalizeChannelFailoverConfig(cfg model.ChannelFailoverConfig) model.ChannelFailoverConfig {
+	if cfg.MaxChannels <= 0 {
+		cfg.MaxChannels = defaultFailoverMaxChannels
+	}
+	return cfg
+}
+
+// ValidateChannelFailoverConfig 校验故障转移配置（需先 Normalize）
+func ValidateChannelFailoverConfig(cfg model.ChannelFailoverConfig) error {
+	if cfg.MaxChannels > maxFailoverMaxChannels {
+		return fmt.Errorf("maxChannels 不能超过 %d", maxFailoverMaxChannels)
+	}
+	return nil
+}
+
+// InitChannelFailoverConfig 从数据库 JSON 加载故障转移配置
+func InitChannelFailoverConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.ChannelFailoverConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("channel failover: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizeChannelFailoverConfig(cfg)
+	if err := ValidateChannelFailoverConfig(cfg); err != nil {
+		log.Warnf("channel failover: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateChannelFailoverConfig(cfg)
+}
+
+// UpdateChannelFailoverConfig 更新运行时故障转移配置
+func UpdateChannelFailoverConfig(cfg model.ChannelFailoverConfig) {
+	channelFailoverState.mu.Lock()
+	defer channelFailoverState.mu.Unlock()
+	channelFailoverState.config = cfg
+}
+
+// GetChannelFailoverConfig 返回当前生效的故障转移配置
+func GetChannelFailoverConfig() model.ChannelFailoverConfig {
+	channelFailoverState.mu.RLock()
+	defer channelFailoverState.mu.RUnlock()
+	return channelFailoverState.config
+}
+
+// shouldFailoverStatus 上游状态码是否应改用其他渠道
+func shouldFailoverStatus(cfg model.ChannelFailoverConfig, statusCode int) bool {
+	if statusCode == http.StatusTooManyRequests {
+		return cfg.On429
+	}
+	return statusCode >= 500 && cfg.On5xx
+}
+
+// selectFailoverChannel 按优先级与轮询规则选择下一个未尝试过、且格式与首个渠道相同的渠道
+func selectFailoverChannel(modelName string, groupIDs []string, format translator.Format, attempted map[string]struct{}) *model.Channel {
+	next, err := channelService.SelectFailoverChannel(modelName, groupIDs, func(ch *model.Channel) bool {
+		if _, ok := attempted[ch.ID]; ok {
+			return true
+		}
+		return requestChannelFormat(ch, format) != format
+	})
+	if err != nil {
+		log.Warnf("channel failover: 选择备用渠道失败: %v", err)
+		return nil
+	}
+	return next
+}
+
+// recordChannelAttempt 在请求追踪中记录一次渠道尝试，failover 标记该尝试触发了故障转移。
+// 重试传输层已记录该渠道的尝试时只更新标记，否则补充一条
+func recordChannelAttempt(trace *RequestTrace, channel *model.Channel, startedAt time.Time, statusCode int, err error, failover bool) {
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	if n := len(trace.Attempts); n > 0 && trace.Attempts[n-1].ChannelID == channel.ID {
+		trace.Attempts[n-1].Failover = trace.Attempts[n-1].Failover || failover
+		return
+	}
+	record := model.RequestAttempt{
+		Attempt:    1,
+		StartedAt:  startedAt,
+		ChannelID:  channel.ID,
+		StatusCode: statusCode,
+		DurationMs: time.Since(startedAt).Milliseconds(),
+		Failover:   failover,
+	}
+	if err != nil {
+		record.Error = SanitizeError(err)
+		record.ErrorClass = classifyError(err)
+	}
+	trace.Attempts = append(trace.Attempts, record)
+}
@@ -0,0 +1,87 @@
+package amp
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+)
+
+func TestShouldFailoverStatus(t *testing.T) {
+	cfg := DefaultChannelFailoverConfig()
+	cases := map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+	}
+	for status, want := range cases {
+		if got := shouldFailoverStatus(cfg, status); got != want {
+			t.Errorf("status %d: got %v, want %v", status, got, want)
+		}
+	}
+
+	cfg.On429 = false
+	if shouldFailoverStatus(cfg, http.StatusTooManyRequests) {
+		t.Error("429 should not fail over when on429 is disabled")
+	}
+	cfg.On5xx = false
+	if shouldFailoverStatus(cfg, http.StatusBadGateway) {
+		t.Error("5xx should not fail over when on5xx is disabled")
+	}
+}
+
+func TestValidateChannelFailoverConfig(t *testing.T) {
+	cfg := NormalizeChannelFailoverConfig(model.ChannelFailoverConfig{Enabled: true})
+	if cfg.MaxChannels != defaultFailoverMaxChannels {
+		t.Fatalf("maxChannels should default to %d, got %d", defaultFailoverMaxChannels, cfg.MaxChannels)
+	}
+	if err := ValidateChannelFailoverConfig(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg.MaxChannels = maxFailoverMaxChannels + 1
+	if err := ValidateChannelFailoverConfig(cfg); err == nil {
+		t.Fatal("expected error for maxChannels above the limit")
+	}
+}
+
+func TestRecordChannelAttempt(t *testing.T) {
+	trace := NewRequestTrace("req", "user", "key", http.MethodPost, "/v1/messages")
+	first := &model.Channel{ID: "ch1"}
+	second := &model.Channel{ID: "ch2"}
+
+	// 重试传输层已记录的尝试只打标记，不重复追加
+	trace.Attempts = append(trace.Attempts, model.RequestAttempt{Attempt: 1, ChannelID: "ch1", StatusCode: 503})
+	recordChannelAttempt(trace, first, time.Now(), 503, nil, true)
+	if len(trace.Attempts) != 1 || !trace.Attempts[0].Failover {
+		t.Fatalf("expected existing attempt to be marked, got %+v", trace.Attempts)
+	}
+
+	recordChannelAttempt(trace, second, time.Now(), 0, errors.New("dial tcp: connection refused"), true)
+	if len(trace.Attempts) != 2 {
+		t.Fatalf("expected a new attempt for ch2, got %+v", trace.Attempts)
+	}
+	got := trace.Attempts[1]
+	if got.ChannelID != "ch2" || !got.Failover || got.Error == "" {
+		t.Fatalf("unexpected attempt %+v", got)
+	}
+
+	// 最终渠道的尝试不带故障转移标记，且不会覆盖已有标记
+	third := &model.Channel{ID: "ch3"}
+	recordChannelAttempt(trace, third, time.Now(), 200, nil, false)
+	if len(trace.Attempts) != 3 || trace.Attempts[2].Failover || trace.Attempts[2].StatusCode != 200 {
+		t.Fatalf("unexpected final attempt %+v", trace.Attempts)
+	}
+	recordChannelAttempt(trace, third, time.Now(), 502, nil, true)
+	recordChannelAttempt(trace, third, time.Now(), 502, nil, false)
+	if len(trace.Attempts) != 3 || !trace.Attempts[2].Failover {
+		t.Fatal("failover flag must not be cleared")
+	}
+
+	recordChannelAttempt(nil, first, time.Now(), 500, nil, true)
+}
@@ -0,0 +1,106 @@
+package amp
+
+import (
+	"sync"
+	"time"
+
+	"ampmanager/internal/health"
+	"ampmanager/internal/service"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// channelHealthTick 调度粒度，各渠道按自己的下一次探测时间执行
+	channelHealthTick = 5 * time.Second
+	// channelHealthConcurrency 同时进行的探测数
+	channelHealthConcurrency = 4
+)
+
+// ChannelHealthChecker 定期探测启用的渠道，连续失败的渠道被熔断后由选路跳过
+type ChannelHealthChecker struct {
+	channelService *service.ChannelService
+	stopChan       chan struct{}
+	stopOnce       sync.Once
+	wg             sync.WaitGroup
+}
+
+var globalChannelHealthChecker *ChannelHealthChecker
+
+// InitChannelHealthChecker 启动全局渠道健康检查
+func InitChannelHealthChecker() {
+	globalChannelHealthChecker = &ChannelHealthChecker{
+		channelService: service.NewChannelService(),
+		stopChan:       make(chan struct{}),
+	}
+	globalChannelHealthChecker.wg.Add(1)
+	go globalChannelHealthChecker.run()
+	log.Info("channel health: checker started")
+}
+
+// StopChannelHealthChecker 停止全局渠道健康检查
+func StopChannelHealthChecker() {
+	if globalChannelHealthChecker == nil {
+		return
+	}
+	globalChannelHealthChecker.stopOnce.Do(func() { close(globalChannelHealthChecker.stopChan) })
+	globalChannelHealthChecker.wg.Wait()
+	log.Info("channel health: checker stopped")
+}
+
+func (h *ChannelHealthChecker) run() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(channelHealthTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.probeDue()
+		case <-h.stopChan:
+			return
+		}
+	}
+}
+
+func (h *ChannelHealthChecker) probeDue() {
+	cfg := health.GetConfig()
+	if !cfg.Enabled {
+		return
+	}
+
+	channels, err := h.channelService.ListEnabledInternal()
+	if err != nil {
+		log.Warnf("channel health: 获取渠道列表失败: %v", err)
+		return
+	}
+
+	activeIDs := make(map[string]struct{}, len(channels))
+	for _, ch := range channels {
+		activeIDs[ch.ID] = struct{}{}
+	}
+	health.Prune(activeIDs)
+
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	now := time.Now().UTC()
+	sem := make(chan struct{}, channelHealthConcurrency)
+	var wg sync.WaitGroup
+	for _, ch := range channels {
+		if !health.DueForProbe(ch.ID, now) {
+			continue
+		}
+		select {
+		case <-h.stopChan:
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			h.channelService.ProbeChannelHealth(ch, timeout)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,160 @@
+package amp
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"ampmanager/internal/health"
+	"ampmanager/internal/model"
+	"ampmanager/internal/realtime"
+	"ampmanager/internal/service"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// channelKeyCheckTick 调度粒度，到达配置的检查间隔后执行一轮
+	channelKeyCheckTick = time.Minute
+	// channelKeyCheckConcurrency 同时检查的渠道数
+	channelKeyCheckConcurrency = 4
+)
+
+var ErrChannelKeyCheckRunning = errors.New("渠道密钥检查正在进行中")
+
+// ChannelKeyChecker 定期用渠道的每个密钥请求一次模型列表，提前发现过期或被吊销的密钥，
+// 而不是等用户请求收到 401 才发现
+type ChannelKeyChecker struct {
+	channelService *service.ChannelService
+	stopChan       chan struct{}
+	stopOnce       sync.Once
+	wg             sync.WaitGroup
+	// runMu 保证同一时间只有一轮检查（定时任务与手动触发互斥）
+	runMu   sync.Mutex
+	lastRun time.Time
+}
+
+var globalChannelKeyChecker *ChannelKeyChecker
+
+// InitChannelKeyChecker 启动全局渠道密钥有效性检查，启动后立即执行一轮
+func InitChannelKeyChecker() {
+	globalChannelKeyChecker = &ChannelKeyChecker{
+		channelService: service.NewChannelService(),
+		stopChan:       make(chan struct{}),
+	}
+	globalChannelKeyChecker.wg.Add(1)
+	go globalChannelKeyChecker.run()
+	log.Info("channel key check: checker started")
+}
+
+// StopChannelKeyChecker 停止全局渠道密钥有效性检查
+func StopChannelKeyChecker() {
+	if globalChannelKeyChecker == nil {
+		return
+	}
+	globalChannelKeyChecker.stopOnce.Do(func() { close(globalChannelKeyChecker.stopChan) })
+	globalChannelKeyChecker.wg.Wait()
+	log.Info("channel key check: checker stopped")
+}
+
+// RunChannelKeyCheck 立即检查所有启用渠道的密钥，返回各渠道的检查结果
+func RunChannelKeyCheck() ([]model.ChannelAuthStatus, error) {
+	checker := globalChannelKeyChecker
+	if checker == nil {
+		checker = &ChannelKeyChecker{
+			channelService: service.NewChannelService(),
+			stopChan:       make(chan struct{}),
+		}
+	}
+	if !checker.runMu.TryLock() {
+		return nil, ErrChannelKeyCheckRunning
+	}
+	defer checker.runMu.Unlock()
+	return checker.checkAll()
+}
+
+func (k *ChannelKeyChecker) run() {
+	defer k.wg.Done()
+	k.checkDue()
+
+	ticker := time.NewTicker(channelKeyCheckTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			k.checkDue()
+		case <-k.stopChan:
+			return
+		}
+	}
+}
+
+func (k *ChannelKeyChecker) checkDue() {
+	cfg := health.GetKeyCheckConfig()
+	if !cfg.Enabled {
+		return
+	}
+	if !k.runMu.TryLock() {
+		return
+	}
+	defer k.runMu.Unlock()
+	if !k.lastRun.IsZero() && time.Since(k.lastRun) < time.Duration(cfg.IntervalSec)*time.Second {
+		return
+	}
+	if _, err := k.checkAll(); err != nil {
+		log.Warnf("channel key check: %v", err)
+	}
+}
+
+// checkAll 检查所有启用渠道，调用方需持有 runMu
+func (k *ChannelKeyChecker) checkAll() ([]model.ChannelAuthStatus, error) {
+	cfg := health.GetKeyCheckConfig()
+	k.lastRun = time.Now()
+
+	channels, err := k.channelService.ListEnabledInternal()
+	if err != nil {
+		return nil, err
+	}
+
+	activeIDs := make(map[string]struct{}, len(channels))
+	for _, ch := range channels {
+		activeIDs[ch.ID] = struct{}{}
+	}
+	health.Prune(activeIDs)
+
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	results := make([]model.ChannelAuthStatus, len(channels))
+	sem := make(chan struct{}, channelKeyCheckConcurrency)
+	var wg sync.WaitGroup
+	for i, ch := range channels {
+		select {
+		case <-k.stopChan:
+			wg.Wait()
+			return results[:i], nil
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			status, newlyInvalid := k.channelService.CheckChannelKeys(ch, timeout)
+			results[i] = status
+			if newlyInvalid {
+				notifyChannelAuthFailed(status)
+			}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// notifyChannelAuthFailed 新发现失效密钥时记录告警并推送给在线的管理端
+func notifyChannelAuthFailed(status model.ChannelAuthStatus) {
+	log.WithFields(log.Fields{
+		"channelId":   status.ChannelID,
+		"channelName": status.ChannelName,
+		"status":      status.Status,
+		"invalidKeys": status.InvalidKeys,
+	}).Warnf("channel key check: 渠道密钥认证失败: %s", status.LastError)
+	realtime.Broadcast("channel_auth_failed", status)
+}
@@ -0,0 +1,54 @@
+package amp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ampmanager/internal/health"
+	"ampmanager/internal/model"
+)
+
+// 密钥池冷却时长
+const (
+	keyCooldownRateLimited  = time.Minute
+	keyCooldownUnauthorized = 10 * time.Minute
+	maxKeyCooldown          = time.Hour
+)
+
+// cooldownChannelKey 密钥被上游限流（429）或认证失败（401）时暂停使用，同渠道的其他密钥继续服务。
+// 仅在渠道配置了多个密钥时生效
+func cooldownChannelKey(channel *model.Channel, resp *http.Response) {
+	if channel.KeyID == "" {
+		return
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		d := keyCooldownRateLimited
+		if retryAfter, ok := parseRetryAfterHeader(resp.Header.Get("Retry-After")); ok {
+			d = min(max(retryAfter, time.Second), maxKeyCooldown)
+		}
+		health.CooldownKey(channel.ID, channel.KeyID, d, fmt.Sprintf("HTTP %d", resp.StatusCode))
+	case http.StatusUnauthorized:
+		health.CooldownKey(channel.ID, channel.KeyID, keyCooldownUnauthorized, fmt.Sprintf("HTTP %d", resp.StatusCode))
+	}
+}
+
+// parseRetryAfterHeader 解析秒数或 HTTP 日期格式的 Retry-After
+func parseRetryAfterHeader(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+	}
+	return 0, false
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,15 +16,17 @@ import (
 	"strings"
 	"time"
 
-	"ampmanager/internal/billing"
+	"ampmanager/internal/health"
 	"ampmanager/internal/model"
 	"ampmanager/internal/service"
+	"ampmanager/internal/tracing"
 	"ampmanager/internal/translator"
 	"ampmanager/internal/translator/filters"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
 )
 
 // sharedChannelTransport 是共享的 Channel Proxy Transport，用于连接复用
@@ -61,6 +64,9 @@ type TranslationInfo struct {
 	Model               string // originalModel - for response rewriting
 	UpstreamModel       string // mappedModel - for upstream URL path
 	ResponseParam       *any
+	Strict              bool // 翻译失败时返回 502，而不是原样透传上游内容
+	// ResponseSession 跨格式转发的 Responses 请求，响应完成后保存会话供 previous_response_id 引用
+	ResponseSession *responseSession
 }
 
 type channelConfigKey struct{}
@@ -68,6 +74,8 @@ type channelConfigKey struct{}
 type ChannelConfig struct {
 	Channel *model.Channel
 	Model   string
+	// StickyKey 会话粘性绑定键，故障转移到其他渠道时改绑到新渠道
+	StickyKey string
 }
 
 func WithChannelConfig(c *gin.Context, cfg *ChannelConfig) {
@@ -107,6 +115,10 @@ func detectIncomingFormat(path string) translator.Format {
 		return translator.FormatOpenAIChat
 	case strings.Contains(path, "/v1/responses"):
 		return translator.FormatOpenAIResponses
+	case isEmbeddingsPath(path):
+		return translator.FormatOpenAIEmbeddings
+	case isAudioPath(path):
+		return translator.FormatOpenAIAudio
 	case strings.Contains(path, "/v1/messages"):
 		return translator.FormatClaude
 	case strings.Contains(path, "/v1beta/models/") || strings.Contains(path, "/v1beta1/publishers/google/models/"):
@@ -121,7 +133,7 @@ func channelTypeToFormat(channel *model.Channel) translator.Format {
 	if channel == nil {
 		return translator.FormatOpenAI
 	}
-	switch channel.Type {
+	switch channel.Type.Protocol() {
 	case model.ChannelTypeOpenAI:
 		if channel.Endpoint == model.ChannelEndpointResponses {
 			return translator.FormatOpenAIResponses
@@ -131,6 +143,11 @@ func channelTypeToFormat(channel *model.Channel) translator.Format {
 		return translator.FormatClaude
 	case model.ChannelTypeGemini:
 		return translator.FormatGemini
+	case model.ChannelTypeOllama:
+		if channel.Endpoint == model.ChannelEndpointGenerate {
+			return translator.FormatOllamaGenerate
+		}
+		return translator.FormatOllamaChat
 	default:
 		return translator.FormatOpenAI
 	}
@@ -141,6 +158,18 @@ func needsFormatConversion(incoming, outgoing translator.Format) bool {
 	return incoming != outgoing
 }
 
+// canTranslate 跨格式转发仅支持已注册翻译器的格式组合，且只翻译生成接口（count_tokens、
+// /v1/responses/input_tokens 等保持拒绝）
+func canTranslate(incoming, outgoing translator.Format, path string) bool {
+	if !translator.HasResponseTransformer(incoming, outgoing) {
+		return false
+	}
+	if incoming == translator.FormatOpenAIResponses {
+		return strings.HasSuffix(strings.TrimSuffix(path, "/"), "/v1/responses")
+	}
+	return shouldForceUpstreamStream(incoming, path)
+}
+
 // getTargetEndpointPath returns the correct endpoint path for the target format
 func getTargetEndpointPath(targetFormat translator.Format, channel *model.Channel) string {
 	switch targetFormat {
@@ -182,6 +211,11 @@ func sanitizeURL(rawURL string) string {
 
 func ChannelRouterMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 批处理由 BatchProxyHandler 自行选择渠道
+		if isBatchPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
 		modelName := extractModelName(c)
 		if modelName == "" {
 			c.Next()
@@ -190,27 +224,56 @@ func ChannelRouterMiddleware() gin.HandlerFunc {
 
 		var channel *model.Channel
 		var err error
+		_, span := tracing.Start(c.Request.Context(), "channel.select", tracing.SpanKindInternal)
+		span.SetAttr("gen_ai.request.model", modelName)
 		proxyCfg := GetProxyConfig(c.Request.Context())
-		if proxyCfg != nil {
+		passthrough := isOpenAIPassthroughPath(c.Request.URL.Path)
+		stickyKey := channelStickyKey(c, proxyCfg, modelName)
+		if stickyKey != "" {
+			var skip func(*model.Channel) bool
+			if passthrough {
+				skip = func(ch *model.Channel) bool { return !channelSupportsOpenAIPassthrough(ch) }
+			}
+			channel = selectStickyChannel(stickyKey, modelName, proxyCfg.GroupIDs, skip)
+		}
+		switch {
+		case channel != nil:
+			log.Debugf("channel sticky: session keeps model '%s' on channel '%s'", modelName, channel.Name)
+		case passthrough:
+			// embeddings 与音频接口只能由 OpenAI 兼容渠道处理，避免选中无法翻译的 Claude/Gemini 渠道
+			var groupIDs []string
+			if proxyCfg != nil {
+				groupIDs = proxyCfg.GroupIDs
+			}
+			channel, err = selectOpenAIPassthroughChannel(modelName, groupIDs)
+		case proxyCfg != nil:
 			channel, err = channelService.SelectChannelForModelWithGroups(modelName, proxyCfg.GroupIDs)
-		} else {
+		default:
 			channel, err = channelService.SelectChannelForModel(modelName)
 		}
 		if err != nil {
 			log.Errorf("channel router: failed to select channel: %v", err)
+			span.SetError(err)
+			span.End()
 			c.Next()
 			return
 		}
 
 		if channel == nil {
+			span.End()
 			c.Next()
 			return
 		}
+		span.SetAttr("channel.id", channel.ID)
+		span.SetAttr("channel.type", string(channel.Type))
+		span.End()
 
 		log.Infof("channel router: routing model '%s' to channel '%s' (%s)", modelName, channel.Name, channel.Type)
+		bindStickyChannel(stickyKey, channel.ID)
 		WithChannelConfig(c, &ChannelConfig{
-			Channel: channel,
-			Model:   modelName,
+			Channel:   channel,
+			Model:     modelName,
+			StickyKey: stickyKey,
 		})
 
 		c.Next()
@@ -251,18 +314,14 @@ func extractModelName(c *gin.Context) string {
 		return ""
 	}
 
-	contentType := c.GetHeader("Content-Type")
-	if !strings.Contains(contentType, "application/json") {
-		return ""
+	// 音频转写/翻译以 multipart 上传，model 为表单字段
+	if boundary, ok := isMultipartForm(c.GetHeader("Content-Type")); ok {
+		return extractMultipartModel(c, boundary)
 	}
-
-	bodyBytes, err := io.ReadAll(io.LimitReader(c.Request.Body, 10*1024*1024))
-	if err != nil {
+	bodyBytes := readJSONRequestBody(c.Request, maxRequestBodySize)
+	if bodyBytes == nil {
 		return ""
 	}
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-	c.Request.ContentLength = int64(len(bodyBytes))
-	c.Request.TransferEncoding = nil
 
 	var payload struct {
 		Model string `json:"model"`
@@ -296,7 +355,8 @@ func (rw *rewritingResponseWriter) Flush() {
 	rw.ResponseWriter.Flush()
 }
 
-// ChannelProxyHandler creates a handler using httputil.ReverseProxy for robust proxying
+// ChannelProxyHandler creates a handler using httputil.ReverseProxy for robust proxying.
+// 上游返回 5xx/429 或连接失败时，按故障转移配置改用同模型、同格式的下一个渠道重新请求
 func ChannelProxyHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Security guard: ensure authentication was performed via proxy middleware
@@ -315,6 +375,11 @@ func ChannelProxyHandler() gin.HandlerFunc {
 			return
 		}
 
+		if IsRawPassthrough(c) {
+			serveRawPassthrough(c, channelCfg)
+			return
+		}
+
 		channel := channelCfg.Channel
 
 		// Use original model from context if mapping was applied, otherwise use channelCfg.Model
@@ -331,12 +396,12 @@ func ChannelProxyHandler() gin.HandlerFunc {
 			}
 		}
 
-		// Detect incoming and outgoing formats - format conversion is NOT supported
+		// Detect incoming and outgoing formats
 		incomingFormat := detectIncomingFormat(c.Request.URL.Path)
-		outgoingFormat := channelTypeToFormat(channel)
+		outgoingFormat := requestChannelFormat(channel, incomingFormat)
 
-		// Reject if formats don't match (no translation supported)
-		if needsFormatConversion(incomingFormat, outgoingFormat) {
+		// Reject if formats don't match and no translator is registered for the pair
+		if needsFormatConversion(incomingFormat, outgoingFormat) && !canTranslate(incomingFormat, outgoingFormat, c.Request.URL.Path) {
 			log.Warnf("channel proxy: format mismatch - incoming %s, channel expects %s (format conversion not supported)", incomingFormat, outgoingFormat)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": fmt.Sprintf("format mismatch: request format is %s but channel expects %s. Format conversion is not supported, please use a channel with matching format.", incomingFormat, outgoingFormat),
@@ -344,417 +409,703 @@ func ChannelProxyHandler() gin.HandlerFunc {
 			return
 		}
 
-		// Read and process request body
-		var originalRequestBody []byte
-		var convertedBody []byte
-		clientWantsStream := false
-		isStreaming := false
+		// 请求体只读取一次，故障转移时按新渠道重新处理
+		req := &channelProxyRequest{
+			incomingFormat: incomingFormat,
+			outgoingFormat: outgoingFormat,
+			originalModel:  originalModel,
+			mappedModel:    mappedModel,
+			upstreamModel:  channelCfg.Model,
+		}
 		// Some clients send JSON bodies with chunked transfer encoding (Content-Length = -1).
 		// We still need to buffer the body so /v1/responses SSE retry can replay it.
 		if c.Request.Body != nil {
-			bodyBytes, err := io.ReadAll(io.LimitReader(c.Request.Body, 10*1024*1024))
+			limit := requestBodyLimit(c.Request.URL.Path)
+			bodyBytes, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
 			c.Request.Body.Close()
+			if int64(len(bodyBytes)) > limit || isRequestBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, NewStandardError(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit)))
+				return
+			}
 			if err != nil {
 				log.Errorf("channel proxy: failed to read request body: %v", err)
 				c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to read request body"))
 				return
 			}
-			originalRequestBody = bodyBytes
-			convertedBody = bodyBytes
+			req.body = bodyBytes
+			req.hasBody = true
+		}
 
-			// Check if streaming
-			var payload struct {
-				Stream bool `json:"stream"`
+		// 输出过滤器按请求构建（含请求中提取的密钥），各次渠道尝试共用
+		if IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
+			if f := newRequestOutputFilter(req.body); f != nil {
+				c.Request = c.Request.WithContext(withOutputFilter(c.Request.Context(), f))
 			}
-			if err := json.Unmarshal(bodyBytes, &payload); err == nil {
-				clientWantsStream = payload.Stream
-				isStreaming = payload.Stream
+		}
+
+		failoverCfg := GetChannelFailoverConfig()
+		canFailover := failoverCfg.Enabled && IsModelInvocation(c.Request.Method, c.Request.URL.Path)
+		groupIDs := GetProxyConfig(c.Request.Context()).GroupIDs
+		attempted := make(map[string]struct{})
+		baseRequest := c.Request
+
+		// 按配置合并流式响应的刷新，减少逐块刷新带来的小包写入
+		defer withStreamFlush(c, incomingFormat)()
+
+		for attempt := 1; ; attempt++ {
+			attempted[channel.ID] = struct{}{}
+			req.pickNext = nil
+			if canFailover && attempt < failoverCfg.MaxChannels {
+				req.pickNext = func() *model.Channel {
+					return selectFailoverChannel(channelCfg.Model, groupIDs, outgoingFormat, attempted)
+				}
 			}
 
-			// Apply outgoing format filters (e.g., Claude system string to array)
-			filteredBody, filterErr := filters.ApplyFilters(outgoingFormat, bodyBytes)
-			if filterErr != nil {
-				log.Warnf("channel proxy: filter application failed: %v, using unfiltered body", filterErr)
-				filteredBody = bodyBytes
+			c.Request = baseRequest
+			next := req.serve(c, channel)
+			if next == nil {
+				return
 			}
-			convertedBody = filteredBody
+			log.Warnf("channel failover: channel '%s' failed, retrying model '%s' on channel '%s' (attempt %d/%d)",
+				channel.Name, channelCfg.Model, next.Name, attempt+1, failoverCfg.MaxChannels)
+			channel = next
+			bindStickyChannel(channelCfg.StickyKey, channel.ID)
+		}
+	}
+}
 
-			if outgoingFormat == translator.FormatClaude {
-				if cfg := GetProxyConfig(c.Request.Context()); cfg != nil {
-					if newBody, injected := ensureClaudeMetadataUserID(convertedBody, c.Request.Header.Get("User-Agent"), channel.APIKey); injected {
-						convertedBody = newBody
-					}
-				}
+// channelProxyRequest 单个客户端请求在各渠道尝试间共享的状态
+type channelProxyRequest struct {
+	incomingFormat translator.Format
+	outgoingFormat translator.Format
+	originalModel  string
+	mappedModel    string
+	upstreamModel  string
+	body           []byte
+	hasBody        bool
+	// trace 首次尝试时创建，故障转移后沿用同一条请求日志
+	trace *RequestTrace
+	// failedOver 已发生过故障转移，最终渠道的尝试也需写入追踪（在请求日志完成前记录）
+	failedOver bool
+	// pickNext 非空时允许故障转移，返回下一个可用渠道（没有时返回 nil）
+	pickNext func() *model.Channel
+}
 
-				if newBody, toolMap, changed := PrefixClaudeToolNamesWithMap(convertedBody); changed {
-					convertedBody = newBody
-					if len(toolMap) > 0 {
-						c.Request = c.Request.WithContext(WithClaudeToolNameMap(c.Request.Context(), toolMap))
-					}
-				}
+// serve 将请求转发到指定渠道。发生故障转移时不向客户端写入任何内容，返回下一个渠道；否则返回 nil
+func (r *channelProxyRequest) serve(c *gin.Context, channel *model.Channel) *model.Channel {
+	incomingFormat := r.incomingFormat
+	outgoingFormat := r.outgoingFormat
+	originalModel := r.originalModel
+	mappedModel := r.mappedModel
+
+	// Read and process request body
+	var originalRequestBody []byte
+	var convertedBody []byte
+	clientWantsStream := false
+	isStreaming := false
+	needsConversion := needsFormatConversion(incomingFormat, outgoingFormat)
+	var session *responseSession
+	if r.hasBody {
+		bodyBytes := r.body
+		originalRequestBody = bodyBytes
+		convertedBody = bodyBytes
+
+		// Check if streaming
+		var payload struct {
+			Stream bool `json:"stream"`
+		}
+		if err := json.Unmarshal(bodyBytes, &payload); err == nil {
+			clientWantsStream = payload.Stream
+			isStreaming = payload.Stream
+		}
+		if incomingFormat == translator.FormatGemini {
+			clientWantsStream = isGeminiStreamPath(c.Request.URL.Path)
+		}
+
+		// Responses previous_response_id 引用本地保存的会话时重建完整 input（见 response_store.go）；
+		// 未找到时同格式渠道交给上游处理，跨格式转发则无法还原会话
+		if incomingFormat == translator.FormatOpenAIResponses {
+			userID := ""
+			if cfg := GetProxyConfig(c.Request.Context()); cfg != nil {
+				userID = cfg.UserID
+			}
+			expanded, s, found, err := expandPreviousResponse(userID, bodyBytes, time.Now())
+			if err != nil && needsConversion {
+				previousID := gjson.GetBytes(bodyBytes, "previous_response_id").String()
+				log.Warnf("channel proxy: cannot restore previous response %s for user %s: %v", previousID, userID, err)
+				errResp := NewStandardError(http.StatusBadRequest, fmt.Sprintf("Previous response with id '%s' not found.", previousID))
+				errResp.Error.Code = "previous_response_not_found"
+				c.JSON(http.StatusBadRequest, errResp)
+				return nil
+			}
+			if found {
+				bodyBytes = expanded
+			}
+			if needsConversion {
+				session = s
 			}
+		}
 
-			if !bytes.Equal(convertedBody, bodyBytes) {
-				c.Request.Body = io.NopCloser(bytes.NewReader(convertedBody))
-				c.Request.ContentLength = int64(len(convertedBody))
-				c.Request.Header.Set("Content-Length", fmt.Sprintf("%d", len(convertedBody)))
-			} else {
-				c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		// 跨格式转发：先把请求翻译为渠道格式，之后的过滤器与注入均按渠道格式处理
+		if needsConversion {
+			span := startTranslationSpan(c.Request.Context(), "translate.request", incomingFormat, outgoingFormat)
+			translated, err := translator.TranslateRequest(incomingFormat, outgoingFormat, r.upstreamModel, bodyBytes, isStreaming)
+			span.SetError(err)
+			span.End()
+			if err != nil {
+				log.Warnf("channel proxy: failed to translate request from %s to %s: %v", incomingFormat, outgoingFormat, err)
+				c.JSON(http.StatusBadRequest, NewStandardError(http.StatusBadRequest, "failed to translate request: "+err.Error()))
+				return nil
 			}
+			bodyBytes = translated
+		}
 
-			// /v1/responses: if client asked for non-stream, force upstream stream=true
-			forcedUpstreamStream := false
-			if !isStreaming && strings.Contains(c.Request.URL.Path, "/v1/responses") {
-				forcedBody, forced := forceJSONStreamTrue(convertedBody)
-				if forced {
-					convertedBody = forcedBody
-					isStreaming = true
-					forcedUpstreamStream = true
-					c.Request.Body = io.NopCloser(bytes.NewReader(convertedBody))
-					c.Request.ContentLength = int64(len(convertedBody))
-					c.Request.Header.Set("Content-Length", fmt.Sprintf("%d", len(convertedBody)))
+		// Apply outgoing format filters (e.g., Claude system string to array)
+		filteredBody, filterErr := filters.ApplyFilters(outgoingFormat, bodyBytes)
+		if filterErr != nil {
+			log.Warnf("channel proxy: filter application failed: %v, using unfiltered body", filterErr)
+			filteredBody = bodyBytes
+		}
+		convertedBody = filteredBody
+
+		if outgoingFormat == translator.FormatClaude {
+			if cfg := GetProxyConfig(c.Request.Context()); cfg != nil {
+				if newBody, injected := ensureClaudeMetadataUserID(convertedBody, c.Request.Header.Get("User-Agent"), channel.APIKey); injected {
+					convertedBody = newBody
 				}
 			}
 
-			c.Request = c.Request.WithContext(WithStreamMode(c.Request.Context(), StreamMode{
-				ClientWantsStream:    clientWantsStream,
-				ForcedUpstreamStream: forcedUpstreamStream,
-			}))
+			if newBody, toolMap, changed := PrefixClaudeToolNamesWithMap(convertedBody); changed {
+				convertedBody = newBody
+				if len(toolMap) > 0 {
+					c.Request = c.Request.WithContext(WithClaudeToolNameMap(c.Request.Context(), toolMap))
+				}
+			}
 		}
 
-		// Store request info in context for response processing
-		var responseParam any
-		translationInfo := &TranslationInfo{
-			NeedsConversion:     false, // No conversion supported
-			IncomingFormat:      incomingFormat,
-			OutgoingFormat:      outgoingFormat,
-			OriginalRequestBody: originalRequestBody,
-			ConvertedBody:       convertedBody,
-			IsStreaming:         isStreaming,
-			Model:               originalModel,
-			UpstreamModel:       channelCfg.Model,
-			ResponseParam:       &responseParam,
+		if !bytes.Equal(convertedBody, r.body) {
+			c.Request.Body = io.NopCloser(bytes.NewReader(convertedBody))
+			c.Request.ContentLength = int64(len(convertedBody))
+			c.Request.Header.Set("Content-Length", fmt.Sprintf("%d", len(convertedBody)))
+		} else {
+			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 		}
-		c.Request = c.Request.WithContext(WithTranslationInfo(c.Request.Context(), translationInfo))
 
-		targetURL, err := buildUpstreamURL(channel, c.Request)
-		if err != nil {
-			log.Errorf("channel proxy: failed to build upstream URL: %v", err)
-			c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to build upstream URL"))
-			return
+		// 客户端请求非流式时改为流式请求上游，响应阶段再聚合为非流式 JSON（见 stream_aggregate.go）。
+		// Gemini 通过路径切换为 streamGenerateContent（getEndpointPath），其余格式设置 stream=true
+		forcedUpstreamStream := false
+		if !clientWantsStream && shouldForceUpstreamStream(incomingFormat, c.Request.URL.Path) {
+			if incomingFormat == translator.FormatGemini {
+				isStreaming = true
+				forcedUpstreamStream = true
+			} else if forcedBody, forced := forceJSONStreamTrue(convertedBody); forced {
+				convertedBody = forcedBody
+				isStreaming = true
+				forcedUpstreamStream = true
+				c.Request.Body = io.NopCloser(bytes.NewReader(convertedBody))
+				c.Request.ContentLength = int64(len(convertedBody))
+				c.Request.Header.Set("Content-Length", fmt.Sprintf("%d", len(convertedBody)))
+			}
 		}
 
-		parsed, err := url.Parse(targetURL)
-		if err != nil {
-			log.Errorf("channel proxy: failed to parse target URL: %v", err)
-			c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "invalid upstream URL"))
-			return
-		}
+		c.Request = c.Request.WithContext(WithStreamMode(c.Request.Context(), StreamMode{
+			ClientWantsStream:    clientWantsStream,
+			ForcedUpstreamStream: forcedUpstreamStream,
+		}))
+	}
 
-		// Get provider info for token extraction
-		providerInfo := ProviderInfoFromChannel(channel)
+	// Store request info in context for response processing
+	var responseParam any
+	translationInfo := &TranslationInfo{
+		NeedsConversion:     needsConversion,
+		IncomingFormat:      incomingFormat,
+		OutgoingFormat:      outgoingFormat,
+		OriginalRequestBody: originalRequestBody,
+		ConvertedBody:       convertedBody,
+		IsStreaming:         isStreaming,
+		Model:               originalModel,
+		UpstreamModel:       r.upstreamModel,
+		ResponseParam:       &responseParam,
+		Strict:              strictTranslation(channel),
+		ResponseSession:     session,
+	}
+	c.Request = c.Request.WithContext(WithTranslationInfo(c.Request.Context(), translationInfo))
 
-		// Create RequestTrace for logging (only for model invocations)
-		var trace *RequestTrace
-		if IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
-			if cfg := GetProxyConfig(c.Request.Context()); cfg != nil {
-				trace = NewRequestTrace(
-					uuid.New().String(),
-					cfg.UserID,
-					cfg.APIKeyID,
-					c.Request.Method,
-					c.Request.URL.Path,
-				)
-				// Set channel info
-				trace.SetChannel(channel.ID, string(channel.Type), channel.BaseURL)
-				trace.SetModels(originalModel, mappedModel)
-				// Set thinking level if applied
-				if thinkingLevel := GetThinkingLevel(c); thinkingLevel != "" {
-					trace.SetThinkingLevel(thinkingLevel)
-				}
-				// Store trace in context
-				c.Request = c.Request.WithContext(WithRequestTrace(c.Request.Context(), trace))
+	targetURL, err := buildUpstreamURL(channel, c.Request)
+	if err != nil {
+		log.Errorf("channel proxy: failed to build upstream URL: %v", err)
+		c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to build upstream URL"))
+		return nil
+	}
 
-				// Write pending record to database immediately
-				if writer := GetLogWriter(); writer != nil {
-					writer.WritePendingFromTrace(trace)
-				}
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		log.Errorf("channel proxy: failed to parse target URL: %v", err)
+		c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "invalid upstream URL"))
+		return nil
+	}
 
-				// Capture request detail for logging (same as amp upstream proxy)
-				if captureData := GetCaptureData(c.Request.Context()); captureData != nil {
-					StoreRequestDetail(trace.RequestID, captureData.RequestHeaders, captureData.RequestBody)
-				}
+	// Get provider info for token extraction
+	providerInfo := ProviderInfoFromChannel(channel)
+	switch outgoingFormat {
+	case translator.FormatOpenAIEmbeddings:
+		providerInfo = embeddingsProviderInfo
+	case translator.FormatOpenAIAudio:
+		providerInfo = audioProviderInfo
+	}
 
-				// Store translated request body if different from original
-				if transInfo := GetTranslationInfo(c.Request.Context()); transInfo != nil && transInfo.NeedsConversion && len(transInfo.ConvertedBody) > 0 {
-					StoreTranslatedRequestBody(trace.RequestID, transInfo.ConvertedBody)
-				}
+	// Create RequestTrace for logging (only for model invocations, subject to the request log policy)
+	trace := r.trace
+	logLevel := requestLogLevelFor(c.Request.Method, c.Request.URL.Path)
+	if trace != nil {
+		// 故障转移：沿用首次尝试的请求日志，更新为当前渠道
+		trace.SetChannel(channel.ID, string(channel.Type), channel.BaseURL)
+		c.Request = c.Request.WithContext(WithRequestTrace(c.Request.Context(), trace))
+		log.Infof("channel proxy: model invocation %s %s -> %s (model: %s, failover)", c.Request.Method, c.Request.URL.Path, sanitizeURL(targetURL), originalModel)
+	} else if IsModelInvocation(c.Request.Method, c.Request.URL.Path) && logLevel != model.RequestLogOff {
+		if cfg := GetProxyConfig(c.Request.Context()); cfg != nil {
+			trace = NewRequestTrace(
+				uuid.New().String(),
+				cfg.UserID,
+				cfg.APIKeyID,
+				c.Request.Method,
+				c.Request.URL.Path,
+			)
+			// Set channel info
+			trace.SetChannel(channel.ID, string(channel.Type), channel.BaseURL)
+			trace.SetModels(originalModel, mappedModel)
+			trace.SetSummaryOnly(logLevel == model.RequestLogSummary)
+			// Set thinking level if applied
+			if thinkingLevel := GetThinkingLevel(c); thinkingLevel != "" {
+				trace.SetThinkingLevel(thinkingLevel)
+			}
+			// Store trace in context
+			c.Request = c.Request.WithContext(WithRequestTrace(c.Request.Context(), trace))
+			r.trace = trace
 
-				log.Infof("channel proxy: model invocation %s %s -> %s (model: %s)", c.Request.Method, c.Request.URL.Path, sanitizeURL(targetURL), originalModel)
+			// Write pending record to database immediately
+			if writer := GetLogWriter(); writer != nil {
+				writer.WritePendingFromTrace(trace)
 			}
-		} else {
-			log.Debugf("channel proxy: %s %s -> %s (model: %s)", c.Request.Method, c.Request.URL.Path, sanitizeURL(targetURL), originalModel)
+
+			// Capture request detail for logging (same as amp upstream proxy)
+			if captureData := GetCaptureData(c.Request.Context()); captureData != nil && !trace.SummaryOnly() {
+				StoreRequestDetail(trace.RequestID, captureData.RequestHeaders, captureData.RequestBody)
+				StoreInjectedSystemPrompt(trace.RequestID, GetInjectedSystemPrompt(c.Request.Context()))
+				StorePIIRedactions(trace.RequestID, GetPIIRedactions(c.Request.Context()))
+			}
+
+			// Store translated request body if different from original
+			if transInfo := GetTranslationInfo(c.Request.Context()); transInfo != nil && transInfo.NeedsConversion && len(transInfo.ConvertedBody) > 0 && !trace.SummaryOnly() {
+				StoreTranslatedRequestBody(trace.RequestID, transInfo.ConvertedBody)
+			}
+
+			log.Infof("channel proxy: model invocation %s %s -> %s (model: %s)", c.Request.Method, c.Request.URL.Path, sanitizeURL(targetURL), originalModel)
 		}
+	} else {
+		log.Debugf("channel proxy: %s %s -> %s (model: %s)", c.Request.Method, c.Request.URL.Path, sanitizeURL(targetURL), originalModel)
+	}
 
-		proxy := &httputil.ReverseProxy{
-			// 使用共享的流式 Transport，支持连接复用
-			Transport: sharedChannelTransport,
-			Director: func(req *http.Request) {
-				req.URL.Scheme = parsed.Scheme
-				req.URL.Host = parsed.Host
-				req.URL.Path = parsed.Path
-				req.URL.RawQuery = parsed.RawQuery
-				req.Host = parsed.Host
+	// 按发往当前渠道的请求体估算输入 token，上游响应缺少用量时使用（音频请求按时长/字符计费，不估算）
+	if trace != nil && r.hasBody && providerInfo.Provider != ProviderOpenAIAudio {
+		trace.SetEstimatedInputTokens(estimateRequestTokens(convertedBody, usageEncoding(mappedModel, providerInfo.Provider)))
+	}
 
-				// Inject ProviderInfo into request context for token extraction
-				*req = *req.WithContext(WithProviderInfo(req.Context(), providerInfo))
+	var federationUser string
+	if channel.FederationIssuer != "" {
+		federationUser = federationOnBehalfOf(GetProxyConfig(c.Request.Context()))
+	}
 
-				// Inject ResponseWriter for SSE keep-alive support
-				*req = *req.WithContext(WithResponseWriter(req.Context(), c.Writer))
+	// 每次上游往返（含渠道内重试）记录一个 client span 并透传 traceparent
+	upstreamTransport := tracing.Transport(channelTransport(channel), "channel.upstream")
+
+	// 故障转移时的下一个渠道，由 ModifyResponse / ErrorHandler 设置
+	var failoverTo *model.Channel
+	attemptStart := time.Now()
+
+	proxy := &httputil.ReverseProxy{
+		// 使用共享的流式 Transport 支持连接复用，配置了 DNS 策略的渠道使用独立连接池
+		Transport: upstreamTransport,
+		Director: func(req *http.Request) {
+			req.URL.Scheme = parsed.Scheme
+			req.URL.Host = parsed.Host
+			req.URL.Path = parsed.Path
+			req.URL.RawQuery = parsed.RawQuery
+			req.Host = parsed.Host
+
+			// Inject ProviderInfo into request context for token extraction
+			*req = *req.WithContext(WithProviderInfo(req.Context(), providerInfo))
+
+			// Inject ResponseWriter for SSE keep-alive support
+			*req = *req.WithContext(WithResponseWriter(req.Context(), c.Writer))
+
+			// Remove client auth headers (ReverseProxy handles hop-by-hop headers automatically)
+			req.Header.Del("Authorization")
+			req.Header.Del("X-Api-Key")
+			req.Header.Del("x-api-key")
+			req.Header.Del("X-Goog-Api-Key")
+			req.Header.Del("x-goog-api-key")
+
+			// 强制流式或跨格式翻译时需要逐行解析 SSE，交给 Transport 协商压缩并自动解压
+			if mode, ok := GetStreamMode(req.Context()); (ok && mode.ForcedUpstreamStream) || needsConversion {
+				req.Header.Del("Accept-Encoding")
+			}
 
-				// Remove client auth headers (ReverseProxy handles hop-by-hop headers automatically)
-				req.Header.Del("Authorization")
-				req.Header.Del("X-Api-Key")
-				req.Header.Del("x-api-key")
-				req.Header.Del("X-Goog-Api-Key")
-				req.Header.Del("x-goog-api-key")
+			// 按渠道策略过滤客户端的 Anthropic-Beta（需在注入渠道必需的 beta 之前）
+			applyAnthropicBetaPolicy(req, channel)
 
-				// Filter Anthropic-Beta header for local/channel handling paths
-				filterAntropicBetaHeader(req)
+			// 按渠道请求头策略移除客户端请求头，之后注入的渠道请求头不受影响
+			headerPolicy := service.ChannelHeaderPolicy(channel)
+			stripClientHeadersByPolicy(req, channel, headerPolicy)
 
-				// Apply channel-specific authentication
-				applyChannelAuth(channel, req)
+			// Apply channel-specific authentication
+			applyChannelAuth(channel, req)
 
-				// Spoof User-Agent for OpenAI channels to mimic Codex CLI
-				if channel.Type == model.ChannelTypeOpenAI {
-					req.Header.Set("User-Agent", "codex_exec/0.98.0 (Mac OS 15.1.0; arm64) unknown")
-				}
+			// Spoof User-Agent for OpenAI channels to mimic Codex CLI
+			if channel.Type == model.ChannelTypeOpenAI {
+				req.Header.Set("User-Agent", "codex_exec/0.98.0 (Mac OS 15.1.0; arm64) unknown")
+			}
 
-				// For OpenAI Chat, inject stream_options.include_usage=true for streaming requests
-				if channel.Type == model.ChannelTypeOpenAI && channel.Endpoint != model.ChannelEndpointResponses {
-					injectOpenAIStreamOptions(req)
-				}
+			// For OpenAI Chat, inject stream_options.include_usage=true for streaming requests
+			if outgoingFormat == translator.FormatOpenAIChat {
+				injectOpenAIStreamOptions(req)
+			}
 
-				// Apply Claude CLI simulation if enabled for this channel
-				if channel.SimulateCLI && channel.Type == model.ChannelTypeClaude {
-					applyClaudeCLISimulation(req, true) // Claude Code requests are always streaming
-				}
+			// Apply Claude CLI simulation if enabled for this channel
+			if channel.SimulateCLI && channel.Type.Protocol() == model.ChannelTypeClaude {
+				applyClaudeCLISimulation(req, true) // Claude Code requests are always streaming
+			}
 
-				// Apply custom headers from channel config
-				var headersMap map[string]string
-				if err := json.Unmarshal([]byte(channel.HeadersJSON), &headersMap); err == nil {
-					for k, v := range headersMap {
-						req.Header.Set(k, v)
-					}
-				}
+			// 强制 User-Agent 覆盖内置的客户端模拟，自定义请求头仍可再覆盖
+			applyForcedUserAgent(req, headerPolicy)
 
-				// For Gemini, ensure no conflicting auth headers (but keep x-goog-api-key)
-				if channel.Type == model.ChannelTypeGemini {
-					req.Header.Del("Authorization")
-					req.Header.Del("X-Api-Key")
-					req.Header.Del("x-api-key")
+			// Apply custom headers from channel config
+			var headersMap map[string]string
+			if err := json.Unmarshal([]byte(channel.HeadersJSON), &headersMap); err == nil {
+				for k, v := range headersMap {
+					req.Header.Set(k, v)
 				}
-			},
-			FlushInterval: -1, // Flush immediately for SSE streaming support
-			ModifyResponse: func(resp *http.Response) error {
-				trace := GetRequestTrace(resp.Request.Context())
-				transInfo := GetTranslationInfo(resp.Request.Context())
-				isStreaming := strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream")
-				providerInfo, _ := GetProviderInfo(resp.Request.Context())
-
-				// /v1/responses: retry on concurrency-limit / retryable errors.
-				// This handles BOTH:
-				//   a) HTTP 200 + SSE stream starting with event: error (handled by SSEConcurrencyRetryWrapper)
-				//   b) HTTP 429/5xx with JSON/SSE error body (handled here directly)
-				isResponsesPath := strings.Contains(resp.Request.URL.Path, "/v1/responses")
-				if isResponsesPath {
-					log.Debugf("sse-retry: /v1/responses detected, status=%d, streaming=%v, content-type=%s",
-						resp.StatusCode, isStreaming, resp.Header.Get("Content-Type"))
-					if ti := GetTranslationInfo(resp.Request.Context()); ti != nil && len(ti.ConvertedBody) > 0 {
-						retryReq := resp.Request.Clone(resp.Request.Context())
-						makeRetryRequest := func() (*http.Response, error) {
-							clone := retryReq.Clone(retryReq.Context())
-							clone.Body = io.NopCloser(bytes.NewReader(ti.ConvertedBody))
-							clone.ContentLength = int64(len(ti.ConvertedBody))
-							return sharedChannelTransport.RoundTrip(clone)
-						}
+			}
 
-						// Case (b): non-2xx status — peek body to check if retryable
-						if resp.StatusCode == 429 || resp.StatusCode >= 500 {
-							bodyBytes, readErr := io.ReadAll(io.LimitReader(resp.Body, 8*1024))
-							resp.Body.Close()
-							if readErr == nil && isRetryableBytes(bodyBytes) {
-								log.Warnf("sse-retry: HTTP %d with retryable error body, starting retries", resp.StatusCode)
-								for attempt := 1; attempt <= sseConcurrencyRetryMax; attempt++ {
-									wait := sseConcurrencyRetryBaseWait * time.Duration(attempt)
-									log.Warnf("sse-retry: attempt %d/%d after %v", attempt, sseConcurrencyRetryMax, wait)
-									time.Sleep(wait)
-									retryResp, err := makeRetryRequest()
-									if err != nil {
-										log.Errorf("sse-retry: request failed: %v", err)
-										continue
-									}
-									resp.StatusCode = retryResp.StatusCode
-									resp.Status = retryResp.Status
-									resp.Header = retryResp.Header
-									resp.Body = retryResp.Body
-									resp.ContentLength = retryResp.ContentLength
-									resp.TransferEncoding = retryResp.TransferEncoding
-									isStreaming = strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream")
-									if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-										log.Infof("sse-retry: attempt %d succeeded with status %d", attempt, resp.StatusCode)
-										break
-									}
-									// Still error? Read body and check if retryable for next iteration
-									bodyBytes, readErr = io.ReadAll(io.LimitReader(resp.Body, 8*1024))
-									resp.Body.Close()
-									if readErr != nil || !isRetryableBytes(bodyBytes) {
-										// Not retryable, reconstruct body and stop
-										resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-										break
-									}
-								}
-							} else {
-								// Not retryable, reconstruct body so downstream can read it
-								resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-							}
-						}
+			// For Gemini, ensure no conflicting auth headers (but keep x-goog-api-key)
+			if channel.Type == model.ChannelTypeGemini {
+				req.Header.Del("Authorization")
+				req.Header.Del("X-Api-Key")
+				req.Header.Del("x-api-key")
+			}
 
-						// Case (a): SSE stream — wrap with retry for in-stream errors
-						if isStreaming {
-							log.Debugf("sse-retry: wrapping SSE stream with concurrency retry wrapper")
-							resp.Body = NewSSEConcurrencyRetryWrapper(resp.Body, func() (io.ReadCloser, error) {
+			// 联邦渠道最后签名，覆盖最终的请求体与路径
+			signChannelRequest(channel, req, federationUser)
+		},
+		FlushInterval: -1, // Flush immediately for SSE streaming support
+		ModifyResponse: withResponseHeaderPolicy(channel, func(resp *http.Response) error {
+			trace := GetRequestTrace(resp.Request.Context())
+			transInfo := GetTranslationInfo(resp.Request.Context())
+			isStreaming := strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream")
+			providerInfo, _ := GetProviderInfo(resp.Request.Context())
+
+			// 记录上游限流额度，供渠道容量建议使用
+			if rl, ok := health.ParseRateLimitHeaders(resp.Header); ok {
+				health.RecordRateLimit(channel.ID, rl)
+			}
+			cooldownChannelKey(channel, resp)
+
+			// Ollama 以 NDJSON 流式返回，转换为 SSE 后按流式响应处理
+			if channel.Type == model.ChannelTypeOllama && isNDJSONResponse(resp) {
+				resp.Body = newNDJSONSSEReader(resp.Body)
+				resp.Header.Set("Content-Type", "text/event-stream")
+				resp.Header.Del("Content-Length")
+				resp.ContentLength = -1
+				isStreaming = true
+			}
+
+			// /v1/responses: retry on concurrency-limit / retryable errors.
+			// This handles BOTH:
+			//   a) HTTP 200 + SSE stream starting with event: error (handled by SSEConcurrencyRetryWrapper)
+			//   b) HTTP 429/5xx with JSON/SSE error body (handled here directly)
+			isResponsesPath := strings.Contains(resp.Request.URL.Path, "/v1/responses")
+			if isResponsesPath {
+				log.Debugf("sse-retry: /v1/responses detected, status=%d, streaming=%v, content-type=%s",
+					resp.StatusCode, isStreaming, resp.Header.Get("Content-Type"))
+				if ti := GetTranslationInfo(resp.Request.Context()); ti != nil && len(ti.ConvertedBody) > 0 {
+					retryReq := resp.Request.Clone(resp.Request.Context())
+					makeRetryRequest := func() (*http.Response, error) {
+						clone := retryReq.Clone(retryReq.Context())
+						clone.Body = io.NopCloser(bytes.NewReader(ti.ConvertedBody))
+						clone.ContentLength = int64(len(ti.ConvertedBody))
+						return upstreamTransport.RoundTrip(clone)
+					}
+
+					// Case (b): non-2xx status — peek body to check if retryable
+					if resp.StatusCode == 429 || resp.StatusCode >= 500 {
+						bodyBytes, readErr := io.ReadAll(io.LimitReader(resp.Body, 8*1024))
+						resp.Body.Close()
+						if readErr == nil && isRetryableBytes(bodyBytes) {
+							log.Warnf("sse-retry: HTTP %d with retryable error body, starting retries", resp.StatusCode)
+							for attempt := 1; attempt <= sseConcurrencyRetryMax; attempt++ {
+								wait := sseConcurrencyRetryBaseWait * time.Duration(attempt)
+								log.Warnf("sse-retry: attempt %d/%d after %v", attempt, sseConcurrencyRetryMax, wait)
+								time.Sleep(wait)
 								retryResp, err := makeRetryRequest()
 								if err != nil {
-									return nil, err
+									log.Errorf("sse-retry: request failed: %v", err)
+									continue
+								}
+								resp.StatusCode = retryResp.StatusCode
+								resp.Status = retryResp.Status
+								resp.Header = retryResp.Header
+								resp.Body = retryResp.Body
+								resp.ContentLength = retryResp.ContentLength
+								resp.TransferEncoding = retryResp.TransferEncoding
+								isStreaming = strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream")
+								if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+									log.Infof("sse-retry: attempt %d succeeded with status %d", attempt, resp.StatusCode)
+									break
 								}
-								if retryResp.StatusCode < 200 || retryResp.StatusCode >= 300 {
-									retryResp.Body.Close()
-									return nil, fmt.Errorf("retry returned status %d", retryResp.StatusCode)
+								// Still error? Read body and check if retryable for next iteration
+								bodyBytes, readErr = io.ReadAll(io.LimitReader(resp.Body, 8*1024))
+								resp.Body.Close()
+								if readErr != nil || !isRetryableBytes(bodyBytes) {
+									// Not retryable, reconstruct body and stop
+									resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+									break
 								}
-								return retryResp.Body, nil
-							})
+							}
+						} else {
+							// Not retryable, reconstruct body so downstream can read it
+							resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 						}
-					} else {
-						log.Debugf("sse-retry: no ConvertedBody available, cannot retry")
 					}
-				}
 
-				// /v1/responses: if client requested non-stream but upstream responded with SSE,
-				// aggregate the SSE into a single JSON response.
-				if isStreaming && strings.Contains(resp.Request.URL.Path, "/v1/responses") {
-					if mode, ok := GetStreamMode(resp.Request.Context()); ok && !mode.ClientWantsStream {
-						jsonBody, assistantText, aggErr := aggregateOpenAIResponsesSSEToJSON(resp.Request.Context(), resp.Body)
-						_ = resp.Body.Close()
-						if aggErr != nil {
-							return aggErr
-						}
-						// Store the extracted assistant text in the trace for logging
-						if trace != nil && assistantText != "" {
-							trace.SetResponseText(assistantText)
-						}
-						resp.Body = io.NopCloser(bytes.NewReader(jsonBody))
-						resp.Header.Set("Content-Type", "application/json")
-						resp.Header.Del("Content-Encoding")
-						resp.Header.Del("Transfer-Encoding")
-						resp.TransferEncoding = nil
-						resp.ContentLength = int64(len(jsonBody))
-						resp.Header.Set("Content-Length", strconv.Itoa(len(jsonBody)))
-
-						isStreaming = false
+					// Case (a): SSE stream — wrap with retry for in-stream errors
+					if isStreaming {
+						log.Debugf("sse-retry: wrapping SSE stream with concurrency retry wrapper")
+						resp.Body = NewSSEConcurrencyRetryWrapper(resp.Body, func() (io.ReadCloser, error) {
+							retryResp, err := makeRetryRequest()
+							if err != nil {
+								return nil, err
+							}
+							if retryResp.StatusCode < 200 || retryResp.StatusCode >= 300 {
+								retryResp.Body.Close()
+								return nil, fmt.Errorf("retry returned status %d", retryResp.StatusCode)
+							}
+							return retryResp.Body, nil
+						})
 					}
+				} else {
+					log.Debugf("sse-retry: no ConvertedBody available, cannot retry")
+				}
+			}
+
+			// 上游失败且存在备用渠道时丢弃本次响应，由外层改用下一个渠道重新请求
+			if r.pickNext != nil && shouldFailoverStatus(GetChannelFailoverConfig(), resp.StatusCode) {
+				if next := r.pickNext(); next != nil {
+					log.Warnf("channel proxy: upstream returned status %d for %s, failing over", resp.StatusCode, sanitizeURL(targetURL))
+					_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+					resp.Body.Close()
+					recordChannelAttempt(trace, channel, attemptStart, resp.StatusCode, nil, true)
+					failoverTo = next
+					return errChannelFailover
 				}
+			}
 
-				// Log non-2xx responses
-				if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-					log.Warnf("channel proxy: upstream returned status %d for %s", resp.StatusCode, sanitizeURL(targetURL))
-					if trace != nil {
-						trace.SetError("upstream_error")
-						resp.Body = NewLoggingBodyWrapper(resp.Body, trace, resp.StatusCode, resp.Request.Context())
+			if r.failedOver {
+				recordChannelAttempt(trace, channel, attemptStart, resp.StatusCode, nil, false)
+			}
+
+			// If client requested non-stream but upstream responded with SSE,
+			// aggregate the SSE into a single JSON response of the same format.
+			var aggregate streamAggregator
+			if isStreaming && transInfo != nil {
+				aggregate = streamAggregatorFor(transInfo.OutgoingFormat)
+			}
+			if aggregate != nil {
+				if mode, ok := GetStreamMode(resp.Request.Context()); ok && !mode.ClientWantsStream {
+					// 聚合把整个上游流读入内存，读取的字节计入请求内存预算，超出时中止
+					body := newBudgetReader(resp.Body, memoryBudgetFrom(resp.Request.Context()), "stream_aggregation")
+					jsonBody, assistantText, aggErr := aggregate(resp.Request.Context(), body)
+					_ = resp.Body.Close()
+					body.done()
+					if aggErr != nil {
+						return aggErr
+					}
+					// Store the extracted assistant text in the trace for logging
+					if trace != nil && assistantText != "" {
+						trace.SetResponseText(assistantText)
+					}
+					resp.Body = io.NopCloser(bytes.NewReader(jsonBody))
+					resp.Header.Set("Content-Type", "application/json")
+					resp.Header.Del("Content-Encoding")
+					resp.Header.Del("Transfer-Encoding")
+					resp.TransferEncoding = nil
+					resp.ContentLength = int64(len(jsonBody))
+					resp.Header.Set("Content-Length", strconv.Itoa(len(jsonBody)))
+					if isAggregatedStreamError(jsonBody) {
+						resp.StatusCode = http.StatusBadGateway
+						resp.Status = http.StatusText(http.StatusBadGateway)
 					}
-					return nil
+
+					isStreaming = false
 				}
+			}
 
-				// For non-streaming responses, read the complete body upfront,
-				// apply all transformations, then reset body with correct Content-Length
-				if !isStreaming {
-					return handleNonStreamingResponse(resp, trace, transInfo, originalModel, mappedModel)
+			// Log non-2xx responses
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				log.Warnf("channel proxy: upstream returned status %d for %s", resp.StatusCode, sanitizeURL(targetURL))
+				if transInfo != nil && transInfo.NeedsConversion {
+					translateErrorResponse(resp, transInfo)
 				}
+				if trace != nil {
+					trace.SetError("upstream_error")
+					resp.Body = NewLoggingBodyWrapper(resp.Body, trace, resp.StatusCode, resp.Request.Context())
+				}
+				return nil
+			}
 
-				// Claude: unprefix only names we prefixed on the way out
-				if isStreaming && providerInfo.Provider == ProviderAnthropic {
-					if toolMap, ok := GetClaudeToolNameMap(resp.Request.Context()); ok && len(toolMap) > 0 {
-						resp.Body = NewSSETransformWrapper(resp.Body, func(b []byte) []byte {
-							out, _ := UnprefixClaudeToolNamesWithMap(b, toolMap)
-							return out
-						})
-					}
+			// 语音合成的音频数据与纯文本转写结果不做 JSON 处理，直接透传
+			if isAudioPassthroughResponse(resp, transInfo) {
+				handleAudioPassthroughResponse(resp, trace, transInfo)
+				return nil
+			}
+
+			// For non-streaming responses, read the complete body upfront,
+			// apply all transformations, then reset body with correct Content-Length
+			if !isStreaming {
+				return handleNonStreamingResponse(resp, trace, transInfo, originalModel, mappedModel)
+			}
+
+			// Claude: unprefix only names we prefixed on the way out
+			if isStreaming && providerInfo.Provider == ProviderAnthropic {
+				if toolMap, ok := GetClaudeToolNameMap(resp.Request.Context()); ok && len(toolMap) > 0 {
+					resp.Body = NewSSETransformWrapper(resp.Body, func(b []byte) []byte {
+						out, _ := UnprefixClaudeToolNamesWithMap(b, toolMap)
+						return out
+					})
 				}
+			}
 
-				// Streaming response handling (existing logic)
+			// 跨格式转发：按渠道格式提取 token 用量后，把 SSE 翻译为客户端格式
+			converted := transInfo != nil && transInfo.NeedsConversion
+			if converted {
 				if trace != nil {
 					resp.Body = WrapResponseBodyForTokenExtraction(resp.Body, isStreaming, trace, providerInfo)
-					resp.Body = NewResponseCaptureWrapper(resp.Body, trace.RequestID, resp.Header)
-					resp.Body = NewLoggingBodyWrapper(resp.Body, trace, resp.StatusCode, resp.Request.Context())
 				}
+				resp.Body = newTranslatingSSEWrapper(resp.Request.Context(), resp.Body, transInfo)
+				resp.Header.Del("Content-Length")
+				resp.ContentLength = -1
+			}
 
-				// Wrap SSE responses with keep-alive for long-running streams
-				if rw := GetResponseWriter(resp.Request.Context()); rw != nil {
-					// Check if pseudo-non-stream is enabled
-					if GetPseudoNonStream(resp.Request.Context()) {
-						var opts []PseudoNonStreamOption
-						if kw := GetAuditKeywords(resp.Request.Context()); len(kw) > 0 {
-							opts = append(opts, WithAuditKeywordsOption(kw))
-						}
-						// Build retry function using the request info available in ModifyResponse
-						if transInfo := GetTranslationInfo(resp.Request.Context()); transInfo != nil && len(transInfo.ConvertedBody) > 0 {
-							retryReq := resp.Request.Clone(resp.Request.Context())
-							opts = append(opts, WithRetryFunc(func() (io.ReadCloser, error) {
-								clone := retryReq.Clone(retryReq.Context())
-								clone.Body = io.NopCloser(bytes.NewReader(transInfo.ConvertedBody))
-								clone.ContentLength = int64(len(transInfo.ConvertedBody))
-								retryResp, err := sharedChannelTransport.RoundTrip(clone)
-								if err != nil {
-									return nil, err
-								}
-								if retryResp.StatusCode < 200 || retryResp.StatusCode >= 300 {
-									retryResp.Body.Close()
-									return nil, fmt.Errorf("retry returned status %d", retryResp.StatusCode)
-								}
-								return retryResp.Body, nil
-							}))
-						}
-						resp.Body = NewPseudoNonStreamBodyWrapper(resp.Body, rw, mappedModel, opts...)
-						log.Infof("channel proxy: enabled pseudo-non-stream buffering for streaming response (model: %s)", mappedModel)
-					} else if wrapper := NewSSEKeepAliveWrapper(resp.Body, rw, resp.Request.Context(), nil); wrapper != nil {
-						resp.Body = wrapper
-						log.Debugf("channel proxy: enabled SSE keep-alive for streaming response")
+			// 按输出过滤规则屏蔽或终止流式文本，在记录日志之前生效
+			if f := getOutputFilter(resp.Request.Context()); f != nil {
+				ctx := resp.Request.Context()
+				resp.Body = newOutputFilterSSEWrapper(resp.Body, f, incomingFormat, func(rule *outputFilterRule) {
+					recordOutputFilterIncident(ctx, rule, incomingFormat, true)
+				})
+			}
+			// 用户启用的后处理插件在内容块结束时执行收尾处理
+			resp.Body = newPostProcessSSEWrapper(resp.Request.Context(), resp.Body, incomingFormat)
+
+			// Streaming response handling (existing logic)
+			if trace != nil {
+				if !converted {
+					resp.Body = WrapResponseBodyForTokenExtraction(resp.Body, isStreaming, trace, providerInfo)
+				}
+				if !trace.SummaryOnly() {
+					resp.Body = NewResponseCaptureWrapper(resp.Request.Context(), resp.Body, trace.RequestID, resp.Header)
+				}
+				resp.Body = NewLoggingBodyWrapper(resp.Body, trace, resp.StatusCode, resp.Request.Context())
+			}
+
+			// Wrap SSE responses with keep-alive for long-running streams
+			if rw := GetResponseWriter(resp.Request.Context()); rw != nil {
+				// Check if pseudo-non-stream is enabled
+				if GetPseudoNonStream(resp.Request.Context()) {
+					var opts []PseudoNonStreamOption
+					if kw := GetAuditKeywords(resp.Request.Context()); len(kw) > 0 {
+						opts = append(opts, WithAuditKeywordsOption(kw))
+					}
+					// Build retry function using the request info available in ModifyResponse
+					if transInfo := GetTranslationInfo(resp.Request.Context()); transInfo != nil && len(transInfo.ConvertedBody) > 0 {
+						retryReq := resp.Request.Clone(resp.Request.Context())
+						opts = append(opts, WithRetryFunc(func() (io.ReadCloser, error) {
+							clone := retryReq.Clone(retryReq.Context())
+							clone.Body = io.NopCloser(bytes.NewReader(transInfo.ConvertedBody))
+							clone.ContentLength = int64(len(transInfo.ConvertedBody))
+							retryResp, err := upstreamTransport.RoundTrip(clone)
+							if err != nil {
+								return nil, err
+							}
+							if retryResp.StatusCode < 200 || retryResp.StatusCode >= 300 {
+								retryResp.Body.Close()
+								return nil, fmt.Errorf("retry returned status %d", retryResp.StatusCode)
+							}
+							return retryResp.Body, nil
+						}))
 					}
+					resp.Body = NewPseudoNonStreamBodyWrapper(resp.Body, rw, mappedModel, opts...)
+					log.Infof("channel proxy: enabled pseudo-non-stream buffering for streaming response (model: %s)", mappedModel)
+				} else if wrapper := NewSSEKeepAliveWrapper(resp.Body, rw, resp.Request.Context(), nil); wrapper != nil {
+					resp.Body = wrapper
+					log.Debugf("channel proxy: enabled SSE keep-alive for streaming response")
 				}
+			}
 
-				return nil
-			},
-			ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
-				log.Errorf("channel proxy: upstream request failed: %v", err)
-				// Update error log (pending record was already written)
+			return nil
+		}),
+		ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
+			if errors.Is(err, errChannelFailover) {
+				return
+			}
+			// 超出请求内存预算不是渠道故障，不做故障转移
+			if errors.Is(err, errMemoryBudgetExceeded) {
+				log.Warnf("channel proxy: response aborted: %v", err)
 				if trace != nil {
-					trace.SetError("upstream_request_failed")
+					trace.SetError(memoryBudgetExceededCode)
 					trace.SetResponse(http.StatusBadGateway)
 					if writer := GetLogWriter(); writer != nil {
 						writer.UpdateFromTrace(trace)
 					}
 				}
-				// 使用清理后的错误消息，防止泄露敏感信息
-				safeMsg := SanitizeError(err)
-				WriteErrorResponse(rw, http.StatusBadGateway, "Upstream request failed: "+safeMsg)
-			},
-		}
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(http.StatusBadGateway)
+				_ = json.NewEncoder(rw).Encode(memoryBudgetExceededError())
+				return
+			}
+			log.Errorf("channel proxy: upstream request failed: %v", err)
+			// 连接失败且客户端仍在等待时改用下一个渠道
+			if r.pickNext != nil && req.Context().Err() == nil {
+				if next := r.pickNext(); next != nil {
+					recordChannelAttempt(trace, channel, attemptStart, 0, err, true)
+					failoverTo = next
+					return
+				}
+			}
+			if r.failedOver {
+				recordChannelAttempt(trace, channel, attemptStart, 0, err, false)
+			}
+			// Update error log (pending record was already written)
+			if trace != nil {
+				trace.SetError("upstream_request_failed")
+				trace.SetResponse(http.StatusBadGateway)
+				if writer := GetLogWriter(); writer != nil {
+					writer.UpdateFromTrace(trace)
+				}
+			}
+			// 使用清理后的错误消息，防止泄露敏感信息
+			safeMsg := SanitizeError(err)
+			WriteErrorResponse(rw, http.StatusBadGateway, "Upstream request failed: "+safeMsg)
+		},
+	}
 
-		// Wrap ResponseWriter to rewrite model names in responses
-		wrappedWriter := newRewritingResponseWriter(c.Writer, originalModel, mappedModel)
-		proxy.ServeHTTP(wrappedWriter, c.Request)
-		wrappedWriter.Flush() // 确保非流式响应被发送给客户端
+	// Wrap ResponseWriter to rewrite model names in responses
+	wrappedWriter := newRewritingResponseWriter(c.Writer, originalModel, mappedModel)
+	proxy.ServeHTTP(wrappedWriter, c.Request)
+	if failoverTo != nil {
+		r.failedOver = true
+		return failoverTo
 	}
+	wrappedWriter.Flush() // 确保非流式响应被发送给客户端
+	return nil
 }
 
 func buildUpstreamURL(channel *model.Channel, req *http.Request) (string, error) {
@@ -766,11 +1117,13 @@ func buildUpstreamURL(channel *model.Channel, req *http.Request) (string, error)
 	upstreamPath := getEndpointPath(channel, req)
 
 	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + upstreamPath
-	parsed.RawQuery = req.URL.RawQuery
+	parsed.RawQuery = stripClientKeyQuery(req.URL.RawQuery)
 
 	if channel.Type == model.ChannelTypeGemini {
 		q := parsed.Query()
-		q.Set("key", channel.APIKey)
+		if channel.FederationIssuer == "" {
+			q.Set("key", channel.APIKey)
+		}
 		// For streaming requests, add alt=sse to get SSE format responses
 		if strings.Contains(upstreamPath, "streamGenerateContent") {
 			q.Set("alt", "sse")
@@ -778,7 +1131,7 @@ func buildUpstreamURL(channel *model.Channel, req *http.Request) (string, error)
 		parsed.RawQuery = q.Encode()
 	}
 
-	if channel.Type == model.ChannelTypeClaude {
+	if channel.Type.Protocol() == model.ChannelTypeClaude {
 		q := parsed.Query()
 		if q.Get("beta") != "true" {
 			q.Set("beta", "true")
@@ -789,14 +1142,29 @@ func buildUpstreamURL(channel *model.Channel, req *http.Request) (string, error)
 	return parsed.String(), nil
 }
 
+// stripClientKeyQuery 去掉查询参数中的 key：Gemini SDK 以 ?key= 携带 AMP API Key（见 extractAPIKey），
+// 不能转发给上游；没有 key 时保持原始查询字符串不变
+func stripClientKeyQuery(rawQuery string) string {
+	// 格式错误的查询参数同样解析出其余各项，key 仍会被去掉
+	query, _ := url.ParseQuery(rawQuery)
+	if !query.Has("key") {
+		return rawQuery
+	}
+	query.Del("key")
+	return query.Encode()
+}
+
 func getEndpointPath(channel *model.Channel, req *http.Request) string {
 	originalPath := req.URL.Path
 
 	// Check if we need format conversion (OpenAI request -> Gemini channel)
 	transInfo := GetTranslationInfo(req.Context())
 
-	switch channel.Type {
+	switch channel.Type.Protocol() {
 	case model.ChannelTypeOpenAI:
+		if isOpenAIPassthroughPath(originalPath) {
+			return passthroughEndpointPath(originalPath)
+		}
 		if channel.Endpoint == model.ChannelEndpointResponses {
 			return "/v1/responses"
 		}
@@ -830,19 +1198,30 @@ func getEndpointPath(channel *model.Channel, req *http.Request) string {
 		if strings.Contains(originalPath, "/v1beta1/publishers/google/models/") {
 			parts := strings.Split(originalPath, "/v1beta1/publishers/google/models/")
 			if len(parts) > 1 {
-				return "/v1beta/models/" + parts[1]
+				return forcedGeminiStreamPath(req, "/v1beta/models/"+parts[1])
 			}
 		}
-		if strings.Contains(originalPath, "/v1beta/models/") {
-			return originalPath
+		// 去掉 /api/provider/google 等本地路由前缀
+		if idx := strings.Index(originalPath, "/v1beta/models/"); idx != -1 {
+			return forcedGeminiStreamPath(req, originalPath[idx:])
 		}
 		return originalPath
+
+	case model.ChannelTypeOllama:
+		if channel.Endpoint == model.ChannelEndpointGenerate {
+			return "/api/generate"
+		}
+		return "/api/chat"
 	}
 
 	return originalPath
 }
 
 func applyChannelAuth(channel *model.Channel, req *http.Request) {
+	// 联邦渠道不发送 API Key，由 signChannelRequest 以其为密钥签名
+	if channel.FederationIssuer != "" {
+		return
+	}
 	switch channel.Type {
 	case model.ChannelTypeOpenAI:
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.APIKey))
@@ -850,8 +1229,18 @@ func applyChannelAuth(channel *model.Channel, req *http.Request) {
 		req.Header.Set("x-api-key", channel.APIKey)
 		req.Header.Set("anthropic-version", "2023-06-01")
 		ensureRequiredAnthropicBetas(req)
+	case model.ChannelTypeClaudeOAuth:
+		// claude.ai OAuth 访问令牌以 Bearer 发送，必需的 oauth beta 由 ensureRequiredAnthropicBetas 注入
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.APIKey))
+		req.Header.Set("anthropic-version", "2023-06-01")
+		ensureRequiredAnthropicBetas(req)
 	case model.ChannelTypeGemini:
 		req.Header.Set("x-goog-api-key", channel.APIKey)
+	case model.ChannelTypeOllama:
+		// Ollama 默认不需要认证，前置反向代理鉴权时填写 API Key
+		if channel.APIKey != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.APIKey))
+		}
 	}
 }
 
@@ -951,17 +1340,11 @@ func injectOpenAIStreamOptions(req *http.Request) {
 		return
 	}
 
-	contentType := req.Header.Get("Content-Type")
-	if !strings.Contains(contentType, "application/json") {
+	bodyBytes := readJSONRequestBody(req, maxRequestBodySize)
+	if bodyBytes == nil {
 		return
 	}
 
-	bodyBytes, err := io.ReadAll(io.LimitReader(req.Body, 10*1024*1024))
-	if err != nil {
-		return
-	}
-	req.Body.Close()
-
 	var payload map[string]interface{}
 	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
 		req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -1043,10 +1426,27 @@ func handleNonStreamingResponse(resp *http.Response, trace *RequestTrace, transI
 	contentEncoding := resp.Header.Get("Content-Encoding")
 	body = NewGzipDecompressor().Decompress(body, contentEncoding, resp.Header)
 
+	// 响应体已在内存中，超出预算时只记录；需要翻译时翻译结果是必需的第二份缓冲，超出预算则中止
+	budget := memoryBudgetFrom(resp.Request.Context())
+	if budget.reserve(len(body)) {
+		defer budget.release(len(body))
+	} else {
+		budget.degrade("response_body")
+	}
+
 	// Extract token usage for logging
 	if trace != nil {
 		info, _ := GetProviderInfo(resp.Request.Context())
+		if resp.StatusCode < http.StatusBadRequest {
+			NewResponseValidator(trace, info, false).ValidateBody(body)
+		}
 		extractTokenUsageFromBody(body, trace, &info)
+		if resp.StatusCode < http.StatusBadRequest && !trace.HasOutputTokens() {
+			estimateResponseOutput(trace, body, info.Provider)
+		}
+		if info.Provider == ProviderOpenAIAudio && resp.StatusCode < http.StatusBadRequest {
+			trace.SetAudioUsage(audioDurationSeconds(body), 0)
+		}
 	}
 
 	// Apply model name rewriting
@@ -1061,8 +1461,68 @@ func handleNonStreamingResponse(resp *http.Response, trace *RequestTrace, transI
 		}
 	}
 
+	// 跨格式转发：把渠道格式的响应翻译回客户端格式
+	if transInfo != nil && transInfo.NeedsConversion && !budget.reserve(len(body)) {
+		log.Warnf("channel proxy: %d byte response exceeds the memory budget for translation", len(body))
+		_ = budget.abort("translation")
+		body = memoryBudgetExceededResponse(resp)
+		resp.Header.Del("Content-Encoding")
+		if trace != nil {
+			trace.SetError(memoryBudgetExceededCode)
+		}
+	} else if transInfo != nil && transInfo.NeedsConversion {
+		defer budget.release(len(body))
+		span := startTranslationSpan(resp.Request.Context(), "translate.response", transInfo.OutgoingFormat, transInfo.IncomingFormat)
+		translated, err := translator.TranslateNonStream(resp.Request.Context(), transInfo.IncomingFormat, transInfo.OutgoingFormat, transInfo.Model, transInfo.OriginalRequestBody, transInfo.ConvertedBody, body, transInfo.ResponseParam)
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			log.Warnf("channel proxy: failed to translate %s response to %s: %v", transInfo.OutgoingFormat, transInfo.IncomingFormat, err)
+			if transInfo.Strict {
+				body = translationFailedResponse(resp, err)
+				resp.Header.Del("Content-Encoding")
+				if trace != nil {
+					trace.SetError(translationFailedCode)
+				}
+			}
+		} else {
+			body = []byte(translated)
+			resp.Header.Set("Content-Type", "application/json")
+			if resp.StatusCode < http.StatusBadRequest {
+				transInfo.ResponseSession.recordResponse(gjson.ParseBytes(body), time.Now())
+			}
+		}
+	}
+
+	// 输出过滤：命中 block 规则时改为返回 400 output_filtered
+	if f := getOutputFilter(resp.Request.Context()); f != nil && transInfo != nil && resp.StatusCode < http.StatusBadRequest {
+		ctx := resp.Request.Context()
+		text := newOutputFilterText(f, func(rule *outputFilterRule) {
+			recordOutputFilterIncident(ctx, rule, transInfo.IncomingFormat, false)
+		})
+		filtered, blocked := f.filterJSONResponse(transInfo.IncomingFormat, body, text)
+		if blocked != nil {
+			errResp := NewStandardError(http.StatusBadRequest, outputFilterBlockedMessage(blocked))
+			errResp.Error.Code = "output_filtered"
+			body, _ = json.Marshal(errResp)
+			resp.StatusCode = http.StatusBadRequest
+			resp.Status = http.StatusText(http.StatusBadRequest)
+			resp.Header.Set("Content-Type", "application/json")
+			resp.Header.Del("Content-Encoding")
+		} else {
+			body = filtered
+		}
+	}
+
+	// 用户启用的响应后处理插件
+	if transInfo != nil && resp.StatusCode < http.StatusBadRequest {
+		if pp := newResponsePostProcessing(GetProxyConfig(resp.Request.Context())); pp != nil {
+			body = pp.processJSONResponse(transInfo.IncomingFormat, body)
+		}
+	}
+
 	// Capture response for logging
-	if trace != nil {
+	if trace != nil && !trace.SummaryOnly() {
 		StoreResponseDetail(trace.RequestID, sanitizeHeaders(resp.Header), body)
 	}
 
@@ -1077,44 +1537,7 @@ func handleNonStreamingResponse(resp *http.Response, trace *RequestTrace, transI
 	if trace != nil {
 		trace.SetResponse(resp.StatusCode)
 
-		if calc := billing.GetCostCalculator(); calc != nil {
-			pricingModel := trace.MappedModel
-			if pricingModel == "" {
-				pricingModel = trace.OriginalModel
-			}
-			if pricingModel != "" {
-				costResult := calc.CalculateFromPointers(
-					pricingModel,
-					trace.InputTokens,
-					trace.OutputTokens,
-					trace.CacheReadInputTokens,
-					trace.CacheCreationInputTokens,
-				)
-				if costResult.PriceFound {
-					proxyCfg := GetProxyConfig(resp.Request.Context())
-					multiplier := 1.0
-					if proxyCfg != nil {
-						multiplier = proxyCfg.RateMultiplier
-						trace.RateMultiplier = multiplier
-					}
-
-					if multiplier == 0 {
-						trace.SetCost(costResult.CostMicros, costResult.CostUsd, costResult.PricingModel)
-					} else {
-						adjustedCostMicros := int64(float64(costResult.CostMicros) * multiplier)
-						adjustedCostUsd := fmt.Sprintf("%.6f", float64(adjustedCostMicros)/1e6)
-						trace.SetCost(adjustedCostMicros, adjustedCostUsd, costResult.PricingModel)
-
-						if proxyCfg != nil && adjustedCostMicros > 0 {
-							billingSvc := service.NewBillingService()
-							if err := billingSvc.SettleRequestCost(trace.RequestID, proxyCfg.UserID, adjustedCostMicros); err != nil {
-								log.Warnf("channel router: failed to settle cost for user %s: %v", proxyCfg.UserID, err)
-							}
-						}
-					}
-				}
-			}
-		}
+		settleTraceCost(trace, GetProxyConfig(resp.Request.Context()))
 
 		if writer := GetLogWriter(); writer != nil {
 			writer.UpdateFromTrace(trace)
@@ -0,0 +1,180 @@
+package amp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/health"
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultChannelStickyTTLSec = 3600
+	minChannelStickyTTLSec     = 60
+	maxChannelStickyTTLSec     = 7 * 24 * 3600
+	// channelStickyPruneInterval 清理过期会话绑定的间隔
+	channelStickyPruneInterval = time.Minute
+)
+
+var channelStickyState struct {
+	mu     sync.RWMutex
+	config model.ChannelStickyConfig
+}
+
+// channelStickyBinding 会话与渠道的绑定
+type channelStickyBinding struct {
+	channelID string
+	lastSeen  time.Time
+}
+
+var channelStickyBindings struct {
+	mu        sync.Mutex
+	items     map[string]*channelStickyBinding
+	lastPrune time.Time
+}
+
+func init() {
+	channelStickyState.config = DefaultChannelStickyConfig()
+	channelStickyBindings.items = make(map[string]*channelStickyBinding)
+}
+
+// DefaultChannelStickyConfig 默认关闭，开启后会话绑定保留 1 小时
+func DefaultChannelStickyConfig() model.ChannelStickyConfig {
+	return model.ChannelStickyConfig{TTLSec: defaultChannelStickyTTLSec}
+}
+
+// NormalizeChannelStickyConfig 填充未设置的字段
+func NormalizeChannelStickyConfig(cfg model.ChannelStickyConfig) model.ChannelStickyConfig {
+	if cfg.TTLSec <= 0 {
+		cfg.TTLSec = defaultChannelStickyTTLSec
+	}
+	return cfg
+}
+
+// ValidateChannelStickyConfig 校验会话粘性配置（需先 Normalize）
+func ValidateChannelStickyConfig(cfg model.ChannelStickyConfig) error {
+	if cfg.TTLSec < minChannelStickyTTLSec || cfg.TTLSec > maxChannelStickyTTLSec {
+		return fmt.Errorf("ttlSec 需在 %d 到 %d 之间", minChannelStickyTTLSec, maxChannelStickyTTLSec)
+	}
+	return nil
+}
+
+// InitChannelStickyConfig 从数据库 JSON 加载会话粘性配置
+func InitChannelStickyConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.ChannelStickyConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("channel sticky: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizeChannelStickyConfig(cfg)
+	if err := ValidateChannelStickyConfig(cfg); err != nil {
+		log.Warnf("channel sticky: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateChannelStickyConfig(cfg)
+}
+
+// UpdateChannelStickyConfig 更新运行时会话粘性配置，关闭时清空已有绑定
+func UpdateChannelStickyConfig(cfg model.ChannelStickyConfig) {
+	channelStickyState.mu.Lock()
+	channelStickyState.config = cfg
+	channelStickyState.mu.Unlock()
+
+	if !cfg.Enabled {
+		channelStickyBindings.mu.Lock()
+		channelStickyBindings.items = make(map[string]*channelStickyBinding)
+		channelStickyBindings.mu.Unlock()
+	}
+}
+
+// GetChannelStickyConfig 返回当前生效的会话粘性配置
+func GetChannelStickyConfig() model.ChannelStickyConfig {
+	channelStickyState.mu.RLock()
+	defer channelStickyState.mu.RUnlock()
+	return channelStickyState.config
+}
+
+// channelStickyKey 会话绑定的键，按用户、会话与模型区分；未开启或客户端未提供会话标识时为空
+func channelStickyKey(c *gin.Context, proxyCfg *ProxyConfig, modelName string) string {
+	if proxyCfg == nil || !GetChannelStickyConfig().Enabled {
+		return ""
+	}
+	for _, name := range conversationThreadHeaders {
+		if v := strings.TrimSpace(c.GetHeader(name)); v != "" {
+			return proxyCfg.UserID + ":" + v + ":" + strings.ToLower(modelName)
+		}
+	}
+	return ""
+}
+
+// stickyChannelID 返回会话绑定且未过期的渠道 ID
+func stickyChannelID(key string) string {
+	if key == "" {
+		return ""
+	}
+	ttl := time.Duration(GetChannelStickyConfig().TTLSec) * time.Second
+	now := time.Now()
+
+	channelStickyBindings.mu.Lock()
+	defer channelStickyBindings.mu.Unlock()
+	binding, ok := channelStickyBindings.items[key]
+	if !ok {
+		return ""
+	}
+	if now.Sub(binding.lastSeen) > ttl {
+		delete(channelStickyBindings.items, key)
+		return ""
+	}
+	binding.lastSeen = now
+	return binding.channelID
+}
+
+// bindStickyChannel 将会话绑定到渠道，顺带清理过期绑定
+func bindStickyChannel(key, channelID string) {
+	if key == "" || channelID == "" {
+		return
+	}
+	ttl := time.Duration(GetChannelStickyConfig().TTLSec) * time.Second
+	now := time.Now()
+
+	channelStickyBindings.mu.Lock()
+	defer channelStickyBindings.mu.Unlock()
+	if now.Sub(channelStickyBindings.lastPrune) > channelStickyPruneInterval {
+		for k, b := range channelStickyBindings.items {
+			if now.Sub(b.lastSeen) > ttl {
+				delete(channelStickyBindings.items, k)
+			}
+		}
+		channelStickyBindings.lastPrune = now
+	}
+	channelStickyBindings.items[key] = &channelStickyBinding{channelID: channelID, lastSeen: now}
+}
+
+// selectStickyChannel 会话已绑定渠道时，在该渠道仍可承接请求（启用、匹配模型、分组可用、未熔断且密钥有效）的前提下沿用它。
+// skip 与正常选择时的过滤条件相同；绑定渠道不可用时返回 nil，由调用方重新选择并更新绑定
+func selectStickyChannel(key, modelName string, groupIDs []string, skip func(*model.Channel) bool) *model.Channel {
+	boundID := stickyChannelID(key)
+	if boundID == "" {
+		return nil
+	}
+	channel, err := channelService.SelectFailoverChannel(modelName, groupIDs, func(ch *model.Channel) bool {
+		if ch.ID != boundID || !health.IsHealthy(ch.ID) || health.IsAuthFailed(ch.ID) {
+			return true
+		}
+		return skip != nil && skip(ch)
+	})
+	if err != nil {
+		log.Warnf("channel sticky: 选择绑定渠道失败: %v", err)
+		return nil
+	}
+	return channel
+}
@@ -0,0 +1,56 @@
+package amp
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChannelStickyBindings(t *testing.T) {
+	UpdateChannelStickyConfig(model.ChannelStickyConfig{Enabled: true, TTLSec: 60})
+	t.Cleanup(func() { UpdateChannelStickyConfig(DefaultChannelStickyConfig()) })
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	cfg := &ProxyConfig{UserID: "u"}
+	if key := channelStickyKey(c, cfg, "GPT-4o"); key != "" {
+		t.Fatalf("requests without a thread id should not be sticky, got %q", key)
+	}
+
+	c.Request.Header.Set("X-Amp-Thread-Id", "T-1")
+	key := channelStickyKey(c, cfg, "GPT-4o")
+	if key != "u:T-1:gpt-4o" {
+		t.Fatalf("unexpected sticky key %q", key)
+	}
+
+	bindStickyChannel(key, "ch1")
+	if got := stickyChannelID(key); got != "ch1" {
+		t.Fatalf("stickyChannelID = %q, want ch1", got)
+	}
+
+	channelStickyBindings.mu.Lock()
+	channelStickyBindings.items[key].lastSeen = time.Now().Add(-2 * time.Minute)
+	channelStickyBindings.mu.Unlock()
+	if got := stickyChannelID(key); got != "" {
+		t.Fatalf("expired binding should be dropped, got %q", got)
+	}
+
+	bindStickyChannel(key, "ch2")
+	UpdateChannelStickyConfig(model.ChannelStickyConfig{TTLSec: 60})
+	if channelStickyKey(c, cfg, "gpt-4o") != "" || stickyChannelID(key) != "" {
+		t.Fatal("disabling stickiness should clear bindings")
+	}
+}
+
+func TestValidateChannelStickyConfig(t *testing.T) {
+	if err := ValidateChannelStickyConfig(NormalizeChannelStickyConfig(model.ChannelStickyConfig{Enabled: true})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ValidateChannelStickyConfig(model.ChannelStickyConfig{Enabled: true, TTLSec: 10}); err == nil {
+		t.Fatal("expected too short ttl to be rejected")
+	}
+}
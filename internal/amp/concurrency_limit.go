@@ -0,0 +1,291 @@
+package amp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultConcurrencyQueueTimeoutSec = 30
+	maxConcurrencyQueueTimeoutSec     = 300
+	// concurrencyRetryAfterSec 超出并发上限时建议的重试间隔
+	concurrencyRetryAfterSec = 1
+)
+
+var concurrencyConfigState struct {
+	mu     sync.RWMutex
+	config model.ConcurrencyLimitConfig
+}
+
+// concurrencySlot 单条并发上限的占用计数
+type concurrencySlot struct {
+	scope    string
+	targetID string
+	userID   string
+	limit    int
+	inFlight int
+	queued   int
+}
+
+var concurrencyState struct {
+	sync.Mutex
+	slots map[string]*concurrencySlot
+	// released 每次释放占用时关闭并重建，唤醒排队中的请求重新检查
+	released chan struct{}
+}
+
+func init() {
+	concurrencyConfigState.config = NormalizeConcurrencyLimitConfig(model.ConcurrencyLimitConfig{})
+	concurrencyState.slots = make(map[string]*concurrencySlot)
+	concurrencyState.released = make(chan struct{})
+}
+
+// NormalizeConcurrencyLimitConfig 填充未设置的字段，默认超出上限立即拒绝
+func NormalizeConcurrencyLimitConfig(cfg model.ConcurrencyLimitConfig) model.ConcurrencyLimitConfig {
+	if cfg.Mode == "" {
+		cfg.Mode = model.ConcurrencyModeReject
+	}
+	if cfg.QueueTimeoutSec <= 0 {
+		cfg.QueueTimeoutSec = defaultConcurrencyQueueTimeoutSec
+	}
+	return cfg
+}
+
+// ValidateConcurrencyLimitConfig 校验并发上限配置（需先 Normalize）
+func ValidateConcurrencyLimitConfig(cfg model.ConcurrencyLimitConfig) error {
+	if cfg.Mode != model.ConcurrencyModeReject && cfg.Mode != model.ConcurrencyModeQueue {
+		return errors.New("mode 只能为 reject 或 queue")
+	}
+	if cfg.QueueTimeoutSec > maxConcurrencyQueueTimeoutSec {
+		return fmt.Errorf("queueTimeoutSec 不能超过 %d", maxConcurrencyQueueTimeoutSec)
+	}
+	return nil
+}
+
+// InitConcurrencyLimitConfig 从数据库 JSON 加载并发上限配置
+func InitConcurrencyLimitConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.ConcurrencyLimitConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("concurrency limit: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizeConcurrencyLimitConfig(cfg)
+	if err := ValidateConcurrencyLimitConfig(cfg); err != nil {
+		log.Warnf("concurrency limit: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateConcurrencyLimitConfig(cfg)
+}
+
+// UpdateConcurrencyLimitConfig 更新并发上限配置，立即生效
+func UpdateConcurrencyLimitConfig(cfg model.ConcurrencyLimitConfig) {
+	concurrencyConfigState.mu.Lock()
+	concurrencyConfigState.config = NormalizeConcurrencyLimitConfig(cfg)
+	concurrencyConfigState.mu.Unlock()
+}
+
+// GetConcurrencyLimitConfig 返回当前并发上限配置
+func GetConcurrencyLimitConfig() model.ConcurrencyLimitConfig {
+	concurrencyConfigState.mu.RLock()
+	defer concurrencyConfigState.mu.RUnlock()
+	return concurrencyConfigState.config
+}
+
+// GetConcurrencyLimitStatus 返回并发上限配置及各规则当前的占用（按占用数降序）
+func GetConcurrencyLimitStatus() model.ConcurrencyLimitStatus {
+	concurrencyState.Lock()
+	usage := make([]model.ConcurrencyUsage, 0, len(concurrencyState.slots))
+	for _, slot := range concurrencyState.slots {
+		usage = append(usage, model.ConcurrencyUsage{
+			Scope:    slot.scope,
+			TargetID: slot.targetID,
+			UserID:   slot.userID,
+			InFlight: slot.inFlight,
+			Limit:    slot.limit,
+			Queued:   slot.queued,
+		})
+	}
+	concurrencyState.Unlock()
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].InFlight != usage[j].InFlight {
+			return usage[i].InFlight > usage[j].InFlight
+		}
+		return usage[i].Scope+usage[i].TargetID+usage[i].UserID < usage[j].Scope+usage[j].TargetID+usage[j].UserID
+	})
+	return model.ConcurrencyLimitStatus{ConcurrencyLimitConfig: GetConcurrencyLimitConfig(), Usage: usage}
+}
+
+// concurrencyKeyFor 规则对应的计数键：分组规则按成员分别计数，用户与 API Key 规则按对象计数
+func concurrencyKeyFor(limit *model.RateLimit, userID string) (string, string) {
+	if limit.Scope == model.RateLimitScopeGroup {
+		return limit.Scope + ":" + limit.TargetID + ":" + userID, userID
+	}
+	return limit.Scope + ":" + limit.TargetID, ""
+}
+
+// concurrencyLease 已占用的并发计数，请求结束时释放
+type concurrencyLease struct {
+	keys []string
+	once sync.Once
+}
+
+// tryAcquireConcurrency 所有规则都有空位时各占用一个，否则不占用并返回第一条已满的规则
+func tryAcquireConcurrency(limits []*model.RateLimit, userID string) (*concurrencyLease, *model.RateLimit) {
+	concurrencyState.Lock()
+	defer concurrencyState.Unlock()
+
+	slots := make([]*concurrencySlot, 0, len(limits))
+	lease := &concurrencyLease{}
+	for _, limit := range limits {
+		key, member := concurrencyKeyFor(limit, userID)
+		slot, ok := concurrencyState.slots[key]
+		if !ok {
+			slot = &concurrencySlot{scope: limit.Scope, targetID: limit.TargetID, userID: member}
+			concurrencyState.slots[key] = slot
+		}
+		slot.limit = limit.MaxConcurrent
+		if slot.inFlight >= slot.limit {
+			pruneIdleConcurrencySlots()
+			return nil, limit
+		}
+		slots = append(slots, slot)
+		lease.keys = append(lease.keys, key)
+	}
+	for _, slot := range slots {
+		slot.inFlight++
+	}
+	return lease, nil
+}
+
+// setConcurrencyQueued 调整排队计数，仅用于状态展示
+func setConcurrencyQueued(limits []*model.RateLimit, userID string, delta int) {
+	concurrencyState.Lock()
+	defer concurrencyState.Unlock()
+	for _, limit := range limits {
+		key, _ := concurrencyKeyFor(limit, userID)
+		if slot, ok := concurrencyState.slots[key]; ok {
+			slot.queued += delta
+		}
+	}
+	pruneIdleConcurrencySlots()
+}
+
+// release 释放占用并唤醒排队中的请求，可重复调用
+func (l *concurrencyLease) release() {
+	l.once.Do(func() {
+		concurrencyState.Lock()
+		for _, key := range l.keys {
+			if slot, ok := concurrencyState.slots[key]; ok && slot.inFlight > 0 {
+				slot.inFlight--
+			}
+		}
+		pruneIdleConcurrencySlots()
+		close(concurrencyState.released)
+		concurrencyState.released = make(chan struct{})
+		concurrencyState.Unlock()
+	})
+}
+
+// pruneIdleConcurrencySlots 删除没有占用也没有排队的计数，调用方需持有锁
+func pruneIdleConcurrencySlots() {
+	for key, slot := range concurrencyState.slots {
+		if slot.inFlight == 0 && slot.queued == 0 {
+			delete(concurrencyState.slots, key)
+		}
+	}
+}
+
+func concurrencyReleased() <-chan struct{} {
+	concurrencyState.Lock()
+	defer concurrencyState.Unlock()
+	return concurrencyState.released
+}
+
+// ConcurrencyLimitMiddleware 按用户、API Key 与分组（按成员分别计算）限制同时进行中的模型调用数。
+// 超出上限时按配置立即返回 429 或排队等待空位；占用在 c.Next() 返回（流式响应转发完毕）后释放。
+// 计数保存在进程内，多实例部署时每个实例分别计算
+func ConcurrencyLimitMiddleware() gin.HandlerFunc {
+	rateLimitService := service.NewRateLimitService()
+	return func(c *gin.Context) {
+		cfg := GetProxyConfig(c.Request.Context())
+		if cfg == nil || !IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		var limits []*model.RateLimit
+		for _, limit := range rateLimitService.LimitsFor(cfg.UserID, cfg.APIKeyID, cfg.GroupIDs) {
+			if limit.MaxConcurrent > 0 {
+				limits = append(limits, limit)
+			}
+		}
+		if len(limits) == 0 {
+			c.Next()
+			return
+		}
+
+		lease, full := acquireConcurrency(c, limits, cfg.UserID)
+		if lease == nil {
+			if full != nil {
+				log.Infof("concurrency limit: rejected %s %s for user %s (%s %s, limit %d)", c.Request.Method, c.Request.URL.Path, cfg.UserID, full.Scope, full.TargetID, full.MaxConcurrent)
+				msg := fmt.Sprintf("concurrency limit exceeded: %s limit of %d concurrent requests", rateLimitScopeLabel(full.Scope), full.MaxConcurrent)
+				resp := NewStandardError(http.StatusTooManyRequests, msg)
+				resp.Error.Code = "concurrency_limit_exceeded"
+				c.Header("Retry-After", strconv.Itoa(concurrencyRetryAfterSec))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, resp)
+			}
+			return
+		}
+		defer lease.release()
+		c.Next()
+	}
+}
+
+// acquireConcurrency 占用并发计数；queue 模式下等待空位直到超时或客户端断开。
+// 返回 nil 租约时：full 非空表示应返回 429，否则客户端已断开且请求已中止
+func acquireConcurrency(c *gin.Context, limits []*model.RateLimit, userID string) (*concurrencyLease, *model.RateLimit) {
+	// 先取唤醒通道再检查，避免检查与等待之间的释放被错过
+	released := concurrencyReleased()
+	lease, full := tryAcquireConcurrency(limits, userID)
+	if lease != nil {
+		return lease, nil
+	}
+	cfg := GetConcurrencyLimitConfig()
+	if cfg.Mode != model.ConcurrencyModeQueue {
+		return nil, full
+	}
+
+	setConcurrencyQueued(limits, userID, 1)
+	defer setConcurrencyQueued(limits, userID, -1)
+	timer := time.NewTimer(time.Duration(cfg.QueueTimeoutSec) * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-released:
+		case <-timer.C:
+			return nil, full
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return nil, nil
+		}
+		released = concurrencyReleased()
+		if lease, full = tryAcquireConcurrency(limits, userID); lease != nil {
+			return lease, nil
+		}
+	}
+}
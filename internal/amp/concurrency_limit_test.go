@@ -0,0 +1,87 @@
+package amp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func resetConcurrencyState() {
+	concurrencyState.Lock()
+	concurrencyState.slots = make(map[string]*concurrencySlot)
+	concurrencyState.Unlock()
+	UpdateConcurrencyLimitConfig(model.ConcurrencyLimitConfig{})
+}
+
+func TestTryAcquireConcurrency_AllOrNothing(t *testing.T) {
+	resetConcurrencyState()
+	user := &model.RateLimit{Scope: model.RateLimitScopeUser, TargetID: "u1", MaxConcurrent: 5}
+	key := &model.RateLimit{Scope: model.RateLimitScopeAPIKey, TargetID: "k1", MaxConcurrent: 1}
+
+	first, full := tryAcquireConcurrency([]*model.RateLimit{user, key}, "u1")
+	if first == nil || full != nil {
+		t.Fatal("first request should be admitted")
+	}
+	if _, full := tryAcquireConcurrency([]*model.RateLimit{user, key}, "u1"); full != key {
+		t.Fatalf("api key limit should be full, got %+v", full)
+	}
+	concurrencyState.Lock()
+	inFlight := concurrencyState.slots["user:u1"].inFlight
+	concurrencyState.Unlock()
+	if inFlight != 1 {
+		t.Fatalf("rejected request must not hold the user slot, inFlight = %d", inFlight)
+	}
+
+	first.release()
+	first.release()
+	if len(GetConcurrencyLimitStatus().Usage) != 0 {
+		t.Fatal("idle slots should be pruned after release")
+	}
+	if lease, _ := tryAcquireConcurrency([]*model.RateLimit{user, key}, "u1"); lease == nil {
+		t.Fatal("slot should be free after release")
+	}
+}
+
+func TestTryAcquireConcurrency_GroupLimitIsPerMember(t *testing.T) {
+	resetConcurrencyState()
+	group := &model.RateLimit{Scope: model.RateLimitScopeGroup, TargetID: "g1", MaxConcurrent: 1}
+
+	if lease, _ := tryAcquireConcurrency([]*model.RateLimit{group}, "u1"); lease == nil {
+		t.Fatal("u1 should be admitted")
+	}
+	if lease, _ := tryAcquireConcurrency([]*model.RateLimit{group}, "u2"); lease == nil {
+		t.Fatal("group limit applies per member, u2 should be admitted")
+	}
+	if _, full := tryAcquireConcurrency([]*model.RateLimit{group}, "u1"); full != group {
+		t.Fatal("second request from u1 should hit the group limit")
+	}
+}
+
+func TestAcquireConcurrency_QueueWaitsForRelease(t *testing.T) {
+	resetConcurrencyState()
+	UpdateConcurrencyLimitConfig(model.ConcurrencyLimitConfig{Mode: model.ConcurrencyModeQueue, QueueTimeoutSec: 5})
+	limits := []*model.RateLimit{{Scope: model.RateLimitScopeUser, TargetID: "u1", MaxConcurrent: 1}}
+
+	held, _ := tryAcquireConcurrency(limits, "u1")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		held.release()
+	}()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	start := time.Now()
+	lease, full := acquireConcurrency(c, limits, "u1")
+	if lease == nil || full != nil {
+		t.Fatal("queued request should be admitted after release")
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("queued request should wait for the held slot")
+	}
+	lease.release()
+}
@@ -0,0 +1,157 @@
+package amp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ampmanager/internal/billing"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 估算输入 token 时，图片等 base64 内容按固定 token 数计算，避免按字节数严重高估
+const (
+	estimatedTokensPerBinaryItem = 1600
+	binaryStringMinLength        = 1024
+)
+
+// worstCaseCostEstimator 估算单次请求最高费用，测试中可替换
+var worstCaseCostEstimator = estimateWorstCaseCost
+
+// RequestCostCeilingMiddleware 在转发前估算单次请求的最高费用（输入 + max_tokens 输出），
+// 超过用户所在分组的上限时拒绝，防止单个超长输出请求耗尽余额。
+// 需在模型映射之后执行，以映射后的模型计价；无法确定模型、输出上限或价格时放行。
+// 分组倍率与实际计费一致，按 billing.ApplyRateMultiplier 换算（倍率 0 按 1 倍）。
+// 计费影子模式下只记录日志不拦截
+func RequestCostCeilingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		cfg := GetProxyConfig(c.Request.Context())
+		if cfg == nil || cfg.MaxRequestCostMicros <= 0 {
+			c.Next()
+			return
+		}
+
+		bodyBytes := readJSONRequestBody(c.Request, maxRequestBodySize)
+		if bodyBytes == nil {
+			c.Next()
+			return
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+			c.Next()
+			return
+		}
+
+		modelName, _ := extractModelFromRequestPath(c)
+		if modelName == "" {
+			modelName, _ = payload["model"].(string)
+		}
+		estimate, ok := worstCaseCostEstimator(modelName, payload)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		costMicros := billing.ApplyRateMultiplier(estimate, cfg.RateMultiplier)
+		if costMicros > cfg.MaxRequestCostMicros && service.IsBillingShadowMode() {
+			log.Infof("cost ceiling: 计费影子模式，放行用户 %s 的请求（模型 %s 预估最高费用 $%.4f 超过上限 $%.4f）",
+				cfg.UserID, modelName, float64(costMicros)/1e6, float64(cfg.MaxRequestCostMicros)/1e6)
+		} else if costMicros > cfg.MaxRequestCostMicros {
+			log.Warnf("cost ceiling: 拒绝用户 %s 的请求，模型 %s 预估最高费用 $%.4f 超过上限 $%.4f",
+				cfg.UserID, modelName, float64(costMicros)/1e6, float64(cfg.MaxRequestCostMicros)/1e6)
+			resp := NewStandardError(http.StatusBadRequest, fmt.Sprintf(
+				"预估单次请求最高费用 $%.4f 超过分组上限 $%.4f，请降低 max_tokens 或缩短输入",
+				float64(costMicros)/1e6, float64(cfg.MaxRequestCostMicros)/1e6))
+			resp.Error.Code = "request_cost_exceeded"
+			c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// estimateWorstCaseCost 按输入估算 token 与最大输出 token 计算费用（微美元，未乘分组倍率）
+func estimateWorstCaseCost(modelName string, payload map[string]interface{}) (int64, bool) {
+	if modelName == "" {
+		return 0, false
+	}
+	calc := billing.GetCostCalculator()
+	if calc == nil {
+		return 0, false
+	}
+
+	maxOutput := requestMaxOutputTokens(payload)
+	if maxOutput <= 0 {
+		if meta := GetModelMetadata(modelName); meta != nil {
+			maxOutput = meta.MaxCompletionTokens
+		}
+	}
+	if maxOutput <= 0 {
+		return 0, false
+	}
+
+	input := estimateInputTokens(payload)
+	result := calc.CalculateFromPointers(modelName, &input, &maxOutput, nil, nil)
+	if !result.PriceFound {
+		return 0, false
+	}
+	return result.CostMicros, true
+}
+
+// requestMaxOutputTokens 读取各格式请求中的最大输出 token 数
+func requestMaxOutputTokens(payload map[string]interface{}) int {
+	for _, key := range []string{"max_tokens", "max_completion_tokens", "max_output_tokens"} {
+		if v, ok := payload[key].(float64); ok && v > 0 {
+			return int(v)
+		}
+	}
+	if gen, ok := payload["generationConfig"].(map[string]interface{}); ok {
+		if v, ok := gen["maxOutputTokens"].(float64); ok && v > 0 {
+			return int(v)
+		}
+	}
+	return 0
+}
+
+// estimateInputTokens 粗略估算输入 token：文本按 4 字符 1 token，base64 内容按固定值
+func estimateInputTokens(v interface{}) int {
+	switch val := v.(type) {
+	case string:
+		if isBinaryString(val) {
+			return estimatedTokensPerBinaryItem
+		}
+		return len(val)/4 + 1
+	case map[string]interface{}:
+		total := 0
+		for _, item := range val {
+			total += estimateInputTokens(item)
+		}
+		return total
+	case []interface{}:
+		total := 0
+		for _, item := range val {
+			total += estimateInputTokens(item)
+		}
+		return total
+	default:
+		return 0
+	}
+}
+
+func isBinaryString(s string) bool {
+	if strings.HasPrefix(s, "data:") {
+		return true
+	}
+	return len(s) >= binaryStringMinLength && !strings.ContainsAny(s, " \n")
+}
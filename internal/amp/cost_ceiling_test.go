@@ -0,0 +1,90 @@
+package amp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestMaxOutputTokens(t *testing.T) {
+	cases := map[string]int{
+		`{"max_tokens":4096}`:                           4096,
+		`{"max_completion_tokens":1000}`:                1000,
+		`{"max_output_tokens":2000}`:                    2000,
+		`{"generationConfig":{"maxOutputTokens":8192}}`: 8192,
+		`{"messages":[{"role":"user","content":"hi"}]}`: 0,
+	}
+	for body, want := range cases {
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if got := requestMaxOutputTokens(payload); got != want {
+			t.Errorf("%s: got %d, want %d", body, got, want)
+		}
+	}
+}
+
+func TestEstimateInputTokens_Base64CountsAsFixed(t *testing.T) {
+	image := strings.Repeat("QUJD", 100000)
+	payload := map[string]interface{}{
+		"messages": []interface{}{
+			map[string]interface{}{"role": "user", "content": strings.Repeat("word ", 400)},
+			map[string]interface{}{"type": "image", "source": map[string]interface{}{"data": image}},
+		},
+	}
+
+	got := estimateInputTokens(payload)
+	if got < estimatedTokensPerBinaryItem || got > estimatedTokensPerBinaryItem+600 {
+		t.Fatalf("unexpected estimate %d", got)
+	}
+}
+
+func withWorstCaseCostEstimate(t *testing.T, costMicros int64) {
+	t.Helper()
+	prev := worstCaseCostEstimator
+	worstCaseCostEstimator = func(string, map[string]interface{}) (int64, bool) { return costMicros, true }
+	t.Cleanup(func() { worstCaseCostEstimator = prev })
+}
+
+// 倍率与计费一致：0 按 1 倍计算，不会跳过上限检查
+func TestRequestCostCeilingMiddlewareRateMultiplier(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withWorstCaseCostEstimate(t, 2_000_000)
+
+	cases := []struct {
+		name       string
+		multiplier float64
+		want       int
+	}{
+		{"zero multiplier bills at 1x", 0, http.StatusBadRequest},
+		{"1x", 1, http.StatusBadRequest},
+		{"discount under ceiling", 0.4, http.StatusOK},
+		{"markup", 3, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		cfg := &ProxyConfig{UserID: "u1", RateMultiplier: tc.multiplier, MaxRequestCostMicros: 1_000_000}
+		engine := gin.New()
+		engine.Use(func(c *gin.Context) {
+			c.Request = c.Request.WithContext(WithProxyConfig(c.Request.Context(), cfg))
+			c.Next()
+		})
+		engine.Use(RequestCostCeilingMiddleware())
+		engine.POST("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4","max_tokens":64000,"messages":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d, body = %s", tc.name, w.Code, tc.want, w.Body.String())
+		}
+		if tc.want == http.StatusBadRequest && !strings.Contains(w.Body.String(), "request_cost_exceeded") {
+			t.Errorf("%s: body = %s", tc.name, w.Body.String())
+		}
+	}
+}
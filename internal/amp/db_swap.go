@@ -0,0 +1,127 @@
+package amp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultDrainTimeout 替换数据库前等待进行中请求结束的默认时长
+const DefaultDrainTimeout = 60 * time.Second
+
+const dbSwapMessage = "数据库恢复中，请稍后重试"
+
+var (
+	// dbSwapMu 同一时间只允许一次数据库替换
+	dbSwapMu   sync.Mutex
+	dbSwapping atomic.Bool
+)
+
+// DatabaseSwap 一次进行中的数据库替换，替换完成（无论成功或回滚）后必须调用 End
+type DatabaseSwap struct {
+	prevMaintenance model.MaintenanceConfig
+	startedAt       time.Time
+	endOnce         sync.Once
+}
+
+// BeginDatabaseSwap 为替换数据库文件做准备：
+// 开启维护模式阻止新的模型调用（排队等待），等待进行中的请求（含流式响应）结束，
+// 再停止日志写入器、请求详情存储和 pending 清理器并将缓冲数据写入当前数据库。
+// 等待超时时恢复原状态并返回错误，此时数据库未被改动。
+func BeginDatabaseSwap(ctx context.Context) (*DatabaseSwap, error) {
+	if !dbSwapMu.TryLock() {
+		return nil, fmt.Errorf("已有数据库替换正在进行")
+	}
+
+	swap := &DatabaseSwap{prevMaintenance: GetMaintenanceConfig(), startedAt: time.Now()}
+	if !swap.prevMaintenance.Enabled {
+		// 替换通常很快完成，新请求排队等待而不是直接失败
+		cfg := swap.prevMaintenance
+		cfg.Enabled = true
+		cfg.Mode = model.MaintenanceModeQueue
+		cfg.Message = dbSwapMessage
+		UpdateMaintenanceConfig(cfg)
+	}
+
+	if err := WaitForInflightDrain(ctx); err != nil {
+		inflight := InflightInvocations()
+		UpdateMaintenanceConfig(swap.prevMaintenance)
+		dbSwapMu.Unlock()
+		return nil, fmt.Errorf("仍有 %d 个请求未完成，已取消: %w", inflight, err)
+	}
+
+	dbSwapping.Store(true)
+	stopDatabaseWriters()
+	log.Infof("db swap: 已排空进行中的请求并写入缓冲日志，耗时 %v", time.Since(swap.startedAt).Round(time.Millisecond))
+	return swap, nil
+}
+
+// End 使用当前数据库连接（新库或回滚后的旧库）重建后台组件，并恢复维护模式原状态
+func (s *DatabaseSwap) End() {
+	s.endOnce.Do(func() {
+		if db := database.GetDB(); db != nil {
+			ReinitLogWriter(db)
+			ReinitRequestDetailStore(db)
+			ReinitPendingCleaner(db)
+			ReinitLogRetentionPruner(db)
+		} else {
+			log.Error("db swap: 数据库不可用，后台组件未重建")
+		}
+		dbSwapping.Store(false)
+		UpdateMaintenanceConfig(s.prevMaintenance)
+		dbSwapMu.Unlock()
+		log.Infof("db swap: 已恢复服务，总耗时 %v", time.Since(s.startedAt).Round(time.Millisecond))
+	})
+}
+
+// IsDatabaseSwapping 返回是否正在替换数据库
+func IsDatabaseSwapping() bool {
+	return dbSwapping.Load()
+}
+
+// stopDatabaseWriters 停止依赖数据库的后台组件，Stop 会把缓冲数据写入数据库
+func stopDatabaseWriters() {
+	logWriterMu.Lock()
+	if globalLogWriter != nil {
+		globalLogWriter.Stop()
+	}
+	logWriterMu.Unlock()
+
+	detailStoreMu.Lock()
+	if globalDetailStore != nil {
+		globalDetailStore.Stop()
+	}
+	detailStoreMu.Unlock()
+
+	if globalPendingCleaner != nil {
+		globalPendingCleaner.Stop()
+	}
+
+	logRetentionPrunerMu.Lock()
+	if globalLogRetentionPruner != nil {
+		globalLogRetentionPruner.Stop()
+	}
+	logRetentionPrunerMu.Unlock()
+}
+
+// DatabaseSwapGuard 数据库替换期间拒绝访问数据库的请求
+// 模型调用由维护模式排队，不会到达此处
+func DatabaseSwapGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsDatabaseSwapping() {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", "5")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": dbSwapMessage})
+	}
+}
@@ -0,0 +1,200 @@
+package amp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+)
+
+// DemoProviderPrefix 内置假上游的路由前缀（仅演示模式下注册）
+const DemoProviderPrefix = "/demo/upstream"
+
+const demoReplyText = "This is a synthetic response from the AMP-Manager demo provider. No real model was called."
+
+// RegisterDemoProviderRoutes 注册内置假上游，按 OpenAI / Anthropic / Gemini 格式返回固定内容和用量，
+// 演示模式下的渠道指向这里，不会访问任何真实服务
+func RegisterDemoProviderRoutes(r *gin.Engine) {
+	g := r.Group(DemoProviderPrefix)
+	g.GET("/v1/models", demoListModels)
+	g.POST("/v1/chat/completions", demoChatCompletions)
+	g.POST("/v1/responses", demoResponses)
+	g.POST("/v1/messages", demoMessages)
+	g.POST("/v1beta/models/*action", demoGemini)
+}
+
+// demoUsage 根据请求体大小估算输入 token，输出 token 固定
+func demoUsage(body []byte) (int, int) {
+	input := len(body)/4 + 8
+	output := len(strings.Fields(demoReplyText))
+	return input, output
+}
+
+func demoReadBody(c *gin.Context) []byte {
+	body, _ := io.ReadAll(io.LimitReader(c.Request.Body, 10<<20))
+	return body
+}
+
+func demoListModels(c *gin.Context) {
+	models := []string{"demo-gpt", "demo-claude", "demo-gemini"}
+	data := make([]gin.H, 0, len(models))
+	for _, id := range models {
+		data = append(data, gin.H{"id": id, "object": "model", "owned_by": "amp-manager-demo"})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+func demoChatCompletions(c *gin.Context) {
+	body := demoReadBody(c)
+	modelName := gjson.GetBytes(body, "model").String()
+	input, output := demoUsage(body)
+	id := "chatcmpl-demo-" + uuid.NewString()[:8]
+	created := time.Now().Unix()
+	usage := gin.H{"prompt_tokens": input, "completion_tokens": output, "total_tokens": input + output}
+
+	if !gjson.GetBytes(body, "stream").Bool() {
+		c.JSON(http.StatusOK, gin.H{
+			"id": id, "object": "chat.completion", "created": created, "model": modelName,
+			"choices": []gin.H{{
+				"index":         0,
+				"message":       gin.H{"role": "assistant", "content": demoReplyText},
+				"finish_reason": "stop",
+			}},
+			"usage": usage,
+		})
+		return
+	}
+
+	w := demoSSE(c)
+	for _, word := range strings.Fields(demoReplyText) {
+		w.data(gin.H{
+			"id": id, "object": "chat.completion.chunk", "created": created, "model": modelName,
+			"choices": []gin.H{{"index": 0, "delta": gin.H{"content": word + " "}}},
+		})
+	}
+	w.data(gin.H{
+		"id": id, "object": "chat.completion.chunk", "created": created, "model": modelName,
+		"choices": []gin.H{{"index": 0, "delta": gin.H{}, "finish_reason": "stop"}},
+		"usage":   usage,
+	})
+	w.done()
+}
+
+func demoResponses(c *gin.Context) {
+	body := demoReadBody(c)
+	modelName := gjson.GetBytes(body, "model").String()
+	input, output := demoUsage(body)
+	response := gin.H{
+		"id": "resp_demo_" + uuid.NewString()[:8], "object": "response", "status": "completed",
+		"created_at": time.Now().Unix(), "model": modelName,
+		"output": []gin.H{{
+			"type": "message", "role": "assistant", "status": "completed",
+			"content": []gin.H{{"type": "output_text", "text": demoReplyText}},
+		}},
+		"usage": gin.H{"input_tokens": input, "output_tokens": output, "total_tokens": input + output},
+	}
+
+	if !gjson.GetBytes(body, "stream").Bool() {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	w := demoSSE(c)
+	w.event("response.created", gin.H{"type": "response.created", "response": gin.H{"id": response["id"], "model": modelName, "status": "in_progress"}})
+	for _, word := range strings.Fields(demoReplyText) {
+		w.event("response.output_text.delta", gin.H{"type": "response.output_text.delta", "output_index": 0, "content_index": 0, "delta": word + " "})
+	}
+	w.event("response.completed", gin.H{"type": "response.completed", "response": response})
+}
+
+func demoMessages(c *gin.Context) {
+	body := demoReadBody(c)
+	modelName := gjson.GetBytes(body, "model").String()
+	input, output := demoUsage(body)
+	id := "msg_demo_" + uuid.NewString()[:8]
+
+	if !gjson.GetBytes(body, "stream").Bool() {
+		c.JSON(http.StatusOK, gin.H{
+			"id": id, "type": "message", "role": "assistant", "model": modelName,
+			"content":     []gin.H{{"type": "text", "text": demoReplyText}},
+			"stop_reason": "end_turn",
+			"usage":       gin.H{"input_tokens": input, "output_tokens": output},
+		})
+		return
+	}
+
+	w := demoSSE(c)
+	w.event("message_start", gin.H{"type": "message_start", "message": gin.H{
+		"id": id, "type": "message", "role": "assistant", "model": modelName, "content": []gin.H{},
+		"usage": gin.H{"input_tokens": input, "output_tokens": 1},
+	}})
+	w.event("content_block_start", gin.H{"type": "content_block_start", "index": 0, "content_block": gin.H{"type": "text", "text": ""}})
+	for _, word := range strings.Fields(demoReplyText) {
+		w.event("content_block_delta", gin.H{"type": "content_block_delta", "index": 0, "delta": gin.H{"type": "text_delta", "text": word + " "}})
+	}
+	w.event("content_block_stop", gin.H{"type": "content_block_stop", "index": 0})
+	w.event("message_delta", gin.H{"type": "message_delta", "delta": gin.H{"stop_reason": "end_turn"}, "usage": gin.H{"output_tokens": output}})
+	w.event("message_stop", gin.H{"type": "message_stop"})
+}
+
+func demoGemini(c *gin.Context) {
+	body := demoReadBody(c)
+	input, output := demoUsage(body)
+	action := c.Param("action")
+	modelName := strings.TrimPrefix(strings.SplitN(action, ":", 2)[0], "/")
+	chunk := func(text string, final bool) gin.H {
+		candidate := gin.H{"index": 0, "content": gin.H{"role": "model", "parts": []gin.H{{"text": text}}}}
+		result := gin.H{"candidates": []gin.H{candidate}, "modelVersion": modelName}
+		if final {
+			candidate["finishReason"] = "STOP"
+			result["usageMetadata"] = gin.H{"promptTokenCount": input, "candidatesTokenCount": output, "totalTokenCount": input + output}
+		}
+		return result
+	}
+
+	if !strings.HasSuffix(action, ":streamGenerateContent") {
+		c.JSON(http.StatusOK, chunk(demoReplyText, true))
+		return
+	}
+
+	w := demoSSE(c)
+	words := strings.Fields(demoReplyText)
+	for i, word := range words {
+		w.data(chunk(word+" ", i == len(words)-1))
+	}
+}
+
+// demoSSEWriter 逐条写出 SSE 事件，每条事件写完后立即刷新
+type demoSSEWriter struct {
+	c   *gin.Context
+	sse *translator.SSEEventWriter
+}
+
+func demoSSE(c *gin.Context) *demoSSEWriter {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	return &demoSSEWriter{c: c, sse: translator.NewSSEEventWriter(c.Writer)}
+}
+
+func (w *demoSSEWriter) data(payload any) {
+	w.event("", payload)
+}
+
+func (w *demoSSEWriter) event(name string, payload any) {
+	data, _ := json.Marshal(payload)
+	_ = w.sse.WriteEvent(name, string(data))
+	w.c.Writer.Flush()
+}
+
+func (w *demoSSEWriter) done() {
+	_ = w.sse.WriteDone()
+	w.c.Writer.Flush()
+}
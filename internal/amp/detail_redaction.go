@@ -0,0 +1,284 @@
+package amp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRedactionMinEntropy     = 4.0
+	defaultRedactionMinTokenLength = 24
+	minRedactionTokenLength        = 12
+	// maxRedactionTokenLength 更长的随机串多为图片等 base64 内容，不参与熵检测
+	maxRedactionTokenLength   = 256
+	maxDetailRedactionRules   = 50
+	maxRedactionMinEntropyCap = 6.0
+)
+
+// detailRedactionBuiltinPatterns 内置的密钥格式：与输出过滤识别的提示中密钥一致，另加 Bearer 令牌
+var detailRedactionBuiltinPatterns = append([]*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{16,}=*`),
+}, promptSecretPatterns...)
+
+// detailRedactor 编译后的脱敏规则
+type detailRedactor struct {
+	patterns    []*regexp.Regexp
+	tokenRe     *regexp.Regexp
+	minEntropy  float64
+	replacement string
+}
+
+var detailRedactionState struct {
+	mu       sync.RWMutex
+	config   model.DetailRedactionConfig
+	redactor *detailRedactor
+}
+
+func init() {
+	cfg := DefaultDetailRedactionConfig()
+	redactor, _ := compileDetailRedactor(cfg)
+	detailRedactionState.config = cfg
+	detailRedactionState.redactor = redactor
+}
+
+// DefaultDetailRedactionConfig 默认启用内置规则与熵检测
+func DefaultDetailRedactionConfig() model.DetailRedactionConfig {
+	return NormalizeDetailRedactionConfig(model.DetailRedactionConfig{
+		Enabled:          true,
+		BuiltinPatterns:  true,
+		EntropyDetection: true,
+	})
+}
+
+// NormalizeDetailRedactionConfig 填充未设置的字段
+func NormalizeDetailRedactionConfig(cfg model.DetailRedactionConfig) model.DetailRedactionConfig {
+	if cfg.Patterns == nil {
+		cfg.Patterns = []model.DetailRedactionPattern{}
+	}
+	for i := range cfg.Patterns {
+		cfg.Patterns[i].Name = strings.TrimSpace(cfg.Patterns[i].Name)
+		if cfg.Patterns[i].Name == "" {
+			cfg.Patterns[i].Name = fmt.Sprintf("rule-%d", i+1)
+		}
+	}
+	if cfg.MinEntropy <= 0 {
+		cfg.MinEntropy = defaultRedactionMinEntropy
+	}
+	if cfg.MinTokenLength <= 0 {
+		cfg.MinTokenLength = defaultRedactionMinTokenLength
+	}
+	if cfg.Replacement == "" {
+		cfg.Replacement = defaultOutputFilterMask
+	}
+	return cfg
+}
+
+// ValidateDetailRedactionConfig 校验脱敏配置（需先 Normalize）
+func ValidateDetailRedactionConfig(cfg model.DetailRedactionConfig) error {
+	if len(cfg.Patterns) > maxDetailRedactionRules {
+		return fmt.Errorf("规则数不能超过 %d", maxDetailRedactionRules)
+	}
+	if cfg.MinEntropy > maxRedactionMinEntropyCap {
+		return fmt.Errorf("minEntropy 不能超过 %.1f", maxRedactionMinEntropyCap)
+	}
+	if cfg.MinTokenLength < minRedactionTokenLength || cfg.MinTokenLength > maxRedactionTokenLength {
+		return fmt.Errorf("minTokenLength 必须在 %d 到 %d 之间", minRedactionTokenLength, maxRedactionTokenLength)
+	}
+	_, err := compileDetailRedactor(cfg)
+	return err
+}
+
+func compileDetailRedactor(cfg model.DetailRedactionConfig) (*detailRedactor, error) {
+	r := &detailRedactor{minEntropy: cfg.MinEntropy, replacement: cfg.Replacement}
+	if cfg.BuiltinPatterns {
+		r.patterns = append(r.patterns, detailRedactionBuiltinPatterns...)
+	}
+	for _, p := range cfg.Patterns {
+		if p.Pattern == "" {
+			return nil, fmt.Errorf("规则 %s 的 pattern 不能为空", p.Name)
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("规则 %s 的正则无效: %v", p.Name, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("规则 %s 的正则不能匹配空字符串", p.Name)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	if cfg.EntropyDetection {
+		r.tokenRe = regexp.MustCompile(fmt.Sprintf(`[A-Za-z0-9_+/=-]{%d,}`, cfg.MinTokenLength))
+	}
+	return r, nil
+}
+
+// InitDetailRedactionConfig 从数据库 JSON 加载脱敏配置
+func InitDetailRedactionConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.DetailRedactionConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("detail redaction: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizeDetailRedactionConfig(cfg)
+	if err := ValidateDetailRedactionConfig(cfg); err != nil {
+		log.Warnf("detail redaction: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateDetailRedactionConfig(cfg)
+}
+
+// UpdateDetailRedactionConfig 更新脱敏配置，对之后写入的详情与详情接口立即生效（需先校验）
+func UpdateDetailRedactionConfig(cfg model.DetailRedactionConfig) {
+	cfg = NormalizeDetailRedactionConfig(cfg)
+	redactor, err := compileDetailRedactor(cfg)
+	if err != nil {
+		log.Errorf("detail redaction: 编译规则失败: %v", err)
+		return
+	}
+	detailRedactionState.mu.Lock()
+	detailRedactionState.config = cfg
+	detailRedactionState.redactor = redactor
+	detailRedactionState.mu.Unlock()
+}
+
+// GetDetailRedactionConfig 返回当前脱敏配置
+func GetDetailRedactionConfig() model.DetailRedactionConfig {
+	detailRedactionState.mu.RLock()
+	defer detailRedactionState.mu.RUnlock()
+	return detailRedactionState.config
+}
+
+// currentDetailRedactor 未启用时返回 nil
+func currentDetailRedactor() *detailRedactor {
+	detailRedactionState.mu.RLock()
+	defer detailRedactionState.mu.RUnlock()
+	if !detailRedactionState.config.Enabled {
+		return nil
+	}
+	return detailRedactionState.redactor
+}
+
+// redact 屏蔽文本中的疑似密钥，返回屏蔽后的文本与屏蔽处数
+func (r *detailRedactor) redact(s string) (string, int) {
+	count := 0
+	for _, re := range r.patterns {
+		s = re.ReplaceAllStringFunc(s, func(m string) string {
+			if m == r.replacement {
+				return m
+			}
+			count++
+			return r.replacement
+		})
+	}
+	if r.tokenRe != nil {
+		s = r.tokenRe.ReplaceAllStringFunc(s, func(m string) string {
+			if !looksLikeRandomSecret(m, r.minEntropy) {
+				return m
+			}
+			count++
+			return r.replacement
+		})
+	}
+	return s, count
+}
+
+// looksLikeRandomSecret 同时包含大小写字母与数字、且每字符熵超过阈值的串视为随机生成的密钥；
+// 单词、路径、十六进制哈希与 UUID 不满足字符类别或熵的要求
+func looksLikeRandomSecret(token string, minEntropy float64) bool {
+	if len(token) > maxRedactionTokenLength {
+		return false
+	}
+	var upper, lower, digit bool
+	for i := 0; i < len(token); i++ {
+		switch c := token[i]; {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	return shannonEntropy(token) > minEntropy
+}
+
+// shannonEntropy 每字符的香农熵（比特）
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var freq [256]int
+	for i := 0; i < len(s); i++ {
+		freq[s[i]]++
+	}
+	n := float64(len(s))
+	entropy := 0.0
+	for _, f := range freq {
+		if f == 0 {
+			continue
+		}
+		p := float64(f) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func (r *detailRedactor) redactBytes(b []byte) ([]byte, int) {
+	if len(b) == 0 {
+		return b, 0
+	}
+	redacted, count := r.redact(string(b))
+	if count == 0 {
+		return b, 0
+	}
+	return []byte(redacted), count
+}
+
+func (r *detailRedactor) redactHeaders(headers http.Header) int {
+	count := 0
+	for key, values := range headers {
+		for i, v := range values {
+			redacted, n := r.redact(v)
+			if n > 0 {
+				headers[key][i] = redacted
+				count += n
+			}
+		}
+	}
+	return count
+}
+
+// RedactRequestDetail 按当前脱敏配置就地屏蔽详情中的请求/响应头与体，屏蔽处数累加到 RedactionCount；
+// 未启用时不做处理。已屏蔽的内容不会再次计数，可对已持久化的详情重复调用
+func RedactRequestDetail(detail *RequestDetail) {
+	r := currentDetailRedactor()
+	if r == nil || detail == nil {
+		return
+	}
+	var n int
+	count := r.redactHeaders(detail.RequestHeaders) + r.redactHeaders(detail.ResponseHeaders)
+	detail.RequestBody, n = r.redactBytes(detail.RequestBody)
+	count += n
+	detail.TranslatedRequestBody, n = r.redactBytes(detail.TranslatedRequestBody)
+	count += n
+	detail.ResponseBody, n = r.redactBytes(detail.ResponseBody)
+	count += n
+	detail.TranslatedResponseBody, n = r.redactBytes(detail.TranslatedResponseBody)
+	count += n
+	detail.RedactionCount += count
+}
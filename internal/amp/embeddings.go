@@ -0,0 +1,16 @@
+package amp
+
+import (
+	"strings"
+)
+
+// embeddingsProviderInfo embeddings 请求按 OpenAI embeddings 响应结构解析用量（只有输入 token）
+var embeddingsProviderInfo = ProviderInfo{
+	Provider: ProviderOpenAIEmbeddings,
+	Endpoint: "embeddings",
+}
+
+// isEmbeddingsPath 判断是否为 OpenAI 兼容的 /v1/embeddings 请求（含 /api/provider/:provider 前缀）
+func isEmbeddingsPath(path string) bool {
+	return normalizeProviderPath(strings.TrimSuffix(path, "/")) == "/v1/embeddings"
+}
@@ -0,0 +1,66 @@
+package amp
+
+import (
+	"net/http"
+	"testing"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+)
+
+func TestIsEmbeddingsPath(t *testing.T) {
+	cases := map[string]bool{
+		"/v1/embeddings":                        true,
+		"/v1/embeddings/":                       true,
+		"/api/provider/openai/v1/embeddings":    true,
+		"/v1/chat/completions":                  false,
+		"/api/provider/openai/v1/responses":     false,
+		"/v1beta/models/text-embedding-004:foo": false,
+	}
+	for path, want := range cases {
+		if got := isEmbeddingsPath(path); got != want {
+			t.Errorf("isEmbeddingsPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if !IsModelInvocation(http.MethodPost, "/api/provider/openai/v1/embeddings") {
+		t.Error("expected embeddings POST to be a model invocation")
+	}
+}
+
+func TestRequestChannelFormat_Embeddings(t *testing.T) {
+	responses := &model.Channel{Type: model.ChannelTypeOpenAI, Endpoint: model.ChannelEndpointResponses}
+	claude := &model.Channel{Type: model.ChannelTypeClaude}
+
+	incoming := detectIncomingFormat("/v1/embeddings")
+	if incoming != translator.FormatOpenAIEmbeddings {
+		t.Fatalf("incoming format = %s, want %s", incoming, translator.FormatOpenAIEmbeddings)
+	}
+	if got := requestChannelFormat(responses, incoming); got != translator.FormatOpenAIEmbeddings {
+		t.Errorf("openai channel format = %s, want %s", got, translator.FormatOpenAIEmbeddings)
+	}
+	if got := requestChannelFormat(claude, incoming); got != translator.FormatClaude {
+		t.Errorf("claude channel format = %s, want %s", got, translator.FormatClaude)
+	}
+	if canTranslate(incoming, translator.FormatClaude, "/v1/embeddings") {
+		t.Error("embeddings must not be translated to claude")
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/api/provider/openai/v1/embeddings", nil)
+	if got := getEndpointPath(responses, req); got != "/v1/embeddings" {
+		t.Errorf("endpoint path = %q, want /v1/embeddings", got)
+	}
+}
+
+func TestExtractTokenUsage_Embeddings(t *testing.T) {
+	body := []byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"model":"text-embedding-3-small","usage":{"prompt_tokens":8,"total_tokens":8}}`)
+	usage := ExtractTokenUsage(body, embeddingsProviderInfo)
+	if usage == nil || usage.InputTokens == nil || *usage.InputTokens != 8 {
+		t.Fatalf("expected 8 input tokens, got %+v", usage)
+	}
+	if usage.OutputTokens != nil && *usage.OutputTokens != 0 {
+		t.Errorf("expected no output tokens, got %d", *usage.OutputTokens)
+	}
+	if issues := validateResponseBody(ProviderOpenAIEmbeddings, body); len(issues) > 0 {
+		t.Errorf("unexpected validation issues: %v", issues)
+	}
+}
@@ -0,0 +1,340 @@
+package amp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/secrets"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 联邦请求头：下级实例以渠道 API Key 为密钥，对签发方、时间戳、方法、路径、查询参数、请求体摘要与原始用户签名
+const (
+	FederationIssuerHeader    = "X-AMP-Federation-Issuer"
+	FederationTimestampHeader = "X-AMP-Federation-Timestamp"
+	FederationPathHeader      = "X-AMP-Federation-Path"
+	FederationUserHeader      = "X-AMP-Federation-User"
+	FederationSignatureHeader = "X-AMP-Federation-Signature"
+)
+
+var federationHeaders = []string{
+	FederationIssuerHeader,
+	FederationTimestampHeader,
+	FederationPathHeader,
+	FederationUserHeader,
+	FederationSignatureHeader,
+}
+
+const (
+	// federationMaxSkew 签名时间戳与本机时间允许的最大偏差
+	federationMaxSkew = 5 * time.Minute
+	// federationPruneInterval 清理过期重放记录的间隔
+	federationPruneInterval = time.Minute
+)
+
+var (
+	errFederationUnknownIssuer = errors.New("unknown federation issuer")
+	errFederationExpired       = errors.New("federation signature expired")
+	errFederationPath          = errors.New("federation path mismatch")
+	errFederationSignature     = errors.New("invalid federation signature")
+	errFederationReplay        = errors.New("federation signature already used")
+	errFederationBodyTooLarge  = errors.New("federation request body too large")
+)
+
+var federationState struct {
+	mu     sync.RWMutex
+	config model.FederationConfig
+}
+
+// federationSeen 已使用过的签名，在时间窗口内拒绝重放
+var federationSeen struct {
+	mu        sync.Mutex
+	items     map[string]time.Time
+	lastPrune time.Time
+}
+
+func init() {
+	federationState.config = model.FederationConfig{Peers: []model.FederationPeer{}}
+	federationSeen.items = make(map[string]time.Time)
+}
+
+// NormalizeFederationConfig 去除首尾空白并填充空列表
+func NormalizeFederationConfig(cfg model.FederationConfig) model.FederationConfig {
+	peers := make([]model.FederationPeer, 0, len(cfg.Peers))
+	for _, p := range cfg.Peers {
+		p.Issuer = strings.TrimSpace(p.Issuer)
+		p.Secret = strings.TrimSpace(p.Secret)
+		p.UserID = strings.TrimSpace(p.UserID)
+		p.SecretSet = false
+		peers = append(peers, p)
+	}
+	cfg.Peers = peers
+	return cfg
+}
+
+// ValidateFederationConfig 校验联邦配置（需先 Normalize）
+func ValidateFederationConfig(cfg model.FederationConfig) error {
+	seen := make(map[string]bool, len(cfg.Peers))
+	for i, p := range cfg.Peers {
+		if p.Issuer == "" {
+			return fmt.Errorf("peers[%d].issuer 不能为空", i)
+		}
+		if len(p.Issuer) > 64 || strings.ContainsAny(p.Issuer, "/\r\n") {
+			return fmt.Errorf("peers[%d].issuer 不能超过 64 个字符且不能包含 /", i)
+		}
+		if seen[p.Issuer] {
+			return fmt.Errorf("签发方 %s 重复", p.Issuer)
+		}
+		seen[p.Issuer] = true
+		if p.Secret == "" {
+			return fmt.Errorf("签发方 %s 未设置密钥", p.Issuer)
+		}
+		if p.UserID == "" {
+			return fmt.Errorf("签发方 %s 未设置本地账户", p.Issuer)
+		}
+	}
+	return nil
+}
+
+// MergeFederationSecrets 未填写密钥的签发方沿用当前配置中的密钥
+func MergeFederationSecrets(cfg model.FederationConfig) model.FederationConfig {
+	current := GetFederationConfig()
+	existing := make(map[string]string, len(current.Peers))
+	for _, p := range current.Peers {
+		existing[p.Issuer] = p.Secret
+	}
+	for i := range cfg.Peers {
+		if cfg.Peers[i].Secret == "" {
+			cfg.Peers[i].Secret = existing[cfg.Peers[i].Issuer]
+		}
+	}
+	return cfg
+}
+
+// InitFederationConfig 从数据库 JSON 加载联邦配置
+func InitFederationConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.FederationConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("federation: 解析配置失败，不信任任何实例: %v", err)
+		return
+	}
+	cfg = NormalizeFederationConfig(cfg)
+	if err := ValidateFederationConfig(cfg); err != nil {
+		log.Warnf("federation: 配置无效，不信任任何实例: %v", err)
+		return
+	}
+	UpdateFederationConfig(cfg)
+}
+
+// UpdateFederationConfig 更新运行时联邦配置
+func UpdateFederationConfig(cfg model.FederationConfig) {
+	federationState.mu.Lock()
+	defer federationState.mu.Unlock()
+	federationState.config = cfg
+}
+
+// GetFederationConfig 返回当前生效的联邦配置（含密钥）
+func GetFederationConfig() model.FederationConfig {
+	federationState.mu.RLock()
+	defer federationState.mu.RUnlock()
+	cfg := federationState.config
+	cfg.Peers = append([]model.FederationPeer(nil), cfg.Peers...)
+	return cfg
+}
+
+// GetFederationConfigMasked 返回用于展示的联邦配置：密钥引用原样返回，明文密钥不返回
+func GetFederationConfigMasked() model.FederationConfig {
+	cfg := GetFederationConfig()
+	for i := range cfg.Peers {
+		cfg.Peers[i].SecretSet = cfg.Peers[i].Secret != ""
+		if !secrets.IsReference(cfg.Peers[i].Secret) {
+			cfg.Peers[i].Secret = ""
+		}
+	}
+	return cfg
+}
+
+func findFederationPeer(issuer string) (model.FederationPeer, bool) {
+	federationState.mu.RLock()
+	defer federationState.mu.RUnlock()
+	for _, p := range federationState.config.Peers {
+		if p.Issuer == issuer && p.Enabled {
+			return p, true
+		}
+	}
+	return model.FederationPeer{}, false
+}
+
+// federationSignature 计算签名：HMAC-SHA256(secret, issuer \n timestamp \n method \n path \n query \n sha256(body) \n user)
+func federationSignature(secret, issuer, timestamp, method, path, query, bodyHash, user string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{issuer, timestamp, method, path, query, bodyHash, user}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func federationBodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// signFederatedRequest 对发往上级实例的请求签名，需在请求体与路径确定后调用
+func signFederatedRequest(req *http.Request, issuer, secret, user string) error {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		body = data
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	setFederationSignature(req.Header, issuer, secret, req.Method, req.URL.Path, req.URL.RawQuery, body, user)
+	return nil
+}
+
+// setFederationSignature 写入联邦请求头
+func setFederationSignature(h http.Header, issuer, secret, method, path, query string, body []byte, user string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	h.Set(FederationIssuerHeader, issuer)
+	h.Set(FederationTimestampHeader, timestamp)
+	h.Set(FederationPathHeader, path)
+	h.Set(FederationUserHeader, user)
+	h.Set(FederationSignatureHeader, federationSignature(secret, issuer, timestamp, method, path, query, federationBodyHash(body), user))
+}
+
+// signChannelRequest 联邦渠道在请求确定后签名，普通渠道不处理
+func signChannelRequest(channel *model.Channel, req *http.Request, user string) {
+	if channel.FederationIssuer == "" {
+		return
+	}
+	if err := signFederatedRequest(req, channel.FederationIssuer, channel.APIKey, user); err != nil {
+		log.Warnf("federation: failed to sign request for channel %s: %v", channel.ID, err)
+	}
+}
+
+// isFederatedRequest 请求是否携带联邦签名
+func isFederatedRequest(c *gin.Context) bool {
+	return c.GetHeader(FederationIssuerHeader) != ""
+}
+
+// verifyFederatedRequest 校验下级实例的签名，成功时返回签发方配置与原始用户。
+// 签名中的路径允许比实际路径多出前缀（上级实例前有反向代理去除路径前缀时）。
+// 签发方与时间戳校验通过后才读取请求体，读取量不超过该接口的请求体上限，超出时返回 errFederationBodyTooLarge
+func verifyFederatedRequest(c *gin.Context) (model.FederationPeer, string, error) {
+	issuer := c.GetHeader(FederationIssuerHeader)
+	peer, ok := findFederationPeer(issuer)
+	if !ok {
+		return peer, "", errFederationUnknownIssuer
+	}
+
+	timestamp := c.GetHeader(FederationTimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return peer, "", errFederationExpired
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > federationMaxSkew || skew < -federationMaxSkew {
+		return peer, "", errFederationExpired
+	}
+
+	signedPath := c.GetHeader(FederationPathHeader)
+	if signedPath == "" || !strings.HasSuffix(signedPath, c.Request.URL.Path) {
+		return peer, "", errFederationPath
+	}
+
+	secret, err := secrets.Resolve(peer.Secret)
+	if err != nil {
+		return peer, "", fmt.Errorf("resolve federation secret: %w", err)
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		limit := requestBodyLimit(c.Request.URL.Path)
+		if c.Request.ContentLength > limit {
+			return peer, "", errFederationBodyTooLarge
+		}
+		body, err = io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return peer, "", err
+		}
+		if int64(len(body)) > limit {
+			return peer, "", errFederationBodyTooLarge
+		}
+	}
+
+	user := c.GetHeader(FederationUserHeader)
+	signature := c.GetHeader(FederationSignatureHeader)
+	expected := federationSignature(secret, issuer, timestamp, c.Request.Method, signedPath, c.Request.URL.RawQuery, federationBodyHash(body), user)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return peer, "", errFederationSignature
+	}
+	if !markFederationSignatureUsed(signature) {
+		return peer, "", errFederationReplay
+	}
+	return peer, user, nil
+}
+
+// markFederationSignatureUsed 记录签名，时间窗口内已出现过时返回 false
+func markFederationSignatureUsed(signature string) bool {
+	now := time.Now()
+	federationSeen.mu.Lock()
+	defer federationSeen.mu.Unlock()
+
+	if now.Sub(federationSeen.lastPrune) > federationPruneInterval {
+		for k, seenAt := range federationSeen.items {
+			if now.Sub(seenAt) > 2*federationMaxSkew {
+				delete(federationSeen.items, k)
+			}
+		}
+		federationSeen.lastPrune = now
+	}
+	if _, ok := federationSeen.items[signature]; ok {
+		return false
+	}
+	federationSeen.items[signature] = now
+	return true
+}
+
+// stripFederationHeaders 校验通过后移除联邦请求头，避免转发给上游
+func stripFederationHeaders(h http.Header) {
+	for _, name := range federationHeaders {
+		h.Del(name)
+	}
+}
+
+// federationOnBehalfOf 转发到上级实例时附带的原始用户：本身是联邦请求时沿用完整链路，否则为本地用户名
+func federationOnBehalfOf(cfg *ProxyConfig) string {
+	if cfg == nil {
+		return ""
+	}
+	if cfg.OnBehalfOf != "" {
+		return cfg.OnBehalfOf
+	}
+	if user, err := userRepo.GetByID(cfg.UserID); err == nil && user != nil {
+		return user.Username
+	}
+	return cfg.UserID
+}
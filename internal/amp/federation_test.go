@@ -0,0 +1,202 @@
+package amp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// federatedContext 把下级实例签名后的请求转成上级实例收到的请求，查询参数沿用签名请求
+func federatedContext(t *testing.T, signed *http.Request, path string, body []byte) *gin.Context {
+	t.Helper()
+	if signed.URL.RawQuery != "" {
+		path += "?" + signed.URL.RawQuery
+	}
+	return federatedContextWithQuery(t, signed, path, body)
+}
+
+// federatedContextWithQuery 与 federatedContext 相同，但 target 中的查询参数按原样使用
+func federatedContextWithQuery(t *testing.T, signed *http.Request, target string, body []byte) *gin.Context {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(signed.Method, target, bytes.NewReader(body))
+	for k, v := range signed.Header {
+		c.Request.Header[k] = v
+	}
+	return c
+}
+
+func TestFederationSignAndVerify(t *testing.T) {
+	UpdateFederationConfig(model.FederationConfig{Peers: []model.FederationPeer{
+		{Issuer: "team-gw", Secret: "s3cret", UserID: "org-user", Enabled: true},
+	}})
+	t.Cleanup(func() { UpdateFederationConfig(model.FederationConfig{}) })
+
+	body := []byte(`{"model":"claude-sonnet-4","messages":[]}`)
+	req := httptest.NewRequest(http.MethodPost, "https://org.example.com/gw/v1/messages?beta=true", bytes.NewReader(body))
+	if err := signFederatedRequest(req, "team-gw", "s3cret", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if forwarded, _ := io.ReadAll(req.Body); !bytes.Equal(forwarded, body) {
+		t.Fatal("signing should keep the request body")
+	}
+
+	// 反向代理去掉 /gw 前缀后签名仍有效
+	c := federatedContext(t, req, "/v1/messages", body)
+	peer, user, err := verifyFederatedRequest(c)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if peer.UserID != "org-user" || user != "alice" {
+		t.Fatalf("unexpected peer %q user %q", peer.UserID, user)
+	}
+	if restored, _ := io.ReadAll(c.Request.Body); !bytes.Equal(restored, body) {
+		t.Fatal("verification should restore the request body")
+	}
+
+	if _, _, err := verifyFederatedRequest(federatedContext(t, req, "/v1/messages", body)); err != errFederationReplay {
+		t.Fatalf("replayed signature should be rejected, got %v", err)
+	}
+}
+
+func TestFederationVerifyRejectsTampering(t *testing.T) {
+	UpdateFederationConfig(model.FederationConfig{Peers: []model.FederationPeer{
+		{Issuer: "team-gw", Secret: "s3cret", UserID: "org-user", Enabled: true},
+		{Issuer: "disabled-gw", Secret: "s3cret", UserID: "org-user"},
+	}})
+	t.Cleanup(func() { UpdateFederationConfig(model.FederationConfig{}) })
+
+	body := []byte(`{"model":"gpt-4o"}`)
+	sign := func(issuer, secret, user string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+		if err := signFederatedRequest(req, issuer, secret, user); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	cases := []struct {
+		name string
+		c    *gin.Context
+		want error
+	}{
+		{"wrong secret", federatedContext(t, sign("team-gw", "other", "bob"), "/v1/chat/completions", body), errFederationSignature},
+		{"tampered body", federatedContext(t, sign("team-gw", "s3cret", "bob"), "/v1/chat/completions", []byte(`{"model":"o3"}`)), errFederationSignature},
+		{"other path", federatedContext(t, sign("team-gw", "s3cret", "bob"), "/v1/embeddings", body), errFederationPath},
+		{"unknown issuer", federatedContext(t, sign("stranger", "s3cret", "bob"), "/v1/chat/completions", body), errFederationUnknownIssuer},
+		{"disabled issuer", federatedContext(t, sign("disabled-gw", "s3cret", "bob"), "/v1/chat/completions", body), errFederationUnknownIssuer},
+	}
+	for _, tc := range cases {
+		if _, _, err := verifyFederatedRequest(tc.c); err != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	forged := sign("team-gw", "s3cret", "bob")
+	forged.Header.Set(FederationUserHeader, "admin")
+	if _, _, err := verifyFederatedRequest(federatedContext(t, forged, "/v1/chat/completions", body)); err != errFederationSignature {
+		t.Errorf("changing the attributed user should invalidate the signature, got %v", err)
+	}
+}
+
+func TestFederationVerifyRejectsQueryTampering(t *testing.T) {
+	UpdateFederationConfig(model.FederationConfig{Peers: []model.FederationPeer{
+		{Issuer: "team-gw", Secret: "s3cret", UserID: "org-user", Enabled: true},
+	}})
+	t.Cleanup(func() { UpdateFederationConfig(model.FederationConfig{}) })
+
+	sign := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse", nil)
+		if err := signFederatedRequest(req, "team-gw", "s3cret", "bob"); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	for _, target := range []string{
+		"/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=json",
+		"/v1beta/models/gemini-2.5-pro:streamGenerateContent",
+		"/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse&key=x",
+	} {
+		if _, _, err := verifyFederatedRequest(federatedContextWithQuery(t, sign(), target, nil)); err != errFederationSignature {
+			t.Errorf("%s: got %v, want %v", target, err, errFederationSignature)
+		}
+	}
+	if _, _, err := verifyFederatedRequest(federatedContextWithQuery(t, sign(), "/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse", nil)); err != nil {
+		t.Errorf("unmodified query rejected: %v", err)
+	}
+}
+
+func TestFederationVerifyRejectsOversizedBody(t *testing.T) {
+	UpdateFederationConfig(model.FederationConfig{Peers: []model.FederationPeer{
+		{Issuer: "team-gw", Secret: "s3cret", UserID: "org-user", Enabled: true},
+	}})
+	t.Cleanup(func() { UpdateFederationConfig(model.FederationConfig{}) })
+
+	signed := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	if err := signFederatedRequest(signed, "team-gw", "s3cret", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	oversized := bytes.Repeat([]byte("a"), maxRequestBodySize+1)
+
+	// 声明了 Content-Length 的请求不读取请求体
+	c := federatedContext(t, signed, "/v1/messages", oversized)
+	if _, _, err := verifyFederatedRequest(c); err != errFederationBodyTooLarge {
+		t.Fatalf("got %v, want %v", err, errFederationBodyTooLarge)
+	}
+
+	// 分块传输的请求最多读取上限加一个字节
+	c = federatedContext(t, signed, "/v1/messages", nil)
+	c.Request.Body = io.NopCloser(bytes.NewReader(oversized))
+	c.Request.ContentLength = -1
+	if _, _, err := verifyFederatedRequest(c); err != errFederationBodyTooLarge {
+		t.Fatalf("chunked: got %v, want %v", err, errFederationBodyTooLarge)
+	}
+
+	// 未知签发方在读取请求体之前拒绝
+	stranger := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	if err := signFederatedRequest(stranger, "stranger", "s3cret", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	c = federatedContext(t, stranger, "/v1/messages", nil)
+	body := &countingReader{r: bytes.NewReader(oversized)}
+	c.Request.Body = io.NopCloser(body)
+	if _, _, err := verifyFederatedRequest(c); err != errFederationUnknownIssuer || body.n != 0 {
+		t.Fatalf("unknown issuer: got %v after reading %d bytes", err, body.n)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestValidateFederationConfig(t *testing.T) {
+	valid := model.FederationConfig{Peers: []model.FederationPeer{{Issuer: "team-gw", Secret: "s", UserID: "u", Enabled: true}}}
+	if err := ValidateFederationConfig(NormalizeFederationConfig(valid)); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	invalid := []model.FederationConfig{
+		{Peers: []model.FederationPeer{{Issuer: "a/b", Secret: "s", UserID: "u"}}},
+		{Peers: []model.FederationPeer{{Issuer: "a", UserID: "u"}}},
+		{Peers: []model.FederationPeer{{Issuer: "a", Secret: "s"}}},
+		{Peers: []model.FederationPeer{{Issuer: "a", Secret: "s", UserID: "u"}, {Issuer: "a", Secret: "s", UserID: "u"}}},
+	}
+	for i, cfg := range invalid {
+		if err := ValidateFederationConfig(NormalizeFederationConfig(cfg)); err == nil {
+			t.Errorf("config %d should be rejected", i)
+		}
+	}
+}
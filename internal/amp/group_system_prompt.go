@@ -0,0 +1,92 @@
+package amp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type injectedSystemPromptKey struct{}
+
+// withInjectedSystemPrompt 记录本次请求插入的分组强制系统提示词，供请求详情审计
+func withInjectedSystemPrompt(ctx context.Context, prompt string) context.Context {
+	return context.WithValue(ctx, injectedSystemPromptKey{}, prompt)
+}
+
+// GetInjectedSystemPrompt 返回本次请求插入的分组强制系统提示词，未插入时为空
+func GetInjectedSystemPrompt(ctx context.Context) string {
+	prompt, _ := ctx.Value(injectedSystemPromptKey{}).(string)
+	return prompt
+}
+
+// joinGroupSystemPrompts 合并用户所在各分组的强制系统提示词，去除空白与重复内容
+func joinGroupSystemPrompts(prompts []string) string {
+	seen := make(map[string]struct{}, len(prompts))
+	var parts []string
+	for _, prompt := range prompts {
+		prompt = strings.TrimSpace(prompt)
+		if prompt == "" {
+			continue
+		}
+		if _, ok := seen[prompt]; ok {
+			continue
+		}
+		seen[prompt] = struct{}{}
+		parts = append(parts, prompt)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// GroupSystemPromptMiddleware 将用户所在分组的强制系统提示词插入到模型调用请求的最前面（在用户系统提示词之前），
+// 用于合规声明等必须附加的指令。与用户系统提示词不同，原生模式下同样生效；插入内容记录到请求详情
+func GroupSystemPromptMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		proxyCfg := GetProxyConfig(c.Request.Context())
+		if proxyCfg == nil || proxyCfg.GroupSystemPrompt == "" {
+			c.Next()
+			return
+		}
+		path := c.Request.URL.Path
+		isCount := isTokenCountPath(path)
+		if !isCount && !IsModelInvocation(c.Request.Method, path) {
+			c.Next()
+			return
+		}
+		format := detectIncomingFormat(path)
+		if isCount && format == translator.FormatGemini {
+			c.Next()
+			return
+		}
+
+		bodyBytes := readJSONRequestBody(c.Request, maxRequestBodySize)
+		if bodyBytes == nil {
+			c.Next()
+			return
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+			c.Next()
+			return
+		}
+		newBody, ok := injectSystemPrompt(format, payload, proxyCfg.GroupSystemPrompt)
+		if !ok {
+			log.Debugf("group system prompt: unsupported request format %s for %s, prompt not injected", format, path)
+			c.Next()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(newBody))
+		c.Request.ContentLength = int64(len(newBody))
+		if !isCount {
+			c.Request = c.Request.WithContext(withInjectedSystemPrompt(c.Request.Context(), proxyCfg.GroupSystemPrompt))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package amp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestJoinGroupSystemPrompts(t *testing.T) {
+	got := joinGroupSystemPrompts([]string{" disclaimer ", "", "policy", "disclaimer"})
+	if got != "disclaimer\n\npolicy" {
+		t.Fatalf("joinGroupSystemPrompts = %q", got)
+	}
+	if got := joinGroupSystemPrompts(nil); got != "" {
+		t.Fatalf("joinGroupSystemPrompts(nil) = %q", got)
+	}
+}
+
+func TestGroupSystemPromptMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &ProxyConfig{UserID: "u1", SystemPrompt: "be brief", GroupSystemPrompt: "compliance notice"}
+
+	var gotBody, gotInjected string
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithProxyConfig(c.Request.Context(), cfg))
+		c.Next()
+	})
+	engine.Use(SystemPromptMiddleware())
+	engine.Use(GroupSystemPromptMiddleware())
+	engine.POST("/*path", func(c *gin.Context) {
+		data, _ := io.ReadAll(c.Request.Body)
+		gotBody = string(data)
+		gotInjected = GetInjectedSystemPrompt(c.Request.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"system":"existing","messages":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(gotBody, `"system":"compliance notice\n\nbe brief\n\nexisting"`) {
+		t.Fatalf("body = %s", gotBody)
+	}
+	if gotInjected != "compliance notice" {
+		t.Fatalf("injected = %q", gotInjected)
+	}
+
+	// token 计数同样插入，但不记录审计
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(`{"messages":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(gotBody, "compliance notice") || gotInjected != "" {
+		t.Fatalf("count body = %s, injected = %q", gotBody, gotInjected)
+	}
+}
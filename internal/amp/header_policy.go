@@ -0,0 +1,78 @@
+package amp
+
+import (
+	"net/http"
+	"strings"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// clientIdentifyingHeaders 开启 StripClientHeaders 时移除的客户端标识类请求头，支持 * 前缀匹配
+var clientIdentifyingHeaders = []string{
+	"User-Agent",
+	"X-Stainless-*",
+	"X-App",
+	"X-Client-*",
+	"X-Amp-*",
+	"Anthropic-Dangerous-Direct-Browser-Access",
+	"Originator",
+	"Session_id",
+	"X-Forwarded-*",
+	"Forwarded",
+	"X-Real-Ip",
+	"Via",
+	"Referer",
+	"Origin",
+	"Cookie",
+	"Sec-*",
+}
+
+// stripClientHeadersByPolicy 按渠道请求头策略移除客户端请求头，需在注入渠道自身请求头之前调用
+func stripClientHeadersByPolicy(req *http.Request, channel *model.Channel, policy model.ChannelHeaderPolicy) {
+	shouldRemove := func(canonical string) bool {
+		if matchHeaderName(canonical, policy.Remove) {
+			return true
+		}
+		return policy.StripClientHeaders &&
+			matchHeaderName(canonical, clientIdentifyingHeaders) &&
+			!matchHeaderName(canonical, policy.Passthrough)
+	}
+
+	var removed []string
+	for name := range req.Header {
+		canonical := http.CanonicalHeaderKey(name)
+		if shouldRemove(canonical) {
+			req.Header.Del(name)
+			removed = append(removed, canonical)
+		}
+	}
+	// ReverseProxy 会在 Director 之后追加客户端 IP，值为 nil 时不再追加
+	if shouldRemove("X-Forwarded-For") {
+		req.Header["X-Forwarded-For"] = nil
+	}
+	if len(removed) > 0 {
+		log.Debugf("channel proxy: 渠道 %s 按请求头策略移除: %s", channel.Name, strings.Join(removed, ","))
+	}
+}
+
+// applyForcedUserAgent 按渠道请求头策略强制 User-Agent，需在内置客户端模拟之后、自定义请求头之前调用
+func applyForcedUserAgent(req *http.Request, policy model.ChannelHeaderPolicy) {
+	if policy.UserAgent != "" {
+		req.Header.Set("User-Agent", policy.UserAgent)
+	}
+}
+
+func matchHeaderName(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(name, p) {
+			return true
+		}
+	}
+	return false
+}
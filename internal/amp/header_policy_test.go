@@ -0,0 +1,53 @@
+package amp
+
+import (
+	"net/http"
+	"testing"
+
+	"ampmanager/internal/model"
+)
+
+func TestStripClientHeadersByPolicy(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/v1/messages", nil)
+	req.Header.Set("User-Agent", "amp/1.0")
+	req.Header.Set("X-Stainless-Os", "MacOS")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.Header.Set("X-Amp-Thread-Id", "T-1")
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("Content-Type", "application/json")
+
+	policy := model.ChannelHeaderPolicy{
+		StripClientHeaders: true,
+		Passthrough:        []string{"x-amp-*"},
+		Remove:             []string{"X-Debug"},
+	}
+	stripClientHeadersByPolicy(req, &model.Channel{Name: "c"}, policy)
+
+	for _, name := range []string{"User-Agent", "X-Stainless-Os", "X-Forwarded-For", "X-Debug"} {
+		if v := req.Header.Get(name); v != "" {
+			t.Errorf("expected %s to be removed, got %q", name, v)
+		}
+	}
+	for _, name := range []string{"X-Amp-Thread-Id", "Content-Type"} {
+		if req.Header.Get(name) == "" {
+			t.Errorf("expected %s to be kept", name)
+		}
+	}
+}
+
+func TestStripClientHeadersByPolicy_EmptyPolicyKeepsHeaders(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/v1/messages", nil)
+	req.Header.Set("User-Agent", "amp/1.0")
+
+	stripClientHeadersByPolicy(req, &model.Channel{Name: "c"}, model.ChannelHeaderPolicy{})
+	applyForcedUserAgent(req, model.ChannelHeaderPolicy{})
+
+	if got := req.Header.Get("User-Agent"); got != "amp/1.0" {
+		t.Fatalf("unexpected User-Agent %q", got)
+	}
+
+	applyForcedUserAgent(req, model.ChannelHeaderPolicy{UserAgent: "custom/2.0"})
+	if got := req.Header.Get("User-Agent"); got != "custom/2.0" {
+		t.Fatalf("unexpected User-Agent %q", got)
+	}
+}
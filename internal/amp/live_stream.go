@@ -0,0 +1,136 @@
+package amp
+
+import (
+	"sync"
+)
+
+const (
+	// liveStreamBacklogSize 新订阅者可补看的已输出内容上限
+	liveStreamBacklogSize = CaptureMaxBodySize
+	// liveStreamSubscriberBuffer 单个订阅者的待发送分片数，写满视为跟不上
+	liveStreamSubscriberBuffer = 256
+)
+
+// LiveStreamEvent 实时观看推送的事件
+type LiveStreamEvent struct {
+	Type   string `json:"type"` // chunk / end
+	Data   string `json:"data,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// liveStream 单个进行中请求的响应流
+type liveStream struct {
+	backlog     []byte
+	subscribers map[chan LiveStreamEvent]struct{}
+}
+
+// LiveStreamRegistry 按请求 ID 广播进行中的响应流，供管理端只读实时观看
+type LiveStreamRegistry struct {
+	mu      sync.Mutex
+	streams map[string]*liveStream
+}
+
+var liveStreams = NewLiveStreamRegistry()
+
+// NewLiveStreamRegistry 创建实时响应流注册表
+func NewLiveStreamRegistry() *LiveStreamRegistry {
+	return &LiveStreamRegistry{streams: make(map[string]*liveStream)}
+}
+
+// GetLiveStreamRegistry 返回全局实时响应流注册表
+func GetLiveStreamRegistry() *LiveStreamRegistry {
+	return liveStreams
+}
+
+// Begin 登记一个进行中的请求，重复登记保持原状
+func (r *LiveStreamRegistry) Begin(requestID string) {
+	if requestID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.streams[requestID]; !ok {
+		r.streams[requestID] = &liveStream{subscribers: make(map[chan LiveStreamEvent]struct{})}
+	}
+}
+
+// Publish 追加响应分片并推送给订阅者；跟不上的订阅者会被断开
+func (r *LiveStreamRegistry) Publish(requestID string, chunk []byte) {
+	if requestID == "" || len(chunk) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stream, ok := r.streams[requestID]
+	if !ok {
+		return
+	}
+	if remaining := liveStreamBacklogSize - len(stream.backlog); remaining > 0 {
+		if len(chunk) <= remaining {
+			stream.backlog = append(stream.backlog, chunk...)
+		} else {
+			stream.backlog = append(stream.backlog, chunk[:remaining]...)
+		}
+	}
+	if len(stream.subscribers) == 0 {
+		return
+	}
+	event := LiveStreamEvent{Type: "chunk", Data: string(chunk)}
+	for ch := range stream.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(stream.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// End 结束请求的实时流，通知订阅者后移除
+func (r *LiveStreamRegistry) End(requestID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stream, ok := r.streams[requestID]
+	if !ok {
+		return
+	}
+	delete(r.streams, requestID)
+	for ch := range stream.subscribers {
+		select {
+		case ch <- LiveStreamEvent{Type: "end", Reason: "completed"}:
+		default:
+		}
+		delete(stream.subscribers, ch)
+		close(ch)
+	}
+}
+
+// IsLive 判断请求是否仍在输出中
+func (r *LiveStreamRegistry) IsLive(requestID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.streams[requestID]
+	return ok
+}
+
+// Subscribe 订阅进行中的请求，返回已输出内容与后续事件通道；
+// 通道关闭表示流结束或订阅者被断开，请求不在进行中时 ok 为 false
+func (r *LiveStreamRegistry) Subscribe(requestID string) (backlog []byte, events <-chan LiveStreamEvent, cancel func(), ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stream, exists := r.streams[requestID]
+	if !exists {
+		return nil, nil, func() {}, false
+	}
+	ch := make(chan LiveStreamEvent, liveStreamSubscriberBuffer)
+	stream.subscribers[ch] = struct{}{}
+	cancel = func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, still := stream.subscribers[ch]; still {
+			delete(stream.subscribers, ch)
+			close(ch)
+		}
+	}
+	return append([]byte(nil), stream.backlog...), ch, cancel, true
+}
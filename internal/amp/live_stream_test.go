@@ -0,0 +1,55 @@
+package amp
+
+import (
+	"testing"
+)
+
+func TestLiveStreamRegistry_SubscribeReplaysBacklog(t *testing.T) {
+	r := NewLiveStreamRegistry()
+	if _, _, _, ok := r.Subscribe("req-1"); ok {
+		t.Fatalf("expected subscribe to fail for unknown request")
+	}
+
+	r.Begin("req-1")
+	r.Publish("req-1", []byte("data: a\n\n"))
+
+	backlog, events, cancel, ok := r.Subscribe("req-1")
+	defer cancel()
+	if !ok || string(backlog) != "data: a\n\n" {
+		t.Fatalf("unexpected backlog %q (ok=%v)", backlog, ok)
+	}
+
+	r.Publish("req-1", []byte("data: b\n\n"))
+	if ev := <-events; ev.Type != "chunk" || ev.Data != "data: b\n\n" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	r.End("req-1")
+	if ev := <-events; ev.Type != "end" {
+		t.Fatalf("expected end event, got %+v", ev)
+	}
+	if _, open := <-events; open {
+		t.Fatalf("expected events channel closed after end")
+	}
+	if r.IsLive("req-1") {
+		t.Fatalf("expected request no longer live")
+	}
+}
+
+func TestLiveStreamRegistry_DropsLaggingSubscriber(t *testing.T) {
+	r := NewLiveStreamRegistry()
+	r.Begin("req-2")
+	_, events, cancel, _ := r.Subscribe("req-2")
+	defer cancel()
+
+	for i := 0; i <= liveStreamSubscriberBuffer; i++ {
+		r.Publish("req-2", []byte("x"))
+	}
+	received := 0
+	for range events {
+		received++
+	}
+	if received != liveStreamSubscriberBuffer {
+		t.Fatalf("expected %d buffered events before drop, got %d", liveStreamSubscriberBuffer, received)
+	}
+}
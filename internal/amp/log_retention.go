@@ -0,0 +1,329 @@
+package amp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MinLogRetentionDays 请求日志的最短保留天数，保证最近 30 天的仪表盘与额度窗口始终基于原始日志
+	MinLogRetentionDays = 31
+
+	// logRetentionInterval 自动清理的执行间隔
+	logRetentionInterval = time.Hour
+	// logRetentionBatchSize 每批删除的行数，避免长时间占用 SQLite 写锁
+	logRetentionBatchSize = 1000
+	// logRetentionRollupMargin 只删除已汇总到 usage_rollups 的日志，汇总水位线前再留出的余量
+	logRetentionRollupMargin = 24 * time.Hour
+)
+
+var (
+	// ErrLogRetentionRunning 已有清理任务在执行
+	ErrLogRetentionRunning = errors.New("日志清理正在执行中")
+	// errLogRetentionStopped 清理器停止，未完成的清理留到下次
+	errLogRetentionStopped = errors.New("清理器已停止")
+)
+
+// LogRetentionConfig 请求日志保留策略，天数为 0 表示永久保留
+type LogRetentionConfig struct {
+	Enabled  bool
+	LogDays  int
+	BodyDays int
+}
+
+// DefaultLogRetentionConfig 默认不自动清理
+func DefaultLogRetentionConfig() *LogRetentionConfig {
+	return &LogRetentionConfig{
+		Enabled:  false,
+		LogDays:  0,
+		BodyDays: 0,
+	}
+}
+
+var (
+	logRetentionConfig   = DefaultLogRetentionConfig()
+	logRetentionConfigMu sync.RWMutex
+)
+
+// GetLogRetentionConfig 获取当前日志保留策略
+func GetLogRetentionConfig() *LogRetentionConfig {
+	logRetentionConfigMu.RLock()
+	defer logRetentionConfigMu.RUnlock()
+	cfg := *logRetentionConfig
+	return &cfg
+}
+
+// UpdateLogRetentionConfig 动态更新日志保留策略，下一次清理时生效
+func UpdateLogRetentionConfig(cfg *LogRetentionConfig) {
+	if cfg == nil {
+		return
+	}
+	logRetentionConfigMu.Lock()
+	copied := *cfg
+	logRetentionConfig = &copied
+	logRetentionConfigMu.Unlock()
+
+	log.Infof("log retention: config updated (enabled=%v, logDays=%d, bodyDays=%d)",
+		cfg.Enabled, cfg.LogDays, cfg.BodyDays)
+}
+
+// InitLogRetentionConfig 从数据库 JSON 加载日志保留策略
+func InitLogRetentionConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+
+	var cfg model.LogRetentionConfigResponse
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("log retention: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+
+	UpdateLogRetentionConfig(&LogRetentionConfig{
+		Enabled:  cfg.Enabled,
+		LogDays:  cfg.LogDays,
+		BodyDays: cfg.BodyDays,
+	})
+}
+
+// LogRetentionPruner 按保留策略定期删除过期的请求日志与请求/响应内容
+type LogRetentionPruner struct {
+	db       *sql.DB
+	runMu    sync.Mutex
+	lastMu   sync.RWMutex
+	lastRun  *model.LogRetentionRunResult
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewLogRetentionPruner 创建日志清理器
+func NewLogRetentionPruner(db *sql.DB) *LogRetentionPruner {
+	return &LogRetentionPruner{
+		db:       db,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动后台清理 goroutine
+func (p *LogRetentionPruner) Start() {
+	p.wg.Add(1)
+	go p.run()
+}
+
+// Stop 优雅停止清理器，进行中的清理在当前批次结束后退出
+func (p *LogRetentionPruner) Stop() {
+	p.stopOnce.Do(func() { close(p.stopChan) })
+	p.wg.Wait()
+}
+
+func (p *LogRetentionPruner) run() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(logRetentionInterval)
+	defer ticker.Stop()
+
+	p.scheduledRun()
+	for {
+		select {
+		case <-ticker.C:
+			p.scheduledRun()
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+func (p *LogRetentionPruner) scheduledRun() {
+	if !GetLogRetentionConfig().Enabled {
+		return
+	}
+	if _, err := p.RunOnce(time.Now()); err != nil && !errors.Is(err, ErrLogRetentionRunning) && !errors.Is(err, errLogRetentionStopped) {
+		log.Errorf("log retention: %v", err)
+	}
+}
+
+// LastRun 返回最近一次清理结果，尚未执行过时返回 nil
+func (p *LogRetentionPruner) LastRun() *model.LogRetentionRunResult {
+	p.lastMu.RLock()
+	defer p.lastMu.RUnlock()
+	return p.lastRun
+}
+
+// RunOnce 按当前保留策略执行一次清理（不检查 Enabled）：
+//   - 删除早于 LogDays 的请求日志及其详情，截止时间对齐到 UTC 零点，且不晚于用量汇总水位线，
+//     保证被删除的日志已计入 usage_rollups
+//   - 删除早于 BodyDays 的请求详情（含归档）并清空请求日志的响应文本
+func (p *LogRetentionPruner) RunOnce(now time.Time) (*model.LogRetentionRunResult, error) {
+	if !p.runMu.TryLock() {
+		return nil, ErrLogRetentionRunning
+	}
+	defer p.runMu.Unlock()
+
+	cfg := GetLogRetentionConfig()
+	result := &model.LogRetentionRunResult{StartedAt: now.UTC()}
+	err := p.prune(cfg, now.UTC(), result)
+	result.FinishedAt = time.Now().UTC()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	p.lastMu.Lock()
+	p.lastRun = result
+	p.lastMu.Unlock()
+
+	if result.DeletedLogs > 0 || result.DeletedDetails > 0 || result.ClearedResponseTexts > 0 {
+		log.Infof("log retention: deleted %d logs, %d details, cleared %d response texts",
+			result.DeletedLogs, result.DeletedDetails, result.ClearedResponseTexts)
+	}
+	return result, err
+}
+
+func (p *LogRetentionPruner) prune(cfg *LogRetentionConfig, now time.Time, result *model.LogRetentionRunResult) error {
+	if cfg.LogDays <= 0 && cfg.BodyDays <= 0 {
+		result.Note = "未配置保留天数，不清理"
+		return nil
+	}
+
+	var logCutoff time.Time
+	if cfg.LogDays > 0 {
+		days := cfg.LogDays
+		if days < MinLogRetentionDays {
+			days = MinLogRetentionDays
+		}
+		logCutoff = utcDayStart(now.AddDate(0, 0, -days))
+
+		watermark, err := service.NewUsageRollupService().Watermark()
+		if err != nil {
+			return fmt.Errorf("load usage rollup watermark: %w", err)
+		}
+		if watermark == nil {
+			result.Note = "用量汇总尚未完成，暂不删除请求日志"
+			logCutoff = time.Time{}
+		} else if limit := utcDayStart(watermark.Add(-logRetentionRollupMargin)); limit.Before(logCutoff) {
+			logCutoff = limit
+		}
+	}
+
+	if !logCutoff.IsZero() {
+		result.LogCutoff = &logCutoff
+		deleted, err := execBatches(p.db, `DELETE FROM request_logs WHERE id IN (
+			SELECT id FROM request_logs WHERE created_at < ? AND status <> 'pending' LIMIT ?)`, logCutoff, p.stopChan)
+		result.DeletedLogs = deleted
+		if err != nil {
+			return fmt.Errorf("delete request logs: %w", err)
+		}
+		if err := service.MarkRequestLogsPrunedBefore(logCutoff); err != nil {
+			return fmt.Errorf("save pruned marker: %w", err)
+		}
+	}
+
+	var bodyCutoff time.Time
+	if cfg.BodyDays > 0 {
+		bodyCutoff = now.AddDate(0, 0, -cfg.BodyDays)
+	}
+	if logCutoff.After(bodyCutoff) {
+		bodyCutoff = logCutoff
+	}
+	if bodyCutoff.IsZero() {
+		return nil
+	}
+	result.BodyCutoff = &bodyCutoff
+
+	cleared, err := execBatches(p.db, `UPDATE request_logs SET response_text = NULL WHERE id IN (
+		SELECT id FROM request_logs WHERE created_at < ? AND response_text IS NOT NULL LIMIT ?)`, bodyCutoff, p.stopChan)
+	result.ClearedResponseTexts = cleared
+	if err != nil {
+		return fmt.Errorf("clear response texts: %w", err)
+	}
+
+	if store := GetRequestDetailStore(); store != nil {
+		deleted, err := store.deleteDetailsBefore(bodyCutoff, p.stopChan)
+		result.DeletedDetails = deleted
+		if err != nil {
+			return fmt.Errorf("delete request details: %w", err)
+		}
+	}
+	return nil
+}
+
+// execBatches 分批执行 query（参数为 cutoff 与批大小）直到影响行数不足一批，
+// stop 关闭时在批次之间返回 errLogRetentionStopped
+func execBatches(db *sql.DB, query string, cutoff time.Time, stop <-chan struct{}) (int64, error) {
+	var total int64
+	for {
+		res, err := db.Exec(query, cutoff.UTC(), logRetentionBatchSize)
+		if err != nil {
+			return total, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += affected
+		if affected < logRetentionBatchSize {
+			return total, nil
+		}
+		select {
+		case <-stop:
+			return total, errLogRetentionStopped
+		default:
+		}
+	}
+}
+
+func utcDayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+var (
+	globalLogRetentionPruner *LogRetentionPruner
+	logRetentionPrunerMu     sync.Mutex
+)
+
+// InitLogRetentionPruner 初始化并启动全局日志清理器
+func InitLogRetentionPruner(db *sql.DB) {
+	logRetentionPrunerMu.Lock()
+	defer logRetentionPrunerMu.Unlock()
+	globalLogRetentionPruner = NewLogRetentionPruner(db)
+	globalLogRetentionPruner.Start()
+	log.Info("log retention: started")
+}
+
+// ReinitLogRetentionPruner 重新初始化全局日志清理器（数据库替换后调用）
+func ReinitLogRetentionPruner(db *sql.DB) {
+	logRetentionPrunerMu.Lock()
+	defer logRetentionPrunerMu.Unlock()
+	if globalLogRetentionPruner != nil {
+		globalLogRetentionPruner.Stop()
+	}
+	globalLogRetentionPruner = NewLogRetentionPruner(db)
+	globalLogRetentionPruner.Start()
+	log.Info("log retention: reinitialized")
+}
+
+// GetLogRetentionPruner 返回全局日志清理器，未初始化时返回 nil
+func GetLogRetentionPruner() *LogRetentionPruner {
+	logRetentionPrunerMu.Lock()
+	defer logRetentionPrunerMu.Unlock()
+	return globalLogRetentionPruner
+}
+
+// StopLogRetentionPruner 停止全局日志清理器
+func StopLogRetentionPruner() {
+	logRetentionPrunerMu.Lock()
+	defer logRetentionPrunerMu.Unlock()
+	if globalLogRetentionPruner != nil {
+		globalLogRetentionPruner.Stop()
+		log.Info("log retention: stopped")
+	}
+}
@@ -0,0 +1,111 @@
+package amp
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/repository"
+	"ampmanager/internal/service"
+)
+
+func withLogRetentionConfig(t *testing.T, cfg LogRetentionConfig) {
+	t.Helper()
+	prev := GetLogRetentionConfig()
+	UpdateLogRetentionConfig(&cfg)
+	t.Cleanup(func() { UpdateLogRetentionConfig(prev) })
+}
+
+func insertRetentionLog(t *testing.T, id, status string, createdAt time.Time) {
+	t.Helper()
+	_, err := database.GetDB().Exec(`
+		INSERT INTO request_logs (id, created_at, user_id, api_key_id, method, path, status_code, latency_ms, status)
+		VALUES (?, ?, 'u1', 'key-1', 'POST', '/v1/messages', 200, 10, ?)`, id, createdAt, status)
+	if err != nil {
+		t.Fatalf("insert request log %s: %v", id, err)
+	}
+}
+
+func remainingLogs(t *testing.T) map[string]bool {
+	t.Helper()
+	rows, err := database.GetDB().Query(`SELECT id FROM request_logs`)
+	if err != nil {
+		t.Fatalf("query request logs: %v", err)
+	}
+	defer rows.Close()
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		ids[id] = true
+	}
+	return ids
+}
+
+// 截止时间对齐到 UTC 零点、不短于最短保留天数，且不晚于用量汇总水位线前一天
+func TestLogRetentionCutoff(t *testing.T) {
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	withLogRetentionConfig(t, LogRetentionConfig{Enabled: true, LogDays: 7})
+
+	now := time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC)
+	cutoff := time.Date(2026, 9, 15, 0, 0, 0, 0, time.UTC)
+	insertRetentionLog(t, "lagging", "success", time.Date(2026, 8, 30, 23, 0, 0, 0, time.UTC))
+	insertRetentionLog(t, "before-cutoff", "success", cutoff.Add(-time.Hour))
+	insertRetentionLog(t, "pending", "pending", cutoff.Add(-time.Hour))
+	insertRetentionLog(t, "after-cutoff", "success", cutoff.Add(time.Hour))
+	pruner := NewLogRetentionPruner(database.GetDB())
+
+	// 尚未汇总过时不删除任何日志
+	result, err := pruner.RunOnce(now)
+	if err != nil {
+		t.Fatalf("run without watermark: %v", err)
+	}
+	if result.LogCutoff != nil || result.DeletedLogs != 0 || result.Note == "" {
+		t.Errorf("without watermark = %+v", result)
+	}
+	if marker := service.RequestLogsPrunedBefore(); marker != nil {
+		t.Errorf("pruned marker = %v", marker)
+	}
+
+	// 汇总水位线落后时截止到水位线前一天的 UTC 零点
+	if err := repository.NewSystemConfigRepository().Set("usage_rollup_watermark", "2026-09-01T12:00:00Z"); err != nil {
+		t.Fatalf("set watermark: %v", err)
+	}
+	lagCutoff := time.Date(2026, 8, 31, 0, 0, 0, 0, time.UTC)
+	result, err = pruner.RunOnce(now)
+	if err != nil {
+		t.Fatalf("run with lagging watermark: %v", err)
+	}
+	if result.LogCutoff == nil || !result.LogCutoff.Equal(lagCutoff) || result.DeletedLogs != 1 {
+		t.Errorf("lagging watermark = %+v", result)
+	}
+	if marker := service.RequestLogsPrunedBefore(); marker == nil || !marker.Equal(lagCutoff) {
+		t.Errorf("pruned marker = %v, want %v", marker, lagCutoff)
+	}
+
+	// 保留天数低于下限时按 MinLogRetentionDays 计算；pending 请求不删除
+	if err := service.NewUsageRollupService().RunOnce(now, nil); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	result, err = pruner.RunOnce(now)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if result.LogCutoff == nil || !result.LogCutoff.Equal(cutoff) || result.DeletedLogs != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if marker := service.RequestLogsPrunedBefore(); marker == nil || !marker.Equal(cutoff) {
+		t.Errorf("pruned marker = %v, want %v", marker, cutoff)
+	}
+	want := map[string]bool{"pending": true, "after-cutoff": true}
+	if got := remainingLogs(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("remaining logs = %v, want %v", got, want)
+	}
+}
@@ -3,14 +3,17 @@ package amp
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
 	"sync"
 	"time"
 
 	"ampmanager/internal/billing"
+	"ampmanager/internal/model"
 	"ampmanager/internal/realtime"
 	"ampmanager/internal/service"
+	"ampmanager/internal/tracing"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -131,8 +134,8 @@ func (w *LogWriter) WritePendingFromTrace(trace *RequestTrace) bool {
 	_, err := w.db.Exec(`
 		INSERT INTO request_logs (
 			id, created_at, status, user_id, api_key_id, original_model, mapped_model,
-			provider, channel_id, endpoint, method, path, status_code, latency_ms, is_streaming
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			provider, channel_id, endpoint, method, path, status_code, latency_ms, is_streaming, on_behalf_of, trace_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		snapshot.RequestID, // 使用 RequestID 作为数据库 ID
 		snapshot.StartTime.UTC(),
@@ -149,12 +152,15 @@ func (w *LogWriter) WritePendingFromTrace(trace *RequestTrace) bool {
 		0, // pending 时 status_code 为 0
 		0, // pending 时 latency_ms 为 0
 		0, // pending 时 is_streaming 为 0
+		onBehalfOf(snapshot.OnBehalfOf),
+		stringPtrIfNonEmpty(snapshot.TraceID),
 	)
 
 	if err != nil {
 		log.Errorf("log writer: failed to insert pending entry: %v", err)
 		return false
 	}
+	registerInflightTrace(trace)
 
 	log.Debugf("log writer: inserted pending request %s", snapshot.RequestID)
 	realtime.NotifyLogCompleted(snapshot.RequestID)
@@ -166,6 +172,12 @@ func (w *LogWriter) UpdateFromTrace(trace *RequestTrace) bool {
 	if trace == nil || trace.RequestID == "" {
 		return false
 	}
+	unregisterInflightTrace(trace.RequestID)
+	// 已被强制结束的记录不再覆盖
+	if trace.IsFinalized() {
+		log.Debugf("log writer: request %s already finalized, skipping update", trace.RequestID)
+		return false
+	}
 
 	snapshot := trace.Clone()
 
@@ -180,6 +192,10 @@ func (w *LogWriter) UpdateFromTrace(trace *RequestTrace) bool {
 	if snapshot.IsStreaming {
 		isStreaming = 1
 	}
+	usageEstimated := 0
+	if snapshot.UsageEstimated {
+		usageEstimated = 1
+	}
 
 	// 构建可选字段
 	var originalModel, mappedModel, provider, channelID, endpoint, errorType, pricingModel, costUsd *string
@@ -236,13 +252,15 @@ func (w *LogWriter) UpdateFromTrace(trace *RequestTrace) bool {
 			output_tokens = ?,
 			cache_read_input_tokens = ?,
 			cache_creation_input_tokens = ?,
+			usage_estimated = ?,
 			error_type = ?,
 			cost_micros = ?,
 			cost_usd = ?,
 			pricing_model = ?,
 			thinking_level = COALESCE(?, thinking_level),
 			rate_multiplier = COALESCE(?, rate_multiplier),
-			response_text = COALESCE(?, response_text)
+			response_text = COALESCE(?, response_text),
+			attempts_json = COALESCE(?, attempts_json)
 		WHERE id = ?
 	`,
 		now,
@@ -259,6 +277,7 @@ func (w *LogWriter) UpdateFromTrace(trace *RequestTrace) bool {
 		snapshot.OutputTokens,
 		snapshot.CacheReadInputTokens,
 		snapshot.CacheCreationInputTokens,
+		usageEstimated,
 		errorType,
 		snapshot.CostMicros,
 		costUsd,
@@ -266,6 +285,7 @@ func (w *LogWriter) UpdateFromTrace(trace *RequestTrace) bool {
 		thinkingLevel,
 		rateMultiplier,
 		stringPtrIfNonEmpty(snapshot.ResponseText),
+		attemptsJSON(snapshot.Attempts),
 		snapshot.RequestID,
 	)
 
@@ -300,6 +320,10 @@ func (w *LogWriter) insertComplete(trace *RequestTrace) bool {
 	if snapshot.IsStreaming {
 		isStreaming = 1
 	}
+	usageEstimated := 0
+	if snapshot.UsageEstimated {
+		usageEstimated = 1
+	}
 
 	var originalModel, mappedModel, provider, channelID, endpoint, errorType, pricingModel, costUsd *string
 	if snapshot.OriginalModel != "" {
@@ -341,8 +365,9 @@ func (w *LogWriter) insertComplete(trace *RequestTrace) bool {
 			id, created_at, updated_at, status, user_id, api_key_id, original_model, mapped_model,
 			provider, channel_id, endpoint, method, path, status_code, latency_ms,
 			is_streaming, input_tokens, output_tokens, cache_read_input_tokens,
-			cache_creation_input_tokens, error_type, cost_micros, cost_usd, pricing_model, thinking_level, rate_multiplier
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			cache_creation_input_tokens, error_type, cost_micros, cost_usd, pricing_model, thinking_level, rate_multiplier,
+			attempts_json, on_behalf_of, trace_id, usage_estimated
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		snapshot.RequestID,
 		snapshot.StartTime.UTC(),
@@ -370,6 +395,10 @@ func (w *LogWriter) insertComplete(trace *RequestTrace) bool {
 		pricingModel,
 		thinkingLevel,
 		rateMultiplier,
+		attemptsJSON(snapshot.Attempts),
+		onBehalfOf(snapshot.OnBehalfOf),
+		stringPtrIfNonEmpty(snapshot.TraceID),
+		usageEstimated,
 	)
 
 	if err != nil {
@@ -548,56 +577,27 @@ func NewLoggingBodyWrapper(body io.ReadCloser, trace *RequestTrace, statusCode i
 	}
 }
 
-// Close 关闭并更新日志记录
+// Close 关闭并更新日志记录。流式响应在结束事件之前中断时按已收到的部分用量（或估算值）结算，
+// 并记录为 client_aborted（客户端已断开）或 stream_incomplete（上游提前关闭）
 func (w *LoggingBodyWrapper) Close() error {
 	err := w.ReadCloser.Close()
 	w.once.Do(func() {
 		if w.trace != nil {
 			w.trace.SetResponse(w.statusCode)
+			if w.trace.StreamIncomplete() {
+				if w.ctx != nil && w.ctx.Err() != nil {
+					w.trace.setErrorIfEmpty(StreamErrorClientAborted)
+				} else {
+					w.trace.setErrorIfEmpty(StreamErrorIncomplete)
+				}
+			}
 
 			// 计算成本（在设置 usage 之后）
-			if calc := billing.GetCostCalculator(); calc != nil {
-				// 使用 MappedModel 作为计价模型（如果没有则使用 OriginalModel）
-				pricingModel := w.trace.MappedModel
-				if pricingModel == "" {
-					pricingModel = w.trace.OriginalModel
-				}
-				if pricingModel != "" {
-					costResult := calc.CalculateFromPointers(
-						pricingModel,
-						w.trace.InputTokens,
-						w.trace.OutputTokens,
-						w.trace.CacheReadInputTokens,
-						w.trace.CacheCreationInputTokens,
-					)
-					if costResult.PriceFound {
-						multiplier := 1.0
-						var proxyCfg *ProxyConfig
-						if w.ctx != nil {
-							proxyCfg = GetProxyConfig(w.ctx)
-						}
-						if proxyCfg != nil {
-							multiplier = proxyCfg.RateMultiplier
-							w.trace.RateMultiplier = multiplier
-						}
-
-						if multiplier == 0 {
-							w.trace.SetCost(costResult.CostMicros, costResult.CostUsd, costResult.PricingModel)
-						} else {
-							adjustedCostMicros := int64(float64(costResult.CostMicros) * multiplier)
-							adjustedCostUsd := fmt.Sprintf("%.6f", float64(adjustedCostMicros)/1e6)
-							w.trace.SetCost(adjustedCostMicros, adjustedCostUsd, costResult.PricingModel)
-
-							if proxyCfg != nil && adjustedCostMicros > 0 {
-								billingSvc := service.NewBillingService()
-								if err := billingSvc.SettleRequestCost(w.trace.RequestID, proxyCfg.UserID, adjustedCostMicros); err != nil {
-									log.Warnf("log writer: failed to settle cost for user %s: %v", proxyCfg.UserID, err)
-								}
-							}
-						}
-					}
-				}
+			var proxyCfg *ProxyConfig
+			if w.ctx != nil {
+				proxyCfg = GetProxyConfig(w.ctx)
 			}
+			settleTraceCost(w.trace, proxyCfg)
 
 			if writer := GetLogWriter(); writer != nil {
 				writer.UpdateFromTrace(w.trace)
@@ -607,9 +607,89 @@ func (w *LoggingBodyWrapper) Close() error {
 	return err
 }
 
+// settleTraceCost 按 trace 的用量计算成本并记录到 trace，乘以分组倍率后从用户额度中扣除。
+// 上游没有返回用量时先以估算值补齐；计价模型优先使用 MappedModel；proxyCfg 为 nil 时按原价记录、不扣费
+func settleTraceCost(trace *RequestTrace, proxyCfg *ProxyConfig) {
+	span := tracing.StartWithParent(trace.SpanContext(), "billing.settle", tracing.SpanKindInternal)
+	defer span.End()
+
+	if trace.ApplyUsageEstimate() {
+		span.SetAttr("billing.usage_estimated", true)
+		log.Debugf("billing: upstream returned no usage for request %s, using estimated tokens", trace.RequestID)
+	}
+
+	calc := billing.GetCostCalculator()
+	if calc == nil {
+		return
+	}
+	pricingModel := trace.MappedModel
+	if pricingModel == "" {
+		pricingModel = trace.OriginalModel
+	}
+	if pricingModel == "" {
+		return
+	}
+	var costResult billing.CostResult
+	if trace.Batch {
+		costResult = calc.CalculateBatch(pricingModel, trace.BillingUsage())
+	} else {
+		costResult = calc.Calculate(pricingModel, trace.BillingUsage())
+	}
+	span.SetAttr("billing.pricing_model", pricingModel)
+	span.SetAttr("billing.price_found", costResult.PriceFound)
+	if !costResult.PriceFound {
+		return
+	}
+
+	multiplier := 1.0
+	if proxyCfg != nil {
+		multiplier = proxyCfg.RateMultiplier
+		trace.RateMultiplier = multiplier
+	}
+	if multiplier == 0 {
+		trace.SetCost(costResult.CostMicros, costResult.CostUsd, costResult.PricingModel)
+		return
+	}
+
+	adjustedCostMicros := billing.ApplyRateMultiplier(costResult.CostMicros, multiplier)
+	adjustedCostUsd := fmt.Sprintf("%.6f", float64(adjustedCostMicros)/1e6)
+	trace.SetCost(adjustedCostMicros, adjustedCostUsd, costResult.PricingModel)
+	span.SetAttr("billing.cost_micros", adjustedCostMicros)
+
+	if proxyCfg != nil && adjustedCostMicros > 0 {
+		billingSvc := service.NewBillingService()
+		if err := billingSvc.SettleRequestCost(trace.RequestID, proxyCfg.UserID, adjustedCostMicros); err != nil {
+			span.SetError(err)
+			log.Warnf("billing: failed to settle cost of request %s for user %s: %v", trace.RequestID, proxyCfg.UserID, err)
+		}
+	}
+}
+
 func stringPtrIfNonEmpty(s string) *string {
 	if s == "" {
 		return nil
 	}
 	return &s
 }
+
+// attemptsJSON 序列化重试历史；只有发生过重试（多于一次尝试）时才落库
+func attemptsJSON(attempts []model.RequestAttempt) *string {
+	if len(attempts) < 2 {
+		return nil
+	}
+	data, err := json.Marshal(attempts)
+	if err != nil {
+		log.Warnf("log writer: failed to marshal attempts: %v", err)
+		return nil
+	}
+	encoded := string(data)
+	return &encoded
+}
+
+// onBehalfOf 非联邦请求时写入 NULL
+func onBehalfOf(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,235 @@
+package amp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 维护模式默认值
+const (
+	defaultMaintenanceMessage    = "服务维护中，请稍后重试"
+	defaultMaintenanceRetryAfter = 60
+	defaultMaintenanceQueueWait  = 30
+	defaultMaintenanceMaxQueued  = 100
+)
+
+var maintenanceState struct {
+	mu     sync.RWMutex
+	config model.MaintenanceConfig
+	// changed 配置每次变更时关闭并重建，唤醒排队中的请求重新判断
+	changed chan struct{}
+}
+
+var (
+	inflightInvocations int64
+	queuedInvocations   int64
+)
+
+func init() {
+	maintenanceState.config = NormalizeMaintenanceConfig(model.MaintenanceConfig{})
+	maintenanceState.changed = make(chan struct{})
+}
+
+// NormalizeMaintenanceConfig 填充未设置的字段
+func NormalizeMaintenanceConfig(cfg model.MaintenanceConfig) model.MaintenanceConfig {
+	if cfg.Mode == "" {
+		cfg.Mode = model.MaintenanceModeReject
+	}
+	if cfg.Message == "" {
+		cfg.Message = defaultMaintenanceMessage
+	}
+	if cfg.RetryAfterSec <= 0 {
+		cfg.RetryAfterSec = defaultMaintenanceRetryAfter
+	}
+	if cfg.QueueTimeoutSec <= 0 {
+		cfg.QueueTimeoutSec = defaultMaintenanceQueueWait
+	}
+	if cfg.MaxQueued <= 0 {
+		cfg.MaxQueued = defaultMaintenanceMaxQueued
+	}
+	return cfg
+}
+
+// ValidateMaintenanceConfig 校验维护模式配置（需先 Normalize）
+func ValidateMaintenanceConfig(cfg model.MaintenanceConfig) error {
+	if cfg.Mode != model.MaintenanceModeReject && cfg.Mode != model.MaintenanceModeQueue {
+		return errors.New("mode 只能为 reject 或 queue")
+	}
+	if cfg.RetryAfterSec > 3600 {
+		return errors.New("retryAfterSec 不能超过 3600")
+	}
+	if cfg.QueueTimeoutSec > 300 {
+		return errors.New("queueTimeoutSec 不能超过 300")
+	}
+	if cfg.MaxQueued > 10000 {
+		return errors.New("maxQueued 不能超过 10000")
+	}
+	return nil
+}
+
+// InitMaintenanceConfig 从数据库 JSON 加载维护模式配置，重启后保持维护状态
+func InitMaintenanceConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.MaintenanceConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("maintenance: 解析配置失败，忽略: %v", err)
+		return
+	}
+	cfg = NormalizeMaintenanceConfig(cfg)
+	if err := ValidateMaintenanceConfig(cfg); err != nil {
+		log.Warnf("maintenance: 配置无效，忽略: %v", err)
+		return
+	}
+	UpdateMaintenanceConfig(cfg)
+}
+
+// UpdateMaintenanceConfig 更新维护模式配置，返回生效后的配置
+// 从关闭切换为开启时记录开始时间；已在维护中时保留原开始时间
+func UpdateMaintenanceConfig(cfg model.MaintenanceConfig) model.MaintenanceConfig {
+	cfg = NormalizeMaintenanceConfig(cfg)
+
+	maintenanceState.mu.Lock()
+	prev := maintenanceState.config
+	switch {
+	case !cfg.Enabled:
+		cfg.StartedAt = nil
+	case prev.Enabled && prev.StartedAt != nil:
+		cfg.StartedAt = prev.StartedAt
+	case cfg.StartedAt == nil:
+		now := time.Now()
+		cfg.StartedAt = &now
+	}
+	maintenanceState.config = cfg
+	close(maintenanceState.changed)
+	maintenanceState.changed = make(chan struct{})
+	maintenanceState.mu.Unlock()
+
+	if cfg.Enabled != prev.Enabled {
+		if cfg.Enabled {
+			log.Infof("maintenance: 已进入维护模式 (mode=%s)，进行中的请求 %d 个", cfg.Mode, InflightInvocations())
+		} else {
+			log.Infof("maintenance: 已退出维护模式")
+		}
+	}
+	return cfg
+}
+
+// GetMaintenanceConfig 返回当前维护模式配置
+func GetMaintenanceConfig() model.MaintenanceConfig {
+	cfg, _ := maintenanceSnapshot()
+	return cfg
+}
+
+// GetMaintenanceStatus 返回维护模式配置及进行中/排队中的请求数
+func GetMaintenanceStatus() model.MaintenanceStatus {
+	return model.MaintenanceStatus{
+		MaintenanceConfig: GetMaintenanceConfig(),
+		InFlight:          InflightInvocations(),
+		Queued:            atomic.LoadInt64(&queuedInvocations),
+	}
+}
+
+// InflightInvocations 返回正在处理中的模型调用数
+func InflightInvocations() int64 {
+	return atomic.LoadInt64(&inflightInvocations)
+}
+
+// WaitForInflightDrain 等待进行中的模型调用全部结束（通常在开启维护模式后调用）
+func WaitForInflightDrain(ctx context.Context) error {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for InflightInvocations() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func maintenanceSnapshot() (model.MaintenanceConfig, <-chan struct{}) {
+	maintenanceState.mu.RLock()
+	defer maintenanceState.mu.RUnlock()
+	return maintenanceState.config, maintenanceState.changed
+}
+
+// MaintenanceMiddleware 维护模式拦截，仅作用于模型调用
+// 放行的请求计入进行中计数直到处理结束（流式响应在 c.Next 内写完），便于等待排空
+func MaintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		var deadline <-chan time.Time
+		queued := false
+		leaveQueue := func() {
+			if queued {
+				atomic.AddInt64(&queuedInvocations, -1)
+				queued = false
+			}
+		}
+		defer leaveQueue()
+
+		for {
+			// 先计数再检查，保证开启维护后 WaitForInflightDrain 不会漏掉刚放行的请求
+			atomic.AddInt64(&inflightInvocations, 1)
+			cfg, changed := maintenanceSnapshot()
+			if !cfg.Enabled {
+				leaveQueue()
+				defer atomic.AddInt64(&inflightInvocations, -1)
+				c.Next()
+				return
+			}
+			atomic.AddInt64(&inflightInvocations, -1)
+
+			if cfg.Mode != model.MaintenanceModeQueue {
+				abortMaintenance(c, cfg)
+				return
+			}
+			if !queued {
+				if atomic.AddInt64(&queuedInvocations, 1) > int64(cfg.MaxQueued) {
+					atomic.AddInt64(&queuedInvocations, -1)
+					abortMaintenance(c, cfg)
+					return
+				}
+				queued = true
+				timer := time.NewTimer(time.Duration(cfg.QueueTimeoutSec) * time.Second)
+				defer timer.Stop()
+				deadline = timer.C
+			}
+
+			select {
+			case <-changed:
+			case <-deadline:
+				abortMaintenance(c, cfg)
+				return
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+		}
+	}
+}
+
+func abortMaintenance(c *gin.Context, cfg model.MaintenanceConfig) {
+	resp := NewStandardError(http.StatusServiceUnavailable, cfg.Message)
+	resp.Error.Code = "maintenance"
+	c.Header("Retry-After", strconv.Itoa(cfg.RetryAfterSec))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, resp)
+}
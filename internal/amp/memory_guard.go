@@ -0,0 +1,414 @@
+package amp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMemoryCheckIntervalSec = 15
+	maxMemoryCheckIntervalSec     = 3600
+
+	memoryLevelNormal   = "normal"
+	memoryLevelWarn     = "warn"
+	memoryLevelCritical = "critical"
+
+	memoryBudgetExceededCode = "memory_budget_exceeded"
+)
+
+// errMemoryBudgetExceeded 必需的缓冲超出请求内存预算，请求被中止
+var errMemoryBudgetExceeded = errors.New("request exceeded its memory budget")
+
+var memoryGuardState struct {
+	mu     sync.RWMutex
+	config model.MemoryGuardConfig
+	status model.MemoryGuardStatus
+}
+
+var (
+	// memoryLevel 最近一次检查的水位，请求路径上无锁读取
+	memoryLevel atomic.Value
+
+	memoryBudgetExceededTotal atomic.Int64
+	memoryBudgetAbortedTotal  atomic.Int64
+)
+
+func init() {
+	memoryGuardState.config = NormalizeMemoryGuardConfig(model.MemoryGuardConfig{})
+	memoryLevel.Store(memoryLevelNormal)
+}
+
+// NormalizeMemoryGuardConfig 填充未设置的字段，默认不限制单请求预算、不告警，检查间隔 15 秒
+func NormalizeMemoryGuardConfig(cfg model.MemoryGuardConfig) model.MemoryGuardConfig {
+	if cfg.CheckIntervalSec <= 0 {
+		cfg.CheckIntervalSec = defaultMemoryCheckIntervalSec
+	}
+	return cfg
+}
+
+// ValidateMemoryGuardConfig 校验内存保护配置（需先 Normalize）
+func ValidateMemoryGuardConfig(cfg model.MemoryGuardConfig) error {
+	if cfg.RequestBudgetMB < 0 || cfg.WarnRSSMB < 0 || cfg.CriticalRSSMB < 0 {
+		return errors.New("requestBudgetMb、warnRssMb、criticalRssMb 不能为负数")
+	}
+	if cfg.WarnRSSMB > 0 && cfg.CriticalRSSMB > 0 && cfg.CriticalRSSMB < cfg.WarnRSSMB {
+		return errors.New("criticalRssMb 不能小于 warnRssMb")
+	}
+	if cfg.CheckIntervalSec > maxMemoryCheckIntervalSec {
+		return fmt.Errorf("checkIntervalSec 不能超过 %d", maxMemoryCheckIntervalSec)
+	}
+	return nil
+}
+
+// InitMemoryGuardConfig 从数据库 JSON 加载内存保护配置
+func InitMemoryGuardConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.MemoryGuardConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("memory guard: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizeMemoryGuardConfig(cfg)
+	if err := ValidateMemoryGuardConfig(cfg); err != nil {
+		log.Warnf("memory guard: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateMemoryGuardConfig(cfg)
+}
+
+// UpdateMemoryGuardConfig 更新内存保护配置：单请求预算对之后开始的请求生效，水位立即按新配置重新检查
+func UpdateMemoryGuardConfig(cfg model.MemoryGuardConfig) {
+	memoryGuardState.mu.Lock()
+	memoryGuardState.config = NormalizeMemoryGuardConfig(cfg)
+	memoryGuardState.mu.Unlock()
+
+	if globalMemoryMonitor != nil {
+		globalMemoryMonitor.notifyReload()
+	}
+}
+
+// GetMemoryGuardConfig 返回当前内存保护配置
+func GetMemoryGuardConfig() model.MemoryGuardConfig {
+	memoryGuardState.mu.RLock()
+	defer memoryGuardState.mu.RUnlock()
+	return memoryGuardState.config
+}
+
+// GetMemoryGuardStatus 返回最近一次检查的进程内存与预算统计，尚未检查过时立即检查一次
+func GetMemoryGuardStatus() model.MemoryGuardStatus {
+	memoryGuardState.mu.RLock()
+	status := memoryGuardState.status
+	memoryGuardState.mu.RUnlock()
+	if status.CheckedAt.IsZero() {
+		status = checkMemoryWatermark()
+	}
+	status.BudgetExceeded = memoryBudgetExceededTotal.Load()
+	status.BudgetAborted = memoryBudgetAbortedTotal.Load()
+	return status
+}
+
+// requestMemoryBudget 单个请求的内存预算，各缓冲层在缓冲前登记字节数，超出时由调用方降级或中止
+type requestMemoryBudget struct {
+	limit    int64
+	used     atomic.Int64
+	peak     atomic.Int64
+	exceeded atomic.Bool
+	aborted  atomic.Bool
+
+	mu     sync.Mutex
+	layers []string
+}
+
+func newRequestMemoryBudget(limit int64) *requestMemoryBudget {
+	return &requestMemoryBudget{limit: limit}
+}
+
+// reserve 登记 n 字节的缓冲，超出预算时不登记并返回 false；未设置预算时总是成功
+func (b *requestMemoryBudget) reserve(n int) bool {
+	if b == nil || n <= 0 {
+		return true
+	}
+	used := b.used.Add(int64(n))
+	if used > b.limit {
+		b.used.Add(-int64(n))
+		return false
+	}
+	for {
+		peak := b.peak.Load()
+		if used <= peak || b.peak.CompareAndSwap(peak, used) {
+			return true
+		}
+	}
+}
+
+// release 释放已登记的缓冲
+func (b *requestMemoryBudget) release(n int) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.used.Add(-int64(n))
+}
+
+// degrade 记录可选缓冲层因超出预算而停止缓冲
+func (b *requestMemoryBudget) degrade(layer string) {
+	if b == nil {
+		return
+	}
+	if !b.exceeded.Swap(true) {
+		memoryBudgetExceededTotal.Add(1)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, l := range b.layers {
+		if l == layer {
+			return
+		}
+	}
+	b.layers = append(b.layers, layer)
+}
+
+// abort 记录必需的缓冲层因超出预算而中止请求，返回 errMemoryBudgetExceeded
+func (b *requestMemoryBudget) abort(layer string) error {
+	if b == nil {
+		return errMemoryBudgetExceeded
+	}
+	b.degrade(layer)
+	if !b.aborted.Swap(true) {
+		memoryBudgetAbortedTotal.Add(1)
+	}
+	return errMemoryBudgetExceeded
+}
+
+type memoryBudgetKey struct{}
+
+func withMemoryBudget(ctx context.Context, b *requestMemoryBudget) context.Context {
+	return context.WithValue(ctx, memoryBudgetKey{}, b)
+}
+
+// memoryBudgetFrom 取出请求的内存预算，未设置预算时返回 nil（nil 预算的所有方法都按不限制处理）
+func memoryBudgetFrom(ctx context.Context) *requestMemoryBudget {
+	if ctx == nil {
+		return nil
+	}
+	b, _ := ctx.Value(memoryBudgetKey{}).(*requestMemoryBudget)
+	return b
+}
+
+// MemoryBudgetMiddleware 按配置为请求分配内存预算，请求结束时记录超出预算的请求
+func MemoryBudgetMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := int64(GetMemoryGuardConfig().RequestBudgetMB) << 20
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+		budget := newRequestMemoryBudget(limit)
+		c.Request = c.Request.WithContext(withMemoryBudget(c.Request.Context(), budget))
+
+		c.Next()
+
+		if budget.exceeded.Load() {
+			budget.mu.Lock()
+			layers := strings.Join(budget.layers, ",")
+			budget.mu.Unlock()
+			log.Warnf("memory guard: request %s %s exceeded its memory budget of %d bytes (peak %d, layers: %s, aborted: %v)",
+				c.Request.Method, c.Request.URL.Path, budget.limit, budget.peak.Load(), layers, budget.aborted.Load())
+		}
+	}
+}
+
+// captureShed 进程内存越过严重水位时所有请求跳过请求详情捕获
+func captureShed() bool {
+	return memoryLevel.Load() == memoryLevelCritical
+}
+
+// budgetReader 按读取的字节数登记预算，用于把整个上游流读入内存的聚合，超出时返回 errMemoryBudgetExceeded
+type budgetReader struct {
+	r      io.Reader
+	budget *requestMemoryBudget
+	layer  string
+	read   int
+}
+
+func newBudgetReader(r io.Reader, budget *requestMemoryBudget, layer string) *budgetReader {
+	return &budgetReader{r: r, budget: budget, layer: layer}
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if !r.budget.reserve(n) {
+			return 0, r.budget.abort(r.layer)
+		}
+		r.read += n
+	}
+	return n, err
+}
+
+// done 聚合完成后释放读取期间登记的预算
+func (r *budgetReader) done() {
+	r.budget.release(r.read)
+	r.read = 0
+}
+
+// memoryBudgetExceededResponse 必需的缓冲超出预算时改写为 502，并返回结构化错误体
+func memoryBudgetExceededResponse(resp *http.Response) []byte {
+	body, _ := json.Marshal(memoryBudgetExceededError())
+	resp.StatusCode = http.StatusBadGateway
+	resp.Status = http.StatusText(http.StatusBadGateway)
+	resp.Header.Set("Content-Type", "application/json")
+	return body
+}
+
+func memoryBudgetExceededError() ErrorResponse {
+	errResp := NewStandardError(http.StatusBadGateway, "upstream response exceeds the per-request memory budget")
+	errResp.Error.Code = memoryBudgetExceededCode
+	return errResp
+}
+
+// memoryWatermarkMonitor 定期检查进程 RSS，水位变化时告警
+type memoryWatermarkMonitor struct {
+	reloadChan chan struct{}
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+}
+
+var globalMemoryMonitor *memoryWatermarkMonitor
+
+// InitMemoryGuard 启动进程内存水位监控
+func InitMemoryGuard() {
+	globalMemoryMonitor = &memoryWatermarkMonitor{
+		reloadChan: make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+	}
+	globalMemoryMonitor.wg.Add(1)
+	go globalMemoryMonitor.run()
+	log.Info("memory guard: started")
+}
+
+// StopMemoryGuard 停止进程内存水位监控
+func StopMemoryGuard() {
+	if m := globalMemoryMonitor; m != nil {
+		m.stopOnce.Do(func() { close(m.stopChan) })
+		m.wg.Wait()
+		log.Info("memory guard: stopped")
+	}
+}
+
+func (m *memoryWatermarkMonitor) notifyReload() {
+	select {
+	case m.reloadChan <- struct{}{}:
+	default:
+	}
+}
+
+func (m *memoryWatermarkMonitor) run() {
+	defer m.wg.Done()
+	interval := func() time.Duration {
+		return time.Duration(GetMemoryGuardConfig().CheckIntervalSec) * time.Second
+	}
+	ticker := time.NewTicker(interval())
+	defer ticker.Stop()
+
+	checkMemoryWatermark()
+	for {
+		select {
+		case <-ticker.C:
+			checkMemoryWatermark()
+		case <-m.reloadChan:
+			ticker.Reset(interval())
+			checkMemoryWatermark()
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+// checkMemoryWatermark 读取进程内存并更新水位，水位变化时写日志并推送 memory_watermark 事件给在线的管理端
+func checkMemoryWatermark() model.MemoryGuardStatus {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	rss := readProcessRSS()
+	if rss == 0 {
+		rss = ms.Sys
+	}
+
+	cfg := GetMemoryGuardConfig()
+	status := model.MemoryGuardStatus{
+		Level:      memoryLevelFor(rss, cfg),
+		RSSBytes:   rss,
+		HeapBytes:  ms.HeapAlloc,
+		Goroutines: runtime.NumGoroutine(),
+		CheckedAt:  time.Now().UTC(),
+	}
+
+	memoryGuardState.mu.Lock()
+	memoryGuardState.status = status
+	memoryGuardState.mu.Unlock()
+
+	previous := memoryLevel.Swap(status.Level)
+	if previous != status.Level {
+		fields := log.Fields{"rssMb": rss >> 20, "heapMb": ms.HeapAlloc >> 20, "from": previous, "to": status.Level}
+		switch status.Level {
+		case memoryLevelCritical:
+			log.WithFields(fields).Errorf("memory guard: 进程内存越过严重水位 %d MB，暂停请求详情捕获", cfg.CriticalRSSMB)
+		case memoryLevelWarn:
+			log.WithFields(fields).Warnf("memory guard: 进程内存越过告警水位 %d MB", cfg.WarnRSSMB)
+		default:
+			log.WithFields(fields).Info("memory guard: 进程内存恢复正常")
+		}
+		realtime.Broadcast("memory_watermark", status)
+	}
+	return status
+}
+
+// memoryLevelFor 按配置的水位判断当前 RSS 所处的级别
+func memoryLevelFor(rss uint64, cfg model.MemoryGuardConfig) string {
+	mb := rss >> 20
+	switch {
+	case cfg.CriticalRSSMB > 0 && mb >= uint64(cfg.CriticalRSSMB):
+		return memoryLevelCritical
+	case cfg.WarnRSSMB > 0 && mb >= uint64(cfg.WarnRSSMB):
+		return memoryLevelWarn
+	default:
+		return memoryLevelNormal
+	}
+}
+
+// readProcessRSS 从 /proc/self/statm 读取常驻内存，非 Linux 平台返回 0（调用方退回 Go 运行时统计）
+func readProcessRSS() uint64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := bytes.Fields(data)
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseUint(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * uint64(os.Getpagesize())
+}
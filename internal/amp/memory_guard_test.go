@@ -0,0 +1,189 @@
+package amp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestRequestMemoryBudget_ReserveAndRelease(t *testing.T) {
+	b := newRequestMemoryBudget(100)
+	if !b.reserve(60) || !b.reserve(40) {
+		t.Fatal("reservations within the limit should succeed")
+	}
+	if b.reserve(1) {
+		t.Fatal("reservation over the limit should fail")
+	}
+	if got := b.used.Load(); got != 100 {
+		t.Fatalf("failed reservation must not be counted, used = %d", got)
+	}
+	b.release(50)
+	if !b.reserve(50) {
+		t.Fatal("released bytes should be reusable")
+	}
+	if got := b.peak.Load(); got != 100 {
+		t.Errorf("peak = %d, want 100", got)
+	}
+
+	var nilBudget *requestMemoryBudget
+	if !nilBudget.reserve(1 << 30) {
+		t.Error("nil budget should never limit")
+	}
+	nilBudget.release(10)
+	nilBudget.degrade("x")
+}
+
+func TestRequestMemoryBudget_DegradeAndAbortCounters(t *testing.T) {
+	exceeded := memoryBudgetExceededTotal.Load()
+	aborted := memoryBudgetAbortedTotal.Load()
+
+	b := newRequestMemoryBudget(10)
+	b.degrade("request_capture")
+	b.degrade("request_capture")
+	if err := b.abort("translation"); !errors.Is(err, errMemoryBudgetExceeded) {
+		t.Fatalf("abort should return errMemoryBudgetExceeded, got %v", err)
+	}
+	_ = b.abort("translation")
+
+	if got := memoryBudgetExceededTotal.Load() - exceeded; got != 1 {
+		t.Errorf("exceeded counter advanced by %d, want 1 per request", got)
+	}
+	if got := memoryBudgetAbortedTotal.Load() - aborted; got != 1 {
+		t.Errorf("aborted counter advanced by %d, want 1 per request", got)
+	}
+	if strings.Join(b.layers, ",") != "request_capture,translation" {
+		t.Errorf("layers = %v", b.layers)
+	}
+}
+
+func TestMemoryLevelFor(t *testing.T) {
+	cfg := model.MemoryGuardConfig{WarnRSSMB: 512, CriticalRSSMB: 1024}
+	tests := []struct {
+		rssMB uint64
+		want  string
+	}{
+		{100, memoryLevelNormal},
+		{512, memoryLevelWarn},
+		{1023, memoryLevelWarn},
+		{2048, memoryLevelCritical},
+	}
+	for _, tt := range tests {
+		if got := memoryLevelFor(tt.rssMB<<20, cfg); got != tt.want {
+			t.Errorf("memoryLevelFor(%d MB) = %q, want %q", tt.rssMB, got, tt.want)
+		}
+	}
+	if got := memoryLevelFor(1<<40, model.MemoryGuardConfig{}); got != memoryLevelNormal {
+		t.Errorf("unset watermarks should never alert, got %q", got)
+	}
+}
+
+func TestValidateMemoryGuardConfig(t *testing.T) {
+	valid := NormalizeMemoryGuardConfig(model.MemoryGuardConfig{RequestBudgetMB: 64, WarnRSSMB: 512, CriticalRSSMB: 1024})
+	if err := ValidateMemoryGuardConfig(valid); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	if valid.CheckIntervalSec != defaultMemoryCheckIntervalSec {
+		t.Errorf("CheckIntervalSec = %d, want default", valid.CheckIntervalSec)
+	}
+	invalid := []model.MemoryGuardConfig{
+		{RequestBudgetMB: -1},
+		{WarnRSSMB: 1024, CriticalRSSMB: 512},
+		{CheckIntervalSec: maxMemoryCheckIntervalSec + 1},
+	}
+	for _, cfg := range invalid {
+		if err := ValidateMemoryGuardConfig(NormalizeMemoryGuardConfig(cfg)); err == nil {
+			t.Errorf("config %+v should be rejected", cfg)
+		}
+	}
+}
+
+func TestResponseCaptureWrapper_DegradesOverBudget(t *testing.T) {
+	budget := newRequestMemoryBudget(16)
+	ctx := withMemoryBudget(context.Background(), budget)
+	body := strings.Repeat("x", 64)
+
+	w := NewResponseCaptureWrapper(ctx, io.NopCloser(strings.NewReader(body)), "", http.Header{})
+	buf := make([]byte, 8)
+	var out strings.Builder
+	for {
+		n, err := w.Read(buf)
+		out.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+
+	if out.String() != body {
+		t.Fatal("capture degradation must not affect the client stream")
+	}
+	if w.buffer.Len() != 16 {
+		t.Errorf("captured %d bytes, want capture to stop at the 16 byte budget", w.buffer.Len())
+	}
+	if !budget.exceeded.Load() || budget.aborted.Load() {
+		t.Error("capture should degrade, not abort")
+	}
+	w.Close()
+	if got := budget.used.Load(); got != 0 {
+		t.Errorf("capture should release its budget on close, used = %d", got)
+	}
+}
+
+func TestTranslatingSSEWrapper_AbortsOverBudget(t *testing.T) {
+	var param any
+	info := &TranslationInfo{
+		NeedsConversion: true,
+		IncomingFormat:  translator.FormatClaude,
+		OutgoingFormat:  translator.FormatOpenAIChat,
+		Model:           "claude-sonnet-4",
+		ResponseParam:   &param,
+	}
+	budget := newRequestMemoryBudget(64)
+	ctx := withMemoryBudget(context.Background(), budget)
+	// 单个事件超过预算且没有分隔符，无法逐帧释放
+	upstream := "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"" + strings.Repeat("a", 256) + "\"}}]}"
+
+	out, err := io.ReadAll(newTranslatingSSEWrapper(ctx, io.NopCloser(strings.NewReader(upstream)), info))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var msg string
+	for _, line := range strings.Split(string(out), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok && gjson.Get(data, "type").String() == "error" {
+			msg = gjson.Get(data, "error.message").String()
+		}
+	}
+	if !strings.Contains(msg, "memory budget") {
+		t.Fatalf("expected a memory budget error event, got %q", out)
+	}
+	if !budget.aborted.Load() {
+		t.Error("translation over budget should abort the request")
+	}
+	if got := budget.used.Load(); got != 0 {
+		t.Errorf("aborted translation should release its buffer, used = %d", got)
+	}
+}
+
+func TestBudgetReader_ReturnsErrorOverBudget(t *testing.T) {
+	budget := newRequestMemoryBudget(32)
+	r := newBudgetReader(strings.NewReader(strings.Repeat("y", 100)), budget, "stream_aggregation")
+	if _, err := io.ReadAll(r); !errors.Is(err, errMemoryBudgetExceeded) {
+		t.Fatalf("expected errMemoryBudgetExceeded, got %v", err)
+	}
+	r.done()
+	if got := budget.used.Load(); got != 0 {
+		t.Errorf("done should release the reservation, used = %d", got)
+	}
+
+	ok := newBudgetReader(strings.NewReader("small"), newRequestMemoryBudget(32), "stream_aggregation")
+	if data, err := io.ReadAll(ok); err != nil || string(data) != "small" {
+		t.Errorf("read within budget: %q, %v", data, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,6 +16,8 @@ import (
 	"strings"
 	"time"
 
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
 	"ampmanager/internal/repository"
 	"ampmanager/internal/service"
 
@@ -156,7 +159,8 @@ func BalanceAdMiddleware() gin.HandlerFunc {
 		endpoint := detectAdEndpoint(c.Request.URL.RawQuery)
 		if endpoint != "" {
 			cfg := GetProxyConfig(c.Request.Context())
-			if cfg != nil && cfg.ShowBalanceInAd && endpoint == "getCurrentAd" {
+			if cfg != nil && cfg.ShowBalanceInAd && endpoint == "getCurrentAd" &&
+				featureFlagService.IsEnabled(model.FeatureBalanceBanner, cfg.UserID, cfg.GroupIDs) {
 				balance, err := userRepo.GetBalance(cfg.UserID)
 				if err == nil {
 					balanceUsd := fmt.Sprintf("$%.2f", float64(balance)/1e6)
@@ -206,8 +210,18 @@ var (
 
 var groupRepo = repository.NewGroupRepository()
 
+var userRepo = repository.NewUserRepository()
+
+// featureFlagService 按用户分组评估功能开关
+var featureFlagService = service.NewFeatureFlagService()
+
 func APIKeyAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if isFederatedRequest(c) {
+			authenticateFederated(c)
+			return
+		}
+
 		apiKey := extractAPIKey(c)
 		if apiKey == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, NewStandardError(http.StatusUnauthorized, "missing api key"))
@@ -241,42 +255,17 @@ func APIKeyAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		settings, err := settingsRepo.GetByUserID(apiKeyRecord.UserID)
-		if err != nil {
-			log.Errorf("amp api key auth: failed to load settings: %v", err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "internal server error"))
+		if !enforceAPIKeyScopes(c, apiKeyRecord) {
 			return
 		}
 
-		if settings == nil {
-			c.AbortWithStatusJSON(http.StatusForbidden, NewStandardError(http.StatusForbidden, "amp proxy not configured for this user"))
-			return
-		}
-
-		if settings.UpstreamURL == "" {
-			c.AbortWithStatusJSON(http.StatusServiceUnavailable, NewStandardError(http.StatusServiceUnavailable, "upstream not configured"))
+		proxyCfg, ok := loadProxyConfig(c, apiKeyRecord.UserID, apiKeyRecord.ID)
+		if !ok {
 			return
 		}
-
-		proxyCfg := &ProxyConfig{
-			UserID:            apiKeyRecord.UserID,
-			APIKeyID:          apiKeyRecord.ID,
-			UpstreamURL:       settings.UpstreamURL,
-			UpstreamAPIKey:    settings.UpstreamAPIKey,
-			ModelMappingsJSON: settings.ModelMappingsJSON,
-			Enabled:           settings.Enabled,
-			WebSearchMode:     settings.WebSearchMode,
-			NativeMode:        settings.NativeMode,
-			ShowBalanceInAd:   settings.ShowBalanceInAd,
-			Socks5Proxy:       settings.Socks5Proxy,
-		}
-
-		rateMultiplier, groupIDs, err := groupRepo.GetMinRateMultiplierByUserID(apiKeyRecord.UserID)
-		if err != nil {
-			log.Warnf("amp api key auth: failed to get rate multiplier for user %s: %v", apiKeyRecord.UserID, err)
-		}
-		proxyCfg.RateMultiplier = rateMultiplier
-		proxyCfg.GroupIDs = groupIDs
+		proxyCfg.APIKeyScopes = apiKeyRecord.Scopes
+		c.Set(middleware.ContextKeyUserID, apiKeyRecord.UserID)
+		c.Set(middleware.ContextKeyAPIKeyID, apiKeyRecord.ID)
 
 		ctx := WithProxyConfig(c.Request.Context(), proxyCfg)
 		c.Request = c.Request.WithContext(ctx)
@@ -291,6 +280,133 @@ func APIKeyAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// authenticateFederated 校验下级 AMP-Manager 实例的签名请求，按签发方对应的本地账户处理
+func authenticateFederated(c *gin.Context) {
+	issuer := c.GetHeader(FederationIssuerHeader)
+	peer, user, err := verifyFederatedRequest(c)
+	if errors.Is(err, errFederationBodyTooLarge) {
+		abortRequestBodyTooLarge(c, requestBodyLimit(c.Request.URL.Path))
+		return
+	}
+	if err != nil {
+		log.Warnf("amp federation auth: rejected request from issuer %q: %v", issuer, err)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, NewStandardError(http.StatusUnauthorized, "invalid federation signature"))
+		return
+	}
+	stripFederationHeaders(c.Request.Header)
+
+	proxyCfg, ok := loadProxyConfig(c, peer.UserID, "")
+	if !ok {
+		return
+	}
+	proxyCfg.OnBehalfOf = peer.Issuer
+	if user != "" {
+		proxyCfg.OnBehalfOf = peer.Issuer + "/" + user
+	}
+	c.Set(middleware.ContextKeyUserID, peer.UserID)
+
+	c.Request = c.Request.WithContext(WithProxyConfig(c.Request.Context(), proxyCfg))
+	c.Next()
+}
+
+// accountSuspendedResponse 停用账户的代理错误响应：OpenAI 兼容格式，额外附带停用说明
+type accountSuspendedResponse struct {
+	Error accountSuspendedDetail `json:"error"`
+}
+
+type accountSuspendedDetail struct {
+	ErrorDetail
+	Suspension model.SuspensionNotice `json:"suspension"`
+}
+
+// abortAccountSuspended 以 403 中止停用账户的代理请求
+func abortAccountSuspended(c *gin.Context, suspension *model.UserSuspension) {
+	notice := service.SuspensionNotice(suspension)
+	message := "account suspended: " + notice.Reason
+	if notice.Message != "" {
+		message += " (" + notice.Message + ")"
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, accountSuspendedResponse{
+		Error: accountSuspendedDetail{
+			ErrorDetail: ErrorDetail{
+				Message: message,
+				Type:    "permission_error",
+				Code:    "account_suspended",
+			},
+			Suspension: notice,
+		},
+	})
+}
+
+// loadProxyConfig 按用户的 Amp 设置与分组构建代理配置，失败时已中止请求并返回 false
+func loadProxyConfig(c *gin.Context, userID, apiKeyID string) (*ProxyConfig, bool) {
+	if suspension := service.ActiveSuspension(userID); suspension != nil {
+		abortAccountSuspended(c, suspension)
+		return nil, false
+	}
+
+	settings, err := settingsRepo.GetByUserID(userID)
+	if err != nil {
+		log.Errorf("amp api key auth: failed to load settings: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "internal server error"))
+		return nil, false
+	}
+
+	if settings == nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, NewStandardError(http.StatusForbidden, "amp proxy not configured for this user"))
+		return nil, false
+	}
+
+	if settings.UpstreamURL == "" {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, NewStandardError(http.StatusServiceUnavailable, "upstream not configured"))
+		return nil, false
+	}
+
+	proxyCfg := &ProxyConfig{
+		UserID:            userID,
+		APIKeyID:          apiKeyID,
+		UpstreamURL:       settings.UpstreamURL,
+		UpstreamAPIKey:    settings.UpstreamAPIKey,
+		ModelMappingsJSON: settings.ModelMappingsJSON,
+		Enabled:           settings.Enabled,
+		WebSearchMode:     settings.WebSearchMode,
+		NativeMode:        settings.NativeMode,
+		ShowBalanceInAd:   settings.ShowBalanceInAd,
+		Socks5Proxy:       settings.Socks5Proxy,
+		PostProcessing:    parsePostProcessingSettings(settings.PostProcessingJSON),
+		SystemPrompt:      settings.SystemPrompt,
+	}
+
+	rateMultiplier, groupIDs, err := groupRepo.GetMinRateMultiplierByUserID(userID)
+	if err != nil {
+		log.Warnf("amp api key auth: failed to get rate multiplier for user %s: %v", userID, err)
+	}
+	proxyCfg.RateMultiplier = rateMultiplier
+	proxyCfg.GroupIDs = groupIDs
+	if len(groupIDs) > 0 {
+		maxCost, err := groupRepo.GetMaxRequestCostByUserID(userID)
+		if err != nil {
+			log.Warnf("amp api key auth: failed to get request cost ceiling for user %s: %v", userID, err)
+		}
+		proxyCfg.MaxRequestCostMicros = maxCost
+
+		pipelineJSON, err := groupRepo.GetPipelineByUserID(userID)
+		if err != nil {
+			log.Warnf("amp api key auth: failed to get request pipeline for user %s: %v", userID, err)
+		}
+		if pipeline := service.ParseGroupPipeline(pipelineJSON); !pipeline.IsEmpty() {
+			proxyCfg.Pipeline = &pipeline
+		}
+
+		prompts, err := groupRepo.GetSystemPromptsByUserID(userID)
+		if err != nil {
+			log.Warnf("amp api key auth: failed to get group system prompts for user %s: %v", userID, err)
+		}
+		proxyCfg.GroupSystemPrompt = joinGroupSystemPrompts(prompts)
+	}
+	return proxyCfg, true
+}
+
 func extractAPIKey(c *gin.Context) string {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader != "" {
@@ -310,6 +426,11 @@ func extractAPIKey(c *gin.Context) string {
 		return googKey
 	}
 
+	// Support OpenAI Realtime clients which send API key via WebSocket subprotocol
+	if wsKey := realtimeSubprotocolAPIKey(c.GetHeader("Sec-WebSocket-Protocol")); wsKey != "" {
+		return wsKey
+	}
+
 	// Support Google Gemini SDK which sends API key as query parameter
 	if qKey := c.Query("key"); qKey != "" {
 		return qKey
@@ -418,54 +539,50 @@ func DebugInternalAPIMiddleware() gin.HandlerFunc {
 	}
 }
 
-type responseLogWriter struct {
+// responseBodyCaptureWriter 转发响应的同时保留前 CaptureMaxBodySize 字节用于请求详情
+type responseBodyCaptureWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	body bytes.Buffer
 }
 
-func (w *responseLogWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
+func (w *responseBodyCaptureWriter) Write(b []byte) (int, error) {
+	if remaining := CaptureMaxBodySize - w.body.Len(); remaining > 0 {
+		w.body.Write(b[:min(len(b), remaining)])
+	}
 	return w.ResponseWriter.Write(b)
 }
 
-// BillingCheckMiddleware checks if user has sufficient balance/subscription before model invocations.
-// Blocks requests with 403 if balance and subscription quota are both exhausted.
-func BillingCheckMiddleware() gin.HandlerFunc {
-	billingSvc := service.NewBillingService()
-	return func(c *gin.Context) {
-		// Only check for model invocation requests (the ones that cost money)
-		if !IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
-			c.Next()
-			return
-		}
-
-		cfg := GetProxyConfig(c.Request.Context())
-		if cfg == nil {
-			c.Next()
-			return
-		}
-
-		// RateMultiplier == 0 means free, skip billing check
-		if cfg.RateMultiplier == 0 {
-			c.Next()
-			return
-		}
+func (w *responseBodyCaptureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
 
-		canStart, err := billingSvc.CanStartRequest(cfg.UserID)
-		if err != nil {
-			log.Errorf("billing check: failed for user %s: %v", cfg.UserID, err)
-			c.Next()
-			return
-		}
+// captureRequestBody 读取请求体前 CaptureMaxBodySize 字节，并恢复完整请求体供后续处理
+func captureRequestBody(req *http.Request) []byte {
+	if req.Body == nil {
+		return nil
+	}
+	bodyBytes, err := io.ReadAll(io.LimitReader(req.Body, CaptureMaxBodySize+1))
+	if err != nil {
+		return nil
+	}
+	req.Body = &multiReaderCloser{
+		Reader: io.MultiReader(bytes.NewReader(bodyBytes), req.Body),
+		Closer: req.Body,
+	}
+	if len(bodyBytes) > CaptureMaxBodySize {
+		return bodyBytes[:CaptureMaxBodySize]
+	}
+	return bodyBytes
+}
 
-		if !canStart {
-			log.Warnf("billing check: insufficient funds for user %s", cfg.UserID)
-			c.AbortWithStatusJSON(http.StatusForbidden, NewStandardError(http.StatusForbidden, "余额和订阅额度均不足，请充值后再使用"))
-			return
-		}
+type responseLogWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
 
-		c.Next()
-	}
+func (w *responseLogWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
 }
 
 // ForceFreeTierMiddleware forces webSearch2 and extractWebPageContent requests to use free tier
@@ -521,6 +638,12 @@ func WebSearchStrategyMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 功能开关关闭时回退到上游搜索
+		if !featureFlagService.IsEnabled(model.FeatureLocalWebSearch, cfg.UserID, cfg.GroupIDs) {
+			c.Next()
+			return
+		}
+
 		switch cfg.WebSearchMode {
 		case "local_duckduckgo":
 			handleLocalWebSearch(c, tool)
@@ -635,7 +758,8 @@ func modifyFreeTierRequest(bodyBytes []byte) ([]byte, bool) {
 }
 
 // RequestLoggingMiddleware 请求日志记录中间件
-// 在请求开始时创建 RequestTrace，请求结束后写入日志
+// 在请求开始时创建 RequestTrace，请求结束后写入日志；按端点类别的日志策略决定是否记录、
+// 是否同时保存请求/响应详情（见 request_log_policy.go）
 // 注意：模型调用请求由 pending 工作流处理，此中间件跳过
 func RequestLoggingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -646,8 +770,14 @@ func RequestLoggingMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 模型调用请求由 pending 工作流处理，跳过记录
-		if IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
+		// 模型调用请求由 pending 工作流处理，Realtime 会话由处理器在结束时记录，跳过记录
+		if IsModelInvocation(c.Request.Method, c.Request.URL.Path) || isRealtimePath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		level := requestLogLevelFor(c.Request.Method, c.Request.URL.Path)
+		if level == model.RequestLogOff {
 			c.Next()
 			return
 		}
@@ -662,13 +792,28 @@ func RequestLoggingMiddleware() gin.HandlerFunc {
 			c.Request.URL.Path,
 		)
 
+		trace.SetSummaryOnly(level == model.RequestLogSummary)
+
 		// 将 trace 存入 context
 		ctx := WithRequestTrace(c.Request.Context(), trace)
 		c.Request = c.Request.WithContext(ctx)
 
+		// 完整记录时保存请求/响应详情
+		var capture *responseBodyCaptureWriter
+		if level == model.RequestLogFull {
+			StoreRequestDetail(requestID, sanitizeHeaders(c.Request.Header), captureRequestBody(c.Request))
+			capture = &responseBodyCaptureWriter{ResponseWriter: c.Writer}
+			c.Writer = capture
+		}
+
 		// 执行后续处理
 		c.Next()
 
+		if capture != nil {
+			c.Writer = capture.ResponseWriter
+			StoreResponseDetail(requestID, sanitizeHeaders(capture.Header()), capture.body.Bytes())
+		}
+
 		// 设置响应状态
 		trace.SetResponse(c.Writer.Status())
 
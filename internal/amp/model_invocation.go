@@ -12,6 +12,10 @@ var modelInvocationPaths = []string{
 	"/v1/chat/completions",
 	"/v1/completions",
 	"/v1/responses",
+	"/v1/embeddings",
+	"/v1/audio/transcriptions",
+	"/v1/audio/translations",
+	"/v1/audio/speech",
 	// Anthropic compatible endpoints
 	"/v1/messages",
 	// Gemini compatible endpoints (prefix match)
@@ -37,6 +41,11 @@ func IsModelInvocation(method, path string) bool {
 	// 例如 /api/provider/anthropic/v1/messages -> /v1/messages
 	normalizedPath := normalizeProviderPath(path)
 
+	// 批处理接口提交的是一组请求，在结算时逐条记录，不作为单次模型调用处理
+	if isBatchPath(normalizedPath) {
+		return false
+	}
+
 	// 精确匹配
 	for _, p := range modelInvocationPaths {
 		if normalizedPath == p {
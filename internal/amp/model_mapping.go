@@ -100,7 +100,8 @@ var mappingChannelService = service.NewChannelService()
 func ApplyModelMappingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		cfg := GetProxyConfig(c.Request.Context())
-		if cfg == nil || cfg.ModelMappingsJSON == "" {
+		// 批处理请求原样提交，不应用模型映射
+		if cfg == nil || cfg.ModelMappingsJSON == "" || isBatchPath(c.Request.URL.Path) {
 			c.Next()
 			return
 		}
@@ -123,19 +124,13 @@ func ApplyModelMappingMiddleware() gin.HandlerFunc {
 		var bodyBytes []byte
 		var payload map[string]interface{}
 
-		if c.Request.Body != nil && c.Request.ContentLength != 0 {
-			var err error
-			bodyBytes, err = io.ReadAll(c.Request.Body)
-			if err == nil {
-				contentType := c.GetHeader("Content-Type")
-				if strings.Contains(contentType, "application/json") {
-					if err := json.Unmarshal(bodyBytes, &payload); err == nil {
-						if modelName == "" {
-							if bodyModel, ok := payload["model"].(string); ok && bodyModel != "" {
-								modelName = bodyModel
-								modelSource = "body"
-							}
-						}
+		// 只读取 JSON 请求体，multipart 与二进制请求体保持原样
+		if bodyBytes = readJSONRequestBody(c.Request, requestBodyLimit(c.Request.URL.Path)); bodyBytes != nil {
+			if err := json.Unmarshal(bodyBytes, &payload); err == nil {
+				if modelName == "" {
+					if bodyModel, ok := payload["model"].(string); ok && bodyModel != "" {
+						modelName = bodyModel
+						modelSource = "body"
 					}
 				}
 			}
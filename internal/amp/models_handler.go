@@ -50,7 +50,12 @@ func handleOpenAIModels(c *gin.Context) {
 
 	data := make([]gin.H, 0)
 	for _, m := range availableModels {
-		if m.ChannelType != filterType {
+		// Ollama 渠道的模型经 OpenAI Chat 翻译调用，随 OpenAI 模型一起列出
+		protocol := m.ChannelType.Protocol()
+		if protocol == model.ChannelTypeOllama {
+			protocol = model.ChannelTypeOpenAI
+		}
+		if protocol != filterType {
 			continue
 		}
 		if m.ModelWhitelist && !modelMatchesRules(m.ModelID, m.ModelsJSON) {
@@ -69,11 +74,88 @@ func handleOpenAIModels(c *gin.Context) {
 	})
 }
 
-// createOpenAIModelsHandler returns a handler for root-level /v1/models endpoint
-func createOpenAIModelsHandler() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		handleOpenAIModels(c)
+// handleUserModels 根路径 /v1/models：汇总当前用户分组可访问渠道的模型，以及目标可用的精确模型映射，
+// 返回 OpenAI 兼容的模型列表，context_length 取自模型元数据
+func handleUserModels(c *gin.Context) {
+	cfg := GetProxyConfig(c.Request.Context())
+	if cfg == nil {
+		c.JSON(http.StatusUnauthorized, NewStandardError(http.StatusUnauthorized, "authentication required"))
+		return
+	}
+
+	accessible, err := channelService.ListAccessibleModels(cfg.GroupIDs)
+	if err != nil {
+		log.Warnf("models handler: failed to list accessible models: %v", err)
+		c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to list models"))
+		return
+	}
+
+	data := make([]gin.H, 0, len(accessible))
+	byID := make(map[string]model.AccessibleModel, len(accessible))
+	for _, m := range accessible {
+		byID[strings.ToLower(m.ID)] = m
+		data = append(data, userModelObject(m.ID, m.Upstream, m.ChannelType))
+	}
+
+	for _, mapping := range userModelMappings(cfg) {
+		if _, exists := byID[strings.ToLower(mapping.From)]; exists {
+			continue
+		}
+		target, ok := byID[strings.ToLower(mapping.To)]
+		if !ok {
+			continue
+		}
+		byID[strings.ToLower(mapping.From)] = target
+		data = append(data, userModelObject(mapping.From, target.Upstream, target.ChannelType))
+	}
+
+	// API Key 限定了模型时只列出允许调用的模型
+	if scopes := cfg.APIKeyScopes; scopes != nil && len(scopes.Models) > 0 {
+		allowed := data[:0]
+		for _, m := range data {
+			if id, _ := m["id"].(string); apiKeyModelAllowed(scopes.Models, id) {
+				allowed = append(allowed, m)
+			}
+		}
+		data = allowed
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   data,
+	})
+}
+
+// userModelMappings 可在模型列表中展示的映射：非正则、非仅 Amp 且目标模型不同的映射
+func userModelMappings(cfg *ProxyConfig) []model.ModelMapping {
+	if cfg.ModelMappingsJSON == "" {
+		return nil
+	}
+	var mappings []model.ModelMapping
+	if err := json.Unmarshal([]byte(cfg.ModelMappingsJSON), &mappings); err != nil {
+		return nil
+	}
+	result := make([]model.ModelMapping, 0, len(mappings))
+	for _, m := range mappings {
+		if m.From == "" || m.To == "" || m.Regex || m.AmpOnly || strings.EqualFold(m.From, m.To) {
+			continue
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+func userModelObject(id, upstream string, channelType model.ChannelType) gin.H {
+	obj := gin.H{
+		"id":       id,
+		"object":   "model",
+		"created":  0,
+		"owned_by": string(channelType),
+	}
+	if meta := GetModelMetadata(upstream); meta != nil && meta.ContextLength > 0 {
+		obj["context_length"] = meta.ContextLength
 	}
+	return obj
 }
 
 // handleClaudeModels returns Anthropic-compatible model list from channel_models
@@ -88,7 +170,7 @@ func handleClaudeModels(c *gin.Context) {
 
 	data := make([]gin.H, 0)
 	for _, m := range availableModels {
-		if m.ChannelType != model.ChannelTypeClaude {
+		if m.ChannelType.Protocol() != model.ChannelTypeClaude {
 			continue
 		}
 		if m.ModelWhitelist && !modelMatchesRules(m.ModelID, m.ModelsJSON) {
@@ -0,0 +1,20 @@
+package amp
+
+import "testing"
+
+func TestUserModelMappings(t *testing.T) {
+	cfg := &ProxyConfig{ModelMappingsJSON: `[
+		{"from":"fast","to":"claude-haiku-4"},
+		{"from":"^gpt-.*","to":"claude-sonnet-4","regex":true},
+		{"from":"amp-only","to":"gpt-4o","ampOnly":true},
+		{"from":"gpt-4o","to":"GPT-4o"},
+		{"from":"no-target"}
+	]`}
+	mappings := userModelMappings(cfg)
+	if len(mappings) != 1 || mappings[0].From != "fast" {
+		t.Fatalf("unexpected listable mappings: %+v", mappings)
+	}
+	if got := userModelMappings(&ProxyConfig{}); len(got) != 0 {
+		t.Fatalf("expected no mappings, got %+v", got)
+	}
+}
@@ -0,0 +1,166 @@
+package amp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ampmanager/internal/translator"
+
+	"github.com/tidwall/gjson"
+)
+
+// Ollama 的流式响应是 NDJSON（每行一个 JSON 分块），在 ModifyResponse 入口处转换为 SSE，
+// 之后与其他格式共用流式聚合、跨格式翻译、用量提取与日志记录
+
+// isNDJSONResponse 判断上游响应是否为 NDJSON 流
+func isNDJSONResponse(resp *http.Response) bool {
+	return strings.Contains(resp.Header.Get("Content-Type"), "application/x-ndjson")
+}
+
+// ndjsonSSEReader 把 NDJSON 流逐行转换为 SSE data 事件，空行丢弃，最后一行可以没有换行
+type ndjsonSSEReader struct {
+	rc  io.ReadCloser
+	buf []byte
+	out bytes.Buffer
+	eof bool
+}
+
+func newNDJSONSSEReader(rc io.ReadCloser) io.ReadCloser {
+	return &ndjsonSSEReader{rc: rc}
+}
+
+func (r *ndjsonSSEReader) Close() error {
+	return r.rc.Close()
+}
+
+func (r *ndjsonSSEReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.eof {
+			if line := bytes.TrimSpace(r.buf); len(line) > 0 {
+				r.writeEvent(line)
+				r.buf = nil
+				continue
+			}
+			return 0, io.EOF
+		}
+
+		tmp := make([]byte, 8*1024)
+		n, err := r.rc.Read(tmp)
+		if n > 0 {
+			r.buf = append(r.buf, tmp[:n]...)
+		}
+		if err == io.EOF {
+			r.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+		for {
+			idx := bytes.IndexByte(r.buf, '\n')
+			if idx < 0 {
+				break
+			}
+			if line := bytes.TrimSpace(r.buf[:idx]); len(line) > 0 {
+				r.writeEvent(line)
+			}
+			r.buf = r.buf[idx+1:]
+		}
+		if r.out.Len() == 0 && !r.eof {
+			return 0, nil
+		}
+	}
+	return r.out.Read(p)
+}
+
+func (r *ndjsonSSEReader) writeEvent(line []byte) {
+	_ = translator.NewSSEEventWriter(&r.out).WriteData(string(line))
+}
+
+// aggregateOllamaSSEToJSON 把（已转换为 SSE 的）Ollama 流式分块合并为非流式响应：
+// 文本与思考过程按顺序拼接，工具调用依次收集，其余字段取最后一个分块（done、done_reason、用量等）。
+// /api/generate 的分块没有 message，文本位于顶层 response
+func aggregateOllamaSSEToJSON(ctx context.Context, r io.Reader) ([]byte, string, error) {
+	result := map[string]any{}
+	var upstreamError []byte
+	received := false
+	isChat := false
+	var content, thinking strings.Builder
+	var toolCalls []any
+
+	err := forEachSSEPayload(ctx, r, func(_ string, payload []byte) bool {
+		root := gjson.ParseBytes(payload)
+		if errValue := root.Get("error"); errValue.Exists() {
+			upstreamError = ollamaStreamError(errValue)
+			return false
+		}
+		received = true
+		root.ForEach(func(key, value gjson.Result) bool {
+			switch key.String() {
+			case "message", "response", "thinking":
+			default:
+				result[key.String()] = value.Value()
+			}
+			return true
+		})
+		if message := root.Get("message"); message.Exists() {
+			isChat = true
+			content.WriteString(message.Get("content").String())
+			thinking.WriteString(message.Get("thinking").String())
+			message.Get("tool_calls").ForEach(func(_, call gjson.Result) bool {
+				toolCalls = append(toolCalls, call.Value())
+				return true
+			})
+		} else {
+			content.WriteString(root.Get("response").String())
+			thinking.WriteString(root.Get("thinking").String())
+		}
+		return true
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if upstreamError != nil {
+		return upstreamError, "", nil
+	}
+	if !received {
+		return nil, "", fmt.Errorf("ollama sse aggregate: no chunks received")
+	}
+
+	if isChat {
+		message := map[string]any{"role": "assistant", "content": content.String()}
+		if thinking.Len() > 0 {
+			message["thinking"] = thinking.String()
+		}
+		if len(toolCalls) > 0 {
+			message["tool_calls"] = toolCalls
+		}
+		result["message"] = message
+	} else {
+		result["response"] = content.String()
+		if thinking.Len() > 0 {
+			result["thinking"] = thinking.String()
+		}
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, content.String(), nil
+}
+
+// ollamaStreamError 流中的错误行为 {"error":"..."}，改写为错误对象，
+// 聚合结果因此被识别为上游错误（见 isAggregatedStreamError）
+func ollamaStreamError(errValue gjson.Result) []byte {
+	if errValue.IsObject() {
+		body, _ := json.Marshal(map[string]any{"error": errValue.Value()})
+		return body
+	}
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]string{"message": errValue.String(), "type": "api_error"},
+	})
+	return body
+}
@@ -0,0 +1,120 @@
+package amp
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/translator"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestNDJSONSSEReader(t *testing.T) {
+	// 最后一行没有换行，且夹带空行与 CRLF
+	upstream := "{\"message\":{\"content\":\"Hi\"},\"done\":false}\r\n\n" +
+		"{\"message\":{\"content\":\"\"},\"done\":true,\"eval_count\":1}"
+	out, err := io.ReadAll(newNDJSONSSEReader(io.NopCloser(strings.NewReader(upstream))))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	want := "data: {\"message\":{\"content\":\"Hi\"},\"done\":false}\n\n" +
+		"data: {\"message\":{\"content\":\"\"},\"done\":true,\"eval_count\":1}\n\n"
+	if string(out) != want {
+		t.Fatalf("got:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestOllamaStreamTranslatedToOpenAIChat(t *testing.T) {
+	var param any
+	info := &TranslationInfo{
+		NeedsConversion:     true,
+		IncomingFormat:      translator.FormatOpenAIChat,
+		OutgoingFormat:      translator.FormatOllamaChat,
+		Model:               "llama3.2",
+		OriginalRequestBody: []byte(`{"stream":true}`),
+		ResponseParam:       &param,
+	}
+	upstream := `{"model":"llama3.2","message":{"role":"assistant","content":"Hel"},"done":false}
+{"model":"llama3.2","message":{"role":"assistant","content":"lo"},"done":false}
+{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":4,"eval_count":2}
+`
+	body := newNDJSONSSEReader(io.NopCloser(strings.NewReader(upstream)))
+	out, err := io.ReadAll(newTranslatingSSEWrapper(context.Background(), body, info))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var text strings.Builder
+	var finish string
+	for _, line := range strings.Split(string(out), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			text.WriteString(gjson.Get(data, "choices.0.delta.content").String())
+			if fr := gjson.Get(data, "choices.0.finish_reason").String(); fr != "" {
+				finish = fr
+			}
+		}
+	}
+	if text.String() != "Hello" || finish != "stop" {
+		t.Fatalf("text %q finish %q:\n%s", text.String(), finish, out)
+	}
+	if strings.Count(string(out), "data: [DONE]") != 1 {
+		t.Fatalf("expected exactly one [DONE]:\n%s", out)
+	}
+}
+
+func TestAggregateOllamaSSEToJSON(t *testing.T) {
+	input := strings.Join([]string{
+		`data: {"model":"llama3.2","message":{"role":"assistant","content":"","thinking":"hm"},"done":false}`,
+		`data: {"model":"llama3.2","message":{"role":"assistant","content":"Hi"},"done":false}`,
+		`data: {"model":"llama3.2","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"read","arguments":{"path":"a"}}}]},"done":false}`,
+		`data: {"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":4,"eval_count":2}`,
+		``,
+	}, "\n\n")
+	out, text, err := aggregateOllamaSSEToJSON(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	root := gjson.ParseBytes(out)
+	if text != "Hi" || root.Get("message.content").String() != "Hi" || root.Get("message.thinking").String() != "hm" {
+		t.Fatalf("unexpected message: %s", out)
+	}
+	if root.Get("message.tool_calls.0.function.arguments.path").String() != "a" {
+		t.Fatalf("unexpected tool calls: %s", out)
+	}
+	if !root.Get("done").Bool() || root.Get("eval_count").Int() != 2 || root.Get("prompt_eval_count").Int() != 4 {
+		t.Fatalf("final chunk fields missing: %s", out)
+	}
+
+	generate := "data: {\"response\":\"He\",\"done\":false}\n\ndata: {\"response\":\"y\",\"done\":true,\"done_reason\":\"length\"}\n\n"
+	out, _, err = aggregateOllamaSSEToJSON(context.Background(), strings.NewReader(generate))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gjson.GetBytes(out, "response").String() != "Hey" || gjson.GetBytes(out, "message").Exists() {
+		t.Fatalf("unexpected generate aggregate: %s", out)
+	}
+
+	out, _, err = aggregateOllamaSSEToJSON(context.Background(), strings.NewReader("data: {\"error\":\"model not found\"}\n\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isAggregatedStreamError(out) || gjson.GetBytes(out, "error.message").String() != "model not found" {
+		t.Fatalf("stream errors must aggregate to an error object: %s", out)
+	}
+}
+
+func TestOllamaUsageParser(t *testing.T) {
+	p := NewUsageParser(ProviderInfo{Provider: ProviderOllama})
+	if _, _, ok := p.ConsumeSSE("", []byte(`{"message":{"content":"Hi"},"done":false}`)); ok {
+		t.Fatal("intermediate chunks carry no usage")
+	}
+	usage, final, ok := p.ConsumeSSE("", []byte(`{"done":true,"prompt_eval_count":12,"eval_count":5}`))
+	if !ok || !final || ptrToInt(usage.InputTokens) != 12 || ptrToInt(usage.OutputTokens) != 5 {
+		t.Fatalf("unexpected usage %+v final=%v ok=%v", usage, final, ok)
+	}
+	usage, ok = p.ParseResponse([]byte(`{"response":"Hi","done":true,"prompt_eval_count":3,"eval_count":1}`))
+	if !ok || ptrToInt(usage.InputTokens) != 3 || ptrToInt(usage.OutputTokens) != 1 {
+		t.Fatalf("unexpected response usage %+v", usage)
+	}
+}
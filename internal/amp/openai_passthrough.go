@@ -0,0 +1,42 @@
+package amp
+
+import (
+	"strings"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+)
+
+// isOpenAIPassthroughPath embeddings 与音频接口只有 OpenAI 兼容渠道提供，请求原样透传
+func isOpenAIPassthroughPath(path string) bool {
+	return isEmbeddingsPath(path) || isAudioPath(path)
+}
+
+// channelSupportsOpenAIPassthrough 只有 OpenAI 兼容渠道提供 embeddings/音频接口，不论其生成接口是 Chat 还是 Responses
+func channelSupportsOpenAIPassthrough(channel *model.Channel) bool {
+	return channel != nil && channel.Type == model.ChannelTypeOpenAI
+}
+
+// requestChannelFormat 渠道处理该请求时使用的格式。embeddings 与音频请求原样透传给 OpenAI 兼容渠道，
+// 不参与 Chat/Responses 的格式翻译
+func requestChannelFormat(channel *model.Channel, incoming translator.Format) translator.Format {
+	switch incoming {
+	case translator.FormatOpenAIEmbeddings, translator.FormatOpenAIAudio:
+		if channelSupportsOpenAIPassthrough(channel) {
+			return incoming
+		}
+	}
+	return channelTypeToFormat(channel)
+}
+
+// selectOpenAIPassthroughChannel 按模型与分组选择渠道，只考虑 OpenAI 兼容渠道
+func selectOpenAIPassthroughChannel(modelName string, groupIDs []string) (*model.Channel, error) {
+	return channelService.SelectFailoverChannel(modelName, groupIDs, func(ch *model.Channel) bool {
+		return !channelSupportsOpenAIPassthrough(ch)
+	})
+}
+
+// passthroughEndpointPath 透传请求在上游使用的路径（去掉 /api/provider/:provider 前缀）
+func passthroughEndpointPath(path string) string {
+	return normalizeProviderPath(strings.TrimSuffix(path, "/"))
+}
@@ -0,0 +1,489 @@
+package amp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	defaultOutputFilterHoldback = 64
+	maxOutputFilterHoldback     = 4096
+	maxOutputFilterRules        = 200
+	defaultOutputFilterMask     = "[REDACTED]"
+	// 单个请求最多从提示中提取的密钥数
+	maxPromptSecrets = 50
+	// 保留的最近命中记录数
+	maxOutputFilterIncidents = 100
+	// promptSecretRuleName 由请求中提取的密钥生成的规则名
+	promptSecretRuleName = "prompt_secret"
+)
+
+// promptSecretPatterns 常见密钥格式，请求中出现的匹配项会在输出中被屏蔽
+var promptSecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`AKIA[0-9A-Z]{16}`),
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}`),
+	regexp.MustCompile(`github_pat_[A-Za-z0-9_]{40,}`),
+	regexp.MustCompile(`glpat-[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`xox[abprs]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`AIza[0-9A-Za-z_-]{35}`),
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`),
+}
+
+// outputFilterRule 编译后的过滤规则
+type outputFilterRule struct {
+	name        string
+	re          *regexp.Regexp
+	block       bool
+	replacement string
+	// literalLen 字面量规则的长度（字符数），用于确定流式暂缓窗口
+	literalLen int
+}
+
+var outputFilterState struct {
+	mu       sync.RWMutex
+	config   model.OutputFilterConfig
+	rules    []*outputFilterRule
+	holdback int
+}
+
+var outputFilterIncidents struct {
+	mu    sync.Mutex
+	items []model.OutputFilterIncident
+}
+
+func init() {
+	outputFilterState.config = DefaultOutputFilterConfig()
+	outputFilterState.holdback = defaultOutputFilterHoldback
+}
+
+// DefaultOutputFilterConfig 默认关闭
+func DefaultOutputFilterConfig() model.OutputFilterConfig {
+	return model.OutputFilterConfig{
+		Rules:         []model.OutputFilterRule{},
+		HoldbackChars: defaultOutputFilterHoldback,
+	}
+}
+
+// NormalizeOutputFilterConfig 填充未设置的字段
+func NormalizeOutputFilterConfig(cfg model.OutputFilterConfig) model.OutputFilterConfig {
+	if cfg.HoldbackChars <= 0 {
+		cfg.HoldbackChars = defaultOutputFilterHoldback
+	}
+	if cfg.Rules == nil {
+		cfg.Rules = []model.OutputFilterRule{}
+	}
+	for i := range cfg.Rules {
+		cfg.Rules[i].Name = strings.TrimSpace(cfg.Rules[i].Name)
+		if cfg.Rules[i].Action == "" {
+			cfg.Rules[i].Action = model.OutputFilterActionMask
+		}
+		if cfg.Rules[i].Name == "" {
+			cfg.Rules[i].Name = fmt.Sprintf("rule-%d", i+1)
+		}
+	}
+	return cfg
+}
+
+// ValidateOutputFilterConfig 校验输出过滤配置（需先 Normalize）
+func ValidateOutputFilterConfig(cfg model.OutputFilterConfig) error {
+	if cfg.HoldbackChars > maxOutputFilterHoldback {
+		return fmt.Errorf("holdbackChars 不能超过 %d", maxOutputFilterHoldback)
+	}
+	if len(cfg.Rules) > maxOutputFilterRules {
+		return fmt.Errorf("规则数不能超过 %d", maxOutputFilterRules)
+	}
+	_, err := compileOutputFilterRules(cfg.Rules)
+	return err
+}
+
+func compileOutputFilterRules(rules []model.OutputFilterRule) ([]*outputFilterRule, error) {
+	compiled := make([]*outputFilterRule, 0, len(rules))
+	for _, r := range rules {
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("规则 %s 的 pattern 不能为空", r.Name)
+		}
+		if r.Action != model.OutputFilterActionMask && r.Action != model.OutputFilterActionBlock {
+			return nil, fmt.Errorf("规则 %s 的 action 必须为 mask 或 block", r.Name)
+		}
+		rule := &outputFilterRule{
+			name:        r.Name,
+			block:       r.Action == model.OutputFilterActionBlock,
+			replacement: r.Replacement,
+		}
+		if rule.replacement == "" {
+			rule.replacement = defaultOutputFilterMask
+		}
+		if r.Regex {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("规则 %s 的正则无效: %v", r.Name, err)
+			}
+			if re.MatchString("") {
+				return nil, fmt.Errorf("规则 %s 的正则不能匹配空字符串", r.Name)
+			}
+			rule.re = re
+		} else {
+			rule.re = regexp.MustCompile("(?i)" + regexp.QuoteMeta(r.Pattern))
+			rule.literalLen = utf8.RuneCountInString(r.Pattern)
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled, nil
+}
+
+// InitOutputFilterConfig 从数据库 JSON 加载输出过滤配置
+func InitOutputFilterConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.OutputFilterConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("output filter: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizeOutputFilterConfig(cfg)
+	if err := ValidateOutputFilterConfig(cfg); err != nil {
+		log.Warnf("output filter: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateOutputFilterConfig(cfg)
+}
+
+// UpdateOutputFilterConfig 更新运行时输出过滤配置（需先校验）
+func UpdateOutputFilterConfig(cfg model.OutputFilterConfig) {
+	rules, err := compileOutputFilterRules(cfg.Rules)
+	if err != nil {
+		log.Warnf("output filter: 编译规则失败: %v", err)
+		return
+	}
+	outputFilterState.mu.Lock()
+	defer outputFilterState.mu.Unlock()
+	outputFilterState.config = cfg
+	outputFilterState.rules = rules
+	outputFilterState.holdback = cfg.HoldbackChars
+}
+
+// GetOutputFilterConfig 返回当前生效的输出过滤配置
+func GetOutputFilterConfig() model.OutputFilterConfig {
+	outputFilterState.mu.RLock()
+	defer outputFilterState.mu.RUnlock()
+	return outputFilterState.config
+}
+
+// GetOutputFilterIncidents 返回最近的命中记录（新的在前）
+func GetOutputFilterIncidents() []model.OutputFilterIncident {
+	outputFilterIncidents.mu.Lock()
+	defer outputFilterIncidents.mu.Unlock()
+	items := make([]model.OutputFilterIncident, len(outputFilterIncidents.items))
+	for i, item := range outputFilterIncidents.items {
+		items[len(items)-1-i] = item
+	}
+	return items
+}
+
+// outputFilter 单个请求使用的过滤器：全局规则加上从请求中提取的密钥
+type outputFilter struct {
+	rules    []*outputFilterRule
+	holdback int
+}
+
+// newRequestOutputFilter 为请求构建过滤器，未启用或没有规则时返回 nil
+func newRequestOutputFilter(requestBody []byte) *outputFilter {
+	outputFilterState.mu.RLock()
+	cfg := outputFilterState.config
+	rules := outputFilterState.rules
+	holdback := outputFilterState.holdback
+	outputFilterState.mu.RUnlock()
+	if !cfg.Enabled {
+		return nil
+	}
+
+	f := &outputFilter{rules: rules, holdback: holdback}
+	if cfg.MaskPromptSecrets {
+		f.rules = append(append([]*outputFilterRule(nil), rules...), extractPromptSecretRules(requestBody)...)
+	}
+	if len(f.rules) == 0 {
+		return nil
+	}
+	for _, r := range f.rules {
+		f.holdback = max(f.holdback, r.literalLen)
+	}
+	return f
+}
+
+// extractPromptSecretRules 提取请求中的疑似密钥，生成区分大小写的字面量屏蔽规则
+func extractPromptSecretRules(body []byte) []*outputFilterRule {
+	seen := make(map[string]struct{})
+	var rules []*outputFilterRule
+	for _, re := range promptSecretPatterns {
+		for _, m := range re.FindAll(body, -1) {
+			secret := string(m)
+			if _, ok := seen[secret]; ok {
+				continue
+			}
+			seen[secret] = struct{}{}
+			rules = append(rules, &outputFilterRule{
+				name:        promptSecretRuleName,
+				re:          regexp.MustCompile(regexp.QuoteMeta(secret)),
+				replacement: defaultOutputFilterMask,
+				literalLen:  len(secret),
+			})
+			if len(rules) >= maxPromptSecrets {
+				return rules
+			}
+		}
+	}
+	return rules
+}
+
+// apply 过滤一段完整文本：命中 block 规则时返回该规则，否则屏蔽所有 mask 规则的匹配内容
+func (f *outputFilter) apply(text string) (string, []*outputFilterRule, *outputFilterRule) {
+	for _, r := range f.rules {
+		if r.block && r.re.MatchString(text) {
+			return text, nil, r
+		}
+	}
+	var hits []*outputFilterRule
+	for _, r := range f.rules {
+		if r.block || !r.re.MatchString(text) {
+			continue
+		}
+		text = r.re.ReplaceAllLiteralString(text, r.replacement)
+		hits = append(hits, r)
+	}
+	return text, hits, nil
+}
+
+// outputFilterText 流式文本的过滤状态：每个内容块末尾暂缓下发 holdback 个字符，
+// 使跨分片的匹配也能被完整替换
+type outputFilterText struct {
+	f       *outputFilter
+	pending map[string]string
+	order   []string
+	onHit   func(rule *outputFilterRule)
+	hit     map[*outputFilterRule]struct{}
+}
+
+func newOutputFilterText(f *outputFilter, onHit func(rule *outputFilterRule)) *outputFilterText {
+	return &outputFilterText{
+		f:       f,
+		pending: make(map[string]string),
+		onHit:   onHit,
+		hit:     make(map[*outputFilterRule]struct{}),
+	}
+}
+
+// report 每条规则在一个响应中只记录一次
+func (t *outputFilterText) report(rules ...*outputFilterRule) {
+	for _, r := range rules {
+		if _, ok := t.hit[r]; ok {
+			continue
+		}
+		t.hit[r] = struct{}{}
+		if t.onHit != nil {
+			t.onHit(r)
+		}
+	}
+}
+
+// filter 过滤完整文本（非流式字段或流结束时的完整快照）
+func (t *outputFilterText) filter(text string) (string, *outputFilterRule) {
+	out, hits, blocked := t.f.apply(text)
+	if blocked != nil {
+		t.report(blocked)
+		return "", blocked
+	}
+	t.report(hits...)
+	return out, nil
+}
+
+// push 追加内容块 key 的增量文本，返回可以下发的已过滤文本
+func (t *outputFilterText) push(key, delta string) (string, *outputFilterRule) {
+	if _, ok := t.pending[key]; !ok {
+		t.order = append(t.order, key)
+	}
+	pending := t.pending[key] + delta
+
+	for _, r := range t.f.rules {
+		if r.block && r.re.MatchString(pending) {
+			t.report(r)
+			return "", r
+		}
+	}
+
+	// 暂缓末尾 holdback 个字符；跨越下发边界的匹配整体留到下次处理
+	cut := len(pending)
+	for i := 0; i < t.f.holdback && cut > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(pending[:cut])
+		cut -= size
+	}
+	for changed := true; changed && cut > 0; {
+		changed = false
+		for _, r := range t.f.rules {
+			for _, loc := range r.re.FindAllStringIndex(pending, -1) {
+				if loc[0] < cut && loc[1] > cut {
+					cut = loc[0]
+					changed = true
+				}
+			}
+		}
+	}
+
+	t.pending[key] = pending[cut:]
+	return t.filter(pending[:cut])
+}
+
+// flush 内容块结束时下发剩余文本
+func (t *outputFilterText) flush(key string) (string, *outputFilterRule) {
+	pending, ok := t.pending[key]
+	if !ok {
+		return "", nil
+	}
+	delete(t.pending, key)
+	return t.filter(pending)
+}
+
+// pendingKeys 尚未结束的内容块（按出现顺序）
+func (t *outputFilterText) pendingKeys() []string {
+	var keys []string
+	for _, key := range t.order {
+		if _, ok := t.pending[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// filterJSONResponse 过滤非流式响应中的文本字段
+func (f *outputFilter) filterJSONResponse(format translator.Format, body []byte, text *outputFilterText) ([]byte, *outputFilterRule) {
+	for _, path := range responseTextPaths(format, body) {
+		original := gjson.GetBytes(body, path).String()
+		filtered, blocked := text.filter(original)
+		if blocked != nil {
+			return body, blocked
+		}
+		if filtered != original {
+			if updated, err := sjson.SetBytes(body, path, filtered); err == nil {
+				body = updated
+			}
+		}
+	}
+	return body, nil
+}
+
+// responseTextPaths 非流式响应中模型输出文本字段的路径（不含思考内容与工具调用）
+func responseTextPaths(format translator.Format, body []byte) []string {
+	var paths []string
+	root := gjson.ParseBytes(body)
+	switch format {
+	case translator.FormatClaude:
+		root.Get("content").ForEach(func(i, block gjson.Result) bool {
+			if block.Get("type").String() == "text" {
+				paths = append(paths, fmt.Sprintf("content.%d.text", i.Int()))
+			}
+			return true
+		})
+	case translator.FormatOpenAIResponses:
+		paths = responsesOutputTextPaths(root.Get("output"), "output")
+	case translator.FormatGemini:
+		root.Get("candidates").ForEach(func(i, cand gjson.Result) bool {
+			cand.Get("content.parts").ForEach(func(j, part gjson.Result) bool {
+				if part.Get("text").Exists() && !part.Get("thought").Bool() {
+					paths = append(paths, fmt.Sprintf("candidates.%d.content.parts.%d.text", i.Int(), j.Int()))
+				}
+				return true
+			})
+			return true
+		})
+	default:
+		root.Get("choices").ForEach(func(i, choice gjson.Result) bool {
+			if choice.Get("message.content").Type == gjson.String {
+				paths = append(paths, fmt.Sprintf("choices.%d.message.content", i.Int()))
+			}
+			return true
+		})
+	}
+	return paths
+}
+
+// responsesOutputTextPaths Responses output 数组中 output_text 的路径
+func responsesOutputTextPaths(output gjson.Result, prefix string) []string {
+	var paths []string
+	output.ForEach(func(i, item gjson.Result) bool {
+		item.Get("content").ForEach(func(j, part gjson.Result) bool {
+			if part.Get("type").String() == "output_text" {
+				paths = append(paths, fmt.Sprintf("%s.%d.content.%d.text", prefix, i.Int(), j.Int()))
+			}
+			return true
+		})
+		return true
+	})
+	return paths
+}
+
+// outputFilterBlockedMessage 终止响应时返回给客户端的说明
+func outputFilterBlockedMessage(rule *outputFilterRule) string {
+	return fmt.Sprintf("响应内容命中输出过滤规则 %s，已终止", rule.name)
+}
+
+// recordOutputFilterIncident 记录命中日志与最近命中记录；block 时标记请求日志
+func recordOutputFilterIncident(ctx context.Context, rule *outputFilterRule, format translator.Format, streaming bool) {
+	incident := model.OutputFilterIncident{
+		Time:      time.Now().UTC(),
+		Rule:      rule.name,
+		Action:    model.OutputFilterActionMask,
+		Format:    string(format),
+		Streaming: streaming,
+	}
+	if rule.block {
+		incident.Action = model.OutputFilterActionBlock
+	}
+	trace := GetRequestTrace(ctx)
+	if trace != nil {
+		incident.RequestID = trace.RequestID
+		if rule.block {
+			trace.SetError("output_filtered")
+		}
+	}
+	if cfg := GetProxyConfig(ctx); cfg != nil {
+		incident.UserID = cfg.UserID
+	}
+	log.Warnf("output filter: 请求 %s（用户 %s）的响应命中规则 %s，处理方式 %s",
+		incident.RequestID, incident.UserID, incident.Rule, incident.Action)
+
+	outputFilterIncidents.mu.Lock()
+	defer outputFilterIncidents.mu.Unlock()
+	outputFilterIncidents.items = append(outputFilterIncidents.items, incident)
+	if n := len(outputFilterIncidents.items); n > maxOutputFilterIncidents {
+		outputFilterIncidents.items = append([]model.OutputFilterIncident(nil), outputFilterIncidents.items[n-maxOutputFilterIncidents:]...)
+	}
+}
+
+type outputFilterKey struct{}
+
+// withOutputFilter 将请求的输出过滤器存入上下文
+func withOutputFilter(ctx context.Context, f *outputFilter) context.Context {
+	return context.WithValue(ctx, outputFilterKey{}, f)
+}
+
+// getOutputFilter 获取请求的输出过滤器，未启用时返回 nil
+func getOutputFilter(ctx context.Context) *outputFilter {
+	if f, ok := ctx.Value(outputFilterKey{}).(*outputFilter); ok {
+		return f
+	}
+	return nil
+}
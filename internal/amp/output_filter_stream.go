@@ -0,0 +1,445 @@
+package amp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"ampmanager/internal/translator"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// sseEvent 待下发的 SSE 事件；raw 非空时原样下发
+type sseEvent struct {
+	raw  []byte
+	name string
+	data []byte
+}
+
+// sseTextStage 流式文本处理阶段：按内容块 key 接收增量并返回可下发的文本，
+// 内容块结束时 flush 剩余文本，filter 处理事件中的完整文本快照
+type sseTextStage interface {
+	push(key, delta string) (string, *outputFilterRule)
+	flush(key string) (string, *outputFilterRule)
+	filter(text string) (string, *outputFilterRule)
+	pendingKeys() []string
+}
+
+// outputFilterSSEWrapper 按响应格式过滤流式输出中的文本增量：命中 mask 规则时替换匹配内容，
+// 命中 block 规则时下发对应格式的错误事件并结束流。响应后处理也复用该包装器的事件改写逻辑
+type outputFilterSSEWrapper struct {
+	rc     io.ReadCloser
+	format translator.Format
+	text   sseTextStage
+
+	buf     []byte
+	out     bytes.Buffer
+	eof     bool
+	stopped bool
+	// seqOffset Responses 插入补发事件后，后续事件 sequence_number 的偏移
+	seqOffset int64
+	lastSeq   int64
+}
+
+// newOutputFilterSSEWrapper 包装流式响应体，f 为 nil 时原样返回
+func newOutputFilterSSEWrapper(rc io.ReadCloser, f *outputFilter, format translator.Format, onHit func(rule *outputFilterRule)) io.ReadCloser {
+	if rc == nil || f == nil {
+		return rc
+	}
+	return &outputFilterSSEWrapper{
+		rc:     rc,
+		format: format,
+		text:   newOutputFilterText(f, onHit),
+	}
+}
+
+func (w *outputFilterSSEWrapper) Close() error {
+	return w.rc.Close()
+}
+
+func (w *outputFilterSSEWrapper) Read(p []byte) (int, error) {
+	for w.out.Len() == 0 {
+		if w.stopped {
+			return 0, io.EOF
+		}
+		if w.eof {
+			if len(bytes.TrimSpace(w.buf)) > 0 {
+				w.processFrame(w.buf)
+			}
+			w.buf = nil
+			if !w.stopped {
+				w.writeEvents(w.flushPending())
+			}
+			w.stopped = true
+			continue
+		}
+
+		tmp := make([]byte, 8*1024)
+		n, err := w.rc.Read(tmp)
+		if n > 0 {
+			w.buf = append(w.buf, tmp[:n]...)
+		}
+		if err == io.EOF {
+			w.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+
+		for !w.stopped {
+			idx, delimLen := findSSEDelimiter(w.buf)
+			if idx < 0 {
+				break
+			}
+			frame := w.buf[:idx+delimLen]
+			w.buf = w.buf[idx+delimLen:]
+			w.processFrame(frame)
+		}
+	}
+	return w.out.Read(p)
+}
+
+func (w *outputFilterSSEWrapper) writeEvents(events []sseEvent) {
+	sse := translator.NewSSEEventWriter(&w.out)
+	for _, ev := range events {
+		if ev.raw != nil {
+			w.out.Write(ev.raw)
+			continue
+		}
+		_ = sse.WriteEvent(ev.name, string(ev.data))
+	}
+}
+
+func (w *outputFilterSSEWrapper) processFrame(frame []byte) {
+	name, payload, done := parseSSEEvent(frame)
+	if done {
+		// OpenAI Chat 以 [DONE] 结束，之前补发未结束内容块的剩余文本
+		events := w.flushPending()
+		if !w.stopped {
+			events = append(events, sseEvent{raw: frame})
+		}
+		w.writeEvents(events)
+		return
+	}
+	if len(payload) == 0 || !gjson.ValidBytes(payload) {
+		w.out.Write(frame)
+		return
+	}
+
+	events, blocked := w.filterEvent(name, payload)
+	if blocked != nil {
+		w.block(blocked)
+		return
+	}
+	if events == nil {
+		w.out.Write(frame)
+		return
+	}
+	w.writeEvents(events)
+}
+
+// block 下发错误事件并停止读取上游
+func (w *outputFilterSSEWrapper) block(rule *outputFilterRule) {
+	msg := outputFilterBlockedMessage(rule)
+	var ev sseEvent
+	switch w.format {
+	case translator.FormatClaude:
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":  "error",
+			"error": map[string]string{"type": "output_filtered", "message": msg},
+		})
+		ev = sseEvent{name: "error", data: data}
+	case translator.FormatOpenAIResponses:
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":            "error",
+			"code":            "output_filtered",
+			"message":         msg,
+			"sequence_number": w.lastSeq + w.seqOffset + 1,
+		})
+		ev = sseEvent{name: "error", data: data}
+	case translator.FormatGemini:
+		data, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]interface{}{"code": 400, "message": msg, "status": "FAILED_PRECONDITION"},
+		})
+		ev = sseEvent{data: data}
+	default:
+		data, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]string{"message": msg, "type": "invalid_request_error", "code": "output_filtered"},
+		})
+		ev = sseEvent{data: data}
+	}
+	w.writeEvents([]sseEvent{ev})
+	w.stopped = true
+	_ = w.rc.Close()
+}
+
+// filterEvent 返回替换后的事件列表；事件不含文本时返回 nil 表示原样下发
+func (w *outputFilterSSEWrapper) filterEvent(name string, payload []byte) ([]sseEvent, *outputFilterRule) {
+	switch w.format {
+	case translator.FormatClaude:
+		return w.filterClaudeEvent(name, payload)
+	case translator.FormatOpenAIResponses:
+		return w.filterResponsesEvent(name, payload)
+	case translator.FormatGemini:
+		return w.filterGeminiEvent(payload)
+	default:
+		return w.filterChatEvent(payload)
+	}
+}
+
+func (w *outputFilterSSEWrapper) filterClaudeEvent(name string, payload []byte) ([]sseEvent, *outputFilterRule) {
+	key := gjson.GetBytes(payload, "index").String()
+	switch gjson.GetBytes(payload, "type").String() {
+	case "content_block_delta":
+		if gjson.GetBytes(payload, "delta.type").String() != "text_delta" {
+			return nil, nil
+		}
+		emit, blocked := w.text.push(key, gjson.GetBytes(payload, "delta.text").String())
+		if blocked != nil {
+			return nil, blocked
+		}
+		data, _ := sjson.SetBytes(payload, "delta.text", emit)
+		return []sseEvent{{name: name, data: data}}, nil
+	case "content_block_stop":
+		rest, blocked := w.text.flush(key)
+		if blocked != nil || rest == "" {
+			return nil, blocked
+		}
+		return []sseEvent{claudeTextDeltaEvent(key, rest), {name: name, data: payload}}, nil
+	}
+	return nil, nil
+}
+
+func claudeTextDeltaEvent(index, text string) sseEvent {
+	idx, _ := strconv.Atoi(index)
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": idx,
+		"delta": map[string]string{"type": "text_delta", "text": text},
+	})
+	return sseEvent{name: "content_block_delta", data: data}
+}
+
+func (w *outputFilterSSEWrapper) filterChatEvent(payload []byte) ([]sseEvent, *outputFilterRule) {
+	choices := gjson.GetBytes(payload, "choices")
+	if !choices.IsArray() {
+		return nil, nil
+	}
+	data := payload
+	changed := false
+	var blocked *outputFilterRule
+	choices.ForEach(func(i, choice gjson.Result) bool {
+		key := choice.Get("index").String()
+		path := fmt.Sprintf("choices.%d.delta.content", i.Int())
+		content := choice.Get("delta.content")
+		emit := ""
+		if content.Type == gjson.String {
+			if emit, blocked = w.text.push(key, content.String()); blocked != nil {
+				return false
+			}
+		}
+		if fr := choice.Get("finish_reason"); fr.Exists() && fr.Type != gjson.Null {
+			rest, b := w.text.flush(key)
+			if blocked = b; blocked != nil {
+				return false
+			}
+			emit += rest
+		}
+		if content.Type == gjson.String || emit != "" {
+			data, _ = sjson.SetBytes(data, path, emit)
+			changed = true
+		}
+		return true
+	})
+	if blocked != nil || !changed {
+		return nil, blocked
+	}
+	return []sseEvent{{data: data}}, nil
+}
+
+func (w *outputFilterSSEWrapper) filterResponsesEvent(name string, payload []byte) ([]sseEvent, *outputFilterRule) {
+	if seq := gjson.GetBytes(payload, "sequence_number"); seq.Exists() {
+		w.lastSeq = seq.Int()
+	}
+	key := gjson.GetBytes(payload, "item_id").String() + ":" + gjson.GetBytes(payload, "content_index").String()
+
+	var events []sseEvent
+	data := payload
+	var blocked *outputFilterRule
+	switch gjson.GetBytes(payload, "type").String() {
+	case "response.output_text.delta":
+		var emit string
+		if emit, blocked = w.text.push(key, gjson.GetBytes(payload, "delta").String()); blocked != nil {
+			return nil, blocked
+		}
+		data, _ = sjson.SetBytes(data, "delta", emit)
+	case "response.output_text.done":
+		rest, b := w.text.flush(key)
+		if b != nil {
+			return nil, b
+		}
+		if rest != "" {
+			delta, _ := json.Marshal(map[string]interface{}{
+				"type":            "response.output_text.delta",
+				"item_id":         gjson.GetBytes(payload, "item_id").String(),
+				"output_index":    gjson.GetBytes(payload, "output_index").Int(),
+				"content_index":   gjson.GetBytes(payload, "content_index").Int(),
+				"delta":           rest,
+				"sequence_number": w.lastSeq + w.seqOffset,
+			})
+			events = append(events, sseEvent{name: "response.output_text.delta", data: delta})
+			w.seqOffset++
+		}
+		if data, blocked = w.filterJSONPaths(data, []string{"text"}); blocked != nil {
+			return nil, blocked
+		}
+	case "response.content_part.done":
+		if gjson.GetBytes(payload, "part.type").String() == "output_text" {
+			if data, blocked = w.filterJSONPaths(data, []string{"part.text"}); blocked != nil {
+				return nil, blocked
+			}
+		}
+	case "response.output_item.done":
+		item := gjson.GetBytes(payload, "item")
+		var paths []string
+		item.Get("content").ForEach(func(j, part gjson.Result) bool {
+			if part.Get("type").String() == "output_text" {
+				paths = append(paths, fmt.Sprintf("item.content.%d.text", j.Int()))
+			}
+			return true
+		})
+		if data, blocked = w.filterJSONPaths(data, paths); blocked != nil {
+			return nil, blocked
+		}
+	case "response.completed", "response.done", "response.incomplete":
+		paths := responsesOutputTextPaths(gjson.GetBytes(payload, "response.output"), "response.output")
+		if data, blocked = w.filterJSONPaths(data, paths); blocked != nil {
+			return nil, blocked
+		}
+	default:
+		if w.seqOffset == 0 {
+			return nil, nil
+		}
+	}
+
+	if w.seqOffset > 0 && gjson.GetBytes(data, "sequence_number").Exists() {
+		data, _ = sjson.SetBytes(data, "sequence_number", w.lastSeq+w.seqOffset)
+	}
+	return append(events, sseEvent{name: name, data: data}), nil
+}
+
+// filterJSONPaths 过滤事件中的完整文本快照
+func (w *outputFilterSSEWrapper) filterJSONPaths(data []byte, paths []string) ([]byte, *outputFilterRule) {
+	for _, path := range paths {
+		original := gjson.GetBytes(data, path).String()
+		filtered, blocked := w.text.filter(original)
+		if blocked != nil {
+			return data, blocked
+		}
+		if filtered != original {
+			data, _ = sjson.SetBytes(data, path, filtered)
+		}
+	}
+	return data, nil
+}
+
+func (w *outputFilterSSEWrapper) filterGeminiEvent(payload []byte) ([]sseEvent, *outputFilterRule) {
+	candidates := gjson.GetBytes(payload, "candidates")
+	if !candidates.IsArray() {
+		return nil, nil
+	}
+	data := payload
+	changed := false
+	var blocked *outputFilterRule
+	candidates.ForEach(func(i, cand gjson.Result) bool {
+		key := cand.Get("index").String()
+		lastText := ""
+		cand.Get("content.parts").ForEach(func(j, part gjson.Result) bool {
+			if part.Get("text").Type != gjson.String || part.Get("thought").Bool() {
+				return true
+			}
+			lastText = fmt.Sprintf("candidates.%d.content.parts.%d.text", i.Int(), j.Int())
+			var emit string
+			if emit, blocked = w.text.push(key, part.Get("text").String()); blocked != nil {
+				return false
+			}
+			data, _ = sjson.SetBytes(data, lastText, emit)
+			changed = true
+			return true
+		})
+		if blocked != nil {
+			return false
+		}
+		if fr := cand.Get("finishReason"); fr.Exists() && fr.String() != "" {
+			rest, b := w.text.flush(key)
+			if blocked = b; blocked != nil {
+				return false
+			}
+			if rest != "" {
+				if lastText != "" {
+					data, _ = sjson.SetBytes(data, lastText, gjson.GetBytes(data, lastText).String()+rest)
+				} else {
+					data, _ = sjson.SetBytes(data, fmt.Sprintf("candidates.%d.content.parts.-1", i.Int()), map[string]string{"text": rest})
+				}
+				changed = true
+			}
+		}
+		return true
+	})
+	if blocked != nil || !changed {
+		return nil, blocked
+	}
+	return []sseEvent{{data: data}}, nil
+}
+
+// flushPending 流结束时补发所有未结束内容块的剩余文本
+func (w *outputFilterSSEWrapper) flushPending() []sseEvent {
+	var events []sseEvent
+	for _, key := range w.text.pendingKeys() {
+		rest, blocked := w.text.flush(key)
+		if blocked != nil {
+			w.block(blocked)
+			return nil
+		}
+		if rest == "" {
+			continue
+		}
+		switch w.format {
+		case translator.FormatClaude:
+			events = append(events, claudeTextDeltaEvent(key, rest))
+		case translator.FormatOpenAIResponses:
+			itemID, contentIndex, _ := strings.Cut(key, ":")
+			idx, _ := strconv.Atoi(contentIndex)
+			w.seqOffset++
+			data, _ := json.Marshal(map[string]interface{}{
+				"type":            "response.output_text.delta",
+				"item_id":         itemID,
+				"content_index":   idx,
+				"delta":           rest,
+				"sequence_number": w.lastSeq + w.seqOffset,
+			})
+			events = append(events, sseEvent{name: "response.output_text.delta", data: data})
+		case translator.FormatGemini:
+			idx, _ := strconv.Atoi(key)
+			data, _ := json.Marshal(map[string]interface{}{
+				"candidates": []interface{}{map[string]interface{}{
+					"index":   idx,
+					"content": map[string]interface{}{"role": "model", "parts": []interface{}{map[string]string{"text": rest}}},
+				}},
+			})
+			events = append(events, sseEvent{data: data})
+		default:
+			idx, _ := strconv.Atoi(key)
+			data, _ := json.Marshal(map[string]interface{}{
+				"object":  "chat.completion.chunk",
+				"choices": []interface{}{map[string]interface{}{"index": idx, "delta": map[string]string{"content": rest}}},
+			})
+			events = append(events, sseEvent{data: data})
+		}
+	}
+	return events
+}
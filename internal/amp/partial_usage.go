@@ -0,0 +1,97 @@
+package amp
+
+import (
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// 流中断时记录的错误类型
+const (
+	// StreamErrorClientAborted 客户端在流结束前断开
+	StreamErrorClientAborted = "client_aborted"
+	// StreamErrorIncomplete 上游在结束事件之前关闭了流
+	StreamErrorIncomplete = "stream_incomplete"
+)
+
+// streamDeltaContent 提取 SSE 事件中新生成的输出内容（文本、思考过程、工具调用参数），
+// 并返回该事件是否表示流已正常结束。OpenAI Chat 的 [DONE] 由调用方处理
+func streamDeltaContent(provider ProviderKind, eventName string, data []byte) (string, bool) {
+	switch provider {
+	case ProviderOpenAIChat:
+		var b strings.Builder
+		gjson.GetBytes(data, "choices").ForEach(func(_, choice gjson.Result) bool {
+			delta := choice.Get("delta")
+			b.WriteString(delta.Get("content").String())
+			b.WriteString(delta.Get("reasoning_content").String())
+			delta.Get("tool_calls").ForEach(func(_, call gjson.Result) bool {
+				b.WriteString(call.Get("function.arguments").String())
+				return true
+			})
+			return true
+		})
+		return b.String(), false
+
+	case ProviderOpenAIResponses:
+		eventType := gjson.GetBytes(data, "type").String()
+		if eventType == "" {
+			eventType = eventName
+		}
+		switch eventType {
+		case "response.output_text.delta", "response.reasoning_text.delta",
+			"response.reasoning_summary_text.delta", "response.function_call_arguments.delta":
+			return gjson.GetBytes(data, "delta").String(), false
+		case "response.completed", "response.incomplete", "response.failed", "response.done":
+			return "", true
+		}
+		return "", false
+
+	case ProviderGemini:
+		var b strings.Builder
+		finished := false
+		gjson.GetBytes(data, "candidates").ForEach(func(_, candidate gjson.Result) bool {
+			candidate.Get("content.parts").ForEach(func(_, part gjson.Result) bool {
+				b.WriteString(part.Get("text").String())
+				if args := part.Get("functionCall.args"); args.Exists() {
+					b.WriteString(args.Raw)
+				}
+				return true
+			})
+			if candidate.Get("finishReason").String() != "" {
+				finished = true
+			}
+			return true
+		})
+		return b.String(), finished
+
+	case ProviderOllama:
+		chunk := gjson.ParseBytes(data)
+		return ollamaOutputContent(chunk), chunk.Get("done").Bool()
+
+	case ProviderOpenAIAudio:
+		switch gjson.GetBytes(data, "type").String() {
+		case "transcript.text.delta":
+			return gjson.GetBytes(data, "delta").String(), false
+		case "transcript.text.done", "speech.audio.done":
+			return "", true
+		}
+		return "", false
+
+	default:
+		switch gjson.GetBytes(data, "type").String() {
+		case "content_block_delta":
+			delta := gjson.GetBytes(data, "delta")
+			switch delta.Get("type").String() {
+			case "text_delta":
+				return delta.Get("text").String(), false
+			case "thinking_delta":
+				return delta.Get("thinking").String(), false
+			case "input_json_delta":
+				return delta.Get("partial_json").String(), false
+			}
+		case "message_stop":
+			return "", true
+		}
+		return "", false
+	}
+}
@@ -0,0 +1,121 @@
+package amp
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readSSE(t *testing.T, info ProviderInfo, trace *RequestTrace, stream string) {
+	t.Helper()
+	extractor := NewSSETokenExtractor(io.NopCloser(strings.NewReader(stream)), trace, info)
+	if _, err := io.ReadAll(extractor); err != nil {
+		t.Fatal(err)
+	}
+	extractor.Close()
+}
+
+const anthropicStreamStart = "event: message_start\n" +
+	`data: {"type":"message_start","message":{"usage":{"input_tokens":120,"cache_read_input_tokens":30,"output_tokens":1}}}` + "\n\n" +
+	"event: content_block_delta\n" +
+	`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello there, friend"}}` + "\n\n" +
+	"event: content_block_delta\n" +
+	`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"你好"}}` + "\n\n"
+
+func TestSSETokenExtractor_AnthropicAbortedKeepsInputAndEstimatesOutput(t *testing.T) {
+	trace := NewRequestTrace("req", "u", "k", "POST", "/v1/messages")
+	readSSE(t, ProviderInfo{Provider: ProviderAnthropic}, trace, anthropicStreamStart)
+
+	snapshot := trace.Clone()
+	if !trace.StreamIncomplete() {
+		t.Fatal("stream without message_delta should be marked incomplete")
+	}
+	if ptrToInt(snapshot.InputTokens) != 120 || ptrToInt(snapshot.CacheReadInputTokens) != 30 {
+		t.Fatalf("input usage from message_start should be kept, got input=%d cacheRead=%d", ptrToInt(snapshot.InputTokens), ptrToInt(snapshot.CacheReadInputTokens))
+	}
+	// "Hello there, friend" = 19 ASCII chars -> 6 tokens at 3.5 chars/token for Claude, plus 2 CJK runes
+	if ptrToInt(snapshot.OutputTokens) != 8 {
+		t.Fatalf("expected estimated output 8, got %d", ptrToInt(snapshot.OutputTokens))
+	}
+	if !snapshot.UsageEstimated {
+		t.Fatal("estimated output must flag the usage as estimated")
+	}
+}
+
+func TestSSETokenExtractor_AnthropicCompleteUsesReportedUsage(t *testing.T) {
+	trace := NewRequestTrace("req", "u", "k", "POST", "/v1/messages")
+	stream := anthropicStreamStart +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","usage":{"output_tokens":42}}` + "\n\n" +
+		"event: message_stop\n" +
+		`data: {"type":"message_stop"}` + "\n\n"
+	readSSE(t, ProviderInfo{Provider: ProviderAnthropic}, trace, stream)
+
+	if trace.StreamIncomplete() {
+		t.Fatal("complete stream must not be marked incomplete")
+	}
+	if got := ptrToInt(trace.Clone().OutputTokens); got != 42 {
+		t.Fatalf("expected reported output 42, got %d", got)
+	}
+}
+
+func TestSSETokenExtractor_OpenAIChat(t *testing.T) {
+	chunks := `data: {"choices":[{"index":0,"delta":{"content":"abcdefgh"}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"q\":1}"}}]}}]}` + "\n\n"
+
+	aborted := NewRequestTrace("req", "u", "k", "POST", "/v1/chat/completions")
+	readSSE(t, ProviderInfo{Provider: ProviderOpenAIChat}, aborted, chunks)
+	if !aborted.StreamIncomplete() || ptrToInt(aborted.Clone().OutputTokens) != 4 {
+		t.Fatalf("aborted chat stream should estimate 4 output tokens, got %d", ptrToInt(aborted.Clone().OutputTokens))
+	}
+
+	done := NewRequestTrace("req", "u", "k", "POST", "/v1/chat/completions")
+	readSSE(t, ProviderInfo{Provider: ProviderOpenAIChat}, done, chunks+"data: [DONE]\n\n")
+	if done.StreamIncomplete() || done.Clone().OutputTokens != nil {
+		t.Fatal("stream ending with [DONE] must not be estimated")
+	}
+}
+
+func TestSSETokenExtractor_GeminiKeepsLastUsageChunk(t *testing.T) {
+	trace := NewRequestTrace("req", "u", "k", "POST", "/v1beta/models/x:streamGenerateContent")
+	stream := `data: {"candidates":[{"content":{"parts":[{"text":"a long piece of streamed text"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":3}}` + "\n\n"
+	readSSE(t, ProviderInfo{Provider: ProviderGemini}, trace, stream)
+
+	if !trace.StreamIncomplete() {
+		t.Fatal("stream without finishReason should be marked incomplete")
+	}
+	if got := ptrToInt(trace.Clone().OutputTokens); got != 3 {
+		t.Fatalf("last usageMetadata should win over the estimate, got %d", got)
+	}
+}
+
+func TestLoggingBodyWrapper_ClassifiesIncompleteStreams(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tc := range []struct {
+		ctx  context.Context
+		want string
+	}{
+		{canceled, StreamErrorClientAborted},
+		{context.Background(), StreamErrorIncomplete},
+	} {
+		trace := NewRequestTrace("", "u", "k", "POST", "/v1/messages")
+		extractor := NewSSETokenExtractor(io.NopCloser(strings.NewReader(anthropicStreamStart)), trace, ProviderInfo{Provider: ProviderAnthropic})
+		wrapper := NewLoggingBodyWrapper(extractor, trace, 200, tc.ctx)
+		io.ReadAll(wrapper)
+		wrapper.Close()
+		if got := trace.Clone().ErrorType; got != tc.want {
+			t.Errorf("expected error type %q, got %q", tc.want, got)
+		}
+	}
+
+	trace := NewRequestTrace("", "u", "k", "POST", "/v1/messages")
+	trace.SetError("stream_timeout")
+	extractor := NewSSETokenExtractor(io.NopCloser(strings.NewReader(anthropicStreamStart)), trace, ProviderInfo{Provider: ProviderAnthropic})
+	NewLoggingBodyWrapper(extractor, trace, 200, canceled).Close()
+	if got := trace.Clone().ErrorType; got != "stream_timeout" {
+		t.Fatalf("existing error type should be kept, got %q", got)
+	}
+}
@@ -2,28 +2,131 @@ package amp
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
+	"ampmanager/internal/billing"
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// PendingErrorTimeoutCleanup 自动清理超时 pending 记录时写入的错误类型
+	PendingErrorTimeoutCleanup = "timeout_cleanup"
+	// PendingErrorForceFinalized 管理员强制结束 pending 记录时写入的错误类型
+	PendingErrorForceFinalized = "force_finalized"
+
+	pendingCleanupBatchSize = 500
+)
+
+// PendingCleanerConfig pending 清理器配置
+type PendingCleanerConfig struct {
+	Enabled         bool
+	Interval        time.Duration
+	Timeout         time.Duration
+	SettleOnCleanup bool
+}
+
+// DefaultPendingCleanerConfig 默认 pending 清理配置
+func DefaultPendingCleanerConfig() *PendingCleanerConfig {
+	return &PendingCleanerConfig{
+		Enabled:         true,
+		Interval:        5 * time.Minute,
+		Timeout:         10 * time.Minute,
+		SettleOnCleanup: false,
+	}
+}
+
+var (
+	pendingCleanerConfig   = DefaultPendingCleanerConfig()
+	pendingCleanerConfigMu sync.RWMutex
+)
+
+// GetPendingCleanerConfig 获取当前 pending 清理配置
+func GetPendingCleanerConfig() *PendingCleanerConfig {
+	pendingCleanerConfigMu.RLock()
+	defer pendingCleanerConfigMu.RUnlock()
+	cfg := *pendingCleanerConfig
+	return &cfg
+}
+
+// UpdatePendingCleanerConfig 动态更新 pending 清理配置，运行中的清理器会重置扫描间隔
+func UpdatePendingCleanerConfig(cfg *PendingCleanerConfig) {
+	if cfg == nil {
+		return
+	}
+	pendingCleanerConfigMu.Lock()
+	copied := *cfg
+	pendingCleanerConfig = &copied
+	pendingCleanerConfigMu.Unlock()
+
+	if globalPendingCleaner != nil {
+		globalPendingCleaner.notifyReload()
+	}
+	log.Infof("pending cleaner: config updated (enabled=%v, interval=%v, timeout=%v, settle=%v)",
+		cfg.Enabled, cfg.Interval, cfg.Timeout, cfg.SettleOnCleanup)
+}
+
+// InitPendingCleanerConfig 从数据库 JSON 加载 pending 清理配置
+func InitPendingCleanerConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+
+	var cfg model.PendingCleanerConfigResponse
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("pending cleaner: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+
+	UpdatePendingCleanerConfig(&PendingCleanerConfig{
+		Enabled:         cfg.Enabled,
+		Interval:        time.Duration(cfg.IntervalSec) * time.Second,
+		Timeout:         time.Duration(cfg.TimeoutSec) * time.Second,
+		SettleOnCleanup: cfg.SettleOnCleanup,
+	})
+}
+
+// inflightTraces 保存已写入 pending 记录、尚未完成的请求追踪
+// 强制结束时可以从中取得已捕获的用量
+var inflightTraces sync.Map
+
+func registerInflightTrace(trace *RequestTrace) {
+	inflightTraces.Store(trace.RequestID, trace)
+}
+
+func unregisterInflightTrace(requestID string) {
+	inflightTraces.Delete(requestID)
+}
+
+func takeInflightTrace(requestID string) *RequestTrace {
+	if val, ok := inflightTraces.LoadAndDelete(requestID); ok {
+		if trace, ok := val.(*RequestTrace); ok {
+			return trace
+		}
+	}
+	return nil
+}
+
 // PendingCleaner 定期清理超时的 pending 请求记录
 type PendingCleaner struct {
-	db       *sql.DB
-	interval time.Duration
-	timeout  time.Duration
-	stopChan chan struct{}
-	wg       sync.WaitGroup
+	db         *sql.DB
+	reloadChan chan struct{}
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
 }
 
 // NewPendingCleaner 创建 pending 记录清理器
 func NewPendingCleaner(db *sql.DB) *PendingCleaner {
 	return &PendingCleaner{
-		db:       db,
-		interval: 5 * time.Minute,
-		timeout:  10 * time.Minute,
-		stopChan: make(chan struct{}),
+		db:         db,
+		reloadChan: make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
 	}
 }
 
@@ -35,13 +138,20 @@ func (c *PendingCleaner) Start() {
 
 // Stop 优雅停止清理器
 func (c *PendingCleaner) Stop() {
-	close(c.stopChan)
+	c.stopOnce.Do(func() { close(c.stopChan) })
 	c.wg.Wait()
 }
 
+func (c *PendingCleaner) notifyReload() {
+	select {
+	case c.reloadChan <- struct{}{}:
+	default:
+	}
+}
+
 func (c *PendingCleaner) run() {
 	defer c.wg.Done()
-	ticker := time.NewTicker(c.interval)
+	ticker := time.NewTicker(normalizeCleanerInterval(GetPendingCleanerConfig().Interval))
 	defer ticker.Stop()
 
 	c.cleanup()
@@ -50,30 +160,232 @@ func (c *PendingCleaner) run() {
 		select {
 		case <-ticker.C:
 			c.cleanup()
+		case <-c.reloadChan:
+			ticker.Reset(normalizeCleanerInterval(GetPendingCleanerConfig().Interval))
 		case <-c.stopChan:
 			return
 		}
 	}
 }
 
+func normalizeCleanerInterval(interval time.Duration) time.Duration {
+	if interval < time.Second {
+		return time.Second
+	}
+	return interval
+}
+
 func (c *PendingCleaner) cleanup() {
-	cutoff := time.Now().UTC().Add(-c.timeout)
-	result, err := c.db.Exec(`
-		UPDATE request_logs 
-		SET status = 'error', 
-			error_type = 'timeout_cleanup',
-			updated_at = CURRENT_TIMESTAMP
-		WHERE status = 'pending' AND created_at < ?
-	`, cutoff.UTC())
+	cfg := GetPendingCleanerConfig()
+	if !cfg.Enabled || cfg.Timeout <= 0 {
+		return
+	}
 
+	cutoff := time.Now().UTC().Add(-cfg.Timeout)
+	rows, err := c.db.Query(`
+		SELECT id FROM request_logs
+		WHERE status = 'pending' AND created_at < ?
+		ORDER BY created_at ASC
+		LIMIT ?
+	`, cutoff.UTC(), pendingCleanupBatchSize)
 	if err != nil {
 		log.Errorf("pending cleaner: cleanup failed: %v", err)
 		return
 	}
 
-	if rows, _ := result.RowsAffected(); rows > 0 {
-		log.Infof("pending cleaner: cleaned up %d stale pending requests", rows)
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Errorf("pending cleaner: cleanup failed: %v", err)
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	var cleaned int
+	for _, id := range ids {
+		if result := finalizePending(c.db, id, PendingErrorTimeoutCleanup, cfg.SettleOnCleanup); result.Finalized {
+			cleaned++
+		}
+	}
+
+	if cleaned > 0 {
+		log.Infof("pending cleaner: cleaned up %d stale pending requests", cleaned)
+	}
+}
+
+// ForceFinalizePending 强制结束指定的 pending 记录，并按已捕获的用量结算
+func ForceFinalizePending(db *sql.DB, ids []string) []model.FinalizePendingResult {
+	results := make([]model.FinalizePendingResult, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, finalizePending(db, id, PendingErrorForceFinalized, true))
+	}
+	return results
+}
+
+// finalizePending 将单条 pending 记录标记为失败，计算成本并（可选）结算
+// 用量优先取内存中的请求追踪，其次取数据库中已写入的值
+func finalizePending(db *sql.DB, id, errorType string, settle bool) model.FinalizePendingResult {
+	result := model.FinalizePendingResult{ID: id}
+
+	var userID, status string
+	var createdAt time.Time
+	var originalModel, mappedModel sql.NullString
+	var inputTokens, outputTokens, cacheRead, cacheCreation sql.NullInt64
+	err := db.QueryRow(`
+		SELECT user_id, status, created_at, original_model, mapped_model,
+		       input_tokens, output_tokens, cache_read_input_tokens, cache_creation_input_tokens
+		FROM request_logs WHERE id = ?
+	`, id).Scan(&userID, &status, &createdAt, &originalModel, &mappedModel,
+		&inputTokens, &outputTokens, &cacheRead, &cacheCreation)
+	if err == sql.ErrNoRows {
+		result.Error = "记录不存在"
+		return result
+	}
+	if err != nil {
+		result.Error = "查询记录失败"
+		log.Errorf("pending cleaner: query %s failed: %v", id, err)
+		return result
+	}
+	if status != string(LogEntryStatusPending) {
+		result.Error = "记录不是 pending 状态"
+		return result
+	}
+
+	usageInput := nullIntPtr(inputTokens)
+	usageOutput := nullIntPtr(outputTokens)
+	usageCacheRead := nullIntPtr(cacheRead)
+	usageCacheCreation := nullIntPtr(cacheCreation)
+	usageEstimated := 0
+	pricingModel := mappedModel.String
+	if pricingModel == "" {
+		pricingModel = originalModel.String
+	}
+
+	if trace := takeInflightTrace(id); trace != nil {
+		trace.MarkFinalized()
+		snapshot := trace.Clone()
+		if snapshot.InputTokens != nil {
+			usageInput = snapshot.InputTokens
+		}
+		if snapshot.OutputTokens != nil {
+			usageOutput = snapshot.OutputTokens
+		} else if usageOutput == nil && snapshot.EstimatedOutputTokens > 0 {
+			// 流式响应尚未收到输出用量时，按已转发内容估算；已开始输出说明上游已处理输入，输入用量同样可用估算值
+			estimated := snapshot.EstimatedOutputTokens
+			usageOutput = &estimated
+			usageEstimated = 1
+			if usageInput == nil && snapshot.EstimatedInputTokens > 0 {
+				estimatedInput := snapshot.EstimatedInputTokens
+				usageInput = &estimatedInput
+			}
+		}
+		if snapshot.CacheReadInputTokens != nil {
+			usageCacheRead = snapshot.CacheReadInputTokens
+		}
+		if snapshot.CacheCreationInputTokens != nil {
+			usageCacheCreation = snapshot.CacheCreationInputTokens
+		}
+		if snapshot.MappedModel != "" {
+			pricingModel = snapshot.MappedModel
+		} else if snapshot.OriginalModel != "" {
+			pricingModel = snapshot.OriginalModel
+		}
+	}
+
+	multiplier := 1.0
+	if userID != "" {
+		if m, _, err := groupRepo.GetMinRateMultiplierByUserID(userID); err == nil {
+			multiplier = m
+		}
+	}
+
+	var costMicros *int64
+	var costUsd, costPricingModel *string
+	if calc := billing.GetCostCalculator(); calc != nil && pricingModel != "" {
+		costResult := calc.CalculateFromPointers(pricingModel, usageInput, usageOutput, usageCacheRead, usageCacheCreation)
+		if costResult.PriceFound {
+			adjusted := costResult.CostMicros
+			usd := costResult.CostUsd
+			if multiplier != 0 {
+				adjusted = int64(float64(costResult.CostMicros) * multiplier)
+				usd = fmt.Sprintf("%.6f", float64(adjusted)/1e6)
+			}
+			costMicros = &adjusted
+			costUsd = &usd
+			costPricingModel = &costResult.PricingModel
+		}
+	}
+
+	now := time.Now().UTC()
+	updateResult, err := db.Exec(`
+		UPDATE request_logs SET
+			status = ?,
+			error_type = ?,
+			updated_at = ?,
+			latency_ms = ?,
+			input_tokens = ?,
+			output_tokens = ?,
+			cache_read_input_tokens = ?,
+			cache_creation_input_tokens = ?,
+			usage_estimated = ?,
+			cost_micros = COALESCE(?, cost_micros),
+			cost_usd = COALESCE(?, cost_usd),
+			pricing_model = COALESCE(?, pricing_model),
+			rate_multiplier = ?
+		WHERE id = ? AND status = ?
+	`,
+		LogEntryStatusError,
+		errorType,
+		now,
+		now.Sub(createdAt.UTC()).Milliseconds(),
+		usageInput,
+		usageOutput,
+		usageCacheRead,
+		usageCacheCreation,
+		usageEstimated,
+		costMicros,
+		costUsd,
+		costPricingModel,
+		multiplier,
+		id,
+		LogEntryStatusPending,
+	)
+	if err != nil {
+		result.Error = "更新记录失败"
+		log.Errorf("pending cleaner: finalize %s failed: %v", id, err)
+		return result
+	}
+	if affected, _ := updateResult.RowsAffected(); affected == 0 {
+		result.Error = "记录已结束"
+		return result
+	}
+	result.Finalized = true
+	if costMicros != nil {
+		result.CostMicros = *costMicros
+	}
+
+	// 与正常完成路径一致：倍率为 0 表示免费，不结算
+	if settle && userID != "" && multiplier != 0 && result.CostMicros > 0 {
+		if err := service.NewBillingService().SettleRequestCost(id, userID, result.CostMicros); err != nil {
+			log.Warnf("pending cleaner: failed to settle cost for %s: %v", id, err)
+		} else {
+			result.Settled = true
+		}
+	}
+
+	return result
+}
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
 	}
+	i := int(v.Int64)
+	return &i
 }
 
 var globalPendingCleaner *PendingCleaner
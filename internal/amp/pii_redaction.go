@@ -0,0 +1,401 @@
+package amp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	piiTypeEmail      = "email"
+	piiTypePhone      = "phone"
+	piiTypeCreditCard = "credit_card"
+)
+
+var (
+	piiEmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// piiPhonePattern 带 + 国际区号的号码、北美格式 (555) 123-4567 / 555-123-4567 与中国大陆手机号；
+	// 不带分隔符的普通数字串不视为电话号码，避免误伤 ID 与时间戳
+	piiPhonePattern = regexp.MustCompile(`\+\d{1,3}[ .-]?(?:\(\d{1,4}\)[ .-]?)?\d{1,4}(?:[ .-]?\d{2,4}){1,4}|\(\d{3}\) ?\d{3}[ .-]\d{4}|\b\d{3}[.-]\d{3}[.-]\d{4}\b|\b1[3-9]\d{9}\b`)
+	// piiCreditCardPattern 13-19 位数字（可用空格或 - 分组），另需通过 Luhn 校验
+	piiCreditCardPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	piiTokenLabelInvalid = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+// piiMatcher 一类敏感内容的识别规则
+type piiMatcher struct {
+	kind  string
+	label string // 占位符前缀，如 EMAIL
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+// piiRedactor 编译后的转发前脱敏规则，按顺序匹配，先匹配的规则优先
+type piiRedactor struct {
+	matchers []piiMatcher
+}
+
+var piiRedactionState struct {
+	mu       sync.RWMutex
+	config   model.PIIRedactionConfig
+	redactor *piiRedactor
+}
+
+func init() {
+	cfg := DefaultPIIRedactionConfig()
+	redactor, _ := compilePIIRedactor(cfg)
+	piiRedactionState.config = cfg
+	piiRedactionState.redactor = redactor
+}
+
+// DefaultPIIRedactionConfig 默认不启用；启用后识别邮箱、电话号码与银行卡号
+func DefaultPIIRedactionConfig() model.PIIRedactionConfig {
+	return NormalizePIIRedactionConfig(model.PIIRedactionConfig{
+		Email:      true,
+		Phone:      true,
+		CreditCard: true,
+	})
+}
+
+// NormalizePIIRedactionConfig 填充未设置的规则名
+func NormalizePIIRedactionConfig(cfg model.PIIRedactionConfig) model.PIIRedactionConfig {
+	if cfg.Patterns == nil {
+		cfg.Patterns = []model.DetailRedactionPattern{}
+	}
+	for i := range cfg.Patterns {
+		cfg.Patterns[i].Name = strings.TrimSpace(cfg.Patterns[i].Name)
+		if piiTokenLabel(cfg.Patterns[i].Name) == "" {
+			cfg.Patterns[i].Name = fmt.Sprintf("custom%d", i+1)
+		}
+	}
+	return cfg
+}
+
+// ValidatePIIRedactionConfig 校验转发前脱敏配置（需先 Normalize）
+func ValidatePIIRedactionConfig(cfg model.PIIRedactionConfig) error {
+	if len(cfg.Patterns) > maxDetailRedactionRules {
+		return fmt.Errorf("规则数不能超过 %d", maxDetailRedactionRules)
+	}
+	_, err := compilePIIRedactor(cfg)
+	return err
+}
+
+func compilePIIRedactor(cfg model.PIIRedactionConfig) (*piiRedactor, error) {
+	r := &piiRedactor{}
+	if cfg.Email {
+		r.matchers = append(r.matchers, piiMatcher{kind: piiTypeEmail, label: "EMAIL", re: piiEmailPattern})
+	}
+	// 银行卡号先于电话号码匹配，分组书写的卡号不会被识别为电话号码
+	if cfg.CreditCard {
+		r.matchers = append(r.matchers, piiMatcher{kind: piiTypeCreditCard, label: "CREDIT_CARD", re: piiCreditCardPattern, valid: luhnValid})
+	}
+	if cfg.Phone {
+		r.matchers = append(r.matchers, piiMatcher{kind: piiTypePhone, label: "PHONE", re: piiPhonePattern, valid: phoneDigitsValid})
+	}
+	for _, p := range cfg.Patterns {
+		if p.Pattern == "" {
+			return nil, fmt.Errorf("规则 %s 的 pattern 不能为空", p.Name)
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("规则 %s 的正则无效: %v", p.Name, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("规则 %s 的正则不能匹配空字符串", p.Name)
+		}
+		r.matchers = append(r.matchers, piiMatcher{kind: p.Name, label: piiTokenLabel(p.Name), re: re})
+	}
+	return r, nil
+}
+
+// piiTokenLabel 规则名转为占位符前缀：大写，非字母数字替换为下划线
+func piiTokenLabel(name string) string {
+	return strings.Trim(piiTokenLabelInvalid.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+}
+
+// luhnValid 校验银行卡号的 Luhn 校验位
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// phoneDigitsValid 电话号码的数字位数需在 7 到 15 位之间（E.164 最长 15 位）
+func phoneDigitsValid(s string) bool {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n++
+		}
+	}
+	return n >= 7 && n <= 15
+}
+
+// InitPIIRedactionConfig 从数据库 JSON 加载转发前脱敏配置
+func InitPIIRedactionConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.PIIRedactionConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("pii redaction: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizePIIRedactionConfig(cfg)
+	if err := ValidatePIIRedactionConfig(cfg); err != nil {
+		log.Warnf("pii redaction: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdatePIIRedactionConfig(cfg)
+}
+
+// UpdatePIIRedactionConfig 更新转发前脱敏配置，对之后的请求立即生效（需先校验）
+func UpdatePIIRedactionConfig(cfg model.PIIRedactionConfig) {
+	cfg = NormalizePIIRedactionConfig(cfg)
+	redactor, err := compilePIIRedactor(cfg)
+	if err != nil {
+		log.Errorf("pii redaction: 编译规则失败: %v", err)
+		return
+	}
+	piiRedactionState.mu.Lock()
+	piiRedactionState.config = cfg
+	piiRedactionState.redactor = redactor
+	piiRedactionState.mu.Unlock()
+}
+
+// GetPIIRedactionConfig 返回当前转发前脱敏配置
+func GetPIIRedactionConfig() model.PIIRedactionConfig {
+	piiRedactionState.mu.RLock()
+	defer piiRedactionState.mu.RUnlock()
+	return piiRedactionState.config
+}
+
+// currentPIIRedactor 未启用或没有任何规则时返回 nil
+func currentPIIRedactor() *piiRedactor {
+	piiRedactionState.mu.RLock()
+	defer piiRedactionState.mu.RUnlock()
+	if !piiRedactionState.config.Enabled || piiRedactionState.redactor == nil || len(piiRedactionState.redactor.matchers) == 0 {
+		return nil
+	}
+	return piiRedactionState.redactor
+}
+
+// piiRedaction 单个请求的脱敏状态：相同的值在整个请求中使用同一占位符，多轮对话的历史消息每次得到相同的占位符
+type piiRedaction struct {
+	redactor *piiRedactor
+	tokens   map[string]string // 类型 + 原始值 -> 占位符
+	next     map[string]int    // 占位符前缀 -> 已分配数量
+	items    []model.PIIRedactionItem
+	index    map[string]int // 占位符 -> items 下标
+}
+
+func (r *piiRedactor) newRedaction() *piiRedaction {
+	return &piiRedaction{
+		redactor: r,
+		tokens:   make(map[string]string),
+		next:     make(map[string]int),
+		index:    make(map[string]int),
+	}
+}
+
+type piiSpan struct {
+	start, end int
+	matcher    *piiMatcher
+}
+
+// redactText 替换文本中的敏感内容；各规则的匹配区间重叠时保留先匹配的规则
+func (p *piiRedaction) redactText(s string) (string, bool) {
+	var spans []piiSpan
+	for i := range p.redactor.matchers {
+		m := &p.redactor.matchers[i]
+		for _, loc := range m.re.FindAllStringIndex(s, -1) {
+			if m.valid != nil && !m.valid(s[loc[0]:loc[1]]) {
+				continue
+			}
+			overlaps := false
+			for _, span := range spans {
+				if loc[0] < span.end && span.start < loc[1] {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				spans = append(spans, piiSpan{start: loc[0], end: loc[1], matcher: m})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return s, false
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		b.WriteString(s[last:span.start])
+		b.WriteString(p.token(span.matcher, s[span.start:span.end]))
+		last = span.end
+	}
+	b.WriteString(s[last:])
+	return b.String(), true
+}
+
+func (p *piiRedaction) token(m *piiMatcher, value string) string {
+	key := m.kind + "\x00" + value
+	token, ok := p.tokens[key]
+	if !ok {
+		p.next[m.label]++
+		token = fmt.Sprintf("[%s_%d]", m.label, p.next[m.label])
+		p.tokens[key] = token
+		p.index[token] = len(p.items)
+		p.items = append(p.items, model.PIIRedactionItem{Type: m.kind, Token: token})
+	}
+	p.items[p.index[token]].Count++
+	return token
+}
+
+// redactRequestBody 替换请求中所有用户消息文本里的敏感内容，返回新的请求体与脱敏报告；没有替换时报告为空
+func (r *piiRedactor) redactRequestBody(format translator.Format, body []byte) ([]byte, []model.PIIRedactionItem) {
+	p := r.newRedaction()
+	for _, path := range piiUserTextPaths(format, gjson.ParseBytes(body)) {
+		redacted, changed := p.redactText(gjson.GetBytes(body, path).String())
+		if !changed {
+			continue
+		}
+		updated, err := sjson.SetBytes(body, path, redacted)
+		if err != nil {
+			log.Debugf("pii redaction: failed to set %s: %v", path, err)
+			continue
+		}
+		body = updated
+	}
+	return body, p.items
+}
+
+// piiUserTextPaths 按请求格式列出所有用户消息中文本的 JSON 路径（按消息顺序）。
+// Claude 与 OpenAI Chat 为 messages 中 role=user 的字符串内容或 text 块，
+// Responses 为字符串 input 或 role=user 条目的字符串内容与 input_text 块，Gemini 为 role=user 的 contents 中的 text part
+func piiUserTextPaths(format translator.Format, root gjson.Result) []string {
+	var paths []string
+	switch format {
+	case translator.FormatGemini:
+		root.Get("contents").ForEach(func(i, content gjson.Result) bool {
+			if role := content.Get("role").String(); role != "" && role != "user" {
+				return true
+			}
+			content.Get("parts").ForEach(func(j, part gjson.Result) bool {
+				if part.Get("text").Type == gjson.String {
+					paths = append(paths, fmt.Sprintf("contents.%d.parts.%d.text", i.Int(), j.Int()))
+				}
+				return true
+			})
+			return true
+		})
+	case translator.FormatOpenAIResponses:
+		input := root.Get("input")
+		if input.Type == gjson.String {
+			return []string{"input"}
+		}
+		paths = userMessageTextPaths(input, "input", "input_text")
+	default:
+		paths = userMessageTextPaths(root.Get("messages"), "messages", "text")
+	}
+	return paths
+}
+
+// userMessageTextPaths role=user 的消息中，content 为字符串或 type 为 partType 的内容块的文本路径
+func userMessageTextPaths(messages gjson.Result, prefix, partType string) []string {
+	var paths []string
+	messages.ForEach(func(i, msg gjson.Result) bool {
+		if msg.Get("role").String() != "user" {
+			return true
+		}
+		content := msg.Get("content")
+		if content.Type == gjson.String {
+			paths = append(paths, fmt.Sprintf("%s.%d.content", prefix, i.Int()))
+			return true
+		}
+		content.ForEach(func(j, block gjson.Result) bool {
+			if block.Get("type").String() == partType && block.Get("text").Type == gjson.String {
+				paths = append(paths, fmt.Sprintf("%s.%d.content.%d.text", prefix, i.Int(), j.Int()))
+			}
+			return true
+		})
+		return true
+	})
+	return paths
+}
+
+type piiRedactionsKey struct{}
+
+// GetPIIRedactions 返回本次请求的转发前脱敏报告，未脱敏时为空
+func GetPIIRedactions(ctx context.Context) []model.PIIRedactionItem {
+	items, _ := ctx.Value(piiRedactionsKey{}).([]model.PIIRedactionItem)
+	return items
+}
+
+// PIIRedactionMiddleware 在请求离开代理前替换用户消息中的邮箱、电话号码、银行卡号与自定义正则匹配的内容，
+// 支持 Claude Messages、OpenAI Chat/Responses 与 Gemini 请求；原生模式同样生效。
+// 每类内容替换为带序号的占位符（如 [EMAIL_1]），脱敏报告记录到请求详情。需在请求流水线之前执行
+func PIIRedactionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		redactor := currentPIIRedactor()
+		if redactor == nil {
+			c.Next()
+			return
+		}
+		path := c.Request.URL.Path
+		isCount := isTokenCountPath(path)
+		if !isCount && !IsModelInvocation(c.Request.Method, path) {
+			c.Next()
+			return
+		}
+
+		bodyBytes := readJSONRequestBody(c.Request, maxRequestBodySize)
+		if bodyBytes == nil || !gjson.ValidBytes(bodyBytes) {
+			c.Next()
+			return
+		}
+		newBody, items := redactor.redactRequestBody(detectIncomingFormat(path), bodyBytes)
+		if len(items) == 0 {
+			c.Next()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(newBody))
+		c.Request.ContentLength = int64(len(newBody))
+		// token 计数同样脱敏，但不记录报告
+		if !isCount {
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), piiRedactionsKey{}, items))
+		}
+		log.Debugf("pii redaction: replaced %d value(s) in %s", len(items), path)
+		c.Next()
+	}
+}
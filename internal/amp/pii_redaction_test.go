@@ -0,0 +1,187 @@
+package amp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func withPIIRedactionConfig(t *testing.T, cfg model.PIIRedactionConfig) {
+	t.Helper()
+	prev := GetPIIRedactionConfig()
+	cfg = NormalizePIIRedactionConfig(cfg)
+	if err := ValidatePIIRedactionConfig(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	UpdatePIIRedactionConfig(cfg)
+	t.Cleanup(func() { UpdatePIIRedactionConfig(prev) })
+}
+
+func TestPIIRedactText(t *testing.T) {
+	redactor, err := compilePIIRedactor(model.PIIRedactionConfig{
+		Email:      true,
+		Phone:      true,
+		CreditCard: true,
+		Patterns:   []model.DetailRedactionPattern{{Name: "employee-id", Pattern: `EMP-\d{6}`}},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	p := redactor.newRedaction()
+
+	got, _ := p.redactText("mail alice@example.com or bob@example.org, again alice@example.com")
+	if got != "mail [EMAIL_1] or [EMAIL_2], again [EMAIL_1]" {
+		t.Errorf("emails = %q", got)
+	}
+	got, _ = p.redactText("card 4111 1111 1111 1111, order 1234567890123, call +1 415-555-0132 or 13812345678")
+	if got != "card [CREDIT_CARD_1], order 1234567890123, call [PHONE_1] or [PHONE_2]" {
+		t.Errorf("card/phone = %q", got)
+	}
+	got, _ = p.redactText("badge EMP-123456 at 2024-01-15, build 12345678")
+	if got != "badge [EMPLOYEE_ID_1] at 2024-01-15, build 12345678" {
+		t.Errorf("custom = %q", got)
+	}
+
+	want := map[string]int{"[EMAIL_1]": 2, "[EMAIL_2]": 1, "[CREDIT_CARD_1]": 1, "[PHONE_1]": 1, "[PHONE_2]": 1, "[EMPLOYEE_ID_1]": 1}
+	if len(p.items) != len(want) {
+		t.Fatalf("items = %+v", p.items)
+	}
+	for _, item := range p.items {
+		if want[item.Token] != item.Count {
+			t.Errorf("item %+v, want count %d", item, want[item.Token])
+		}
+	}
+	if p.items[0].Type != piiTypeEmail || p.items[len(p.items)-1].Type != "employee-id" {
+		t.Errorf("item types = %+v", p.items)
+	}
+}
+
+func TestPIIRedactRequestBodyFormats(t *testing.T) {
+	redactor, _ := compilePIIRedactor(model.PIIRedactionConfig{Email: true})
+
+	cases := []struct {
+		name   string
+		format translator.Format
+		body   string
+		paths  map[string]string
+	}{
+		{
+			name:   "claude",
+			format: translator.FormatClaude,
+			body:   `{"system":"admin@corp.com","messages":[{"role":"user","content":"hi a@x.io"},{"role":"assistant","content":"ok a@x.io"},{"role":"user","content":[{"type":"text","text":"b@x.io"},{"type":"image","source":{}}]}]}`,
+			paths: map[string]string{
+				"system":                    "admin@corp.com",
+				"messages.0.content":        "hi [EMAIL_1]",
+				"messages.1.content":        "ok a@x.io",
+				"messages.2.content.0.text": "[EMAIL_2]",
+			},
+		},
+		{
+			name:   "openai chat",
+			format: translator.FormatOpenAIChat,
+			body:   `{"messages":[{"role":"system","content":"s@x.io"},{"role":"user","content":[{"type":"text","text":"to a@x.io"}]}]}`,
+			paths: map[string]string{
+				"messages.0.content":        "s@x.io",
+				"messages.1.content.0.text": "to [EMAIL_1]",
+			},
+		},
+		{
+			name:   "openai responses",
+			format: translator.FormatOpenAIResponses,
+			body:   `{"input":[{"role":"user","content":[{"type":"input_text","text":"a@x.io"}]},{"type":"function_call_output","output":"c@x.io"}]}`,
+			paths: map[string]string{
+				"input.0.content.0.text": "[EMAIL_1]",
+				"input.1.output":         "c@x.io",
+			},
+		},
+		{
+			name:   "openai responses string input",
+			format: translator.FormatOpenAIResponses,
+			body:   `{"input":"mail a@x.io"}`,
+			paths:  map[string]string{"input": "mail [EMAIL_1]"},
+		},
+		{
+			name:   "gemini",
+			format: translator.FormatGemini,
+			body:   `{"contents":[{"role":"user","parts":[{"text":"a@x.io"},{"inlineData":{}}]},{"role":"model","parts":[{"text":"a@x.io"}]},{"parts":[{"text":"again a@x.io"}]}]}`,
+			paths: map[string]string{
+				"contents.0.parts.0.text": "[EMAIL_1]",
+				"contents.1.parts.0.text": "a@x.io",
+				"contents.2.parts.0.text": "again [EMAIL_1]",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, items := redactor.redactRequestBody(tc.format, []byte(tc.body))
+			if len(items) == 0 {
+				t.Fatal("expected redactions")
+			}
+			for path, want := range tc.paths {
+				if got := gjson.GetBytes(body, path).String(); got != want {
+					t.Errorf("%s = %q, want %q", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPIIRedactionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withPIIRedactionConfig(t, model.PIIRedactionConfig{Enabled: true, Email: true})
+
+	var gotBody string
+	var gotItems []model.PIIRedactionItem
+	engine := gin.New()
+	engine.Use(PIIRedactionMiddleware())
+	engine.POST("/*path", func(c *gin.Context) {
+		data, _ := io.ReadAll(c.Request.Body)
+		gotBody = string(data)
+		gotItems = GetPIIRedactions(c.Request.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"messages":[{"role":"user","content":"a@x.io"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	if strings.Contains(gotBody, "a@x.io") || len(gotItems) != 1 || gotItems[0].Token != "[EMAIL_1]" {
+		t.Fatalf("body = %s, items = %+v", gotBody, gotItems)
+	}
+
+	// token 计数同样脱敏，但不记录报告
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(`{"messages":[{"role":"user","content":"a@x.io"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	if strings.Contains(gotBody, "a@x.io") || gotItems != nil {
+		t.Fatalf("count body = %s, items = %+v", gotBody, gotItems)
+	}
+
+	// 未启用时不修改请求
+	withPIIRedactionConfig(t, model.PIIRedactionConfig{Email: true})
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"messages":[{"role":"user","content":"a@x.io"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(gotBody, "a@x.io") || gotItems != nil {
+		t.Fatalf("disabled body = %s, items = %+v", gotBody, gotItems)
+	}
+}
+
+func TestValidatePIIRedactionConfig(t *testing.T) {
+	cfg := NormalizePIIRedactionConfig(model.PIIRedactionConfig{Patterns: []model.DetailRedactionPattern{{Pattern: "a*"}}})
+	if cfg.Patterns[0].Name != "custom1" {
+		t.Errorf("name = %q", cfg.Patterns[0].Name)
+	}
+	if err := ValidatePIIRedactionConfig(cfg); err == nil {
+		t.Error("expected error for pattern matching empty string")
+	}
+	if err := ValidatePIIRedactionConfig(model.PIIRedactionConfig{Patterns: []model.DetailRedactionPattern{{Name: "x", Pattern: "("}}}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
@@ -0,0 +1,463 @@
+package amp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	pipelineStepTimeout       = 60 * time.Second
+	pipelineDefaultMaxTokens  = 256
+	pipelineMaxInputRunes     = 16000
+	pipelineMaxStepRespBytes  = 4 * 1024 * 1024
+	pipelineSummarySeparator  = "\n\n---\n**摘要**："
+	pipelineStepPathPrefix    = "/pipeline/"
+	pipelineStepErrorType     = "pipeline_step_failed"
+	pipelineBlockedErrorCode  = "pipeline_blocked"
+	pipelineTriageBlockAnswer = "BLOCK"
+)
+
+// defaultPipelinePrompts 各步骤类型的默认指令，route 步骤会在指令后附加候选模型列表
+var defaultPipelinePrompts = map[string]string{
+	model.PipelineStepRoute:     "你是请求分类器。根据用户请求的类型与难度，从候选模型中选择最合适的一个。只回答模型名称，不要输出其他内容。",
+	model.PipelineStepTriage:    "你是安全审核员。判断用户请求是否应被拒绝（违法、有害或滥用内容）。只回答 ALLOW 或 BLOCK。",
+	model.PipelineStepSummarize: "用不超过三句话总结以下回答的要点，只输出摘要。",
+}
+
+// RequestPipelineMiddleware 执行用户所在分组配置的请求流水线。
+// 前置步骤在转发前依次执行：route 按分类结果改写请求模型，triage 判定为 BLOCK 时拒绝请求；
+// 后置步骤只对非流式回答生效，summarize 将摘要追加到回答末尾。
+// 每个步骤通过现有渠道调用，单独写入请求日志并计费；步骤失败时跳过该步骤，不影响原请求。
+// 需在模型映射之后、渠道选择之前执行
+func RequestPipelineMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		proxyCfg := GetProxyConfig(c.Request.Context())
+		if proxyCfg == nil || proxyCfg.Pipeline == nil || !isPipelineRequest(c.Request) {
+			c.Next()
+			return
+		}
+
+		bodyBytes := readJSONRequestBody(c.Request, maxRequestBodySize)
+		if bodyBytes == nil || !gjson.ValidBytes(bodyBytes) {
+			c.Next()
+			return
+		}
+
+		format := detectIncomingFormat(c.Request.URL.Path)
+		pipeline := proxyCfg.Pipeline
+		if input := pipelineUserText(format, bodyBytes); input != "" {
+			for _, step := range pipeline.Pre {
+				if !runPipelinePreStep(c, proxyCfg, step, format, input) {
+					return
+				}
+			}
+		}
+
+		streaming := parseStreamFlag(bodyBytes) || strings.Contains(c.Request.URL.Path, "streamGenerateContent")
+		if len(pipeline.Post) == 0 || streaming {
+			c.Next()
+			return
+		}
+
+		writer := &pipelineResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		body := writer.body.Bytes()
+		if writer.Status() == http.StatusOK && writer.Header().Get("Content-Encoding") == "" {
+			for _, step := range pipeline.Post {
+				body = runPipelinePostStep(c.Request.Context(), proxyCfg, step, format, body)
+			}
+			writer.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		}
+		if len(body) == 0 {
+			c.Writer.WriteHeaderNow()
+			return
+		}
+		if _, err := c.Writer.Write(body); err != nil {
+			log.Debugf("pipeline: failed to write response: %v", err)
+		}
+	}
+}
+
+// isPipelineRequest 只处理文本类模型调用，token 计数、embeddings 与音频接口不经过流水线
+func isPipelineRequest(req *http.Request) bool {
+	if !IsModelInvocation(req.Method, req.URL.Path) || isTokenCountPath(req.URL.Path) || isOpenAIPassthroughPath(req.URL.Path) {
+		return false
+	}
+	return req.Body != nil && req.ContentLength != 0 && isJSONContentType(req.Header.Get("Content-Type"))
+}
+
+// runPipelinePreStep 执行单个前置步骤，返回 false 表示请求已被拒绝
+func runPipelinePreStep(c *gin.Context, proxyCfg *ProxyConfig, step model.PipelineStep, format translator.Format, input string) bool {
+	switch step.Type {
+	case model.PipelineStepTriage:
+		answer, err := runPipelineStep(c.Request.Context(), proxyCfg, step, pipelineStepPrompt(step), input)
+		if err != nil {
+			log.Warnf("pipeline: triage step for user %s failed, request allowed: %v", proxyCfg.UserID, err)
+			return true
+		}
+		if !strings.Contains(strings.ToUpper(answer), pipelineTriageBlockAnswer) {
+			return true
+		}
+		log.Warnf("pipeline: 安全分诊拒绝用户 %s 的请求（模型 %s）", proxyCfg.UserID, step.Model)
+		resp := NewStandardError(http.StatusBadRequest, "请求未通过安全分诊，已被拒绝")
+		resp.Error.Code = pipelineBlockedErrorCode
+		c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+		return false
+
+	case model.PipelineStepRoute:
+		answer, err := runPipelineStep(c.Request.Context(), proxyCfg, step, pipelineStepPrompt(step), input)
+		if err != nil {
+			log.Warnf("pipeline: route step for user %s failed, keeping requested model: %v", proxyCfg.UserID, err)
+			return true
+		}
+		target := matchPipelineCandidate(answer, step.Candidates)
+		if target == "" {
+			log.Warnf("pipeline: route step answered %q which is not a candidate, keeping requested model", answer)
+			return true
+		}
+		applyPipelineRoute(c, proxyCfg, format, target)
+	}
+	return true
+}
+
+// runPipelinePostStep 执行单个后置步骤，返回处理后的响应体
+func runPipelinePostStep(ctx context.Context, proxyCfg *ProxyConfig, step model.PipelineStep, format translator.Format, body []byte) []byte {
+	if step.Type != model.PipelineStepSummarize {
+		return body
+	}
+	paths := responseTextPaths(format, body)
+	if len(paths) == 0 {
+		return body
+	}
+	texts := make([]string, 0, len(paths))
+	for _, path := range paths {
+		texts = append(texts, gjson.GetBytes(body, path).String())
+	}
+	answer := strings.TrimSpace(strings.Join(texts, "\n"))
+	if answer == "" {
+		return body
+	}
+
+	summary, err := runPipelineStep(ctx, proxyCfg, step, pipelineStepPrompt(step), truncateRunes(answer, pipelineMaxInputRunes))
+	if err != nil {
+		log.Warnf("pipeline: summarize step for user %s failed: %v", proxyCfg.UserID, err)
+		return body
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return body
+	}
+	last := paths[len(paths)-1]
+	updated, err := sjson.SetBytes(body, last, gjson.GetBytes(body, last).String()+pipelineSummarySeparator+summary)
+	if err != nil {
+		return body
+	}
+	return updated
+}
+
+// pipelineStepPrompt 步骤的指令：未配置时使用默认指令，route 步骤附加候选模型列表
+func pipelineStepPrompt(step model.PipelineStep) string {
+	prompt := step.Prompt
+	if prompt == "" {
+		prompt = defaultPipelinePrompts[step.Type]
+	}
+	if step.Type == model.PipelineStepRoute {
+		prompt += "\n候选模型：\n- " + strings.Join(step.Candidates, "\n- ")
+	}
+	return prompt
+}
+
+// matchPipelineCandidate 从分类结果中找出候选模型：优先完全匹配，否则取回答中出现的最长候选名
+func matchPipelineCandidate(answer string, candidates []string) string {
+	answer = strings.Trim(strings.TrimSpace(answer), "`\"'.。")
+	best := ""
+	for _, candidate := range candidates {
+		if strings.EqualFold(answer, candidate) {
+			return candidate
+		}
+		if strings.Contains(answer, candidate) && len(candidate) > len(best) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// applyPipelineRoute 将请求模型改写为分类选出的模型，并按模型映射的方式记录原始模型，
+// 响应中的模型名仍改写回客户端请求的模型
+func applyPipelineRoute(c *gin.Context, proxyCfg *ProxyConfig, format translator.Format, target string) {
+	current := extractModelName(c)
+	if current == "" || current == target {
+		return
+	}
+	if channel, err := channelService.SelectChannelForModelWithGroups(target, proxyCfg.GroupIDs); err != nil || channel == nil {
+		log.Warnf("pipeline: routed model '%s' has no available channel, keeping '%s'", target, current)
+		return
+	}
+
+	if format == translator.FormatGemini {
+		newPath := rewriteModelInPath(c.Request.URL.Path, current, target)
+		c.Request.URL.Path = newPath
+		c.Request.RequestURI = newPath
+		if c.Request.URL.RawQuery != "" {
+			c.Request.RequestURI = newPath + "?" + c.Request.URL.RawQuery
+		}
+	}
+	bodyBytes, _ := io.ReadAll(c.Request.Body)
+	if gjson.GetBytes(bodyBytes, "model").Exists() {
+		if updated, err := sjson.SetBytes(bodyBytes, "model", target); err == nil {
+			bodyBytes = updated
+		}
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	c.Request.ContentLength = int64(len(bodyBytes))
+	c.Request.Header.Set("Content-Length", fmt.Sprintf("%d", len(bodyBytes)))
+
+	original := current
+	if IsModelMappingApplied(c) {
+		if orig := GetOriginalModel(c); orig != "" {
+			original = orig
+		}
+	}
+	c.Set(OriginalModelContextKey, original)
+	c.Set(MappedModelContextKey, target)
+	c.Set(ModelMappingAppliedKey, true)
+	c.Request = c.Request.WithContext(WithModelInfo(c.Request.Context(), original, target))
+	log.Infof("pipeline: routed model %s -> %s", current, target)
+}
+
+// runPipelineStep 通过渠道调用步骤模型，返回模型输出的文本。
+// 每次调用单独写入一条请求日志（路径为 /pipeline/<type>），按步骤模型的价格与用户分组倍率计费
+func runPipelineStep(ctx context.Context, proxyCfg *ProxyConfig, step model.PipelineStep, prompt, input string) (string, error) {
+	channel, err := channelService.SelectChannelForModelWithGroups(step.Model, proxyCfg.GroupIDs)
+	if err != nil {
+		return "", err
+	}
+	if channel == nil {
+		return "", fmt.Errorf("模型 %s 没有可用渠道", step.Model)
+	}
+
+	maxTokens := step.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = pipelineDefaultMaxTokens
+	}
+	endpoint, payload := buildPipelineStepRequest(channel, step.Model, prompt, input, maxTokens)
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	upstreamURL, err := url.Parse(channel.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	upstreamURL.Path = strings.TrimSuffix(upstreamURL.Path, "/") + endpoint
+
+	trace := NewRequestTrace(uuid.New().String(), proxyCfg.UserID, proxyCfg.APIKeyID, http.MethodPost, pipelineStepPathPrefix+step.Type)
+	trace.SetModels(step.Model, step.Model)
+	trace.SetChannel(channel.ID, string(channel.Type), channel.BaseURL)
+	trace.SetOnBehalfOf(proxyCfg.OnBehalfOf)
+	trace.SetEstimatedInputTokens(estimateRequestTokens(reqBody, usageEncoding(step.Model, ProviderInfoFromChannel(channel).Provider)))
+	writer := GetLogWriter()
+	if writer != nil {
+		writer.WritePendingFromTrace(trace)
+	}
+	defer func() {
+		settleTraceCost(trace, proxyCfg)
+		if writer != nil {
+			writer.UpdateFromTrace(trace)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, pipelineStepTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstreamURL.String(), bytes.NewReader(reqBody))
+	if err != nil {
+		trace.SetError(pipelineStepErrorType)
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	applyChannelAuth(channel, req)
+	if channel.FederationIssuer != "" {
+		signChannelRequest(channel, req, federationOnBehalfOf(proxyCfg))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		trace.SetResponse(http.StatusBadGateway)
+		trace.SetError("upstream_request_failed")
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, pipelineMaxStepRespBytes))
+	trace.SetResponse(resp.StatusCode)
+	if err != nil {
+		trace.SetError(pipelineStepErrorType)
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		trace.SetError("upstream_error")
+		return "", fmt.Errorf("渠道 %s 返回 HTTP %d", channel.Name, resp.StatusCode)
+	}
+
+	info := ProviderInfoFromChannel(channel)
+	usage := ExtractTokenUsage(body, info)
+	if usage != nil {
+		trace.SetUsage(usage.InputTokens, usage.OutputTokens, usage.CacheReadInputTokens, usage.CacheCreationInputTokens)
+	}
+	if usage == nil || usage.OutputTokens == nil {
+		estimateResponseOutput(trace, body, info.Provider)
+	}
+	var texts []string
+	for _, path := range responseTextPaths(channelTypeToFormat(channel), body) {
+		texts = append(texts, gjson.GetBytes(body, path).String())
+	}
+	text := strings.TrimSpace(strings.Join(texts, ""))
+	if text == "" {
+		trace.SetError(pipelineStepErrorType)
+		return "", fmt.Errorf("模型 %s 未返回文本", step.Model)
+	}
+	return text, nil
+}
+
+// buildPipelineStepRequest 按渠道类型构造单轮文本请求，返回上游路径与请求体
+func buildPipelineStepRequest(channel *model.Channel, modelName, prompt, input string, maxTokens int) (string, map[string]interface{}) {
+	switch channel.Type.Protocol() {
+	case model.ChannelTypeClaude:
+		return "/v1/messages", map[string]interface{}{
+			"model":      modelName,
+			"system":     prompt,
+			"messages":   []interface{}{map[string]interface{}{"role": "user", "content": input}},
+			"max_tokens": maxTokens,
+		}
+	case model.ChannelTypeGemini:
+		return fmt.Sprintf("/v1beta/models/%s:generateContent", strings.TrimPrefix(modelName, "models/")), map[string]interface{}{
+			"systemInstruction": map[string]interface{}{"parts": []interface{}{map[string]interface{}{"text": prompt}}},
+			"contents":          []interface{}{map[string]interface{}{"role": "user", "parts": []interface{}{map[string]interface{}{"text": input}}}},
+			"generationConfig":  map[string]interface{}{"maxOutputTokens": maxTokens},
+		}
+	default:
+		if channel.Endpoint == model.ChannelEndpointResponses {
+			return "/v1/responses", map[string]interface{}{
+				"model":             modelName,
+				"instructions":      prompt,
+				"input":             input,
+				"max_output_tokens": maxTokens,
+			}
+		}
+		return "/v1/chat/completions", map[string]interface{}{
+			"model": modelName,
+			"messages": []interface{}{
+				map[string]interface{}{"role": "system", "content": prompt},
+				map[string]interface{}{"role": "user", "content": input},
+			},
+			"max_tokens": maxTokens,
+		}
+	}
+}
+
+// pipelineUserText 请求中最后一条消息为用户消息时返回其文本；
+// 最后一条是工具结果等非用户文本时返回空，工具调用续写轮次不重复执行前置步骤
+func pipelineUserText(format translator.Format, body []byte) string {
+	root := gjson.ParseBytes(body)
+	var text string
+	switch format {
+	case translator.FormatClaude:
+		text = lastUserMessageText(root.Get("messages"), "role", "content", "text")
+	case translator.FormatOpenAIResponses:
+		input := root.Get("input")
+		if input.Type == gjson.String {
+			text = input.String()
+		} else {
+			text = lastUserMessageText(input, "role", "content", "input_text")
+		}
+	case translator.FormatGemini:
+		contents := root.Get("contents").Array()
+		if len(contents) == 0 {
+			return ""
+		}
+		last := contents[len(contents)-1]
+		if role := last.Get("role").String(); role != "" && role != "user" {
+			return ""
+		}
+		var parts []string
+		last.Get("parts").ForEach(func(_, part gjson.Result) bool {
+			if t := part.Get("text"); t.Exists() {
+				parts = append(parts, t.String())
+			}
+			return true
+		})
+		text = strings.Join(parts, "\n")
+	default:
+		text = lastUserMessageText(root.Get("messages"), "role", "content", "text")
+	}
+	return truncateRunes(strings.TrimSpace(text), pipelineMaxInputRunes)
+}
+
+// lastUserMessageText 消息数组最后一项为用户消息时返回其文本，content 为字符串或 type 为 partType 的内容块数组
+func lastUserMessageText(messages gjson.Result, roleField, contentField, partType string) string {
+	items := messages.Array()
+	if len(items) == 0 {
+		return ""
+	}
+	last := items[len(items)-1]
+	if last.Get(roleField).String() != "user" {
+		return ""
+	}
+	content := last.Get(contentField)
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	var parts []string
+	content.ForEach(func(_, block gjson.Result) bool {
+		if block.Get("type").String() == partType {
+			parts = append(parts, block.Get("text").String())
+		}
+		return true
+	})
+	return strings.Join(parts, "\n")
+}
+
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit])
+}
+
+// pipelineResponseWriter 缓冲完整的非流式响应，后置步骤处理完成后再写回客户端
+type pipelineResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *pipelineResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *pipelineResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// WriteHeaderNow 与 Flush 不向客户端发送任何内容，状态码与响应头在写回时一并发送
+func (w *pipelineResponseWriter) WriteHeaderNow() {}
+
+func (w *pipelineResponseWriter) Flush() {}
@@ -0,0 +1,74 @@
+package amp
+
+import (
+	"testing"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+)
+
+func TestPipelineUserText(t *testing.T) {
+	cases := []struct {
+		name   string
+		format translator.Format
+		body   string
+		want   string
+	}{
+		{"claude string", translator.FormatClaude, `{"messages":[{"role":"user","content":"hello"}]}`, "hello"},
+		{"claude blocks", translator.FormatClaude, `{"messages":[{"role":"user","content":[{"type":"image"},{"type":"text","text":"describe"}]}]}`, "describe"},
+		{"claude tool result", translator.FormatClaude, `{"messages":[{"role":"user","content":"q"},{"role":"assistant","content":"a"},{"role":"user","content":[{"type":"tool_result","content":"ok"}]}]}`, ""},
+		{"chat tool turn", translator.FormatOpenAIChat, `{"messages":[{"role":"user","content":"q"},{"role":"tool","content":"r"}]}`, ""},
+		{"chat parts", translator.FormatOpenAIChat, `{"messages":[{"role":"system","content":"s"},{"role":"user","content":[{"type":"text","text":"hi"}]}]}`, "hi"},
+		{"responses string", translator.FormatOpenAIResponses, `{"input":"plain"}`, "plain"},
+		{"responses items", translator.FormatOpenAIResponses, `{"input":[{"type":"message","role":"user","content":[{"type":"input_text","text":"x"}]}]}`, "x"},
+		{"responses tool output", translator.FormatOpenAIResponses, `{"input":[{"type":"function_call_output","output":"r"}]}`, ""},
+		{"gemini", translator.FormatGemini, `{"contents":[{"role":"user","parts":[{"text":"g"}]}]}`, "g"},
+		{"gemini model turn", translator.FormatGemini, `{"contents":[{"role":"model","parts":[{"text":"g"}]}]}`, ""},
+	}
+	for _, tc := range cases {
+		if got := pipelineUserText(tc.format, []byte(tc.body)); got != tc.want {
+			t.Errorf("%s: pipelineUserText = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMatchPipelineCandidate(t *testing.T) {
+	candidates := []string{"gpt-4o", "gpt-4o-mini", "claude-sonnet-4"}
+	cases := map[string]string{
+		"gpt-4o-mini":            "gpt-4o-mini",
+		"`GPT-4O`":               "gpt-4o",
+		"选择 gpt-4o-mini。":        "gpt-4o-mini",
+		"claude-sonnet-4\n":      "claude-sonnet-4",
+		"none of them fits best": "",
+	}
+	for answer, want := range cases {
+		if got := matchPipelineCandidate(answer, candidates); got != want {
+			t.Errorf("matchPipelineCandidate(%q) = %q, want %q", answer, got, want)
+		}
+	}
+}
+
+func TestPipelineStepPrompt(t *testing.T) {
+	step := model.PipelineStep{Type: model.PipelineStepRoute, Prompt: "pick", Candidates: []string{"a", "b"}}
+	if got, want := pipelineStepPrompt(step), "pick\n候选模型：\n- a\n- b"; got != want {
+		t.Errorf("pipelineStepPrompt = %q, want %q", got, want)
+	}
+	if pipelineStepPrompt(model.PipelineStep{Type: model.PipelineStepTriage}) == "" {
+		t.Error("expected default triage prompt")
+	}
+}
+
+func TestBuildPipelineStepRequest(t *testing.T) {
+	path, payload := buildPipelineStepRequest(&model.Channel{Type: model.ChannelTypeGemini}, "models/gemini-2.5-flash", "p", "in", 64)
+	if path != "/v1beta/models/gemini-2.5-flash:generateContent" {
+		t.Errorf("unexpected gemini path %q", path)
+	}
+	if payload["generationConfig"].(map[string]interface{})["maxOutputTokens"] != 64 {
+		t.Errorf("unexpected gemini payload %+v", payload)
+	}
+
+	path, payload = buildPipelineStepRequest(&model.Channel{Type: model.ChannelTypeOpenAI, Endpoint: model.ChannelEndpointResponses}, "gpt-4o-mini", "p", "in", 64)
+	if path != "/v1/responses" || payload["instructions"] != "p" || payload["input"] != "in" {
+		t.Errorf("unexpected responses request %q %+v", path, payload)
+	}
+}
@@ -0,0 +1,481 @@
+package amp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 响应后处理配置限制
+const (
+	maxPostProcessors = 16
+	maxLocaleLength   = 35
+)
+
+// ResponsePostProcessor 响应后处理插件：对模型输出的完整文本做确定性改写
+type ResponsePostProcessor interface {
+	// Name 插件名称，用户设置中按名称启用
+	Name() string
+	Description() string
+	// Process 处理非流式响应中的完整文本，locale 为用户设置的语言区域（可能为空）
+	Process(text, locale string) string
+}
+
+// StreamFinalizer 可选接口：支持流式响应收尾处理的插件实现。
+// 流式输出中每个文本内容块末尾的空白会暂缓下发，内容块结束时依次交给各插件：
+// sent 为已下发的文本，tail 为暂缓的末尾空白，返回值替代 tail 下发
+type StreamFinalizer interface {
+	FinalizeStream(sent, tail, locale string) string
+}
+
+var postProcessorRegistry struct {
+	sync.RWMutex
+	processors map[string]ResponsePostProcessor
+}
+
+func init() {
+	RegisterResponsePostProcessor(trimTrailingWhitespaceProcessor{})
+	RegisterResponsePostProcessor(markdownNormalizeProcessor{})
+	RegisterResponsePostProcessor(localePunctuationProcessor{})
+}
+
+// RegisterResponsePostProcessor 注册响应后处理插件，同名插件后注册的覆盖先注册的
+func RegisterResponsePostProcessor(p ResponsePostProcessor) {
+	postProcessorRegistry.Lock()
+	defer postProcessorRegistry.Unlock()
+	if postProcessorRegistry.processors == nil {
+		postProcessorRegistry.processors = make(map[string]ResponsePostProcessor)
+	}
+	postProcessorRegistry.processors[p.Name()] = p
+}
+
+func lookupResponsePostProcessor(name string) ResponsePostProcessor {
+	postProcessorRegistry.RLock()
+	defer postProcessorRegistry.RUnlock()
+	return postProcessorRegistry.processors[name]
+}
+
+// ListResponsePostProcessors 列出已注册的响应后处理插件（按名称排序）
+func ListResponsePostProcessors() []model.PostProcessorInfo {
+	postProcessorRegistry.RLock()
+	defer postProcessorRegistry.RUnlock()
+	list := make([]model.PostProcessorInfo, 0, len(postProcessorRegistry.processors))
+	for _, p := range postProcessorRegistry.processors {
+		_, streaming := p.(StreamFinalizer)
+		list = append(list, model.PostProcessorInfo{Name: p.Name(), Description: p.Description(), Streaming: streaming})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// NormalizePostProcessingSettings 去除空白与重复的处理器名称
+func NormalizePostProcessingSettings(pp model.PostProcessingSettings) model.PostProcessingSettings {
+	seen := make(map[string]struct{}, len(pp.Processors))
+	processors := make([]string, 0, len(pp.Processors))
+	for _, name := range pp.Processors {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		processors = append(processors, name)
+	}
+	pp.Processors = processors
+	pp.Locale = strings.TrimSpace(pp.Locale)
+	return pp
+}
+
+// ValidatePostProcessingSettings 校验响应后处理设置
+func ValidatePostProcessingSettings(pp model.PostProcessingSettings) error {
+	if len(pp.Processors) > maxPostProcessors {
+		return fmt.Errorf("后处理器数量不能超过 %d 个", maxPostProcessors)
+	}
+	for _, name := range pp.Processors {
+		if lookupResponsePostProcessor(name) == nil {
+			return fmt.Errorf("未知的后处理器: %s", name)
+		}
+	}
+	if len(pp.Locale) > maxLocaleLength {
+		return fmt.Errorf("语言区域不能超过 %d 个字符", maxLocaleLength)
+	}
+	return nil
+}
+
+// parsePostProcessingSettings 解析用户设置中保存的后处理配置，格式错误时视为未启用
+func parsePostProcessingSettings(raw string) model.PostProcessingSettings {
+	var pp model.PostProcessingSettings
+	if raw == "" {
+		return pp
+	}
+	if err := json.Unmarshal([]byte(raw), &pp); err != nil {
+		return model.PostProcessingSettings{}
+	}
+	return pp
+}
+
+// responsePostProcessing 单个请求启用的后处理插件
+type responsePostProcessing struct {
+	processors []ResponsePostProcessor
+	locale     string
+}
+
+// newResponsePostProcessing 按用户设置构建后处理链，未启用任何插件时返回 nil
+func newResponsePostProcessing(cfg *ProxyConfig) *responsePostProcessing {
+	if cfg == nil || len(cfg.PostProcessing.Processors) == 0 {
+		return nil
+	}
+	pp := &responsePostProcessing{locale: cfg.PostProcessing.Locale}
+	for _, name := range cfg.PostProcessing.Processors {
+		// 插件被移除后已保存的设置中可能残留其名称，跳过即可
+		if p := lookupResponsePostProcessor(name); p != nil {
+			pp.processors = append(pp.processors, p)
+		}
+	}
+	if len(pp.processors) == 0 {
+		return nil
+	}
+	return pp
+}
+
+func (pp *responsePostProcessing) process(text string) string {
+	for _, p := range pp.processors {
+		text = p.Process(text, pp.locale)
+	}
+	return text
+}
+
+// finalize 依次执行各插件的流式收尾处理
+func (pp *responsePostProcessing) finalize(sent, tail string) string {
+	for _, p := range pp.processors {
+		if f, ok := p.(StreamFinalizer); ok {
+			tail = f.FinalizeStream(sent, tail, pp.locale)
+		}
+	}
+	return tail
+}
+
+// processJSONResponse 处理非流式响应中的文本字段
+func (pp *responsePostProcessing) processJSONResponse(format translator.Format, body []byte) []byte {
+	for _, path := range responseTextPaths(format, body) {
+		original := gjson.GetBytes(body, path).String()
+		if processed := pp.process(original); processed != original {
+			if updated, err := sjson.SetBytes(body, path, processed); err == nil {
+				body = updated
+			}
+		}
+	}
+	return body
+}
+
+// formatForProvider 上游 provider 对应的响应格式
+func formatForProvider(kind ProviderKind) translator.Format {
+	switch kind {
+	case ProviderOpenAIChat:
+		return translator.FormatOpenAIChat
+	case ProviderOpenAIResponses:
+		return translator.FormatOpenAIResponses
+	case ProviderOpenAIEmbeddings:
+		return translator.FormatOpenAIEmbeddings
+	case ProviderOpenAIAudio:
+		return translator.FormatOpenAIAudio
+	case ProviderGemini:
+		return translator.FormatGemini
+	case ProviderOllama:
+		return translator.FormatOllamaChat
+	default:
+		return translator.FormatClaude
+	}
+}
+
+// PostProcessMiddleware 按用户设置对非流式响应执行后处理插件
+type PostProcessMiddleware struct{}
+
+func (m *PostProcessMiddleware) ProcessBody(body []byte, ctx *ResponseContext) ([]byte, error) {
+	if ctx.StatusCode < 200 || ctx.StatusCode >= 300 {
+		return body, nil
+	}
+	pp := newResponsePostProcessing(GetProxyConfig(ctx.Ctx))
+	if pp == nil || !gjson.ValidBytes(body) {
+		return body, nil
+	}
+	return pp.processJSONResponse(formatForProvider(ctx.Provider.Provider), body), nil
+}
+
+// newPostProcessSSEWrapper 包装流式响应体，在每个文本内容块结束时执行插件的收尾处理
+func newPostProcessSSEWrapper(ctx context.Context, rc io.ReadCloser, format translator.Format) io.ReadCloser {
+	pp := newResponsePostProcessing(GetProxyConfig(ctx))
+	if rc == nil || pp == nil {
+		return rc
+	}
+	return &outputFilterSSEWrapper{
+		rc:     rc,
+		format: format,
+		text:   newPostProcessStream(pp),
+	}
+}
+
+// postProcessStream 流式后处理状态：已下发文本原样保留，仅暂缓每个内容块末尾的空白，
+// 使收尾处理可以去除或补全结尾
+type postProcessStream struct {
+	pp    *responsePostProcessing
+	sent  map[string]*strings.Builder
+	tail  map[string]string
+	order []string
+}
+
+func newPostProcessStream(pp *responsePostProcessing) *postProcessStream {
+	return &postProcessStream{
+		pp:   pp,
+		sent: make(map[string]*strings.Builder),
+		tail: make(map[string]string),
+	}
+}
+
+func (s *postProcessStream) push(key, delta string) (string, *outputFilterRule) {
+	sent, ok := s.sent[key]
+	if !ok {
+		sent = &strings.Builder{}
+		s.sent[key] = sent
+		s.order = append(s.order, key)
+	}
+	text := s.tail[key] + delta
+	emit := strings.TrimRightFunc(text, unicode.IsSpace)
+	s.tail[key] = text[len(emit):]
+	sent.WriteString(emit)
+	return emit, nil
+}
+
+func (s *postProcessStream) flush(key string) (string, *outputFilterRule) {
+	sent, ok := s.sent[key]
+	if !ok {
+		return "", nil
+	}
+	delete(s.sent, key)
+	tail := s.tail[key]
+	delete(s.tail, key)
+	return s.pp.finalize(sent.String(), tail), nil
+}
+
+// filter 处理事件中的完整文本快照，结果与逐段下发的文本一致
+func (s *postProcessStream) filter(text string) (string, *outputFilterRule) {
+	body := strings.TrimRightFunc(text, unicode.IsSpace)
+	return body + s.pp.finalize(body, text[len(body):]), nil
+}
+
+func (s *postProcessStream) pendingKeys() []string {
+	var keys []string
+	for _, key := range s.order {
+		if _, ok := s.sent[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ========== 内置插件 ==========
+
+// trimTrailingWhitespaceProcessor 去除每行行尾空白与文本末尾的空行（代码块内容保持不变）
+type trimTrailingWhitespaceProcessor struct{}
+
+func (trimTrailingWhitespaceProcessor) Name() string { return "trim_trailing_whitespace" }
+
+func (trimTrailingWhitespaceProcessor) Description() string {
+	return "去除行尾空白与结尾多余的空行，代码块内容保持不变"
+}
+
+func (trimTrailingWhitespaceProcessor) Process(text, _ string) string {
+	text = mapOutsideCodeFences(text, func(prose string) string {
+		lines := strings.Split(prose, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, " \t")
+		}
+		return strings.Join(lines, "\n")
+	})
+	return strings.TrimRightFunc(text, unicode.IsSpace)
+}
+
+func (trimTrailingWhitespaceProcessor) FinalizeStream(_, _, _ string) string {
+	return ""
+}
+
+// markdownNormalizeProcessor 统一换行符、合并连续空行并补全未闭合的代码块
+type markdownNormalizeProcessor struct{}
+
+var excessBlankLines = regexp.MustCompile(`\n{3,}`)
+
+func (markdownNormalizeProcessor) Name() string { return "markdown_normalize" }
+
+func (markdownNormalizeProcessor) Description() string {
+	return "统一换行符为 \\n、合并连续空行，并补全未闭合的代码块"
+}
+
+func (markdownNormalizeProcessor) Process(text, _ string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = mapOutsideCodeFences(text, func(prose string) string {
+		return excessBlankLines.ReplaceAllString(prose, "\n\n")
+	})
+	if fence := openCodeFence(text); fence != "" {
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		text += fence
+	}
+	return text
+}
+
+func (markdownNormalizeProcessor) FinalizeStream(sent, tail, _ string) string {
+	fence := openCodeFence(sent + tail)
+	if fence == "" {
+		return tail
+	}
+	if !strings.HasSuffix(sent+tail, "\n") {
+		tail += "\n"
+	}
+	return tail + fence
+}
+
+// localePunctuationProcessor 按语言区域将中日文字后的半角标点替换为全角标点
+type localePunctuationProcessor struct{}
+
+var localePunctuation = map[string]map[rune]rune{
+	"zh": {',': '，', '.': '。', '!': '！', '?': '？', ':': '：', ';': '；'},
+	"ja": {',': '、', '.': '。', '!': '！', '?': '？', ':': '：', ';': '；'},
+}
+
+func (localePunctuationProcessor) Name() string { return "locale_punctuation" }
+
+func (localePunctuationProcessor) Description() string {
+	return "locale 为 zh/ja 时，将中日文字后的半角标点替换为全角标点（跳过代码）"
+}
+
+func (localePunctuationProcessor) Process(text, locale string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(locale), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	table := localePunctuation[lang]
+	if table == nil {
+		return text
+	}
+	return mapOutsideCodeFences(text, func(prose string) string {
+		// 反引号之间为行内代码，不做替换
+		parts := strings.Split(prose, "`")
+		for i := 0; i < len(parts); i += 2 {
+			parts[i] = fullWidthPunctuation(parts[i], table)
+		}
+		return strings.Join(parts, "`")
+	})
+}
+
+func fullWidthPunctuation(text string, table map[rune]rune) string {
+	runes := []rune(text)
+	out := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		full, ok := table[r]
+		if !ok || i == 0 || !isCJKRune(runes[i-1]) {
+			out = append(out, r)
+			continue
+		}
+		// 仅替换位于句读位置的标点：其后为结尾、空白或中日文字，避免误改 1.5、a.b 等
+		next := i + 1
+		if next < len(runes) && runes[next] != ' ' && runes[next] != '\n' && runes[next] != '\t' && !isCJKRune(runes[next]) {
+			out = append(out, r)
+			continue
+		}
+		out = append(out, full)
+		// 全角标点自带间距，去掉其后紧跟中日文字前的单个空格
+		if next+1 < len(runes) && runes[next] == ' ' && isCJKRune(runes[next+1]) {
+			i++
+		}
+	}
+	return string(out)
+}
+
+func isCJKRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// mapOutsideCodeFences 对围栏代码块以外的文本执行 fn，围栏行与代码块内容原样保留
+func mapOutsideCodeFences(text string, fn func(string) string) string {
+	var out, prose strings.Builder
+	fence := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		marker := codeFenceMarker(line)
+		if fence == "" && marker == "" {
+			prose.WriteString(line)
+			continue
+		}
+		if fence == "" {
+			out.WriteString(fn(prose.String()))
+			prose.Reset()
+			fence = marker
+		} else if closesCodeFence(line, marker, fence) {
+			fence = ""
+		}
+		out.WriteString(line)
+	}
+	if prose.Len() > 0 {
+		out.WriteString(fn(prose.String()))
+	}
+	return out.String()
+}
+
+// openCodeFence 文本结束时仍未闭合的围栏标记（如 ```），已全部闭合时返回空串
+func openCodeFence(text string) string {
+	fence := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		marker := codeFenceMarker(line)
+		if marker == "" {
+			continue
+		}
+		if fence == "" {
+			fence = marker
+		} else if closesCodeFence(line, marker, fence) {
+			fence = ""
+		}
+	}
+	return fence
+}
+
+// closesCodeFence 围栏行是否闭合当前代码块：字符相同、长度不短于起始标记且不带语言标识
+func closesCodeFence(line, marker, fence string) bool {
+	if marker == "" || marker[0] != fence[0] || len(marker) < len(fence) {
+		return false
+	}
+	rest := strings.TrimLeft(line, " ")[len(marker):]
+	return strings.TrimSpace(rest) == ""
+}
+
+// codeFenceMarker 返回行首的 ``` 或 ~~~ 围栏标记
+func codeFenceMarker(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return ""
+	}
+	ch := trimmed[0]
+	if ch != '`' && ch != '~' {
+		return ""
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == ch {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	return trimmed[:n]
+}
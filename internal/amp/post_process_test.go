@@ -0,0 +1,120 @@
+package amp
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/tidwall/gjson"
+)
+
+func newTestPostProcessing(t *testing.T, locale string, names ...string) *responsePostProcessing {
+	t.Helper()
+	pp := newResponsePostProcessing(&ProxyConfig{PostProcessing: model.PostProcessingSettings{Processors: names, Locale: locale}})
+	if pp == nil {
+		t.Fatalf("no processors resolved from %v", names)
+	}
+	return pp
+}
+
+func TestTrimTrailingWhitespace_KeepsCodeBlocks(t *testing.T) {
+	pp := newTestPostProcessing(t, "", "trim_trailing_whitespace")
+	in := "hello  \nworld\t\n```\ncode  \n```\n\n\n"
+	want := "hello\nworld\n```\ncode  \n```"
+	if got := pp.process(in); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestMarkdownNormalize(t *testing.T) {
+	pp := newTestPostProcessing(t, "", "markdown_normalize")
+	in := "a\r\n\r\n\r\n\r\nb\n```go\nx\n\n\n\ny"
+	want := "a\n\nb\n```go\nx\n\n\n\ny\n```"
+	if got := pp.process(in); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := pp.process("```\nx\n```python\n"); got != "```\nx\n```python\n```" {
+		t.Fatalf("a fence with an info string must not close the block, got %q", got)
+	}
+}
+
+func TestLocalePunctuation(t *testing.T) {
+	pp := newTestPostProcessing(t, "zh-CN", "locale_punctuation")
+	in := "你好, 世界! 版本 1.5 发布了. 用 `a, b` 调用?\n```\n注意, 代码\n```"
+	want := "你好，世界！版本 1.5 发布了。用 `a, b` 调用？\n```\n注意, 代码\n```"
+	if got := pp.process(in); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	en := newTestPostProcessing(t, "en-US", "locale_punctuation")
+	if got := en.process("你好, 世界"); got != "你好, 世界" {
+		t.Fatalf("non-CJK locale must not change punctuation, got %q", got)
+	}
+}
+
+func TestPostProcessJSONResponse(t *testing.T) {
+	pp := newTestPostProcessing(t, "", "trim_trailing_whitespace")
+	body := []byte(`{"content":[{"type":"thinking","thinking":"x  "},{"type":"text","text":"done  \n\n"}]}`)
+	out := pp.processJSONResponse(translator.FormatClaude, body)
+	if got := gjson.GetBytes(out, "content.1.text").String(); got != "done" {
+		t.Fatalf("unexpected text %q", got)
+	}
+	if got := gjson.GetBytes(out, "content.0.thinking").String(); got != "x  " {
+		t.Fatalf("thinking must be left untouched, got %q", got)
+	}
+}
+
+func TestPostProcessSSE_ClaudeFinalizesBlock(t *testing.T) {
+	ctx := WithProxyConfig(context.Background(), &ProxyConfig{
+		PostProcessing: model.PostProcessingSettings{Processors: []string{"trim_trailing_whitespace", "markdown_normalize"}},
+	})
+	stream := "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"```go\\nfmt.Println()  \\n\"}}\n\n" +
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"x \\n\\n\"}}\n\n" +
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n"
+
+	rc := newPostProcessSSEWrapper(ctx, io.NopCloser(strings.NewReader(stream)), translator.FormatClaude)
+	out, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var text strings.Builder
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			text.WriteString(gjson.Get(line[6:], "delta.text").String())
+		}
+	}
+	if want := "```go\nfmt.Println()  \nx\n```"; text.String() != want {
+		t.Fatalf("got %q, want %q", text.String(), want)
+	}
+}
+
+func TestPostProcessStream_SnapshotMatchesDeltas(t *testing.T) {
+	s := newPostProcessStream(newTestPostProcessing(t, "", "trim_trailing_whitespace", "markdown_normalize"))
+	full := "see:\n```\nx  \n\n"
+	var streamed strings.Builder
+	for _, delta := range []string{"see:\n", "```\nx", "  \n\n"} {
+		emit, _ := s.push("0", delta)
+		streamed.WriteString(emit)
+	}
+	rest, _ := s.flush("0")
+	streamed.WriteString(rest)
+
+	snapshot, _ := s.filter(full)
+	if streamed.String() != snapshot || snapshot != "see:\n```\nx\n```" {
+		t.Fatalf("streamed %q, snapshot %q", streamed.String(), snapshot)
+	}
+}
+
+func TestValidatePostProcessingSettings(t *testing.T) {
+	pp := NormalizePostProcessingSettings(model.PostProcessingSettings{Processors: []string{" markdown_normalize ", "markdown_normalize", ""}})
+	if len(pp.Processors) != 1 || ValidatePostProcessingSettings(pp) != nil {
+		t.Fatalf("unexpected normalized settings %+v", pp)
+	}
+	if err := ValidatePostProcessingSettings(model.PostProcessingSettings{Processors: []string{"nope"}}); err == nil {
+		t.Fatal("unknown processor should be rejected")
+	}
+}
@@ -9,10 +9,13 @@ import (
 type ProviderKind string
 
 const (
-	ProviderAnthropic       ProviderKind = "anthropic"
-	ProviderOpenAIChat      ProviderKind = "openai_chat"
-	ProviderOpenAIResponses ProviderKind = "openai_responses"
-	ProviderGemini          ProviderKind = "gemini"
+	ProviderAnthropic        ProviderKind = "anthropic"
+	ProviderOpenAIChat       ProviderKind = "openai_chat"
+	ProviderOpenAIResponses  ProviderKind = "openai_responses"
+	ProviderGemini           ProviderKind = "gemini"
+	ProviderOpenAIEmbeddings ProviderKind = "openai_embeddings"
+	ProviderOpenAIAudio      ProviderKind = "openai_audio"
+	ProviderOllama           ProviderKind = "ollama"
 )
 
 type ProviderInfo struct {
@@ -40,7 +43,7 @@ func ProviderInfoFromChannel(channel *model.Channel) ProviderInfo {
 		return ProviderInfo{Provider: ProviderAnthropic}
 	}
 
-	switch channel.Type {
+	switch channel.Type.Protocol() {
 	case model.ChannelTypeClaude:
 		return ProviderInfo{
 			Provider: ProviderAnthropic,
@@ -62,6 +65,15 @@ func ProviderInfoFromChannel(channel *model.Channel) ProviderInfo {
 			Provider: ProviderGemini,
 			Endpoint: "generate_content",
 		}
+	case model.ChannelTypeOllama:
+		endpoint := string(model.ChannelEndpointChat)
+		if channel.Endpoint == model.ChannelEndpointGenerate {
+			endpoint = string(model.ChannelEndpointGenerate)
+		}
+		return ProviderInfo{
+			Provider: ProviderOllama,
+			Endpoint: endpoint,
+		}
 	default:
 		return ProviderInfo{Provider: ProviderAnthropic}
 	}
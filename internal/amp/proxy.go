@@ -14,6 +14,9 @@ import (
 	"sync"
 	"time"
 
+	"ampmanager/internal/model"
+	"ampmanager/internal/tracing"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
@@ -35,6 +38,22 @@ type ProxyConfig struct {
 	Socks5Proxy       string
 	RateMultiplier    float64
 	GroupIDs          []string
+	// MaxRequestCostMicros 分组的单次请求费用上限，0 表示不限制
+	MaxRequestCostMicros int64
+	// PostProcessing 用户启用的响应后处理插件
+	PostProcessing model.PostProcessingSettings
+	// SystemPrompt 用户设置的系统提示词，模型调用时插入到请求的系统提示之前
+	SystemPrompt string
+	// GroupSystemPrompt 用户所在分组的强制系统提示词（多个分组按创建时间合并），插入在用户系统提示词之前
+	GroupSystemPrompt string
+	// Pipeline 用户所在分组配置的请求流水线，nil 表示未启用
+	Pipeline *model.RequestPipeline
+	// OnBehalfOf 下级实例转发的联邦请求的原始用户（签发方/用户），直接请求时为空
+	OnBehalfOf string
+	// APIKeyScopes 所用 API Key 的访问范围，nil 表示不限制
+	APIKeyScopes *model.APIKeyScopes
+	// RawPassthrough 管理员请求原样透传调试（见 raw_passthrough.go），不做映射、翻译、过滤与改写
+	RawPassthrough bool
 }
 
 func WithProxyConfig(ctx context.Context, cfg *ProxyConfig) context.Context {
@@ -306,7 +325,7 @@ func (t *Socks5AwareTransport) RoundTrip(req *http.Request) (*http.Response, err
 		return t.Base.RoundTrip(req)
 	}
 
-	retryTransport := NewRetryTransport(socks5Transport, t.Base.getConfig())
+	retryTransport := NewRetryTransport(tracing.Transport(socks5Transport, "amp.upstream"), t.Base.getConfig())
 	return retryTransport.RoundTrip(req)
 }
 
@@ -329,14 +348,14 @@ func CreateDynamicReverseProxy() *httputil.ReverseProxy {
 	// 使用针对 AI 流式请求优化的 Transport，解决 60 秒超时问题
 	streamingTransport := NewStreamingTransport()
 
-	// 初始化全局 RetryTransport
-	globalRetryTransport = NewRetryTransport(streamingTransport, DefaultRetryConfig())
+	// 初始化全局 RetryTransport，每次重试尝试记录独立的 client span
+	globalRetryTransport = NewRetryTransport(tracing.Transport(streamingTransport, "amp.upstream"), DefaultRetryConfig())
 
 	proxy := &httputil.ReverseProxy{
 		// 使用 SOCKS5 感知的 Transport，自动根据用户配置选择直连或走代理
 		Transport: &Socks5AwareTransport{Base: globalRetryTransport},
 		// FlushInterval 设为 -1 确保流式响应（SSE）立即刷新到客户端
-		// 避免缓冲导致 "request ended without sending any chunks" 错误
+		// 避免缓冲导致 "request ended without sending any chunks" 错误；开启刷新合并时由 ProxyHandler 包装的 Writer 合并刷新
 		FlushInterval: -1,
 		Director: func(req *http.Request) {
 			cfg := GetProxyConfig(req.Context())
@@ -370,8 +389,9 @@ func CreateDynamicReverseProxy() *httputil.ReverseProxy {
 				return
 			}
 
-			// Only create trace for model invocation requests
-			if IsModelInvocation(req.Method, req.URL.Path) {
+			// Only create trace for model invocation requests, subject to the request log policy
+			logLevel := requestLogLevelFor(req.Method, req.URL.Path)
+			if IsModelInvocation(req.Method, req.URL.Path) && logLevel != model.RequestLogOff {
 				trace := NewRequestTrace(
 					uuid.New().String(),
 					cfg.UserID,
@@ -381,6 +401,7 @@ func CreateDynamicReverseProxy() *httputil.ReverseProxy {
 				)
 				// Set provider info (amp upstream defaults to Anthropic)
 				trace.SetChannel("", string(ProviderAnthropic), cfg.UpstreamURL)
+				trace.SetSummaryOnly(logLevel == model.RequestLogSummary)
 				// Get model info from context if available
 				if modelInfo := GetModelInfo(req.Context()); modelInfo != nil {
 					trace.SetModels(modelInfo.OriginalModel, modelInfo.MappedModel)
@@ -398,7 +419,13 @@ func CreateDynamicReverseProxy() *httputil.ReverseProxy {
 
 				// Capture request detail for logging
 				if captureData := GetCaptureData(req.Context()); captureData != nil {
-					StoreRequestDetail(trace.RequestID, captureData.RequestHeaders, captureData.RequestBody)
+					if !trace.SummaryOnly() {
+						StoreRequestDetail(trace.RequestID, captureData.RequestHeaders, captureData.RequestBody)
+						StoreInjectedSystemPrompt(trace.RequestID, GetInjectedSystemPrompt(req.Context()))
+						StorePIIRedactions(trace.RequestID, GetPIIRedactions(req.Context()))
+					}
+					// 上游响应缺少用量时使用的输入估算值
+					trace.SetEstimatedInputTokens(estimateRequestTokens(captureData.RequestBody, traceEncoding(trace, ProviderAnthropic)))
 				}
 
 				log.Infof("amp proxy: model invocation %s %s -> %s", req.Method, req.URL.Path, req.URL.Host)
@@ -467,6 +494,8 @@ func modifyResponse(resp *http.Response) error {
 			}
 		}
 
+		resp.Body = newPostProcessSSEWrapper(resp.Request.Context(), resp.Body, formatForProvider(rctx.Provider.Provider))
+
 		pipeline := NewStreamingPipelineWithContext(resp.Request.Context())
 		if err := pipeline.ProcessStreamingResponse(resp, rctx); err != nil {
 			return err
@@ -549,6 +578,18 @@ func isStreamingResponse(resp *http.Response) bool {
 
 func errorHandler(rw http.ResponseWriter, req *http.Request, err error) {
 	log.Errorf("amp upstream proxy error for %s %s: %v", req.Method, req.URL.Path, err)
+	// 转发过程中请求体超出大小限制时返回 413，而不是上游错误
+	if isRequestBodyTooLarge(err) {
+		if trace := GetRequestTrace(req.Context()); trace != nil {
+			trace.SetError("request_body_too_large")
+			trace.SetResponse(http.StatusRequestEntityTooLarge)
+			if writer := GetLogWriter(); writer != nil {
+				writer.UpdateFromTrace(trace)
+			}
+		}
+		WriteErrorResponse(rw, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
 	// Update error log (pending record was already written in Director)
 	if trace := GetRequestTrace(req.Context()); trace != nil {
 		trace.SetError("upstream_request_failed")
@@ -569,41 +610,9 @@ func ProxyHandler(proxy *httputil.ReverseProxy) gin.HandlerFunc {
 			return
 		}
 		// Inject ResponseWriter into context for SSE keep-alive support
+		defer withStreamFlush(c, detectIncomingFormat(c.Request.URL.Path))()
 		ctx := WithResponseWriter(c.Request.Context(), c.Writer)
 		c.Request = c.Request.WithContext(ctx)
 		proxy.ServeHTTP(c.Writer, c.Request)
 	}
 }
-
-// filterAntropicBetaHeader removes the context-1m-2025-08-07 beta feature
-// This should ONLY be called for local/channel handling paths, NOT for ampcode.com proxy
-func filterAntropicBetaHeader(req *http.Request) {
-	betaHeader := req.Header.Get("Anthropic-Beta")
-	if betaHeader == "" {
-		return
-	}
-
-	filtered := filterBetaFeatures(betaHeader, "context-1m-2025-08-07")
-	if filtered != "" {
-		req.Header.Set("Anthropic-Beta", filtered)
-		log.Debugf("channel proxy: filtered Anthropic-Beta header: %s -> %s", betaHeader, filtered)
-	} else {
-		req.Header.Del("Anthropic-Beta")
-		log.Debugf("channel proxy: removed Anthropic-Beta header (was: %s)", betaHeader)
-	}
-}
-
-// filterBetaFeatures removes a specific feature from comma-separated beta features list
-func filterBetaFeatures(header, featureToRemove string) string {
-	features := strings.Split(header, ",")
-	filtered := make([]string, 0, len(features))
-
-	for _, feature := range features {
-		trimmed := strings.TrimSpace(feature)
-		if trimmed != "" && trimmed != featureToRemove {
-			filtered = append(filtered, trimmed)
-		}
-	}
-
-	return strings.Join(filtered, ",")
-}
@@ -0,0 +1,166 @@
+package amp
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// QuotaExhaustedHeader soft 模式下额度已用尽但仍放行时附加的响应头
+const QuotaExhaustedHeader = "X-AMP-Quota-Exhausted"
+
+// quotaErrorResponse 额度用尽时的错误响应：在标准错误格式上附带额度详情
+type quotaErrorResponse struct {
+	Error quotaErrorDetail `json:"error"`
+}
+
+type quotaErrorDetail struct {
+	ErrorDetail
+	Quota quotaErrorQuota `json:"quota"`
+}
+
+type quotaErrorQuota struct {
+	Sources          []model.BillingSource        `json:"sources"`
+	BalanceMicros    int64                        `json:"balanceMicros"`
+	HasSubscription  bool                         `json:"hasSubscription"`
+	ExhaustedWindows []model.QuotaExhaustedWindow `json:"exhaustedWindows"`
+	ResetsAt         *time.Time                   `json:"resetsAt,omitempty"`
+	RetryAfterSec    int                          `json:"retryAfterSec,omitempty"`
+}
+
+// BillingCheckMiddleware 模型调用、实时会话与批处理提交前检查用户的余额与订阅额度。
+// hard 模式下额度用尽时拒绝：订阅窗口会自动恢复时返回 429 与 Retry-After，否则返回 402；
+// soft 模式只记录日志并附加 X-AMP-Quota-Exhausted 响应头；计费影子模式下不检查
+func BillingCheckMiddleware() gin.HandlerFunc {
+	billingSvc := service.NewBillingService()
+	return func(c *gin.Context) {
+		// Only check for model invocation requests, realtime sessions and batch submissions (the ones that cost money)
+		if !IsModelInvocation(c.Request.Method, c.Request.URL.Path) && !isRealtimePath(c.Request.URL.Path) &&
+			!isBatchCreateRequest(c.Request.Method, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		cfg := GetProxyConfig(c.Request.Context())
+		if cfg == nil {
+			c.Next()
+			return
+		}
+
+		// RateMultiplier == 0 means free, skip billing check
+		if cfg.RateMultiplier == 0 {
+			c.Next()
+			return
+		}
+
+		// Shadow mode records costs without enforcing balances
+		if service.IsBillingShadowMode() {
+			c.Next()
+			return
+		}
+
+		mode := service.GetQuotaEnforcementConfig().Mode
+		if mode == model.QuotaEnforcementOff {
+			c.Next()
+			return
+		}
+
+		result, err := billingSvc.CheckQuota(cfg.UserID)
+		if err != nil {
+			log.Errorf("billing check: failed for user %s: %v", cfg.UserID, err)
+			c.Next()
+			return
+		}
+		if result.Allowed {
+			c.Next()
+			return
+		}
+
+		status, retryAfter, resp := quotaDenial(result, time.Now())
+		if mode == model.QuotaEnforcementSoft {
+			log.Warnf("billing check: user %s has no remaining quota (%s), allowed by soft mode", cfg.UserID, resp.Error.Code)
+			c.Header(QuotaExhaustedHeader, resp.Error.Code)
+			c.Next()
+			return
+		}
+
+		log.Warnf("billing check: rejected user %s: %s", cfg.UserID, resp.Error.Message)
+		if retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+		}
+		c.AbortWithStatusJSON(status, resp)
+	}
+}
+
+// quotaDenial 根据检查结果生成拒绝响应：用户使用订阅计费且订阅窗口会自动恢复时返回 429 与恢复前的秒数，
+// 否则（余额不足、总量额度用尽或没有订阅）返回 402
+func quotaDenial(result *model.QuotaCheckResult, now time.Time) (int, int, quotaErrorResponse) {
+	sources := []model.BillingSource{result.PrimarySource}
+	if result.SecondarySource != "" && result.SecondarySource != result.PrimarySource {
+		sources = append(sources, result.SecondarySource)
+	}
+	usesSubscription := false
+	for _, src := range sources {
+		if src == model.BillingSourceSubscription {
+			usesSubscription = true
+		}
+	}
+
+	quota := quotaErrorQuota{
+		Sources:          sources,
+		BalanceMicros:    result.BalanceMicros,
+		HasSubscription:  result.HasSubscription,
+		ExhaustedWindows: result.ExhaustedWindows,
+		ResetsAt:         result.ResetsAt,
+	}
+	if quota.ExhaustedWindows == nil {
+		quota.ExhaustedWindows = []model.QuotaExhaustedWindow{}
+	}
+
+	if usesSubscription && result.ResetsAt != nil {
+		retryAfter := int(math.Ceil(result.ResetsAt.Sub(now).Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		quota.RetryAfterSec = retryAfter
+		return http.StatusTooManyRequests, retryAfter, quotaErrorResponse{Error: quotaErrorDetail{
+			ErrorDetail: ErrorDetail{
+				Message: fmt.Sprintf("订阅额度已用尽（%s），将于 %s 恢复",
+					describeExhaustedWindows(result.ExhaustedWindows), result.ResetsAt.UTC().Format(time.RFC3339)),
+				Type: MapHTTPStatusToErrorType(http.StatusTooManyRequests),
+				Code: "subscription_quota_exhausted",
+			},
+			Quota: quota,
+		}}
+	}
+
+	message := "余额和订阅额度均不足，请充值后再使用"
+	if len(result.ExhaustedWindows) > 0 {
+		message = fmt.Sprintf("订阅额度已用尽（%s）且不会在订阅期内恢复，余额不足，请充值后再使用", describeExhaustedWindows(result.ExhaustedWindows))
+	}
+	return http.StatusPaymentRequired, 0, quotaErrorResponse{Error: quotaErrorDetail{
+		ErrorDetail: ErrorDetail{
+			Message: message,
+			Type:    "insufficient_quota",
+			Code:    "insufficient_quota",
+		},
+		Quota: quota,
+	}}
+}
+
+func describeExhaustedWindows(windows []model.QuotaExhaustedWindow) string {
+	names := make([]string, 0, len(windows))
+	for _, w := range windows {
+		names = append(names, string(w.LimitType))
+	}
+	return strings.Join(names, ", ")
+}
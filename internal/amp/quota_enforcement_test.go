@@ -0,0 +1,90 @@
+package amp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+)
+
+func TestQuotaDenialSubscriptionWindow(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	resetsAt := now.Add(90 * time.Minute)
+	result := &model.QuotaCheckResult{
+		PrimarySource:   model.BillingSourceSubscription,
+		SecondarySource: model.BillingSourceBalance,
+		HasSubscription: true,
+		ExhaustedWindows: []model.QuotaExhaustedWindow{
+			{LimitType: model.LimitTypeRolling5h, WindowMode: model.WindowModeFixed, LimitMicros: 1_000_000, UsedMicros: 1_200_000, ResetsAt: &resetsAt},
+		},
+		ResetsAt: &resetsAt,
+	}
+
+	status, retryAfter, resp := quotaDenial(result, now)
+	if status != http.StatusTooManyRequests || retryAfter != 5400 {
+		t.Fatalf("got status %d retryAfter %d", status, retryAfter)
+	}
+	if resp.Error.Code != "subscription_quota_exhausted" || !strings.Contains(resp.Error.Message, "rolling_5h") {
+		t.Fatalf("unexpected error: %+v", resp.Error.ErrorDetail)
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Error struct {
+			Code  string `json:"code"`
+			Quota struct {
+				ExhaustedWindows []struct {
+					LimitType string `json:"limitType"`
+				} `json:"exhaustedWindows"`
+				ResetsAt      string `json:"resetsAt"`
+				RetryAfterSec int    `json:"retryAfterSec"`
+			} `json:"quota"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Error.Code != "subscription_quota_exhausted" || len(decoded.Error.Quota.ExhaustedWindows) != 1 ||
+		decoded.Error.Quota.ResetsAt == "" || decoded.Error.Quota.RetryAfterSec != 5400 {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+func TestQuotaDenialPaymentRequired(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name   string
+		result *model.QuotaCheckResult
+	}{
+		{"balance only", &model.QuotaCheckResult{PrimarySource: model.BillingSourceBalance}},
+		{"total window", &model.QuotaCheckResult{
+			PrimarySource:    model.BillingSourceSubscription,
+			SecondarySource:  model.BillingSourceBalance,
+			HasSubscription:  true,
+			ExhaustedWindows: []model.QuotaExhaustedWindow{{LimitType: model.LimitTypeTotal, LimitMicros: 1, UsedMicros: 1}},
+		}},
+		{"no subscription", &model.QuotaCheckResult{PrimarySource: model.BillingSourceSubscription, SecondarySource: model.BillingSourceBalance}},
+	}
+	for _, tc := range cases {
+		status, retryAfter, resp := quotaDenial(tc.result, now)
+		if status != http.StatusPaymentRequired || retryAfter != 0 || resp.Error.Code != "insufficient_quota" {
+			t.Errorf("%s: got status %d retryAfter %d code %s", tc.name, status, retryAfter, resp.Error.Code)
+		}
+		if resp.Error.Quota.ExhaustedWindows == nil {
+			t.Errorf("%s: exhaustedWindows should be an empty list", tc.name)
+		}
+	}
+
+	// 订阅窗口会恢复，但用户未使用订阅计费时仍按余额不足处理
+	resetsAt := now.Add(time.Hour)
+	status, _, _ := quotaDenial(&model.QuotaCheckResult{PrimarySource: model.BillingSourceBalance, ResetsAt: &resetsAt}, now)
+	if status != http.StatusPaymentRequired {
+		t.Errorf("balance-only user should get 402, got %d", status)
+	}
+}
@@ -0,0 +1,245 @@
+package amp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// rateLimitBucketIdleTTL 超过该时间未使用的令牌桶已回满，直接丢弃
+const rateLimitBucketIdleTTL = 10 * time.Minute
+
+// tokenBucket 按分钟额度匀速补充的令牌桶；level 可为负，表示超出额度的用量需要先补回
+type tokenBucket struct {
+	capacity  float64
+	perSecond float64
+	level     float64
+	last      time.Time
+}
+
+func newTokenBucket(perMinute float64, now time.Time) tokenBucket {
+	return tokenBucket{capacity: perMinute, perSecond: perMinute / 60, level: perMinute, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.level = math.Min(b.capacity, b.level+elapsed*b.perSecond)
+	}
+	b.last = now
+}
+
+// wait 取得 need 个令牌前需要等待的时间
+func (b *tokenBucket) wait(need float64, now time.Time) time.Duration {
+	b.refill(now)
+	if b.level >= need {
+		return 0
+	}
+	return time.Duration((need - b.level) / b.perSecond * float64(time.Second))
+}
+
+// rateLimitBucket 单条限流规则的请求数与 token 数令牌桶
+type rateLimitBucket struct {
+	rpm      int
+	tpm      int64
+	requests tokenBucket
+	tokens   tokenBucket
+	lastUsed time.Time
+}
+
+var rateLimitState struct {
+	sync.Mutex
+	buckets   map[string]*rateLimitBucket
+	lastPrune time.Time
+}
+
+// rateLimitBucketFor 返回规则对应的令牌桶，规则额度变更后重新计算
+func rateLimitBucketFor(limit *model.RateLimit, now time.Time) (string, *rateLimitBucket) {
+	if rateLimitState.buckets == nil {
+		rateLimitState.buckets = make(map[string]*rateLimitBucket)
+	}
+	if now.Sub(rateLimitState.lastPrune) > time.Minute {
+		for key, b := range rateLimitState.buckets {
+			if now.Sub(b.lastUsed) > rateLimitBucketIdleTTL {
+				delete(rateLimitState.buckets, key)
+			}
+		}
+		rateLimitState.lastPrune = now
+	}
+
+	key := limit.Scope + ":" + limit.TargetID
+	b, ok := rateLimitState.buckets[key]
+	if !ok || b.rpm != limit.RequestsPerMinute || b.tpm != limit.TokensPerMinute {
+		b = &rateLimitBucket{rpm: limit.RequestsPerMinute, tpm: limit.TokensPerMinute}
+		if b.rpm > 0 {
+			b.requests = newTokenBucket(float64(b.rpm), now)
+		}
+		if b.tpm > 0 {
+			b.tokens = newTokenBucket(float64(b.tpm), now)
+		}
+		rateLimitState.buckets[key] = b
+	}
+	b.lastUsed = now
+	return key, b
+}
+
+// rateLimitDenial 被拒绝时命中的规则与建议的重试时间
+type rateLimitDenial struct {
+	limit      *model.RateLimit
+	tokens     bool
+	retryAfter time.Duration
+}
+
+// rateLimitLease 已放行请求占用的令牌桶，响应结束后按实际 token 用量扣减
+type rateLimitLease struct {
+	keys []string
+
+	mu    sync.Mutex
+	trace *RequestTrace
+}
+
+// acquireRateLimit 检查所有规则，全部有余量时各扣除一次请求；任一规则不足时不扣减并返回等待最久的一条
+func acquireRateLimit(limits []*model.RateLimit, now time.Time) (*rateLimitLease, *rateLimitDenial) {
+	rateLimitState.Lock()
+	defer rateLimitState.Unlock()
+
+	var denial *rateLimitDenial
+	lease := &rateLimitLease{}
+	buckets := make([]*rateLimitBucket, 0, len(limits))
+	for _, limit := range limits {
+		key, b := rateLimitBucketFor(limit, now)
+		if b.rpm > 0 {
+			if wait := b.requests.wait(1, now); wait > 0 && (denial == nil || wait > denial.retryAfter) {
+				denial = &rateLimitDenial{limit: limit, retryAfter: wait}
+			}
+		}
+		if b.tpm > 0 {
+			// token 用量在响应结束后才知道，桶内有余量即放行
+			if wait := b.tokens.wait(1, now); wait > 0 && (denial == nil || wait > denial.retryAfter) {
+				denial = &rateLimitDenial{limit: limit, tokens: true, retryAfter: wait}
+			}
+		}
+		lease.keys = append(lease.keys, key)
+		buckets = append(buckets, b)
+	}
+	if denial != nil {
+		return nil, denial
+	}
+	for _, b := range buckets {
+		if b.rpm > 0 {
+			b.requests.level--
+		}
+	}
+	return lease, nil
+}
+
+// attach 记录本次请求的追踪信息，由 WithRequestTrace 调用
+func (l *rateLimitLease) attach(trace *RequestTrace) {
+	l.mu.Lock()
+	l.trace = trace
+	l.mu.Unlock()
+}
+
+// settle 按响应的实际 token 用量扣减各规则的 token 桶
+func (l *rateLimitLease) settle(now time.Time) {
+	l.mu.Lock()
+	trace := l.trace
+	l.mu.Unlock()
+	if trace == nil {
+		return
+	}
+
+	trace.mu.Lock()
+	var used int
+	for _, n := range []*int{trace.InputTokens, trace.OutputTokens, trace.CacheCreationInputTokens} {
+		if n != nil {
+			used += *n
+		}
+	}
+	trace.mu.Unlock()
+	if used <= 0 {
+		return
+	}
+
+	rateLimitState.Lock()
+	defer rateLimitState.Unlock()
+	for _, key := range l.keys {
+		if b, ok := rateLimitState.buckets[key]; ok && b.tpm > 0 {
+			b.tokens.refill(now)
+			b.tokens.level -= float64(used)
+			b.lastUsed = now
+		}
+	}
+}
+
+type rateLimitLeaseKey struct{}
+
+func withRateLimitLease(ctx context.Context, lease *rateLimitLease) context.Context {
+	return context.WithValue(ctx, rateLimitLeaseKey{}, lease)
+}
+
+func getRateLimitLease(ctx context.Context) *rateLimitLease {
+	if lease, ok := ctx.Value(rateLimitLeaseKey{}).(*rateLimitLease); ok {
+		return lease
+	}
+	return nil
+}
+
+// RateLimitMiddleware 按用户、API Key 与分组的令牌桶限流（每分钟请求数 / token 数），仅作用于模型调用。
+// 令牌桶状态保存在进程内，多实例部署时每个实例分别计算
+func RateLimitMiddleware() gin.HandlerFunc {
+	rateLimitService := service.NewRateLimitService()
+	return func(c *gin.Context) {
+		cfg := GetProxyConfig(c.Request.Context())
+		if cfg == nil || !IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		limits := rateLimitService.LimitsFor(cfg.UserID, cfg.APIKeyID, cfg.GroupIDs)
+		if len(limits) == 0 {
+			c.Next()
+			return
+		}
+
+		lease, denial := acquireRateLimit(limits, time.Now())
+		if denial != nil {
+			retryAfter := int(math.Ceil(denial.retryAfter.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			var msg string
+			if denial.tokens {
+				msg = fmt.Sprintf("rate limit exceeded: %s limit of %d tokens per minute", rateLimitScopeLabel(denial.limit.Scope), denial.limit.TokensPerMinute)
+			} else {
+				msg = fmt.Sprintf("rate limit exceeded: %s limit of %d requests per minute", rateLimitScopeLabel(denial.limit.Scope), denial.limit.RequestsPerMinute)
+			}
+			log.Infof("rate limit: rejected %s %s for user %s (%s %s, retry after %ds)", c.Request.Method, c.Request.URL.Path, cfg.UserID, denial.limit.Scope, denial.limit.TargetID, retryAfter)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, NewStandardError(http.StatusTooManyRequests, msg))
+			return
+		}
+
+		c.Request = c.Request.WithContext(withRateLimitLease(c.Request.Context(), lease))
+		c.Next()
+		// 流式响应在 c.Next() 返回时已转发完毕，此时 trace 中为最终用量
+		lease.settle(time.Now())
+	}
+}
+
+func rateLimitScopeLabel(scope string) string {
+	switch scope {
+	case model.RateLimitScopeAPIKey:
+		return "api key"
+	default:
+		return scope
+	}
+}
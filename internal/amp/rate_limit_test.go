@@ -0,0 +1,99 @@
+package amp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+)
+
+func resetRateLimitState() {
+	rateLimitState.Lock()
+	rateLimitState.buckets = nil
+	rateLimitState.Unlock()
+}
+
+func TestAcquireRateLimit_RequestsPerMinute(t *testing.T) {
+	resetRateLimitState()
+	now := time.Now()
+	limits := []*model.RateLimit{{Scope: model.RateLimitScopeUser, TargetID: "u1", RequestsPerMinute: 2}}
+
+	for i := 0; i < 2; i++ {
+		if _, denial := acquireRateLimit(limits, now); denial != nil {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	_, denial := acquireRateLimit(limits, now)
+	if denial == nil || denial.tokens {
+		t.Fatalf("third request should hit the request limit, got %+v", denial)
+	}
+	if denial.retryAfter != 30*time.Second {
+		t.Fatalf("retry after = %v, want 30s", denial.retryAfter)
+	}
+	if _, denial := acquireRateLimit(limits, now.Add(30*time.Second)); denial != nil {
+		t.Fatal("bucket should refill one request every 30s")
+	}
+}
+
+func TestAcquireRateLimit_DeniedRequestConsumesNothing(t *testing.T) {
+	resetRateLimitState()
+	now := time.Now()
+	user := &model.RateLimit{Scope: model.RateLimitScopeUser, TargetID: "u1", RequestsPerMinute: 10}
+	key := &model.RateLimit{Scope: model.RateLimitScopeAPIKey, TargetID: "k1", RequestsPerMinute: 1}
+
+	if _, denial := acquireRateLimit([]*model.RateLimit{user, key}, now); denial != nil {
+		t.Fatal("first request should be allowed")
+	}
+	for i := 0; i < 5; i++ {
+		if _, denial := acquireRateLimit([]*model.RateLimit{user, key}, now); denial == nil || denial.limit != key {
+			t.Fatalf("api key limit should reject, got %+v", denial)
+		}
+	}
+	rateLimitState.Lock()
+	level := rateLimitState.buckets["user:u1"].requests.level
+	rateLimitState.Unlock()
+	if level != 9 {
+		t.Fatalf("rejected requests must not consume the user bucket, level = %v", level)
+	}
+}
+
+func TestRateLimitLease_SettlesTokenUsage(t *testing.T) {
+	resetRateLimitState()
+	now := time.Now()
+	limits := []*model.RateLimit{{Scope: model.RateLimitScopeGroup, TargetID: "g1", TokensPerMinute: 600}}
+
+	lease, denial := acquireRateLimit(limits, now)
+	if denial != nil {
+		t.Fatal("first request should be allowed")
+	}
+	ctx := withRateLimitLease(context.Background(), lease)
+	trace := &RequestTrace{}
+	WithRequestTrace(ctx, trace)
+	input, output, cacheRead := 500, 200, 1000
+	trace.InputTokens, trace.OutputTokens, trace.CacheReadInputTokens = &input, &output, &cacheRead
+	lease.settle(now)
+
+	_, denial = acquireRateLimit(limits, now)
+	if denial == nil || !denial.tokens {
+		t.Fatalf("token bucket should be exhausted, got %+v", denial)
+	}
+	// 超出 100 token，需补回至 1 个令牌：101 / 10 每秒
+	if denial.retryAfter != 10100*time.Millisecond {
+		t.Fatalf("retry after = %v, want 10.1s", denial.retryAfter)
+	}
+}
+
+func TestRateLimitBucket_ResetsWhenLimitChanges(t *testing.T) {
+	resetRateLimitState()
+	now := time.Now()
+	limit := &model.RateLimit{Scope: model.RateLimitScopeUser, TargetID: "u1", RequestsPerMinute: 1}
+	acquireRateLimit([]*model.RateLimit{limit}, now)
+	if _, denial := acquireRateLimit([]*model.RateLimit{limit}, now); denial == nil {
+		t.Fatal("second request should be rejected")
+	}
+	raised := &model.RateLimit{Scope: model.RateLimitScopeUser, TargetID: "u1", RequestsPerMinute: 5}
+	if _, denial := acquireRateLimit([]*model.RateLimit{raised}, now); denial != nil {
+		t.Fatal("raising the limit should take effect immediately")
+	}
+}
@@ -0,0 +1,340 @@
+package amp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+	"ampmanager/internal/translator"
+	"ampmanager/internal/translator/filters"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// 原样透传调试模式：管理员的 API Key 在请求中携带 X-AMP-Raw-Passthrough: 1 时，该请求不做模型映射、
+// 系统提示词注入、流水线、翻译、过滤与改写，请求体按字节原样发往所选渠道，上游响应原样返回（分组强制系统提示词与转发前 PII 脱敏仍然执行）；
+// 响应头 X-AMP-Raw-Passthrough-Skipped 列出常规处理下会应用的步骤，用于区分问题出在 AMP-Manager 还是上游
+const (
+	RawPassthroughHeader        = "X-AMP-Raw-Passthrough"
+	RawPassthroughSkippedHeader = "X-AMP-Raw-Passthrough-Skipped"
+)
+
+// RawPassthroughMiddleware 识别原样透传请求头并校验权限，需放在 APIKeyAuthMiddleware 之后。
+// 请求头在转发前移除；非管理员返回 403，不支持的接口返回 400
+func RawPassthroughMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.GetHeader(RawPassthroughHeader)
+		if value == "" {
+			c.Next()
+			return
+		}
+		c.Request.Header.Del(RawPassthroughHeader)
+		if !isTruthyHeader(value) {
+			c.Next()
+			return
+		}
+
+		proxyCfg := GetProxyConfig(c.Request.Context())
+		if proxyCfg == nil || proxyCfg.APIKeyID == "" || !isAdminUser(proxyCfg.UserID) {
+			resp := NewStandardError(http.StatusForbidden, "raw passthrough is only available to admin api keys")
+			resp.Error.Code = "raw_passthrough_forbidden"
+			c.AbortWithStatusJSON(http.StatusForbidden, resp)
+			return
+		}
+		path := c.Request.URL.Path
+		// /api/internal 固定转发到 ampcode.com，不经过渠道
+		supported := IsModelInvocation(c.Request.Method, path) || (c.Request.Method == http.MethodPost && isTokenCountPath(path))
+		if !supported || strings.HasPrefix(path, "/api/internal") {
+			resp := NewStandardError(http.StatusBadRequest, "raw passthrough only supports model invocation and token count requests")
+			resp.Error.Code = "raw_passthrough_unsupported"
+			c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		proxyCfg.RawPassthrough = true
+		log.Infof("raw passthrough: user %s %s %s", proxyCfg.UserID, c.Request.Method, path)
+		c.Next()
+	}
+}
+
+// IsRawPassthrough 当前请求是否为原样透传调试请求
+func IsRawPassthrough(c *gin.Context) bool {
+	cfg := GetProxyConfig(c.Request.Context())
+	return cfg != nil && cfg.RawPassthrough
+}
+
+// RawPassthroughSkipMiddleware 原样透传请求跳过会改写请求或直接返回响应的中间件
+func RawPassthroughSkipMiddleware(inner gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsRawPassthrough(c) {
+			c.Next()
+			return
+		}
+		inner(c)
+	}
+}
+
+// abortRawPassthroughNoChannel 原样透传只支持渠道转发，未选中渠道（原生模式或没有渠道承接该模型）时拒绝，
+// 避免悄悄改走 ampcode.com 上游
+func abortRawPassthroughNoChannel(c *gin.Context) {
+	resp := NewStandardError(http.StatusBadRequest, "raw passthrough requires a request routed to a channel")
+	resp.Error.Code = "raw_passthrough_no_channel"
+	c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+}
+
+func isTruthyHeader(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+func isAdminUser(userID string) bool {
+	user, err := userRepo.GetByID(userID)
+	if err != nil {
+		log.Warnf("raw passthrough: failed to load user %s: %v", userID, err)
+		return false
+	}
+	return user != nil && user.IsAdmin
+}
+
+// serveRawPassthrough 把请求原样转发到渠道：路径只去掉本地路由前缀，查询参数（客户端凭据 key 除外）与请求体不变，
+// 请求头只替换客户端凭据为渠道认证并附加渠道自定义请求头；不做故障转移与重试。
+// 请求仍按常规记录日志并按上游返回的用量计费
+func serveRawPassthrough(c *gin.Context, channelCfg *ChannelConfig) {
+	channel := channelCfg.Channel
+	proxyCfg := GetProxyConfig(c.Request.Context())
+
+	var body []byte
+	if c.Request.Body != nil {
+		limit := requestBodyLimit(c.Request.URL.Path)
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+		c.Request.Body.Close()
+		if int64(len(data)) > limit || isRequestBodyTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, NewStandardError(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit)))
+			return
+		}
+		if err != nil {
+			log.Errorf("raw passthrough: failed to read request body: %v", err)
+			c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to read request body"))
+			return
+		}
+		body = data
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+	}
+
+	target, err := rawPassthroughURL(channel, c.Request)
+	if err != nil {
+		log.Errorf("raw passthrough: failed to build upstream URL: %v", err)
+		c.JSON(http.StatusInternalServerError, NewStandardError(http.StatusInternalServerError, "failed to build upstream URL"))
+		return
+	}
+	skipped := rawPassthroughSkipped(c, proxyCfg, channel, channelCfg.Model, body, target)
+
+	providerInfo := ProviderInfoFromChannel(channel)
+	var trace *RequestTrace
+	logLevel := requestLogLevelFor(c.Request.Method, c.Request.URL.Path)
+	if IsModelInvocation(c.Request.Method, c.Request.URL.Path) && logLevel != model.RequestLogOff {
+		trace = NewRequestTrace(uuid.New().String(), proxyCfg.UserID, proxyCfg.APIKeyID, c.Request.Method, c.Request.URL.Path)
+		trace.SetChannel(channel.ID, string(channel.Type), channel.BaseURL)
+		trace.SetModels(channelCfg.Model, channelCfg.Model)
+		trace.SetSummaryOnly(logLevel == model.RequestLogSummary)
+		trace.SetEstimatedInputTokens(estimateRequestTokens(body, usageEncoding(channelCfg.Model, providerInfo.Provider)))
+		c.Request = c.Request.WithContext(WithRequestTrace(c.Request.Context(), trace))
+		if writer := GetLogWriter(); writer != nil {
+			writer.WritePendingFromTrace(trace)
+		}
+		if captureData := GetCaptureData(c.Request.Context()); captureData != nil && !trace.SummaryOnly() {
+			StoreRequestDetail(trace.RequestID, captureData.RequestHeaders, captureData.RequestBody)
+			StoreInjectedSystemPrompt(trace.RequestID, GetInjectedSystemPrompt(c.Request.Context()))
+			StorePIIRedactions(trace.RequestID, GetPIIRedactions(c.Request.Context()))
+		}
+	}
+	var federationUser string
+	if channel.FederationIssuer != "" {
+		federationUser = federationOnBehalfOf(proxyCfg)
+	}
+	log.Infof("raw passthrough: %s %s -> %s (model: %s)", c.Request.Method, c.Request.URL.Path, sanitizeURL(target.String()), channelCfg.Model)
+
+	proxy := &httputil.ReverseProxy{
+		Transport: channelTransport(channel),
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = target.Path
+			req.URL.RawPath = ""
+			req.URL.RawQuery = target.RawQuery
+			req.Host = target.Host
+
+			req.Header.Del("Authorization")
+			req.Header.Del("X-Api-Key")
+			req.Header.Del("X-Goog-Api-Key")
+			applyChannelAuth(channel, req)
+			var headersMap map[string]string
+			if err := json.Unmarshal([]byte(channel.HeadersJSON), &headersMap); err == nil {
+				for k, v := range headersMap {
+					req.Header.Set(k, v)
+				}
+			}
+			signChannelRequest(channel, req, federationUser)
+		},
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			resp.Header.Set(headerAMPChannelID, channel.ID)
+			resp.Header.Set(RawPassthroughSkippedHeader, strings.Join(skipped, ", "))
+			if trace == nil {
+				return nil
+			}
+			resp.Header.Set(headerAMPRequestID, trace.RequestID)
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				trace.SetError("upstream_error")
+			} else if resp.Header.Get("Content-Encoding") == "" {
+				isStreaming := strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream")
+				resp.Body = WrapResponseBodyForTokenExtraction(resp.Body, isStreaming, trace, providerInfo)
+			}
+			if !trace.SummaryOnly() {
+				resp.Body = NewResponseCaptureWrapper(resp.Request.Context(), resp.Body, trace.RequestID, resp.Header)
+			}
+			resp.Body = NewLoggingBodyWrapper(resp.Body, trace, resp.StatusCode, resp.Request.Context())
+			return nil
+		},
+		ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
+			log.Errorf("raw passthrough: upstream request failed: %v", err)
+			if trace != nil {
+				trace.SetError("upstream_request_failed")
+				trace.SetResponse(http.StatusBadGateway)
+				if writer := GetLogWriter(); writer != nil {
+					writer.UpdateFromTrace(trace)
+				}
+			}
+			rw.Header().Set(RawPassthroughSkippedHeader, strings.Join(skipped, ", "))
+			WriteErrorResponse(rw, http.StatusBadGateway, "Upstream request failed: "+SanitizeError(err))
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// rawPassthroughURL 渠道地址加上去掉本地路由前缀（/api/provider/:provider、/api/internal）后的原始路径与查询参数
+func rawPassthroughURL(channel *model.Channel, req *http.Request) (*url.URL, error) {
+	if channel.BaseURL == "" {
+		return nil, errors.New("channel has no base url")
+	}
+	target, err := url.Parse(channel.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	target.Path = strings.TrimSuffix(target.Path, "/") + normalizeProviderPath(req.URL.Path)
+	target.RawQuery = stripClientKeyQuery(req.URL.RawQuery)
+	return target, nil
+}
+
+// rawPassthroughSkipped 列出常规处理下会应用到该请求的步骤，只做判断，不修改请求
+func rawPassthroughSkipped(c *gin.Context, proxyCfg *ProxyConfig, channel *model.Channel, modelName string, body []byte, target *url.URL) []string {
+	var skipped []string
+	path := c.Request.URL.Path
+	invocation := IsModelInvocation(c.Request.Method, path)
+
+	if proxyCfg.ModelMappingsJSON != "" && modelName != "" {
+		var mappings []model.ModelMapping
+		if err := json.Unmarshal([]byte(proxyCfg.ModelMappingsJSON), &mappings); err == nil {
+			if result := applyMappingWithHeaders(modelName, mappings, c.GetHeader); result.Applied {
+				skipped = append(skipped, "model-mapping="+result.OriginalModel+">"+result.MappedModel)
+			}
+		}
+	}
+	if proxyCfg.SystemPrompt != "" {
+		skipped = append(skipped, "system-prompt")
+	}
+	if proxyCfg.Pipeline != nil && invocation {
+		skipped = append(skipped, "pipeline")
+	}
+	if GetToolLoopConfig().Enabled && invocation {
+		skipped = append(skipped, "tool-loop-guard")
+	}
+	if isTokenCountPath(path) {
+		skipped = append(skipped, "token-count-cache")
+	}
+
+	incoming := detectIncomingFormat(path)
+	outgoing := requestChannelFormat(channel, incoming)
+	if needsFormatConversion(incoming, outgoing) {
+		skipped = append(skipped, fmt.Sprintf("translation=%s>%s", incoming, outgoing))
+	}
+	if len(body) > 0 {
+		if filtered, err := filters.ApplyFilters(outgoing, body); err == nil && !bytes.Equal(filtered, body) {
+			skipped = append(skipped, "request-filters")
+		}
+		if outgoing == translator.FormatClaude {
+			if _, injected := ensureClaudeMetadataUserID(body, c.Request.Header.Get("User-Agent"), channel.APIKey); injected {
+				skipped = append(skipped, "claude-metadata")
+			}
+			if _, _, changed := PrefixClaudeToolNamesWithMap(body); changed {
+				skipped = append(skipped, "claude-tool-prefix")
+			}
+		}
+		var payload struct {
+			Stream bool `json:"stream"`
+		}
+		_ = json.Unmarshal(body, &payload)
+		if !payload.Stream && shouldForceUpstreamStream(incoming, path) {
+			skipped = append(skipped, "force-stream")
+		}
+		if outgoing == translator.FormatOpenAIChat && payload.Stream {
+			skipped = append(skipped, "stream-options")
+		}
+	}
+
+	if normal, err := buildUpstreamURL(channel, c.Request); err == nil {
+		if parsed, err := url.Parse(normal); err == nil {
+			query := parsed.Query()
+			query.Del("key")
+			if parsed.Path != target.Path || query.Encode() != target.Query().Encode() {
+				skipped = append(skipped, "upstream-url="+parsed.Path)
+			}
+		}
+	}
+	if c.Request.Header.Get("Anthropic-Beta") != "" {
+		if _, removed := filterAnthropicBetas(c.Request.Header.Get("Anthropic-Beta"), service.ChannelAnthropicBetaPolicy(channel)); len(removed) > 0 {
+			skipped = append(skipped, "anthropic-beta-policy")
+		}
+	}
+	headerPolicy := service.ChannelHeaderPolicy(channel)
+	if headerPolicy.StripClientHeaders || len(headerPolicy.Remove) > 0 {
+		skipped = append(skipped, "header-policy")
+	}
+	if headerPolicy.UserAgent != "" || channel.Type == model.ChannelTypeOpenAI {
+		skipped = append(skipped, "user-agent")
+	}
+	if channel.SimulateCLI && channel.Type.Protocol() == model.ChannelTypeClaude {
+		skipped = append(skipped, "cli-simulation")
+	}
+
+	if invocation {
+		if GetOutputFilterConfig().Enabled {
+			skipped = append(skipped, "output-filter")
+		}
+		if newResponsePostProcessing(proxyCfg) != nil {
+			skipped = append(skipped, "post-processing")
+		}
+	}
+	respCfg := GetResponseHeaderConfig()
+	if _, ok := respCfg.Formats[string(channel.Type.Protocol())]; ok || respCfg.InjectHeaders {
+		skipped = append(skipped, "response-headers")
+	}
+	if len(skipped) == 0 {
+		return []string{"none"}
+	}
+	return skipped
+}
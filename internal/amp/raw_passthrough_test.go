@@ -0,0 +1,223 @@
+package amp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rawPassthroughEngine 模拟路由中原样透传请求经过的中间件链，最终由 serveRawPassthrough 转发到 upstream
+func rawPassthroughEngine(upstream string, cfg *ProxyConfig, middlewares ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg.RawPassthrough = true
+	channel := &model.Channel{ID: "ch1", Type: model.ChannelTypeOpenAI, BaseURL: upstream, APIKey: "sk-upstream"}
+
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithProxyConfig(c.Request.Context(), cfg))
+		c.Next()
+	})
+	engine.Use(middlewares...)
+	engine.POST("/*path", func(c *gin.Context) {
+		serveRawPassthrough(c, &ChannelConfig{Channel: channel, Model: "gpt-4o"})
+	})
+	return engine
+}
+
+func TestRawPassthroughURL(t *testing.T) {
+	cases := []struct {
+		base, path, want string
+	}{
+		{"https://api.example.com/", "/v1/chat/completions?x=1", "https://api.example.com/v1/chat/completions?x=1"},
+		{"https://proxy.example.com/anthropic", "/api/provider/anthropic/v1/messages", "https://proxy.example.com/anthropic/v1/messages"},
+		// Gemini 路径保持客户端原样，不补 alt=sse 也不改写为流式接口
+		{"https://gemini.example.com", "/api/provider/google/v1beta/models/gemini-pro:generateContent", "https://gemini.example.com/v1beta/models/gemini-pro:generateContent"},
+		// 客户端以 ?key= 携带的 AMP API Key 不转发，其余查询参数保留
+		{"https://gemini.example.com", "/api/provider/google/v1beta/models/gemini-pro:streamGenerateContent?key=amp-secret&alt=sse", "https://gemini.example.com/v1beta/models/gemini-pro:streamGenerateContent?alt=sse"},
+		{"https://gemini.example.com", "/v1beta/models?key=amp-secret", "https://gemini.example.com/v1beta/models"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("POST", tc.path, nil)
+		got, err := rawPassthroughURL(&model.Channel{BaseURL: tc.base}, req)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		if got.String() != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.path, got, tc.want)
+		}
+	}
+	if _, err := rawPassthroughURL(&model.Channel{}, httptest.NewRequest("POST", "/v1/messages", nil)); err == nil {
+		t.Error("expected error for channel without base url")
+	}
+}
+
+func TestIsTruthyHeader(t *testing.T) {
+	for _, v := range []string{"1", "true", " TRUE ", "yes", "on"} {
+		if !isTruthyHeader(v) {
+			t.Errorf("%q should enable raw passthrough", v)
+		}
+	}
+	for _, v := range []string{"", "0", "false", "off", "raw"} {
+		if isTruthyHeader(v) {
+			t.Errorf("%q should not enable raw passthrough", v)
+		}
+	}
+}
+
+func TestRawPassthroughStillRedactsPII(t *testing.T) {
+	withPIIRedactionConfig(t, model.PIIRedactionConfig{Enabled: true, Email: true})
+
+	var upstreamBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		upstreamBody = string(data)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"x"}`))
+	}))
+	defer upstream.Close()
+
+	engine := rawPassthroughEngine(upstream.URL, &ProxyConfig{UserID: "admin", APIKeyID: "key1"}, complianceMiddlewares()...)
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"mail alice@example.com"}]}`
+	status, _ := postThrough(t, engine, "/v1/chat/completions", "application/json", strings.NewReader(body), int64(len(body)))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if strings.Contains(upstreamBody, "alice@example.com") || !strings.Contains(upstreamBody, "[EMAIL_1]") {
+		t.Fatalf("upstream body = %s", upstreamBody)
+	}
+}
+
+func TestRawPassthroughDropsClientKeyQuery(t *testing.T) {
+	var upstreamQuery string
+	var upstreamHeaders http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamQuery = r.URL.RawQuery
+		upstreamHeaders = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"x"}`))
+	}))
+	defer upstream.Close()
+
+	engine := rawPassthroughEngine(upstream.URL, &ProxyConfig{UserID: "admin", APIKeyID: "key1"})
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	status, _ := postThrough(t, engine, "/v1/chat/completions?key=amp-client-key&x=1", "application/json", strings.NewReader(body), int64(len(body)))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if upstreamQuery != "x=1" {
+		t.Errorf("upstream query = %q, want x=1", upstreamQuery)
+	}
+	for name, values := range upstreamHeaders {
+		for _, v := range values {
+			if strings.Contains(v, "amp-client-key") {
+				t.Errorf("upstream header %s = %q", name, v)
+			}
+		}
+	}
+	if got := upstreamHeaders.Get("Authorization"); got != "Bearer sk-upstream" {
+		t.Errorf("authorization = %q", got)
+	}
+}
+
+// 常规转发同样不把客户端 key 交给上游；联合身份认证的 Gemini 渠道不设置 key
+func TestBuildUpstreamURLDropsClientKeyQuery(t *testing.T) {
+	cases := []struct {
+		channel *model.Channel
+		path    string
+		want    string
+	}{
+		{&model.Channel{Type: model.ChannelTypeOpenAI, BaseURL: "https://api.example.com"}, "/v1/chat/completions?key=amp-secret&x=1", "https://api.example.com/v1/chat/completions?x=1"},
+		{&model.Channel{Type: model.ChannelTypeGemini, BaseURL: "https://gemini.example.com", APIKey: "g-key"}, "/v1beta/models/gemini-pro:generateContent?key=amp-secret", "https://gemini.example.com/v1beta/models/gemini-pro:generateContent?key=g-key"},
+		{&model.Channel{Type: model.ChannelTypeGemini, BaseURL: "https://gemini.example.com", FederationIssuer: "https://issuer.example.com"}, "/v1beta/models/gemini-pro:generateContent?key=amp-secret", "https://gemini.example.com/v1beta/models/gemini-pro:generateContent"},
+	}
+	for _, tc := range cases {
+		got, err := buildUpstreamURL(tc.channel, httptest.NewRequest("POST", tc.path, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s %s: got %s, want %s", tc.channel.Type, tc.path, got, tc.want)
+		}
+	}
+}
+
+// withMemoryDetailStore 使用不落库的请求详情存储
+func withMemoryDetailStore(t *testing.T) *RequestDetailStore {
+	t.Helper()
+	prevStore := globalDetailStore
+	prevEnabled := IsRequestDetailEnabled()
+	store := &RequestDetailStore{details: make(map[string]*RequestDetail), ttl: DefaultDetailTTL}
+	globalDetailStore = store
+	requestDetailEnabled.Store(true)
+	t.Cleanup(func() {
+		globalDetailStore = prevStore
+		requestDetailEnabled.Store(prevEnabled)
+	})
+	return store
+}
+
+func TestRawPassthroughStillInjectsGroupSystemPrompt(t *testing.T) {
+	withPIIRedactionConfig(t, model.PIIRedactionConfig{Enabled: true, Email: true})
+	store := withMemoryDetailStore(t)
+
+	var upstreamBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		upstreamBody = string(data)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"x"}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &ProxyConfig{UserID: "admin", APIKeyID: "key1", SystemPrompt: "be brief", GroupSystemPrompt: "compliance notice"}
+	middlewares := append(complianceMiddlewares(), RequestCaptureMiddleware())
+	srv := httptest.NewServer(rawPassthroughEngine(upstream.URL, cfg, middlewares...))
+	defer srv.Close()
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"mail alice@example.com"}]}`
+	resp, err := http.Post(srv.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	// 用户自己的系统提示词随原样透传跳过，分组强制系统提示词仍然插入
+	var sent struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(upstreamBody), &sent); err != nil {
+		t.Fatalf("upstream body %s: %v", upstreamBody, err)
+	}
+	if len(sent.Messages) != 2 || sent.Messages[0].Role != "system" || sent.Messages[0].Content != "compliance notice" {
+		t.Fatalf("upstream body = %s", upstreamBody)
+	}
+	skipped := resp.Header.Get(RawPassthroughSkippedHeader)
+	if !strings.Contains(skipped, "system-prompt") || strings.Contains(skipped, "group-system-prompt") || strings.Contains(skipped, "pii-redaction") {
+		t.Errorf("skipped = %q", skipped)
+	}
+
+	detail := store.Get(resp.Header.Get(headerAMPRequestID))
+	if detail == nil {
+		t.Fatal("request detail not captured")
+	}
+	if detail.InjectedSystemPrompt != "compliance notice" {
+		t.Errorf("injected system prompt = %q", detail.InjectedSystemPrompt)
+	}
+	if !strings.Contains(detail.PIIRedactions, "[EMAIL_1]") {
+		t.Errorf("pii redactions = %q", detail.PIIRedactions)
+	}
+}
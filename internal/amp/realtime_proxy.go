@@ -0,0 +1,297 @@
+package amp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"nhooyr.io/websocket"
+)
+
+const (
+	// realtimeEndpointPath OpenAI Realtime API 的 WebSocket 路径
+	realtimeEndpointPath = "/v1/realtime"
+	// realtimeDialTimeout 与上游建立 WebSocket 连接的超时
+	realtimeDialTimeout = 15 * time.Second
+	// realtimeMaxMessageSize 单条消息上限，音频以 base64 放在 JSON 事件中，默认 32KB 的读取上限不够
+	realtimeMaxMessageSize = 16 * 1024 * 1024
+	// realtimeAPIKeyProtocolPrefix 浏览器无法为 WebSocket 设置请求头，OpenAI 客户端通过该子协议携带密钥
+	realtimeAPIKeyProtocolPrefix = "openai-insecure-api-key."
+)
+
+// isRealtimePath 判断是否为 Realtime API 的 WebSocket 请求
+func isRealtimePath(path string) bool {
+	return passthroughEndpointPath(path) == realtimeEndpointPath
+}
+
+// realtimeSubprotocolAPIKey 从 Sec-WebSocket-Protocol 中取出客户端通过子协议携带的 API Key
+func realtimeSubprotocolAPIKey(header string) string {
+	for _, p := range strings.Split(header, ",") {
+		if p = strings.TrimSpace(p); strings.HasPrefix(p, realtimeAPIKeyProtocolPrefix) {
+			return strings.TrimPrefix(p, realtimeAPIKeyProtocolPrefix)
+		}
+	}
+	return ""
+}
+
+// realtimeUpstreamSubprotocols 转发给上游的子协议，去掉携带本服务 API Key 的子协议
+func realtimeUpstreamSubprotocols(header string) []string {
+	var protocols []string
+	for _, p := range strings.Split(header, ",") {
+		if p = strings.TrimSpace(p); p != "" && !strings.HasPrefix(p, realtimeAPIKeyProtocolPrefix) {
+			protocols = append(protocols, p)
+		}
+	}
+	return protocols
+}
+
+// realtimeUpstreamURL 将渠道地址转换为 ws/wss 地址，保留客户端的查询参数（不含 key）
+func realtimeUpstreamURL(baseURL string, query url.Values) (string, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	switch parsed.Scheme {
+	case "https":
+		parsed.Scheme = "wss"
+	case "http":
+		parsed.Scheme = "ws"
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + realtimeEndpointPath
+	q := url.Values{}
+	for k, v := range query {
+		if k != "key" {
+			q[k] = v
+		}
+	}
+	parsed.RawQuery = q.Encode()
+	return parsed.String(), nil
+}
+
+// realtimeUsage 累计会话中每次 response.done 事件报告的用量
+type realtimeUsage struct {
+	mu                sync.Mutex
+	responses         int
+	inputTokens       int
+	outputTokens      int
+	cachedTokens      int
+	inputAudioTokens  int
+	outputAudioTokens int
+}
+
+// observe 处理上游发给客户端的文本事件
+func (u *realtimeUsage) observe(data []byte) {
+	if gjson.GetBytes(data, "type").String() != "response.done" {
+		return
+	}
+	usage := gjson.GetBytes(data, "response.usage")
+	if !usage.Exists() {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.responses++
+	u.inputTokens += int(usage.Get("input_tokens").Int())
+	u.outputTokens += int(usage.Get("output_tokens").Int())
+	u.cachedTokens += int(usage.Get("input_token_details.cached_tokens").Int())
+	u.inputAudioTokens += int(usage.Get("input_token_details.audio_tokens").Int())
+	u.outputAudioTokens += int(usage.Get("output_token_details.audio_tokens").Int())
+}
+
+// apply 将累计用量写入请求追踪，会话中没有完成任何响应时不记录用量
+func (u *realtimeUsage) apply(trace *RequestTrace) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.responses == 0 {
+		return
+	}
+	input, output, cached := u.inputTokens, u.outputTokens, u.cachedTokens
+	trace.SetUsage(&input, &output, &cached, nil)
+	trace.SetAudioTokens(u.inputAudioTokens, u.outputAudioTokens)
+}
+
+// RealtimeProxyHandler 将 OpenAI Realtime API 的 WebSocket 会话转发到 OpenAI 兼容渠道。
+// 模型由查询参数 model 指定，先与上游建立连接再接受客户端升级，上游握手失败时返回普通 HTTP 错误；
+// 会话期间双向原样转发消息，按 response.done 事件累计用量，会话结束时写入请求日志并计费
+func RealtimeProxyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		proxyCfg := GetProxyConfig(c.Request.Context())
+		if proxyCfg == nil {
+			c.JSON(http.StatusUnauthorized, NewStandardError(http.StatusUnauthorized, "authentication required"))
+			return
+		}
+		modelName := strings.TrimSpace(c.Query("model"))
+		if modelName == "" {
+			c.JSON(http.StatusBadRequest, NewStandardError(http.StatusBadRequest, "missing model query parameter"))
+			return
+		}
+
+		channel, err := selectOpenAIPassthroughChannel(modelName, proxyCfg.GroupIDs)
+		if err != nil || channel == nil {
+			c.JSON(http.StatusServiceUnavailable, NewStandardError(http.StatusServiceUnavailable, fmt.Sprintf("no channel available for model %s", modelName)))
+			return
+		}
+
+		upstreamURL, err := realtimeUpstreamURL(channel.BaseURL, c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadGateway, NewStandardError(http.StatusBadGateway, "invalid channel base url"))
+			return
+		}
+		header := http.Header{}
+		if channel.FederationIssuer != "" {
+			if parsed, err := url.Parse(upstreamURL); err == nil {
+				setFederationSignature(header, channel.FederationIssuer, channel.APIKey, http.MethodGet, parsed.Path, parsed.RawQuery, nil, federationOnBehalfOf(proxyCfg))
+			}
+		} else {
+			header.Set("Authorization", "Bearer "+channel.APIKey)
+		}
+		if beta := c.GetHeader("OpenAI-Beta"); beta != "" {
+			header.Set("OpenAI-Beta", beta)
+		}
+
+		trace := NewRequestTrace(uuid.New().String(), proxyCfg.UserID, proxyCfg.APIKeyID, c.Request.Method, c.Request.URL.Path)
+		trace.SetModels(modelName, modelName)
+		trace.SetChannel(channel.ID, string(channel.Type), channel.BaseURL)
+		trace.SetStreaming(true)
+		trace.SetOnBehalfOf(proxyCfg.OnBehalfOf)
+
+		dialCtx, cancelDial := context.WithTimeout(c.Request.Context(), realtimeDialTimeout)
+		upstream, resp, err := websocket.Dial(dialCtx, upstreamURL, &websocket.DialOptions{
+			HTTPClient:   channelWebSocketClient(channel),
+			HTTPHeader:   header,
+			Subprotocols: realtimeUpstreamSubprotocols(c.GetHeader("Sec-WebSocket-Protocol")),
+		})
+		cancelDial()
+		if err != nil {
+			status := http.StatusBadGateway
+			if resp != nil {
+				cooldownChannelKey(channel, resp)
+				status = resp.StatusCode
+			}
+			log.Warnf("realtime proxy: failed to connect channel '%s' for model %s: %v", channel.Name, modelName, err)
+			trace.SetResponse(status)
+			trace.SetError("upstream_request_failed")
+			writeRealtimeTrace(trace, proxyCfg)
+			c.JSON(http.StatusBadGateway, NewStandardError(http.StatusBadGateway, fmt.Sprintf("failed to connect upstream realtime endpoint (HTTP %d)", status)))
+			return
+		}
+		upstream.SetReadLimit(realtimeMaxMessageSize)
+
+		var acceptProtocols []string
+		if p := upstream.Subprotocol(); p != "" {
+			acceptProtocols = []string{p}
+		}
+		// 使用 API Key 鉴权而非 Cookie，允许跨域客户端连接
+		client, err := websocket.Accept(c.Writer, c.Request, &websocket.AcceptOptions{
+			Subprotocols:       acceptProtocols,
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			upstream.Close(websocket.StatusGoingAway, "client handshake failed")
+			return
+		}
+		client.SetReadLimit(realtimeMaxMessageSize)
+
+		log.Infof("realtime proxy: session started for model '%s' on channel '%s'", modelName, channel.Name)
+		usage := &realtimeUsage{}
+		upstreamErr := relayRealtimeSession(c.Request.Context(), client, upstream, usage)
+
+		trace.SetResponse(http.StatusSwitchingProtocols)
+		if upstreamErr != nil {
+			trace.SetError("upstream_error")
+		}
+		usage.apply(trace)
+		writeRealtimeTrace(trace, proxyCfg)
+		log.Infof("realtime proxy: session closed for model '%s' (%d responses, %dms)", modelName, usage.responses, trace.Clone().LatencyMs)
+	}
+}
+
+// relayRealtimeSession 双向转发消息直到任一方断开，并以对方的关闭状态关闭另一端。
+// 上游异常断开时返回其错误
+func relayRealtimeSession(ctx context.Context, client, upstream *websocket.Conn, usage *realtimeUsage) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		fromUpstream bool
+		err          error
+	}
+	done := make(chan result, 2)
+	go func() {
+		done <- result{fromUpstream: false, err: pumpRealtimeMessages(ctx, client, upstream, nil)}
+	}()
+	go func() {
+		done <- result{fromUpstream: true, err: pumpRealtimeMessages(ctx, upstream, client, usage.observe)}
+	}()
+
+	first := <-done
+	status := websocket.CloseStatus(first.err)
+	reason := ""
+	if status == -1 {
+		status = websocket.StatusGoingAway
+		reason = "peer disconnected"
+	}
+	if first.fromUpstream {
+		client.Close(status, reason)
+		upstream.Close(websocket.StatusNormalClosure, "")
+	} else {
+		upstream.Close(status, reason)
+		client.Close(websocket.StatusNormalClosure, "")
+	}
+	cancel()
+	<-done
+
+	if first.fromUpstream && !isNormalRealtimeClose(first.err) {
+		return first.err
+	}
+	return nil
+}
+
+// pumpRealtimeMessages 将 src 的消息原样写入 dst，observe 非空时观察文本消息
+func pumpRealtimeMessages(ctx context.Context, src, dst *websocket.Conn, observe func([]byte)) error {
+	for {
+		typ, data, err := src.Read(ctx)
+		if err != nil {
+			return err
+		}
+		if observe != nil && typ == websocket.MessageText {
+			observe(data)
+		}
+		if err := dst.Write(ctx, typ, data); err != nil {
+			return err
+		}
+	}
+}
+
+func isNormalRealtimeClose(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return true
+	}
+	switch websocket.CloseStatus(err) {
+	case websocket.StatusNormalClosure, websocket.StatusGoingAway, websocket.StatusNoStatusRcvd:
+		return true
+	}
+	return false
+}
+
+// writeRealtimeTrace 会话结束时写入请求日志并结算费用。会话可能超过 pending 清理超时，
+// 因此不在会话开始时写入 pending 记录
+func writeRealtimeTrace(trace *RequestTrace, proxyCfg *ProxyConfig) {
+	writer := GetLogWriter()
+	if writer != nil {
+		writer.WritePendingFromTrace(trace)
+	}
+	settleTraceCost(trace, proxyCfg)
+	if writer != nil {
+		writer.UpdateFromTrace(trace)
+	}
+}
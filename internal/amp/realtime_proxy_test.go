@@ -0,0 +1,45 @@
+package amp
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRealtimeSubprotocols(t *testing.T) {
+	header := "realtime, openai-insecure-api-key.sk-amp-123, openai-beta.realtime-v1"
+	if got := realtimeSubprotocolAPIKey(header); got != "sk-amp-123" {
+		t.Errorf("realtimeSubprotocolAPIKey = %q", got)
+	}
+	want := []string{"realtime", "openai-beta.realtime-v1"}
+	if got := realtimeUpstreamSubprotocols(header); !reflect.DeepEqual(got, want) {
+		t.Errorf("realtimeUpstreamSubprotocols = %v, want %v", got, want)
+	}
+}
+
+func TestRealtimeUpstreamURL(t *testing.T) {
+	query := url.Values{"model": {"gpt-realtime"}, "key": {"sk-amp-123"}}
+	got, err := realtimeUpstreamURL("https://api.openai.com/", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "wss://api.openai.com/v1/realtime?model=gpt-realtime" {
+		t.Errorf("realtimeUpstreamURL = %q", got)
+	}
+}
+
+func TestRealtimeUsageObserve(t *testing.T) {
+	u := &realtimeUsage{}
+	u.observe([]byte(`{"type":"response.audio.delta","delta":"AAAA"}`))
+	u.observe([]byte(`{"type":"response.done","response":{"usage":{"input_tokens":100,"output_tokens":40,"input_token_details":{"cached_tokens":20,"audio_tokens":60},"output_token_details":{"audio_tokens":30}}}}`))
+	u.observe([]byte(`{"type":"response.done","response":{"usage":{"input_tokens":50,"output_tokens":10}}}`))
+
+	trace := NewRequestTrace("r", "u", "k", "GET", "/v1/realtime")
+	u.apply(trace)
+	if trace.InputTokens == nil || *trace.InputTokens != 150 || *trace.OutputTokens != 50 || *trace.CacheReadInputTokens != 20 {
+		t.Fatalf("unexpected token usage %+v", trace)
+	}
+	if trace.InputAudioTokens != 60 || trace.OutputAudioTokens != 30 {
+		t.Errorf("unexpected audio tokens %d/%d", trace.InputAudioTokens, trace.OutputAudioTokens)
+	}
+}
@@ -0,0 +1,96 @@
+package amp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 代理链上的中间件只解析 JSON 请求体：multipart（音频上传）与二进制请求体不读取、不改写，
+// 原样交给渠道或上游；需要查看请求体时通过 peekRequestBody 读取，读取的部分与剩余部分拼接后放回
+
+// isJSONContentType 判断媒体类型是否为 JSON（application/json 或 +json 后缀），忽略 charset 等参数
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// peekRequestBody 读取至多 limit 字节的请求体。未超出时请求体替换为已读取的内容并返回 true；
+// 超出时返回 false，已读取的前缀与剩余请求体拼接后放回，请求体保持完整
+func peekRequestBody(req *http.Request, limit int64) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	body := req.Body
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil || int64(len(data)) > limit {
+		req.Body = &multiReaderCloser{
+			Reader: io.MultiReader(bytes.NewReader(data), body),
+			Closer: body,
+		}
+		return nil, false, err
+	}
+	_ = body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.TransferEncoding = nil
+	return data, true, nil
+}
+
+// readJSONRequestBody 供只处理 JSON 的中间件读取请求体：非 JSON、空请求体、超过 limit 或读取失败时返回 nil，
+// 请求体保持不变；返回非 nil 时请求体已替换为同样内容，可直接继续转发
+func readJSONRequestBody(req *http.Request, limit int64) []byte {
+	if req.Body == nil || req.ContentLength == 0 || !isJSONContentType(req.Header.Get("Content-Type")) {
+		return nil
+	}
+	data, ok, err := peekRequestBody(req, limit)
+	if err != nil || !ok {
+		return nil
+	}
+	return data
+}
+
+// RequestBodyLimitMiddleware 按接口限制模型调用请求体大小：Content-Length 超出时直接返回 413，
+// 分块传输的请求体在读取到超出部分时报错，不需要先完整缓冲请求体
+func RequestBodyLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		// 只限制模型调用、token 计数与批处理提交，转发到 Amp 上游的其他请求保持不限制
+		if !IsModelInvocation(c.Request.Method, path) && !isTokenCountPath(path) && !isBatchCreateRequest(c.Request.Method, path) {
+			c.Next()
+			return
+		}
+		limit := requestBodyLimit(path)
+		if c.Request.ContentLength > limit {
+			abortRequestBodyTooLarge(c, limit)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// isRequestBodyTooLarge 读取请求体的错误是否由 RequestBodyLimitMiddleware 的大小限制引起
+func isRequestBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+func abortRequestBodyTooLarge(c *gin.Context, limit int64) {
+	resp := NewStandardError(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit))
+	resp.Error.Code = "request_body_too_large"
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, resp)
+}
@@ -0,0 +1,226 @@
+package amp
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func multipartAudioBody(t *testing.T, audio []byte) ([]byte, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.WriteField("model", "whisper-1"); err != nil {
+		t.Fatalf("write field: %v", err)
+	}
+	part, err := w.CreateFormFile("file", "audio.mp3")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	part.Write(audio)
+	if err := w.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+// capturingUpstream 记录上游收到的请求体与 Content-Type
+type capturingUpstream struct {
+	body        []byte
+	contentType string
+}
+
+func (u *capturingUpstream) server(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.body, _ = io.ReadAll(r.Body)
+		u.contentType = r.Header.Get("Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newMultipartTestEngine 按代理链的顺序挂载只处理 JSON 的中间件，验证 multipart 请求体原样通过
+func newMultipartTestEngine(proxyCfg *ProxyConfig, channelCfg *ChannelConfig, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithProxyConfig(c.Request.Context(), proxyCfg))
+		if channelCfg != nil {
+			WithChannelConfig(c, channelCfg)
+		}
+		c.Next()
+	})
+	engine.Use(RequestBodyLimitMiddleware())
+	engine.Use(SystemPromptMiddleware())
+	engine.Use(RequestPipelineMiddleware())
+	engine.Use(RequestCostCeilingMiddleware())
+	engine.Use(ToolLoopGuardMiddleware())
+	engine.POST("/*path", handler)
+	return engine
+}
+
+// postThrough 经真实 HTTP 服务发送请求（ReverseProxy 需要 CloseNotifier），返回状态码与响应体
+func postThrough(t *testing.T, engine *gin.Engine, path, contentType string, body io.Reader, contentLength int64) (int, string) {
+	t.Helper()
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+path, body)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.ContentLength = contentLength
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestPeekRequestBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("0123456789"))
+	data, ok, err := peekRequestBody(req, 4)
+	if err != nil || ok || data != nil {
+		t.Fatalf("peek over limit = %q, %v, %v", data, ok, err)
+	}
+	rest, _ := io.ReadAll(req.Body)
+	if string(rest) != "0123456789" {
+		t.Fatalf("body after peek over limit = %q", rest)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("0123"))
+	req.ContentLength = -1
+	data, ok, err = peekRequestBody(req, 4)
+	if err != nil || !ok || string(data) != "0123" {
+		t.Fatalf("peek within limit = %q, %v, %v", data, ok, err)
+	}
+	if req.ContentLength != 4 {
+		t.Fatalf("ContentLength = %d, want 4", req.ContentLength)
+	}
+	rest, _ = io.ReadAll(req.Body)
+	if string(rest) != "0123" {
+		t.Fatalf("body after peek = %q", rest)
+	}
+}
+
+func TestReadJSONRequestBodySkipsNonJSON(t *testing.T) {
+	body, contentType := multipartAudioBody(t, []byte("ID3audio"))
+	req := httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if got := readJSONRequestBody(req, maxRequestBodySize); got != nil {
+		t.Fatalf("expected nil for multipart body, got %q", got)
+	}
+	rest, _ := io.ReadAll(req.Body)
+	if !bytes.Equal(rest, body) {
+		t.Fatal("multipart body changed")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"m"}`))
+	req.Header.Set("Content-Type", "application/vnd.api+json; charset=utf-8")
+	if got := readJSONRequestBody(req, maxRequestBodySize); string(got) != `{"model":"m"}` {
+		t.Fatalf("readJSONRequestBody = %q", got)
+	}
+}
+
+func TestMultipartThroughChannelProxy(t *testing.T) {
+	upstream := &capturingUpstream{}
+	srv := upstream.server(t)
+
+	audio := bytes.Repeat([]byte{0x00, 0xff, 0x0d, 0x0a}, 64<<10)
+	body, contentType := multipartAudioBody(t, audio)
+
+	prevToolLoop := GetToolLoopConfig()
+	toolLoop := DefaultToolLoopConfig()
+	toolLoop.Enabled = true
+	UpdateToolLoopConfig(toolLoop)
+	t.Cleanup(func() { UpdateToolLoopConfig(prevToolLoop) })
+
+	proxyCfg := &ProxyConfig{
+		UserID:               "u1",
+		SystemPrompt:         "always be brief",
+		MaxRequestCostMicros: 1,
+		RateMultiplier:       1,
+	}
+	channelCfg := &ChannelConfig{
+		Channel: &model.Channel{ID: "ch1", Name: "openai", Type: model.ChannelTypeOpenAI, BaseURL: srv.URL, APIKey: "sk-test", Enabled: true},
+		Model:   "whisper-1",
+	}
+	engine := newMultipartTestEngine(proxyCfg, channelCfg, ChannelProxyHandler())
+
+	status, respBody := postThrough(t, engine, "/v1/audio/transcriptions", contentType, bytes.NewReader(body), int64(len(body)))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", status, respBody)
+	}
+	if upstream.contentType != contentType {
+		t.Fatalf("upstream Content-Type = %q, want %q", upstream.contentType, contentType)
+	}
+	if !bytes.Equal(upstream.body, body) {
+		t.Fatalf("upstream body differs: got %d bytes, want %d", len(upstream.body), len(body))
+	}
+}
+
+func TestMultipartThroughAmpUpstreamProxy(t *testing.T) {
+	upstream := &capturingUpstream{}
+	srv := upstream.server(t)
+
+	audio := bytes.Repeat([]byte{0x00, 0xff, 0x0d, 0x0a}, 64<<10)
+	body, contentType := multipartAudioBody(t, audio)
+
+	proxyCfg := &ProxyConfig{
+		UserID:       "u1",
+		UpstreamURL:  srv.URL,
+		SystemPrompt: "always be brief",
+	}
+	engine := newMultipartTestEngine(proxyCfg, nil, ProxyHandler(CreateDynamicReverseProxy()))
+
+	status, respBody := postThrough(t, engine, "/api/provider/openai/v1/audio/transcriptions", contentType, bytes.NewReader(body), int64(len(body)))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", status, respBody)
+	}
+	if upstream.contentType != contentType {
+		t.Fatalf("upstream Content-Type = %q, want %q", upstream.contentType, contentType)
+	}
+	if !bytes.Equal(upstream.body, body) {
+		t.Fatalf("upstream body differs: got %d bytes, want %d", len(upstream.body), len(body))
+	}
+}
+
+func TestRequestBodyLimitMiddleware(t *testing.T) {
+	upstream := &capturingUpstream{}
+	srv := upstream.server(t)
+
+	proxyCfg := &ProxyConfig{UserID: "u1", UpstreamURL: srv.URL}
+	engine := newMultipartTestEngine(proxyCfg, nil, ProxyHandler(CreateDynamicReverseProxy()))
+
+	oversized := bytes.Repeat([]byte("a"), maxRequestBodySize+1)
+
+	// 声明了 Content-Length 的请求直接拒绝
+	status, _ := postThrough(t, engine, "/api/provider/anthropic/v1/messages", "application/octet-stream", bytes.NewReader(oversized), int64(len(oversized)))
+	if status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", status)
+	}
+
+	// 分块传输的请求在转发读取到超出部分时拒绝
+	status, _ = postThrough(t, engine, "/api/provider/anthropic/v1/messages", "application/octet-stream", io.MultiReader(bytes.NewReader(oversized)), -1)
+	if status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("chunked status = %d, want 413", status)
+	}
+
+	// 非模型调用不受限制
+	status, _ = postThrough(t, engine, "/api/threads", "application/octet-stream", bytes.NewReader(oversized), int64(len(oversized)))
+	if status != http.StatusOK || len(upstream.body) != len(oversized) {
+		t.Fatalf("non-model status = %d, upstream got %d bytes", status, len(upstream.body))
+	}
+}
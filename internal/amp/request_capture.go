@@ -3,11 +3,14 @@ package amp
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"strings"
 	"sync/atomic"
 
+	"ampmanager/internal/model"
+
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
@@ -71,7 +74,8 @@ func GetCaptureData(ctx context.Context) *CaptureData {
 func RequestCaptureMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Only capture for model invocation requests
-		if !IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
+		// 进程内存越过严重水位时跳过捕获
+		if !IsModelInvocation(c.Request.Method, c.Request.URL.Path) || captureShed() {
 			c.Next()
 			return
 		}
@@ -89,6 +93,11 @@ func RequestCaptureMiddleware() gin.HandlerFunc {
 				} else {
 					requestBody = bodyBytes
 				}
+				// 超出请求内存预算时不保留请求体副本
+				if budget := memoryBudgetFrom(c.Request.Context()); !budget.reserve(len(requestBody)) {
+					budget.degrade("request_capture")
+					requestBody = nil
+				}
 				// Restore the body using MultiReader: captured prefix + remaining original body
 				c.Request.Body = &multiReaderCloser{
 					Reader: io.MultiReader(bytes.NewReader(bodyBytes), c.Request.Body),
@@ -125,6 +134,38 @@ func StoreRequestDetail(requestID string, headers http.Header, body []byte) {
 		requestID, len(headers), len(body))
 }
 
+// StoreInjectedSystemPrompt 在请求详情中记录插入的分组强制系统提示词，供合规审计
+func StoreInjectedSystemPrompt(requestID string, prompt string) {
+	if prompt == "" || !IsRequestDetailEnabled() {
+		return
+	}
+
+	store := GetRequestDetailStore()
+	if store == nil {
+		return
+	}
+
+	store.SetInjectedSystemPrompt(requestID, prompt)
+}
+
+// StorePIIRedactions 在请求详情中记录转发前脱敏报告
+func StorePIIRedactions(requestID string, items []model.PIIRedactionItem) {
+	if len(items) == 0 || !IsRequestDetailEnabled() {
+		return
+	}
+
+	store := GetRequestDetailStore()
+	if store == nil {
+		return
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return
+	}
+	store.SetPIIRedactions(requestID, string(data))
+}
+
 // StoreTranslatedRequestBody stores the translated request body
 func StoreTranslatedRequestBody(requestID string, body []byte) {
 	if !IsRequestDetailEnabled() {
@@ -204,29 +245,44 @@ type ResponseCaptureWrapper struct {
 	headers   http.Header
 	buffer    *bytes.Buffer
 	maxSize   int
+	// budget 请求内存预算，超出后停止缓冲，已捕获的部分照常保存
+	budget *requestMemoryBudget
 }
 
 // NewResponseCaptureWrapper creates a new response capture wrapper
-func NewResponseCaptureWrapper(body io.ReadCloser, requestID string, headers http.Header) *ResponseCaptureWrapper {
+// 请求详情监控开启时同时登记实时流，供管理端按请求 ID 实时观看；进程内存越过严重水位时不缓冲响应体
+func NewResponseCaptureWrapper(ctx context.Context, body io.ReadCloser, requestID string, headers http.Header) *ResponseCaptureWrapper {
+	if IsRequestDetailEnabled() {
+		liveStreams.Begin(requestID)
+	}
+	maxSize := CaptureMaxBodySize
+	if captureShed() {
+		maxSize = 0
+	}
 	return &ResponseCaptureWrapper{
 		ReadCloser: body,
 		requestID:  requestID,
 		headers:    sanitizeHeaders(headers),
 		buffer:     &bytes.Buffer{},
-		maxSize:    CaptureMaxBodySize,
+		maxSize:    maxSize,
+		budget:     memoryBudgetFrom(ctx),
 	}
 }
 
 func (w *ResponseCaptureWrapper) Read(p []byte) (int, error) {
 	n, err := w.ReadCloser.Read(p)
 	if n > 0 && w.buffer.Len() < w.maxSize {
-		remaining := w.maxSize - w.buffer.Len()
-		if n <= remaining {
-			w.buffer.Write(p[:n])
+		chunk := p[:min(n, w.maxSize-w.buffer.Len())]
+		if w.budget.reserve(len(chunk)) {
+			w.buffer.Write(chunk)
 		} else {
-			w.buffer.Write(p[:remaining])
+			w.budget.degrade("response_capture")
+			w.maxSize = w.buffer.Len()
 		}
 	}
+	if n > 0 {
+		liveStreams.Publish(w.requestID, p[:n])
+	}
 	return n, err
 }
 
@@ -234,6 +290,8 @@ func (w *ResponseCaptureWrapper) Close() error {
 	// Store response detail before closing
 	if w.requestID != "" {
 		StoreResponseDetail(w.requestID, w.headers, w.buffer.Bytes())
+		liveStreams.End(w.requestID)
 	}
+	w.budget.release(w.buffer.Len())
 	return w.ReadCloser.Close()
 }
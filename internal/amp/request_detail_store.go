@@ -41,6 +41,9 @@ type RequestDetail struct {
 	ResponseHeaders        http.Header
 	ResponseBody           []byte
 	TranslatedResponseBody []byte // 翻译后发送给客户端的响应体
+	RedactionCount         int    // 脱敏屏蔽的疑似密钥处数
+	InjectedSystemPrompt   string // 插入的分组强制系统提示词（合规审计）
+	PIIRedactions          string // 转发前脱敏报告（JSON）
 	Persisted              bool
 }
 
@@ -57,6 +60,7 @@ type RequestDetailStore struct {
 	archiveDays      int
 	lastArchiveAt    time.Time
 	stopChan         chan struct{}
+	stopOnce         sync.Once
 	wg               sync.WaitGroup
 }
 
@@ -121,9 +125,13 @@ func (s *RequestDetailStore) openArchiveDB() *sql.DB {
 	if s.db == nil {
 		return nil
 	}
-	if database.IsPostgres() {
+	if database.HasArchiveTable() {
 		s.archiveTableName = "request_log_details_archive"
 		s.ownsArchiveDB = false
+		// MySQL 的归档表随主库结构在 database.createTables 中创建
+		if !database.IsPostgres() {
+			return s.db
+		}
 		_, err := s.db.Exec(`
 			CREATE TABLE IF NOT EXISTS request_log_details_archive (
 				request_id TEXT PRIMARY KEY,
@@ -140,6 +148,9 @@ func (s *RequestDetailStore) openArchiveDB() *sql.DB {
 			log.Warnf("request detail store: failed to ensure postgres archive table: %v", err)
 			return nil
 		}
+		_, _ = s.db.Exec(`ALTER TABLE request_log_details_archive ADD COLUMN IF NOT EXISTS redaction_count INTEGER NOT NULL DEFAULT 0`)
+		_, _ = s.db.Exec(`ALTER TABLE request_log_details_archive ADD COLUMN IF NOT EXISTS injected_system_prompt TEXT NOT NULL DEFAULT ''`)
+		_, _ = s.db.Exec(`ALTER TABLE request_log_details_archive ADD COLUMN IF NOT EXISTS pii_redactions TEXT NOT NULL DEFAULT ''`)
 		_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_request_log_details_archive_created ON request_log_details_archive(created_at DESC)`)
 		if err != nil {
 			log.Warnf("request detail store: failed to ensure postgres archive index: %v", err)
@@ -193,6 +204,9 @@ func (s *RequestDetailStore) openArchiveDB() *sql.DB {
 	}
 	_, _ = adb.Exec(`ALTER TABLE request_log_details ADD COLUMN translated_request_body TEXT`)
 	_, _ = adb.Exec(`ALTER TABLE request_log_details ADD COLUMN translated_response_body TEXT`)
+	_, _ = adb.Exec(`ALTER TABLE request_log_details ADD COLUMN redaction_count INTEGER NOT NULL DEFAULT 0`)
+	_, _ = adb.Exec(`ALTER TABLE request_log_details ADD COLUMN injected_system_prompt TEXT NOT NULL DEFAULT ''`)
+	_, _ = adb.Exec(`ALTER TABLE request_log_details ADD COLUMN pii_redactions TEXT NOT NULL DEFAULT ''`)
 
 	s.ownsArchiveDB = true
 	log.Info("request detail store: archive db ready")
@@ -298,6 +312,32 @@ func (s *RequestDetailStore) UpdateRequestData(requestID string, headers http.He
 	}
 }
 
+// SetInjectedSystemPrompt 记录请求插入的分组强制系统提示词
+func (s *RequestDetailStore) SetInjectedSystemPrompt(requestID string, prompt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	detail, exists := s.details[requestID]
+	if !exists {
+		return
+	}
+	detail.InjectedSystemPrompt = prompt
+	detail.LastUpdatedAt = time.Now().UTC()
+}
+
+// SetPIIRedactions 记录请求的转发前脱敏报告（JSON）
+func (s *RequestDetailStore) SetPIIRedactions(requestID string, report string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	detail, exists := s.details[requestID]
+	if !exists {
+		return
+	}
+	detail.PIIRedactions = report
+	detail.LastUpdatedAt = time.Now().UTC()
+}
+
 // UpdateTranslatedRequestBody stores the translated request body
 func (s *RequestDetailStore) UpdateTranslatedRequestBody(requestID string, body []byte) {
 	if len(body) == 0 {
@@ -394,6 +434,9 @@ func copyDetail(detail *RequestDetail) *RequestDetail {
 		ResponseHeaders:        nil,
 		ResponseBody:           make([]byte, len(detail.ResponseBody)),
 		TranslatedResponseBody: make([]byte, len(detail.TranslatedResponseBody)),
+		RedactionCount:         detail.RedactionCount,
+		InjectedSystemPrompt:   detail.InjectedSystemPrompt,
+		PIIRedactions:          detail.PIIRedactions,
 		Persisted:              detail.Persisted,
 	}
 	copy(copied.RequestBody, detail.RequestBody)
@@ -441,7 +484,7 @@ func (s *RequestDetailStore) getFromDB(db *sql.DB, tableName, requestID string)
 	var requestHeaders, requestBody, translatedRequestBody, responseHeaders, responseBody, translatedResponseBody sql.NullString
 
 	query := fmt.Sprintf(`
-		SELECT request_id, request_headers, request_body, translated_request_body, response_headers, response_body, translated_response_body, created_at
+		SELECT request_id, request_headers, request_body, translated_request_body, response_headers, response_body, translated_response_body, redaction_count, injected_system_prompt, pii_redactions, created_at
 		FROM %s
 		WHERE request_id = ?
 	`, tableName)
@@ -453,6 +496,9 @@ func (s *RequestDetailStore) getFromDB(db *sql.DB, tableName, requestID string)
 		&responseHeaders,
 		&responseBody,
 		&translatedResponseBody,
+		&detail.RedactionCount,
+		&detail.InjectedSystemPrompt,
+		&detail.PIIRedactions,
 		&detail.CreatedAt,
 	)
 
@@ -493,6 +539,8 @@ func (s *RequestDetailStore) persistToDB(detail *RequestDetail) error {
 		return nil
 	}
 
+	// 写入前脱敏，detail 为内存条目的副本
+	RedactRequestDetail(detail)
 	requestHeadersJSON := headersToJSON(detail.RequestHeaders)
 	responseHeadersJSON := headersToJSON(detail.ResponseHeaders)
 	requestBody := sanitizeBodyForStorage(detail.RequestBody)
@@ -502,8 +550,8 @@ func (s *RequestDetailStore) persistToDB(detail *RequestDetail) error {
 
 	query := fmt.Sprintf(`
 		INSERT INTO %s
-		(request_id, request_headers, request_body, translated_request_body, response_headers, response_body, translated_response_body, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		(request_id, request_headers, request_body, translated_request_body, response_headers, response_body, translated_response_body, redaction_count, injected_system_prompt, pii_redactions, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT (request_id) DO UPDATE SET
 			request_headers = excluded.request_headers,
 			request_body = excluded.request_body,
@@ -511,6 +559,9 @@ func (s *RequestDetailStore) persistToDB(detail *RequestDetail) error {
 			response_headers = excluded.response_headers,
 			response_body = excluded.response_body,
 			translated_response_body = excluded.translated_response_body,
+			redaction_count = excluded.redaction_count,
+			injected_system_prompt = excluded.injected_system_prompt,
+			pii_redactions = excluded.pii_redactions,
 			created_at = excluded.created_at
 	`, s.hotTableName)
 	_, err := s.db.Exec(query,
@@ -521,6 +572,9 @@ func (s *RequestDetailStore) persistToDB(detail *RequestDetail) error {
 		responseHeadersJSON,
 		responseBody,
 		translatedResponseBody,
+		detail.RedactionCount,
+		detail.InjectedSystemPrompt,
+		detail.PIIRedactions,
 		detail.CreatedAt.UTC(),
 	)
 
@@ -613,7 +667,7 @@ func (s *RequestDetailStore) archiveOldDetails(now time.Time) {
 	cutoff := now.AddDate(0, 0, -s.archiveDays).UTC()
 
 	// 查找需要归档的行（分批处理）
-	query := fmt.Sprintf(`SELECT request_id, request_headers, request_body, translated_request_body, response_headers, response_body, translated_response_body, created_at
+	query := fmt.Sprintf(`SELECT request_id, request_headers, request_body, translated_request_body, response_headers, response_body, translated_response_body, redaction_count, injected_system_prompt, pii_redactions, created_at
 		 FROM %s WHERE created_at < ? ORDER BY created_at LIMIT ?`, s.hotTableName)
 	rows, err := s.db.Query(query, cutoff, ArchiveBatchSize)
 	if err != nil {
@@ -630,12 +684,15 @@ func (s *RequestDetailStore) archiveOldDetails(now time.Time) {
 		responseHeaders        sql.NullString
 		responseBody           sql.NullString
 		translatedResponseBody sql.NullString
+		redactionCount         int
+		injectedSystemPrompt   string
+		piiRedactions          string
 		createdAt              time.Time
 	}
 	var batch []row
 	for rows.Next() {
 		var r row
-		if err := rows.Scan(&r.requestID, &r.requestHeaders, &r.requestBody, &r.translatedRequestBody, &r.responseHeaders, &r.responseBody, &r.translatedResponseBody, &r.createdAt); err != nil {
+		if err := rows.Scan(&r.requestID, &r.requestHeaders, &r.requestBody, &r.translatedRequestBody, &r.responseHeaders, &r.responseBody, &r.translatedResponseBody, &r.redactionCount, &r.injectedSystemPrompt, &r.piiRedactions, &r.createdAt); err != nil {
 			log.Warnf("request detail store: archive scan failed: %v", err)
 			return
 		}
@@ -659,8 +716,8 @@ func (s *RequestDetailStore) archiveOldDetails(now time.Time) {
 	}
 
 	archiveInsertSQL := fmt.Sprintf(`INSERT INTO %s
-		(request_id, request_headers, request_body, translated_request_body, response_headers, response_body, translated_response_body, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		(request_id, request_headers, request_body, translated_request_body, response_headers, response_body, translated_response_body, redaction_count, injected_system_prompt, pii_redactions, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT (request_id) DO NOTHING`, s.archiveTableName)
 	stmt, err := archiveTx.Prepare(archiveInsertSQL)
 	if err != nil {
@@ -671,7 +728,7 @@ func (s *RequestDetailStore) archiveOldDetails(now time.Time) {
 	defer stmt.Close()
 
 	for _, r := range batch {
-		_, err := stmt.Exec(r.requestID, r.requestHeaders, r.requestBody, r.translatedRequestBody, r.responseHeaders, r.responseBody, r.translatedResponseBody, r.createdAt)
+		_, err := stmt.Exec(r.requestID, r.requestHeaders, r.requestBody, r.translatedRequestBody, r.responseHeaders, r.responseBody, r.translatedResponseBody, r.redactionCount, r.injectedSystemPrompt, r.piiRedactions, r.createdAt)
 		if err != nil {
 			archiveTx.Rollback()
 			log.Warnf("request detail store: archive insert failed: %v", err)
@@ -729,6 +786,21 @@ func (s *RequestDetailStore) archiveOldDetails(now time.Time) {
 	log.Infof("request detail store: archived %d rows older than %d days", len(ids), s.archiveDays)
 }
 
+// deleteDetailsBefore permanently deletes persisted details older than cutoff from the hot table
+// and then the archive, in batches. Used by the log retention pruner.
+func (s *RequestDetailStore) deleteDetailsBefore(cutoff time.Time, stop <-chan struct{}) (int64, error) {
+	if s.db == nil {
+		return 0, nil
+	}
+	deleteSQL := `DELETE FROM %s WHERE request_id IN (SELECT request_id FROM %s WHERE created_at < ? LIMIT ?)`
+	total, err := execBatches(s.db, fmt.Sprintf(deleteSQL, s.hotTableName, s.hotTableName), cutoff, stop)
+	if err != nil || s.archiveDB == nil {
+		return total, err
+	}
+	archived, err := execBatches(s.archiveDB, fmt.Sprintf(deleteSQL, s.archiveTableName, s.archiveTableName), cutoff, stop)
+	return total + archived, err
+}
+
 // persistAll persists all entries to database (called on shutdown)
 func (s *RequestDetailStore) persistAll() {
 	s.mu.RLock()
@@ -754,11 +826,13 @@ func (s *RequestDetailStore) persistAll() {
 
 // Stop stops the cleanup loop
 func (s *RequestDetailStore) Stop() {
-	close(s.stopChan)
-	s.wg.Wait()
-	if s.ownsArchiveDB && s.archiveDB != nil {
-		s.archiveDB.Close()
-	}
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+		s.wg.Wait()
+		if s.ownsArchiveDB && s.archiveDB != nil {
+			s.archiveDB.Close()
+		}
+	})
 }
 
 // Helper functions for JSON serialization of headers
@@ -0,0 +1,142 @@
+package amp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var requestLogPolicyState struct {
+	mu     sync.RWMutex
+	policy model.RequestLogPolicy
+}
+
+func init() {
+	requestLogPolicyState.policy = DefaultRequestLogPolicy()
+}
+
+// DefaultRequestLogPolicy 默认完整记录模型调用，token 计数只记摘要，其余辅助流量不记录
+func DefaultRequestLogPolicy() model.RequestLogPolicy {
+	return model.RequestLogPolicy{
+		ModelInvocation: model.RequestLogFull,
+		TokenCount:      model.RequestLogSummary,
+		Telemetry:       model.RequestLogOff,
+		Ads:             model.RequestLogOff,
+		Docs:            model.RequestLogOff,
+		Other:           model.RequestLogOff,
+	}
+}
+
+// NormalizeRequestLogPolicy 未设置的类别使用默认级别
+func NormalizeRequestLogPolicy(policy model.RequestLogPolicy) model.RequestLogPolicy {
+	defaults := DefaultRequestLogPolicy()
+	fill := func(level *model.RequestLogLevel, fallback model.RequestLogLevel) {
+		*level = model.RequestLogLevel(strings.ToLower(strings.TrimSpace(string(*level))))
+		if *level == "" {
+			*level = fallback
+		}
+	}
+	fill(&policy.ModelInvocation, defaults.ModelInvocation)
+	fill(&policy.TokenCount, defaults.TokenCount)
+	fill(&policy.Telemetry, defaults.Telemetry)
+	fill(&policy.Ads, defaults.Ads)
+	fill(&policy.Docs, defaults.Docs)
+	fill(&policy.Other, defaults.Other)
+	return policy
+}
+
+// ValidateRequestLogPolicy 校验日志策略（需先 Normalize）
+func ValidateRequestLogPolicy(policy model.RequestLogPolicy) error {
+	levels := []struct {
+		name  string
+		level model.RequestLogLevel
+	}{
+		{"modelInvocation", policy.ModelInvocation},
+		{"tokenCount", policy.TokenCount},
+		{"telemetry", policy.Telemetry},
+		{"ads", policy.Ads},
+		{"docs", policy.Docs},
+		{"other", policy.Other},
+	}
+	for _, l := range levels {
+		switch l.level {
+		case model.RequestLogFull, model.RequestLogSummary, model.RequestLogOff:
+		default:
+			return fmt.Errorf("%s 只能为 full、summary 或 off", l.name)
+		}
+	}
+	if policy.ModelInvocation == model.RequestLogOff {
+		return fmt.Errorf("modelInvocation 不能为 off，模型调用日志用于计费结算")
+	}
+	return nil
+}
+
+// InitRequestLogPolicy 从数据库 JSON 加载请求日志策略
+func InitRequestLogPolicy(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var policy model.RequestLogPolicy
+	if err := json.Unmarshal([]byte(configJSON), &policy); err != nil {
+		log.Warnf("request log policy: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	policy = NormalizeRequestLogPolicy(policy)
+	if err := ValidateRequestLogPolicy(policy); err != nil {
+		log.Warnf("request log policy: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateRequestLogPolicy(policy)
+}
+
+// UpdateRequestLogPolicy 更新运行时请求日志策略
+func UpdateRequestLogPolicy(policy model.RequestLogPolicy) {
+	requestLogPolicyState.mu.Lock()
+	defer requestLogPolicyState.mu.Unlock()
+	requestLogPolicyState.policy = policy
+}
+
+// GetRequestLogPolicy 返回当前生效的请求日志策略
+func GetRequestLogPolicy() model.RequestLogPolicy {
+	requestLogPolicyState.mu.RLock()
+	defer requestLogPolicyState.mu.RUnlock()
+	return requestLogPolicyState.policy
+}
+
+// requestLogLevelFor 按请求所属的端点类别返回日志级别。
+// token 计数优先于模型调用判断（Gemini countTokens 也匹配模型调用路径）
+func requestLogLevelFor(method, path string) model.RequestLogLevel {
+	policy := GetRequestLogPolicy()
+	switch {
+	case isTokenCountPath(path):
+		return policy.TokenCount
+	case IsModelInvocation(method, path):
+		return policy.ModelInvocation
+	case hasPathPrefix(path, "/api/telemetry"), hasPathPrefix(path, "/api/otel"):
+		return policy.Telemetry
+	case hasPathPrefix(path, "/api/ads"):
+		return policy.Ads
+	case isDocsPath(path):
+		return policy.Docs
+	default:
+		return policy.Other
+	}
+}
+
+// isDocsPath 公开页面路由（见 registerManagementRoutes 中的 publicRoutes）
+func isDocsPath(path string) bool {
+	return hasPathPrefix(path, "/docs") ||
+		hasPathPrefix(path, "/threads") ||
+		hasPathPrefix(path, "/settings") ||
+		strings.HasSuffix(path, ".rss")
+}
+
+// hasPathPrefix 路径等于 prefix 或位于其下级
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
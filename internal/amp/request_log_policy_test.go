@@ -0,0 +1,76 @@
+package amp
+
+import (
+	"net/http"
+	"testing"
+
+	"ampmanager/internal/model"
+)
+
+func TestRequestLogLevelFor(t *testing.T) {
+	prev := GetRequestLogPolicy()
+	defer UpdateRequestLogPolicy(prev)
+	UpdateRequestLogPolicy(model.RequestLogPolicy{
+		ModelInvocation: model.RequestLogFull,
+		TokenCount:      model.RequestLogOff,
+		Telemetry:       model.RequestLogSummary,
+		Ads:             model.RequestLogOff,
+		Docs:            model.RequestLogSummary,
+		Other:           model.RequestLogFull,
+	})
+
+	cases := []struct {
+		method string
+		path   string
+		want   model.RequestLogLevel
+	}{
+		{http.MethodPost, "/api/provider/anthropic/v1/messages", model.RequestLogFull},
+		{http.MethodPost, "/api/provider/anthropic/v1/messages/count_tokens", model.RequestLogOff},
+		// Gemini countTokens 同时匹配模型调用路径，按 token 计数处理
+		{http.MethodPost, "/v1beta/models/gemini-2.5-pro:countTokens", model.RequestLogOff},
+		{http.MethodPost, "/api/telemetry", model.RequestLogSummary},
+		{http.MethodPost, "/api/otel/v1/traces", model.RequestLogSummary},
+		{http.MethodGet, "/api/ads", model.RequestLogOff},
+		{http.MethodGet, "/docs/getting-started", model.RequestLogSummary},
+		{http.MethodGet, "/news.rss", model.RequestLogSummary},
+		{http.MethodGet, "/api/threads/T-1", model.RequestLogFull},
+		{http.MethodGet, "/api/adsense", model.RequestLogFull},
+	}
+	for _, tc := range cases {
+		if got := requestLogLevelFor(tc.method, tc.path); got != tc.want {
+			t.Errorf("requestLogLevelFor(%s %s) = %q, want %q", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestValidateRequestLogPolicy(t *testing.T) {
+	policy := NormalizeRequestLogPolicy(model.RequestLogPolicy{Telemetry: " Summary "})
+	if err := ValidateRequestLogPolicy(policy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.Telemetry != model.RequestLogSummary || policy.ModelInvocation != model.RequestLogFull {
+		t.Errorf("unexpected normalized policy: %+v", policy)
+	}
+
+	policy.ModelInvocation = model.RequestLogOff
+	if err := ValidateRequestLogPolicy(policy); err == nil {
+		t.Error("expected modelInvocation=off to be rejected")
+	}
+
+	policy = NormalizeRequestLogPolicy(model.RequestLogPolicy{Ads: "verbose"})
+	if err := ValidateRequestLogPolicy(policy); err == nil {
+		t.Error("expected unknown level to be rejected")
+	}
+}
+
+func TestRequestTraceSummaryOnly(t *testing.T) {
+	var nilTrace *RequestTrace
+	if nilTrace.SummaryOnly() {
+		t.Error("expected nil trace not to be summary-only")
+	}
+	trace := NewRequestTrace("req-1", "u", "k", http.MethodPost, "/v1/messages")
+	trace.SetSummaryOnly(true)
+	if !trace.SummaryOnly() {
+		t.Error("expected trace to be summary-only")
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"sync"
 	"time"
+
+	"ampmanager/internal/billing"
+	"ampmanager/internal/model"
+	"ampmanager/internal/tracing"
 )
 
 type requestTraceKey struct{}
@@ -27,6 +31,10 @@ type RequestTrace struct {
 	Endpoint      string
 	IsStreaming   bool
 	ThinkingLevel string
+	// OnBehalfOf 联邦请求的原始用户（签发方/用户）
+	OnBehalfOf string
+	// TraceID 分布式追踪的 trace ID，用于在 APM 中关联请求日志
+	TraceID string
 
 	// 响应信息
 	StatusCode int
@@ -37,6 +45,19 @@ type RequestTrace struct {
 	OutputTokens             *int
 	CacheReadInputTokens     *int
 	CacheCreationInputTokens *int
+	// EstimatedOutputTokens 按流式响应已转发的内容估算的输出 token，流未正常结束且没有收到输出用量时用于结算
+	EstimatedOutputTokens int
+	// EstimatedInputTokens 按发往上游的请求体估算的输入 token，上游响应没有输入用量时使用
+	EstimatedInputTokens int
+	// UsageEstimated 记录的 token 数（部分或全部）为估算值
+	UsageEstimated bool
+
+	// 音频用量（转写按音频秒数、语音合成按输入字符数计费）
+	AudioSeconds    float64
+	InputCharacters int
+	// Realtime 会话中已计入输入/输出 token 的音频 token 数
+	InputAudioTokens  int
+	OutputAudioTokens int
 
 	// 成本信息
 	CostMicros   *int64
@@ -46,11 +67,29 @@ type RequestTrace struct {
 	// 倍率信息
 	RateMultiplier float64
 
+	// Batch 批处理条目，按批处理价格计费
+	Batch bool
+
 	// 错误信息
 	ErrorType string
 
 	// 响应文本（/v1/responses 聚合的助手文本）
 	ResponseText string
+
+	// 重试历史（由 RetryTransport 逐次追加）
+	Attempts []model.RequestAttempt
+
+	// finalized 表示记录已被 pending 清理器或管理员强制结束，后续完成时不再覆盖
+	finalized bool
+
+	// streamIncomplete 流式响应在结束事件之前中断（客户端断开或上游截断）
+	streamIncomplete bool
+
+	// summaryOnly 日志策略为 summary，只记录日志不保存请求/响应详情
+	summaryOnly bool
+
+	// spanContext 请求所在的追踪 span，计费结算等脱离请求 context 的阶段以其为父 span
+	spanContext tracing.SpanContext
 }
 
 // NewRequestTrace 创建新的请求追踪
@@ -67,6 +106,15 @@ func NewRequestTrace(requestID, userID, apiKeyID, method, path string) *RequestT
 
 // WithRequestTrace 将 RequestTrace 存入 context
 func WithRequestTrace(ctx context.Context, trace *RequestTrace) context.Context {
+	if lease := getRateLimitLease(ctx); lease != nil {
+		lease.attach(trace)
+	}
+	if cfg := GetProxyConfig(ctx); cfg != nil && cfg.OnBehalfOf != "" && trace != nil {
+		trace.SetOnBehalfOf(cfg.OnBehalfOf)
+	}
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() && trace != nil {
+		trace.setSpanContext(sc)
+	}
 	return context.WithValue(ctx, requestTraceKey{}, trace)
 }
 
@@ -80,6 +128,23 @@ func GetRequestTrace(ctx context.Context) *RequestTrace {
 	return nil
 }
 
+// SetSummaryOnly 设置是否只记录日志摘要
+func (t *RequestTrace) SetSummaryOnly(summaryOnly bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.summaryOnly = summaryOnly
+}
+
+// SummaryOnly 是否跳过请求/响应详情的保存，trace 为 nil 时返回 false
+func (t *RequestTrace) SummaryOnly() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.summaryOnly
+}
+
 // SetModels 设置模型信息
 func (t *RequestTrace) SetModels(original, mapped string) {
 	t.mu.Lock()
@@ -130,6 +195,42 @@ func (t *RequestTrace) SetUsage(input, output, cacheRead, cacheCreation *int) {
 	}
 }
 
+// SetAudioUsage 设置音频用量，非正数的值不覆盖
+func (t *RequestTrace) SetAudioUsage(seconds float64, characters int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if seconds > 0 {
+		t.AudioSeconds = seconds
+	}
+	if characters > 0 {
+		t.InputCharacters = characters
+	}
+}
+
+// SetAudioTokens 设置输入/输出 token 中的音频 token 数
+func (t *RequestTrace) SetAudioTokens(input, output int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.InputAudioTokens = input
+	t.OutputAudioTokens = output
+}
+
+// BillingUsage 计费使用的用量（token 与音频用量）
+func (t *RequestTrace) BillingUsage() billing.TokenUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return billing.TokenUsage{
+		InputTokens:              ptrToInt(t.InputTokens),
+		OutputTokens:             ptrToInt(t.OutputTokens),
+		CacheReadInputTokens:     ptrToInt(t.CacheReadInputTokens),
+		CacheCreationInputTokens: ptrToInt(t.CacheCreationInputTokens),
+		AudioSeconds:             t.AudioSeconds,
+		InputCharacters:          t.InputCharacters,
+		InputAudioTokens:         t.InputAudioTokens,
+		OutputAudioTokens:        t.OutputAudioTokens,
+	}
+}
+
 // UpdateOutputTokens 更新输出 token（流式时多次调用取最大值）
 func (t *RequestTrace) UpdateOutputTokens(output int) {
 	t.mu.Lock()
@@ -139,6 +240,75 @@ func (t *RequestTrace) UpdateOutputTokens(output int) {
 	}
 }
 
+// HasOutputTokens 是否已记录输出用量
+func (t *RequestTrace) HasOutputTokens() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.OutputTokens != nil
+}
+
+// SetEstimatedOutputTokens 更新按已转发内容估算的输出 token
+func (t *RequestTrace) SetEstimatedOutputTokens(tokens int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.EstimatedOutputTokens = tokens
+}
+
+// MarkStreamIncomplete 标记流式响应未正常结束：没有收到输出用量时以估算值作为输出 token，
+// 已收到的部分用量（如 Anthropic message_start 中的输入 token、Gemini 最后一个 usageMetadata）保持不变。
+// 返回是否使用了估算值
+func (t *RequestTrace) MarkStreamIncomplete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.streamIncomplete = true
+	if t.OutputTokens == nil && t.EstimatedOutputTokens > 0 {
+		estimated := t.EstimatedOutputTokens
+		t.OutputTokens = &estimated
+		t.UsageEstimated = true
+		return true
+	}
+	return false
+}
+
+// SetEstimatedInputTokens 设置按请求体估算的输入 token
+func (t *RequestTrace) SetEstimatedInputTokens(tokens int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.EstimatedInputTokens = tokens
+}
+
+// ApplyUsageEstimate 上游成功响应但没有返回输入或输出用量时以估算值补齐，使请求日志的 token 数不为空。
+// 没有输入估算值的请求（音频、Realtime 等不按文本计量的请求）不处理。返回是否使用了估算值
+func (t *RequestTrace) ApplyUsageEstimate() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.StatusCode < 200 || t.StatusCode >= 400 || t.EstimatedInputTokens <= 0 {
+		return false
+	}
+	applied := false
+	if t.InputTokens == nil {
+		estimated := t.EstimatedInputTokens
+		t.InputTokens = &estimated
+		applied = true
+	}
+	if t.OutputTokens == nil {
+		estimated := t.EstimatedOutputTokens
+		t.OutputTokens = &estimated
+		applied = true
+	}
+	if applied {
+		t.UsageEstimated = true
+	}
+	return applied
+}
+
+// StreamIncomplete 流式响应是否在结束事件之前中断
+func (t *RequestTrace) StreamIncomplete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.streamIncomplete
+}
+
 // SetError 设置错误类型
 func (t *RequestTrace) SetError(errorType string) {
 	t.mu.Lock()
@@ -146,6 +316,15 @@ func (t *RequestTrace) SetError(errorType string) {
 	t.ErrorType = errorType
 }
 
+// setErrorIfEmpty 尚未记录错误时设置错误类型，不覆盖更具体的错误（如 stream_timeout）
+func (t *RequestTrace) setErrorIfEmpty(errorType string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ErrorType == "" {
+		t.ErrorType = errorType
+	}
+}
+
 // SetThinkingLevel 设置思维等级
 func (t *RequestTrace) SetThinkingLevel(level string) {
 	t.mu.Lock()
@@ -153,6 +332,27 @@ func (t *RequestTrace) SetThinkingLevel(level string) {
 	t.ThinkingLevel = level
 }
 
+// SetOnBehalfOf 设置联邦请求的原始用户
+func (t *RequestTrace) SetOnBehalfOf(onBehalfOf string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.OnBehalfOf = onBehalfOf
+}
+
+func (t *RequestTrace) setSpanContext(sc tracing.SpanContext) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spanContext = sc
+	t.TraceID = sc.TraceIDString()
+}
+
+// SpanContext 返回请求所在的追踪 span，未开启追踪时无效
+func (t *RequestTrace) SpanContext() tracing.SpanContext {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spanContext
+}
+
 // SetResponseText 设置响应文本
 func (t *RequestTrace) SetResponseText(text string) {
 	t.mu.Lock()
@@ -160,6 +360,27 @@ func (t *RequestTrace) SetResponseText(text string) {
 	t.ResponseText = text
 }
 
+// AddAttempt 追加一次上游尝试记录
+func (t *RequestTrace) AddAttempt(attempt model.RequestAttempt) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Attempts = append(t.Attempts, attempt)
+}
+
+// MarkFinalized 标记记录已被强制结束
+func (t *RequestTrace) MarkFinalized() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.finalized = true
+}
+
+// IsFinalized 记录是否已被强制结束
+func (t *RequestTrace) IsFinalized() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.finalized
+}
+
 // copyIntPtr 深拷贝 *int 指针
 func copyIntPtr(p *int) *int {
 	if p == nil {
@@ -196,18 +417,25 @@ func (t *RequestTrace) Clone() RequestTrace {
 		Endpoint:                 t.Endpoint,
 		IsStreaming:              t.IsStreaming,
 		ThinkingLevel:            t.ThinkingLevel,
+		OnBehalfOf:               t.OnBehalfOf,
+		TraceID:                  t.TraceID,
 		StatusCode:               t.StatusCode,
 		LatencyMs:                t.LatencyMs,
 		InputTokens:              copyIntPtr(t.InputTokens),
 		OutputTokens:             copyIntPtr(t.OutputTokens),
 		CacheReadInputTokens:     copyIntPtr(t.CacheReadInputTokens),
 		CacheCreationInputTokens: copyIntPtr(t.CacheCreationInputTokens),
+		EstimatedOutputTokens:    t.EstimatedOutputTokens,
+		EstimatedInputTokens:     t.EstimatedInputTokens,
+		UsageEstimated:           t.UsageEstimated,
 		CostMicros:               copyInt64Ptr(t.CostMicros),
 		CostUsd:                  copyStringPtr(t.CostUsd),
 		PricingModel:             copyStringPtr(t.PricingModel),
 		RateMultiplier:           t.RateMultiplier,
+		Batch:                    t.Batch,
 		ErrorType:                t.ErrorType,
 		ResponseText:             t.ResponseText,
+		Attempts:                 append([]model.RequestAttempt(nil), t.Attempts...),
 	}
 }
 
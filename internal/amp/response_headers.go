@@ -0,0 +1,217 @@
+package amp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AMP-Manager 附加的响应头
+const (
+	headerAMPRequestID = "X-AMP-Request-Id"
+	headerAMPChannelID = "X-AMP-Channel-Id"
+	headerAMPCostUsd   = "X-AMP-Cost-Usd"
+	headerAMPCache     = "X-AMP-Cache"
+)
+
+const maxResponseHeaderRuleItems = 64
+
+var responseHeaderNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+\*?$`)
+
+// protectedResponseHeaders 描述响应体本身的响应头，任何规则都不会移除
+var protectedResponseHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"Content-Encoding",
+	"Transfer-Encoding",
+	"Trailer",
+}
+
+// commonDeniedResponseHeaders 默认移除的响应头：上游服务器、CDN 和会话信息
+var commonDeniedResponseHeaders = []string{
+	"Set-Cookie",
+	"Server",
+	"Server-Timing",
+	"X-Powered-By",
+	"Via",
+	"Alt-Svc",
+	"Cf-*",
+	"X-Envoy-*",
+}
+
+// defaultResponseHeaderRules 各上游格式的默认规则，速率限制与请求 ID 类响应头默认透传
+func defaultResponseHeaderRules() map[string]model.ResponseHeaderRule {
+	deny := func(extra ...string) model.ResponseHeaderRule {
+		headers := append(append([]string{}, commonDeniedResponseHeaders...), extra...)
+		return model.ResponseHeaderRule{Mode: model.ResponseHeaderModeDeny, Headers: headers}
+	}
+	return map[string]model.ResponseHeaderRule{
+		string(model.ChannelTypeClaude): deny("Anthropic-Organization-Id"),
+		string(model.ChannelTypeOpenAI): deny("Openai-Organization", "Openai-Project"),
+		string(model.ChannelTypeGemini): deny(),
+	}
+}
+
+var responseHeaderState struct {
+	mu     sync.RWMutex
+	config model.ResponseHeaderConfig
+}
+
+func init() {
+	responseHeaderState.config = NormalizeResponseHeaderConfig(model.ResponseHeaderConfig{})
+}
+
+// NormalizeResponseHeaderConfig 为未配置的格式填充默认规则，响应头名称统一为规范格式
+func NormalizeResponseHeaderConfig(cfg model.ResponseHeaderConfig) model.ResponseHeaderConfig {
+	formats := defaultResponseHeaderRules()
+	for format, rule := range cfg.Formats {
+		if rule.Mode == "" {
+			rule.Mode = model.ResponseHeaderModeDeny
+		}
+		headers := make([]string, 0, len(rule.Headers))
+		seen := make(map[string]struct{}, len(rule.Headers))
+		for _, h := range rule.Headers {
+			h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+			if h == "" {
+				continue
+			}
+			if _, ok := seen[h]; ok {
+				continue
+			}
+			seen[h] = struct{}{}
+			headers = append(headers, h)
+		}
+		rule.Headers = headers
+		formats[strings.ToLower(format)] = rule
+	}
+	cfg.Formats = formats
+	return cfg
+}
+
+// ValidateResponseHeaderConfig 校验响应头策略（需先 Normalize）
+func ValidateResponseHeaderConfig(cfg model.ResponseHeaderConfig) error {
+	for format, rule := range cfg.Formats {
+		switch model.ChannelType(format) {
+		case model.ChannelTypeClaude, model.ChannelTypeOpenAI, model.ChannelTypeGemini:
+		default:
+			return fmt.Errorf("未知的格式 %q，只能为 claude、openai 或 gemini", format)
+		}
+		if rule.Mode != model.ResponseHeaderModeDeny && rule.Mode != model.ResponseHeaderModeAllow {
+			return fmt.Errorf("%s: mode 只能为 deny 或 allow", format)
+		}
+		if len(rule.Headers) > maxResponseHeaderRuleItems {
+			return fmt.Errorf("%s: 最多 %d 项", format, maxResponseHeaderRuleItems)
+		}
+		for _, h := range rule.Headers {
+			if !responseHeaderNamePattern.MatchString(h) {
+				return fmt.Errorf("%s: 无效的响应头名称 %q", format, h)
+			}
+		}
+	}
+	return nil
+}
+
+// InitResponseHeaderConfig 从数据库 JSON 加载响应头策略
+func InitResponseHeaderConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.ResponseHeaderConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("response headers: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizeResponseHeaderConfig(cfg)
+	if err := ValidateResponseHeaderConfig(cfg); err != nil {
+		log.Warnf("response headers: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateResponseHeaderConfig(cfg)
+}
+
+// UpdateResponseHeaderConfig 更新运行时响应头策略，传入空配置即恢复默认
+func UpdateResponseHeaderConfig(cfg model.ResponseHeaderConfig) {
+	responseHeaderState.mu.Lock()
+	defer responseHeaderState.mu.Unlock()
+	responseHeaderState.config = NormalizeResponseHeaderConfig(cfg)
+}
+
+// GetResponseHeaderConfig 返回当前生效的响应头策略
+func GetResponseHeaderConfig() model.ResponseHeaderConfig {
+	responseHeaderState.mu.RLock()
+	defer responseHeaderState.mu.RUnlock()
+	return responseHeaderState.config
+}
+
+// withResponseHeaderPolicy 在 ModifyResponse 完成响应体处理（含非流式计费）后应用响应头策略
+func withResponseHeaderPolicy(channel *model.Channel, modify func(*http.Response) error) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		if err := modify(resp); err != nil {
+			return err
+		}
+		applyResponseHeaderPolicy(resp, channel, GetRequestTrace(resp.Request.Context()))
+		return nil
+	}
+}
+
+// applyResponseHeaderPolicy 按渠道类型过滤上游响应头，并按配置附加 AMP-Manager 自身的响应头
+func applyResponseHeaderPolicy(resp *http.Response, channel *model.Channel, trace *RequestTrace) {
+	cfg := GetResponseHeaderConfig()
+	if rule, ok := cfg.Formats[string(channel.Type.Protocol())]; ok {
+		filterResponseHeaders(resp.Header, rule)
+	}
+	if !cfg.InjectHeaders {
+		return
+	}
+
+	resp.Header.Set(headerAMPChannelID, channel.ID)
+	if trace == nil {
+		return
+	}
+	resp.Header.Set(headerAMPRequestID, trace.RequestID)
+	// 流式响应的用量在响应头发出后才能得到，只有非流式响应附加费用和缓存状态
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	snapshot := trace.Clone()
+	if snapshot.CostUsd != nil {
+		resp.Header.Set(headerAMPCostUsd, *snapshot.CostUsd)
+	}
+	if status := promptCacheStatus(&snapshot); status != "" {
+		resp.Header.Set(headerAMPCache, status)
+	}
+}
+
+// filterResponseHeaders 按规则移除响应头，描述响应体的响应头始终保留
+func filterResponseHeaders(header http.Header, rule model.ResponseHeaderRule) {
+	allow := rule.Mode == model.ResponseHeaderModeAllow
+	for name := range header {
+		if matchHeaderName(name, protectedResponseHeaders) {
+			continue
+		}
+		if matchHeaderName(name, rule.Headers) != allow {
+			header.Del(name)
+		}
+	}
+}
+
+// promptCacheStatus 根据用量返回提示缓存状态：hit 读取了缓存，write 写入了缓存，miss 未使用缓存
+func promptCacheStatus(trace *RequestTrace) string {
+	switch {
+	case trace.CacheReadInputTokens != nil && *trace.CacheReadInputTokens > 0:
+		return "hit"
+	case trace.CacheCreationInputTokens != nil && *trace.CacheCreationInputTokens > 0:
+		return "write"
+	case trace.InputTokens != nil:
+		return "miss"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,98 @@
+package amp
+
+import (
+	"net/http"
+	"testing"
+
+	"ampmanager/internal/model"
+)
+
+func TestFilterResponseHeaders_DefaultDeny(t *testing.T) {
+	cfg := NormalizeResponseHeaderConfig(model.ResponseHeaderConfig{})
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Set-Cookie", "a=b")
+	header.Set("Cf-Ray", "123")
+	header.Set("Openai-Organization", "org-1")
+	header.Set("X-Ratelimit-Remaining-Requests", "10")
+	header.Set("X-Request-Id", "req-1")
+
+	filterResponseHeaders(header, cfg.Formats["openai"])
+
+	for _, name := range []string{"Set-Cookie", "Cf-Ray", "Openai-Organization"} {
+		if header.Get(name) != "" {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	for _, name := range []string{"Content-Type", "X-Ratelimit-Remaining-Requests", "X-Request-Id"} {
+		if header.Get(name) == "" {
+			t.Errorf("expected %s to be kept", name)
+		}
+	}
+}
+
+func TestFilterResponseHeaders_AllowKeepsProtected(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Anthropic-Ratelimit-Requests-Remaining", "5")
+	header.Set("Request-Id", "req-1")
+	header.Set("X-Other", "1")
+
+	filterResponseHeaders(header, model.ResponseHeaderRule{
+		Mode:    model.ResponseHeaderModeAllow,
+		Headers: []string{"anthropic-ratelimit-*"},
+	})
+
+	if header.Get("Content-Type") == "" || header.Get("Anthropic-Ratelimit-Requests-Remaining") == "" {
+		t.Fatalf("expected protected and allowed headers to be kept: %v", header)
+	}
+	if header.Get("Request-Id") != "" || header.Get("X-Other") != "" {
+		t.Fatalf("expected unlisted headers to be removed: %v", header)
+	}
+}
+
+func TestValidateResponseHeaderConfig(t *testing.T) {
+	cfg := NormalizeResponseHeaderConfig(model.ResponseHeaderConfig{
+		Formats: map[string]model.ResponseHeaderRule{"Claude": {Headers: []string{"request-id"}}},
+	})
+	if err := ValidateResponseHeaderConfig(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rule := cfg.Formats["claude"]; rule.Mode != model.ResponseHeaderModeDeny || rule.Headers[0] != "Request-Id" {
+		t.Fatalf("unexpected normalized rule: %+v", rule)
+	}
+
+	bad := NormalizeResponseHeaderConfig(model.ResponseHeaderConfig{
+		Formats: map[string]model.ResponseHeaderRule{"mistral": {}},
+	})
+	if err := ValidateResponseHeaderConfig(bad); err == nil {
+		t.Fatal("expected unknown format to be rejected")
+	}
+}
+
+func TestApplyResponseHeaderPolicy_InjectsHeaders(t *testing.T) {
+	UpdateResponseHeaderConfig(model.ResponseHeaderConfig{InjectHeaders: true})
+	defer UpdateResponseHeaderConfig(model.ResponseHeaderConfig{})
+
+	input, cacheRead := 100, 80
+	trace := NewRequestTrace("req-1", "u", "k", http.MethodPost, "/v1/messages")
+	trace.InputTokens = &input
+	trace.CacheReadInputTokens = &cacheRead
+	trace.SetCost(1500, "0.001500", "claude-sonnet")
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Content-Type", "application/json")
+	applyResponseHeaderPolicy(resp, &model.Channel{ID: "ch-1", Type: model.ChannelTypeClaude}, trace)
+
+	want := map[string]string{
+		headerAMPChannelID: "ch-1",
+		headerAMPRequestID: "req-1",
+		headerAMPCostUsd:   "0.001500",
+		headerAMPCache:     "hit",
+	}
+	for name, value := range want {
+		if got := resp.Header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
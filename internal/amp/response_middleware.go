@@ -159,10 +159,10 @@ func (m *TokenExtractionMiddleware) WrapReader(reader io.ReadCloser, ctx *Respon
 type ResponseCaptureMiddleware struct{}
 
 func (m *ResponseCaptureMiddleware) WrapReader(reader io.ReadCloser, ctx *ResponseContext) io.ReadCloser {
-	if ctx.RequestID == "" {
+	if ctx.RequestID == "" || ctx.Trace.SummaryOnly() {
 		return reader
 	}
-	return NewResponseCaptureWrapper(reader, ctx.RequestID, ctx.Headers)
+	return NewResponseCaptureWrapper(ctx.Ctx, reader, ctx.RequestID, ctx.Headers)
 }
 
 // LoggingMiddleware 日志中间件
@@ -182,11 +182,18 @@ type TokenUsageMiddleware struct{}
 
 func (m *TokenUsageMiddleware) ProcessBody(body []byte, ctx *ResponseContext) ([]byte, error) {
 	if ctx.Trace != nil && len(body) > 0 {
-		if usage := ExtractTokenUsage(body, ctx.Provider); usage != nil {
+		if ctx.StatusCode < http.StatusBadRequest {
+			NewResponseValidator(ctx.Trace, ctx.Provider, false).ValidateBody(body)
+		}
+		usage := ExtractTokenUsage(body, ctx.Provider)
+		if usage != nil {
 			ctx.Trace.SetUsage(usage.InputTokens, usage.OutputTokens, usage.CacheReadInputTokens, usage.CacheCreationInputTokens)
 			log.Debugf("amp proxy: extracted non-streaming token usage - input=%v, output=%v",
 				ptrToInt(usage.InputTokens), ptrToInt(usage.OutputTokens))
 		}
+		if (usage == nil || usage.OutputTokens == nil) && ctx.StatusCode < http.StatusBadRequest {
+			estimateResponseOutput(ctx.Trace, body, ctx.Provider.Provider)
+		}
 	}
 	return body, nil
 }
@@ -195,7 +202,7 @@ func (m *TokenUsageMiddleware) ProcessBody(body []byte, ctx *ResponseContext) ([
 type ResponseStorageMiddleware struct{}
 
 func (m *ResponseStorageMiddleware) ProcessBody(body []byte, ctx *ResponseContext) ([]byte, error) {
-	if ctx.RequestID != "" && len(body) > 0 {
+	if ctx.RequestID != "" && len(body) > 0 && !ctx.Trace.SummaryOnly() {
 		StoreResponseDetail(ctx.RequestID, sanitizeHeaders(ctx.Headers), body)
 	}
 	return body, nil
@@ -365,10 +372,13 @@ func (p *StreamingPipelineWithContext) ProcessStreamingResponse(resp *http.Respo
 	)
 	// 2. Token 提取器
 	tokenExtractor := NewSSETokenExtractor(healthWrapper, ctx.Trace, ctx.Provider)
-	// 3. 响应捕获包装器
-	captureWrapper := NewResponseCaptureWrapper(tokenExtractor, ctx.RequestID, ctx.Headers)
+	// 3. 响应捕获包装器（日志策略为 summary 时跳过）
+	var captured io.ReadCloser = tokenExtractor
+	if !ctx.Trace.SummaryOnly() {
+		captured = NewResponseCaptureWrapper(ctx.Ctx, tokenExtractor, ctx.RequestID, ctx.Headers)
+	}
 	// 4. 日志包装器（最外层）
-	resp.Body = NewLoggingBodyWrapper(captureWrapper, ctx.Trace, resp.StatusCode, ctx.Ctx)
+	resp.Body = NewLoggingBodyWrapper(captured, ctx.Trace, resp.StatusCode, ctx.Ctx)
 
 	return nil
 }
@@ -390,6 +400,7 @@ func NewDefaultNonStreamingPipeline() *NonStreamingPipeline {
 		NewGzipDecompressor(),
 		&TokenUsageMiddleware{},
 		&ToolNamePrefixStripMiddleware{},
+		&PostProcessMiddleware{},
 		&ResponseStorageMiddleware{},
 	)
 }
@@ -0,0 +1,232 @@
+package amp
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Responses API 的 previous_response_id 由上游保存会话；跨格式转发到 Claude 等渠道时上游没有这段会话，
+// 因此在本地按响应 ID 保存每轮的输入与输出条目，后续请求引用时重建完整的 input。
+// 存储在进程内，多实例部署时需要会话粘滞到同一实例
+
+const (
+	// responseStoreTTL 超过该时间未被引用的响应即丢弃
+	responseStoreTTL           = 6 * time.Hour
+	responseStorePruneInterval = time.Minute
+	// responseStoreMaxBytes 存储总量上限，超出时优先丢弃最久未引用的响应
+	responseStoreMaxBytes = 256 << 20
+	// responseStoreMaxDepth 重建会话时最多回溯的轮数
+	responseStoreMaxDepth = 1000
+)
+
+var errPreviousResponseNotFound = errors.New("previous response not found")
+
+// storedResponse 一轮请求的输入条目与模型输出条目，parentID 指向上一轮响应
+type storedResponse struct {
+	userID   string
+	parentID string
+	items    []json.RawMessage
+	size     int
+	lastUsed time.Time
+}
+
+var responseStore struct {
+	mu        sync.Mutex
+	items     map[string]*storedResponse
+	bytes     int
+	lastPrune time.Time
+}
+
+// responseSession 本次 Responses 请求在响应完成后需要保存的会话状态
+type responseSession struct {
+	userID   string
+	parentID string
+	input    []json.RawMessage
+
+	mu       sync.Mutex
+	recorded bool
+}
+
+// responsesInputItems 将 input（字符串或条目数组）统一为条目数组
+func responsesInputItems(input gjson.Result) []json.RawMessage {
+	if input.Type == gjson.String {
+		item, _ := sjson.Set(`{"type":"message","role":"user"}`, "content", input.String())
+		return []json.RawMessage{json.RawMessage(item)}
+	}
+	var items []json.RawMessage
+	for _, item := range input.Array() {
+		items = append(items, json.RawMessage(item.Raw))
+	}
+	return items
+}
+
+// expandPreviousResponse 用本地保存的会话替换 previous_response_id，返回完整 input 的请求体。
+// 请求未引用本地保存的响应时 found 为 false，请求体保持原样；store 为 false 的请求不保存本轮会话
+func expandPreviousResponse(userID string, body []byte, now time.Time) (expanded []byte, session *responseSession, found bool, err error) {
+	root := gjson.ParseBytes(body)
+	input := responsesInputItems(root.Get("input"))
+	if store := root.Get("store"); !store.Exists() || store.Bool() {
+		session = &responseSession{userID: userID, input: input}
+	}
+
+	previousID := root.Get("previous_response_id").String()
+	if previousID == "" {
+		return body, session, false, nil
+	}
+	history, ok := loadResponseHistory(userID, previousID, now)
+	if !ok {
+		return body, session, false, errPreviousResponseNotFound
+	}
+	if session != nil {
+		session.parentID = previousID
+	}
+
+	items := make([]string, 0, len(history)+len(input))
+	for _, item := range history {
+		items = append(items, string(item))
+	}
+	for _, item := range input {
+		items = append(items, string(item))
+	}
+	out, err := sjson.DeleteBytes(body, "previous_response_id")
+	if err != nil {
+		return body, session, false, err
+	}
+	out, err = sjson.SetRawBytes(out, "input", []byte("["+strings.Join(items, ",")+"]"))
+	if err != nil {
+		return body, session, false, err
+	}
+	return out, session, true, nil
+}
+
+// loadResponseHistory 从指定响应回溯到会话起点，按时间顺序返回各轮的条目。
+// 响应属于其他用户或会话中间某轮已过期时视为不存在
+func loadResponseHistory(userID, responseID string, now time.Time) ([]json.RawMessage, bool) {
+	responseStore.mu.Lock()
+	defer responseStore.mu.Unlock()
+
+	var chain []*storedResponse
+	for id := responseID; id != ""; {
+		entry, ok := responseStore.items[id]
+		if !ok || entry.userID != userID || now.Sub(entry.lastUsed) > responseStoreTTL || len(chain) >= responseStoreMaxDepth {
+			return nil, false
+		}
+		chain = append(chain, entry)
+		id = entry.parentID
+	}
+
+	var history []json.RawMessage
+	for i := len(chain) - 1; i >= 0; i-- {
+		chain[i].lastUsed = now
+		history = append(history, chain[i].items...)
+	}
+	return history, true
+}
+
+// recordResponse 保存已完成的响应对象；同一请求只保存一次
+func (s *responseSession) recordResponse(response gjson.Result, now time.Time) {
+	if s == nil {
+		return
+	}
+	id := response.Get("id").String()
+	status := response.Get("status").String()
+	// 上游重复使用消息 ID 时不能让响应指向自身，否则会话链成环
+	if id == "" || id == s.parentID || (status != "completed" && status != "incomplete") {
+		return
+	}
+	s.mu.Lock()
+	if s.recorded {
+		s.mu.Unlock()
+		return
+	}
+	s.recorded = true
+	s.mu.Unlock()
+
+	items := append([]json.RawMessage{}, s.input...)
+	for _, item := range response.Get("output").Array() {
+		if stored, ok := storedOutputItem(item); ok {
+			items = append(items, stored)
+		}
+	}
+	entry := &storedResponse{userID: s.userID, parentID: s.parentID, items: items, lastUsed: now}
+	for _, item := range items {
+		entry.size += len(item)
+	}
+	saveResponse(id, entry, now)
+}
+
+// storedOutputItem 输出条目作为下一轮的输入保存：只保留消息与函数调用，并去掉本地生成的条目 ID。
+// reasoning 条目没有上游签名，重放时会被 OpenAI 拒绝，Claude 也无法使用
+func storedOutputItem(item gjson.Result) (json.RawMessage, bool) {
+	switch item.Get("type").String() {
+	case "message", "function_call":
+		raw, _ := sjson.Delete(item.Raw, "id")
+		return json.RawMessage(raw), true
+	}
+	return nil, false
+}
+
+func saveResponse(id string, entry *storedResponse, now time.Time) {
+	responseStore.mu.Lock()
+	defer responseStore.mu.Unlock()
+
+	if responseStore.items == nil {
+		responseStore.items = make(map[string]*storedResponse)
+	}
+	if old, ok := responseStore.items[id]; ok {
+		responseStore.bytes -= old.size
+	}
+	responseStore.items[id] = entry
+	responseStore.bytes += entry.size
+
+	if now.Sub(responseStore.lastPrune) > responseStorePruneInterval {
+		for key, item := range responseStore.items {
+			if now.Sub(item.lastUsed) > responseStoreTTL {
+				responseStore.bytes -= item.size
+				delete(responseStore.items, key)
+			}
+		}
+		responseStore.lastPrune = now
+	}
+	if responseStore.bytes <= responseStoreMaxBytes {
+		return
+	}
+	ids := make([]string, 0, len(responseStore.items))
+	for key := range responseStore.items {
+		ids = append(ids, key)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return responseStore.items[ids[i]].lastUsed.Before(responseStore.items[ids[j]].lastUsed)
+	})
+	for _, key := range ids {
+		if responseStore.bytes <= responseStoreMaxBytes {
+			break
+		}
+		responseStore.bytes -= responseStore.items[key].size
+		delete(responseStore.items, key)
+	}
+}
+
+// recordResponseFromSSE 在翻译后的 Responses 流中找到 response.completed / response.incomplete 时保存会话
+func (s *responseSession) recordResponseFromSSE(chunk string, now time.Time) {
+	if s == nil {
+		return
+	}
+	for _, line := range strings.Split(chunk, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		switch gjson.Get(data, "type").String() {
+		case "response.completed", "response.incomplete":
+			s.recordResponse(gjson.Get(data, "response"), now)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package amp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestExpandPreviousResponse_RebuildsHistory(t *testing.T) {
+	now := time.Now()
+
+	// 第一轮：字符串 input，模型发起工具调用
+	first := []byte(`{"model":"m","input":"read a.txt"}`)
+	body, session, found, err := expandPreviousResponse("u1", first, now)
+	if err != nil || found || string(body) != string(first) {
+		t.Fatalf("first turn: found=%v err=%v body=%s", found, err, body)
+	}
+	session.recordResponse(gjson.Parse(`{"id":"resp_store_1","status":"completed","output":[
+		{"id":"rs_1","type":"reasoning","summary":[{"type":"summary_text","text":"hmm"}]},
+		{"id":"fc_1","type":"function_call","call_id":"call_1","name":"read","arguments":"{}"}
+	]}`), now)
+
+	// 第二轮：只携带工具结果
+	second := []byte(`{"model":"m","previous_response_id":"resp_store_1","input":[{"type":"function_call_output","call_id":"call_1","output":"hello"}]}`)
+	body, session, found, err = expandPreviousResponse("u1", second, now)
+	if err != nil || !found {
+		t.Fatalf("second turn: found=%v err=%v", found, err)
+	}
+	res := gjson.ParseBytes(body)
+	if res.Get("previous_response_id").Exists() {
+		t.Fatal("previous_response_id must be removed")
+	}
+	want := []string{"message", "function_call", "function_call_output"}
+	if n := len(res.Get("input").Array()); n != len(want) {
+		t.Fatalf("input has %d items, want %d: %s", n, len(want), body)
+	}
+	for i, typ := range want {
+		if got := res.Get(fmt.Sprintf("input.%d.type", i)).String(); got != typ {
+			t.Errorf("input.%d.type = %q, want %q", i, got, typ)
+		}
+	}
+	if res.Get("input.1.id").Exists() {
+		t.Error("locally generated item ids must not be replayed")
+	}
+	session.recordResponse(gjson.Parse(`{"id":"resp_store_2","status":"completed","output":[{"id":"msg_2","type":"message","role":"assistant","content":[{"type":"output_text","text":"done"}]}]}`), now)
+
+	// 第三轮：沿链回溯两轮
+	third := []byte(`{"model":"m","previous_response_id":"resp_store_2","input":"thanks"}`)
+	body, _, found, err = expandPreviousResponse("u1", third, now)
+	if err != nil || !found {
+		t.Fatalf("third turn: found=%v err=%v", found, err)
+	}
+	if n := len(gjson.GetBytes(body, "input").Array()); n != 5 {
+		t.Fatalf("third turn input has %d items, want 5: %s", n, body)
+	}
+}
+
+func TestExpandPreviousResponse_ScopedToUser(t *testing.T) {
+	now := time.Now()
+	_, session, _, _ := expandPreviousResponse("owner", []byte(`{"input":"hi"}`), now)
+	session.recordResponse(gjson.Parse(`{"id":"resp_store_owner","status":"completed","output":[]}`), now)
+
+	body := []byte(`{"previous_response_id":"resp_store_owner","input":"next"}`)
+	if _, _, _, err := expandPreviousResponse("someone-else", body, now); !errors.Is(err, errPreviousResponseNotFound) {
+		t.Fatalf("expected not found for another user, got %v", err)
+	}
+	if _, _, _, err := expandPreviousResponse("owner", body, now.Add(responseStoreTTL+time.Minute)); !errors.Is(err, errPreviousResponseNotFound) {
+		t.Fatalf("expected expired response to be gone, got %v", err)
+	}
+}
+
+func TestExpandPreviousResponse_StoreFalse(t *testing.T) {
+	_, session, _, err := expandPreviousResponse("u1", []byte(`{"input":"hi","store":false}`), time.Now())
+	if err != nil || session != nil {
+		t.Fatalf("store=false must not create a session, got %v %v", session, err)
+	}
+}
+
+func TestResponseSession_RecordFromSSE(t *testing.T) {
+	now := time.Now()
+	_, session, _, _ := expandPreviousResponse("u1", []byte(`{"input":"hi"}`), now)
+	session.recordResponseFromSSE("event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"x\"}\n\n", now)
+	session.recordResponseFromSSE("event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_store_sse\",\"status\":\"completed\",\"output\":[]}}\n\n", now)
+
+	if _, ok := loadResponseHistory("u1", "resp_store_sse", now); !ok {
+		t.Fatal("completed stream response was not stored")
+	}
+}
@@ -0,0 +1,344 @@
+package amp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	maxSchemaDeviations          = 200 // 内存中保留的最近偏差条数
+	maxDeviationsPerResponse     = 5   // 单个响应最多记录的偏差条数，避免流式响应刷屏
+	schemaDeviationSampleMaxSize = 512
+)
+
+// responseValidationEnabled 控制是否校验上游响应结构（调试用，默认关闭）
+var responseValidationEnabled atomic.Bool
+
+// SetResponseValidationEnabled 设置上游响应结构校验开关
+func SetResponseValidationEnabled(enabled bool) {
+	responseValidationEnabled.Store(enabled)
+	if enabled {
+		log.Info("response validation: enabled")
+	} else {
+		log.Info("response validation: disabled")
+	}
+}
+
+// IsResponseValidationEnabled 获取上游响应结构校验状态
+func IsResponseValidationEnabled() bool {
+	return responseValidationEnabled.Load()
+}
+
+// SchemaDeviation 上游响应结构偏差记录
+type SchemaDeviation struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	ChannelID string    `json:"channelId,omitempty"`
+	Provider  string    `json:"provider"`
+	Streaming bool      `json:"streaming"`
+	Event     string    `json:"event,omitempty"`
+	Issue     string    `json:"issue"`
+	Sample    string    `json:"sample"`
+}
+
+// SchemaDeviationCount 按提供商和问题聚合的偏差计数
+type SchemaDeviationCount struct {
+	Provider string `json:"provider"`
+	Issue    string `json:"issue"`
+	Count    int64  `json:"count"`
+}
+
+type deviationCountKey struct {
+	provider string
+	issue    string
+}
+
+// schemaDeviationLog 最近偏差的环形缓冲区
+type schemaDeviationLog struct {
+	mu     sync.Mutex
+	items  []SchemaDeviation
+	next   int
+	full   bool
+	counts map[deviationCountKey]int64
+}
+
+var globalDeviationLog = &schemaDeviationLog{
+	items:  make([]SchemaDeviation, maxSchemaDeviations),
+	counts: make(map[deviationCountKey]int64),
+}
+
+func (l *schemaDeviationLog) add(d SchemaDeviation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items[l.next] = d
+	l.next = (l.next + 1) % len(l.items)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.counts[deviationCountKey{provider: d.Provider, issue: d.Issue}]++
+}
+
+// GetSchemaDeviations 返回最近的偏差记录（新的在前）和聚合计数
+func GetSchemaDeviations() ([]SchemaDeviation, []SchemaDeviationCount) {
+	l := globalDeviationLog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size := l.next
+	if l.full {
+		size = len(l.items)
+	}
+	items := make([]SchemaDeviation, 0, size)
+	for i := 1; i <= size; i++ {
+		idx := (l.next - i + len(l.items)) % len(l.items)
+		items = append(items, l.items[idx])
+	}
+
+	counts := make([]SchemaDeviationCount, 0, len(l.counts))
+	for key, count := range l.counts {
+		counts = append(counts, SchemaDeviationCount{Provider: key.provider, Issue: key.issue, Count: count})
+	}
+	return items, counts
+}
+
+// ClearSchemaDeviations 清空偏差记录
+func ClearSchemaDeviations() {
+	l := globalDeviationLog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items = make([]SchemaDeviation, maxSchemaDeviations)
+	l.next = 0
+	l.full = false
+	l.counts = make(map[deviationCountKey]int64)
+}
+
+// ResponseValidator 校验单个上游响应的结构
+type ResponseValidator struct {
+	provider  ProviderKind
+	trace     *RequestTrace
+	streaming bool
+	reported  int
+}
+
+// NewResponseValidator 创建响应校验器；未启用校验时返回 nil
+func NewResponseValidator(trace *RequestTrace, info ProviderInfo, streaming bool) *ResponseValidator {
+	if !IsResponseValidationEnabled() {
+		return nil
+	}
+	return &ResponseValidator{
+		provider:  info.Provider,
+		trace:     trace,
+		streaming: streaming,
+	}
+}
+
+// ValidateBody 校验非流式响应体
+func (v *ResponseValidator) ValidateBody(body []byte) {
+	if v == nil || len(body) == 0 {
+		return
+	}
+	for _, issue := range validateResponseBody(v.provider, body) {
+		v.report("", issue, body)
+	}
+}
+
+// ValidateSSE 校验单个 SSE 事件
+func (v *ResponseValidator) ValidateSSE(eventName string, data []byte) {
+	if v == nil || len(data) == 0 {
+		return
+	}
+	for _, issue := range validateSSEEvent(v.provider, eventName, data) {
+		v.report(eventName, issue, data)
+	}
+}
+
+func (v *ResponseValidator) report(eventName, issue string, sample []byte) {
+	if v.reported >= maxDeviationsPerResponse {
+		return
+	}
+	v.reported++
+
+	deviation := SchemaDeviation{
+		Time:      time.Now().UTC(),
+		Provider:  string(v.provider),
+		Streaming: v.streaming,
+		Event:     eventName,
+		Issue:     issue,
+		Sample:    truncateSample(sample),
+	}
+	if v.trace != nil {
+		snapshot := v.trace.Clone()
+		deviation.RequestID = snapshot.RequestID
+		deviation.ChannelID = snapshot.ChannelID
+	}
+	globalDeviationLog.add(deviation)
+
+	log.WithFields(log.Fields{
+		"requestId": deviation.RequestID,
+		"channelId": deviation.ChannelID,
+		"provider":  deviation.Provider,
+		"event":     eventName,
+		"sample":    deviation.Sample,
+	}).Warnf("response validation: %s", issue)
+}
+
+func truncateSample(data []byte) string {
+	sample := SanitizeErrorMessage(string(data))
+	if len(sample) > schemaDeviationSampleMaxSize {
+		return sample[:schemaDeviationSampleMaxSize] + "..."
+	}
+	return sample
+}
+
+// validateResponseBody 按提供商格式校验非流式响应体，返回发现的问题
+func validateResponseBody(provider ProviderKind, body []byte) []string {
+	// 音频转写可按 response_format 返回 text/srt/vtt 纯文本
+	if provider == ProviderOpenAIAudio && !gjson.ValidBytes(body) {
+		return nil
+	}
+	if !gjson.ValidBytes(body) {
+		return []string{"响应体不是合法 JSON"}
+	}
+	root := gjson.ParseBytes(body)
+	if !root.IsObject() {
+		return []string{"响应体不是 JSON 对象"}
+	}
+	// 错误响应有各自的格式，不做结构校验
+	if root.Get("error").Exists() {
+		return nil
+	}
+
+	var issues []string
+	switch provider {
+	case ProviderAnthropic:
+		if t := root.Get("type").String(); t != "message" {
+			issues = append(issues, fmt.Sprintf("type 应为 message，实际为 %q", t))
+		}
+		issues = appendArrayIssue(issues, root, "content", false)
+		issues = appendUsageIssues(issues, root, "usage", true, "input_tokens", "output_tokens")
+	case ProviderOpenAIChat:
+		issues = appendArrayIssue(issues, root, "choices", true)
+		issues = appendUsageIssues(issues, root, "usage", true, "prompt_tokens", "completion_tokens")
+	case ProviderOpenAIResponses:
+		issues = appendArrayIssue(issues, root, "output", false)
+		issues = appendUsageIssues(issues, root, "usage", true, "input_tokens", "output_tokens")
+	case ProviderOpenAIEmbeddings:
+		issues = appendArrayIssue(issues, root, "data", true)
+		issues = appendUsageIssues(issues, root, "usage", true, "prompt_tokens")
+	case ProviderOpenAIAudio:
+		if root.Get("text").Type != gjson.String {
+			issues = append(issues, "缺少 text 字段")
+		}
+	case ProviderGemini:
+		issues = appendArrayIssue(issues, root, "candidates", true)
+		issues = appendUsageIssues(issues, root, "usageMetadata", false, "promptTokenCount", "candidatesTokenCount")
+	}
+	return issues
+}
+
+// knownAnthropicEvents Anthropic Messages 流式事件类型
+var knownAnthropicEvents = map[string]bool{
+	"message_start":       true,
+	"content_block_start": true,
+	"content_block_delta": true,
+	"content_block_stop":  true,
+	"message_delta":       true,
+	"message_stop":        true,
+	"ping":                true,
+	"error":               true,
+}
+
+// validateSSEEvent 按提供商格式校验单个 SSE 事件，返回发现的问题
+func validateSSEEvent(provider ProviderKind, eventName string, data []byte) []string {
+	if !gjson.ValidBytes(data) {
+		return []string{"SSE data 不是合法 JSON"}
+	}
+	root := gjson.ParseBytes(data)
+	if !root.IsObject() {
+		return []string{"SSE data 不是 JSON 对象"}
+	}
+	if root.Get("error").Exists() {
+		return nil
+	}
+
+	var issues []string
+	switch provider {
+	case ProviderAnthropic:
+		eventType := root.Get("type").String()
+		if !knownAnthropicEvents[eventType] {
+			issues = append(issues, fmt.Sprintf("未知的 SSE 事件类型 %q", eventType))
+		}
+		if eventName != "" && eventName != eventType {
+			issues = append(issues, fmt.Sprintf("event 行 %q 与 data.type %q 不一致", eventName, eventType))
+		}
+		switch eventType {
+		case "message_start":
+			issues = appendUsageIssues(issues, root, "message.usage", true, "input_tokens", "output_tokens")
+		case "message_delta":
+			issues = appendUsageIssues(issues, root, "usage", false, "output_tokens")
+		}
+	case ProviderOpenAIChat:
+		issues = appendArrayIssue(issues, root, "choices", false)
+		issues = appendUsageIssues(issues, root, "usage", false, "prompt_tokens", "completion_tokens")
+	case ProviderOpenAIResponses:
+		eventType := root.Get("type").String()
+		if eventType != "error" && !strings.HasPrefix(eventType, "response.") {
+			issues = append(issues, fmt.Sprintf("未知的 SSE 事件类型 %q", eventType))
+		}
+		if eventType == "response.completed" {
+			issues = appendUsageIssues(issues, root, "response.usage", true, "input_tokens", "output_tokens")
+		}
+	case ProviderGemini:
+		if !root.Get("candidates").Exists() && !root.Get("usageMetadata").Exists() {
+			issues = append(issues, "缺少 candidates 和 usageMetadata")
+		}
+		issues = appendArrayIssue(issues, root, "candidates", false)
+		issues = appendUsageIssues(issues, root, "usageMetadata", false, "promptTokenCount", "candidatesTokenCount")
+	}
+	return issues
+}
+
+// appendArrayIssue 检查字段是否为数组；required 为 true 时字段缺失或为空数组也视为问题
+func appendArrayIssue(issues []string, root gjson.Result, path string, required bool) []string {
+	field := root.Get(path)
+	if !field.Exists() || field.Type == gjson.Null {
+		if required {
+			return append(issues, fmt.Sprintf("缺少 %s 数组", path))
+		}
+		return issues
+	}
+	if !field.IsArray() {
+		return append(issues, fmt.Sprintf("%s 不是数组", path))
+	}
+	if required && len(field.Array()) == 0 {
+		return append(issues, fmt.Sprintf("%s 为空数组", path))
+	}
+	return issues
+}
+
+// appendUsageIssues 检查 usage 对象中的计数字段是否为数字
+func appendUsageIssues(issues []string, root gjson.Result, path string, required bool, fields ...string) []string {
+	usage := root.Get(path)
+	if !usage.Exists() || usage.Type == gjson.Null {
+		if required {
+			return append(issues, fmt.Sprintf("缺少 %s", path))
+		}
+		return issues
+	}
+	if !usage.IsObject() {
+		return append(issues, fmt.Sprintf("%s 不是对象", path))
+	}
+	for _, name := range fields {
+		field := usage.Get(name)
+		if field.Exists() && field.Type != gjson.Number {
+			issues = append(issues, fmt.Sprintf("%s.%s 不是数字", path, name))
+		}
+	}
+	return issues
+}
@@ -0,0 +1,139 @@
+package amp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateResponseBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   ProviderKind
+		body       string
+		wantIssues []string
+	}{
+		{
+			name:     "valid openai chat",
+			provider: ProviderOpenAIChat,
+			body:     `{"choices":[{"message":{"content":"hi"}}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+		},
+		{
+			name:       "openai chat missing choices",
+			provider:   ProviderOpenAIChat,
+			body:       `{"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+			wantIssues: []string{"缺少 choices 数组"},
+		},
+		{
+			name:       "openai chat string usage",
+			provider:   ProviderOpenAIChat,
+			body:       `{"choices":[{}],"usage":{"prompt_tokens":"3","completion_tokens":1}}`,
+			wantIssues: []string{"usage.prompt_tokens 不是数字"},
+		},
+		{
+			name:     "valid anthropic",
+			provider: ProviderAnthropic,
+			body:     `{"type":"message","content":[],"usage":{"input_tokens":1,"output_tokens":2}}`,
+		},
+		{
+			name:       "anthropic wrong type",
+			provider:   ProviderAnthropic,
+			body:       `{"type":"completion","usage":{"input_tokens":1,"output_tokens":2}}`,
+			wantIssues: []string{`type 应为 message，实际为 "completion"`},
+		},
+		{
+			name:     "error payload skipped",
+			provider: ProviderGemini,
+			body:     `{"error":{"message":"quota"}}`,
+		},
+		{
+			name:       "invalid json",
+			provider:   ProviderGemini,
+			body:       `{"candidates":[`,
+			wantIssues: []string{"响应体不是合法 JSON"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateResponseBody(tt.provider, []byte(tt.body))
+			if strings.Join(got, "|") != strings.Join(tt.wantIssues, "|") {
+				t.Errorf("validateResponseBody() = %v, want %v", got, tt.wantIssues)
+			}
+		})
+	}
+}
+
+func TestValidateSSEEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   ProviderKind
+		event      string
+		data       string
+		wantIssues []string
+	}{
+		{
+			name:     "anthropic delta",
+			provider: ProviderAnthropic,
+			event:    "content_block_delta",
+			data:     `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`,
+		},
+		{
+			name:       "anthropic unknown event",
+			provider:   ProviderAnthropic,
+			data:       `{"type":"content_delta"}`,
+			wantIssues: []string{`未知的 SSE 事件类型 "content_delta"`},
+		},
+		{
+			name:       "anthropic event mismatch",
+			provider:   ProviderAnthropic,
+			event:      "message_stop",
+			data:       `{"type":"ping"}`,
+			wantIssues: []string{`event 行 "message_stop" 与 data.type "ping" 不一致`},
+		},
+		{
+			name:     "openai chat usage chunk",
+			provider: ProviderOpenAIChat,
+			data:     `{"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":2}}`,
+		},
+		{
+			name:       "responses completed without usage",
+			provider:   ProviderOpenAIResponses,
+			event:      "response.completed",
+			data:       `{"type":"response.completed","response":{}}`,
+			wantIssues: []string{"缺少 response.usage"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateSSEEvent(tt.provider, tt.event, []byte(tt.data))
+			if strings.Join(got, "|") != strings.Join(tt.wantIssues, "|") {
+				t.Errorf("validateSSEEvent() = %v, want %v", got, tt.wantIssues)
+			}
+		})
+	}
+}
+
+func TestResponseValidatorRecordsDeviations(t *testing.T) {
+	SetResponseValidationEnabled(true)
+	defer SetResponseValidationEnabled(false)
+	ClearSchemaDeviations()
+	defer ClearSchemaDeviations()
+
+	trace := NewRequestTrace("req-validate", "user", "key", "POST", "/v1/chat/completions")
+	validator := NewResponseValidator(trace, ProviderInfo{Provider: ProviderOpenAIChat}, true)
+	for i := 0; i < maxDeviationsPerResponse+3; i++ {
+		validator.ValidateSSE("", []byte(`not json`))
+	}
+
+	items, counts := GetSchemaDeviations()
+	if len(items) != maxDeviationsPerResponse {
+		t.Fatalf("deviations = %d, want %d", len(items), maxDeviationsPerResponse)
+	}
+	if items[0].RequestID != "req-validate" || !items[0].Streaming {
+		t.Errorf("deviation = %+v", items[0])
+	}
+	if len(counts) != 1 || counts[0].Count != int64(maxDeviationsPerResponse) {
+		t.Errorf("counts = %+v", counts)
+	}
+}
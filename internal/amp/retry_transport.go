@@ -14,6 +14,8 @@ import (
 	"syscall"
 	"time"
 
+	"ampmanager/internal/model"
+
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/gjson"
@@ -184,6 +186,7 @@ func (rt *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 
 		// 发起请求
+		startedAt := time.Now().UTC()
 		resp, err := rt.Base.RoundTrip(attemptReq)
 
 		if err != nil {
@@ -194,15 +197,19 @@ func (rt *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 				var fbTimeout *FirstByteTimeoutError
 				if errors.As(err, &fbTimeout) {
 					log.Warnf("retry: streaming request first-byte timeout, not retrying (upstream may have started processing)")
+					rt.recordAttempt(req, attempt, startedAt, nil, err, 0)
 					return nil, err
 				}
 			}
 
 			if rt.shouldRetryError(err) && attempt < cfg.MaxAttempts {
 				rt.logRetryAttempt(req, attempt, cfg.MaxAttempts, err, nil)
-				rt.backoff(req.Context(), attempt, cfg, nil)
+				delay := rt.backoffDelay(attempt, cfg, nil)
+				rt.recordAttempt(req, attempt, startedAt, nil, err, delay)
+				rt.backoff(req.Context(), attempt, delay)
 				continue
 			}
+			rt.recordAttempt(req, attempt, startedAt, nil, err, 0)
 			return nil, err
 		}
 
@@ -215,7 +222,9 @@ func (rt *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 			}
 			rt.logRetryAttempt(req, attempt, cfg.MaxAttempts, nil, resp)
 			_ = resp.Body.Close()
-			rt.backoff(req.Context(), attempt, cfg, retryAfter)
+			delay := rt.backoffDelay(attempt, cfg, retryAfter)
+			rt.recordAttempt(req, attempt, startedAt, resp, nil, delay)
+			rt.backoff(req.Context(), attempt, delay)
 			continue
 		}
 
@@ -225,7 +234,9 @@ func (rt *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 			lastErr = emptyBodyErr
 			rt.logRetryAttempt(req, attempt, cfg.MaxAttempts, emptyBodyErr, resp)
 			_ = resp.Body.Close()
-			rt.backoff(req.Context(), attempt, cfg, nil)
+			delay := rt.backoffDelay(attempt, cfg, nil)
+			rt.recordAttempt(req, attempt, startedAt, resp, emptyBodyErr, delay)
+			rt.backoff(req.Context(), attempt, delay)
 			continue
 		}
 
@@ -242,13 +253,17 @@ func (rt *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 					// 流式请求首字节超时后不再重试
 					if isStreaming {
 						log.Warnf("retry: streaming request first-byte timeout, not retrying")
+						rt.recordAttempt(req, attempt, startedAt, resp, probeErr, 0)
 						return nil, probeErr
 					}
 					if attempt < cfg.MaxAttempts {
 						rt.logRetryAttempt(req, attempt, cfg.MaxAttempts, probeErr, resp)
-						rt.backoff(req.Context(), attempt, cfg, nil)
+						delay := rt.backoffDelay(attempt, cfg, nil)
+						rt.recordAttempt(req, attempt, startedAt, resp, probeErr, delay)
+						rt.backoff(req.Context(), attempt, delay)
 						continue
 					}
+					rt.recordAttempt(req, attempt, startedAt, resp, probeErr, 0)
 					return nil, &RetryExhaustedError{Attempts: attempt, LastErr: probeErr}
 				}
 
@@ -261,6 +276,7 @@ func (rt *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 
 		// 成功
+		rt.recordAttempt(req, attempt, startedAt, resp, nil, 0)
 		if attempt > 1 {
 			log.Infof("retry: request succeeded after %d attempts: %s %s", attempt, req.Method, req.URL.Path)
 		}
@@ -297,16 +313,12 @@ func (rt *RetryTransport) cacheRequestBody(req *http.Request, maxBytes int64) ([
 		return data, true, nil
 	}
 
-	// 读取并缓存请求体
-	data, err := io.ReadAll(io.LimitReader(req.Body, maxBytes+1))
+	// 读取并缓存请求体；太大时已读取的部分与剩余部分拼接放回，请求体保持完整并返回不可重试
+	data, ok, err := peekRequestBody(req, maxBytes)
 	if err != nil {
 		return nil, false, err
 	}
-	_ = req.Body.Close()
-
-	if int64(len(data)) > maxBytes {
-		// 太大，重建 body 并返回不可重试
-		req.Body = io.NopCloser(bytes.NewReader(data))
+	if !ok {
 		return nil, false, nil
 	}
 
@@ -314,8 +326,6 @@ func (rt *RetryTransport) cacheRequestBody(req *http.Request, maxBytes int64) ([
 	req.GetBody = func() (io.ReadCloser, error) {
 		return io.NopCloser(bytes.NewReader(data)), nil
 	}
-	req.Body = io.NopCloser(bytes.NewReader(data))
-	req.ContentLength = int64(len(data))
 
 	return data, true, nil
 }
@@ -571,23 +581,24 @@ func (rt *RetryTransport) parseRetryDelayFromBody(resp *http.Response, limit int
 	return nil
 }
 
-// backoff 执行退避等待
-func (rt *RetryTransport) backoff(ctx context.Context, attempt int, cfg *RetryConfig, retryAfter *time.Duration) {
-	var delay time.Duration
-
+// backoffDelay 计算本次退避时长（优先使用上游给出的 Retry-After）
+func (rt *RetryTransport) backoffDelay(attempt int, cfg *RetryConfig, retryAfter *time.Duration) time.Duration {
 	if retryAfter != nil {
-		delay = *retryAfter
-	} else {
-		// 指数退避 + 抖动
-		delay = cfg.BackoffBase * (1 << (attempt - 1))
-		if delay > cfg.BackoffMax {
-			delay = cfg.BackoffMax
-		}
-		// 添加 ±25% 的抖动
-		jitter := time.Duration(rand.Float64()*float64(delay)*0.5) - delay/4
-		delay += jitter
+		return *retryAfter
 	}
 
+	// 指数退避 + 抖动
+	delay := cfg.BackoffBase * (1 << (attempt - 1))
+	if delay > cfg.BackoffMax {
+		delay = cfg.BackoffMax
+	}
+	// 添加 ±25% 的抖动
+	jitter := time.Duration(rand.Float64()*float64(delay)*0.5) - delay/4
+	return delay + jitter
+}
+
+// backoff 执行退避等待
+func (rt *RetryTransport) backoff(ctx context.Context, attempt int, delay time.Duration) {
 	log.Debugf("retry: backing off for %v before attempt %d", delay, attempt+1)
 
 	timer := time.NewTimer(delay)
@@ -599,6 +610,32 @@ func (rt *RetryTransport) backoff(ctx context.Context, attempt int, cfg *RetryCo
 	}
 }
 
+// recordAttempt 将本次尝试写入 RequestTrace，供请求日志持久化重试历史
+func (rt *RetryTransport) recordAttempt(req *http.Request, attempt int, startedAt time.Time, resp *http.Response, err error, delay time.Duration) {
+	trace := GetRequestTrace(req.Context())
+	if trace == nil {
+		return
+	}
+
+	record := model.RequestAttempt{
+		Attempt:    attempt,
+		StartedAt:  startedAt,
+		DurationMs: time.Since(startedAt).Milliseconds(),
+		BackoffMs:  delay.Milliseconds(),
+	}
+	trace.mu.Lock()
+	record.ChannelID = trace.ChannelID
+	trace.mu.Unlock()
+	if resp != nil {
+		record.StatusCode = resp.StatusCode
+	}
+	if err != nil {
+		record.Error = SanitizeError(err)
+		record.ErrorClass = classifyError(err)
+	}
+	trace.AddAttempt(record)
+}
+
 // logRetryAttempt 记录重试日志
 func (rt *RetryTransport) logRetryAttempt(req *http.Request, attempt, maxAttempts int, err error, resp *http.Response) {
 	fields := log.Fields{
@@ -0,0 +1,77 @@
+package amp
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRetryTransportRecordsAttempts(t *testing.T) {
+	calls := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		status := http.StatusOK
+		body := `{"ok":true}`
+		if calls == 1 {
+			status = http.StatusServiceUnavailable
+			body = `{"error":"overloaded"}`
+		}
+		return &http.Response{
+			StatusCode:    status,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	})
+
+	cfg := DefaultRetryConfig()
+	cfg.BackoffBase = time.Millisecond
+	cfg.BackoffMax = time.Millisecond
+	rt := NewRetryTransport(base, cfg)
+
+	trace := NewRequestTrace("req-1", "user-1", "key-1", http.MethodPost, "/v1/messages")
+	trace.SetChannel("channel-1", "anthropic", "messages")
+
+	req, _ := http.NewRequest(http.MethodPost, "http://upstream/v1/messages", strings.NewReader(`{}`))
+	req = req.WithContext(WithRequestTrace(req.Context(), trace))
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	snapshot := trace.Clone()
+	if len(snapshot.Attempts) != 2 {
+		t.Fatalf("attempts = %d, want 2", len(snapshot.Attempts))
+	}
+
+	first := snapshot.Attempts[0]
+	if first.Attempt != 1 || first.StatusCode != http.StatusServiceUnavailable || first.ChannelID != "channel-1" {
+		t.Errorf("first attempt = %+v", first)
+	}
+	if first.BackoffMs < 0 {
+		t.Errorf("first attempt backoff = %d, want >= 0", first.BackoffMs)
+	}
+
+	second := snapshot.Attempts[1]
+	if second.Attempt != 2 || second.StatusCode != http.StatusOK || second.BackoffMs != 0 {
+		t.Errorf("second attempt = %+v", second)
+	}
+
+	if got := attemptsJSON(snapshot.Attempts); got == nil || !strings.Contains(*got, `"statusCode":503`) {
+		t.Errorf("attemptsJSON() = %v", got)
+	}
+	if got := attemptsJSON(snapshot.Attempts[:1]); got != nil {
+		t.Errorf("attemptsJSON() for single attempt = %v, want nil", *got)
+	}
+}
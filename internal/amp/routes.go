@@ -12,13 +12,14 @@ import (
 func RegisterProxyRoutes(engine *gin.Engine, proxy *httputil.ReverseProxy) {
 	cfg := config.Get()
 	proxyLimiter := middleware.NewRateLimiter(cfg.RateLimitProxyRPS, 200)
+	countCache := newTokenCountCache(cfg.TokenCountCacheSize, cfg.TokenCountCacheTTL)
 
 	proxyHandler := ProxyHandler(proxy)
 	channelHandler := ChannelProxyHandler()
 	modelsHandler := ModelsHandler()
 
 	// Register amp proxy routes at root level
-	registerAmpProxyAPI(engine, proxyHandler, channelHandler, modelsHandler, proxyLimiter)
+	registerAmpProxyAPI(engine, proxyHandler, channelHandler, modelsHandler, proxyLimiter, countCache)
 
 	// Register management routes (user, auth, threads, etc.) - proxied to ampcode.com
 	registerManagementRoutes(engine, proxyHandler, proxyLimiter)
@@ -35,6 +36,10 @@ func ThreadRedirectHandler() gin.HandlerFunc {
 
 func createRoutingHandler(upstreamHandler, channelHandler gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if IsRawPassthrough(c) && GetChannelConfig(c) == nil {
+			abortRawPassthroughNoChannel(c)
+			return
+		}
 		if IsNativeMode(c) {
 			upstreamHandler(c)
 			return
@@ -48,8 +53,19 @@ func createRoutingHandler(upstreamHandler, channelHandler gin.HandlerFunc) gin.H
 	}
 }
 
-// createProviderHandler routes provider requests, with special handling for /models endpoints
-func createProviderHandler(upstreamHandler, channelHandler, modelsHandler gin.HandlerFunc) gin.HandlerFunc {
+// createGeminiActionHandler routes /v1beta/models/*action, sending batchGenerateContent to the batch handler
+func createGeminiActionHandler(routingHandler, batchHandler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isBatchPath(c.Request.URL.Path) {
+			batchHandler(c)
+			return
+		}
+		routingHandler(c)
+	}
+}
+
+// createProviderHandler routes provider requests, with special handling for /models and batch endpoints
+func createProviderHandler(upstreamHandler, channelHandler, modelsHandler, batchHandler gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if IsNativeMode(c) {
 			upstreamHandler(c)
@@ -64,8 +80,17 @@ func createProviderHandler(upstreamHandler, channelHandler, modelsHandler gin.Ha
 			return
 		}
 
+		if isBatchPath(path) {
+			batchHandler(c)
+			return
+		}
+
 		// Otherwise use normal routing
 		channelCfg := GetChannelConfig(c)
+		if IsRawPassthrough(c) && (channelCfg == nil || channelCfg.Channel == nil) {
+			abortRawPassthroughNoChannel(c)
+			return
+		}
 		if channelCfg != nil && channelCfg.Channel != nil {
 			channelHandler(c)
 			return
@@ -85,7 +110,11 @@ func isModelsEndpoint(path string) bool {
 func registerManagementRoutes(engine *gin.Engine, proxyHandler gin.HandlerFunc, rateLimiter *middleware.RateLimiter) {
 	// Management routes under /api/* - proxied to ampcode.com
 	api := engine.Group("/api")
+	api.Use(TracingMiddleware())
+	api.Use(DatabaseSwapGuard())
 	api.Use(APIKeyAuthMiddleware())
+	// 非模型调用的辅助流量按请求日志策略记录（默认不记录）
+	api.Use(RequestLoggingMiddleware())
 	api.Use(rateLimiter.RateLimitByAPIKey())
 
 	// User and auth management
@@ -115,6 +144,7 @@ func registerManagementRoutes(engine *gin.Engine, proxyHandler gin.HandlerFunc,
 	// These are public pages (threads, docs, etc.) that don't require API key auth
 	publicRoutes := engine.Group("/")
 	publicRoutes.Use(PublicProxyMiddleware())
+	publicRoutes.Use(RequestLoggingMiddleware())
 
 	// Thread pages redirect to official ampcode.com for browser access
 	publicRoutes.GET("/threads/:threadID", ThreadRedirectHandler())
@@ -131,28 +161,74 @@ func registerManagementRoutes(engine *gin.Engine, proxyHandler gin.HandlerFunc,
 	publicRoutes.Any("/auth/*path", proxyHandler)
 }
 
+// complianceMiddlewares returns the request rewrites required for compliance: the mandatory group
+// system prompt is prepended first, then PII is redacted. They run for native mode and raw passthrough
+// requests alike and must never be skipped
+func complianceMiddlewares() []gin.HandlerFunc {
+	return []gin.HandlerFunc{GroupSystemPromptMiddleware(), PIIRedactionMiddleware()}
+}
+
 // registerAmpProxyAPI registers amp proxy routes at root /api/* level
 // This is needed because amp CLI ignores URL path and sends requests directly to /api/*
-func registerAmpProxyAPI(engine *gin.Engine, proxyHandler, channelHandler, modelsHandler gin.HandlerFunc, rateLimiter *middleware.RateLimiter) {
+func registerAmpProxyAPI(engine *gin.Engine, proxyHandler, channelHandler, modelsHandler gin.HandlerFunc, rateLimiter *middleware.RateLimiter, countCache *tokenCountCache) {
 	api := engine.Group("/api")
+	// 追踪最先执行，根 span 覆盖维护排队与鉴权耗时
+	api.Use(TracingMiddleware())
+	// 维护模式在鉴权之前拦截，排队中的请求在数据库替换完成后再鉴权
+	api.Use(MaintenanceMiddleware())
+	api.Use(DatabaseSwapGuard())
 	api.Use(APIKeyAuthMiddleware())
+	// 管理员原样透传调试请求跳过之后的映射、注入与缓存，渠道转发时不做翻译与改写
+	api.Use(RawPassthroughMiddleware())
+	// multipart 与二进制请求体按接口限制大小并以流的方式交给后续处理，超限时返回 413
+	api.Use(RequestBodyLimitMiddleware())
+	// 请求内存预算覆盖之后详情捕获、翻译与流聚合的缓冲
+	api.Use(MemoryBudgetMiddleware())
+	api.Use(RequestLoggingMiddleware())
 	api.Use(rateLimiter.RateLimitByAPIKey())
+	api.Use(RateLimitMiddleware())
+	// 并发上限在令牌桶之后占用，被令牌桶拒绝的请求不占用并发
+	api.Use(ConcurrencyLimitMiddleware())
 	api.Use(NativeModeSkipMiddleware(BillingCheckMiddleware()))
-	api.Use(NativeModeSkipMiddleware(ApplyModelMappingMiddleware()))
+	api.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(ApplyModelMappingMiddleware())))
+	api.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(SystemPromptMiddleware())))
+	// 分组强制系统提示词与转发前脱敏在用户系统提示词之后、请求流水线之前执行；合规要求，原生模式与原样透传请求同样生效
+	api.Use(complianceMiddlewares()...)
+	api.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(RequestPipelineMiddleware())))
+	api.Use(NativeModeSkipMiddleware(RequestCostCeilingMiddleware()))
+	api.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(ToolLoopGuardMiddleware())))
+	// token 计数响应缓存：命中时不再选择渠道或请求上游，原生模式同样生效
+	api.Use(RawPassthroughSkipMiddleware(TokenCountCacheMiddleware(countCache)))
 	api.Use(NativeModeSkipMiddleware(ChannelRouterMiddleware()))
 	api.Use(NativeModeSkipMiddleware(RequestCaptureMiddleware()))
 
 	api.Any("/internal", ProxyDisabledSkipMiddleware(BalanceAdMiddleware()), ProxyDisabledSkipMiddleware(DebugInternalAPIMiddleware()), ProxyDisabledSkipMiddleware(WebSearchStrategyMiddleware()), proxyHandler)
 	api.Any("/internal/*path", ProxyDisabledSkipMiddleware(BalanceAdMiddleware()), ProxyDisabledSkipMiddleware(DebugInternalAPIMiddleware()), ProxyDisabledSkipMiddleware(WebSearchStrategyMiddleware()), proxyHandler)
 
-	api.Any("/provider/:provider/*path", createProviderHandler(proxyHandler, channelHandler, modelsHandler))
+	batchHandler := BatchProxyHandler(proxyHandler)
+	api.Any("/provider/:provider/*path", createProviderHandler(proxyHandler, channelHandler, modelsHandler, batchHandler))
 
 	// Root level v1/v1beta routes for OpenAI/Anthropic/Gemini compatible endpoints
 	v1 := engine.Group("/v1")
+	v1.Use(TracingMiddleware())
+	v1.Use(MaintenanceMiddleware())
+	v1.Use(DatabaseSwapGuard())
 	v1.Use(APIKeyAuthMiddleware())
+	v1.Use(RawPassthroughMiddleware())
+	v1.Use(RequestBodyLimitMiddleware())
+	v1.Use(MemoryBudgetMiddleware())
+	v1.Use(RequestLoggingMiddleware())
 	v1.Use(rateLimiter.RateLimitByAPIKey())
+	v1.Use(RateLimitMiddleware())
+	v1.Use(ConcurrencyLimitMiddleware())
 	v1.Use(NativeModeSkipMiddleware(BillingCheckMiddleware()))
-	v1.Use(NativeModeSkipMiddleware(ApplyModelMappingMiddleware()))
+	v1.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(ApplyModelMappingMiddleware())))
+	v1.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(SystemPromptMiddleware())))
+	v1.Use(complianceMiddlewares()...)
+	v1.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(RequestPipelineMiddleware())))
+	v1.Use(NativeModeSkipMiddleware(RequestCostCeilingMiddleware()))
+	v1.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(ToolLoopGuardMiddleware())))
+	v1.Use(RawPassthroughSkipMiddleware(TokenCountCacheMiddleware(countCache)))
 	v1.Use(NativeModeSkipMiddleware(ChannelRouterMiddleware()))
 	v1.Use(NativeModeSkipMiddleware(RequestCaptureMiddleware()))
 
@@ -160,19 +236,46 @@ func registerAmpProxyAPI(engine *gin.Engine, proxyHandler, channelHandler, model
 	v1.POST("/completions", createRoutingHandler(proxyHandler, channelHandler))
 	v1.POST("/messages", createRoutingHandler(proxyHandler, channelHandler))
 	v1.POST("/responses", createRoutingHandler(proxyHandler, channelHandler))
+	v1.POST("/embeddings", createRoutingHandler(proxyHandler, channelHandler))
+	v1.POST("/audio/transcriptions", createRoutingHandler(proxyHandler, channelHandler))
+	v1.POST("/audio/translations", createRoutingHandler(proxyHandler, channelHandler))
+	v1.POST("/audio/speech", createRoutingHandler(proxyHandler, channelHandler))
+	v1.GET("/realtime", RealtimeProxyHandler())
+	// Anthropic Message Batches
+	v1.Any("/messages/batches", batchHandler)
+	v1.Any("/messages/batches/*path", batchHandler)
 
 	v1beta := engine.Group("/v1beta")
+	v1beta.Use(TracingMiddleware())
+	v1beta.Use(MaintenanceMiddleware())
+	v1beta.Use(DatabaseSwapGuard())
 	v1beta.Use(APIKeyAuthMiddleware())
+	v1beta.Use(RawPassthroughMiddleware())
+	v1beta.Use(RequestBodyLimitMiddleware())
+	v1beta.Use(MemoryBudgetMiddleware())
+	v1beta.Use(RequestLoggingMiddleware())
 	v1beta.Use(rateLimiter.RateLimitByAPIKey())
+	v1beta.Use(RateLimitMiddleware())
+	v1beta.Use(ConcurrencyLimitMiddleware())
 	v1beta.Use(NativeModeSkipMiddleware(BillingCheckMiddleware()))
-	v1beta.Use(NativeModeSkipMiddleware(ApplyModelMappingMiddleware()))
+	v1beta.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(ApplyModelMappingMiddleware())))
+	v1beta.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(SystemPromptMiddleware())))
+	v1beta.Use(complianceMiddlewares()...)
+	v1beta.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(RequestPipelineMiddleware())))
+	v1beta.Use(NativeModeSkipMiddleware(RequestCostCeilingMiddleware()))
+	v1beta.Use(NativeModeSkipMiddleware(RawPassthroughSkipMiddleware(ToolLoopGuardMiddleware())))
+	v1beta.Use(RawPassthroughSkipMiddleware(TokenCountCacheMiddleware(countCache)))
 	v1beta.Use(NativeModeSkipMiddleware(ChannelRouterMiddleware()))
 	v1beta.Use(NativeModeSkipMiddleware(RequestCaptureMiddleware()))
 
-	v1beta.POST("/models/*action", createRoutingHandler(proxyHandler, channelHandler))
+	v1beta.POST("/models/*action", createGeminiActionHandler(createRoutingHandler(proxyHandler, channelHandler), batchHandler))
+	// Gemini batch operations
+	v1beta.Any("/batches", batchHandler)
+	v1beta.Any("/batches/*path", batchHandler)
 	v1beta.GET("/models/*action", proxyHandler)
 
 	// Models listing endpoints - no auth required
 	engine.GET("/v1beta/models", createGeminiModelsHandler())
-	engine.GET("/v1/models", createOpenAIModelsHandler())
+	// 按用户可访问的渠道与模型映射汇总，需要 API Key
+	engine.GET("/v1/models", MaintenanceMiddleware(), DatabaseSwapGuard(), APIKeyAuthMiddleware(), handleUserModels)
 }
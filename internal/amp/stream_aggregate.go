@@ -0,0 +1,560 @@
+package amp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ampmanager/internal/translator"
+
+	"github.com/tidwall/gjson"
+)
+
+// 非流式客户端请求时，渠道代理统一以流式请求上游，再把 SSE 聚合成该格式的非流式 JSON。
+// 上游在生成期间持续有数据返回，避免长时间无响应被中间层（CDN、负载均衡）超时断开。
+
+// streamAggregator 把某种格式的 SSE 流聚合为非流式 JSON，返回聚合后的 body 与用于日志的助手文本
+type streamAggregator func(ctx context.Context, r io.Reader) ([]byte, string, error)
+
+// streamAggregatorFor 返回指定格式的聚合器，不支持的格式返回 nil
+func streamAggregatorFor(format translator.Format) streamAggregator {
+	switch format {
+	case translator.FormatOpenAIResponses:
+		return aggregateOpenAIResponsesSSEToJSON
+	case translator.FormatOpenAIChat:
+		return aggregateOpenAIChatSSEToJSON
+	case translator.FormatClaude:
+		return aggregateClaudeSSEToJSON
+	case translator.FormatGemini:
+		return aggregateGeminiSSEToJSON
+	case translator.FormatOllamaChat, translator.FormatOllamaGenerate:
+		return aggregateOllamaSSEToJSON
+	}
+	return nil
+}
+
+// shouldForceUpstreamStream 判断非流式请求是否改为流式请求上游再聚合；
+// count_tokens / countTokens 等非生成接口保持原样
+func shouldForceUpstreamStream(format translator.Format, path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	switch format {
+	case translator.FormatOpenAIResponses:
+		return strings.Contains(path, "/v1/responses")
+	case translator.FormatOpenAIChat:
+		return strings.HasSuffix(path, "/v1/chat/completions")
+	case translator.FormatClaude:
+		return strings.HasSuffix(path, "/v1/messages")
+	case translator.FormatGemini:
+		return strings.HasSuffix(path, ":generateContent")
+	}
+	return false
+}
+
+// isGeminiStreamPath Gemini 通过路径而不是 body 中的 stream 字段区分流式请求
+func isGeminiStreamPath(path string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(path, "/"), ":streamGenerateContent")
+}
+
+// forcedGeminiStreamPath 强制流式时把 :generateContent 改为 :streamGenerateContent
+func forcedGeminiStreamPath(req *http.Request, path string) string {
+	if mode, ok := GetStreamMode(req.Context()); ok && mode.ForcedUpstreamStream && strings.HasSuffix(path, ":generateContent") {
+		return strings.TrimSuffix(path, ":generateContent") + ":streamGenerateContent"
+	}
+	return path
+}
+
+// isAggregatedStreamError 上游在流中返回错误事件时，聚合结果即为该错误负载
+func isAggregatedStreamError(body []byte) bool {
+	return gjson.GetBytes(body, "error").IsObject() && !gjson.GetBytes(body, "choices").Exists() && !gjson.GetBytes(body, "candidates").Exists()
+}
+
+// forEachSSEPayload 逐个读取 SSE 事件的 data 负载，fn 返回 false 时停止；收到 [DONE] 时结束
+func forEachSSEPayload(ctx context.Context, r io.Reader, fn func(event string, payload []byte) bool) error {
+	var sseBuffer bytes.Buffer
+	var totalRead int64
+	tmp := make([]byte, 4096)
+
+	handle := func(event []byte) bool {
+		name, payload, done := parseSSEEvent(event)
+		if done {
+			return false
+		}
+		if len(payload) == 0 {
+			return true
+		}
+		return fn(name, payload)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		n, err := r.Read(tmp)
+		if n > 0 {
+			totalRead += int64(n)
+			if totalRead > maxResponsesSSEAggregateBytes {
+				return fmt.Errorf("sse aggregate: exceeded max bytes (%d)", maxResponsesSSEAggregateBytes)
+			}
+			sseBuffer.Write(tmp[:n])
+		}
+
+		for {
+			data := sseBuffer.Bytes()
+			idx, delimLen := findSSEDelimiter(data)
+			if idx == -1 {
+				break
+			}
+			event := make([]byte, idx+delimLen)
+			copy(event, data[:idx+delimLen])
+			sseBuffer.Reset()
+			sseBuffer.Write(data[idx+delimLen:])
+			if !handle(event) {
+				return nil
+			}
+		}
+
+		if err == io.EOF {
+			// 最后一个事件可能没有结尾空行
+			if rest := bytes.TrimSpace(sseBuffer.Bytes()); len(rest) > 0 {
+				handle(rest)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ========== OpenAI Chat Completions ==========
+
+type chatToolCallAccumulator struct {
+	id        string
+	typ       string
+	name      string
+	arguments strings.Builder
+}
+
+type chatChoiceAccumulator struct {
+	role         string
+	content      strings.Builder
+	reasoning    strings.Builder
+	refusal      strings.Builder
+	toolCalls    map[int64]*chatToolCallAccumulator
+	finishReason any
+	logprobs     []any
+}
+
+// aggregateOpenAIChatSSEToJSON 把 chat.completion.chunk 流合并为 chat.completion
+func aggregateOpenAIChatSSEToJSON(ctx context.Context, r io.Reader) ([]byte, string, error) {
+	var id, modelName, fingerprint string
+	var created int64
+	var usage json.RawMessage
+	var upstreamError []byte
+	choices := make(map[int64]*chatChoiceAccumulator)
+
+	err := forEachSSEPayload(ctx, r, func(_ string, payload []byte) bool {
+		if gjson.GetBytes(payload, "error").IsObject() {
+			upstreamError = payload
+			return false
+		}
+		if id == "" {
+			id = gjson.GetBytes(payload, "id").String()
+			created = gjson.GetBytes(payload, "created").Int()
+		}
+		if m := gjson.GetBytes(payload, "model").String(); m != "" {
+			modelName = m
+		}
+		if fp := gjson.GetBytes(payload, "system_fingerprint").String(); fp != "" {
+			fingerprint = fp
+		}
+		if u := gjson.GetBytes(payload, "usage"); u.IsObject() {
+			usage = json.RawMessage(u.Raw)
+		}
+
+		gjson.GetBytes(payload, "choices").ForEach(func(_, choice gjson.Result) bool {
+			index := choice.Get("index").Int()
+			acc := choices[index]
+			if acc == nil {
+				acc = &chatChoiceAccumulator{toolCalls: make(map[int64]*chatToolCallAccumulator)}
+				choices[index] = acc
+			}
+			delta := choice.Get("delta")
+			if role := delta.Get("role").String(); role != "" {
+				acc.role = role
+			}
+			acc.content.WriteString(delta.Get("content").String())
+			acc.reasoning.WriteString(delta.Get("reasoning_content").String())
+			acc.refusal.WriteString(delta.Get("refusal").String())
+			delta.Get("tool_calls").ForEach(func(_, tc gjson.Result) bool {
+				tcIndex := tc.Get("index").Int()
+				call := acc.toolCalls[tcIndex]
+				if call == nil {
+					call = &chatToolCallAccumulator{typ: "function"}
+					acc.toolCalls[tcIndex] = call
+				}
+				if v := tc.Get("id").String(); v != "" {
+					call.id = v
+				}
+				if v := tc.Get("type").String(); v != "" {
+					call.typ = v
+				}
+				if v := tc.Get("function.name").String(); v != "" {
+					call.name = v
+				}
+				call.arguments.WriteString(tc.Get("function.arguments").String())
+				return true
+			})
+			if fr := choice.Get("finish_reason"); fr.Exists() && fr.Type != gjson.Null {
+				acc.finishReason = fr.Value()
+			}
+			if lp := choice.Get("logprobs.content"); lp.IsArray() {
+				for _, item := range lp.Array() {
+					acc.logprobs = append(acc.logprobs, item.Value())
+				}
+			}
+			return true
+		})
+		return true
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if upstreamError != nil {
+		return upstreamError, "", nil
+	}
+	if id == "" && len(choices) == 0 {
+		return nil, "", fmt.Errorf("chat sse aggregate: no chunks received")
+	}
+
+	indexes := make([]int64, 0, len(choices))
+	for index := range choices {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	var texts []string
+	outChoices := make([]map[string]any, 0, len(choices))
+	for _, index := range indexes {
+		acc := choices[index]
+		role := acc.role
+		if role == "" {
+			role = "assistant"
+		}
+		message := map[string]any{"role": role, "content": nil}
+		if acc.content.Len() > 0 {
+			message["content"] = acc.content.String()
+			texts = append(texts, acc.content.String())
+		}
+		if acc.reasoning.Len() > 0 {
+			message["reasoning_content"] = acc.reasoning.String()
+		}
+		if acc.refusal.Len() > 0 {
+			message["refusal"] = acc.refusal.String()
+		}
+		if len(acc.toolCalls) > 0 {
+			tcIndexes := make([]int64, 0, len(acc.toolCalls))
+			for i := range acc.toolCalls {
+				tcIndexes = append(tcIndexes, i)
+			}
+			sort.Slice(tcIndexes, func(i, j int) bool { return tcIndexes[i] < tcIndexes[j] })
+			toolCalls := make([]map[string]any, 0, len(tcIndexes))
+			for _, i := range tcIndexes {
+				call := acc.toolCalls[i]
+				toolCalls = append(toolCalls, map[string]any{
+					"id":   call.id,
+					"type": call.typ,
+					"function": map[string]any{
+						"name":      call.name,
+						"arguments": call.arguments.String(),
+					},
+				})
+			}
+			message["tool_calls"] = toolCalls
+		}
+		out := map[string]any{
+			"index":         index,
+			"message":       message,
+			"finish_reason": acc.finishReason,
+			"logprobs":      nil,
+		}
+		if len(acc.logprobs) > 0 {
+			out["logprobs"] = map[string]any{"content": acc.logprobs}
+		}
+		outChoices = append(outChoices, out)
+	}
+
+	result := map[string]any{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   modelName,
+		"choices": outChoices,
+	}
+	if fingerprint != "" {
+		result["system_fingerprint"] = fingerprint
+	}
+	if usage != nil {
+		result["usage"] = usage
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, strings.Join(texts, "\n"), nil
+}
+
+// ========== Claude Messages ==========
+
+type claudeBlockAccumulator struct {
+	block       map[string]any
+	text        strings.Builder
+	thinking    strings.Builder
+	partialJSON strings.Builder
+	citations   []any
+}
+
+// aggregateClaudeSSEToJSON 按 message_start / content_block_* / message_delta 事件重建完整的 message 对象
+func aggregateClaudeSSEToJSON(ctx context.Context, r io.Reader) ([]byte, string, error) {
+	var message map[string]any
+	var upstreamError []byte
+	blocks := make(map[int64]*claudeBlockAccumulator)
+
+	err := forEachSSEPayload(ctx, r, func(_ string, payload []byte) bool {
+		switch gjson.GetBytes(payload, "type").String() {
+		case "error":
+			upstreamError = payload
+			return false
+		case "message_start":
+			if err := json.Unmarshal([]byte(gjson.GetBytes(payload, "message").Raw), &message); err != nil {
+				message = map[string]any{}
+			}
+		case "content_block_start":
+			index := gjson.GetBytes(payload, "index").Int()
+			acc := &claudeBlockAccumulator{}
+			if err := json.Unmarshal([]byte(gjson.GetBytes(payload, "content_block").Raw), &acc.block); err != nil || acc.block == nil {
+				acc.block = map[string]any{}
+			}
+			blocks[index] = acc
+		case "content_block_delta":
+			acc := blocks[gjson.GetBytes(payload, "index").Int()]
+			if acc == nil {
+				return true
+			}
+			delta := gjson.GetBytes(payload, "delta")
+			switch delta.Get("type").String() {
+			case "text_delta":
+				acc.text.WriteString(delta.Get("text").String())
+			case "input_json_delta":
+				acc.partialJSON.WriteString(delta.Get("partial_json").String())
+			case "thinking_delta":
+				acc.thinking.WriteString(delta.Get("thinking").String())
+			case "signature_delta":
+				acc.block["signature"] = delta.Get("signature").String()
+			case "citations_delta":
+				acc.citations = append(acc.citations, delta.Get("citation").Value())
+			}
+		case "message_delta":
+			if message == nil {
+				message = map[string]any{}
+			}
+			gjson.GetBytes(payload, "delta").ForEach(func(key, value gjson.Result) bool {
+				message[key.String()] = value.Value()
+				return true
+			})
+			if u := gjson.GetBytes(payload, "usage"); u.IsObject() {
+				usage, _ := message["usage"].(map[string]any)
+				if usage == nil {
+					usage = map[string]any{}
+				}
+				u.ForEach(func(key, value gjson.Result) bool {
+					// message_delta 中的 null 表示未更新，保留 message_start 的值
+					if value.Type != gjson.Null {
+						usage[key.String()] = value.Value()
+					}
+					return true
+				})
+				message["usage"] = usage
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if upstreamError != nil {
+		return upstreamError, "", nil
+	}
+	if message == nil {
+		return nil, "", fmt.Errorf("claude sse aggregate: message_start not received")
+	}
+
+	indexes := make([]int64, 0, len(blocks))
+	for index := range blocks {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	var texts []string
+	content := make([]map[string]any, 0, len(blocks))
+	for _, index := range indexes {
+		acc := blocks[index]
+		block := acc.block
+		switch block["type"] {
+		case "text":
+			text, _ := block["text"].(string)
+			block["text"] = text + acc.text.String()
+			texts = append(texts, block["text"].(string))
+			if len(acc.citations) > 0 {
+				block["citations"] = acc.citations
+			}
+		case "thinking":
+			thinking, _ := block["thinking"].(string)
+			block["thinking"] = thinking + acc.thinking.String()
+		case "tool_use", "server_tool_use", "mcp_tool_use":
+			if acc.partialJSON.Len() > 0 {
+				var input any
+				if err := json.Unmarshal([]byte(acc.partialJSON.String()), &input); err == nil {
+					block["input"] = input
+				}
+			}
+			if block["input"] == nil {
+				block["input"] = map[string]any{}
+			}
+		}
+		content = append(content, block)
+	}
+	message["content"] = content
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, strings.Join(texts, "\n"), nil
+}
+
+// ========== Gemini generateContent ==========
+
+type geminiCandidateAccumulator struct {
+	candidate map[string]any
+	role      string
+	parts     []map[string]any
+}
+
+// aggregateGeminiSSEToJSON 合并 streamGenerateContent 的各个分片：相邻的文本分片拼接，
+// 其他 part（functionCall、inlineData 等）按顺序保留，其余字段取最后一次出现的值
+func aggregateGeminiSSEToJSON(ctx context.Context, r io.Reader) ([]byte, string, error) {
+	result := map[string]any{}
+	var upstreamError []byte
+	received := false
+	candidates := make(map[int64]*geminiCandidateAccumulator)
+
+	err := forEachSSEPayload(ctx, r, func(_ string, payload []byte) bool {
+		if gjson.GetBytes(payload, "error").IsObject() {
+			upstreamError = payload
+			return false
+		}
+		received = true
+		gjson.ParseBytes(payload).ForEach(func(key, value gjson.Result) bool {
+			if key.String() != "candidates" {
+				result[key.String()] = value.Value()
+			}
+			return true
+		})
+
+		gjson.GetBytes(payload, "candidates").ForEach(func(i, cand gjson.Result) bool {
+			index := i.Int()
+			if idx := cand.Get("index"); idx.Exists() {
+				index = idx.Int()
+			}
+			acc := candidates[index]
+			if acc == nil {
+				acc = &geminiCandidateAccumulator{candidate: map[string]any{}}
+				candidates[index] = acc
+			}
+			cand.ForEach(func(key, value gjson.Result) bool {
+				if key.String() != "content" {
+					acc.candidate[key.String()] = value.Value()
+				}
+				return true
+			})
+			if role := cand.Get("content.role").String(); role != "" {
+				acc.role = role
+			}
+			cand.Get("content.parts").ForEach(func(_, part gjson.Result) bool {
+				acc.appendPart(part)
+				return true
+			})
+			return true
+		})
+		return true
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if upstreamError != nil {
+		return upstreamError, "", nil
+	}
+	if !received {
+		return nil, "", fmt.Errorf("gemini sse aggregate: no chunks received")
+	}
+
+	indexes := make([]int64, 0, len(candidates))
+	for index := range candidates {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	var texts []string
+	outCandidates := make([]map[string]any, 0, len(candidates))
+	for _, index := range indexes {
+		acc := candidates[index]
+		role := acc.role
+		if role == "" {
+			role = "model"
+		}
+		for _, part := range acc.parts {
+			if text, ok := part["text"].(string); ok && part["thought"] != true {
+				texts = append(texts, text)
+			}
+		}
+		acc.candidate["content"] = map[string]any{"role": role, "parts": acc.parts}
+		outCandidates = append(outCandidates, acc.candidate)
+	}
+	result["candidates"] = outCandidates
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, strings.Join(texts, ""), nil
+}
+
+// appendPart 文本分片与前一个同类（thought 标记相同）文本分片合并
+func (acc *geminiCandidateAccumulator) appendPart(part gjson.Result) {
+	text := part.Get("text")
+	thought := part.Get("thought").Bool()
+	if text.Exists() && len(acc.parts) > 0 {
+		last := acc.parts[len(acc.parts)-1]
+		if prev, ok := last["text"].(string); ok && (last["thought"] == true) == thought {
+			last["text"] = prev + text.String()
+			if sig := part.Get("thoughtSignature"); sig.Exists() {
+				last["thoughtSignature"] = sig.String()
+			}
+			return
+		}
+	}
+	value, ok := part.Value().(map[string]any)
+	if !ok {
+		return
+	}
+	acc.parts = append(acc.parts, value)
+}
@@ -0,0 +1,160 @@
+package amp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/translator"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestAggregateOpenAIChatSSEToJSON(t *testing.T) {
+	input := strings.Join([]string{
+		`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":100,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":100,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":100,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read","arguments":"{\"pa"}}]}}]}`,
+		`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":100,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":1}"}}]},"finish_reason":"tool_calls"}]}`,
+		`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":100,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`,
+		`data: [DONE]`,
+		``,
+	}, "\n\n")
+
+	out, text, err := aggregateOpenAIChatSSEToJSON(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	root := gjson.ParseBytes(out)
+	if root.Get("object").String() != "chat.completion" {
+		t.Fatalf("expected object=chat.completion, got %q", root.Get("object").String())
+	}
+	if got := root.Get("choices.0.message.content").String(); got != "Hello" || text != "Hello" {
+		t.Fatalf("expected content=Hello, got %q (text %q)", got, text)
+	}
+	if got := root.Get("choices.0.message.tool_calls.0.function.arguments").String(); got != `{"path":1}` {
+		t.Fatalf("unexpected tool arguments: %q", got)
+	}
+	if root.Get("choices.0.finish_reason").String() != "tool_calls" {
+		t.Fatalf("expected finish_reason=tool_calls")
+	}
+	if root.Get("usage.total_tokens").Int() != 12 {
+		t.Fatalf("expected usage.total_tokens=12, got %s", root.Get("usage").Raw)
+	}
+}
+
+func TestAggregateClaudeSSEToJSON(t *testing.T) {
+	input := strings.Join([]string{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"claude-sonnet-4\",\"content\":[],\"stop_reason\":null,\"usage\":{\"input_tokens\":10,\"cache_read_input_tokens\":4,\"output_tokens\":1}}}",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"thinking\",\"thinking\":\"\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"thinking_delta\",\"thinking\":\"hmm\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"signature_delta\",\"signature\":\"sig\"}}",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi \"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"text_delta\",\"text\":\"there\"}}",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":2,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"Read\",\"input\":{}}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":2,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"file\\\":\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":2,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"\\\"a.go\\\"}\"}}",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\",\"stop_sequence\":null},\"usage\":{\"output_tokens\":42,\"input_tokens\":null}}",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+		"",
+	}, "\n\n")
+
+	out, text, err := aggregateClaudeSSEToJSON(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	root := gjson.ParseBytes(out)
+	if root.Get("id").String() != "msg_1" || root.Get("stop_reason").String() != "tool_use" {
+		t.Fatalf("unexpected message: %s", out)
+	}
+	if root.Get("content.0.thinking").String() != "hmm" || root.Get("content.0.signature").String() != "sig" {
+		t.Fatalf("unexpected thinking block: %s", root.Get("content.0").Raw)
+	}
+	if text != "Hi there" || root.Get("content.1.text").String() != "Hi there" {
+		t.Fatalf("unexpected text block: %s", root.Get("content.1").Raw)
+	}
+	if root.Get("content.2.input.file").String() != "a.go" {
+		t.Fatalf("unexpected tool_use block: %s", root.Get("content.2").Raw)
+	}
+	if root.Get("usage.input_tokens").Int() != 10 || root.Get("usage.output_tokens").Int() != 42 || root.Get("usage.cache_read_input_tokens").Int() != 4 {
+		t.Fatalf("unexpected usage: %s", root.Get("usage").Raw)
+	}
+}
+
+func TestAggregateClaudeSSEToJSON_ErrorEvent(t *testing.T) {
+	input := "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"
+
+	out, _, err := aggregateClaudeSSEToJSON(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isAggregatedStreamError(out) {
+		t.Fatalf("expected error payload, got %s", out)
+	}
+}
+
+func TestAggregateGeminiSSEToJSON(t *testing.T) {
+	input := strings.Join([]string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"plan","thought":true}]},"index":0}],"modelVersion":"gemini-2.5-pro"}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hello "}]},"index":0}]}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"world"}]},"index":0}]}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"ls","args":{}}}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":5,"totalTokenCount":8},"modelVersion":"gemini-2.5-pro"}`,
+	}, "\r\n\r\n")
+
+	out, text, err := aggregateGeminiSSEToJSON(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	root := gjson.ParseBytes(out)
+	parts := root.Get("candidates.0.content.parts").Array()
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 merged parts, got %s", root.Get("candidates.0.content.parts").Raw)
+	}
+	if parts[0].Get("text").String() != "plan" || !parts[0].Get("thought").Bool() {
+		t.Fatalf("unexpected thought part: %s", parts[0].Raw)
+	}
+	if parts[1].Get("text").String() != "Hello world" || text != "Hello world" {
+		t.Fatalf("unexpected text part: %s (text %q)", parts[1].Raw, text)
+	}
+	if parts[2].Get("functionCall.name").String() != "ls" {
+		t.Fatalf("unexpected function call part: %s", parts[2].Raw)
+	}
+	if root.Get("candidates.0.finishReason").String() != "STOP" || root.Get("usageMetadata.totalTokenCount").Int() != 8 {
+		t.Fatalf("unexpected aggregated response: %s", out)
+	}
+}
+
+func TestShouldForceUpstreamStream(t *testing.T) {
+	cases := []struct {
+		format translator.Format
+		path   string
+		want   bool
+	}{
+		{translator.FormatOpenAIChat, "/api/provider/openai/v1/chat/completions", true},
+		{translator.FormatClaude, "/api/provider/anthropic/v1/messages", true},
+		{translator.FormatClaude, "/api/provider/anthropic/v1/messages/count_tokens", false},
+		{translator.FormatGemini, "/api/provider/google/v1beta/models/gemini-2.5-pro:generateContent", true},
+		{translator.FormatGemini, "/api/provider/google/v1beta/models/gemini-2.5-pro:countTokens", false},
+		{translator.FormatOpenAIResponses, "/api/provider/openai/v1/responses", true},
+	}
+	for _, tc := range cases {
+		if got := shouldForceUpstreamStream(tc.format, tc.path); got != tc.want {
+			t.Errorf("shouldForceUpstreamStream(%s, %s) = %v, want %v", tc.format, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestForcedGeminiStreamPath(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://example.test/", nil)
+	path := "/v1beta/models/gemini-2.5-pro:generateContent"
+	if got := forcedGeminiStreamPath(req, path); got != path {
+		t.Fatalf("expected path unchanged without stream mode, got %q", got)
+	}
+
+	req = req.WithContext(WithStreamMode(req.Context(), StreamMode{ForcedUpstreamStream: true}))
+	if got := forcedGeminiStreamPath(req, path); got != "/v1beta/models/gemini-2.5-pro:streamGenerateContent" {
+		t.Fatalf("expected streamGenerateContent path, got %q", got)
+	}
+}
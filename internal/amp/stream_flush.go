@@ -0,0 +1,244 @@
+package amp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultStreamFlushIntervalMs = 20
+	maxStreamFlushIntervalMs     = 1000
+)
+
+// streamFlushFormats 可单独设置刷新间隔的客户端请求格式
+var streamFlushFormats = map[translator.Format]struct{}{
+	translator.FormatOpenAI:          {},
+	translator.FormatOpenAIChat:      {},
+	translator.FormatOpenAIResponses: {},
+	translator.FormatOpenAIAudio:     {},
+	translator.FormatClaude:          {},
+	translator.FormatGemini:          {},
+}
+
+var streamFlushState struct {
+	mu     sync.RWMutex
+	config model.StreamFlushConfig
+}
+
+func init() {
+	streamFlushState.config = NormalizeStreamFlushConfig(model.StreamFlushConfig{})
+}
+
+// NormalizeStreamFlushConfig 填充未设置的字段，默认关闭，开启后刷新间隔默认 20ms
+func NormalizeStreamFlushConfig(cfg model.StreamFlushConfig) model.StreamFlushConfig {
+	if cfg.IntervalMs <= 0 {
+		cfg.IntervalMs = defaultStreamFlushIntervalMs
+	}
+	return cfg
+}
+
+// ValidateStreamFlushConfig 校验刷新合并配置（需先 Normalize）
+func ValidateStreamFlushConfig(cfg model.StreamFlushConfig) error {
+	if cfg.IntervalMs > maxStreamFlushIntervalMs {
+		return fmt.Errorf("intervalMs 不能超过 %d", maxStreamFlushIntervalMs)
+	}
+	for format, ms := range cfg.Formats {
+		if _, ok := streamFlushFormats[translator.Format(format)]; !ok {
+			return fmt.Errorf("不支持的格式: %s", format)
+		}
+		if ms < 0 || ms > maxStreamFlushIntervalMs {
+			return fmt.Errorf("formats.%s 必须在 0 到 %d 之间", format, maxStreamFlushIntervalMs)
+		}
+	}
+	return nil
+}
+
+// InitStreamFlushConfig 从数据库 JSON 加载刷新合并配置
+func InitStreamFlushConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.StreamFlushConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("stream flush: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizeStreamFlushConfig(cfg)
+	if err := ValidateStreamFlushConfig(cfg); err != nil {
+		log.Warnf("stream flush: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateStreamFlushConfig(cfg)
+}
+
+// UpdateStreamFlushConfig 更新刷新合并配置，对之后开始的请求生效
+func UpdateStreamFlushConfig(cfg model.StreamFlushConfig) {
+	streamFlushState.mu.Lock()
+	streamFlushState.config = NormalizeStreamFlushConfig(cfg)
+	streamFlushState.mu.Unlock()
+}
+
+// GetStreamFlushConfig 返回当前刷新合并配置
+func GetStreamFlushConfig() model.StreamFlushConfig {
+	streamFlushState.mu.RLock()
+	defer streamFlushState.mu.RUnlock()
+	return streamFlushState.config
+}
+
+// streamFlushInterval 返回指定格式的刷新间隔，0 表示不合并
+func streamFlushInterval(format translator.Format) time.Duration {
+	cfg := GetStreamFlushConfig()
+	if !cfg.Enabled {
+		return 0
+	}
+	ms := cfg.IntervalMs
+	if override, ok := cfg.Formats[string(format)]; ok {
+		ms = override
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// withStreamFlush 按配置为本次转发启用刷新合并；返回的函数需在转发结束后调用，
+// 发出尚未刷新的数据并恢复原 ResponseWriter
+func withStreamFlush(c *gin.Context, format translator.Format) func() {
+	interval := streamFlushInterval(format)
+	if interval <= 0 {
+		return func() {}
+	}
+	original := c.Writer
+	fw := newCoalescingFlushWriter(original, interval)
+	c.Writer = fw
+	return func() {
+		fw.Close()
+		c.Writer = original
+	}
+}
+
+// coalescingFlushWriter 合并 ReverseProxy 逐块发起的刷新：
+// 写完完整 SSE 事件且距上次刷新已满 interval 时立即刷新，否则推迟到截止时间由定时器刷新。
+// 定时器与转发在不同 goroutine，所有写入和刷新都经过 mu 串行化
+type coalescingFlushWriter struct {
+	gin.ResponseWriter
+	interval time.Duration
+
+	mu sync.Mutex
+	// tail 已写入数据的最后几个字节，用于跨多次写入判断事件边界
+	tail         []byte
+	pending      bool
+	pendingSince time.Time
+	lastFlush    time.Time
+	flushed      bool
+	timer        *time.Timer
+	timerAt      time.Time
+	closed       bool
+}
+
+func newCoalescingFlushWriter(w gin.ResponseWriter, interval time.Duration) *coalescingFlushWriter {
+	return &coalescingFlushWriter{ResponseWriter: w, interval: interval, tail: make([]byte, 0, 4)}
+}
+
+func (w *coalescingFlushWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.ResponseWriter.Write(data)
+	if n > 0 {
+		if !w.pending {
+			w.pending = true
+			w.pendingSince = time.Now()
+		}
+		w.tail = append(w.tail, data[:n]...)
+		if len(w.tail) > 4 {
+			w.tail = append(w.tail[:0], w.tail[len(w.tail)-4:]...)
+		}
+	}
+	return n, err
+}
+
+func (w *coalescingFlushWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 首次刷新立即执行，让客户端尽早收到响应头；之后按事件边界与 interval 合并
+func (w *coalescingFlushWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || !w.flushed {
+		w.flushLocked(time.Now())
+		return
+	}
+	if !w.pending {
+		return
+	}
+
+	now := time.Now()
+	deadline := w.pendingSince.Add(w.interval)
+	if w.atEventBoundary() {
+		deadline = w.lastFlush.Add(w.interval)
+	}
+	if !now.Before(deadline) {
+		w.flushLocked(now)
+		return
+	}
+	w.scheduleLocked(deadline, now)
+}
+
+// Close 停止定时器并发出剩余数据，之后的刷新不再合并
+func (w *coalescingFlushWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.stopTimerLocked()
+	if w.pending {
+		w.flushLocked(time.Now())
+	}
+}
+
+func (w *coalescingFlushWriter) atEventBoundary() bool {
+	return bytes.HasSuffix(w.tail, []byte("\n\n")) || bytes.HasSuffix(w.tail, []byte("\r\n\r\n"))
+}
+
+func (w *coalescingFlushWriter) flushLocked(now time.Time) {
+	w.ResponseWriter.Flush()
+	w.pending = false
+	w.flushed = true
+	w.lastFlush = now
+	w.stopTimerLocked()
+}
+
+// scheduleLocked 在 deadline 刷新；已有更早的定时器时沿用
+func (w *coalescingFlushWriter) scheduleLocked(deadline, now time.Time) {
+	if w.timer != nil {
+		if !deadline.Before(w.timerAt) {
+			return
+		}
+		w.timer.Stop()
+	}
+	w.timerAt = deadline
+	w.timer = time.AfterFunc(deadline.Sub(now), w.flushDeferred)
+}
+
+func (w *coalescingFlushWriter) stopTimerLocked() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+func (w *coalescingFlushWriter) flushDeferred() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timer = nil
+	if w.closed || !w.pending {
+		return
+	}
+	w.flushLocked(time.Now())
+}
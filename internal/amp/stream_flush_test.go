@@ -0,0 +1,179 @@
+package amp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countingFlushRecorder 统计底层实际发生的刷新次数
+type countingFlushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes atomic.Int32
+}
+
+func (r *countingFlushRecorder) Flush() {
+	r.flushes.Add(1)
+	r.ResponseRecorder.Flush()
+}
+
+func newFlushTestWriter(interval time.Duration) (*coalescingFlushWriter, *countingFlushRecorder) {
+	rec := &countingFlushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	c, _ := gin.CreateTestContext(rec)
+	return newCoalescingFlushWriter(c.Writer, interval), rec
+}
+
+func TestCoalescingFlushWriter_CoalescesEventsWithinInterval(t *testing.T) {
+	w, rec := newFlushTestWriter(time.Hour)
+	w.Flush() // 响应头立即发出
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(w, "data: {\"i\":%d}\n\n", i)
+		w.Flush()
+	}
+	if got := rec.flushes.Load(); got != 1 {
+		t.Fatalf("events within the interval should be coalesced, got %d flushes", got)
+	}
+	w.Close()
+	if got := rec.flushes.Load(); got != 2 {
+		t.Fatalf("close should flush the remaining events, got %d flushes", got)
+	}
+	if rec.Body.Len() == 0 {
+		t.Fatal("body should be written through")
+	}
+}
+
+func TestCoalescingFlushWriter_FlushesCompleteEventOnceIntervalElapsed(t *testing.T) {
+	w, rec := newFlushTestWriter(10 * time.Millisecond)
+	defer w.Close()
+	w.Flush()
+	time.Sleep(15 * time.Millisecond)
+
+	// 不完整的事件不会立即刷新
+	io.WriteString(w, "data: {\"partial\":")
+	w.Flush()
+	if got := rec.flushes.Load(); got != 1 {
+		t.Fatalf("partial event should wait for its boundary, got %d flushes", got)
+	}
+	io.WriteString(w, "true}\n\n")
+	w.Flush()
+	if got := rec.flushes.Load(); got != 2 {
+		t.Fatalf("complete event after the interval should flush immediately, got %d flushes", got)
+	}
+}
+
+func TestCoalescingFlushWriter_DeferredFlushFiresWithoutMoreData(t *testing.T) {
+	w, rec := newFlushTestWriter(5 * time.Millisecond)
+	defer w.Close()
+	w.Flush()
+	io.WriteString(w, "data: {\"stalled\":")
+	w.Flush()
+
+	deadline := time.Now().Add(time.Second)
+	for rec.flushes.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("pending data should be flushed by the timer when upstream stalls")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamFlushConfig_PerFormatInterval(t *testing.T) {
+	defer UpdateStreamFlushConfig(model.StreamFlushConfig{})
+
+	cfg := NormalizeStreamFlushConfig(model.StreamFlushConfig{Enabled: true, Formats: map[string]int{"gemini": 0, "claude": 50}})
+	if err := ValidateStreamFlushConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	UpdateStreamFlushConfig(cfg)
+	if got := streamFlushInterval(translator.FormatOpenAIChat); got != defaultStreamFlushIntervalMs*time.Millisecond {
+		t.Errorf("unexpected default interval %v", got)
+	}
+	if got := streamFlushInterval(translator.FormatClaude); got != 50*time.Millisecond {
+		t.Errorf("unexpected claude interval %v", got)
+	}
+	if got := streamFlushInterval(translator.FormatGemini); got != 0 {
+		t.Errorf("gemini override 0 should disable coalescing, got %v", got)
+	}
+
+	if ValidateStreamFlushConfig(model.StreamFlushConfig{IntervalMs: 20, Formats: map[string]int{"unknown": 10}}) == nil {
+		t.Error("unknown format should be rejected")
+	}
+	if ValidateStreamFlushConfig(model.StreamFlushConfig{IntervalMs: 5000}) == nil {
+		t.Error("interval above the limit should be rejected")
+	}
+}
+
+// countingResponseWriter 统计写入真实连接的刷新次数
+type countingResponseWriter struct {
+	http.ResponseWriter
+	flushes *atomic.Int64
+}
+
+func (w *countingResponseWriter) Flush() {
+	w.flushes.Add(1)
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// benchmarkStreamRelay 模拟高并发下高频小事件的流式转发：每个事件写入后立即 Flush（ReverseProxy FlushInterval -1 的行为），
+// 客户端通过真实 TCP 连接读取，interval 为 0 时为逐块刷新
+func benchmarkStreamRelay(b *testing.B, interval time.Duration) {
+	gin.SetMode(gin.TestMode)
+	const events = 200
+	event := []byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"tok\"}}]}\n\n")
+	var flushes atomic.Int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		c, _ := gin.CreateTestContext(&countingResponseWriter{ResponseWriter: rw, flushes: &flushes})
+		var w gin.ResponseWriter = c.Writer
+		var fw *coalescingFlushWriter
+		if interval > 0 {
+			fw = newCoalescingFlushWriter(c.Writer, interval)
+			w = fw
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < events; i++ {
+			w.Write(event)
+			w.Flush()
+		}
+		if fw != nil {
+			fw.Close()
+		}
+	}))
+	defer server.Close()
+
+	client := server.Client()
+	client.Transport.(*http.Transport).MaxIdleConnsPerHost = 256
+
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	})
+	b.ReportMetric(float64(flushes.Load())/float64(b.N), "flushes/op")
+}
+
+func BenchmarkStreamRelay_FlushEveryChunk(b *testing.B) {
+	benchmarkStreamRelay(b, 0)
+}
+
+func BenchmarkStreamRelay_Coalesced20ms(b *testing.B) {
+	benchmarkStreamRelay(b, 20*time.Millisecond)
+}
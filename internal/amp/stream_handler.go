@@ -7,6 +7,8 @@ import (
 	"sync"
 	"time"
 
+	"ampmanager/internal/translator"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -226,7 +228,7 @@ func (h *SSEStreamHandler) WroteFirstChunk() bool {
 // BuildSSEErrorEvent 构建 SSE 格式的错误事件
 func BuildSSEErrorEvent(statusCode int, message string) []byte {
 	errBody := BuildErrorResponseBody(statusCode, message)
-	return []byte("event: error\ndata: " + string(errBody) + "\n\n")
+	return []byte(translator.FormatSSEEvent("error", string(errBody)))
 }
 
 // SSEKeepAliveWrapper 包装 io.ReadCloser，在读取时支持心跳写入
@@ -0,0 +1,107 @@
+package amp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SystemPromptMiddleware 将用户设置的系统提示词插入到模型调用请求的系统提示之前。
+// 只处理 Claude Messages、OpenAI Chat/Responses 与 Gemini 生成接口，Gemini countTokens 不支持系统提示，保持原样
+func SystemPromptMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		proxyCfg := GetProxyConfig(c.Request.Context())
+		if proxyCfg == nil || proxyCfg.SystemPrompt == "" {
+			c.Next()
+			return
+		}
+		path := c.Request.URL.Path
+		isCount := isTokenCountPath(path)
+		if !isCount && !IsModelInvocation(c.Request.Method, path) {
+			c.Next()
+			return
+		}
+		format := detectIncomingFormat(path)
+		if isCount && format == translator.FormatGemini {
+			c.Next()
+			return
+		}
+
+		bodyBytes := readJSONRequestBody(c.Request, maxRequestBodySize)
+		if bodyBytes == nil {
+			c.Next()
+			return
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+			c.Next()
+			return
+		}
+		if newBody, ok := injectSystemPrompt(format, payload, proxyCfg.SystemPrompt); ok {
+			c.Request.Body = io.NopCloser(bytes.NewReader(newBody))
+			c.Request.ContentLength = int64(len(newBody))
+		}
+		c.Next()
+	}
+}
+
+// injectSystemPrompt 按请求格式把 prompt 放在已有系统提示之前，不支持的格式返回 false
+func injectSystemPrompt(format translator.Format, payload map[string]interface{}, prompt string) ([]byte, bool) {
+	switch format {
+	case translator.FormatClaude:
+		switch system := payload["system"].(type) {
+		case nil:
+			payload["system"] = prompt
+		case string:
+			payload["system"] = joinSystemPrompt(prompt, system)
+		case []interface{}:
+			payload["system"] = append([]interface{}{map[string]interface{}{"type": "text", "text": prompt}}, system...)
+		default:
+			return nil, false
+		}
+	case translator.FormatOpenAIChat:
+		messages, ok := payload["messages"].([]interface{})
+		if !ok {
+			return nil, false
+		}
+		payload["messages"] = append([]interface{}{map[string]interface{}{"role": "system", "content": prompt}}, messages...)
+	case translator.FormatOpenAIResponses:
+		instructions, _ := payload["instructions"].(string)
+		payload["instructions"] = joinSystemPrompt(prompt, instructions)
+	case translator.FormatGemini:
+		key := "systemInstruction"
+		if _, ok := payload[key]; !ok {
+			if _, ok := payload["system_instruction"]; ok {
+				key = "system_instruction"
+			}
+		}
+		instruction := asMap(payload[key])
+		if instruction == nil {
+			instruction = map[string]interface{}{}
+		}
+		parts, _ := instruction["parts"].([]interface{})
+		instruction["parts"] = append([]interface{}{map[string]interface{}{"text": prompt}}, parts...)
+		payload[key] = instruction
+	default:
+		return nil, false
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func joinSystemPrompt(prompt, existing string) string {
+	if strings.TrimSpace(existing) == "" {
+		return prompt
+	}
+	return prompt + "\n\n" + existing
+}
@@ -0,0 +1,83 @@
+package amp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"ampmanager/internal/translator"
+)
+
+func TestInjectSystemPrompt(t *testing.T) {
+	cases := []struct {
+		name   string
+		format translator.Format
+		body   string
+		check  func(map[string]interface{}) bool
+	}{
+		{
+			name:   "claude string system",
+			format: translator.FormatClaude,
+			body:   `{"system":"be brief","messages":[]}`,
+			check: func(p map[string]interface{}) bool {
+				return p["system"] == "team rules\n\nbe brief"
+			},
+		},
+		{
+			name:   "claude block system",
+			format: translator.FormatClaude,
+			body:   `{"system":[{"type":"text","text":"be brief","cache_control":{"type":"ephemeral"}}],"messages":[]}`,
+			check: func(p map[string]interface{}) bool {
+				blocks := p["system"].([]interface{})
+				return len(blocks) == 2 && asMap(blocks[0])["text"] == "team rules" && asMap(blocks[1])["cache_control"] != nil
+			},
+		},
+		{
+			name:   "openai chat",
+			format: translator.FormatOpenAIChat,
+			body:   `{"messages":[{"role":"user","content":"hi"}]}`,
+			check: func(p map[string]interface{}) bool {
+				messages := p["messages"].([]interface{})
+				return len(messages) == 2 && asMap(messages[0])["role"] == "system" && asMap(messages[0])["content"] == "team rules"
+			},
+		},
+		{
+			name:   "responses",
+			format: translator.FormatOpenAIResponses,
+			body:   `{"input":"hi"}`,
+			check: func(p map[string]interface{}) bool {
+				return p["instructions"] == "team rules"
+			},
+		},
+		{
+			name:   "gemini",
+			format: translator.FormatGemini,
+			body:   `{"system_instruction":{"parts":[{"text":"be brief"}]},"contents":[]}`,
+			check: func(p map[string]interface{}) bool {
+				parts := asMap(p["system_instruction"])["parts"].([]interface{})
+				return p["systemInstruction"] == nil && len(parts) == 2 && asMap(parts[0])["text"] == "team rules"
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(tc.body), &payload); err != nil {
+			t.Fatal(err)
+		}
+		data, ok := injectSystemPrompt(tc.format, payload, "team rules")
+		if !ok {
+			t.Fatalf("%s: expected prompt to be injected", tc.name)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !tc.check(got) {
+			t.Errorf("%s: unexpected body %s", tc.name, data)
+		}
+	}
+
+	if _, ok := injectSystemPrompt(translator.FormatOpenAIEmbeddings, map[string]interface{}{"input": "hi"}, "team rules"); ok {
+		t.Error("embeddings requests should not be modified")
+	}
+}
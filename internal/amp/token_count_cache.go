@@ -0,0 +1,182 @@
+package amp
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// tokenCountCacheMaxEntryBytes 单条缓存响应的大小上限，token 计数响应通常只有几十字节
+const tokenCountCacheMaxEntryBytes = 16 * 1024
+
+// tokenCountPathSuffixes token 计数接口路径后缀（Claude / Gemini / OpenAI Responses）
+var tokenCountPathSuffixes = []string{
+	"/v1/messages/count_tokens",
+	":countTokens",
+	"/v1/responses/input_tokens",
+}
+
+// isTokenCountPath 判断是否为 token 计数请求路径
+func isTokenCountPath(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	for _, suffix := range tokenCountPathSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenCountCacheEntry struct {
+	key             string
+	contentType     string
+	contentEncoding string
+	body            []byte
+	expiresAt       time.Time
+}
+
+// tokenCountCache 进程内 LRU 缓存，保存 token 计数接口的成功响应。
+// 相同模型与请求体的计数结果是确定的，短时间内直接复用，减少上游调用
+type tokenCountCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// newTokenCountCache ttl 或 size 不大于 0 时返回 nil（关闭缓存）
+func newTokenCountCache(size int, ttl time.Duration) *tokenCountCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &tokenCountCache{
+		ttl:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (tc *tokenCountCache) get(key string, now time.Time) (*tokenCountCacheEntry, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	elem, ok := tc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*tokenCountCacheEntry)
+	if !now.Before(entry.expiresAt) {
+		tc.order.Remove(elem)
+		delete(tc.entries, key)
+		return nil, false
+	}
+	tc.order.MoveToFront(elem)
+	return entry, true
+}
+
+func (tc *tokenCountCache) put(entry *tokenCountCacheEntry, now time.Time) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	entry.expiresAt = now.Add(tc.ttl)
+	if elem, ok := tc.entries[entry.key]; ok {
+		elem.Value = entry
+		tc.order.MoveToFront(elem)
+		return
+	}
+	tc.entries[entry.key] = tc.order.PushFront(entry)
+	for tc.order.Len() > tc.size {
+		oldest := tc.order.Back()
+		tc.order.Remove(oldest)
+		delete(tc.entries, oldest.Value.(*tokenCountCacheEntry).key)
+	}
+}
+
+// tokenCountCacheKey 缓存键：模型 + 客户端接受的压缩方式 + 规范化请求指纹。
+// 路径去掉 /api/provider/:provider 前缀，使 Amp CLI 与直连客户端共用缓存
+func tokenCountCacheKey(req *http.Request, body []byte) string {
+	path := normalizeProviderPath(req.URL.Path)
+	modelName := gjson.GetBytes(body, "model").String()
+	if idx := strings.Index(path, "/models/"); modelName == "" && idx != -1 {
+		modelName = extractModelFromPathPart(path[idx+len("/models/"):])
+	}
+	return modelName + "\x00" + req.Header.Get("Accept-Encoding") + "\x00" + RequestFingerprint(req.Method, path, body)
+}
+
+// tokenCountCaptureWriter 转发响应的同时保留一份副本，超过上限后不再缓存
+type tokenCountCaptureWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *tokenCountCaptureWriter) Write(b []byte) (int, error) {
+	if !w.overflow {
+		if w.body.Len()+len(b) > tokenCountCacheMaxEntryBytes {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *tokenCountCaptureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// TokenCountCacheMiddleware 为 token 计数接口提供短时缓存，渠道代理与 ampcode 上游代理共用。
+// 命中时直接返回缓存的响应，未命中时只缓存 200 响应；cache 为 nil 时不做任何处理
+func TokenCountCacheMiddleware(cache *tokenCountCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cache == nil || c.Request.Method != http.MethodPost || !isTokenCountPath(c.Request.URL.Path) || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		bodyBytes, ok, err := peekRequestBody(c.Request, maxRequestBodySize)
+		if err != nil || !ok {
+			c.Next()
+			return
+		}
+
+		key := tokenCountCacheKey(c.Request, bodyBytes)
+		now := time.Now()
+		if entry, ok := cache.get(key, now); ok {
+			log.Debugf("token count cache: hit for %s", c.Request.URL.Path)
+			if entry.contentEncoding != "" {
+				c.Header("Content-Encoding", entry.contentEncoding)
+			}
+			c.Data(http.StatusOK, entry.contentType, entry.body)
+			c.Abort()
+			return
+		}
+
+		writer := &tokenCountCaptureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.Status() != http.StatusOK || writer.overflow || writer.body.Len() == 0 {
+			return
+		}
+		contentType := writer.Header().Get("Content-Type")
+		if !strings.Contains(contentType, "application/json") {
+			return
+		}
+		cache.put(&tokenCountCacheEntry{
+			key:             key,
+			contentType:     contentType,
+			contentEncoding: writer.Header().Get("Content-Encoding"),
+			body:            bytes.Clone(writer.body.Bytes()),
+		}, now)
+	}
+}
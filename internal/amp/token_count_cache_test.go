@@ -0,0 +1,82 @@
+package amp
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsTokenCountPath(t *testing.T) {
+	cases := map[string]bool{
+		"/api/provider/anthropic/v1/messages/count_tokens":        true,
+		"/v1beta/models/gemini-2.5-pro:countTokens":               true,
+		"/api/provider/openai/v1/responses/input_tokens":          true,
+		"/api/provider/anthropic/v1/messages":                     false,
+		"/v1beta/models/gemini-2.5-pro:generateContent":           false,
+		"/api/provider/openai/v1/responses/input_tokens/extra_id": false,
+	}
+	for path, want := range cases {
+		if got := isTokenCountPath(path); got != want {
+			t.Errorf("isTokenCountPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestTokenCountCacheKey(t *testing.T) {
+	newReq := func(path string) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com"+path, nil)
+		return req
+	}
+	body := []byte(`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`)
+	reordered := []byte(`{"messages":[{"content":"hi","role":"user"}],"model":"claude-sonnet-4"}`)
+
+	viaProvider := tokenCountCacheKey(newReq("/api/provider/anthropic/v1/messages/count_tokens"), body)
+	direct := tokenCountCacheKey(newReq("/v1/messages/count_tokens"), reordered)
+	if viaProvider != direct {
+		t.Error("expected provider prefix and key order not to affect the cache key")
+	}
+	if !strings.HasPrefix(viaProvider, "claude-sonnet-4\x00") {
+		t.Errorf("expected key to start with the body model, got %q", viaProvider)
+	}
+
+	other := tokenCountCacheKey(newReq("/v1/messages/count_tokens"), []byte(`{"model":"claude-opus-4","messages":[{"role":"user","content":"hi"}]}`))
+	if other == direct {
+		t.Error("expected different models to use different keys")
+	}
+
+	gemini := tokenCountCacheKey(newReq("/v1beta/models/gemini-2.5-pro:countTokens"), []byte(`{"contents":[]}`))
+	if !strings.HasPrefix(gemini, "gemini-2.5-pro\x00") {
+		t.Errorf("expected gemini key to use the model from the path, got %q", gemini)
+	}
+}
+
+func TestTokenCountCache_ExpiryAndEviction(t *testing.T) {
+	if newTokenCountCache(10, 0) != nil || newTokenCountCache(0, time.Second) != nil {
+		t.Fatal("expected zero ttl or size to disable the cache")
+	}
+
+	cache := newTokenCountCache(2, time.Minute)
+	now := time.Now()
+	cache.put(&tokenCountCacheEntry{key: "a", body: []byte(`{"input_tokens":1}`)}, now)
+	cache.put(&tokenCountCacheEntry{key: "b", body: []byte(`{"input_tokens":2}`)}, now)
+
+	if _, ok := cache.get("a", now); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	// a 刚被访问，插入 c 时淘汰最久未使用的 b
+	cache.put(&tokenCountCacheEntry{key: "c", body: []byte(`{"input_tokens":3}`)}, now)
+	if _, ok := cache.get("b", now); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok := cache.get("a", now); !ok {
+		t.Error("expected a to survive eviction")
+	}
+
+	if _, ok := cache.get("c", now.Add(time.Minute)); ok {
+		t.Error("expected c to expire after ttl")
+	}
+	if cache.order.Len() != 1 || len(cache.entries) != 1 {
+		t.Errorf("expected expired entry to be removed, got %d entries", len(cache.entries))
+	}
+}
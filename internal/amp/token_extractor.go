@@ -7,6 +7,8 @@ import (
 	"sync"
 	"time"
 
+	"ampmanager/internal/tokenizer"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -38,15 +40,25 @@ type SSETokenExtractor struct {
 	buffer       bytes.Buffer
 	mu           sync.Mutex
 	extracted    bool
-	currentEvent string // 当前 SSE event 名称
+	currentEvent string             // 当前 SSE event 名称
+	validator    *ResponseValidator // 调试模式下的结构校验（未启用时为 nil）
+	provider     ProviderKind
+	// completed 已收到结束事件（最终 usage、[DONE] 或各格式的结束事件）
+	completed bool
+	// streamed 按上游模型的编码累计已转发的输出 token，流中断或缺少用量时作为估算值
+	streamed  *tokenizer.Counter
+	closeOnce sync.Once
 }
 
 // NewSSETokenExtractor 创建 SSE token 提取器
 func NewSSETokenExtractor(reader io.ReadCloser, trace *RequestTrace, info ProviderInfo) *SSETokenExtractor {
 	return &SSETokenExtractor{
-		reader: reader,
-		trace:  trace,
-		parser: NewUsageParser(info),
+		reader:    reader,
+		trace:     trace,
+		parser:    NewUsageParser(info),
+		validator: NewResponseValidator(trace, info, true),
+		provider:  info.Provider,
+		streamed:  tokenizer.NewCounter(traceEncoding(trace, info.Provider)),
 	}
 }
 
@@ -61,11 +73,28 @@ func (e *SSETokenExtractor) Read(p []byte) (int, error) {
 
 // Close 实现 io.Closer 接口
 func (e *SSETokenExtractor) Close() error {
-	// 在关闭前 flush 残留 buffer 中的数据
-	e.flushRemainingBuffer()
+	e.closeOnce.Do(func() {
+		// 在关闭前 flush 残留 buffer 中的数据
+		e.flushRemainingBuffer()
+		e.markIncompleteIfNeeded()
+	})
 	return e.reader.Close()
 }
 
+// markIncompleteIfNeeded 流在结束事件之前关闭（客户端断开或上游截断）时，
+// 保留已收到的部分用量，并在缺少输出用量时按已转发内容估算
+func (e *SSETokenExtractor) markIncompleteIfNeeded() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.completed || e.trace == nil {
+		return
+	}
+	if e.trace.MarkStreamIncomplete() {
+		log.Infof("SSE token extractor: stream of request %s ended early, estimated output=%d tokens",
+			e.trace.RequestID, e.streamed.Tokens())
+	}
+}
+
 // flushRemainingBuffer 处理 buffer 中残留的数据（EOF 时可能没有换行符）
 func (e *SSETokenExtractor) flushRemainingBuffer() {
 	e.mu.Lock()
@@ -94,6 +123,7 @@ func (e *SSETokenExtractor) flushRemainingBuffer() {
 		if strings.HasPrefix(line, "data:") {
 			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
 			if data == "[DONE]" {
+				e.completed = true
 				e.currentEvent = ""
 				continue
 			}
@@ -135,6 +165,7 @@ func (e *SSETokenExtractor) processChunk(chunk []byte) {
 		if strings.HasPrefix(line, "data:") {
 			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
 			if data == "[DONE]" {
+				e.completed = true
 				e.currentEvent = ""
 				continue
 			}
@@ -146,6 +177,21 @@ func (e *SSETokenExtractor) processChunk(chunk []byte) {
 
 // parseSSEDataLocked 解析单个 SSE 数据事件（调用者需持有锁）
 func (e *SSETokenExtractor) parseSSEDataLocked(data string) {
+	e.validator.ValidateSSE(e.currentEvent, []byte(data))
+
+	if !e.completed {
+		content, terminal := streamDeltaContent(e.provider, e.currentEvent, []byte(data))
+		if content != "" {
+			e.streamed.Add(content)
+			if e.trace != nil {
+				e.trace.SetEstimatedOutputTokens(e.streamed.Tokens())
+			}
+		}
+		if terminal {
+			e.completed = true
+		}
+	}
+
 	usage, final, ok := e.parser.ConsumeSSE(e.currentEvent, []byte(data))
 	if !ok {
 		return
@@ -159,6 +205,7 @@ func (e *SSETokenExtractor) parseSSEDataLocked(data string) {
 
 	if final {
 		e.extracted = true
+		e.completed = true
 	}
 }
 
@@ -191,6 +238,8 @@ func WrapResponseBodyForTokenExtraction(body io.ReadCloser, isStreaming bool, tr
 		return io.NopCloser(bytes.NewReader(data))
 	}
 
+	NewResponseValidator(trace, info, false).ValidateBody(data)
+
 	usage := ExtractTokenUsage(data, info)
 	if usage != nil {
 		trace.SetUsage(usage.InputTokens, usage.OutputTokens, usage.CacheReadInputTokens, usage.CacheCreationInputTokens)
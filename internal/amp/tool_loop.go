@@ -0,0 +1,565 @@
+package amp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultToolLoopWarnTurns         = 40
+	defaultToolLoopBlockTurns        = 80
+	defaultToolLoopMaxIdenticalCalls = 8
+
+	// 会话状态在最后一次请求后保留的时长
+	toolLoopConversationTTL = time.Hour
+	toolLoopPruneInterval   = 10 * time.Minute
+	// 错误信息中展示的工具调用签名最大长度
+	toolLoopMaxCallDisplay = 200
+)
+
+// toolLoopWarning 注入给模型的提醒，面向模型因此使用英文
+const toolLoopWarning = "[AMP-Manager] This conversation has made %d consecutive tool-call turns without new user input. " +
+	"If you are repeating the same actions without making progress, stop calling tools, summarize what you have tried, " +
+	"and ask the user how to proceed."
+
+// 客户端携带的会话标识请求头，按顺序取第一个非空值（工具循环检测与会话粘性共用）
+var conversationThreadHeaders = []string{"X-Amp-Thread-Id", "X-Thread-Id", "X-Session-Id", "Session_id"}
+
+var toolLoopState struct {
+	mu     sync.RWMutex
+	config model.ToolLoopConfig
+}
+
+// toolLoopConversation 会话的连续工具调用状态
+type toolLoopConversation struct {
+	turns       int
+	lastOutputs string
+	warned      bool
+	lastSeen    time.Time
+}
+
+var toolLoopConversations struct {
+	mu        sync.Mutex
+	items     map[string]*toolLoopConversation
+	lastPrune time.Time
+}
+
+func init() {
+	toolLoopState.config = DefaultToolLoopConfig()
+	toolLoopConversations.items = make(map[string]*toolLoopConversation)
+}
+
+// DefaultToolLoopConfig 默认关闭；开启后 40 轮提醒、80 轮或连续 8 次相同调用时拒绝
+func DefaultToolLoopConfig() model.ToolLoopConfig {
+	return model.ToolLoopConfig{
+		WarnTurns:         defaultToolLoopWarnTurns,
+		BlockTurns:        defaultToolLoopBlockTurns,
+		MaxIdenticalCalls: defaultToolLoopMaxIdenticalCalls,
+	}
+}
+
+// NormalizeToolLoopConfig 负数阈值视为不启用
+func NormalizeToolLoopConfig(cfg model.ToolLoopConfig) model.ToolLoopConfig {
+	cfg.WarnTurns = max(cfg.WarnTurns, 0)
+	cfg.BlockTurns = max(cfg.BlockTurns, 0)
+	cfg.MaxIdenticalCalls = max(cfg.MaxIdenticalCalls, 0)
+	return cfg
+}
+
+// ValidateToolLoopConfig 校验工具调用循环检测配置（需先 Normalize）
+func ValidateToolLoopConfig(cfg model.ToolLoopConfig) error {
+	if cfg.Enabled && cfg.WarnTurns == 0 && cfg.BlockTurns == 0 && cfg.MaxIdenticalCalls == 0 {
+		return fmt.Errorf("启用时 warnTurns、blockTurns、maxIdenticalCalls 至少需设置一项")
+	}
+	if cfg.WarnTurns > 0 && cfg.BlockTurns > 0 && cfg.WarnTurns >= cfg.BlockTurns {
+		return fmt.Errorf("warnTurns 必须小于 blockTurns")
+	}
+	return nil
+}
+
+// InitToolLoopConfig 从数据库 JSON 加载工具调用循环检测配置
+func InitToolLoopConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.ToolLoopConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("tool loop: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	cfg = NormalizeToolLoopConfig(cfg)
+	if err := ValidateToolLoopConfig(cfg); err != nil {
+		log.Warnf("tool loop: 配置无效，使用默认值: %v", err)
+		return
+	}
+	UpdateToolLoopConfig(cfg)
+}
+
+// UpdateToolLoopConfig 更新运行时工具调用循环检测配置
+func UpdateToolLoopConfig(cfg model.ToolLoopConfig) {
+	toolLoopState.mu.Lock()
+	defer toolLoopState.mu.Unlock()
+	toolLoopState.config = cfg
+}
+
+// GetToolLoopConfig 返回当前生效的工具调用循环检测配置
+func GetToolLoopConfig() model.ToolLoopConfig {
+	toolLoopState.mu.RLock()
+	defer toolLoopState.mu.RUnlock()
+	return toolLoopState.config
+}
+
+// toolLoopStats 请求末尾连续工具调用的统计
+type toolLoopStats struct {
+	// continuation 请求以工具结果结尾，即模型上一轮发起了工具调用
+	continuation bool
+	// turns 自最后一条用户消息以来的工具调用轮数
+	turns int
+	// identical 最近连续相同的工具调用轮数
+	identical int
+	lastCall  string
+	// historyMissing 请求只携带本轮工具结果（Responses previous_response_id），轮数需按会话累计
+	historyMissing bool
+	outputs        string
+}
+
+// ToolLoopGuardMiddleware 检测智能体的工具调用死循环：统计会话自最后一条用户消息以来连续的工具调用轮数，
+// 达到提醒阈值时向请求注入提醒消息，达到拒绝阈值或连续发起相同调用时返回 400 tool_loop_detected。
+// 支持 Claude Messages、OpenAI Chat、Responses 与 Gemini 格式
+func ToolLoopGuardMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := GetToolLoopConfig()
+		if !cfg.Enabled || !IsModelInvocation(c.Request.Method, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		bodyBytes := readJSONRequestBody(c.Request, maxRequestBodySize)
+		if bodyBytes == nil {
+			c.Next()
+			return
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+			c.Next()
+			return
+		}
+
+		format := detectIncomingFormat(c.Request.URL.Path)
+		stats := analyzeToolLoop(format, payload)
+		userID := ""
+		if proxyCfg := GetProxyConfig(c.Request.Context()); proxyCfg != nil {
+			userID = proxyCfg.UserID
+		}
+		key := toolLoopConversationKey(c.Request.Header, userID, payload)
+		firstWarn := observeToolLoop(key, &stats, cfg.WarnTurns, time.Now())
+		if !stats.continuation {
+			c.Next()
+			return
+		}
+
+		var reason string
+		switch {
+		case cfg.BlockTurns > 0 && stats.turns >= cfg.BlockTurns:
+			reason = fmt.Sprintf("会话已连续 %d 轮只进行工具调用，没有新的用户消息", stats.turns)
+		case cfg.MaxIdenticalCalls > 0 && stats.identical >= cfg.MaxIdenticalCalls:
+			call := stats.lastCall
+			if len(call) > toolLoopMaxCallDisplay {
+				call = strings.ToValidUTF8(call[:toolLoopMaxCallDisplay], "") + "..."
+			}
+			reason = fmt.Sprintf("会话已连续 %d 次发起相同的工具调用 %s", stats.identical, call)
+		}
+		if reason != "" {
+			log.Warnf("tool loop: 拒绝用户 %s 会话 %s 的请求: %s", userID, key, reason)
+			resp := NewStandardError(http.StatusBadRequest, reason+"，疑似陷入工具调用循环，请发送新的用户消息后继续")
+			resp.Error.Code = "tool_loop_detected"
+			c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if cfg.WarnTurns > 0 && stats.turns >= cfg.WarnTurns {
+			if newBody, ok := injectToolLoopWarning(format, payload, fmt.Sprintf(toolLoopWarning, stats.turns)); ok {
+				c.Request.Body = io.NopCloser(bytes.NewReader(newBody))
+				c.Request.ContentLength = int64(len(newBody))
+				c.Request.Header.Set("Content-Length", fmt.Sprintf("%d", len(newBody)))
+				if firstWarn {
+					log.Warnf("tool loop: 用户 %s 会话 %s 已连续 %d 轮工具调用，注入提醒消息", userID, key, stats.turns)
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// observeToolLoop 更新会话状态：请求不是工具结果时重置；只携带本轮工具结果时按会话累计轮数。
+// 返回本轮是否首次达到提醒阈值，用于只记录一次提醒日志
+func observeToolLoop(key string, stats *toolLoopStats, warnTurns int, now time.Time) bool {
+	toolLoopConversations.mu.Lock()
+	defer toolLoopConversations.mu.Unlock()
+
+	if now.Sub(toolLoopConversations.lastPrune) > toolLoopPruneInterval {
+		for k, conv := range toolLoopConversations.items {
+			if now.Sub(conv.lastSeen) > toolLoopConversationTTL {
+				delete(toolLoopConversations.items, k)
+			}
+		}
+		toolLoopConversations.lastPrune = now
+	}
+
+	conv, ok := toolLoopConversations.items[key]
+	if !ok && !stats.continuation {
+		return false
+	}
+	if !ok {
+		conv = &toolLoopConversation{}
+		toolLoopConversations.items[key] = conv
+	}
+	conv.lastSeen = now
+
+	if !stats.continuation {
+		conv.turns, conv.lastOutputs, conv.warned = 0, "", false
+		return false
+	}
+	if stats.historyMissing {
+		// 同一批工具结果重复提交（客户端重试）时不重复计数
+		if stats.outputs != conv.lastOutputs {
+			conv.turns++
+			conv.lastOutputs = stats.outputs
+		}
+		stats.turns = max(stats.turns, conv.turns)
+	}
+	conv.turns = stats.turns
+
+	if warnTurns <= 0 || stats.turns < warnTurns || conv.warned {
+		return false
+	}
+	conv.warned = true
+	return true
+}
+
+// toolLoopConversationKey 会话标识：优先使用客户端的会话请求头或请求体中的会话字段，
+// 否则取系统提示与首条用户消息的哈希；按用户隔离
+func toolLoopConversationKey(header http.Header, userID string, payload map[string]interface{}) string {
+	for _, name := range conversationThreadHeaders {
+		if v := strings.TrimSpace(header.Get(name)); v != "" {
+			return userID + ":" + v
+		}
+	}
+	if v, ok := payload["prompt_cache_key"].(string); ok && v != "" {
+		return userID + ":" + v
+	}
+	if meta, ok := payload["metadata"].(map[string]interface{}); ok {
+		if v, ok := meta["user_id"].(string); ok && v != "" {
+			return userID + ":" + v
+		}
+	}
+	switch conv := payload["conversation"].(type) {
+	case string:
+		if conv != "" {
+			return userID + ":" + conv
+		}
+	case map[string]interface{}:
+		if id, ok := conv["id"].(string); ok && id != "" {
+			return userID + ":" + id
+		}
+	}
+
+	h := sha256.New()
+	for _, field := range []string{"system", "instructions", "systemInstruction"} {
+		if v, ok := payload[field]; ok {
+			data, _ := json.Marshal(v)
+			h.Write(data)
+		}
+	}
+	for _, field := range []string{"messages", "input", "contents"} {
+		switch items := payload[field].(type) {
+		case string:
+			h.Write([]byte(items))
+		case []interface{}:
+			for _, item := range items {
+				if role, _ := asMap(item)["role"].(string); role == "user" {
+					data, _ := json.Marshal(item)
+					h.Write(data)
+					break
+				}
+			}
+		}
+	}
+	return userID + ":prefix-" + hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// analyzeToolLoop 从请求末尾向前统计连续的工具调用轮数
+func analyzeToolLoop(format translator.Format, payload map[string]interface{}) toolLoopStats {
+	var stats toolLoopStats
+	var turns []string
+	switch format {
+	case translator.FormatClaude:
+		stats.continuation, turns = claudeToolTurns(payload)
+	case translator.FormatOpenAIResponses:
+		stats.continuation, turns, stats.outputs = responsesToolTurns(payload)
+		if id, _ := payload["previous_response_id"].(string); id != "" {
+			stats.historyMissing = true
+		}
+	case translator.FormatGemini:
+		stats.continuation, turns = geminiToolTurns(payload)
+	default:
+		stats.continuation, turns = chatToolTurns(payload)
+	}
+	if !stats.continuation {
+		return toolLoopStats{}
+	}
+
+	stats.turns = len(turns)
+	if len(turns) > 0 {
+		stats.lastCall = turns[0]
+		for _, sig := range turns {
+			if sig != turns[0] {
+				break
+			}
+			stats.identical++
+		}
+	}
+	return stats
+}
+
+// claudeToolTurns 最后一条用户消息包含 tool_result 时为工具调用续轮；返回由近及远的每轮调用签名
+func claudeToolTurns(payload map[string]interface{}) (bool, []string) {
+	messages, _ := payload["messages"].([]interface{})
+	var turns []string
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := asMap(messages[i])
+		blocks, _ := msg["content"].([]interface{})
+		switch msg["role"] {
+		case "user":
+			if !hasBlockType(blocks, "tool_result") {
+				return i < len(messages)-1, turns
+			}
+		case "assistant":
+			var calls []string
+			for _, b := range blocks {
+				block := asMap(b)
+				if block["type"] == "tool_use" {
+					calls = append(calls, toolCallSignature(block["name"], block["input"]))
+				}
+			}
+			if len(calls) == 0 {
+				return i < len(messages)-1, turns
+			}
+			turns = append(turns, strings.Join(calls, "; "))
+		}
+	}
+	return len(turns) > 0, turns
+}
+
+// chatToolTurns 最后一条消息为 tool 消息时为工具调用续轮
+func chatToolTurns(payload map[string]interface{}) (bool, []string) {
+	messages, _ := payload["messages"].([]interface{})
+	if len(messages) == 0 {
+		return false, nil
+	}
+	if role, _ := asMap(messages[len(messages)-1])["role"].(string); role != "tool" && role != "function" {
+		return false, nil
+	}
+	var turns []string
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := asMap(messages[i])
+		switch msg["role"] {
+		case "tool", "function", "system", "developer":
+			continue
+		case "assistant":
+			var calls []string
+			toolCalls, _ := msg["tool_calls"].([]interface{})
+			for _, tc := range toolCalls {
+				fn := asMap(asMap(tc)["function"])
+				calls = append(calls, toolCallSignature(fn["name"], fn["arguments"]))
+			}
+			if fc := asMap(msg["function_call"]); len(fc) > 0 {
+				calls = append(calls, toolCallSignature(fc["name"], fc["arguments"]))
+			}
+			if len(calls) == 0 {
+				return true, turns
+			}
+			turns = append(turns, strings.Join(calls, "; "))
+		default:
+			return true, turns
+		}
+	}
+	return true, turns
+}
+
+// responsesToolTurns 最后一个输入项为 *_call_output 时为工具调用续轮；相邻的调用项属于同一轮。
+// outputs 为末尾工具结果的 call_id 列表，用于识别重复提交
+func responsesToolTurns(payload map[string]interface{}) (bool, []string, string) {
+	items, _ := payload["input"].([]interface{})
+	if len(items) == 0 {
+		return false, nil, ""
+	}
+	if itemType, _ := asMap(items[len(items)-1])["type"].(string); !strings.HasSuffix(itemType, "_call_output") {
+		return false, nil, ""
+	}
+
+	var turns []string
+	var outputs []string
+	var calls []string
+	flush := func() {
+		if len(calls) > 0 {
+			// 倒序遍历收集，恢复原始顺序
+			for l, r := 0, len(calls)-1; l < r; l, r = l+1, r-1 {
+				calls[l], calls[r] = calls[r], calls[l]
+			}
+			turns = append(turns, strings.Join(calls, "; "))
+			calls = nil
+		}
+	}
+	trailing := true
+	for i := len(items) - 1; i >= 0; i-- {
+		item := asMap(items[i])
+		itemType, _ := item["type"].(string)
+		switch {
+		case strings.HasSuffix(itemType, "_call_output"):
+			flush()
+			if trailing {
+				id, _ := item["call_id"].(string)
+				outputs = append(outputs, id)
+			}
+			continue
+		case strings.HasSuffix(itemType, "_call"):
+			args := item["arguments"]
+			if args == nil {
+				args = item["input"]
+			}
+			name := item["name"]
+			if name == nil {
+				name = itemType
+			}
+			calls = append(calls, toolCallSignature(name, args))
+		case itemType == "message" || itemType == "":
+			if role, _ := item["role"].(string); role == "user" {
+				flush()
+				return true, turns, strings.Join(outputs, ",")
+			}
+		}
+		trailing = false
+	}
+	flush()
+	return true, turns, strings.Join(outputs, ",")
+}
+
+// geminiToolTurns 最后一条内容包含 functionResponse 时为工具调用续轮
+func geminiToolTurns(payload map[string]interface{}) (bool, []string) {
+	contents, _ := payload["contents"].([]interface{})
+	var turns []string
+	for i := len(contents) - 1; i >= 0; i-- {
+		content := asMap(contents[i])
+		parts, _ := content["parts"].([]interface{})
+		var calls []string
+		hasResponse := false
+		for _, p := range parts {
+			part := asMap(p)
+			if fc := asMap(part["functionCall"]); len(fc) > 0 {
+				calls = append(calls, toolCallSignature(fc["name"], fc["args"]))
+			}
+			if _, ok := part["functionResponse"]; ok {
+				hasResponse = true
+			}
+		}
+		if content["role"] == "model" {
+			if len(calls) == 0 {
+				return i < len(contents)-1, turns
+			}
+			turns = append(turns, strings.Join(calls, "; "))
+		} else if !hasResponse {
+			return i < len(contents)-1, turns
+		}
+	}
+	return len(turns) > 0, turns
+}
+
+// toolCallSignature 工具名与参数的规范化表示；JSON 字符串参数重新序列化以忽略键顺序与空白差异
+func toolCallSignature(name, args interface{}) string {
+	if s, ok := args.(string); ok {
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(s), &parsed); err == nil {
+			args = parsed
+		}
+	}
+	data, _ := json.Marshal(args)
+	return fmt.Sprintf("%v(%s)", name, data)
+}
+
+// injectToolLoopWarning 在请求末尾追加提醒：OpenAI Chat / Responses 追加 system 消息；
+// Claude 与 Gemini 追加到最后一条用户消息，避免改动系统提示导致提示缓存失效
+func injectToolLoopWarning(format translator.Format, payload map[string]interface{}, warning string) ([]byte, bool) {
+	switch format {
+	case translator.FormatClaude:
+		messages, _ := payload["messages"].([]interface{})
+		if len(messages) == 0 {
+			return nil, false
+		}
+		last := asMap(messages[len(messages)-1])
+		blocks, ok := last["content"].([]interface{})
+		if !ok {
+			return nil, false
+		}
+		last["content"] = append(blocks, map[string]interface{}{"type": "text", "text": warning})
+	case translator.FormatOpenAIResponses:
+		items, ok := payload["input"].([]interface{})
+		if !ok {
+			return nil, false
+		}
+		payload["input"] = append(items, map[string]interface{}{"type": "message", "role": "system", "content": warning})
+	case translator.FormatGemini:
+		contents, _ := payload["contents"].([]interface{})
+		if len(contents) == 0 {
+			return nil, false
+		}
+		last := asMap(contents[len(contents)-1])
+		parts, ok := last["parts"].([]interface{})
+		if !ok {
+			return nil, false
+		}
+		last["parts"] = append(parts, map[string]interface{}{"text": warning})
+	default:
+		messages, ok := payload["messages"].([]interface{})
+		if !ok {
+			return nil, false
+		}
+		payload["messages"] = append(messages, map[string]interface{}{"role": "system", "content": warning})
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func hasBlockType(blocks []interface{}, blockType string) bool {
+	for _, b := range blocks {
+		if asMap(b)["type"] == blockType {
+			return true
+		}
+	}
+	return false
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
@@ -0,0 +1,190 @@
+package amp
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+)
+
+func mustPayload(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	return payload
+}
+
+func TestAnalyzeToolLoop_Claude(t *testing.T) {
+	payload := mustPayload(t, `{"messages":[
+		{"role":"user","content":"list files"},
+		{"role":"assistant","content":[{"type":"tool_use","id":"1","name":"ls","input":{"path":"a"}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"1","content":"x"}]},
+		{"role":"assistant","content":[{"type":"text","text":"again"},{"type":"tool_use","id":"2","name":"ls","input":{"path":"b"}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"2","content":"x"}]},
+		{"role":"assistant","content":[{"type":"tool_use","id":"3","name":"ls","input":{"path":"b"}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"3","content":"x"},{"type":"text","text":"<reminder>"}]}
+	]}`)
+	stats := analyzeToolLoop(translator.FormatClaude, payload)
+	if !stats.continuation || stats.turns != 3 || stats.identical != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	payload = mustPayload(t, `{"messages":[
+		{"role":"assistant","content":[{"type":"tool_use","id":"1","name":"ls","input":{}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"1","content":"x"}]},
+		{"role":"user","content":"thanks, now do something else"}
+	]}`)
+	if stats := analyzeToolLoop(translator.FormatClaude, payload); stats.continuation || stats.turns != 0 {
+		t.Fatalf("a new user message must reset the count, got %+v", stats)
+	}
+}
+
+func TestAnalyzeToolLoop_OpenAIChat(t *testing.T) {
+	payload := mustPayload(t, `{"messages":[
+		{"role":"system","content":"sys"},
+		{"role":"user","content":"go"},
+		{"role":"assistant","tool_calls":[{"id":"a","type":"function","function":{"name":"read","arguments":"{\"b\":1,\"a\":2}"}}]},
+		{"role":"tool","tool_call_id":"a","content":"x"},
+		{"role":"assistant","tool_calls":[{"id":"b","type":"function","function":{"name":"read","arguments":"{\"a\": 2, \"b\": 1}"}}]},
+		{"role":"tool","tool_call_id":"b","content":"x"}
+	]}`)
+	stats := analyzeToolLoop(translator.FormatOpenAIChat, payload)
+	if !stats.continuation || stats.turns != 2 || stats.identical != 2 {
+		t.Fatalf("arguments differing only in key order should count as identical, got %+v", stats)
+	}
+}
+
+func TestAnalyzeToolLoop_Responses(t *testing.T) {
+	payload := mustPayload(t, `{"input":[
+		{"role":"user","content":"go"},
+		{"type":"function_call","call_id":"a","name":"ls","arguments":"{}"},
+		{"type":"function_call","call_id":"b","name":"cat","arguments":"{}"},
+		{"type":"function_call_output","call_id":"a","output":"x"},
+		{"type":"function_call_output","call_id":"b","output":"x"},
+		{"type":"reasoning","summary":[]},
+		{"type":"function_call","call_id":"c","name":"ls","arguments":"{}"},
+		{"type":"function_call_output","call_id":"c","output":"x"}
+	]}`)
+	stats := analyzeToolLoop(translator.FormatOpenAIResponses, payload)
+	if !stats.continuation || stats.turns != 2 || stats.identical != 1 || stats.outputs != "c" {
+		t.Fatalf("parallel calls should form a single turn, got %+v", stats)
+	}
+}
+
+func TestAnalyzeToolLoop_Gemini(t *testing.T) {
+	payload := mustPayload(t, `{"contents":[
+		{"role":"user","parts":[{"text":"go"}]},
+		{"role":"model","parts":[{"functionCall":{"name":"ls","args":{}}}]},
+		{"role":"user","parts":[{"functionResponse":{"name":"ls","response":{}}}]}
+	]}`)
+	if stats := analyzeToolLoop(translator.FormatGemini, payload); !stats.continuation || stats.turns != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestObserveToolLoop_AccumulatesWithoutHistory(t *testing.T) {
+	t.Cleanup(func() {
+		toolLoopConversations.mu.Lock()
+		delete(toolLoopConversations.items, "u:thread")
+		toolLoopConversations.mu.Unlock()
+	})
+	now := time.Now()
+	observe := func(outputs string) toolLoopStats {
+		stats := toolLoopStats{continuation: true, historyMissing: true, outputs: outputs}
+		observeToolLoop("u:thread", &stats, 0, now)
+		return stats
+	}
+
+	observe("a")
+	observe("b")
+	if stats := observe("b"); stats.turns != 2 {
+		t.Fatalf("retried tool results must not be counted twice, got %d", stats.turns)
+	}
+	observeToolLoop("u:thread", &toolLoopStats{}, 0, now)
+	if stats := observe("c"); stats.turns != 1 {
+		t.Fatalf("a new user message must reset the conversation, got %d", stats.turns)
+	}
+}
+
+func TestObserveToolLoop_WarnsOncePerStreak(t *testing.T) {
+	t.Cleanup(func() {
+		toolLoopConversations.mu.Lock()
+		delete(toolLoopConversations.items, "u:warn")
+		toolLoopConversations.mu.Unlock()
+	})
+	now := time.Now()
+	stats := toolLoopStats{continuation: true, turns: 5}
+	if !observeToolLoop("u:warn", &stats, 5, now) {
+		t.Fatal("first time over the threshold should be reported")
+	}
+	stats = toolLoopStats{continuation: true, turns: 6}
+	if observeToolLoop("u:warn", &stats, 5, now) {
+		t.Fatal("the warning should be logged only once per streak")
+	}
+}
+
+func TestToolLoopConversationKey(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Amp-Thread-Id", "T-1")
+	if key := toolLoopConversationKey(header, "u", nil); key != "u:T-1" {
+		t.Fatalf("unexpected key %q", key)
+	}
+
+	first := mustPayload(t, `{"system":"s","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"a"}]}`)
+	second := mustPayload(t, `{"system":"s","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"b"}]}`)
+	other := mustPayload(t, `{"system":"s","messages":[{"role":"user","content":"bye"}]}`)
+	if toolLoopConversationKey(http.Header{}, "u", first) != toolLoopConversationKey(http.Header{}, "u", second) {
+		t.Fatal("requests sharing a prefix should map to the same conversation")
+	}
+	if toolLoopConversationKey(http.Header{}, "u", first) == toolLoopConversationKey(http.Header{}, "u", other) {
+		t.Fatal("different first user messages should map to different conversations")
+	}
+	if toolLoopConversationKey(http.Header{}, "u", first) == toolLoopConversationKey(http.Header{}, "v", first) {
+		t.Fatal("conversations must be isolated per user")
+	}
+}
+
+func TestValidateToolLoopConfig(t *testing.T) {
+	if err := ValidateToolLoopConfig(NormalizeToolLoopConfig(model.ToolLoopConfig{Enabled: true, WarnTurns: -1})); err == nil {
+		t.Fatal("enabling without any threshold should be rejected")
+	}
+	if err := ValidateToolLoopConfig(model.ToolLoopConfig{Enabled: true, WarnTurns: 10, BlockTurns: 10}); err == nil {
+		t.Fatal("warnTurns must be below blockTurns")
+	}
+	cfg := DefaultToolLoopConfig()
+	cfg.Enabled = true
+	if err := ValidateToolLoopConfig(cfg); err != nil {
+		t.Fatalf("default config should be valid: %v", err)
+	}
+}
+
+func TestInjectToolLoopWarning_AppendsToLastUserMessage(t *testing.T) {
+	payload := mustPayload(t, `{"system":[{"type":"text","text":"s","cache_control":{"type":"ephemeral"}}],"messages":[
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"1","content":"x"}]}
+	]}`)
+	data, ok := injectToolLoopWarning(translator.FormatClaude, payload, "stop")
+	if !ok {
+		t.Fatal("expected the warning to be injected")
+	}
+	var got struct {
+		System   []map[string]interface{} `json:"system"`
+		Messages []struct {
+			Content []map[string]interface{} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.System) != 1 {
+		t.Fatal("the system prompt must stay untouched to keep the prompt cache")
+	}
+	blocks := got.Messages[0].Content
+	if len(blocks) != 2 || blocks[1]["type"] != "text" || blocks[1]["text"] != "stop" {
+		t.Fatalf("unexpected content %+v", blocks)
+	}
+}
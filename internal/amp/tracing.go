@@ -0,0 +1,51 @@
+package amp
+
+import (
+	"net/http"
+
+	"ampmanager/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TracingMiddleware 为代理请求创建根 server span，沿用客户端传入的 traceparent。
+// 渠道选择、上游调用、格式翻译与计费结算的 span 都挂在该 span 下；未配置 OTLP 导出时直接放行
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tracing.Enabled() {
+			c.Next()
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+		ctx, span := tracing.Start(ctx, c.Request.Method+" "+route, tracing.SpanKindServer)
+		span.SetAttr("http.request.method", c.Request.Method)
+		span.SetAttr("http.route", route)
+		span.SetAttr("url.path", c.Request.URL.Path)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttr("http.response.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetErrorMessage(http.StatusText(status))
+		}
+		if cfg := GetProxyConfig(c.Request.Context()); cfg != nil {
+			span.SetAttr("enduser.id", cfg.UserID)
+			span.SetAttr("ampmanager.api_key_id", cfg.APIKeyID)
+		}
+		if channelCfg := GetChannelConfig(c); channelCfg != nil && channelCfg.Channel != nil {
+			span.SetAttr("gen_ai.request.model", channelCfg.Model)
+			span.SetAttr("channel.id", channelCfg.Channel.ID)
+		}
+		if trace := GetRequestTrace(c.Request.Context()); trace != nil {
+			span.SetAttr("ampmanager.request_id", trace.RequestID)
+		}
+		span.End()
+	}
+}
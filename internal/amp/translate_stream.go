@@ -0,0 +1,212 @@
+package amp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ampmanager/internal/tracing"
+	"ampmanager/internal/translator"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// translatingSSEWrapper 将上游格式的 SSE 流逐个事件翻译为客户端格式。
+// 上游结束时补发一次 [DONE]，由翻译器补齐客户端格式的结束事件（已结束时翻译器忽略）。
+// 严格模式下翻译失败会下发客户端格式的错误事件并终止流，宽松模式丢弃该事件继续转发。
+// 尚未成帧的数据计入请求内存预算，单个事件超出预算时同样下发错误事件并终止流
+type translatingSSEWrapper struct {
+	rc     io.ReadCloser
+	ctx    context.Context
+	info   *TranslationInfo
+	budget *requestMemoryBudget
+	buf    []byte
+	out    bytes.Buffer
+	eof    bool
+	done   bool
+
+	// span 覆盖整个流的翻译，关闭时记录翻译的事件数
+	span   *tracing.Span
+	events int
+}
+
+func newTranslatingSSEWrapper(ctx context.Context, rc io.ReadCloser, info *TranslationInfo) io.ReadCloser {
+	span := startTranslationSpan(ctx, "translate.stream", info.OutgoingFormat, info.IncomingFormat)
+	return &translatingSSEWrapper{rc: rc, ctx: ctx, info: info, budget: memoryBudgetFrom(ctx), span: span}
+}
+
+func (w *translatingSSEWrapper) Close() error {
+	w.span.SetAttr("translation.events", w.events)
+	w.span.End()
+	return w.rc.Close()
+}
+
+// startTranslationSpan 记录一次跨格式翻译，from/to 为翻译方向
+func startTranslationSpan(ctx context.Context, name string, from, to translator.Format) *tracing.Span {
+	_, span := tracing.Start(ctx, name, tracing.SpanKindInternal)
+	span.SetAttr("translation.from", string(from))
+	span.SetAttr("translation.to", string(to))
+	return span
+}
+
+func (w *translatingSSEWrapper) Read(p []byte) (int, error) {
+	for w.out.Len() == 0 {
+		if w.done {
+			return 0, io.EOF
+		}
+		if w.eof {
+			if len(bytes.TrimSpace(w.buf)) > 0 {
+				w.translateFrame(w.buf)
+			}
+			w.budget.release(len(w.buf))
+			w.buf = nil
+			if !w.done {
+				w.translate([]byte("[DONE]"))
+			}
+			w.done = true
+			continue
+		}
+
+		tmp := make([]byte, 8*1024)
+		n, err := w.rc.Read(tmp)
+		if n > 0 {
+			if !w.budget.reserve(n) {
+				w.failWith(memoryBudgetExceededCode, "upstream stream event exceeds the per-request memory budget", w.budget.abort("translation"))
+				continue
+			}
+			w.buf = append(w.buf, tmp[:n]...)
+		}
+		if err == io.EOF {
+			w.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+		for !w.done {
+			idx, delimLen := findSSEDelimiter(w.buf)
+			if idx < 0 {
+				break
+			}
+			frame := w.buf[:idx]
+			w.buf = w.buf[idx+delimLen:]
+			w.budget.release(idx + delimLen)
+			w.translateFrame(frame)
+		}
+		if w.out.Len() == 0 && !w.eof && !w.done {
+			return 0, nil
+		}
+	}
+	return w.out.Read(p)
+}
+
+// translateFrame 取出事件中的 data 负载（多行 data 按规范以换行拼接）后翻译，注释行与空事件直接丢弃
+func (w *translatingSSEWrapper) translateFrame(frame []byte) {
+	var data [][]byte
+	for _, line := range bytes.Split(frame, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if payload, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = append(data, bytes.TrimSpace(payload))
+		}
+	}
+	if payload := bytes.Join(data, []byte("\n")); len(payload) > 0 {
+		w.translate(payload)
+	}
+}
+
+func (w *translatingSSEWrapper) translate(payload []byte) {
+	info := w.info
+	w.events++
+	chunks, err := translator.TranslateStream(w.ctx, info.IncomingFormat, info.OutgoingFormat, info.Model, info.OriginalRequestBody, info.ConvertedBody, payload, info.ResponseParam)
+	if err != nil {
+		log.Warnf("channel proxy: failed to translate %s stream event to %s: %v", info.OutgoingFormat, info.IncomingFormat, err)
+		if info.Strict {
+			w.fail(err)
+		}
+		return
+	}
+	for _, chunk := range chunks {
+		info.ResponseSession.recordResponseFromSSE(chunk, time.Now())
+		w.out.WriteString(chunk)
+	}
+}
+
+// fail 严格模式：下发客户端格式的错误事件后终止流，不再读取上游
+func (w *translatingSSEWrapper) fail(err error) {
+	w.failWith(translationFailedCode, translationFailedMessage(err), err)
+}
+
+// failWith 下发客户端格式的错误事件后终止流，code 同时记录为请求的错误类型
+func (w *translatingSSEWrapper) failWith(code, msg string, err error) {
+	w.budget.release(len(w.buf))
+	w.buf = nil
+	switch w.info.IncomingFormat {
+	case translator.FormatClaude:
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":  "error",
+			"error": map[string]string{"type": "api_error", "message": msg},
+		})
+		_ = translator.NewSSEEventWriter(&w.out).WriteEvent("error", string(data))
+	default:
+		data, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]string{"message": msg, "type": "api_error", "code": code},
+		})
+		sse := translator.NewSSEEventWriter(&w.out)
+		_ = sse.WriteData(string(data))
+		_ = sse.WriteDone()
+	}
+	if trace := GetRequestTrace(w.ctx); trace != nil {
+		trace.SetError(code)
+	}
+	w.span.SetError(err)
+	w.done = true
+}
+
+// translateErrorResponse 将上游的错误响应翻译为客户端格式，无法翻译时宽松模式保持原样，严格模式改为 502
+func translateErrorResponse(resp *http.Response, info *TranslationInfo) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxNonStreamingResponseSize))
+	resp.Body.Close()
+	if err != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return
+	}
+	body = NewGzipDecompressor().Decompress(body, resp.Header.Get("Content-Encoding"), resp.Header)
+	span := startTranslationSpan(resp.Request.Context(), "translate.error_response", info.OutgoingFormat, info.IncomingFormat)
+	translated, err := translator.TranslateNonStream(resp.Request.Context(), info.IncomingFormat, info.OutgoingFormat, info.Model, info.OriginalRequestBody, info.ConvertedBody, body, info.ResponseParam)
+	span.SetError(err)
+	span.End()
+	if err == nil {
+		body = []byte(translated)
+		resp.Header.Set("Content-Type", "application/json")
+	} else {
+		log.Warnf("channel proxy: failed to translate %s error response to %s: %v", info.OutgoingFormat, info.IncomingFormat, err)
+		if info.Strict {
+			body = translationFailedResponse(resp, err)
+		}
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Transfer-Encoding")
+	resp.TransferEncoding = nil
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+const translationFailedCode = "translation_failed"
+
+func translationFailedMessage(err error) string {
+	return "failed to translate upstream response: " + err.Error()
+}
+
+// translationFailedResponse 严格模式下翻译失败时改写为 502，并返回结构化错误体
+func translationFailedResponse(resp *http.Response, err error) []byte {
+	errResp := NewStandardError(http.StatusBadGateway, translationFailedMessage(err))
+	errResp.Error.Code = translationFailedCode
+	body, _ := json.Marshal(errResp)
+	resp.StatusCode = http.StatusBadGateway
+	resp.Status = http.StatusText(http.StatusBadGateway)
+	resp.Header.Set("Content-Type", "application/json")
+	return body
+}
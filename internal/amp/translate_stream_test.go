@@ -0,0 +1,129 @@
+package amp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/translator"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestTranslatingSSEWrapper_FinishesStreamWithoutDone(t *testing.T) {
+	var param any
+	info := &TranslationInfo{
+		NeedsConversion: true,
+		IncomingFormat:  translator.FormatClaude,
+		OutgoingFormat:  translator.FormatOpenAIChat,
+		Model:           "claude-sonnet-4",
+		ResponseParam:   &param,
+	}
+	// 上游未发送 [DONE]，且使用 CRLF 分隔、夹带注释行
+	upstream := ": keep-alive\r\n\r\n" +
+		"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\r\n\r\n" +
+		"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1}}\r\n\r\n"
+
+	out, err := io.ReadAll(newTranslatingSSEWrapper(context.Background(), io.NopCloser(strings.NewReader(upstream)), info))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var events []string
+	var text strings.Builder
+	for _, line := range strings.Split(string(out), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			events = append(events, gjson.Get(data, "type").String())
+			text.WriteString(gjson.Get(data, "delta.text").String())
+		}
+	}
+	want := "message_start content_block_start content_block_delta content_block_stop message_delta message_stop"
+	if got := strings.Join(events, " "); got != want {
+		t.Fatalf("events:\n got %s\nwant %s", got, want)
+	}
+	if text.String() != "Hi" {
+		t.Fatalf("text = %q", text.String())
+	}
+}
+
+func TestTranslatingSSEWrapper_StrictModeFailsStream(t *testing.T) {
+	upstream := "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+		"data: {not json\n\n" +
+		"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\" there\"}}]}\n\n"
+
+	for _, strict := range []bool{false, true} {
+		var param any
+		info := &TranslationInfo{
+			NeedsConversion: true,
+			IncomingFormat:  translator.FormatClaude,
+			OutgoingFormat:  translator.FormatOpenAIChat,
+			Model:           "claude-sonnet-4",
+			ResponseParam:   &param,
+			Strict:          strict,
+		}
+		out, err := io.ReadAll(newTranslatingSSEWrapper(context.Background(), io.NopCloser(strings.NewReader(upstream)), info))
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var text strings.Builder
+		var errorEvent string
+		for _, line := range strings.Split(string(out), "\n") {
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				text.WriteString(gjson.Get(data, "delta.text").String())
+				if gjson.Get(data, "type").String() == "error" {
+					errorEvent = data
+				}
+			}
+		}
+		if strict {
+			if text.String() != "Hi" {
+				t.Fatalf("strict: text after failure should be dropped, got %q", text.String())
+			}
+			if !strings.Contains(gjson.Get(errorEvent, "error.message").String(), "failed to translate upstream response") {
+				t.Fatalf("strict: missing error event in %s", out)
+			}
+		} else {
+			if text.String() != "Hi there" {
+				t.Fatalf("relaxed: text = %q", text.String())
+			}
+			if errorEvent != "" {
+				t.Fatalf("relaxed: unexpected error event %s", errorEvent)
+			}
+		}
+	}
+}
+
+func TestTranslateErrorResponse_StrictModeReturns502(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		var param any
+		info := &TranslationInfo{
+			NeedsConversion: true,
+			IncomingFormat:  translator.FormatClaude,
+			OutgoingFormat:  translator.FormatOpenAIChat,
+			Model:           "claude-sonnet-4",
+			ResponseParam:   &param,
+			Strict:          strict,
+		}
+		req, _ := http.NewRequest(http.MethodPost, "http://upstream/v1/chat/completions", nil)
+		resp := &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Header:     http.Header{"Content-Type": []string{"text/html"}},
+			Body:       io.NopCloser(strings.NewReader("<html>bad gateway</html>")),
+			Request:    req,
+		}
+		translateErrorResponse(resp, info)
+		body, _ := io.ReadAll(resp.Body)
+
+		if strict {
+			if resp.StatusCode != http.StatusBadGateway {
+				t.Fatalf("strict: status = %d", resp.StatusCode)
+			}
+			if code := gjson.GetBytes(body, "error.code").String(); code != translationFailedCode {
+				t.Fatalf("strict: error code = %q, body %s", code, body)
+			}
+		} else if resp.StatusCode != http.StatusInternalServerError || string(body) != "<html>bad gateway</html>" {
+			t.Fatalf("relaxed: status %d body %s", resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package amp
+
+import (
+	"encoding/json"
+	"sync"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var translationState struct {
+	mu     sync.RWMutex
+	config model.TranslationConfig
+}
+
+// InitTranslationConfig 从数据库 JSON 加载跨格式翻译配置
+func InitTranslationConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.TranslationConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("translation: 解析配置失败，使用默认值: %v", err)
+		return
+	}
+	UpdateTranslationConfig(cfg)
+}
+
+// UpdateTranslationConfig 更新运行时跨格式翻译配置
+func UpdateTranslationConfig(cfg model.TranslationConfig) {
+	translationState.mu.Lock()
+	defer translationState.mu.Unlock()
+	translationState.config = cfg
+}
+
+// GetTranslationConfig 返回当前生效的跨格式翻译配置（默认宽松模式）
+func GetTranslationConfig() model.TranslationConfig {
+	translationState.mu.RLock()
+	defer translationState.mu.RUnlock()
+	return translationState.config
+}
+
+// strictTranslation 渠道设置优先，未设置时沿用全局配置
+func strictTranslation(channel *model.Channel) bool {
+	if channel != nil {
+		switch channel.TranslationMode {
+		case model.ChannelTranslationModeStrict:
+			return true
+		case model.ChannelTranslationModeRelaxed:
+			return false
+		}
+	}
+	return GetTranslationConfig().Strict
+}
@@ -0,0 +1,163 @@
+package amp
+
+import (
+	"encoding/json"
+	"strings"
+
+	"ampmanager/internal/tokenizer"
+
+	"github.com/tidwall/gjson"
+)
+
+// usageEncoding 按上游模型选择 token 估算编码，模型名无法识别时按渠道格式选择
+func usageEncoding(modelName string, provider ProviderKind) tokenizer.Encoding {
+	if enc := tokenizer.ForModel(modelName); enc != tokenizer.Generic {
+		return enc
+	}
+	switch provider {
+	case ProviderAnthropic:
+		return tokenizer.Claude
+	case ProviderGemini:
+		return tokenizer.Gemini
+	default:
+		return tokenizer.Generic
+	}
+}
+
+// traceEncoding 请求日志对应的估算编码
+func traceEncoding(trace *RequestTrace, provider ProviderKind) tokenizer.Encoding {
+	if trace == nil {
+		return usageEncoding("", provider)
+	}
+	modelName := trace.MappedModel
+	if modelName == "" {
+		modelName = trace.OriginalModel
+	}
+	return usageEncoding(modelName, provider)
+}
+
+// estimateRequestTokens 估算发往上游的请求体的输入 token：累加 JSON 中的全部字符串，
+// 图片等二进制内容按固定值计（与 cost_ceiling 的预估一致）。请求体不是 JSON 时返回 0
+func estimateRequestTokens(body []byte, enc tokenizer.Encoding) int {
+	if len(body) == 0 {
+		return 0
+	}
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0
+	}
+	return countPayloadTokens(payload, enc)
+}
+
+func countPayloadTokens(v interface{}, enc tokenizer.Encoding) int {
+	switch val := v.(type) {
+	case string:
+		if isBinaryString(val) {
+			return estimatedTokensPerBinaryItem
+		}
+		return tokenizer.Count(enc, val)
+	case map[string]interface{}:
+		total := 0
+		for _, item := range val {
+			total += countPayloadTokens(item, enc)
+		}
+		return total
+	case []interface{}:
+		total := 0
+		for _, item := range val {
+			total += countPayloadTokens(item, enc)
+		}
+		return total
+	default:
+		return 0
+	}
+}
+
+// estimateResponseOutput 非流式响应没有输出用量时，按响应中的文本、思考过程与工具调用参数估算输出 token
+func estimateResponseOutput(trace *RequestTrace, body []byte, provider ProviderKind) {
+	if trace == nil {
+		return
+	}
+	text := responseOutputContent(provider, body)
+	trace.SetEstimatedOutputTokens(tokenizer.Count(traceEncoding(trace, provider), text))
+}
+
+// responseOutputContent 提取非流式响应中模型生成的内容，与 streamDeltaContent 覆盖的内容一致
+func responseOutputContent(provider ProviderKind, body []byte) string {
+	var b strings.Builder
+	root := gjson.ParseBytes(body)
+	switch provider {
+	case ProviderOpenAIChat:
+		root.Get("choices").ForEach(func(_, choice gjson.Result) bool {
+			message := choice.Get("message")
+			b.WriteString(message.Get("content").String())
+			b.WriteString(message.Get("reasoning_content").String())
+			message.Get("tool_calls").ForEach(func(_, call gjson.Result) bool {
+				b.WriteString(call.Get("function.arguments").String())
+				return true
+			})
+			return true
+		})
+
+	case ProviderOpenAIResponses:
+		root.Get("output").ForEach(func(_, item gjson.Result) bool {
+			b.WriteString(item.Get("arguments").String())
+			item.Get("content").ForEach(func(_, part gjson.Result) bool {
+				b.WriteString(part.Get("text").String())
+				return true
+			})
+			item.Get("summary").ForEach(func(_, part gjson.Result) bool {
+				b.WriteString(part.Get("text").String())
+				return true
+			})
+			return true
+		})
+
+	case ProviderGemini:
+		root.Get("candidates").ForEach(func(_, candidate gjson.Result) bool {
+			candidate.Get("content.parts").ForEach(func(_, part gjson.Result) bool {
+				b.WriteString(part.Get("text").String())
+				if args := part.Get("functionCall.args"); args.Exists() {
+					b.WriteString(args.Raw)
+				}
+				return true
+			})
+			return true
+		})
+
+	case ProviderOllama:
+		b.WriteString(ollamaOutputContent(root))
+
+	case ProviderOpenAIEmbeddings, ProviderOpenAIAudio:
+		// 没有生成的文本内容
+
+	default:
+		root.Get("content").ForEach(func(_, block gjson.Result) bool {
+			switch block.Get("type").String() {
+			case "text":
+				b.WriteString(block.Get("text").String())
+			case "thinking":
+				b.WriteString(block.Get("thinking").String())
+			case "tool_use":
+				b.WriteString(block.Get("input").Raw)
+			}
+			return true
+		})
+	}
+	return b.String()
+}
+
+// ollamaOutputContent 提取 Ollama 响应（或流式分块）中的文本、思考过程与工具调用参数，
+// /api/chat 位于 message 下，/api/generate 位于顶层 response / thinking
+func ollamaOutputContent(root gjson.Result) string {
+	var b strings.Builder
+	b.WriteString(root.Get("message.content").String())
+	b.WriteString(root.Get("message.thinking").String())
+	b.WriteString(root.Get("response").String())
+	b.WriteString(root.Get("thinking").String())
+	root.Get("message.tool_calls").ForEach(func(_, call gjson.Result) bool {
+		b.WriteString(call.Get("function.arguments").Raw)
+		return true
+	})
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package amp
+
+import (
+	"strings"
+	"testing"
+
+	"ampmanager/internal/tokenizer"
+)
+
+func TestEstimateRequestTokens_CountsTextAndBinaryItems(t *testing.T) {
+	body := `{"model":"claude-x","messages":[{"role":"user","content":[` +
+		`{"type":"text","text":"Hello there, friend"},` +
+		`{"type":"image","source":{"type":"base64","data":"` + strings.Repeat("A", 2048) + `"}}]}]}`
+	got := estimateRequestTokens([]byte(body), tokenizer.Claude)
+	// 图片按固定值计，其余字符串逐个估算
+	if got <= estimatedTokensPerBinaryItem || got > estimatedTokensPerBinaryItem+20 {
+		t.Fatalf("unexpected estimate %d", got)
+	}
+	if estimateRequestTokens([]byte("not json"), tokenizer.Claude) != 0 {
+		t.Fatal("non-JSON body should not be estimated")
+	}
+}
+
+func TestApplyUsageEstimate_FillsMissingUsageOfSuccessfulResponses(t *testing.T) {
+	trace := NewRequestTrace("req", "u", "k", "POST", "/v1/chat/completions")
+	trace.SetEstimatedInputTokens(50)
+	trace.SetEstimatedOutputTokens(12)
+	trace.SetResponse(200)
+	if !trace.ApplyUsageEstimate() {
+		t.Fatal("missing usage should be estimated")
+	}
+	snapshot := trace.Clone()
+	if ptrToInt(snapshot.InputTokens) != 50 || ptrToInt(snapshot.OutputTokens) != 12 || !snapshot.UsageEstimated {
+		t.Fatalf("unexpected usage input=%d output=%d estimated=%v", ptrToInt(snapshot.InputTokens), ptrToInt(snapshot.OutputTokens), snapshot.UsageEstimated)
+	}
+
+	reported := NewRequestTrace("req", "u", "k", "POST", "/v1/chat/completions")
+	reported.SetEstimatedInputTokens(50)
+	reported.SetUsage(intPtr(40), intPtr(10), nil, nil)
+	reported.SetResponse(200)
+	if reported.ApplyUsageEstimate() || reported.Clone().UsageEstimated {
+		t.Fatal("reported usage must not be replaced")
+	}
+
+	failed := NewRequestTrace("req", "u", "k", "POST", "/v1/chat/completions")
+	failed.SetEstimatedInputTokens(50)
+	failed.SetResponse(500)
+	if failed.ApplyUsageEstimate() || failed.Clone().InputTokens != nil {
+		t.Fatal("failed responses must not be estimated")
+	}
+}
+
+func TestTokenUsageMiddleware_EstimatesOutputWithoutUsage(t *testing.T) {
+	trace := NewRequestTrace("req", "u", "k", "POST", "/v1/messages")
+	body := `{"type":"message","content":[{"type":"text","text":"Hello there, friend"},{"type":"tool_use","name":"f","input":{}}]}`
+	ctx := &ResponseContext{Trace: trace, Provider: ProviderInfo{Provider: ProviderAnthropic}, StatusCode: 200}
+	if _, err := (&TokenUsageMiddleware{}).ProcessBody([]byte(body), ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 19 ASCII chars of text plus "{}" -> 21 chars at 3.5 chars/token
+	if got := trace.Clone().EstimatedOutputTokens; got != 6 {
+		t.Fatalf("expected estimated output 6, got %d", got)
+	}
+}
+
+func TestSSETokenExtractor_CompletedStreamWithoutUsageIsEstimated(t *testing.T) {
+	trace := NewRequestTrace("req", "u", "k", "POST", "/v1/chat/completions")
+	trace.SetModels("gpt-4o", "gpt-4o")
+	trace.SetEstimatedInputTokens(20)
+	chunks := `data: {"choices":[{"index":0,"delta":{"content":"Hello"}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"content":" world"}}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+	readSSE(t, ProviderInfo{Provider: ProviderOpenAIChat}, trace, chunks)
+	trace.SetResponse(200)
+
+	if !trace.ApplyUsageEstimate() {
+		t.Fatal("stream without usage chunk should be estimated")
+	}
+	if got := ptrToInt(trace.Clone().OutputTokens); got != 2 {
+		t.Fatalf("expected 2 estimated output tokens, got %d", got)
+	}
+}
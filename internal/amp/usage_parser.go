@@ -23,12 +23,17 @@ func NewUsageParser(info ProviderInfo) UsageParser {
 	switch info.Provider {
 	case ProviderAnthropic:
 		return &anthropicParser{}
-	case ProviderOpenAIChat:
+	case ProviderOpenAIChat, ProviderOpenAIEmbeddings:
+		// embeddings 的 usage 只有 prompt_tokens/total_tokens，与 Chat 结构兼容
 		return &openAIChatParser{}
 	case ProviderOpenAIResponses:
 		return &openAIResponsesParser{}
 	case ProviderGemini:
 		return &geminiParser{}
+	case ProviderOpenAIAudio:
+		return &openAIAudioParser{}
+	case ProviderOllama:
+		return &ollamaParser{}
 	default:
 		return &anthropicParser{}
 	}
@@ -70,8 +75,11 @@ func (p *anthropicParser) ConsumeSSE(eventName string, data []byte) (*TokenUsage
 			p.cur.CacheCreationInputTokens = u.CacheCreationInputTokens
 			log.Debugf("usage parser [anthropic]: message_start - input=%v, cache_read=%v, cache_creation=%v",
 				ptrToInt(u.InputTokens), ptrToInt(u.CacheReadInputTokens), ptrToInt(u.CacheCreationInputTokens))
+			// 先返回输入部分（不含 output_tokens 占位值），客户端中途断开时按已知的输入用量结算；
+			// 最终值以 message_delta 为准
+			usage := p.cur
+			return &usage, false, true
 		}
-		// 不在 message_start 时返回 usage，等待 message_delta 获取最终值
 		return nil, false, false
 	case "message_delta":
 		if ev.Usage != nil {
@@ -288,3 +296,88 @@ func (p *geminiParser) ParseResponse(body []byte) (*TokenUsage, bool) {
 	}
 	return usage, true
 }
+
+// ========== Ollama Parser ==========
+
+// ollamaParser 解析 Ollama /api/chat、/api/generate 的用量：只有 done=true 的最后一个分块
+// 携带 prompt_eval_count 与 eval_count（流式响应的 NDJSON 行已转换为 SSE data 事件）
+type ollamaParser struct{}
+
+type ollamaUsage struct {
+	Done            bool `json:"done"`
+	PromptEvalCount *int `json:"prompt_eval_count,omitempty"`
+	EvalCount       *int `json:"eval_count,omitempty"`
+}
+
+func (p *ollamaParser) ConsumeSSE(eventName string, data []byte) (*TokenUsage, bool, bool) {
+	return p.parse(data)
+}
+
+func (p *ollamaParser) ParseResponse(body []byte) (*TokenUsage, bool) {
+	usage, _, ok := p.parse(body)
+	return usage, ok
+}
+
+func (p *ollamaParser) parse(data []byte) (*TokenUsage, bool, bool) {
+	var chunk ollamaUsage
+	if err := json.Unmarshal(data, &chunk); err != nil || !chunk.Done {
+		return nil, false, false
+	}
+	if chunk.PromptEvalCount == nil && chunk.EvalCount == nil {
+		return nil, false, false
+	}
+	log.Debugf("usage parser [ollama]: done - input=%v, output=%v", ptrToInt(chunk.PromptEvalCount), ptrToInt(chunk.EvalCount))
+	return &TokenUsage{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}, true, true
+}
+
+// ========== OpenAI Audio Parser ==========
+
+// openAIAudioParser 解析 /v1/audio/* 的 token 用量。gpt-4o 系列转写/语音模型返回
+// usage.type=tokens；whisper 返回 usage.type=duration，按秒计费（见 audioDurationSeconds）
+type openAIAudioParser struct{}
+
+type openAIAudioUsage struct {
+	Type         string `json:"type"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+}
+
+func (u *openAIAudioUsage) tokenUsage() (*TokenUsage, bool) {
+	if u == nil || (u.Type != "" && u.Type != "tokens") {
+		return nil, false
+	}
+	return &TokenUsage{
+		InputTokens:  intPtr(u.InputTokens),
+		OutputTokens: intPtr(u.OutputTokens),
+	}, true
+}
+
+func (p *openAIAudioParser) ConsumeSSE(eventName string, data []byte) (*TokenUsage, bool, bool) {
+	var ev struct {
+		Type  string            `json:"type"`
+		Usage *openAIAudioUsage `json:"usage,omitempty"`
+	}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return nil, false, false
+	}
+	// transcript.text.done / speech.audio.done 携带最终用量
+	if ev.Type != "transcript.text.done" && ev.Type != "speech.audio.done" {
+		return nil, false, false
+	}
+	usage, ok := ev.Usage.tokenUsage()
+	if !ok {
+		return nil, false, false
+	}
+	log.Debugf("usage parser [openai_audio]: %s - input=%d, output=%d", ev.Type, ev.Usage.InputTokens, ev.Usage.OutputTokens)
+	return usage, true, true
+}
+
+func (p *openAIAudioParser) ParseResponse(body []byte) (*TokenUsage, bool) {
+	var resp struct {
+		Usage *openAIAudioUsage `json:"usage,omitempty"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, false
+	}
+	return resp.Usage.tokenUsage()
+}
@@ -0,0 +1,380 @@
+// Package autotls 通过 ACME 协议（默认 Let's Encrypt）为直接暴露在公网的部署自动申请与续期 TLS 证书。
+//
+// 证书与 ACME 账户密钥保存在缓存目录（默认数据目录下的 acme/），重启后直接复用；
+// 同时支持 TLS-ALPN-01（HTTPS 端口）与 HTTP-01（HTTP 端口）质询。
+package autotls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// checkInterval 定期检查证书的间隔；autocert 在到期前 30 天自动续期，定期检查确保每个域名都已加载并启动续期
+	checkInterval = 12 * time.Hour
+	// checkTimeout 单个域名申请证书的超时
+	checkTimeout = 5 * time.Minute
+)
+
+// Options ACME 配置
+type Options struct {
+	Enabled bool
+	Domains []string
+	Email   string
+	// CacheDir 证书与账户密钥的持久化目录
+	CacheDir string
+	// DirectoryURL ACME 服务地址，为空时使用 Let's Encrypt 生产环境
+	DirectoryURL string
+	// HTTPPort HTTP-01 质询与 HTTPS 跳转端口
+	HTTPPort string
+	// TLSPort HTTPS 与 TLS-ALPN-01 质询端口
+	TLSPort string
+}
+
+// CertStatus 单个域名的证书状态
+type CertStatus struct {
+	Domain        string     `json:"domain"`
+	KeyType       string     `json:"keyType,omitempty"`
+	Issuer        string     `json:"issuer,omitempty"`
+	NotBefore     *time.Time `json:"notBefore,omitempty"`
+	NotAfter      *time.Time `json:"notAfter,omitempty"`
+	DaysRemaining *int       `json:"daysRemaining,omitempty"`
+	LastCheckAt   *time.Time `json:"lastCheckAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
+
+// Status ACME 整体状态
+type Status struct {
+	Enabled      bool         `json:"enabled"`
+	Domains      []string     `json:"domains"`
+	Email        string       `json:"email,omitempty"`
+	CacheDir     string       `json:"cacheDir,omitempty"`
+	DirectoryURL string       `json:"directoryUrl,omitempty"`
+	HTTPPort     string       `json:"httpPort,omitempty"`
+	TLSPort      string       `json:"tlsPort,omitempty"`
+	Certificates []CertStatus `json:"certificates"`
+}
+
+type checkResult struct {
+	at  time.Time
+	err string
+}
+
+var state struct {
+	mu      sync.RWMutex
+	opts    Options
+	manager *autocert.Manager
+	checks  map[string]checkResult
+}
+
+var (
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+)
+
+// NormalizeDomains 去除空白、末尾的点并转为小写，去重后排序
+func NormalizeDomains(domains []string) []string {
+	seen := make(map[string]bool, len(domains))
+	result := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d), "."))
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		result = append(result, d)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Validate 校验 ACME 配置（需先 NormalizeDomains）
+func Validate(opts Options) error {
+	if !opts.Enabled {
+		return nil
+	}
+	if len(opts.Domains) == 0 {
+		return errors.New("ACME_DOMAINS 不能为空")
+	}
+	for _, d := range opts.Domains {
+		if !strings.Contains(d, ".") || strings.ContainsAny(d, "*/: ") {
+			return fmt.Errorf("域名 %s 无效（不支持通配符与端口）", d)
+		}
+	}
+	if opts.CacheDir == "" {
+		return errors.New("ACME_CACHE_DIR 不能为空")
+	}
+	if opts.TLSPort == "" || opts.HTTPPort == "" {
+		return errors.New("ACME_TLS_PORT 与 ACME_HTTP_PORT 不能为空")
+	}
+	return nil
+}
+
+// Configure 按配置创建证书管理器，未启用时只记录配置
+func Configure(opts Options) error {
+	opts.Domains = NormalizeDomains(opts.Domains)
+	if err := Validate(opts); err != nil {
+		return err
+	}
+
+	var manager *autocert.Manager
+	if opts.Enabled {
+		manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(opts.CacheDir),
+			HostPolicy: autocert.HostWhitelist(opts.Domains...),
+			Email:      opts.Email,
+		}
+		if opts.DirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: opts.DirectoryURL}
+		}
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.opts = opts
+	state.manager = manager
+	state.checks = make(map[string]checkResult)
+	return nil
+}
+
+// Enabled 是否已启用 ACME
+func Enabled() bool {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return state.manager != nil
+}
+
+// Listen 监听 HTTPS 端口，返回使用 ACME 证书的 TLS listener（含 TLS-ALPN-01 质询）
+func Listen() (net.Listener, error) {
+	state.mu.RLock()
+	manager, opts := state.manager, state.opts
+	state.mu.RUnlock()
+	if manager == nil {
+		return nil, errors.New("ACME 未启用")
+	}
+	ln, err := net.Listen("tcp", "0.0.0.0:"+opts.TLSPort)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(ln, manager.TLSConfig()), nil
+}
+
+// ServeHTTP 在 HTTP 端口处理 HTTP-01 质询，其余请求跳转到 HTTPS；阻塞直到监听失败
+func ServeHTTP() error {
+	state.mu.RLock()
+	manager, opts := state.manager, state.opts
+	state.mu.RUnlock()
+	if manager == nil {
+		return errors.New("ACME 未启用")
+	}
+	server := &http.Server{
+		Addr:              "0.0.0.0:" + opts.HTTPPort,
+		Handler:           manager.HTTPHandler(redirectHandler(opts.TLSPort)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+// redirectHandler 非质询请求跳转到 HTTPS 端口，仅处理 GET/HEAD
+func redirectHandler(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Use HTTPS", http.StatusBadRequest)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+	})
+}
+
+// InitRenewal 启动证书检查任务：启动时立即为每个域名申请或加载证书，之后定期检查
+func InitRenewal() {
+	if !Enabled() {
+		return
+	}
+	stopChan = make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		// 等待 HTTP/HTTPS 监听就绪后再申请，确保质询可被访问
+		select {
+		case <-time.After(3 * time.Second):
+			CheckAll()
+		case <-stopChan:
+			return
+		}
+		for {
+			select {
+			case <-ticker.C:
+				CheckAll()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+	log.Info("autotls: 证书检查任务已启动")
+}
+
+// StopRenewal 停止证书检查任务
+func StopRenewal() {
+	if stopChan == nil {
+		return
+	}
+	stopOnce.Do(func() {
+		close(stopChan)
+	})
+	wg.Wait()
+}
+
+// CheckAll 依次为每个域名加载证书，缺失或即将到期时向 ACME 服务申请
+func CheckAll() {
+	state.mu.RLock()
+	manager, domains := state.manager, state.opts.Domains
+	state.mu.RUnlock()
+	if manager == nil {
+		return
+	}
+
+	for _, domain := range domains {
+		err := checkDomain(manager, domain)
+		result := checkResult{at: time.Now()}
+		if err != nil {
+			result.err = err.Error()
+			log.Warnf("autotls: 域名 %s 证书获取失败: %v", domain, err)
+		}
+		state.mu.Lock()
+		if state.manager == manager {
+			state.checks[domain] = result
+		}
+		state.mu.Unlock()
+	}
+}
+
+func checkDomain(manager *autocert.Manager, domain string) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.GetCertificate(ecdsaHello(domain))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(checkTimeout):
+		return errors.New("申请证书超时")
+	}
+}
+
+// ecdsaHello 模拟支持 ECDSA 的客户端握手，使 autocert 加载或申请与浏览器一致的 ECDSA 证书
+func ecdsaHello(domain string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		ServerName:       domain,
+		CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:  []tls.CurveID{tls.CurveP256},
+		SupportedPoints:  []uint8{0},
+	}
+}
+
+// CurrentStatus 返回 ACME 配置与各域名证书状态，证书信息读取自缓存目录
+func CurrentStatus() Status {
+	state.mu.RLock()
+	opts := state.opts
+	checks := make(map[string]checkResult, len(state.checks))
+	for k, v := range state.checks {
+		checks[k] = v
+	}
+	state.mu.RUnlock()
+
+	status := Status{
+		Enabled:      opts.Enabled,
+		Domains:      append([]string{}, opts.Domains...),
+		Email:        opts.Email,
+		CacheDir:     opts.CacheDir,
+		DirectoryURL: opts.DirectoryURL,
+		HTTPPort:     opts.HTTPPort,
+		TLSPort:      opts.TLSPort,
+		Certificates: []CertStatus{},
+	}
+	if !opts.Enabled {
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	now := time.Now()
+	for _, domain := range opts.Domains {
+		cert := readCertStatus(ctx, autocert.DirCache(opts.CacheDir), domain, now)
+		if check, ok := checks[domain]; ok {
+			at := check.at
+			cert.LastCheckAt = &at
+			cert.LastError = check.err
+		}
+		status.Certificates = append(status.Certificates, cert)
+	}
+	return status
+}
+
+// readCertStatus 读取缓存中的证书，优先 ECDSA，其次 RSA
+func readCertStatus(ctx context.Context, cache autocert.Cache, domain string, now time.Time) CertStatus {
+	status := CertStatus{Domain: domain}
+	for _, candidate := range []struct{ key, keyType string }{{domain, "ecdsa"}, {domain + "+rsa", "rsa"}} {
+		data, err := cache.Get(ctx, candidate.key)
+		if err != nil {
+			continue
+		}
+		leaf, err := parseLeaf(data)
+		if err != nil {
+			status.LastError = err.Error()
+			continue
+		}
+		notBefore, notAfter := leaf.NotBefore, leaf.NotAfter
+		days := int(notAfter.Sub(now).Hours() / 24)
+		status.KeyType = candidate.keyType
+		status.Issuer = leaf.Issuer.CommonName
+		status.NotBefore = &notBefore
+		status.NotAfter = &notAfter
+		status.DaysRemaining = &days
+		status.LastError = ""
+		break
+	}
+	return status
+}
+
+// parseLeaf 从 autocert 缓存内容（私钥 + 证书链 PEM）中取出叶子证书
+func parseLeaf(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("缓存中没有证书")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
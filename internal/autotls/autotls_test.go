@@ -0,0 +1,119 @@
+package autotls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// cachedCert 生成与 autocert 缓存格式一致的内容：私钥 PEM 后接证书 PEM
+func cachedCert(t *testing.T, domain string, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		Issuer:       pkix.Name{CommonName: "Test CA"},
+		DNSNames:     []string{domain},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+}
+
+func TestReadCertStatus(t *testing.T) {
+	ctx := context.Background()
+	cache := autocert.DirCache(t.TempDir())
+	now := time.Now()
+	if err := cache.Put(ctx, "amp.example.com", cachedCert(t, "amp.example.com", now.Add(40*24*time.Hour+time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put(ctx, "rsa.example.com+rsa", cachedCert(t, "rsa.example.com", now.Add(5*24*time.Hour+time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	status := readCertStatus(ctx, cache, "amp.example.com", now)
+	if status.KeyType != "ecdsa" || status.DaysRemaining == nil || *status.DaysRemaining != 40 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if status.NotAfter == nil || status.LastError != "" {
+		t.Fatalf("expiry should be read from cache: %+v", status)
+	}
+
+	if status := readCertStatus(ctx, cache, "rsa.example.com", now); status.KeyType != "rsa" || *status.DaysRemaining != 5 {
+		t.Fatalf("rsa certificate should be used as fallback: %+v", status)
+	}
+	if status := readCertStatus(ctx, cache, "missing.example.com", now); status.NotAfter != nil {
+		t.Fatalf("missing certificate should have no expiry: %+v", status)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Options{Enabled: true, Domains: NormalizeDomains([]string{" AMP.example.com. ", "amp.example.com"}), CacheDir: "/data/acme", HTTPPort: "80", TLSPort: "443"}
+	if len(valid.Domains) != 1 || valid.Domains[0] != "amp.example.com" {
+		t.Fatalf("unexpected normalized domains: %v", valid.Domains)
+	}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("valid options rejected: %v", err)
+	}
+	if err := Validate(Options{}); err != nil {
+		t.Fatalf("disabled options should not be validated: %v", err)
+	}
+
+	invalid := []Options{
+		{Enabled: true, CacheDir: "/data/acme", HTTPPort: "80", TLSPort: "443"},
+		{Enabled: true, Domains: []string{"*.example.com"}, CacheDir: "/data/acme", HTTPPort: "80", TLSPort: "443"},
+		{Enabled: true, Domains: []string{"localhost"}, CacheDir: "/data/acme", HTTPPort: "80", TLSPort: "443"},
+		{Enabled: true, Domains: []string{"amp.example.com"}, HTTPPort: "80", TLSPort: "443"},
+	}
+	for i, opts := range invalid {
+		if err := Validate(opts); err == nil {
+			t.Errorf("options %d should be rejected", i)
+		}
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	cases := []struct {
+		port, want string
+	}{
+		{"443", "https://amp.example.com/v1/models?x=1"},
+		{"8443", "https://amp.example.com:8443/v1/models?x=1"},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		redirectHandler(tc.port).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://amp.example.com:80/v1/models?x=1", nil))
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != tc.want {
+			t.Errorf("port %s: got %d %q", tc.port, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	redirectHandler("443").ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "http://amp.example.com/v1/messages", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("non-GET requests should not be redirected, got %d", rec.Code)
+	}
+}
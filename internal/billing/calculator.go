@@ -31,6 +31,15 @@ func NewCostCalculator(store *PriceStore) *CostCalculator {
 // pricingModel: 计价模型名（可以是 originalModel 或 mappedModel）
 // usage: token 使用量
 func (c *CostCalculator) Calculate(pricingModel string, usage TokenUsage) CostResult {
+	return c.calculate(pricingModel, usage, false)
+}
+
+// CalculateBatch 按批处理（Message Batches / Gemini batch）价格计算单个批处理条目的成本
+func (c *CostCalculator) CalculateBatch(pricingModel string, usage TokenUsage) CostResult {
+	return c.calculate(pricingModel, usage, true)
+}
+
+func (c *CostCalculator) calculate(pricingModel string, usage TokenUsage, batch bool) CostResult {
 	result := CostResult{
 		PricingModel: pricingModel,
 	}
@@ -40,17 +49,16 @@ func (c *CostCalculator) Calculate(pricingModel string, usage TokenUsage) CostRe
 	}
 
 	// 查找价格
-	priceData, found := c.store.GetPrice(pricingModel)
+	priceData, found := c.LookupPrice(pricingModel)
 	if !found {
-		// 尝试模糊匹配（移除版本后缀）
-		priceData, found = c.tryFuzzyMatch(pricingModel)
-		if !found {
-			log.Debugf("billing: price not found for model %s", pricingModel)
-			return result
-		}
+		log.Debugf("billing: price not found for model %s", pricingModel)
+		return result
 	}
 
 	result.PriceFound = true
+	if batch {
+		priceData = priceData.BatchPrices()
+	}
 
 	// 防御性处理：负数 token 归零
 	inputTokens := usage.InputTokens
@@ -70,25 +78,52 @@ func (c *CostCalculator) Calculate(pricingModel string, usage TokenUsage) CostRe
 		cacheCreationTokens = 0
 	}
 
+	// 音频 token 已计入输入/输出 token，有音频单价时从文本部分中扣除后单独计费
+	var audioTokenMicros int64
+	if inputAudio := min(max(usage.InputAudioTokens, 0), inputTokens); inputAudio > 0 && priceData.InputCostPerAudioToken > 0 {
+		inputTokens -= inputAudio
+		audioTokenMicros += int64(math.Round(float64(inputAudio) * priceData.InputCostPerAudioToken * 1e6))
+	}
+	if outputAudio := min(max(usage.OutputAudioTokens, 0), outputTokens); outputAudio > 0 && priceData.OutputCostPerAudioToken > 0 {
+		outputTokens -= outputAudio
+		audioTokenMicros += int64(math.Round(float64(outputAudio) * priceData.OutputCostPerAudioToken * 1e6))
+	}
+
 	// 使用微美元整数累计，避免浮点误差
 	inputMicros := int64(math.Round(float64(inputTokens) * priceData.InputCostPerToken * 1e6))
 	outputMicros := int64(math.Round(float64(outputTokens) * priceData.OutputCostPerToken * 1e6))
 	cacheReadMicros := int64(math.Round(float64(cacheReadTokens) * priceData.CacheReadInputPerToken * 1e6))
 	cacheCreateMicros := int64(math.Round(float64(cacheCreationTokens) * priceData.CacheCreationPerToken * 1e6))
+	audioMicros := int64(math.Round(math.Max(usage.AudioSeconds, 0)*priceData.InputCostPerSecond*1e6 +
+		float64(max(usage.InputCharacters, 0))*priceData.InputCostPerCharacter*1e6))
 
-	totalMicros := inputMicros + outputMicros + cacheReadMicros + cacheCreateMicros
+	totalMicros := inputMicros + outputMicros + cacheReadMicros + cacheCreateMicros + audioMicros + audioTokenMicros
 	result.CostMicros = totalMicros
 
 	// 从 CostMicros 反推 CostUsd（保留 6 位小数）
 	result.CostUsd = fmt.Sprintf("%.6f", float64(totalMicros)/1e6)
 
-	log.Debugf("billing: calculated cost for %s - input=%d, output=%d, cache_read=%d, cache_creation=%d -> $%s",
-		pricingModel, inputTokens, outputTokens,
-		cacheReadTokens, cacheCreationTokens, result.CostUsd)
+	log.Debugf("billing: calculated cost for %s (batch=%v) - input=%d, output=%d, cache_read=%d, cache_creation=%d, audio_seconds=%.1f, characters=%d -> $%s",
+		pricingModel, batch, inputTokens, outputTokens,
+		cacheReadTokens, cacheCreationTokens, usage.AudioSeconds, usage.InputCharacters, result.CostUsd)
 
 	return result
 }
 
+// HasPrice 判断模型能否匹配到价格（含模糊匹配），与 Calculate 的查找规则一致
+func (c *CostCalculator) HasPrice(model string) bool {
+	_, found := c.LookupPrice(model)
+	return found
+}
+
+// LookupPrice 返回模型的单价：先精确匹配，再尝试模糊匹配（移除版本后缀）
+func (c *CostCalculator) LookupPrice(model string) (PriceData, bool) {
+	if priceData, found := c.store.GetPrice(model); found {
+		return priceData, true
+	}
+	return c.tryFuzzyMatch(model)
+}
+
 // tryFuzzyMatch 尝试模糊匹配模型名
 func (c *CostCalculator) tryFuzzyMatch(model string) (PriceData, bool) {
 	// 常见的模型名变体匹配规则
@@ -0,0 +1,99 @@
+package billing
+
+import "testing"
+
+func TestCalculateAudioUsage(t *testing.T) {
+	store := &PriceStore{prices: map[string]ModelPrice{
+		"whisper-1": {Model: "whisper-1", PriceData: PriceData{InputCostPerSecond: 0.0001}},
+		"tts-1":     {Model: "tts-1", PriceData: PriceData{InputCostPerCharacter: 0.000015}},
+	}}
+	calc := NewCostCalculator(store)
+
+	if got := calc.Calculate("whisper-1", TokenUsage{AudioSeconds: 90}); got.CostMicros != 9000 {
+		t.Errorf("whisper-1 cost = %d micros, want 9000", got.CostMicros)
+	}
+	if got := calc.Calculate("tts-1", TokenUsage{InputCharacters: 1000}); got.CostMicros != 15000 {
+		t.Errorf("tts-1 cost = %d micros, want 15000", got.CostMicros)
+	}
+	if got := calc.Calculate("tts-1", TokenUsage{InputTokens: 1000}); !got.PriceFound || got.CostMicros != 0 {
+		t.Errorf("expected token usage not to be billed by character price, got %+v", got)
+	}
+}
+
+func TestCalculateAudioTokens(t *testing.T) {
+	store := &PriceStore{prices: map[string]ModelPrice{
+		"gpt-realtime": {Model: "gpt-realtime", PriceData: PriceData{
+			InputCostPerToken:       0.000004,
+			OutputCostPerToken:      0.000016,
+			InputCostPerAudioToken:  0.000032,
+			OutputCostPerAudioToken: 0.000064,
+		}},
+		"gpt-4o": {Model: "gpt-4o", PriceData: PriceData{InputCostPerToken: 0.0000025, OutputCostPerToken: 0.00001}},
+	}}
+	calc := NewCostCalculator(store)
+
+	// 文本 600 × 4 + 音频 400 × 32 + 文本 50 × 16 + 音频 150 × 64
+	usage := TokenUsage{InputTokens: 1000, OutputTokens: 200, InputAudioTokens: 400, OutputAudioTokens: 150}
+	if got := calc.Calculate("gpt-realtime", usage); got.CostMicros != 2400+12800+800+9600 {
+		t.Errorf("gpt-realtime cost = %d micros, want %d", got.CostMicros, 2400+12800+800+9600)
+	}
+	// 没有音频单价时音频 token 按文本单价计费
+	if got := calc.Calculate("gpt-4o", usage); got.CostMicros != 2500+2000 {
+		t.Errorf("gpt-4o cost = %d micros, want 4500", got.CostMicros)
+	}
+}
+
+func TestCalculateBatch(t *testing.T) {
+	store := &PriceStore{prices: map[string]ModelPrice{
+		"claude-sonnet-4": {Model: "claude-sonnet-4", PriceData: PriceData{
+			InputCostPerToken:      0.000003,
+			OutputCostPerToken:     0.000015,
+			CacheReadInputPerToken: 0.0000003,
+		}},
+		"gemini-2.5-pro": {Model: "gemini-2.5-pro", PriceData: PriceData{
+			InputCostPerToken:         0.00000125,
+			OutputCostPerToken:        0.00001,
+			CacheReadInputPerToken:    0.0000005,
+			InputCostPerTokenBatches:  0.000000625,
+			OutputCostPerTokenBatches: 0.000004,
+		}},
+	}}
+	calc := NewCostCalculator(store)
+	usage := TokenUsage{InputTokens: 1000, OutputTokens: 1000, CacheReadInputTokens: 1000}
+
+	// 没有批处理单价时按常规价格的一半计费
+	if got := calc.CalculateBatch("claude-sonnet-4", usage); got.CostMicros != 1500+7500+150 {
+		t.Errorf("claude batch cost = %d micros, want %d", got.CostMicros, 1500+7500+150)
+	}
+	// 使用价格表中的批处理单价，缓存单价按输入单价的比例折算
+	if got := calc.CalculateBatch("gemini-2.5-pro", usage); got.CostMicros != 625+4000+250 {
+		t.Errorf("gemini batch cost = %d micros, want %d", got.CostMicros, 625+4000+250)
+	}
+	if got := calc.Calculate("gemini-2.5-pro", usage); got.CostMicros != 1250+10000+500 {
+		t.Errorf("regular cost = %d micros, want %d", got.CostMicros, 1250+10000+500)
+	}
+}
+
+func TestLookupPriceAndRateMultiplier(t *testing.T) {
+	store := &PriceStore{prices: map[string]ModelPrice{
+		"claude-3-5-sonnet-20241022": {Model: "claude-3-5-sonnet-20241022", PriceData: PriceData{InputCostPerToken: 0.000003, OutputCostPerToken: 0.000015}},
+	}}
+	calc := NewCostCalculator(store)
+
+	// 模糊匹配与 Calculate 的查找规则一致
+	price, found := calc.LookupPrice("claude-3-5-sonnet-latest")
+	if !found || price.OutputCostPerToken != 0.000015 {
+		t.Fatalf("lookup latest = %+v, %v", price, found)
+	}
+	if _, found := calc.LookupPrice("unknown-model"); found {
+		t.Error("unknown model should not have a price")
+	}
+
+	cost := calc.Calculate("claude-3-5-sonnet-latest", TokenUsage{InputTokens: 1000, OutputTokens: 1000})
+	if got := ApplyRateMultiplier(cost.CostMicros, 0.8); got != 14400 {
+		t.Errorf("multiplied cost = %d, want 14400", got)
+	}
+	if got := ApplyRateMultiplier(cost.CostMicros, 0); got != cost.CostMicros {
+		t.Errorf("zero multiplier cost = %d, want %d", got, cost.CostMicros)
+	}
+}
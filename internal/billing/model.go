@@ -14,22 +14,68 @@ type ModelPrice struct {
 }
 
 // PriceData 价格数据（遵循 LiteLLM 格式）
-// 单位: USD per token
+// 单位: USD per token（音频价格为 USD per second / per character）
 type PriceData struct {
 	InputCostPerToken        float64 `json:"input_cost_per_token"`
 	OutputCostPerToken       float64 `json:"output_cost_per_token"`
 	CacheReadInputPerToken   float64 `json:"cache_read_input_token_cost,omitempty"`
 	CacheCreationPerToken    float64 `json:"cache_creation_input_token_cost,omitempty"`
+	// 音频接口：转写按音频秒数计费，语音合成按输入字符数计费
+	InputCostPerSecond       float64 `json:"input_cost_per_second,omitempty"`
+	InputCostPerCharacter    float64 `json:"input_cost_per_character,omitempty"`
+	// Realtime 等语音模型的音频 token 单价，未设置时音频 token 按文本单价计费
+	InputCostPerAudioToken   float64 `json:"input_cost_per_audio_token,omitempty"`
+	OutputCostPerAudioToken  float64 `json:"output_cost_per_audio_token,omitempty"`
+	// 批处理接口单价，未设置时按常规单价的 DefaultBatchDiscount 计费
+	InputCostPerTokenBatches  float64 `json:"input_cost_per_token_batches,omitempty"`
+	OutputCostPerTokenBatches float64 `json:"output_cost_per_token_batches,omitempty"`
 	// 可选：1M 上下文溢价（暂不实现）
 	// Above1MInputCostPerToken float64 `json:"above_1m_input_cost_per_token,omitempty"`
 }
 
+// DefaultBatchDiscount 价格表没有批处理单价时的折扣（Anthropic、Gemini、OpenAI 的批处理均为常规价格的 50%）
+const DefaultBatchDiscount = 0.5
+
+// BatchPrices 返回批处理计费使用的价格：输入/输出使用批处理单价，
+// 缓存单价按输入单价的折扣比例折算，音频单价保持不变
+func (p PriceData) BatchPrices() PriceData {
+	inputRatio := DefaultBatchDiscount
+	if p.InputCostPerTokenBatches > 0 {
+		if p.InputCostPerToken > 0 {
+			inputRatio = p.InputCostPerTokenBatches / p.InputCostPerToken
+		}
+		p.InputCostPerToken = p.InputCostPerTokenBatches
+	} else {
+		p.InputCostPerToken *= DefaultBatchDiscount
+	}
+	if p.OutputCostPerTokenBatches > 0 {
+		p.OutputCostPerToken = p.OutputCostPerTokenBatches
+	} else {
+		p.OutputCostPerToken *= DefaultBatchDiscount
+	}
+	p.CacheReadInputPerToken *= inputRatio
+	p.CacheCreationPerToken *= inputRatio
+	return p
+}
+
+// ApplyRateMultiplier 按分组倍率调整费用（微美元），倍率为 0 时按原价
+func ApplyRateMultiplier(costMicros int64, multiplier float64) int64 {
+	if multiplier == 0 {
+		return costMicros
+	}
+	return int64(float64(costMicros) * multiplier)
+}
+
 // TokenUsage 统一的 token 使用量结构
 type TokenUsage struct {
 	InputTokens              int
 	OutputTokens             int
 	CacheReadInputTokens     int
 	CacheCreationInputTokens int
+	AudioSeconds             float64 // 转写音频时长（秒）
+	InputCharacters          int     // 语音合成输入字符数
+	InputAudioTokens         int     // InputTokens 中的音频 token 数
+	OutputAudioTokens        int     // OutputTokens 中的音频 token 数
 }
 
 // CostResult 成本计算结果
@@ -58,6 +58,12 @@ type LiteLLMPricing struct {
 
 	CacheReadInputTokenCost     *float64 `json:"cache_read_input_token_cost,omitempty"`
 	CacheCreationInputTokenCost *float64 `json:"cache_creation_input_token_cost,omitempty"`
+	InputCostPerSecond          *float64 `json:"input_cost_per_second,omitempty"`
+	InputCostPerCharacter       *float64 `json:"input_cost_per_character,omitempty"`
+	InputCostPerAudioToken      *float64 `json:"input_cost_per_audio_token,omitempty"`
+	OutputCostPerAudioToken     *float64 `json:"output_cost_per_audio_token,omitempty"`
+	InputCostPerTokenBatches    *float64 `json:"input_cost_per_token_batches,omitempty"`
+	OutputCostPerTokenBatches   *float64 `json:"output_cost_per_token_batches,omitempty"`
 	SupportsPromptCaching       *bool    `json:"supports_prompt_caching,omitempty"`
 
 	MaxInputTokens  *wholeNumber `json:"max_input_tokens,omitempty"`
@@ -203,8 +209,9 @@ func (s *PriceStore) FetchFromLiteLLM(ctx context.Context) error {
 			continue
 		}
 
-		// 只处理有价格的条目
-		if lp.InputCostPerToken == nil && lp.OutputCostPerToken == nil {
+		// 只处理有价格的条目（音频模型可能只有按秒或按字符的价格）
+		if lp.InputCostPerToken == nil && lp.OutputCostPerToken == nil &&
+			lp.InputCostPerSecond == nil && lp.InputCostPerCharacter == nil {
 			continue
 		}
 
@@ -214,10 +221,16 @@ func (s *PriceStore) FetchFromLiteLLM(ctx context.Context) error {
 			Provider: lp.LiteLLMProvider,
 			Source:   "litellm",
 			PriceData: PriceData{
-				InputCostPerToken:      ptrFloat64(lp.InputCostPerToken),
-				OutputCostPerToken:     ptrFloat64(lp.OutputCostPerToken),
-				CacheReadInputPerToken: ptrFloat64(lp.CacheReadInputTokenCost),
-				CacheCreationPerToken:  ptrFloat64(lp.CacheCreationInputTokenCost),
+				InputCostPerToken:         ptrFloat64(lp.InputCostPerToken),
+				OutputCostPerToken:        ptrFloat64(lp.OutputCostPerToken),
+				CacheReadInputPerToken:    ptrFloat64(lp.CacheReadInputTokenCost),
+				CacheCreationPerToken:     ptrFloat64(lp.CacheCreationInputTokenCost),
+				InputCostPerSecond:        ptrFloat64(lp.InputCostPerSecond),
+				InputCostPerCharacter:     ptrFloat64(lp.InputCostPerCharacter),
+				InputCostPerAudioToken:    ptrFloat64(lp.InputCostPerAudioToken),
+				OutputCostPerAudioToken:   ptrFloat64(lp.OutputCostPerAudioToken),
+				InputCostPerTokenBatches:  ptrFloat64(lp.InputCostPerTokenBatches),
+				OutputCostPerTokenBatches: ptrFloat64(lp.OutputCostPerTokenBatches),
 			},
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
@@ -2,10 +2,13 @@ package config
 
 import (
 	"ampmanager/internal/database"
+	"ampmanager/internal/secrets"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -18,16 +21,75 @@ type Config struct {
 	DBType        string
 	DatabaseURL   string
 	SQLitePath    string
+	// 分析查询（用量统计、仪表盘）使用的只读连接：PostgreSQL 副本地址与连接池大小
+	DatabaseReadURL      string
+	DatabaseReadPoolSize int
 
-	// CORS 配置
-	CORSAllowedOrigins string
+	// CORS 与嵌入配置（可被系统配置中的 HTTP 策略覆盖）
+	CORSAllowedOrigins   string
+	CORSAllowCredentials bool
+	FrameAncestors       string
 
 	// 速率限制配置
 	RateLimitAuthRPS  float64
 	RateLimitProxyRPS float64
+	// 管理 API 按会话/IP 限流（令牌/秒与突发容量，RPS 为 0 时关闭）
+	RateLimitAdminRPS   float64
+	RateLimitAdminBurst int
+
+	// count_tokens / countTokens 响应缓存（TTL 为 0 时关闭）
+	TokenCountCacheTTL  time.Duration
+	TokenCountCacheSize int
+
+	// tiktoken 词表目录（cl100k_base.tiktoken / o200k_base.tiktoken），上游缺少用量时用于估算 OpenAI 模型的 token
+	TokenizerDir string
 
 	// 数据加密密钥 (32 bytes for AES-256)
 	DataEncryptionKey string
+
+	// 泄露密码库文件：每行一个明文密码或 SHA-1 哈希（兼容 HIBP 的 HASH:COUNT 格式），密码策略开启 breachCheck 时使用
+	PasswordBreachList string
+
+	// 演示模式：写入合成数据并禁止破坏性操作
+	DemoMode bool
+
+	// 前端静态文件外部目录（开发用），为空时使用编译时内嵌的资源
+	WebDistDir string
+
+	// 外部密钥存储：密钥类配置与渠道 API Key 可写为 file:// / vault:// / aws-sm:// 引用
+	SecretRefreshInterval time.Duration
+	VaultAddr             string
+	VaultToken            string
+	VaultNamespace        string
+	AWSRegion             string
+
+	// ACME 自动证书：直接暴露在公网时由服务自身申请并续期 TLS 证书
+	ACMEEnabled      bool
+	ACMEDomains      []string
+	ACMEEmail        string
+	ACMECacheDir     string
+	ACMEDirectoryURL string
+	ACMEHTTPPort     string
+	ACMETLSPort      string
+
+	// OpenTelemetry 追踪：OTLP/HTTP 导出地址为空时关闭
+	OTLPEndpoint    string
+	OTLPHeaders     string
+	OTelServiceName string
+	OTelSampleRatio float64
+
+	// SMTP 发信：用于邮箱验证、找回密码与凭据变更通知，SMTPHost 为空时关闭邮件功能
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTLS      string
+	// PublicURL 邮件中链接使用的对外访问地址，为空时不发送验证与找回密码邮件
+	PublicURL string
+
+	// secretRefs 记录以引用形式配置的项（环境变量名 -> 引用），用于读取轮换后的值
+	secretRefs map[string]string
 }
 
 var cfg *Config
@@ -37,7 +99,12 @@ var insecureDefaults = map[string]string{
 	"JWT_SECRET":     "amp-manager-default-secret-change-in-production",
 }
 
-func Load() *Config {
+// Load 读取配置，优先级：环境变量（含 .env）> 配置文件 > 默认值；配置文件校验失败时返回错误
+func Load() (*Config, error) {
+	if err := loadConfigFile(); err != nil {
+		return nil, err
+	}
+
 	runtimeOptions, hasRuntimeOptions, runtimeErr := loadRuntimeDatabaseOptions()
 	if runtimeErr != nil {
 		fmt.Fprintf(os.Stderr, "warning: failed to load runtime database config: %v\n", runtimeErr)
@@ -53,25 +120,111 @@ func Load() *Config {
 	}
 
 	cfg = &Config{
-		AdminUsername:      getEnv("ADMIN_USERNAME", "admin"),
-		AdminPassword:      getEnv("ADMIN_PASSWORD", "admin123"),
-		ServerPort:         getEnv("SERVER_PORT", "16823"),
-		JWTSecret:          getEnv("JWT_SECRET", "amp-manager-default-secret-change-in-production"),
-		JWTIssuer:          getEnv("JWT_ISSUER", "ampmanager"),
-		JWTAudience:        getEnv("JWT_AUDIENCE", "ampmanager-users"),
-		DBType:             getEnv("DB_TYPE", defaultDBType),
-		DatabaseURL:        getEnv("DATABASE_URL", defaultDatabaseURL),
-		SQLitePath:         getEnv("SQLITE_PATH", defaultSQLitePath),
-		CORSAllowedOrigins: getEnv("CORS_ALLOWED_ORIGINS", "*"),
-		RateLimitAuthRPS:   getEnvFloat("RATE_LIMIT_AUTH_RPS", 5),
-		RateLimitProxyRPS:  getEnvFloat("RATE_LIMIT_PROXY_RPS", 100),
-		DataEncryptionKey:  getEnv("DATA_ENCRYPTION_KEY", ""),
+		AdminUsername:         getEnv("ADMIN_USERNAME", "admin"),
+		AdminPassword:         getEnv("ADMIN_PASSWORD", "admin123"),
+		ServerPort:            getEnv("SERVER_PORT", "16823"),
+		JWTSecret:             getEnv("JWT_SECRET", "amp-manager-default-secret-change-in-production"),
+		JWTIssuer:             getEnv("JWT_ISSUER", "ampmanager"),
+		JWTAudience:           getEnv("JWT_AUDIENCE", "ampmanager-users"),
+		DBType:                getEnv("DB_TYPE", defaultDBType),
+		DatabaseURL:           getEnv("DATABASE_URL", defaultDatabaseURL),
+		SQLitePath:            getEnv("SQLITE_PATH", defaultSQLitePath),
+		DatabaseReadURL:       getEnv("DATABASE_READ_URL", ""),
+		DatabaseReadPoolSize:  getEnvInt("DATABASE_READ_POOL_SIZE", 4),
+		CORSAllowedOrigins:    getEnv("CORS_ALLOWED_ORIGINS", "*"),
+		CORSAllowCredentials:  getEnvBool("CORS_ALLOW_CREDENTIALS", true),
+		FrameAncestors:        getEnv("FRAME_ANCESTORS", ""),
+		RateLimitAuthRPS:      getEnvFloat("RATE_LIMIT_AUTH_RPS", 5),
+		RateLimitProxyRPS:     getEnvFloat("RATE_LIMIT_PROXY_RPS", 100),
+		RateLimitAdminRPS:     getEnvFloat("RATE_LIMIT_ADMIN_RPS", 10),
+		RateLimitAdminBurst:   getEnvInt("RATE_LIMIT_ADMIN_BURST", 60),
+		TokenCountCacheTTL:    getEnvDuration("TOKEN_COUNT_CACHE_TTL", 30*time.Second),
+		TokenCountCacheSize:   getEnvInt("TOKEN_COUNT_CACHE_SIZE", 1024),
+		TokenizerDir:          getEnv("TOKENIZER_DIR", ""),
+		DataEncryptionKey:     getEnv("DATA_ENCRYPTION_KEY", ""),
+		PasswordBreachList:    getEnv("PASSWORD_BREACH_LIST", ""),
+		DemoMode:              getEnvBool("DEMO_MODE", false),
+		WebDistDir:            getEnv("WEB_DIST_DIR", ""),
+		SecretRefreshInterval: getEnvDuration("SECRET_REFRESH_INTERVAL", 5*time.Minute),
+		VaultAddr:             getEnv("VAULT_ADDR", ""),
+		VaultToken:            getEnv("VAULT_TOKEN", ""),
+		VaultNamespace:        getEnv("VAULT_NAMESPACE", ""),
+		AWSRegion:             getEnv("AWS_REGION", ""),
 	}
-	return cfg
+	cfg.ACMEEnabled = getEnvBool("ACME_ENABLED", false)
+	cfg.ACMEDomains = splitList(getEnv("ACME_DOMAINS", ""))
+	cfg.ACMEEmail = getEnv("ACME_EMAIL", "")
+	cfg.ACMECacheDir = getEnv("ACME_CACHE_DIR", filepath.Join(filepath.Dir(cfg.SQLitePath), "acme"))
+	cfg.ACMEDirectoryURL = getEnv("ACME_DIRECTORY_URL", "")
+	cfg.ACMEHTTPPort = getEnv("ACME_HTTP_PORT", "80")
+	cfg.ACMETLSPort = getEnv("ACME_TLS_PORT", "443")
+	cfg.OTLPEndpoint = getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	cfg.OTLPHeaders = getEnv("OTEL_EXPORTER_OTLP_HEADERS", "")
+	cfg.OTelServiceName = getEnv("OTEL_SERVICE_NAME", "ampmanager")
+	cfg.OTelSampleRatio = getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1)
+	cfg.SMTPHost = getEnv("SMTP_HOST", "")
+	cfg.SMTPPort = getEnv("SMTP_PORT", "587")
+	cfg.SMTPUsername = getEnv("SMTP_USERNAME", "")
+	cfg.SMTPPassword = getEnv("SMTP_PASSWORD", "")
+	cfg.SMTPFrom = getEnv("SMTP_FROM", "")
+	cfg.SMTPTLS = getEnv("SMTP_TLS", "starttls")
+	cfg.PublicURL = strings.TrimSuffix(getEnv("PUBLIC_URL", ""), "/")
+
+	secrets.Configure(secrets.Options{
+		RefreshInterval: cfg.SecretRefreshInterval,
+		VaultAddr:       cfg.VaultAddr,
+		VaultToken:      cfg.VaultToken,
+		VaultNamespace:  cfg.VaultNamespace,
+		AWSRegion:       cfg.AWSRegion,
+	})
+	if err := cfg.resolveSecretRefs(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// resolveSecretRefs 启动时解析密钥引用，任一引用无法解析则拒绝启动
+func (c *Config) resolveSecretRefs() error {
+	c.secretRefs = map[string]string{}
+	fields := []struct {
+		env   string
+		value *string
+	}{
+		{"ADMIN_PASSWORD", &c.AdminPassword},
+		{"JWT_SECRET", &c.JWTSecret},
+		{"DATABASE_URL", &c.DatabaseURL},
+		{"DATABASE_READ_URL", &c.DatabaseReadURL},
+		{"DATA_ENCRYPTION_KEY", &c.DataEncryptionKey},
+		{"SMTP_PASSWORD", &c.SMTPPassword},
+	}
+	for _, f := range fields {
+		if !secrets.IsReference(*f.value) {
+			continue
+		}
+		resolved, err := secrets.Resolve(*f.value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.env, err)
+		}
+		c.secretRefs[f.env] = *f.value
+		*f.value = resolved
+	}
+	return nil
+}
+
+// currentSecret 引用型配置返回密钥存储中的最新值（含后台轮换），否则返回启动时的值
+func (c *Config) currentSecret(env, loaded string) string {
+	ref, ok := c.secretRefs[env]
+	if !ok {
+		return loaded
+	}
+	if value, err := secrets.Resolve(ref); err == nil {
+		return value
+	}
+	return loaded
 }
 
 func ValidateSecurityConfig(cfg *Config) error {
-	if os.Getenv("ALLOW_INSECURE_DEFAULTS") == "true" {
+	if getEnvBool("ALLOW_INSECURE_DEFAULTS", false) {
 		return nil
 	}
 
@@ -104,33 +257,97 @@ func Get() *Config {
 	return cfg
 }
 
+// GetJWTSecret 返回当前 JWT 签名密钥，外部存储中的密钥轮换后立即生效
+func (c *Config) GetJWTSecret() string {
+	return c.currentSecret("JWT_SECRET", c.JWTSecret)
+}
+
+// GetSMTPPassword 返回当前 SMTP 密码，外部存储中的密钥轮换后立即生效
+func (c *Config) GetSMTPPassword() string {
+	return c.currentSecret("SMTP_PASSWORD", c.SMTPPassword)
+}
+
 func (c *Config) GetEncryptionKey() []byte {
-	if c.DataEncryptionKey == "" {
+	key := c.currentSecret("DATA_ENCRYPTION_KEY", c.DataEncryptionKey)
+	if key == "" {
 		return nil
 	}
-	return []byte(c.DataEncryptionKey)
+	return []byte(key)
 }
 
 func (c *Config) DatabaseOptions() database.Options {
 	return database.Options{
-		Type:        database.DBType(c.DBType),
-		DatabaseURL: c.DatabaseURL,
-		SQLitePath:  c.SQLitePath,
+		Type:            database.DBType(c.DBType),
+		DatabaseURL:     c.DatabaseURL,
+		SQLitePath:      c.SQLitePath,
+		ReadDatabaseURL: c.DatabaseReadURL,
+		ReadPoolSize:    c.DatabaseReadPoolSize,
 	}
 }
 
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value, ok := lookupSetting(key); ok {
 		return value
 	}
+	recordDefault(key, defaultValue)
 	return defaultValue
 }
 
 func getEnvFloat(key string, defaultValue float64) float64 {
-	if value := os.Getenv(key); value != "" {
+	if value, ok := lookupSetting(key); ok {
 		if f, err := strconv.ParseFloat(value, 64); err == nil {
 			return f
 		}
+		warnInvalidSetting(key, value)
+	}
+	recordDefault(key, strconv.FormatFloat(defaultValue, 'f', -1, 64))
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, ok := lookupSetting(key); ok {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+		warnInvalidSetting(key, value)
+	}
+	recordDefault(key, strconv.Itoa(defaultValue))
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, ok := lookupSetting(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+		warnInvalidSetting(key, value)
+	}
+	recordDefault(key, strconv.FormatBool(defaultValue))
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, ok := lookupSetting(key); ok {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		warnInvalidSetting(key, value)
 	}
+	recordDefault(key, defaultValue.String())
 	return defaultValue
 }
+
+// splitList 按逗号拆分列表配置，忽略空项
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func warnInvalidSetting(key, value string) {
+	fmt.Fprintf(os.Stderr, "warning: invalid value %q for %s, using default\n", value, key)
+}
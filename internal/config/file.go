@@ -0,0 +1,394 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ampmanager/internal/secrets"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileEnv 指定配置文件路径；未设置时依次查找 defaultConfigFiles
+const configFileEnv = "CONFIG_FILE"
+
+var defaultConfigFiles = []string{"./config.yaml", "./config.yml", "./config.toml"}
+
+type settingKind int
+
+const (
+	kindString settingKind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindList
+)
+
+func (k settingKind) String() string {
+	switch k {
+	case kindInt:
+		return "整数"
+	case kindFloat:
+		return "数字"
+	case kindBool:
+		return "布尔值"
+	case kindList:
+		return "字符串列表"
+	default:
+		return "字符串"
+	}
+}
+
+// setting 配置项：配置文件中的路径与对应的环境变量（环境变量优先）
+type setting struct {
+	path    string
+	env     string
+	kind    settingKind
+	sep     string   // kindList 转为环境变量格式时的分隔符
+	secret  bool     // 输出有效配置时脱敏
+	allowed []string // 非空时限定取值
+}
+
+var settings = []setting{
+	{path: "server.port", env: "SERVER_PORT", kind: kindString},
+	{path: "admin.username", env: "ADMIN_USERNAME", kind: kindString},
+	{path: "admin.password", env: "ADMIN_PASSWORD", kind: kindString, secret: true},
+	{path: "jwt.secret", env: "JWT_SECRET", kind: kindString, secret: true},
+	{path: "jwt.issuer", env: "JWT_ISSUER", kind: kindString},
+	{path: "jwt.audience", env: "JWT_AUDIENCE", kind: kindString},
+	{path: "database.type", env: "DB_TYPE", kind: kindString, allowed: []string{"sqlite", "postgres", "mysql", "mariadb"}},
+	{path: "database.url", env: "DATABASE_URL", kind: kindString, secret: true},
+	{path: "database.sqlitePath", env: "SQLITE_PATH", kind: kindString},
+	{path: "database.readUrl", env: "DATABASE_READ_URL", kind: kindString, secret: true},
+	{path: "database.readPoolSize", env: "DATABASE_READ_POOL_SIZE", kind: kindInt},
+	{path: "cors.allowedOrigins", env: "CORS_ALLOWED_ORIGINS", kind: kindList, sep: ","},
+	{path: "cors.allowCredentials", env: "CORS_ALLOW_CREDENTIALS", kind: kindBool},
+	{path: "cors.frameAncestors", env: "FRAME_ANCESTORS", kind: kindList, sep: " "},
+	{path: "rateLimit.authRps", env: "RATE_LIMIT_AUTH_RPS", kind: kindFloat},
+	{path: "rateLimit.proxyRps", env: "RATE_LIMIT_PROXY_RPS", kind: kindFloat},
+	{path: "rateLimit.adminRps", env: "RATE_LIMIT_ADMIN_RPS", kind: kindFloat},
+	{path: "rateLimit.adminBurst", env: "RATE_LIMIT_ADMIN_BURST", kind: kindInt},
+	{path: "tokenCountCache.ttl", env: "TOKEN_COUNT_CACHE_TTL", kind: kindString},
+	{path: "tokenCountCache.size", env: "TOKEN_COUNT_CACHE_SIZE", kind: kindInt},
+	{path: "tokenizer.dir", env: "TOKENIZER_DIR", kind: kindString},
+	{path: "security.dataEncryptionKey", env: "DATA_ENCRYPTION_KEY", kind: kindString, secret: true},
+	{path: "security.allowInsecureDefaults", env: "ALLOW_INSECURE_DEFAULTS", kind: kindBool},
+	{path: "security.passwordBreachList", env: "PASSWORD_BREACH_LIST", kind: kindString},
+	{path: "demoMode", env: "DEMO_MODE", kind: kindBool},
+	{path: "web.distDir", env: "WEB_DIST_DIR", kind: kindString},
+	{path: "secrets.refreshInterval", env: "SECRET_REFRESH_INTERVAL", kind: kindString},
+	{path: "vault.addr", env: "VAULT_ADDR", kind: kindString},
+	{path: "vault.token", env: "VAULT_TOKEN", kind: kindString, secret: true},
+	{path: "vault.namespace", env: "VAULT_NAMESPACE", kind: kindString},
+	{path: "aws.region", env: "AWS_REGION", kind: kindString},
+	{path: "acme.enabled", env: "ACME_ENABLED", kind: kindBool},
+	{path: "acme.domains", env: "ACME_DOMAINS", kind: kindList, sep: ","},
+	{path: "acme.email", env: "ACME_EMAIL", kind: kindString},
+	{path: "acme.cacheDir", env: "ACME_CACHE_DIR", kind: kindString},
+	{path: "acme.directoryUrl", env: "ACME_DIRECTORY_URL", kind: kindString},
+	{path: "acme.httpPort", env: "ACME_HTTP_PORT", kind: kindString},
+	{path: "acme.tlsPort", env: "ACME_TLS_PORT", kind: kindString},
+	{path: "tracing.otlpEndpoint", env: "OTEL_EXPORTER_OTLP_ENDPOINT", kind: kindString},
+	{path: "tracing.otlpHeaders", env: "OTEL_EXPORTER_OTLP_HEADERS", kind: kindString, secret: true},
+	{path: "tracing.serviceName", env: "OTEL_SERVICE_NAME", kind: kindString},
+	{path: "tracing.sampleRatio", env: "OTEL_TRACES_SAMPLER_ARG", kind: kindFloat},
+	{path: "smtp.host", env: "SMTP_HOST", kind: kindString},
+	{path: "smtp.port", env: "SMTP_PORT", kind: kindString},
+	{path: "smtp.username", env: "SMTP_USERNAME", kind: kindString},
+	{path: "smtp.password", env: "SMTP_PASSWORD", kind: kindString, secret: true},
+	{path: "smtp.from", env: "SMTP_FROM", kind: kindString},
+	{path: "smtp.tls", env: "SMTP_TLS", kind: kindString, allowed: []string{"starttls", "tls", "none"}},
+	{path: "server.publicUrl", env: "PUBLIC_URL", kind: kindString},
+}
+
+// 配置值来源
+const (
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+var (
+	// configFilePath 已加载的配置文件，为空表示未使用配置文件
+	configFilePath string
+	// fileValues 配置文件中的值，已按环境变量格式转为字符串
+	fileValues = map[string]string{}
+	// resolved 每个环境变量最终使用的值与来源
+	resolved = map[string]resolvedValue{}
+)
+
+type resolvedValue struct {
+	value  string
+	source string
+}
+
+// EffectiveSetting 有效配置项（敏感值已脱敏）
+type EffectiveSetting struct {
+	Key    string `json:"key"`
+	Env    string `json:"env"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// EffectiveConfig 有效配置及其来源文件
+type EffectiveConfig struct {
+	ConfigFile string             `json:"configFile"`
+	Settings   []EffectiveSetting `json:"settings"`
+}
+
+// loadConfigFile 查找并解析配置文件，校验失败时返回包含全部问题的错误
+func loadConfigFile() error {
+	configFilePath = ""
+	fileValues = map[string]string{}
+	resolved = map[string]resolvedValue{}
+
+	path := os.Getenv(configFileEnv)
+	if path == "" {
+		for _, candidate := range defaultConfigFiles {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件 %s 失败: %w", path, err)
+	}
+
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &doc)
+	case ".toml":
+		err = toml.Unmarshal(raw, &doc)
+	default:
+		return fmt.Errorf("配置文件 %s 格式不支持，仅支持 .yaml/.yml/.toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+
+	values, issues := validateConfigDocument(doc)
+	if len(issues) > 0 {
+		return fmt.Errorf("配置文件 %s 校验失败:\n  - %s", path, strings.Join(issues, "\n  - "))
+	}
+	configFilePath = path
+	fileValues = values
+	return nil
+}
+
+// validateConfigDocument 按 settings 校验配置文件并转换为环境变量格式
+func validateConfigDocument(doc map[string]interface{}) (map[string]string, []string) {
+	flat := map[string]interface{}{}
+	flattenConfig("", doc, flat)
+
+	byPath := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byPath[strings.ToLower(s.path)] = s
+	}
+
+	paths := make([]string, 0, len(flat))
+	for p := range flat {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	values := map[string]string{}
+	var issues []string
+	for _, p := range paths {
+		s, ok := byPath[strings.ToLower(p)]
+		if !ok {
+			msg := fmt.Sprintf("%s: 未知配置项", p)
+			if suggestion := suggestSetting(p); suggestion != "" {
+				msg += fmt.Sprintf("，是否为 %s？", suggestion)
+			}
+			issues = append(issues, msg)
+			continue
+		}
+		value, err := convertSettingValue(s, flat[p])
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("%s: %v", p, err))
+			continue
+		}
+		values[s.env] = value
+	}
+	return values, issues
+}
+
+// flattenConfig 将嵌套表展开为 a.b.c 形式的路径
+func flattenConfig(prefix string, node map[string]interface{}, out map[string]interface{}) {
+	for key, value := range node {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if child, ok := value.(map[string]interface{}); ok {
+			flattenConfig(path, child, out)
+			continue
+		}
+		out[path] = value
+	}
+}
+
+func convertSettingValue(s setting, value interface{}) (string, error) {
+	if value == nil {
+		return "", fmt.Errorf("值不能为空，应为%s", s.kind)
+	}
+	var out string
+	switch s.kind {
+	case kindString:
+		switch v := value.(type) {
+		case string:
+			out = v
+		case int, int64, uint64, float64:
+			// 端口等常被写成数字
+			out = fmt.Sprint(v)
+		default:
+			return "", fmt.Errorf("应为%s，实际为 %T", s.kind, value)
+		}
+	case kindInt:
+		switch v := value.(type) {
+		case int:
+			out = strconv.Itoa(v)
+		case int64:
+			out = strconv.FormatInt(v, 10)
+		case uint64:
+			out = strconv.FormatUint(v, 10)
+		default:
+			return "", fmt.Errorf("应为%s，实际为 %v", s.kind, value)
+		}
+	case kindFloat:
+		switch v := value.(type) {
+		case int:
+			out = strconv.Itoa(v)
+		case int64:
+			out = strconv.FormatInt(v, 10)
+		case uint64:
+			out = strconv.FormatUint(v, 10)
+		case float64:
+			out = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return "", fmt.Errorf("应为%s，实际为 %v", s.kind, value)
+		}
+	case kindBool:
+		v, ok := value.(bool)
+		if !ok {
+			return "", fmt.Errorf("应为布尔值 true/false，实际为 %v", value)
+		}
+		out = strconv.FormatBool(v)
+	case kindList:
+		switch v := value.(type) {
+		case string:
+			out = v
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				str, ok := item.(string)
+				if !ok {
+					return "", fmt.Errorf("列表元素应为字符串，实际为 %v", item)
+				}
+				items = append(items, str)
+			}
+			out = strings.Join(items, s.sep)
+		default:
+			return "", fmt.Errorf("应为%s，实际为 %T", s.kind, value)
+		}
+	}
+
+	if len(s.allowed) > 0 {
+		for _, allowed := range s.allowed {
+			if out == allowed {
+				return out, nil
+			}
+		}
+		return "", fmt.Errorf("取值 %q 无效，允许值: %s", out, strings.Join(s.allowed, ", "))
+	}
+	return out, nil
+}
+
+// suggestSetting 为拼写错误的配置项给出最接近的已知路径
+func suggestSetting(path string) string {
+	best, bestDistance := "", 4
+	for _, s := range settings {
+		if d := levenshtein(strings.ToLower(path), strings.ToLower(s.path)); d < bestDistance {
+			best, bestDistance = s.path, d
+		}
+		// 误用环境变量名作为键
+		if strings.EqualFold(path, s.env) {
+			return s.path
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// lookupSetting 按 环境变量 > 配置文件 的优先级取值，并记录来源
+func lookupSetting(key string) (string, bool) {
+	if value := os.Getenv(key); value != "" {
+		resolved[key] = resolvedValue{value: value, source: SourceEnv}
+		return value, true
+	}
+	if value, ok := fileValues[key]; ok {
+		resolved[key] = resolvedValue{value: value, source: SourceFile}
+		return value, true
+	}
+	return "", false
+}
+
+// recordDefault 记录使用默认值的配置项
+func recordDefault(key, value string) {
+	resolved[key] = resolvedValue{value: value, source: SourceDefault}
+}
+
+var databaseURLPassword = regexp.MustCompile(`://([^:/?#]+):([^@/?#]+)@`)
+
+// GetEffectiveConfig 返回当前生效的配置（敏感值脱敏），用于排查部署问题
+func GetEffectiveConfig() EffectiveConfig {
+	result := EffectiveConfig{ConfigFile: configFilePath, Settings: make([]EffectiveSetting, 0, len(settings))}
+	for _, s := range settings {
+		item := EffectiveSetting{Key: s.path, Env: s.env, Source: SourceDefault}
+		if r, ok := resolved[s.env]; ok {
+			item.Value, item.Source = r.value, r.source
+		}
+		// 密钥引用本身不含敏感信息，原样展示便于排查
+		if s.secret && item.Value != "" && !secrets.IsReference(item.Value) {
+			if s.env == "DATABASE_URL" || s.env == "DATABASE_READ_URL" {
+				item.Value = databaseURLPassword.ReplaceAllString(item.Value, `://$1:******@`)
+			} else {
+				item.Value = "******"
+			}
+		}
+		result.Settings = append(result.Settings, item)
+	}
+	return result
+}
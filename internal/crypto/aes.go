@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"io"
+	"strings"
 )
 
 var ErrEncryptionKeyNotSet = errors.New("encryption key not configured")
@@ -73,3 +74,50 @@ func IsEncrypted(value string) bool {
 	}
 	return len(value) > 50
 }
+
+// envelopePrefix 信封加密值的前缀，后接版本号、被主密钥加密的数据密钥与被数据密钥加密的密文
+const envelopePrefix = "enc:v1:"
+
+// EncryptEnvelope 信封加密：每个值生成随机数据密钥加密明文，再用主密钥加密数据密钥，
+// 更换主密钥时只需重新加密数据密钥
+func EncryptEnvelope(plaintext []byte, masterKey []byte) (string, error) {
+	if len(masterKey) == 0 {
+		return "", ErrEncryptionKeyNotSet
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := Encrypt(dataKey, masterKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := Encrypt(plaintext, dataKey)
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + wrappedKey + ":" + ciphertext, nil
+}
+
+// DecryptEnvelope 解密 EncryptEnvelope 生成的值
+func DecryptEnvelope(value string, masterKey []byte) ([]byte, error) {
+	if len(masterKey) == 0 {
+		return nil, ErrEncryptionKeyNotSet
+	}
+
+	wrappedKey, ciphertext, ok := strings.Cut(strings.TrimPrefix(value, envelopePrefix), ":")
+	if !IsEnvelope(value) || !ok {
+		return nil, errors.New("invalid envelope ciphertext")
+	}
+	dataKey, err := Decrypt(wrappedKey, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return Decrypt(ciphertext, dataKey)
+}
+
+// IsEnvelope 判断值是否为 EncryptEnvelope 的输出
+func IsEnvelope(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var (
+	testMasterKey = bytes.Repeat([]byte{0x11}, 32)
+	otherKey      = bytes.Repeat([]byte{0x22}, 32)
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	for _, plain := range []string{"sk-test-123", `[{"key":"sk-a"},{"key":"sk-b"}]`, "密钥"} {
+		sealed, err := EncryptEnvelope([]byte(plain), testMasterKey)
+		if err != nil {
+			t.Fatalf("encrypt %q: %v", plain, err)
+		}
+		if !IsEnvelope(sealed) || strings.Contains(sealed, plain) {
+			t.Fatalf("sealed = %q", sealed)
+		}
+		got, err := DecryptEnvelope(sealed, testMasterKey)
+		if err != nil {
+			t.Fatalf("decrypt %q: %v", plain, err)
+		}
+		if string(got) != plain {
+			t.Errorf("round trip = %q, want %q", got, plain)
+		}
+	}
+
+	// 每次加密使用新的数据密钥与随机数，相同明文的密文不同
+	a, _ := EncryptEnvelope([]byte("same"), testMasterKey)
+	b, _ := EncryptEnvelope([]byte("same"), testMasterKey)
+	if a == b {
+		t.Error("envelope ciphertext is deterministic")
+	}
+}
+
+func TestEnvelopeWrongKey(t *testing.T) {
+	sealed, err := EncryptEnvelope([]byte("sk-test"), testMasterKey)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := DecryptEnvelope(sealed, otherKey); err == nil {
+		t.Error("expected error decrypting with a different master key")
+	}
+	if _, err := DecryptEnvelope(sealed, nil); err != ErrEncryptionKeyNotSet {
+		t.Errorf("nil key error = %v", err)
+	}
+	if _, err := EncryptEnvelope([]byte("x"), nil); err != ErrEncryptionKeyNotSet {
+		t.Errorf("encrypt nil key error = %v", err)
+	}
+}
+
+func TestEnvelopeTampered(t *testing.T) {
+	sealed, _ := EncryptEnvelope([]byte("sk-test"), testMasterKey)
+	cases := map[string]string{
+		"missing separator": envelopePrefix + "abc",
+		"no prefix":         strings.TrimPrefix(sealed, envelopePrefix),
+		"flipped byte":      sealed[:len(sealed)-4] + "AAA=",
+	}
+	for name, value := range cases {
+		if _, err := DecryptEnvelope(value, testMasterKey); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestIsEnvelopeLegacyValues(t *testing.T) {
+	legacy, err := Encrypt([]byte("sk-legacy-upstream-key"), testMasterKey)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	for _, value := range []string{"", "sk-plain", legacy} {
+		if IsEnvelope(value) {
+			t.Errorf("IsEnvelope(%q) = true", value)
+		}
+	}
+	got, err := Decrypt(legacy, testMasterKey)
+	if err != nil || string(got) != "sk-legacy-upstream-key" {
+		t.Errorf("legacy decrypt = %q, %v", got, err)
+	}
+}
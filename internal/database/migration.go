@@ -29,8 +29,12 @@ var migrationTables = []string{
 	"user_api_keys",
 	"channels",
 	"user_groups",
+	"group_admins",
+	"user_email_tokens",
+	"user_identities",
 	"channel_groups",
 	"channel_models",
+	"channel_oauth_tokens",
 	"model_metadata",
 	"model_prices",
 	"subscription_plans",
@@ -41,6 +45,18 @@ var migrationTables = []string{
 	"request_log_details",
 	"system_config",
 	"billing_events",
+	"saved_log_views",
+	"channel_templates",
+	"feature_flags",
+	"rate_limits",
+	"settings_templates",
+	"settings_template_versions",
+	"user_settings_templates",
+	"scheduled_changes",
+	"audit_logs",
+	"usage_rollups",
+	"batch_jobs",
+	"group_budget_alerts",
 }
 
 func MigrateBetweenDatabases(params MigrationParams) error {
@@ -53,7 +69,7 @@ func MigrateBetweenDatabases(params MigrationParams) error {
 		return err
 	}
 	if sourceOptions.Type == targetOptions.Type {
-		return fmt.Errorf("migration only supports switching between sqlite and postgres")
+		return fmt.Errorf("migration only supports switching between different database types")
 	}
 
 	reportMigrationProgress(params.OnProgress, 5, "打开源数据库")
@@ -112,7 +128,7 @@ func reportMigrationProgress(callback func(MigrationProgress), progress int, mes
 
 func clearBusinessTablesOnDB(targetDB *sql.DB, targetOptions Options) error {
 	allTables := append([]string{}, migrationTables...)
-	if targetOptions.Type == DBTypePostgres {
+	if targetOptions.Type != DBTypeSQLite {
 		allTables = append(allTables, "request_log_details_archive")
 	}
 
@@ -122,6 +138,16 @@ func clearBusinessTablesOnDB(targetDB *sql.DB, targetOptions Options) error {
 		return err
 	}
 
+	if targetOptions.Type == DBTypeMySQL {
+		// migrationTables 按父表在前排列，逆序删除即可满足外键约束
+		for index := len(allTables) - 1; index >= 0; index-- {
+			if _, err := targetDB.Exec("DELETE FROM " + allTables[index]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	if _, err := targetDB.Exec("PRAGMA foreign_keys = OFF"); err != nil {
 		return err
 	}
@@ -162,7 +188,9 @@ func copyTableBetween(sourceDB, targetDB *sql.DB, sourceTable, targetTable strin
 	}
 	defer rows.Close()
 
-	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", targetTable, strings.Join(columns, ", "), placeholderListForType(len(columns), detectDBTypeFromHandle(targetDB)))
+	// 占位符统一使用 ?，PostgreSQL 连接层负责改写为 $n
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",")
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", targetTable, strings.Join(columns, ", "), placeholders)
 	transaction, err := targetDB.Begin()
 	if err != nil {
 		return err
@@ -209,7 +237,7 @@ func tableExistsOnDB(db *sql.DB, tableName string) (bool, error) {
 	_, err := tableColumnsOnDB(db, tableName)
 	if err != nil {
 		message := strings.ToLower(err.Error())
-		if strings.Contains(message, "does not exist") || strings.Contains(message, "no such table") {
+		if strings.Contains(message, "does not exist") || strings.Contains(message, "doesn't exist") || strings.Contains(message, "no such table") {
 			return false, nil
 		}
 		return false, err
@@ -280,7 +308,7 @@ func migrateArchiveDataBetween(sourceOptions, targetOptions Options, sourceMainD
 }
 
 func openArchiveSourceOnDB(options Options, mainDB *sql.DB) (*sql.DB, string, func() error, error) {
-	if options.Type == DBTypePostgres {
+	if options.Type != DBTypeSQLite {
 		exists, err := tableExistsOnDB(mainDB, "request_log_details_archive")
 		if err != nil {
 			return nil, "", nil, err
@@ -312,7 +340,7 @@ func openArchiveSourceOnDB(options Options, mainDB *sql.DB) (*sql.DB, string, fu
 }
 
 func openArchiveTargetOnDB(options Options, mainDB *sql.DB, clearTarget bool) (*sql.DB, string, func() error, error) {
-	if options.Type == DBTypePostgres {
+	if options.Type != DBTypeSQLite {
 		if clearTarget {
 			if _, err := mainDB.Exec("DELETE FROM request_log_details_archive"); err != nil {
 				return nil, "", nil, err
@@ -348,6 +376,9 @@ func openArchiveTargetOnDB(options Options, mainDB *sql.DB, clearTarget bool) (*
 			response_headers TEXT,
 			response_body TEXT,
 			translated_response_body TEXT,
+			redaction_count INTEGER NOT NULL DEFAULT 0,
+			injected_system_prompt TEXT NOT NULL DEFAULT '',
+			pii_redactions TEXT NOT NULL DEFAULT '',
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);
 		CREATE INDEX IF NOT EXISTS idx_archive_details_created ON request_log_details(created_at DESC);
@@ -369,27 +400,3 @@ func openArchiveTargetOnDB(options Options, mainDB *sql.DB, clearTarget bool) (*
 func sqliteArchivePath(sqlitePath string) string {
 	return filepath.Join(filepath.Dir(sqlitePath), "data_details_archive.db")
 }
-
-func placeholderListForType(count int, currentType DBType) string {
-	placeholders := make([]string, count)
-	for index := 0; index < count; index++ {
-		if currentType == DBTypePostgres {
-			placeholders[index] = fmt.Sprintf("$%d", index+1)
-		} else {
-			placeholders[index] = "?"
-		}
-	}
-	return strings.Join(placeholders, ",")
-}
-
-func detectDBTypeFromHandle(db *sql.DB) DBType {
-	if err := db.Ping(); err != nil {
-		return DBTypeSQLite
-	}
-	rows, err := db.Query("SELECT version()")
-	if err == nil {
-		rows.Close()
-		return DBTypePostgres
-	}
-	return DBTypeSQLite
-}
@@ -0,0 +1,327 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// MySQL / MariaDB 方言适配。
+// 业务 SQL 沿用 SQLite 与 PostgreSQL 共用的写法，在连接层改写为 MySQL 语法：
+//   - INSERT ... ON CONFLICT (...) DO UPDATE SET x = excluded.x → ON DUPLICATE KEY UPDATE x = VALUES(x)
+//   - INSERT ... ON CONFLICT DO NOTHING → INSERT IGNORE
+//   - DELETE/UPDATE t WHERE id IN (SELECT id FROM t WHERE ... LIMIT ?) → 单表 DELETE/UPDATE ... LIMIT ?
+//     （MySQL 不允许 IN 子查询带 LIMIT，也不允许子查询引用被修改的表）
+//   - 保留字标识符 key / groups 加反引号
+//
+// 建表与迁移语句由 adaptMySQLSchema 转换：参与主键、唯一约束、外键或索引的 TEXT 列改为 VARCHAR(191)，
+// 其余 TEXT 改为 LONGTEXT，INTEGER 统一为 BIGINT，时间列为 DATETIME(6)。
+// 占位符保持 ?，无需改写；业务 SQL 未使用 RETURNING。
+
+const mysqlKeyColumnType = "VARCHAR(191)"
+
+var (
+	mysqlConflictPattern  = regexp.MustCompile(`(?is)\s*\bON\s+CONFLICT\s*(?:\([^)]*\))?\s*DO\s+(NOTHING|UPDATE\s+SET)\b`)
+	mysqlInsertPattern    = regexp.MustCompile(`(?i)^(\s*INSERT)\s+INTO\b`)
+	mysqlExcludedPattern  = regexp.MustCompile(`(?i)\bexcluded\.(\w+)`)
+	mysqlReservedPattern  = regexp.MustCompile(`\b(key|groups)\b`)
+	mysqlSelfLimitPattern = regexp.MustCompile(`(?is)^(\s*(?:DELETE\s+FROM|UPDATE)\s+(\w+)\b.*?)\bWHERE\s+(\w+)\s+IN\s*\(\s*SELECT\s+(\w+)\s+FROM\s+(\w+)\s+WHERE\s+(.*)\s+LIMIT\s+\?\s*\)\s*$`)
+
+	mysqlCreateTablePattern = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(\w+)\s*\((.*)\)$`)
+	mysqlAddColumnPattern   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+ADD\s+COLUMN\s+(.*)$`)
+	mysqlCreateIndexPattern = regexp.MustCompile(`(?is)^CREATE\s+(UNIQUE\s+)?INDEX\s+(?:IF\s+NOT\s+EXISTS\s+)?(\w+)\s+ON\s+(\w+)\s*\((.*?)\)\s*(?:WHERE\s+(.*))?$`)
+	mysqlDropIndexPattern   = regexp.MustCompile(`(?is)^DROP\s+INDEX\b`)
+	mysqlColumnPattern      = regexp.MustCompile(`(?is)^(\w+)\s+(TEXT|INTEGER|BIGINT|REAL|DATETIME|TIMESTAMPTZ)\b(.*)$`)
+	mysqlTableKeyPattern    = regexp.MustCompile(`(?is)^(?:PRIMARY\s+KEY|UNIQUE)\s*\(([^)]*)\)`)
+	mysqlForeignKeyPattern  = regexp.MustCompile(`(?is)^FOREIGN\s+KEY\s*\(([^)]*)\)\s*REFERENCES\s+(\w+)\s*\(([^)]*)\)`)
+	mysqlInlineKeyPattern   = regexp.MustCompile(`(?i)\b(PRIMARY\s+KEY|UNIQUE)\b`)
+	mysqlTextDefaultPattern = regexp.MustCompile(`(?i)\bDEFAULT\s+('(?:[^']|'')*')`)
+	mysqlNotNullPattern     = regexp.MustCompile(`(?is)^(\w+)\s+IS\s+NOT\s+NULL$`)
+)
+
+// rewriteMySQLQuery 将共用方言的查询改写为 MySQL 语法
+func rewriteMySQLQuery(query string) string {
+	if query == "" {
+		return query
+	}
+	query = rewriteMySQLConflict(query)
+	query = rewriteMySQLSelfLimit(query)
+	return replaceOutsideLiterals(query, mysqlReservedPattern, func(match []string) string {
+		return "`" + match[1] + "`"
+	})
+}
+
+func rewriteMySQLConflict(query string) string {
+	masked := maskSQLLiterals(query)
+	loc := mysqlConflictPattern.FindStringSubmatchIndex(masked)
+	if loc == nil {
+		return query
+	}
+
+	head, tail := query[:loc[0]], query[loc[1]:]
+	if strings.EqualFold(masked[loc[2]:loc[3]], "NOTHING") {
+		return mysqlInsertPattern.ReplaceAllString(head, "${1} IGNORE INTO") + tail
+	}
+	tail = replaceOutsideLiterals(tail, mysqlExcludedPattern, func(match []string) string {
+		return "VALUES(" + match[1] + ")"
+	})
+	return head + " ON DUPLICATE KEY UPDATE" + tail
+}
+
+func rewriteMySQLSelfLimit(query string) string {
+	loc := mysqlSelfLimitPattern.FindStringSubmatchIndex(maskSQLLiterals(query))
+	if loc == nil {
+		return query
+	}
+	group := func(index int) string {
+		return query[loc[2*index]:loc[2*index+1]]
+	}
+	if group(2) != group(5) || group(3) != group(4) {
+		return query
+	}
+	return group(1) + "WHERE " + group(6) + " LIMIT ?"
+}
+
+// replaceOutsideLiterals 替换字符串字面量、引号标识符与注释之外的匹配
+func replaceOutsideLiterals(query string, pattern *regexp.Regexp, replace func(match []string) string) string {
+	matches := pattern.FindAllStringSubmatchIndex(maskSQLLiterals(query), -1)
+	if len(matches) == 0 {
+		return query
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(query) + len(matches)*8)
+	last := 0
+	for _, loc := range matches {
+		groups := make([]string, len(loc)/2)
+		for index := range groups {
+			if loc[2*index] >= 0 {
+				groups[index] = query[loc[2*index]:loc[2*index+1]]
+			}
+		}
+		builder.WriteString(query[last:loc[0]])
+		builder.WriteString(replace(groups))
+		last = loc[1]
+	}
+	builder.WriteString(query[last:])
+	return builder.String()
+}
+
+// maskSQLLiterals 返回等长副本，引号内容（含引号本身）与注释替换为空格，便于正则只匹配语句结构
+func maskSQLLiterals(query string) string {
+	masked := []byte(query)
+	var quote byte
+	inLineComment := false
+	inBlockComment := false
+
+	for index := 0; index < len(masked); index++ {
+		current := query[index]
+		var next byte
+		if index+1 < len(query) {
+			next = query[index+1]
+		}
+
+		switch {
+		case inLineComment:
+			if current == '\n' {
+				inLineComment = false
+				continue
+			}
+			masked[index] = ' '
+			continue
+		case inBlockComment:
+			masked[index] = ' '
+			if current == '*' && next == '/' {
+				masked[index+1] = ' '
+				index++
+				inBlockComment = false
+			}
+			continue
+		case quote != 0:
+			masked[index] = ' '
+			if current == quote {
+				if next == quote {
+					masked[index+1] = ' '
+					index++
+				} else {
+					quote = 0
+				}
+			}
+			continue
+		}
+
+		switch {
+		case current == '\'' || current == '"' || current == '`':
+			quote = current
+			masked[index] = ' '
+		case current == '-' && next == '-':
+			inLineComment = true
+			masked[index] = ' '
+		case current == '/' && next == '*':
+			inBlockComment = true
+			masked[index] = ' '
+			masked[index+1] = ' '
+			index++
+		}
+	}
+	return string(masked)
+}
+
+var (
+	mysqlKeyColumnsOnce sync.Once
+	mysqlKeyColumnsSet  map[string]bool
+)
+
+// mysqlSchemaKeyColumns 建表语句与全部迁移中参与主键、唯一约束、外键或索引的列（table.column），
+// 迁移中先加列后建索引的列同样需要在加列时使用 VARCHAR
+func mysqlSchemaKeyColumns() map[string]bool {
+	mysqlKeyColumnsOnce.Do(func() {
+		texts := []string{baseSchema, mysqlArchiveSchema}
+		for _, migration := range schemaMigrations() {
+			texts = append(texts, migration.sql)
+		}
+		mysqlKeyColumnsSet = collectMySQLKeyColumns(texts...)
+	})
+	return mysqlKeyColumnsSet
+}
+
+func collectMySQLKeyColumns(texts ...string) map[string]bool {
+	keys := make(map[string]bool)
+	addColumns := func(table, columnList string) {
+		for _, column := range strings.Split(columnList, ",") {
+			fields := strings.Fields(column)
+			if len(fields) > 0 && !strings.Contains(fields[0], "(") {
+				keys[table+"."+fields[0]] = true
+			}
+		}
+	}
+
+	for _, text := range texts {
+		for _, statement := range splitStatements(text) {
+			if match := mysqlCreateTablePattern.FindStringSubmatch(statement); match != nil {
+				table := match[1]
+				for _, definition := range splitTopLevel(match[2]) {
+					if keyMatch := mysqlTableKeyPattern.FindStringSubmatch(definition); keyMatch != nil {
+						addColumns(table, keyMatch[1])
+					} else if foreignMatch := mysqlForeignKeyPattern.FindStringSubmatch(definition); foreignMatch != nil {
+						addColumns(table, foreignMatch[1])
+						addColumns(foreignMatch[2], foreignMatch[3])
+					} else if columnMatch := mysqlColumnPattern.FindStringSubmatch(definition); columnMatch != nil && mysqlInlineKeyPattern.MatchString(columnMatch[3]) {
+						keys[table+"."+columnMatch[1]] = true
+					}
+				}
+			} else if match := mysqlCreateIndexPattern.FindStringSubmatch(statement); match != nil {
+				addColumns(match[3], match[4])
+			}
+		}
+	}
+	return keys
+}
+
+// adaptMySQLSchema 将建表与迁移语句转换为 MySQL DDL；非 DDL 语句原样保留（由连接层改写）
+func adaptMySQLSchema(sqlText string, keys map[string]bool) string {
+	var statements []string
+	for _, statement := range splitStatements(sqlText) {
+		statements = append(statements, adaptMySQLStatement(statement, keys)...)
+	}
+	return strings.Join(statements, ";\n")
+}
+
+func adaptMySQLStatement(statement string, keys map[string]bool) []string {
+	if match := mysqlCreateTablePattern.FindStringSubmatch(statement); match != nil {
+		table := match[1]
+		definitions := splitTopLevel(match[2])
+		for index, definition := range definitions {
+			definitions[index] = adaptMySQLColumn(table, definition, keys)
+		}
+		return []string{"CREATE TABLE IF NOT EXISTS " + table + " (\n\t" + strings.Join(definitions, ",\n\t") + "\n) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin"}
+	}
+
+	if match := mysqlAddColumnPattern.FindStringSubmatch(statement); match != nil {
+		return []string{"ALTER TABLE " + match[1] + " ADD COLUMN " + adaptMySQLColumn(match[1], strings.TrimSpace(match[2]), keys)}
+	}
+
+	if match := mysqlCreateIndexPattern.FindStringSubmatch(statement); match != nil {
+		unique, name, table, columns, where := match[1], match[2], match[3], strings.TrimSpace(match[4]), strings.TrimSpace(match[5])
+		// 表达式索引（MariaDB 不支持）跳过，相关列已有普通索引
+		if strings.Contains(columns, "(") {
+			return nil
+		}
+		createSQL := "CREATE " + unique + "INDEX " + name + " ON " + table + "(" + columns + ")"
+		if where == "" {
+			return []string{createSQL}
+		}
+		// 唯一索引本就允许多个 NULL，WHERE col IS NOT NULL 的部分索引可直接去掉条件
+		if notNull := mysqlNotNullPattern.FindStringSubmatch(where); notNull != nil && strings.Contains(columns, notNull[1]) {
+			return []string{createSQL}
+		}
+		// 单列部分唯一索引改为生成列上的唯一索引：条件不成立时生成列为 NULL，不参与唯一性检查
+		if unique != "" && !strings.Contains(columns, ",") {
+			generated := name + "_col"
+			return []string{
+				"ALTER TABLE " + table + " ADD COLUMN " + generated + " " + mysqlKeyColumnType + " GENERATED ALWAYS AS (CASE WHEN " + where + " THEN " + columns + " END) VIRTUAL",
+				"CREATE UNIQUE INDEX " + name + " ON " + table + "(" + generated + ")",
+			}
+		}
+		return nil
+	}
+
+	// MySQL 库从当前结构建表，不存在需要清理的历史索引
+	if mysqlDropIndexPattern.MatchString(statement) {
+		return nil
+	}
+	return []string{statement}
+}
+
+func adaptMySQLColumn(table, definition string, keys map[string]bool) string {
+	definition = strings.TrimSpace(definition)
+	match := mysqlColumnPattern.FindStringSubmatch(definition)
+	if match == nil {
+		return definition
+	}
+
+	column, columnType, rest := match[1], strings.ToUpper(match[2]), match[3]
+	switch columnType {
+	case "TEXT":
+		if keys[table+"."+column] || mysqlInlineKeyPattern.MatchString(rest) {
+			columnType = mysqlKeyColumnType
+		} else {
+			// TEXT/BLOB 列只接受表达式默认值
+			columnType = "LONGTEXT"
+			rest = mysqlTextDefaultPattern.ReplaceAllString(rest, "DEFAULT ($1)")
+		}
+	case "INTEGER", "BIGINT":
+		columnType = "BIGINT"
+	case "REAL":
+		columnType = "DOUBLE"
+	case "DATETIME", "TIMESTAMPTZ":
+		columnType = "DATETIME(6)"
+		rest = strings.ReplaceAll(rest, "CURRENT_TIMESTAMP", "CURRENT_TIMESTAMP(6)")
+	}
+	return column + " " + columnType + rest
+}
+
+// splitTopLevel 按不在括号与引号内的逗号拆分列定义
+func splitTopLevel(body string) []string {
+	masked := maskSQLLiterals(body)
+	var parts []string
+	depth := 0
+	last := 0
+	for index := 0; index < len(masked); index++ {
+		switch masked[index] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(body[last:index]))
+				last = index + 1
+			}
+		}
+	}
+	if tail := strings.TrimSpace(body[last:]); tail != "" {
+		parts = append(parts, tail)
+	}
+	return parts
+}
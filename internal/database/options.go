@@ -10,12 +10,18 @@ type DBType string
 const (
 	DBTypeSQLite   DBType = "sqlite"
 	DBTypePostgres DBType = "postgres"
+	// DBTypeMySQL 同时适用于 MariaDB（DB_TYPE=mariadb 归一为 mysql）
+	DBTypeMySQL DBType = "mysql"
 )
 
 type Options struct {
 	Type        DBType
 	DatabaseURL string
 	SQLitePath  string
+	// ReadDatabaseURL PostgreSQL / MySQL 只读副本连接串，为空时分析查询使用主库
+	ReadDatabaseURL string
+	// ReadPoolSize 分析查询连接池大小；SQLite 下为 0 时不单独建立只读连接池
+	ReadPoolSize int
 }
 
 func (options Options) Normalize() (Options, error) {
@@ -24,6 +30,13 @@ func (options Options) Normalize() (Options, error) {
 	if normalized.Type == "" {
 		normalized.Type = DBTypeSQLite
 	}
+	if normalized.Type == "mariadb" {
+		normalized.Type = DBTypeMySQL
+	}
+
+	if normalized.ReadPoolSize < 0 {
+		normalized.ReadPoolSize = 0
+	}
 
 	switch normalized.Type {
 	case DBTypeSQLite:
@@ -34,6 +47,10 @@ func (options Options) Normalize() (Options, error) {
 		if strings.TrimSpace(normalized.DatabaseURL) == "" {
 			return normalized, fmt.Errorf("DATABASE_URL is required when DB_TYPE=postgres")
 		}
+	case DBTypeMySQL:
+		if strings.TrimSpace(normalized.DatabaseURL) == "" {
+			return normalized, fmt.Errorf("DATABASE_URL is required when DB_TYPE=mysql")
+		}
 	default:
 		return normalized, fmt.Errorf("unsupported DB_TYPE: %s", normalized.Type)
 	}
@@ -13,7 +13,9 @@ import (
 )
 
 var (
-	db        *sql.DB
+	db *sql.DB
+	// readDB 分析查询使用的只读连接，未配置时为 nil
+	readDB    *sql.DB
 	dbPath    string
 	dbType    DBType
 	dbOptions Options
@@ -58,6 +60,7 @@ func initDB(options Options) error {
 	if existing := db; existing != nil {
 		_ = existing.Close()
 	}
+	closeReadDB()
 
 	db = newDB
 	dbPath = resolvedPath
@@ -68,7 +71,83 @@ func initDB(options Options) error {
 	if err := createTables(); err != nil {
 		return err
 	}
-	return runMigrations()
+	if err := runMigrations(); err != nil {
+		return err
+	}
+
+	// 建表完成后再打开只读连接，SQLite 只读连接池要求数据库文件已存在
+	newReadDB, err := openReadDB(options)
+	if err != nil {
+		return fmt.Errorf("open read-only database: %w", err)
+	}
+	readDB = newReadDB
+	return nil
+}
+
+// openReadDB 打开分析查询使用的只读连接，未配置时返回 nil
+func openReadDB(options Options) (*sql.DB, error) {
+	switch options.Type {
+	case DBTypeSQLite:
+		if options.ReadPoolSize <= 0 {
+			return nil, nil
+		}
+		return openSQLiteReadPool(options.SQLitePath, options.ReadPoolSize)
+	case DBTypePostgres:
+		if options.ReadDatabaseURL == "" {
+			return nil, nil
+		}
+		newDB, _, err := openPostgresDB(options.ReadDatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		if options.ReadPoolSize > 0 {
+			newDB.SetMaxOpenConns(options.ReadPoolSize)
+			newDB.SetMaxIdleConns(options.ReadPoolSize)
+		}
+		return newDB, nil
+	case DBTypeMySQL:
+		if options.ReadDatabaseURL == "" {
+			return nil, nil
+		}
+		newDB, _, err := openMySQLDB(options.ReadDatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		if options.ReadPoolSize > 0 {
+			newDB.SetMaxOpenConns(options.ReadPoolSize)
+			newDB.SetMaxIdleConns(options.ReadPoolSize)
+		}
+		return newDB, nil
+	default:
+		return nil, nil
+	}
+}
+
+// openSQLiteReadPool 在同一数据库文件上打开独立的只读连接池
+// WAL 模式下读连接不会阻塞日志写入器与计费的写事务
+func openSQLiteReadPool(path string, size int) (*sql.DB, error) {
+	dsn := path + "?_pragma=busy_timeout(5000)&_pragma=query_only(ON)"
+	newDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = newDB.Ping(); err != nil {
+		newDB.Close()
+		return nil, err
+	}
+
+	newDB.SetMaxOpenConns(size)
+	newDB.SetMaxIdleConns(size)
+	newDB.SetConnMaxLifetime(time.Hour)
+
+	return newDB, nil
+}
+
+func closeReadDB() {
+	if readDB != nil {
+		_ = readDB.Close()
+		readDB = nil
+	}
 }
 
 func openDB(options Options) (*sql.DB, string, error) {
@@ -77,6 +156,8 @@ func openDB(options Options) (*sql.DB, string, error) {
 		return openSQLiteDB(options.SQLitePath)
 	case DBTypePostgres:
 		return openPostgresDB(options.DatabaseURL)
+	case DBTypeMySQL:
+		return openMySQLDB(options.DatabaseURL)
 	default:
 		return nil, "", fmt.Errorf("unsupported DB_TYPE: %s", options.Type)
 	}
@@ -161,17 +242,65 @@ func IsPostgres() bool {
 	return dbType == DBTypePostgres
 }
 
+func IsMySQL() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return dbType == DBTypeMySQL
+}
+
+// HasArchiveTable 返回请求详情归档是否为主库中的 request_log_details_archive 表（PostgreSQL / MySQL）；
+// SQLite 的归档位于独立的归档库文件
+func HasArchiveTable() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return dbType != DBTypeSQLite
+}
+
 func SupportsFileBackups() bool {
 	return IsSQLite()
 }
 
+// DayBucketExprIn 按指定时区的自然日分桶，结果格式为 YYYY-MM-DD；loc 为空或 UTC 时等同于 DayBucketExpr。
+// PostgreSQL 按时区规则换算（含夏令时）；SQLite 没有时区数据库、MySQL 的时区表通常未加载，二者按当前 UTC 偏移换算，
+// 跨越夏令时切换的范围内切换前的日期边界会偏差一小时
+func DayBucketExprIn(column string, loc *time.Location) string {
+	if loc == nil || loc == time.UTC {
+		return DayBucketExpr(column)
+	}
+	if IsPostgres() {
+		return fmt.Sprintf("TO_CHAR(%s AT TIME ZONE '%s', 'YYYY-MM-DD')", column, strings.ReplaceAll(loc.String(), "'", "''"))
+	}
+	_, offset := time.Now().In(loc).Zone()
+	if offset == 0 {
+		return DayBucketExpr(column)
+	}
+	if IsMySQL() {
+		return fmt.Sprintf("DATE_FORMAT(DATE_ADD(%s, INTERVAL %d SECOND), '%%Y-%%m-%%d')", column, offset)
+	}
+	return fmt.Sprintf("date(substr(%s, 1, 19), '%+d seconds')", column, offset)
+}
+
 func DayBucketExpr(column string) string {
 	if IsPostgres() {
 		return fmt.Sprintf("TO_CHAR(%s AT TIME ZONE 'UTC', 'YYYY-MM-DD')", column)
 	}
+	if IsMySQL() {
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d')", column)
+	}
 	return fmt.Sprintf("substr(%s, 1, 10)", column)
 }
 
+// HourBucketExpr 按 UTC 小时分桶，结果格式为 YYYY-MM-DD HH
+func HourBucketExpr(column string) string {
+	if IsPostgres() {
+		return fmt.Sprintf("TO_CHAR(%s AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24')", column)
+	}
+	if IsMySQL() {
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H')", column)
+	}
+	return fmt.Sprintf("substr(%s, 1, 13)", column)
+}
+
 func Rebind(query string) string {
 	if IsPostgres() {
 		return rewritePlaceholders(query)
@@ -199,6 +328,7 @@ func CloseAndRelease() error {
 		if dbType == DBTypeSQLite {
 			_, _ = db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
 		}
+		closeReadDB()
 		err := db.Close()
 		db = nil
 		return err
@@ -222,6 +352,23 @@ func GetDB() *sql.DB {
 	return db
 }
 
+// GetReadDB 返回分析查询使用的只读连接，未配置只读副本或连接池时返回主连接
+func GetReadDB() *sql.DB {
+	mu.RLock()
+	defer mu.RUnlock()
+	if readDB != nil {
+		return readDB
+	}
+	return db
+}
+
+// HasReadDB 返回是否配置了独立的只读连接
+func HasReadDB() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return readDB != nil
+}
+
 // GetPath returns the database file path.
 func GetPath() string {
 	mu.RLock()
@@ -229,8 +376,8 @@ func GetPath() string {
 	return dbPath
 }
 
-func createTables() error {
-	schema := `
+// baseSchema 建表语句（SQLite 方言），PostgreSQL 与 MySQL 在 createTables 中按方言转换
+const baseSchema = `
 	CREATE TABLE IF NOT EXISTS groups (
 		id TEXT PRIMARY KEY,
 		name TEXT UNIQUE NOT NULL,
@@ -289,6 +436,13 @@ func createTables() error {
 		priority INTEGER NOT NULL DEFAULT 100,
 		models_json TEXT NOT NULL DEFAULT '[]',
 		headers_json TEXT NOT NULL DEFAULT '{}',
+		anthropic_beta_policy_json TEXT NOT NULL DEFAULT '',
+		header_policy_json TEXT NOT NULL DEFAULT '',
+		api_keys_json TEXT NOT NULL DEFAULT '[]',
+		key_strategy TEXT NOT NULL DEFAULT '',
+		translation_mode TEXT NOT NULL DEFAULT '',
+		federation_issuer TEXT NOT NULL DEFAULT '',
+		dns_policy_json TEXT NOT NULL DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -305,6 +459,29 @@ func createTables() error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_user_groups_group ON user_groups(group_id);
 
+	CREATE TABLE IF NOT EXISTS group_admins (
+		group_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (group_id, user_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_group_admins_user ON group_admins(user_id);
+
+	CREATE TABLE IF NOT EXISTS user_email_tokens (
+		token_hash TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		purpose TEXT NOT NULL,
+		email TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_email_tokens_user ON user_email_tokens(user_id, purpose);
+
 	CREATE TABLE IF NOT EXISTS channel_groups (
 		channel_id TEXT NOT NULL,
 		group_id TEXT NOT NULL,
@@ -320,10 +497,24 @@ func createTables() error {
 		model_id TEXT NOT NULL,
 		display_name TEXT NOT NULL DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at DATETIME,
+		removed_at DATETIME,
 		FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
 	);
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_channel_models_unique ON channel_models(channel_id, model_id);
 
+	CREATE TABLE IF NOT EXISTS channel_oauth_tokens (
+		channel_id TEXT PRIMARY KEY,
+		access_token TEXT NOT NULL DEFAULT '',
+		refresh_token TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME,
+		scope TEXT NOT NULL DEFAULT '',
+		last_refresh_at DATETIME,
+		last_error TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+	);
+
 	CREATE TABLE IF NOT EXISTS model_metadata (
 		id TEXT PRIMARY KEY,
 		model_pattern TEXT UNIQUE NOT NULL,
@@ -368,7 +559,10 @@ func createTables() error {
 		rate_multiplier REAL,
 		charged_subscription_micros INTEGER NOT NULL DEFAULT 0,
 		charged_balance_micros INTEGER NOT NULL DEFAULT 0,
-		billing_status TEXT NOT NULL DEFAULT 'none'
+		billing_status TEXT NOT NULL DEFAULT 'none',
+		attempts_json TEXT,
+		on_behalf_of TEXT,
+		trace_id TEXT
 	);
 	CREATE INDEX IF NOT EXISTS idx_request_logs_user_time ON request_logs(user_id, created_at DESC);
 	CREATE INDEX IF NOT EXISTS idx_request_logs_apikey_time ON request_logs(api_key_id, created_at DESC);
@@ -413,6 +607,8 @@ func createTables() error {
 		name TEXT UNIQUE NOT NULL,
 		description TEXT NOT NULL DEFAULT '',
 		enabled INTEGER NOT NULL DEFAULT 1,
+		reset_timezone TEXT NOT NULL DEFAULT '',
+		reset_hour INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -465,6 +661,10 @@ func createTables() error {
 		source TEXT NOT NULL CHECK (source IN ('subscription', 'balance')),
 		event_type TEXT NOT NULL CHECK (event_type IN ('charge', 'refund', 'adjustment')),
 		amount_micros INTEGER NOT NULL CHECK (amount_micros >= 0),
+		direction TEXT NOT NULL DEFAULT '',
+		reason TEXT NOT NULL DEFAULT '',
+		actor TEXT NOT NULL DEFAULT '',
+		balance_after_micros INTEGER,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
 		FOREIGN KEY (user_subscription_id) REFERENCES user_subscriptions(id) ON DELETE CASCADE
@@ -473,7 +673,188 @@ func createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_billing_events_user_created ON billing_events(user_id, created_at DESC);
 	CREATE INDEX IF NOT EXISTS idx_billing_events_request_created ON billing_events(request_log_id, created_at DESC);
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_billing_events_idempotent ON billing_events(request_log_id, source, event_type) WHERE request_log_id IS NOT NULL;
+
+	CREATE TABLE IF NOT EXISTS saved_log_views (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		filters_json TEXT NOT NULL DEFAULT '{}',
+		pinned INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_saved_log_views_user_name ON saved_log_views(user_id, name);
+
+	CREATE TABLE IF NOT EXISTS channel_templates (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT '',
+		type TEXT NOT NULL,
+		endpoint TEXT NOT NULL DEFAULT '',
+		base_url TEXT NOT NULL DEFAULT '',
+		weight INTEGER NOT NULL DEFAULT 1,
+		priority INTEGER NOT NULL DEFAULT 100,
+		model_whitelist INTEGER NOT NULL DEFAULT 0,
+		simulate_cli INTEGER NOT NULL DEFAULT 0,
+		models_json TEXT NOT NULL DEFAULT '[]',
+		headers_json TEXT NOT NULL DEFAULT '{}',
+		group_ids_json TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS feature_flags (
+		key TEXT PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		enabled INTEGER NOT NULL DEFAULT 0,
+		group_ids_json TEXT NOT NULL DEFAULT '[]',
+		rollout_percent INTEGER NOT NULL DEFAULT 100,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS rate_limits (
+		scope TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		requests_per_minute INTEGER NOT NULL DEFAULT 0,
+		tokens_per_minute INTEGER NOT NULL DEFAULT 0,
+		max_concurrent INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (scope, target_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS settings_templates (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT '',
+		kind TEXT NOT NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		content_json TEXT NOT NULL DEFAULT '{}',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS settings_template_versions (
+		template_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		content_json TEXT NOT NULL DEFAULT '{}',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (template_id, version),
+		FOREIGN KEY (template_id) REFERENCES settings_templates(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS user_settings_templates (
+		user_id TEXT NOT NULL,
+		template_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		pinned INTEGER NOT NULL DEFAULT 0,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, template_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (template_id) REFERENCES settings_templates(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_settings_templates_template ON user_settings_templates(template_id);
+
+	CREATE TABLE IF NOT EXISTS scheduled_changes (
+		id TEXT PRIMARY KEY,
+		kind TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		payload_json TEXT NOT NULL DEFAULT '{}',
+		previous_json TEXT NOT NULL DEFAULT '',
+		note TEXT NOT NULL DEFAULT '',
+		apply_at DATETIME NOT NULL,
+		revert_at DATETIME,
+		status TEXT NOT NULL DEFAULT 'pending',
+		applied_at DATETIME,
+		reverted_at DATETIME,
+		error TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_changes_status ON scheduled_changes(status, apply_at);
+
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		issuer TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		last_login_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_subject ON user_identities(issuer, subject);
+	CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
+	CREATE TABLE IF NOT EXISTS audit_logs (
+		id TEXT PRIMARY KEY,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL DEFAULT '',
+		target_id TEXT NOT NULL DEFAULT '',
+		detail_json TEXT NOT NULL DEFAULT '{}',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_logs_created ON audit_logs(created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_logs_target ON audit_logs(target_type, target_id);
+
+	CREATE TABLE IF NOT EXISTS usage_rollups (
+		resolution TEXT NOT NULL,
+		bucket TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		requests INTEGER NOT NULL DEFAULT 0,
+		errors INTEGER NOT NULL DEFAULT 0,
+		input_tokens INTEGER NOT NULL DEFAULT 0,
+		output_tokens INTEGER NOT NULL DEFAULT 0,
+		cache_read_tokens INTEGER NOT NULL DEFAULT 0,
+		cost_micros INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (resolution, bucket, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_usage_rollups_user ON usage_rollups(user_id, resolution, bucket);
+
+	CREATE TABLE IF NOT EXISTS batch_jobs (
+		id TEXT PRIMARY KEY,
+		provider TEXT NOT NULL,
+		upstream_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		api_key_id TEXT NOT NULL DEFAULT '',
+		channel_id TEXT NOT NULL,
+		model TEXT NOT NULL DEFAULT '',
+		rate_multiplier REAL NOT NULL DEFAULT 1,
+		request_count INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'in_progress',
+		item_count INTEGER NOT NULL DEFAULT 0,
+		cost_micros INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		settled_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_batch_jobs_upstream ON batch_jobs(provider, upstream_id);
+	CREATE INDEX IF NOT EXISTS idx_batch_jobs_user ON batch_jobs(user_id, provider, created_at);
+	CREATE INDEX IF NOT EXISTS idx_batch_jobs_status ON batch_jobs(status);
+
+	CREATE TABLE IF NOT EXISTS group_budget_alerts (
+		id TEXT PRIMARY KEY,
+		group_id TEXT NOT NULL,
+		month TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		threshold_percent INTEGER NOT NULL,
+		budget_micros INTEGER NOT NULL DEFAULT 0,
+		spend_micros INTEGER NOT NULL DEFAULT 0,
+		forecast_micros INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_group_budget_alerts_once ON group_budget_alerts(group_id, month, kind, threshold_percent);
+	CREATE INDEX IF NOT EXISTS idx_group_budget_alerts_time ON group_budget_alerts(created_at DESC);
 	`
+
+func createTables() error {
+	schema := baseSchema
 	if dbType == DBTypePostgres {
 		schema = strings.ReplaceAll(schema, "DATETIME", "TIMESTAMPTZ")
 		replacer := strings.NewReplacer(
@@ -487,6 +868,15 @@ func createTables() error {
 			"charged_balance_micros INTEGER NOT NULL DEFAULT 0", "charged_balance_micros BIGINT NOT NULL DEFAULT 0",
 			"limit_micros INTEGER NOT NULL CHECK (limit_micros >= 0)", "limit_micros BIGINT NOT NULL CHECK (limit_micros >= 0)",
 			"amount_micros INTEGER NOT NULL CHECK (amount_micros >= 0)", "amount_micros BIGINT NOT NULL CHECK (amount_micros >= 0)",
+			"balance_after_micros INTEGER,", "balance_after_micros BIGINT,",
+			"tokens_per_minute INTEGER NOT NULL DEFAULT 0", "tokens_per_minute BIGINT NOT NULL DEFAULT 0",
+			"input_tokens INTEGER NOT NULL DEFAULT 0", "input_tokens BIGINT NOT NULL DEFAULT 0",
+			"output_tokens INTEGER NOT NULL DEFAULT 0", "output_tokens BIGINT NOT NULL DEFAULT 0",
+			"cache_read_tokens INTEGER NOT NULL DEFAULT 0", "cache_read_tokens BIGINT NOT NULL DEFAULT 0",
+			"cost_micros INTEGER NOT NULL DEFAULT 0", "cost_micros BIGINT NOT NULL DEFAULT 0",
+			"budget_micros INTEGER NOT NULL DEFAULT 0", "budget_micros BIGINT NOT NULL DEFAULT 0",
+			"spend_micros INTEGER NOT NULL DEFAULT 0", "spend_micros BIGINT NOT NULL DEFAULT 0",
+			"forecast_micros INTEGER NOT NULL DEFAULT 0", "forecast_micros BIGINT NOT NULL DEFAULT 0",
 		)
 		schema = replacer.Replace(schema)
 		schema += `
@@ -498,11 +888,17 @@ func createTables() error {
 			response_headers TEXT,
 			response_body TEXT,
 			translated_response_body TEXT,
+			redaction_count INTEGER NOT NULL DEFAULT 0,
+			injected_system_prompt TEXT NOT NULL DEFAULT '',
+			pii_redactions TEXT NOT NULL DEFAULT '',
 			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);
 		CREATE INDEX IF NOT EXISTS idx_request_log_details_archive_created ON request_log_details_archive(created_at DESC);
 		`
 	}
+	if dbType == DBTypeMySQL {
+		return execMySQLSchema(db, adaptMySQLSchema(schema+";"+mysqlArchiveSchema, mysqlSchemaKeyColumns()))
+	}
 
 	return execStatements(db, schema)
 }
@@ -512,10 +908,44 @@ func runMigrations() error {
 		return fmt.Errorf("ensure schema_migrations table failed: %w", err)
 	}
 
-	migrations := []struct {
-		name string
-		sql  string
-	}{
+	migrations := schemaMigrations()
+
+	for _, m := range migrations {
+		applied, err := isMigrationApplied(m.name)
+		if err != nil {
+			return fmt.Errorf("check migration '%s' failed: %w", m.name, err)
+		}
+		if applied {
+			continue
+		}
+
+		err = execStatements(db, adaptMigrationSQL(m.name, m.sql))
+		if err != nil && !shouldIgnoreMigrationError(m.name, err) {
+			return fmt.Errorf("migration '%s' failed: %w", m.name, err)
+		}
+
+		if err := markMigrationApplied(m.name); err != nil {
+			return fmt.Errorf("mark migration '%s' applied failed: %w", m.name, err)
+		}
+	}
+
+	if dbType == DBTypeSQLite {
+		if err := migrateTimestampsToUTC(db); err != nil {
+			return fmt.Errorf("migrate timestamps to UTC failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type schemaMigration struct {
+	name string
+	sql  string
+}
+
+// schemaMigrations 按顺序执行的增量迁移，已执行的按名称记录在 schema_migrations
+func schemaMigrations() []schemaMigration {
+	return []schemaMigration{
 		{
 			name: "add_api_key_column",
 			sql:  `ALTER TABLE user_api_keys ADD COLUMN api_key TEXT NOT NULL DEFAULT ''`,
@@ -775,34 +1205,198 @@ func runMigrations() error {
 					DROP INDEX IF EXISTS idx_billing_events_request;
 				`,
 		},
+		{
+			name: "add_request_logs_attempts_json",
+			sql:  `ALTER TABLE request_logs ADD COLUMN attempts_json TEXT`,
+		},
+		{
+			name: "add_channels_version",
+			sql:  `ALTER TABLE channels ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+		{
+			name: "add_groups_version",
+			sql:  `ALTER TABLE groups ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+		{
+			name: "add_subscription_plans_version",
+			sql:  `ALTER TABLE subscription_plans ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+		{
+			name: "add_user_amp_settings_version",
+			sql:  `ALTER TABLE user_amp_settings ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+		{
+			name: "add_channels_anthropic_beta_policy",
+			sql:  `ALTER TABLE channels ADD COLUMN anthropic_beta_policy_json TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_channels_header_policy",
+			sql:  `ALTER TABLE channels ADD COLUMN header_policy_json TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_groups_max_request_cost",
+			sql:  `ALTER TABLE groups ADD COLUMN max_request_cost_micros INTEGER NOT NULL DEFAULT 0`,
+		},
+		{
+			name: "add_channels_api_keys",
+			sql: `
+					ALTER TABLE channels ADD COLUMN api_keys_json TEXT NOT NULL DEFAULT '[]';
+					ALTER TABLE channels ADD COLUMN key_strategy TEXT NOT NULL DEFAULT '';
+				`,
+		},
+		{
+			name: "add_user_amp_settings_post_processing",
+			sql:  `ALTER TABLE user_amp_settings ADD COLUMN post_processing_json TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_channels_translation_mode",
+			sql:  `ALTER TABLE channels ADD COLUMN translation_mode TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_groups_pipeline",
+			sql:  `ALTER TABLE groups ADD COLUMN pipeline_json TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_user_amp_settings_system_prompt",
+			sql:  `ALTER TABLE user_amp_settings ADD COLUMN system_prompt TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_channels_federation_issuer",
+			sql:  `ALTER TABLE channels ADD COLUMN federation_issuer TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_request_logs_on_behalf_of",
+			sql:  `ALTER TABLE request_logs ADD COLUMN on_behalf_of TEXT`,
+		},
+		{
+			name: "add_channel_models_last_seen_at",
+			sql:  `ALTER TABLE channel_models ADD COLUMN last_seen_at DATETIME`,
+		},
+		{
+			name: "add_channel_models_removed_at",
+			sql:  `ALTER TABLE channel_models ADD COLUMN removed_at DATETIME`,
+		},
+		{
+			name: "add_channels_dns_policy_json",
+			sql:  `ALTER TABLE channels ADD COLUMN dns_policy_json TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_billing_events_direction",
+			sql:  `ALTER TABLE billing_events ADD COLUMN direction TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_billing_events_reason",
+			sql:  `ALTER TABLE billing_events ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_billing_events_actor",
+			sql:  `ALTER TABLE billing_events ADD COLUMN actor TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_billing_events_balance_after_micros",
+			sql:  `ALTER TABLE billing_events ADD COLUMN balance_after_micros INTEGER`,
+		},
+		{
+			name: "add_users_timezone",
+			sql:  `ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_subscription_plans_reset_timezone",
+			sql:  `ALTER TABLE subscription_plans ADD COLUMN reset_timezone TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_subscription_plans_reset_hour",
+			sql:  `ALTER TABLE subscription_plans ADD COLUMN reset_hour INTEGER NOT NULL DEFAULT 0`,
+		},
+		{
+			name: "add_request_logs_trace_id",
+			sql:  `ALTER TABLE request_logs ADD COLUMN trace_id TEXT`,
+		},
+		{
+			name: "add_request_logs_trace_id_index",
+			sql:  `CREATE INDEX IF NOT EXISTS idx_request_logs_trace_id ON request_logs(trace_id)`,
+		},
+		{
+			name: "add_users_suspended_at",
+			sql:  `ALTER TABLE users ADD COLUMN suspended_at DATETIME`,
+		},
+		{
+			name: "add_users_suspended_until",
+			sql:  `ALTER TABLE users ADD COLUMN suspended_until DATETIME`,
+		},
+		{
+			name: "add_users_suspension_reason",
+			sql:  `ALTER TABLE users ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_users_suspension_message",
+			sql:  `ALTER TABLE users ADD COLUMN suspension_message TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_users_suspended_by",
+			sql:  `ALTER TABLE users ADD COLUMN suspended_by TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_rate_limits_max_concurrent",
+			sql:  `ALTER TABLE rate_limits ADD COLUMN max_concurrent INTEGER NOT NULL DEFAULT 0`,
+		},
+		{
+			name: "add_users_email",
+			sql:  `ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_users_email_verified_at",
+			sql:  `ALTER TABLE users ADD COLUMN email_verified_at DATETIME`,
+		},
+		{
+			name: "add_users_email_index",
+			sql:  `CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`,
+		},
+		{
+			name: "add_users_password_changed_at",
+			sql:  `ALTER TABLE users ADD COLUMN password_changed_at DATETIME`,
+		},
+		{
+			name: "backfill_users_password_changed_at",
+			sql:  `UPDATE users SET password_changed_at = created_at WHERE password_changed_at IS NULL`,
+		},
+		{
+			name: "add_users_password_must_change",
+			sql:  `ALTER TABLE users ADD COLUMN password_must_change INTEGER NOT NULL DEFAULT 0`,
+		},
+		{
+			name: "add_request_logs_usage_estimated",
+			sql:  `ALTER TABLE request_logs ADD COLUMN usage_estimated INTEGER NOT NULL DEFAULT 0`,
+		},
+		{
+			name: "add_user_api_keys_scopes",
+			sql:  `ALTER TABLE user_api_keys ADD COLUMN scopes_json TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_request_log_details_redaction_count",
+			sql:  `ALTER TABLE request_log_details ADD COLUMN redaction_count INTEGER NOT NULL DEFAULT 0`,
+		},
+		{
+			name: "add_groups_monthly_budget",
+			sql:  `ALTER TABLE groups ADD COLUMN monthly_budget_micros INTEGER NOT NULL DEFAULT 0`,
+		},
+		{
+			name: "add_groups_system_prompt",
+			sql:  `ALTER TABLE groups ADD COLUMN system_prompt TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_request_log_details_injected_system_prompt",
+			sql:  `ALTER TABLE request_log_details ADD COLUMN injected_system_prompt TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "add_request_log_details_pii_redactions",
+			sql:  `ALTER TABLE request_log_details ADD COLUMN pii_redactions TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "postgres_widen_groups_max_request_cost_micros",
+			sql:  `ALTER TABLE groups ALTER COLUMN max_request_cost_micros TYPE BIGINT`,
+		},
 	}
-
-	for _, m := range migrations {
-		applied, err := isMigrationApplied(m.name)
-		if err != nil {
-			return fmt.Errorf("check migration '%s' failed: %w", m.name, err)
-		}
-		if applied {
-			continue
-		}
-
-		err = execStatements(db, adaptMigrationSQL(m.name, m.sql))
-		if err != nil && !shouldIgnoreMigrationError(m.name, err) {
-			return fmt.Errorf("migration '%s' failed: %w", m.name, err)
-		}
-
-		if err := markMigrationApplied(m.name); err != nil {
-			return fmt.Errorf("mark migration '%s' applied failed: %w", m.name, err)
-		}
-	}
-
-	if dbType == DBTypeSQLite {
-		if err := migrateTimestampsToUTC(db); err != nil {
-			return fmt.Errorf("migrate timestamps to UTC failed: %w", err)
-		}
-	}
-
-	return nil
 }
 
 func adaptMigrationSQL(name string, sqlText string) string {
@@ -814,6 +1408,15 @@ func adaptMigrationSQL(name string, sqlText string) string {
 	switch name {
 	case "add_request_detail_retention_default":
 		adapted = `INSERT INTO system_config (key, value, updated_at) VALUES ('request_detail_retention_days', '30', CURRENT_TIMESTAMP) ON CONFLICT (key) DO NOTHING`
+		if dbType == DBTypeMySQL {
+			// MySQL 不允许 UPDATE 的子查询引用被修改的表，直接写入改名后的键
+			adapted = `INSERT INTO system_config (key, value, updated_at) VALUES ('request_detail_archive_days', '30', CURRENT_TIMESTAMP) ON CONFLICT (key) DO NOTHING`
+		}
+	case "rename_retention_to_archive_days", "migrate_proxy_tokens", "drop_legacy_users_group_id", "drop_legacy_channels_group_id":
+		// MySQL 库从当前结构建表，不存在旧键、旧表与旧列
+		if dbType == DBTypeMySQL {
+			adapted = ""
+		}
 	case "add_user_balance_micros":
 		if dbType == DBTypePostgres {
 			adapted = `ALTER TABLE users ADD COLUMN balance_micros BIGINT NOT NULL DEFAULT 0`
@@ -830,11 +1433,26 @@ func adaptMigrationSQL(name string, sqlText string) string {
 		if dbType == DBTypePostgres {
 			adapted = `ALTER TABLE request_logs ADD COLUMN charged_balance_micros BIGINT NOT NULL DEFAULT 0`
 		}
-	case "postgres_widen_users_balance_micros", "postgres_widen_request_logs_micros_columns", "postgres_widen_request_logs_token_columns", "postgres_widen_subscription_plan_limits_limit_micros", "postgres_widen_billing_events_amount_micros":
+	case "add_groups_max_request_cost":
+		if dbType == DBTypePostgres {
+			adapted = `ALTER TABLE groups ADD COLUMN max_request_cost_micros BIGINT NOT NULL DEFAULT 0`
+		}
+	case "add_groups_monthly_budget":
+		if dbType == DBTypePostgres {
+			adapted = `ALTER TABLE groups ADD COLUMN monthly_budget_micros BIGINT NOT NULL DEFAULT 0`
+		}
+	case "add_billing_events_balance_after_micros":
+		if dbType == DBTypePostgres {
+			adapted = `ALTER TABLE billing_events ADD COLUMN balance_after_micros BIGINT`
+		}
+	case "postgres_widen_users_balance_micros", "postgres_widen_request_logs_micros_columns", "postgres_widen_request_logs_token_columns", "postgres_widen_subscription_plan_limits_limit_micros", "postgres_widen_billing_events_amount_micros", "postgres_widen_groups_max_request_cost_micros":
 		if dbType != DBTypePostgres {
 			adapted = ""
 		}
 	}
+	if dbType == DBTypeMySQL {
+		adapted = adaptMySQLSchema(adapted, mysqlSchemaKeyColumns())
+	}
 
 	return adapted
 }
@@ -866,12 +1484,16 @@ func ensureSchemaMigrationsTable() error {
 	if dbType == DBTypePostgres {
 		columnType = "TIMESTAMPTZ"
 	}
-	_, err := db.Exec(fmt.Sprintf(`
+	schema := fmt.Sprintf(`
                 CREATE TABLE IF NOT EXISTS schema_migrations (
                         name TEXT PRIMARY KEY,
                         applied_at %s NOT NULL DEFAULT CURRENT_TIMESTAMP
                 )
-	`, columnType))
+	`, columnType)
+	if dbType == DBTypeMySQL {
+		schema = adaptMySQLSchema(schema, nil)
+	}
+	_, err := db.Exec(schema)
 	return err
 }
 
@@ -897,6 +1519,7 @@ func shouldIgnoreMigrationError(name string, err error) bool {
 	msg := strings.ToLower(err.Error())
 
 	if strings.Contains(msg, "duplicate column name") ||
+		strings.Contains(msg, "duplicate key name") ||
 		strings.Contains(msg, "already exists") ||
 		strings.Contains(msg, "unique constraint failed") ||
 		strings.Contains(msg, "duplicate key value") {
@@ -1016,6 +1639,7 @@ func migrateTimestampsToUTC(db *sql.DB) error {
 func Close() error {
 	mu.Lock()
 	defer mu.Unlock()
+	closeReadDB()
 	if db != nil {
 		err := db.Close()
 		db = nil
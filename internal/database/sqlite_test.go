@@ -0,0 +1,62 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var microsIntegerColumnPattern = regexp.MustCompile(`(?i)\b\w+_micros\s+INTEGER\b`)
+
+func TestAdaptMigrationSQLForPostgres(t *testing.T) {
+	withDBType(t, DBTypePostgres)
+
+	cases := map[string]string{
+		"add_groups_max_request_cost":                   "ALTER TABLE groups ADD COLUMN max_request_cost_micros BIGINT NOT NULL DEFAULT 0",
+		"add_groups_monthly_budget":                     "ALTER TABLE groups ADD COLUMN monthly_budget_micros BIGINT NOT NULL DEFAULT 0",
+		"add_billing_events_balance_after_micros":       "ALTER TABLE billing_events ADD COLUMN balance_after_micros BIGINT",
+		"postgres_widen_groups_max_request_cost_micros": "ALTER TABLE groups ALTER COLUMN max_request_cost_micros TYPE BIGINT",
+	}
+	found := make(map[string]bool)
+	for _, migration := range schemaMigrations() {
+		want, ok := cases[migration.name]
+		if !ok {
+			continue
+		}
+		found[migration.name] = true
+		if got := adaptMigrationSQL(migration.name, migration.sql); got != want {
+			t.Errorf("%s:\n got  %q\n want %q", migration.name, got, want)
+		}
+	}
+	for name := range cases {
+		if !found[name] {
+			t.Errorf("migration %s not found", name)
+		}
+	}
+}
+
+// 金额以微单位存储，PostgreSQL 的 INTEGER 只有 32 位，约 2147 美元即溢出
+func TestPostgresMicrosColumnsAreBigint(t *testing.T) {
+	withDBType(t, DBTypePostgres)
+
+	for _, migration := range schemaMigrations() {
+		adapted := adaptMigrationSQL(migration.name, migration.sql)
+		if match := microsIntegerColumnPattern.FindString(adapted); match != "" {
+			t.Errorf("%s: micros column stays 32-bit on PostgreSQL: %q", migration.name, match)
+		}
+	}
+}
+
+func TestPostgresWidenMigrationsSkippedElsewhere(t *testing.T) {
+	for _, typ := range []DBType{DBTypeSQLite, DBTypeMySQL} {
+		withDBType(t, typ)
+		for _, migration := range schemaMigrations() {
+			if !strings.HasPrefix(migration.name, "postgres_widen_") {
+				continue
+			}
+			if got := adaptMigrationSQL(migration.name, migration.sql); got != "" {
+				t.Errorf("%s on %s = %q, want skipped", migration.name, typ, got)
+			}
+		}
+	}
+}
@@ -3,9 +3,12 @@ package handler
 import (
 	"errors"
 	"net/http"
+	"strings"
 
+	"ampmanager/internal/amp"
 	"ampmanager/internal/middleware"
 	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
 	"ampmanager/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -45,8 +48,23 @@ func (h *AmpHandler) UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	if req.PostProcessing != nil {
+		pp := amp.NormalizePostProcessingSettings(*req.PostProcessing)
+		if err := amp.ValidatePostProcessingSettings(pp); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.PostProcessing = &pp
+	}
+
 	settings, err := h.ampService.UpdateSettings(userID, &req)
 	if err != nil {
+		if errors.Is(err, service.ErrSettingsConflict) {
+			// 返回最新数据供前端对比合并
+			current, _ := h.ampService.GetSettings(userID)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "current": current})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新配置失败"})
 		return
 	}
@@ -54,6 +72,11 @@ func (h *AmpHandler) UpdateSettings(c *gin.Context) {
 	c.JSON(http.StatusOK, settings)
 }
 
+// ListPostProcessors 列出可在设置中启用的响应后处理插件
+func (h *AmpHandler) ListPostProcessors(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"processors": amp.ListResponsePostProcessors()})
+}
+
 func (h *AmpHandler) TestConnection(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
@@ -92,6 +115,10 @@ func (h *AmpHandler) CreateAPIKey(c *gin.Context) {
 
 	key, err := h.ampService.CreateAPIKey(userID, &req)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKeyScopes) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 API Key 失败"})
 		return
 	}
@@ -99,6 +126,60 @@ func (h *AmpHandler) CreateAPIKey(c *gin.Context) {
 	c.JSON(http.StatusCreated, key)
 }
 
+// GenerateClientConfig 为当前用户生成 Amp CLI 配置包（会签发新的 API Key）
+func (h *AmpHandler) GenerateClientConfig(c *gin.Context) {
+	h.generateClientConfig(c, middleware.GetUserID(c))
+}
+
+// AdminGenerateClientConfig 管理员为指定用户生成 Amp CLI 配置包
+func (h *AmpHandler) AdminGenerateClientConfig(c *gin.Context) {
+	h.generateClientConfig(c, c.Param("id"))
+}
+
+func (h *AmpHandler) generateClientConfig(c *gin.Context, userID string) {
+	var req model.ClientConfigRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "请求参数错误",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	bundle, err := h.ampService.GenerateClientConfig(userID, requestBaseURL(c), &req)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成客户端配置失败"})
+		return
+	}
+
+	if c.Query("download") == "1" || c.Query("download") == "true" {
+		c.Header("Content-Disposition", `attachment; filename="amp-client-config.json"`)
+	}
+	c.JSON(http.StatusCreated, bundle)
+}
+
+// requestBaseURL 根据当前请求（含反向代理头）推断对外访问地址
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	host := c.Request.Host
+	if fwdHost := c.GetHeader("X-Forwarded-Host"); fwdHost != "" {
+		host = strings.TrimSpace(strings.Split(fwdHost, ",")[0])
+	}
+	return scheme + "://" + host
+}
+
 func (h *AmpHandler) DeleteAPIKey(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	keyID := c.Param("id")
@@ -150,6 +231,40 @@ func (h *AmpHandler) GetAPIKey(c *gin.Context) {
 	c.JSON(http.StatusOK, key)
 }
 
+// UpdateAPIKeyScopes 替换当前用户 API Key 的访问范围
+func (h *AmpHandler) UpdateAPIKeyScopes(c *gin.Context) {
+	var req model.UpdateAPIKeyScopesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	key, err := h.ampService.UpdateAPIKeyScopes(middleware.GetUserID(c), c.Param("id"), &req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "更新 API Key 访问范围失败"
+
+		if errors.Is(err, service.ErrInvalidAPIKeyScopes) {
+			status = http.StatusBadRequest
+			msg = err.Error()
+		} else if errors.Is(err, service.ErrAPIKeyNotFound) {
+			status = http.StatusNotFound
+			msg = err.Error()
+		} else if errors.Is(err, service.ErrNotOwner) {
+			status = http.StatusForbidden
+			msg = err.Error()
+		}
+
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
 func (h *AmpHandler) GetBootstrap(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
@@ -161,3 +276,121 @@ func (h *AmpHandler) GetBootstrap(c *gin.Context) {
 
 	c.JSON(http.StatusOK, bootstrap)
 }
+
+// AdminListAPIKeys 管理员（或分组管理员）查看用户的 API Key
+func (h *AmpHandler) AdminListAPIKeys(c *gin.Context) {
+	keys, err := h.ampService.ListAPIKeys(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取 API Key 列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apiKeys": keys})
+}
+
+// AdminCreateAPIKey 管理员（或分组管理员）为用户签发 API Key
+func (h *AmpHandler) AdminCreateAPIKey(c *gin.Context) {
+	var req model.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	key, err := h.ampService.AdminCreateAPIKey(middleware.GetUserID(c), c.Param("id"), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKeyScopes) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 API Key 失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// AdminDeleteAPIKey 管理员（或分组管理员）删除用户的 API Key
+func (h *AmpHandler) AdminDeleteAPIKey(c *gin.Context) {
+	err := h.ampService.AdminDeleteAPIKey(middleware.GetUserID(c), c.Param("id"), c.Param("keyId"))
+	if err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) || errors.Is(err, service.ErrNotOwner) {
+			// 不属于该用户的 Key 按不存在处理，避免跨用户探测
+			c.JSON(http.StatusNotFound, gin.H{"error": service.ErrAPIKeyNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除 API Key 失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API Key 已删除"})
+}
+
+// AdminUpdateAPIKeyScopes 管理员（或分组管理员）替换用户 API Key 的访问范围
+func (h *AmpHandler) AdminUpdateAPIKeyScopes(c *gin.Context) {
+	var req model.UpdateAPIKeyScopesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	key, err := h.ampService.AdminUpdateAPIKeyScopes(middleware.GetUserID(c), c.Param("id"), c.Param("keyId"), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKeyScopes) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrAPIKeyNotFound) || errors.Is(err, service.ErrNotOwner) {
+			// 不属于该用户的 Key 按不存在处理，避免跨用户探测
+			c.JSON(http.StatusNotFound, gin.H{"error": service.ErrAPIKeyNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新 API Key 访问范围失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// AdminGetModelMappings 管理员（或分组管理员）查看用户的模型映射
+func (h *AmpHandler) AdminGetModelMappings(c *gin.Context) {
+	mappings, err := h.ampService.GetModelMappings(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取模型映射失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappings)
+}
+
+// AdminUpdateModelMappings 管理员（或分组管理员）替换用户的模型映射
+func (h *AmpHandler) AdminUpdateModelMappings(c *gin.Context) {
+	userID := c.Param("id")
+
+	var req model.ModelMappingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	mappings, err := h.ampService.UpdateModelMappings(middleware.GetUserID(c), userID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrSettingsConflict) {
+			current, _ := h.ampService.GetModelMappings(userID)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "current": current})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新模型映射失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappings)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditLogHandler struct {
+	auditService *service.AuditLogService
+}
+
+func NewAuditLogHandler() *AuditLogHandler {
+	return &AuditLogHandler{
+		auditService: service.NewAuditLogService(),
+	}
+}
+
+// List 分页查询审计记录，可按 action、targetType、targetId 筛选
+func (h *AuditLogHandler) List(c *gin.Context) {
+	filter := model.AuditLogFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		TargetID:   c.Query("targetId"),
+	}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		filter.Page = page
+	}
+	if pageSize, err := strconv.Atoi(c.Query("pageSize")); err == nil && pageSize > 0 {
+		filter.PageSize = pageSize
+	}
+
+	result, err := h.auditService.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
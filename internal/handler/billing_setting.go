@@ -3,6 +3,7 @@ package handler
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"ampmanager/internal/middleware"
 	"ampmanager/internal/model"
@@ -15,6 +16,7 @@ type BillingSettingHandler struct {
 	billingService *service.BillingService
 	settingService *service.BillingSettingService
 	subService     *service.UserSubscriptionService
+	quotaService   *service.QuotaService
 }
 
 func NewBillingSettingHandler() *BillingSettingHandler {
@@ -22,6 +24,7 @@ func NewBillingSettingHandler() *BillingSettingHandler {
 		billingService: service.NewBillingService(),
 		settingService: service.NewBillingSettingService(),
 		subService:     service.NewUserSubscriptionService(),
+		quotaService:   service.NewQuotaService(),
 	}
 }
 
@@ -40,6 +43,22 @@ func (h *BillingSettingHandler) GetBillingState(c *gin.Context) {
 	c.JSON(http.StatusOK, state)
 }
 
+// GetQuotaReleases 获取当前订阅各额度窗口的释放计划（滑动窗口中已用额度何时重新可用）
+func (h *BillingSettingHandler) GetQuotaReleases(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	schedule, err := h.quotaService.GetReleaseSchedule(userID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取额度释放计划失败"})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
 func (h *BillingSettingHandler) UpdateBillingPriority(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	if userID == "" {
@@ -3,7 +3,9 @@ package handler
 import (
 	"errors"
 	"net/http"
+	"strings"
 
+	"ampmanager/internal/health"
 	"ampmanager/internal/model"
 	"ampmanager/internal/service"
 
@@ -11,12 +13,16 @@ import (
 )
 
 type ChannelHandler struct {
-	channelService *service.ChannelService
+	channelService  *service.ChannelService
+	importService   *service.ChannelImportService
+	templateService *service.ChannelTemplateService
 }
 
 func NewChannelHandler() *ChannelHandler {
 	return &ChannelHandler{
-		channelService: service.NewChannelService(),
+		channelService:  service.NewChannelService(),
+		importService:   service.NewChannelImportService(),
+		templateService: service.NewChannelTemplateService(),
 	}
 }
 
@@ -58,6 +64,10 @@ func (h *ChannelHandler) Create(c *gin.Context) {
 
 	channel, err := h.channelService.Create(&req)
 	if err != nil {
+		if errors.Is(err, service.ErrChannelSecret) || errors.Is(err, service.ErrChannelBetaPolicy) || errors.Is(err, service.ErrChannelHeaderPolicy) || errors.Is(err, service.ErrChannelDNSPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建渠道失败"})
 		return
 	}
@@ -83,6 +93,16 @@ func (h *ChannelHandler) Update(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, service.ErrChannelSecret) || errors.Is(err, service.ErrChannelBetaPolicy) || errors.Is(err, service.ErrChannelHeaderPolicy) || errors.Is(err, service.ErrChannelDNSPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrChannelConflict) {
+			// 返回最新数据供前端对比合并
+			current, _ := h.channelService.GetByID(id)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "current": current})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新渠道失败"})
 		return
 	}
@@ -90,6 +110,208 @@ func (h *ChannelHandler) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, channel)
 }
 
+// Import 从 CLIProxyAPI / one-api / new-api 配置导入渠道和用户，dryRun 时仅预览
+func (h *ChannelHandler) Import(c *gin.Context) {
+	var req model.ChannelImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	result, err := h.importService.Import(&req)
+	if err != nil {
+		if errors.Is(err, service.ErrImportContentInvalid) || errors.Is(err, service.ErrUnsupportedImportSource) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导入渠道失败", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Duplicate 复制渠道，可同时替换名称、Base URL 和 API Key
+func (h *ChannelHandler) Duplicate(c *gin.Context) {
+	var req model.ChannelDuplicateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	channel, err := h.templateService.Duplicate(c.Param("id"), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrChannelNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "复制渠道失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, channel)
+}
+
+// BulkCreate 按模板或现有渠道为一组 API Key 批量创建渠道
+func (h *ChannelHandler) BulkCreate(c *gin.Context) {
+	var req model.ChannelBulkCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	result, err := h.templateService.BulkCreate(&req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound), errors.Is(err, service.ErrChannelTemplateNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrBulkCreateSourceInvalid),
+			errors.Is(err, service.ErrChannelTemplateUnresolved),
+			errors.Is(err, service.ErrChannelTemplateBaseURLInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "批量创建渠道失败", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// SaveAsTemplate 将渠道配置保存为模板
+func (h *ChannelHandler) SaveAsTemplate(c *gin.Context) {
+	var req model.SaveChannelTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	tpl, err := h.templateService.SaveFromChannel(c.Param("id"), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrChannelTemplateNameExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存渠道模板失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, tpl)
+}
+
+// BulkAddModels 向多个渠道追加模型
+func (h *ChannelHandler) BulkAddModels(c *gin.Context) {
+	var req model.ChannelModelsBulkAddRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	result, err := h.channelService.BulkAddModels(&req)
+	if err != nil {
+		h.writeModelsBulkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// BulkRemoveModels 从多个渠道移除模型
+func (h *ChannelHandler) BulkRemoveModels(c *gin.Context) {
+	var req model.ChannelModelsBulkRemoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	result, err := h.channelService.BulkRemoveModels(&req)
+	if err != nil {
+		h.writeModelsBulkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// CopyModels 将渠道的模型列表复制到其他同类型渠道
+func (h *ChannelHandler) CopyModels(c *gin.Context) {
+	var req model.ChannelModelsCopyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	result, err := h.channelService.CopyModels(c.Param("id"), &req)
+	if err != nil {
+		h.writeModelsBulkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// PreviewModelRouting 预览模型的实际路由渠道
+// models: 逗号分隔的模型名，留空时预览所有渠道显式配置的模型；
+// groupIds: 携带该参数时按对应分组用户的视角过滤（空值表示无分组用户）
+func (h *ChannelHandler) PreviewModelRouting(c *gin.Context) {
+	modelNames := splitCommaQuery(c.Query("models"))
+	var groupIDs []string
+	if raw, ok := c.GetQuery("groupIds"); ok {
+		groupIDs = append([]string{}, splitCommaQuery(raw)...)
+	}
+
+	routing, err := h.channelService.PreviewModelRouting(modelNames, groupIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取路由预览失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"routing": routing})
+}
+
+func (h *ChannelHandler) writeModelsBulkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrChannelNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelModelsSourceEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新渠道模型失败"})
+	}
+}
+
+func splitCommaQuery(raw string) []string {
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func (h *ChannelHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 
@@ -133,7 +355,15 @@ func (h *ChannelHandler) SetEnabled(c *gin.Context) {
 func (h *ChannelHandler) TestConnection(c *gin.Context) {
 	id := c.Param("id")
 
-	result, err := h.channelService.TestConnection(id)
+	var req model.TestChannelRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+			return
+		}
+	}
+
+	result, err := h.channelService.TestConnection(id, &req)
 	if err != nil {
 		if errors.Is(err, service.ErrChannelNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -145,3 +375,33 @@ func (h *ChannelHandler) TestConnection(c *gin.Context) {
 
 	c.JSON(http.StatusOK, result)
 }
+
+// ListHealth 获取启用渠道的健康检查与熔断状态
+func (h *ChannelHandler) ListHealth(c *gin.Context) {
+	statuses, err := h.channelService.ListChannelHealth()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取渠道健康状态失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"config": health.GetConfig(), "channels": statuses})
+}
+
+// GetCapacity 获取渠道用量与容量建议（接近上游限流上限的渠道及建议权重）
+func (h *ChannelHandler) GetCapacity(c *gin.Context) {
+	report, err := service.BuildChannelCapacityReport()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取渠道容量建议失败"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ApplyCapacity 按当前容量建议调整渠道权重
+func (h *ChannelHandler) ApplyCapacity(c *gin.Context) {
+	report, err := service.ApplyChannelCapacityRecommendations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "调整渠道权重失败"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChannelOAuthHandler struct {
+	oauthService *service.ChannelOAuthService
+}
+
+func NewChannelOAuthHandler() *ChannelOAuthHandler {
+	return &ChannelOAuthHandler{
+		oauthService: service.NewChannelOAuthService(),
+	}
+}
+
+// Get 返回 claude_oauth 渠道的令牌状态（不含令牌本身）
+func (h *ChannelOAuthHandler) Get(c *gin.Context) {
+	status, err := h.oauthService.Status(c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "获取 OAuth 令牌状态失败")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// Set 保存管理员从 claude.ai 登录获得的令牌
+func (h *ChannelOAuthHandler) Set(c *gin.Context) {
+	var req model.SetChannelOAuthTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	status, err := h.oauthService.SetToken(middleware.GetUserID(c), c.Param("id"), &req)
+	if err != nil {
+		h.writeError(c, err, "保存 OAuth 令牌失败")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// Refresh 立即刷新访问令牌
+func (h *ChannelOAuthHandler) Refresh(c *gin.Context) {
+	status, err := h.oauthService.Refresh(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "刷新 OAuth 令牌失败")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *ChannelOAuthHandler) writeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrChannelNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelNotOAuth), errors.Is(err, service.ErrChannelOAuthNotConfigured):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelOAuthRefresh):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
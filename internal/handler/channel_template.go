@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChannelTemplateHandler struct {
+	templateService *service.ChannelTemplateService
+}
+
+func NewChannelTemplateHandler() *ChannelTemplateHandler {
+	return &ChannelTemplateHandler{
+		templateService: service.NewChannelTemplateService(),
+	}
+}
+
+// List 获取全部渠道模板（内置模板在前）
+func (h *ChannelTemplateHandler) List(c *gin.Context) {
+	templates, err := h.templateService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取渠道模板列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+func (h *ChannelTemplateHandler) Get(c *gin.Context) {
+	tpl, err := h.templateService.Get(c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "获取渠道模板失败")
+		return
+	}
+	c.JSON(http.StatusOK, tpl)
+}
+
+func (h *ChannelTemplateHandler) Create(c *gin.Context) {
+	var req model.ChannelTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	tpl, err := h.templateService.Create(&req)
+	if err != nil {
+		h.writeError(c, err, "创建渠道模板失败")
+		return
+	}
+	c.JSON(http.StatusCreated, tpl)
+}
+
+func (h *ChannelTemplateHandler) Update(c *gin.Context) {
+	var req model.ChannelTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	tpl, err := h.templateService.Update(c.Param("id"), &req)
+	if err != nil {
+		h.writeError(c, err, "更新渠道模板失败")
+		return
+	}
+	c.JSON(http.StatusOK, tpl)
+}
+
+func (h *ChannelTemplateHandler) Delete(c *gin.Context) {
+	if err := h.templateService.Delete(c.Param("id")); err != nil {
+		h.writeError(c, err, "删除渠道模板失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "渠道模板已删除"})
+}
+
+func (h *ChannelTemplateHandler) writeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrChannelTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelTemplateNameExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelTemplateBuiltin):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
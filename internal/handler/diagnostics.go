@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DiagnosticsHandler struct {
+	diagnosticsService *service.DiagnosticsService
+}
+
+func NewDiagnosticsHandler() *DiagnosticsHandler {
+	return &DiagnosticsHandler{
+		diagnosticsService: service.NewDiagnosticsService(),
+	}
+}
+
+// GetReport 返回最近一次配置自检报告（启动时自动执行）
+func (h *DiagnosticsHandler) GetReport(c *gin.Context) {
+	report := service.LatestDiagnosticReport()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "自检尚未完成，请稍后重试"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// Run 立即重新执行自检，修复配置后用于确认问题已消除
+func (h *DiagnosticsHandler) Run(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+	defer cancel()
+	c.JSON(http.StatusOK, h.diagnosticsService.Run(ctx, "manual"))
+}
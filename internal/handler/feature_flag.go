@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FeatureFlagHandler struct {
+	flagService *service.FeatureFlagService
+}
+
+func NewFeatureFlagHandler() *FeatureFlagHandler {
+	return &FeatureFlagHandler{
+		flagService: service.NewFeatureFlagService(),
+	}
+}
+
+// List 列出内置及自定义功能开关
+func (h *FeatureFlagHandler) List(c *gin.Context) {
+	flags, err := h.flagService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取功能开关失败"})
+		return
+	}
+	c.JSON(http.StatusOK, flags)
+}
+
+// Put 创建或更新功能开关，立即生效
+func (h *FeatureFlagHandler) Put(c *gin.Context) {
+	var req model.FeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	flag, err := h.flagService.Put(c.Param("key"), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrFeatureFlagInvalidKey), errors.Is(err, service.ErrGroupNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存功能开关失败"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, flag)
+}
+
+// Delete 删除开关配置，内置开关恢复默认状态
+func (h *FeatureFlagHandler) Delete(c *gin.Context) {
+	if err := h.flagService.Delete(c.Param("key")); err != nil {
+		if errors.Is(err, service.ErrFeatureFlagNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除功能开关失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已删除"})
+}
+
+// GetMyFeatures 返回当前用户的功能开关状态
+func (h *FeatureFlagHandler) GetMyFeatures(c *gin.Context) {
+	features, err := h.flagService.EvaluateForUser(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取功能开关失败"})
+		return
+	}
+	c.JSON(http.StatusOK, features)
+}
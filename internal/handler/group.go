@@ -3,20 +3,25 @@ package handler
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
+	"ampmanager/internal/middleware"
 	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
 	"ampmanager/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
 type GroupHandler struct {
-	groupService *service.GroupService
+	groupService  *service.GroupService
+	budgetService *service.GroupBudgetService
 }
 
 func NewGroupHandler() *GroupHandler {
 	return &GroupHandler{
-		groupService: service.NewGroupService(),
+		groupService:  service.NewGroupService(),
+		budgetService: service.NewGroupBudgetService(),
 	}
 }
 
@@ -55,6 +60,10 @@ func (h *GroupHandler) Create(c *gin.Context) {
 
 	group, err := h.groupService.Create(&req)
 	if err != nil {
+		if errors.Is(err, service.ErrGroupPipeline) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if errors.Is(err, service.ErrGroupNameExists) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
@@ -83,6 +92,16 @@ func (h *GroupHandler) Update(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, service.ErrGroupPipeline) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrGroupConflict) {
+			// 返回最新数据供前端对比合并
+			current, _ := h.groupService.GetByID(id)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "current": current})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新分组失败"})
 		return
 	}
@@ -102,3 +121,102 @@ func (h *GroupHandler) Delete(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "分组已删除"})
 }
+
+// ListManaged 列出当前管理员可管理的分组（分组管理员只返回所辖分组）
+func (h *GroupHandler) ListManaged(c *gin.Context) {
+	groups, err := h.groupService.ListInScope(middleware.GetAdminScope(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分组列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// ListAdmins 列出分组管理员
+func (h *GroupHandler) ListAdmins(c *gin.Context) {
+	admins, err := h.groupService.ListAdmins(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrGroupNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分组管理员失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"admins": admins})
+}
+
+// AddAdmin 指定分组管理员
+func (h *GroupHandler) AddAdmin(c *gin.Context) {
+	var req model.AddGroupAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	groupID := c.Param("id")
+	if err := h.groupService.AddAdmin(middleware.GetUserID(c), groupID, req.UserID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrGroupNotFound), errors.Is(err, repository.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrGroupAdminIsGlobalAdmin):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "指定分组管理员失败"})
+		}
+		return
+	}
+
+	admins, _ := h.groupService.ListAdmins(groupID)
+	c.JSON(http.StatusOK, gin.H{"admins": admins})
+}
+
+// RemoveAdmin 撤销分组管理员
+func (h *GroupHandler) RemoveAdmin(c *gin.Context) {
+	removed, err := h.groupService.RemoveAdmin(middleware.GetUserID(c), c.Param("id"), c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销分组管理员失败"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该用户不是此分组的管理员"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已撤销分组管理员"})
+}
+
+// GetBudget 分组本月的预算使用情况、预测费用与已触发的告警
+func (h *GroupHandler) GetBudget(c *gin.Context) {
+	status, err := h.budgetService.GetStatus(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrGroupNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分组预算失败"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// ListBudgetAlerts 分组预算告警历史，可按分组、月份（2006-01）与类型筛选
+func (h *GroupHandler) ListBudgetAlerts(c *gin.Context) {
+	filter := model.GroupBudgetAlertFilter{
+		GroupID: c.Query("groupId"),
+		Month:   c.Query("month"),
+		Kind:    c.Query("kind"),
+	}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		filter.Page = page
+	}
+	if pageSize, err := strconv.Atoi(c.Query("pageSize")); err == nil && pageSize > 0 {
+		filter.PageSize = pageSize
+	}
+
+	result, err := h.budgetService.ListAlerts(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分组预算告警失败"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LogViewHandler struct {
+	viewService *service.SavedLogViewService
+}
+
+func NewLogViewHandler() *LogViewHandler {
+	return &LogViewHandler{
+		viewService: service.NewSavedLogViewService(),
+	}
+}
+
+// List 获取当前用户保存的日志视图（pinned=true 时仅返回置顶视图）
+func (h *LogViewHandler) List(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	pinnedOnly := c.Query("pinned") == "true" || c.Query("pinned") == "1"
+
+	views, err := h.viewService.List(userID, pinnedOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取视图列表失败"})
+		return
+	}
+	if views == nil {
+		views = []*model.SavedLogView{}
+	}
+	c.JSON(http.StatusOK, gin.H{"views": views})
+}
+
+func (h *LogViewHandler) Get(c *gin.Context) {
+	view, err := h.viewService.Get(middleware.GetUserID(c), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "获取视图失败")
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *LogViewHandler) Create(c *gin.Context) {
+	var req model.SavedLogViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	view, err := h.viewService.Create(middleware.GetUserID(c), &req)
+	if err != nil {
+		h.writeError(c, err, "创建视图失败")
+		return
+	}
+	c.JSON(http.StatusCreated, view)
+}
+
+func (h *LogViewHandler) Update(c *gin.Context) {
+	var req model.SavedLogViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	view, err := h.viewService.Update(middleware.GetUserID(c), c.Param("id"), &req)
+	if err != nil {
+		h.writeError(c, err, "更新视图失败")
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *LogViewHandler) SetPinned(c *gin.Context) {
+	var req model.SetPinnedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	view, err := h.viewService.SetPinned(middleware.GetUserID(c), c.Param("id"), req.Pinned)
+	if err != nil {
+		h.writeError(c, err, "更新视图失败")
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *LogViewHandler) Delete(c *gin.Context) {
+	if err := h.viewService.Delete(middleware.GetUserID(c), c.Param("id")); err != nil {
+		h.writeError(c, err, "删除视图失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "视图已删除"})
+}
+
+func (h *LogViewHandler) writeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrLogViewNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrLogViewNameExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrLogViewInvalidWindow), errors.Is(err, service.ErrLogViewInvalidStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -71,6 +71,25 @@ func (h *ModelHandler) GetChannelModels(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"models": models})
 }
 
+// SyncModels 立即同步所有启用渠道的上游模型，返回新增与标记移除的模型
+func (h *ModelHandler) SyncModels(c *gin.Context) {
+	report, err := h.modelService.SyncAllChannelModels(service.ModelSyncTriggerManual)
+	if err != nil {
+		if errors.Is(err, service.ErrModelSyncRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "同步模型失败"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetLastModelSync 返回最近一次模型同步结果（定时或手动）
+func (h *ModelHandler) GetLastModelSync(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"report": service.GetLastModelSyncReport()})
+}
+
 func (h *ModelHandler) FetchAllModels(c *gin.Context) {
 	results, err := h.modelService.FetchAllChannelsModels()
 	if err != nil {
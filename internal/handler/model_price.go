@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ModelPriceHandler struct {
+	priceService *service.ModelPriceService
+}
+
+func NewModelPriceHandler() *ModelPriceHandler {
+	return &ModelPriceHandler{priceService: service.NewModelPriceService()}
+}
+
+// ListMyModelPrices 当前用户可调用模型的价格（含分组倍率）
+func (h *ModelPriceHandler) ListMyModelPrices(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	prices, err := h.priceService.ListUserModelPrices(userID)
+	if err != nil {
+		h.writeError(c, err, "获取模型价格失败")
+		return
+	}
+	c.JSON(http.StatusOK, prices)
+}
+
+// QuoteMyModel 按预计 token 数估算当前用户调用模型的费用
+func (h *ModelPriceHandler) QuoteMyModel(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req model.ModelQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	quote, err := h.priceService.Quote(userID, req)
+	if err != nil {
+		h.writeError(c, err, "估算费用失败")
+		return
+	}
+	c.JSON(http.StatusOK, quote)
+}
+
+func (h *ModelPriceHandler) writeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrModelNotAccessible):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrPriceUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	oidcStateCookie = "amp_oidc_state"
+	oidcCookiePath  = "/api/manage/auth/oidc"
+	// oidcLandingPath 回调完成后跳转的前端页面，携带一次性票据或错误信息
+	oidcLandingPath = "/sso-callback"
+)
+
+// GetOIDCLoginOptions 登录页可用的登录方式（公开）
+func (h *UserHandler) GetOIDCLoginOptions(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetOIDCLoginOptions())
+}
+
+// StartOIDCLogin 跳转到 IdP 授权页，redirect 为登录完成后前端跳转的站内路径
+func (h *UserHandler) StartOIDCLogin(c *gin.Context) {
+	authURL, state, err := service.OIDCBeginLogin(c.Request.Context(), c.Query("redirect"))
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, service.ErrOIDCDisabled) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	setOIDCStateCookie(c, state, int(10*time.Minute/time.Second))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback IdP 回调：校验 state 并完成登录，之后带着一次性票据跳转到前端页面换取登录 Token
+func (h *UserHandler) OIDCCallback(c *gin.Context) {
+	state, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+
+	if idpErr := c.Query("error"); idpErr != "" {
+		log.Warnf("oidc: IdP 返回错误: %s %s", idpErr, c.Query("error_description"))
+		redirectOIDCLanding(c, url.Values{"error": {service.ErrOIDCLoginFailed.Error()}})
+		return
+	}
+
+	ticket, redirect, err := service.OIDCCompleteLogin(c.Request.Context(), c.Query("code"), c.Query("state"), state)
+	if err != nil {
+		msg := service.ErrOIDCLoginFailed.Error()
+		if errors.Is(err, service.ErrOIDCInvalidState) || errors.Is(err, service.ErrOIDCNotProvisioned) ||
+			errors.Is(err, service.ErrOIDCGroupDenied) || errors.Is(err, service.ErrOIDCDisabled) {
+			msg = err.Error()
+		} else if !errors.Is(err, service.ErrOIDCLoginFailed) {
+			log.Errorf("oidc: 完成登录失败: %v", err)
+		}
+		redirectOIDCLanding(c, url.Values{"error": {msg}})
+		return
+	}
+	redirectOIDCLanding(c, url.Values{"ticket": {ticket}, "redirect": {redirect}})
+}
+
+// ExchangeOIDCTicket 用回调页的一次性票据换取登录 Token
+func (h *UserHandler) ExchangeOIDCTicket(c *gin.Context) {
+	var req model.OIDCExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, token, err := h.userService.OIDCExchangeTicket(req.Ticket)
+	if err != nil {
+		var suspended *service.SuspendedError
+		switch {
+		case errors.As(err, &suspended):
+			middleware.AbortSuspended(c, suspended.Suspension)
+		case errors.Is(err, service.ErrOIDCInvalidTicket):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, model.AuthResponse{
+		ID:       user.ID,
+		Username: user.Username,
+		Token:    token,
+		IsAdmin:  user.IsAdmin,
+		Message:  "登录成功",
+
+		MustChangePassword: service.UserPasswordChangeDue(user, time.Now()),
+	})
+}
+
+// setOIDCStateCookie 登录状态 Cookie 只发往 SSO 接口；SameSite=Lax 保证从 IdP 跳转回来时携带
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, oidcCookiePath, "", secure, true)
+}
+
+func redirectOIDCLanding(c *gin.Context, query url.Values) {
+	c.Redirect(http.StatusFound, oidcLandingPath+"?"+query.Encode())
+}
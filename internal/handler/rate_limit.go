@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RateLimitHandler struct {
+	rateLimitService *service.RateLimitService
+}
+
+func NewRateLimitHandler() *RateLimitHandler {
+	return &RateLimitHandler{
+		rateLimitService: service.NewRateLimitService(),
+	}
+}
+
+// List 列出所有用户、API Key 与分组的限流规则
+func (h *RateLimitHandler) List(c *gin.Context) {
+	limits, err := h.rateLimitService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取限流规则失败"})
+		return
+	}
+	c.JSON(http.StatusOK, limits)
+}
+
+// Put 创建或更新限流规则，0 表示该项不限制
+func (h *RateLimitHandler) Put(c *gin.Context) {
+	var req model.RateLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	limit, err := h.rateLimitService.Put(c.Param("scope"), c.Param("targetId"), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRateLimitInvalidScope), errors.Is(err, service.ErrRateLimitTargetNotFound), errors.Is(err, service.ErrRateLimitEmpty):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存限流规则失败"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, limit)
+}
+
+// Delete 删除限流规则
+func (h *RateLimitHandler) Delete(c *gin.Context) {
+	if err := h.rateLimitService.Delete(c.Param("scope"), c.Param("targetId")); err != nil {
+		if errors.Is(err, service.ErrRateLimitNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除限流规则失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已删除"})
+}
@@ -1,12 +1,17 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"ampmanager/internal/amp"
+	"ampmanager/internal/database"
 	"ampmanager/internal/middleware"
 	"ampmanager/internal/model"
 	"ampmanager/internal/realtime"
@@ -17,33 +22,8 @@ import (
 	"nhooyr.io/websocket"
 )
 
-type RequestLogHandler struct {
-	logService *service.RequestLogService
-}
-
-func NewRequestLogHandler() *RequestLogHandler {
-	return &RequestLogHandler{
-		logService: service.NewRequestLogService(),
-	}
-}
-
-// ListRequestLogs 获取请求日志列表
-func (h *RequestLogHandler) ListRequestLogs(c *gin.Context) {
-	userID := middleware.GetUserID(c)
-
-	params := service.ListRequestLogsParams{
-		UserID:   userID,
-		Page:     1,
-		PageSize: 20,
-	}
-
-	// 解析查询参数
-	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
-		params.Page = page
-	}
-	if pageSize, err := strconv.Atoi(c.Query("pageSize")); err == nil && pageSize > 0 {
-		params.PageSize = pageSize
-	}
+// parseListFilters 解析日志列表的通用过滤参数，失败时已写入 400 响应
+func parseListFilters(c *gin.Context, params *service.ListRequestLogsParams) bool {
 	if apiKeyID := c.Query("apiKeyId"); apiKeyID != "" {
 		params.APIKeyID = apiKeyID
 	}
@@ -54,7 +34,7 @@ func (h *RequestLogHandler) ListRequestLogs(c *gin.Context) {
 		statusCode, err := strconv.Atoi(statusStr)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "status 参数无效，应为整数"})
-			return
+			return false
 		}
 		params.StatusCode = &statusCode
 	}
@@ -62,11 +42,25 @@ func (h *RequestLogHandler) ListRequestLogs(c *gin.Context) {
 		val := isStreaming == "true" || isStreaming == "1"
 		params.IsStreaming = &val
 	}
+	if logStatus := c.Query("logStatus"); logStatus != "" {
+		params.Status = logStatus
+	}
+	if minCostStr := c.Query("minCostMicros"); minCostStr != "" {
+		minCost, err := strconv.ParseInt(minCostStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "minCostMicros 参数无效，应为整数"})
+			return false
+		}
+		params.MinCost = &minCost
+	}
+	if traceID := c.Query("traceId"); traceID != "" {
+		params.TraceID = strings.ToLower(traceID)
+	}
 	if from := c.Query("from"); from != "" {
 		t, err := time.Parse(time.RFC3339, from)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "from 时间格式错误，应为 RFC3339 格式"})
-			return
+			return false
 		}
 		params.From = &t
 	}
@@ -74,10 +68,80 @@ func (h *RequestLogHandler) ListRequestLogs(c *gin.Context) {
 		t, err := time.Parse(time.RFC3339, to)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "to 时间格式错误，应为 RFC3339 格式"})
-			return
+			return false
 		}
 		params.To = &t
 	}
+	// 携带 cursor 参数（可为空字符串表示第一页）时切换为游标分页
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		if cursor != "" {
+			if _, err := repository.DecodeLogCursor(cursor); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cursor 参数无效"})
+				return false
+			}
+		}
+		params.UseCursor = true
+		params.Cursor = cursor
+	}
+	return true
+}
+
+type RequestLogHandler struct {
+	logService    *service.RequestLogService
+	viewService   *service.SavedLogViewService
+	rollupService *service.UsageRollupService
+}
+
+func NewRequestLogHandler() *RequestLogHandler {
+	return &RequestLogHandler{
+		logService:    service.NewRequestLogService(),
+		viewService:   service.NewSavedLogViewService(),
+		rollupService: service.NewUsageRollupService(),
+	}
+}
+
+// applySavedView 若携带 viewId 参数，则以保存的视图作为基础过滤条件（显式查询参数优先）
+func (h *RequestLogHandler) applySavedView(c *gin.Context, params *service.ListRequestLogsParams, adminScope bool) bool {
+	viewID := c.Query("viewId")
+	if viewID == "" {
+		return true
+	}
+	view, err := h.viewService.Get(middleware.GetUserID(c), viewID)
+	if err != nil {
+		if errors.Is(err, service.ErrLogViewNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取视图失败"})
+		return false
+	}
+	h.viewService.ApplyToParams(view, params, adminScope)
+	return true
+}
+
+// ListRequestLogs 获取请求日志列表
+func (h *RequestLogHandler) ListRequestLogs(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	params := service.ListRequestLogsParams{
+		UserID:   userID,
+		Page:     1,
+		PageSize: 20,
+	}
+
+	// 解析查询参数
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		params.Page = page
+	}
+	if pageSize, err := strconv.Atoi(c.Query("pageSize")); err == nil && pageSize > 0 {
+		params.PageSize = pageSize
+	}
+	if !h.applySavedView(c, &params, false) {
+		return
+	}
+	if !parseListFilters(c, &params) {
+		return
+	}
 
 	result, err := h.logService.List(params)
 	if err != nil {
@@ -88,6 +152,76 @@ func (h *RequestLogHandler) ListRequestLogs(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// ExportRequestLogs 以 JSONL 或 CSV 流式导出当前用户的请求日志
+func (h *RequestLogHandler) ExportRequestLogs(c *gin.Context) {
+	params := service.ListRequestLogsParams{
+		UserID: middleware.GetUserID(c),
+	}
+	if !h.applySavedView(c, &params, false) {
+		return
+	}
+	if !parseListFilters(c, &params) {
+		return
+	}
+
+	h.streamExport(c, params)
+}
+
+// streamExport 逐行写出日志，不在内存中缓存完整结果集；format 为 csv 时导出 CSV，否则为 JSONL
+func (h *RequestLogHandler) streamExport(c *gin.Context, params service.ListRequestLogsParams) {
+	format := c.DefaultQuery("format", "jsonl")
+	if format != "jsonl" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format 参数无效，允许值: jsonl, csv"})
+		return
+	}
+
+	filename := fmt.Sprintf("request-logs-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	var write func(model.RequestLog) error
+	var flush func() error
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		writer := newRequestLogCSVWriter(c.Writer)
+		if err := writer.WriteHeader(); err != nil {
+			c.Error(err)
+			return
+		}
+		write, flush = writer.Write, writer.Flush
+	} else {
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+		c.Status(http.StatusOK)
+		encoder := json.NewEncoder(c.Writer)
+		write = func(item model.RequestLog) error { return encoder.Encode(item) }
+		flush = func() error { return nil }
+	}
+
+	written := 0
+	err := h.logService.Export(params, func(item model.RequestLog) error {
+		if err := write(item); err != nil {
+			return err
+		}
+		written++
+		if written%500 == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// 响应头已发送，只能记录错误并中断输出
+		c.Error(err)
+		return
+	}
+	c.Writer.Flush()
+}
+
 // GetRequestLog 获取单条日志详情
 func (h *RequestLogHandler) GetRequestLog(c *gin.Context) {
 	userID := middleware.GetUserID(c)
@@ -173,52 +307,70 @@ func (h *RequestLogHandler) AdminListRequestLogs(c *gin.Context) {
 	if pageSize, err := strconv.Atoi(c.Query("pageSize")); err == nil && pageSize > 0 {
 		params.PageSize = pageSize
 	}
+	if !h.applySavedView(c, &params, true) {
+		return
+	}
 	// 可选：按用户过滤
 	if userID := c.Query("userId"); userID != "" {
 		params.UserID = userID
 	}
-	if apiKeyID := c.Query("apiKeyId"); apiKeyID != "" {
-		params.APIKeyID = apiKeyID
+	if !parseListFilters(c, &params) {
+		return
 	}
-	if model := c.Query("model"); model != "" {
-		params.Model = model
+
+	result, err := h.logService.ListAdmin(params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取日志失败"})
+		return
 	}
-	if statusStr := c.Query("status"); statusStr != "" {
-		statusCode, err := strconv.Atoi(statusStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "status 参数无效，应为整数"})
-			return
-		}
-		params.StatusCode = &statusCode
+
+	c.JSON(http.StatusOK, result)
+}
+
+// AdminExportRequestLogs 管理员以 JSONL 或 CSV 流式导出请求日志（可选按用户过滤）
+func (h *RequestLogHandler) AdminExportRequestLogs(c *gin.Context) {
+	params := service.ListRequestLogsParams{}
+	if !h.applySavedView(c, &params, true) {
+		return
 	}
-	if isStreaming := c.Query("isStreaming"); isStreaming != "" {
-		val := isStreaming == "true" || isStreaming == "1"
-		params.IsStreaming = &val
+	if userID := c.Query("userId"); userID != "" {
+		params.UserID = userID
 	}
-	if from := c.Query("from"); from != "" {
-		t, err := time.Parse(time.RFC3339, from)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "from 时间格式错误，应为 RFC3339 格式"})
+	if !parseListFilters(c, &params) {
+		return
+	}
+
+	h.streamExport(c, params)
+}
+
+// AdminGetErrorClusters 管理员获取最近失败请求的错误聚类报告
+func (h *RequestLogHandler) AdminGetErrorClusters(c *gin.Context) {
+	hours := 24
+	if v := c.Query("hours"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 || parsed > 24*30 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hours 参数无效，范围 1-720"})
 			return
 		}
-		params.From = &t
+		hours = parsed
 	}
-	if to := c.Query("to"); to != "" {
-		t, err := time.Parse(time.RFC3339, to)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "to 时间格式错误，应为 RFC3339 格式"})
+	limit := 20
+	if v := c.Query("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 || parsed > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 参数无效，范围 1-100"})
 			return
 		}
-		params.To = &t
+		limit = parsed
 	}
 
-	result, err := h.logService.ListAdmin(params)
+	report, err := h.logService.GetErrorClusters(time.Duration(hours)*time.Hour, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取日志失败"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取错误聚类失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, report)
 }
 
 // AdminGetDistinctModels 管理员获取使用过的模型列表
@@ -279,7 +431,12 @@ func (h *RequestLogHandler) AdminGetUsageSummary(c *gin.Context) {
 
 	modelFilter := c.Query("model")
 
-	result, err := h.logService.GetUsageSummaryAdmin(userID, from, to, groupBy, modelFilter)
+	loc, ok := adminReportLocation(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.logService.GetUsageSummaryAdmin(userID, from, to, groupBy, modelFilter, loc)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计失败"})
 		return
@@ -288,6 +445,25 @@ func (h *RequestLogHandler) AdminGetUsageSummary(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// AdminFinalizePendingLogs 管理员强制结束 pending 记录，并按已捕获的用量结算
+func (h *RequestLogHandler) AdminFinalizePendingLogs(c *gin.Context) {
+	var req model.FinalizePendingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	results := amp.ForceFinalizePending(database.GetDB(), req.IDs)
+	finalized := 0
+	for _, result := range results {
+		if result.Finalized {
+			finalized++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": results, "finalized": finalized})
+}
+
 // AdminGetRequestLogDetail 管理员获取请求日志详情（含请求/响应头和体）
 func (h *RequestLogHandler) AdminGetRequestLogDetail(c *gin.Context) {
 	logID := c.Param("id")
@@ -308,6 +484,9 @@ func (h *RequestLogHandler) AdminGetRequestLogDetail(c *gin.Context) {
 		return
 	}
 
+	// 返回前按当前规则再脱敏一次：覆盖尚未落库的内存条目及规则变更前写入的记录
+	amp.RedactRequestDetail(detail)
+
 	// Convert headers to map[string]string for JSON response
 	requestHeaders := make(map[string]string)
 	for k, v := range detail.RequestHeaders {
@@ -323,6 +502,9 @@ func (h *RequestLogHandler) AdminGetRequestLogDetail(c *gin.Context) {
 		}
 	}
 
+	// 重试历史为补充信息，读取失败不影响详情返回
+	attempts, _ := h.logService.GetAttempts(logID)
+
 	result := &model.RequestLogDetail{
 		RequestID:              detail.RequestID,
 		RequestHeaders:         requestHeaders,
@@ -331,8 +513,14 @@ func (h *RequestLogHandler) AdminGetRequestLogDetail(c *gin.Context) {
 		ResponseHeaders:        responseHeaders,
 		ResponseBody:           string(detail.ResponseBody),
 		TranslatedResponseBody: string(detail.TranslatedResponseBody),
+		Attempts:               attempts,
+		RedactionCount:         detail.RedactionCount,
+		InjectedSystemPrompt:   detail.InjectedSystemPrompt,
 		CreatedAt:              detail.CreatedAt,
 	}
+	if detail.PIIRedactions != "" {
+		_ = json.Unmarshal([]byte(detail.PIIRedactions), &result.PIIRedactions)
+	}
 
 	c.JSON(http.StatusOK, result)
 }
@@ -408,6 +596,7 @@ func (h *RequestLogHandler) GetDashboard(c *gin.Context) {
 			"balanceMicros": balance,
 			"balanceUsd":    fmt.Sprintf("%.6f", float64(balance)/1e6),
 		},
+		"timezone":      service.UserLocation(userID).String(),
 		"today":         formatPeriod(today),
 		"week":          formatPeriod(week),
 		"month":         formatPeriod(month),
@@ -419,6 +608,11 @@ func (h *RequestLogHandler) GetDashboard(c *gin.Context) {
 
 // GetAdminDashboard 获取管理员仪表盘数据（全局汇总）
 func (h *RequestLogHandler) GetAdminDashboard(c *gin.Context) {
+	loc, ok := adminReportLocation(c)
+	if !ok {
+		return
+	}
+
 	userService := service.NewUserService()
 	totalBalance, userCount, err := userService.GetTotalBalanceAndUserCount()
 	if err != nil {
@@ -426,7 +620,7 @@ func (h *RequestLogHandler) GetAdminDashboard(c *gin.Context) {
 		return
 	}
 
-	today, week, month, topModels, dailyTrend, err := h.logService.GetAdminDashboardStats()
+	today, week, month, topModels, dailyTrend, err := h.logService.GetAdminDashboardStats(loc)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计数据失败"})
 		return
@@ -487,6 +681,7 @@ func (h *RequestLogHandler) GetAdminDashboard(c *gin.Context) {
 			"totalBalanceUsd":    fmt.Sprintf("%.6f", float64(totalBalance)/1e6),
 			"userCount":          userCount,
 		},
+		"timezone":      loc.String(),
 		"today":         formatPeriod(today),
 		"week":          formatPeriod(week),
 		"month":         formatPeriod(month),
@@ -520,3 +715,265 @@ func (h *RequestLogHandler) AdminRequestLogsWS(c *gin.Context) {
 	go client.WriteLoop(ctx)
 	client.ReadLoop(ctx)
 }
+
+// AdminRequestLiveWS 通过 WebSocket 只读转发进行中请求的响应流（已输出部分先行补发）
+func (h *RequestLogHandler) AdminRequestLiveWS(c *gin.Context) {
+	registry := amp.GetLiveStreamRegistry()
+	if !registry.IsLive(c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "请求不在进行中或未开启请求详情监控"})
+		return
+	}
+
+	conn, err := websocket.Accept(c.Writer, c.Request, &websocket.AcceptOptions{
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return
+	}
+	defer conn.Close(websocket.StatusInternalError, "")
+
+	backlog, events, cancel, ok := registry.Subscribe(c.Param("id"))
+	defer cancel()
+
+	// 只读连接：客户端消息一律丢弃，读取失败即视为断开
+	ctx := conn.CloseRead(c.Request.Context())
+	write := func(event amp.LiveStreamEvent) bool {
+		msg, err := json.Marshal(event)
+		if err != nil {
+			return false
+		}
+		writeCtx, cancelWrite := context.WithTimeout(ctx, 5*time.Second)
+		defer cancelWrite()
+		return conn.Write(writeCtx, websocket.MessageText, msg) == nil
+	}
+
+	if !ok {
+		write(amp.LiveStreamEvent{Type: "end", Reason: "completed"})
+		conn.Close(websocket.StatusNormalClosure, "")
+		return
+	}
+	if len(backlog) > 0 && !write(amp.LiveStreamEvent{Type: "chunk", Data: string(backlog)}) {
+		return
+	}
+
+	for {
+		select {
+		case event, open := <-events:
+			if !open {
+				// 订阅者跟不上被断开
+				write(amp.LiveStreamEvent{Type: "end", Reason: "lagged"})
+				conn.Close(websocket.StatusNormalClosure, "")
+				return
+			}
+			if !write(event) {
+				return
+			}
+			if event.Type == "end" {
+				conn.Close(websocket.StatusNormalClosure, "")
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// parseDashboardRange 解析仪表盘共享时间范围，默认最近 30 天
+func parseDashboardRange(c *gin.Context) (time.Time, time.Time, bool) {
+	to := time.Now().UTC()
+	if toStr := c.Query("to"); toStr != "" {
+		t, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 时间格式错误，应为 RFC3339 格式"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = t.UTC()
+	}
+	from := to.AddDate(0, 0, -30)
+	if fromStr := c.Query("from"); fromStr != "" {
+		t, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from 时间格式错误，应为 RFC3339 格式"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = t.UTC()
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from 不能晚于 to"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// adminReportLocation 管理员报表按天分组使用的时区：优先使用 timezone 参数，否则为管理员自己的报表时区
+func adminReportLocation(c *gin.Context) (*time.Location, bool) {
+	if name := c.Query("timezone"); name != "" {
+		loc, err := service.ParseTimezone(name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		return loc, true
+	}
+	return service.UserLocation(middleware.GetUserID(c)), true
+}
+
+// formatDashboardSummary 将聚合仪表盘数据转换为前端格式
+func formatDashboardSummary(summary *repository.DashboardSummary, from, to time.Time) gin.H {
+	topModelsList := make([]gin.H, 0, len(summary.TopModels))
+	for _, m := range summary.TopModels {
+		topModelsList = append(topModelsList, gin.H{
+			"model":        m.Model,
+			"requestCount": m.RequestCount,
+			"costMicros":   m.CostMicros,
+			"costUsd":      fmt.Sprintf("%.6f", float64(m.CostMicros)/1e6),
+		})
+	}
+
+	trendList := make([]gin.H, 0, len(summary.DailyTrend))
+	for _, d := range summary.DailyTrend {
+		trendList = append(trendList, gin.H{
+			"date":       d.Date,
+			"costMicros": d.CostMicros,
+			"costUsd":    fmt.Sprintf("%.6f", float64(d.CostMicros)/1e6),
+			"requests":   d.Requests,
+		})
+	}
+
+	cacheHitRateList := make([]gin.H, 0, len(summary.CacheHitRates))
+	for _, r := range summary.CacheHitRates {
+		cacheHitRateList = append(cacheHitRateList, gin.H{
+			"provider":            r.Provider,
+			"totalInputTokens":    r.TotalInputTokens,
+			"cacheReadTokens":     r.CacheReadTokens,
+			"cacheCreationTokens": r.CacheCreationTokens,
+			"requestCount":        r.RequestCount,
+			"hitRate":             fmt.Sprintf("%.1f", r.HitRate),
+		})
+	}
+
+	recentLogs := summary.RecentLogs
+	if recentLogs == nil {
+		recentLogs = []model.RequestLog{}
+	}
+
+	return gin.H{
+		"range": gin.H{
+			"from": from.Format(time.RFC3339),
+			"to":   to.Format(time.RFC3339),
+		},
+		"period": gin.H{
+			"requestCount":    summary.Period.RequestCount,
+			"inputTokensSum":  summary.Period.InputTokensSum,
+			"outputTokensSum": summary.Period.OutputTokensSum,
+			"costMicros":      summary.Period.CostMicrosSum,
+			"costUsd":         fmt.Sprintf("%.6f", float64(summary.Period.CostMicrosSum)/1e6),
+			"errorCount":      summary.Period.ErrorCount,
+		},
+		"topModels":     topModelsList,
+		"dailyTrend":    trendList,
+		"cacheHitRates": cacheHitRateList,
+		"recentLogs":    recentLogs,
+	}
+}
+
+// GetDashboardSummary 获取用户聚合仪表盘数据（统计、缓存命中率、计费状态、最近日志）
+func (h *RequestLogHandler) GetDashboardSummary(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	from, to, ok := parseDashboardRange(c)
+	if !ok {
+		return
+	}
+
+	loc := service.UserLocation(userID)
+	summary, err := h.logService.GetDashboardSummary(repository.DashboardSummaryParams{
+		UserID:   userID,
+		From:     from,
+		To:       to,
+		Location: loc,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计数据失败"})
+		return
+	}
+
+	billingState, err := service.NewBillingService().GetBillingState(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取计费状态失败"})
+		return
+	}
+
+	result := formatDashboardSummary(summary, from, to)
+	result["timezone"] = loc.String()
+	result["billing"] = billingState
+	c.JSON(http.StatusOK, result)
+}
+
+// AdminGetDashboardSummary 管理员获取全局聚合仪表盘数据
+func (h *RequestLogHandler) AdminGetDashboardSummary(c *gin.Context) {
+	from, to, ok := parseDashboardRange(c)
+	if !ok {
+		return
+	}
+	loc, ok := adminReportLocation(c)
+	if !ok {
+		return
+	}
+
+	summary, err := h.logService.GetDashboardSummary(repository.DashboardSummaryParams{
+		UserID:      c.Query("userId"),
+		From:        from,
+		To:          to,
+		TopModels:   10,
+		RecentLimit: 20,
+		Location:    loc,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计数据失败"})
+		return
+	}
+
+	totalBalance, userCount, err := service.NewUserService().GetTotalBalanceAndUserCount()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取余额失败"})
+		return
+	}
+
+	result := formatDashboardSummary(summary, from, to)
+	result["timezone"] = loc.String()
+	result["balance"] = gin.H{
+		"totalBalanceMicros": totalBalance,
+		"totalBalanceUsd":    fmt.Sprintf("%.6f", float64(totalBalance)/1e6),
+		"userCount":          userCount,
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetDashboardTrends 获取当前用户的长周期趋势图数据（基于汇总表，最长 366 天）
+func (h *RequestLogHandler) GetDashboardTrends(c *gin.Context) {
+	h.writeUsageTrend(c, middleware.GetUserID(c))
+}
+
+// AdminGetDashboardTrends 管理员获取全局或指定用户（userId）的长周期趋势图数据
+func (h *RequestLogHandler) AdminGetDashboardTrends(c *gin.Context) {
+	h.writeUsageTrend(c, c.Query("userId"))
+}
+
+func (h *RequestLogHandler) writeUsageTrend(c *gin.Context, userID string) {
+	from, to, ok := parseDashboardRange(c)
+	if !ok {
+		return
+	}
+
+	trend, err := h.rollupService.GetUsageTrend(userID, from, to, c.Query("resolution"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUsageTrend) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取趋势数据失败"})
+		return
+	}
+	c.JSON(http.StatusOK, trend)
+}
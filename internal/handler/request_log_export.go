@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"ampmanager/internal/model"
+)
+
+// requestLogCSVColumns CSV 导出的列，顺序与 requestLogCSVRecord 一致
+var requestLogCSVColumns = []string{
+	"id", "createdAt", "status", "userId", "username", "apiKeyId", "apiKeyName",
+	"originalModel", "mappedModel", "pricingModel", "provider", "channelId", "channelName", "endpoint",
+	"method", "path", "statusCode", "latencyMs", "isStreaming",
+	"inputTokens", "outputTokens", "cacheReadInputTokens", "cacheCreationInputTokens", "usageEstimated",
+	"costMicros", "costUsd", "errorType", "requestId", "onBehalfOf",
+}
+
+// requestLogCSVWriter 将请求日志逐行写为 CSV
+type requestLogCSVWriter struct {
+	w *csv.Writer
+}
+
+func newRequestLogCSVWriter(w io.Writer) *requestLogCSVWriter {
+	return &requestLogCSVWriter{w: csv.NewWriter(w)}
+}
+
+func (c *requestLogCSVWriter) WriteHeader() error {
+	return c.w.Write(requestLogCSVColumns)
+}
+
+func (c *requestLogCSVWriter) Write(item model.RequestLog) error {
+	return c.w.Write(requestLogCSVRecord(item))
+}
+
+func (c *requestLogCSVWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func requestLogCSVRecord(item model.RequestLog) []string {
+	return []string{
+		csvText(item.ID),
+		item.CreatedAt,
+		string(item.Status),
+		csvText(item.UserID),
+		csvTextPtr(item.Username),
+		csvText(item.APIKeyID),
+		csvTextPtr(item.APIKeyName),
+		csvTextPtr(item.OriginalModel),
+		csvTextPtr(item.MappedModel),
+		csvTextPtr(item.PricingModel),
+		csvTextPtr(item.Provider),
+		csvTextPtr(item.ChannelID),
+		csvTextPtr(item.ChannelName),
+		csvTextPtr(item.Endpoint),
+		item.Method,
+		csvText(item.Path),
+		strconv.Itoa(item.StatusCode),
+		strconv.FormatInt(item.LatencyMs, 10),
+		strconv.FormatBool(item.IsStreaming),
+		csvIntPtr(item.InputTokens),
+		csvIntPtr(item.OutputTokens),
+		csvIntPtr(item.CacheReadInputTokens),
+		csvIntPtr(item.CacheCreationInputTokens),
+		strconv.FormatBool(item.UsageEstimated),
+		csvInt64Ptr(item.CostMicros),
+		csvTextPtr(item.CostUsd),
+		csvTextPtr(item.ErrorType),
+		csvTextPtr(item.RequestID),
+		csvTextPtr(item.OnBehalfOf),
+	}
+}
+
+// csvText 对可能来自客户端的文本加前缀 '，避免在表格软件中被当作公式执行
+func csvText(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func csvTextPtr(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return csvText(*v)
+}
+
+func csvIntPtr(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func csvInt64Ptr(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
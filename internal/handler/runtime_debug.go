@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// RuntimeDebugHandler 运行时诊断：pprof 采样、运行时指标与 goroutine 堆栈，仅在系统设置中开启后可用
+type RuntimeDebugHandler struct{}
+
+func NewRuntimeDebugHandler() *RuntimeDebugHandler {
+	return &RuntimeDebugHandler{}
+}
+
+// RequireEnabled 运行时诊断未开启时返回 403，开启时记录访问者便于事后追溯
+func (h *RuntimeDebugHandler) RequireEnabled() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !service.RuntimeDebugEnabled() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "运行时诊断未开启，请先在系统设置中开启"})
+			return
+		}
+		log.Infof("runtime debug: 管理员 %s 访问 %s", middleware.GetUserID(c), c.Request.URL.RequestURI())
+		c.Next()
+	}
+}
+
+// GetStats 当前 goroutine 数、堆内存与 GC 指标
+func (h *RuntimeDebugHandler) GetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, service.CollectRuntimeStats())
+}
+
+// GoroutineDump 以文本返回所有 goroutine 的完整堆栈（含阻塞时长），debug=1 时按相同堆栈聚合计数
+func (h *RuntimeDebugHandler) GoroutineDump(c *gin.Context) {
+	debug := 2
+	if c.Query("debug") == "1" {
+		debug = 1
+	}
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	if err := runtimepprof.Lookup("goroutine").WriteTo(c.Writer, debug); err != nil {
+		log.Errorf("runtime debug: 导出 goroutine 堆栈失败: %v", err)
+	}
+}
+
+// PprofIndex net/http/pprof 的概览页，页面中的链接为相对路径，指向 PprofProfile
+func (h *RuntimeDebugHandler) PprofIndex(c *gin.Context) {
+	pprof.Index(c.Writer, c.Request)
+}
+
+// PprofProfile 按名称提供 pprof 数据：profile（CPU，seconds 参数）、trace、cmdline、symbol，
+// 其余名称（heap、goroutine、allocs、block、mutex、threadcreate）由 runtime/pprof 输出
+func (h *RuntimeDebugHandler) PprofProfile(c *gin.Context) {
+	switch name := c.Param("name"); name {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
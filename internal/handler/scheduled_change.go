@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduledChangeHandler struct {
+	changeService *service.ScheduledChangeService
+}
+
+func NewScheduledChangeHandler() *ScheduledChangeHandler {
+	return &ScheduledChangeHandler{
+		changeService: service.NewScheduledChangeService(),
+	}
+}
+
+// List 列出定时变更，可按 status 筛选
+func (h *ScheduledChangeHandler) List(c *gin.Context) {
+	changes, err := h.changeService.List(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取定时变更失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+func (h *ScheduledChangeHandler) Get(c *gin.Context) {
+	change, err := h.changeService.Get(c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "获取定时变更失败")
+		return
+	}
+	c.JSON(http.StatusOK, change)
+}
+
+func (h *ScheduledChangeHandler) Create(c *gin.Context) {
+	var req model.ScheduledChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	change, err := h.changeService.Create(middleware.GetUserID(c), &req)
+	if err != nil {
+		h.writeError(c, err, "创建定时变更失败")
+		return
+	}
+	c.JSON(http.StatusCreated, change)
+}
+
+// Cancel 取消尚未生效的定时变更
+func (h *ScheduledChangeHandler) Cancel(c *gin.Context) {
+	if err := h.changeService.Cancel(middleware.GetUserID(c), c.Param("id")); err != nil {
+		h.writeError(c, err, "取消定时变更失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "定时变更已取消"})
+}
+
+func (h *ScheduledChangeHandler) writeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrScheduledChangeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrScheduledChangeNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrScheduledChangeInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
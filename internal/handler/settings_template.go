@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SettingsTemplateHandler struct {
+	templateService *service.SettingsTemplateService
+}
+
+func NewSettingsTemplateHandler() *SettingsTemplateHandler {
+	return &SettingsTemplateHandler{
+		templateService: service.NewSettingsTemplateService(),
+	}
+}
+
+// List 获取全部设置模板
+func (h *SettingsTemplateHandler) List(c *gin.Context) {
+	templates, err := h.templateService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取设置模板列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+func (h *SettingsTemplateHandler) Get(c *gin.Context) {
+	tpl, err := h.templateService.Get(c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "获取设置模板失败")
+		return
+	}
+	c.JSON(http.StatusOK, tpl)
+}
+
+// ListVersions 获取模板的历史版本
+func (h *SettingsTemplateHandler) ListVersions(c *gin.Context) {
+	versions, err := h.templateService.ListVersions(c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "获取设置模板版本失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+func (h *SettingsTemplateHandler) Create(c *gin.Context) {
+	var req model.SettingsTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	tpl, err := h.templateService.Create(&req)
+	if err != nil {
+		h.writeError(c, err, "创建设置模板失败")
+		return
+	}
+	c.JSON(http.StatusCreated, tpl)
+}
+
+// Update 更新模板，内容变化时同步给跟随最新版本的用户
+func (h *SettingsTemplateHandler) Update(c *gin.Context) {
+	var req model.SettingsTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	result, err := h.templateService.Update(c.Param("id"), &req)
+	if err != nil {
+		h.writeError(c, err, "更新设置模板失败")
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *SettingsTemplateHandler) Delete(c *gin.Context) {
+	if err := h.templateService.Delete(c.Param("id")); err != nil {
+		h.writeError(c, err, "删除设置模板失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "设置模板已删除"})
+}
+
+// ListForUser 获取模板列表及当前用户的应用状态
+func (h *SettingsTemplateHandler) ListForUser(c *gin.Context) {
+	templates, err := h.templateService.ListForUser(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取设置模板列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// Apply 将模板应用到当前用户的设置
+func (h *SettingsTemplateHandler) Apply(c *gin.Context) {
+	var req model.ApplySettingsTemplateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+			return
+		}
+	}
+
+	settings, err := h.templateService.Apply(middleware.GetUserID(c), c.Param("id"), &req)
+	if err != nil {
+		h.writeError(c, err, "应用设置模板失败")
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// Detach 取消应用模板，已写入的设置保留
+func (h *SettingsTemplateHandler) Detach(c *gin.Context) {
+	if err := h.templateService.Detach(middleware.GetUserID(c), c.Param("id")); err != nil {
+		h.writeError(c, err, "取消应用设置模板失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已取消应用设置模板"})
+}
+
+func (h *SettingsTemplateHandler) writeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrSettingsTemplateNotFound),
+		errors.Is(err, service.ErrSettingsTemplateVersionMissing),
+		errors.Is(err, service.ErrSettingsTemplateNotApplied):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSettingsTemplateNameExists),
+		errors.Is(err, service.ErrSettingsConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSettingsTemplateKindChange),
+		errors.Is(err, service.ErrSettingsTemplateInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -47,7 +47,9 @@ func (h *SubscriptionHandler) Create(c *gin.Context) {
 		if errors.Is(err, service.ErrPlanNameRequired) ||
 			errors.Is(err, service.ErrInvalidLimitType) ||
 			errors.Is(err, service.ErrInvalidWindowMode) ||
-			errors.Is(err, service.ErrDuplicateLimitType) {
+			errors.Is(err, service.ErrDuplicateLimitType) ||
+			errors.Is(err, service.ErrInvalidResetHour) ||
+			errors.Is(err, service.ErrInvalidTimezone) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -88,10 +90,18 @@ func (h *SubscriptionHandler) Update(c *gin.Context) {
 		if errors.Is(err, service.ErrPlanNameRequired) ||
 			errors.Is(err, service.ErrInvalidLimitType) ||
 			errors.Is(err, service.ErrInvalidWindowMode) ||
-			errors.Is(err, service.ErrDuplicateLimitType) {
+			errors.Is(err, service.ErrDuplicateLimitType) ||
+			errors.Is(err, service.ErrInvalidResetHour) ||
+			errors.Is(err, service.ErrInvalidTimezone) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, service.ErrPlanConflict) {
+			// 返回最新数据供前端对比合并
+			current, _ := h.planService.GetByID(id)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "current": current})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新套餐失败"})
 		return
 	}
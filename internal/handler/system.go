@@ -4,18 +4,28 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"ampmanager/internal/amp"
+	"ampmanager/internal/autotls"
+	"ampmanager/internal/config"
 	"ampmanager/internal/database"
+	"ampmanager/internal/health"
+	"ampmanager/internal/middleware"
 	"ampmanager/internal/model"
 	"ampmanager/internal/repository"
+	"ampmanager/internal/secrets"
+	"ampmanager/internal/service"
+	"ampmanager/internal/translator"
 	"ampmanager/internal/translator/filters"
 
 	"github.com/gin-gonic/gin"
@@ -27,6 +37,37 @@ var backupFilenamePattern = regexp.MustCompile(`^data\.db\.backup\.\d{14}$`)
 const retryConfigKey = "retry_config"
 const timeoutConfigKey = "timeout_config"
 const cacheTTLConfigKey = "cache_ttl_override"
+const pendingCleanerConfigKey = "pending_cleaner_config"
+const responseValidationKey = "response_validation_enabled"
+const httpPolicyConfigKey = "http_policy"
+const maintenanceConfigKey = "maintenance_config"
+const responseHeaderConfigKey = "response_header_config"
+const billingShadowConfigKey = "billing_shadow_mode"
+const billingAuditConfigKey = "billing_audit_config"
+const channelHealthConfigKey = "channel_health_config"
+const channelKeyCheckConfigKey = "channel_key_check_config"
+const channelFailoverConfigKey = "channel_failover_config"
+const channelStickyConfigKey = "channel_sticky_config"
+const channelCapacityConfigKey = "channel_capacity_config"
+const toolLoopConfigKey = "tool_loop_config"
+const outputFilterConfigKey = "output_filter_config"
+const translationConfigKey = "translation_config"
+const requestLogPolicyKey = "request_log_policy"
+const federationConfigKey = "federation_config"
+const modelSyncConfigKey = "model_sync_config"
+const quotaEnforcementConfigKey = "quota_enforcement_config"
+const logRetentionConfigKey = "log_retention_config"
+const concurrencyLimitConfigKey = "concurrency_limit_config"
+const passwordPolicyConfigKey = "password_policy_config"
+const streamFlushConfigKey = "stream_flush_config"
+const oidcConfigKey = "oidc_config"
+const memoryGuardConfigKey = "memory_guard_config"
+const runtimeDebugConfigKey = "runtime_debug_config"
+const detailRedactionConfigKey = "detail_redaction_config"
+const piiRedactionConfigKey = "pii_redaction_config"
+const accessLogConfigKey = "access_log_config"
+const groupBudgetConfigKey = "group_budget_alert_config"
+const newUserDefaultsConfigKey = "new_user_defaults_config"
 
 type SystemHandler struct {
 	configRepo *repository.SystemConfigRepository
@@ -38,7 +79,7 @@ func ensureSQLiteDatabaseFiles(c *gin.Context) bool {
 	}
 
 	c.JSON(http.StatusBadRequest, gin.H{
-		"error": "当前使用的是 PostgreSQL，文件级数据库备份/恢复不可用，请改用 dbtool 迁移命令",
+		"error": "当前使用的不是 SQLite，文件级数据库备份/恢复不可用，请改用 dbtool 迁移命令",
 	})
 	return false
 }
@@ -67,17 +108,28 @@ func (h *SystemHandler) GetDatabaseInfo(c *gin.Context) {
 	databaseURL := options.DatabaseURL
 
 	archiveMode := "独立 SQLite 归档库"
-	if database.IsPostgres() {
+	if database.HasArchiveTable() {
 		archiveMode = "同库归档表 request_log_details_archive"
 	}
 
+	// 分析查询连接：replica（PostgreSQL / MySQL 只读副本）、pool（SQLite 独立只读连接池）或 primary（与写入共用）
+	readConnection := "primary"
+	if database.HasReadDB() {
+		readConnection = "pool"
+		if !database.IsSQLite() {
+			readConnection = "replica"
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"currentType":         database.GetType(),
-		"supportsFileBackups": database.SupportsFileBackups(),
-		"sqlitePath":          sqlitePath,
-		"databaseURL":         databaseURL,
-		"databaseURLMasked":   maskDatabaseURL(databaseURL),
-		"archiveMode":         archiveMode,
+		"currentType":           database.GetType(),
+		"supportsFileBackups":   database.SupportsFileBackups(),
+		"sqlitePath":            sqlitePath,
+		"databaseURL":           databaseURL,
+		"databaseURLMasked":     maskDatabaseURL(databaseURL),
+		"archiveMode":           archiveMode,
+		"readConnection":        readConnection,
+		"readDatabaseURLMasked": maskDatabaseURL(options.ReadDatabaseURL),
 	})
 }
 
@@ -235,6 +287,29 @@ func (h *SystemHandler) UpdateRetryConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": resp})
 }
 
+// beginDatabaseSwap 替换数据库前排空流量并写入缓冲日志；失败时已写入响应
+// drainTimeoutSec 查询参数可覆盖等待进行中请求结束的时长
+func beginDatabaseSwap(c *gin.Context) (*amp.DatabaseSwap, bool) {
+	timeout := amp.DefaultDrainTimeout
+	if v := c.Query("drainTimeoutSec"); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec <= 0 || sec > 600 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "drainTimeoutSec 需为 1-600 之间的整数"})
+			return nil, false
+		}
+		timeout = time.Duration(sec) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	swap, err := amp.BeginDatabaseSwap(ctx)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "无法开始数据库替换: " + err.Error()})
+		return nil, false
+	}
+	return swap, true
+}
+
 func (h *SystemHandler) UploadDatabase(c *gin.Context) {
 	if database.IsPostgres() {
 		h.uploadPostgresDump(c)
@@ -268,6 +343,12 @@ func (h *SystemHandler) UploadDatabase(c *gin.Context) {
 	shmPath := dbPath + "-shm"
 	backupPath := "./data/data.db.backup." + time.Now().Format("20060102150405")
 
+	swap, ok := beginDatabaseSwap(c)
+	if !ok {
+		return
+	}
+	defer swap.End()
+
 	// 关闭数据库连接，释放文件句柄（Windows 必须先关闭才能操作文件）
 	if err := database.CloseAndRelease(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭数据库连接失败: " + err.Error()})
@@ -324,11 +405,6 @@ func (h *SystemHandler) UploadDatabase(c *gin.Context) {
 		return
 	}
 
-	// 重新初始化日志写入器等依赖数据库的组件
-	amp.ReinitLogWriter(database.GetDB())
-	amp.ReinitRequestDetailStore(database.GetDB())
-	amp.ReinitPendingCleaner(database.GetDB())
-
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "数据库上传并切换成功",
 		"backupFile": filepath.Base(backupPath),
@@ -360,6 +436,12 @@ func (h *SystemHandler) uploadPostgresDump(c *gin.Context) {
 		return
 	}
 
+	swap, ok := beginDatabaseSwap(c)
+	if !ok {
+		return
+	}
+	defer swap.End()
+
 	currentOptions := database.GetOptions()
 	if err := database.CloseAndRelease(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭数据库连接失败: " + err.Error()})
@@ -368,9 +450,6 @@ func (h *SystemHandler) uploadPostgresDump(c *gin.Context) {
 
 	reopenOnError := func() {
 		_ = database.InitWithOptions(currentOptions)
-		amp.ReinitLogWriter(database.GetDB())
-		amp.ReinitRequestDetailStore(database.GetDB())
-		amp.ReinitPendingCleaner(database.GetDB())
 	}
 
 	if err := database.RestorePostgresDatabase(context.Background(), currentOptions, bytes.ToValidUTF8(dumpContent, []byte(""))); err != nil {
@@ -383,9 +462,6 @@ func (h *SystemHandler) uploadPostgresDump(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新连接 PostgreSQL 失败: " + err.Error()})
 		return
 	}
-	amp.ReinitLogWriter(database.GetDB())
-	amp.ReinitRequestDetailStore(database.GetDB())
-	amp.ReinitPendingCleaner(database.GetDB())
 
 	c.JSON(http.StatusOK, gin.H{"message": "PostgreSQL dump 导入成功"})
 }
@@ -496,6 +572,12 @@ func (h *SystemHandler) RestoreBackup(c *gin.Context) {
 	shmPath := dbPath + "-shm"
 	currentBackup := "./data/data.db.backup." + time.Now().Format("20060102150405")
 
+	swap, ok := beginDatabaseSwap(c)
+	if !ok {
+		return
+	}
+	defer swap.End()
+
 	// 关闭数据库连接，释放文件句柄
 	if err := database.CloseAndRelease(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭数据库连接失败: " + err.Error()})
@@ -556,11 +638,6 @@ func (h *SystemHandler) RestoreBackup(c *gin.Context) {
 		return
 	}
 
-	// 重新初始化依赖数据库的组件
-	amp.ReinitLogWriter(database.GetDB())
-	amp.ReinitRequestDetailStore(database.GetDB())
-	amp.ReinitPendingCleaner(database.GetDB())
-
 	c.JSON(http.StatusOK, gin.H{"message": "数据库恢复并切换成功"})
 }
 
@@ -632,6 +709,48 @@ func (h *SystemHandler) UpdateRequestDetailEnabled(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "enabled": req.Enabled})
 }
 
+// GetResponseValidation 获取上游响应结构校验状态及最近发现的偏差
+func (h *SystemHandler) GetResponseValidation(c *gin.Context) {
+	items, counts := amp.GetSchemaDeviations()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":    amp.IsResponseValidationEnabled(),
+		"deviations": items,
+		"counts":     counts,
+	})
+}
+
+// UpdateResponseValidation 更新上游响应结构校验开关
+func (h *SystemHandler) UpdateResponseValidation(c *gin.Context) {
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	value := "false"
+	if req.Enabled {
+		value = "true"
+	}
+
+	if err := h.configRepo.Set(responseValidationKey, value); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	// 更新运行时配置
+	amp.SetResponseValidationEnabled(req.Enabled)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "enabled": req.Enabled})
+}
+
+// ClearResponseValidationDeviations 清空已记录的响应结构偏差
+func (h *SystemHandler) ClearResponseValidationDeviations(c *gin.Context) {
+	amp.ClearSchemaDeviations()
+	c.JSON(http.StatusOK, gin.H{"message": "已清空"})
+}
+
 // GetTimeoutConfig 获取超时配置
 func (h *SystemHandler) GetTimeoutConfig(c *gin.Context) {
 	value, err := h.configRepo.Get(timeoutConfigKey)
@@ -768,3 +887,1256 @@ func (h *SystemHandler) UpdateCacheTTLConfig(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "cacheTTL": req.CacheTTL})
 }
+
+// GetPendingCleanerConfig 获取 pending 请求清理配置
+func (h *SystemHandler) GetPendingCleanerConfig(c *gin.Context) {
+	value, err := h.configRepo.Get(pendingCleanerConfigKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取配置失败"})
+		return
+	}
+
+	// 如果没有配置，返回默认值
+	if value == "" {
+		defaultCfg := amp.DefaultPendingCleanerConfig()
+		c.JSON(http.StatusOK, model.PendingCleanerConfigResponse{
+			Enabled:         defaultCfg.Enabled,
+			IntervalSec:     int(defaultCfg.Interval / time.Second),
+			TimeoutSec:      int(defaultCfg.Timeout / time.Second),
+			SettleOnCleanup: defaultCfg.SettleOnCleanup,
+		})
+		return
+	}
+
+	var resp model.PendingCleanerConfigResponse
+	if err := json.Unmarshal([]byte(value), &resp); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析配置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdatePendingCleanerConfig 更新 pending 请求清理配置
+func (h *SystemHandler) UpdatePendingCleanerConfig(c *gin.Context) {
+	var req model.PendingCleanerConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	if req.IntervalSec < 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "intervalSec 必须 >= 10"})
+		return
+	}
+	if req.TimeoutSec < 60 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeoutSec 必须 >= 60"})
+		return
+	}
+
+	const maxDuration = time.Duration(1<<63 - 1)
+	maxSec := int64(maxDuration / time.Second)
+	if int64(req.IntervalSec) > maxSec || int64(req.TimeoutSec) > maxSec {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "清理参数过大，超出可表示范围"})
+		return
+	}
+
+	// 保存到数据库
+	resp := model.PendingCleanerConfigResponse{
+		Enabled:         req.Enabled,
+		IntervalSec:     req.IntervalSec,
+		TimeoutSec:      req.TimeoutSec,
+		SettleOnCleanup: req.SettleOnCleanup,
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+
+	if err := h.configRepo.Set(pendingCleanerConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	// 更新运行时配置
+	amp.UpdatePendingCleanerConfig(&amp.PendingCleanerConfig{
+		Enabled:         req.Enabled,
+		Interval:        time.Duration(req.IntervalSec) * time.Second,
+		Timeout:         time.Duration(req.TimeoutSec) * time.Second,
+		SettleOnCleanup: req.SettleOnCleanup,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": resp})
+}
+
+// GetLogRetention 获取请求日志保留策略、已清理到的时间及最近一次清理结果
+func (h *SystemHandler) GetLogRetention(c *gin.Context) {
+	cfg := amp.GetLogRetentionConfig()
+	status := model.LogRetentionStatus{
+		Config: model.LogRetentionConfigResponse{
+			Enabled:  cfg.Enabled,
+			LogDays:  cfg.LogDays,
+			BodyDays: cfg.BodyDays,
+		},
+		PrunedBefore: service.RequestLogsPrunedBefore(),
+	}
+	if pruner := amp.GetLogRetentionPruner(); pruner != nil {
+		status.LastRun = pruner.LastRun()
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdateLogRetention 更新请求日志保留策略，下一次清理时生效
+func (h *SystemHandler) UpdateLogRetention(c *gin.Context) {
+	var req model.LogRetentionConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	if req.LogDays != 0 && (req.LogDays < amp.MinLogRetentionDays || req.LogDays > 3650) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("logDays 必须为 0 或 %d-3650", amp.MinLogRetentionDays)})
+		return
+	}
+	if req.BodyDays < 0 || req.BodyDays > 3650 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bodyDays 必须为 0-3650"})
+		return
+	}
+
+	resp := model.LogRetentionConfigResponse{
+		Enabled:  req.Enabled,
+		LogDays:  req.LogDays,
+		BodyDays: req.BodyDays,
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(logRetentionConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	amp.UpdateLogRetentionConfig(&amp.LogRetentionConfig{
+		Enabled:  req.Enabled,
+		LogDays:  req.LogDays,
+		BodyDays: req.BodyDays,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": resp})
+}
+
+// RunLogRetention 按当前保留策略立即执行一次清理（不要求已启用自动清理）
+func (h *SystemHandler) RunLogRetention(c *gin.Context) {
+	pruner := amp.GetLogRetentionPruner()
+	if pruner == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "日志清理器未启动"})
+		return
+	}
+
+	result, err := pruner.RunOnce(time.Now())
+	if err != nil {
+		if errors.Is(err, amp.ErrLogRetentionRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "日志清理失败", "result": result})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetHTTPPolicy获取当前生效的 CORS 与嵌入策略（custom 表示来自系统配置）
+func (h *SystemHandler) GetHTTPPolicy(c *gin.Context) {
+	policy, custom := middleware.GetHTTPPolicy()
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "custom": custom})
+}
+
+// UpdateHTTPPolicy 更新 CORS 与嵌入策略，立即生效
+func (h *SystemHandler) UpdateHTTPPolicy(c *gin.Context) {
+	var req model.HTTPPolicyConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	policy := middleware.NormalizeHTTPPolicy(req)
+	if err := middleware.ValidateHTTPPolicy(policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(httpPolicyConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	// 更新运行时配置
+	middleware.UpdateHTTPPolicy(&policy)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "policy": policy})
+}
+
+// ResetHTTPPolicy 删除保存的策略，恢复环境变量中的默认值
+func (h *SystemHandler) ResetHTTPPolicy(c *gin.Context) {
+	if err := h.configRepo.Delete(httpPolicyConfigKey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	middleware.UpdateHTTPPolicy(nil)
+	policy, _ := middleware.GetHTTPPolicy()
+
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复默认配置", "policy": policy})
+}
+
+// GetAccessLogConfig 获取 HTTP 访问日志配置及实际写入的文件路径
+func (h *SystemHandler) GetAccessLogConfig(c *gin.Context) {
+	cfg, path := middleware.GetAccessLogConfig()
+	c.JSON(http.StatusOK, gin.H{"config": cfg, "filePath": path})
+}
+
+// UpdateAccessLogConfig 更新 HTTP 访问日志配置，日志文件无法打开时不保存
+func (h *SystemHandler) UpdateAccessLogConfig(c *gin.Context) {
+	var req model.AccessLogConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := middleware.NormalizeAccessLogConfig(req)
+	if err := middleware.ValidateAccessLogConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := middleware.UpdateAccessLogConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.configRepo.Set(accessLogConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	_, path := middleware.GetAccessLogConfig()
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg, "filePath": path})
+}
+
+// GetMaintenance 获取维护模式配置及进行中/排队中的请求数
+func (h *SystemHandler) GetMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetMaintenanceStatus())
+}
+
+// UpdateMaintenance 开启/关闭维护模式或修改其配置，立即生效
+func (h *SystemHandler) UpdateMaintenance(c *gin.Context) {
+	var req model.MaintenanceConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	req.StartedAt = nil
+	cfg := amp.NormalizeMaintenanceConfig(req)
+	if err := amp.ValidateMaintenanceConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 先更新运行时状态以获得开始时间，再持久化，重启后保持维护状态
+	cfg = amp.UpdateMaintenanceConfig(cfg)
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(maintenanceConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "status": amp.GetMaintenanceStatus()})
+}
+
+// GetMaintenanceNotice 返回维护横幅信息，供所有登录用户的控制台展示
+func (h *SystemHandler) GetMaintenanceNotice(c *gin.Context) {
+	cfg := amp.GetMaintenanceConfig()
+	if !cfg.Enabled {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   true,
+		"message":   cfg.Message,
+		"startedAt": cfg.StartedAt,
+	})
+}
+
+// GetResponseHeaderConfig 获取上游响应头透传策略（含各格式的默认规则）
+func (h *SystemHandler) GetResponseHeaderConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetResponseHeaderConfig())
+}
+
+// UpdateResponseHeaderConfig 更新上游响应头透传策略，未配置的格式使用默认规则，立即生效
+func (h *SystemHandler) UpdateResponseHeaderConfig(c *gin.Context) {
+	var req model.ResponseHeaderConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizeResponseHeaderConfig(req)
+	if err := amp.ValidateResponseHeaderConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(responseHeaderConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	amp.UpdateResponseHeaderConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": amp.GetResponseHeaderConfig()})
+}
+
+// ResetResponseHeaderConfig 删除保存的策略，恢复默认规则
+func (h *SystemHandler) ResetResponseHeaderConfig(c *gin.Context) {
+	if err := h.configRepo.Delete(responseHeaderConfigKey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	amp.UpdateResponseHeaderConfig(model.ResponseHeaderConfig{})
+
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复默认配置", "config": amp.GetResponseHeaderConfig()})
+}
+
+// GetEffectiveConfig 返回启动时生效的配置及每项来源（env/file/default），敏感值已脱敏
+func (h *SystemHandler) GetEffectiveConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, config.GetEffectiveConfig())
+}
+
+// GetSecretStatus 返回外部密钥引用的解析状态（不含密钥值）
+func (h *SystemHandler) GetSecretStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"refreshInterval": config.Get().SecretRefreshInterval.String(),
+		"secrets":         secrets.Statuses(),
+	})
+}
+
+// GetACMEStatus 返回 ACME 自动证书配置与各域名证书的到期状态
+func (h *SystemHandler) GetACMEStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, autotls.CurrentStatus())
+}
+
+// RefreshSecrets 立即从外部密钥存储重新拉取所有引用，用于轮换后无需等待刷新周期
+func (h *SystemHandler) RefreshSecrets(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+	defer cancel()
+	c.JSON(http.StatusOK, gin.H{"secrets": secrets.Refresh(ctx)})
+}
+
+// GetDemoStatus 返回是否处于演示模式；演示模式下同时返回可用的演示账户
+func (h *SystemHandler) GetDemoStatus(c *gin.Context) {
+	if !config.Get().DemoMode {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":  true,
+		"accounts": service.DemoAccounts,
+	})
+}
+
+// GetBillingShadow 获取计费影子模式配置及开启以来按模型汇总的费用
+func (h *SystemHandler) GetBillingShadow(c *gin.Context) {
+	status, err := service.GetBillingShadowStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取影子模式汇总失败"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdateBillingShadow 开启/关闭计费影子模式，立即生效
+func (h *SystemHandler) UpdateBillingShadow(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	// 先更新运行时状态以获得开始时间，再持久化，重启后汇总区间保持不变
+	cfg := service.UpdateBillingShadowConfig(*req.Enabled)
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(billingShadowConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetBillingAudit 获取计费一致性检查配置及最近一次检查结果
+func (h *SystemHandler) GetBillingAudit(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"config":     service.GetBillingAuditConfig(),
+		"lastReport": service.GetLastBillingAuditReport(),
+	})
+}
+
+// UpdateBillingAudit 更新计费一致性检查配置，立即生效
+func (h *SystemHandler) UpdateBillingAudit(c *gin.Context) {
+	var req model.BillingAuditConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := service.NormalizeBillingAuditConfig(req)
+	if err := service.ValidateBillingAuditConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(billingAuditConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	service.UpdateBillingAuditConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// RunBillingAudit 立即执行一次计费一致性检查，repair 为 true 时修复可修复的问题
+func (h *SystemHandler) RunBillingAudit(c *gin.Context) {
+	var req struct {
+		Repair bool `json:"repair"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+	}
+
+	report, err := service.RunBillingAudit(req.Repair)
+	if err != nil {
+		if errors.Is(err, service.ErrBillingAuditRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计费一致性检查失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetGroupBudgetAlertConfig 获取分组预算告警配置
+func (h *SystemHandler) GetGroupBudgetAlertConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetGroupBudgetAlertConfig())
+}
+
+// UpdateGroupBudgetAlertConfig 更新分组预算告警配置，立即生效
+func (h *SystemHandler) UpdateGroupBudgetAlertConfig(c *gin.Context) {
+	var req model.GroupBudgetAlertConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := service.NormalizeGroupBudgetAlertConfig(req)
+	if err := service.ValidateGroupBudgetAlertConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(groupBudgetConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	service.UpdateGroupBudgetAlertConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// RunGroupBudgetCheck 立即检查各分组的本月预算，返回新触发的告警
+func (h *SystemHandler) RunGroupBudgetCheck(c *gin.Context) {
+	alerts, err := service.RunGroupBudgetCheck()
+	if err != nil {
+		if errors.Is(err, service.ErrGroupBudgetCheckRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "分组预算检查失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+}
+
+// GetNewUserDefaultsConfig 获取新用户默认配置
+func (h *SystemHandler) GetNewUserDefaultsConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetNewUserDefaultsConfig())
+}
+
+// UpdateNewUserDefaultsConfig 更新新用户默认配置，对之后创建的用户生效
+func (h *SystemHandler) UpdateNewUserDefaultsConfig(c *gin.Context) {
+	var req model.NewUserDefaultsConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := service.NormalizeNewUserDefaultsConfig(req)
+	if err := service.ValidateNewUserDefaultsConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(newUserDefaultsConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	service.UpdateNewUserDefaultsConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// PreviewNewUserDefaults 按用户名与邮箱预览新用户将被分配的分组、套餐与设置
+func (h *SystemHandler) PreviewNewUserDefaults(c *gin.Context) {
+	var req model.NewUserDefaultsPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	c.JSON(http.StatusOK, service.PreviewNewUserDefaults(&req))
+}
+
+// GetChannelHealthConfig 获取渠道健康检查配置
+func (h *SystemHandler) GetChannelHealthConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, health.GetConfig())
+}
+
+// UpdateChannelHealthConfig 更新渠道健康检查配置，立即生效
+func (h *SystemHandler) UpdateChannelHealthConfig(c *gin.Context) {
+	var req model.ChannelHealthConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := health.NormalizeConfig(req)
+	if err := health.ValidateConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(channelHealthConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	health.UpdateConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetChannelKeyCheckConfig 获取渠道密钥有效性检查配置
+func (h *SystemHandler) GetChannelKeyCheckConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, health.GetKeyCheckConfig())
+}
+
+// UpdateChannelKeyCheckConfig 更新渠道密钥有效性检查配置，立即生效
+func (h *SystemHandler) UpdateChannelKeyCheckConfig(c *gin.Context) {
+	var req model.ChannelKeyCheckConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := health.NormalizeKeyCheckConfig(req)
+	if err := health.ValidateKeyCheckConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(channelKeyCheckConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	health.UpdateKeyCheckConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// RunChannelKeyCheck 立即检查所有启用渠道的密钥
+func (h *SystemHandler) RunChannelKeyCheck(c *gin.Context) {
+	if !health.GetKeyCheckConfig().Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "渠道密钥检查未启用"})
+		return
+	}
+	results, err := amp.RunChannelKeyCheck()
+	if err != nil {
+		if errors.Is(err, amp.ErrChannelKeyCheckRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "渠道密钥检查失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// GetChannelFailoverConfig 获取渠道故障转移配置
+func (h *SystemHandler) GetChannelFailoverConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetChannelFailoverConfig())
+}
+
+// UpdateChannelFailoverConfig 更新渠道故障转移配置，立即生效
+func (h *SystemHandler) UpdateChannelFailoverConfig(c *gin.Context) {
+	var req model.ChannelFailoverConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizeChannelFailoverConfig(req)
+	if err := amp.ValidateChannelFailoverConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(channelFailoverConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateChannelFailoverConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetChannelStickyConfig 获取会话粘性配置
+func (h *SystemHandler) GetChannelStickyConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetChannelStickyConfig())
+}
+
+// UpdateChannelStickyConfig 更新会话粘性配置，立即生效
+func (h *SystemHandler) UpdateChannelStickyConfig(c *gin.Context) {
+	var req model.ChannelStickyConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizeChannelStickyConfig(req)
+	if err := amp.ValidateChannelStickyConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(channelStickyConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateChannelStickyConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetConcurrencyLimitConfig 获取并发上限处理策略及当前各规则的占用
+func (h *SystemHandler) GetConcurrencyLimitConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetConcurrencyLimitStatus())
+}
+
+// UpdateConcurrencyLimitConfig 更新并发上限处理策略（拒绝 / 排队），立即生效
+func (h *SystemHandler) UpdateConcurrencyLimitConfig(c *gin.Context) {
+	var req model.ConcurrencyLimitConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizeConcurrencyLimitConfig(req)
+	if err := amp.ValidateConcurrencyLimitConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(concurrencyLimitConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateConcurrencyLimitConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetStreamFlushConfig 获取流式响应刷新合并配置
+func (h *SystemHandler) GetStreamFlushConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetStreamFlushConfig())
+}
+
+// UpdateStreamFlushConfig 更新流式响应刷新合并配置，对之后开始的请求生效
+func (h *SystemHandler) UpdateStreamFlushConfig(c *gin.Context) {
+	var req model.StreamFlushConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizeStreamFlushConfig(req)
+	if err := amp.ValidateStreamFlushConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(streamFlushConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateStreamFlushConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetMemoryGuardConfig 获取内存保护配置
+func (h *SystemHandler) GetMemoryGuardConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetMemoryGuardConfig())
+}
+
+// UpdateMemoryGuardConfig 更新内存保护配置：单请求预算对之后开始的请求生效，水位立即重新检查
+func (h *SystemHandler) UpdateMemoryGuardConfig(c *gin.Context) {
+	var req model.MemoryGuardConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizeMemoryGuardConfig(req)
+	if err := amp.ValidateMemoryGuardConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(memoryGuardConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateMemoryGuardConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetMemoryGuardStatus 当前进程内存水位与单请求预算的降级、中止统计
+func (h *SystemHandler) GetMemoryGuardStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetMemoryGuardStatus())
+}
+
+// GetRuntimeDebugConfig 获取运行时诊断开关
+func (h *SystemHandler) GetRuntimeDebugConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetRuntimeDebugConfig())
+}
+
+// UpdateRuntimeDebugConfig 开启或关闭 pprof、运行时指标与 goroutine 堆栈接口，立即生效
+func (h *SystemHandler) UpdateRuntimeDebugConfig(c *gin.Context) {
+	var req model.RuntimeDebugConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(runtimeDebugConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	service.UpdateRuntimeDebugConfig(req)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": req})
+}
+
+// GetTranslationConfig 获取跨格式翻译配置
+func (h *SystemHandler) GetTranslationConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetTranslationConfig())
+}
+
+// UpdateTranslationConfig 更新跨格式翻译配置（严格 / 宽松模式），立即生效
+func (h *SystemHandler) UpdateTranslationConfig(c *gin.Context) {
+	var req model.TranslationConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(translationConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateTranslationConfig(req)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": req})
+}
+
+// GetToolLoopConfig 获取工具调用循环检测配置
+func (h *SystemHandler) GetToolLoopConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetToolLoopConfig())
+}
+
+// UpdateToolLoopConfig 更新工具调用循环检测配置，立即生效
+func (h *SystemHandler) UpdateToolLoopConfig(c *gin.Context) {
+	var req model.ToolLoopConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizeToolLoopConfig(req)
+	if err := amp.ValidateToolLoopConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(toolLoopConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateToolLoopConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetOutputFilterConfig 获取输出过滤配置及最近的命中记录
+func (h *SystemHandler) GetOutputFilterConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"config":    amp.GetOutputFilterConfig(),
+		"incidents": amp.GetOutputFilterIncidents(),
+	})
+}
+
+// UpdateOutputFilterConfig 更新输出过滤配置，对新请求立即生效
+func (h *SystemHandler) UpdateOutputFilterConfig(c *gin.Context) {
+	var req model.OutputFilterConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizeOutputFilterConfig(req)
+	if err := amp.ValidateOutputFilterConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(outputFilterConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateOutputFilterConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetDetailRedactionConfig 获取请求详情脱敏配置
+func (h *SystemHandler) GetDetailRedactionConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"config": amp.GetDetailRedactionConfig()})
+}
+
+// UpdateDetailRedactionConfig 更新请求详情脱敏配置，对之后写入的详情与详情接口立即生效
+func (h *SystemHandler) UpdateDetailRedactionConfig(c *gin.Context) {
+	var req model.DetailRedactionConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizeDetailRedactionConfig(req)
+	if err := amp.ValidateDetailRedactionConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(detailRedactionConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateDetailRedactionConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetPIIRedactionConfig 获取转发前脱敏配置
+func (h *SystemHandler) GetPIIRedactionConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"config": amp.GetPIIRedactionConfig()})
+}
+
+// UpdatePIIRedactionConfig 更新转发前脱敏配置，对之后的请求立即生效
+func (h *SystemHandler) UpdatePIIRedactionConfig(c *gin.Context) {
+	var req model.PIIRedactionConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.NormalizePIIRedactionConfig(req)
+	if err := amp.ValidatePIIRedactionConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(piiRedactionConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdatePIIRedactionConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetTranslatorMetrics 格式转换统计：按 (from, to, 操作) 统计调用、回退原始数据与错误分类
+func (h *SystemHandler) GetTranslatorMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, translator.Metrics())
+}
+
+// ResetTranslatorMetrics 清空格式转换统计
+func (h *SystemHandler) ResetTranslatorMetrics(c *gin.Context) {
+	translator.ResetMetrics()
+	c.JSON(http.StatusOK, gin.H{"message": "统计已清空"})
+}
+
+// GetChannelCapacityConfig 获取渠道容量建议配置
+func (h *SystemHandler) GetChannelCapacityConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetChannelCapacityConfig())
+}
+
+// UpdateChannelCapacityConfig 更新渠道容量建议配置，立即生效
+func (h *SystemHandler) UpdateChannelCapacityConfig(c *gin.Context) {
+	var req model.ChannelCapacityConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := service.NormalizeChannelCapacityConfig(req)
+	if err := service.ValidateChannelCapacityConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(channelCapacityConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	service.UpdateChannelCapacityConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetQuotaEnforcementConfig 获取模型调用前的额度检查配置
+func (h *SystemHandler) GetQuotaEnforcementConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetQuotaEnforcementConfig())
+}
+
+// UpdateQuotaEnforcementConfig 更新模型调用前的额度检查配置，立即生效
+func (h *SystemHandler) UpdateQuotaEnforcementConfig(c *gin.Context) {
+	var req model.QuotaEnforcementConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := service.NormalizeQuotaEnforcementConfig(req)
+	if err := service.ValidateQuotaEnforcementConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(quotaEnforcementConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	service.UpdateQuotaEnforcementConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetPasswordPolicy 获取密码策略及泄露密码库加载情况
+func (h *SystemHandler) GetPasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetPasswordPolicyStatus())
+}
+
+// UpdatePasswordPolicy 更新密码策略，立即生效；已有密码不受影响，下次设置密码时按新策略校验
+func (h *SystemHandler) UpdatePasswordPolicy(c *gin.Context) {
+	var req model.PasswordPolicyConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := service.NormalizePasswordPolicyConfig(req)
+	if err := service.ValidatePasswordPolicyConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(passwordPolicyConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	service.UpdatePasswordPolicyConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetOIDCConfig 获取 SSO 登录配置，不返回明文客户端密钥
+func (h *SystemHandler) GetOIDCConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetOIDCConfigMasked())
+}
+
+// UpdateOIDCConfig 更新 SSO 登录配置，立即生效；未填写客户端密钥时沿用原密钥
+func (h *SystemHandler) UpdateOIDCConfig(c *gin.Context) {
+	var req model.OIDCConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := service.MergeOIDCClientSecret(service.NormalizeOIDCConfig(req))
+	if err := service.ValidateOIDCConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(oidcConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	service.UpdateOIDCConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": service.GetOIDCConfigMasked()})
+}
+
+// GetModelSyncConfig 获取上游模型自动同步配置
+func (h *SystemHandler) GetModelSyncConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetModelSyncConfig())
+}
+
+// UpdateModelSyncConfig 更新上游模型自动同步配置，立即生效
+func (h *SystemHandler) UpdateModelSyncConfig(c *gin.Context) {
+	var req model.ModelSyncConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := service.NormalizeModelSyncConfig(req)
+	if err := service.ValidateModelSyncConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(modelSyncConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	service.UpdateModelSyncConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": cfg})
+}
+
+// GetRequestLogPolicy 获取按端点类别的请求日志策略
+func (h *SystemHandler) GetRequestLogPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetRequestLogPolicy())
+}
+
+// UpdateRequestLogPolicy 更新请求日志策略，对新请求立即生效
+func (h *SystemHandler) UpdateRequestLogPolicy(c *gin.Context) {
+	var req model.RequestLogPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	policy := amp.NormalizeRequestLogPolicy(req)
+	if err := amp.ValidateRequestLogPolicy(policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(requestLogPolicyKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateRequestLogPolicy(policy)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": policy})
+}
+
+// GetFederationConfig 获取联邦配置（受信任的下级实例），不返回明文密钥
+func (h *SystemHandler) GetFederationConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, amp.GetFederationConfigMasked())
+}
+
+// UpdateFederationConfig 更新联邦配置，立即生效；未填写密钥的签发方沿用原密钥
+func (h *SystemHandler) UpdateFederationConfig(c *gin.Context) {
+	var req model.FederationConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	cfg := amp.MergeFederationSecrets(amp.NormalizeFederationConfig(req))
+	if err := amp.ValidateFederationConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "序列化配置失败"})
+		return
+	}
+	if err := h.configRepo.Set(federationConfigKey, string(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
+		return
+	}
+	amp.UpdateFederationConfig(cfg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "配置已更新", "config": amp.GetFederationConfigMasked()})
+}
@@ -124,6 +124,7 @@ func switchRuntimeDatabase(options database.Options) error {
 	amp.ReinitLogWriter(database.GetDB())
 	amp.ReinitRequestDetailStore(database.GetDB())
 	amp.ReinitPendingCleaner(database.GetDB())
+	amp.ReinitLogRetentionPruner(database.GetDB())
 
 	if cfg := config.Get(); cfg != nil {
 		cfg.DBType = string(options.Type)
@@ -4,21 +4,26 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"ampmanager/internal/middleware"
 	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
 	"ampmanager/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
 type UserHandler struct {
-	userService *service.UserService
+	userService    *service.UserService
+	billingService *service.BillingService
 }
 
 func NewUserHandler() *UserHandler {
 	return &UserHandler{
-		userService: service.NewUserService(),
+		userService:    service.NewUserService(),
+		billingService: service.NewBillingService(),
 	}
 }
 
@@ -34,18 +39,29 @@ func (h *UserHandler) Register(c *gin.Context) {
 
 	user, err := h.userService.Register(&req)
 	if err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
 		status := http.StatusInternalServerError
 		msg := "注册失败"
 
 		if errors.Is(err, service.ErrUsernameExists) {
 			status = http.StatusConflict
 			msg = err.Error()
+		} else if errors.Is(err, service.ErrPasswordLoginDisabled) {
+			status = http.StatusForbidden
+			msg = err.Error()
 		}
 
 		c.JSON(status, gin.H{"error": msg})
 		return
 	}
 
+	// 填写了邮箱且已配置 SMTP 与 PUBLIC_URL 时发送验证邮件，发送失败不影响注册，可稍后重新发送
+	if user.Email != "" {
+		_ = h.userService.SendEmailVerification(user.ID)
+	}
+
 	// 注册成功后自动生成 token
 	jwtService := service.NewJWTService()
 	token, err := jwtService.GenerateToken(user.ID, user.Username)
@@ -79,12 +95,20 @@ func (h *UserHandler) Login(c *gin.Context) {
 
 	user, token, err := h.userService.Login(&req)
 	if err != nil {
+		var suspended *service.SuspendedError
+		if errors.As(err, &suspended) {
+			middleware.AbortSuspended(c, suspended.Suspension)
+			return
+		}
 		status := http.StatusInternalServerError
 		msg := "登录失败"
 
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			status = http.StatusUnauthorized
 			msg = err.Error()
+		} else if errors.Is(err, service.ErrPasswordLoginDisabled) {
+			status = http.StatusForbidden
+			msg = err.Error()
 		}
 
 		c.JSON(status, gin.H{"error": msg})
@@ -97,9 +121,25 @@ func (h *UserHandler) Login(c *gin.Context) {
 		Token:    token,
 		IsAdmin:  user.IsAdmin,
 		Message:  "登录成功",
+
+		MustChangePassword: service.UserPasswordChangeDue(user, time.Now()),
 	})
 }
 
+// respondPasswordPolicyError 新密码不符合密码策略时返回 400（含未满足的各项要求），已处理时返回 true
+func respondPasswordPolicyError(c *gin.Context, err error) bool {
+	var policyErr *service.PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "weak_password", "violations": policyErr.Violations})
+	case errors.Is(err, service.ErrPasswordReused):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "password_reused"})
+	default:
+		return false
+	}
+	return true
+}
+
 func (h *UserHandler) ChangePassword(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	if userID == "" {
@@ -114,6 +154,9 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 	}
 
 	if err := h.userService.ChangePassword(userID, req.OldPassword, req.NewPassword); err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -146,6 +189,60 @@ func (h *UserHandler) ChangeUsername(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "用户名修改成功"})
 }
 
+// GetMyTimezone 获取当前用户的报表时区
+func (h *UserHandler) GetMyTimezone(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	timezone, err := h.userService.GetTimezone(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取时区失败"})
+		return
+	}
+	c.JSON(http.StatusOK, model.TimezoneSetting{Timezone: timezone})
+}
+
+// UpdateMyTimezone 设置当前用户的报表时区，空字符串恢复为 UTC
+func (h *UserHandler) UpdateMyTimezone(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req model.TimezoneSetting
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	timezone, err := h.userService.SetTimezone(userID, req.Timezone)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTimezone):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "设置时区失败"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, model.TimezoneSetting{Timezone: timezone})
+}
+
+// GetMyAdminScope 返回当前用户的管理权限范围（全局管理员或所辖分组）
+func (h *UserHandler) GetMyAdminScope(c *gin.Context) {
+	scope, err := service.ResolveAdminScope(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取管理权限失败"})
+		return
+	}
+	if scope == nil {
+		scope = &service.AdminScope{GroupIDs: []string{}}
+	}
+	c.JSON(http.StatusOK, scope)
+}
+
+// ListUsers 列出用户，分组管理员只能看到所辖分组内的非管理员用户
 func (h *UserHandler) ListUsers(c *gin.Context) {
 	users, err := h.userService.ListUsers()
 	if err != nil {
@@ -153,7 +250,7 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, service.FilterUsersInScope(middleware.GetAdminScope(c), users))
 }
 
 func (h *UserHandler) SetAdmin(c *gin.Context) {
@@ -199,7 +296,14 @@ func (h *UserHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	if err := h.userService.ResetPassword(userID, req.NewPassword); err != nil {
+	if err := h.userService.ResetPassword(middleware.GetUserID(c), userID, req.NewPassword, req.ForceChange); err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
 		return
 	}
@@ -207,6 +311,50 @@ func (h *UserHandler) ResetPassword(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "密码已重置"})
 }
 
+// SetPasswordChangeRequired 要求用户（或取消要求）在继续使用管理接口前修改密码，API Key 调用不受影响
+func (h *UserHandler) SetPasswordChangeRequired(c *gin.Context) {
+	var req model.ForcePasswordChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if err := h.userService.SetPasswordMustChange(middleware.GetUserID(c), c.Param("id"), req.Required); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "设置成功", "required": req.Required})
+}
+
+// GetCredentialHygiene 凭据卫生报告：passwordDays（默认取密码有效期，未设置时 90）天未修改密码的账户，
+// 以及创建超过 keyDays（默认 30）天仍从未使用的 API Key
+func (h *UserHandler) GetCredentialHygiene(c *gin.Context) {
+	defaultPasswordDays := service.GetPasswordPolicyConfig().MaxAgeDays
+	if defaultPasswordDays <= 0 {
+		defaultPasswordDays = 90
+	}
+	passwordDays, err := strconv.Atoi(c.DefaultQuery("passwordDays", strconv.Itoa(defaultPasswordDays)))
+	if err != nil || passwordDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "passwordDays 必须为非负整数"})
+		return
+	}
+	keyDays, err := strconv.Atoi(c.DefaultQuery("keyDays", "30"))
+	if err != nil || keyDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "keyDays 必须为非负整数"})
+		return
+	}
+
+	report, err := service.CredentialHygieneReport(passwordDays, keyDays)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成报告失败"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
 func (h *UserHandler) SetGroup(c *gin.Context) {
 	userID := c.Param("id")
 	var req model.SetGroupsRequest
@@ -214,7 +362,11 @@ func (h *UserHandler) SetGroup(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
 		return
 	}
-	if err := h.userService.SetGroups(userID, req.GroupIDs); err != nil {
+	if err := h.userService.SetGroupsInScope(middleware.GetAdminScope(c), userID, req.GroupIDs); err != nil {
+		if errors.Is(err, service.ErrOutOfAdminScope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置分组失败"})
 		return
 	}
@@ -236,7 +388,11 @@ func (h *UserHandler) TopUp(c *gin.Context) {
 		return
 	}
 
-	if err := h.userService.TopUp(userID, amountMicros); err != nil {
+	if err := h.userService.TopUp(middleware.GetUserID(c), userID, amountMicros, req.Reason); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "充值失败"})
 		return
 	}
@@ -249,6 +405,122 @@ func (h *UserHandler) TopUp(c *gin.Context) {
 	})
 }
 
+// AdjustBalance 管理员增加或扣减用户余额，必须填写原因；记录为 adjustment 计费事件并写入审计记录
+func (h *UserHandler) AdjustBalance(c *gin.Context) {
+	userID := c.Param("id")
+
+	var req model.BalanceAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+	amountMicros, err := service.BalanceAdjustmentAmount(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err := h.billingService.AdjustBalance(middleware.GetUserID(c), userID, req.Direction, amountMicros, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInsufficientBalance):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidBalanceAdjustment):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "调整余额失败"})
+		}
+		return
+	}
+
+	balance := *event.BalanceAfterMicros
+	c.JSON(http.StatusOK, model.BalanceAdjustmentResponse{
+		Event:         event,
+		BalanceMicros: balance,
+		BalanceUsd:    fmt.Sprintf("%.6f", float64(balance)/1e6),
+	})
+}
+
+// SuspendUser 管理员停用用户：代理与管理接口均返回带原因的 403，可选到期自动恢复
+func (h *UserHandler) SuspendUser(c *gin.Context) {
+	userID := c.Param("id")
+
+	var req model.SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	suspension, err := h.userService.SuspendUser(middleware.GetUserID(c), userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrCannotSuspendSelf), errors.Is(err, service.ErrInvalidSuspension):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "停用用户失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, suspension)
+}
+
+// UnsuspendUser 管理员恢复被停用的用户
+func (h *UserHandler) UnsuspendUser(c *gin.Context) {
+	wasSuspended, err := h.userService.UnsuspendUser(middleware.GetUserID(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复用户失败"})
+		return
+	}
+
+	message := "用户已恢复"
+	if !wasSuspended {
+		message = "用户未处于停用状态"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "wasSuspended": wasSuspended})
+}
+
+// ListBillingHistory 管理员查看用户的计费记录
+func (h *UserHandler) ListBillingHistory(c *gin.Context) {
+	page, pageSize := parseBillingHistoryPage(c)
+	result, err := h.billingService.ListBillingHistory(c.Param("id"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取计费记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetMyBillingHistory 当前用户的计费记录（扣费、退款与余额调整）
+func (h *UserHandler) GetMyBillingHistory(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	page, pageSize := parseBillingHistoryPage(c)
+	result, err := h.billingService.ListBillingHistory(userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取计费记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func parseBillingHistoryPage(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+	return page, pageSize
+}
+
 func (h *UserHandler) GetMyBalance(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	if userID == "" {
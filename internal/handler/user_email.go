@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondEmailError 邮箱与找回密码相关错误的统一响应
+func respondEmailError(c *gin.Context, err error, fallback string) {
+	if respondPasswordPolicyError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailNotSet), errors.Is(err, service.ErrEmailAlreadyVerified), errors.Is(err, service.ErrInvalidEmailToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMailDisabled), errors.Is(err, service.ErrPublicURLNotSet):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailSendFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetMyEmail 获取当前用户的邮箱与验证状态
+func (h *UserHandler) GetMyEmail(c *gin.Context) {
+	status, err := h.userService.GetEmailStatus(middleware.GetUserID(c))
+	if err != nil {
+		respondEmailError(c, err, "获取邮箱失败")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdateMyEmail 设置或解绑当前用户的邮箱，设置后发送验证邮件
+func (h *UserHandler) UpdateMyEmail(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req model.UpdateEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+
+	if err := h.userService.UpdateEmail(userID, req.Email); err != nil {
+		if errors.Is(err, service.ErrEmailSendFailed) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "邮箱已保存，但验证邮件发送失败，请稍后重新发送"})
+			return
+		}
+		if errors.Is(err, service.ErrPublicURLNotSet) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "邮箱已保存，但服务端未配置 PUBLIC_URL，无法发送验证邮件，请联系管理员"})
+			return
+		}
+		respondEmailError(c, err, "设置邮箱失败")
+		return
+	}
+
+	status, err := h.userService.GetEmailStatus(userID)
+	if err != nil {
+		respondEmailError(c, err, "获取邮箱失败")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// ResendEmailVerification 重新发送验证邮件
+func (h *UserHandler) ResendEmailVerification(c *gin.Context) {
+	if err := h.userService.SendEmailVerification(middleware.GetUserID(c)); err != nil {
+		respondEmailError(c, err, "发送验证邮件失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "验证邮件已发送"})
+}
+
+// VerifyEmail 使用验证邮件中的令牌完成邮箱验证（无需登录）
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	var req model.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if err := h.userService.VerifyEmail(req.Token); err != nil {
+		respondEmailError(c, err, "验证邮箱失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "邮箱验证成功"})
+}
+
+// RequestPasswordReset 申请找回密码，无论邮箱是否已注册都返回相同结果
+func (h *UserHandler) RequestPasswordReset(c *gin.Context) {
+	var req model.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if err := h.userService.RequestPasswordReset(req.Email); err != nil {
+		respondEmailError(c, err, "申请找回密码失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "如果该邮箱已绑定并验证，重置密码的链接将发送到该邮箱"})
+}
+
+// ConfirmPasswordReset 使用找回密码邮件中的令牌设置新密码
+func (h *UserHandler) ConfirmPasswordReset(c *gin.Context) {
+	var req model.PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误", "details": err.Error()})
+		return
+	}
+	if err := h.userService.ConfirmPasswordReset(req.Token, req.NewPassword); err != nil {
+		respondEmailError(c, err, "重置密码失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请使用新密码登录"})
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"ampmanager/internal/config"
+	"ampmanager/internal/mail"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+// startFakeSMTP 启动只接收邮件的 SMTP 服务器并配置为发信服务器，返回收到的邮件正文
+func startFakeSMTP(t *testing.T) <-chan string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	bodies := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeSMTP(conn, bodies)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	if err := mail.Configure(mail.Options{Host: host, Port: port, From: "noreply@example.com", TLS: mail.TLSNone}); err != nil {
+		t.Fatalf("configure mail: %v", err)
+	}
+	t.Cleanup(func() { _ = mail.Configure(mail.Options{}) })
+	return bodies
+}
+
+func serveFakeSMTP(conn net.Conn, bodies chan<- string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			reply("250 localhost")
+		case line == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil || dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			reply("250 queued")
+			bodies <- decodeMailBody(data.String())
+		case line == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func decodeMailBody(data string) string {
+	msg, err := netmail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	raw := new(strings.Builder)
+	scanner := bufio.NewScanner(msg.Body)
+	for scanner.Scan() {
+		raw.WriteString(scanner.Text())
+	}
+	body, _ := base64.StdEncoding.DecodeString(raw.String())
+	return string(body)
+}
+
+func withPublicURL(t *testing.T, publicURL string) {
+	t.Helper()
+	t.Setenv("PUBLIC_URL", publicURL)
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+}
+
+func createVerifiedUser(t *testing.T, username, email string) *model.User {
+	t.Helper()
+	users := repository.NewUserRepository()
+	user := &model.User{Username: username, PasswordHash: "x"}
+	if err := users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := users.UpdateEmail(user.ID, email); err != nil {
+		t.Fatalf("update email: %v", err)
+	}
+	if ok, err := users.MarkEmailVerified(user.ID, email); err != nil || !ok {
+		t.Fatalf("verify email: %v, %v", ok, err)
+	}
+	return user
+}
+
+// spoofedRequest 以伪造的 Host 与 X-Forwarded-Host 发送请求
+func spoofedRequest(engine http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Host = "evil.example.net"
+	req.Header.Set("X-Forwarded-Host", "attacker.example.org")
+	req.Header.Set("X-Forwarded-Proto", "http")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestPasswordResetLinkIgnoresRequestHost(t *testing.T) {
+	setupTestDB(t)
+	withPublicURL(t, "https://amp.example.com")
+	bodies := startFakeSMTP(t)
+	createVerifiedUser(t, "alice", "alice@example.com")
+
+	engine := newTestEngine("")
+	engine.POST("/auth/password-reset", NewUserHandler().RequestPasswordReset)
+	w := spoofedRequest(engine, http.MethodPost, "/auth/password-reset", `{"email":"alice@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case body := <-bodies:
+		if !strings.Contains(body, "https://amp.example.com/reset-password?token=") {
+			t.Errorf("reset mail = %q", body)
+		}
+		if strings.Contains(body, "evil.example.net") || strings.Contains(body, "attacker.example.org") {
+			t.Errorf("reset link uses request host: %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reset mail not sent")
+	}
+}
+
+func TestVerificationLinkIgnoresRequestHost(t *testing.T) {
+	setupTestDB(t)
+	withPublicURL(t, "https://amp.example.com")
+	bodies := startFakeSMTP(t)
+	user := &model.User{Username: "bob", PasswordHash: "x"}
+	if err := repository.NewUserRepository().Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	engine := newTestEngine(user.ID)
+	engine.PUT("/me/email", NewUserHandler().UpdateMyEmail)
+	w := spoofedRequest(engine, http.MethodPut, "/me/email", `{"email":"bob@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case body := <-bodies:
+		if !strings.Contains(body, "https://amp.example.com/verify-email?token=") || strings.Contains(body, "example.net") || strings.Contains(body, "example.org") {
+			t.Errorf("verification mail = %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("verification mail not sent")
+	}
+}
+
+// 未配置 PUBLIC_URL 时拒绝发送邮件，而不是按请求头推断链接地址
+func TestEmailLinksRequirePublicURL(t *testing.T) {
+	setupTestDB(t)
+	withPublicURL(t, "")
+	bodies := startFakeSMTP(t)
+	createVerifiedUser(t, "alice", "alice@example.com")
+	pending := &model.User{Username: "bob", PasswordHash: "x"}
+	users := repository.NewUserRepository()
+	if err := users.Create(pending); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := users.UpdateEmail(pending.ID, "bob@example.com"); err != nil {
+		t.Fatalf("update email: %v", err)
+	}
+
+	engine := newTestEngine(pending.ID)
+	handler := NewUserHandler()
+	engine.POST("/auth/password-reset", handler.RequestPasswordReset)
+	engine.POST("/me/email/verification", handler.ResendEmailVerification)
+
+	if w := spoofedRequest(engine, http.MethodPost, "/auth/password-reset", `{"email":"alice@example.com"}`); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "PUBLIC_URL") {
+		t.Errorf("password reset status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := spoofedRequest(engine, http.MethodPost, "/me/email/verification", `{}`); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "PUBLIC_URL") {
+		t.Errorf("verification status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case body := <-bodies:
+		t.Errorf("mail sent without PUBLIC_URL: %q", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupTestDB 为每个测试初始化独立的 SQLite 数据库
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+}
+
+// newTestEngine 以 actorID 身份调用 handler，模拟已通过 JWT 认证
+func newTestEngine(actorID string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		if actorID != "" {
+			c.Set(middleware.ContextKeyUserID, actorID)
+		}
+		c.Next()
+	})
+	return engine
+}
+
+func doJSON(engine *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdjustBalanceHandler(t *testing.T) {
+	setupTestDB(t)
+	users := repository.NewUserRepository()
+	user := &model.User{Username: "alice", PasswordHash: "x", BalanceMicros: 500_000}
+	if err := users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	engine := newTestEngine("admin-1")
+	engine.POST("/users/:id/balance-adjustments", NewUserHandler().AdjustBalance)
+	path := "/users/" + user.ID + "/balance-adjustments"
+
+	cases := []struct {
+		name    string
+		path    string
+		body    string
+		status  int
+		balance int64
+	}{
+		{"debit below zero", path, `{"direction":"debit","amountMicros":500001,"reason":"overdraw"}`, http.StatusConflict, 500_000},
+		{"missing reason", path, `{"direction":"debit","amountMicros":1}`, http.StatusBadRequest, 500_000},
+		{"missing amount", path, `{"direction":"credit","reason":"none"}`, http.StatusBadRequest, 500_000},
+		{"negative amount", path, `{"direction":"debit","amountMicros":-5,"reason":"negative"}`, http.StatusBadRequest, 500_000},
+		{"unknown user", "/users/missing/balance-adjustments", `{"direction":"credit","amountMicros":1,"reason":"ghost"}`, http.StatusNotFound, 500_000},
+		{"credit usd", path, `{"direction":"credit","amountUsd":1.005,"reason":"refund"}`, http.StatusOK, 1_505_000},
+		{"debit", path, `{"direction":"debit","amountMicros":505000,"reason":"correction"}`, http.StatusOK, 1_000_000},
+	}
+	for _, tc := range cases {
+		w := doJSON(engine, http.MethodPost, tc.path, tc.body)
+		if w.Code != tc.status {
+			t.Errorf("%s: status = %d, body = %s", tc.name, w.Code, w.Body.String())
+		}
+		balance, _ := users.GetBalance(user.ID)
+		if balance != tc.balance {
+			t.Errorf("%s: balance = %d, want %d", tc.name, balance, tc.balance)
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		var resp model.BalanceAdjustmentResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decode: %v", tc.name, err)
+		}
+		if resp.BalanceMicros != tc.balance || resp.Event == nil || resp.Event.Actor != "admin-1" || *resp.Event.BalanceAfterMicros != tc.balance {
+			t.Errorf("%s: response = %s", tc.name, w.Body.String())
+		}
+	}
+}
+
+func withPasswordPolicy(t *testing.T, cfg model.PasswordPolicyConfig) {
+	t.Helper()
+	prev := service.GetPasswordPolicyConfig()
+	service.UpdatePasswordPolicyConfig(service.NormalizePasswordPolicyConfig(cfg))
+	t.Cleanup(func() { service.UpdatePasswordPolicyConfig(prev) })
+}
+
+type passwordErrorResponse struct {
+	Code       string   `json:"code"`
+	Violations []string `json:"violations"`
+}
+
+func TestRegisterRejectsWeakPassword(t *testing.T) {
+	setupTestDB(t)
+	withPasswordPolicy(t, model.PasswordPolicyConfig{MinLength: 10, RequireDigit: true, DisallowUsername: true, BreachCheck: true})
+
+	engine := newTestEngine("")
+	engine.POST("/auth/register", NewUserHandler().Register)
+
+	cases := []struct {
+		name       string
+		body       string
+		violations int
+	}{
+		{"too short", `{"username":"alice","password":"kf83hqzt"}`, 1},
+		{"missing digit", `{"username":"alice","password":"kfxhqztwpv"}`, 1},
+		{"contains username", `{"username":"alice","password":"alice-83hqzt"}`, 1},
+		{"common password", `{"username":"alice","password":"1234567890"}`, 1},
+		{"several rules", `{"username":"alice","password":"Alice!"}`, 3},
+	}
+	for _, tc := range cases {
+		w := doJSON(engine, http.MethodPost, "/auth/register", tc.body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, body = %s", tc.name, w.Code, w.Body.String())
+			continue
+		}
+		var resp passwordErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decode: %v", tc.name, err)
+		}
+		if resp.Code != "weak_password" || len(resp.Violations) != tc.violations {
+			t.Errorf("%s: response = %s", tc.name, w.Body.String())
+		}
+	}
+	if exists, _ := repository.NewUserRepository().ExistsByUsername("alice"); exists {
+		t.Error("user created despite weak password")
+	}
+}
+
+func TestChangePasswordRejectsWeakPassword(t *testing.T) {
+	setupTestDB(t)
+	withPasswordPolicy(t, model.PasswordPolicyConfig{MinLength: 10, RequireDigit: true, DisallowUsername: true, BreachCheck: true})
+
+	users := repository.NewUserRepository()
+	hash, err := service.HashPassword("old-pass-2024")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	user := &model.User{Username: "alice", PasswordHash: hash}
+	if err := users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	engine := newTestEngine(user.ID)
+	engine.POST("/me/password", NewUserHandler().ChangePassword)
+
+	cases := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"too short", `{"oldPassword":"old-pass-2024","newPassword":"kf83hqzt"}`, http.StatusBadRequest, "weak_password"},
+		{"missing digit", `{"oldPassword":"old-pass-2024","newPassword":"kfxhqztwpv"}`, http.StatusBadRequest, "weak_password"},
+		{"contains username", `{"oldPassword":"old-pass-2024","newPassword":"ALICE-83hqzt"}`, http.StatusBadRequest, "weak_password"},
+		{"common password", `{"oldPassword":"old-pass-2024","newPassword":"password123"}`, http.StatusBadRequest, "weak_password"},
+		{"same as current", `{"oldPassword":"old-pass-2024","newPassword":"old-pass-2024"}`, http.StatusBadRequest, "password_reused"},
+		{"wrong old password", `{"oldPassword":"wrong","newPassword":"kf83hqzt-new"}`, http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		w := doJSON(engine, http.MethodPost, "/me/password", tc.body)
+		var resp passwordErrorResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != tc.status || resp.Code != tc.code {
+			t.Errorf("%s: status = %d, body = %s", tc.name, w.Code, w.Body.String())
+		}
+		if stored, _ := users.GetByID(user.ID); stored.PasswordHash != hash {
+			t.Fatalf("%s: password changed", tc.name)
+		}
+	}
+
+	w := doJSON(engine, http.MethodPost, "/me/password", `{"oldPassword":"old-pass-2024","newPassword":"kf83hqzt-new"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("strong password: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if stored, _ := users.GetByID(user.ID); stored.PasswordHash == hash {
+		t.Error("strong password not saved")
+	}
+}
@@ -0,0 +1,220 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 密钥有效性检查默认值
+const (
+	defaultKeyCheckIntervalSec = 3600
+	defaultKeyCheckTimeoutSec  = 10
+	minKeyCheckIntervalSec     = 300
+)
+
+// KeyCheckResult 单个密钥的检查结果。Conclusive 为 false 表示上游不可达或返回非认证错误，
+// 无法判断密钥是否有效，沿用上一次的结论
+type KeyCheckResult struct {
+	KeyID      string
+	Valid      bool
+	Conclusive bool
+	Error      string
+}
+
+type keyAuth struct {
+	valid bool
+	err   string
+}
+
+type channelAuth struct {
+	keys        map[string]keyAuth
+	status      string
+	checkedAt   time.Time
+	failedSince time.Time
+}
+
+var auth struct {
+	mu       sync.RWMutex
+	config   model.ChannelKeyCheckConfig
+	channels map[string]*channelAuth
+}
+
+func init() {
+	auth.config = DefaultKeyCheckConfig()
+	auth.channels = make(map[string]*channelAuth)
+}
+
+// DefaultKeyCheckConfig 默认每小时检查一次所有启用渠道的密钥
+func DefaultKeyCheckConfig() model.ChannelKeyCheckConfig {
+	return model.ChannelKeyCheckConfig{
+		Enabled:     true,
+		IntervalSec: defaultKeyCheckIntervalSec,
+		TimeoutSec:  defaultKeyCheckTimeoutSec,
+	}
+}
+
+// NormalizeKeyCheckConfig 填充未设置的字段
+func NormalizeKeyCheckConfig(cfg model.ChannelKeyCheckConfig) model.ChannelKeyCheckConfig {
+	if cfg.IntervalSec <= 0 {
+		cfg.IntervalSec = defaultKeyCheckIntervalSec
+	}
+	if cfg.TimeoutSec <= 0 {
+		cfg.TimeoutSec = defaultKeyCheckTimeoutSec
+	}
+	return cfg
+}
+
+// ValidateKeyCheckConfig 校验密钥有效性检查配置（需先 Normalize）
+func ValidateKeyCheckConfig(cfg model.ChannelKeyCheckConfig) error {
+	if cfg.IntervalSec < minKeyCheckIntervalSec || cfg.IntervalSec > 7*86400 {
+		return errors.New("intervalSec 必须在 300 到 604800 之间")
+	}
+	if cfg.TimeoutSec > 60 {
+		return errors.New("timeoutSec 不能超过 60")
+	}
+	return nil
+}
+
+// InitKeyCheckConfig 启动时从持久化配置加载
+func InitKeyCheckConfig(configJSON string) {
+	var cfg model.ChannelKeyCheckConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("channel key check: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+	cfg = NormalizeKeyCheckConfig(cfg)
+	if err := ValidateKeyCheckConfig(cfg); err != nil {
+		log.Warnf("channel key check: 配置无效，使用默认配置: %v", err)
+		return
+	}
+	UpdateKeyCheckConfig(cfg)
+}
+
+// UpdateKeyCheckConfig 更新运行时配置。关闭时清空检查结果，已标记失效的渠道恢复参与选路
+func UpdateKeyCheckConfig(cfg model.ChannelKeyCheckConfig) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	auth.config = cfg
+	if !cfg.Enabled {
+		auth.channels = make(map[string]*channelAuth)
+	}
+}
+
+// GetKeyCheckConfig 获取当前密钥有效性检查配置
+func GetKeyCheckConfig() model.ChannelKeyCheckConfig {
+	auth.mu.RLock()
+	defer auth.mu.RUnlock()
+	return auth.config
+}
+
+// RecordKeyCheck 记录渠道一轮密钥检查结果，totalKeys 为密钥池中的密钥数。
+// 返回检查后的状态，以及本轮是否新发现失效密钥（用于通知管理员）
+func RecordKeyCheck(channelID string, totalKeys int, results []KeyCheckResult) (model.ChannelAuthStatus, bool) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	now := time.Now().UTC()
+	a, ok := auth.channels[channelID]
+	if !ok {
+		a = &channelAuth{keys: make(map[string]keyAuth)}
+		auth.channels[channelID] = a
+	}
+	a.checkedAt = now
+
+	newlyInvalid := false
+	current := make(map[string]keyAuth, len(results))
+	for _, r := range results {
+		prev, known := a.keys[r.KeyID]
+		if !r.Conclusive {
+			if known {
+				current[r.KeyID] = prev
+			}
+			continue
+		}
+		if !r.Valid && (!known || prev.valid) {
+			newlyInvalid = true
+		}
+		current[r.KeyID] = keyAuth{valid: r.Valid, err: r.Error}
+	}
+	// 只保留仍在密钥池中的密钥
+	a.keys = current
+
+	invalid := 0
+	for _, k := range a.keys {
+		if !k.valid {
+			invalid++
+		}
+	}
+	switch {
+	case invalid == 0:
+		if a.status == model.ChannelAuthFailed || a.status == model.ChannelAuthPartial {
+			log.Infof("channel key check: 渠道 %s 的密钥已恢复有效", channelID)
+		}
+		a.status = model.ChannelAuthOK
+		a.failedSince = time.Time{}
+	case invalid >= totalKeys:
+		a.status = model.ChannelAuthFailed
+	default:
+		a.status = model.ChannelAuthPartial
+	}
+	if invalid > 0 && a.failedSince.IsZero() {
+		a.failedSince = now
+	}
+	return a.snapshot(channelID), newlyInvalid
+}
+
+// AuthStatus 获取渠道密钥有效性状态，未检查过的渠道返回 nil
+func AuthStatus(channelID string) *model.ChannelAuthStatus {
+	auth.mu.RLock()
+	defer auth.mu.RUnlock()
+	a, ok := auth.channels[channelID]
+	if !ok || a.status == "" {
+		return nil
+	}
+	status := a.snapshot(channelID)
+	return &status
+}
+
+// IsAuthFailed 渠道的所有密钥是否均已认证失败
+func IsAuthFailed(channelID string) bool {
+	auth.mu.RLock()
+	defer auth.mu.RUnlock()
+	a, ok := auth.channels[channelID]
+	return ok && a.status == model.ChannelAuthFailed
+}
+
+func (a *channelAuth) snapshot(channelID string) model.ChannelAuthStatus {
+	status := model.ChannelAuthStatus{
+		ChannelID:   channelID,
+		Status:      a.status,
+		CheckedAt:   timePtr(a.checkedAt),
+		FailedSince: timePtr(a.failedSince),
+	}
+	for id, k := range a.keys {
+		if !k.valid {
+			status.InvalidKeys = append(status.InvalidKeys, id)
+		}
+	}
+	if len(status.InvalidKeys) > 0 {
+		sort.Strings(status.InvalidKeys)
+		status.LastError = a.keys[status.InvalidKeys[0]].err
+	}
+	return status
+}
+
+func pruneAuth(activeIDs map[string]struct{}) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	for id := range auth.channels {
+		if _, ok := activeIDs[id]; !ok {
+			delete(auth.channels, id)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package health
+
+import (
+	"testing"
+
+	"ampmanager/internal/model"
+)
+
+func resetAuthState(t *testing.T) {
+	t.Helper()
+	UpdateKeyCheckConfig(model.ChannelKeyCheckConfig{})
+	UpdateKeyCheckConfig(DefaultKeyCheckConfig())
+	t.Cleanup(func() {
+		UpdateKeyCheckConfig(model.ChannelKeyCheckConfig{})
+		UpdateKeyCheckConfig(DefaultKeyCheckConfig())
+	})
+}
+
+func TestRecordKeyCheck_StatusTransitions(t *testing.T) {
+	resetAuthState(t)
+
+	if AuthStatus("ch1") != nil {
+		t.Fatal("unchecked channel should have no auth status")
+	}
+
+	status, newlyInvalid := RecordKeyCheck("ch1", 2, []KeyCheckResult{
+		{KeyID: "k1", Valid: true, Conclusive: true},
+		{KeyID: "k2", Conclusive: true, Error: "认证失败 (HTTP 401)"},
+	})
+	if status.Status != model.ChannelAuthPartial || !newlyInvalid {
+		t.Fatalf("expected partial with new invalid key, got %+v newlyInvalid=%v", status, newlyInvalid)
+	}
+	if len(status.InvalidKeys) != 1 || status.InvalidKeys[0] != "k2" || status.FailedSince == nil {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if IsAuthFailed("ch1") {
+		t.Fatal("partially invalid channel should still be routable")
+	}
+
+	// 不确定的结果沿用上一次结论，不重复通知
+	status, newlyInvalid = RecordKeyCheck("ch1", 2, []KeyCheckResult{
+		{KeyID: "k1", Conclusive: true, Error: "认证失败 (HTTP 403)"},
+		{KeyID: "k2", Error: "连接失败"},
+	})
+	if status.Status != model.ChannelAuthFailed || !newlyInvalid || !IsAuthFailed("ch1") {
+		t.Fatalf("expected auth_failed, got %+v newlyInvalid=%v", status, newlyInvalid)
+	}
+	_, newlyInvalid = RecordKeyCheck("ch1", 2, []KeyCheckResult{
+		{KeyID: "k1", Conclusive: true},
+		{KeyID: "k2", Conclusive: true},
+	})
+	if newlyInvalid {
+		t.Fatal("keys that were already invalid should not be reported again")
+	}
+
+	status, _ = RecordKeyCheck("ch1", 2, []KeyCheckResult{
+		{KeyID: "k1", Valid: true, Conclusive: true},
+		{KeyID: "k2", Valid: true, Conclusive: true},
+	})
+	if status.Status != model.ChannelAuthOK || len(status.InvalidKeys) != 0 || status.FailedSince != nil {
+		t.Fatalf("expected recovery, got %+v", status)
+	}
+}
+
+func TestKeyCheckDisableAndPrune(t *testing.T) {
+	resetAuthState(t)
+
+	RecordKeyCheck("ch1", 1, []KeyCheckResult{{KeyID: "k1", Conclusive: true}})
+	RecordKeyCheck("ch2", 1, []KeyCheckResult{{KeyID: "k1", Conclusive: true}})
+	Prune(map[string]struct{}{"ch2": {}})
+	if AuthStatus("ch1") != nil || !IsAuthFailed("ch2") {
+		t.Fatal("prune should drop only removed channels")
+	}
+
+	UpdateKeyCheckConfig(model.ChannelKeyCheckConfig{Enabled: false, IntervalSec: 3600, TimeoutSec: 10})
+	if IsAuthFailed("ch2") {
+		t.Fatal("disabling the check should clear auth_failed marks")
+	}
+}
+
+func TestValidateKeyCheckConfig(t *testing.T) {
+	cfg := NormalizeKeyCheckConfig(model.ChannelKeyCheckConfig{Enabled: true})
+	if err := ValidateKeyCheckConfig(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg.IntervalSec = 60
+	if err := ValidateKeyCheckConfig(cfg); err == nil {
+		t.Error("expected too short interval to be rejected")
+	}
+}
@@ -0,0 +1,247 @@
+// Package health 维护渠道健康状态与熔断判断。
+//
+// 探测由 amp 包中的后台任务执行并通过 RecordProbe 上报；连续失败达到阈值的渠道被熔断，
+// 选路时跳过，之后按较短的恢复间隔继续探测，探测成功即自动恢复。
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 健康检查默认值
+const (
+	defaultIntervalSec         = 60
+	defaultRecoveryIntervalSec = 30
+	defaultTimeoutSec          = 10
+	defaultFailureThreshold    = 3
+)
+
+type channelState struct {
+	failures       int
+	healthy        bool
+	lastCheckedAt  time.Time
+	lastSuccessAt  time.Time
+	lastError      string
+	latencyMs      int64
+	unhealthySince time.Time
+	nextProbeAt    time.Time
+}
+
+var state struct {
+	mu       sync.RWMutex
+	config   model.ChannelHealthConfig
+	channels map[string]*channelState
+}
+
+func init() {
+	state.config = DefaultConfig()
+	state.channels = make(map[string]*channelState)
+}
+
+// DefaultConfig 默认每分钟探测一次，连续失败 3 次熔断
+func DefaultConfig() model.ChannelHealthConfig {
+	return model.ChannelHealthConfig{
+		Enabled:             true,
+		IntervalSec:         defaultIntervalSec,
+		RecoveryIntervalSec: defaultRecoveryIntervalSec,
+		TimeoutSec:          defaultTimeoutSec,
+		FailureThreshold:    defaultFailureThreshold,
+	}
+}
+
+// NormalizeConfig 填充未设置的字段
+func NormalizeConfig(cfg model.ChannelHealthConfig) model.ChannelHealthConfig {
+	if cfg.IntervalSec <= 0 {
+		cfg.IntervalSec = defaultIntervalSec
+	}
+	if cfg.RecoveryIntervalSec <= 0 {
+		cfg.RecoveryIntervalSec = defaultRecoveryIntervalSec
+	}
+	if cfg.TimeoutSec <= 0 {
+		cfg.TimeoutSec = defaultTimeoutSec
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	return cfg
+}
+
+// ValidateConfig 校验健康检查配置（需先 Normalize）
+func ValidateConfig(cfg model.ChannelHealthConfig) error {
+	if cfg.IntervalSec < 10 || cfg.IntervalSec > 86400 {
+		return errors.New("intervalSec 必须在 10 到 86400 之间")
+	}
+	if cfg.RecoveryIntervalSec < 5 || cfg.RecoveryIntervalSec > 86400 {
+		return errors.New("recoveryIntervalSec 必须在 5 到 86400 之间")
+	}
+	if cfg.TimeoutSec > 60 {
+		return errors.New("timeoutSec 不能超过 60")
+	}
+	if cfg.FailureThreshold > 100 {
+		return errors.New("failureThreshold 不能超过 100")
+	}
+	return nil
+}
+
+// InitConfig 启动时从持久化配置加载
+func InitConfig(configJSON string) {
+	var cfg model.ChannelHealthConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("channel health: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+	cfg = NormalizeConfig(cfg)
+	if err := ValidateConfig(cfg); err != nil {
+		log.Warnf("channel health: 配置无效，使用默认配置: %v", err)
+		return
+	}
+	UpdateConfig(cfg)
+}
+
+// UpdateConfig 更新运行时配置。关闭时清空已记录的状态，重新开启后所有渠道从健康状态开始探测
+func UpdateConfig(cfg model.ChannelHealthConfig) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.config = cfg
+	if !cfg.Enabled {
+		state.channels = make(map[string]*channelState)
+	}
+	// 阈值调整后立即按新阈值重新判断
+	for _, s := range state.channels {
+		s.healthy = s.failures < cfg.FailureThreshold
+		if s.healthy {
+			s.unhealthySince = time.Time{}
+		}
+	}
+}
+
+// GetConfig 获取当前健康检查配置
+func GetConfig() model.ChannelHealthConfig {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return state.config
+}
+
+// IsHealthy 渠道是否可用于选路；未开启健康检查或尚未探测过的渠道视为健康
+func IsHealthy(channelID string) bool {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if !state.config.Enabled {
+		return true
+	}
+	s, ok := state.channels[channelID]
+	return !ok || s.healthy
+}
+
+// DueForProbe 渠道是否到了下一次探测时间
+func DueForProbe(channelID string, now time.Time) bool {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	s, ok := state.channels[channelID]
+	return !ok || !now.Before(s.nextProbeAt)
+}
+
+// RecordProbe 记录一次探测结果（后台探测与管理员手动测试均会上报）
+func RecordProbe(channelID string, success bool, latencyMs int64, errMsg string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if !state.config.Enabled {
+		return
+	}
+
+	now := time.Now().UTC()
+	s, ok := state.channels[channelID]
+	if !ok {
+		s = &channelState{healthy: true}
+		state.channels[channelID] = s
+	}
+	s.lastCheckedAt = now
+	s.latencyMs = latencyMs
+
+	if success {
+		if !s.healthy {
+			log.Infof("channel health: 渠道 %s 探测成功，已恢复（熔断持续 %s）",
+				channelID, now.Sub(s.unhealthySince).Round(time.Second))
+		}
+		s.failures = 0
+		s.healthy = true
+		s.lastError = ""
+		s.lastSuccessAt = now
+		s.unhealthySince = time.Time{}
+		s.nextProbeAt = now.Add(time.Duration(state.config.IntervalSec) * time.Second)
+		return
+	}
+
+	s.failures++
+	s.lastError = errMsg
+	if s.healthy && s.failures >= state.config.FailureThreshold {
+		s.healthy = false
+		s.unhealthySince = now
+		log.Warnf("channel health: 渠道 %s 连续 %d 次探测失败，已熔断: %s", channelID, s.failures, errMsg)
+	}
+	s.nextProbeAt = now.Add(time.Duration(state.config.RecoveryIntervalSec) * time.Second)
+}
+
+// Prune 清除不在 activeIDs 中的渠道状态、限流信息、密钥有效性与密钥池状态（渠道被删除或禁用）
+func Prune(activeIDs map[string]struct{}) {
+	pruneAuth(activeIDs)
+
+	state.mu.Lock()
+	for id := range state.channels {
+		if _, ok := activeIDs[id]; !ok {
+			delete(state.channels, id)
+		}
+	}
+	state.mu.Unlock()
+
+	rateLimits.mu.Lock()
+	for id := range rateLimits.channels {
+		if _, ok := activeIDs[id]; !ok {
+			delete(rateLimits.channels, id)
+		}
+	}
+	rateLimits.mu.Unlock()
+
+	keyPools.mu.Lock()
+	defer keyPools.mu.Unlock()
+	for id := range keyPools.channels {
+		if _, ok := activeIDs[id]; !ok {
+			delete(keyPools.channels, id)
+		}
+	}
+}
+
+// Status 获取渠道健康状态，尚未探测过的渠道返回健康
+func Status(channelID string) model.ChannelHealthStatus {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	status := model.ChannelHealthStatus{ChannelID: channelID, Healthy: true}
+	s, ok := state.channels[channelID]
+	if !ok {
+		return status
+	}
+	status.Healthy = s.healthy
+	status.ConsecutiveFailures = s.failures
+	status.LastError = s.lastError
+	status.LatencyMs = s.latencyMs
+	status.LastCheckedAt = timePtr(s.lastCheckedAt)
+	status.LastSuccessAt = timePtr(s.lastSuccessAt)
+	status.UnhealthySince = timePtr(s.unhealthySince)
+	status.NextProbeAt = timePtr(s.nextProbeAt)
+	return status
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
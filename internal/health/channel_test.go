@@ -0,0 +1,96 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+)
+
+func resetState(t *testing.T, cfg model.ChannelHealthConfig) {
+	t.Helper()
+	UpdateConfig(model.ChannelHealthConfig{})
+	UpdateConfig(cfg)
+	t.Cleanup(func() { UpdateConfig(DefaultConfig()) })
+}
+
+func TestRecordProbe_TripsAfterThresholdAndRecovers(t *testing.T) {
+	resetState(t, DefaultConfig())
+
+	RecordProbe("ch1", false, 10, "连接失败")
+	RecordProbe("ch1", false, 10, "连接失败")
+	if !IsHealthy("ch1") {
+		t.Fatal("channel should stay healthy below the failure threshold")
+	}
+
+	RecordProbe("ch1", false, 10, "连接失败")
+	if IsHealthy("ch1") {
+		t.Fatal("channel should be unhealthy after reaching the failure threshold")
+	}
+	status := Status("ch1")
+	if status.ConsecutiveFailures != 3 || status.UnhealthySince == nil || status.LastError != "连接失败" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	RecordProbe("ch1", true, 5, "")
+	status = Status("ch1")
+	if !status.Healthy || status.ConsecutiveFailures != 0 || status.UnhealthySince != nil {
+		t.Fatalf("channel should recover after a successful probe, got %+v", status)
+	}
+}
+
+func TestIsHealthy_DisabledIgnoresState(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FailureThreshold = 1
+	resetState(t, cfg)
+
+	RecordProbe("ch1", false, 0, "HTTP 502")
+	if IsHealthy("ch1") {
+		t.Fatal("channel should be unhealthy")
+	}
+
+	cfg.Enabled = false
+	UpdateConfig(cfg)
+	if !IsHealthy("ch1") {
+		t.Fatal("disabled health checks must not skip channels")
+	}
+	if !IsHealthy("unknown") {
+		t.Fatal("unprobed channels are healthy")
+	}
+}
+
+func TestDueForProbe_UsesRecoveryInterval(t *testing.T) {
+	resetState(t, DefaultConfig())
+
+	now := time.Now().UTC()
+	if !DueForProbe("ch1", now) {
+		t.Fatal("unprobed channel should be due")
+	}
+
+	RecordProbe("ch1", true, 0, "")
+	if DueForProbe("ch1", now.Add(30*time.Second)) || !DueForProbe("ch1", now.Add(61*time.Second)) {
+		t.Fatal("healthy channel should be probed after intervalSec")
+	}
+
+	RecordProbe("ch1", false, 0, "HTTP 503")
+	if !DueForProbe("ch1", time.Now().UTC().Add(31*time.Second)) {
+		t.Fatal("failing channel should be probed after recoveryIntervalSec")
+	}
+}
+
+func TestPrune_RemovesInactiveChannels(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FailureThreshold = 1
+	resetState(t, cfg)
+
+	RecordProbe("keep", false, 0, "x")
+	RecordProbe("drop", false, 0, "x")
+	Prune(map[string]struct{}{"keep": {}})
+
+	if IsHealthy("keep") {
+		t.Fatal("kept channel should retain its state")
+	}
+	if !IsHealthy("drop") {
+		t.Fatal("pruned channel should be forgotten")
+	}
+}
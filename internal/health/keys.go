@@ -0,0 +1,142 @@
+package health
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type keyEntry struct {
+	lastUsed      time.Time
+	cooldownUntil time.Time
+	lastError     string
+}
+
+type channelKeys struct {
+	next uint64
+	keys map[string]*keyEntry
+}
+
+var keyPools struct {
+	mu       sync.Mutex
+	channels map[string]*channelKeys
+}
+
+func init() {
+	keyPools.channels = make(map[string]*channelKeys)
+}
+
+// KeyFingerprint 密钥指纹，用于在状态与日志中标识密钥而不暴露密钥本身
+func KeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+func poolFor(channelID string) *channelKeys {
+	pool, ok := keyPools.channels[channelID]
+	if !ok {
+		pool = &channelKeys{keys: make(map[string]*keyEntry)}
+		keyPools.channels[channelID] = pool
+	}
+	return pool
+}
+
+func (p *channelKeys) entry(keyID string) *keyEntry {
+	e, ok := p.keys[keyID]
+	if !ok {
+		e = &keyEntry{}
+		p.keys[keyID] = e
+	}
+	return e
+}
+
+// SelectKey 从密钥池中选择本次使用的密钥，返回 keyIDs 中的下标：跳过冷却中的密钥，
+// lru 为 true 时选择最久未使用的密钥，否则轮询；全部冷却时选择最早结束冷却的密钥
+func SelectKey(channelID string, keyIDs []string, lru bool) int {
+	if len(keyIDs) <= 1 {
+		return 0
+	}
+
+	keyPools.mu.Lock()
+	defer keyPools.mu.Unlock()
+
+	now := time.Now().UTC()
+	pool := poolFor(channelID)
+	n := len(keyIDs)
+	selected := -1
+	if lru {
+		for i, id := range keyIDs {
+			e := pool.entry(id)
+			if now.Before(e.cooldownUntil) {
+				continue
+			}
+			if selected < 0 || e.lastUsed.Before(pool.keys[keyIDs[selected]].lastUsed) {
+				selected = i
+			}
+		}
+	} else {
+		start := int(pool.next % uint64(n))
+		for i := 0; i < n; i++ {
+			idx := (start + i) % n
+			if !now.Before(pool.entry(keyIDs[idx]).cooldownUntil) {
+				selected = idx
+				break
+			}
+		}
+		if selected >= 0 {
+			pool.next = uint64(selected + 1)
+		}
+	}
+
+	if selected < 0 {
+		selected = 0
+		for i, id := range keyIDs {
+			if pool.keys[id].cooldownUntil.Before(pool.keys[keyIDs[selected]].cooldownUntil) {
+				selected = i
+			}
+		}
+	}
+	pool.entry(keyIDs[selected]).lastUsed = now
+	return selected
+}
+
+// CooldownKey 暂停使用密钥 d 时长，期间选择密钥时跳过
+func CooldownKey(channelID, keyID string, d time.Duration, reason string) {
+	keyPools.mu.Lock()
+	defer keyPools.mu.Unlock()
+
+	e := poolFor(channelID).entry(keyID)
+	until := time.Now().UTC().Add(d)
+	if until.After(e.cooldownUntil) {
+		e.cooldownUntil = until
+	}
+	e.lastError = reason
+	log.Warnf("channel key: 渠道 %s 的密钥 %s 冷却 %s: %s", channelID, keyID, d.Round(time.Second), reason)
+}
+
+// KeyStatus 获取密钥的使用与冷却状态，ID 与 Ref 由调用方填写
+func KeyStatus(channelID, keyID string) model.ChannelKeyStatus {
+	keyPools.mu.Lock()
+	defer keyPools.mu.Unlock()
+
+	status := model.ChannelKeyStatus{ID: keyID}
+	pool, ok := keyPools.channels[channelID]
+	if !ok {
+		return status
+	}
+	e, ok := pool.keys[keyID]
+	if !ok {
+		return status
+	}
+	status.LastUsedAt = timePtr(e.lastUsed)
+	if time.Now().UTC().Before(e.cooldownUntil) {
+		status.CooldownUntil = timePtr(e.cooldownUntil)
+		status.LastError = e.lastError
+	}
+	return status
+}
@@ -0,0 +1,64 @@
+package health
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelectKey_RoundRobinSkipsCoolingKeys(t *testing.T) {
+	ids := []string{"a", "b", "c"}
+	t.Cleanup(func() { Prune(map[string]struct{}{}) })
+
+	var got []int
+	for i := 0; i < 4; i++ {
+		got = append(got, SelectKey("rr", ids, false))
+	}
+	if got[0] != 0 || got[1] != 1 || got[2] != 2 || got[3] != 0 {
+		t.Fatalf("expected round-robin order, got %v", got)
+	}
+
+	CooldownKey("rr", "b", time.Minute, "HTTP 429")
+	for i := 0; i < 4; i++ {
+		if idx := SelectKey("rr", ids, false); idx == 1 {
+			t.Fatal("cooling key must be skipped")
+		}
+	}
+	if status := KeyStatus("rr", "b"); status.CooldownUntil == nil || status.LastError != "HTTP 429" {
+		t.Fatalf("unexpected key status %+v", status)
+	}
+}
+
+func TestSelectKey_LRU(t *testing.T) {
+	ids := []string{"a", "b"}
+	t.Cleanup(func() { Prune(map[string]struct{}{}) })
+
+	first := SelectKey("lru", ids, true)
+	second := SelectKey("lru", ids, true)
+	if first == second {
+		t.Fatalf("least recently used key should alternate, got %d twice", first)
+	}
+
+	CooldownKey("lru", ids[first], time.Minute, "HTTP 401")
+	for i := 0; i < 3; i++ {
+		if idx := SelectKey("lru", ids, true); idx != second {
+			t.Fatalf("expected the only available key %d, got %d", second, idx)
+		}
+	}
+}
+
+func TestSelectKey_AllCoolingPicksEarliestRecovery(t *testing.T) {
+	ids := []string{"a", "b"}
+	t.Cleanup(func() { Prune(map[string]struct{}{}) })
+
+	CooldownKey("all", "a", time.Hour, "HTTP 401")
+	CooldownKey("all", "b", time.Minute, "HTTP 429")
+	if idx := SelectKey("all", ids, false); idx != 1 {
+		t.Fatalf("expected the key that recovers first, got %d", idx)
+	}
+}
+
+func TestSelectKey_SingleKey(t *testing.T) {
+	if idx := SelectKey("single", []string{"a"}, false); idx != 0 {
+		t.Fatalf("expected 0, got %d", idx)
+	}
+}
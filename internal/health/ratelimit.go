@@ -0,0 +1,82 @@
+package health
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+)
+
+// 上游限流响应头（均为每分钟额度）
+var (
+	requestLimitHeaders = []rateLimitHeaderPair{
+		{"x-ratelimit-limit-requests", "x-ratelimit-remaining-requests"},
+		{"anthropic-ratelimit-requests-limit", "anthropic-ratelimit-requests-remaining"},
+	}
+	tokenLimitHeaders = []rateLimitHeaderPair{
+		{"x-ratelimit-limit-tokens", "x-ratelimit-remaining-tokens"},
+		{"anthropic-ratelimit-tokens-limit", "anthropic-ratelimit-tokens-remaining"},
+		{"anthropic-ratelimit-input-tokens-limit", "anthropic-ratelimit-input-tokens-remaining"},
+	}
+)
+
+type rateLimitHeaderPair struct {
+	limit     string
+	remaining string
+}
+
+var rateLimits struct {
+	mu       sync.RWMutex
+	channels map[string]model.ChannelRateLimit
+}
+
+func init() {
+	rateLimits.channels = make(map[string]model.ChannelRateLimit)
+}
+
+// ParseRateLimitHeaders 解析 OpenAI / Anthropic 的限流响应头，上游未返回任何额度时 ok 为 false
+func ParseRateLimitHeaders(header http.Header) (rl model.ChannelRateLimit, ok bool) {
+	if limit, remaining, found := parseHeaderPair(header, requestLimitHeaders); found {
+		rl.RequestsLimit, rl.RequestsRemaining = limit, remaining
+		ok = true
+	}
+	if limit, remaining, found := parseHeaderPair(header, tokenLimitHeaders); found {
+		rl.TokensLimit, rl.TokensRemaining = limit, remaining
+		ok = true
+	}
+	return rl, ok
+}
+
+func parseHeaderPair(header http.Header, pairs []rateLimitHeaderPair) (limit, remaining int64, ok bool) {
+	for _, p := range pairs {
+		l, err := strconv.ParseInt(strings.TrimSpace(header.Get(p.limit)), 10, 64)
+		if err != nil || l <= 0 {
+			continue
+		}
+		r, err := strconv.ParseInt(strings.TrimSpace(header.Get(p.remaining)), 10, 64)
+		if err != nil || r < 0 {
+			continue
+		}
+		return l, min(r, l), true
+	}
+	return 0, 0, false
+}
+
+// RecordRateLimit 记录渠道最近一次响应中的限流额度
+func RecordRateLimit(channelID string, rl model.ChannelRateLimit) {
+	rl.ObservedAt = time.Now().UTC()
+	rateLimits.mu.Lock()
+	defer rateLimits.mu.Unlock()
+	rateLimits.channels[channelID] = rl
+}
+
+// RateLimit 获取渠道最近一次观测到的限流额度
+func RateLimit(channelID string) (model.ChannelRateLimit, bool) {
+	rateLimits.mu.RLock()
+	defer rateLimits.mu.RUnlock()
+	rl, ok := rateLimits.channels[channelID]
+	return rl, ok
+}
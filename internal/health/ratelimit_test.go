@@ -0,0 +1,78 @@
+package health
+
+import (
+	"net/http"
+	"testing"
+
+	"ampmanager/internal/model"
+)
+
+func TestParseRateLimitHeaders_OpenAI(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Ratelimit-Limit-Requests", "500")
+	h.Set("X-Ratelimit-Remaining-Requests", "120")
+	h.Set("X-Ratelimit-Limit-Tokens", "30000")
+	h.Set("X-Ratelimit-Remaining-Tokens", "29000")
+
+	rl, ok := ParseRateLimitHeaders(h)
+	if !ok {
+		t.Fatal("expected rate limit headers to be parsed")
+	}
+	if rl.RequestsLimit != 500 || rl.RequestsRemaining != 120 || rl.TokensLimit != 30000 || rl.TokensRemaining != 29000 {
+		t.Fatalf("unexpected rate limit %+v", rl)
+	}
+}
+
+func TestParseRateLimitHeaders_AnthropicInputTokensFallback(t *testing.T) {
+	h := http.Header{}
+	h.Set("Anthropic-Ratelimit-Requests-Limit", "50")
+	h.Set("Anthropic-Ratelimit-Requests-Remaining", "49")
+	h.Set("Anthropic-Ratelimit-Input-Tokens-Limit", "40000")
+	h.Set("Anthropic-Ratelimit-Input-Tokens-Remaining", "1000")
+
+	rl, ok := ParseRateLimitHeaders(h)
+	if !ok || rl.RequestsLimit != 50 || rl.RequestsRemaining != 49 || rl.TokensLimit != 40000 || rl.TokensRemaining != 1000 {
+		t.Fatalf("unexpected rate limit %+v (ok=%v)", rl, ok)
+	}
+}
+
+func TestParseRateLimitHeaders_IgnoresIncompleteOrInvalid(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Ratelimit-Limit-Requests", "500")
+	h.Set("X-Ratelimit-Limit-Tokens", "abc")
+	h.Set("X-Ratelimit-Remaining-Tokens", "10")
+	if _, ok := ParseRateLimitHeaders(h); ok {
+		t.Fatal("limits without a valid remaining value must be ignored")
+	}
+
+	h.Set("X-Ratelimit-Remaining-Requests", "900")
+	rl, ok := ParseRateLimitHeaders(h)
+	if !ok || rl.RequestsRemaining != 500 {
+		t.Fatalf("remaining should be capped at the limit, got %+v", rl)
+	}
+}
+
+func TestPrune_RemovesRateLimits(t *testing.T) {
+	RecordRateLimit("keep", mustParseRateLimit(t, "10", "5"))
+	RecordRateLimit("drop", mustParseRateLimit(t, "10", "5"))
+	Prune(map[string]struct{}{"keep": {}})
+
+	if _, ok := RateLimit("keep"); !ok {
+		t.Fatal("kept channel should retain its rate limit")
+	}
+	if _, ok := RateLimit("drop"); ok {
+		t.Fatal("pruned channel should be forgotten")
+	}
+}
+
+func mustParseRateLimit(t *testing.T, limit, remaining string) model.ChannelRateLimit {
+	t.Helper()
+	h := http.Header{}
+	h.Set("X-Ratelimit-Limit-Requests", limit)
+	h.Set("X-Ratelimit-Remaining-Requests", remaining)
+	rl, ok := ParseRateLimitHeaders(h)
+	if !ok {
+		t.Fatal("failed to parse rate limit headers")
+	}
+	return rl
+}
@@ -0,0 +1,223 @@
+// Package mail 通过 SMTP 发送纯文本通知邮件（邮箱验证、找回密码、凭据变更通知）。
+//
+// 未配置 SMTP 主机时邮件功能关闭，Enabled 返回 false，Send 返回 ErrDisabled。
+package mail
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLS 模式
+const (
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+	TLSNone     = "none"
+)
+
+const dialTimeout = 10 * time.Second
+
+// ErrDisabled 未配置 SMTP
+var ErrDisabled = errors.New("邮件服务未配置")
+
+// Options SMTP 配置
+type Options struct {
+	// Host SMTP 服务器地址，为空时关闭邮件功能
+	Host string
+	Port string
+	// Username 为空时不进行 SMTP 认证
+	Username string
+	// Password 每次发信时读取，以便使用外部密钥存储中轮换后的密码
+	Password func() string
+	// From 发件人，如 "AMP Manager <noreply@example.com>"
+	From string
+	// TLS starttls（默认，要求服务器支持 STARTTLS）/ tls（隐式 TLS，通常为 465 端口）/ none
+	TLS string
+}
+
+var state struct {
+	sync.RWMutex
+	opts Options
+	from *netmail.Address
+}
+
+// Configure 校验并应用 SMTP 配置；Host 为空时关闭邮件功能
+func Configure(opts Options) error {
+	if opts.TLS == "" {
+		opts.TLS = TLSStartTLS
+	}
+	var from *netmail.Address
+	if opts.Host != "" {
+		switch opts.TLS {
+		case TLSStartTLS, TLSImplicit, TLSNone:
+		default:
+			return fmt.Errorf("SMTP_TLS 取值无效: %s", opts.TLS)
+		}
+		if opts.Port == "" {
+			return errors.New("未配置 SMTP_PORT")
+		}
+		if opts.From == "" {
+			return errors.New("配置 SMTP_HOST 时必须配置 SMTP_FROM")
+		}
+		addr, err := netmail.ParseAddress(opts.From)
+		if err != nil {
+			return fmt.Errorf("SMTP_FROM 格式无效: %w", err)
+		}
+		from = addr
+	}
+
+	state.Lock()
+	state.opts = opts
+	state.from = from
+	state.Unlock()
+	return nil
+}
+
+// Enabled 是否已配置 SMTP
+func Enabled() bool {
+	state.RLock()
+	defer state.RUnlock()
+	return state.opts.Host != ""
+}
+
+// Message 纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Send 发送邮件
+func Send(msg Message) error {
+	state.RLock()
+	opts, from := state.opts, state.from
+	state.RUnlock()
+	if opts.Host == "" {
+		return ErrDisabled
+	}
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("收件人地址无效: %w", err)
+	}
+
+	data, err := buildMessage(from, to, msg.Subject, msg.Body, time.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := dial(opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if opts.Username != "" {
+		password := ""
+		if opts.Password != nil {
+			password = opts.Password()
+		}
+		if err := client.Auth(smtp.PlainAuth("", opts.Username, password, opts.Host)); err != nil {
+			return fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial 连接 SMTP 服务器并按配置建立 TLS
+func dial(opts Options) (*smtp.Client, error) {
+	addr := net.JoinHostPort(opts.Host, opts.Port)
+	tlsConfig := &tls.Config{ServerName: opts.Host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	var err error
+	if opts.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+
+	client, err := smtp.NewClient(conn, opts.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if opts.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("SMTP 服务器不支持 STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS 失败: %w", err)
+		}
+	}
+	return client, nil
+}
+
+// buildMessage 生成 RFC 5322 邮件：主题按 RFC 2047 编码，正文为 UTF-8 纯文本（base64 传输编码）
+func buildMessage(from, to *netmail.Address, subject, body string, now time.Time) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	var b strings.Builder
+	header := func(key, value string) {
+		b.WriteString(key + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", stripLineBreaks(subject)))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "base64")
+	b.WriteString("\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return []byte(b.String()), nil
+}
+
+// stripLineBreaks 去掉换行，防止头部注入
+func stripLineBreaks(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
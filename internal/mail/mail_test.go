@@ -0,0 +1,133 @@
+package mail
+
+import (
+	"bufio"
+	"encoding/base64"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigure_Validation(t *testing.T) {
+	defer Configure(Options{})
+
+	if err := Configure(Options{}); err != nil || Enabled() {
+		t.Fatalf("empty host should disable mail, err=%v", err)
+	}
+	if err := Configure(Options{Host: "smtp.example.com", Port: "587"}); err == nil {
+		t.Fatal("missing from should be rejected")
+	}
+	if err := Configure(Options{Host: "smtp.example.com", Port: "587", From: "noreply@example.com", TLS: "ssl"}); err == nil {
+		t.Fatal("unknown tls mode should be rejected")
+	}
+	if err := Configure(Options{Host: "smtp.example.com", Port: "587", From: "AMP <noreply@example.com>"}); err != nil || !Enabled() {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	from := &netmail.Address{Name: "AMP Manager", Address: "noreply@example.com"}
+	to := &netmail.Address{Address: "user@example.com"}
+	data, err := buildMessage(from, to, "重置密码\r\nBcc: evil@example.com", "链接：https://example.com/reset?token=abc", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := netmail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("message does not parse: %v", err)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Fatal("subject line breaks must not inject headers")
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || !strings.HasPrefix(subject, "重置密码") {
+		t.Fatalf("unexpected subject %q (%v)", subject, err)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>") {
+		t.Fatalf("unexpected message id %q", msg.Header.Get("Message-ID"))
+	}
+
+	raw := new(strings.Builder)
+	scanner := bufio.NewScanner(msg.Body)
+	for scanner.Scan() {
+		if len(scanner.Text()) > 76 {
+			t.Fatal("body lines must be wrapped at 76 characters")
+		}
+		raw.WriteString(scanner.Text())
+	}
+	body, err := base64.StdEncoding.DecodeString(raw.String())
+	if err != nil || string(body) != "链接：https://example.com/reset?token=abc" {
+		t.Fatalf("unexpected body %q (%v)", body, err)
+	}
+}
+
+func TestSend_PlainSMTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		var commands []string
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			commands = append(commands, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 localhost")
+			case line == "DATA":
+				reply("354 go ahead")
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil || dataLine == ".\r\n" {
+						break
+					}
+				}
+				reply("250 queued")
+			case line == "QUIT":
+				reply("221 bye")
+				received <- commands
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	if err := Configure(Options{Host: host, Port: port, From: "noreply@example.com", TLS: TLSNone}); err != nil {
+		t.Fatal(err)
+	}
+	defer Configure(Options{})
+
+	if err := Send(Message{To: "user@example.com", Subject: "hi", Body: "hello"}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	select {
+	case commands := <-received:
+		joined := strings.Join(commands, "\n")
+		if !strings.Contains(joined, "MAIL FROM:<noreply@example.com>") || !strings.Contains(joined, "RCPT TO:<user@example.com>") {
+			t.Fatalf("unexpected SMTP dialogue:\n%s", joined)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not receive the message")
+	}
+}
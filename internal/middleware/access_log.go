@@ -0,0 +1,421 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// ContextKeyAPIKeyID 代理接口通过 API Key 认证时的 Key ID，供访问日志记录
+const ContextKeyAPIKeyID = "api_key_id"
+
+const (
+	defaultAccessLogMaxSizeMB  = 100
+	defaultAccessLogMaxBackups = 5
+	maxAccessLogSizeMB         = 10240
+	maxAccessLogBackups        = 100
+	maxAccessLogExcludePaths   = 50
+)
+
+// accessLogSensitiveParams 查询参数中可能携带凭据的键，记录时替换为 REDACTED
+var accessLogSensitiveParams = map[string]bool{
+	"key":           true,
+	"api_key":       true,
+	"apikey":        true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"code":          true,
+	"state":         true,
+	"password":      true,
+}
+
+var accessLogState struct {
+	mu          sync.RWMutex
+	config      model.AccessLogConfig
+	defaultPath string
+	writer      *rotatingFile
+}
+
+func init() {
+	accessLogState.config = DefaultAccessLogConfig()
+}
+
+// SetDefaultAccessLogPath 设置未配置路径时使用的日志文件（数据库目录下的 access.log）
+func SetDefaultAccessLogPath(path string) {
+	accessLogState.mu.Lock()
+	defer accessLogState.mu.Unlock()
+	accessLogState.defaultPath = path
+}
+
+// DefaultAccessLogConfig 默认关闭，combined 格式，全量记录
+func DefaultAccessLogConfig() model.AccessLogConfig {
+	return NormalizeAccessLogConfig(model.AccessLogConfig{})
+}
+
+// NormalizeAccessLogConfig 填充未设置的字段
+func NormalizeAccessLogConfig(cfg model.AccessLogConfig) model.AccessLogConfig {
+	cfg.Format = strings.ToLower(strings.TrimSpace(cfg.Format))
+	if cfg.Format == "" {
+		cfg.Format = model.AccessLogFormatCombined
+	}
+	cfg.Path = strings.TrimSpace(cfg.Path)
+	if cfg.MaxSizeMB <= 0 {
+		cfg.MaxSizeMB = defaultAccessLogMaxSizeMB
+	}
+	if cfg.MaxBackups <= 0 {
+		cfg.MaxBackups = defaultAccessLogMaxBackups
+	}
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = 1
+	}
+	paths := make([]string, 0, len(cfg.ExcludePaths))
+	for _, p := range cfg.ExcludePaths {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	cfg.ExcludePaths = paths
+	return cfg
+}
+
+// ValidateAccessLogConfig 校验访问日志配置（需先 Normalize）
+func ValidateAccessLogConfig(cfg model.AccessLogConfig) error {
+	if cfg.Format != model.AccessLogFormatCombined && cfg.Format != model.AccessLogFormatJSON {
+		return errors.New("format 只能为 combined 或 json")
+	}
+	if cfg.MaxSizeMB > maxAccessLogSizeMB {
+		return fmt.Errorf("maxSizeMb 不能超过 %d", maxAccessLogSizeMB)
+	}
+	if cfg.MaxBackups > maxAccessLogBackups {
+		return fmt.Errorf("maxBackups 不能超过 %d", maxAccessLogBackups)
+	}
+	if cfg.SampleRate > 1 {
+		return errors.New("sampleRate 必须在 0 到 1 之间")
+	}
+	if len(cfg.ExcludePaths) > maxAccessLogExcludePaths {
+		return fmt.Errorf("excludePaths 不能超过 %d 项", maxAccessLogExcludePaths)
+	}
+	for _, p := range cfg.ExcludePaths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("排除路径 %q 必须以 / 开头", p)
+		}
+	}
+	return nil
+}
+
+// InitAccessLog 从系统配置 JSON 加载访问日志配置并打开日志文件
+func InitAccessLog(configJSON string) error {
+	if configJSON == "" {
+		return nil
+	}
+	var cfg model.AccessLogConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return err
+	}
+	cfg = NormalizeAccessLogConfig(cfg)
+	if err := ValidateAccessLogConfig(cfg); err != nil {
+		return err
+	}
+	return UpdateAccessLogConfig(cfg)
+}
+
+// UpdateAccessLogConfig 更新配置并按需重新打开日志文件，打开失败时保持原配置（需先校验）
+func UpdateAccessLogConfig(cfg model.AccessLogConfig) error {
+	accessLogState.mu.Lock()
+	defer accessLogState.mu.Unlock()
+
+	var writer *rotatingFile
+	if cfg.Enabled {
+		path := cfg.Path
+		if path == "" {
+			path = accessLogState.defaultPath
+		}
+		if path == "" {
+			return errors.New("未配置访问日志路径")
+		}
+		maxBytes := int64(cfg.MaxSizeMB) * 1024 * 1024
+		if old := accessLogState.writer; old != nil && old.path == path {
+			// 同一文件只更新轮转参数，避免重新打开
+			old.setLimits(maxBytes, cfg.MaxBackups)
+			writer = old
+		} else {
+			var err error
+			writer, err = openRotatingFile(path, maxBytes, cfg.MaxBackups)
+			if err != nil {
+				return fmt.Errorf("打开访问日志失败: %w", err)
+			}
+		}
+	}
+	if old := accessLogState.writer; old != nil && old != writer {
+		old.Close()
+	}
+	accessLogState.config = cfg
+	accessLogState.writer = writer
+	return nil
+}
+
+// GetAccessLogConfig 返回当前访问日志配置及实际写入的文件路径
+func GetAccessLogConfig() (model.AccessLogConfig, string) {
+	accessLogState.mu.RLock()
+	defer accessLogState.mu.RUnlock()
+	path := accessLogState.config.Path
+	if path == "" {
+		path = accessLogState.defaultPath
+	}
+	return accessLogState.config, path
+}
+
+// CloseAccessLog 关闭访问日志文件
+func CloseAccessLog() {
+	accessLogState.mu.Lock()
+	defer accessLogState.mu.Unlock()
+	if accessLogState.writer != nil {
+		accessLogState.writer.Close()
+		accessLogState.writer = nil
+	}
+	accessLogState.config.Enabled = false
+}
+
+// accessLogEntry JSON 格式的一行访问日志
+type accessLogEntry struct {
+	Time      string  `json:"time"`
+	RemoteIP  string  `json:"remoteIp"`
+	User      string  `json:"user,omitempty"`
+	APIKeyID  string  `json:"apiKeyId,omitempty"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Query     string  `json:"query,omitempty"`
+	Route     string  `json:"route,omitempty"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	LatencyMs float64 `json:"latencyMs"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"userAgent,omitempty"`
+}
+
+// AccessLog 记录每个 HTTP 请求的访问日志，未启用时直接放行
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		accessLogState.mu.RLock()
+		cfg := accessLogState.config
+		writer := accessLogState.writer
+		accessLogState.mu.RUnlock()
+		if !cfg.Enabled || writer == nil {
+			return
+		}
+
+		path := c.Request.URL.Path
+		for _, prefix := range cfg.ExcludePaths {
+			if strings.HasPrefix(path, prefix) {
+				return
+			}
+		}
+		status := c.Writer.Status()
+		if cfg.SampleRate < 1 && status < 400 && !isAdminAccessPath(path) && rand.Float64() >= cfg.SampleRate {
+			return
+		}
+
+		entry := accessLogEntry{
+			Time:      start.Format(time.RFC3339Nano),
+			RemoteIP:  c.ClientIP(),
+			User:      accessLogUser(c),
+			APIKeyID:  c.GetString(ContextKeyAPIKeyID),
+			Method:    c.Request.Method,
+			Path:      path,
+			Query:     sanitizeAccessLogQuery(c.Request.URL.RawQuery),
+			Route:     c.FullPath(),
+			Proto:     c.Request.Proto,
+			Status:    status,
+			Bytes:     max(c.Writer.Size(), 0),
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			Referer:   c.Request.Referer(),
+			UserAgent: c.Request.UserAgent(),
+		}
+
+		var line []byte
+		if cfg.Format == model.AccessLogFormatJSON {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return
+			}
+			line = append(data, '\n')
+		} else {
+			line = formatCombinedAccessLog(entry, start)
+		}
+		if _, err := writer.Write(line); err != nil {
+			log.Warnf("access log: write failed: %v", err)
+		}
+	}
+}
+
+// isAdminAccessPath 管理员与分组管理员接口始终记录，不参与采样
+func isAdminAccessPath(path string) bool {
+	return strings.HasPrefix(path, "/api/admin") || strings.HasPrefix(path, "/api/group-admin")
+}
+
+// accessLogUser 管理接口取 JWT 中的用户名，代理接口取 API Key 所属用户 ID
+func accessLogUser(c *gin.Context) string {
+	if username := c.GetString(ContextKeyUsername); username != "" {
+		return username
+	}
+	return c.GetString(ContextKeyUserID)
+}
+
+// sanitizeAccessLogQuery 屏蔽查询参数中的凭据（如 Gemini 的 ?key=、OAuth 回调的 code/state）
+func sanitizeAccessLogQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "[unparsable]"
+	}
+	for key, vals := range values {
+		if accessLogSensitiveParams[strings.ToLower(key)] {
+			for i := range vals {
+				vals[i] = "REDACTED"
+			}
+		}
+	}
+	return values.Encode()
+}
+
+// formatCombinedAccessLog 输出 combined 格式：host ident user [time] "request" status bytes "referer" "user-agent"，末尾附加耗时（毫秒）
+func formatCombinedAccessLog(e accessLogEntry, start time.Time) []byte {
+	user := e.User
+	if user == "" {
+		user = "-"
+	}
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.Itoa(e.Bytes)
+	}
+	target := e.Path
+	if e.Query != "" {
+		target += "?" + e.Query
+	}
+	referer := e.Referer
+	if referer == "" {
+		referer = "-"
+	}
+	userAgent := e.UserAgent
+	if userAgent == "" {
+		userAgent = "-"
+	}
+	return fmt.Appendf(nil, "%s - %s [%s] \"%s %s %s\" %d %s %s %s %.3f\n",
+		e.RemoteIP, quoteAccessLogField(user), start.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, quoteAccessLogValue(target), e.Proto, e.Status, bytes,
+		strconv.Quote(referer), strconv.Quote(userAgent), e.LatencyMs)
+}
+
+// quoteAccessLogField 用户名等不加引号的字段中的空白替换为 _，避免破坏字段分隔
+func quoteAccessLogField(s string) string {
+	return strings.ReplaceAll(quoteAccessLogValue(s), " ", "_")
+}
+
+// quoteAccessLogValue 转义引号与控制字符，避免日志注入
+func quoteAccessLogValue(s string) string {
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
+
+// rotatingFile 按大小轮转的日志文件：超出上限时 access.log 依次改名为 access.log.1、.2 …，超过保留数的删除
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxBytes int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) setLimits(maxBytes int64, maxBackups int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxBytes = maxBytes
+	r.maxBackups = maxBackups
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		log.Warnf("access log: close before rotate failed: %v", err)
+	}
+	r.file = nil
+	_ = os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		log.Warnf("access log: rotate failed: %v", err)
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
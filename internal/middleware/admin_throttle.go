@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// AdminThrottle 管理 API 的按会话/IP 限流，不同路由按开销扣除不同数量的令牌
+type AdminThrottle struct {
+	limiters    sync.Map
+	rate        rate.Limit
+	burst       int
+	routeCosts  map[string]int
+	defaultCost int
+}
+
+// NewAdminThrottle 创建管理 API 限流器；routeCosts 以 gin 路由模板（FullPath）为键，未列出的路由开销为 1
+func NewAdminThrottle(rps float64, burst int, routeCosts map[string]int) *AdminThrottle {
+	if burst < 1 {
+		burst = 1
+	}
+	return &AdminThrottle{
+		rate:        rate.Limit(rps),
+		burst:       burst,
+		routeCosts:  routeCosts,
+		defaultCost: 1,
+	}
+}
+
+func (t *AdminThrottle) getLimiter(key string) *rate.Limiter {
+	if v, ok := t.limiters.Load(key); ok {
+		return v.(*rate.Limiter)
+	}
+	v, _ := t.limiters.LoadOrStore(key, rate.NewLimiter(t.rate, t.burst))
+	return v.(*rate.Limiter)
+}
+
+func (t *AdminThrottle) routeCost(c *gin.Context) int {
+	cost, ok := t.routeCosts[c.FullPath()]
+	if !ok {
+		cost = t.defaultCost
+	}
+	// 超过突发容量的请求永远无法放行，按容量上限扣除
+	if cost > t.burst {
+		cost = t.burst
+	}
+	return cost
+}
+
+// Middleware 需挂在 JWT 认证之后：已登录会话按用户限流，否则按客户端 IP
+func (t *AdminThrottle) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t.rate <= 0 {
+			c.Next()
+			return
+		}
+
+		key := "ip:" + c.ClientIP()
+		if userID := GetUserID(c); userID != "" {
+			key = "user:" + userID
+		}
+
+		now := time.Now()
+		reservation := t.getLimiter(key).ReserveN(now, t.routeCost(c))
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "管理接口请求过于频繁，请稍后再试",
+				"retry_after": retryAfter,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
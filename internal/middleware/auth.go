@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"ampmanager/internal/model"
 	"ampmanager/internal/repository"
 	"ampmanager/internal/service"
 
@@ -18,6 +19,9 @@ const (
 
 	// tokenRefreshThreshold 当 Token 签发超过此时间后，自动刷新（滑动过期）
 	tokenRefreshThreshold = 1 * time.Hour
+
+	// passwordChangePath 需要修改密码的用户仍可访问的接口
+	passwordChangePath = "/api/me/password"
 )
 
 func JWTAuthMiddleware() gin.HandlerFunc {
@@ -50,6 +54,14 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if suspension := service.ActiveSuspension(claims.UserID); suspension != nil {
+			AbortSuspended(c, suspension)
+			return
+		}
+		if c.FullPath() != passwordChangePath && service.PasswordChangeRequired(claims.UserID) {
+			AbortPasswordChangeRequired(c)
+			return
+		}
 
 		c.Set(ContextKeyUserID, claims.UserID)
 		c.Set(ContextKeyUsername, claims.Username)
@@ -112,6 +124,14 @@ func JWTAuthFromQuery(param string) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if suspension := service.ActiveSuspension(claims.UserID); suspension != nil {
+			AbortSuspended(c, suspension)
+			return
+		}
+		if c.FullPath() != passwordChangePath && service.PasswordChangeRequired(claims.UserID) {
+			AbortPasswordChangeRequired(c)
+			return
+		}
 
 		c.Set(ContextKeyUserID, claims.UserID)
 		c.Set(ContextKeyUsername, claims.Username)
@@ -119,6 +139,23 @@ func JWTAuthFromQuery(param string) gin.HandlerFunc {
 	}
 }
 
+// AbortSuspended 以 403 拒绝已停用账户的请求，响应中说明停用原因与到期时间
+func AbortSuspended(c *gin.Context, suspension *model.UserSuspension) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":      "账户已停用：" + service.SuspensionDescription(suspension.Reason),
+		"code":       "account_suspended",
+		"suspension": service.SuspensionNotice(suspension),
+	})
+}
+
+// AbortPasswordChangeRequired 以 403 拒绝需要先修改密码的用户（管理员要求或密码已过期）
+func AbortPasswordChangeRequired(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error": "需要先修改密码才能继续使用",
+		"code":  "password_change_required",
+	})
+}
+
 func GetUserID(c *gin.Context) string {
 	userID, _ := c.Get(ContextKeyUserID)
 	if id, ok := userID.(string); ok {
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// demoAllowedRoutes 演示模式下允许的写操作（方法 + 路由模板）：登录、个人偏好与自己的 API Key、
+// 日志视图等只影响当前账户的操作。其余 POST/PUT/PATCH/DELETE 一律拒绝，新增的管理路由默认不可用
+var demoAllowedRoutes = map[string]bool{
+	"POST /api/manage/auth/login":                      true,
+	"PUT /api/me/timezone":                             true,
+	"PUT /api/me/billing/priority":                     true,
+	"POST /api/me/models/quote":                        true,
+	"PUT /api/me/amp/settings":                         true,
+	"POST /api/me/amp/settings/test":                   true,
+	"POST /api/me/amp/settings-templates/:id/apply":    true,
+	"POST /api/me/amp/api-keys":                        true,
+	"PUT /api/me/amp/api-keys/:id/scopes":              true,
+	"POST /api/me/amp/client-config":                   true,
+	"POST /api/me/amp/log-views":                       true,
+	"PUT /api/me/amp/log-views/:id":                    true,
+	"PATCH /api/me/amp/log-views/:id/pinned":           true,
+	"POST /api/admin/system/new-user-defaults/preview": true,
+}
+
+// DemoModeGuard 演示模式下只放行只读请求与 demoAllowedRoutes 中的写操作，
+// 数据库上传/恢复、账户凭据、权限变更等均被拦截，避免公开演示环境被改坏
+func DemoModeGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Demo-Mode", "true")
+		if isDemoBlocked(c.Request.Method, c.FullPath()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "演示模式下不允许此操作"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// isDemoBlocked 按路由模板判断，避免 /users/:id/xxx 这类路径绕过后缀匹配
+func isDemoBlocked(method, route string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return !demoAllowedRoutes[method+" "+route]
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ampmanager/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpPolicyMu      sync.RWMutex
+	defaultHTTPPolicy = model.HTTPPolicyConfig{}
+	httpPolicy        = model.HTTPPolicyConfig{}
+	httpPolicyCustom  bool
+)
+
+// SetDefaultHTTPPolicy 设置来自环境变量的默认策略，未保存系统配置时生效
+func SetDefaultHTTPPolicy(policy model.HTTPPolicyConfig) {
+	policy = NormalizeHTTPPolicy(policy)
+	httpPolicyMu.Lock()
+	defer httpPolicyMu.Unlock()
+	defaultHTTPPolicy = policy
+	if !httpPolicyCustom {
+		httpPolicy = policy
+	}
+}
+
+// InitHTTPPolicy 从系统配置 JSON 加载策略，解析或校验失败时保留默认策略
+func InitHTTPPolicy(configJSON string) error {
+	if configJSON == "" {
+		return nil
+	}
+	var policy model.HTTPPolicyConfig
+	if err := json.Unmarshal([]byte(configJSON), &policy); err != nil {
+		return err
+	}
+	policy = NormalizeHTTPPolicy(policy)
+	if err := ValidateHTTPPolicy(policy); err != nil {
+		return err
+	}
+	UpdateHTTPPolicy(&policy)
+	return nil
+}
+
+// UpdateHTTPPolicy 更新运行时策略，nil 表示恢复默认策略
+func UpdateHTTPPolicy(policy *model.HTTPPolicyConfig) {
+	httpPolicyMu.Lock()
+	defer httpPolicyMu.Unlock()
+	if policy == nil {
+		httpPolicy = defaultHTTPPolicy
+		httpPolicyCustom = false
+		return
+	}
+	httpPolicy = *policy
+	httpPolicyCustom = true
+}
+
+// GetHTTPPolicy 返回当前生效的策略及其是否来自系统配置
+func GetHTTPPolicy() (model.HTTPPolicyConfig, bool) {
+	httpPolicyMu.RLock()
+	defer httpPolicyMu.RUnlock()
+	return httpPolicy, httpPolicyCustom
+}
+
+// NormalizeHTTPPolicy 去除空白与空项，保证列表字段非 nil
+func NormalizeHTTPPolicy(policy model.HTTPPolicyConfig) model.HTTPPolicyConfig {
+	policy.CORSAllowedOrigins = normalizeOriginList(policy.CORSAllowedOrigins)
+	policy.FrameAncestors = normalizeOriginList(policy.FrameAncestors)
+	policy.ContentSecurityPolicy = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(policy.ContentSecurityPolicy), ";"))
+	return policy
+}
+
+func normalizeOriginList(items []string) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimRight(strings.TrimSpace(item), "/"); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// ValidateHTTPPolicy 校验来源格式与 CSP 指令
+func ValidateHTTPPolicy(policy model.HTTPPolicyConfig) error {
+	for _, origin := range policy.CORSAllowedOrigins {
+		if origin == "*" {
+			if policy.CORSAllowCredentials {
+				return errors.New("允许凭据时不能使用 * 作为跨域来源")
+			}
+			continue
+		}
+		if err := validateOriginPattern(origin); err != nil {
+			return fmt.Errorf("跨域来源 %q 无效: %w", origin, err)
+		}
+	}
+	for _, ancestor := range policy.FrameAncestors {
+		if ancestor == "'self'" || ancestor == "'none'" {
+			continue
+		}
+		if err := validateOriginPattern(ancestor); err != nil {
+			return fmt.Errorf("嵌入来源 %q 无效: %w", ancestor, err)
+		}
+	}
+	if policy.CORSMaxAgeSec < 0 || policy.CORSMaxAgeSec > 86400 {
+		return errors.New("corsMaxAgeSec 必须在 0 到 86400 之间")
+	}
+	csp := policy.ContentSecurityPolicy
+	if strings.ContainsAny(csp, "\r\n") {
+		return errors.New("contentSecurityPolicy 不能包含换行")
+	}
+	for _, directive := range strings.Split(csp, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) > 0 && strings.EqualFold(fields[0], "frame-ancestors") {
+			return errors.New("frame-ancestors 请通过 frameAncestors 配置")
+		}
+	}
+	return nil
+}
+
+// validateOriginPattern 来源须为 scheme://host[:port]，host 可用 *. 前缀匹配子域
+func validateOriginPattern(origin string) error {
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("仅支持 http/https")
+	}
+	if u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return errors.New("格式应为 scheme://host[:port]")
+	}
+	return nil
+}
+
+// matchOrigin 判断请求来源是否命中配置的来源（支持子域通配）
+func matchOrigin(pattern, origin string) bool {
+	if strings.EqualFold(pattern, origin) {
+		return true
+	}
+	scheme, host, ok := strings.Cut(pattern, "://*.")
+	if !ok {
+		return false
+	}
+	originScheme, originHost, ok := strings.Cut(origin, "://")
+	if !ok || !strings.EqualFold(scheme, originScheme) {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(originHost), "."+strings.ToLower(host))
+}
+
+// HTTPPolicy 按当前策略写入 CORS 与安全相关响应头
+func HTTPPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, _ := GetHTTPPolicy()
+		origin := c.Request.Header.Get("Origin")
+
+		// 只有配置了允许源时才启用 CORS
+		if origin != "" {
+			allowOrigin := ""
+			for _, o := range policy.CORSAllowedOrigins {
+				if o == "*" && !policy.CORSAllowCredentials {
+					allowOrigin = "*"
+					break
+				}
+				if matchOrigin(o, origin) {
+					allowOrigin = origin
+					break
+				}
+			}
+
+			if allowOrigin != "" {
+				c.Header("Access-Control-Allow-Origin", allowOrigin)
+				c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, PATCH, OPTIONS")
+				c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Api-Key")
+				c.Header("Access-Control-Expose-Headers", "Retry-After, Content-Disposition")
+				if policy.CORSAllowCredentials {
+					c.Header("Access-Control-Allow-Credentials", "true")
+				}
+				if policy.CORSMaxAgeSec > 0 {
+					c.Header("Access-Control-Max-Age", strconv.Itoa(policy.CORSMaxAgeSec))
+				}
+				if allowOrigin != "*" {
+					c.Header("Vary", "Origin")
+				}
+			}
+		}
+
+		frameAncestors := policy.FrameAncestors
+		if len(frameAncestors) == 0 {
+			frameAncestors = []string{"'self'"}
+		}
+		csp := "frame-ancestors " + strings.Join(frameAncestors, " ")
+		if policy.ContentSecurityPolicy != "" {
+			csp += "; " + policy.ContentSecurityPolicy
+		}
+		c.Header("Content-Security-Policy", csp)
+		// 旧浏览器不识别 frame-ancestors，只在可表达时补充 X-Frame-Options
+		switch strings.Join(frameAncestors, " ") {
+		case "'none'":
+			c.Header("X-Frame-Options", "DENY")
+		case "'self'":
+			c.Header("X-Frame-Options", "SAMEORIGIN")
+		}
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+		c.Next()
+	}
+}
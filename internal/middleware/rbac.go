@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"ampmanager/internal/repository"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKeyAdminScope 当前请求的管理权限范围（*service.AdminScope）
+const ContextKeyAdminScope = "admin_scope"
+
+// GroupAdminMiddleware 允许全局管理员与分组管理员访问，并记录管理权限范围供 RequireUserInScope 与处理器使用
+func GroupAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := GetUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+			c.Abort()
+			return
+		}
+
+		scope, err := service.ResolveAdminScope(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取管理权限失败"})
+			c.Abort()
+			return
+		}
+		if scope == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员或分组管理员权限"})
+			c.Abort()
+			return
+		}
+
+		c.Set(ContextKeyAdminScope, scope)
+		if scope.Global {
+			c.Set(ContextKeyIsAdmin, true)
+		}
+		c.Next()
+	}
+}
+
+// RequireUserInScope 校验路径参数 param 指定的用户在当前管理权限范围内
+func RequireUserInScope(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := service.CheckUserInScope(GetAdminScope(c), c.Param(param)); err != nil {
+			switch {
+			case errors.Is(err, repository.ErrUserNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrOutOfAdminScope):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "校验管理权限失败"})
+			}
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetAdminScope 返回当前请求的管理权限范围；经 AdminMiddleware 认证的请求视为全局管理员，未认证时返回 nil
+func GetAdminScope(c *gin.Context) *service.AdminScope {
+	if v, exists := c.Get(ContextKeyAdminScope); exists {
+		if scope, ok := v.(*service.AdminScope); ok {
+			return scope
+		}
+	}
+	if IsAdmin(c) {
+		return &service.AdminScope{Global: true}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+	"ampmanager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+}
+
+// createScopedUser 创建属于 groupIDs 的用户，并指定为 adminOf 中各分组的分组管理员
+func createScopedUser(t *testing.T, username string, isAdmin bool, groupIDs, adminOf []string) string {
+	t.Helper()
+	users := repository.NewUserRepository()
+	user := &model.User{Username: username, PasswordHash: "x", IsAdmin: isAdmin}
+	if err := users.Create(user); err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	if isAdmin {
+		if err := users.SetAdmin(user.ID, true); err != nil {
+			t.Fatalf("set admin %s: %v", username, err)
+		}
+	}
+	if err := users.SetGroups(user.ID, groupIDs); err != nil {
+		t.Fatalf("set groups %s: %v", username, err)
+	}
+	for _, gid := range adminOf {
+		if err := repository.NewGroupRepository().AddAdmin(gid, user.ID, "test"); err != nil {
+			t.Fatalf("add group admin %s: %v", username, err)
+		}
+	}
+	return user.ID
+}
+
+func createGroup(t *testing.T, name string) string {
+	t.Helper()
+	group := &model.Group{Name: name}
+	if err := repository.NewGroupRepository().Create(group); err != nil {
+		t.Fatalf("create group %s: %v", name, err)
+	}
+	return group.ID
+}
+
+// scopeEngine 模拟 /api/group-admin/users/:id 路由的中间件链
+func scopeEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		if actor := c.GetHeader("X-Test-Actor"); actor != "" {
+			c.Set(ContextKeyUserID, actor)
+		}
+		c.Next()
+	})
+	engine.Use(GroupAdminMiddleware())
+	engine.GET("/groups", func(c *gin.Context) {
+		c.JSON(http.StatusOK, GetAdminScope(c))
+	})
+	engine.GET("/users/:id", RequireUserInScope("id"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return engine
+}
+
+func scopeRequest(engine *gin.Engine, actor, path string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if actor != "" {
+		req.Header.Set("X-Test-Actor", actor)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestGroupAdminMiddleware(t *testing.T) {
+	setupTestDB(t)
+	teamA := createGroup(t, "team-a")
+	root := createScopedUser(t, "root", true, nil, nil)
+	leader := createScopedUser(t, "leader", false, []string{teamA}, []string{teamA})
+	member := createScopedUser(t, "member", false, []string{teamA}, nil)
+
+	engine := scopeEngine()
+	cases := []struct {
+		name  string
+		actor string
+		want  int
+	}{
+		{"unauthenticated", "", http.StatusUnauthorized},
+		{"plain user", member, http.StatusForbidden},
+		{"unknown user", "missing", http.StatusForbidden},
+		{"group admin", leader, http.StatusOK},
+		{"global admin", root, http.StatusOK},
+	}
+	for _, tc := range cases {
+		if got := scopeRequest(engine, tc.actor, "/groups"); got != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRequireUserInScope(t *testing.T) {
+	setupTestDB(t)
+	teamA := createGroup(t, "team-a")
+	teamB := createGroup(t, "team-b")
+	root := createScopedUser(t, "root", true, nil, nil)
+	otherRoot := createScopedUser(t, "root2", true, []string{teamA}, nil)
+	leader := createScopedUser(t, "leader", false, []string{teamA}, []string{teamA})
+	coLeader := createScopedUser(t, "co-leader", false, []string{teamA}, []string{teamA})
+	// 同在 team-a 但管理的是 team-b：不能被 team-a 的分组管理员修改
+	peer := createScopedUser(t, "peer", false, []string{teamA}, []string{teamB})
+	member := createScopedUser(t, "member", false, []string{teamA, teamB}, nil)
+	outsider := createScopedUser(t, "outsider", false, []string{teamB}, nil)
+	ungrouped := createScopedUser(t, "ungrouped", false, nil, nil)
+
+	engine := scopeEngine()
+	cases := []struct {
+		name          string
+		actor, target string
+		want          int
+	}{
+		{"member of managed group", leader, member, http.StatusNoContent},
+		{"user outside managed groups", leader, outsider, http.StatusForbidden},
+		{"user without groups", leader, ungrouped, http.StatusForbidden},
+		{"global admin target", leader, otherRoot, http.StatusForbidden},
+		{"admin of another group", leader, peer, http.StatusForbidden},
+		{"co-admin of same group", leader, coLeader, http.StatusForbidden},
+		{"self", leader, leader, http.StatusForbidden},
+		{"missing target", leader, "missing", http.StatusNotFound},
+		{"global admin manages group admin", root, peer, http.StatusNoContent},
+		{"global admin manages anyone", root, otherRoot, http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		if got := scopeRequest(engine, tc.actor, "/users/"+tc.target); got != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// 撤销分组管理员后重新回到管理范围
+	if _, err := service.NewGroupService().RemoveAdmin("root", teamB, peer); err != nil {
+		t.Fatalf("remove admin: %v", err)
+	}
+	if got := scopeRequest(engine, leader, "/users/"+peer); got != http.StatusNoContent {
+		t.Errorf("revoked peer: status = %d, want %d", got, http.StatusNoContent)
+	}
+}
@@ -20,6 +20,10 @@ type AmpSettings struct {
 	NativeMode         bool      `json:"native_mode"`
 	ShowBalanceInAd    bool      `json:"show_balance_in_ad"`
 	Socks5Proxy        string    `json:"socks5_proxy"`
+	PostProcessingJSON string    `json:"-"`
+	// SystemPrompt 转发模型请求时加在系统提示最前面的内容，为空表示不修改
+	SystemPrompt       string    `json:"system_prompt"`
+	Version            int       `json:"version"`
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
 }
@@ -47,6 +51,8 @@ type UserAPIKey struct {
 	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
 	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
 	CreatedAt  time.Time  `json:"created_at"`
+	// Scopes 访问范围，nil 表示不限制
+	Scopes *APIKeyScopes `json:"scopes,omitempty"`
 }
 
 // Request/Response 结构体
@@ -60,6 +66,12 @@ type AmpSettingsRequest struct {
 	NativeMode         bool           `json:"nativeMode"`
 	ShowBalanceInAd    *bool          `json:"showBalanceInAd,omitempty"`
 	Socks5Proxy        string         `json:"socks5Proxy,omitempty"`
+	// PostProcessing nil 表示不修改
+	PostProcessing *PostProcessingSettings `json:"postProcessing,omitempty"`
+	// SystemPrompt nil 表示不修改，空字符串表示清除
+	SystemPrompt *string `json:"systemPrompt,omitempty"`
+	// Version 编辑时读取到的版本号，非 0 时用于乐观锁校验
+	Version int `json:"version,omitempty"`
 }
 
 type AmpSettingsResponse struct {
@@ -67,14 +79,34 @@ type AmpSettingsResponse struct {
 	ModelMappings []ModelMapping `json:"modelMappings"`
 	Enabled       bool           `json:"enabled"`
 	HasAPIKey          bool           `json:"apiKeySet"`
+	APIKeyMasked       string         `json:"apiKeyMasked,omitempty"` // 脱敏后的上游 API Key
 	WebSearchMode      string         `json:"webSearchMode"` // upstream | builtin_free | local_duckduckgo
 	NativeMode         bool           `json:"nativeMode"`
 	ShowBalanceInAd    bool           `json:"showBalanceInAd"`
 	HasSocks5Proxy     bool           `json:"socks5ProxySet"`
+	PostProcessing     PostProcessingSettings `json:"postProcessing"`
+	SystemPrompt       string         `json:"systemPrompt"`
+	Version            int            `json:"version"`
 	CreatedAt          time.Time      `json:"createdAt,omitempty"`
 	UpdatedAt          time.Time      `json:"updatedAt,omitempty"`
 }
 
+// PostProcessingSettings 响应后处理设置：按顺序执行启用的处理器，
+// 非流式响应处理完整文本，流式响应仅在内容块结束时执行收尾处理
+type PostProcessingSettings struct {
+	Processors []string `json:"processors"`
+	// Locale 语言区域（如 zh-CN），供与语言相关的处理器使用
+	Locale string `json:"locale,omitempty"`
+}
+
+// PostProcessorInfo 可用的响应后处理器
+type PostProcessorInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Streaming 是否支持流式响应的收尾处理
+	Streaming bool `json:"streaming"`
+}
+
 type TestConnectionResponse struct {
 	Success   bool   `json:"success"`
 	Message   string `json:"message"`
@@ -83,6 +115,20 @@ type TestConnectionResponse struct {
 
 type CreateAPIKeyRequest struct {
 	Name string `json:"name" binding:"required,min=1,max=64"`
+	// Scopes 可选的访问范围（模型、接口类别与月度预算）
+	Scopes *APIKeyScopes `json:"scopes,omitempty"`
+}
+
+// ModelMappingsRequest 管理员更新用户的模型映射，其余 Amp 设置保持不变
+type ModelMappingsRequest struct {
+	ModelMappings []ModelMapping `json:"modelMappings" binding:"required"`
+	// Version 读取到的设置版本号，非 0 时用于乐观锁校验
+	Version int `json:"version,omitempty"`
+}
+
+type ModelMappingsResponse struct {
+	ModelMappings []ModelMapping `json:"modelMappings"`
+	Version       int            `json:"version"`
 }
 
 type CreateAPIKeyResponse struct {
@@ -92,6 +138,7 @@ type CreateAPIKeyResponse struct {
 	APIKey    string    `json:"apiKey"`
 	CreatedAt time.Time `json:"createdAt"`
 	Message   string    `json:"message"`
+	Scopes    *APIKeyScopes `json:"scopes,omitempty"`
 }
 
 type APIKeyRevealResponse struct {
@@ -110,6 +157,7 @@ type APIKeyListItem struct {
 	RevokedAt *time.Time `json:"revokedAt,omitempty"`
 	LastUsed  *time.Time `json:"lastUsedAt,omitempty"`
 	IsActive  bool       `json:"isActive"`
+	Scopes    *APIKeyScopes `json:"scopes,omitempty"`
 }
 
 type BootstrapResponse struct {
@@ -152,14 +200,32 @@ type RequestLog struct {
 	OutputTokens             *int             `json:"outputTokens,omitempty"`
 	CacheReadInputTokens     *int             `json:"cacheReadInputTokens,omitempty"`
 	CacheCreationInputTokens *int             `json:"cacheCreationInputTokens,omitempty"`
+	UsageEstimated           bool             `json:"usageEstimated"` // token 数为估算值（上游未返回用量）
 	ErrorType                *string          `json:"errorType,omitempty"`
 	RequestID                *string          `json:"requestId,omitempty"`
 	ThinkingLevel            *string          `json:"thinkingLevel,omitempty"` // 思维等级
+	OnBehalfOf               *string          `json:"onBehalfOf,omitempty"`    // 联邦请求的原始用户（签发方/用户）
+	TraceID                  *string          `json:"traceId,omitempty"`       // 分布式追踪 trace ID
 	OutputPreview            *string          `json:"outputPreview,omitempty"` // 响应输出预览（前200字符）
 	// 成本相关字段
 	CostMicros   *int64  `json:"costMicros,omitempty"`   // 成本（微美元，USD * 1e6）
 	CostUsd      *string `json:"costUsd,omitempty"`      // 成本（USD，用于展示）
 	PricingModel *string `json:"pricingModel,omitempty"` // 计价模型名
+	// 重试历史（仅详情接口返回，单次尝试时为空）
+	Attempts []RequestAttempt `json:"attempts,omitempty"`
+}
+
+// RequestAttempt 单次上游请求尝试记录（由重试传输层记录）
+type RequestAttempt struct {
+	Attempt    int       `json:"attempt"`
+	StartedAt  time.Time `json:"startedAt"`
+	ChannelID  string    `json:"channelId,omitempty"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorClass string    `json:"errorClass,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	BackoffMs  int64     `json:"backoffMs,omitempty"` // 本次失败后等待的退避时长
+	Failover   bool      `json:"failover,omitempty"`  // 本次失败后切换到其他渠道
 }
 
 // RequestLogListResponse 请求日志列表响应
@@ -168,6 +234,8 @@ type RequestLogListResponse struct {
 	Total    int64        `json:"total"`
 	Page     int          `json:"page"`
 	PageSize int          `json:"pageSize"`
+	// NextCursor 游标分页模式下的下一页游标（为空表示没有更多数据）
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 // UsageSummary 用量统计
@@ -190,12 +258,79 @@ type UsageSummaryResponse struct {
 
 // RequestLogDetail 请求日志详情（包含请求/响应头和体）
 type RequestLogDetail struct {
-	RequestID              string            `json:"requestId"`
-	RequestHeaders         map[string]string `json:"requestHeaders"`
-	RequestBody            string            `json:"requestBody"`
-	TranslatedRequestBody  string            `json:"translatedRequestBody,omitempty"` // 翻译后发送给上游的请求
-	ResponseHeaders        map[string]string `json:"responseHeaders"`
-	ResponseBody           string            `json:"responseBody"`
-	TranslatedResponseBody string            `json:"translatedResponseBody,omitempty"` // 翻译后发送给客户端的响应
-	CreatedAt              time.Time         `json:"createdAt"`
+	RequestID              string             `json:"requestId"`
+	RequestHeaders         map[string]string  `json:"requestHeaders"`
+	RequestBody            string             `json:"requestBody"`
+	TranslatedRequestBody  string             `json:"translatedRequestBody,omitempty"` // 翻译后发送给上游的请求
+	ResponseHeaders        map[string]string  `json:"responseHeaders"`
+	ResponseBody           string             `json:"responseBody"`
+	TranslatedResponseBody string             `json:"translatedResponseBody,omitempty"` // 翻译后发送给客户端的响应
+	Attempts               []RequestAttempt   `json:"attempts,omitempty"`               // 重试历史
+	RedactionCount         int                `json:"redactionCount"`                   // 脱敏屏蔽的疑似密钥处数
+	InjectedSystemPrompt   string             `json:"injectedSystemPrompt,omitempty"`   // 插入的分组强制系统提示词（合规审计）
+	PIIRedactions          []PIIRedactionItem `json:"piiRedactions,omitempty"`          // 转发前脱敏报告
+	CreatedAt              time.Time          `json:"createdAt"`
+}
+
+// FinalizePendingRequest 强制结束 pending 记录请求
+type FinalizePendingRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=200"`
+}
+
+// FinalizePendingResult 单条 pending 记录的强制结束结果
+type FinalizePendingResult struct {
+	ID         string `json:"id"`
+	Finalized  bool   `json:"finalized"`
+	CostMicros int64  `json:"costMicros"`
+	Settled    bool   `json:"settled"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ErrorClusterChannel 错误聚类中受影响的渠道
+type ErrorClusterChannel struct {
+	ChannelID   string `json:"channelId"`
+	ChannelName string `json:"channelName"`
+	Count       int64  `json:"count"`
+}
+
+// ErrorCluster 按归一化错误签名聚合的失败请求
+type ErrorCluster struct {
+	Signature         string                `json:"signature"`
+	ErrorType         string                `json:"errorType"`
+	StatusCode        int                   `json:"statusCode"`
+	MessagePattern    string                `json:"messagePattern"`
+	Count             int64                 `json:"count"`
+	FirstSeen         time.Time             `json:"firstSeen"`
+	LastSeen          time.Time             `json:"lastSeen"`
+	Models            []string              `json:"models"`
+	Channels          []ErrorClusterChannel `json:"channels"`
+	ExampleRequestIDs []string              `json:"exampleRequestIds"`
+}
+
+// ErrorClusterReport 错误聚类报告
+type ErrorClusterReport struct {
+	From          time.Time      `json:"from"`
+	To            time.Time      `json:"to"`
+	TotalFailed   int64          `json:"totalFailed"`
+	SampleLimited bool           `json:"sampleLimited"`
+	Clusters      []ErrorCluster `json:"clusters"`
+}
+
+// ClientConfigRequest 生成 Amp CLI / VS Code 扩展配置包的请求
+type ClientConfigRequest struct {
+	KeyName string `json:"keyName" binding:"max=64"`
+	BaseURL string `json:"baseUrl" binding:"omitempty,url"` // 为空时使用当前访问地址
+}
+
+// ClientConfigBundle Amp CLI / VS Code 扩展的开箱即用配置
+type ClientConfigBundle struct {
+	BaseURL       string            `json:"baseUrl"`
+	APIKeyID      string            `json:"apiKeyId"`
+	APIKeyName    string            `json:"apiKeyName"`
+	APIKey        string            `json:"apiKey"`
+	Env           map[string]string `json:"env"`
+	Settings      map[string]any    `json:"settings"`      // 写入 settings.json 的推荐配置
+	SettingsPaths map[string]string `json:"settingsPaths"` // 各客户端 settings.json 的位置
+	Snippets      map[string]string `json:"snippets"`      // 按 shell 区分的环境变量设置脚本
+	CreatedAt     time.Time         `json:"createdAt"`
 }
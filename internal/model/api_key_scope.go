@@ -0,0 +1,47 @@
+package model
+
+// API Key 可访问的接口类别
+const (
+	// APIKeyEndpointChat 对话类模型调用：Chat Completions、Messages、Responses、Gemini generateContent 与实时会话
+	APIKeyEndpointChat = "chat"
+	// APIKeyEndpointEmbeddings 向量接口
+	APIKeyEndpointEmbeddings = "embeddings"
+	// APIKeyEndpointAudio 语音转写、翻译与合成
+	APIKeyEndpointAudio = "audio"
+	// APIKeyEndpointBatch Anthropic / Gemini 批处理接口
+	APIKeyEndpointBatch = "batch"
+	// APIKeyEndpointModels 模型列表
+	APIKeyEndpointModels = "models"
+	// APIKeyEndpointAmp 转发到 Amp 上游的管理接口（用户、线程、遥测等）
+	APIKeyEndpointAmp = "amp"
+)
+
+// APIKeyEndpoints 所有可授权的接口类别
+var APIKeyEndpoints = []string{
+	APIKeyEndpointChat,
+	APIKeyEndpointEmbeddings,
+	APIKeyEndpointAudio,
+	APIKeyEndpointBatch,
+	APIKeyEndpointModels,
+	APIKeyEndpointAmp,
+}
+
+// APIKeyScopes API Key 的访问范围，各字段为空表示不限制
+type APIKeyScopes struct {
+	// Models 允许调用的模型（按请求中的原始模型名匹配），支持 * 通配符，如 claude-*、*-mini
+	Models []string `json:"models,omitempty"`
+	// Endpoints 允许访问的接口类别，见 APIKeyEndpoint* 常量
+	Endpoints []string `json:"endpoints,omitempty"`
+	// MonthlyBudgetMicros 该 Key 每个自然月（UTC）的消费上限，0 表示不限制
+	MonthlyBudgetMicros int64 `json:"monthlyBudgetMicros,omitempty"`
+}
+
+// IsEmpty 是否未设置任何限制
+func (s *APIKeyScopes) IsEmpty() bool {
+	return s == nil || (len(s.Models) == 0 && len(s.Endpoints) == 0 && s.MonthlyBudgetMicros == 0)
+}
+
+// UpdateAPIKeyScopesRequest 更新 API Key 的访问范围，scopes 为空对象时取消所有限制
+type UpdateAPIKeyScopesRequest struct {
+	Scopes APIKeyScopes `json:"scopes"`
+}
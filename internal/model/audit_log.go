@@ -0,0 +1,33 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditLog 管理操作与定时任务执行的审计记录
+type AuditLog struct {
+	ID string `json:"id"`
+	// Actor 操作人用户 ID，定时任务执行时为 scheduler
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetID   string          `json:"targetId"`
+	Detail     json.RawMessage `json:"detail"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+type AuditLogFilter struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Page       int
+	PageSize   int
+}
+
+type AuditLogListResponse struct {
+	Items    []*AuditLog `json:"items"`
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+}
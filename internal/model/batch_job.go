@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// BatchProvider 批处理接口所属的上游格式
+type BatchProvider string
+
+const (
+	// BatchProviderAnthropic Anthropic Message Batches（/v1/messages/batches）
+	BatchProviderAnthropic BatchProvider = "anthropic"
+	// BatchProviderGemini Gemini batchGenerateContent（/v1beta/batches）
+	BatchProviderGemini BatchProvider = "gemini"
+)
+
+// BatchJobStatus 批处理任务的结算状态
+type BatchJobStatus string
+
+const (
+	BatchJobInProgress BatchJobStatus = "in_progress" // 上游处理中或等待结算
+	BatchJobSettling   BatchJobStatus = "settling"    // 正在拉取结果并逐条结算
+	BatchJobSettled    BatchJobStatus = "settled"     // 已逐条写入请求日志并结算
+	BatchJobFailed     BatchJobStatus = "failed"      // 结果已无法获取（渠道被删除或超过上游保留期），原因见 Error
+)
+
+// BatchJob 经由渠道提交的批处理任务，记录提交用户与渠道，后续查询、取消与结算都发往同一渠道
+type BatchJob struct {
+	ID       string        `json:"id"`
+	Provider BatchProvider `json:"provider"`
+	// UpstreamID 上游的批处理 ID（Anthropic 为 msgbatch_xxx，Gemini 为 batches/xxx），客户端使用该 ID 查询
+	UpstreamID     string         `json:"upstreamId"`
+	UserID         string         `json:"userId"`
+	APIKeyID       string         `json:"apiKeyId"`
+	ChannelID      string         `json:"channelId"`
+	Model          string         `json:"model"`
+	RateMultiplier float64        `json:"rateMultiplier"`
+	RequestCount   int            `json:"requestCount"`
+	Status         BatchJobStatus `json:"status"`
+	// ItemCount 结算时写入请求日志的条目数
+	ItemCount  int        `json:"itemCount"`
+	CostMicros int64      `json:"costMicros"`
+	Error      string     `json:"error,omitempty"`
+	SettledAt  *time.Time `json:"settledAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+// 计费一致性检查发现的问题类型
+const (
+	// BillingAuditRequestChargeMismatch 请求日志上的已扣费用与该请求的计费事件合计不一致
+	BillingAuditRequestChargeMismatch = "request_charge_mismatch"
+	// BillingAuditNegativeBalance 用户余额低于允许的透支额度
+	BillingAuditNegativeBalance = "negative_balance"
+	// BillingAuditSubscriptionWindowMismatch 订阅当前窗口内按请求日志汇总的扣费与计费事件合计不一致
+	BillingAuditSubscriptionWindowMismatch = "subscription_window_mismatch"
+	// BillingAuditSubscriptionWindowExceeded 订阅当前窗口内的扣费超过套餐额度
+	BillingAuditSubscriptionWindowExceeded = "subscription_window_exceeded"
+	// BillingAuditSubscriptionOwnerMismatch 订阅扣费事件缺少订阅或订阅不属于该用户
+	BillingAuditSubscriptionOwnerMismatch = "subscription_owner_mismatch"
+)
+
+// BillingAuditConfig 计费一致性检查配置
+type BillingAuditConfig struct {
+	// Enabled 是否定期执行检查
+	Enabled     bool `json:"enabled"`
+	IntervalSec int  `json:"intervalSec"`
+	// AutoRepair 定期检查时自动修复可修复的问题（以计费事件为准修正请求日志，余额恢复到透支下限）
+	AutoRepair bool `json:"autoRepair"`
+	// OverdraftMicros 允许的余额透支额度，余额低于 -OverdraftMicros 视为异常
+	OverdraftMicros int64 `json:"overdraftMicros"`
+	// LookbackDays 逐请求核对的时间范围
+	LookbackDays int `json:"lookbackDays"`
+}
+
+// BillingAuditIssue 单个不一致项，Expected 为按计费事件（或约束）得出的值，Actual 为当前记录值
+type BillingAuditIssue struct {
+	Type           string  `json:"type"`
+	UserID         string  `json:"userId"`
+	RequestLogID   *string `json:"requestLogId,omitempty"`
+	SubscriptionID *string `json:"subscriptionId,omitempty"`
+	Source         string  `json:"source,omitempty"`
+	Expected       int64   `json:"expected"`
+	Actual         int64   `json:"actual"`
+	Detail         string  `json:"detail,omitempty"`
+	Repaired       bool    `json:"repaired"`
+}
+
+// BillingAuditReport 一次检查的结果
+type BillingAuditReport struct {
+	StartedAt  time.Time           `json:"startedAt"`
+	FinishedAt time.Time           `json:"finishedAt"`
+	Repair     bool                `json:"repair"`
+	Issues     []BillingAuditIssue `json:"issues"`
+	// IssueCounts 按类型统计的问题数
+	IssueCounts   map[string]int `json:"issueCounts"`
+	RepairedCount int            `json:"repairedCount"`
+	// Truncated 问题过多时仅返回前若干条
+	Truncated bool `json:"truncated"`
+}
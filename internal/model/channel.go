@@ -8,8 +8,21 @@ const (
 	ChannelTypeGemini ChannelType = "gemini"
 	ChannelTypeClaude ChannelType = "claude"
 	ChannelTypeOpenAI ChannelType = "openai"
+	// ChannelTypeClaudeOAuth 以 claude.ai 订阅的 OAuth 令牌代替 API Key 访问 Anthropic，
+	// 令牌由 AMP-Manager 在过期前自动刷新
+	ChannelTypeClaudeOAuth ChannelType = "claude_oauth"
+	// ChannelTypeOllama 自托管的 Ollama 服务，OpenAI Chat 请求翻译为 /api/chat 或 /api/generate
+	ChannelTypeOllama ChannelType = "ollama"
 )
 
+// Protocol 渠道上游使用的协议：claude_oauth 与 claude 同为 Anthropic Messages 协议，仅认证方式不同
+func (t ChannelType) Protocol() ChannelType {
+	if t == ChannelTypeClaudeOAuth {
+		return ChannelTypeClaude
+	}
+	return t
+}
+
 type ChannelEndpoint string
 
 const (
@@ -17,6 +30,9 @@ const (
 	ChannelEndpointResponses       ChannelEndpoint = "responses"
 	ChannelEndpointMessages        ChannelEndpoint = "messages"
 	ChannelEndpointGenerateContent ChannelEndpoint = "generate_content"
+	// Ollama 原生接口：/api/chat 与 /api/generate
+	ChannelEndpointChat     ChannelEndpoint = "chat"
+	ChannelEndpointGenerate ChannelEndpoint = "generate"
 )
 
 type Channel struct {
@@ -26,6 +42,12 @@ type Channel struct {
 	Name           string          `json:"name"`
 	BaseURL        string          `json:"baseUrl"`
 	APIKey         string          `json:"-"`
+	// APIKeysJSON 额外密钥列表（JSON 数组），与 APIKey 组成密钥池轮换使用
+	APIKeysJSON string `json:"-"`
+	// KeyStrategy 密钥池选择策略，为空时按 round_robin
+	KeyStrategy string `json:"keyStrategy"`
+	// KeyID 本次请求选中密钥的指纹，仅在密钥池有多个密钥时设置，不落库
+	KeyID string `json:"-"`
 	Enabled        bool            `json:"enabled"`
 	Weight         int             `json:"weight"`
 	Priority       int             `json:"priority"`
@@ -33,21 +55,117 @@ type Channel struct {
 	SimulateCLI    bool            `json:"simulateCli"`
 	ModelsJSON     string          `json:"-"`
 	HeadersJSON    string          `json:"-"`
+	// AnthropicBetaPolicyJSON 为空时使用默认策略（仅移除 1M 上下文）
+	AnthropicBetaPolicyJSON string `json:"-"`
+	// HeaderPolicyJSON 为空时不改动客户端请求头
+	HeaderPolicyJSON string `json:"-"`
+	// TranslationMode 跨格式翻译失败时的处理方式，为空时沿用全局配置
+	TranslationMode string `json:"-"`
+	// FederationIssuer 非空时上游为另一个 AMP-Manager 实例，请求以 API Key 为密钥签名并附带原始用户，而不直接发送 API Key
+	FederationIssuer string `json:"-"`
+	// DNSPolicyJSON 为空时使用系统解析与共享连接池
+	DNSPolicyJSON string `json:"-"`
+	Version                 int    `json:"version"`
 	CreatedAt      time.Time       `json:"createdAt"`
 	UpdatedAt      time.Time       `json:"updatedAt"`
 }
 
+// 密钥池选择策略
+const (
+	ChannelKeyStrategyRoundRobin = "round_robin" // 轮询
+	ChannelKeyStrategyLRU        = "lru"         // 最久未使用
+)
+
+// ChannelKeyStatus 密钥池中单个密钥的状态（不含密钥本身）
+type ChannelKeyStatus struct {
+	// ID 密钥指纹
+	ID string `json:"id"`
+	// Ref 密钥以外部存储引用配置时返回引用本身
+	Ref           string     `json:"ref,omitempty"`
+	// Masked 脱敏后的密钥，引用时为空
+	Masked        string     `json:"masked,omitempty"`
+	Primary       bool       `json:"primary"`
+	LastUsedAt    *time.Time `json:"lastUsedAt,omitempty"`
+	CooldownUntil *time.Time `json:"cooldownUntil,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
+
+// 渠道的跨格式翻译模式
+const (
+	ChannelTranslationModeInherit = "inherit" // 沿用全局配置
+	ChannelTranslationModeStrict  = "strict"  // 翻译失败返回 502
+	ChannelTranslationModeRelaxed = "relaxed" // 翻译失败时记录警告并沿用原始数据
+)
+
+// Anthropic-Beta 策略模式
+const (
+	AnthropicBetaModeDeny  = "deny"  // 移除列表中的 beta，其余透传
+	AnthropicBetaModeAllow = "allow" // 仅保留列表中的 beta，其余移除
+)
+
+// DefaultAnthropicBetaDeny 未配置策略时移除的 beta（多数上游不支持 1M 上下文）
+var DefaultAnthropicBetaDeny = []string{"context-1m-2025-08-07"}
+
+// AnthropicBetaPolicy 渠道对客户端 Anthropic-Beta 请求头的处理策略
+// Betas 支持以 * 结尾的前缀匹配，如 context-1m-*；渠道自身必需的 beta 不受影响
+type AnthropicBetaPolicy struct {
+	Mode  string   `json:"mode" binding:"omitempty,oneof=deny allow"`
+	Betas []string `json:"betas"`
+}
+
+// ChannelHeaderPolicy 渠道对客户端请求头的处理策略，在自定义请求头（headers）之前生效：
+//   - StripClientHeaders 移除客户端标识类请求头（User-Agent、X-Stainless-*、X-Forwarded-For 等），
+//     Passthrough 中列出的除外
+//   - Remove 额外移除的客户端请求头
+//   - UserAgent 非空时强制使用该 User-Agent，覆盖内置的客户端模拟
+//
+// 请求头名称不区分大小写，支持以 * 结尾的前缀匹配
+type ChannelHeaderPolicy struct {
+	UserAgent          string   `json:"userAgent"`
+	StripClientHeaders bool     `json:"stripClientHeaders"`
+	Passthrough        []string `json:"passthrough"`
+	Remove             []string `json:"remove"`
+}
+
+// 渠道 DNS 策略的地址族偏好
+const (
+	ChannelIPPreferenceAuto     = "auto"      // 按解析结果顺序，首个地址的地址族优先
+	ChannelIPPreferenceIPv4     = "ipv4"      // 优先 IPv4，失败时回退 IPv6
+	ChannelIPPreferenceIPv6     = "ipv6"      // 优先 IPv6，失败时回退 IPv4
+	ChannelIPPreferenceIPv4Only = "ipv4_only" // 只连接 IPv4
+	ChannelIPPreferenceIPv6Only = "ipv6_only" // 只连接 IPv6
+)
+
+// ChannelDNSPolicy 渠道连接上游时的 DNS 策略，配置后渠道使用独立的拨号器与连接池：
+//   - StaticIPs 固定连接的 IP，设置后不再解析渠道 Base URL 的域名
+//   - Resolver 自定义 DNS 服务器（host:port，未写端口时为 53），为空时使用系统解析
+//   - IPPreference 地址族偏好，为空时按 auto
+//   - FallbackDelayMs 首选地址族连接未完成时开始并行连接另一地址族前的等待（Happy Eyeballs），0 表示 300ms
+//   - CacheTTLSec 解析结果的缓存时间，0 表示不缓存；Go 解析器不返回记录的 TTL，统一按此时间过期
+type ChannelDNSPolicy struct {
+	StaticIPs       []string `json:"staticIps"`
+	Resolver        string   `json:"resolver"`
+	IPPreference    string   `json:"ipPreference" binding:"omitempty,oneof=auto ipv4 ipv6 ipv4_only ipv6_only"`
+	FallbackDelayMs int      `json:"fallbackDelayMs"`
+	CacheTTLSec     int      `json:"cacheTtlSec"`
+}
+
 type ChannelModel struct {
 	Name  string `json:"name"`
 	Alias string `json:"alias,omitempty"`
+	// Weight 该模型在同优先级渠道间轮询的权重，0 表示沿用渠道权重
+	Weight int `json:"weight,omitempty"`
 }
 
 type ChannelRequest struct {
-	Type     ChannelType            `json:"type" binding:"required,oneof=gemini claude openai"`
+	Type     ChannelType            `json:"type" binding:"required,oneof=gemini claude openai claude_oauth ollama"`
 	Endpoint ChannelEndpoint        `json:"endpoint"`
 	Name     string                 `json:"name" binding:"required,min=1,max=64"`
 	BaseURL  string                 `json:"baseUrl" binding:"required,url"`
 	APIKey   string                 `json:"apiKey,omitempty"`
+	// APIKeys 额外密钥，为 nil 时保留原列表，空数组表示清空
+	APIKeys     []string `json:"apiKeys,omitempty"`
+	KeyStrategy string   `json:"keyStrategy" binding:"omitempty,oneof=round_robin lru"`
 	Enabled  bool                   `json:"enabled"`
 	Weight   int                    `json:"weight"`
 	Priority int                    `json:"priority"`
@@ -56,6 +174,18 @@ type ChannelRequest struct {
 	GroupIDs []string               `json:"groupIds"`
 	Models   []ChannelModel         `json:"models,omitempty"`
 	Headers  map[string]string      `json:"headers,omitempty"`
+	// AnthropicBetaPolicy 为空时使用默认策略
+	AnthropicBetaPolicy *AnthropicBetaPolicy `json:"anthropicBetaPolicy,omitempty"`
+	// HeaderPolicy 为空时保留原策略
+	HeaderPolicy *ChannelHeaderPolicy `json:"headerPolicy,omitempty"`
+	// TranslationMode 为空时保留原设置
+	TranslationMode string `json:"translationMode,omitempty" binding:"omitempty,oneof=inherit strict relaxed"`
+	// FederationIssuer 为 nil 时保留原设置，空字符串表示关闭联邦签名
+	FederationIssuer *string `json:"federationIssuer,omitempty" binding:"omitempty,max=64"`
+	// DNSPolicy 为空时保留原策略
+	DNSPolicy *ChannelDNSPolicy `json:"dnsPolicy,omitempty"`
+	// Version 编辑时读取到的版本号，非 0 时用于乐观锁校验
+	Version int `json:"version,omitempty"`
 }
 
 type ChannelResponse struct {
@@ -65,6 +195,17 @@ type ChannelResponse struct {
 	Name        string             `json:"name"`
 	BaseURL     string             `json:"baseUrl"`
 	APIKeySet   bool               `json:"apiKeySet"`
+	// APIKeyMasked 脱敏后的密钥（保留首尾各 4 位），密钥为外部存储引用时为空
+	APIKeyMasked string            `json:"apiKeyMasked,omitempty"`
+	// APIKeyRef 密钥以外部存储引用配置时返回引用本身
+	APIKeyRef   string             `json:"apiKeyRef,omitempty"`
+	// APIKeyCount 密钥池中的密钥数量（含 APIKey）
+	APIKeyCount int    `json:"apiKeyCount"`
+	KeyStrategy string `json:"keyStrategy"`
+	// Keys 密钥池有多个密钥时返回各密钥的使用与冷却状态
+	Keys        []ChannelKeyStatus `json:"keys,omitempty"`
+	// Auth 定时密钥有效性检查的结果，未检查过时为空
+	Auth        *ChannelAuthStatus `json:"auth,omitempty"`
 	Enabled     bool               `json:"enabled"`
 	Weight      int                `json:"weight"`
 	Priority    int                `json:"priority"`
@@ -74,14 +215,51 @@ type ChannelResponse struct {
 	GroupNames  []string           `json:"groupNames"`
 	Models      []ChannelModel     `json:"models"`
 	Headers     map[string]string  `json:"headers"`
+	AnthropicBetaPolicy AnthropicBetaPolicy `json:"anthropicBetaPolicy"`
+	HeaderPolicy        ChannelHeaderPolicy `json:"headerPolicy"`
+	TranslationMode     string              `json:"translationMode"`
+	FederationIssuer    string              `json:"federationIssuer"`
+	DNSPolicy           ChannelDNSPolicy    `json:"dnsPolicy"`
+	Version     int                `json:"version"`
 	CreatedAt   time.Time          `json:"createdAt"`
 	UpdatedAt   time.Time          `json:"updatedAt"`
 }
 
+// TestChannelRequest 测试渠道的可选参数，Model 为空时使用渠道配置或上游返回的第一个模型
+type TestChannelRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt" binding:"max=2000"`
+}
+
 type TestChannelResponse struct {
 	Success   bool   `json:"success"`
 	Message   string `json:"message"`
 	LatencyMs int64  `json:"latencyMs,omitempty"`
+	// Models 上游模型列表接口返回的模型
+	Models []string `json:"models,omitempty"`
+	// Completion 实际发送一次简短对话请求的结果，未执行时为空
+	Completion *ChannelCompletionTest `json:"completion,omitempty"`
+}
+
+// ChannelCompletionTest 渠道对话请求测试结果
+type ChannelCompletionTest struct {
+	Model        string `json:"model"`
+	Success      bool   `json:"success"`
+	StatusCode   int    `json:"statusCode,omitempty"`
+	LatencyMs    int64  `json:"latencyMs"`
+	Content      string `json:"content,omitempty"`
+	InputTokens  int    `json:"inputTokens,omitempty"`
+	OutputTokens int    `json:"outputTokens,omitempty"`
+	Message      string `json:"message,omitempty"`
+	// Translations 其他客户端格式经该渠道转发时的请求与响应翻译检查
+	Translations []ChannelTranslationCheck `json:"translations,omitempty"`
+}
+
+// ChannelTranslationCheck 单个客户端格式的翻译检查结果
+type ChannelTranslationCheck struct {
+	Format  string `json:"format"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
 }
 
 type ChannelModel2 struct {
@@ -90,6 +268,19 @@ type ChannelModel2 struct {
 	ModelID     string    `json:"modelId"`
 	DisplayName string    `json:"displayName"`
 	CreatedAt   time.Time `json:"createdAt"`
+	// LastSeenAt 最近一次在上游模型列表中出现的时间
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+	// RemovedAt 上游不再返回该模型的时间，非空时不再对外展示
+	RemovedAt *time.Time `json:"removedAt,omitempty"`
+}
+
+// AccessibleModel 用户可调用的模型（按分组可访问的启用渠道汇总）
+type AccessibleModel struct {
+	ID          string      `json:"id"`
+	DisplayName string      `json:"displayName,omitempty"`
+	ChannelType ChannelType `json:"channelType"`
+	// Upstream 渠道别名解析后发送给上游的模型名
+	Upstream string `json:"upstream"`
 }
 
 type AvailableModel struct {
@@ -100,3 +291,67 @@ type AvailableModel struct {
 	ModelWhitelist bool        `json:"-"`
 	ModelsJSON     string      `json:"-"`
 }
+
+// ChannelModelsBulkAddRequest 向多个渠道的模型列表追加模型（模型名和别名都相同的条目不会重复添加）
+type ChannelModelsBulkAddRequest struct {
+	ChannelIDs []string       `json:"channelIds" binding:"required,min=1"`
+	Models     []ChannelModel `json:"models" binding:"required,min=1"`
+	DryRun     bool           `json:"dryRun"`
+}
+
+// ChannelModelsBulkRemoveRequest 从多个渠道的模型列表移除模型，按模型名或别名匹配
+type ChannelModelsBulkRemoveRequest struct {
+	ChannelIDs []string `json:"channelIds" binding:"required,min=1"`
+	Models     []string `json:"models" binding:"required,min=1"`
+	DryRun     bool     `json:"dryRun"`
+}
+
+// ChannelModelsCopyRequest 将渠道的模型列表复制到其他同类型渠道
+type ChannelModelsCopyRequest struct {
+	TargetChannelIDs []string `json:"targetChannelIds" binding:"required,min=1"`
+	// Mode replace: 覆盖目标渠道的模型列表（默认）；merge: 合并到目标渠道
+	Mode   string `json:"mode" binding:"omitempty,oneof=replace merge"`
+	DryRun bool   `json:"dryRun"`
+}
+
+// ChannelModelsChange 单个渠道模型列表的变更
+type ChannelModelsChange struct {
+	ChannelID   string         `json:"channelId"`
+	ChannelName string         `json:"channelName"`
+	Before      []ChannelModel `json:"before"`
+	After       []ChannelModel `json:"after"`
+	Added       []string       `json:"added"`
+	Removed     []string       `json:"removed"`
+	Changed     bool           `json:"changed"`
+	Skipped     bool           `json:"skipped,omitempty"`
+	Reason      string         `json:"reason,omitempty"`
+	Warning     string         `json:"warning,omitempty"`
+}
+
+type ChannelModelsBulkResult struct {
+	DryRun   bool                  `json:"dryRun"`
+	Channels []ChannelModelsChange `json:"channels"`
+	// Routing 变更涉及模型在变更后的实际路由情况
+	Routing []ModelRoutingPreview `json:"routing"`
+}
+
+// ModelRoutingPreview 某个模型名会被路由到哪些渠道
+type ModelRoutingPreview struct {
+	Model    string                `json:"model"`
+	Channels []ModelRouteCandidate `json:"channels"`
+}
+
+// ModelRouteCandidate 可承接该模型的渠道；Active 为 true 表示处于最高优先级、实际参与轮询，TrafficShare 按权重计算
+type ModelRouteCandidate struct {
+	ChannelID    string      `json:"channelId"`
+	ChannelName  string      `json:"channelName"`
+	Type         ChannelType `json:"type"`
+	Priority     int         `json:"priority"`
+	GroupIDs     []string    `json:"groupIds"`
+	MatchKind    string      `json:"matchKind"` // name | alias | wildcard | default
+	MatchedEntry string      `json:"matchedEntry,omitempty"`
+	// Weight 该渠道承接此模型的轮询权重（模型条目权重优先，否则为渠道权重）
+	Weight       int         `json:"weight"`
+	Active       bool        `json:"active"`
+	TrafficShare float64     `json:"trafficShare"`
+}
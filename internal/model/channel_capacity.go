@@ -0,0 +1,60 @@
+package model
+
+import "time"
+
+// ChannelCapacityConfig 渠道容量建议与权重自动调整配置
+type ChannelCapacityConfig struct {
+	// WindowMinutes 统计 RPM/TPM 的时间窗口，上游限流信息超过该时间未更新视为过期
+	WindowMinutes int `json:"windowMinutes"`
+	// WarnRatio 用量达到上限的该比例时视为接近上限
+	WarnRatio float64 `json:"warnRatio"`
+	// AutoAdjust 定期按建议自动调整渠道权重
+	AutoAdjust  bool `json:"autoAdjust"`
+	IntervalSec int  `json:"intervalSec"`
+	// MinWeight / MaxWeight 建议权重与自动调整的上下限
+	MinWeight int `json:"minWeight"`
+	MaxWeight int `json:"maxWeight"`
+}
+
+// ChannelRateLimit 上游响应头中最近一次观测到的限流额度（按分钟），Limit 为 0 表示上游未返回
+type ChannelRateLimit struct {
+	RequestsLimit     int64     `json:"requestsLimit,omitempty"`
+	RequestsRemaining int64     `json:"requestsRemaining"`
+	TokensLimit       int64     `json:"tokensLimit,omitempty"`
+	TokensRemaining   int64     `json:"tokensRemaining"`
+	ObservedAt        time.Time `json:"observedAt"`
+}
+
+// ChannelCapacity 单个渠道的用量与容量建议
+type ChannelCapacity struct {
+	ChannelID   string `json:"channelId"`
+	ChannelName string `json:"channelName"`
+	Priority    int    `json:"priority"`
+	Weight      int    `json:"weight"`
+	// RecommendedWeight 建议权重，与 Weight 相同表示无需调整
+	RecommendedWeight int     `json:"recommendedWeight"`
+	Requests          int64   `json:"requests"`
+	Tokens            int64   `json:"tokens"`
+	RPM               float64 `json:"rpm"`
+	TPM               float64 `json:"tpm"`
+	// RateLimit 窗口内观测到的上游限流信息，没有时为空
+	RateLimit *ChannelRateLimit `json:"rateLimit,omitempty"`
+	// RequestUtilization / TokenUtilization 为 0~1 的已用比例，上游未返回对应上限时为空
+	RequestUtilization *float64 `json:"requestUtilization,omitempty"`
+	TokenUtilization   *float64 `json:"tokenUtilization,omitempty"`
+	NearLimit          bool     `json:"nearLimit"`
+	Reason             string   `json:"reason,omitempty"`
+}
+
+// ChannelCapacityReport 渠道容量建议报告
+type ChannelCapacityReport struct {
+	GeneratedAt   time.Time         `json:"generatedAt"`
+	WindowMinutes int               `json:"windowMinutes"`
+	WarnRatio     float64           `json:"warnRatio"`
+	Channels      []ChannelCapacity `json:"channels"`
+	// NearLimitCount 接近上限的渠道数
+	NearLimitCount int `json:"nearLimitCount"`
+	// Applied 为 true 表示本次已按建议调整权重，AdjustedCount 为实际调整的渠道数
+	Applied       bool `json:"applied"`
+	AdjustedCount int  `json:"adjustedCount"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// ChannelHealthConfig 渠道健康检查与熔断配置
+type ChannelHealthConfig struct {
+	Enabled bool `json:"enabled"`
+	// IntervalSec 健康渠道的探测间隔
+	IntervalSec int `json:"intervalSec"`
+	// RecoveryIntervalSec 探测失败或已熔断渠道的重新探测间隔
+	RecoveryIntervalSec int `json:"recoveryIntervalSec"`
+	TimeoutSec          int `json:"timeoutSec"`
+	// FailureThreshold 连续失败达到该次数后熔断，选路时跳过该渠道
+	FailureThreshold int `json:"failureThreshold"`
+}
+
+// ChannelHealthStatus 渠道健康状态
+type ChannelHealthStatus struct {
+	ChannelID   string `json:"channelId"`
+	ChannelName string `json:"channelName,omitempty"`
+	// Healthy 为 false 表示已熔断
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastCheckedAt       *time.Time `json:"lastCheckedAt,omitempty"`
+	LastSuccessAt       *time.Time `json:"lastSuccessAt,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LatencyMs           int64      `json:"latencyMs,omitempty"`
+	UnhealthySince      *time.Time `json:"unhealthySince,omitempty"`
+	NextProbeAt         *time.Time `json:"nextProbeAt,omitempty"`
+}
+
+// 渠道密钥有效性状态
+const (
+	ChannelAuthOK      = "ok"          // 所有密钥认证通过
+	ChannelAuthPartial = "partial"     // 密钥池中部分密钥失效
+	ChannelAuthFailed  = "auth_failed" // 所有密钥均认证失败，选路时跳过
+)
+
+// ChannelKeyCheckConfig 渠道密钥有效性定期检查配置
+type ChannelKeyCheckConfig struct {
+	Enabled bool `json:"enabled"`
+	// IntervalSec 两次检查之间的间隔
+	IntervalSec int `json:"intervalSec"`
+	TimeoutSec  int `json:"timeoutSec"`
+}
+
+// ChannelAuthStatus 渠道密钥有效性检查结果
+type ChannelAuthStatus struct {
+	ChannelID   string `json:"channelId"`
+	ChannelName string `json:"channelName,omitempty"`
+	Status      string `json:"status"`
+	// InvalidKeys 认证失败的密钥指纹
+	InvalidKeys []string   `json:"invalidKeys,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	CheckedAt   *time.Time `json:"checkedAt,omitempty"`
+	// FailedSince 首次发现密钥失效的时间，全部恢复后清空
+	FailedSince *time.Time `json:"failedSince,omitempty"`
+}
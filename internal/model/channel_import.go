@@ -0,0 +1,66 @@
+package model
+
+// ChannelImportSource 渠道导入来源格式
+type ChannelImportSource string
+
+const (
+	ChannelImportSourceCLIProxyAPI ChannelImportSource = "cliproxyapi" // CLIProxyAPI config.yaml
+	ChannelImportSourceOneAPI      ChannelImportSource = "one-api"     // one-api 渠道/令牌/用户 JSON
+	ChannelImportSourceNewAPI      ChannelImportSource = "new-api"     // new-api 渠道/令牌/用户 JSON
+)
+
+// ChannelImportRequest 从其他网关配置导入渠道的请求
+type ChannelImportRequest struct {
+	Source   ChannelImportSource `json:"source" binding:"required,oneof=cliproxyapi one-api new-api"`
+	Content  string              `json:"content" binding:"required"`
+	DryRun   bool                `json:"dryRun"`
+	GroupIDs []string            `json:"groupIds"` // 导入的渠道和用户加入的分组
+}
+
+// ImportedChannel 导入（或预览）的渠道
+type ImportedChannel struct {
+	ID        string            `json:"id,omitempty"` // 实际创建后的渠道 ID
+	Name      string            `json:"name"`
+	Type      ChannelType       `json:"type"`
+	Endpoint  ChannelEndpoint   `json:"endpoint"`
+	BaseURL   string            `json:"baseUrl"`
+	APIKey    string            `json:"apiKey"` // 脱敏后的 Key
+	Enabled   bool              `json:"enabled"`
+	Weight    int               `json:"weight"`
+	Priority  int               `json:"priority"`
+	Models    []ChannelModel    `json:"models"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Skipped   bool              `json:"skipped"`
+	Reason    string            `json:"reason,omitempty"`
+	SourceRef string            `json:"sourceRef"` // 在源配置中的位置，便于对照
+}
+
+// ImportedAPIKey 导入（或预览）的用户 API Key
+type ImportedAPIKey struct {
+	Name    string `json:"name"`
+	Prefix  string `json:"prefix"`
+	Skipped bool   `json:"skipped"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// ImportedUser 导入（或预览）的用户
+type ImportedUser struct {
+	ID       string           `json:"id,omitempty"`
+	Username string           `json:"username"`
+	Password string           `json:"password,omitempty"` // 随机生成的初始密码，仅实际导入时返回
+	APIKeys  []ImportedAPIKey `json:"apiKeys"`
+	Skipped  bool             `json:"skipped"`
+	Reason   string           `json:"reason,omitempty"`
+}
+
+// ChannelImportResult 导入结果；DryRun 时仅为预览，不写入数据库
+type ChannelImportResult struct {
+	Source          ChannelImportSource `json:"source"`
+	DryRun          bool                `json:"dryRun"`
+	Channels        []ImportedChannel   `json:"channels"`
+	Users           []ImportedUser      `json:"users"`
+	Warnings        []string            `json:"warnings"`
+	CreatedChannels int                 `json:"createdChannels"`
+	CreatedUsers    int                 `json:"createdUsers"`
+	CreatedAPIKeys  int                 `json:"createdApiKeys"`
+}
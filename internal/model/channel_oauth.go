@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// ChannelOAuthToken claude_oauth 渠道的 OAuth 令牌。配置 DATA_ENCRYPTION_KEY 时 access / refresh token 加密存储
+type ChannelOAuthToken struct {
+	ChannelID    string     `json:"channelId"`
+	AccessToken  string     `json:"-"`
+	RefreshToken string     `json:"-"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	Scope        string     `json:"scope,omitempty"`
+	// LastRefreshAt 最近一次成功刷新的时间
+	LastRefreshAt *time.Time `json:"lastRefreshAt,omitempty"`
+	// LastError 最近一次刷新失败的原因，成功刷新后清空
+	LastError string    `json:"lastError,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SetChannelOAuthTokenRequest 设置 claude_oauth 渠道的令牌，可直接粘贴 Claude Code 凭据文件中 claudeAiOauth 的字段。
+// 未提供 accessToken 或 expiresAt 时立即用 refreshToken 换取新的访问令牌
+type SetChannelOAuthTokenRequest struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken" binding:"required"`
+	// ExpiresAt 访问令牌过期时间（Unix 毫秒，与 Claude Code 凭据文件一致）
+	ExpiresAt int64    `json:"expiresAt"`
+	Scopes    []string `json:"scopes,omitempty"`
+}
+
+// ChannelOAuthStatus claude_oauth 渠道的令牌状态（不含令牌本身）
+type ChannelOAuthStatus struct {
+	ChannelID     string     `json:"channelId"`
+	Configured    bool       `json:"configured"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	Scope         string     `json:"scope,omitempty"`
+	LastRefreshAt *time.Time `json:"lastRefreshAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
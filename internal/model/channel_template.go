@@ -0,0 +1,85 @@
+package model
+
+import "time"
+
+// 渠道模板中可使用的占位符，创建渠道时替换为实际值；
+// 其他 {{name}} 形式的占位符从请求的 variables 中取值
+const (
+	ChannelTemplatePlaceholderAPIKey  = "{{apiKey}}"
+	ChannelTemplatePlaceholderBaseURL = "{{baseUrl}}"
+)
+
+// ChannelTemplate 渠道模板：保存某类上游的默认配置（模型列表、请求头、分组等），
+// BaseURL 和请求头的值可以包含占位符
+type ChannelTemplate struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	Type           ChannelType       `json:"type"`
+	Endpoint       ChannelEndpoint   `json:"endpoint"`
+	BaseURL        string            `json:"baseUrl"`
+	Weight         int               `json:"weight"`
+	Priority       int               `json:"priority"`
+	ModelWhitelist bool              `json:"modelWhitelist"`
+	SimulateCLI    bool              `json:"simulateCli"`
+	Models         []ChannelModel    `json:"models"`
+	Headers        map[string]string `json:"headers"`
+	GroupIDs       []string          `json:"groupIds"`
+	Builtin        bool              `json:"builtin"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	UpdatedAt      time.Time         `json:"updatedAt"`
+}
+
+type ChannelTemplateRequest struct {
+	Name           string            `json:"name" binding:"required,min=1,max=64"`
+	Description    string            `json:"description" binding:"max=256"`
+	Type           ChannelType       `json:"type" binding:"required,oneof=gemini claude openai claude_oauth ollama"`
+	Endpoint       ChannelEndpoint   `json:"endpoint"`
+	BaseURL        string            `json:"baseUrl"`
+	Weight         int               `json:"weight"`
+	Priority       int               `json:"priority"`
+	ModelWhitelist bool              `json:"modelWhitelist"`
+	SimulateCLI    bool              `json:"simulateCli"`
+	Models         []ChannelModel    `json:"models,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	GroupIDs       []string          `json:"groupIds"`
+}
+
+// SaveChannelTemplateRequest 将现有渠道保存为模板（不保存 API Key）
+type SaveChannelTemplateRequest struct {
+	Name        string `json:"name" binding:"required,min=1,max=64"`
+	Description string `json:"description" binding:"max=256"`
+}
+
+// ChannelDuplicateRequest 复制渠道，未填写的字段沿用源渠道
+type ChannelDuplicateRequest struct {
+	Name    string `json:"name" binding:"max=64"`
+	BaseURL string `json:"baseUrl" binding:"omitempty,url"`
+	APIKey  string `json:"apiKey"`
+	// Enabled 未指定时复制出的渠道默认禁用，避免同一个 Key 被重复调度
+	Enabled *bool `json:"enabled"`
+}
+
+// ChannelBulkCreateRequest 按模板或现有渠道为一组 API Key 批量创建渠道，
+// templateId 与 sourceChannelId 二选一
+type ChannelBulkCreateRequest struct {
+	TemplateID      string            `json:"templateId"`
+	SourceChannelID string            `json:"sourceChannelId"`
+	NamePrefix      string            `json:"namePrefix" binding:"required,min=1,max=56"`
+	BaseURL         string            `json:"baseUrl" binding:"omitempty,url"`
+	APIKeys         []string          `json:"apiKeys" binding:"required,min=1,max=200"`
+	Variables       map[string]string `json:"variables"`
+	// GroupIDs 非空时覆盖模板/源渠道的分组
+	GroupIDs []string `json:"groupIds"`
+	Enabled  bool     `json:"enabled"`
+}
+
+type ChannelBulkCreateSkipped struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+type ChannelBulkCreateResult struct {
+	Channels []*ChannelResponse         `json:"channels"`
+	Skipped  []ChannelBulkCreateSkipped `json:"skipped"`
+}
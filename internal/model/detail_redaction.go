@@ -0,0 +1,24 @@
+package model
+
+// DetailRedactionConfig 请求详情脱敏配置：请求/响应头与体在写入数据库和详情接口返回前屏蔽疑似密钥
+type DetailRedactionConfig struct {
+	Enabled bool `json:"enabled"`
+	// BuiltinPatterns 使用内置的常见密钥格式（sk-、AKIA、ghp_、xox*-、AIza、JWT、Bearer 令牌等）
+	BuiltinPatterns bool `json:"builtinPatterns"`
+	// Patterns 额外的正则规则
+	Patterns []DetailRedactionPattern `json:"patterns"`
+	// EntropyDetection 按信息熵识别未知格式的随机串（需同时包含大小写字母与数字）
+	EntropyDetection bool `json:"entropyDetection"`
+	// MinEntropy 每字符的香农熵阈值（比特），默认 4.0
+	MinEntropy float64 `json:"minEntropy"`
+	// MinTokenLength 参与熵检测的最短长度，默认 24
+	MinTokenLength int `json:"minTokenLength"`
+	// Replacement 替换文本，默认 [REDACTED]
+	Replacement string `json:"replacement"`
+}
+
+// DetailRedactionPattern 自定义脱敏规则
+type DetailRedactionPattern struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// 诊断问题级别
+const (
+	DiagnosticSeverityError   = "error"
+	DiagnosticSeverityWarning = "warning"
+)
+
+// 诊断结果状态
+const (
+	DiagnosticStatusOK      = "ok"
+	DiagnosticStatusWarning = "warning"
+	DiagnosticStatusError   = "error"
+)
+
+// DiagnosticIssue 自检发现的单个问题
+type DiagnosticIssue struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Subject  string `json:"subject"`
+	Message  string `json:"message"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// DiagnosticCheck 单项检查的执行结果
+type DiagnosticCheck struct {
+	Name       string `json:"name"`
+	Title      string `json:"title"`
+	Status     string `json:"status"`
+	IssueCount int    `json:"issueCount"`
+	DurationMs int64  `json:"durationMs"`
+	// Error 检查本身执行失败（如数据库查询出错）时的原因
+	Error string `json:"error,omitempty"`
+}
+
+// DiagnosticReport 配置自检报告
+type DiagnosticReport struct {
+	Trigger    string            `json:"trigger"` // startup | manual
+	Status     string            `json:"status"`
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt time.Time         `json:"finishedAt"`
+	DurationMs int64             `json:"durationMs"`
+	Checks     []DiagnosticCheck `json:"checks"`
+	Issues     []DiagnosticIssue `json:"issues"`
+}
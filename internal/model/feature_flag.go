@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// 内置功能开关
+const (
+	FeatureLocalWebSearch = "local_web_search" // 本地/内置免费网页搜索
+	FeatureBalanceBanner  = "balance_banner"   // 在 Amp 广告位展示余额
+)
+
+// FeatureFlag 功能开关：总开关 + 目标分组 + 灰度百分比
+type FeatureFlag struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	// GroupIDs 为空时对所有用户生效，否则仅对这些分组的成员生效
+	GroupIDs []string `json:"groupIds"`
+	// RolloutPercent 命中分组的用户中按用户 ID 哈希放量的比例（0-100）
+	RolloutPercent int       `json:"rolloutPercent"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type FeatureFlagRequest struct {
+	Description    string   `json:"description" binding:"max=256"`
+	Enabled        bool     `json:"enabled"`
+	GroupIDs       []string `json:"groupIds"`
+	RolloutPercent *int     `json:"rolloutPercent" binding:"omitempty,min=0,max=100"`
+}
+
+type FeatureFlagResponse struct {
+	Key            string   `json:"key"`
+	Description    string   `json:"description"`
+	Enabled        bool     `json:"enabled"`
+	GroupIDs       []string `json:"groupIds"`
+	GroupNames     []string `json:"groupNames"`
+	RolloutPercent int      `json:"rolloutPercent"`
+	// Builtin 代码中内置的开关；Configured 为 false 时使用内置默认值
+	Builtin    bool       `json:"builtin"`
+	Configured bool       `json:"configured"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
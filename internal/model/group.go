@@ -3,27 +3,97 @@ package model
 import "time"
 
 type Group struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description"`
-	RateMultiplier float64   `json:"rateMultiplier"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	RateMultiplier float64 `json:"rateMultiplier"`
+	// MaxRequestCostMicros 单次请求预估最高费用上限（微美元），0 表示不限制
+	MaxRequestCostMicros int64 `json:"maxRequestCostMicros"`
+	// MonthlyBudgetMicros 分组每个自然月（UTC）的费用预算（微美元），0 表示不设预算；只用于告警，不限制请求
+	MonthlyBudgetMicros int64 `json:"monthlyBudgetMicros"`
+	// SystemPrompt 分组强制系统提示词（如合规声明），转发模型请求时加在最前面，用户无法关闭；为空表示不启用
+	SystemPrompt string `json:"systemPrompt"`
+	// PipelineJSON 请求流水线配置，为空表示不启用
+	PipelineJSON string    `json:"-"`
+	Version      int       `json:"version"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
 }
 
 type GroupRequest struct {
 	Name           string  `json:"name" binding:"required,min=1,max=64"`
 	Description    string  `json:"description" binding:"max=256"`
 	RateMultiplier float64 `json:"rateMultiplier"`
+	// MaxRequestCostMicros 未携带时保留原值
+	MaxRequestCostMicros *int64 `json:"maxRequestCostMicros,omitempty" binding:"omitempty,min=0"`
+	// MonthlyBudgetMicros 未携带时保留原值
+	MonthlyBudgetMicros *int64 `json:"monthlyBudgetMicros,omitempty" binding:"omitempty,min=0"`
+	// SystemPrompt 未携带时保留原值，空字符串表示关闭
+	SystemPrompt *string `json:"systemPrompt,omitempty" binding:"omitempty,max=20000"`
+	// Pipeline 未携带时保留原配置，前后置步骤均为空时关闭
+	Pipeline *RequestPipeline `json:"pipeline,omitempty"`
+	// Version 编辑时读取到的版本号，非 0 时用于乐观锁校验
+	Version int `json:"version,omitempty"`
 }
 
 type GroupResponse struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description"`
-	RateMultiplier float64   `json:"rateMultiplier"`
-	UserCount      int       `json:"userCount"`
-	ChannelCount   int       `json:"channelCount"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
+	ID                   string          `json:"id"`
+	Name                 string          `json:"name"`
+	Description          string          `json:"description"`
+	RateMultiplier       float64         `json:"rateMultiplier"`
+	MaxRequestCostMicros int64           `json:"maxRequestCostMicros"`
+	MonthlyBudgetMicros  int64           `json:"monthlyBudgetMicros"`
+	SystemPrompt         string          `json:"systemPrompt"`
+	Pipeline             RequestPipeline `json:"pipeline"`
+	UserCount            int             `json:"userCount"`
+	ChannelCount         int             `json:"channelCount"`
+	Version              int             `json:"version"`
+	CreatedAt            time.Time       `json:"createdAt"`
+	UpdatedAt            time.Time       `json:"updatedAt"`
+}
+
+// GroupAdmin 分组管理员：可管理分组内用户及其 API Key 与模型映射，不能管理渠道与全局配置
+type GroupAdmin struct {
+	GroupID   string    `json:"groupId"`
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type AddGroupAdminRequest struct {
+	UserID string `json:"userId" binding:"required"`
+}
+
+// 请求流水线步骤类型
+const (
+	// PipelineStepRoute 前置：由低成本模型对请求分类，从候选模型中选出本次实际使用的模型
+	PipelineStepRoute = "route"
+	// PipelineStepTriage 前置：安全分诊，模型判定为 BLOCK 时拒绝请求
+	PipelineStepTriage = "triage"
+	// PipelineStepSummarize 后置：为非流式回答生成摘要并追加到回答末尾
+	PipelineStepSummarize = "summarize"
+)
+
+// PipelineStep 流水线中的一次模型调用，通过现有渠道转发，单独记录请求日志并计费
+type PipelineStep struct {
+	Type  string `json:"type"`
+	Model string `json:"model"`
+	// Prompt 覆盖该步骤的默认指令
+	Prompt string `json:"prompt,omitempty"`
+	// Candidates route 步骤可选择的模型
+	Candidates []string `json:"candidates,omitempty"`
+	// MaxTokens 步骤输出上限，0 使用默认值
+	MaxTokens int `json:"maxTokens,omitempty"`
+}
+
+// RequestPipeline 分组的请求流水线：前置步骤在转发前依次执行，后置步骤在收到完整回答后执行
+type RequestPipeline struct {
+	Pre  []PipelineStep `json:"pre"`
+	Post []PipelineStep `json:"post"`
+}
+
+// IsEmpty 是否没有配置任何步骤
+func (p RequestPipeline) IsEmpty() bool {
+	return len(p.Pre) == 0 && len(p.Post) == 0
 }
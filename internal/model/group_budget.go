@@ -0,0 +1,69 @@
+package model
+
+import "time"
+
+// GroupBudgetAlertConfig 分组月度预算告警配置
+type GroupBudgetAlertConfig struct {
+	// Enabled 是否定期检查各分组的本月费用
+	Enabled     bool `json:"enabled"`
+	IntervalSec int  `json:"intervalSec"`
+	// ForecastMinDays 本月已过天数不少于该值时才按预测费用告警，避免月初样本太少导致误报
+	ForecastMinDays int `json:"forecastMinDays"`
+}
+
+// 分组预算告警类型
+const (
+	// GroupBudgetAlertThreshold 本月实际费用越过预算的 50% / 80% / 100%
+	GroupBudgetAlertThreshold = "threshold"
+	// GroupBudgetAlertForecast 按本月消耗速度预测月末费用将超出预算
+	GroupBudgetAlertForecast = "forecast"
+)
+
+// GroupBudgetAlert 一条分组预算告警记录，每个分组每月每种告警只触发一次
+type GroupBudgetAlert struct {
+	ID        string `json:"id"`
+	GroupID   string `json:"groupId"`
+	GroupName string `json:"groupName"`
+	// Month 告警所属的自然月（UTC），格式 2006-01
+	Month string `json:"month"`
+	Kind  string `json:"kind"`
+	// ThresholdPercent 越过的阈值百分比，forecast 告警固定为 100
+	ThresholdPercent int   `json:"thresholdPercent"`
+	BudgetMicros     int64 `json:"budgetMicros"`
+	SpendMicros      int64 `json:"spendMicros"`
+	// ForecastMicros 触发时预测的月末费用
+	ForecastMicros int64     `json:"forecastMicros"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type GroupBudgetAlertFilter struct {
+	GroupID  string
+	Month    string
+	Kind     string
+	Page     int
+	PageSize int
+}
+
+type GroupBudgetAlertListResponse struct {
+	Items    []*GroupBudgetAlert `json:"items"`
+	Total    int64               `json:"total"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"pageSize"`
+}
+
+// GroupBudgetStatus 分组本月的预算使用情况
+type GroupBudgetStatus struct {
+	GroupID      string `json:"groupId"`
+	GroupName    string `json:"groupName"`
+	Month        string `json:"month"`
+	BudgetMicros int64  `json:"budgetMicros"`
+	// SpendMicros 本月至今分组内用户的请求费用合计（用户属于多个分组时计入每个分组）
+	SpendMicros int64 `json:"spendMicros"`
+	// ForecastMicros 按本月至今的平均消耗速度线性外推的月末费用
+	ForecastMicros int64 `json:"forecastMicros"`
+	// UsedPercent 实际费用占预算的百分比，未设预算时为 0
+	UsedPercent     float64 `json:"usedPercent"`
+	ForecastPercent float64 `json:"forecastPercent"`
+	// Alerts 本月已触发的告警
+	Alerts []*GroupBudgetAlert `json:"alerts"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// LogFilterDefinition 日志过滤条件定义（与日志列表查询参数一一对应）
+type LogFilterDefinition struct {
+	UserID      string     `json:"userId,omitempty"` // 仅管理员视图生效
+	APIKeyID    string     `json:"apiKeyId,omitempty"`
+	Model       string     `json:"model,omitempty"`
+	StatusCode  *int       `json:"statusCode,omitempty"`
+	Status      string     `json:"status,omitempty"` // pending | success | error
+	IsStreaming *bool      `json:"isStreaming,omitempty"`
+	MinCost     *int64     `json:"minCostMicros,omitempty"`
+	From        *time.Time `json:"from,omitempty"`
+	To          *time.Time `json:"to,omitempty"`
+	// LastDuration 相对时间窗口（如 "1h"、"24h"），设置后覆盖 From/To
+	LastDuration string `json:"lastDuration,omitempty"`
+}
+
+// SavedLogView 用户保存的日志筛选视图
+type SavedLogView struct {
+	ID        string              `json:"id"`
+	UserID    string              `json:"userId"`
+	Name      string              `json:"name"`
+	Filters   LogFilterDefinition `json:"filters"`
+	Pinned    bool                `json:"pinned"`
+	CreatedAt time.Time           `json:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+}
+
+type SavedLogViewRequest struct {
+	Name    string              `json:"name" binding:"required,min=1,max=64"`
+	Filters LogFilterDefinition `json:"filters"`
+	Pinned  bool                `json:"pinned"`
+}
+
+type SetPinnedRequest struct {
+	Pinned bool `json:"pinned"`
+}
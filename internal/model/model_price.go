@@ -0,0 +1,52 @@
+package model
+
+// TokenPrice 每 token 单价（USD），与价格表字段一致
+type TokenPrice struct {
+	InputCostPerToken      float64 `json:"inputCostPerToken"`
+	OutputCostPerToken     float64 `json:"outputCostPerToken"`
+	CacheReadInputPerToken float64 `json:"cacheReadInputPerToken"`
+	CacheCreationPerToken  float64 `json:"cacheCreationPerToken"`
+}
+
+// UserModelPrice 用户可调用模型的价格：实际支付单价 = 价格表单价 × 分组倍率
+type UserModelPrice struct {
+	Model       string      `json:"model"`
+	ChannelType ChannelType `json:"channelType"`
+	// PricingModel 计费使用的模型名；经用户模型映射时为映射目标
+	PricingModel string `json:"pricingModel"`
+	// PriceFound 价格表中没有该模型时为 false，此类调用不计费
+	PriceFound     bool        `json:"priceFound"`
+	BasePrice      *TokenPrice `json:"basePrice,omitempty"`
+	EffectivePrice *TokenPrice `json:"effectivePrice,omitempty"`
+}
+
+// UserModelPriceList 当前用户的模型价格列表
+type UserModelPriceList struct {
+	// RateMultiplier 用户所在分组中最低的费率倍率，未加入分组时为 1
+	RateMultiplier float64          `json:"rateMultiplier"`
+	Models         []UserModelPrice `json:"models"`
+}
+
+// ModelQuoteRequest 按预计 token 数估算费用
+type ModelQuoteRequest struct {
+	Model               string `json:"model" binding:"required"`
+	InputTokens         int    `json:"inputTokens" binding:"min=0"`
+	OutputTokens        int    `json:"outputTokens" binding:"min=0"`
+	CacheReadTokens     int    `json:"cacheReadTokens" binding:"min=0"`
+	CacheCreationTokens int    `json:"cacheCreationTokens" binding:"min=0"`
+	// Batch 按批处理接口单价估算
+	Batch bool `json:"batch"`
+}
+
+// ModelQuote 估算结果
+type ModelQuote struct {
+	Model          string  `json:"model"`
+	PricingModel   string  `json:"pricingModel"`
+	PriceFound     bool    `json:"priceFound"`
+	RateMultiplier float64 `json:"rateMultiplier"`
+	// BaseCostMicros 按价格表单价计算的费用
+	BaseCostMicros int64 `json:"baseCostMicros"`
+	// CostMicros 乘以分组倍率后实际扣除的费用
+	CostMicros int64  `json:"costMicros"`
+	CostUsd    string `json:"costUsd"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// ModelSyncConfig 上游模型自动同步配置
+type ModelSyncConfig struct {
+	// Enabled 定期查询各启用渠道的上游模型列表并同步到 channel_models
+	Enabled         bool `json:"enabled"`
+	IntervalMinutes int  `json:"intervalMinutes"`
+	// AppendToModels 将新发现的模型追加到渠道模型列表（models_json）；
+	// 列表为空（按类型默认匹配）或已被通配符覆盖的渠道不追加
+	AppendToModels bool `json:"appendToModels"`
+}
+
+// ModelSyncChannelResult 单个渠道的同步结果
+type ModelSyncChannelResult struct {
+	ChannelID   string `json:"channelId"`
+	ChannelName string `json:"channelName"`
+	// Total 上游当前提供的模型数
+	Total int `json:"total"`
+	// Added 新发现的模型；Removed 上游不再返回、已标记移除的模型；Restored 标记移除后重新出现的模型
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Restored []string `json:"restored"`
+	// AppendedToModels 追加到渠道模型列表的模型
+	AppendedToModels []string `json:"appendedToModels,omitempty"`
+	Error            string   `json:"error,omitempty"`
+}
+
+// ModelSyncReport 一次同步的汇总
+type ModelSyncReport struct {
+	Trigger      string                   `json:"trigger"`
+	StartedAt    time.Time                `json:"startedAt"`
+	FinishedAt   time.Time                `json:"finishedAt"`
+	AddedCount   int                      `json:"addedCount"`
+	RemovedCount int                      `json:"removedCount"`
+	FailedCount  int                      `json:"failedCount"`
+	Channels     []ModelSyncChannelResult `json:"channels"`
+}
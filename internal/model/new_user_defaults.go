@@ -0,0 +1,53 @@
+package model
+
+// NewUserAssignmentRule 新用户自动分配规则，用户名正则与邮箱域名同时设置时需都匹配
+type NewUserAssignmentRule struct {
+	Name string `json:"name"`
+	// UsernamePattern 用户名正则（如 `^dev-`），为空表示不限制
+	UsernamePattern string `json:"usernamePattern,omitempty"`
+	// EmailDomain 邮箱域名（如 example.com，不区分大小写），只匹配已验证的邮箱
+	EmailDomain string   `json:"emailDomain,omitempty"`
+	GroupIDs    []string `json:"groupIds"`
+	// PlanID 匹配时分配的订阅套餐，多条规则匹配时使用第一条设置了套餐的规则
+	PlanID string `json:"planId,omitempty"`
+}
+
+// NewUserAmpDefaults 新用户的默认 Amp 设置，创建用户时写入，之后由用户自行修改
+type NewUserAmpDefaults struct {
+	UpstreamURL   string `json:"upstreamUrl"`
+	Enabled       bool   `json:"enabled"`
+	WebSearchMode string `json:"webSearchMode,omitempty"`
+	// SettingsTemplateIDs 依次应用的设置模板，跟随模板最新版本
+	SettingsTemplateIDs []string `json:"settingsTemplateIds,omitempty"`
+}
+
+// NewUserDefaultsConfig 新用户默认配置：注册、SSO 自动开通与批量导入创建用户后自动分配分组、套餐与 Amp 设置
+type NewUserDefaultsConfig struct {
+	Enabled bool                    `json:"enabled"`
+	Rules   []NewUserAssignmentRule `json:"rules"`
+	// DefaultGroupIDs 没有规则匹配时加入的分组
+	DefaultGroupIDs []string `json:"defaultGroupIds"`
+	// DefaultPlanID 匹配的规则均未设置套餐时分配的订阅套餐，为空表示不分配
+	DefaultPlanID string `json:"defaultPlanId,omitempty"`
+	// PlanDurationDays 自动分配的套餐有效天数，0 表示不过期
+	PlanDurationDays int `json:"planDurationDays"`
+	// AmpSettings 为空表示不创建默认 Amp 设置
+	AmpSettings *NewUserAmpDefaults `json:"ampSettings,omitempty"`
+}
+
+// NewUserDefaultsPreviewRequest 按用户名与邮箱预览将要应用的默认配置
+type NewUserDefaultsPreviewRequest struct {
+	Username      string `json:"username" binding:"required"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+}
+
+// NewUserDefaultsResult 对新用户应用（或预览）默认配置的结果
+type NewUserDefaultsResult struct {
+	MatchedRules []string `json:"matchedRules"`
+	GroupIDs     []string `json:"groupIds"`
+	PlanID       string   `json:"planId,omitempty"`
+	AmpSettings  bool     `json:"ampSettings"`
+	// SettingsTemplateIDs 应用的设置模板
+	SettingsTemplateIDs []string `json:"settingsTemplateIds,omitempty"`
+}
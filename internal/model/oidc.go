@@ -0,0 +1,65 @@
+package model
+
+import "time"
+
+// OIDCConfig 管理后台 OIDC 单点登录配置。开启后登录页提供 SSO 登录，首次登录的用户按声明自动创建账户，
+// 并按 IdP 分组映射到本地分组与管理员权限
+type OIDCConfig struct {
+	Enabled bool `json:"enabled"`
+	// DisplayName 登录页按钮显示的名称
+	DisplayName string `json:"displayName"`
+	// Issuer IdP 签发方地址，从 {issuer}/.well-known/openid-configuration 发现各端点
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"clientId"`
+	// ClientSecret 支持密钥引用，查询时不返回明文
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// ClientSecretSet 是否已配置客户端密钥（仅查询时返回）
+	ClientSecretSet bool `json:"clientSecretSet"`
+	// RedirectURL 在 IdP 注册的回调地址，需指向 /api/manage/auth/oidc/callback
+	RedirectURL string `json:"redirectUrl"`
+	// Scopes 默认 openid profile email
+	Scopes []string `json:"scopes"`
+	// UsernameClaim 新建账户使用的用户名声明，默认 preferred_username，缺失时使用 email
+	UsernameClaim string `json:"usernameClaim"`
+	// GroupsClaim IdP 分组所在的声明，默认 groups
+	GroupsClaim string `json:"groupsClaim"`
+	// AutoProvision 首次登录时自动创建账户；关闭时只有已绑定的账户可以登录
+	AutoProvision bool `json:"autoProvision"`
+	// AllowedGroups 非空时只允许属于其中任一 IdP 分组的用户登录
+	AllowedGroups []string `json:"allowedGroups"`
+	// GroupMappings IdP 分组到本地分组的映射，非空时每次登录按映射结果覆盖用户的分组
+	GroupMappings []OIDCGroupMapping `json:"groupMappings"`
+	// AdminGroups 非空时每次登录按是否属于其中任一 IdP 分组设置管理员权限
+	AdminGroups []string `json:"adminGroups"`
+	// DisablePasswordLogin 关闭本地密码登录与注册，只保留初始管理员账户的密码登录用于应急
+	DisablePasswordLogin bool `json:"disablePasswordLogin"`
+}
+
+// OIDCGroupMapping IdP 分组到本地分组的映射
+type OIDCGroupMapping struct {
+	Claim   string `json:"claim"`
+	GroupID string `json:"groupId"`
+}
+
+// OIDCLoginOptions 登录页展示的登录方式（公开接口）
+type OIDCLoginOptions struct {
+	Enabled              bool   `json:"enabled"`
+	DisplayName          string `json:"displayName,omitempty"`
+	PasswordLoginEnabled bool   `json:"passwordLoginEnabled"`
+}
+
+// OIDCExchangeRequest 用回调页携带的一次性票据换取登录 Token
+type OIDCExchangeRequest struct {
+	Ticket string `json:"ticket" binding:"required"`
+}
+
+// UserIdentity 用户绑定的外部身份（OIDC 签发方 + subject）
+type UserIdentity struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"userId"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
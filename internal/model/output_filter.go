@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// 输出过滤规则命中后的处理方式
+const (
+	OutputFilterActionMask  = "mask"
+	OutputFilterActionBlock = "block"
+)
+
+// OutputFilterConfig 响应内容过滤配置：扫描渠道返回的文本（含流式输出），
+// 命中规则时屏蔽匹配内容或终止响应
+type OutputFilterConfig struct {
+	Enabled bool               `json:"enabled"`
+	Rules   []OutputFilterRule `json:"rules"`
+	// MaskPromptSecrets 请求中出现的疑似密钥（sk-、AKIA、ghp_ 等格式）若在输出中原样出现则屏蔽
+	MaskPromptSecrets bool `json:"maskPromptSecrets"`
+	// HoldbackChars 流式输出暂缓下发的字符数，用于匹配跨多个分片的内容
+	HoldbackChars int `json:"holdbackChars"`
+}
+
+// OutputFilterRule 输出过滤规则
+type OutputFilterRule struct {
+	Name string `json:"name"`
+	// Pattern 匹配内容，Regex 为 false 时按字面量匹配（不区分大小写）
+	Pattern string `json:"pattern"`
+	Regex   bool   `json:"regex"`
+	// Action mask 替换匹配内容，block 终止响应
+	Action string `json:"action"`
+	// Replacement 屏蔽时的替换文本，默认 [REDACTED]
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// OutputFilterIncident 输出过滤命中记录
+type OutputFilterIncident struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	UserID    string    `json:"userId"`
+	Rule      string    `json:"rule"`
+	Action    string    `json:"action"`
+	Format    string    `json:"format"`
+	Streaming bool      `json:"streaming"`
+}
@@ -0,0 +1,62 @@
+package model
+
+import "time"
+
+// PasswordPolicyConfig 密码策略：注册、修改、重置与找回密码时校验新密码，
+// BcryptCost 用于新生成的密码哈希，MaxAgeDays 大于 0 时超过该天数未修改密码的用户需先修改密码
+type PasswordPolicyConfig struct {
+	MinLength        int  `json:"minLength"`
+	RequireUppercase bool `json:"requireUppercase"`
+	RequireLowercase bool `json:"requireLowercase"`
+	RequireDigit     bool `json:"requireDigit"`
+	RequireSymbol    bool `json:"requireSymbol"`
+	// DisallowUsername 密码不得包含用户名（忽略大小写）
+	DisallowUsername bool `json:"disallowUsername"`
+	// BreachCheck 拒绝内置常见弱密码及 PASSWORD_BREACH_LIST 文件中的泄露密码
+	BreachCheck bool `json:"breachCheck"`
+	BcryptCost  int  `json:"bcryptCost"`
+	MaxAgeDays  int  `json:"maxAgeDays"`
+}
+
+// PasswordPolicyStatus 密码策略及泄露密码库加载情况
+type PasswordPolicyStatus struct {
+	Config PasswordPolicyConfig `json:"config"`
+	// BreachListEntries 已加载的泄露密码条数（含内置弱密码）
+	BreachListEntries int    `json:"breachListEntries"`
+	BreachListFile    string `json:"breachListFile,omitempty"`
+}
+
+// ForcePasswordChangeRequest 设置或取消“下次登录后必须修改密码”
+type ForcePasswordChangeRequest struct {
+	Required bool `json:"required"`
+}
+
+// StalePasswordEntry 长期未修改密码或被要求修改密码的账户
+type StalePasswordEntry struct {
+	UserID            string    `json:"userId"`
+	Username          string    `json:"username"`
+	IsAdmin           bool      `json:"isAdmin"`
+	PasswordChangedAt time.Time `json:"passwordChangedAt"`
+	AgeDays           int       `json:"ageDays"`
+	MustChange        bool      `json:"mustChange"`
+}
+
+// UnusedAPIKeyEntry 创建后从未使用过的有效 API Key
+type UnusedAPIKeyEntry struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"createdAt"`
+	AgeDays   int       `json:"ageDays"`
+}
+
+// CredentialHygieneReport 凭据卫生报告
+type CredentialHygieneReport struct {
+	PasswordAgeDays int                  `json:"passwordAgeDays"`
+	KeyAgeDays      int                  `json:"keyAgeDays"`
+	GeneratedAt     time.Time            `json:"generatedAt"`
+	StalePasswords  []StalePasswordEntry `json:"stalePasswords"`
+	UnusedAPIKeys   []UnusedAPIKeyEntry  `json:"unusedApiKeys"`
+}
@@ -0,0 +1,19 @@
+package model
+
+// PIIRedactionConfig 转发前脱敏配置：用户消息中的邮箱、电话号码、银行卡号与自定义正则匹配的内容
+// 在发往上游前替换为占位符（如 [EMAIL_1]），同一请求中相同的值使用同一占位符
+type PIIRedactionConfig struct {
+	Enabled    bool `json:"enabled"`
+	Email      bool `json:"email"`
+	Phone      bool `json:"phone"`
+	CreditCard bool `json:"creditCard"`
+	// Patterns 额外的正则规则，占位符取规则名的大写形式（如 employee-id → [EMPLOYEE_ID_1]）
+	Patterns []DetailRedactionPattern `json:"patterns"`
+}
+
+// PIIRedactionItem 请求脱敏报告中的一项：只记录类型、占位符与出现次数，不记录原始内容
+type PIIRedactionItem struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// 限流规则的作用范围
+const (
+	RateLimitScopeUser   = "user"
+	RateLimitScopeAPIKey = "api_key"
+	// RateLimitScopeGroup 分组内所有成员共享同一额度
+	RateLimitScopeGroup = "group"
+)
+
+// RateLimit 模型调用的令牌桶限流规则，按分钟补充额度，0 表示该项不限制
+type RateLimit struct {
+	Scope             string `json:"scope"`
+	TargetID          string `json:"targetId"`
+	RequestsPerMinute int    `json:"requestsPerMinute"`
+	// TokensPerMinute 按响应实际用量（输入 + 输出 + 缓存写入）扣减
+	TokensPerMinute int64 `json:"tokensPerMinute"`
+	// MaxConcurrent 同时进行中的模型调用上限（含流式响应），分组规则按成员分别计算
+	MaxConcurrent int       `json:"maxConcurrent"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type RateLimitRequest struct {
+	RequestsPerMinute int   `json:"requestsPerMinute" binding:"min=0,max=1000000"`
+	TokensPerMinute   int64 `json:"tokensPerMinute" binding:"min=0"`
+	MaxConcurrent     int   `json:"maxConcurrent" binding:"min=0,max=10000"`
+}
+
+// 超出并发上限时新模型调用的处理方式
+const (
+	ConcurrencyModeReject = "reject" // 立即返回 429
+	ConcurrencyModeQueue  = "queue"  // 排队等待空位，超时后返回 429
+)
+
+// ConcurrencyLimitConfig 并发上限的全局处理策略，上限本身在限流规则中按用户、API Key、分组配置
+type ConcurrencyLimitConfig struct {
+	Mode string `json:"mode"`
+	// QueueTimeoutSec queue 模式下单个请求最长等待时间
+	QueueTimeoutSec int `json:"queueTimeoutSec"`
+}
+
+// ConcurrencyUsage 某条并发上限当前占用情况；分组规则的 UserID 为占用的成员
+type ConcurrencyUsage struct {
+	Scope    string `json:"scope"`
+	TargetID string `json:"targetId"`
+	UserID   string `json:"userId,omitempty"`
+	InFlight int    `json:"inFlight"`
+	Limit    int    `json:"limit"`
+	Queued   int    `json:"queued"`
+}
+
+// ConcurrencyLimitStatus 并发上限配置及当前占用
+type ConcurrencyLimitStatus struct {
+	ConcurrencyLimitConfig
+	Usage []ConcurrencyUsage `json:"usage"`
+}
@@ -0,0 +1,60 @@
+package model
+
+import "time"
+
+// ScheduledChangeKind 定时变更类型
+type ScheduledChangeKind string
+
+const (
+	// ScheduledChangeModelMappings 替换用户的模型映射，TargetID 为用户 ID
+	ScheduledChangeModelMappings ScheduledChangeKind = "model_mappings"
+	// ScheduledChangeChannelEnabled 启用或禁用渠道，TargetID 为渠道 ID
+	ScheduledChangeChannelEnabled ScheduledChangeKind = "channel_enabled"
+)
+
+// ScheduledChangeStatus 定时变更状态
+type ScheduledChangeStatus string
+
+const (
+	ScheduledChangePending   ScheduledChangeStatus = "pending"   // 等待生效
+	ScheduledChangeApplied   ScheduledChangeStatus = "applied"   // 已生效，设置了恢复时间时等待恢复
+	ScheduledChangeReverted  ScheduledChangeStatus = "reverted"  // 已恢复为生效前的值
+	ScheduledChangeCancelled ScheduledChangeStatus = "cancelled" // 生效前被取消
+	ScheduledChangeFailed    ScheduledChangeStatus = "failed"    // 生效或恢复失败，原因见 Error
+)
+
+// ScheduledChangePayload 变更内容，按类型使用对应字段；生效时按同样结构保存变更前的值用于恢复
+type ScheduledChangePayload struct {
+	ModelMappings []ModelMapping `json:"modelMappings,omitempty"`
+	Enabled       *bool          `json:"enabled,omitempty"`
+}
+
+// ScheduledChange 在指定时间生效、可在窗口结束后自动恢复的配置变更
+type ScheduledChange struct {
+	ID       string                 `json:"id"`
+	Kind     ScheduledChangeKind    `json:"kind"`
+	TargetID string                 `json:"targetId"`
+	Payload  ScheduledChangePayload `json:"payload"`
+	// Previous 生效前的值，生效后才有
+	Previous   *ScheduledChangePayload `json:"previous,omitempty"`
+	Note       string                  `json:"note"`
+	ApplyAt    time.Time               `json:"applyAt"`
+	RevertAt   *time.Time              `json:"revertAt,omitempty"`
+	Status     ScheduledChangeStatus   `json:"status"`
+	AppliedAt  *time.Time              `json:"appliedAt,omitempty"`
+	RevertedAt *time.Time              `json:"revertedAt,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+	CreatedBy  string                  `json:"createdBy"`
+	CreatedAt  time.Time               `json:"createdAt"`
+	UpdatedAt  time.Time               `json:"updatedAt"`
+}
+
+// ScheduledChangeRequest 创建定时变更；RevertAt 为空表示生效后不自动恢复
+type ScheduledChangeRequest struct {
+	Kind     ScheduledChangeKind    `json:"kind" binding:"required,oneof=model_mappings channel_enabled"`
+	TargetID string                 `json:"targetId" binding:"required"`
+	Payload  ScheduledChangePayload `json:"payload"`
+	Note     string                 `json:"note" binding:"max=256"`
+	ApplyAt  time.Time              `json:"applyAt" binding:"required"`
+	RevertAt *time.Time             `json:"revertAt"`
+}
@@ -0,0 +1,84 @@
+package model
+
+import "time"
+
+// SettingsTemplateKind 设置模板类型
+type SettingsTemplateKind string
+
+const (
+	// SettingsTemplateSystemPrompt 系统提示词，应用后替换用户设置中的系统提示词
+	SettingsTemplateSystemPrompt SettingsTemplateKind = "system_prompt"
+	// SettingsTemplateModelMappings 模型映射集，应用后合并到用户的模型映射
+	SettingsTemplateModelMappings SettingsTemplateKind = "model_mappings"
+	// SettingsTemplateThinkingPreset 思维等级预设，按模型名设置思维等级，应用后合并到用户的模型映射
+	SettingsTemplateThinkingPreset SettingsTemplateKind = "thinking_preset"
+)
+
+// SettingsTemplateContent 模板内容，按模板类型使用对应字段
+type SettingsTemplateContent struct {
+	SystemPrompt  string         `json:"systemPrompt,omitempty"`
+	ModelMappings []ModelMapping `json:"modelMappings,omitempty"`
+}
+
+// SettingsTemplate 管理员维护的设置模板，用户可一键应用到自己的设置。
+// 每次修改内容生成新版本，跟随最新版本的用户自动更新，锁定版本的用户保持不变
+type SettingsTemplate struct {
+	ID          string                  `json:"id"`
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Kind        SettingsTemplateKind    `json:"kind"`
+	Version     int                     `json:"version"`
+	Content     SettingsTemplateContent `json:"content"`
+	// AppliedUsers 应用了该模板的用户数
+	AppliedUsers int       `json:"appliedUsers"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+type SettingsTemplateRequest struct {
+	Name        string                  `json:"name" binding:"required,min=1,max=64"`
+	Description string                  `json:"description" binding:"max=256"`
+	Kind        SettingsTemplateKind    `json:"kind" binding:"required,oneof=system_prompt model_mappings thinking_preset"`
+	Content     SettingsTemplateContent `json:"content"`
+}
+
+// SettingsTemplateVersion 模板的历史版本
+type SettingsTemplateVersion struct {
+	Version   int                     `json:"version"`
+	Content   SettingsTemplateContent `json:"content"`
+	CreatedAt time.Time               `json:"createdAt"`
+}
+
+// UserSettingsTemplate 用户应用的模板及版本
+type UserSettingsTemplate struct {
+	UserID     string `json:"userId"`
+	TemplateID string `json:"templateId"`
+	Version    int    `json:"version"`
+	// Pinned 锁定当前版本，模板更新时不自动同步
+	Pinned    bool      `json:"pinned"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// SettingsTemplateForUser 用户可见的模板及其应用状态
+type SettingsTemplateForUser struct {
+	SettingsTemplate
+	// Applied 为空表示用户未应用该模板
+	Applied *UserSettingsTemplate `json:"applied,omitempty"`
+}
+
+// ApplySettingsTemplateRequest 应用模板；Version 为 0 表示最新版本，Pinned 为 true 时锁定该版本
+type ApplySettingsTemplateRequest struct {
+	Version int  `json:"version"`
+	Pinned  bool `json:"pinned"`
+}
+
+// SettingsTemplateUpdateResult 更新模板后向跟随最新版本的用户同步的结果
+type SettingsTemplateUpdateResult struct {
+	Template *SettingsTemplate `json:"template"`
+	// Propagated 已同步到新版本的用户数
+	Propagated int `json:"propagated"`
+	// Pinned 锁定旧版本而未同步的用户数
+	Pinned int `json:"pinned"`
+	// Failed 同步失败的用户 ID
+	Failed []string `json:"failed"`
+}
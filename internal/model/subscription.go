@@ -35,13 +35,18 @@ const (
 	SubscriptionStatusCancelled SubscriptionStatus = "cancelled"
 )
 
+// SubscriptionPlan 订阅套餐。每日/每周/每月固定窗口在 ResetTimezone（IANA 名称，为空时使用订阅用户的报表时区）
+// 的 ResetHour 点（0-23）重置
 type SubscriptionPlan struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Enabled     bool      `json:"enabled"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Enabled       bool      `json:"enabled"`
+	ResetTimezone string    `json:"resetTimezone"`
+	ResetHour     int       `json:"resetHour"`
+	Version       int       `json:"version"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
 }
 
 type SubscriptionPlanLimit struct {
@@ -73,6 +78,20 @@ type UserBillingSetting struct {
 	UpdatedAt       time.Time     `json:"updatedAt"`
 }
 
+// 计费事件类型
+const (
+	BillingEventCharge     = "charge"
+	BillingEventRefund     = "refund"
+	BillingEventAdjustment = "adjustment" // 管理员手动调整余额
+)
+
+// 余额调整方向，金额始终为正数
+const (
+	BalanceAdjustmentCredit = "credit" // 增加余额
+	BalanceAdjustmentDebit  = "debit"  // 扣减余额
+)
+
+// BillingEvent 计费事件；Direction、Reason、Actor、BalanceAfterMicros 仅余额调整事件设置
 type BillingEvent struct {
 	ID                 string        `json:"id"`
 	RequestLogID       *string       `json:"requestLogId"`
@@ -81,16 +100,47 @@ type BillingEvent struct {
 	Source             BillingSource `json:"source"`
 	EventType          string        `json:"eventType"`
 	AmountMicros       int64         `json:"amountMicros"`
+	Direction          string        `json:"direction,omitempty"`
+	Reason             string        `json:"reason,omitempty"`
+	Actor              string        `json:"actor,omitempty"`
+	BalanceAfterMicros *int64        `json:"balanceAfterMicros,omitempty"`
 	CreatedAt          time.Time     `json:"createdAt"`
 }
 
 // --- Request / Response DTOs ---
 
+// BalanceAdjustmentRequest 管理员调整用户余额，AmountMicros 与 AmountUsd 二选一
+type BalanceAdjustmentRequest struct {
+	Direction    string  `json:"direction" binding:"required,oneof=credit debit"`
+	AmountMicros int64   `json:"amountMicros" binding:"omitempty,gt=0"`
+	AmountUsd    float64 `json:"amountUsd" binding:"omitempty,gt=0"`
+	Reason       string  `json:"reason" binding:"required,max=256"`
+}
+
+type BalanceAdjustmentResponse struct {
+	Event         *BillingEvent `json:"event"`
+	BalanceMicros int64         `json:"balanceMicros"`
+	BalanceUsd    string        `json:"balanceUsd"`
+}
+
+// BillingEventListResponse 用户计费记录（扣费、退款与余额调整），按时间倒序
+type BillingEventListResponse struct {
+	Items    []*BillingEvent `json:"items"`
+	Total    int64           `json:"total"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"pageSize"`
+}
+
 type SubscriptionPlanRequest struct {
 	Name        string            `json:"name" binding:"required,min=1,max=64"`
 	Description string            `json:"description" binding:"max=256"`
 	Enabled     bool              `json:"enabled"`
 	Limits      []PlanLimitRequest `json:"limits"`
+	// ResetTimezone 固定窗口的重置时区，为空时使用订阅用户的报表时区；ResetHour 为重置整点（0-23）
+	ResetTimezone string `json:"resetTimezone" binding:"max=64"`
+	ResetHour     int    `json:"resetHour" binding:"min=0,max=23"`
+	// Version 编辑时读取到的版本号，非 0 时用于乐观锁校验
+	Version int `json:"version,omitempty"`
 }
 
 type PlanLimitRequest struct {
@@ -100,13 +150,16 @@ type PlanLimitRequest struct {
 }
 
 type SubscriptionPlanResponse struct {
-	ID          string                  `json:"id"`
-	Name        string                  `json:"name"`
-	Description string                  `json:"description"`
-	Enabled     bool                    `json:"enabled"`
-	Limits      []SubscriptionPlanLimit `json:"limits"`
-	CreatedAt   time.Time               `json:"createdAt"`
-	UpdatedAt   time.Time               `json:"updatedAt"`
+	ID            string                  `json:"id"`
+	Name          string                  `json:"name"`
+	Description   string                  `json:"description"`
+	Enabled       bool                    `json:"enabled"`
+	Limits        []SubscriptionPlanLimit `json:"limits"`
+	ResetTimezone string                  `json:"resetTimezone"`
+	ResetHour     int                     `json:"resetHour"`
+	Version       int                     `json:"version"`
+	CreatedAt     time.Time               `json:"createdAt"`
+	UpdatedAt     time.Time               `json:"updatedAt"`
 }
 
 type AssignSubscriptionRequest struct {
@@ -149,3 +202,68 @@ type BillingStateResponse struct {
 type UpdateBillingPriorityRequest struct {
 	PrimarySource BillingSource `json:"primarySource" binding:"required"`
 }
+
+// 额度预检执行模式
+const (
+	// QuotaEnforcementHard 额度用尽时拒绝模型调用
+	QuotaEnforcementHard = "hard"
+	// QuotaEnforcementSoft 额度用尽时仍放行，只记录日志并在响应头中提示
+	QuotaEnforcementSoft = "soft"
+	// QuotaEnforcementOff 不做请求前额度检查
+	QuotaEnforcementOff = "off"
+)
+
+// QuotaEnforcementConfig 模型调用前的额度检查配置
+type QuotaEnforcementConfig struct {
+	Mode string `json:"mode"`
+}
+
+// QuotaExhaustedWindow 已用尽的订阅额度窗口，ResetsAt 为空表示不会自动恢复（总量额度）
+type QuotaExhaustedWindow struct {
+	LimitType   LimitType  `json:"limitType"`
+	WindowMode  WindowMode `json:"windowMode"`
+	LimitMicros int64      `json:"limitMicros"`
+	UsedMicros  int64      `json:"usedMicros"`
+	ResetsAt    *time.Time `json:"resetsAt,omitempty"`
+}
+
+// QuotaCheckResult 请求前额度检查结果
+type QuotaCheckResult struct {
+	Allowed         bool          `json:"allowed"`
+	PrimarySource   BillingSource `json:"primarySource"`
+	SecondarySource BillingSource `json:"secondarySource"`
+	BalanceMicros   int64         `json:"balanceMicros"`
+	HasSubscription bool          `json:"hasSubscription"`
+	// ExhaustedWindows 当前订阅中已用尽的窗口（任一窗口用尽即订阅不可用）
+	ExhaustedWindows []QuotaExhaustedWindow `json:"exhaustedWindows"`
+	// ResetsAt 订阅最早恢复可用的时间（所有已用尽窗口都恢复），为空表示只能通过充值或更换订阅恢复
+	ResetsAt *time.Time `json:"resetsAt,omitempty"`
+}
+
+// CapacityRelease 已用额度移出窗口、重新可用的时间点
+type CapacityRelease struct {
+	ReleaseAt time.Time `json:"releaseAt"`
+	// AmountMicros 该时刻释放的额度（同一分钟内合并；窗口内的退款移出窗口时为负）
+	AmountMicros int64 `json:"amountMicros"`
+	// LeftAfterMicros 释放后该窗口的剩余额度
+	LeftAfterMicros int64 `json:"leftAfterMicros"`
+}
+
+// WindowReleaseSchedule 单个额度窗口的当前用量与额度释放计划
+type WindowReleaseSchedule struct {
+	WindowRemaining
+	// NextReleaseAt 最近一次有额度释放的时间：固定窗口为窗口结束时间，滑动窗口为最早的扣费移出窗口的时间；
+	// 没有已用额度或总量额度时为空
+	NextReleaseAt *time.Time `json:"nextReleaseAt,omitempty"`
+	// Releases 按时间正序的释放计划，固定窗口只有窗口结束时一次
+	Releases []CapacityRelease `json:"releases"`
+	// Truncated 释放计划超出返回上限，只返回了最早的部分
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// QuotaReleaseScheduleResponse 当前订阅各窗口的额度释放计划
+type QuotaReleaseScheduleResponse struct {
+	Now            time.Time               `json:"now"`
+	SubscriptionID string                  `json:"subscriptionId,omitempty"`
+	Windows        []WindowReleaseSchedule `json:"windows"`
+}
@@ -54,3 +54,329 @@ type TimeoutConfigRequest struct {
 	DialTimeoutSec         int `json:"dialTimeoutSec"`
 	TLSHandshakeTimeoutSec int `json:"tlsHandshakeTimeoutSec"`
 }
+
+// PendingCleanerConfigResponse pending 清理配置响应
+type PendingCleanerConfigResponse struct {
+	Enabled         bool `json:"enabled"`
+	IntervalSec     int  `json:"intervalSec"`     // 扫描间隔
+	TimeoutSec      int  `json:"timeoutSec"`      // pending 超过该时长视为失败
+	SettleOnCleanup bool `json:"settleOnCleanup"` // 自动清理时按已捕获用量结算
+}
+
+// PendingCleanerConfigRequest pending 清理配置请求
+type PendingCleanerConfigRequest struct {
+	Enabled         bool `json:"enabled"`
+	IntervalSec     int  `json:"intervalSec"`
+	TimeoutSec      int  `json:"timeoutSec"`
+	SettleOnCleanup bool `json:"settleOnCleanup"`
+}
+
+// LogRetentionConfigResponse 请求日志保留策略，天数为 0 表示永久保留
+type LogRetentionConfigResponse struct {
+	Enabled  bool `json:"enabled"`  // 是否每小时自动清理
+	LogDays  int  `json:"logDays"`  // 请求日志保留天数，更早的统计只保留在用量汇总表中
+	BodyDays int  `json:"bodyDays"` // 请求/响应内容（详情与响应文本）保留天数
+}
+
+// LogRetentionConfigRequest 请求日志保留策略请求
+type LogRetentionConfigRequest struct {
+	Enabled  bool `json:"enabled"`
+	LogDays  int  `json:"logDays"`
+	BodyDays int  `json:"bodyDays"`
+}
+
+// LogRetentionRunResult 单次日志清理的结果
+type LogRetentionRunResult struct {
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt time.Time  `json:"finishedAt"`
+	LogCutoff  *time.Time `json:"logCutoff,omitempty"`  // 删除了早于该时间的请求日志
+	BodyCutoff *time.Time `json:"bodyCutoff,omitempty"` // 删除了早于该时间的请求/响应内容
+	// DeletedLogs 删除的请求日志条数
+	DeletedLogs int64 `json:"deletedLogs"`
+	// DeletedDetails 删除的请求详情条数（含归档）
+	DeletedDetails int64 `json:"deletedDetails"`
+	// ClearedResponseTexts 清空响应文本的请求日志条数
+	ClearedResponseTexts int64  `json:"clearedResponseTexts"`
+	Note                 string `json:"note,omitempty"`
+	Error                string `json:"error,omitempty"`
+}
+
+// LogRetentionStatus 日志保留策略与清理状态
+type LogRetentionStatus struct {
+	Config LogRetentionConfigResponse `json:"config"`
+	// PrunedBefore 早于该时间的请求日志已被清理，仪表盘使用用量汇总表补足
+	PrunedBefore *time.Time             `json:"prunedBefore,omitempty"`
+	LastRun      *LogRetentionRunResult `json:"lastRun,omitempty"`
+}
+
+// HTTPPolicyConfig 管理 API 的跨域与嵌入策略
+type HTTPPolicyConfig struct {
+	// CORSAllowedOrigins 允许的跨域来源，支持 https://*.example.com 形式的子域通配；
+	// "*" 仅在不允许凭据时生效
+	CORSAllowedOrigins   []string `json:"corsAllowedOrigins"`
+	CORSAllowCredentials bool     `json:"corsAllowCredentials"`
+	CORSMaxAgeSec        int      `json:"corsMaxAgeSec"`
+	// FrameAncestors 允许嵌入本站页面的来源（CSP frame-ancestors），空表示仅允许同源
+	FrameAncestors []string `json:"frameAncestors"`
+	// ContentSecurityPolicy 附加的 CSP 指令（不含 frame-ancestors）
+	ContentSecurityPolicy string `json:"contentSecurityPolicy"`
+}
+
+// 访问日志格式
+const (
+	AccessLogFormatCombined = "combined" // Apache/Nginx combined 格式
+	AccessLogFormatJSON     = "json"     // 每行一个 JSON 对象
+)
+
+// AccessLogConfig HTTP 访问日志配置：记录所有路由（含管理接口与代理接口）的访问，与模型调用的请求日志相互独立
+type AccessLogConfig struct {
+	Enabled bool   `json:"enabled"`
+	Format  string `json:"format"`
+	// Path 日志文件路径，空表示数据库目录下的 access.log
+	Path string `json:"path"`
+	// MaxSizeMB 单个文件达到该大小后轮转
+	MaxSizeMB int `json:"maxSizeMb"`
+	// MaxBackups 保留的轮转文件数（access.log.1 为最近一个）
+	MaxBackups int `json:"maxBackups"`
+	// SampleRate 记录比例（0-1]，只作用于成功的非管理请求；管理接口与状态码 >= 400 的请求始终记录
+	SampleRate float64 `json:"sampleRate"`
+	// ExcludePaths 不记录的路径前缀（如 /health）
+	ExcludePaths []string `json:"excludePaths"`
+}
+
+// 维护模式下新模型调用的处理方式
+const (
+	MaintenanceModeReject = "reject" // 立即返回 503
+	MaintenanceModeQueue  = "queue"  // 排队等待维护结束，超时后返回 503
+)
+
+// MaintenanceConfig 维护模式配置
+type MaintenanceConfig struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode"`
+	// Message 返回给客户端并在控制台横幅中展示的提示
+	Message       string `json:"message"`
+	RetryAfterSec int    `json:"retryAfterSec"`
+	// QueueTimeoutSec queue 模式下单个请求最长等待时间
+	QueueTimeoutSec int `json:"queueTimeoutSec"`
+	// MaxQueued queue 模式下同时排队的请求上限，超出后直接拒绝
+	MaxQueued int        `json:"maxQueued"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+// MaintenanceStatus 维护模式状态
+type MaintenanceStatus struct {
+	MaintenanceConfig
+	// InFlight 正在处理中的模型调用数（含流式响应）
+	InFlight int64 `json:"inFlight"`
+	Queued   int64 `json:"queued"`
+}
+
+// 上游响应头过滤模式
+const (
+	ResponseHeaderModeDeny  = "deny"  // 移除列表中的响应头，其余透传
+	ResponseHeaderModeAllow = "allow" // 仅保留列表中的响应头（内容相关响应头始终保留）
+)
+
+// ResponseHeaderRule 某一上游格式的响应头过滤规则，Headers 支持以 * 结尾的前缀匹配
+type ResponseHeaderRule struct {
+	Mode    string   `json:"mode"`
+	Headers []string `json:"headers"`
+}
+
+// ResponseHeaderConfig 渠道转发时上游响应头的透传策略
+type ResponseHeaderConfig struct {
+	// Formats 按上游格式（claude / openai / gemini）配置，未配置的格式使用默认规则
+	Formats map[string]ResponseHeaderRule `json:"formats"`
+	// InjectHeaders 在响应中附加 X-AMP-Request-Id、X-AMP-Channel-Id，
+	// 非流式响应另附加 X-AMP-Cost-Usd 和 X-AMP-Cache（提示缓存命中情况）
+	InjectHeaders bool `json:"injectHeaders"`
+}
+
+// BillingShadowConfig 计费影子模式：照常计算并记录费用，但不扣减余额/订阅额度，也不因额度拦截请求，
+// 用于正式启用计费前对照上游账单核验定价
+type BillingShadowConfig struct {
+	Enabled   bool       `json:"enabled"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+// BillingShadowModelSummary 影子模式期间按计价模型汇总的费用
+type BillingShadowModelSummary struct {
+	Model                   string `json:"model"`
+	RequestCount            int64  `json:"requestCount"`
+	UnpricedCount           int64  `json:"unpricedCount"`
+	InputTokensSum          int64  `json:"inputTokensSum"`
+	OutputTokensSum         int64  `json:"outputTokensSum"`
+	CacheReadInputTokensSum int64  `json:"cacheReadInputTokensSum"`
+	CacheCreationTokensSum  int64  `json:"cacheCreationInputTokensSum"`
+	CostMicrosSum           int64  `json:"costMicrosSum"`
+	CostUsdSum              string `json:"costUsdSum"`
+	UpstreamCostMicrosSum   int64  `json:"upstreamCostMicrosSum"`
+	UpstreamCostUsdSum      string `json:"upstreamCostUsdSum"`
+}
+
+// BillingShadowStatus 影子模式配置及自开启以来的费用汇总
+type BillingShadowStatus struct {
+	BillingShadowConfig
+	// Models 成功请求按计价模型汇总；CostMicrosSum 为按分组倍率折算后本应扣除的费用，
+	// UpstreamCostMicrosSum 为按模型单价计算的上游成本，可直接与供应商账单对照
+	Models []BillingShadowModelSummary `json:"models"`
+	// WouldChargeMicros 影子模式下本应扣除的费用合计
+	WouldChargeMicros int64  `json:"wouldChargeMicros"`
+	WouldChargeUsd    string `json:"wouldChargeUsd"`
+}
+
+// ChannelFailoverConfig 渠道故障转移配置：上游返回 5xx/429 或连接失败时改用同模型的下一个渠道重新请求
+type ChannelFailoverConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxChannels 单个请求最多尝试的渠道数（含首个渠道）
+	MaxChannels int  `json:"maxChannels"`
+	On429       bool `json:"on429"`
+	On5xx       bool `json:"on5xx"`
+}
+
+// ChannelStickyConfig 会话粘性配置：同一会话（客户端提供的 thread/session ID）对同一模型的请求
+// 在 TTL 内固定路由到首次选中的渠道，提高上游提示缓存命中率
+type ChannelStickyConfig struct {
+	Enabled bool `json:"enabled"`
+	// TTLSec 会话绑定在最后一次使用后保留的秒数
+	TTLSec int `json:"ttlSec"`
+}
+
+// TranslationConfig 跨格式翻译配置：Strict 为 true 时翻译失败返回 502（流式响应下发错误事件后结束），
+// 否则记录警告并沿用原始数据。渠道可单独设置 translationMode 覆盖
+type TranslationConfig struct {
+	Strict bool `json:"strict"`
+}
+
+// RuntimeDebugConfig 运行时诊断开关：开启后管理员可获取 pprof 采样、运行时指标与 goroutine 堆栈，
+// 默认关闭，排查完成后应及时关闭
+type RuntimeDebugConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// RuntimeStats 进程运行时指标快照
+type RuntimeStats struct {
+	GoVersion  string    `json:"goVersion"`
+	NumCPU     int       `json:"numCpu"`
+	GOMAXPROCS int       `json:"gomaxprocs"`
+	Goroutines int       `json:"goroutines"`
+	StartedAt  time.Time `json:"startedAt"`
+	UptimeSec  int64     `json:"uptimeSec"`
+
+	HeapAllocBytes    uint64 `json:"heapAllocBytes"`
+	HeapInuseBytes    uint64 `json:"heapInuseBytes"`
+	HeapIdleBytes     uint64 `json:"heapIdleBytes"`
+	HeapReleasedBytes uint64 `json:"heapReleasedBytes"`
+	HeapObjects       uint64 `json:"heapObjects"`
+	StackInuseBytes   uint64 `json:"stackInuseBytes"`
+	// SysBytes 从操作系统获取的内存总量
+	SysBytes uint64 `json:"sysBytes"`
+
+	NumGC uint32 `json:"numGc"`
+	// LastGC 最近一次 GC 完成时间，尚未 GC 时为空
+	LastGC       *time.Time `json:"lastGc,omitempty"`
+	NextGCBytes  uint64     `json:"nextGcBytes"`
+	PauseTotalNs uint64     `json:"pauseTotalNs"`
+	// LastPauseNs 最近一次 GC 的停顿时长
+	LastPauseNs   uint64  `json:"lastPauseNs"`
+	GCCPUFraction float64 `json:"gcCpuFraction"`
+}
+
+// StreamFlushConfig 流式响应刷新合并配置：开启后中转不再在每个数据块后立即刷新，
+// 而是在写完完整的 SSE 事件且距上次刷新已满 IntervalMs 时刷新；不完整的事件最迟在写入 IntervalMs 后发出
+type StreamFlushConfig struct {
+	Enabled bool `json:"enabled"`
+	// IntervalMs 两次刷新之间的最短间隔（毫秒）
+	IntervalMs int `json:"intervalMs"`
+	// Formats 按客户端请求格式（openai-chat、openai-responses、claude、gemini 等）覆盖 IntervalMs，
+	// 值为 0 时该格式不合并，保持逐块刷新
+	Formats map[string]int `json:"formats,omitempty"`
+}
+
+// MemoryGuardConfig 内存保护配置：限制单个请求在各缓冲层（请求详情捕获、跨格式翻译、流聚合）累计缓冲的内存，
+// 并监控进程常驻内存（RSS），越过水位时告警
+type MemoryGuardConfig struct {
+	// RequestBudgetMB 单个请求可缓冲的内存上限（MB），0 表示不限制。超出后可选的缓冲（请求详情捕获）停止记录，
+	// 必需的缓冲（跨格式翻译、流聚合）中止请求并返回 memory_budget_exceeded 错误
+	RequestBudgetMB int `json:"requestBudgetMb"`
+	// WarnRSSMB 进程 RSS 告警水位（MB），0 表示不告警
+	WarnRSSMB int `json:"warnRssMb"`
+	// CriticalRSSMB 进程 RSS 严重水位（MB），越过后所有请求跳过请求详情捕获，0 表示不启用
+	CriticalRSSMB int `json:"criticalRssMb"`
+	// CheckIntervalSec RSS 检查间隔（秒）
+	CheckIntervalSec int `json:"checkIntervalSec"`
+}
+
+// MemoryGuardStatus 当前进程内存与内存保护的统计
+type MemoryGuardStatus struct {
+	// Level 当前水位：normal、warn、critical
+	Level      string    `json:"level"`
+	RSSBytes   uint64    `json:"rssBytes"`
+	HeapBytes  uint64    `json:"heapBytes"`
+	Goroutines int       `json:"goroutines"`
+	CheckedAt  time.Time `json:"checkedAt"`
+	// BudgetExceeded 自启动以来超出单请求预算的请求数（降级与中止合计）
+	BudgetExceeded int64 `json:"budgetExceeded"`
+	// BudgetAborted 其中因必需的缓冲超出预算而中止的请求数
+	BudgetAborted int64 `json:"budgetAborted"`
+}
+
+// ToolLoopConfig 工具调用循环检测配置：同一会话连续只有工具调用、没有新用户消息的轮数过多时，
+// 先注入提醒，再拒绝该会话的后续请求，防止智能体陷入死循环持续消耗 token
+type ToolLoopConfig struct {
+	Enabled bool `json:"enabled"`
+	// WarnTurns 连续工具调用轮数达到该值时向请求注入提醒消息，0 表示不提醒
+	WarnTurns int `json:"warnTurns"`
+	// BlockTurns 连续工具调用轮数达到该值时拒绝请求，0 表示不拒绝
+	BlockTurns int `json:"blockTurns"`
+	// MaxIdenticalCalls 连续发起名称与参数完全相同的工具调用达到该次数时拒绝请求，0 表示不检测
+	MaxIdenticalCalls int `json:"maxIdenticalCalls"`
+}
+
+// RequestLogLevel 请求日志记录级别
+type RequestLogLevel string
+
+const (
+	// RequestLogFull 记录日志并保存请求/响应详情
+	RequestLogFull RequestLogLevel = "full"
+	// RequestLogSummary 只记录日志（状态码、耗时、模型、用量），不保存请求/响应详情
+	RequestLogSummary RequestLogLevel = "summary"
+	// RequestLogOff 不记录
+	RequestLogOff RequestLogLevel = "off"
+)
+
+// RequestLogPolicy 按端点类别设置请求日志级别，避免广告、遥测等辅助流量挤占请求日志。
+// 模型调用的日志同时用于计费结算，不能设为 off
+type RequestLogPolicy struct {
+	ModelInvocation RequestLogLevel `json:"modelInvocation"`
+	// TokenCount count_tokens / countTokens / input_tokens
+	TokenCount RequestLogLevel `json:"tokenCount"`
+	// Telemetry /api/telemetry、/api/otel
+	Telemetry RequestLogLevel `json:"telemetry"`
+	// Ads /api/ads
+	Ads RequestLogLevel `json:"ads"`
+	// Docs 代理到 ampcode.com 的公开页面（文档、线程、设置页、RSS）
+	Docs RequestLogLevel `json:"docs"`
+	// Other 其余 Amp 管理接口（用户、认证、线程、/api/internal 等）
+	Other RequestLogLevel `json:"other"`
+}
+
+// FederationConfig 联邦配置：信任的下级 AMP-Manager 实例。下级实例把本实例配置为渠道并设置签发方后，
+// 以共享密钥对请求签名并附带原始用户，本实例校验签名后按对应的本地账户处理并计费
+type FederationConfig struct {
+	Peers []FederationPeer `json:"peers"`
+}
+
+// FederationPeer 受信任的下级实例
+type FederationPeer struct {
+	// Issuer 下级实例渠道中配置的签发方标识
+	Issuer string `json:"issuer"`
+	// Secret 签名密钥，即下级实例该渠道的 API Key；支持密钥引用，查询时不返回明文
+	Secret string `json:"secret,omitempty"`
+	// SecretSet 是否已配置密钥（仅查询时返回）
+	SecretSet bool `json:"secretSet"`
+	// UserID 该实例的请求使用的本地账户（设置、分组倍率与计费均按此账户）
+	UserID  string `json:"userId"`
+	Enabled bool   `json:"enabled"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// 趋势图时间桶粒度
+const (
+	UsageTrendResolutionAuto = "auto"
+	UsageTrendResolutionHour = "hour"
+	UsageTrendResolutionDay  = "day"
+)
+
+// UsageTrendPoint 趋势图中单个时间桶的统计，没有请求的桶各项为 0
+type UsageTrendPoint struct {
+	Time            time.Time `json:"time"`
+	Requests        int64     `json:"requests"`
+	Errors          int64     `json:"errors"`
+	InputTokens     int64     `json:"inputTokens"`
+	OutputTokens    int64     `json:"outputTokens"`
+	CacheReadTokens int64     `json:"cacheReadTokens"`
+	CostMicros      int64     `json:"costMicros"`
+	CostUsd         string    `json:"costUsd"`
+}
+
+// UsageTrend 长周期趋势图数据
+type UsageTrend struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Resolution string    `json:"resolution"`
+	// RolledUpAt 汇总数据的截止时间，之后的请求尚未计入
+	RolledUpAt *time.Time        `json:"rolledUpAt,omitempty"`
+	Points     []UsageTrendPoint `json:"points"`
+}
@@ -3,18 +3,28 @@ package model
 import "time"
 
 type User struct {
-	ID            string    `json:"id"`
-	Username      string    `json:"username"`
-	PasswordHash  string    `json:"-"`
-	IsAdmin       bool      `json:"is_admin"`
-	BalanceMicros int64     `json:"balance_micros"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	PasswordHash  string `json:"-"`
+	IsAdmin       bool   `json:"is_admin"`
+	BalanceMicros int64  `json:"balance_micros"`
+	Timezone      string `json:"timezone"`
+	Email         string `json:"email"`
+	// EmailVerifiedAt 为空表示邮箱未验证；修改邮箱后需重新验证
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// PasswordChangedAt 最近一次设置密码的时间，用于密码有效期与凭据卫生报告
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	// PasswordMustChange 管理员要求或批量导入的账户，修改密码前只能访问修改密码接口
+	PasswordMustChange bool      `json:"password_must_change"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
 }
 
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=32"`
 	Password string `json:"password" binding:"required,min=6,max=128"`
+	// Email 可选，填写后发送验证邮件；验证后可用于找回密码与接收凭据变更通知
+	Email string `json:"email" binding:"omitempty,email,max=254"`
 }
 
 type LoginRequest struct {
@@ -28,18 +38,27 @@ type AuthResponse struct {
 	Token    string `json:"token,omitempty"`
 	IsAdmin  bool   `json:"isAdmin"`
 	Message  string `json:"message"`
+	// MustChangePassword 为 true 时需先调用修改密码接口，其余管理接口返回 403 password_change_required
+	MustChangePassword bool `json:"mustChangePassword,omitempty"`
 }
 
 type UserInfo struct {
-	ID            string    `json:"id"`
-	Username      string    `json:"username"`
-	IsAdmin       bool      `json:"isAdmin"`
-	BalanceMicros int64     `json:"balanceMicros"`
-	BalanceUsd    string    `json:"balanceUsd"`
-	GroupIDs      []string  `json:"groupIds"`
-	GroupNames    []string  `json:"groupNames"`
-	CreatedAt     time.Time `json:"createdAt"`
-	UpdatedAt     time.Time `json:"updatedAt"`
+	ID            string   `json:"id"`
+	Username      string   `json:"username"`
+	IsAdmin       bool     `json:"isAdmin"`
+	BalanceMicros int64    `json:"balanceMicros"`
+	BalanceUsd    string   `json:"balanceUsd"`
+	GroupIDs      []string `json:"groupIds"`
+	GroupNames    []string `json:"groupNames"`
+	Timezone      string   `json:"timezone"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"emailVerified"`
+	// Suspension 当前生效的停用状态，未停用或已到期时为空
+	Suspension         *UserSuspension `json:"suspension,omitempty"`
+	PasswordChangedAt  time.Time       `json:"passwordChangedAt"`
+	MustChangePassword bool            `json:"mustChangePassword"`
+	CreatedAt          time.Time       `json:"createdAt"`
+	UpdatedAt          time.Time       `json:"updatedAt"`
 }
 
 type ChangePasswordRequest struct {
@@ -51,12 +70,20 @@ type ChangeUsernameRequest struct {
 	NewUsername string `json:"newUsername" binding:"required,min=3,max=32"`
 }
 
+// TimezoneSetting 用户的报表时区（IANA 名称，如 Asia/Shanghai），空字符串表示 UTC。
+// 仪表盘、用量统计的按天分组与订阅的每日/每周/每月固定窗口按该时区的自然日计算
+type TimezoneSetting struct {
+	Timezone string `json:"timezone" binding:"max=64"`
+}
+
 type SetAdminRequest struct {
 	IsAdmin bool `json:"isAdmin"`
 }
 
 type ResetPasswordRequest struct {
 	NewPassword string `json:"newPassword" binding:"required,min=6,max=128"`
+	// ForceChange 要求用户登录后先修改密码
+	ForceChange bool `json:"forceChange"`
 }
 
 type SetGroupsRequest struct {
@@ -65,4 +92,84 @@ type SetGroupsRequest struct {
 
 type TopUpRequest struct {
 	AmountUsd float64 `json:"amountUsd" binding:"required,gt=0"`
+	// Reason 为空时记录为“管理员充值”
+	Reason string `json:"reason" binding:"max=256"`
+}
+
+// 账户停用原因
+const (
+	SuspensionReasonNonPayment  = "non_payment"
+	SuspensionReasonAbuseReview = "abuse_review"
+	SuspensionReasonOther       = "other"
+)
+
+// UserSuspension 账户停用状态：停用期间代理与管理 API 均返回 403，ExpiresAt 到期后自动恢复
+type UserSuspension struct {
+	Reason      string     `json:"reason"`
+	Message     string     `json:"message,omitempty"`
+	SuspendedAt time.Time  `json:"suspendedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	SuspendedBy string     `json:"suspendedBy,omitempty"`
+}
+
+// SuspendUserRequest 停用账户；Message 会展示给被停用的用户，ExpiresAt 为空表示直到手动恢复
+type SuspendUserRequest struct {
+	Reason    string     `json:"reason" binding:"required"`
+	Message   string     `json:"message" binding:"max=512"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// SuspensionNotice 返回给被停用用户的说明（不含操作人）
+type SuspensionNotice struct {
+	Reason      string     `json:"reason"`
+	Description string     `json:"description"`
+	Message     string     `json:"message,omitempty"`
+	SuspendedAt time.Time  `json:"suspendedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+}
+
+// 一次性令牌用途
+const (
+	EmailTokenVerify        = "verify_email"
+	EmailTokenPasswordReset = "password_reset"
+	// EmailTokenOIDCLogin SSO 回调后交给登录页换取登录 Token 的票据
+	EmailTokenOIDCLogin = "oidc_login"
+)
+
+// EmailToken 邮箱验证 / 找回密码 / SSO 登录票据（只保存哈希），一次性使用
+type EmailToken struct {
+	TokenHash string
+	UserID    string
+	Purpose   string
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// EmailStatus 当前用户的邮箱状态
+type EmailStatus struct {
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+	// MailEnabled 服务端是否已配置 SMTP，未配置时无法发送验证邮件与找回密码
+	MailEnabled bool `json:"mailEnabled"`
+}
+
+// UpdateEmailRequest 设置邮箱，空字符串表示解除绑定
+type UpdateEmailRequest struct {
+	Email string `json:"email" binding:"omitempty,email,max=254"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// PasswordResetRequest 申请找回密码，无论邮箱是否存在都返回相同结果
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email,max=254"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required,min=6,max=128"`
 }
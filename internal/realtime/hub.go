@@ -16,6 +16,7 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 	notify     chan string
+	events     chan []byte
 	fetcher    LogFetcher
 	mu         sync.RWMutex
 }
@@ -33,6 +34,7 @@ func InitHub(fetcher LogFetcher) {
 			register:   make(chan *Client, 16),
 			unregister: make(chan *Client, 16),
 			notify:     make(chan string, 256),
+			events:     make(chan []byte, 64),
 			fetcher:    fetcher,
 		}
 		go globalHub.run()
@@ -58,6 +60,27 @@ func NotifyLogCompleted(id string) {
 	}
 }
 
+// Broadcast pushes an arbitrary event to all clients (non-blocking)
+func Broadcast(eventType string, data interface{}) {
+	h := globalHub
+	if h == nil {
+		return
+	}
+	msg, err := json.Marshal(map[string]interface{}{
+		"type": eventType,
+		"data": data,
+	})
+	if err != nil {
+		log.Debugf("realtime: failed to marshal %s event: %v", eventType, err)
+		return
+	}
+	select {
+	case h.events <- msg:
+	default:
+		// hub busy, drop event
+	}
+}
+
 // Register adds a client to the hub
 func (h *Hub) Register(c *Client) {
 	h.register <- c
@@ -107,16 +130,22 @@ func (h *Hub) run() {
 			if err != nil {
 				continue
 			}
+			h.broadcast(msg)
 
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- msg:
-				default:
-					// slow client, skip
-				}
-			}
-			h.mu.RUnlock()
+		case msg := <-h.events:
+			h.broadcast(msg)
+		}
+	}
+}
+
+func (h *Hub) broadcast(msg []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		select {
+		case client.send <- msg:
+		default:
+			// slow client, skip
 		}
 	}
 }
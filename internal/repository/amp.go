@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"ampmanager/internal/database"
@@ -23,13 +24,13 @@ func (r *AmpSettingsRepository) GetByUserID(userID string) (*model.AmpSettings,
 	var webSearchMode sql.NullString
 	err := db.QueryRow(
 		`SELECT id, user_id, upstream_url, upstream_api_key, model_mappings_json, 
-		        enabled, web_search_mode, native_mode, show_balance_in_ad, socks5_proxy, created_at, updated_at 
+		        enabled, web_search_mode, native_mode, show_balance_in_ad, socks5_proxy, post_processing_json, system_prompt, version, created_at, updated_at 
 		 FROM user_amp_settings WHERE user_id = ?`,
 		userID,
 	).Scan(
 		&settings.ID, &settings.UserID, &settings.UpstreamURL, &settings.UpstreamAPIKey,
 		&settings.ModelMappingsJSON, &settings.Enabled,
-		&webSearchMode, &settings.NativeMode, &settings.ShowBalanceInAd, &settings.Socks5Proxy, &settings.CreatedAt, &settings.UpdatedAt,
+		&webSearchMode, &settings.NativeMode, &settings.ShowBalanceInAd, &settings.Socks5Proxy, &settings.PostProcessingJSON, &settings.SystemPrompt, &settings.Version, &settings.CreatedAt, &settings.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -44,9 +45,43 @@ func (r *AmpSettingsRepository) GetByUserID(userID string) (*model.AmpSettings,
 	} else {
 		settings.WebSearchMode = model.WebSearchModeUpstream
 	}
+	if settings.UpstreamAPIKey, err = openSecret(settings.UpstreamAPIKey); err != nil {
+		return nil, err
+	}
 	return settings, nil
 }
 
+// ListEnabled 列出所有启用了 Amp 代理的用户设置
+func (r *AmpSettingsRepository) ListEnabled() ([]*model.AmpSettings, error) {
+	db := database.GetDB()
+	rows, err := db.Query(
+		`SELECT id, user_id, upstream_url, upstream_api_key, model_mappings_json,
+		        enabled, native_mode, version, created_at, updated_at
+		 FROM user_amp_settings WHERE enabled = 1 ORDER BY user_id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*model.AmpSettings
+	for rows.Next() {
+		settings := &model.AmpSettings{}
+		if err := rows.Scan(
+			&settings.ID, &settings.UserID, &settings.UpstreamURL, &settings.UpstreamAPIKey,
+			&settings.ModelMappingsJSON, &settings.Enabled, &settings.NativeMode,
+			&settings.Version, &settings.CreatedAt, &settings.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if settings.UpstreamAPIKey, err = openSecret(settings.UpstreamAPIKey); err != nil {
+			return nil, err
+		}
+		result = append(result, settings)
+	}
+	return result, rows.Err()
+}
+
 func (r *AmpSettingsRepository) Upsert(settings *model.AmpSettings) error {
 	db := database.GetDB()
 	now := time.Now().UTC()
@@ -56,31 +91,49 @@ func (r *AmpSettingsRepository) Upsert(settings *model.AmpSettings) error {
 	if err != nil {
 		return err
 	}
+	upstreamAPIKey, err := sealSecret(settings.UpstreamAPIKey)
+	if err != nil {
+		return err
+	}
 
 	if existing == nil {
 		settings.ID = uuid.New().String()
 		settings.CreatedAt = now
+		settings.Version = 1
 		_, err = db.Exec(
 			`INSERT INTO user_amp_settings 
 			 (id, user_id, upstream_url, upstream_api_key, model_mappings_json, 
-			  enabled, web_search_mode, native_mode, show_balance_in_ad, socks5_proxy, created_at, updated_at) 
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			settings.ID, settings.UserID, settings.UpstreamURL, settings.UpstreamAPIKey,
+			  enabled, web_search_mode, native_mode, show_balance_in_ad, socks5_proxy, post_processing_json, system_prompt, created_at, updated_at) 
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			settings.ID, settings.UserID, settings.UpstreamURL, upstreamAPIKey,
 			settings.ModelMappingsJSON, settings.Enabled,
-			settings.WebSearchMode, settings.NativeMode, settings.ShowBalanceInAd, settings.Socks5Proxy, settings.CreatedAt, settings.UpdatedAt,
+			settings.WebSearchMode, settings.NativeMode, settings.ShowBalanceInAd, settings.Socks5Proxy, settings.PostProcessingJSON, settings.SystemPrompt, settings.CreatedAt, settings.UpdatedAt,
 		)
 	} else {
 		settings.ID = existing.ID
 		settings.CreatedAt = existing.CreatedAt
-		_, err = db.Exec(
+		// settings.Version 为调用方读取时的版本号；未指定时以本次读取的版本为准
+		if settings.Version == 0 {
+			settings.Version = existing.Version
+		}
+		var result sql.Result
+		result, err = db.Exec(
 			`UPDATE user_amp_settings 
 			 SET upstream_url = ?, upstream_api_key = ?, model_mappings_json = ?, 
-			     enabled = ?, web_search_mode = ?, native_mode = ?, show_balance_in_ad = ?, socks5_proxy = ?, updated_at = ? 
-			 WHERE user_id = ?`,
-			settings.UpstreamURL, settings.UpstreamAPIKey, settings.ModelMappingsJSON,
+			     enabled = ?, web_search_mode = ?, native_mode = ?, show_balance_in_ad = ?, socks5_proxy = ?, post_processing_json = ?, system_prompt = ?, updated_at = ?, version = version + 1 
+			 WHERE user_id = ? AND version = ?`,
+			settings.UpstreamURL, upstreamAPIKey, settings.ModelMappingsJSON,
 			settings.Enabled, settings.WebSearchMode,
-			settings.NativeMode, settings.ShowBalanceInAd, settings.Socks5Proxy, settings.UpdatedAt, settings.UserID,
+			settings.NativeMode, settings.ShowBalanceInAd, settings.Socks5Proxy, settings.PostProcessingJSON, settings.SystemPrompt, settings.UpdatedAt, settings.UserID,
+			settings.Version,
 		)
+		if err != nil {
+			return err
+		}
+		if err = checkVersionUpdate(result); err != nil {
+			return err
+		}
+		settings.Version++
 	}
 	return err
 }
@@ -97,9 +150,9 @@ func (r *APIKeyRepository) Create(apiKey *model.UserAPIKey) error {
 	apiKey.CreatedAt = time.Now().UTC()
 
 	_, err := db.Exec(
-		`INSERT INTO user_api_keys (id, user_id, name, prefix, key_hash, api_key, created_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		apiKey.ID, apiKey.UserID, apiKey.Name, apiKey.Prefix, apiKey.KeyHash, apiKey.APIKey, apiKey.CreatedAt,
+		`INSERT INTO user_api_keys (id, user_id, name, prefix, key_hash, api_key, scopes_json, created_at) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		apiKey.ID, apiKey.UserID, apiKey.Name, apiKey.Prefix, apiKey.KeyHash, apiKey.APIKey, encodeAPIKeyScopes(apiKey.Scopes), apiKey.CreatedAt,
 	)
 	return err
 }
@@ -107,7 +160,7 @@ func (r *APIKeyRepository) Create(apiKey *model.UserAPIKey) error {
 func (r *APIKeyRepository) ListByUserID(userID string) ([]*model.UserAPIKey, error) {
 	db := database.GetDB()
 	rows, err := db.Query(
-		`SELECT id, user_id, name, prefix, key_hash, created_at, revoked_at, last_used_at 
+		`SELECT id, user_id, name, prefix, key_hash, created_at, revoked_at, last_used_at, scopes_json 
 		 FROM user_api_keys WHERE user_id = ? ORDER BY created_at DESC`,
 		userID,
 	)
@@ -120,10 +173,12 @@ func (r *APIKeyRepository) ListByUserID(userID string) ([]*model.UserAPIKey, err
 	for rows.Next() {
 		key := &model.UserAPIKey{}
 		var revokedAt, lastUsed sql.NullTime
-		err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.CreatedAt, &revokedAt, &lastUsed)
+		var scopesJSON string
+		err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.CreatedAt, &revokedAt, &lastUsed, &scopesJSON)
 		if err != nil {
 			return nil, err
 		}
+		key.Scopes = decodeAPIKeyScopes(scopesJSON)
 		if revokedAt.Valid {
 			key.RevokedAt = &revokedAt.Time
 		}
@@ -139,11 +194,12 @@ func (r *APIKeyRepository) GetByID(id string) (*model.UserAPIKey, error) {
 	db := database.GetDB()
 	key := &model.UserAPIKey{}
 	var revokedAt, lastUsed sql.NullTime
+	var scopesJSON string
 	err := db.QueryRow(
-		`SELECT id, user_id, name, prefix, key_hash, api_key, created_at, revoked_at, last_used_at 
+		`SELECT id, user_id, name, prefix, key_hash, api_key, created_at, revoked_at, last_used_at, scopes_json 
 		 FROM user_api_keys WHERE id = ?`,
 		id,
-	).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.APIKey, &key.CreatedAt, &revokedAt, &lastUsed)
+	).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.APIKey, &key.CreatedAt, &revokedAt, &lastUsed, &scopesJSON)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -156,6 +212,7 @@ func (r *APIKeyRepository) GetByID(id string) (*model.UserAPIKey, error) {
 	if lastUsed.Valid {
 		key.LastUsed = &lastUsed.Time
 	}
+	key.Scopes = decodeAPIKeyScopes(scopesJSON)
 	return key, nil
 }
 
@@ -169,11 +226,12 @@ func (r *APIKeyRepository) GetByKeyHash(keyHash string) (*model.UserAPIKey, erro
 	db := database.GetDB()
 	key := &model.UserAPIKey{}
 	var revokedAt, lastUsed sql.NullTime
+	var scopesJSON string
 	err := db.QueryRow(
-		`SELECT id, user_id, name, prefix, key_hash, created_at, revoked_at, last_used_at 
+		`SELECT id, user_id, name, prefix, key_hash, created_at, revoked_at, last_used_at, scopes_json 
 		 FROM user_api_keys WHERE key_hash = ?`,
 		keyHash,
-	).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.CreatedAt, &revokedAt, &lastUsed)
+	).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.CreatedAt, &revokedAt, &lastUsed, &scopesJSON)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -186,9 +244,28 @@ func (r *APIKeyRepository) GetByKeyHash(keyHash string) (*model.UserAPIKey, erro
 	if lastUsed.Valid {
 		key.LastUsed = &lastUsed.Time
 	}
+	key.Scopes = decodeAPIKeyScopes(scopesJSON)
 	return key, nil
 }
 
+// UpdateScopes 替换 API Key 的访问范围，scopes 为空时取消所有限制
+func (r *APIKeyRepository) UpdateScopes(id string, scopes *model.APIKeyScopes) error {
+	db := database.GetDB()
+	_, err := db.Exec(`UPDATE user_api_keys SET scopes_json = ? WHERE id = ?`, encodeAPIKeyScopes(scopes), id)
+	return err
+}
+
+// SumCostSince 汇总 API Key 自 since 起的消费（micros）
+func (r *APIKeyRepository) SumCostSince(id string, since time.Time) (int64, error) {
+	db := database.GetDB()
+	var total int64
+	err := db.QueryRow(
+		`SELECT COALESCE(SUM(cost_micros), 0) FROM request_logs WHERE api_key_id = ? AND created_at >= ?`,
+		id, since.UTC(),
+	).Scan(&total)
+	return total, err
+}
+
 func (r *APIKeyRepository) UpdateLastUsed(id string) error {
 	db := database.GetDB()
 	now := time.Now().UTC()
@@ -196,9 +273,58 @@ func (r *APIKeyRepository) UpdateLastUsed(id string) error {
 	return err
 }
 
+// ListNeverUsed 返回在 before 之前创建、从未使用且仍有效（未吊销、未过期）的 API Key，按创建时间升序
+func (r *APIKeyRepository) ListNeverUsed(before time.Time) ([]model.UnusedAPIKeyEntry, error) {
+	db := database.GetDB()
+	now := time.Now().UTC()
+	rows, err := db.Query(
+		`SELECT k.id, k.user_id, u.username, k.name, k.prefix, k.created_at
+		 FROM user_api_keys k JOIN users u ON u.id = k.user_id
+		 WHERE k.last_used_at IS NULL AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > ?) AND k.created_at < ?
+		 ORDER BY k.created_at ASC`,
+		now, before.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []model.UnusedAPIKeyEntry
+	for rows.Next() {
+		var key model.UnusedAPIKeyEntry
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Username, &key.Name, &key.Prefix, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
 func (r *APIKeyRepository) HasActiveByUserID(userID string) (bool, error) {
 	db := database.GetDB()
 	var count int
 	err := db.QueryRow(`SELECT COUNT(*) FROM user_api_keys WHERE user_id = ? AND revoked_at IS NULL`, userID).Scan(&count)
 	return count > 0, err
 }
+
+func encodeAPIKeyScopes(scopes *model.APIKeyScopes) string {
+	if scopes.IsEmpty() {
+		return ""
+	}
+	data, err := json.Marshal(scopes)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func decodeAPIKeyScopes(raw string) *model.APIKeyScopes {
+	if raw == "" {
+		return nil
+	}
+	scopes := &model.APIKeyScopes{}
+	if err := json.Unmarshal([]byte(raw), scopes); err != nil || scopes.IsEmpty() {
+		return nil
+	}
+	return scopes
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+type AuditLogRepository struct{}
+
+func NewAuditLogRepository() *AuditLogRepository {
+	return &AuditLogRepository{}
+}
+
+func (r *AuditLogRepository) Create(entry *model.AuditLog) error {
+	db := database.GetDB()
+	entry.ID = uuid.New().String()
+	entry.CreatedAt = time.Now().UTC()
+	detail := string(entry.Detail)
+	if detail == "" {
+		detail = "{}"
+	}
+	_, err := db.Exec(
+		`INSERT INTO audit_logs (id, actor, action, target_type, target_id, detail_json, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.Actor, entry.Action, entry.TargetType, entry.TargetID, detail, entry.CreatedAt,
+	)
+	return err
+}
+
+// List 按时间倒序分页查询审计记录
+func (r *AuditLogRepository) List(filter model.AuditLogFilter) ([]*model.AuditLog, int64, error) {
+	db := database.GetDB()
+	var conditions []string
+	var args []interface{}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_logs`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (filter.Page - 1) * filter.PageSize
+	rows, err := db.Query(
+		`SELECT id, actor, action, target_type, target_id, detail_json, created_at FROM audit_logs`+where+` ORDER BY created_at DESC LIMIT ? OFFSET ?`,
+		append(args, filter.PageSize, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []*model.AuditLog{}
+	for rows.Next() {
+		entry := &model.AuditLog{}
+		var detail string
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.TargetType, &entry.TargetID, &detail, &entry.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		entry.Detail = []byte(detail)
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
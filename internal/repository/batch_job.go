@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+const batchJobColumns = `id, provider, upstream_id, user_id, api_key_id, channel_id, model, rate_multiplier, request_count,
+	status, item_count, cost_micros, error, settled_at, created_at, updated_at`
+
+type BatchJobRepository struct{}
+
+func NewBatchJobRepository() *BatchJobRepository {
+	return &BatchJobRepository{}
+}
+
+func (r *BatchJobRepository) Create(job *model.BatchJob) error {
+	db := database.GetDB()
+	job.ID = uuid.New().String()
+	job.Status = model.BatchJobInProgress
+	now := time.Now().UTC()
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	_, err := db.Exec(
+		`INSERT INTO batch_jobs (id, provider, upstream_id, user_id, api_key_id, channel_id, model, rate_multiplier, request_count, status, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Provider, job.UpstreamID, job.UserID, job.APIKeyID, job.ChannelID, job.Model, job.RateMultiplier,
+		job.RequestCount, job.Status, job.CreatedAt, job.UpdatedAt,
+	)
+	return err
+}
+
+// GetByUpstreamID 按上游批处理 ID 查找任务，不存在时返回 nil
+func (r *BatchJobRepository) GetByUpstreamID(provider model.BatchProvider, upstreamID string) (*model.BatchJob, error) {
+	db := database.GetDB()
+	job, err := scanBatchJob(db.QueryRow(`SELECT `+batchJobColumns+` FROM batch_jobs WHERE provider = ? AND upstream_id = ?`, provider, upstreamID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// ListByUser 按提交时间倒序列出用户的批处理任务，before 不为空时只返回在其之前提交的任务（分页游标）
+func (r *BatchJobRepository) ListByUser(userID string, provider model.BatchProvider, before *time.Time, limit int) ([]*model.BatchJob, error) {
+	query := `SELECT ` + batchJobColumns + ` FROM batch_jobs WHERE user_id = ? AND provider = ?`
+	args := []interface{}{userID, provider}
+	if before != nil {
+		query += ` AND created_at < ?`
+		args = append(args, *before)
+	}
+	query += ` ORDER BY created_at DESC LIMIT ?`
+	args = append(args, limit)
+	return r.query(query, args...)
+}
+
+// ListByStatus 按提交时间先后列出指定状态的任务
+func (r *BatchJobRepository) ListByStatus(status model.BatchJobStatus) ([]*model.BatchJob, error) {
+	return r.query(`SELECT `+batchJobColumns+` FROM batch_jobs WHERE status = ? ORDER BY created_at ASC`, status)
+}
+
+// MarkSettling 开始结算，仅在任务仍为处理中时更新，保证同一任务只结算一次
+func (r *BatchJobRepository) MarkSettling(id string) (bool, error) {
+	return r.transition(
+		`UPDATE batch_jobs SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		model.BatchJobSettling, time.Now().UTC(), id, model.BatchJobInProgress,
+	)
+}
+
+// ReleaseSettling 结果暂时无法获取时放弃本次结算，记录原因后等待下次重试
+func (r *BatchJobRepository) ReleaseSettling(id, reason string) (bool, error) {
+	return r.transition(
+		`UPDATE batch_jobs SET status = ?, error = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		model.BatchJobInProgress, reason, time.Now().UTC(), id, model.BatchJobSettling,
+	)
+}
+
+// MarkSettled 记录结算完成的条目数与总费用
+func (r *BatchJobRepository) MarkSettled(id string, itemCount int, costMicros int64, at time.Time) (bool, error) {
+	return r.transition(
+		`UPDATE batch_jobs SET status = ?, item_count = ?, cost_micros = ?, error = '', settled_at = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		model.BatchJobSettled, itemCount, costMicros, at, at, id, model.BatchJobSettling,
+	)
+}
+
+// MarkFailed 结果已无法获取，不再重试
+func (r *BatchJobRepository) MarkFailed(id, reason string) (bool, error) {
+	return r.transition(
+		`UPDATE batch_jobs SET status = ?, error = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		model.BatchJobFailed, reason, time.Now().UTC(), id, model.BatchJobSettling,
+	)
+}
+
+func (r *BatchJobRepository) transition(query string, args ...interface{}) (bool, error) {
+	db := database.GetDB()
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *BatchJobRepository) query(query string, args ...interface{}) ([]*model.BatchJob, error) {
+	db := database.GetDB()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*model.BatchJob{}
+	for rows.Next() {
+		job, err := scanBatchJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func scanBatchJob(row rowScanner) (*model.BatchJob, error) {
+	job := &model.BatchJob{}
+	var settledAt sql.NullTime
+	if err := row.Scan(&job.ID, &job.Provider, &job.UpstreamID, &job.UserID, &job.APIKeyID, &job.ChannelID, &job.Model,
+		&job.RateMultiplier, &job.RequestCount, &job.Status, &job.ItemCount, &job.CostMicros, &job.Error,
+		&settledAt, &job.CreatedAt, &job.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if settledAt.Valid {
+		job.SettledAt = &settledAt.Time
+	}
+	return job, nil
+}
@@ -14,11 +14,15 @@ type BillingEventRepositoryInterface interface {
 	Create(event *model.BillingEvent) error
 	GetUsageInWindow(userSubscriptionID string, start, end time.Time) (int64, error)
 	ListByUserID(userID string, limit, offset int) ([]*model.BillingEvent, error)
+	CountByUserID(userID string) (int64, error)
 	ListByRequestLogID(requestLogID string) ([]*model.BillingEvent, error)
+	ListSubscriptionEventsInWindow(userSubscriptionID string, start, end time.Time) ([]*model.BillingEvent, error)
 }
 
 var _ BillingEventRepositoryInterface = (*BillingEventRepository)(nil)
 
+const billingEventColumns = `id, request_log_id, user_id, user_subscription_id, source, event_type, amount_micros, direction, reason, actor, balance_after_micros, created_at`
+
 type BillingEventRepository struct{}
 
 func NewBillingEventRepository() *BillingEventRepository {
@@ -31,8 +35,9 @@ func (r *BillingEventRepository) Create(event *model.BillingEvent) error {
 	event.CreatedAt = time.Now().UTC()
 
 	_, err := db.Exec(
-		`INSERT INTO billing_events (id, request_log_id, user_id, user_subscription_id, source, event_type, amount_micros, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		event.ID, event.RequestLogID, event.UserID, event.UserSubscriptionID, event.Source, event.EventType, event.AmountMicros, event.CreatedAt,
+		`INSERT INTO billing_events (`+billingEventColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.ID, event.RequestLogID, event.UserID, event.UserSubscriptionID, event.Source, event.EventType, event.AmountMicros,
+		event.Direction, event.Reason, event.Actor, event.BalanceAfterMicros, event.CreatedAt,
 	)
 	return err
 }
@@ -56,10 +61,27 @@ func (r *BillingEventRepository) GetUsageInWindow(userSubscriptionID string, sta
 	return chargeSum.Int64 - refundSum.Int64, nil
 }
 
+// ListSubscriptionEventsInWindow 按时间正序返回订阅在窗口内的扣费与退款事件
+func (r *BillingEventRepository) ListSubscriptionEventsInWindow(userSubscriptionID string, start, end time.Time) ([]*model.BillingEvent, error) {
+	db := database.GetDB()
+	rows, err := db.Query(
+		`SELECT `+billingEventColumns+`
+		 FROM billing_events
+		 WHERE user_subscription_id = ? AND source = 'subscription' AND created_at >= ? AND created_at < ?
+		 ORDER BY created_at`,
+		userSubscriptionID, start, end,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBillingEvents(rows)
+}
+
 func (r *BillingEventRepository) ListByUserID(userID string, limit, offset int) ([]*model.BillingEvent, error) {
 	db := database.GetDB()
 	rows, err := db.Query(
-		`SELECT id, request_log_id, user_id, user_subscription_id, source, event_type, amount_micros, created_at 
+		`SELECT `+billingEventColumns+`
 		 FROM billing_events WHERE user_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?`,
 		userID, limit, offset,
 	)
@@ -67,22 +89,21 @@ func (r *BillingEventRepository) ListByUserID(userID string, limit, offset int)
 		return nil, err
 	}
 	defer rows.Close()
+	return scanBillingEvents(rows)
+}
 
-	var events []*model.BillingEvent
-	for rows.Next() {
-		e := &model.BillingEvent{}
-		if err := rows.Scan(&e.ID, &e.RequestLogID, &e.UserID, &e.UserSubscriptionID, &e.Source, &e.EventType, &e.AmountMicros, &e.CreatedAt); err != nil {
-			return nil, err
-		}
-		events = append(events, e)
-	}
-	return events, rows.Err()
+// CountByUserID 用户计费事件总数，用于分页
+func (r *BillingEventRepository) CountByUserID(userID string) (int64, error) {
+	db := database.GetDB()
+	var total int64
+	err := db.QueryRow(`SELECT COUNT(*) FROM billing_events WHERE user_id = ?`, userID).Scan(&total)
+	return total, err
 }
 
 func (r *BillingEventRepository) ListByRequestLogID(requestLogID string) ([]*model.BillingEvent, error) {
 	db := database.GetDB()
 	rows, err := db.Query(
-		`SELECT id, request_log_id, user_id, user_subscription_id, source, event_type, amount_micros, created_at 
+		`SELECT `+billingEventColumns+`
 		 FROM billing_events WHERE request_log_id = ? ORDER BY created_at DESC`,
 		requestLogID,
 	)
@@ -90,13 +111,22 @@ func (r *BillingEventRepository) ListByRequestLogID(requestLogID string) ([]*mod
 		return nil, err
 	}
 	defer rows.Close()
+	return scanBillingEvents(rows)
+}
 
+func scanBillingEvents(rows *sql.Rows) ([]*model.BillingEvent, error) {
 	var events []*model.BillingEvent
 	for rows.Next() {
 		e := &model.BillingEvent{}
-		if err := rows.Scan(&e.ID, &e.RequestLogID, &e.UserID, &e.UserSubscriptionID, &e.Source, &e.EventType, &e.AmountMicros, &e.CreatedAt); err != nil {
+		var balanceAfter sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.RequestLogID, &e.UserID, &e.UserSubscriptionID, &e.Source, &e.EventType, &e.AmountMicros,
+			&e.Direction, &e.Reason, &e.Actor, &balanceAfter, &e.CreatedAt); err != nil {
 			return nil, err
 		}
+		if balanceAfter.Valid {
+			v := balanceAfter.Int64
+			e.BalanceAfterMicros = &v
+		}
 		events = append(events, e)
 	}
 	return events, rows.Err()
@@ -22,6 +22,7 @@ type ChannelRepositoryInterface interface {
 	SetGroups(id string, groupIDs []string) error
 	GetGroupIDs(channelID string) ([]string, error)
 	GetGroupIDsByChannelIDs(channelIDs []string) (map[string][]string, error)
+	UpdateModelsBatch(channels []*model.Channel) error
 }
 
 var _ ChannelRepositoryInterface = (*ChannelRepository)(nil)
@@ -38,12 +39,17 @@ func (r *ChannelRepository) Create(channel *model.Channel) error {
 	now := time.Now().UTC()
 	channel.CreatedAt = now
 	channel.UpdatedAt = now
+	channel.Version = 1
 
-	_, err := db.Exec(
-		`INSERT INTO channels (id, type, endpoint, name, base_url, api_key, enabled, weight, priority, model_whitelist, simulate_cli, models_json, headers_json, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		channel.ID, channel.Type, channel.Endpoint, channel.Name, channel.BaseURL, channel.APIKey,
-		channel.Enabled, channel.Weight, channel.Priority, channel.ModelWhitelist, channel.SimulateCLI, channel.ModelsJSON, channel.HeadersJSON,
+	apiKey, apiKeysJSON, err := sealChannelSecrets(channel)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(
+		`INSERT INTO channels (id, type, endpoint, name, base_url, api_key, enabled, weight, priority, model_whitelist, simulate_cli, models_json, headers_json, anthropic_beta_policy_json, header_policy_json, api_keys_json, key_strategy, translation_mode, federation_issuer, dns_policy_json, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		channel.ID, channel.Type, channel.Endpoint, channel.Name, channel.BaseURL, apiKey,
+		channel.Enabled, channel.Weight, channel.Priority, channel.ModelWhitelist, channel.SimulateCLI, channel.ModelsJSON, channel.HeadersJSON, channel.AnthropicBetaPolicyJSON, channel.HeaderPolicyJSON, apiKeysJSON, channel.KeyStrategy, channel.TranslationMode, channel.FederationIssuer, channel.DNSPolicyJSON,
 		channel.CreatedAt, channel.UpdatedAt,
 	)
 	return err
@@ -54,13 +60,13 @@ func (r *ChannelRepository) GetByID(id string) (*model.Channel, error) {
 	channel := &model.Channel{}
 
 	err := db.QueryRow(
-		`SELECT id, type, endpoint, name, base_url, api_key, enabled, weight, priority, model_whitelist, simulate_cli, models_json, headers_json, created_at, updated_at
+		`SELECT id, type, endpoint, name, base_url, api_key, enabled, weight, priority, model_whitelist, simulate_cli, models_json, headers_json, anthropic_beta_policy_json, header_policy_json, api_keys_json, key_strategy, translation_mode, federation_issuer, dns_policy_json, version, created_at, updated_at
 		 FROM channels WHERE id = ?`,
 		id,
 	).Scan(
 		&channel.ID, &channel.Type, &channel.Endpoint, &channel.Name, &channel.BaseURL, &channel.APIKey,
-		&channel.Enabled, &channel.Weight, &channel.Priority, &channel.ModelWhitelist, &channel.SimulateCLI, &channel.ModelsJSON, &channel.HeadersJSON,
-		&channel.CreatedAt, &channel.UpdatedAt,
+		&channel.Enabled, &channel.Weight, &channel.Priority, &channel.ModelWhitelist, &channel.SimulateCLI, &channel.ModelsJSON, &channel.HeadersJSON, &channel.AnthropicBetaPolicyJSON, &channel.HeaderPolicyJSON, &channel.APIKeysJSON, &channel.KeyStrategy, &channel.TranslationMode, &channel.FederationIssuer, &channel.DNSPolicyJSON,
+		&channel.Version, &channel.CreatedAt, &channel.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -69,13 +75,16 @@ func (r *ChannelRepository) GetByID(id string) (*model.Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := openChannelSecrets(channel); err != nil {
+		return nil, err
+	}
 	return channel, nil
 }
 
 func (r *ChannelRepository) List() ([]*model.Channel, error) {
 	db := database.GetDB()
 	rows, err := db.Query(
-		`SELECT id, type, endpoint, name, base_url, api_key, enabled, weight, priority, model_whitelist, simulate_cli, models_json, headers_json, created_at, updated_at
+		`SELECT id, type, endpoint, name, base_url, api_key, enabled, weight, priority, model_whitelist, simulate_cli, models_json, headers_json, anthropic_beta_policy_json, header_policy_json, api_keys_json, key_strategy, translation_mode, federation_issuer, dns_policy_json, version, created_at, updated_at
 		 FROM channels ORDER BY priority ASC, created_at DESC`,
 	)
 	if err != nil {
@@ -88,12 +97,15 @@ func (r *ChannelRepository) List() ([]*model.Channel, error) {
 		channel := &model.Channel{}
 		err := rows.Scan(
 			&channel.ID, &channel.Type, &channel.Endpoint, &channel.Name, &channel.BaseURL, &channel.APIKey,
-			&channel.Enabled, &channel.Weight, &channel.Priority, &channel.ModelWhitelist, &channel.SimulateCLI, &channel.ModelsJSON, &channel.HeadersJSON,
-			&channel.CreatedAt, &channel.UpdatedAt,
+			&channel.Enabled, &channel.Weight, &channel.Priority, &channel.ModelWhitelist, &channel.SimulateCLI, &channel.ModelsJSON, &channel.HeadersJSON, &channel.AnthropicBetaPolicyJSON, &channel.HeaderPolicyJSON, &channel.APIKeysJSON, &channel.KeyStrategy, &channel.TranslationMode, &channel.FederationIssuer, &channel.DNSPolicyJSON,
+			&channel.Version, &channel.CreatedAt, &channel.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		if err := openChannelSecrets(channel); err != nil {
+			return nil, err
+		}
 		channels = append(channels, channel)
 	}
 	return channels, rows.Err()
@@ -102,7 +114,7 @@ func (r *ChannelRepository) List() ([]*model.Channel, error) {
 func (r *ChannelRepository) ListEnabled() ([]*model.Channel, error) {
 	db := database.GetDB()
 	rows, err := db.Query(
-		`SELECT id, type, endpoint, name, base_url, api_key, enabled, weight, priority, model_whitelist, simulate_cli, models_json, headers_json, created_at, updated_at
+		`SELECT id, type, endpoint, name, base_url, api_key, enabled, weight, priority, model_whitelist, simulate_cli, models_json, headers_json, anthropic_beta_policy_json, header_policy_json, api_keys_json, key_strategy, translation_mode, federation_issuer, dns_policy_json, version, created_at, updated_at
 		 FROM channels WHERE enabled = 1 ORDER BY priority ASC, weight DESC`,
 	)
 	if err != nil {
@@ -115,28 +127,75 @@ func (r *ChannelRepository) ListEnabled() ([]*model.Channel, error) {
 		channel := &model.Channel{}
 		err := rows.Scan(
 			&channel.ID, &channel.Type, &channel.Endpoint, &channel.Name, &channel.BaseURL, &channel.APIKey,
-			&channel.Enabled, &channel.Weight, &channel.Priority, &channel.ModelWhitelist, &channel.SimulateCLI, &channel.ModelsJSON, &channel.HeadersJSON,
-			&channel.CreatedAt, &channel.UpdatedAt,
+			&channel.Enabled, &channel.Weight, &channel.Priority, &channel.ModelWhitelist, &channel.SimulateCLI, &channel.ModelsJSON, &channel.HeadersJSON, &channel.AnthropicBetaPolicyJSON, &channel.HeaderPolicyJSON, &channel.APIKeysJSON, &channel.KeyStrategy, &channel.TranslationMode, &channel.FederationIssuer, &channel.DNSPolicyJSON,
+			&channel.Version, &channel.CreatedAt, &channel.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		if err := openChannelSecrets(channel); err != nil {
+			return nil, err
+		}
 		channels = append(channels, channel)
 	}
 	return channels, rows.Err()
 }
 
+// Update 更新渠道；channel.Version 为读取时的版本号，与数据库不一致时返回 ErrVersionConflict
 func (r *ChannelRepository) Update(channel *model.Channel) error {
 	db := database.GetDB()
 	channel.UpdatedAt = time.Now().UTC()
 
-	_, err := db.Exec(
-		`UPDATE channels SET type = ?, endpoint = ?, name = ?, base_url = ?, api_key = ?, enabled = ?, weight = ?, priority = ?, model_whitelist = ?, simulate_cli = ?, models_json = ?, headers_json = ?, updated_at = ?
-		 WHERE id = ?`,
-		channel.Type, channel.Endpoint, channel.Name, channel.BaseURL, channel.APIKey, channel.Enabled, channel.Weight, channel.Priority, channel.ModelWhitelist, channel.SimulateCLI, channel.ModelsJSON, channel.HeadersJSON, channel.UpdatedAt,
-		channel.ID,
+	apiKey, apiKeysJSON, err := sealChannelSecrets(channel)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(
+		`UPDATE channels SET type = ?, endpoint = ?, name = ?, base_url = ?, api_key = ?, enabled = ?, weight = ?, priority = ?, model_whitelist = ?, simulate_cli = ?, models_json = ?, headers_json = ?, anthropic_beta_policy_json = ?, header_policy_json = ?, api_keys_json = ?, key_strategy = ?, translation_mode = ?, federation_issuer = ?, dns_policy_json = ?, updated_at = ?, version = version + 1
+		 WHERE id = ? AND version = ?`,
+		channel.Type, channel.Endpoint, channel.Name, channel.BaseURL, apiKey, channel.Enabled, channel.Weight, channel.Priority, channel.ModelWhitelist, channel.SimulateCLI, channel.ModelsJSON, channel.HeadersJSON, channel.AnthropicBetaPolicyJSON, channel.HeaderPolicyJSON, apiKeysJSON, channel.KeyStrategy, channel.TranslationMode, channel.FederationIssuer, channel.DNSPolicyJSON, channel.UpdatedAt,
+		channel.ID, channel.Version,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := checkVersionUpdate(result); err != nil {
+		return err
+	}
+	channel.Version++
+	return nil
+}
+
+// UpdateModelsBatch 在同一事务内更新多个渠道的 models_json，任一渠道版本不匹配则全部回滚
+func (r *ChannelRepository) UpdateModelsBatch(channels []*model.Channel) error {
+	db := database.GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, channel := range channels {
+		result, err := tx.Exec(
+			`UPDATE channels SET models_json = ?, updated_at = ?, version = version + 1 WHERE id = ? AND version = ?`,
+			channel.ModelsJSON, now, channel.ID, channel.Version,
+		)
+		if err != nil {
+			return err
+		}
+		if err := checkVersionUpdate(result); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		channel.UpdatedAt = now
+		channel.Version++
+	}
+	return nil
 }
 
 func (r *ChannelRepository) Delete(id string) error {
@@ -147,7 +206,14 @@ func (r *ChannelRepository) Delete(id string) error {
 
 func (r *ChannelRepository) SetEnabled(id string, enabled bool) error {
 	db := database.GetDB()
-	_, err := db.Exec(`UPDATE channels SET enabled = ?, updated_at = ? WHERE id = ?`, enabled, time.Now().UTC(), id)
+	_, err := db.Exec(`UPDATE channels SET enabled = ?, updated_at = ?, version = version + 1 WHERE id = ?`, enabled, time.Now().UTC(), id)
+	return err
+}
+
+// SetWeight 仅更新渠道权重（容量建议自动调整使用）
+func (r *ChannelRepository) SetWeight(id string, weight int) error {
+	db := database.GetDB()
+	_, err := db.Exec(`UPDATE channels SET weight = ?, updated_at = ?, version = version + 1 WHERE id = ?`, weight, time.Now().UTC(), id)
 	return err
 }
 
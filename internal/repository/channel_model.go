@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"database/sql"
+	"sort"
 	"time"
 
 	"ampmanager/internal/database"
@@ -15,39 +17,90 @@ func NewChannelModelRepository() *ChannelModelRepository {
 	return &ChannelModelRepository{}
 }
 
-func (r *ChannelModelRepository) ReplaceModels(channelID string, models []model.ChannelModel2) error {
+// SyncModels 按上游返回的模型列表同步：新增未记录的模型，刷新已有模型的显示名与最近出现时间，
+// 上游不再返回的模型只标记 removed_at 而不删除。返回新增、新标记移除与重新出现的模型
+func (r *ChannelModelRepository) SyncModels(channelID string, models []model.ChannelModel2) (added, removed, restored []string, err error) {
 	db := database.GetDB()
 	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
+	defer tx.Rollback()
 
-	_, err = tx.Exec(`DELETE FROM channel_models WHERE channel_id = ?`, channelID)
+	rows, err := tx.Query(`SELECT model_id, removed_at FROM channel_models WHERE channel_id = ?`, channelID)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return nil, nil, nil, err
+	}
+	existing := make(map[string]bool) // model_id -> 是否已标记移除
+	for rows.Next() {
+		var modelID string
+		var removedAt sql.NullTime
+		if err := rows.Scan(&modelID, &removedAt); err != nil {
+			rows.Close()
+			return nil, nil, nil, err
+		}
+		existing[modelID] = removedAt.Valid
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, err
 	}
 
+	now := time.Now().UTC()
+	seen := make(map[string]bool, len(models))
 	for _, m := range models {
-		m.ID = uuid.New().String()
-		m.CreatedAt = time.Now().UTC()
+		if m.ModelID == "" || seen[m.ModelID] {
+			continue
+		}
+		seen[m.ModelID] = true
+
+		wasRemoved, ok := existing[m.ModelID]
+		if !ok {
+			_, err = tx.Exec(
+				`INSERT INTO channel_models (id, channel_id, model_id, display_name, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?, ?)`,
+				uuid.New().String(), channelID, m.ModelID, m.DisplayName, now, now,
+			)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			added = append(added, m.ModelID)
+			continue
+		}
 		_, err = tx.Exec(
-			`INSERT INTO channel_models (id, channel_id, model_id, display_name, created_at) VALUES (?, ?, ?, ?, ?)`,
-			m.ID, channelID, m.ModelID, m.DisplayName, m.CreatedAt,
+			`UPDATE channel_models SET display_name = ?, last_seen_at = ?, removed_at = NULL WHERE channel_id = ? AND model_id = ?`,
+			m.DisplayName, now, channelID, m.ModelID,
 		)
 		if err != nil {
-			tx.Rollback()
-			return err
+			return nil, nil, nil, err
+		}
+		if wasRemoved {
+			restored = append(restored, m.ModelID)
 		}
 	}
 
-	return tx.Commit()
+	for modelID, wasRemoved := range existing {
+		if seen[modelID] || wasRemoved {
+			continue
+		}
+		if _, err = tx.Exec(`UPDATE channel_models SET removed_at = ? WHERE channel_id = ? AND model_id = ?`, now, channelID, modelID); err != nil {
+			return nil, nil, nil, err
+		}
+		removed = append(removed, modelID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, nil, err
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(restored)
+	return added, removed, restored, nil
 }
 
 func (r *ChannelModelRepository) GetByChannelID(channelID string) ([]*model.ChannelModel2, error) {
 	db := database.GetDB()
 	rows, err := db.Query(
-		`SELECT id, channel_id, model_id, display_name, created_at FROM channel_models WHERE channel_id = ? ORDER BY model_id`,
+		`SELECT id, channel_id, model_id, display_name, created_at, last_seen_at, removed_at FROM channel_models WHERE channel_id = ? ORDER BY model_id`,
 		channelID,
 	)
 	if err != nil {
@@ -58,9 +111,16 @@ func (r *ChannelModelRepository) GetByChannelID(channelID string) ([]*model.Chan
 	var models []*model.ChannelModel2
 	for rows.Next() {
 		m := &model.ChannelModel2{}
-		if err := rows.Scan(&m.ID, &m.ChannelID, &m.ModelID, &m.DisplayName, &m.CreatedAt); err != nil {
+		var lastSeenAt, removedAt sql.NullTime
+		if err := rows.Scan(&m.ID, &m.ChannelID, &m.ModelID, &m.DisplayName, &m.CreatedAt, &lastSeenAt, &removedAt); err != nil {
 			return nil, err
 		}
+		if lastSeenAt.Valid {
+			m.LastSeenAt = &lastSeenAt.Time
+		}
+		if removedAt.Valid {
+			m.RemovedAt = &removedAt.Time
+		}
 		models = append(models, m)
 	}
 	return models, rows.Err()
@@ -72,7 +132,7 @@ func (r *ChannelModelRepository) ListAllWithChannel() ([]*model.AvailableModel,
 		SELECT cm.model_id, cm.display_name, c.type, c.name, c.model_whitelist, c.models_json
 		FROM channel_models cm
 		JOIN channels c ON cm.channel_id = c.id
-		WHERE c.enabled = 1
+		WHERE c.enabled = 1 AND cm.removed_at IS NULL
 		ORDER BY c.type, cm.model_id
 	`)
 	if err != nil {
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+)
+
+const channelOAuthTokenColumns = `channel_id, access_token, refresh_token, expires_at, scope, last_refresh_at, last_error, updated_at`
+
+// ChannelOAuthRepository claude_oauth 渠道的令牌存储，令牌的加解密由调用方负责
+type ChannelOAuthRepository struct{}
+
+func NewChannelOAuthRepository() *ChannelOAuthRepository {
+	return &ChannelOAuthRepository{}
+}
+
+// Get 获取渠道的令牌，未配置时返回 nil
+func (r *ChannelOAuthRepository) Get(channelID string) (*model.ChannelOAuthToken, error) {
+	db := database.GetDB()
+	token, err := scanChannelOAuthToken(db.QueryRow(`SELECT `+channelOAuthTokenColumns+` FROM channel_oauth_tokens WHERE channel_id = ?`, channelID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
+
+// Save 写入渠道的令牌并清空刷新错误
+func (r *ChannelOAuthRepository) Save(token *model.ChannelOAuthToken) error {
+	db := database.GetDB()
+	token.UpdatedAt = time.Now().UTC()
+	token.LastError = ""
+	_, err := db.Exec(
+		`INSERT INTO channel_oauth_tokens (`+channelOAuthTokenColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(channel_id) DO UPDATE SET access_token = excluded.access_token, refresh_token = excluded.refresh_token,
+		 expires_at = excluded.expires_at, scope = excluded.scope, last_refresh_at = excluded.last_refresh_at,
+		 last_error = excluded.last_error, updated_at = excluded.updated_at`,
+		token.ChannelID, token.AccessToken, token.RefreshToken, token.ExpiresAt, token.Scope, token.LastRefreshAt, token.LastError, token.UpdatedAt,
+	)
+	return err
+}
+
+// SetLastError 记录刷新失败的原因，令牌本身保持不变
+func (r *ChannelOAuthRepository) SetLastError(channelID, message string) error {
+	db := database.GetDB()
+	_, err := db.Exec(`UPDATE channel_oauth_tokens SET last_error = ?, updated_at = ? WHERE channel_id = ?`, message, time.Now().UTC(), channelID)
+	return err
+}
+
+// ListExpiringBefore 列出访问令牌在 before 之前过期（或过期时间未知）的渠道令牌
+func (r *ChannelOAuthRepository) ListExpiringBefore(before time.Time) ([]*model.ChannelOAuthToken, error) {
+	db := database.GetDB()
+	rows, err := db.Query(
+		`SELECT `+channelOAuthTokenColumns+` FROM channel_oauth_tokens
+		 WHERE refresh_token != '' AND (expires_at IS NULL OR expires_at <= ?)`,
+		before,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*model.ChannelOAuthToken
+	for rows.Next() {
+		token, err := scanChannelOAuthToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func scanChannelOAuthToken(row rowScanner) (*model.ChannelOAuthToken, error) {
+	token := &model.ChannelOAuthToken{}
+	var expiresAt, lastRefreshAt sql.NullTime
+	if err := row.Scan(&token.ChannelID, &token.AccessToken, &token.RefreshToken, &expiresAt, &token.Scope,
+		&lastRefreshAt, &token.LastError, &token.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastRefreshAt.Valid {
+		token.LastRefreshAt = &lastRefreshAt.Time
+	}
+	return token, nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+const channelTemplateColumns = `id, name, description, type, endpoint, base_url, weight, priority, model_whitelist, simulate_cli, models_json, headers_json, group_ids_json, created_at, updated_at`
+
+type ChannelTemplateRepository struct{}
+
+func NewChannelTemplateRepository() *ChannelTemplateRepository {
+	return &ChannelTemplateRepository{}
+}
+
+func (r *ChannelTemplateRepository) Create(tpl *model.ChannelTemplate) error {
+	db := database.GetDB()
+	modelsJSON, headersJSON, groupIDsJSON, err := marshalChannelTemplate(tpl)
+	if err != nil {
+		return err
+	}
+	tpl.ID = uuid.New().String()
+	now := time.Now().UTC()
+	tpl.CreatedAt = now
+	tpl.UpdatedAt = now
+
+	_, err = db.Exec(
+		`INSERT INTO channel_templates (`+channelTemplateColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		tpl.ID, tpl.Name, tpl.Description, tpl.Type, tpl.Endpoint, tpl.BaseURL, tpl.Weight, tpl.Priority,
+		tpl.ModelWhitelist, tpl.SimulateCLI, modelsJSON, headersJSON, groupIDsJSON, tpl.CreatedAt, tpl.UpdatedAt,
+	)
+	return err
+}
+
+func (r *ChannelTemplateRepository) GetByID(id string) (*model.ChannelTemplate, error) {
+	db := database.GetDB()
+	row := db.QueryRow(`SELECT `+channelTemplateColumns+` FROM channel_templates WHERE id = ?`, id)
+	tpl, err := scanChannelTemplate(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return tpl, err
+}
+
+func (r *ChannelTemplateRepository) List() ([]*model.ChannelTemplate, error) {
+	db := database.GetDB()
+	rows, err := db.Query(`SELECT ` + channelTemplateColumns + ` FROM channel_templates ORDER BY name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*model.ChannelTemplate
+	for rows.Next() {
+		tpl, err := scanChannelTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tpl)
+	}
+	return templates, rows.Err()
+}
+
+func (r *ChannelTemplateRepository) ExistsByName(name, excludeID string) (bool, error) {
+	db := database.GetDB()
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM channel_templates WHERE name = ? AND id != ?`, name, excludeID).Scan(&count)
+	return count > 0, err
+}
+
+func (r *ChannelTemplateRepository) Update(tpl *model.ChannelTemplate) error {
+	db := database.GetDB()
+	modelsJSON, headersJSON, groupIDsJSON, err := marshalChannelTemplate(tpl)
+	if err != nil {
+		return err
+	}
+	tpl.UpdatedAt = time.Now().UTC()
+	_, err = db.Exec(
+		`UPDATE channel_templates SET name = ?, description = ?, type = ?, endpoint = ?, base_url = ?, weight = ?, priority = ?,
+		 model_whitelist = ?, simulate_cli = ?, models_json = ?, headers_json = ?, group_ids_json = ?, updated_at = ? WHERE id = ?`,
+		tpl.Name, tpl.Description, tpl.Type, tpl.Endpoint, tpl.BaseURL, tpl.Weight, tpl.Priority,
+		tpl.ModelWhitelist, tpl.SimulateCLI, modelsJSON, headersJSON, groupIDsJSON, tpl.UpdatedAt, tpl.ID,
+	)
+	return err
+}
+
+func (r *ChannelTemplateRepository) Delete(id string) error {
+	db := database.GetDB()
+	_, err := db.Exec(`DELETE FROM channel_templates WHERE id = ?`, id)
+	return err
+}
+
+func marshalChannelTemplate(tpl *model.ChannelTemplate) (string, string, string, error) {
+	models, headers, groupIDs := tpl.Models, tpl.Headers, tpl.GroupIDs
+	if models == nil {
+		models = []model.ChannelModel{}
+	}
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	if groupIDs == nil {
+		groupIDs = []string{}
+	}
+	modelsJSON, err := json.Marshal(models)
+	if err != nil {
+		return "", "", "", err
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return "", "", "", err
+	}
+	groupIDsJSON, err := json.Marshal(groupIDs)
+	if err != nil {
+		return "", "", "", err
+	}
+	return string(modelsJSON), string(headersJSON), string(groupIDsJSON), nil
+}
+
+func scanChannelTemplate(row rowScanner) (*model.ChannelTemplate, error) {
+	tpl := &model.ChannelTemplate{}
+	var modelsJSON, headersJSON, groupIDsJSON string
+	if err := row.Scan(
+		&tpl.ID, &tpl.Name, &tpl.Description, &tpl.Type, &tpl.Endpoint, &tpl.BaseURL, &tpl.Weight, &tpl.Priority,
+		&tpl.ModelWhitelist, &tpl.SimulateCLI, &modelsJSON, &headersJSON, &groupIDsJSON, &tpl.CreatedAt, &tpl.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(modelsJSON), &tpl.Models)
+	_ = json.Unmarshal([]byte(headersJSON), &tpl.Headers)
+	_ = json.Unmarshal([]byte(groupIDsJSON), &tpl.GroupIDs)
+	if tpl.Models == nil {
+		tpl.Models = []model.ChannelModel{}
+	}
+	if tpl.Headers == nil {
+		tpl.Headers = map[string]string{}
+	}
+	if tpl.GroupIDs == nil {
+		tpl.GroupIDs = []string{}
+	}
+	return tpl, nil
+}
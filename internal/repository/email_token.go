@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+)
+
+type EmailTokenRepository struct{}
+
+func NewEmailTokenRepository() *EmailTokenRepository {
+	return &EmailTokenRepository{}
+}
+
+// Create 保存令牌，同时清理已过期的令牌
+func (r *EmailTokenRepository) Create(token *model.EmailToken) error {
+	db := database.GetDB()
+	now := time.Now().UTC()
+	if _, err := db.Exec(`DELETE FROM user_email_tokens WHERE expires_at < ?`, now); err != nil {
+		return err
+	}
+	token.CreatedAt = now
+	_, err := db.Exec(
+		`INSERT INTO user_email_tokens (token_hash, user_id, purpose, email, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		token.TokenHash, token.UserID, token.Purpose, token.Email, token.ExpiresAt.UTC(), token.CreatedAt,
+	)
+	return err
+}
+
+// Consume 将未使用且未过期的令牌标记为已使用并返回；令牌无效时返回 nil
+func (r *EmailTokenRepository) Consume(tokenHash, purpose string) (*model.EmailToken, error) {
+	db := database.GetDB()
+	now := time.Now().UTC()
+	result, err := db.Exec(
+		`UPDATE user_email_tokens SET used_at = ? WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?`,
+		now, tokenHash, purpose, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return nil, err
+	}
+
+	token := &model.EmailToken{}
+	var usedAt sql.NullTime
+	err = db.QueryRow(
+		`SELECT token_hash, user_id, purpose, email, expires_at, used_at, created_at FROM user_email_tokens WHERE token_hash = ?`,
+		tokenHash,
+	).Scan(&token.TokenHash, &token.UserID, &token.Purpose, &token.Email, &token.ExpiresAt, &usedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
+
+// InvalidateUser 作废用户某一用途的全部未使用令牌
+func (r *EmailTokenRepository) InvalidateUser(userID, purpose string) error {
+	db := database.GetDB()
+	_, err := db.Exec(
+		`UPDATE user_email_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL`,
+		time.Now().UTC(), userID, purpose,
+	)
+	return err
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+)
+
+type FeatureFlagRepository struct{}
+
+func NewFeatureFlagRepository() *FeatureFlagRepository {
+	return &FeatureFlagRepository{}
+}
+
+const featureFlagColumns = `key, description, enabled, group_ids_json, rollout_percent, created_at, updated_at`
+
+func (r *FeatureFlagRepository) List() ([]*model.FeatureFlag, error) {
+	db := database.GetDB()
+	rows, err := db.Query(`SELECT ` + featureFlagColumns + ` FROM feature_flags ORDER BY key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []*model.FeatureFlag
+	for rows.Next() {
+		flag, err := scanFeatureFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+	return flags, rows.Err()
+}
+
+func (r *FeatureFlagRepository) GetByKey(key string) (*model.FeatureFlag, error) {
+	db := database.GetDB()
+	flag, err := scanFeatureFlag(db.QueryRow(`SELECT `+featureFlagColumns+` FROM feature_flags WHERE key = ?`, key))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return flag, err
+}
+
+// Upsert 创建或覆盖开关，保留原创建时间
+func (r *FeatureFlagRepository) Upsert(flag *model.FeatureFlag) error {
+	db := database.GetDB()
+	groupIDsJSON, err := json.Marshal(flag.GroupIDs)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if flag.CreatedAt.IsZero() {
+		flag.CreatedAt = now
+	}
+	flag.UpdatedAt = now
+
+	_, err = db.Exec(`
+		INSERT INTO feature_flags (key, description, enabled, group_ids_json, rollout_percent, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			description = excluded.description,
+			enabled = excluded.enabled,
+			group_ids_json = excluded.group_ids_json,
+			rollout_percent = excluded.rollout_percent,
+			updated_at = excluded.updated_at`,
+		flag.Key, flag.Description, flag.Enabled, string(groupIDsJSON), flag.RolloutPercent, flag.CreatedAt, flag.UpdatedAt,
+	)
+	return err
+}
+
+func (r *FeatureFlagRepository) Delete(key string) (bool, error) {
+	db := database.GetDB()
+	result, err := db.Exec(`DELETE FROM feature_flags WHERE key = ?`, key)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func scanFeatureFlag(row rowScanner) (*model.FeatureFlag, error) {
+	flag := &model.FeatureFlag{}
+	var groupIDsJSON string
+	if err := row.Scan(&flag.Key, &flag.Description, &flag.Enabled, &groupIDsJSON, &flag.RolloutPercent, &flag.CreatedAt, &flag.UpdatedAt); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(groupIDsJSON), &flag.GroupIDs)
+	if flag.GroupIDs == nil {
+		flag.GroupIDs = []string{}
+	}
+	return flag, nil
+}
@@ -22,6 +22,12 @@ type GroupRepositoryInterface interface {
 	CountUsers(groupID string) (int, error)
 	CountChannels(groupID string) (int, error)
 	GetMinRateMultiplierByUserID(userID string) (float64, []string, error)
+	GetMaxRequestCostByUserID(userID string) (int64, error)
+	GetPipelineByUserID(userID string) (string, error)
+	ListAdmins(groupID string) ([]*model.GroupAdmin, error)
+	AddAdmin(groupID, userID, createdBy string) error
+	RemoveAdmin(groupID, userID string) (bool, error)
+	GetAdminGroupIDs(userID string) ([]string, error)
 }
 
 var _ GroupRepositoryInterface = (*GroupRepository)(nil)
@@ -38,13 +44,14 @@ func (r *GroupRepository) Create(group *model.Group) error {
 	now := time.Now().UTC()
 	group.CreatedAt = now
 	group.UpdatedAt = now
+	group.Version = 1
 	if group.RateMultiplier == 0 {
 		group.RateMultiplier = 1.0
 	}
 
 	_, err := db.Exec(
-		`INSERT INTO groups (id, name, description, rate_multiplier, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		group.ID, group.Name, group.Description, group.RateMultiplier, group.CreatedAt, group.UpdatedAt,
+		`INSERT INTO groups (id, name, description, rate_multiplier, max_request_cost_micros, monthly_budget_micros, system_prompt, pipeline_json, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		group.ID, group.Name, group.Description, group.RateMultiplier, group.MaxRequestCostMicros, group.MonthlyBudgetMicros, group.SystemPrompt, group.PipelineJSON, group.CreatedAt, group.UpdatedAt,
 	)
 	return err
 }
@@ -53,8 +60,8 @@ func (r *GroupRepository) GetByID(id string) (*model.Group, error) {
 	db := database.GetDB()
 	group := &model.Group{}
 	err := db.QueryRow(
-		`SELECT id, name, description, rate_multiplier, created_at, updated_at FROM groups WHERE id = ?`, id,
-	).Scan(&group.ID, &group.Name, &group.Description, &group.RateMultiplier, &group.CreatedAt, &group.UpdatedAt)
+		`SELECT id, name, description, rate_multiplier, max_request_cost_micros, monthly_budget_micros, system_prompt, pipeline_json, version, created_at, updated_at FROM groups WHERE id = ?`, id,
+	).Scan(&group.ID, &group.Name, &group.Description, &group.RateMultiplier, &group.MaxRequestCostMicros, &group.MonthlyBudgetMicros, &group.SystemPrompt, &group.PipelineJSON, &group.Version, &group.CreatedAt, &group.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -69,7 +76,7 @@ func (r *GroupRepository) GetByIDs(ids []string) (map[string]*model.Group, error
 
 	db := database.GetDB()
 	placeholders := strings.TrimRight(strings.Repeat("?,", len(ids)), ",")
-	query := `SELECT id, name, description, rate_multiplier, created_at, updated_at FROM groups WHERE id IN (` + placeholders + `)`
+	query := `SELECT id, name, description, rate_multiplier, max_request_cost_micros, monthly_budget_micros, system_prompt, pipeline_json, version, created_at, updated_at FROM groups WHERE id IN (` + placeholders + `)`
 
 	args := make([]interface{}, len(ids))
 	for i, id := range ids {
@@ -84,7 +91,7 @@ func (r *GroupRepository) GetByIDs(ids []string) (map[string]*model.Group, error
 
 	for rows.Next() {
 		group := &model.Group{}
-		if err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.RateMultiplier, &group.CreatedAt, &group.UpdatedAt); err != nil {
+		if err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.RateMultiplier, &group.MaxRequestCostMicros, &group.MonthlyBudgetMicros, &group.SystemPrompt, &group.PipelineJSON, &group.Version, &group.CreatedAt, &group.UpdatedAt); err != nil {
 			return nil, err
 		}
 		result[group.ID] = group
@@ -96,8 +103,8 @@ func (r *GroupRepository) GetByName(name string) (*model.Group, error) {
 	db := database.GetDB()
 	group := &model.Group{}
 	err := db.QueryRow(
-		`SELECT id, name, description, rate_multiplier, created_at, updated_at FROM groups WHERE name = ?`, name,
-	).Scan(&group.ID, &group.Name, &group.Description, &group.RateMultiplier, &group.CreatedAt, &group.UpdatedAt)
+		`SELECT id, name, description, rate_multiplier, max_request_cost_micros, monthly_budget_micros, system_prompt, pipeline_json, version, created_at, updated_at FROM groups WHERE name = ?`, name,
+	).Scan(&group.ID, &group.Name, &group.Description, &group.RateMultiplier, &group.MaxRequestCostMicros, &group.MonthlyBudgetMicros, &group.SystemPrompt, &group.PipelineJSON, &group.Version, &group.CreatedAt, &group.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -107,7 +114,7 @@ func (r *GroupRepository) GetByName(name string) (*model.Group, error) {
 func (r *GroupRepository) List() ([]*model.Group, error) {
 	db := database.GetDB()
 	rows, err := db.Query(
-		`SELECT id, name, description, rate_multiplier, created_at, updated_at FROM groups ORDER BY created_at DESC`,
+		`SELECT id, name, description, rate_multiplier, max_request_cost_micros, monthly_budget_micros, system_prompt, pipeline_json, version, created_at, updated_at FROM groups ORDER BY created_at DESC`,
 	)
 	if err != nil {
 		return nil, err
@@ -117,7 +124,7 @@ func (r *GroupRepository) List() ([]*model.Group, error) {
 	var groups []*model.Group
 	for rows.Next() {
 		group := &model.Group{}
-		if err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.RateMultiplier, &group.CreatedAt, &group.UpdatedAt); err != nil {
+		if err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.RateMultiplier, &group.MaxRequestCostMicros, &group.MonthlyBudgetMicros, &group.SystemPrompt, &group.PipelineJSON, &group.Version, &group.CreatedAt, &group.UpdatedAt); err != nil {
 			return nil, err
 		}
 		groups = append(groups, group)
@@ -125,20 +132,29 @@ func (r *GroupRepository) List() ([]*model.Group, error) {
 	return groups, rows.Err()
 }
 
+// Update 更新分组；group.Version 为读取时的版本号，与数据库不一致时返回 ErrVersionConflict
 func (r *GroupRepository) Update(group *model.Group) error {
 	db := database.GetDB()
 	group.UpdatedAt = time.Now().UTC()
-	_, err := db.Exec(
-		`UPDATE groups SET name = ?, description = ?, rate_multiplier = ?, updated_at = ? WHERE id = ?`,
-		group.Name, group.Description, group.RateMultiplier, group.UpdatedAt, group.ID,
+	result, err := db.Exec(
+		`UPDATE groups SET name = ?, description = ?, rate_multiplier = ?, max_request_cost_micros = ?, monthly_budget_micros = ?, system_prompt = ?, pipeline_json = ?, updated_at = ?, version = version + 1 WHERE id = ? AND version = ?`,
+		group.Name, group.Description, group.RateMultiplier, group.MaxRequestCostMicros, group.MonthlyBudgetMicros, group.SystemPrompt, group.PipelineJSON, group.UpdatedAt, group.ID, group.Version,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := checkVersionUpdate(result); err != nil {
+		return err
+	}
+	group.Version++
+	return nil
 }
 
 func (r *GroupRepository) Delete(id string) error {
 	db := database.GetDB()
 	_, _ = db.Exec(`DELETE FROM user_groups WHERE group_id = ?`, id)
 	_, _ = db.Exec(`DELETE FROM channel_groups WHERE group_id = ?`, id)
+	_, _ = db.Exec(`DELETE FROM group_admins WHERE group_id = ?`, id)
 	_, err := db.Exec(`DELETE FROM groups WHERE id = ?`, id)
 	return err
 }
@@ -192,3 +208,134 @@ func (r *GroupRepository) GetMinRateMultiplierByUserID(userID string) (float64,
 	}
 	return minMultiplier, groupIDs, nil
 }
+
+// GetMaxRequestCostByUserID 返回用户所在分组中最严格（最小的非 0）单次请求费用上限，0 表示不限制
+func (r *GroupRepository) GetMaxRequestCostByUserID(userID string) (int64, error) {
+	db := database.GetDB()
+	var ceiling sql.NullInt64
+	err := db.QueryRow(`
+		SELECT MIN(g.max_request_cost_micros)
+		FROM groups g
+		INNER JOIN user_groups ug ON g.id = ug.group_id
+		WHERE ug.user_id = ? AND g.max_request_cost_micros > 0
+	`, userID).Scan(&ceiling)
+	if err != nil {
+		return 0, err
+	}
+	return ceiling.Int64, nil
+}
+
+// GetPipelineByUserID 返回用户所在分组中最早创建且配置了请求流水线的分组的流水线 JSON，没有时返回空字符串
+func (r *GroupRepository) GetPipelineByUserID(userID string) (string, error) {
+	db := database.GetDB()
+	var pipelineJSON string
+	err := db.QueryRow(`
+		SELECT g.pipeline_json
+		FROM groups g
+		INNER JOIN user_groups ug ON g.id = ug.group_id
+		WHERE ug.user_id = ? AND g.pipeline_json != ''
+		ORDER BY g.created_at ASC
+		LIMIT 1
+	`, userID).Scan(&pipelineJSON)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return pipelineJSON, err
+}
+
+// GetSystemPromptsByUserID 按分组创建时间返回用户所在分组配置的强制系统提示词
+func (r *GroupRepository) GetSystemPromptsByUserID(userID string) ([]string, error) {
+	db := database.GetDB()
+	rows, err := db.Query(`
+		SELECT g.system_prompt
+		FROM groups g
+		INNER JOIN user_groups ug ON g.id = ug.group_id
+		WHERE ug.user_id = ? AND g.system_prompt != ''
+		ORDER BY g.created_at ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prompts []string
+	for rows.Next() {
+		var prompt string
+		if err := rows.Scan(&prompt); err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, prompt)
+	}
+	return prompts, rows.Err()
+}
+
+// ListAdmins 列出分组管理员
+func (r *GroupRepository) ListAdmins(groupID string) ([]*model.GroupAdmin, error) {
+	db := database.GetDB()
+	rows, err := db.Query(`
+		SELECT ga.group_id, ga.user_id, u.username, ga.created_by, ga.created_at
+		FROM group_admins ga
+		INNER JOIN users u ON u.id = ga.user_id
+		WHERE ga.group_id = ?
+		ORDER BY ga.created_at ASC
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	admins := []*model.GroupAdmin{}
+	for rows.Next() {
+		admin := &model.GroupAdmin{}
+		if err := rows.Scan(&admin.GroupID, &admin.UserID, &admin.Username, &admin.CreatedBy, &admin.CreatedAt); err != nil {
+			return nil, err
+		}
+		admins = append(admins, admin)
+	}
+	return admins, rows.Err()
+}
+
+// AddAdmin 指定分组管理员，已是管理员时不做修改
+func (r *GroupRepository) AddAdmin(groupID, userID, createdBy string) error {
+	db := database.GetDB()
+	_, err := db.Exec(
+		`INSERT INTO group_admins (group_id, user_id, created_by, created_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(group_id, user_id) DO NOTHING`,
+		groupID, userID, createdBy, time.Now().UTC(),
+	)
+	return err
+}
+
+// RemoveAdmin 撤销分组管理员，返回是否存在该记录
+func (r *GroupRepository) RemoveAdmin(groupID, userID string) (bool, error) {
+	db := database.GetDB()
+	result, err := db.Exec(`DELETE FROM group_admins WHERE group_id = ? AND user_id = ?`, groupID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// GetAdminGroupIDs 返回用户担任管理员的分组
+func (r *GroupRepository) GetAdminGroupIDs(userID string) ([]string, error) {
+	db := database.GetDB()
+	rows, err := db.Query(`SELECT group_id FROM group_admins WHERE user_id = ? ORDER BY group_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
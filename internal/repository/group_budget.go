@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// GroupBudgetRepository 分组月度费用统计与预算告警记录
+type GroupBudgetRepository struct{}
+
+func NewGroupBudgetRepository() *GroupBudgetRepository {
+	return &GroupBudgetRepository{}
+}
+
+// SumCostSince 统计分组内用户自 since 起的请求费用合计
+func (r *GroupBudgetRepository) SumCostSince(groupID string, since time.Time) (int64, error) {
+	db := database.GetReadDB()
+	var total int64
+	err := db.QueryRow(
+		`SELECT COALESCE(SUM(rl.cost_micros), 0) FROM request_logs rl
+		 INNER JOIN user_groups ug ON ug.user_id = rl.user_id
+		 WHERE ug.group_id = ? AND rl.created_at >= ?`,
+		groupID, since.UTC(),
+	).Scan(&total)
+	return total, err
+}
+
+// CreateOnce 写入告警记录；同一分组、月份、类型与阈值已有记录时不写入并返回 false
+func (r *GroupBudgetRepository) CreateOnce(alert *model.GroupBudgetAlert) (bool, error) {
+	db := database.GetDB()
+	alert.ID = uuid.New().String()
+	alert.CreatedAt = time.Now().UTC()
+	result, err := db.Exec(
+		`INSERT INTO group_budget_alerts (id, group_id, month, kind, threshold_percent, budget_micros, spend_micros, forecast_micros, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (group_id, month, kind, threshold_percent) DO NOTHING`,
+		alert.ID, alert.GroupID, alert.Month, alert.Kind, alert.ThresholdPercent, alert.BudgetMicros, alert.SpendMicros, alert.ForecastMicros, alert.CreatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// List 按时间倒序分页查询告警记录
+func (r *GroupBudgetRepository) List(filter model.GroupBudgetAlertFilter) ([]*model.GroupBudgetAlert, int64, error) {
+	db := database.GetDB()
+	var conditions []string
+	var args []interface{}
+	if filter.GroupID != "" {
+		conditions = append(conditions, "a.group_id = ?")
+		args = append(args, filter.GroupID)
+	}
+	if filter.Month != "" {
+		conditions = append(conditions, "a.month = ?")
+		args = append(args, filter.Month)
+	}
+	if filter.Kind != "" {
+		conditions = append(conditions, "a.kind = ?")
+		args = append(args, filter.Kind)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM group_budget_alerts a`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (filter.Page - 1) * filter.PageSize
+	rows, err := db.Query(
+		`SELECT a.id, a.group_id, COALESCE(g.name, ''), a.month, a.kind, a.threshold_percent, a.budget_micros, a.spend_micros, a.forecast_micros, a.created_at
+		 FROM group_budget_alerts a LEFT JOIN groups g ON g.id = a.group_id`+where+` ORDER BY a.created_at DESC LIMIT ? OFFSET ?`,
+		append(args, filter.PageSize, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	alerts := []*model.GroupBudgetAlert{}
+	for rows.Next() {
+		alert := &model.GroupBudgetAlert{}
+		if err := rows.Scan(&alert.ID, &alert.GroupID, &alert.GroupName, &alert.Month, &alert.Kind, &alert.ThresholdPercent,
+			&alert.BudgetMicros, &alert.SpendMicros, &alert.ForecastMicros, &alert.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, total, rows.Err()
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+type SavedLogViewRepository struct{}
+
+func NewSavedLogViewRepository() *SavedLogViewRepository {
+	return &SavedLogViewRepository{}
+}
+
+func (r *SavedLogViewRepository) Create(view *model.SavedLogView) error {
+	db := database.GetDB()
+	filtersJSON, err := json.Marshal(view.Filters)
+	if err != nil {
+		return err
+	}
+	view.ID = uuid.New().String()
+	now := time.Now().UTC()
+	view.CreatedAt = now
+	view.UpdatedAt = now
+
+	_, err = db.Exec(
+		`INSERT INTO saved_log_views (id, user_id, name, filters_json, pinned, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		view.ID, view.UserID, view.Name, string(filtersJSON), view.Pinned, view.CreatedAt, view.UpdatedAt,
+	)
+	return err
+}
+
+// GetByID 获取指定用户的视图，不属于该用户时返回 nil
+func (r *SavedLogViewRepository) GetByID(userID, id string) (*model.SavedLogView, error) {
+	db := database.GetDB()
+	row := db.QueryRow(
+		`SELECT id, user_id, name, filters_json, pinned, created_at, updated_at FROM saved_log_views WHERE id = ? AND user_id = ?`,
+		id, userID,
+	)
+	view, err := scanSavedLogView(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return view, err
+}
+
+// ListByUser 列出用户的视图，置顶视图排在前面
+func (r *SavedLogViewRepository) ListByUser(userID string, pinnedOnly bool) ([]*model.SavedLogView, error) {
+	db := database.GetDB()
+	query := `SELECT id, user_id, name, filters_json, pinned, created_at, updated_at FROM saved_log_views WHERE user_id = ?`
+	if pinnedOnly {
+		query += ` AND pinned = 1`
+	}
+	query += ` ORDER BY pinned DESC, name ASC`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []*model.SavedLogView
+	for rows.Next() {
+		view, err := scanSavedLogView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	return views, rows.Err()
+}
+
+func (r *SavedLogViewRepository) ExistsByName(userID, name, excludeID string) (bool, error) {
+	db := database.GetDB()
+	var count int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM saved_log_views WHERE user_id = ? AND name = ? AND id != ?`,
+		userID, name, excludeID,
+	).Scan(&count)
+	return count > 0, err
+}
+
+func (r *SavedLogViewRepository) Update(view *model.SavedLogView) error {
+	db := database.GetDB()
+	filtersJSON, err := json.Marshal(view.Filters)
+	if err != nil {
+		return err
+	}
+	view.UpdatedAt = time.Now().UTC()
+	_, err = db.Exec(
+		`UPDATE saved_log_views SET name = ?, filters_json = ?, pinned = ?, updated_at = ? WHERE id = ? AND user_id = ?`,
+		view.Name, string(filtersJSON), view.Pinned, view.UpdatedAt, view.ID, view.UserID,
+	)
+	return err
+}
+
+func (r *SavedLogViewRepository) Delete(userID, id string) error {
+	db := database.GetDB()
+	_, err := db.Exec(`DELETE FROM saved_log_views WHERE id = ? AND user_id = ?`, id, userID)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSavedLogView(row rowScanner) (*model.SavedLogView, error) {
+	view := &model.SavedLogView{}
+	var filtersJSON string
+	if err := row.Scan(&view.ID, &view.UserID, &view.Name, &filtersJSON, &view.Pinned, &view.CreatedAt, &view.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if filtersJSON != "" {
+		if err := json.Unmarshal([]byte(filtersJSON), &view.Filters); err != nil {
+			return nil, err
+		}
+	}
+	return view, nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+)
+
+type RateLimitRepository struct{}
+
+func NewRateLimitRepository() *RateLimitRepository {
+	return &RateLimitRepository{}
+}
+
+const rateLimitColumns = `scope, target_id, requests_per_minute, tokens_per_minute, max_concurrent, created_at, updated_at`
+
+func (r *RateLimitRepository) List() ([]*model.RateLimit, error) {
+	db := database.GetDB()
+	rows, err := db.Query(`SELECT ` + rateLimitColumns + ` FROM rate_limits ORDER BY scope, target_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var limits []*model.RateLimit
+	for rows.Next() {
+		limit := &model.RateLimit{}
+		if err := rows.Scan(&limit.Scope, &limit.TargetID, &limit.RequestsPerMinute, &limit.TokensPerMinute, &limit.MaxConcurrent, &limit.CreatedAt, &limit.UpdatedAt); err != nil {
+			return nil, err
+		}
+		limits = append(limits, limit)
+	}
+	return limits, rows.Err()
+}
+
+// Upsert 创建或覆盖限流规则，保留原创建时间
+func (r *RateLimitRepository) Upsert(limit *model.RateLimit) error {
+	db := database.GetDB()
+	now := time.Now().UTC()
+	if limit.CreatedAt.IsZero() {
+		limit.CreatedAt = now
+	}
+	limit.UpdatedAt = now
+
+	_, err := db.Exec(`
+		INSERT INTO rate_limits (scope, target_id, requests_per_minute, tokens_per_minute, max_concurrent, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(scope, target_id) DO UPDATE SET
+			requests_per_minute = excluded.requests_per_minute,
+			tokens_per_minute = excluded.tokens_per_minute,
+			max_concurrent = excluded.max_concurrent,
+			updated_at = excluded.updated_at`,
+		limit.Scope, limit.TargetID, limit.RequestsPerMinute, limit.TokensPerMinute, limit.MaxConcurrent, limit.CreatedAt, limit.UpdatedAt,
+	)
+	return err
+}
+
+func (r *RateLimitRepository) Delete(scope, targetID string) (bool, error) {
+	db := database.GetDB()
+	result, err := db.Exec(`DELETE FROM rate_limits WHERE scope = ? AND target_id = ?`, scope, targetID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
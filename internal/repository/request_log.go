@@ -1,8 +1,13 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -10,6 +15,8 @@ import (
 	"ampmanager/internal/model"
 )
 
+// RequestLogRepository 请求日志仓储
+// 统计、仪表盘与导出等重查询走 database.GetReadDB()，避免阻塞日志写入与计费使用的主连接
 type RequestLogRepository struct{}
 
 func NewRequestLogRepository() *RequestLogRepository {
@@ -25,15 +32,49 @@ type ListParams struct {
 	IsStreaming *bool
 	From        *time.Time
 	To          *time.Time
+	Status      string
+	MinCost     *int64
+	TraceID     string
 	Page        int
 	PageSize    int
+	// Cursor 非空时使用 keyset 分页（忽略 Page）
+	Cursor string
 }
 
-// List 查询请求日志列表
-func (r *RequestLogRepository) List(params ListParams) ([]model.RequestLog, int64, error) {
-	db := database.GetDB()
+// LogCursor keyset 分页游标，对应排序键 (created_at DESC, id DESC)
+type LogCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// ErrInvalidCursor 游标格式无效
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeLogCursor 将游标编码为不透明字符串
+func EncodeLogCursor(cursor LogCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeLogCursor 解析游标字符串
+func DecodeLogCursor(encoded string) (LogCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return LogCursor{}, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return LogCursor{}, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return LogCursor{}, ErrInvalidCursor
+	}
+	return LogCursor{CreatedAt: createdAt, ID: parts[1]}, nil
+}
 
-	// 构建 WHERE 条件（使用 r. 前缀避免 JOIN 时的歧义）
+// buildListConditions 构建列表查询的 WHERE 条件（使用 r. 前缀避免 JOIN 时的歧义）
+func buildListConditions(params ListParams) ([]string, []interface{}) {
 	conditions := []string{"1=1"}
 	args := []interface{}{}
 
@@ -61,6 +102,18 @@ func (r *RequestLogRepository) List(params ListParams) ([]model.RequestLog, int6
 		conditions = append(conditions, "r.is_streaming = ?")
 		args = append(args, val)
 	}
+	if params.Status != "" {
+		conditions = append(conditions, "r.status = ?")
+		args = append(args, params.Status)
+	}
+	if params.MinCost != nil {
+		conditions = append(conditions, "r.cost_micros >= ?")
+		args = append(args, *params.MinCost)
+	}
+	if params.TraceID != "" {
+		conditions = append(conditions, "r.trace_id = ?")
+		args = append(args, params.TraceID)
+	}
 	if params.From != nil {
 		conditions = append(conditions, "r.created_at >= ?")
 		args = append(args, params.From.UTC())
@@ -70,49 +123,58 @@ func (r *RequestLogRepository) List(params ListParams) ([]model.RequestLog, int6
 		args = append(args, params.To.UTC())
 	}
 
-	whereClause := strings.Join(conditions, " AND ")
-
-	// 查询总数
-	var total int64
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM request_logs r WHERE %s", whereClause)
-	if err := db.QueryRow(countQuery, args...).Scan(&total); err != nil {
-		return nil, 0, err
-	}
+	return conditions, args
+}
 
-	// 分页
-	if params.Page < 1 {
-		params.Page = 1
-	}
-	if params.PageSize < 1 {
-		params.PageSize = 20
-	}
-	if params.PageSize > 100 {
-		params.PageSize = 100
-	}
-	offset := (params.Page - 1) * params.PageSize
+// buildListSelect 构建列表查询的 SELECT ... WHERE 部分，调用方追加 ORDER BY / LIMIT
+func buildListSelect(whereClause string) string {
 	detailJoin := "LEFT JOIN request_log_details d ON r.id = d.request_id"
 	outputPreviewExpr := "COALESCE(SUBSTR(r.response_text, 1, 200), SUBSTR(d.response_body, 1, 200))"
-	if database.IsPostgres() {
+	if database.HasArchiveTable() {
 		detailJoin += "\n                LEFT JOIN request_log_details_archive da ON r.id = da.request_id"
 		outputPreviewExpr = "COALESCE(SUBSTR(r.response_text, 1, 200), SUBSTR(d.response_body, 1, 200), SUBSTR(da.response_body, 1, 200))"
 	}
 
-	// 查询数据
-	query := fmt.Sprintf(`
+	return fmt.Sprintf(`
 		SELECT r.id, r.created_at, r.updated_at, r.status, r.user_id, u.username, r.api_key_id, k.name as api_key_name, k.prefix as api_key_prefix, r.original_model, r.mapped_model,
 		       r.provider, r.channel_id, c.name as channel_name, r.endpoint, r.method, r.path, r.status_code, r.latency_ms,
 		       r.is_streaming, r.input_tokens, r.output_tokens, r.cache_read_input_tokens,
 		       r.cache_creation_input_tokens, r.error_type, r.request_id, r.cost_micros, r.cost_usd, r.pricing_model, r.thinking_level,
-		       %s as output_preview
+		       r.on_behalf_of, r.trace_id, r.usage_estimated, %s as output_preview
 		FROM request_logs r
                 LEFT JOIN users u ON r.user_id = u.id
 		LEFT JOIN user_api_keys k ON r.api_key_id = k.id
 		%s
 		LEFT JOIN channels c ON r.channel_id = c.id
-		WHERE %s
-		ORDER BY r.created_at DESC
+		WHERE %s`, outputPreviewExpr, detailJoin, whereClause)
+}
+
+// List 查询请求日志列表
+func (r *RequestLogRepository) List(params ListParams) ([]model.RequestLog, int64, error) {
+	db := database.GetDB()
+
+	conditions, args := buildListConditions(params)
+	whereClause := strings.Join(conditions, " AND ")
+
+	// 查询总数
+	var total int64
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM request_logs r WHERE %s", whereClause)
+	if err := db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// 分页
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	params.PageSize = normalizeListPageSize(params.PageSize)
+	offset := (params.Page - 1) * params.PageSize
+
+	// 查询数据（id 作为次排序键保证同一时间戳下顺序稳定）
+	query := buildListSelect(whereClause) + `
+		ORDER BY r.created_at DESC, r.id DESC
 		LIMIT ? OFFSET ?
-	`, outputPreviewExpr, detailJoin, whereClause)
+	`
 
 	args = append(args, params.PageSize, offset)
 	rows, err := db.Query(query, args...)
@@ -123,120 +185,247 @@ func (r *RequestLogRepository) List(params ListParams) ([]model.RequestLog, int6
 
 	var logs []model.RequestLog
 	for rows.Next() {
-		var log model.RequestLog
-		var createdAt time.Time
-		var updatedAt sql.NullTime
-		var status sql.NullString
-		var isStreaming int
-		var username, apiKeyName, apiKeyPrefix sql.NullString
-		var originalModel, mappedModel, provider, channelID, channelName, endpoint, errorType, requestID, costUsd, pricingModel, thinkingLevel, outputPreview sql.NullString
-		var inputTokens, outputTokens, cacheRead, cacheCreation, costMicros sql.NullInt64
-
-		err := rows.Scan(
-			&log.ID, &createdAt, &updatedAt, &status, &log.UserID, &username, &log.APIKeyID, &apiKeyName, &apiKeyPrefix,
-			&originalModel, &mappedModel, &provider, &channelID, &channelName, &endpoint,
-			&log.Method, &log.Path, &log.StatusCode, &log.LatencyMs,
-			&isStreaming, &inputTokens, &outputTokens, &cacheRead, &cacheCreation,
-			&errorType, &requestID, &costMicros, &costUsd, &pricingModel, &thinkingLevel,
-			&outputPreview,
-		)
+		log, _, err := scanListRow(rows)
 		if err != nil {
 			return nil, 0, err
 		}
+		logs = append(logs, log)
+	}
 
-		log.CreatedAt = createdAt.Format(time.RFC3339)
-		log.IsStreaming = isStreaming == 1
+	return logs, total, rows.Err()
+}
 
-		if username.Valid {
-			log.Username = &username.String
-		}
-		if apiKeyName.Valid {
-			log.APIKeyName = &apiKeyName.String
-		}
-		if apiKeyPrefix.Valid {
-			log.APIKeyPrefix = &apiKeyPrefix.String
-		}
-		if updatedAt.Valid {
-			formatted := updatedAt.Time.Format(time.RFC3339)
-			log.UpdatedAt = &formatted
-		}
-		if status.Valid {
-			log.Status = model.RequestLogStatus(status.String)
-		} else {
-			log.Status = model.RequestLogStatusSuccess // 默认为 success（兼容旧数据）
-		}
+// ListByCursor 使用 keyset 分页查询请求日志，返回下一页游标（无更多数据时为空）
+func (r *RequestLogRepository) ListByCursor(params ListParams) ([]model.RequestLog, string, error) {
+	db := database.GetDB()
 
-		if originalModel.Valid {
-			log.OriginalModel = &originalModel.String
-		}
-		if mappedModel.Valid {
-			log.MappedModel = &mappedModel.String
-		}
-		if provider.Valid {
-			log.Provider = &provider.String
-		}
-		if channelID.Valid {
-			log.ChannelID = &channelID.String
-		}
-		if channelName.Valid {
-			log.ChannelName = &channelName.String
-		}
-		if endpoint.Valid {
-			log.Endpoint = &endpoint.String
-		}
-		if errorType.Valid {
-			log.ErrorType = &errorType.String
-		}
-		if requestID.Valid {
-			log.RequestID = &requestID.String
-		}
-		if inputTokens.Valid {
-			v := int(inputTokens.Int64)
-			log.InputTokens = &v
-		}
-		if outputTokens.Valid {
-			v := int(outputTokens.Int64)
-			log.OutputTokens = &v
+	conditions, args := buildListConditions(params)
+	if params.Cursor != "" {
+		cursor, err := DecodeLogCursor(params.Cursor)
+		if err != nil {
+			return nil, "", err
 		}
-		if cacheRead.Valid {
-			v := int(cacheRead.Int64)
-			log.CacheReadInputTokens = &v
+		conditions = append(conditions, "(r.created_at < ? OR (r.created_at = ? AND r.id < ?))")
+		args = append(args, cursor.CreatedAt.UTC(), cursor.CreatedAt.UTC(), cursor.ID)
+	}
+	whereClause := strings.Join(conditions, " AND ")
+	pageSize := normalizeListPageSize(params.PageSize)
+
+	// 多取一条用于判断是否还有下一页
+	query := buildListSelect(whereClause) + `
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT ?
+	`
+	args = append(args, pageSize+1)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var logs []model.RequestLog
+	var lastCreatedAt time.Time
+	for rows.Next() {
+		log, createdAt, err := scanListRow(rows)
+		if err != nil {
+			return nil, "", err
 		}
-		if cacheCreation.Valid {
-			v := int(cacheCreation.Int64)
-			log.CacheCreationInputTokens = &v
+		if len(logs) == pageSize {
+			next := EncodeLogCursor(LogCursor{CreatedAt: lastCreatedAt, ID: logs[len(logs)-1].ID})
+			return logs, next, nil
 		}
-		if costMicros.Valid {
-			log.CostMicros = &costMicros.Int64
+		lastCreatedAt = createdAt
+		logs = append(logs, log)
+	}
+
+	return logs, "", rows.Err()
+}
+
+// Iterate 流式遍历满足条件的全部日志，按 keyset 分批查询，不会一次性加载到内存
+// fn 返回错误时停止遍历并返回该错误
+func (r *RequestLogRepository) Iterate(params ListParams, batchSize int, fn func(model.RequestLog) error) error {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	db := database.GetReadDB()
+	baseConditions, baseArgs := buildListConditions(params)
+
+	var cursor *LogCursor
+	for {
+		conditions := append([]string{}, baseConditions...)
+		args := append([]interface{}{}, baseArgs...)
+		if cursor != nil {
+			conditions = append(conditions, "(r.created_at < ? OR (r.created_at = ? AND r.id < ?))")
+			args = append(args, cursor.CreatedAt.UTC(), cursor.CreatedAt.UTC(), cursor.ID)
 		}
-		if costUsd.Valid {
-			log.CostUsd = &costUsd.String
+		query := buildListSelect(strings.Join(conditions, " AND ")) + `
+			ORDER BY r.created_at DESC, r.id DESC
+			LIMIT ?
+		`
+		args = append(args, batchSize)
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return err
 		}
-		if pricingModel.Valid {
-			log.PricingModel = &pricingModel.String
+
+		count := 0
+		var last LogCursor
+		for rows.Next() {
+			log, createdAt, err := scanListRow(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			count++
+			last = LogCursor{CreatedAt: createdAt, ID: log.ID}
+			if err := fn(log); err != nil {
+				rows.Close()
+				return err
+			}
 		}
-		if thinkingLevel.Valid {
-			log.ThinkingLevel = &thinkingLevel.String
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
 		}
-		if outputPreview.Valid {
-			log.OutputPreview = &outputPreview.String
+
+		if count < batchSize {
+			return nil
 		}
+		cursor = &last
+	}
+}
 
-		logs = append(logs, log)
+func normalizeListPageSize(pageSize int) int {
+	if pageSize < 1 {
+		return 20
+	}
+	if pageSize > 100 {
+		return 100
 	}
+	return pageSize
+}
 
-	return logs, total, rows.Err()
+// scanListRow 扫描 buildListSelect 查询出的一行，同时返回原始 created_at 供游标使用
+func scanListRow(rows *sql.Rows) (model.RequestLog, time.Time, error) {
+	var log model.RequestLog
+	var createdAt time.Time
+	var updatedAt sql.NullTime
+	var status sql.NullString
+	var isStreaming, usageEstimated int
+	var username, apiKeyName, apiKeyPrefix sql.NullString
+	var originalModel, mappedModel, provider, channelID, channelName, endpoint, errorType, requestID, costUsd, pricingModel, thinkingLevel, onBehalfOf, traceID, outputPreview sql.NullString
+	var inputTokens, outputTokens, cacheRead, cacheCreation, costMicros sql.NullInt64
+
+	err := rows.Scan(
+		&log.ID, &createdAt, &updatedAt, &status, &log.UserID, &username, &log.APIKeyID, &apiKeyName, &apiKeyPrefix,
+		&originalModel, &mappedModel, &provider, &channelID, &channelName, &endpoint,
+		&log.Method, &log.Path, &log.StatusCode, &log.LatencyMs,
+		&isStreaming, &inputTokens, &outputTokens, &cacheRead, &cacheCreation,
+		&errorType, &requestID, &costMicros, &costUsd, &pricingModel, &thinkingLevel,
+		&onBehalfOf, &traceID, &usageEstimated, &outputPreview,
+	)
+	if err != nil {
+		return log, createdAt, err
+	}
+	log.CreatedAt = createdAt.Format(time.RFC3339)
+	log.IsStreaming = isStreaming == 1
+	log.UsageEstimated = usageEstimated == 1
+
+	if username.Valid {
+		log.Username = &username.String
+	}
+	if apiKeyName.Valid {
+		log.APIKeyName = &apiKeyName.String
+	}
+	if apiKeyPrefix.Valid {
+		log.APIKeyPrefix = &apiKeyPrefix.String
+	}
+	if updatedAt.Valid {
+		formatted := updatedAt.Time.Format(time.RFC3339)
+		log.UpdatedAt = &formatted
+	}
+	if status.Valid {
+		log.Status = model.RequestLogStatus(status.String)
+	} else {
+		log.Status = model.RequestLogStatusSuccess // 默认为 success（兼容旧数据）
+	}
+
+	if originalModel.Valid {
+		log.OriginalModel = &originalModel.String
+	}
+	if mappedModel.Valid {
+		log.MappedModel = &mappedModel.String
+	}
+	if provider.Valid {
+		log.Provider = &provider.String
+	}
+	if channelID.Valid {
+		log.ChannelID = &channelID.String
+	}
+	if channelName.Valid {
+		log.ChannelName = &channelName.String
+	}
+	if endpoint.Valid {
+		log.Endpoint = &endpoint.String
+	}
+	if errorType.Valid {
+		log.ErrorType = &errorType.String
+	}
+	if requestID.Valid {
+		log.RequestID = &requestID.String
+	}
+	if inputTokens.Valid {
+		v := int(inputTokens.Int64)
+		log.InputTokens = &v
+	}
+	if outputTokens.Valid {
+		v := int(outputTokens.Int64)
+		log.OutputTokens = &v
+	}
+	if cacheRead.Valid {
+		v := int(cacheRead.Int64)
+		log.CacheReadInputTokens = &v
+	}
+	if cacheCreation.Valid {
+		v := int(cacheCreation.Int64)
+		log.CacheCreationInputTokens = &v
+	}
+	if costMicros.Valid {
+		log.CostMicros = &costMicros.Int64
+	}
+	if costUsd.Valid {
+		log.CostUsd = &costUsd.String
+	}
+	if pricingModel.Valid {
+		log.PricingModel = &pricingModel.String
+	}
+	if thinkingLevel.Valid {
+		log.ThinkingLevel = &thinkingLevel.String
+	}
+	if onBehalfOf.Valid {
+		log.OnBehalfOf = &onBehalfOf.String
+	}
+	if traceID.Valid {
+		log.TraceID = &traceID.String
+	}
+	if outputPreview.Valid {
+		log.OutputPreview = &outputPreview.String
+	}
+
+	return log, createdAt, nil
 }
 
 // GetUsageSummary 获取用量统计
-// userID 为 nil 或空字符串时查询所有用户
-func (r *RequestLogRepository) GetUsageSummary(userID *string, from, to *time.Time, groupBy string, modelFilter string) ([]model.UsageSummary, error) {
-	db := database.GetDB()
+// userID 为 nil 或空字符串时查询所有用户；按天分组时按 loc 的自然日分组
+func (r *RequestLogRepository) GetUsageSummary(userID *string, from, to *time.Time, groupBy string, modelFilter string, loc *time.Location) ([]model.UsageSummary, error) {
+	db := database.GetReadDB()
 
 	var groupColumn string
 	switch groupBy {
 	case "day":
-		groupColumn = database.DayBucketExpr("created_at")
+		groupColumn = database.DayBucketExprIn("created_at", loc)
 	case "model":
 		groupColumn = "COALESCE(mapped_model, original_model, 'unknown')"
 	case "apiKey":
@@ -244,7 +433,7 @@ func (r *RequestLogRepository) GetUsageSummary(userID *string, from, to *time.Ti
 	case "user":
 		groupColumn = "user_id"
 	default:
-		groupColumn = database.DayBucketExpr("created_at")
+		groupColumn = database.DayBucketExprIn("created_at", loc)
 	}
 
 	conditions := []string{"1=1"}
@@ -318,9 +507,97 @@ func (r *RequestLogRepository) GetUsageSummary(userID *string, from, to *time.Ti
 	return summaries, rows.Err()
 }
 
+// GetBillingShadowSummary 按计价模型汇总 since 之后的成功请求费用，供计费影子模式核对定价。
+// 上游成本按 cost_micros / rate_multiplier 还原（免费分组记录的即为原始成本）
+func (r *RequestLogRepository) GetBillingShadowSummary(since time.Time) ([]model.BillingShadowModelSummary, error) {
+	db := database.GetReadDB()
+
+	query := `
+		SELECT
+			COALESCE(pricing_model, mapped_model, original_model, 'unknown') as model_key,
+			COUNT(*) as request_count,
+			SUM(CASE WHEN cost_micros IS NULL THEN 1 ELSE 0 END) as unpriced_count,
+			COALESCE(SUM(input_tokens), 0),
+			COALESCE(SUM(output_tokens), 0),
+			COALESCE(SUM(cache_read_input_tokens), 0),
+			COALESCE(SUM(cache_creation_input_tokens), 0),
+			COALESCE(SUM(CASE WHEN billing_status = 'shadow' THEN cost_micros ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN rate_multiplier > 0 THEN cost_micros / rate_multiplier ELSE cost_micros END), 0)
+		FROM request_logs
+		WHERE created_at >= ? AND status_code >= 200 AND status_code < 400
+		GROUP BY model_key
+		ORDER BY request_count DESC
+		LIMIT 200
+	`
+
+	rows, err := db.Query(query, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []model.BillingShadowModelSummary
+	for rows.Next() {
+		var s model.BillingShadowModelSummary
+		var upstream float64
+		if err := rows.Scan(
+			&s.Model,
+			&s.RequestCount,
+			&s.UnpricedCount,
+			&s.InputTokensSum,
+			&s.OutputTokensSum,
+			&s.CacheReadInputTokensSum,
+			&s.CacheCreationTokensSum,
+			&s.CostMicrosSum,
+			&upstream,
+		); err != nil {
+			return nil, err
+		}
+		s.UpstreamCostMicrosSum = int64(math.Round(upstream))
+		s.CostUsdSum = fmt.Sprintf("%.6f", float64(s.CostMicrosSum)/1_000_000)
+		s.UpstreamCostUsdSum = fmt.Sprintf("%.6f", float64(s.UpstreamCostMicrosSum)/1_000_000)
+		summaries = append(summaries, s)
+	}
+
+	return summaries, rows.Err()
+}
+
+// ChannelUsageStat 渠道在统计窗口内的请求数与 token 数
+type ChannelUsageStat struct {
+	ChannelID string
+	Requests  int64
+	Tokens    int64
+}
+
+// GetChannelUsageSince 按渠道汇总 since 之后的请求数与输入、输出 token 数（包含失败请求，同样占用上游额度）
+func (r *RequestLogRepository) GetChannelUsageSince(since time.Time) (map[string]ChannelUsageStat, error) {
+	db := database.GetReadDB()
+
+	rows, err := db.Query(`
+		SELECT channel_id, COUNT(*), COALESCE(SUM(COALESCE(input_tokens, 0) + COALESCE(output_tokens, 0)), 0)
+		FROM request_logs
+		WHERE created_at >= ? AND channel_id IS NOT NULL AND channel_id != ''
+		GROUP BY channel_id
+	`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]ChannelUsageStat)
+	for rows.Next() {
+		var s ChannelUsageStat
+		if err := rows.Scan(&s.ChannelID, &s.Requests, &s.Tokens); err != nil {
+			return nil, err
+		}
+		stats[s.ChannelID] = s
+	}
+	return stats, rows.Err()
+}
+
 // GetDistinctModels 获取使用过的模型列表
 func (r *RequestLogRepository) GetDistinctModels() ([]string, error) {
-	db := database.GetDB()
+	db := database.GetReadDB()
 
 	query := `
 		SELECT DISTINCT COALESCE(mapped_model, original_model) as model
@@ -350,7 +627,7 @@ func (r *RequestLogRepository) GetDistinctModels() ([]string, error) {
 
 // GetDistinctModelsByUser 获取指定用户使用过的模型列表
 func (r *RequestLogRepository) GetDistinctModelsByUser(userID string) ([]string, error) {
-	db := database.GetDB()
+	db := database.GetReadDB()
 
 	query := `
 		SELECT DISTINCT COALESCE(mapped_model, original_model) as model
@@ -387,7 +664,7 @@ type DistinctAPIKey struct {
 
 // GetDistinctAPIKeys 获取在日志中使用过的 API Key 列表
 func (r *RequestLogRepository) GetDistinctAPIKeys(userID string) ([]DistinctAPIKey, error) {
-	db := database.GetDB()
+	db := database.GetReadDB()
 
 	var rows *sql.Rows
 	var err error
@@ -459,11 +736,26 @@ type DashboardCacheHitRate struct {
 	HitRate             float64
 }
 
-// GetDashboardStats 获取仪表盘统计数据
-func (r *RequestLogRepository) GetDashboardStats(userID string) (today, week, month DashboardPeriodStats, topModels []DashboardTopModel, dailyTrend []DashboardDailyTrend, err error) {
-	db := database.GetDB()
-	now := time.Now().UTC()
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+// cacheProviderExpr 按模型名前缀归类提供商，用于缓存命中率统计
+const cacheProviderExpr = `CASE
+						WHEN LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'claude%' THEN 'Claude'
+						WHEN LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'gpt%'
+						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'o1%'
+						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'o3%'
+						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'o4%'
+						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'chatgpt%' THEN 'OpenAI'
+						WHEN LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'gemini%' THEN 'Gemini'
+						ELSE 'Other'
+				END`
+
+// GetDashboardStats 获取仪表盘统计数据，今日与每日趋势按 loc 的自然日计算
+func (r *RequestLogRepository) GetDashboardStats(userID string, loc *time.Location) (today, week, month DashboardPeriodStats, topModels []DashboardTopModel, dailyTrend []DashboardDailyTrend, err error) {
+	db := database.GetReadDB()
+	if loc == nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
 	weekStart := todayStart.AddDate(0, 0, -7)
 	monthStart := todayStart.AddDate(0, 0, -30)
 
@@ -526,7 +818,7 @@ func (r *RequestLogRepository) GetDashboardStats(userID string) (today, week, mo
 		WHERE user_id = ? AND created_at >= ?
 		GROUP BY day
 		ORDER BY day ASC
-	`, database.DayBucketExpr("created_at")), userID, todayStart.AddDate(0, 0, -13).UTC())
+	`, database.DayBucketExprIn("created_at", loc)), userID, todayStart.AddDate(0, 0, -13).UTC())
 	if err != nil {
 		return
 	}
@@ -544,31 +836,20 @@ func (r *RequestLogRepository) GetDashboardStats(userID string) (today, week, mo
 
 // GetCacheHitRateByProvider 按提供商分类获取缓存命中率（30天）
 func (r *RequestLogRepository) GetCacheHitRateByProvider(userID string) ([]DashboardCacheHitRate, error) {
-	db := database.GetDB()
+	db := database.GetReadDB()
 	monthStart := time.Now().UTC().AddDate(0, 0, -30)
 
-	providerExpr := `CASE
-						WHEN LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'claude%%' THEN 'Claude'
-						WHEN LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'gpt%%'
-						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'o1%%'
-						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'o3%%'
-						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'o4%%'
-						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'chatgpt%%' THEN 'OpenAI'
-						WHEN LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'gemini%%' THEN 'Gemini'
-						ELSE 'Other'
-				END`
-
 	query := `
 		SELECT provider, total_input, cache_read, cache_creation, req_count FROM (
 			SELECT
-				` + providerExpr + ` as provider,
+				` + cacheProviderExpr + ` as provider,
 				COALESCE(SUM(input_tokens), 0) as total_input,
 				COALESCE(SUM(cache_read_input_tokens), 0) as cache_read,
 				COALESCE(SUM(cache_creation_input_tokens), 0) as cache_creation,
 				COUNT(*) as req_count
 			FROM request_logs
 			WHERE user_id = ? AND created_at >= ?
-			GROUP BY ` + providerExpr + `
+			GROUP BY ` + cacheProviderExpr + `
 		) WHERE provider IN ('Claude', 'OpenAI', 'Gemini')
 		ORDER BY req_count DESC
 	`
@@ -595,10 +876,13 @@ func (r *RequestLogRepository) GetCacheHitRateByProvider(userID string) ([]Dashb
 }
 
 // GetAdminDashboardStats 获取管理员仪表盘统计数据（全局，不按用户过滤）
-func (r *RequestLogRepository) GetAdminDashboardStats() (today, week, month DashboardPeriodStats, topModels []DashboardTopModel, dailyTrend []DashboardDailyTrend, err error) {
-	db := database.GetDB()
-	now := time.Now().UTC()
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+func (r *RequestLogRepository) GetAdminDashboardStats(loc *time.Location) (today, week, month DashboardPeriodStats, topModels []DashboardTopModel, dailyTrend []DashboardDailyTrend, err error) {
+	db := database.GetReadDB()
+	if loc == nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
 	weekStart := todayStart.AddDate(0, 0, -7)
 	monthStart := todayStart.AddDate(0, 0, -30)
 
@@ -661,7 +945,7 @@ func (r *RequestLogRepository) GetAdminDashboardStats() (today, week, month Dash
 		WHERE created_at >= ?
 		GROUP BY day
 		ORDER BY day ASC
-	`, database.DayBucketExpr("created_at")), todayStart.AddDate(0, 0, -13).UTC())
+	`, database.DayBucketExprIn("created_at", loc)), todayStart.AddDate(0, 0, -13).UTC())
 	if err != nil {
 		return
 	}
@@ -679,31 +963,20 @@ func (r *RequestLogRepository) GetAdminDashboardStats() (today, week, month Dash
 
 // GetAdminCacheHitRateByProvider 管理员全局缓存命中率（30天）
 func (r *RequestLogRepository) GetAdminCacheHitRateByProvider() ([]DashboardCacheHitRate, error) {
-	db := database.GetDB()
+	db := database.GetReadDB()
 	monthStart := time.Now().UTC().AddDate(0, 0, -30)
 
-	providerExpr := `CASE
-						WHEN LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'claude%%' THEN 'Claude'
-						WHEN LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'gpt%%'
-						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'o1%%'
-						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'o3%%'
-						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'o4%%'
-						  OR LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'chatgpt%%' THEN 'OpenAI'
-						WHEN LOWER(COALESCE(mapped_model, original_model, '')) LIKE 'gemini%%' THEN 'Gemini'
-						ELSE 'Other'
-				END`
-
 	query := `
 		SELECT provider, total_input, cache_read, cache_creation, req_count FROM (
 			SELECT
-				` + providerExpr + ` as provider,
+				` + cacheProviderExpr + ` as provider,
 				COALESCE(SUM(input_tokens), 0) as total_input,
 				COALESCE(SUM(cache_read_input_tokens), 0) as cache_read,
 				COALESCE(SUM(cache_creation_input_tokens), 0) as cache_creation,
 				COUNT(*) as req_count
 			FROM request_logs
 			WHERE created_at >= ?
-			GROUP BY ` + providerExpr + `
+			GROUP BY ` + cacheProviderExpr + `
 		) WHERE provider IN ('Claude', 'OpenAI', 'Gemini')
 		ORDER BY req_count DESC
 	`
@@ -737,15 +1010,17 @@ func (r *RequestLogRepository) GetByID(id string) (*model.RequestLog, error) {
 	var createdAt time.Time
 	var updatedAt sql.NullTime
 	var status sql.NullString
-	var isStreaming int
-	var originalModel, mappedModel, provider, channelID, channelName, endpoint, errorType, requestID, costUsd, pricingModel, thinkingLevel sql.NullString
+	var isStreaming, usageEstimated int
+	var originalModel, mappedModel, provider, channelID, channelName, endpoint, errorType, requestID, costUsd, pricingModel, thinkingLevel, onBehalfOf, traceID sql.NullString
 	var inputTokens, outputTokens, cacheRead, cacheCreation, costMicros sql.NullInt64
+	var attemptsJSON sql.NullString
 
 	err := db.QueryRow(`
 		SELECT r.id, r.created_at, r.updated_at, r.status, r.user_id, r.api_key_id, r.original_model, r.mapped_model,
 		       r.provider, r.channel_id, c.name as channel_name, r.endpoint, r.method, r.path, r.status_code, r.latency_ms,
 		       r.is_streaming, r.input_tokens, r.output_tokens, r.cache_read_input_tokens,
-		       r.cache_creation_input_tokens, r.error_type, r.request_id, r.cost_micros, r.cost_usd, r.pricing_model, r.thinking_level
+		       r.cache_creation_input_tokens, r.error_type, r.request_id, r.cost_micros, r.cost_usd, r.pricing_model, r.thinking_level,
+		       r.attempts_json, r.on_behalf_of, r.trace_id, r.usage_estimated
 		FROM request_logs r
 		LEFT JOIN channels c ON r.channel_id = c.id
 		WHERE r.id = ?
@@ -755,6 +1030,7 @@ func (r *RequestLogRepository) GetByID(id string) (*model.RequestLog, error) {
 		&log.Method, &log.Path, &log.StatusCode, &log.LatencyMs,
 		&isStreaming, &inputTokens, &outputTokens, &cacheRead, &cacheCreation,
 		&errorType, &requestID, &costMicros, &costUsd, &pricingModel, &thinkingLevel,
+		&attemptsJSON, &onBehalfOf, &traceID, &usageEstimated,
 	)
 
 	if err == sql.ErrNoRows {
@@ -766,6 +1042,7 @@ func (r *RequestLogRepository) GetByID(id string) (*model.RequestLog, error) {
 
 	log.CreatedAt = createdAt.Format(time.RFC3339)
 	log.IsStreaming = isStreaming == 1
+	log.UsageEstimated = usageEstimated == 1
 
 	if updatedAt.Valid {
 		formatted := updatedAt.Time.Format(time.RFC3339)
@@ -829,10 +1106,44 @@ func (r *RequestLogRepository) GetByID(id string) (*model.RequestLog, error) {
 	if thinkingLevel.Valid {
 		log.ThinkingLevel = &thinkingLevel.String
 	}
+	if onBehalfOf.Valid {
+		log.OnBehalfOf = &onBehalfOf.String
+	}
+	if traceID.Valid {
+		log.TraceID = &traceID.String
+	}
+	log.Attempts = decodeAttempts(attemptsJSON)
 
 	return &log, nil
 }
 
+// GetAttempts 获取请求的重试历史（未发生重试时返回空）
+func (r *RequestLogRepository) GetAttempts(id string) ([]model.RequestAttempt, error) {
+	db := database.GetDB()
+
+	var attemptsJSON sql.NullString
+	err := db.QueryRow(`SELECT attempts_json FROM request_logs WHERE id = ?`, id).Scan(&attemptsJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeAttempts(attemptsJSON), nil
+}
+
+// decodeAttempts 解析 attempts_json 列，格式异常时忽略
+func decodeAttempts(raw sql.NullString) []model.RequestAttempt {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	var attempts []model.RequestAttempt
+	if err := json.Unmarshal([]byte(raw.String), &attempts); err != nil {
+		return nil
+	}
+	return attempts
+}
+
 // GetByIDWithJoins 获取单条日志（含用户名、Key信息、渠道名，用于广播）
 func (r *RequestLogRepository) GetByIDWithJoins(id string) (*model.RequestLog, error) {
 	db := database.GetDB()
@@ -841,7 +1152,7 @@ func (r *RequestLogRepository) GetByIDWithJoins(id string) (*model.RequestLog, e
 	var createdAt time.Time
 	var updatedAt sql.NullTime
 	var status sql.NullString
-	var isStreaming int
+	var isStreaming, usageEstimated int
 	var username, apiKeyName, apiKeyPrefix sql.NullString
 	var originalModel, mappedModel, provider, channelID, channelName, endpoint, errorType, requestID, costUsd, pricingModel, thinkingLevel sql.NullString
 	var inputTokens, outputTokens, cacheRead, cacheCreation, costMicros sql.NullInt64
@@ -851,7 +1162,8 @@ func (r *RequestLogRepository) GetByIDWithJoins(id string) (*model.RequestLog, e
 		       r.original_model, r.mapped_model, r.provider, r.channel_id, c.name, r.endpoint,
 		       r.method, r.path, r.status_code, r.latency_ms,
 		       r.is_streaming, r.input_tokens, r.output_tokens, r.cache_read_input_tokens,
-		       r.cache_creation_input_tokens, r.error_type, r.request_id, r.cost_micros, r.cost_usd, r.pricing_model, r.thinking_level
+		       r.cache_creation_input_tokens, r.error_type, r.request_id, r.cost_micros, r.cost_usd, r.pricing_model, r.thinking_level,
+		       r.usage_estimated
 		FROM request_logs r
 		LEFT JOIN users u ON r.user_id = u.id
 		LEFT JOIN user_api_keys k ON r.api_key_id = k.id
@@ -863,6 +1175,7 @@ func (r *RequestLogRepository) GetByIDWithJoins(id string) (*model.RequestLog, e
 		&l.Method, &l.Path, &l.StatusCode, &l.LatencyMs,
 		&isStreaming, &inputTokens, &outputTokens, &cacheRead, &cacheCreation,
 		&errorType, &requestID, &costMicros, &costUsd, &pricingModel, &thinkingLevel,
+		&usageEstimated,
 	)
 
 	if err == sql.ErrNoRows {
@@ -874,6 +1187,7 @@ func (r *RequestLogRepository) GetByIDWithJoins(id string) (*model.RequestLog, e
 
 	l.CreatedAt = createdAt.Format(time.RFC3339)
 	l.IsStreaming = isStreaming == 1
+	l.UsageEstimated = usageEstimated == 1
 
 	if username.Valid {
 		l.Username = &username.String
@@ -948,3 +1262,250 @@ func (r *RequestLogRepository) GetByIDWithJoins(id string) (*model.RequestLog, e
 
 	return &l, nil
 }
+
+// DashboardSummaryParams 聚合仪表盘查询参数
+// UserID 为空时统计全局数据
+type DashboardSummaryParams struct {
+	UserID      string
+	From        time.Time
+	To          time.Time
+	TopModels   int
+	RecentLimit int
+	// Location 每日趋势按该时区的自然日分组，为空时为 UTC
+	Location *time.Location
+}
+
+// DashboardSummary 聚合仪表盘数据（所有组件共享同一时间范围）
+type DashboardSummary struct {
+	Period        DashboardPeriodStats
+	TopModels     []DashboardTopModel
+	DailyTrend    []DashboardDailyTrend
+	CacheHitRates []DashboardCacheHitRate
+	RecentLogs    []model.RequestLog
+}
+
+// GetDashboardSummary 在同一个只读事务中查询仪表盘所需的全部数据，
+// 所有查询共用一个连接和一致的快照，减少 SQLite 的锁竞争
+func (r *RequestLogRepository) GetDashboardSummary(params DashboardSummaryParams) (*DashboardSummary, error) {
+	db := database.GetReadDB()
+
+	if params.TopModels <= 0 {
+		params.TopModels = 5
+	}
+	if params.RecentLimit <= 0 {
+		params.RecentLimit = 10
+	}
+
+	conditions := []string{"created_at >= ?", "created_at <= ?"}
+	args := []interface{}{params.From.UTC(), params.To.UTC()}
+	if params.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, params.UserID)
+	}
+	whereClause := strings.Join(conditions, " AND ")
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: database.IsPostgres()})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	summary := &DashboardSummary{}
+
+	err = tx.QueryRow(fmt.Sprintf(`
+		SELECT COUNT(*),
+		       COALESCE(SUM(input_tokens), 0),
+		       COALESCE(SUM(output_tokens), 0),
+		       COALESCE(SUM(cost_micros), 0),
+		       COALESCE(SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END), 0)
+		FROM request_logs WHERE %s
+	`, whereClause), args...).Scan(
+		&summary.Period.RequestCount, &summary.Period.InputTokensSum, &summary.Period.OutputTokensSum,
+		&summary.Period.CostMicrosSum, &summary.Period.ErrorCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf(`
+		SELECT COALESCE(mapped_model, original_model, 'unknown') as model,
+		       COUNT(*) as cnt,
+		       COALESCE(SUM(cost_micros), 0) as cost
+		FROM request_logs
+		WHERE %s
+		GROUP BY model
+		ORDER BY cnt DESC
+		LIMIT ?
+	`, whereClause), append(args, params.TopModels)...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var m DashboardTopModel
+		if err := rows.Scan(&m.Model, &m.RequestCount, &m.CostMicros); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		summary.TopModels = append(summary.TopModels, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(fmt.Sprintf(`
+		SELECT %s as day,
+		       COALESCE(SUM(cost_micros), 0) as cost,
+		       COUNT(*) as cnt
+		FROM request_logs
+		WHERE %s
+		GROUP BY day
+		ORDER BY day ASC
+	`, database.DayBucketExprIn("created_at", params.Location), whereClause), args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var d DashboardDailyTrend
+		if err := rows.Scan(&d.Date, &d.CostMicros, &d.Requests); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		summary.DailyTrend = append(summary.DailyTrend, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`
+		SELECT provider, total_input, cache_read, cache_creation, req_count FROM (
+			SELECT
+				`+cacheProviderExpr+` as provider,
+				COALESCE(SUM(input_tokens), 0) as total_input,
+				COALESCE(SUM(cache_read_input_tokens), 0) as cache_read,
+				COALESCE(SUM(cache_creation_input_tokens), 0) as cache_creation,
+				COUNT(*) as req_count
+			FROM request_logs
+			WHERE `+whereClause+`
+			GROUP BY `+cacheProviderExpr+`
+		) t WHERE provider IN ('Claude', 'OpenAI', 'Gemini')
+		ORDER BY req_count DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c DashboardCacheHitRate
+		if err := rows.Scan(&c.Provider, &c.TotalInputTokens, &c.CacheReadTokens, &c.CacheCreationTokens, &c.RequestCount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		totalRelevant := c.TotalInputTokens + c.CacheReadTokens
+		if totalRelevant > 0 {
+			c.HitRate = float64(c.CacheReadTokens) / float64(totalRelevant) * 100
+		}
+		summary.CacheHitRates = append(summary.CacheHitRates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(fmt.Sprintf(`
+		SELECT id, created_at, status, user_id, api_key_id, original_model, mapped_model,
+		       method, path, status_code, latency_ms, is_streaming, cost_micros
+		FROM request_logs
+		WHERE %s
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, whereClause), append(args, params.RecentLimit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l model.RequestLog
+		var createdAt time.Time
+		var status, originalModel, mappedModel sql.NullString
+		var isStreaming int
+		var costMicros sql.NullInt64
+		if err := rows.Scan(
+			&l.ID, &createdAt, &status, &l.UserID, &l.APIKeyID, &originalModel, &mappedModel,
+			&l.Method, &l.Path, &l.StatusCode, &l.LatencyMs, &isStreaming, &costMicros,
+		); err != nil {
+			return nil, err
+		}
+		l.CreatedAt = createdAt.Format(time.RFC3339)
+		l.IsStreaming = isStreaming == 1
+		l.Status = model.RequestLogStatusSuccess
+		if status.Valid {
+			l.Status = model.RequestLogStatus(status.String)
+		}
+		if originalModel.Valid {
+			l.OriginalModel = &originalModel.String
+		}
+		if mappedModel.Valid {
+			l.MappedModel = &mappedModel.String
+		}
+		if costMicros.Valid {
+			l.CostMicros = &costMicros.Int64
+		}
+		summary.RecentLogs = append(summary.RecentLogs, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// FailedRequestSample 失败请求样本（用于错误聚类分析）
+type FailedRequestSample struct {
+	ID          string
+	CreatedAt   time.Time
+	ErrorType   string
+	StatusCode  int
+	ChannelID   string
+	ChannelName string
+	Model       string
+	Message     string
+}
+
+// ListFailedSince 获取指定时间之后的失败请求（按时间倒序，最多 limit 条）
+func (r *RequestLogRepository) ListFailedSince(since time.Time, limit int) ([]FailedRequestSample, error) {
+	db := database.GetDB()
+
+	messageExpr := "COALESCE(SUBSTR(d.response_body, 1, 2000), SUBSTR(r.response_text, 1, 2000), '')"
+	detailJoin := "LEFT JOIN request_log_details d ON r.id = d.request_id"
+	if database.HasArchiveTable() {
+		detailJoin += "\n\t\tLEFT JOIN request_log_details_archive da ON r.id = da.request_id"
+		messageExpr = "COALESCE(SUBSTR(d.response_body, 1, 2000), SUBSTR(da.response_body, 1, 2000), SUBSTR(r.response_text, 1, 2000), '')"
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT r.id, r.created_at, COALESCE(r.error_type, ''), r.status_code,
+		       COALESCE(r.channel_id, ''), COALESCE(c.name, ''),
+		       COALESCE(r.mapped_model, r.original_model, ''), %s
+		FROM request_logs r
+		%s
+		LEFT JOIN channels c ON r.channel_id = c.id
+		WHERE r.created_at >= ? AND (r.status = 'error' OR r.status_code >= 400)
+		ORDER BY r.created_at DESC
+		LIMIT ?
+	`, messageExpr, detailJoin), since.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []FailedRequestSample
+	for rows.Next() {
+		var s FailedRequestSample
+		if err := rows.Scan(&s.ID, &s.CreatedAt, &s.ErrorType, &s.StatusCode, &s.ChannelID, &s.ChannelName, &s.Model, &s.Message); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
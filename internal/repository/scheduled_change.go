@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+const scheduledChangeColumns = `id, kind, target_id, payload_json, previous_json, note, apply_at, revert_at, status,
+	applied_at, reverted_at, error, created_by, created_at, updated_at`
+
+type ScheduledChangeRepository struct{}
+
+func NewScheduledChangeRepository() *ScheduledChangeRepository {
+	return &ScheduledChangeRepository{}
+}
+
+func (r *ScheduledChangeRepository) Create(change *model.ScheduledChange) error {
+	db := database.GetDB()
+	payloadJSON, err := json.Marshal(change.Payload)
+	if err != nil {
+		return err
+	}
+	change.ID = uuid.New().String()
+	change.Status = model.ScheduledChangePending
+	now := time.Now().UTC()
+	change.CreatedAt = now
+	change.UpdatedAt = now
+
+	_, err = db.Exec(
+		`INSERT INTO scheduled_changes (id, kind, target_id, payload_json, note, apply_at, revert_at, status, created_by, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		change.ID, change.Kind, change.TargetID, string(payloadJSON), change.Note, change.ApplyAt, change.RevertAt,
+		change.Status, change.CreatedBy, change.CreatedAt, change.UpdatedAt,
+	)
+	return err
+}
+
+func (r *ScheduledChangeRepository) GetByID(id string) (*model.ScheduledChange, error) {
+	db := database.GetDB()
+	change, err := scanScheduledChange(db.QueryRow(`SELECT `+scheduledChangeColumns+` FROM scheduled_changes WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return change, err
+}
+
+// List 列出定时变更，status 为空时返回全部，按生效时间倒序
+func (r *ScheduledChangeRepository) List(status string) ([]*model.ScheduledChange, error) {
+	query := `SELECT ` + scheduledChangeColumns + ` FROM scheduled_changes`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY apply_at DESC`
+	return r.query(query, args...)
+}
+
+// ListDue 列出到达生效时间的待生效变更，以及到达恢复时间的已生效变更，按时间先后排序
+func (r *ScheduledChangeRepository) ListDue(now time.Time) ([]*model.ScheduledChange, error) {
+	return r.query(
+		`SELECT `+scheduledChangeColumns+` FROM scheduled_changes
+		 WHERE (status = ? AND apply_at <= ?) OR (status = ? AND revert_at IS NOT NULL AND revert_at <= ?)
+		 ORDER BY apply_at ASC`,
+		model.ScheduledChangePending, now, model.ScheduledChangeApplied, now,
+	)
+}
+
+// MarkApplied 记录变更已生效及生效前的值，仅在仍为待生效时更新
+func (r *ScheduledChangeRepository) MarkApplied(id string, previous *model.ScheduledChangePayload, at time.Time) (bool, error) {
+	previousJSON, err := json.Marshal(previous)
+	if err != nil {
+		return false, err
+	}
+	return r.transition(
+		`UPDATE scheduled_changes SET status = ?, previous_json = ?, applied_at = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		model.ScheduledChangeApplied, string(previousJSON), at, at, id, model.ScheduledChangePending,
+	)
+}
+
+// MarkReverted 记录变更已恢复，仅在仍为已生效时更新
+func (r *ScheduledChangeRepository) MarkReverted(id string, at time.Time) (bool, error) {
+	return r.transition(
+		`UPDATE scheduled_changes SET status = ?, reverted_at = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		model.ScheduledChangeReverted, at, at, id, model.ScheduledChangeApplied,
+	)
+}
+
+// MarkFailed 记录生效或恢复失败，from 为执行前的状态
+func (r *ScheduledChangeRepository) MarkFailed(id string, from model.ScheduledChangeStatus, reason string) (bool, error) {
+	return r.transition(
+		`UPDATE scheduled_changes SET status = ?, error = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		model.ScheduledChangeFailed, reason, time.Now().UTC(), id, from,
+	)
+}
+
+// Cancel 取消尚未生效的变更
+func (r *ScheduledChangeRepository) Cancel(id string) (bool, error) {
+	return r.transition(
+		`UPDATE scheduled_changes SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		model.ScheduledChangeCancelled, time.Now().UTC(), id, model.ScheduledChangePending,
+	)
+}
+
+func (r *ScheduledChangeRepository) transition(query string, args ...interface{}) (bool, error) {
+	db := database.GetDB()
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *ScheduledChangeRepository) query(query string, args ...interface{}) ([]*model.ScheduledChange, error) {
+	db := database.GetDB()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*model.ScheduledChange{}
+	for rows.Next() {
+		change, err := scanScheduledChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func scanScheduledChange(row rowScanner) (*model.ScheduledChange, error) {
+	change := &model.ScheduledChange{}
+	var payloadJSON, previousJSON string
+	var revertAt, appliedAt, revertedAt sql.NullTime
+	if err := row.Scan(&change.ID, &change.Kind, &change.TargetID, &payloadJSON, &previousJSON, &change.Note,
+		&change.ApplyAt, &revertAt, &change.Status, &appliedAt, &revertedAt, &change.Error,
+		&change.CreatedBy, &change.CreatedAt, &change.UpdatedAt); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(payloadJSON), &change.Payload)
+	if previousJSON != "" {
+		var previous model.ScheduledChangePayload
+		if err := json.Unmarshal([]byte(previousJSON), &previous); err == nil {
+			change.Previous = &previous
+		}
+	}
+	if revertAt.Valid {
+		change.RevertAt = &revertAt.Time
+	}
+	if appliedAt.Valid {
+		change.AppliedAt = &appliedAt.Time
+	}
+	if revertedAt.Valid {
+		change.RevertedAt = &revertedAt.Time
+	}
+	return change, nil
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ampmanager/internal/crypto"
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+)
+
+// 渠道 API Key（api_key、api_keys_json）与用户上游 API Key（upstream_api_key）在本层透明加解密：
+// 配置主密钥时写入前信封加密，读取后解密，调用方始终使用明文
+
+// ErrEncryptionKeyMissing 数据库中存在加密的密钥，但未配置主密钥
+var ErrEncryptionKeyMissing = errors.New("数据库中存在加密的密钥，但未配置 DATA_ENCRYPTION_KEY")
+
+var encryptionKeyProvider func() []byte
+
+// SetEncryptionKeyProvider 设置主密钥来源，每次加解密时调用，外部存储中的密钥轮换后立即生效；
+// 未设置或返回空时以明文存储
+func SetEncryptionKeyProvider(provider func() []byte) {
+	encryptionKeyProvider = provider
+}
+
+func encryptionKey() []byte {
+	if encryptionKeyProvider == nil {
+		return nil
+	}
+	return encryptionKeyProvider()
+}
+
+// sealSecret 加密待写入的密钥；未配置主密钥或已是密文时原样返回
+func sealSecret(value string) (string, error) {
+	key := encryptionKey()
+	if value == "" || key == nil || crypto.IsEnvelope(value) {
+		return value, nil
+	}
+	sealed, err := crypto.EncryptEnvelope([]byte(value), key)
+	if err != nil {
+		return "", fmt.Errorf("encrypt secret: %w", err)
+	}
+	return sealed, nil
+}
+
+// openSecret 解密读取到的密钥，开启加密前保存的明文原样返回
+func openSecret(stored string) (string, error) {
+	if stored == "" {
+		return "", nil
+	}
+	key := encryptionKey()
+	if crypto.IsEnvelope(stored) {
+		if key == nil {
+			return "", ErrEncryptionKeyMissing
+		}
+		plain, err := crypto.DecryptEnvelope(stored, key)
+		if err != nil {
+			return "", fmt.Errorf("decrypt secret: %w", err)
+		}
+		return string(plain), nil
+	}
+	// 早期版本的上游 API Key 由服务层以单层 AES-GCM 加密
+	if key != nil && crypto.IsEncrypted(stored) {
+		if plain, err := crypto.Decrypt(stored, key); err == nil {
+			return string(plain), nil
+		}
+	}
+	return stored, nil
+}
+
+// openChannelSecrets 解密渠道的主密钥与密钥池
+func openChannelSecrets(channel *model.Channel) error {
+	var err error
+	if channel.APIKey, err = openSecret(channel.APIKey); err != nil {
+		return err
+	}
+	channel.APIKeysJSON, err = openSecret(channel.APIKeysJSON)
+	return err
+}
+
+// sealChannelSecrets 返回渠道主密钥与密钥池的存储值，不修改 channel
+func sealChannelSecrets(channel *model.Channel) (apiKey, apiKeysJSON string, err error) {
+	if apiKey, err = sealSecret(channel.APIKey); err != nil {
+		return "", "", err
+	}
+	if apiKeysJSON, err = sealSecret(channel.APIKeysJSON); err != nil {
+		return "", "", err
+	}
+	return apiKey, apiKeysJSON, nil
+}
+
+// secretColumns 需要加密存储的列
+var secretColumns = []struct {
+	table   string
+	columns []string
+}{
+	{table: "channels", columns: []string{"api_key", "api_keys_json"}},
+	{table: "user_amp_settings", columns: []string{"upstream_api_key"}},
+}
+
+// EncryptStoredSecrets 启动时把明文（及早期单层加密）的密钥改写为信封加密，返回改写的记录数；
+// 未配置主密钥时只做检查，存在已加密的值则返回 ErrEncryptionKeyMissing
+func EncryptStoredSecrets() (int, error) {
+	db := database.GetDB()
+	key := encryptionKey()
+	migrated := 0
+	for _, target := range secretColumns {
+		rows, err := loadSecretRows(db, target.table, target.columns)
+		if err != nil {
+			return migrated, err
+		}
+		for _, row := range rows {
+			sealed := make([]string, len(row.values))
+			changed := false
+			for i, stored := range row.values {
+				// 已加密的值只校验能否用当前主密钥解密
+				plain, err := openSecret(stored)
+				if err != nil {
+					return migrated, fmt.Errorf("%s %s: %w", target.table, row.id, err)
+				}
+				if key == nil || crypto.IsEnvelope(stored) {
+					sealed[i] = stored
+					continue
+				}
+				if sealed[i], err = sealSecret(plain); err != nil {
+					return migrated, err
+				}
+				changed = changed || sealed[i] != stored
+			}
+			if !changed {
+				continue
+			}
+			if err := updateSecretRow(db, target.table, target.columns, row, sealed); err != nil {
+				return migrated, err
+			}
+			migrated++
+		}
+	}
+	return migrated, nil
+}
+
+type secretRow struct {
+	id     string
+	values []string
+}
+
+func loadSecretRows(db *sql.DB, table string, columns []string) ([]secretRow, error) {
+	rows, err := db.Query(`SELECT id, ` + strings.Join(columns, ", ") + ` FROM ` + table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []secretRow
+	for rows.Next() {
+		row := secretRow{values: make([]string, len(columns))}
+		values := make([]sql.NullString, len(columns))
+		dest := []any{&row.id}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			row.values[i] = value.String
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// updateSecretRow 只改写密钥列，不递增版本号；以原值为条件（NULL 视同空串），期间被修改的记录保持不变并返回错误
+func updateSecretRow(db *sql.DB, table string, columns []string, row secretRow, sealed []string) error {
+	set := make([]string, len(columns))
+	where := make([]string, len(columns))
+	args := make([]any, 0, 2*len(columns)+1)
+	for i, column := range columns {
+		set[i] = column + " = ?"
+		where[i] = "COALESCE(" + column + ", '') = ?"
+		args = append(args, sealed[i])
+	}
+	args = append(args, row.id)
+	for _, value := range row.values {
+		args = append(args, value)
+	}
+	result, err := db.Exec(`UPDATE `+table+` SET `+strings.Join(set, ", ")+` WHERE id = ? AND `+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s %s: secret columns changed during encryption, retry", table, row.id)
+	}
+	return nil
+}
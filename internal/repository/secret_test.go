@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/crypto"
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+)
+
+// setupTestDB 为每个测试初始化独立的 SQLite 数据库
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+}
+
+// withEncryptionKey 设置主密钥，nil 表示未配置
+func withEncryptionKey(t *testing.T, key []byte) {
+	t.Helper()
+	prev := encryptionKeyProvider
+	SetEncryptionKeyProvider(func() []byte { return key })
+	t.Cleanup(func() { encryptionKeyProvider = prev })
+}
+
+var (
+	testMasterKey  = bytes.Repeat([]byte{0x11}, 32)
+	rotatedTestKey = bytes.Repeat([]byte{0x22}, 32)
+)
+
+func createTestChannel(t *testing.T, apiKey string) *model.Channel {
+	t.Helper()
+	channel := &model.Channel{
+		Type:        model.ChannelTypeOpenAI,
+		Endpoint:    model.ChannelEndpointChatCompletions,
+		Name:        "test",
+		BaseURL:     "https://api.example.com",
+		APIKey:      apiKey,
+		APIKeysJSON: `[{"key":"sk-pool"}]`,
+		Enabled:     true,
+		ModelsJSON:  "[]",
+		HeadersJSON: "{}",
+	}
+	if err := NewChannelRepository().Create(channel); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	return channel
+}
+
+func storedChannelSecrets(t *testing.T, id string) (string, string) {
+	t.Helper()
+	var apiKey, apiKeysJSON string
+	if err := database.GetDB().QueryRow(`SELECT api_key, api_keys_json FROM channels WHERE id = ?`, id).Scan(&apiKey, &apiKeysJSON); err != nil {
+		t.Fatalf("read channel: %v", err)
+	}
+	return apiKey, apiKeysJSON
+}
+
+func TestChannelSecretsRoundTrip(t *testing.T) {
+	setupTestDB(t)
+	withEncryptionKey(t, testMasterKey)
+
+	channel := createTestChannel(t, "sk-round-trip")
+	apiKey, apiKeysJSON := storedChannelSecrets(t, channel.ID)
+	if !crypto.IsEnvelope(apiKey) || !crypto.IsEnvelope(apiKeysJSON) || strings.Contains(apiKey, "sk-round-trip") {
+		t.Fatalf("stored = %q, %q", apiKey, apiKeysJSON)
+	}
+
+	got, err := NewChannelRepository().GetByID(channel.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.APIKey != "sk-round-trip" || got.APIKeysJSON != `[{"key":"sk-pool"}]` {
+		t.Errorf("opened = %q, %q", got.APIKey, got.APIKeysJSON)
+	}
+}
+
+func TestLegacyPlaintextSecretPassthrough(t *testing.T) {
+	setupTestDB(t)
+	withEncryptionKey(t, nil)
+	channel := createTestChannel(t, "sk-plain")
+	if apiKey, _ := storedChannelSecrets(t, channel.ID); apiKey != "sk-plain" {
+		t.Fatalf("stored without key = %q", apiKey)
+	}
+
+	// 开启加密后、启动迁移前，存量明文仍可读取
+	withEncryptionKey(t, testMasterKey)
+	got, err := NewChannelRepository().GetByID(channel.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.APIKey != "sk-plain" {
+		t.Errorf("opened = %q", got.APIKey)
+	}
+
+	// 早期版本单层加密的上游 API Key 同样可读
+	legacy, err := crypto.Encrypt([]byte("sk-legacy-upstream"), testMasterKey)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if plain, err := openSecret(legacy); err != nil || plain != "sk-legacy-upstream" {
+		t.Errorf("legacy = %q, %v", plain, err)
+	}
+}
+
+func TestSecretWrongKey(t *testing.T) {
+	setupTestDB(t)
+	withEncryptionKey(t, testMasterKey)
+	channel := createTestChannel(t, "sk-secret")
+
+	withEncryptionKey(t, rotatedTestKey)
+	if _, err := NewChannelRepository().GetByID(channel.ID); err == nil {
+		t.Error("expected error reading with a different master key")
+	}
+	if _, err := EncryptStoredSecrets(); err == nil {
+		t.Error("expected startup check to fail with a different master key")
+	}
+
+	withEncryptionKey(t, nil)
+	if _, err := NewChannelRepository().GetByID(channel.ID); !errors.Is(err, ErrEncryptionKeyMissing) {
+		t.Errorf("missing key error = %v", err)
+	}
+	if _, err := EncryptStoredSecrets(); !errors.Is(err, ErrEncryptionKeyMissing) {
+		t.Errorf("startup check without key = %v", err)
+	}
+}
+
+func TestEncryptStoredSecretsIdempotent(t *testing.T) {
+	setupTestDB(t)
+	withEncryptionKey(t, nil)
+	first := createTestChannel(t, "sk-first")
+	second := createTestChannel(t, "")
+
+	withEncryptionKey(t, testMasterKey)
+	migrated, err := EncryptStoredSecrets()
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if migrated != 2 {
+		t.Fatalf("migrated = %d, want 2", migrated)
+	}
+	firstKey, firstPool := storedChannelSecrets(t, first.ID)
+	secondKey, secondPool := storedChannelSecrets(t, second.ID)
+	if !crypto.IsEnvelope(firstKey) || !crypto.IsEnvelope(firstPool) || !crypto.IsEnvelope(secondPool) {
+		t.Fatalf("not sealed: %q, %q, %q", firstKey, firstPool, secondPool)
+	}
+	if secondKey != "" {
+		t.Errorf("empty key sealed as %q", secondKey)
+	}
+
+	// 再次执行不改写任何记录，也不会对密文再加密一层
+	migrated, err = EncryptStoredSecrets()
+	if err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	if migrated != 0 {
+		t.Errorf("second migrated = %d, want 0", migrated)
+	}
+	againKey, againPool := storedChannelSecrets(t, first.ID)
+	if againKey != firstKey || againPool != firstPool {
+		t.Error("sealed values rewritten on second run")
+	}
+	plain, err := crypto.DecryptEnvelope(againKey, testMasterKey)
+	if err != nil || string(plain) != "sk-first" {
+		t.Errorf("single layer decrypt = %q, %v", plain, err)
+	}
+}
+
+func TestUpdateSecretRowNullColumns(t *testing.T) {
+	setupTestDB(t)
+	db := database.GetDB()
+	if _, err := db.Exec(`CREATE TABLE secret_rows (id TEXT PRIMARY KEY, a TEXT, b TEXT)`); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO secret_rows (id, a, b) VALUES ('r1', 'sk-a', NULL)`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	columns := []string{"a", "b"}
+	rows, err := loadSecretRows(db, "secret_rows", columns)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("load = %+v, %v", rows, err)
+	}
+	if err := updateSecretRow(db, "secret_rows", columns, rows[0], []string{"sealed-a", ""}); err != nil {
+		t.Fatalf("update with NULL column: %v", err)
+	}
+	var a string
+	if err := db.QueryRow(`SELECT a FROM secret_rows WHERE id = 'r1'`).Scan(&a); err != nil || a != "sealed-a" {
+		t.Fatalf("a = %q, %v", a, err)
+	}
+
+	// 读取后被修改的记录不覆盖，并返回错误而非静默跳过
+	if err := updateSecretRow(db, "secret_rows", columns, rows[0], []string{"sealed-again", ""}); err == nil {
+		t.Error("expected error when the row changed after loading")
+	}
+}
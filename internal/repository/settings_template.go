@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+const settingsTemplateColumns = `t.id, t.name, t.description, t.kind, t.version, t.content_json, t.created_at, t.updated_at,
+	(SELECT COUNT(*) FROM user_settings_templates ut WHERE ut.template_id = t.id)`
+
+type SettingsTemplateRepository struct{}
+
+func NewSettingsTemplateRepository() *SettingsTemplateRepository {
+	return &SettingsTemplateRepository{}
+}
+
+// Create 创建模板并保存第 1 版内容
+func (r *SettingsTemplateRepository) Create(tpl *model.SettingsTemplate) error {
+	contentJSON, err := json.Marshal(tpl.Content)
+	if err != nil {
+		return err
+	}
+	tpl.ID = uuid.New().String()
+	tpl.Version = 1
+	now := time.Now().UTC()
+	tpl.CreatedAt = now
+	tpl.UpdatedAt = now
+
+	tx, err := database.GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO settings_templates (id, name, description, kind, version, content_json, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		tpl.ID, tpl.Name, tpl.Description, tpl.Kind, tpl.Version, string(contentJSON), tpl.CreatedAt, tpl.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO settings_template_versions (template_id, version, content_json, created_at) VALUES (?, ?, ?, ?)`,
+		tpl.ID, tpl.Version, string(contentJSON), now,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Update 更新模板；newVersion 为 true 时版本号加 1 并保存新版本内容，否则只更新名称与描述
+func (r *SettingsTemplateRepository) Update(tpl *model.SettingsTemplate, newVersion bool) error {
+	contentJSON, err := json.Marshal(tpl.Content)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	tpl.UpdatedAt = now
+
+	tx, err := database.GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if newVersion {
+		tpl.Version++
+		if _, err := tx.Exec(
+			`INSERT INTO settings_template_versions (template_id, version, content_json, created_at) VALUES (?, ?, ?, ?)`,
+			tpl.ID, tpl.Version, string(contentJSON), now,
+		); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(
+		`UPDATE settings_templates SET name = ?, description = ?, version = ?, content_json = ?, updated_at = ? WHERE id = ?`,
+		tpl.Name, tpl.Description, tpl.Version, string(contentJSON), tpl.UpdatedAt, tpl.ID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SettingsTemplateRepository) GetByID(id string) (*model.SettingsTemplate, error) {
+	db := database.GetDB()
+	tpl, err := scanSettingsTemplate(db.QueryRow(`SELECT `+settingsTemplateColumns+` FROM settings_templates t WHERE t.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return tpl, err
+}
+
+func (r *SettingsTemplateRepository) List() ([]*model.SettingsTemplate, error) {
+	db := database.GetDB()
+	rows, err := db.Query(`SELECT ` + settingsTemplateColumns + ` FROM settings_templates t ORDER BY t.kind ASC, t.name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*model.SettingsTemplate
+	for rows.Next() {
+		tpl, err := scanSettingsTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tpl)
+	}
+	return templates, rows.Err()
+}
+
+func (r *SettingsTemplateRepository) ExistsByName(name, excludeID string) (bool, error) {
+	db := database.GetDB()
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM settings_templates WHERE name = ? AND id != ?`, name, excludeID).Scan(&count)
+	return count > 0, err
+}
+
+// Delete 删除模板及其版本和应用记录，已应用到用户设置中的内容保留
+func (r *SettingsTemplateRepository) Delete(id string) (bool, error) {
+	db := database.GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_settings_templates WHERE template_id = ?`, id); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM settings_template_versions WHERE template_id = ?`, id); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(`DELETE FROM settings_templates WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, tx.Commit()
+}
+
+// GetVersion 获取模板的指定版本，不存在时返回 nil
+func (r *SettingsTemplateRepository) GetVersion(templateID string, version int) (*model.SettingsTemplateVersion, error) {
+	db := database.GetDB()
+	v := &model.SettingsTemplateVersion{}
+	var contentJSON string
+	err := db.QueryRow(
+		`SELECT version, content_json, created_at FROM settings_template_versions WHERE template_id = ? AND version = ?`,
+		templateID, version,
+	).Scan(&v.Version, &contentJSON, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(contentJSON), &v.Content)
+	return v, nil
+}
+
+// ListVersions 按版本号倒序列出模板的历史版本
+func (r *SettingsTemplateRepository) ListVersions(templateID string) ([]*model.SettingsTemplateVersion, error) {
+	db := database.GetDB()
+	rows, err := db.Query(
+		`SELECT version, content_json, created_at FROM settings_template_versions WHERE template_id = ? ORDER BY version DESC`,
+		templateID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*model.SettingsTemplateVersion
+	for rows.Next() {
+		v := &model.SettingsTemplateVersion{}
+		var contentJSON string
+		if err := rows.Scan(&v.Version, &contentJSON, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(contentJSON), &v.Content)
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// UpsertBinding 记录用户应用的模板版本
+func (r *SettingsTemplateRepository) UpsertBinding(binding *model.UserSettingsTemplate) error {
+	db := database.GetDB()
+	binding.AppliedAt = time.Now().UTC()
+	_, err := db.Exec(`
+		INSERT INTO user_settings_templates (user_id, template_id, version, pinned, applied_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, template_id) DO UPDATE SET
+			version = excluded.version,
+			pinned = excluded.pinned,
+			applied_at = excluded.applied_at`,
+		binding.UserID, binding.TemplateID, binding.Version, binding.Pinned, binding.AppliedAt,
+	)
+	return err
+}
+
+func (r *SettingsTemplateRepository) DeleteBinding(userID, templateID string) (bool, error) {
+	db := database.GetDB()
+	result, err := db.Exec(`DELETE FROM user_settings_templates WHERE user_id = ? AND template_id = ?`, userID, templateID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *SettingsTemplateRepository) GetBinding(userID, templateID string) (*model.UserSettingsTemplate, error) {
+	db := database.GetDB()
+	b := &model.UserSettingsTemplate{}
+	err := db.QueryRow(
+		`SELECT user_id, template_id, version, pinned, applied_at FROM user_settings_templates WHERE user_id = ? AND template_id = ?`,
+		userID, templateID,
+	).Scan(&b.UserID, &b.TemplateID, &b.Version, &b.Pinned, &b.AppliedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return b, err
+}
+
+func (r *SettingsTemplateRepository) ListBindingsByUser(userID string) ([]*model.UserSettingsTemplate, error) {
+	return r.listBindings(`SELECT user_id, template_id, version, pinned, applied_at FROM user_settings_templates WHERE user_id = ?`, userID)
+}
+
+func (r *SettingsTemplateRepository) ListBindingsByTemplate(templateID string) ([]*model.UserSettingsTemplate, error) {
+	return r.listBindings(`SELECT user_id, template_id, version, pinned, applied_at FROM user_settings_templates WHERE template_id = ? ORDER BY user_id`, templateID)
+}
+
+func (r *SettingsTemplateRepository) listBindings(query string, arg string) ([]*model.UserSettingsTemplate, error) {
+	db := database.GetDB()
+	rows, err := db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bindings []*model.UserSettingsTemplate
+	for rows.Next() {
+		b := &model.UserSettingsTemplate{}
+		if err := rows.Scan(&b.UserID, &b.TemplateID, &b.Version, &b.Pinned, &b.AppliedAt); err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, rows.Err()
+}
+
+func scanSettingsTemplate(row rowScanner) (*model.SettingsTemplate, error) {
+	tpl := &model.SettingsTemplate{}
+	var contentJSON string
+	if err := row.Scan(&tpl.ID, &tpl.Name, &tpl.Description, &tpl.Kind, &tpl.Version, &contentJSON,
+		&tpl.CreatedAt, &tpl.UpdatedAt, &tpl.AppliedUsers); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(contentJSON), &tpl.Content)
+	return tpl, nil
+}
@@ -41,10 +41,11 @@ func (r *SubscriptionPlanRepository) Create(plan *model.SubscriptionPlan, limits
 	plan.ID = uuid.New().String()
 	plan.CreatedAt = time.Now().UTC()
 	plan.UpdatedAt = plan.CreatedAt
+	plan.Version = 1
 
 	_, err = tx.Exec(
-		`INSERT INTO subscription_plans (id, name, description, enabled, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		plan.ID, plan.Name, plan.Description, plan.Enabled, plan.CreatedAt, plan.UpdatedAt,
+		`INSERT INTO subscription_plans (id, name, description, enabled, reset_timezone, reset_hour, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		plan.ID, plan.Name, plan.Description, plan.Enabled, plan.ResetTimezone, plan.ResetHour, plan.CreatedAt, plan.UpdatedAt,
 	)
 	if err != nil {
 		return err
@@ -71,8 +72,8 @@ func (r *SubscriptionPlanRepository) GetByID(id string) (*model.SubscriptionPlan
 	db := database.GetDB()
 	plan := &model.SubscriptionPlan{}
 	err := db.QueryRow(
-		`SELECT id, name, description, enabled, created_at, updated_at FROM subscription_plans WHERE id = ?`, id,
-	).Scan(&plan.ID, &plan.Name, &plan.Description, &plan.Enabled, &plan.CreatedAt, &plan.UpdatedAt)
+		`SELECT id, name, description, enabled, reset_timezone, reset_hour, version, created_at, updated_at FROM subscription_plans WHERE id = ?`, id,
+	).Scan(&plan.ID, &plan.Name, &plan.Description, &plan.Enabled, &plan.ResetTimezone, &plan.ResetHour, &plan.Version, &plan.CreatedAt, &plan.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil, nil
 	}
@@ -91,7 +92,7 @@ func (r *SubscriptionPlanRepository) GetByID(id string) (*model.SubscriptionPlan
 func (r *SubscriptionPlanRepository) List() ([]*model.SubscriptionPlan, map[string][]model.SubscriptionPlanLimit, error) {
 	db := database.GetDB()
 	rows, err := db.Query(
-		`SELECT id, name, description, enabled, created_at, updated_at FROM subscription_plans ORDER BY created_at DESC`,
+		`SELECT id, name, description, enabled, reset_timezone, reset_hour, version, created_at, updated_at FROM subscription_plans ORDER BY created_at DESC`,
 	)
 	if err != nil {
 		return nil, nil, err
@@ -101,7 +102,7 @@ func (r *SubscriptionPlanRepository) List() ([]*model.SubscriptionPlan, map[stri
 	var plans []*model.SubscriptionPlan
 	for rows.Next() {
 		p := &model.SubscriptionPlan{}
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Enabled, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Enabled, &p.ResetTimezone, &p.ResetHour, &p.Version, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			return nil, nil, err
 		}
 		plans = append(plans, p)
@@ -131,9 +132,11 @@ func (r *SubscriptionPlanRepository) Update(id string, plan *model.SubscriptionP
 	defer tx.Rollback()
 
 	now := time.Now().UTC()
+	// plan.Version 为读取时的版本号，不一致说明已被其他请求修改
 	result, err := tx.Exec(
-		`UPDATE subscription_plans SET name = ?, description = ?, enabled = ?, updated_at = ? WHERE id = ?`,
-		plan.Name, plan.Description, plan.Enabled, now, id,
+		`UPDATE subscription_plans SET name = ?, description = ?, enabled = ?, reset_timezone = ?, reset_hour = ?, updated_at = ?, version = version + 1
+		 WHERE id = ? AND version = ?`,
+		plan.Name, plan.Description, plan.Enabled, plan.ResetTimezone, plan.ResetHour, now, id, plan.Version,
 	)
 	if err != nil {
 		return err
@@ -143,7 +146,7 @@ func (r *SubscriptionPlanRepository) Update(id string, plan *model.SubscriptionP
 		return err
 	}
 	if affected == 0 {
-		return ErrPlanNotFound
+		return ErrVersionConflict
 	}
 
 	_, err = tx.Exec(`DELETE FROM subscription_plan_limits WHERE plan_id = ?`, id)
@@ -177,7 +180,7 @@ func (r *SubscriptionPlanRepository) Delete(id string) error {
 func (r *SubscriptionPlanRepository) SetEnabled(id string, enabled bool) error {
 	db := database.GetDB()
 	result, err := db.Exec(
-		`UPDATE subscription_plans SET enabled = ?, updated_at = ? WHERE id = ?`,
+		`UPDATE subscription_plans SET enabled = ?, updated_at = ?, version = version + 1 WHERE id = ?`,
 		enabled, time.Now().UTC(), id,
 	)
 	if err != nil {
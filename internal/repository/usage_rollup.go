@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"ampmanager/internal/database"
+)
+
+// 汇总粒度
+const (
+	UsageRollupHour = "hour"
+	UsageRollupDay  = "day"
+)
+
+// 汇总桶的键格式（UTC），与 database.HourBucketExpr / DayBucketExpr 的输出一致
+const (
+	UsageRollupHourLayout = "2006-01-02 15"
+	UsageRollupDayLayout  = "2006-01-02"
+)
+
+// UsageRollupPoint 单个时间桶的汇总
+type UsageRollupPoint struct {
+	Bucket          string
+	Requests        int64
+	Errors          int64
+	InputTokens     int64
+	OutputTokens    int64
+	CacheReadTokens int64
+	CostMicros      int64
+}
+
+// UsageRollupRepository 按用户与小时/天预聚合的请求统计，供长周期趋势图使用
+type UsageRollupRepository struct{}
+
+func NewUsageRollupRepository() *UsageRollupRepository {
+	return &UsageRollupRepository{}
+}
+
+// EarliestRequestTime 最早一条请求日志的时间，没有日志时返回 nil
+func (r *UsageRollupRepository) EarliestRequestTime() (*time.Time, error) {
+	db := database.GetReadDB()
+	var earliest time.Time
+	err := db.QueryRow(`SELECT created_at FROM request_logs ORDER BY created_at LIMIT 1`).Scan(&earliest)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	earliest = earliest.UTC()
+	return &earliest, nil
+}
+
+// Rebuild 重新汇总 [from, to) 内的小时桶（from 向下取整到小时），再由小时桶重新汇总涉及的天桶。
+// pending 请求不计入，完成后的下一次汇总会覆盖对应的小时桶
+func (r *UsageRollupRepository) Rebuild(from, to time.Time) error {
+	from = from.UTC().Truncate(time.Hour)
+	to = to.UTC()
+	dayFrom := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	dayTo := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+
+	db := database.GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM usage_rollups WHERE resolution = ? AND bucket >= ? AND bucket < ?`,
+		UsageRollupHour, from.Format(UsageRollupHourLayout), to.Add(time.Hour).Truncate(time.Hour).Format(UsageRollupHourLayout)); err != nil {
+		return fmt.Errorf("delete hour rollups: %w", err)
+	}
+	hourExpr := database.HourBucketExpr("created_at")
+	if _, err := tx.Exec(fmt.Sprintf(`
+		INSERT INTO usage_rollups (resolution, bucket, user_id, requests, errors, input_tokens, output_tokens, cache_read_tokens, cost_micros)
+		SELECT ?, %s, user_id,
+		       COUNT(*),
+		       COALESCE(SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END), 0),
+		       COALESCE(SUM(input_tokens), 0),
+		       COALESCE(SUM(output_tokens), 0),
+		       COALESCE(SUM(cache_read_input_tokens), 0),
+		       COALESCE(SUM(cost_micros), 0)
+		FROM request_logs
+		WHERE created_at >= ? AND created_at < ? AND status <> 'pending'
+		GROUP BY %s, user_id
+	`, hourExpr, hourExpr), UsageRollupHour, from, to.Add(time.Hour).Truncate(time.Hour)); err != nil {
+		return fmt.Errorf("insert hour rollups: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM usage_rollups WHERE resolution = ? AND bucket >= ? AND bucket < ?`,
+		UsageRollupDay, dayFrom.Format(UsageRollupDayLayout), dayTo.Format(UsageRollupDayLayout)); err != nil {
+		return fmt.Errorf("delete day rollups: %w", err)
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO usage_rollups (resolution, bucket, user_id, requests, errors, input_tokens, output_tokens, cache_read_tokens, cost_micros)
+		SELECT ?, substr(bucket, 1, 10), user_id,
+		       SUM(requests), SUM(errors), SUM(input_tokens), SUM(output_tokens), SUM(cache_read_tokens), SUM(cost_micros)
+		FROM usage_rollups
+		WHERE resolution = ? AND bucket >= ? AND bucket < ?
+		GROUP BY substr(bucket, 1, 10), user_id
+	`, UsageRollupDay, UsageRollupHour, dayFrom.Format(UsageRollupHourLayout), dayTo.Format(UsageRollupHourLayout)); err != nil {
+		return fmt.Errorf("insert day rollups: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// PruneHours 删除早于 before 的小时桶，天桶不受影响
+func (r *UsageRollupRepository) PruneHours(before time.Time) (int64, error) {
+	db := database.GetDB()
+	result, err := db.Exec(`DELETE FROM usage_rollups WHERE resolution = ? AND bucket < ?`,
+		UsageRollupHour, before.UTC().Format(UsageRollupHourLayout))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Series 按桶返回 [fromBucket, toBucket) 内的汇总，userID 为空时汇总所有用户；没有请求的桶不返回
+func (r *UsageRollupRepository) Series(resolution, fromBucket, toBucket, userID string) ([]UsageRollupPoint, error) {
+	db := database.GetReadDB()
+	query := `
+		SELECT bucket, SUM(requests), SUM(errors), SUM(input_tokens), SUM(output_tokens), SUM(cache_read_tokens), SUM(cost_micros)
+		FROM usage_rollups
+		WHERE resolution = ? AND bucket >= ? AND bucket < ?`
+	args := []interface{}{resolution, fromBucket, toBucket}
+	if userID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` GROUP BY bucket ORDER BY bucket`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []UsageRollupPoint
+	for rows.Next() {
+		var p UsageRollupPoint
+		if err := rows.Scan(&p.Bucket, &p.Requests, &p.Errors, &p.InputTokens, &p.OutputTokens, &p.CacheReadTokens, &p.CostMicros); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
@@ -20,7 +20,18 @@ type UserRepositoryInterface interface {
 	GetByID(id string) (*model.User, error)
 	List() ([]*model.User, error)
 	UpdatePassword(id string, passwordHash string) error
+	UpdatePasswordHash(id string, passwordHash string) error
+	SetPasswordMustChange(id string, required bool) error
 	UpdateUsername(id string, username string) error
+	UpdateTimezone(id string, timezone string) error
+	GetByVerifiedEmail(email string) (*model.User, error)
+	EmailInUse(email, excludeUserID string) (bool, error)
+	UpdateEmail(id string, email string) error
+	MarkEmailVerified(id string, email string) (bool, error)
+	GetSuspension(id string) (*model.UserSuspension, error)
+	ListSuspensions() (map[string]*model.UserSuspension, error)
+	SetSuspension(id string, s *model.UserSuspension) error
+	ClearSuspension(id string) error
 	SetAdmin(id string, isAdmin bool) error
 	SetGroups(id string, groupIDs []string) error
 	GetGroupIDs(userID string) ([]string, error)
@@ -40,27 +51,42 @@ func NewUserRepository() *UserRepository {
 	return &UserRepository{}
 }
 
+const userColumns = `id, username, password_hash, is_admin, balance_micros, timezone, email, email_verified_at, password_changed_at, password_must_change, created_at, updated_at`
+
+func scanUser(row rowScanner) (*model.User, error) {
+	user := &model.User{}
+	var verifiedAt, passwordChangedAt sql.NullTime
+	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.BalanceMicros, &user.Timezone, &user.Email, &verifiedAt, &passwordChangedAt, &user.PasswordMustChange, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	user.PasswordChangedAt = user.CreatedAt
+	if passwordChangedAt.Valid {
+		user.PasswordChangedAt = passwordChangedAt.Time
+	}
+	return user, nil
+}
+
 func (r *UserRepository) Create(user *model.User) error {
 	db := database.GetDB()
 	user.ID = uuid.New().String()
 	user.CreatedAt = time.Now().UTC()
 	user.UpdatedAt = time.Now().UTC()
+	user.PasswordChangedAt = user.CreatedAt
 
 	_, err := db.Exec(
-		`INSERT INTO users (id, username, password_hash, is_admin, balance_micros, created_at, updated_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		user.ID, user.Username, user.PasswordHash, user.IsAdmin, user.BalanceMicros, user.CreatedAt, user.UpdatedAt,
+		`INSERT INTO users (id, username, password_hash, is_admin, balance_micros, email, password_changed_at, password_must_change, created_at, updated_at) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID, user.Username, user.PasswordHash, user.IsAdmin, user.BalanceMicros, user.Email, user.PasswordChangedAt, user.PasswordMustChange, user.CreatedAt, user.UpdatedAt,
 	)
 	return err
 }
 
 func (r *UserRepository) GetByUsername(username string) (*model.User, error) {
 	db := database.GetDB()
-	user := &model.User{}
-	err := db.QueryRow(
-		`SELECT id, username, password_hash, is_admin, balance_micros, created_at, updated_at FROM users WHERE username = ?`,
-		username,
-	).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.BalanceMicros, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(db.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -76,11 +102,7 @@ func (r *UserRepository) ExistsByUsername(username string) (bool, error) {
 
 func (r *UserRepository) GetByID(id string) (*model.User, error) {
 	db := database.GetDB()
-	user := &model.User{}
-	err := db.QueryRow(
-		`SELECT id, username, password_hash, is_admin, balance_micros, created_at, updated_at FROM users WHERE id = ?`,
-		id,
-	).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.BalanceMicros, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -89,9 +111,7 @@ func (r *UserRepository) GetByID(id string) (*model.User, error) {
 
 func (r *UserRepository) List() ([]*model.User, error) {
 	db := database.GetDB()
-	rows, err := db.Query(
-		`SELECT id, username, password_hash, is_admin, balance_micros, created_at, updated_at FROM users ORDER BY created_at DESC`,
-	)
+	rows, err := db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -99,8 +119,8 @@ func (r *UserRepository) List() ([]*model.User, error) {
 
 	var users []*model.User
 	for rows.Next() {
-		user := &model.User{}
-		if err := rows.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.BalanceMicros, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -108,11 +128,40 @@ func (r *UserRepository) List() ([]*model.User, error) {
 	return users, nil
 }
 
+// UpdatePassword 设置新密码，同时刷新修改时间并清除强制修改标记
 func (r *UserRepository) UpdatePassword(id string, passwordHash string) error {
+	db := database.GetDB()
+	now := time.Now().UTC()
+	result, err := db.Exec(
+		`UPDATE users SET password_hash = ?, password_changed_at = ?, password_must_change = ?, updated_at = ? WHERE id = ?`,
+		passwordHash, now, false, now, id,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdatePasswordHash 只替换哈希（如按新的 bcrypt cost 重新哈希），不视为修改密码
+func (r *UserRepository) UpdatePasswordHash(id string, passwordHash string) error {
+	db := database.GetDB()
+	_, err := db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, id)
+	return err
+}
+
+// SetPasswordMustChange 设置或取消强制修改密码标记
+func (r *UserRepository) SetPasswordMustChange(id string, required bool) error {
 	db := database.GetDB()
 	result, err := db.Exec(
-		`UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`,
-		passwordHash, time.Now().UTC(), id,
+		`UPDATE users SET password_must_change = ?, updated_at = ? WHERE id = ?`,
+		required, time.Now().UTC(), id,
 	)
 	if err != nil {
 		return err
@@ -127,6 +176,30 @@ func (r *UserRepository) UpdatePassword(id string, passwordHash string) error {
 	return nil
 }
 
+// ListStalePasswords 返回在 before 之前最后一次设置密码、或被要求修改密码的用户，按修改时间升序；
+// 没有本地密码（只通过 SSO 登录）的用户不计入
+func (r *UserRepository) ListStalePasswords(before time.Time) ([]*model.User, error) {
+	db := database.GetDB()
+	rows, err := db.Query(
+		`SELECT `+userColumns+` FROM users WHERE password_hash <> '' AND (password_changed_at < ? OR password_must_change = ?) ORDER BY password_changed_at ASC`,
+		before.UTC(), true,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
 func (r *UserRepository) UpdateUsername(id string, username string) error {
 	db := database.GetDB()
 	result, err := db.Exec(
@@ -146,6 +219,195 @@ func (r *UserRepository) UpdateUsername(id string, username string) error {
 	return nil
 }
 
+// UpdateTimezone 更新用户的报表时区，空字符串表示 UTC
+func (r *UserRepository) UpdateTimezone(id string, timezone string) error {
+	db := database.GetDB()
+	result, err := db.Exec(
+		`UPDATE users SET timezone = ?, updated_at = ? WHERE id = ?`,
+		timezone, time.Now().UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetTimezone 返回用户的报表时区，未设置时为空字符串
+func (r *UserRepository) GetTimezone(id string) (string, error) {
+	db := database.GetDB()
+	var timezone string
+	err := db.QueryRow(`SELECT timezone FROM users WHERE id = ?`, id).Scan(&timezone)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return timezone, err
+}
+
+// GetByVerifiedEmail 按已验证的邮箱查找用户，不存在时返回 nil
+func (r *UserRepository) GetByVerifiedEmail(email string) (*model.User, error) {
+	db := database.GetDB()
+	user, err := scanUser(db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = ? AND email_verified_at IS NOT NULL`, email))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return user, err
+}
+
+// EmailInUse 邮箱是否已被其他用户验证
+func (r *UserRepository) EmailInUse(email, excludeUserID string) (bool, error) {
+	db := database.GetDB()
+	var count int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM users WHERE email = ? AND email_verified_at IS NOT NULL AND id <> ?`,
+		email, excludeUserID,
+	).Scan(&count)
+	return count > 0, err
+}
+
+// UpdateEmail 更新邮箱并清除验证状态，空字符串表示解除绑定
+func (r *UserRepository) UpdateEmail(id string, email string) error {
+	db := database.GetDB()
+	result, err := db.Exec(
+		`UPDATE users SET email = ?, email_verified_at = NULL, updated_at = ? WHERE id = ?`,
+		email, time.Now().UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// MarkEmailVerified 邮箱仍为 email 时标记为已验证；邮箱已被修改时返回 false
+func (r *UserRepository) MarkEmailVerified(id string, email string) (bool, error) {
+	db := database.GetDB()
+	now := time.Now().UTC()
+	result, err := db.Exec(
+		`UPDATE users SET email_verified_at = ?, updated_at = ? WHERE id = ? AND email = ?`,
+		now, now, id, email,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// GetSuspension 返回用户的停用记录（可能已到期），未停用时返回 nil
+func (r *UserRepository) GetSuspension(id string) (*model.UserSuspension, error) {
+	db := database.GetDB()
+	row := db.QueryRow(
+		`SELECT suspended_at, suspended_until, suspension_reason, suspension_message, suspended_by FROM users WHERE id = ?`,
+		id,
+	)
+	suspension, err := scanSuspension(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	return suspension, err
+}
+
+// ListSuspensions 返回所有存在停用记录的用户（key: userID），到期判断由调用方处理
+func (r *UserRepository) ListSuspensions() (map[string]*model.UserSuspension, error) {
+	db := database.GetDB()
+	rows, err := db.Query(
+		`SELECT id, suspended_at, suspended_until, suspension_reason, suspension_message, suspended_by FROM users WHERE suspended_at IS NOT NULL`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]*model.UserSuspension)
+	for rows.Next() {
+		var userID string
+		var suspendedAt, suspendedUntil sql.NullTime
+		s := &model.UserSuspension{}
+		if err := rows.Scan(&userID, &suspendedAt, &suspendedUntil, &s.Reason, &s.Message, &s.SuspendedBy); err != nil {
+			return nil, err
+		}
+		s.SuspendedAt = suspendedAt.Time
+		if suspendedUntil.Valid {
+			s.ExpiresAt = &suspendedUntil.Time
+		}
+		result[userID] = s
+	}
+	return result, rows.Err()
+}
+
+// SetSuspension 停用用户，覆盖已有的停用记录
+func (r *UserRepository) SetSuspension(id string, s *model.UserSuspension) error {
+	db := database.GetDB()
+	var until interface{}
+	if s.ExpiresAt != nil {
+		until = s.ExpiresAt.UTC()
+	}
+	result, err := db.Exec(
+		`UPDATE users SET suspended_at = ?, suspended_until = ?, suspension_reason = ?, suspension_message = ?, suspended_by = ?, updated_at = ? WHERE id = ?`,
+		s.SuspendedAt.UTC(), until, s.Reason, s.Message, s.SuspendedBy, time.Now().UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ClearSuspension 恢复用户
+func (r *UserRepository) ClearSuspension(id string) error {
+	db := database.GetDB()
+	result, err := db.Exec(
+		`UPDATE users SET suspended_at = NULL, suspended_until = NULL, suspension_reason = '', suspension_message = '', suspended_by = '', updated_at = ? WHERE id = ?`,
+		time.Now().UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func scanSuspension(row *sql.Row) (*model.UserSuspension, error) {
+	var suspendedAt, suspendedUntil sql.NullTime
+	s := &model.UserSuspension{}
+	if err := row.Scan(&suspendedAt, &suspendedUntil, &s.Reason, &s.Message, &s.SuspendedBy); err != nil {
+		return nil, err
+	}
+	if !suspendedAt.Valid {
+		return nil, nil
+	}
+	s.SuspendedAt = suspendedAt.Time
+	if suspendedUntil.Valid {
+		s.ExpiresAt = &suspendedUntil.Time
+	}
+	return s, nil
+}
+
 func (r *UserRepository) SetAdmin(id string, isAdmin bool) error {
 	db := database.GetDB()
 	_, err := db.Exec(
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+type UserIdentityRepository struct{}
+
+func NewUserIdentityRepository() *UserIdentityRepository {
+	return &UserIdentityRepository{}
+}
+
+func (r *UserIdentityRepository) Create(identity *model.UserIdentity) error {
+	db := database.GetDB()
+	identity.ID = uuid.New().String()
+	identity.CreatedAt = time.Now().UTC()
+
+	_, err := db.Exec(
+		`INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		identity.ID, identity.UserID, identity.Issuer, identity.Subject, identity.Email, identity.CreatedAt,
+	)
+	return err
+}
+
+// GetBySubject 按签发方与 subject 查找绑定，不存在时返回 nil
+func (r *UserIdentityRepository) GetBySubject(issuer, subject string) (*model.UserIdentity, error) {
+	db := database.GetDB()
+	identity := &model.UserIdentity{}
+	var lastLoginAt sql.NullTime
+	err := db.QueryRow(
+		`SELECT id, user_id, issuer, subject, email, last_login_at, created_at FROM user_identities WHERE issuer = ? AND subject = ?`,
+		issuer, subject,
+	).Scan(&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email, &lastLoginAt, &identity.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastLoginAt.Valid {
+		identity.LastLoginAt = &lastLoginAt.Time
+	}
+	return identity, nil
+}
+
+// TouchLogin 记录最近一次登录时间与 IdP 提供的邮箱
+func (r *UserIdentityRepository) TouchLogin(id, email string) error {
+	db := database.GetDB()
+	_, err := db.Exec(`UPDATE user_identities SET email = ?, last_login_at = ? WHERE id = ?`, email, time.Now().UTC(), id)
+	return err
+}
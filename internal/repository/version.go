@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrVersionConflict 乐观锁冲突：记录在读取后已被其他请求修改
+var ErrVersionConflict = errors.New("记录已被修改")
+
+// checkVersionUpdate 检查带版本条件的 UPDATE 结果，未命中任何行时视为版本冲突
+func checkVersionUpdate(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -1,144 +1,288 @@
 package router
 
 import (
+	"path/filepath"
 	"strings"
 
 	"ampmanager/internal/amp"
 	"ampmanager/internal/config"
 	"ampmanager/internal/handler"
 	"ampmanager/internal/middleware"
+	"ampmanager/internal/model"
 	"ampmanager/internal/web"
 
 	"github.com/gin-gonic/gin"
 )
 
+// manageRouteCosts 管理 API 中需要大范围扫描数据库或访问上游的路由开销，未列出的路由开销为 1
+var manageRouteCosts = map[string]int{
+	"/api/me/dashboard":                      5,
+	"/api/dashboard":                         10,
+	"/api/dashboard/trends":                  5,
+	"/api/me/amp/request-logs":               3,
+	"/api/me/amp/request-logs/export":        20,
+	"/api/me/amp/usage/summary":              5,
+	"/api/me/models/prices":                  3,
+	"/api/admin/request-logs":                3,
+	"/api/admin/request-logs/export":         20,
+	"/api/admin/request-logs/error-clusters": 10,
+	"/api/admin/usage/summary":               5,
+	"/api/admin/dashboard":                   10,
+	"/api/admin/dashboard/summary":           10,
+	"/api/admin/dashboard/trends":            5,
+	"/api/admin/channels/bulk":               5,
+	"/api/admin/channels/models/bulk-add":    5,
+	"/api/admin/channels/models/bulk-remove": 5,
+	"/api/admin/channels/models/routing":     3,
+	"/api/admin/channels/:id/test":           5,
+	"/api/admin/channels/:id/fetch-models":   5,
+	"/api/admin/models/fetch-all":            20,
+	"/api/admin/models/sync":                 20,
+	"/api/admin/prices/refresh":              20,
+	"/api/admin/system/database/upload":      30,
+	"/api/admin/system/database/download":    30,
+	"/api/admin/system/database/restore":     30,
+	"/api/admin/system/database/migrate":     30,
+	"/api/admin/system/diagnostics/run":      20,
+	"/api/admin/system/log-retention/run":    20,
+	"/api/admin/system/secrets/refresh":      10,
+}
+
 func Setup() *gin.Engine {
 	r := gin.Default()
 
 	cfg := config.Get()
 
-	// 解析 CORS 配置
-	allowedOrigins := make([]string, 0)
-	if cfg.CORSAllowedOrigins != "" {
-		for _, o := range strings.Split(cfg.CORSAllowedOrigins, ",") {
-			if trimmed := strings.TrimSpace(o); trimmed != "" && trimmed != "*" {
-				allowedOrigins = append(allowedOrigins, trimmed)
-			}
-		}
-	}
-	corsEnabled := len(allowedOrigins) > 0
-
-	r.Use(func(c *gin.Context) {
-		origin := c.Request.Header.Get("Origin")
-
-		// 只有配置了具体的允许源时才启用 CORS
-		if corsEnabled && origin != "" {
-			allowed := false
-			for _, o := range allowedOrigins {
-				if o == origin {
-					allowed = true
-					break
-				}
-			}
-
-			if allowed {
-				c.Header("Access-Control-Allow-Origin", origin)
-				c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, PATCH, OPTIONS")
-				c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Api-Key")
-				c.Header("Access-Control-Allow-Credentials", "true")
-				c.Header("Vary", "Origin")
-			}
-		}
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
+	// CORS 与嵌入策略：环境变量作为默认值，系统配置保存后覆盖
+	middleware.SetDefaultHTTPPolicy(model.HTTPPolicyConfig{
+		CORSAllowedOrigins:   strings.Split(cfg.CORSAllowedOrigins, ","),
+		CORSAllowCredentials: cfg.CORSAllowCredentials,
+		FrameAncestors:       strings.Fields(cfg.FrameAncestors),
 	})
+	// 访问日志放在最前，CORS 预检与被拒绝的请求同样记录
+	middleware.SetDefaultAccessLogPath(filepath.Join(filepath.Dir(cfg.SQLitePath), "access.log"))
+	r.Use(middleware.AccessLog())
+	r.Use(middleware.HTTPPolicy())
 
 	authLimiter := middleware.NewRateLimiter(cfg.RateLimitAuthRPS, 10)
+	manageThrottle := middleware.NewAdminThrottle(cfg.RateLimitAdminRPS, cfg.RateLimitAdminBurst, manageRouteCosts)
 
 	userHandler := handler.NewUserHandler()
 	ampHandler := handler.NewAmpHandler()
 	requestLogHandler := handler.NewRequestLogHandler()
 	channelHandler := handler.NewChannelHandler()
+	channelOAuthHandler := handler.NewChannelOAuthHandler()
+	channelTemplateHandler := handler.NewChannelTemplateHandler()
+	settingsTemplateHandler := handler.NewSettingsTemplateHandler()
+	scheduledChangeHandler := handler.NewScheduledChangeHandler()
+	auditLogHandler := handler.NewAuditLogHandler()
 	modelHandler := handler.NewModelHandler()
 	modelMetadataHandler := handler.NewModelMetadataHandler()
 	systemHandler := handler.NewSystemHandler()
 	billingHandler := handler.NewBillingHandler()
+	modelPriceHandler := handler.NewModelPriceHandler()
 	groupHandler := handler.NewGroupHandler()
 	subscriptionHandler := handler.NewSubscriptionHandler()
 	billingSettingHandler := handler.NewBillingSettingHandler()
+	logViewHandler := handler.NewLogViewHandler()
+	diagnosticsHandler := handler.NewDiagnosticsHandler()
+	runtimeDebugHandler := handler.NewRuntimeDebugHandler()
+	featureFlagHandler := handler.NewFeatureFlagHandler()
+	rateLimitHandler := handler.NewRateLimitHandler()
 
 	api := r.Group("/api")
+	api.Use(amp.DatabaseSwapGuard())
+	if cfg.DemoMode {
+		api.Use(middleware.DemoModeGuard())
+		amp.RegisterDemoProviderRoutes(r)
+	}
 	{
+		api.GET("/manage/demo", systemHandler.GetDemoStatus)
+
 		// Local management auth (using /manage/auth to avoid conflict with proxy /api/auth/*)
 		manageAuth := api.Group("/manage/auth")
 		manageAuth.Use(authLimiter.RateLimitByIP())
 		{
 			manageAuth.POST("/register", userHandler.Register)
 			manageAuth.POST("/login", userHandler.Login)
+			manageAuth.POST("/verify-email", userHandler.VerifyEmail)
+			manageAuth.POST("/password-reset", userHandler.RequestPasswordReset)
+			manageAuth.POST("/password-reset/confirm", userHandler.ConfirmPasswordReset)
+			manageAuth.GET("/oidc", userHandler.GetOIDCLoginOptions)
+			manageAuth.GET("/oidc/login", userHandler.StartOIDCLogin)
+			manageAuth.GET("/oidc/callback", userHandler.OIDCCallback)
+			manageAuth.POST("/oidc/exchange", userHandler.ExchangeOIDCTicket)
 		}
 
 		me := api.Group("/me")
 		me.Use(middleware.JWTAuthMiddleware())
+		me.Use(manageThrottle.Middleware())
 		{
 			me.PUT("/password", userHandler.ChangePassword)
 			me.PUT("/username", userHandler.ChangeUsername)
+			me.GET("/email", userHandler.GetMyEmail)
+			me.PUT("/email", userHandler.UpdateMyEmail)
+			me.POST("/email/verification", userHandler.ResendEmailVerification)
+			me.GET("/timezone", userHandler.GetMyTimezone)
+			me.PUT("/timezone", userHandler.UpdateMyTimezone)
+			me.GET("/admin-scope", userHandler.GetMyAdminScope)
 			me.GET("/balance", userHandler.GetMyBalance)
+			me.GET("/features", featureFlagHandler.GetMyFeatures)
+			me.GET("/maintenance", systemHandler.GetMaintenanceNotice)
 			me.GET("/dashboard", requestLogHandler.GetDashboard)
 			me.GET("/billing/state", billingSettingHandler.GetBillingState)
+			me.GET("/billing/history", userHandler.GetMyBillingHistory)
+			me.GET("/billing/quota-releases", billingSettingHandler.GetQuotaReleases)
 			me.PUT("/billing/priority", billingSettingHandler.UpdateBillingPriority)
 			me.GET("/subscription", billingSettingHandler.GetMySubscription)
+			me.GET("/models/prices", modelPriceHandler.ListMyModelPrices)
+			me.POST("/models/quote", modelPriceHandler.QuoteMyModel)
 
 			ampGroup := me.Group("/amp")
 			{
 				ampGroup.GET("/settings", ampHandler.GetSettings)
 				ampGroup.PUT("/settings", ampHandler.UpdateSettings)
 				ampGroup.POST("/settings/test", ampHandler.TestConnection)
+				ampGroup.GET("/post-processors", ampHandler.ListPostProcessors)
+
+				// 设置模板库
+				ampGroup.GET("/settings-templates", settingsTemplateHandler.ListForUser)
+				ampGroup.POST("/settings-templates/:id/apply", settingsTemplateHandler.Apply)
+				ampGroup.DELETE("/settings-templates/:id/apply", settingsTemplateHandler.Detach)
 
 				ampGroup.GET("/api-keys", ampHandler.ListAPIKeys)
 				ampGroup.POST("/api-keys", ampHandler.CreateAPIKey)
 				ampGroup.GET("/api-keys/:id", ampHandler.GetAPIKey)
 				ampGroup.DELETE("/api-keys/:id", ampHandler.DeleteAPIKey)
+				ampGroup.PUT("/api-keys/:id/scopes", ampHandler.UpdateAPIKeyScopes)
+				ampGroup.POST("/client-config", ampHandler.GenerateClientConfig)
 
 				ampGroup.GET("/bootstrap", ampHandler.GetBootstrap)
 
 				// 请求日志
 				ampGroup.GET("/request-logs", requestLogHandler.ListRequestLogs)
 				ampGroup.GET("/request-logs/models", requestLogHandler.GetDistinctModels)
+				ampGroup.GET("/request-logs/export", requestLogHandler.ExportRequestLogs)
 				ampGroup.GET("/request-logs/:id", requestLogHandler.GetRequestLog)
 				ampGroup.GET("/usage/summary", requestLogHandler.GetUsageSummary)
+
+				// 日志视图（保存的筛选条件）
+				ampGroup.GET("/log-views", logViewHandler.List)
+				ampGroup.POST("/log-views", logViewHandler.Create)
+				ampGroup.GET("/log-views/:id", logViewHandler.Get)
+				ampGroup.PUT("/log-views/:id", logViewHandler.Update)
+				ampGroup.PATCH("/log-views/:id/pinned", logViewHandler.SetPinned)
+				ampGroup.DELETE("/log-views/:id", logViewHandler.Delete)
 			}
 		}
 
+		// 聚合仪表盘（单次请求返回所有组件数据）
+		dashboard := api.Group("/dashboard")
+		dashboard.Use(middleware.JWTAuthMiddleware())
+		dashboard.Use(manageThrottle.Middleware())
+		{
+			dashboard.GET("", requestLogHandler.GetDashboardSummary)
+			dashboard.GET("/trends", requestLogHandler.GetDashboardTrends)
+		}
+
 		models := api.Group("/models")
 		models.Use(middleware.JWTAuthMiddleware())
 		{
 			models.GET("", modelHandler.ListAvailableModels)
 		}
 
+		// 分组管理员：只能管理所辖分组内的用户及其 API Key 与模型映射，全局管理员同样可以访问
+		groupAdmin := api.Group("/group-admin")
+		groupAdmin.Use(middleware.JWTAuthMiddleware())
+		groupAdmin.Use(middleware.GroupAdminMiddleware())
+		groupAdmin.Use(manageThrottle.Middleware())
+		{
+			groupAdmin.GET("/groups", groupHandler.ListManaged)
+			groupAdmin.GET("/users", userHandler.ListUsers)
+
+			managedUser := groupAdmin.Group("/users/:id")
+			managedUser.Use(middleware.RequireUserInScope("id"))
+			{
+				managedUser.PATCH("/group", userHandler.SetGroup)
+				managedUser.POST("/reset-password", userHandler.ResetPassword)
+				managedUser.PUT("/password-change-required", userHandler.SetPasswordChangeRequired)
+				managedUser.POST("/suspension", userHandler.SuspendUser)
+				managedUser.DELETE("/suspension", userHandler.UnsuspendUser)
+				managedUser.POST("/client-config", ampHandler.AdminGenerateClientConfig)
+				managedUser.GET("/api-keys", ampHandler.AdminListAPIKeys)
+				managedUser.POST("/api-keys", ampHandler.AdminCreateAPIKey)
+				managedUser.DELETE("/api-keys/:keyId", ampHandler.AdminDeleteAPIKey)
+				managedUser.PUT("/api-keys/:keyId/scopes", ampHandler.AdminUpdateAPIKeyScopes)
+				managedUser.GET("/model-mappings", ampHandler.AdminGetModelMappings)
+				managedUser.PUT("/model-mappings", ampHandler.AdminUpdateModelMappings)
+			}
+		}
+
 		admin := api.Group("/admin")
 		admin.Use(middleware.JWTAuthMiddleware())
 		admin.Use(middleware.AdminMiddleware())
+		admin.Use(manageThrottle.Middleware())
 		{
 			channels := admin.Group("/channels")
 			{
 				channels.GET("", channelHandler.List)
 				channels.POST("", channelHandler.Create)
+				channels.POST("/import", channelHandler.Import)
+				channels.POST("/bulk", channelHandler.BulkCreate)
+				channels.POST("/models/bulk-add", channelHandler.BulkAddModels)
+				channels.POST("/models/bulk-remove", channelHandler.BulkRemoveModels)
+				channels.GET("/models/routing", channelHandler.PreviewModelRouting)
+				channels.GET("/health", channelHandler.ListHealth)
+				channels.GET("/capacity", channelHandler.GetCapacity)
+				channels.POST("/capacity/apply", channelHandler.ApplyCapacity)
 				channels.GET("/:id", channelHandler.Get)
 				channels.PUT("/:id", channelHandler.Update)
 				channels.DELETE("/:id", channelHandler.Delete)
 				channels.PATCH("/:id/enabled", channelHandler.SetEnabled)
+				channels.POST("/:id/duplicate", channelHandler.Duplicate)
+				channels.POST("/:id/save-as-template", channelHandler.SaveAsTemplate)
 				channels.POST("/:id/test", channelHandler.TestConnection)
+				channels.GET("/:id/oauth", channelOAuthHandler.Get)
+				channels.PUT("/:id/oauth", channelOAuthHandler.Set)
+				channels.POST("/:id/oauth/refresh", channelOAuthHandler.Refresh)
 				channels.POST("/:id/fetch-models", modelHandler.FetchChannelModels)
 				channels.GET("/:id/models", modelHandler.GetChannelModels)
+				channels.POST("/:id/models/copy", channelHandler.CopyModels)
+			}
+
+			channelTemplates := admin.Group("/channel-templates")
+			{
+				channelTemplates.GET("", channelTemplateHandler.List)
+				channelTemplates.POST("", channelTemplateHandler.Create)
+				channelTemplates.GET("/:id", channelTemplateHandler.Get)
+				channelTemplates.PUT("/:id", channelTemplateHandler.Update)
+				channelTemplates.DELETE("/:id", channelTemplateHandler.Delete)
+			}
+
+			settingsTemplates := admin.Group("/settings-templates")
+			{
+				settingsTemplates.GET("", settingsTemplateHandler.List)
+				settingsTemplates.POST("", settingsTemplateHandler.Create)
+				settingsTemplates.GET("/:id", settingsTemplateHandler.Get)
+				settingsTemplates.PUT("/:id", settingsTemplateHandler.Update)
+				settingsTemplates.DELETE("/:id", settingsTemplateHandler.Delete)
+				settingsTemplates.GET("/:id/versions", settingsTemplateHandler.ListVersions)
+			}
+
+			scheduledChanges := admin.Group("/scheduled-changes")
+			{
+				scheduledChanges.GET("", scheduledChangeHandler.List)
+				scheduledChanges.POST("", scheduledChangeHandler.Create)
+				scheduledChanges.GET("/:id", scheduledChangeHandler.Get)
+				scheduledChanges.POST("/:id/cancel", scheduledChangeHandler.Cancel)
 			}
+			admin.GET("/audit-logs", auditLogHandler.List)
 
 			adminModels := admin.Group("/models")
 			{
 				adminModels.POST("/fetch-all", modelHandler.FetchAllModels)
+				adminModels.POST("/sync", modelHandler.SyncModels)
+				adminModels.GET("/sync/last", modelHandler.GetLastModelSync)
 			}
 
 			modelMetadata := admin.Group("/model-metadata")
@@ -158,6 +302,12 @@ func Setup() *gin.Engine {
 				system.POST("/database/restore", systemHandler.RestoreBackup)
 				system.DELETE("/database/backups/:filename", systemHandler.DeleteBackup)
 				system.GET("/database-info", systemHandler.GetDatabaseInfo)
+				system.GET("/effective-config", systemHandler.GetEffectiveConfig)
+				system.GET("/secrets", systemHandler.GetSecretStatus)
+				system.GET("/acme", systemHandler.GetACMEStatus)
+				system.POST("/secrets/refresh", systemHandler.RefreshSecrets)
+				system.GET("/diagnostics", diagnosticsHandler.GetReport)
+				system.POST("/diagnostics/run", diagnosticsHandler.Run)
 				system.POST("/database/migrate", systemHandler.StartDatabaseMigration)
 				system.GET("/database/migrate/:taskID", systemHandler.GetDatabaseMigrationTask)
 
@@ -169,6 +319,11 @@ func Setup() *gin.Engine {
 				system.GET("/request-detail-enabled", systemHandler.GetRequestDetailEnabled)
 				system.PUT("/request-detail-enabled", systemHandler.UpdateRequestDetailEnabled)
 
+				// 上游响应结构校验（调试模式）
+				system.GET("/response-validation", systemHandler.GetResponseValidation)
+				system.PUT("/response-validation", systemHandler.UpdateResponseValidation)
+				system.DELETE("/response-validation/deviations", systemHandler.ClearResponseValidationDeviations)
+
 				// 超时配置
 				system.GET("/timeout-config", systemHandler.GetTimeoutConfig)
 				system.PUT("/timeout-config", systemHandler.UpdateTimeoutConfig)
@@ -176,15 +331,143 @@ func Setup() *gin.Engine {
 				// 缓存 TTL 配置
 				system.GET("/cache-ttl", systemHandler.GetCacheTTLConfig)
 				system.PUT("/cache-ttl", systemHandler.UpdateCacheTTLConfig)
+
+				// pending 请求清理配置
+				system.GET("/pending-cleaner", systemHandler.GetPendingCleanerConfig)
+				system.PUT("/pending-cleaner", systemHandler.UpdatePendingCleanerConfig)
+
+				// 请求日志保留策略
+				system.GET("/log-retention", systemHandler.GetLogRetention)
+				system.PUT("/log-retention", systemHandler.UpdateLogRetention)
+				system.POST("/log-retention/run", systemHandler.RunLogRetention)
+
+				// CORS 与嵌入策略
+				system.GET("/http-policy", systemHandler.GetHTTPPolicy)
+				system.PUT("/http-policy", systemHandler.UpdateHTTPPolicy)
+				system.DELETE("/http-policy", systemHandler.ResetHTTPPolicy)
+				system.GET("/access-log", systemHandler.GetAccessLogConfig)
+				system.PUT("/access-log", systemHandler.UpdateAccessLogConfig)
+
+				// 维护模式
+				system.GET("/maintenance", systemHandler.GetMaintenance)
+				system.PUT("/maintenance", systemHandler.UpdateMaintenance)
+
+				// 上游响应头透传策略
+				system.GET("/response-headers", systemHandler.GetResponseHeaderConfig)
+				system.PUT("/response-headers", systemHandler.UpdateResponseHeaderConfig)
+				system.DELETE("/response-headers", systemHandler.ResetResponseHeaderConfig)
+
+				// 计费影子模式
+				system.GET("/quota-enforcement", systemHandler.GetQuotaEnforcementConfig)
+				system.PUT("/quota-enforcement", systemHandler.UpdateQuotaEnforcementConfig)
+				system.GET("/billing-shadow", systemHandler.GetBillingShadow)
+				system.PUT("/billing-shadow", systemHandler.UpdateBillingShadow)
+
+				// 计费一致性检查
+				system.GET("/billing-audit", systemHandler.GetBillingAudit)
+				system.PUT("/billing-audit", systemHandler.UpdateBillingAudit)
+				system.POST("/billing-audit/run", systemHandler.RunBillingAudit)
+				system.GET("/group-budget-alerts", systemHandler.GetGroupBudgetAlertConfig)
+				system.PUT("/group-budget-alerts", systemHandler.UpdateGroupBudgetAlertConfig)
+				system.POST("/group-budget-alerts/run", systemHandler.RunGroupBudgetCheck)
+				system.GET("/new-user-defaults", systemHandler.GetNewUserDefaultsConfig)
+				system.PUT("/new-user-defaults", systemHandler.UpdateNewUserDefaultsConfig)
+				system.POST("/new-user-defaults/preview", systemHandler.PreviewNewUserDefaults)
+
+				// 渠道健康检查与熔断
+				system.GET("/channel-health", systemHandler.GetChannelHealthConfig)
+				system.PUT("/channel-health", systemHandler.UpdateChannelHealthConfig)
+				system.GET("/channel-key-check", systemHandler.GetChannelKeyCheckConfig)
+				system.PUT("/channel-key-check", systemHandler.UpdateChannelKeyCheckConfig)
+				system.POST("/channel-key-check/run", systemHandler.RunChannelKeyCheck)
+				system.GET("/channel-failover", systemHandler.GetChannelFailoverConfig)
+				system.PUT("/channel-failover", systemHandler.UpdateChannelFailoverConfig)
+				system.GET("/channel-sticky", systemHandler.GetChannelStickyConfig)
+				system.PUT("/channel-sticky", systemHandler.UpdateChannelStickyConfig)
+				system.GET("/channel-capacity", systemHandler.GetChannelCapacityConfig)
+				system.PUT("/channel-capacity", systemHandler.UpdateChannelCapacityConfig)
+
+				// 模型调用并发上限的处理策略
+				system.GET("/concurrency-limit", systemHandler.GetConcurrencyLimitConfig)
+				system.PUT("/concurrency-limit", systemHandler.UpdateConcurrencyLimitConfig)
+
+				// 流式响应刷新合并
+				system.GET("/stream-flush", systemHandler.GetStreamFlushConfig)
+				system.PUT("/stream-flush", systemHandler.UpdateStreamFlushConfig)
+
+				// 内存保护：单请求缓冲预算与进程内存水位
+				system.GET("/memory-guard", systemHandler.GetMemoryGuardConfig)
+				system.PUT("/memory-guard", systemHandler.UpdateMemoryGuardConfig)
+				system.GET("/memory-guard/status", systemHandler.GetMemoryGuardStatus)
+
+				// 运行时诊断：pprof、运行时指标与 goroutine 堆栈，需先开启
+				system.GET("/debug", systemHandler.GetRuntimeDebugConfig)
+				system.PUT("/debug", systemHandler.UpdateRuntimeDebugConfig)
+				runtimeDebug := system.Group("/debug")
+				runtimeDebug.Use(runtimeDebugHandler.RequireEnabled())
+				{
+					runtimeDebug.GET("/runtime", runtimeDebugHandler.GetStats)
+					runtimeDebug.GET("/goroutines", runtimeDebugHandler.GoroutineDump)
+					runtimeDebug.GET("/pprof/", runtimeDebugHandler.PprofIndex)
+					runtimeDebug.GET("/pprof/:name", runtimeDebugHandler.PprofProfile)
+					runtimeDebug.POST("/pprof/:name", runtimeDebugHandler.PprofProfile)
+				}
+
+				// 密码策略
+				system.GET("/password-policy", systemHandler.GetPasswordPolicy)
+				system.PUT("/password-policy", systemHandler.UpdatePasswordPolicy)
+
+				// OIDC 单点登录
+				system.GET("/oidc", systemHandler.GetOIDCConfig)
+				system.PUT("/oidc", systemHandler.UpdateOIDCConfig)
+
+				// 工具调用循环检测
+				system.GET("/tool-loop", systemHandler.GetToolLoopConfig)
+				system.PUT("/tool-loop", systemHandler.UpdateToolLoopConfig)
+
+				// 输出内容过滤
+				system.GET("/output-filters", systemHandler.GetOutputFilterConfig)
+				system.PUT("/output-filters", systemHandler.UpdateOutputFilterConfig)
+				system.GET("/detail-redaction", systemHandler.GetDetailRedactionConfig)
+				system.PUT("/detail-redaction", systemHandler.UpdateDetailRedactionConfig)
+				system.GET("/pii-redaction", systemHandler.GetPIIRedactionConfig)
+				system.PUT("/pii-redaction", systemHandler.UpdatePIIRedactionConfig)
+
+				// 格式转换：严格模式与统计
+				system.GET("/translation", systemHandler.GetTranslationConfig)
+				system.PUT("/translation", systemHandler.UpdateTranslationConfig)
+				system.GET("/translator-metrics", systemHandler.GetTranslatorMetrics)
+				system.DELETE("/translator-metrics", systemHandler.ResetTranslatorMetrics)
+
+				// 按端点类别的请求日志策略
+				system.GET("/request-log-policy", systemHandler.GetRequestLogPolicy)
+				system.PUT("/request-log-policy", systemHandler.UpdateRequestLogPolicy)
+				system.GET("/model-sync", systemHandler.GetModelSyncConfig)
+				system.PUT("/model-sync", systemHandler.UpdateModelSyncConfig)
+				system.GET("/federation", systemHandler.GetFederationConfig)
+				system.PUT("/federation", systemHandler.UpdateFederationConfig)
 			}
 
 			users := admin.Group("/users")
 			{
 				users.GET("", userHandler.ListUsers)
+				users.GET("/credential-hygiene", userHandler.GetCredentialHygiene)
 				users.PATCH("/:id/admin", userHandler.SetAdmin)
 				users.PATCH("/:id/group", userHandler.SetGroup)
 				users.POST("/:id/reset-password", userHandler.ResetPassword)
+				users.PUT("/:id/password-change-required", userHandler.SetPasswordChangeRequired)
 				users.POST("/:id/topup", userHandler.TopUp)
+				users.POST("/:id/balance-adjustments", userHandler.AdjustBalance)
+				users.POST("/:id/suspension", userHandler.SuspendUser)
+				users.DELETE("/:id/suspension", userHandler.UnsuspendUser)
+				users.GET("/:id/billing-history", userHandler.ListBillingHistory)
+				users.POST("/:id/client-config", ampHandler.AdminGenerateClientConfig)
+				users.GET("/:id/api-keys", ampHandler.AdminListAPIKeys)
+				users.POST("/:id/api-keys", ampHandler.AdminCreateAPIKey)
+				users.DELETE("/:id/api-keys/:keyId", ampHandler.AdminDeleteAPIKey)
+				users.PUT("/:id/api-keys/:keyId/scopes", ampHandler.AdminUpdateAPIKeyScopes)
+				users.GET("/:id/model-mappings", ampHandler.AdminGetModelMappings)
+				users.PUT("/:id/model-mappings", ampHandler.AdminUpdateModelMappings)
 				users.DELETE("/:id", userHandler.DeleteUser)
 				users.GET("/:id/subscription", subscriptionHandler.GetUserSubscription)
 				users.POST("/:id/subscription", subscriptionHandler.AssignSubscription)
@@ -199,6 +482,25 @@ func Setup() *gin.Engine {
 				groups.GET("/:id", groupHandler.Get)
 				groups.PUT("/:id", groupHandler.Update)
 				groups.DELETE("/:id", groupHandler.Delete)
+				groups.GET("/:id/admins", groupHandler.ListAdmins)
+				groups.POST("/:id/admins", groupHandler.AddAdmin)
+				groups.DELETE("/:id/admins/:userId", groupHandler.RemoveAdmin)
+				groups.GET("/:id/budget", groupHandler.GetBudget)
+			}
+			admin.GET("/group-budget-alerts", groupHandler.ListBudgetAlerts)
+
+			featureFlags := admin.Group("/feature-flags")
+			{
+				featureFlags.GET("", featureFlagHandler.List)
+				featureFlags.PUT("/:key", featureFlagHandler.Put)
+				featureFlags.DELETE("/:key", featureFlagHandler.Delete)
+			}
+
+			rateLimits := admin.Group("/rate-limits")
+			{
+				rateLimits.GET("", rateLimitHandler.List)
+				rateLimits.PUT("/:scope/:targetId", rateLimitHandler.Put)
+				rateLimits.DELETE("/:scope/:targetId", rateLimitHandler.Delete)
 			}
 
 			subscriptions := admin.Group("/subscriptions")
@@ -218,9 +520,14 @@ func Setup() *gin.Engine {
 			admin.GET("/request-logs", requestLogHandler.AdminListRequestLogs)
 			admin.GET("/request-logs/models", requestLogHandler.AdminGetDistinctModels)
 			admin.GET("/request-logs/keys", requestLogHandler.AdminGetDistinctAPIKeys)
+			admin.GET("/request-logs/export", requestLogHandler.AdminExportRequestLogs)
+			admin.GET("/request-logs/error-clusters", requestLogHandler.AdminGetErrorClusters)
+			admin.POST("/request-logs/pending/finalize", requestLogHandler.AdminFinalizePendingLogs)
 			admin.GET("/request-logs/:id/detail", requestLogHandler.AdminGetRequestLogDetail)
 			admin.GET("/usage/summary", requestLogHandler.AdminGetUsageSummary)
 			admin.GET("/dashboard", requestLogHandler.GetAdminDashboard)
+			admin.GET("/dashboard/summary", requestLogHandler.AdminGetDashboardSummary)
+			admin.GET("/dashboard/trends", requestLogHandler.AdminGetDashboardTrends)
 
 			// 价格表管理
 			prices := admin.Group("/prices")
@@ -238,12 +545,17 @@ func Setup() *gin.Engine {
 		middleware.AdminMiddleware(),
 		requestLogHandler.AdminRequestLogsWS,
 	)
+	api.GET("/admin/request-logs/:id/live/ws",
+		middleware.JWTAuthFromQuery("token"),
+		middleware.AdminMiddleware(),
+		requestLogHandler.AdminRequestLiveWS,
+	)
 
 	proxy := amp.CreateDynamicReverseProxy()
 	amp.RegisterProxyRoutes(r, proxy)
 
-	// Serve embedded frontend static files
-	web.RegisterStaticRoutes(r)
+	// Serve frontend static files (embedded, or WEB_DIST_DIR in development)
+	web.RegisterStaticRoutes(r, cfg.WebDistDir)
 
 	return r
 }
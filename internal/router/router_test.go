@@ -0,0 +1,97 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/config"
+	"ampmanager/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// demoWritableRoutes 演示模式下允许的写操作，修改 middleware.demoAllowedRoutes 时需同步更新
+var demoWritableRoutes = map[string]bool{
+	"POST /api/manage/auth/login":                      true,
+	"PUT /api/me/timezone":                             true,
+	"PUT /api/me/billing/priority":                     true,
+	"POST /api/me/models/quote":                        true,
+	"PUT /api/me/amp/settings":                         true,
+	"POST /api/me/amp/settings/test":                   true,
+	"POST /api/me/amp/settings-templates/:id/apply":    true,
+	"POST /api/me/amp/api-keys":                        true,
+	"PUT /api/me/amp/api-keys/:id/scopes":              true,
+	"POST /api/me/amp/client-config":                   true,
+	"POST /api/me/amp/log-views":                       true,
+	"PUT /api/me/amp/log-views/:id":                    true,
+	"PATCH /api/me/amp/log-views/:id/pinned":           true,
+	"POST /api/admin/system/new-user-defaults/preview": true,
+}
+
+func setupDemoRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("DEMO_MODE", "true")
+	t.Setenv("SQLITE_PATH", filepath.Join(dir, "test.db"))
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if err := database.Init(filepath.Join(dir, "test.db")); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	gin.SetMode(gin.TestMode)
+	return Setup()
+}
+
+// routeSamplePath 把路由模板中的参数替换为示例值
+func routeSamplePath(route string) string {
+	parts := strings.Split(route, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parts[i] = "x"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// 遍历所有已注册的管理 API：写操作除白名单外都被演示模式拦截，白名单中的路由均已注册且不被拦截
+func TestDemoModeBlocksUnlistedWrites(t *testing.T) {
+	engine := setupDemoRouter(t)
+
+	registered := map[string]bool{}
+	for _, route := range engine.Routes() {
+		// Amp 代理路由同样以 /api/ 开头，但不经过管理 API 的中间件
+		if !strings.HasPrefix(route.Path, "/api/") || !strings.HasPrefix(route.Handler, "ampmanager/internal/handler.") {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		registered[key] = true
+
+		req := httptest.NewRequest(route.Method, routeSamplePath(route.Path), strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		blocked := w.Code == http.StatusForbidden && strings.Contains(w.Body.String(), "演示模式")
+
+		switch route.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if blocked {
+				t.Errorf("%s: read-only route blocked in demo mode", key)
+			}
+		default:
+			if want := !demoWritableRoutes[key]; blocked != want {
+				t.Errorf("%s: blocked = %v, want %v (status %d)", key, blocked, want, w.Code)
+			}
+		}
+	}
+
+	for key := range demoWritableRoutes {
+		if !registered[key] {
+			t.Errorf("%s: allowed in demo mode but not registered", key)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+// fileProvider 读取挂载的密钥文件（Docker/Kubernetes secrets）
+type fileProvider struct{}
+
+func (fileProvider) fetch(_ context.Context, ref Reference) (string, error) {
+	data, err := os.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+	return extractKey(strings.TrimRight(string(data), "\r\n"), ref.Key)
+}
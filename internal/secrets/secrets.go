@@ -0,0 +1,325 @@
+// Package secrets 解析外部密钥存储中的密钥引用，并定期刷新缓存。
+//
+// 支持的引用格式（#key 可选，用于从 JSON 对象中取字段）：
+//
+//	file:///run/secrets/jwt_secret
+//	vault://secret/data/ampmanager#jwt_secret
+//	aws-sm://prod/ampmanager#openai_key
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 引用前缀
+const (
+	SchemeFile  = "file"
+	SchemeVault = "vault"
+	SchemeAWS   = "aws-sm"
+)
+
+var schemes = []string{SchemeFile, SchemeVault, SchemeAWS}
+
+const fetchTimeout = 10 * time.Second
+
+var ErrNotReference = errors.New("不是密钥引用")
+
+// Reference 解析后的密钥引用
+type Reference struct {
+	Raw    string
+	Scheme string
+	Path   string
+	Key    string
+}
+
+// Options 外部密钥存储配置
+type Options struct {
+	// RefreshInterval 后台刷新间隔，<=0 时不刷新
+	RefreshInterval time.Duration
+	VaultAddr       string
+	VaultToken      string
+	VaultNamespace  string
+	AWSRegion       string
+}
+
+// Status 引用的解析状态（不含密钥值）
+type Status struct {
+	Reference     string     `json:"reference"`
+	Provider      string     `json:"provider"`
+	Resolved      bool       `json:"resolved"`
+	FetchedAt     *time.Time `json:"fetchedAt,omitempty"`
+	LastAttemptAt time.Time  `json:"lastAttemptAt"`
+	LastError     string     `json:"lastError,omitempty"`
+	Changes       int        `json:"changes"`
+}
+
+// provider 拉取引用指向的密钥，并按 Reference.Key 取出字段
+type provider interface {
+	fetch(ctx context.Context, ref Reference) (string, error)
+}
+
+type entry struct {
+	value         string
+	fetchedAt     time.Time
+	lastAttemptAt time.Time
+	lastError     string
+	changes       int
+}
+
+// Store 密钥引用缓存
+type Store struct {
+	mu        sync.RWMutex
+	entries   map[string]*entry
+	providers map[string]provider
+	interval  time.Duration
+	startOnce sync.Once
+}
+
+// NewStore 创建密钥缓存，未调用 Configure 时仅支持文件引用
+func NewStore() *Store {
+	return &Store{
+		entries:   make(map[string]*entry),
+		providers: map[string]provider{SchemeFile: fileProvider{}},
+	}
+}
+
+var defaultStore = NewStore()
+
+// Configure 配置全局密钥缓存
+func Configure(opts Options) {
+	defaultStore.Configure(opts)
+}
+
+// Resolve 解析全局缓存中的引用，非引用值原样返回
+func Resolve(value string) (string, error) {
+	return defaultStore.Resolve(value)
+}
+
+// Refresh 立即刷新全局缓存中的全部引用
+func Refresh(ctx context.Context) []Status {
+	return defaultStore.Refresh(ctx)
+}
+
+// Statuses 返回全局缓存中所有引用的状态
+func Statuses() []Status {
+	return defaultStore.Statuses()
+}
+
+// StartRefresher 启动全局缓存的后台刷新
+func StartRefresher() {
+	defaultStore.StartRefresher()
+}
+
+// IsReference 判断值是否为密钥引用
+func IsReference(value string) bool {
+	_, ok := schemeOf(value)
+	return ok
+}
+
+func schemeOf(value string) (string, bool) {
+	for _, scheme := range schemes {
+		if strings.HasPrefix(value, scheme+"://") {
+			return scheme, true
+		}
+	}
+	return "", false
+}
+
+// ParseReference 解析 scheme://path#key 形式的引用
+func ParseReference(value string) (Reference, error) {
+	value = strings.TrimSpace(value)
+	scheme, ok := schemeOf(value)
+	if !ok {
+		return Reference{}, ErrNotReference
+	}
+	ref := Reference{Raw: value, Scheme: scheme, Path: strings.TrimPrefix(value, scheme+"://")}
+	if idx := strings.LastIndex(ref.Path, "#"); idx >= 0 {
+		ref.Path, ref.Key = ref.Path[:idx], ref.Path[idx+1:]
+	}
+	if ref.Path == "" {
+		return Reference{}, fmt.Errorf("密钥引用 %s 缺少路径", value)
+	}
+	return ref, nil
+}
+
+// Configure 按配置注册 Vault 与 AWS Secrets Manager
+func (s *Store) Configure(opts Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interval = opts.RefreshInterval
+	s.providers[SchemeVault] = newVaultProvider(opts.VaultAddr, opts.VaultToken, opts.VaultNamespace)
+	s.providers[SchemeAWS] = newAWSProvider(opts.AWSRegion)
+}
+
+// Resolve 返回引用的缓存值，首次访问时同步拉取；刷新失败时沿用上次成功的值
+func (s *Store) Resolve(value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	ref, err := ParseReference(value)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.RLock()
+	e, ok := s.entries[ref.Raw]
+	if ok && !e.fetchedAt.IsZero() {
+		v := e.value
+		s.mu.RUnlock()
+		return v, nil
+	}
+	s.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	if err := s.refreshOne(ctx, ref); err != nil {
+		return "", err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.entries[ref.Raw].value, nil
+}
+
+// Refresh 重新拉取所有已访问过的引用
+func (s *Store) Refresh(ctx context.Context) []Status {
+	s.mu.RLock()
+	raws := make([]string, 0, len(s.entries))
+	for raw := range s.entries {
+		raws = append(raws, raw)
+	}
+	s.mu.RUnlock()
+
+	for _, raw := range raws {
+		ref, err := ParseReference(raw)
+		if err != nil {
+			continue
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		if err := s.refreshOne(fetchCtx, ref); err != nil {
+			log.Warnf("secrets: 刷新 %s 失败，继续使用缓存值: %v", raw, err)
+		}
+		cancel()
+	}
+	return s.Statuses()
+}
+
+func (s *Store) refreshOne(ctx context.Context, ref Reference) error {
+	s.mu.RLock()
+	p, ok := s.providers[ref.Scheme]
+	s.mu.RUnlock()
+
+	var (
+		value string
+		err   error
+	)
+	if !ok {
+		err = fmt.Errorf("未配置 %s 密钥存储", ref.Scheme)
+	} else {
+		value, err = p.fetch(ctx, ref)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.entries[ref.Raw]
+	if !exists {
+		// 从未解析成功的引用不进入缓存，避免错误配置被反复刷新
+		if err != nil {
+			return fmt.Errorf("解析密钥引用 %s 失败: %w", ref.Raw, err)
+		}
+		e = &entry{}
+		s.entries[ref.Raw] = e
+	}
+	e.lastAttemptAt = time.Now()
+	if err != nil {
+		e.lastError = err.Error()
+		return fmt.Errorf("解析密钥引用 %s 失败: %w", ref.Raw, err)
+	}
+	if !e.fetchedAt.IsZero() && e.value != value {
+		e.changes++
+		log.Infof("secrets: %s 已轮换", ref.Raw)
+	}
+	e.value = value
+	e.fetchedAt = e.lastAttemptAt
+	e.lastError = ""
+	return nil
+}
+
+// Statuses 按引用排序返回状态
+func (s *Store) Statuses() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Status, 0, len(s.entries))
+	for raw, e := range s.entries {
+		scheme, _ := schemeOf(raw)
+		st := Status{
+			Reference:     raw,
+			Provider:      scheme,
+			Resolved:      !e.fetchedAt.IsZero(),
+			LastAttemptAt: e.lastAttemptAt,
+			LastError:     e.lastError,
+			Changes:       e.changes,
+		}
+		if st.Resolved {
+			fetchedAt := e.fetchedAt
+			st.FetchedAt = &fetchedAt
+		}
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Reference < result[j].Reference })
+	return result
+}
+
+// StartRefresher 按配置的间隔在后台刷新，重复调用无效
+func (s *Store) StartRefresher() {
+	s.mu.RLock()
+	interval := s.interval
+	s.mu.RUnlock()
+	if interval <= 0 {
+		return
+	}
+	s.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				s.Refresh(context.Background())
+			}
+		}()
+	})
+}
+
+// extractKey 从 JSON 对象中取出指定字段，key 为空时返回原值
+func extractKey(raw, key string) (string, error) {
+	if key == "" {
+		return raw, nil
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+		return "", fmt.Errorf("密钥内容不是 JSON 对象，无法读取字段 %s", key)
+	}
+	return fieldString(obj, key)
+}
+
+func fieldString(obj map[string]interface{}, key string) (string, error) {
+	v, ok := obj[key]
+	if !ok {
+		return "", fmt.Errorf("字段 %s 不存在", key)
+	}
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case nil:
+		return "", fmt.Errorf("字段 %s 为空", key)
+	default:
+		return fmt.Sprint(val), nil
+	}
+}
@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// vaultProvider 通过 HTTP API 读取 HashiCorp Vault KV（v1/v2）
+type vaultProvider struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+func newVaultProvider(addr, token, namespace string) *vaultProvider {
+	return &vaultProvider{
+		addr:      strings.TrimRight(addr, "/"),
+		token:     token,
+		namespace: namespace,
+		client:    &http.Client{Timeout: fetchTimeout},
+	}
+}
+
+func (p *vaultProvider) fetch(ctx context.Context, ref Reference) (string, error) {
+	if p.addr == "" {
+		return "", errors.New("未配置 VAULT_ADDR")
+	}
+	// Token 本身可来自挂载文件（如 Vault Agent 写出的 token）
+	if IsReference(p.token) && !strings.HasPrefix(p.token, SchemeFile+"://") {
+		return "", errors.New("VAULT_TOKEN 仅支持 file:// 引用")
+	}
+	token, err := Resolve(p.token)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.addr+"/v1/"+strings.TrimLeft(ref.Path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Vault 返回 HTTP %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", fmt.Errorf("解析 Vault 响应失败: %w", err)
+	}
+	data := payload.Data
+	// KV v2 的字段位于 data.data，同时带有 metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = inner
+		}
+	}
+
+	key := ref.Key
+	if key == "" {
+		if len(data) != 1 {
+			return "", errors.New("Vault 密钥包含多个字段，请使用 #字段名 指定")
+		}
+		for k := range data {
+			key = k
+		}
+	}
+	return fieldString(data, key)
+}
@@ -8,12 +8,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"strings"
 	"time"
 
-	"ampmanager/internal/config"
-	"ampmanager/internal/crypto"
 	"ampmanager/internal/model"
 	"ampmanager/internal/repository"
 )
@@ -23,6 +21,7 @@ var (
 	ErrAPIKeyRevoked       = errors.New("API Key 已被撤销")
 	ErrAPIKeyNotRetrievable = errors.New("API Key 只在创建时显示一次，无法再次获取")
 	ErrNotOwner            = errors.New("无权操作此资源")
+	ErrSettingsConflict    = errors.New("设置已在其他地方被修改，请刷新后重试")
 )
 
 type AmpService struct {
@@ -53,29 +52,11 @@ func (s *AmpService) GetSettings(userID string) (*model.AmpSettingsResponse, err
 			NativeMode:         false,
 			ShowBalanceInAd:    false,
 			HasSocks5Proxy:     false,
+			PostProcessing:     model.PostProcessingSettings{Processors: []string{}},
 		}, nil
 	}
 
-	var mappings []model.ModelMapping
-	if settings.ModelMappingsJSON != "" {
-		_ = json.Unmarshal([]byte(settings.ModelMappingsJSON), &mappings)
-	}
-	if mappings == nil {
-		mappings = []model.ModelMapping{}
-	}
-
-	return &model.AmpSettingsResponse{
-		UpstreamURL:     settings.UpstreamURL,
-		ModelMappings:   mappings,
-		Enabled:         settings.Enabled,
-		HasAPIKey:       settings.UpstreamAPIKey != "",
-		WebSearchMode:   settings.WebSearchMode,
-		NativeMode:      settings.NativeMode,
-		ShowBalanceInAd: settings.ShowBalanceInAd,
-		HasSocks5Proxy:  settings.Socks5Proxy != "",
-		CreatedAt:       settings.CreatedAt,
-		UpdatedAt:       settings.UpdatedAt,
-	}, nil
+	return buildAmpSettingsResponse(settings), nil
 }
 
 func (s *AmpService) UpdateSettings(userID string, req *model.AmpSettingsRequest) (*model.AmpSettingsResponse, error) {
@@ -90,6 +71,7 @@ func (s *AmpService) UpdateSettings(userID string, req *model.AmpSettingsRequest
 		Enabled:     req.Enabled,
 		WebSearchMode:      req.WebSearchMode,
 		NativeMode:         req.NativeMode,
+		Version:            req.Version,
 	}
 
 	// 处理 ShowBalanceInAd（*bool 指针，nil 表示不修改）
@@ -118,17 +100,8 @@ func (s *AmpService) UpdateSettings(userID string, req *model.AmpSettingsRequest
 	if existing != nil && req.UpstreamAPIKey == "" {
 		settings.UpstreamAPIKey = existing.UpstreamAPIKey
 	} else if req.UpstreamAPIKey != "" {
-		encKey := config.Get().GetEncryptionKey()
-		if encKey != nil {
-			encrypted, err := crypto.Encrypt([]byte(req.UpstreamAPIKey), encKey)
-			if err != nil {
-				return nil, fmt.Errorf("failed to encrypt upstream API key: %w", err)
-			}
-			settings.UpstreamAPIKey = encrypted
-		} else {
-			log.Println("[WARN] DATA_ENCRYPTION_KEY not set, storing upstream API key in plaintext")
-			settings.UpstreamAPIKey = req.UpstreamAPIKey
-		}
+		// 加密存储由 repository 层负责
+		settings.UpstreamAPIKey = req.UpstreamAPIKey
 	}
 
 	if req.ModelMappings != nil {
@@ -138,30 +111,71 @@ func (s *AmpService) UpdateSettings(userID string, req *model.AmpSettingsRequest
 		settings.ModelMappingsJSON = existing.ModelMappingsJSON
 	}
 
-	if err := s.settingsRepo.Upsert(settings); err != nil {
-		return nil, err
+	if req.PostProcessing != nil {
+		postProcessingJSON, _ := json.Marshal(req.PostProcessing)
+		settings.PostProcessingJSON = string(postProcessingJSON)
+	} else if existing != nil {
+		settings.PostProcessingJSON = existing.PostProcessingJSON
 	}
 
-	var mappings []model.ModelMapping
-	if settings.ModelMappingsJSON != "" {
-		_ = json.Unmarshal([]byte(settings.ModelMappingsJSON), &mappings)
+	if req.SystemPrompt != nil {
+		settings.SystemPrompt = strings.TrimSpace(*req.SystemPrompt)
+	} else if existing != nil {
+		settings.SystemPrompt = existing.SystemPrompt
 	}
-	if mappings == nil {
-		mappings = []model.ModelMapping{}
+
+	if err := s.settingsRepo.Upsert(settings); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return nil, ErrSettingsConflict
+		}
+		return nil, err
 	}
 
+	return buildAmpSettingsResponse(settings), nil
+}
+
+// buildAmpSettingsResponse 将设置转换为接口响应，不包含密钥等敏感字段
+func buildAmpSettingsResponse(settings *model.AmpSettings) *model.AmpSettingsResponse {
 	return &model.AmpSettingsResponse{
 		UpstreamURL:     settings.UpstreamURL,
-		ModelMappings:   mappings,
+		ModelMappings:   decodeModelMappings(settings.ModelMappingsJSON),
 		Enabled:         settings.Enabled,
 		HasAPIKey:       settings.UpstreamAPIKey != "",
+		APIKeyMasked:    maskImportKey(settings.UpstreamAPIKey),
 		WebSearchMode:   settings.WebSearchMode,
 		NativeMode:      settings.NativeMode,
 		ShowBalanceInAd: settings.ShowBalanceInAd,
 		HasSocks5Proxy:  settings.Socks5Proxy != "",
+		PostProcessing:  decodePostProcessing(settings.PostProcessingJSON),
+		SystemPrompt:    settings.SystemPrompt,
+		Version:         settings.Version,
 		CreatedAt:       settings.CreatedAt,
 		UpdatedAt:       settings.UpdatedAt,
-	}, nil
+	}
+}
+
+// decodeModelMappings 解析模型映射，未配置时返回空列表
+func decodeModelMappings(raw string) []model.ModelMapping {
+	var mappings []model.ModelMapping
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &mappings)
+	}
+	if mappings == nil {
+		mappings = []model.ModelMapping{}
+	}
+	return mappings
+}
+
+// decodePostProcessing 解析响应后处理设置，未配置时返回空列表
+func decodePostProcessing(raw string) model.PostProcessingSettings {
+	var pp model.PostProcessingSettings
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &pp)
+	}
+	if pp.Processors == nil {
+		pp.Processors = []string{}
+	}
+	return pp
 }
 
 func (s *AmpService) TestConnection(userID string) (*model.TestConnectionResponse, error) {
@@ -186,9 +200,8 @@ func (s *AmpService) TestConnection(userID string) (*model.TestConnectionRespons
 	}
 
 	if settings.UpstreamAPIKey != "" {
-		apiKey := s.decryptUpstreamAPIKey(settings.UpstreamAPIKey)
-		req.Header.Set("Authorization", "Bearer "+apiKey)
-		req.Header.Set("X-Api-Key", apiKey)
+		req.Header.Set("Authorization", "Bearer "+settings.UpstreamAPIKey)
+		req.Header.Set("X-Api-Key", settings.UpstreamAPIKey)
 	}
 
 	start := time.Now()
@@ -235,6 +248,11 @@ func (s *AmpService) TestConnection(userID string) (*model.TestConnectionRespons
 }
 
 func (s *AmpService) CreateAPIKey(userID string, req *model.CreateAPIKeyRequest) (*model.CreateAPIKeyResponse, error) {
+	scopes, err := NormalizeAPIKeyScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
 	keyBytes := make([]byte, 32)
 	if _, err := rand.Read(keyBytes); err != nil {
 		return nil, err
@@ -252,11 +270,13 @@ func (s *AmpService) CreateAPIKey(userID string, req *model.CreateAPIKeyRequest)
 		Prefix:  prefix,
 		KeyHash: keyHash,
 		APIKey:  rawKey,
+		Scopes:  scopes,
 	}
 
 	if err := s.apiKeyRepo.Create(apiKey); err != nil {
 		return nil, err
 	}
+	notifyCredentialChangeByID(userID, fmt.Sprintf("新建了 API Key「%s」（%s…）", apiKey.Name, prefix))
 
 	return &model.CreateAPIKeyResponse{
 		ID:        apiKey.ID,
@@ -265,6 +285,7 @@ func (s *AmpService) CreateAPIKey(userID string, req *model.CreateAPIKeyRequest)
 		APIKey:    rawKey,
 		CreatedAt: apiKey.CreatedAt,
 		Message:   "API Key 创建成功，请妥善保存，可在列表中再次查看",
+		Scopes:    scopes,
 	}, nil
 }
 
@@ -287,6 +308,7 @@ func (s *AmpService) ListAPIKeys(userID string) ([]*model.APIKeyListItem, error)
 			RevokedAt: k.RevokedAt,
 			LastUsed:  k.LastUsed,
 			IsActive:  k.RevokedAt == nil,
+			Scopes:    k.Scopes,
 		})
 	}
 	return items, nil
@@ -347,14 +369,7 @@ func (s *AmpService) GetBootstrap(userID string) (*model.BootstrapResponse, erro
 }
 
 func (s *AmpService) GetSettingsInternal(userID string) (*model.AmpSettings, error) {
-	settings, err := s.settingsRepo.GetByUserID(userID)
-	if err != nil {
-		return nil, err
-	}
-	if settings != nil && settings.UpstreamAPIKey != "" {
-		settings.UpstreamAPIKey = s.decryptUpstreamAPIKey(settings.UpstreamAPIKey)
-	}
-	return settings, nil
+	return s.settingsRepo.GetByUserID(userID)
 }
 
 func (s *AmpService) ValidateAPIKey(rawKey string) (*model.UserAPIKey, error) {
@@ -377,20 +392,3 @@ func (s *AmpService) ValidateAPIKey(rawKey string) (*model.UserAPIKey, error) {
 	return key, nil
 }
 
-func (s *AmpService) decryptUpstreamAPIKey(storedKey string) string {
-	if storedKey == "" {
-		return ""
-	}
-
-	encKey := config.Get().GetEncryptionKey()
-	if encKey == nil {
-		return storedKey
-	}
-
-	decrypted, err := crypto.Decrypt(storedKey, encKey)
-	if err != nil {
-		log.Printf("[WARN] Failed to decrypt upstream API key (may be plaintext from before encryption was enabled): %v", err)
-		return storedKey
-	}
-	return string(decrypted)
-}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+const (
+	auditActionAPIKeyCreate        = "api_key.create"
+	auditActionAPIKeyDelete        = "api_key.delete"
+	auditActionModelMappingsUpdate = "user.model_mappings_update"
+)
+
+// AdminCreateAPIKey 管理员（或分组管理员）为用户签发 API Key 并写入审计记录
+func (s *AmpService) AdminCreateAPIKey(actor, userID string, req *model.CreateAPIKeyRequest) (*model.CreateAPIKeyResponse, error) {
+	key, err := s.CreateAPIKey(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(actor, auditActionAPIKeyCreate, "user", userID, map[string]interface{}{
+		"keyId":  key.ID,
+		"name":   key.Name,
+		"prefix": key.Prefix,
+	})
+	return key, nil
+}
+
+// AdminDeleteAPIKey 管理员（或分组管理员）删除用户的 API Key 并写入审计记录
+func (s *AmpService) AdminDeleteAPIKey(actor, userID, keyID string) error {
+	if err := s.DeleteAPIKey(userID, keyID); err != nil {
+		return err
+	}
+	recordAudit(actor, auditActionAPIKeyDelete, "user", userID, map[string]interface{}{"keyId": keyID})
+	return nil
+}
+
+// GetModelMappings 返回用户的模型映射与设置版本号
+func (s *AmpService) GetModelMappings(userID string) (*model.ModelMappingsResponse, error) {
+	settings, err := s.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ModelMappingsResponse{ModelMappings: settings.ModelMappings, Version: settings.Version}, nil
+}
+
+// UpdateModelMappings 只替换用户的模型映射并写入审计记录；用户尚无设置时按默认值创建
+func (s *AmpService) UpdateModelMappings(actor, userID string, req *model.ModelMappingsRequest) (*model.ModelMappingsResponse, error) {
+	existing, err := s.settingsRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	settings := &model.AmpSettings{
+		UserID:        userID,
+		UpstreamURL:   "https://ampcode.com",
+		WebSearchMode: model.WebSearchModeUpstream,
+	}
+	previous := []model.ModelMapping{}
+	if existing != nil {
+		settings = existing
+		previous = decodeModelMappings(existing.ModelMappingsJSON)
+	}
+	settings.Version = req.Version
+	mappingsJSON, _ := json.Marshal(req.ModelMappings)
+	settings.ModelMappingsJSON = string(mappingsJSON)
+
+	if err := s.settingsRepo.Upsert(settings); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return nil, ErrSettingsConflict
+		}
+		return nil, err
+	}
+	recordAudit(actor, auditActionModelMappingsUpdate, "user", userID, map[string]interface{}{
+		"before": previous,
+		"after":  req.ModelMappings,
+	})
+	return &model.ModelMappingsResponse{ModelMappings: decodeModelMappings(settings.ModelMappingsJSON), Version: settings.Version}, nil
+}
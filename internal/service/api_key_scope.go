@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"ampmanager/internal/model"
+)
+
+const (
+	auditActionAPIKeyScopesUpdate = "api_key.scopes_update"
+
+	maxAPIKeyScopeModels     = 100
+	maxAPIKeyModelPatternLen = 128
+)
+
+var ErrInvalidAPIKeyScopes = errors.New("API Key 访问范围无效")
+
+// NormalizeAPIKeyScopes 去除空白与重复项并校验访问范围，没有任何限制时返回 nil
+func NormalizeAPIKeyScopes(scopes *model.APIKeyScopes) (*model.APIKeyScopes, error) {
+	if scopes == nil {
+		return nil, nil
+	}
+	normalized := &model.APIKeyScopes{MonthlyBudgetMicros: scopes.MonthlyBudgetMicros}
+	if normalized.MonthlyBudgetMicros < 0 {
+		return nil, fmt.Errorf("%w: 月度预算不能为负数", ErrInvalidAPIKeyScopes)
+	}
+
+	seen := make(map[string]bool)
+	for _, pattern := range scopes.Models {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || seen[pattern] {
+			continue
+		}
+		if len(pattern) > maxAPIKeyModelPatternLen {
+			return nil, fmt.Errorf("%w: 模型名称过长: %s", ErrInvalidAPIKeyScopes, pattern)
+		}
+		seen[pattern] = true
+		normalized.Models = append(normalized.Models, pattern)
+	}
+	if len(normalized.Models) > maxAPIKeyScopeModels {
+		return nil, fmt.Errorf("%w: 最多允许 %d 个模型", ErrInvalidAPIKeyScopes, maxAPIKeyScopeModels)
+	}
+
+	seen = make(map[string]bool)
+	for _, endpoint := range scopes.Endpoints {
+		endpoint = strings.ToLower(strings.TrimSpace(endpoint))
+		if endpoint == "" || seen[endpoint] {
+			continue
+		}
+		if !containsString(model.APIKeyEndpoints, endpoint) {
+			return nil, fmt.Errorf("%w: 未知的接口类别 %q，可选值为 %s", ErrInvalidAPIKeyScopes, endpoint, strings.Join(model.APIKeyEndpoints, ", "))
+		}
+		seen[endpoint] = true
+		normalized.Endpoints = append(normalized.Endpoints, endpoint)
+	}
+
+	if normalized.IsEmpty() {
+		return nil, nil
+	}
+	return normalized, nil
+}
+
+// UpdateAPIKeyScopes 替换用户自己的 API Key 的访问范围
+func (s *AmpService) UpdateAPIKeyScopes(userID, keyID string, req *model.UpdateAPIKeyScopesRequest) (*model.APIKeyListItem, error) {
+	scopes, err := NormalizeAPIKeyScopes(&req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.apiKeyRepo.GetByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.RevokedAt != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	if key.UserID != userID {
+		return nil, ErrNotOwner
+	}
+	if err := s.apiKeyRepo.UpdateScopes(keyID, scopes); err != nil {
+		return nil, err
+	}
+	return &model.APIKeyListItem{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		CreatedAt: key.CreatedAt,
+		LastUsed:  key.LastUsed,
+		IsActive:  true,
+		Scopes:    scopes,
+	}, nil
+}
+
+// AdminUpdateAPIKeyScopes 管理员（或分组管理员）替换用户 API Key 的访问范围并写入审计记录
+func (s *AmpService) AdminUpdateAPIKeyScopes(actor, userID, keyID string, req *model.UpdateAPIKeyScopesRequest) (*model.APIKeyListItem, error) {
+	item, err := s.UpdateAPIKeyScopes(userID, keyID, req)
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(actor, auditActionAPIKeyScopesUpdate, "user", userID, map[string]interface{}{
+		"keyId":  keyID,
+		"scopes": item.Scopes,
+	})
+	return item, nil
+}
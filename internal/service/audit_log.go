@@ -0,0 +1,50 @@
+package service
+
+import (
+	"encoding/json"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AuditActorScheduler 定时任务执行操作时记录的操作人
+const AuditActorScheduler = "scheduler"
+
+type AuditLogService struct {
+	repo *repository.AuditLogRepository
+}
+
+func NewAuditLogService() *AuditLogService {
+	return &AuditLogService{repo: repository.NewAuditLogRepository()}
+}
+
+func (s *AuditLogService) List(filter model.AuditLogFilter) (*model.AuditLogListResponse, error) {
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 200 {
+		filter.PageSize = 50
+	}
+	items, total, err := s.repo.List(filter)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuditLogListResponse{Items: items, Total: total, Page: filter.Page, PageSize: filter.PageSize}, nil
+}
+
+// recordAudit 写入一条审计记录，失败只记录日志，不影响操作本身
+func recordAudit(actor, action, targetType, targetID string, detail interface{}) {
+	entry := &model.AuditLog{Actor: actor, Action: action, TargetType: targetType, TargetID: targetID}
+	if detail != nil {
+		data, err := json.Marshal(detail)
+		if err != nil {
+			log.Warnf("audit log: 序列化 %s 详情失败: %v", action, err)
+		}
+		entry.Detail = data
+	}
+	if err := repository.NewAuditLogRepository().Create(entry); err != nil {
+		log.Warnf("audit log: 写入 %s 记录失败: %v", action, err)
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInsufficientBalance 扣减金额超过用户当前余额
+	ErrInsufficientBalance = errors.New("用户余额不足，无法扣减")
+	// ErrInvalidBalanceAdjustment 调整参数无效
+	ErrInvalidBalanceAdjustment = errors.New("余额调整参数无效")
+
+	errBalanceAdjustmentTooLarge = fmt.Errorf("%w: 单次调整金额不能超过 %d 美元", ErrInvalidBalanceAdjustment, maxBalanceAdjustmentMicros/1_000_000)
+)
+
+const auditActionBalanceAdjust = "balance.adjust"
+
+// maxBillingHistoryPageSize 计费记录单页上限
+const maxBillingHistoryPageSize = 200
+
+// maxBalanceAdjustmentMicros 单次调整金额上限（100 万美元），防止误操作与 amountUsd 换算溢出
+const maxBalanceAdjustmentMicros int64 = 1_000_000 * 1_000_000
+
+// BalanceAdjustmentAmount 解析调整金额，amountMicros 优先，二者都未设置或超过单次上限时返回错误；
+// amountUsd 按四舍五入换算为微美元，避免 1.005 之类的金额因浮点误差少计 1 micro
+func BalanceAdjustmentAmount(req *model.BalanceAdjustmentRequest) (int64, error) {
+	if req.AmountMicros > 0 {
+		return checkBalanceAdjustmentLimit(req.AmountMicros)
+	}
+	usd := req.AmountUsd
+	if math.IsNaN(usd) || math.IsInf(usd, 0) {
+		return 0, fmt.Errorf("%w: amountUsd 不是有效数字", ErrInvalidBalanceAdjustment)
+	}
+	// 先按美元比较再换算，超出 int64 范围的金额转换结果未定义
+	if math.Abs(usd) > float64(maxBalanceAdjustmentMicros)/1e6 {
+		return 0, errBalanceAdjustmentTooLarge
+	}
+	if amount := int64(math.Round(usd * 1e6)); amount > 0 {
+		return checkBalanceAdjustmentLimit(amount)
+	}
+	return 0, fmt.Errorf("%w: amountMicros 或 amountUsd 必须大于 0", ErrInvalidBalanceAdjustment)
+}
+
+func checkBalanceAdjustmentLimit(amountMicros int64) (int64, error) {
+	if amountMicros > maxBalanceAdjustmentMicros {
+		return 0, errBalanceAdjustmentTooLarge
+	}
+	return amountMicros, nil
+}
+
+// AdjustBalance 在同一事务内增减用户余额并写入 adjustment 计费事件，之后写入审计记录。
+// 扣减不会使余额变为负数，余额不足时返回 ErrInsufficientBalance
+func (s *BillingService) AdjustBalance(actor, userID, direction string, amountMicros int64, reason string) (*model.BillingEvent, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, fmt.Errorf("%w: 必须填写调整原因", ErrInvalidBalanceAdjustment)
+	}
+	if amountMicros <= 0 {
+		return nil, fmt.Errorf("%w: 金额必须大于 0", ErrInvalidBalanceAdjustment)
+	}
+	if _, err := checkBalanceAdjustmentLimit(amountMicros); err != nil {
+		return nil, err
+	}
+	if direction != model.BalanceAdjustmentCredit && direction != model.BalanceAdjustmentDebit {
+		return nil, fmt.Errorf("%w: direction 必须为 credit 或 debit", ErrInvalidBalanceAdjustment)
+	}
+
+	db := database.GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("balance adjust: begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var result sql.Result
+	if direction == model.BalanceAdjustmentCredit {
+		result, err = tx.Exec(`UPDATE users SET balance_micros = balance_micros + ?, updated_at = ? WHERE id = ?`, amountMicros, now, userID)
+	} else {
+		result, err = tx.Exec(`UPDATE users SET balance_micros = balance_micros - ?, updated_at = ? WHERE id = ? AND balance_micros >= ?`, amountMicros, now, userID, amountMicros)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("balance adjust: update balance: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	var balance int64
+	if err := tx.QueryRow(`SELECT balance_micros FROM users WHERE id = ?`, userID).Scan(&balance); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("balance adjust: query balance: %w", err)
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("%w（当前余额 %.6f USD）", ErrInsufficientBalance, float64(balance)/1e6)
+	}
+
+	event := &model.BillingEvent{
+		ID:                 uuid.New().String(),
+		UserID:             userID,
+		Source:             model.BillingSourceBalance,
+		EventType:          model.BillingEventAdjustment,
+		AmountMicros:       amountMicros,
+		Direction:          direction,
+		Reason:             reason,
+		Actor:              actor,
+		BalanceAfterMicros: &balance,
+		CreatedAt:          now,
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO billing_events (id, request_log_id, user_id, user_subscription_id, source, event_type, amount_micros, direction, reason, actor, balance_after_micros, created_at)
+		 VALUES (?, NULL, ?, NULL, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.ID, event.UserID, event.Source, event.EventType, event.AmountMicros, event.Direction, event.Reason, event.Actor, balance, event.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("balance adjust: insert event: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("balance adjust: commit: %w", err)
+	}
+
+	log.Infof("balance adjust: %s %s user %s by %d micros (%s), balance now %d", actor, direction, userID, amountMicros, reason, balance)
+	recordAudit(actor, auditActionBalanceAdjust, "user", userID, map[string]interface{}{
+		"eventId":            event.ID,
+		"direction":          direction,
+		"amountMicros":       amountMicros,
+		"reason":             reason,
+		"balanceAfterMicros": balance,
+	})
+	return event, nil
+}
+
+// ListBillingHistory 分页返回用户的计费记录（扣费、退款与余额调整），按时间倒序
+func (s *BillingService) ListBillingHistory(userID string, page, pageSize int) (*model.BillingEventListResponse, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > maxBillingHistoryPageSize {
+		pageSize = 50
+	}
+	total, err := s.eventRepo.CountByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.eventRepo.ListByUserID(userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []*model.BillingEvent{}
+	}
+	return &model.BillingEventListResponse{Items: items, Total: total, Page: page, PageSize: pageSize}, nil
+}
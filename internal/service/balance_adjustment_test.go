@@ -0,0 +1,302 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+// setupTestDB 为每个测试初始化独立的 SQLite 数据库
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+}
+
+func createTestUser(t *testing.T, username string, balanceMicros int64) *model.User {
+	t.Helper()
+	user := &model.User{Username: username, PasswordHash: "x", BalanceMicros: balanceMicros}
+	if err := repository.NewUserRepository().Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func userBalance(t *testing.T, userID string) int64 {
+	t.Helper()
+	balance, err := repository.NewUserRepository().GetBalance(userID)
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	return balance
+}
+
+func TestBalanceAdjustmentAmount(t *testing.T) {
+	cases := []struct {
+		req  model.BalanceAdjustmentRequest
+		want int64
+	}{
+		{model.BalanceAdjustmentRequest{AmountMicros: 1500, AmountUsd: 9}, 1500},
+		{model.BalanceAdjustmentRequest{AmountUsd: 1.005}, 1_005_000},
+		{model.BalanceAdjustmentRequest{AmountUsd: 0.29}, 290_000},
+		{model.BalanceAdjustmentRequest{AmountUsd: 0.000001}, 1},
+	}
+	for _, tc := range cases {
+		got, err := BalanceAdjustmentAmount(&tc.req)
+		if err != nil || got != tc.want {
+			t.Errorf("%+v = %d, %v; want %d", tc.req, got, err, tc.want)
+		}
+	}
+	if _, err := BalanceAdjustmentAmount(&model.BalanceAdjustmentRequest{AmountUsd: 0.0000001}); !errors.Is(err, ErrInvalidBalanceAdjustment) {
+		t.Errorf("sub-micro amount error = %v", err)
+	}
+}
+
+func TestBalanceAdjustmentAmountBounds(t *testing.T) {
+	maxUsd := float64(maxBalanceAdjustmentMicros) / 1e6
+	valid := []struct {
+		req  model.BalanceAdjustmentRequest
+		want int64
+	}{
+		{model.BalanceAdjustmentRequest{AmountMicros: maxBalanceAdjustmentMicros}, maxBalanceAdjustmentMicros},
+		{model.BalanceAdjustmentRequest{AmountUsd: maxUsd}, maxBalanceAdjustmentMicros},
+		{model.BalanceAdjustmentRequest{AmountUsd: maxUsd - 0.000001}, maxBalanceAdjustmentMicros - 1},
+	}
+	for _, tc := range valid {
+		if got, err := BalanceAdjustmentAmount(&tc.req); err != nil || got != tc.want {
+			t.Errorf("%+v = %d, %v; want %d", tc.req, got, err, tc.want)
+		}
+	}
+
+	invalid := []model.BalanceAdjustmentRequest{
+		{AmountMicros: maxBalanceAdjustmentMicros + 1},
+		{AmountMicros: math.MaxInt64},
+		{AmountUsd: maxUsd + 0.000001},
+		{AmountUsd: 1e30},
+		{AmountUsd: -1e30},
+		{AmountUsd: -1},
+		{AmountUsd: math.MaxFloat64},
+		{AmountUsd: math.NaN()},
+		{AmountUsd: math.Inf(1)},
+		{AmountUsd: math.Inf(-1)},
+	}
+	for _, req := range invalid {
+		if got, err := BalanceAdjustmentAmount(&req); !errors.Is(err, ErrInvalidBalanceAdjustment) {
+			t.Errorf("%+v = %d, %v; want ErrInvalidBalanceAdjustment", req, got, err)
+		}
+	}
+}
+
+func TestAdjustBalanceRejectsAmountOverLimit(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", 0)
+	svc := NewBillingService()
+
+	if _, err := svc.AdjustBalance("admin", user.ID, model.BalanceAdjustmentCredit, maxBalanceAdjustmentMicros+1, "typo"); !errors.Is(err, ErrInvalidBalanceAdjustment) {
+		t.Fatalf("error = %v, want ErrInvalidBalanceAdjustment", err)
+	}
+	if balance := userBalance(t, user.ID); balance != 0 {
+		t.Errorf("balance after rejected credit = %d", balance)
+	}
+	if _, err := svc.AdjustBalance("admin", user.ID, model.BalanceAdjustmentCredit, maxBalanceAdjustmentMicros, "limit"); err != nil {
+		t.Fatalf("credit at limit: %v", err)
+	}
+	if balance := userBalance(t, user.ID); balance != maxBalanceAdjustmentMicros {
+		t.Errorf("balance = %d, want %d", balance, maxBalanceAdjustmentMicros)
+	}
+}
+
+func TestAdjustBalanceDebitBelowZero(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", 1_000_000)
+	svc := NewBillingService()
+
+	_, err := svc.AdjustBalance("admin", user.ID, model.BalanceAdjustmentDebit, 1_000_001, "overdraw")
+	if !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("error = %v, want ErrInsufficientBalance", err)
+	}
+	if balance := userBalance(t, user.ID); balance != 1_000_000 {
+		t.Errorf("balance after rejected debit = %d", balance)
+	}
+	if count, _ := repository.NewBillingEventRepository().CountByUserID(user.ID); count != 0 {
+		t.Errorf("rejected debit recorded %d events", count)
+	}
+	assertAuditCount(t, user.ID, 0)
+
+	// 扣减到恰好为零是允许的
+	event, err := svc.AdjustBalance("admin", user.ID, model.BalanceAdjustmentDebit, 1_000_000, "close account")
+	if err != nil {
+		t.Fatalf("debit to zero: %v", err)
+	}
+	if *event.BalanceAfterMicros != 0 || userBalance(t, user.ID) != 0 {
+		t.Errorf("balance after = %d / %d", *event.BalanceAfterMicros, userBalance(t, user.ID))
+	}
+}
+
+func TestAdjustBalanceValidation(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "bob", 0)
+	svc := NewBillingService()
+
+	invalid := []struct {
+		direction string
+		amount    int64
+		reason    string
+	}{
+		{model.BalanceAdjustmentCredit, 100, "  "},
+		{model.BalanceAdjustmentCredit, 0, "zero"},
+		{model.BalanceAdjustmentCredit, -100, "negative"},
+		{"refund", 100, "bad direction"},
+	}
+	for _, tc := range invalid {
+		if _, err := svc.AdjustBalance("admin", user.ID, tc.direction, tc.amount, tc.reason); !errors.Is(err, ErrInvalidBalanceAdjustment) {
+			t.Errorf("%+v error = %v", tc, err)
+		}
+	}
+	for _, direction := range []string{model.BalanceAdjustmentCredit, model.BalanceAdjustmentDebit} {
+		if _, err := svc.AdjustBalance("admin", "missing", direction, 100, "ghost"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("%s missing user error = %v", direction, err)
+		}
+	}
+}
+
+func TestAdjustBalanceRecordsEventAndAudit(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "carol", 250_000)
+	svc := NewBillingService()
+
+	event, err := svc.AdjustBalance("admin-1", user.ID, model.BalanceAdjustmentCredit, 750_000, " goodwill credit ")
+	if err != nil {
+		t.Fatalf("credit: %v", err)
+	}
+
+	history, err := svc.ListBillingHistory(user.ID, 1, 10)
+	if err != nil || history.Total != 1 {
+		t.Fatalf("history = %+v, %v", history, err)
+	}
+	stored := history.Items[0]
+	if stored.ID != event.ID || stored.EventType != model.BillingEventAdjustment || stored.Source != model.BillingSourceBalance ||
+		stored.AmountMicros != 750_000 || stored.Direction != model.BalanceAdjustmentCredit || stored.Reason != "goodwill credit" ||
+		stored.Actor != "admin-1" || stored.BalanceAfterMicros == nil || *stored.BalanceAfterMicros != 1_000_000 {
+		t.Errorf("stored event = %+v", stored)
+	}
+
+	logs := assertAuditCount(t, user.ID, 1)
+	entry := logs[0]
+	if entry.Actor != "admin-1" || entry.Action != auditActionBalanceAdjust || entry.TargetType != "user" {
+		t.Errorf("audit entry = %+v", entry)
+	}
+	var detail struct {
+		EventID            string `json:"eventId"`
+		Direction          string `json:"direction"`
+		AmountMicros       int64  `json:"amountMicros"`
+		Reason             string `json:"reason"`
+		BalanceAfterMicros int64  `json:"balanceAfterMicros"`
+	}
+	if err := json.Unmarshal(entry.Detail, &detail); err != nil {
+		t.Fatalf("audit detail: %v", err)
+	}
+	if detail.EventID != event.ID || detail.Direction != "credit" || detail.AmountMicros != 750_000 || detail.Reason != "goodwill credit" || detail.BalanceAfterMicros != 1_000_000 {
+		t.Errorf("audit detail = %+v", detail)
+	}
+}
+
+// 并发调整时余额不会变为负数，且每条事件的 balance_after_micros 与按提交顺序逐条累加的余额一致
+func TestAdjustBalanceConcurrent(t *testing.T) {
+	setupTestDB(t)
+	const initial = 1_000_000
+	user := createTestUser(t, "dave", initial)
+	svc := NewBillingService()
+
+	type outcome struct {
+		delta int64
+		err   error
+	}
+	var wg sync.WaitGroup
+	results := make(chan outcome, 40)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			direction, amount := model.BalanceAdjustmentDebit, int64(150_000+i)
+			if i%4 == 0 {
+				direction, amount = model.BalanceAdjustmentCredit, int64(100_000+i)
+			}
+			_, err := svc.AdjustBalance("admin", user.ID, direction, amount, "concurrent")
+			if direction == model.BalanceAdjustmentDebit {
+				amount = -amount
+			}
+			results <- outcome{delta: amount, err: err}
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	expected := int64(initial)
+	succeeded, rejected := 0, 0
+	for result := range results {
+		switch {
+		case result.err == nil:
+			expected += result.delta
+			succeeded++
+		case errors.Is(result.err, ErrInsufficientBalance):
+			rejected++
+		default:
+			t.Fatalf("unexpected error: %v", result.err)
+		}
+	}
+	if rejected == 0 {
+		t.Error("expected some debits to be rejected for insufficient balance")
+	}
+	if balance := userBalance(t, user.ID); balance != expected {
+		t.Fatalf("balance = %d, want %d", balance, expected)
+	}
+
+	// SQLite 写事务串行执行，rowid 顺序即提交顺序
+	rows, err := database.GetDB().Query(`SELECT direction, amount_micros, balance_after_micros FROM billing_events WHERE user_id = ? ORDER BY rowid`, user.ID)
+	if err != nil {
+		t.Fatalf("query events: %v", err)
+	}
+	defer rows.Close()
+	running, events := int64(initial), 0
+	for rows.Next() {
+		var direction string
+		var amount, after int64
+		if err := rows.Scan(&direction, &amount, &after); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		if direction == model.BalanceAdjustmentDebit {
+			amount = -amount
+		}
+		running += amount
+		if after != running || after < 0 {
+			t.Fatalf("event %d balance_after_micros = %d, want %d", events, after, running)
+		}
+		events++
+	}
+	if events != succeeded || running != expected {
+		t.Errorf("events = %d (want %d), final = %d (want %d)", events, succeeded, running, expected)
+	}
+	assertAuditCount(t, user.ID, succeeded)
+}
+
+func assertAuditCount(t *testing.T, userID string, want int) []*model.AuditLog {
+	t.Helper()
+	logs, total, err := repository.NewAuditLogRepository().List(model.AuditLogFilter{Action: auditActionBalanceAdjust, TargetID: userID, Page: 1, PageSize: 100})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	if int(total) != want {
+		t.Fatalf("audit entries = %d, want %d", total, want)
+	}
+	return logs
+}
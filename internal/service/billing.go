@@ -59,25 +59,44 @@ func NewBillingServiceWithRepo(
 	}
 }
 
+// CanStartRequest 用户是否还有可用的计费来源
 func (s *BillingService) CanStartRequest(userID string) (bool, error) {
-	setting, err := s.settingRepo.GetByUserID(userID)
+	result, err := s.CheckQuota(userID)
 	if err != nil {
 		return false, err
 	}
+	return result.Allowed, nil
+}
+
+// CheckQuota 模型调用前按用户的计费来源顺序检查是否还有可用额度，
+// 并给出已用尽的订阅窗口及其恢复时间
+func (s *BillingService) CheckQuota(userID string) (*model.QuotaCheckResult, error) {
+	setting, err := s.settingRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
 
 	sub, err := s.subRepo.GetActiveByUserID(userID)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	result := &model.QuotaCheckResult{
+		PrimarySource:    setting.PrimarySource,
+		SecondarySource:  setting.SecondarySource,
+		ExhaustedWindows: []model.QuotaExhaustedWindow{},
 	}
 
 	var subscriptionRemaining int64
 	if sub != nil {
-		_, limits, err := s.planRepo.GetByID(sub.PlanID)
+		plan, limits, err := s.planRepo.GetByID(sub.PlanID)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
 		if len(limits) > 0 {
-			subscriptionRemaining = s.calcSubscriptionRemaining(sub, limits)
+			result.HasSubscription = true
+			boundary := PlanResetBoundary(plan, UserLocation(userID))
+			subscriptionRemaining = s.checkSubscriptionWindows(sub, limits, boundary, time.Now().UTC(), result)
 		}
 	}
 
@@ -86,33 +105,38 @@ func (s *BillingService) CanStartRequest(userID string) (bool, error) {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			balance = 0
 		} else {
-			return false, err
+			return nil, err
 		}
 	}
+	result.BalanceMicros = balance
 
 	sources := []model.BillingSource{setting.PrimarySource, setting.SecondarySource}
 	for _, src := range sources {
 		switch src {
 		case model.BillingSourceSubscription:
 			if subscriptionRemaining > 0 {
-				return true, nil
+				result.Allowed = true
 			}
 		case model.BillingSourceBalance:
 			if balance > 0 {
-				return true, nil
+				result.Allowed = true
 			}
 		}
 	}
 
-	return false, nil
+	return result, nil
 }
 
-func (s *BillingService) calcSubscriptionRemaining(sub *model.UserSubscription, limits []model.SubscriptionPlanLimit) int64 {
-	now := time.Now().UTC()
+// checkSubscriptionWindows 计算订阅剩余额度（各窗口剩余的最小值），并把已用尽的窗口写入 result。
+// 订阅在所有已用尽窗口都恢复后才可用，因此恢复时间取各窗口恢复时间的最大值；
+// 任一窗口不会自动恢复或恢复前订阅已到期时，恢复时间为空
+func (s *BillingService) checkSubscriptionWindows(sub *model.UserSubscription, limits []model.SubscriptionPlanLimit, boundary QuotaResetBoundary, now time.Time, result *model.QuotaCheckResult) int64 {
 	minRemaining := int64(math.MaxInt64)
+	var resetsAt *time.Time
+	recoverable := true
 
 	for _, limit := range limits {
-		start, end, err := GetWindowBounds(limit.LimitType, limit.WindowMode, now, sub.StartsAt)
+		start, end, err := GetWindowBounds(limit.LimitType, limit.WindowMode, now, sub.StartsAt, boundary)
 		if err != nil {
 			continue
 		}
@@ -127,14 +151,65 @@ func (s *BillingService) calcSubscriptionRemaining(sub *model.UserSubscription,
 		if left < minRemaining {
 			minRemaining = left
 		}
+		if left > 0 {
+			continue
+		}
+
+		window := model.QuotaExhaustedWindow{
+			LimitType:   limit.LimitType,
+			WindowMode:  limit.WindowMode,
+			LimitMicros: limit.LimitMicros,
+			UsedMicros:  used,
+			ResetsAt:    s.windowResetTime(sub, limit, start, end, used),
+		}
+		result.ExhaustedWindows = append(result.ExhaustedWindows, window)
+		switch {
+		case window.ResetsAt == nil:
+			recoverable = false
+		case resetsAt == nil || window.ResetsAt.After(*resetsAt):
+			resetsAt = window.ResetsAt
+		}
 	}
 
+	if recoverable && resetsAt != nil && (sub.ExpiresAt == nil || resetsAt.Before(*sub.ExpiresAt)) {
+		result.ResetsAt = resetsAt
+	}
 	if minRemaining == math.MaxInt64 {
 		return 0
 	}
 	return minRemaining
 }
 
+// windowResetTime 已用尽窗口恢复可用的时间：固定窗口为窗口结束时间；
+// 滑动窗口为最早的扣费陆续移出窗口、用量回落到额度以下的时间；总量额度不会恢复
+func (s *BillingService) windowResetTime(sub *model.UserSubscription, limit model.SubscriptionPlanLimit, start, end time.Time, used int64) *time.Time {
+	if limit.LimitType == model.LimitTypeTotal {
+		return nil
+	}
+	if limit.WindowMode == model.WindowModeFixed {
+		return &end
+	}
+
+	events, err := s.eventRepo.ListSubscriptionEventsInWindow(sub.ID, start, end)
+	if err != nil {
+		return nil
+	}
+	length := end.Sub(start)
+	var expired int64
+	for _, e := range events {
+		if e.EventType == "refund" {
+			expired -= e.AmountMicros
+		} else {
+			expired += e.AmountMicros
+		}
+		if used-expired < limit.LimitMicros {
+			resetsAt := e.CreatedAt.Add(length).UTC()
+			return &resetsAt
+		}
+	}
+	return nil
+}
+
 func (s *BillingService) SettleRequestCost(requestLogID, userID string, costMicros int64) error {
 	if costMicros < 0 {
 		return fmt.Errorf("billing: invalid negative cost %d", costMicros)
@@ -143,6 +218,13 @@ func (s *BillingService) SettleRequestCost(requestLogID, userID string, costMicr
 		return s.markBillingStatus(requestLogID, "free", 0, 0)
 	}
 
+	// 影子模式只记录费用，不扣减余额/订阅额度
+	if IsBillingShadowMode() {
+		return s.markShadowBilled(requestLogID, userID, costMicros)
+	}
+
+	// 写库连接可能只有一个，事务开始前读取用户时区
+	loc := UserLocation(userID)
 	db := database.GetDB()
 
 	tx, err := db.Begin()
@@ -151,6 +233,16 @@ func (s *BillingService) SettleRequestCost(requestLogID, userID string, costMicr
 	}
 	defer tx.Rollback()
 
+	// 已结算过的请求不重复扣费（强制结束后请求仍可能正常完成）
+	var currentStatus string
+	err = tx.QueryRow(`SELECT billing_status FROM request_logs WHERE id = ?`, requestLogID).Scan(&currentStatus)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("billing: query billing status: %w", err)
+	}
+	if currentStatus != "" && currentStatus != "none" {
+		return nil
+	}
+
 	setting, err := s.queryBillingSetting(tx, userID)
 	if err != nil {
 		return fmt.Errorf("billing: query setting: %w", err)
@@ -163,7 +255,7 @@ func (s *BillingService) SettleRequestCost(requestLogID, userID string, costMicr
 
 	var subscriptionRemaining int64
 	if sub != nil {
-		subscriptionRemaining, err = s.calcSubscriptionRemainingTx(tx, sub)
+		subscriptionRemaining, err = s.calcSubscriptionRemainingTx(tx, sub, loc)
 		if err != nil {
 			return fmt.Errorf("billing: calc subscription remaining: %w", err)
 		}
@@ -326,7 +418,14 @@ func (s *BillingService) queryBalance(tx *sql.Tx, userID string) (int64, error)
 	return balance, err
 }
 
-func (s *BillingService) calcSubscriptionRemainingTx(tx *sql.Tx, sub *model.UserSubscription) (int64, error) {
+func (s *BillingService) calcSubscriptionRemainingTx(tx *sql.Tx, sub *model.UserSubscription, userLoc *time.Location) (int64, error) {
+	plan := &model.SubscriptionPlan{}
+	err := tx.QueryRow(`SELECT reset_timezone, reset_hour FROM subscription_plans WHERE id = ?`, sub.PlanID).Scan(&plan.ResetTimezone, &plan.ResetHour)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	boundary := PlanResetBoundary(plan, userLoc)
+
 	rows, err := tx.Query(
 		`SELECT id, plan_id, limit_type, window_mode, limit_micros, created_at, updated_at 
 		 FROM subscription_plan_limits WHERE plan_id = ? ORDER BY limit_type`,
@@ -357,7 +456,7 @@ func (s *BillingService) calcSubscriptionRemainingTx(tx *sql.Tx, sub *model.User
 	minRemaining := int64(math.MaxInt64)
 
 	for _, limit := range limits {
-		start, end, err := GetWindowBounds(limit.LimitType, limit.WindowMode, now, sub.StartsAt)
+		start, end, err := GetWindowBounds(limit.LimitType, limit.WindowMode, now, sub.StartsAt, boundary)
 		if err != nil {
 			return 0, err
 		}
@@ -409,3 +508,16 @@ func (s *BillingService) markBillingStatus(requestLogID, status string, subMicro
 	)
 	return err
 }
+
+// markShadowBilled 影子模式下将请求标记为 shadow，费用保留在 cost_micros 中，已结算过的请求不覆盖
+func (s *BillingService) markShadowBilled(requestLogID, userID string, costMicros int64) error {
+	db := database.GetDB()
+	if _, err := db.Exec(
+		`UPDATE request_logs SET charged_subscription_micros = 0, charged_balance_micros = 0, billing_status = 'shadow' WHERE id = ? AND billing_status = 'none'`,
+		requestLogID,
+	); err != nil {
+		return fmt.Errorf("billing: mark shadow: %w", err)
+	}
+	log.Debugf("billing: shadow request %s user %s cost=%d (not charged)", requestLogID, userID, costMicros)
+	return nil
+}
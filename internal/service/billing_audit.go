@@ -0,0 +1,550 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBillingAuditInterval     = 24 * 3600
+	defaultBillingAuditLookbackDays = 30
+	minBillingAuditInterval         = 600
+	maxBillingAuditLookbackDays     = 3650
+	// 单次报告最多保留的问题条数，超出部分仍计入 IssueCounts 并按需修复
+	maxBillingAuditIssues = 500
+)
+
+var ErrBillingAuditRunning = errors.New("计费一致性检查正在进行中")
+
+var billingAuditState struct {
+	mu         sync.RWMutex
+	config     model.BillingAuditConfig
+	lastReport *model.BillingAuditReport
+}
+
+// billingAuditRunMu 保证同一时间只有一次检查（定时任务与手动触发互斥）
+var billingAuditRunMu sync.Mutex
+
+func init() {
+	billingAuditState.config = DefaultBillingAuditConfig()
+}
+
+// DefaultBillingAuditConfig 默认每天检查一次，只报告不修复
+func DefaultBillingAuditConfig() model.BillingAuditConfig {
+	return model.BillingAuditConfig{
+		Enabled:      true,
+		IntervalSec:  defaultBillingAuditInterval,
+		LookbackDays: defaultBillingAuditLookbackDays,
+	}
+}
+
+// NormalizeBillingAuditConfig 填充未设置的字段
+func NormalizeBillingAuditConfig(cfg model.BillingAuditConfig) model.BillingAuditConfig {
+	if cfg.IntervalSec <= 0 {
+		cfg.IntervalSec = defaultBillingAuditInterval
+	}
+	if cfg.LookbackDays <= 0 {
+		cfg.LookbackDays = defaultBillingAuditLookbackDays
+	}
+	return cfg
+}
+
+// ValidateBillingAuditConfig 校验计费一致性检查配置（需先 Normalize）
+func ValidateBillingAuditConfig(cfg model.BillingAuditConfig) error {
+	if cfg.IntervalSec < minBillingAuditInterval {
+		return fmt.Errorf("intervalSec 不能小于 %d", minBillingAuditInterval)
+	}
+	if cfg.LookbackDays > maxBillingAuditLookbackDays {
+		return fmt.Errorf("lookbackDays 不能超过 %d", maxBillingAuditLookbackDays)
+	}
+	if cfg.OverdraftMicros < 0 {
+		return errors.New("overdraftMicros 不能为负数")
+	}
+	return nil
+}
+
+// InitBillingAuditConfig 启动时从持久化配置加载
+func InitBillingAuditConfig(configJSON string) {
+	var cfg model.BillingAuditConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("billing audit: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+	cfg = NormalizeBillingAuditConfig(cfg)
+	if err := ValidateBillingAuditConfig(cfg); err != nil {
+		log.Warnf("billing audit: 配置无效，使用默认配置: %v", err)
+		return
+	}
+	UpdateBillingAuditConfig(cfg)
+}
+
+// UpdateBillingAuditConfig 更新运行时配置，运行中的定时任务会重置检查间隔
+func UpdateBillingAuditConfig(cfg model.BillingAuditConfig) {
+	billingAuditState.mu.Lock()
+	billingAuditState.config = cfg
+	billingAuditState.mu.Unlock()
+
+	if globalBillingAuditor != nil {
+		globalBillingAuditor.notifyReload()
+	}
+}
+
+// GetBillingAuditConfig 获取当前计费一致性检查配置
+func GetBillingAuditConfig() model.BillingAuditConfig {
+	billingAuditState.mu.RLock()
+	defer billingAuditState.mu.RUnlock()
+	return billingAuditState.config
+}
+
+// GetLastBillingAuditReport 获取最近一次检查结果，尚未执行过时返回 nil
+func GetLastBillingAuditReport() *model.BillingAuditReport {
+	billingAuditState.mu.RLock()
+	defer billingAuditState.mu.RUnlock()
+	return billingAuditState.lastReport
+}
+
+// RunBillingAudit 核对计费不变量：
+//   - 每个请求的计费事件合计（charge - refund）等于 request_logs 上的已扣订阅/余额费用
+//   - 用户余额不低于 -OverdraftMicros
+//   - 有效订阅当前各窗口内，计费事件合计等于对应请求日志的订阅扣费合计，且不超过套餐额度
+//   - 订阅扣费事件关联的订阅属于同一用户
+//
+// repair 为 true 时以计费事件为准修正请求日志的已扣费用，并将超额透支的余额恢复到透支下限；
+// 订阅相关问题只报告不修复
+func RunBillingAudit(repair bool) (*model.BillingAuditReport, error) {
+	if !billingAuditRunMu.TryLock() {
+		return nil, ErrBillingAuditRunning
+	}
+	defer billingAuditRunMu.Unlock()
+
+	cfg := GetBillingAuditConfig()
+	a := &billingAudit{
+		cfg: cfg,
+		report: &model.BillingAuditReport{
+			StartedAt:   time.Now().UTC(),
+			Repair:      repair,
+			Issues:      []model.BillingAuditIssue{},
+			IssueCounts: map[string]int{},
+		},
+		repair: repair,
+	}
+
+	checks := []func() error{
+		a.checkRequestCharges,
+		a.checkBalances,
+		a.checkSubscriptionOwners,
+		a.checkSubscriptionWindows,
+	}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return nil, fmt.Errorf("billing audit: %w", err)
+		}
+	}
+
+	a.report.FinishedAt = time.Now().UTC()
+
+	billingAuditState.mu.Lock()
+	billingAuditState.lastReport = a.report
+	billingAuditState.mu.Unlock()
+
+	return a.report, nil
+}
+
+type billingAudit struct {
+	cfg    model.BillingAuditConfig
+	report *model.BillingAuditReport
+	repair bool
+}
+
+func (a *billingAudit) add(issue model.BillingAuditIssue) {
+	a.report.IssueCounts[issue.Type]++
+	if issue.Repaired {
+		a.report.RepairedCount++
+	}
+	if len(a.report.Issues) >= maxBillingAuditIssues {
+		a.report.Truncated = true
+		return
+	}
+	a.report.Issues = append(a.report.Issues, issue)
+}
+
+// checkRequestCharges 逐请求核对 request_logs 已扣费用与计费事件，仅检查 LookbackDays 内的请求
+func (a *billingAudit) checkRequestCharges() error {
+	since := time.Now().UTC().AddDate(0, 0, -a.cfg.LookbackDays)
+
+	rows, err := database.GetReadDB().Query(`
+		SELECT rl.id, rl.user_id, rl.charged_subscription_micros, rl.charged_balance_micros,
+			COALESCE(e.sub_sum, 0), COALESCE(e.bal_sum, 0)
+		FROM request_logs rl
+		LEFT JOIN (
+			SELECT request_log_id,
+				SUM(CASE WHEN source = 'subscription' AND event_type = 'charge' THEN amount_micros
+					WHEN source = 'subscription' AND event_type = 'refund' THEN -amount_micros ELSE 0 END) as sub_sum,
+				SUM(CASE WHEN source = 'balance' AND event_type = 'charge' THEN amount_micros
+					WHEN source = 'balance' AND event_type = 'refund' THEN -amount_micros ELSE 0 END) as bal_sum
+			FROM billing_events
+			WHERE request_log_id IS NOT NULL
+			GROUP BY request_log_id
+		) e ON e.request_log_id = rl.id
+		WHERE rl.created_at >= ?
+			AND (rl.charged_subscription_micros != COALESCE(e.sub_sum, 0) OR rl.charged_balance_micros != COALESCE(e.bal_sum, 0))
+		ORDER BY rl.created_at DESC
+	`, since)
+	if err != nil {
+		return fmt.Errorf("query request charges: %w", err)
+	}
+
+	type mismatch struct {
+		id, userID                   string
+		chargedSub, chargedBal       int64
+		expectedSub, expectedBalance int64
+	}
+	var mismatches []mismatch
+	for rows.Next() {
+		var m mismatch
+		if err := rows.Scan(&m.id, &m.userID, &m.chargedSub, &m.chargedBal, &m.expectedSub, &m.expectedBalance); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan request charges: %w", err)
+		}
+		mismatches = append(mismatches, m)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("query request charges: %w", err)
+	}
+	rows.Close()
+
+	for _, m := range mismatches {
+		repaired := false
+		if a.repair {
+			res, err := database.GetDB().Exec(
+				`UPDATE request_logs SET charged_subscription_micros = ?, charged_balance_micros = ?
+				 WHERE id = ? AND charged_subscription_micros = ? AND charged_balance_micros = ?`,
+				m.expectedSub, m.expectedBalance, m.id, m.chargedSub, m.chargedBal,
+			)
+			if err != nil {
+				return fmt.Errorf("repair request %s: %w", m.id, err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				repaired = true
+			}
+		}
+
+		id := m.id
+		if m.chargedSub != m.expectedSub {
+			a.add(model.BillingAuditIssue{
+				Type:         model.BillingAuditRequestChargeMismatch,
+				UserID:       m.userID,
+				RequestLogID: &id,
+				Source:       string(model.BillingSourceSubscription),
+				Expected:     m.expectedSub,
+				Actual:       m.chargedSub,
+				Repaired:     repaired,
+			})
+		}
+		if m.chargedBal != m.expectedBalance {
+			a.add(model.BillingAuditIssue{
+				Type:         model.BillingAuditRequestChargeMismatch,
+				UserID:       m.userID,
+				RequestLogID: &id,
+				Source:       string(model.BillingSourceBalance),
+				Expected:     m.expectedBalance,
+				Actual:       m.chargedBal,
+				Repaired:     repaired,
+			})
+		}
+	}
+	return nil
+}
+
+// checkBalances 检查余额低于透支下限的用户
+func (a *billingAudit) checkBalances() error {
+	floor := -a.cfg.OverdraftMicros
+
+	rows, err := database.GetReadDB().Query(
+		`SELECT id, balance_micros FROM users WHERE balance_micros < ? ORDER BY balance_micros ASC`, floor,
+	)
+	if err != nil {
+		return fmt.Errorf("query balances: %w", err)
+	}
+
+	type negative struct {
+		userID  string
+		balance int64
+	}
+	var negatives []negative
+	for rows.Next() {
+		var n negative
+		if err := rows.Scan(&n.userID, &n.balance); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan balances: %w", err)
+		}
+		negatives = append(negatives, n)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("query balances: %w", err)
+	}
+	rows.Close()
+
+	for _, n := range negatives {
+		repaired := false
+		if a.repair {
+			res, err := database.GetDB().Exec(
+				`UPDATE users SET balance_micros = ?, updated_at = ? WHERE id = ? AND balance_micros < ?`,
+				floor, time.Now().UTC(), n.userID, floor,
+			)
+			if err != nil {
+				return fmt.Errorf("repair balance %s: %w", n.userID, err)
+			}
+			if affected, _ := res.RowsAffected(); affected > 0 {
+				repaired = true
+			}
+		}
+		a.add(model.BillingAuditIssue{
+			Type:     model.BillingAuditNegativeBalance,
+			UserID:   n.userID,
+			Source:   string(model.BillingSourceBalance),
+			Expected: floor,
+			Actual:   n.balance,
+			Repaired: repaired,
+		})
+	}
+	return nil
+}
+
+// checkSubscriptionOwners 检查订阅扣费事件是否关联到同一用户的订阅
+func (a *billingAudit) checkSubscriptionOwners() error {
+	since := time.Now().UTC().AddDate(0, 0, -a.cfg.LookbackDays)
+
+	rows, err := database.GetReadDB().Query(`
+		SELECT e.user_id, e.request_log_id, e.user_subscription_id, e.amount_micros, us.user_id
+		FROM billing_events e
+		LEFT JOIN user_subscriptions us ON us.id = e.user_subscription_id
+		WHERE e.source = 'subscription' AND e.created_at >= ?
+			AND (e.user_subscription_id IS NULL OR us.user_id IS NULL OR us.user_id != e.user_id)
+	`, since)
+	if err != nil {
+		return fmt.Errorf("query subscription events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var requestLogID, subscriptionID, ownerID sql.NullString
+		var amount int64
+		if err := rows.Scan(&userID, &requestLogID, &subscriptionID, &amount, &ownerID); err != nil {
+			return fmt.Errorf("scan subscription events: %w", err)
+		}
+
+		issue := model.BillingAuditIssue{
+			Type:   model.BillingAuditSubscriptionOwnerMismatch,
+			UserID: userID,
+			Source: string(model.BillingSourceSubscription),
+			Actual: amount,
+		}
+		if requestLogID.Valid {
+			issue.RequestLogID = &requestLogID.String
+		}
+		switch {
+		case !subscriptionID.Valid:
+			issue.Detail = "订阅扣费事件未关联订阅"
+		case !ownerID.Valid:
+			issue.SubscriptionID = &subscriptionID.String
+			issue.Detail = "关联的订阅不存在"
+		default:
+			issue.SubscriptionID = &subscriptionID.String
+			issue.Detail = fmt.Sprintf("关联的订阅属于用户 %s", ownerID.String)
+		}
+		a.add(issue)
+	}
+	return rows.Err()
+}
+
+// checkSubscriptionWindows 按有效订阅的每个额度窗口核对扣费合计
+func (a *billingAudit) checkSubscriptionWindows() error {
+	db := database.GetReadDB()
+
+	rows, err := db.Query(`
+		SELECT us.id, us.user_id, us.starts_at, l.limit_type, l.window_mode, l.limit_micros, p.reset_timezone, p.reset_hour
+		FROM user_subscriptions us
+		JOIN subscription_plan_limits l ON l.plan_id = us.plan_id
+		JOIN subscription_plans p ON p.id = us.plan_id
+		WHERE us.status = 'active'
+		ORDER BY us.id, l.limit_type
+	`)
+	if err != nil {
+		return fmt.Errorf("query subscription limits: %w", err)
+	}
+
+	type window struct {
+		subscriptionID, userID string
+		startsAt               time.Time
+		limitType              model.LimitType
+		windowMode             model.WindowMode
+		limitMicros            int64
+		plan                   model.SubscriptionPlan
+	}
+	var windows []window
+	for rows.Next() {
+		var w window
+		if err := rows.Scan(&w.subscriptionID, &w.userID, &w.startsAt, &w.limitType, &w.windowMode, &w.limitMicros, &w.plan.ResetTimezone, &w.plan.ResetHour); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan subscription limits: %w", err)
+		}
+		windows = append(windows, w)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("query subscription limits: %w", err)
+	}
+	rows.Close()
+
+	now := time.Now().UTC()
+	// 窗口起点早于日志清理时间时，部分请求日志已被删除，只核对额度不核对合计
+	prunedBefore := RequestLogsPrunedBefore()
+	for _, w := range windows {
+		start, end, err := GetWindowBounds(w.limitType, w.windowMode, now, w.startsAt, PlanResetBoundary(&w.plan, UserLocation(w.userID)))
+		if err != nil {
+			continue
+		}
+
+		var eventSum, logSum int64
+		if err := db.QueryRow(`
+			SELECT
+				COALESCE(SUM(CASE WHEN event_type = 'charge' THEN amount_micros WHEN event_type = 'refund' THEN -amount_micros ELSE 0 END), 0)
+			FROM billing_events
+			WHERE user_subscription_id = ? AND source = 'subscription' AND created_at >= ? AND created_at < ?
+		`, w.subscriptionID, start, end).Scan(&eventSum); err != nil {
+			return fmt.Errorf("sum subscription events: %w", err)
+		}
+		if err := db.QueryRow(`
+			SELECT COALESCE(SUM(charged_subscription_micros), 0)
+			FROM request_logs
+			WHERE id IN (
+				SELECT request_log_id FROM billing_events
+				WHERE user_subscription_id = ? AND source = 'subscription' AND request_log_id IS NOT NULL
+					AND created_at >= ? AND created_at < ?
+			)
+		`, w.subscriptionID, start, end).Scan(&logSum); err != nil {
+			return fmt.Errorf("sum subscription request logs: %w", err)
+		}
+
+		subscriptionID := w.subscriptionID
+		windowDetail := fmt.Sprintf("%s/%s 窗口 %s ~ %s", w.limitType, w.windowMode,
+			start.Format(time.RFC3339), end.Format(time.RFC3339))
+		logsComplete := prunedBefore == nil || !start.Before(*prunedBefore)
+		if logsComplete && logSum != eventSum {
+			a.add(model.BillingAuditIssue{
+				Type:           model.BillingAuditSubscriptionWindowMismatch,
+				UserID:         w.userID,
+				SubscriptionID: &subscriptionID,
+				Source:         string(model.BillingSourceSubscription),
+				Expected:       eventSum,
+				Actual:         logSum,
+				Detail:         windowDetail,
+			})
+		}
+		if eventSum > w.limitMicros {
+			a.add(model.BillingAuditIssue{
+				Type:           model.BillingAuditSubscriptionWindowExceeded,
+				UserID:         w.userID,
+				SubscriptionID: &subscriptionID,
+				Source:         string(model.BillingSourceSubscription),
+				Expected:       w.limitMicros,
+				Actual:         eventSum,
+				Detail:         windowDetail,
+			})
+		}
+	}
+	return nil
+}
+
+// BillingAuditor 按配置的间隔定期执行计费一致性检查
+type BillingAuditor struct {
+	reloadChan chan struct{}
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+}
+
+var globalBillingAuditor *BillingAuditor
+
+// InitBillingAuditor 启动全局计费一致性检查任务，首次检查在一个间隔之后执行
+func InitBillingAuditor() {
+	globalBillingAuditor = &BillingAuditor{
+		reloadChan: make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+	}
+	globalBillingAuditor.wg.Add(1)
+	go globalBillingAuditor.run()
+	log.Info("billing audit: started")
+}
+
+// StopBillingAuditor 停止全局计费一致性检查任务
+func StopBillingAuditor() {
+	if globalBillingAuditor == nil {
+		return
+	}
+	globalBillingAuditor.stopOnce.Do(func() { close(globalBillingAuditor.stopChan) })
+	globalBillingAuditor.wg.Wait()
+	log.Info("billing audit: stopped")
+}
+
+func (b *BillingAuditor) notifyReload() {
+	select {
+	case b.reloadChan <- struct{}{}:
+	default:
+	}
+}
+
+func (b *BillingAuditor) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(time.Duration(GetBillingAuditConfig().IntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.audit()
+		case <-b.reloadChan:
+			ticker.Reset(time.Duration(GetBillingAuditConfig().IntervalSec) * time.Second)
+		case <-b.stopChan:
+			return
+		}
+	}
+}
+
+func (b *BillingAuditor) audit() {
+	cfg := GetBillingAuditConfig()
+	if !cfg.Enabled {
+		return
+	}
+
+	report, err := RunBillingAudit(cfg.AutoRepair)
+	if err != nil {
+		if !errors.Is(err, ErrBillingAuditRunning) {
+			log.Errorf("billing audit: %v", err)
+		}
+		return
+	}
+
+	total := 0
+	for _, n := range report.IssueCounts {
+		total += n
+	}
+	if total == 0 {
+		log.Debug("billing audit: no discrepancies found")
+		return
+	}
+	log.Warnf("billing audit: found %d discrepancies %v (repaired=%d)", total, report.IssueCounts, report.RepairedCount)
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+func withBillingAuditConfig(t *testing.T, cfg model.BillingAuditConfig) {
+	t.Helper()
+	prev := GetBillingAuditConfig()
+	UpdateBillingAuditConfig(cfg)
+	t.Cleanup(func() { UpdateBillingAuditConfig(prev) })
+}
+
+func insertAuditRequestLog(t *testing.T, id, userID string, createdAt time.Time, chargedSub, chargedBal int64) {
+	t.Helper()
+	_, err := database.GetDB().Exec(`
+		INSERT INTO request_logs (id, created_at, user_id, api_key_id, method, path, status_code, latency_ms,
+			charged_subscription_micros, charged_balance_micros, billing_status)
+		VALUES (?, ?, ?, 'key-1', 'POST', '/v1/messages', 200, 10, ?, ?, 'charged')`,
+		id, createdAt, userID, chargedSub, chargedBal,
+	)
+	if err != nil {
+		t.Fatalf("insert request log %s: %v", id, err)
+	}
+}
+
+func insertAuditEvent(t *testing.T, requestLogID, userID string, source model.BillingSource, eventType string, amount int64) {
+	t.Helper()
+	event := &model.BillingEvent{RequestLogID: &requestLogID, UserID: userID, Source: source, EventType: eventType, AmountMicros: amount}
+	if err := repository.NewBillingEventRepository().Create(event); err != nil {
+		t.Fatalf("insert event for %s: %v", requestLogID, err)
+	}
+}
+
+func requestCharges(t *testing.T, id string) (int64, int64) {
+	t.Helper()
+	var sub, bal int64
+	if err := database.GetDB().QueryRow(`SELECT charged_subscription_micros, charged_balance_micros FROM request_logs WHERE id = ?`, id).Scan(&sub, &bal); err != nil {
+		t.Fatalf("read request log %s: %v", id, err)
+	}
+	return sub, bal
+}
+
+// 修复只改写与计费事件不一致的请求日志和低于透支下限的余额，一致的记录、回溯范围外的请求与订阅问题保持原样
+func TestRunBillingAuditRepair(t *testing.T) {
+	setupTestDB(t)
+	withBillingAuditConfig(t, model.BillingAuditConfig{IntervalSec: defaultBillingAuditInterval, LookbackDays: 30, OverdraftMicros: 100})
+
+	alice := createTestUser(t, "alice", 1_000_000)
+	withinFloor := createTestUser(t, "bob", -50)
+	overdrawn := createTestUser(t, "carol", -500)
+	now := time.Now().UTC()
+
+	// 一致：余额扣费 300
+	insertAuditRequestLog(t, "req-ok", alice.ID, now, 0, 300)
+	insertAuditEvent(t, "req-ok", alice.ID, model.BillingSourceBalance, model.BillingEventCharge, 300)
+	// 退款事件未同步到请求日志：应为 500 - 200
+	insertAuditRequestLog(t, "req-refund", alice.ID, now, 0, 500)
+	insertAuditEvent(t, "req-refund", alice.ID, model.BillingSourceBalance, model.BillingEventCharge, 500)
+	insertAuditEvent(t, "req-refund", alice.ID, model.BillingSourceBalance, model.BillingEventRefund, 200)
+	// 请求日志有扣费但没有任何计费事件
+	insertAuditRequestLog(t, "req-missing", alice.ID, now, 0, 700)
+	// 仅订阅扣费不一致，且订阅事件未关联订阅（只报告不修复）
+	insertAuditRequestLog(t, "req-sub", alice.ID, now, 400, 100)
+	insertAuditEvent(t, "req-sub", alice.ID, model.BillingSourceSubscription, model.BillingEventCharge, 250)
+	insertAuditEvent(t, "req-sub", alice.ID, model.BillingSourceBalance, model.BillingEventCharge, 100)
+	// 超出回溯范围的不一致请求不检查
+	insertAuditRequestLog(t, "req-old", alice.ID, now.AddDate(0, 0, -40), 0, 900)
+
+	wantCounts := map[string]int{
+		model.BillingAuditRequestChargeMismatch:     3,
+		model.BillingAuditNegativeBalance:           1,
+		model.BillingAuditSubscriptionOwnerMismatch: 1,
+	}
+	assertCounts := func(report *model.BillingAuditReport, want map[string]int) {
+		t.Helper()
+		if len(report.IssueCounts) != len(want) {
+			t.Errorf("issue counts = %v, want %v", report.IssueCounts, want)
+		}
+		for typ, n := range want {
+			if report.IssueCounts[typ] != n {
+				t.Errorf("issue counts = %v, want %v", report.IssueCounts, want)
+				break
+			}
+		}
+	}
+
+	// 只报告时不改写任何记录
+	report, err := RunBillingAudit(false)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	assertCounts(report, wantCounts)
+	if report.RepairedCount != 0 {
+		t.Errorf("report-only repaired = %d", report.RepairedCount)
+	}
+	if _, bal := requestCharges(t, "req-missing"); bal != 700 {
+		t.Errorf("report-only rewrote req-missing balance charge to %d", bal)
+	}
+	if balance := userBalance(t, overdrawn.ID); balance != -500 {
+		t.Errorf("report-only rewrote balance to %d", balance)
+	}
+
+	report, err = RunBillingAudit(true)
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	assertCounts(report, wantCounts)
+	if report.RepairedCount != 4 {
+		t.Errorf("repaired = %d, want 4", report.RepairedCount)
+	}
+
+	type mismatch struct {
+		source           string
+		expected, actual int64
+	}
+	want := map[string]mismatch{
+		"req-refund":  {string(model.BillingSourceBalance), 300, 500},
+		"req-missing": {string(model.BillingSourceBalance), 0, 700},
+		"req-sub":     {string(model.BillingSourceSubscription), 250, 400},
+	}
+	for _, issue := range report.Issues {
+		switch issue.Type {
+		case model.BillingAuditRequestChargeMismatch:
+			w, ok := want[*issue.RequestLogID]
+			if !ok || issue.Source != w.source || issue.Expected != w.expected || issue.Actual != w.actual || !issue.Repaired {
+				t.Errorf("request issue = %+v", issue)
+			}
+			delete(want, *issue.RequestLogID)
+		case model.BillingAuditNegativeBalance:
+			if issue.UserID != overdrawn.ID || issue.Expected != -100 || issue.Actual != -500 || !issue.Repaired {
+				t.Errorf("balance issue = %+v", issue)
+			}
+		case model.BillingAuditSubscriptionOwnerMismatch:
+			if issue.RequestLogID == nil || *issue.RequestLogID != "req-sub" || issue.Repaired {
+				t.Errorf("owner issue = %+v", issue)
+			}
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("missing request issues: %v", want)
+	}
+
+	charges := []struct {
+		id       string
+		sub, bal int64
+	}{
+		{"req-ok", 0, 300},
+		{"req-refund", 0, 300},
+		{"req-missing", 0, 0},
+		{"req-sub", 250, 100},
+		{"req-old", 0, 900},
+	}
+	for _, c := range charges {
+		if sub, bal := requestCharges(t, c.id); sub != c.sub || bal != c.bal {
+			t.Errorf("%s charges = %d/%d, want %d/%d", c.id, sub, bal, c.sub, c.bal)
+		}
+	}
+	balances := map[string]int64{alice.ID: 1_000_000, withinFloor.ID: -50, overdrawn.ID: -100}
+	for id, want := range balances {
+		if balance := userBalance(t, id); balance != want {
+			t.Errorf("user %s balance = %d, want %d", id, balance, want)
+		}
+	}
+	if count, _ := repository.NewBillingEventRepository().CountByUserID(alice.ID); count != 5 {
+		t.Errorf("billing events = %d, repair must not add or remove events", count)
+	}
+
+	// 修复后再次检查只剩不可修复的订阅问题
+	report, err = RunBillingAudit(true)
+	if err != nil {
+		t.Fatalf("second repair: %v", err)
+	}
+	assertCounts(report, map[string]int{model.BillingAuditSubscriptionOwnerMismatch: 1})
+	if report.RepairedCount != 0 {
+		t.Errorf("second run repaired = %d", report.RepairedCount)
+	}
+}
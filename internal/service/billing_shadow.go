@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var billingShadowState struct {
+	mu     sync.RWMutex
+	config model.BillingShadowConfig
+}
+
+// InitBillingShadowConfig 启动时从持久化配置恢复影子模式状态
+func InitBillingShadowConfig(configJSON string) {
+	var cfg model.BillingShadowConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("billing shadow: 配置解析失败，保持关闭: %v", err)
+		return
+	}
+	if cfg.Enabled && cfg.StartedAt == nil {
+		now := time.Now().UTC()
+		cfg.StartedAt = &now
+	}
+	if !cfg.Enabled {
+		cfg.StartedAt = nil
+	}
+
+	billingShadowState.mu.Lock()
+	billingShadowState.config = cfg
+	billingShadowState.mu.Unlock()
+
+	if cfg.Enabled {
+		log.Infof("billing shadow: 计费影子模式已开启（自 %s 起），费用仅记录不扣除", cfg.StartedAt.Format(time.RFC3339))
+	}
+}
+
+// UpdateBillingShadowConfig 开启或关闭影子模式并返回生效后的配置。
+// 保持开启时沿用原开始时间，汇总区间不因重复保存而重置
+func UpdateBillingShadowConfig(enabled bool) model.BillingShadowConfig {
+	billingShadowState.mu.Lock()
+	defer billingShadowState.mu.Unlock()
+
+	cfg := billingShadowState.config
+	switch {
+	case enabled && !cfg.Enabled:
+		now := time.Now().UTC()
+		cfg.StartedAt = &now
+	case !enabled:
+		cfg.StartedAt = nil
+	}
+	cfg.Enabled = enabled
+	billingShadowState.config = cfg
+	return cfg
+}
+
+// GetBillingShadowConfig 获取当前影子模式配置
+func GetBillingShadowConfig() model.BillingShadowConfig {
+	billingShadowState.mu.RLock()
+	defer billingShadowState.mu.RUnlock()
+	return billingShadowState.config
+}
+
+// IsBillingShadowMode 影子模式开启时不扣费、不做额度拦截
+func IsBillingShadowMode() bool {
+	billingShadowState.mu.RLock()
+	defer billingShadowState.mu.RUnlock()
+	return billingShadowState.config.Enabled
+}
+
+// GetBillingShadowStatus 返回影子模式配置；开启时附带自开始以来按模型汇总的费用
+func GetBillingShadowStatus() (*model.BillingShadowStatus, error) {
+	cfg := GetBillingShadowConfig()
+	status := &model.BillingShadowStatus{
+		BillingShadowConfig: cfg,
+		Models:              []model.BillingShadowModelSummary{},
+		WouldChargeUsd:      "0.000000",
+	}
+	if !cfg.Enabled || cfg.StartedAt == nil {
+		return status, nil
+	}
+
+	summaries, err := repository.NewRequestLogRepository().GetBillingShadowSummary(*cfg.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("billing shadow: query summary: %w", err)
+	}
+	if summaries != nil {
+		status.Models = summaries
+	}
+	for _, s := range summaries {
+		status.WouldChargeMicros += s.CostMicrosSum
+	}
+	status.WouldChargeUsd = fmt.Sprintf("%.6f", float64(status.WouldChargeMicros)/1_000_000)
+	return status, nil
+}
@@ -4,19 +4,50 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"ampmanager/internal/health"
 	"ampmanager/internal/model"
 	"ampmanager/internal/repository"
+	"ampmanager/internal/secrets"
 )
 
 var (
 	ErrChannelNotFound = errors.New("渠道不存在")
+	ErrChannelConflict = errors.New("渠道已被其他管理员修改，请刷新后重试")
+	ErrChannelSecret   = errors.New("渠道密钥引用无法解析")
+	// ErrChannelBetaPolicy Anthropic-Beta 策略校验失败
+	ErrChannelBetaPolicy = errors.New("Anthropic-Beta 策略无效")
+	// ErrChannelHeaderPolicy 请求头策略校验失败
+	ErrChannelHeaderPolicy = errors.New("请求头策略无效")
+	// ErrChannelDNSPolicy DNS 策略校验失败
+	ErrChannelDNSPolicy = errors.New("DNS 策略无效")
+)
+
+var anthropicBetaPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+\*?$`)
+
+const maxAnthropicBetaPolicyItems = 64
+
+var headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+\*?$`)
+
+const (
+	maxHeaderPolicyItems     = 64
+	maxHeaderPolicyUserAgent = 512
+)
+
+const (
+	maxDNSPolicyStaticIPs     = 16
+	maxDNSPolicyFallbackDelay = 10000
+	maxDNSPolicyCacheTTL      = 24 * 60 * 60
 )
 
 // modelsCache 缓存 ModelsJSON -> []model.ChannelModel 的解析结果
@@ -75,6 +106,18 @@ func (s *ChannelService) getRRCounter(key string) *atomic.Uint64 {
 }
 
 func (s *ChannelService) Create(req *model.ChannelRequest) (*model.ChannelResponse, error) {
+	if err := validateChannelSecretRef(req.APIKey); err != nil {
+		return nil, err
+	}
+	apiKeysJSON, err := encodeChannelAPIKeys(req.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+	keyStrategy := req.KeyStrategy
+	if keyStrategy == "" {
+		keyStrategy = model.ChannelKeyStrategyRoundRobin
+	}
+
 	modelsJSON, _ := json.Marshal(req.Models)
 	if req.Models == nil {
 		modelsJSON = []byte("[]")
@@ -98,19 +141,53 @@ func (s *ChannelService) Create(req *model.ChannelRequest) (*model.ChannelRespon
 		endpoint = s.defaultEndpointForType(req.Type)
 	}
 
+	var betaPolicyJSON string
+	if req.AnthropicBetaPolicy != nil {
+		encoded, err := encodeAnthropicBetaPolicy(req.AnthropicBetaPolicy)
+		if err != nil {
+			return nil, err
+		}
+		betaPolicyJSON = encoded
+	}
+	var headerPolicyJSON string
+	if req.HeaderPolicy != nil {
+		encoded, err := encodeChannelHeaderPolicy(req.HeaderPolicy)
+		if err != nil {
+			return nil, err
+		}
+		headerPolicyJSON = encoded
+	}
+	var dnsPolicyJSON string
+	if req.DNSPolicy != nil {
+		encoded, err := encodeChannelDNSPolicy(req.DNSPolicy)
+		if err != nil {
+			return nil, err
+		}
+		dnsPolicyJSON = encoded
+	}
+
 	channel := &model.Channel{
-		Type:           req.Type,
-		Endpoint:       endpoint,
-		Name:           req.Name,
-		BaseURL:        strings.TrimSuffix(req.BaseURL, "/"),
-		APIKey:         req.APIKey,
-		Enabled:        req.Enabled,
-		Weight:         weight,
-		Priority:       priority,
-		ModelWhitelist: req.ModelWhitelist,
-		SimulateCLI:    req.SimulateCLI,
-		ModelsJSON:     string(modelsJSON),
-		HeadersJSON:    string(headersJSON),
+		Type:                    req.Type,
+		Endpoint:                endpoint,
+		Name:                    req.Name,
+		BaseURL:                 strings.TrimSuffix(req.BaseURL, "/"),
+		APIKey:                  req.APIKey,
+		APIKeysJSON:             apiKeysJSON,
+		KeyStrategy:             keyStrategy,
+		Enabled:                 req.Enabled,
+		Weight:                  weight,
+		Priority:                priority,
+		ModelWhitelist:          req.ModelWhitelist,
+		SimulateCLI:             req.SimulateCLI,
+		ModelsJSON:              string(modelsJSON),
+		HeadersJSON:             string(headersJSON),
+		AnthropicBetaPolicyJSON: betaPolicyJSON,
+		HeaderPolicyJSON:        headerPolicyJSON,
+		TranslationMode:         storedTranslationMode(req.TranslationMode),
+		DNSPolicyJSON:           dnsPolicyJSON,
+	}
+	if req.FederationIssuer != nil {
+		channel.FederationIssuer = strings.TrimSpace(*req.FederationIssuer)
 	}
 
 	if err := s.repo.Create(channel); err != nil {
@@ -125,13 +202,15 @@ func (s *ChannelService) Create(req *model.ChannelRequest) (*model.ChannelRespon
 }
 
 func (s *ChannelService) defaultEndpointForType(channelType model.ChannelType) model.ChannelEndpoint {
-	switch channelType {
+	switch channelType.Protocol() {
 	case model.ChannelTypeOpenAI:
 		return model.ChannelEndpointChatCompletions
 	case model.ChannelTypeClaude:
 		return model.ChannelEndpointMessages
 	case model.ChannelTypeGemini:
 		return model.ChannelEndpointGenerateContent
+	case model.ChannelTypeOllama:
+		return model.ChannelEndpointChat
 	default:
 		return model.ChannelEndpointChatCompletions
 	}
@@ -164,6 +243,9 @@ func (s *ChannelService) Update(id string, req *model.ChannelRequest) (*model.Ch
 	if existing == nil {
 		return nil, ErrChannelNotFound
 	}
+	if err := validateChannelSecretRef(req.APIKey); err != nil {
+		return nil, err
+	}
 
 	modelsJSON, _ := json.Marshal(req.Models)
 	if req.Models == nil {
@@ -199,12 +281,57 @@ func (s *ChannelService) Update(id string, req *model.ChannelRequest) (*model.Ch
 	existing.SimulateCLI = req.SimulateCLI
 	existing.ModelsJSON = string(modelsJSON)
 	existing.HeadersJSON = string(headersJSON)
+	// 未携带策略时保留原配置，避免旧客户端编辑渠道时重置策略
+	if req.AnthropicBetaPolicy != nil {
+		betaPolicyJSON, err := encodeAnthropicBetaPolicy(req.AnthropicBetaPolicy)
+		if err != nil {
+			return nil, err
+		}
+		existing.AnthropicBetaPolicyJSON = betaPolicyJSON
+	}
+	if req.HeaderPolicy != nil {
+		headerPolicyJSON, err := encodeChannelHeaderPolicy(req.HeaderPolicy)
+		if err != nil {
+			return nil, err
+		}
+		existing.HeaderPolicyJSON = headerPolicyJSON
+	}
+	if req.DNSPolicy != nil {
+		dnsPolicyJSON, err := encodeChannelDNSPolicy(req.DNSPolicy)
+		if err != nil {
+			return nil, err
+		}
+		existing.DNSPolicyJSON = dnsPolicyJSON
+	}
 
 	if req.APIKey != "" {
 		existing.APIKey = req.APIKey
 	}
+	if req.APIKeys != nil {
+		apiKeysJSON, err := encodeChannelAPIKeys(req.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		existing.APIKeysJSON = apiKeysJSON
+	}
+	if req.KeyStrategy != "" {
+		existing.KeyStrategy = req.KeyStrategy
+	}
+	if req.TranslationMode != "" {
+		existing.TranslationMode = storedTranslationMode(req.TranslationMode)
+	}
+	if req.FederationIssuer != nil {
+		existing.FederationIssuer = strings.TrimSpace(*req.FederationIssuer)
+	}
+	// 客户端携带版本号时以客户端读取的版本为准，否则只保护本次读取到写入之间的窗口
+	if req.Version != 0 {
+		existing.Version = req.Version
+	}
 
 	if err := s.repo.Update(existing); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return nil, ErrChannelConflict
+		}
 		return nil, err
 	}
 
@@ -235,7 +362,9 @@ func (s *ChannelService) SetEnabled(id string, enabled bool) error {
 	return s.repo.SetEnabled(id, enabled)
 }
 
-func (s *ChannelService) TestConnection(id string) (*model.TestChannelResponse, error) {
+// TestConnection 请求渠道的模型列表接口，再用一个模型发送简短的对话请求，
+// 报告延迟、状态码、上游模型列表及其他客户端格式经该渠道转发时的翻译问题
+func (s *ChannelService) TestConnection(id string, req *model.TestChannelRequest) (*model.TestChannelResponse, error) {
 	channel, err := s.repo.GetByID(id)
 	if err != nil {
 		return nil, err
@@ -244,16 +373,85 @@ func (s *ChannelService) TestConnection(id string) (*model.TestChannelResponse,
 		return nil, ErrChannelNotFound
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	result, reachable := probeChannel(channel, 10*time.Second)
+	// 手动测试结果同样计入健康状态，测试通过可立即解除熔断
+	if channel.Enabled {
+		health.RecordProbe(channel.ID, reachable, result.LatencyMs, result.Message)
+	}
+	if !reachable {
+		return result, nil
+	}
+
+	modelName := s.testModelName(channel, req.Model, result.Models)
+	if modelName == "" {
+		result.Completion = &model.ChannelCompletionTest{Message: "未找到可用于测试的模型，请指定 model"}
+		return result, nil
+	}
+	// probeChannel 已解析出本次使用的密钥
+	result.Completion = testChannelCompletion(channel, channel.APIKey, modelName, req.Prompt, 30*time.Second)
+	if !result.Completion.Success {
+		result.Success = false
+		result.Message = "模型列表可访问，但对话请求失败"
+	}
+	return result, nil
+}
+
+// ProbeChannelHealth 探测渠道连通性并记录健康状态，供后台健康检查调用
+func (s *ChannelService) ProbeChannelHealth(channel *model.Channel, timeout time.Duration) {
+	copied := *channel
+	result, reachable := probeChannel(&copied, timeout)
+	health.RecordProbe(channel.ID, reachable, result.LatencyMs, result.Message)
+}
+
+// ListEnabledInternal 列出启用的渠道（含密钥，仅供内部使用）
+func (s *ChannelService) ListEnabledInternal() ([]*model.Channel, error) {
+	return s.repo.ListEnabled()
+}
+
+// probeChannel 请求渠道的模型列表接口。reachable 表示上游可达且认证有效：
+// 连接失败、5xx 与 401/403 视为不可达，其余状态码（如不支持模型列表的 404/501）仍视为可达
+func probeChannel(channel *model.Channel, timeout time.Duration) (*model.TestChannelResponse, bool) {
+	if _, err := resolveChannelKey(channel); err != nil {
+		return &model.TestChannelResponse{
+			Success: false,
+			Message: err.Error(),
+		}, false
+	}
+
+	result, statusCode := probeChannelKey(channel, channel.APIKey, timeout)
+	if statusCode == 0 || isAuthFailureStatus(statusCode) {
+		return result, false
+	}
+	return result, statusCode < 500 || statusCode == http.StatusNotImplemented
+}
+
+// isAuthFailureStatus 上游以 401/403 拒绝了密钥
+func isAuthFailureStatus(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
+
+// setOllamaAuth Ollama 默认不需要认证，配置了 API Key（如前置反向代理鉴权）时以 Bearer 发送
+func setOllamaAuth(req *http.Request, key string) {
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+}
+
+// probeChannelKey 使用指定密钥（已解析的明文）请求渠道的模型列表接口，
+// 返回测试结果与上游状态码，请求未发出或连接失败时状态码为 0
+func probeChannelKey(channel *model.Channel, apiKey string, timeout time.Duration) (*model.TestChannelResponse, int) {
+	client := &http.Client{Timeout: timeout}
 	var testURL string
 
-	switch channel.Type {
+	switch channel.Type.Protocol() {
 	case model.ChannelTypeOpenAI:
 		testURL = channel.BaseURL + "/v1/models"
 	case model.ChannelTypeClaude:
 		testURL = channel.BaseURL + "/v1/models"
 	case model.ChannelTypeGemini:
 		testURL = channel.BaseURL + "/v1beta/models"
+	case model.ChannelTypeOllama:
+		testURL = channel.BaseURL + "/api/tags"
 	default:
 		testURL = channel.BaseURL
 	}
@@ -263,20 +461,21 @@ func (s *ChannelService) TestConnection(id string) (*model.TestChannelResponse,
 		return &model.TestChannelResponse{
 			Success: false,
 			Message: fmt.Sprintf("创建请求失败: %v", err),
-		}, nil
+		}, 0
 	}
 
-	switch channel.Type {
+	switch channel.Type.Protocol() {
 	case model.ChannelTypeOpenAI:
-		req.Header.Set("Authorization", "Bearer "+channel.APIKey)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
 	case model.ChannelTypeClaude:
-		req.Header.Set("x-api-key", channel.APIKey)
-		req.Header.Set("anthropic-version", "2023-06-01")
+		setAnthropicAuth(req, channel.Type, apiKey)
 	case model.ChannelTypeGemini:
 		q := req.URL.Query()
-		q.Set("key", channel.APIKey)
+		q.Set("key", apiKey)
 		req.URL.RawQuery = q.Encode()
-		req.Header.Set("x-goog-api-key", channel.APIKey)
+		req.Header.Set("x-goog-api-key", apiKey)
+	case model.ChannelTypeOllama:
+		setOllamaAuth(req, apiKey)
 	}
 
 	start := time.Now()
@@ -288,31 +487,75 @@ func (s *ChannelService) TestConnection(id string) (*model.TestChannelResponse,
 			Success:   false,
 			Message:   fmt.Sprintf("连接失败: %v", err),
 			LatencyMs: latency,
-		}, nil
+		}, 0
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return &model.TestChannelResponse{
+		result := &model.TestChannelResponse{
 			Success:   true,
 			Message:   fmt.Sprintf("连接成功 (HTTP %d)", resp.StatusCode),
 			LatencyMs: latency,
-		}, nil
+		}
+		if body, err := io.ReadAll(io.LimitReader(resp.Body, maxChannelProbeBodyBytes)); err == nil {
+			if models, err := parseModelsResponse(channel.Type, body); err == nil {
+				for _, m := range models {
+					result.Models = append(result.Models, m.ID)
+				}
+			}
+		}
+		return result, resp.StatusCode
 	}
 
-	if resp.StatusCode == 401 || resp.StatusCode == 403 {
+	if isAuthFailureStatus(resp.StatusCode) {
 		return &model.TestChannelResponse{
 			Success:   false,
 			Message:   fmt.Sprintf("认证失败 (HTTP %d)", resp.StatusCode),
 			LatencyMs: latency,
-		}, nil
+		}, resp.StatusCode
 	}
 
 	return &model.TestChannelResponse{
 		Success:   false,
 		Message:   fmt.Sprintf("请求失败: HTTP %d", resp.StatusCode),
 		LatencyMs: latency,
-	}, nil
+	}, resp.StatusCode
+}
+
+// CheckChannelKeys 逐个检查渠道密钥池中的密钥能否通过上游认证并记录结果。
+// 认证失败的密钥在下一次检查前暂停使用；返回检查后的状态，以及本轮是否新发现失效密钥
+func (s *ChannelService) CheckChannelKeys(channel *model.Channel, timeout time.Duration) (model.ChannelAuthStatus, bool) {
+	if channel.Type == model.ChannelTypeClaudeOAuth {
+		return checkChannelOAuth(channel, timeout)
+	}
+	keys := channelKeyPool(channel)
+	results := make([]health.KeyCheckResult, 0, len(keys))
+	cooldown := time.Duration(health.GetKeyCheckConfig().IntervalSec) * time.Second
+	for _, ref := range keys {
+		keyID := health.KeyFingerprint(ref)
+		key, err := secrets.Resolve(ref)
+		if err != nil {
+			results = append(results, health.KeyCheckResult{KeyID: keyID, Conclusive: true, Error: err.Error()})
+			continue
+		}
+		result, statusCode := probeChannelKey(channel, key, timeout)
+		switch {
+		case isAuthFailureStatus(statusCode):
+			results = append(results, health.KeyCheckResult{KeyID: keyID, Conclusive: true, Error: result.Message})
+			if len(keys) > 1 {
+				health.CooldownKey(channel.ID, keyID, cooldown, result.Message)
+			}
+		case statusCode >= 200 && statusCode < 300:
+			results = append(results, health.KeyCheckResult{KeyID: keyID, Valid: true, Conclusive: true})
+		default:
+			// 连接失败、限流或 5xx 无法判断密钥是否有效
+			results = append(results, health.KeyCheckResult{KeyID: keyID, Error: result.Message})
+		}
+	}
+
+	status, newlyInvalid := health.RecordKeyCheck(channel.ID, len(keys), results)
+	status.ChannelName = channel.Name
+	return status, newlyInvalid
 }
 
 func (s *ChannelService) SelectChannelForModel(modelName string) (*model.Channel, error) {
@@ -328,45 +571,19 @@ func (s *ChannelService) SelectChannelForModel(modelName string) (*model.Channel
 		}
 	}
 
-	if len(candidates) == 0 {
-		return nil, nil
-	}
-
-	if len(candidates) == 1 {
-		return candidates[0], nil
-	}
-
-	minPriority := candidates[0].Priority
-	for _, c := range candidates {
-		if c.Priority < minPriority {
-			minPriority = c.Priority
-		}
-	}
-
-	var priorityCandidates []*model.Channel
-	for _, c := range candidates {
-		if c.Priority == minPriority {
-			priorityCandidates = append(priorityCandidates, c)
-		}
-	}
-
-	// 按 ID 排序确保稳定顺序
-	sort.Slice(priorityCandidates, func(i, j int) bool {
-		return priorityCandidates[i].ID < priorityCandidates[j].ID
-	})
-
-	// 使用原子计数器实现线程安全的 round-robin
-	counter := s.getRRCounter(modelName)
-	idx := int(counter.Add(1) - 1)
-	selected := priorityCandidates[idx%len(priorityCandidates)]
-
-	return selected, nil
+	return s.pickChannel(modelName, candidates)
 }
 
 // SelectChannelForModelWithGroups 根据分组过滤选择渠道
 // 无分组用户: 只能使用未关联分组的渠道
 // 有分组用户: 可以使用其分组渠道 + 未关联分组的渠道
 func (s *ChannelService) SelectChannelForModelWithGroups(modelName string, groupIDs []string) (*model.Channel, error) {
+	return s.SelectFailoverChannel(modelName, groupIDs, nil)
+}
+
+// SelectFailoverChannel 与 SelectChannelForModelWithGroups 相同，但跳过 skip 返回 true 的渠道，
+// 用于故障转移时排除已尝试过的渠道
+func (s *ChannelService) SelectFailoverChannel(modelName string, groupIDs []string, skip func(*model.Channel) bool) (*model.Channel, error) {
 	channels, err := s.repo.ListEnabled()
 	if err != nil {
 		return nil, err
@@ -375,6 +592,9 @@ func (s *ChannelService) SelectChannelForModelWithGroups(modelName string, group
 	// Collect IDs of model-matching channels for batch group lookup
 	var matchingChannels []*model.Channel
 	for _, ch := range channels {
+		if skip != nil && skip(ch) {
+			continue
+		}
 		if s.channelMatchesModel(ch, modelName) {
 			matchingChannels = append(matchingChannels, ch)
 		}
@@ -384,18 +604,22 @@ func (s *ChannelService) SelectChannelForModelWithGroups(modelName string, group
 		return nil, nil
 	}
 
+	return s.pickChannel(modelName, s.filterChannelsByGroups(matchingChannels, groupIDs))
+}
+
+// filterChannelsByGroups 保留用户可访问的渠道：未绑定分组的渠道对所有用户开放，否则需与用户分组有交集
+func (s *ChannelService) filterChannelsByGroups(channels []*model.Channel, groupIDs []string) []*model.Channel {
 	// Batch fetch group mappings
-	matchingIDs := make([]string, len(matchingChannels))
-	for i, ch := range matchingChannels {
-		matchingIDs[i] = ch.ID
+	ids := make([]string, len(channels))
+	for i, ch := range channels {
+		ids[i] = ch.ID
 	}
-	channelGroupMap, batchErr := s.repo.GetGroupIDsByChannelIDs(matchingIDs)
+	channelGroupMap, batchErr := s.repo.GetGroupIDsByChannelIDs(ids)
 	fallbackToSingleLookup := batchErr != nil
 	userGroupIDSet := toStringSet(groupIDs)
 
-	// Filter by group access
 	var candidates []*model.Channel
-	for _, ch := range matchingChannels {
+	for _, ch := range channels {
 		chGroupIDs := channelGroupMap[ch.ID]
 		if fallbackToSingleLookup {
 			var singleLookupErr error
@@ -410,13 +634,74 @@ func (s *ChannelService) SelectChannelForModelWithGroups(modelName string, group
 			candidates = append(candidates, ch)
 		}
 	}
+	return candidates
+}
+
+// ListAccessibleModels 汇总用户分组可访问的启用渠道能够承接的模型：渠道配置的模型（有别名时为别名，通配条目除外）
+// 与从上游获取的模型列表中渠道承接的模型；同名模型只保留优先级最高的渠道
+func (s *ChannelService) ListAccessibleModels(groupIDs []string) ([]model.AccessibleModel, error) {
+	channels, err := s.repo.ListEnabled()
+	if err != nil {
+		return nil, err
+	}
+	channels = s.filterChannelsByGroups(channels, groupIDs)
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].Priority < channels[j].Priority
+	})
 
+	channelModelRepo := repository.NewChannelModelRepository()
+	seen := make(map[string]bool)
+	var result []model.AccessibleModel
+	add := func(ch *model.Channel, id, displayName string) {
+		key := strings.ToLower(id)
+		if id == "" || strings.Contains(id, "*") || seen[key] {
+			return
+		}
+		_, entry, ok := s.matchChannelModel(ch, id)
+		if !ok {
+			return
+		}
+		upstream := id
+		if entry != nil && !strings.Contains(entry.Name, "*") {
+			upstream = entry.Name
+		}
+		seen[key] = true
+		result = append(result, model.AccessibleModel{ID: id, DisplayName: displayName, ChannelType: ch.Type, Upstream: upstream})
+	}
+
+	for _, ch := range channels {
+		models, _ := getParsedModels(ch.ModelsJSON)
+		for _, m := range models {
+			if m.Alias != "" {
+				add(ch, m.Alias, "")
+			} else {
+				add(ch, m.Name, "")
+			}
+		}
+		// 获取失败时只使用渠道配置的模型
+		fetched, err := channelModelRepo.GetByChannelID(ch.ID)
+		if err != nil {
+			continue
+		}
+		for _, m := range fetched {
+			if m.RemovedAt != nil {
+				continue
+			}
+			add(ch, m.ModelID, m.DisplayName)
+		}
+	}
+	return result, nil
+}
+
+// pickChannel 在候选渠道中跳过熔断渠道，取最高优先级（数值最小）的渠道并按模型加权轮询
+func (s *ChannelService) pickChannel(modelName string, candidates []*model.Channel) (*model.Channel, error) {
 	if len(candidates) == 0 {
 		return nil, nil
 	}
 
+	candidates = filterHealthyChannels(candidates)
 	if len(candidates) == 1 {
-		return candidates[0], nil
+		return resolveChannelKey(candidates[0])
 	}
 
 	minPriority := candidates[0].Priority
@@ -433,15 +718,203 @@ func (s *ChannelService) SelectChannelForModelWithGroups(modelName string, group
 		}
 	}
 
+	// 按 ID 排序确保稳定顺序
 	sort.Slice(priorityCandidates, func(i, j int) bool {
 		return priorityCandidates[i].ID < priorityCandidates[j].ID
 	})
 
+	weights := s.normalizedModelWeights(modelName, priorityCandidates)
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+
+	// 使用原子计数器实现线程安全的加权 round-robin：每轮 total 个请求中渠道 i 分得 weights[i] 个
 	counter := s.getRRCounter(modelName)
-	idx := int(counter.Add(1) - 1)
-	selected := priorityCandidates[idx%len(priorityCandidates)]
+	slot := int((counter.Add(1) - 1) % uint64(total))
+	selected := priorityCandidates[len(priorityCandidates)-1]
+	for i, w := range weights {
+		if slot < w {
+			selected = priorityCandidates[i]
+			break
+		}
+		slot -= w
+	}
 
-	return selected, nil
+	return resolveChannelKey(selected)
+}
+
+// normalizedModelWeights 返回各渠道承接该模型的权重并除以最大公约数，权重相同时退化为逐个轮询
+func (s *ChannelService) normalizedModelWeights(modelName string, channels []*model.Channel) []int {
+	weights := make([]int, len(channels))
+	divisor := 0
+	for i, ch := range channels {
+		weights[i] = s.channelModelWeight(ch, modelName)
+		divisor = gcd(divisor, weights[i])
+	}
+	for i := range weights {
+		weights[i] /= divisor
+	}
+	return weights
+}
+
+// channelModelWeight 渠道承接该模型时的权重：命中的模型条目设置了权重时优先使用，否则取渠道权重
+func (s *ChannelService) channelModelWeight(channel *model.Channel, modelName string) int {
+	if _, entry, ok := s.matchChannelModel(channel, modelName); ok && entry != nil && entry.Weight > 0 {
+		return entry.Weight
+	}
+	if channel.Weight > 0 {
+		return channel.Weight
+	}
+	return 1
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// filterHealthyChannels 跳过已熔断或密钥全部失效的渠道；全部被跳过时仍返回原候选，避免探测误判导致模型完全不可用
+func filterHealthyChannels(candidates []*model.Channel) []*model.Channel {
+	healthy := make([]*model.Channel, 0, len(candidates))
+	for _, ch := range candidates {
+		if health.IsHealthy(ch.ID) && !health.IsAuthFailed(ch.ID) {
+			healthy = append(healthy, ch)
+		}
+	}
+	if len(healthy) == 0 {
+		return candidates
+	}
+	return healthy
+}
+
+// validateChannelSecretRef 保存前确认密钥引用可解析，避免配置错误到请求时才暴露
+func validateChannelSecretRef(apiKey string) error {
+	if !secrets.IsReference(apiKey) {
+		return nil
+	}
+	if _, err := secrets.Resolve(apiKey); err != nil {
+		return fmt.Errorf("%w: %v", ErrChannelSecret, err)
+	}
+	return nil
+}
+
+// resolveChannelKey 从密钥池中选择本次使用的密钥，并将密钥引用替换为外部密钥存储中的当前值；
+// claude_oauth 渠道使用当前的 OAuth 访问令牌
+func resolveChannelKey(channel *model.Channel) (*model.Channel, error) {
+	if channel.Type == model.ChannelTypeClaudeOAuth {
+		token, err := channelOAuthAccessToken(channel.ID)
+		if err != nil {
+			return nil, fmt.Errorf("渠道 %s: %w", channel.Name, err)
+		}
+		channel.APIKey = token
+		channel.KeyID = ""
+		return channel, nil
+	}
+	if keys := channelKeyPool(channel); len(keys) > 1 {
+		ids := make([]string, len(keys))
+		for i, key := range keys {
+			ids[i] = health.KeyFingerprint(key)
+		}
+		idx := health.SelectKey(channel.ID, ids, channel.KeyStrategy == model.ChannelKeyStrategyLRU)
+		channel.APIKey = keys[idx]
+		channel.KeyID = ids[idx]
+	}
+	key, err := secrets.Resolve(channel.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("渠道 %s: %w", channel.Name, err)
+	}
+	channel.APIKey = key
+	return channel, nil
+}
+
+// channelKeyPool 渠道的密钥池：APIKey 在前，随后为额外密钥，忽略空值与重复值
+func channelKeyPool(channel *model.Channel) []string {
+	extra := channelExtraAPIKeys(channel)
+	keys := make([]string, 0, len(extra)+1)
+	seen := make(map[string]struct{}, len(extra)+1)
+	for _, key := range append([]string{channel.APIKey}, extra...) {
+		if key == "" {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// channelExtraAPIKeys 解码渠道的额外密钥列表
+func channelExtraAPIKeys(channel *model.Channel) []string {
+	var keys []string
+	if channel.APIKeysJSON != "" {
+		_ = json.Unmarshal([]byte(channel.APIKeysJSON), &keys)
+	}
+	return keys
+}
+
+// encodeChannelAPIKeys 校验并编码额外密钥列表
+func encodeChannelAPIKeys(keys []string) (string, error) {
+	cleaned := make([]string, 0, len(keys))
+	for _, raw := range keys {
+		key := strings.TrimSpace(raw)
+		if key == "" {
+			continue
+		}
+		if err := validateChannelSecretRef(key); err != nil {
+			return "", err
+		}
+		cleaned = append(cleaned, key)
+	}
+	encoded, err := json.Marshal(cleaned)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// storedTranslationMode 沿用全局配置时不落库
+func storedTranslationMode(mode string) string {
+	if mode == model.ChannelTranslationModeInherit {
+		return ""
+	}
+	return mode
+}
+
+// channelTranslationMode 渠道的跨格式翻译模式，未设置时为 inherit
+func channelTranslationMode(channel *model.Channel) string {
+	if channel.TranslationMode == "" {
+		return model.ChannelTranslationModeInherit
+	}
+	return channel.TranslationMode
+}
+
+// channelKeyStrategy 渠道的密钥池选择策略，未设置时为轮询
+func channelKeyStrategy(channel *model.Channel) string {
+	if channel.KeyStrategy == "" {
+		return model.ChannelKeyStrategyRoundRobin
+	}
+	return channel.KeyStrategy
+}
+
+// channelKeyStatuses 密钥池有多个密钥时返回各密钥的状态
+func channelKeyStatuses(channel *model.Channel) []model.ChannelKeyStatus {
+	keys := channelKeyPool(channel)
+	if len(keys) <= 1 {
+		return nil
+	}
+	statuses := make([]model.ChannelKeyStatus, len(keys))
+	for i, key := range keys {
+		statuses[i] = health.KeyStatus(channel.ID, health.KeyFingerprint(key))
+		statuses[i].Ref = channelKeyRef(key)
+		statuses[i].Masked = maskChannelKey(key)
+		statuses[i].Primary = key == channel.APIKey
+	}
+	return statuses
 }
 
 func toStringSet(values []string) map[string]struct{} {
@@ -462,34 +935,56 @@ func hasAnyInSet(set map[string]struct{}, values []string) bool {
 }
 
 func (s *ChannelService) channelMatchesModel(channel *model.Channel, modelName string) bool {
+	_, _, ok := s.describeModelMatch(channel, modelName)
+	return ok
+}
+
+// describeModelMatch 判断渠道是否承接该模型，并返回匹配方式（name/alias/wildcard/default）和命中的条目
+func (s *ChannelService) describeModelMatch(channel *model.Channel, modelName string) (string, string, bool) {
+	kind, entry, ok := s.matchChannelModel(channel, modelName)
+	if !ok || entry == nil {
+		return kind, "", ok
+	}
+	if kind == "alias" {
+		return kind, entry.Alias, true
+	}
+	return kind, entry.Name, true
+}
+
+// matchChannelModel 判断渠道是否承接该模型，返回匹配方式和命中的模型条目（default 匹配时条目为空）
+func (s *ChannelService) matchChannelModel(channel *model.Channel, modelName string) (string, *model.ChannelModel, bool) {
 	models, valid := getParsedModels(channel.ModelsJSON)
 	if !valid {
-		return false
+		return "", nil, false
 	}
 
 	if len(models) == 0 {
-		return s.defaultModelMatch(channel.Type, modelName)
+		return "default", nil, s.defaultModelMatch(channel.Type, modelName)
 	}
 
 	modelLower := strings.ToLower(modelName)
-	for _, m := range models {
-		if strings.EqualFold(m.Name, modelName) || strings.EqualFold(m.Alias, modelName) {
-			return true
+	for i := range models {
+		m := &models[i]
+		if strings.EqualFold(m.Name, modelName) {
+			return "name", m, true
+		}
+		if strings.EqualFold(m.Alias, modelName) {
+			return "alias", m, true
 		}
 		nameLower := strings.ToLower(m.Name)
 		if strings.Contains(nameLower, "*") {
 			if s.wildcardMatch(nameLower, modelLower) {
-				return true
+				return "wildcard", m, true
 			}
 		}
 	}
 
-	return false
+	return "", nil, false
 }
 
 func (s *ChannelService) defaultModelMatch(channelType model.ChannelType, modelName string) bool {
 	modelLower := strings.ToLower(modelName)
-	switch channelType {
+	switch channelType.Protocol() {
 	case model.ChannelTypeGemini:
 		return strings.HasPrefix(modelLower, "gemini")
 	case model.ChannelTypeClaude:
@@ -582,6 +1077,257 @@ func (s *ChannelService) toResponsesBatch(channels []*model.Channel) ([]*model.C
 	return responses, nil
 }
 
+// ChannelAnthropicBetaPolicy 返回渠道生效的 Anthropic-Beta 策略，未配置或无法解析时为默认策略
+func ChannelAnthropicBetaPolicy(channel *model.Channel) model.AnthropicBetaPolicy {
+	policy := model.AnthropicBetaPolicy{Mode: model.AnthropicBetaModeDeny, Betas: model.DefaultAnthropicBetaDeny}
+	if channel == nil || channel.AnthropicBetaPolicyJSON == "" {
+		return policy
+	}
+	var configured model.AnthropicBetaPolicy
+	if err := json.Unmarshal([]byte(channel.AnthropicBetaPolicyJSON), &configured); err != nil {
+		return policy
+	}
+	if configured.Mode == "" {
+		configured.Mode = model.AnthropicBetaModeDeny
+	}
+	if configured.Betas == nil {
+		configured.Betas = []string{}
+	}
+	return configured
+}
+
+// encodeAnthropicBetaPolicy 校验并序列化 Anthropic-Beta 策略，beta 名称去重保序
+func encodeAnthropicBetaPolicy(policy *model.AnthropicBetaPolicy) (string, error) {
+	mode := policy.Mode
+	if mode == "" {
+		mode = model.AnthropicBetaModeDeny
+	}
+	if mode != model.AnthropicBetaModeDeny && mode != model.AnthropicBetaModeAllow {
+		return "", fmt.Errorf("%w: mode 只能为 deny 或 allow", ErrChannelBetaPolicy)
+	}
+	if len(policy.Betas) > maxAnthropicBetaPolicyItems {
+		return "", fmt.Errorf("%w: 最多 %d 项", ErrChannelBetaPolicy, maxAnthropicBetaPolicyItems)
+	}
+
+	betas := make([]string, 0, len(policy.Betas))
+	seen := make(map[string]struct{}, len(policy.Betas))
+	for _, b := range policy.Betas {
+		b = strings.TrimSpace(b)
+		if b == "" {
+			continue
+		}
+		if !anthropicBetaPattern.MatchString(b) {
+			return "", fmt.Errorf("%w: 无效的 beta 名称 %q", ErrChannelBetaPolicy, b)
+		}
+		if _, ok := seen[b]; ok {
+			continue
+		}
+		seen[b] = struct{}{}
+		betas = append(betas, b)
+	}
+
+	data, err := json.Marshal(model.AnthropicBetaPolicy{Mode: mode, Betas: betas})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ChannelHeaderPolicy 返回渠道的请求头策略，未配置或无法解析时为空策略（不改动请求头）
+func ChannelHeaderPolicy(channel *model.Channel) model.ChannelHeaderPolicy {
+	policy := model.ChannelHeaderPolicy{Passthrough: []string{}, Remove: []string{}}
+	if channel == nil || channel.HeaderPolicyJSON == "" {
+		return policy
+	}
+	var configured model.ChannelHeaderPolicy
+	if err := json.Unmarshal([]byte(channel.HeaderPolicyJSON), &configured); err != nil {
+		return policy
+	}
+	if configured.Passthrough == nil {
+		configured.Passthrough = []string{}
+	}
+	if configured.Remove == nil {
+		configured.Remove = []string{}
+	}
+	return configured
+}
+
+// encodeChannelHeaderPolicy 校验并序列化请求头策略，请求头名称统一为规范格式并去重
+func encodeChannelHeaderPolicy(policy *model.ChannelHeaderPolicy) (string, error) {
+	userAgent := strings.TrimSpace(policy.UserAgent)
+	if len(userAgent) > maxHeaderPolicyUserAgent {
+		return "", fmt.Errorf("%w: userAgent 不能超过 %d 个字符", ErrChannelHeaderPolicy, maxHeaderPolicyUserAgent)
+	}
+	if strings.ContainsAny(userAgent, "\r\n") {
+		return "", fmt.Errorf("%w: userAgent 不能包含换行", ErrChannelHeaderPolicy)
+	}
+	passthrough, err := normalizeHeaderNames("passthrough", policy.Passthrough)
+	if err != nil {
+		return "", err
+	}
+	remove, err := normalizeHeaderNames("remove", policy.Remove)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(model.ChannelHeaderPolicy{
+		UserAgent:          userAgent,
+		StripClientHeaders: policy.StripClientHeaders,
+		Passthrough:        passthrough,
+		Remove:             remove,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func normalizeHeaderNames(field string, names []string) ([]string, error) {
+	if len(names) > maxHeaderPolicyItems {
+		return nil, fmt.Errorf("%w: %s 最多 %d 项", ErrChannelHeaderPolicy, field, maxHeaderPolicyItems)
+	}
+	result := make([]string, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !headerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: %s 中无效的请求头名称 %q", ErrChannelHeaderPolicy, field, name)
+		}
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// ChannelDNSPolicy 返回渠道的 DNS 策略，未配置或无法解析时为空策略（系统解析）
+func ChannelDNSPolicy(channel *model.Channel) model.ChannelDNSPolicy {
+	policy := model.ChannelDNSPolicy{StaticIPs: []string{}, IPPreference: model.ChannelIPPreferenceAuto}
+	if channel == nil || channel.DNSPolicyJSON == "" {
+		return policy
+	}
+	var configured model.ChannelDNSPolicy
+	if err := json.Unmarshal([]byte(channel.DNSPolicyJSON), &configured); err != nil {
+		return policy
+	}
+	if configured.StaticIPs == nil {
+		configured.StaticIPs = []string{}
+	}
+	if configured.IPPreference == "" {
+		configured.IPPreference = model.ChannelIPPreferenceAuto
+	}
+	return configured
+}
+
+// IsDefaultDNSPolicy 策略与系统解析的行为一致时无需为渠道单独建立连接池
+func IsDefaultDNSPolicy(policy model.ChannelDNSPolicy) bool {
+	return len(policy.StaticIPs) == 0 && policy.Resolver == "" &&
+		(policy.IPPreference == "" || policy.IPPreference == model.ChannelIPPreferenceAuto) &&
+		policy.FallbackDelayMs == 0 && policy.CacheTTLSec == 0
+}
+
+// encodeChannelDNSPolicy 校验并序列化 DNS 策略，固定 IP 去重，DNS 服务器补全默认端口；
+// 与系统解析行为一致的策略保存为空
+func encodeChannelDNSPolicy(policy *model.ChannelDNSPolicy) (string, error) {
+	if len(policy.StaticIPs) > maxDNSPolicyStaticIPs {
+		return "", fmt.Errorf("%w: staticIps 最多 %d 项", ErrChannelDNSPolicy, maxDNSPolicyStaticIPs)
+	}
+	staticIPs := make([]string, 0, len(policy.StaticIPs))
+	seen := make(map[string]struct{}, len(policy.StaticIPs))
+	for _, raw := range policy.StaticIPs {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		ip := net.ParseIP(raw)
+		if ip == nil {
+			return "", fmt.Errorf("%w: staticIps 中无效的 IP %q", ErrChannelDNSPolicy, raw)
+		}
+		if _, ok := seen[ip.String()]; ok {
+			continue
+		}
+		seen[ip.String()] = struct{}{}
+		staticIPs = append(staticIPs, ip.String())
+	}
+
+	resolver := strings.TrimSpace(policy.Resolver)
+	if resolver != "" {
+		host, port, err := net.SplitHostPort(resolver)
+		if err != nil {
+			host, port = strings.Trim(resolver, "[]"), "53"
+		}
+		if net.ParseIP(host) == nil {
+			return "", fmt.Errorf("%w: resolver 必须为 IP 或 IP:端口", ErrChannelDNSPolicy)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("%w: resolver 端口无效", ErrChannelDNSPolicy)
+		}
+		resolver = net.JoinHostPort(host, port)
+	}
+
+	preference := strings.ToLower(strings.TrimSpace(policy.IPPreference))
+	switch preference {
+	case "", model.ChannelIPPreferenceAuto:
+		preference = model.ChannelIPPreferenceAuto
+	case model.ChannelIPPreferenceIPv4, model.ChannelIPPreferenceIPv6, model.ChannelIPPreferenceIPv4Only, model.ChannelIPPreferenceIPv6Only:
+	default:
+		return "", fmt.Errorf("%w: ipPreference 必须为 auto、ipv4、ipv6、ipv4_only 或 ipv6_only", ErrChannelDNSPolicy)
+	}
+	if preference == model.ChannelIPPreferenceIPv4Only || preference == model.ChannelIPPreferenceIPv6Only {
+		wantV4 := preference == model.ChannelIPPreferenceIPv4Only
+		for _, ip := range staticIPs {
+			if (net.ParseIP(ip).To4() != nil) != wantV4 {
+				return "", fmt.Errorf("%w: 固定 IP %s 与 ipPreference %s 冲突", ErrChannelDNSPolicy, ip, preference)
+			}
+		}
+	}
+
+	if policy.FallbackDelayMs < 0 || policy.FallbackDelayMs > maxDNSPolicyFallbackDelay {
+		return "", fmt.Errorf("%w: fallbackDelayMs 必须在 0 到 %d 之间", ErrChannelDNSPolicy, maxDNSPolicyFallbackDelay)
+	}
+	if policy.CacheTTLSec < 0 || policy.CacheTTLSec > maxDNSPolicyCacheTTL {
+		return "", fmt.Errorf("%w: cacheTtlSec 必须在 0 到 %d 之间", ErrChannelDNSPolicy, maxDNSPolicyCacheTTL)
+	}
+
+	normalized := model.ChannelDNSPolicy{
+		StaticIPs:       staticIPs,
+		Resolver:        resolver,
+		IPPreference:    preference,
+		FallbackDelayMs: policy.FallbackDelayMs,
+		CacheTTLSec:     policy.CacheTTLSec,
+	}
+	if IsDefaultDNSPolicy(normalized) {
+		return "", nil
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// channelKeyRef 密钥引用不含敏感信息，返回给前端展示
+func channelKeyRef(apiKey string) string {
+	if secrets.IsReference(apiKey) {
+		return apiKey
+	}
+	return ""
+}
+
+// maskChannelKey 返回脱敏后的密钥供管理界面辨认，引用以 channelKeyRef 原样展示
+func maskChannelKey(apiKey string) string {
+	if secrets.IsReference(apiKey) {
+		return ""
+	}
+	return maskImportKey(apiKey)
+}
+
 func (s *ChannelService) buildResponse(channel *model.Channel, gids []string, groupMap map[string]*model.Group) *model.ChannelResponse {
 	var models []model.ChannelModel
 	_ = json.Unmarshal([]byte(channel.ModelsJSON), &models)
@@ -607,22 +1353,49 @@ func (s *ChannelService) buildResponse(channel *model.Channel, gids []string, gr
 	}
 
 	return &model.ChannelResponse{
-		ID:             channel.ID,
-		Type:           channel.Type,
-		Endpoint:       channel.Endpoint,
-		Name:           channel.Name,
-		BaseURL:        channel.BaseURL,
-		APIKeySet:      channel.APIKey != "",
-		Enabled:        channel.Enabled,
-		Weight:         channel.Weight,
-		Priority:       channel.Priority,
-		ModelWhitelist: channel.ModelWhitelist,
-		SimulateCLI:    channel.SimulateCLI,
-		GroupIDs:       groupIDs,
-		GroupNames:     groupNames,
-		Models:         models,
-		Headers:        headers,
-		CreatedAt:      channel.CreatedAt,
-		UpdatedAt:      channel.UpdatedAt,
+		ID:                  channel.ID,
+		Type:                channel.Type,
+		Endpoint:            channel.Endpoint,
+		Name:                channel.Name,
+		BaseURL:             channel.BaseURL,
+		APIKeySet:           channel.APIKey != "",
+		APIKeyRef:           channelKeyRef(channel.APIKey),
+		APIKeyMasked:        maskChannelKey(channel.APIKey),
+		APIKeyCount:         len(channelKeyPool(channel)),
+		KeyStrategy:         channelKeyStrategy(channel),
+		Keys:                channelKeyStatuses(channel),
+		Auth:                health.AuthStatus(channel.ID),
+		Enabled:             channel.Enabled,
+		Weight:              channel.Weight,
+		Priority:            channel.Priority,
+		ModelWhitelist:      channel.ModelWhitelist,
+		SimulateCLI:         channel.SimulateCLI,
+		GroupIDs:            groupIDs,
+		GroupNames:          groupNames,
+		Models:              models,
+		Headers:             headers,
+		AnthropicBetaPolicy: ChannelAnthropicBetaPolicy(channel),
+		HeaderPolicy:        ChannelHeaderPolicy(channel),
+		TranslationMode:     channelTranslationMode(channel),
+		FederationIssuer:    channel.FederationIssuer,
+		DNSPolicy:           ChannelDNSPolicy(channel),
+		Version:             channel.Version,
+		CreatedAt:           channel.CreatedAt,
+		UpdatedAt:           channel.UpdatedAt,
+	}
+}
+
+// ListChannelHealth 返回所有启用渠道的健康状态
+func (s *ChannelService) ListChannelHealth() ([]model.ChannelHealthStatus, error) {
+	channels, err := s.repo.ListEnabled()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]model.ChannelHealthStatus, 0, len(channels))
+	for _, ch := range channels {
+		status := health.Status(ch.ID)
+		status.ChannelName = ch.Name
+		statuses = append(statuses, status)
 	}
+	return statuses, nil
 }
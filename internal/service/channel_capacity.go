@@ -0,0 +1,399 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/health"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCapacityWindowMinutes = 5
+	defaultCapacityWarnRatio     = 0.8
+	defaultCapacityInterval      = 300
+	defaultCapacityMinWeight     = 1
+	defaultCapacityMaxWeight     = 100
+	minCapacityInterval          = 60
+	maxCapacityWindowMinutes     = 1440
+	maxCapacityWeight            = 10000
+	// 计算建议权重时剩余额度比例的下限，避免接近上限的渠道完全不分配流量
+	minCapacityHeadroom = 0.05
+)
+
+var channelCapacityState struct {
+	mu     sync.RWMutex
+	config model.ChannelCapacityConfig
+}
+
+// channelCapacityApplyMu 保证定时调整与手动应用不会同时写入权重
+var channelCapacityApplyMu sync.Mutex
+
+func init() {
+	channelCapacityState.config = DefaultChannelCapacityConfig()
+}
+
+// DefaultChannelCapacityConfig 默认按最近 5 分钟统计，只给出建议不自动调整
+func DefaultChannelCapacityConfig() model.ChannelCapacityConfig {
+	return model.ChannelCapacityConfig{
+		WindowMinutes: defaultCapacityWindowMinutes,
+		WarnRatio:     defaultCapacityWarnRatio,
+		IntervalSec:   defaultCapacityInterval,
+		MinWeight:     defaultCapacityMinWeight,
+		MaxWeight:     defaultCapacityMaxWeight,
+	}
+}
+
+// NormalizeChannelCapacityConfig 填充未设置的字段
+func NormalizeChannelCapacityConfig(cfg model.ChannelCapacityConfig) model.ChannelCapacityConfig {
+	if cfg.WindowMinutes <= 0 {
+		cfg.WindowMinutes = defaultCapacityWindowMinutes
+	}
+	if cfg.WarnRatio <= 0 {
+		cfg.WarnRatio = defaultCapacityWarnRatio
+	}
+	if cfg.IntervalSec <= 0 {
+		cfg.IntervalSec = defaultCapacityInterval
+	}
+	if cfg.MinWeight <= 0 {
+		cfg.MinWeight = defaultCapacityMinWeight
+	}
+	if cfg.MaxWeight <= 0 {
+		cfg.MaxWeight = defaultCapacityMaxWeight
+	}
+	return cfg
+}
+
+// ValidateChannelCapacityConfig 校验渠道容量建议配置（需先 Normalize）
+func ValidateChannelCapacityConfig(cfg model.ChannelCapacityConfig) error {
+	if cfg.WindowMinutes > maxCapacityWindowMinutes {
+		return fmt.Errorf("windowMinutes 不能超过 %d", maxCapacityWindowMinutes)
+	}
+	if cfg.WarnRatio > 1 {
+		return errors.New("warnRatio 必须在 0 到 1 之间")
+	}
+	if cfg.IntervalSec < minCapacityInterval {
+		return fmt.Errorf("intervalSec 不能小于 %d", minCapacityInterval)
+	}
+	if cfg.MaxWeight > maxCapacityWeight {
+		return fmt.Errorf("maxWeight 不能超过 %d", maxCapacityWeight)
+	}
+	if cfg.MinWeight > cfg.MaxWeight {
+		return errors.New("minWeight 不能大于 maxWeight")
+	}
+	return nil
+}
+
+// InitChannelCapacityConfig 启动时从持久化配置加载
+func InitChannelCapacityConfig(configJSON string) {
+	var cfg model.ChannelCapacityConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("channel capacity: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+	cfg = NormalizeChannelCapacityConfig(cfg)
+	if err := ValidateChannelCapacityConfig(cfg); err != nil {
+		log.Warnf("channel capacity: 配置无效，使用默认配置: %v", err)
+		return
+	}
+	UpdateChannelCapacityConfig(cfg)
+}
+
+// UpdateChannelCapacityConfig 更新运行时配置，运行中的定时任务会重置调整间隔
+func UpdateChannelCapacityConfig(cfg model.ChannelCapacityConfig) {
+	channelCapacityState.mu.Lock()
+	channelCapacityState.config = cfg
+	channelCapacityState.mu.Unlock()
+
+	if globalChannelCapacityAdjuster != nil {
+		globalChannelCapacityAdjuster.notifyReload()
+	}
+}
+
+// GetChannelCapacityConfig 获取当前渠道容量建议配置
+func GetChannelCapacityConfig() model.ChannelCapacityConfig {
+	channelCapacityState.mu.RLock()
+	defer channelCapacityState.mu.RUnlock()
+	return channelCapacityState.config
+}
+
+// BuildChannelCapacityReport 统计启用渠道在窗口内的 RPM/TPM，结合上游限流响应头判断是否接近上限，
+// 并给出同优先级、承接相同模型的渠道间的权重调整建议
+func BuildChannelCapacityReport() (*model.ChannelCapacityReport, error) {
+	cfg := GetChannelCapacityConfig()
+	channels, err := repository.NewChannelRepository().ListEnabled()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	window := time.Duration(cfg.WindowMinutes) * time.Minute
+	usage, err := repository.NewRequestLogRepository().GetChannelUsageSince(now.Add(-window))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.ChannelCapacityReport{
+		GeneratedAt:   now,
+		WindowMinutes: cfg.WindowMinutes,
+		WarnRatio:     cfg.WarnRatio,
+		Channels:      make([]model.ChannelCapacity, 0, len(channels)),
+	}
+	modelKeys := make([][]string, 0, len(channels))
+	minutes := float64(cfg.WindowMinutes)
+	for _, ch := range channels {
+		stat := usage[ch.ID]
+		item := model.ChannelCapacity{
+			ChannelID:   ch.ID,
+			ChannelName: ch.Name,
+			Priority:    ch.Priority,
+			Weight:      ch.Weight,
+			Requests:    stat.Requests,
+			Tokens:      stat.Tokens,
+			RPM:         roundRatio(float64(stat.Requests) / minutes),
+			TPM:         roundRatio(float64(stat.Tokens) / minutes),
+		}
+		if rl, ok := health.RateLimit(ch.ID); ok && now.Sub(rl.ObservedAt) <= window {
+			item.RateLimit = &rl
+			evaluateChannelCapacity(&item, cfg.WarnRatio)
+		}
+		if item.NearLimit {
+			report.NearLimitCount++
+		}
+		report.Channels = append(report.Channels, item)
+		modelKeys = append(modelKeys, capacityModelKeys(ch))
+	}
+
+	recommendChannelWeights(report.Channels, modelKeys, cfg)
+	return report, nil
+}
+
+// ApplyChannelCapacityRecommendations 生成报告并将建议权重写入渠道
+func ApplyChannelCapacityRecommendations() (*model.ChannelCapacityReport, error) {
+	channelCapacityApplyMu.Lock()
+	defer channelCapacityApplyMu.Unlock()
+
+	report, err := BuildChannelCapacityReport()
+	if err != nil {
+		return nil, err
+	}
+
+	repo := repository.NewChannelRepository()
+	for i := range report.Channels {
+		item := &report.Channels[i]
+		if item.RecommendedWeight == item.Weight {
+			continue
+		}
+		if err := repo.SetWeight(item.ChannelID, item.RecommendedWeight); err != nil {
+			return nil, fmt.Errorf("更新渠道 %s 权重失败: %w", item.ChannelName, err)
+		}
+		log.Infof("channel capacity: 渠道 '%s' 权重 %d -> %d（%s）", item.ChannelName, item.Weight, item.RecommendedWeight, item.Reason)
+		item.Weight = item.RecommendedWeight
+		report.AdjustedCount++
+	}
+	report.Applied = true
+	return report, nil
+}
+
+// evaluateChannelCapacity 计算请求数与 token 的已用比例：取上游当前分钟已用额度与本地平均 RPM/TPM 中较大者
+func evaluateChannelCapacity(item *model.ChannelCapacity, warnRatio float64) {
+	rl := item.RateLimit
+	var reasons []string
+	if rl.RequestsLimit > 0 {
+		used := math.Max(float64(rl.RequestsLimit-rl.RequestsRemaining), item.RPM)
+		util := roundRatio(math.Min(used/float64(rl.RequestsLimit), 1))
+		item.RequestUtilization = &util
+		if util >= warnRatio {
+			reasons = append(reasons, fmt.Sprintf("请求数已用 %.0f%%（上限 %d/分钟）", util*100, rl.RequestsLimit))
+		}
+	}
+	if rl.TokensLimit > 0 {
+		used := math.Max(float64(rl.TokensLimit-rl.TokensRemaining), item.TPM)
+		util := roundRatio(math.Min(used/float64(rl.TokensLimit), 1))
+		item.TokenUtilization = &util
+		if util >= warnRatio {
+			reasons = append(reasons, fmt.Sprintf("token 已用 %.0f%%（上限 %d/分钟）", util*100, rl.TokensLimit))
+		}
+	}
+	if len(reasons) > 0 {
+		item.NearLimit = true
+		item.Reason = strings.Join(reasons, "；")
+	}
+}
+
+// recommendChannelWeights 将同优先级且承接相同模型的渠道归为一组，组内有渠道接近上限时，
+// 按「权重 × 剩余额度比例」重新分配组内总权重：接近上限的渠道降低权重，其余渠道相应提高。
+// 没有渠道接近上限的组保持原权重；modelKeys 与 items 一一对应
+func recommendChannelWeights(items []model.ChannelCapacity, modelKeys [][]string, cfg model.ChannelCapacityConfig) {
+	parent := make([]int, len(items))
+	for i := range items {
+		parent[i] = i
+		items[i].RecommendedWeight = items[i].Weight
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	owner := make(map[string]int)
+	for i := range items {
+		for _, key := range modelKeys[i] {
+			k := fmt.Sprintf("%d|%s", items[i].Priority, key)
+			if j, ok := owner[k]; ok {
+				parent[find(i)] = find(j)
+			} else {
+				owner[k] = i
+			}
+		}
+	}
+	groups := make(map[int][]int)
+	for i := range items {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	for _, idxs := range groups {
+		nearLimit := false
+		for _, i := range idxs {
+			nearLimit = nearLimit || items[i].NearLimit
+		}
+		if !nearLimit || len(idxs) < 2 {
+			continue
+		}
+
+		scores := make([]float64, len(idxs))
+		totalWeight, totalScore := 0, 0.0
+		for k, i := range idxs {
+			util := 0.0
+			if u := items[i].RequestUtilization; u != nil {
+				util = *u
+			}
+			if u := items[i].TokenUtilization; u != nil && *u > util {
+				util = *u
+			}
+			weight := max(items[i].Weight, 1)
+			totalWeight += weight
+			scores[k] = float64(weight) * math.Max(1-util, minCapacityHeadroom)
+			totalScore += scores[k]
+		}
+
+		for k, i := range idxs {
+			recommended := int(math.Round(float64(totalWeight) * scores[k] / totalScore))
+			items[i].RecommendedWeight = min(max(recommended, cfg.MinWeight), cfg.MaxWeight)
+			if !items[i].NearLimit && items[i].RecommendedWeight != items[i].Weight {
+				items[i].Reason = "同组渠道接近上限，分担流量"
+			}
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].NearLimit != items[j].NearLimit {
+			return items[i].NearLimit
+		}
+		if items[i].Priority != items[j].Priority {
+			return items[i].Priority < items[j].Priority
+		}
+		return items[i].ChannelName < items[j].ChannelName
+	})
+}
+
+// capacityModelKeys 渠道对外承接的模型名（有别名时取别名），未配置模型的渠道按类型默认匹配
+func capacityModelKeys(ch *model.Channel) []string {
+	models, _ := getParsedModels(ch.ModelsJSON)
+	if len(models) == 0 {
+		return []string{"default:" + string(ch.Type)}
+	}
+	keys := make([]string, 0, len(models))
+	for _, m := range models {
+		name := m.Alias
+		if name == "" {
+			name = m.Name
+		}
+		keys = append(keys, strings.ToLower(name))
+	}
+	return keys
+}
+
+func roundRatio(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ChannelCapacityAdjuster 开启自动调整时按配置的间隔应用权重建议
+type ChannelCapacityAdjuster struct {
+	reloadChan chan struct{}
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+}
+
+var globalChannelCapacityAdjuster *ChannelCapacityAdjuster
+
+// InitChannelCapacityAdjuster 启动全局渠道权重自动调整任务
+func InitChannelCapacityAdjuster() {
+	globalChannelCapacityAdjuster = &ChannelCapacityAdjuster{
+		reloadChan: make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+	}
+	globalChannelCapacityAdjuster.wg.Add(1)
+	go globalChannelCapacityAdjuster.run()
+	log.Info("channel capacity: started")
+}
+
+// StopChannelCapacityAdjuster 停止全局渠道权重自动调整任务
+func StopChannelCapacityAdjuster() {
+	if globalChannelCapacityAdjuster == nil {
+		return
+	}
+	globalChannelCapacityAdjuster.stopOnce.Do(func() { close(globalChannelCapacityAdjuster.stopChan) })
+	globalChannelCapacityAdjuster.wg.Wait()
+	log.Info("channel capacity: stopped")
+}
+
+func (a *ChannelCapacityAdjuster) notifyReload() {
+	select {
+	case a.reloadChan <- struct{}{}:
+	default:
+	}
+}
+
+func (a *ChannelCapacityAdjuster) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(time.Duration(GetChannelCapacityConfig().IntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.adjust()
+		case <-a.reloadChan:
+			ticker.Reset(time.Duration(GetChannelCapacityConfig().IntervalSec) * time.Second)
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *ChannelCapacityAdjuster) adjust() {
+	if !GetChannelCapacityConfig().AutoAdjust {
+		return
+	}
+	report, err := ApplyChannelCapacityRecommendations()
+	if err != nil {
+		log.Errorf("channel capacity: %v", err)
+		return
+	}
+	if report.AdjustedCount > 0 {
+		log.Warnf("channel capacity: %d 个渠道接近上限，已调整 %d 个渠道的权重", report.NearLimitCount, report.AdjustedCount)
+	}
+}
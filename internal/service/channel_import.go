@@ -0,0 +1,235 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+var (
+	ErrUnsupportedImportSource = errors.New("不支持的导入来源")
+	ErrImportContentInvalid    = errors.New("导入内容无法解析")
+)
+
+// ChannelImportService 从其他网关（CLIProxyAPI / one-api / new-api）的配置导入渠道、用户和 API Key
+type ChannelImportService struct {
+	channelService *ChannelService
+	channelRepo    repository.ChannelRepositoryInterface
+	userRepo       repository.UserRepositoryInterface
+	apiKeyRepo     *repository.APIKeyRepository
+}
+
+func NewChannelImportService() *ChannelImportService {
+	return &ChannelImportService{
+		channelService: NewChannelService(),
+		channelRepo:    repository.NewChannelRepository(),
+		userRepo:       repository.NewUserRepository(),
+		apiKeyRepo:     repository.NewAPIKeyRepository(),
+	}
+}
+
+// Import 解析源配置并导入；DryRun 时只返回将要创建的内容
+func (s *ChannelImportService) Import(req *model.ChannelImportRequest) (*model.ChannelImportResult, error) {
+	var draft *importDraft
+	var err error
+	switch req.Source {
+	case model.ChannelImportSourceCLIProxyAPI:
+		draft, err = parseCLIProxyAPIConfig(req.Content)
+	case model.ChannelImportSourceOneAPI, model.ChannelImportSourceNewAPI:
+		draft, err = parseOneAPIExport(req.Source, req.Content)
+	default:
+		return nil, ErrUnsupportedImportSource
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrImportContentInvalid, err)
+	}
+
+	result := &model.ChannelImportResult{
+		Source:   req.Source,
+		DryRun:   req.DryRun,
+		Channels: []model.ImportedChannel{},
+		Users:    []model.ImportedUser{},
+		Warnings: draft.warnings,
+	}
+	if result.Warnings == nil {
+		result.Warnings = []string{}
+	}
+
+	if err := s.importChannels(req, draft, result); err != nil {
+		return nil, err
+	}
+	if err := s.importUsers(req, draft, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *ChannelImportService) importChannels(req *model.ChannelImportRequest, draft *importDraft, result *model.ChannelImportResult) error {
+	existing, err := s.channelRepo.List()
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(existing))
+	for _, ch := range existing {
+		names[ch.Name] = true
+	}
+
+	for _, d := range draft.channels {
+		channel := d.channel
+		channel.APIKey = maskImportKey(d.apiKey)
+		if !channel.Skipped && names[channel.Name] {
+			channel.Skipped = true
+			channel.Reason = "同名渠道已存在"
+		}
+		if channel.Skipped {
+			result.Channels = append(result.Channels, channel)
+			continue
+		}
+		names[channel.Name] = true
+
+		if !req.DryRun {
+			created, err := s.channelService.Create(&model.ChannelRequest{
+				Type:     channel.Type,
+				Endpoint: channel.Endpoint,
+				Name:     channel.Name,
+				BaseURL:  channel.BaseURL,
+				APIKey:   d.apiKey,
+				Enabled:  channel.Enabled,
+				Weight:   channel.Weight,
+				Priority: channel.Priority,
+				GroupIDs: req.GroupIDs,
+				Models:   channel.Models,
+				Headers:  channel.Headers,
+			})
+			if err != nil {
+				return fmt.Errorf("创建渠道 %s 失败: %w", channel.Name, err)
+			}
+			channel.ID = created.ID
+			result.CreatedChannels++
+		}
+		result.Channels = append(result.Channels, channel)
+	}
+	return nil
+}
+
+func (s *ChannelImportService) importUsers(req *model.ChannelImportRequest, draft *importDraft, result *model.ChannelImportResult) error {
+	seenKeys := make(map[string]bool)
+	for _, d := range draft.users {
+		user := model.ImportedUser{Username: d.username, APIKeys: []model.ImportedAPIKey{}}
+		switch {
+		case d.skip != "":
+			user.Skipped, user.Reason = true, d.skip
+		case len(d.username) < 3 || len(d.username) > 32:
+			user.Skipped, user.Reason = true, "用户名长度需为 3-32 个字符"
+		default:
+			exists, err := s.userRepo.ExistsByUsername(d.username)
+			if err != nil {
+				return err
+			}
+			if exists {
+				user.Skipped, user.Reason = true, ErrUsernameExists.Error()
+			}
+		}
+
+		if !user.Skipped && !req.DryRun {
+			password, err := randomImportPassword()
+			if err != nil {
+				return err
+			}
+			hashed, err := HashPassword(password)
+			if err != nil {
+				return err
+			}
+			// 随机初始密码只返回给管理员一次，用户首次登录后需自行修改
+			created := &model.User{Username: d.username, PasswordHash: hashed, PasswordMustChange: true}
+			if err := s.userRepo.Create(created); err != nil {
+				return fmt.Errorf("创建用户 %s 失败: %w", d.username, err)
+			}
+			if len(req.GroupIDs) > 0 {
+				if err := s.userRepo.SetGroups(created.ID, req.GroupIDs); err != nil {
+					return err
+				}
+			}
+			// 导入时选择了分组则不再按规则分配分组
+			ApplyNewUserDefaults(created, NewUserSourceImport, len(req.GroupIDs) > 0)
+			user.ID = created.ID
+			user.Password = password
+			result.CreatedUsers++
+		}
+
+		for _, k := range d.keys {
+			key := model.ImportedAPIKey{Name: k.name, Prefix: importKeyPrefix(k.key)}
+			keyHash := hashImportKey(k.key)
+			switch {
+			case user.Skipped:
+				key.Skipped, key.Reason = true, "所属用户未导入"
+			case k.skip != "":
+				key.Skipped, key.Reason = true, k.skip
+			case seenKeys[keyHash]:
+				key.Skipped, key.Reason = true, "导入数据中 Key 重复"
+			default:
+				dup, err := s.apiKeyRepo.GetByKeyHash(keyHash)
+				if err != nil {
+					return err
+				}
+				if dup != nil {
+					key.Skipped, key.Reason = true, "Key 已存在"
+				}
+			}
+			seenKeys[keyHash] = true
+
+			if !key.Skipped && !req.DryRun {
+				if err := s.apiKeyRepo.Create(&model.UserAPIKey{
+					UserID:  user.ID,
+					Name:    k.name,
+					Prefix:  key.Prefix,
+					KeyHash: keyHash,
+					APIKey:  k.key,
+				}); err != nil {
+					return fmt.Errorf("创建 API Key %s 失败: %w", k.name, err)
+				}
+				result.CreatedAPIKeys++
+			}
+			user.APIKeys = append(user.APIKeys, key)
+		}
+		result.Users = append(result.Users, user)
+	}
+	return nil
+}
+
+// hashImportKey 与 CreateAPIKey / ValidateAPIKey 使用相同的哈希方式，保证导入的 Key 可直接使用
+func hashImportKey(rawKey string) string {
+	hash := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(hash[:])
+}
+
+func importKeyPrefix(rawKey string) string {
+	if len(rawKey) <= 8 {
+		return rawKey[:len(rawKey)/2]
+	}
+	return rawKey[:8]
+}
+
+func maskImportKey(rawKey string) string {
+	if rawKey == "" {
+		return ""
+	}
+	if len(rawKey) <= 8 {
+		return "****"
+	}
+	return rawKey[:4] + "****" + rawKey[len(rawKey)-4:]
+}
+
+func randomImportPassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
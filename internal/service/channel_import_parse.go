@@ -0,0 +1,458 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ampmanager/internal/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+// importDraft 从源配置解析出的待导入数据（尚未与数据库比对）
+type importDraft struct {
+	channels []importChannelDraft
+	users    []importUserDraft
+	warnings []string
+}
+
+type importChannelDraft struct {
+	channel model.ImportedChannel
+	apiKey  string
+}
+
+type importUserDraft struct {
+	username string
+	skip     string // 非空表示源数据中即不应导入的原因
+	keys     []importKeyDraft
+}
+
+type importKeyDraft struct {
+	name string
+	key  string
+	skip string
+}
+
+func (d *importDraft) warnf(format string, args ...interface{}) {
+	d.warnings = append(d.warnings, fmt.Sprintf(format, args...))
+}
+
+// normalizeImportBaseURL 去掉末尾的版本路径，AMP-Manager 的渠道 BaseURL 不包含 /v1
+func normalizeImportBaseURL(raw string) string {
+	baseURL := strings.TrimRight(strings.TrimSpace(raw), "/")
+	for _, suffix := range []string{"/v1beta", "/v1"} {
+		if strings.HasSuffix(baseURL, suffix) {
+			return strings.TrimSuffix(baseURL, suffix)
+		}
+	}
+	return baseURL
+}
+
+// ==================== CLIProxyAPI ====================
+
+type cliProxyConfig struct {
+	APIKeys          []string               `yaml:"api-keys"`
+	GeminiKeys       []cliProxyKeyEntry     `yaml:"gemini-api-key"`
+	LegacyGeminiKeys []string               `yaml:"generative-language-api-key"`
+	ClaudeKeys       []cliProxyKeyEntry     `yaml:"claude-api-key"`
+	CodexKeys        []cliProxyKeyEntry     `yaml:"codex-api-key"`
+	OpenAICompat     []cliProxyOpenAICompat `yaml:"openai-compatibility"`
+}
+
+type cliProxyModel struct {
+	Name  string `yaml:"name"`
+	Alias string `yaml:"alias"`
+}
+
+type cliProxyKeyEntry struct {
+	APIKey  string            `yaml:"api-key"`
+	BaseURL string            `yaml:"base-url"`
+	Headers map[string]string `yaml:"headers"`
+	Models  []cliProxyModel   `yaml:"models"`
+}
+
+// UnmarshalYAML 兼容旧版本中直接写 Key 字符串的列表项
+func (e *cliProxyKeyEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.APIKey = node.Value
+		return nil
+	}
+	type plain cliProxyKeyEntry
+	return node.Decode((*plain)(e))
+}
+
+type cliProxyOpenAICompat struct {
+	Name          string   `yaml:"name"`
+	BaseURL       string   `yaml:"base-url"`
+	APIKeys       []string `yaml:"api-keys"`
+	APIKeyEntries []struct {
+		APIKey string `yaml:"api-key"`
+	} `yaml:"api-key-entries"`
+	Headers map[string]string `yaml:"headers"`
+	Models  []cliProxyModel   `yaml:"models"`
+}
+
+func parseCLIProxyAPIConfig(content string) (*importDraft, error) {
+	var cfg cliProxyConfig
+	if err := yaml.Unmarshal([]byte(content), &cfg); err != nil {
+		return nil, fmt.Errorf("解析 CLIProxyAPI 配置失败: %w", err)
+	}
+
+	draft := &importDraft{}
+	addEntries := func(section string, entries []cliProxyKeyEntry, channelType model.ChannelType, endpoint model.ChannelEndpoint, defaultBaseURL string) {
+		for i, entry := range entries {
+			ref := fmt.Sprintf("%s[%d]", section, i)
+			if strings.TrimSpace(entry.APIKey) == "" {
+				draft.warnf("%s 缺少 api-key，已忽略", ref)
+				continue
+			}
+			baseURL := normalizeImportBaseURL(entry.BaseURL)
+			if baseURL == "" {
+				baseURL = defaultBaseURL
+			}
+			draft.channels = append(draft.channels, importChannelDraft{
+				apiKey: strings.TrimSpace(entry.APIKey),
+				channel: model.ImportedChannel{
+					Name:      fmt.Sprintf("%s-%d", section, i+1),
+					Type:      channelType,
+					Endpoint:  endpoint,
+					BaseURL:   baseURL,
+					Enabled:   true,
+					Weight:    1,
+					Priority:  100,
+					Models:    cliProxyModels(entry.Models),
+					Headers:   entry.Headers,
+					SourceRef: ref,
+				},
+			})
+		}
+	}
+
+	gemini := cfg.GeminiKeys
+	for _, key := range cfg.LegacyGeminiKeys {
+		gemini = append(gemini, cliProxyKeyEntry{APIKey: key})
+	}
+	addEntries("gemini-api-key", gemini, model.ChannelTypeGemini, model.ChannelEndpointGenerateContent, "https://generativelanguage.googleapis.com")
+	addEntries("claude-api-key", cfg.ClaudeKeys, model.ChannelTypeClaude, model.ChannelEndpointMessages, "https://api.anthropic.com")
+	addEntries("codex-api-key", cfg.CodexKeys, model.ChannelTypeOpenAI, model.ChannelEndpointResponses, "https://api.openai.com")
+
+	for i, compat := range cfg.OpenAICompat {
+		ref := fmt.Sprintf("openai-compatibility[%d]", i)
+		baseURL := normalizeImportBaseURL(compat.BaseURL)
+		if baseURL == "" {
+			draft.warnf("%s 缺少 base-url，已忽略", ref)
+			continue
+		}
+		keys := append([]string{}, compat.APIKeys...)
+		for _, entry := range compat.APIKeyEntries {
+			keys = append(keys, entry.APIKey)
+		}
+		name := strings.TrimSpace(compat.Name)
+		if name == "" {
+			name = fmt.Sprintf("openai-compatibility-%d", i+1)
+		}
+		entries := make([]cliProxyKeyEntry, 0, len(keys))
+		for _, key := range keys {
+			entries = append(entries, cliProxyKeyEntry{APIKey: key, BaseURL: baseURL, Headers: compat.Headers, Models: compat.Models})
+		}
+		if len(entries) == 0 {
+			draft.warnf("%s 没有配置 api-key，已忽略", ref)
+			continue
+		}
+		before := len(draft.channels)
+		addEntries(ref, entries, model.ChannelTypeOpenAI, model.ChannelEndpointChatCompletions, baseURL)
+		// 同一 provider 的多个 Key 以 provider 名称命名
+		for j := before; j < len(draft.channels); j++ {
+			draft.channels[j].channel.Name = name
+			if len(entries) > 1 {
+				draft.channels[j].channel.Name = fmt.Sprintf("%s #%d", name, j-before+1)
+			}
+		}
+	}
+
+	// CLIProxyAPI 的客户端 Key 没有用户概念，统一归到一个导入用户下
+	if len(cfg.APIKeys) > 0 {
+		user := importUserDraft{username: "cliproxyapi"}
+		for i, key := range cfg.APIKeys {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			user.keys = append(user.keys, importKeyDraft{name: fmt.Sprintf("cliproxyapi-%d", i+1), key: key})
+		}
+		if len(user.keys) > 0 {
+			draft.users = append(draft.users, user)
+		}
+	}
+
+	return draft, nil
+}
+
+func cliProxyModels(models []cliProxyModel) []model.ChannelModel {
+	result := make([]model.ChannelModel, 0, len(models))
+	for _, m := range models {
+		name := strings.TrimSpace(m.Name)
+		if name == "" {
+			continue
+		}
+		result = append(result, model.ChannelModel{Name: name, Alias: strings.TrimSpace(m.Alias)})
+	}
+	return result
+}
+
+// ==================== one-api / new-api ====================
+
+// one-api 与 new-api 共用的渠道类型编号（仅列出需要特殊处理的类型）
+const (
+	oneAPIChannelTypeOpenAI    = 1
+	oneAPIChannelTypeAzure     = 3
+	oneAPIChannelTypeAnthropic = 14
+	oneAPIChannelTypeGemini    = 24
+)
+
+type oneAPIChannel struct {
+	ID           int     `json:"id"`
+	Type         int     `json:"type"`
+	Key          string  `json:"key"`
+	Name         string  `json:"name"`
+	Status       int     `json:"status"`
+	BaseURL      *string `json:"base_url"`
+	Models       string  `json:"models"`
+	ModelMapping *string `json:"model_mapping"`
+	Weight       *int    `json:"weight"`
+	Priority     *int64  `json:"priority"`
+}
+
+type oneAPIToken struct {
+	ID          int    `json:"id"`
+	UserID      int    `json:"user_id"`
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Status      int    `json:"status"`
+	ExpiredTime int64  `json:"expired_time"`
+}
+
+type oneAPIUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Status   int    `json:"status"`
+}
+
+type oneAPIExport struct {
+	Channels []oneAPIChannel `json:"channels"`
+	Tokens   []oneAPIToken   `json:"tokens"`
+	Users    []oneAPIUser    `json:"users"`
+	// Data 兼容直接粘贴 /api/channel/ 接口返回的 {"success":true,"data":[...]}
+	Data json.RawMessage `json:"data"`
+}
+
+// parseOneAPIExport 解析 one-api / new-api 的导出 JSON，支持：
+// 渠道数组、接口响应 {"data":[...]}、以及 {"channels":[...],"tokens":[...],"users":[...]}
+func parseOneAPIExport(source model.ChannelImportSource, content string) (*importDraft, error) {
+	trimmed := bytes.TrimSpace([]byte(content))
+	var export oneAPIExport
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &export.Channels); err != nil {
+			return nil, fmt.Errorf("解析 %s 渠道列表失败: %w", source, err)
+		}
+	} else {
+		if err := json.Unmarshal(trimmed, &export); err != nil {
+			return nil, fmt.Errorf("解析 %s 导出数据失败: %w", source, err)
+		}
+		if len(export.Data) > 0 && export.Data[0] == '[' && len(export.Channels) == 0 {
+			if err := json.Unmarshal(export.Data, &export.Channels); err != nil {
+				return nil, fmt.Errorf("解析 %s 渠道列表失败: %w", source, err)
+			}
+		}
+	}
+
+	draft := &importDraft{}
+	for i, ch := range export.Channels {
+		parseOneAPIChannel(draft, fmt.Sprintf("channels[%d]", i), ch)
+	}
+	parseOneAPIUsers(draft, export.Users, export.Tokens)
+	return draft, nil
+}
+
+func parseOneAPIChannel(draft *importDraft, ref string, ch oneAPIChannel) {
+	name := strings.TrimSpace(ch.Name)
+	if name == "" {
+		name = fmt.Sprintf("channel-%d", ch.ID)
+	}
+
+	var channelType model.ChannelType
+	var endpoint model.ChannelEndpoint
+	var defaultBaseURL string
+	switch ch.Type {
+	case oneAPIChannelTypeAzure:
+		draft.warnf("%s (%s) 是 Azure 渠道，暂不支持导入", ref, name)
+		return
+	case oneAPIChannelTypeAnthropic:
+		channelType, endpoint, defaultBaseURL = model.ChannelTypeClaude, model.ChannelEndpointMessages, "https://api.anthropic.com"
+	case oneAPIChannelTypeGemini:
+		channelType, endpoint, defaultBaseURL = model.ChannelTypeGemini, model.ChannelEndpointGenerateContent, "https://generativelanguage.googleapis.com"
+	case oneAPIChannelTypeOpenAI:
+		channelType, endpoint, defaultBaseURL = model.ChannelTypeOpenAI, model.ChannelEndpointChatCompletions, "https://api.openai.com"
+	default:
+		// 其余类型大多是 OpenAI 兼容接口
+		channelType, endpoint = model.ChannelTypeOpenAI, model.ChannelEndpointChatCompletions
+		draft.warnf("%s (%s) 的渠道类型 %d 按 OpenAI 兼容渠道导入", ref, name, ch.Type)
+	}
+
+	baseURL := ""
+	if ch.BaseURL != nil {
+		baseURL = normalizeImportBaseURL(*ch.BaseURL)
+	}
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	weight := 1
+	if ch.Weight != nil && *ch.Weight > 0 {
+		weight = *ch.Weight
+	}
+	// one-api 的优先级越大越优先，AMP-Manager 越小越优先（默认 100）
+	priority := 100
+	if ch.Priority != nil {
+		priority = 100 - int(*ch.Priority)
+		if priority < 1 {
+			priority = 1
+		}
+	}
+
+	models, err := oneAPIModels(ch.Models, ch.ModelMapping)
+	if err != nil {
+		draft.warnf("%s (%s) 的 model_mapping 无法解析，已忽略映射: %v", ref, name, err)
+	}
+
+	// 批量添加的渠道一行一个 Key，拆分为多个渠道
+	var keys []string
+	for _, key := range strings.Split(ch.Key, "\n") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	base := model.ImportedChannel{
+		Name:      name,
+		Type:      channelType,
+		Endpoint:  endpoint,
+		BaseURL:   baseURL,
+		Enabled:   ch.Status == 1,
+		Weight:    weight,
+		Priority:  priority,
+		Models:    models,
+		SourceRef: ref,
+	}
+	if len(keys) == 0 {
+		skipped := base
+		skipped.Skipped = true
+		skipped.Reason = "缺少 API Key"
+		draft.channels = append(draft.channels, importChannelDraft{channel: skipped})
+		return
+	}
+	if baseURL == "" {
+		skipped := base
+		skipped.Skipped = true
+		skipped.Reason = "缺少 base_url"
+		draft.channels = append(draft.channels, importChannelDraft{channel: skipped})
+		return
+	}
+	for i, key := range keys {
+		channel := base
+		if len(keys) > 1 {
+			channel.Name = fmt.Sprintf("%s #%d", name, i+1)
+		}
+		draft.channels = append(draft.channels, importChannelDraft{channel: channel, apiKey: key})
+	}
+}
+
+// oneAPIModels 将逗号分隔的模型列表和 {"客户端模型":"上游模型"} 映射转换为渠道模型
+func oneAPIModels(modelsCSV string, mappingJSON *string) ([]model.ChannelModel, error) {
+	mapping := map[string]string{}
+	var mappingErr error
+	if mappingJSON != nil && strings.TrimSpace(*mappingJSON) != "" {
+		mappingErr = json.Unmarshal([]byte(*mappingJSON), &mapping)
+	}
+
+	seen := make(map[string]bool)
+	var result []model.ChannelModel
+	add := func(clientName string) {
+		if clientName == "" || seen[clientName] {
+			return
+		}
+		seen[clientName] = true
+		if upstream := mapping[clientName]; upstream != "" && upstream != clientName {
+			result = append(result, model.ChannelModel{Name: upstream, Alias: clientName})
+			return
+		}
+		result = append(result, model.ChannelModel{Name: clientName})
+	}
+
+	for _, name := range strings.Split(modelsCSV, ",") {
+		add(strings.TrimSpace(name))
+	}
+	// 映射中存在但模型列表未列出的客户端模型也一并导入
+	extra := make([]string, 0, len(mapping))
+	for clientName := range mapping {
+		extra = append(extra, clientName)
+	}
+	sort.Strings(extra)
+	for _, clientName := range extra {
+		add(strings.TrimSpace(clientName))
+	}
+
+	if result == nil {
+		result = []model.ChannelModel{}
+	}
+	return result, mappingErr
+}
+
+func parseOneAPIUsers(draft *importDraft, users []oneAPIUser, tokens []oneAPIToken) {
+	byID := make(map[int]int, len(users))
+	for i, u := range users {
+		byID[u.ID] = len(draft.users)
+		user := importUserDraft{username: strings.TrimSpace(u.Username)}
+		if u.Status != 1 {
+			user.skip = "源系统中用户已禁用"
+		}
+		if user.username == "" {
+			draft.warnf("users[%d] 缺少 username，已忽略", i)
+			delete(byID, u.ID)
+			continue
+		}
+		draft.users = append(draft.users, user)
+	}
+
+	now := time.Now().Unix()
+	for i, t := range tokens {
+		idx, ok := byID[t.UserID]
+		if !ok {
+			draft.warnf("tokens[%d] (%s) 所属用户 %d 不在导入数据中，已忽略", i, t.Name, t.UserID)
+			continue
+		}
+		key := strings.TrimSpace(t.Key)
+		if key == "" {
+			continue
+		}
+		// one-api / new-api 数据库中存储的 Key 不带 sk- 前缀，客户端使用时带前缀
+		if !strings.HasPrefix(key, "sk-") {
+			key = "sk-" + key
+		}
+		keyDraft := importKeyDraft{name: strings.TrimSpace(t.Name), key: key}
+		if keyDraft.name == "" {
+			keyDraft.name = fmt.Sprintf("token-%d", t.ID)
+		}
+		switch {
+		case t.Status != 1:
+			keyDraft.skip = "源系统中令牌已禁用或耗尽"
+		case t.ExpiredTime > 0 && t.ExpiredTime < now:
+			keyDraft.skip = "令牌已过期"
+		}
+		draft.users[idx].keys = append(draft.users[idx].keys, keyDraft)
+	}
+}
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+// draftChannels 以 "名称|类型|端点|BaseURL|Key|模型" 的形式列出解析出的渠道，跳过的渠道附带原因
+func draftChannels(draft *importDraft) []string {
+	result := make([]string, 0, len(draft.channels))
+	for _, d := range draft.channels {
+		ch := d.channel
+		models := make([]string, 0, len(ch.Models))
+		for _, m := range ch.Models {
+			if m.Alias != "" {
+				models = append(models, m.Alias+"->"+m.Name)
+			} else {
+				models = append(models, m.Name)
+			}
+		}
+		line := fmt.Sprintf("%s|%s|%s|%s|%s|%s", ch.Name, ch.Type, ch.Endpoint, ch.BaseURL, d.apiKey, strings.Join(models, ","))
+		if ch.Skipped {
+			line += " skipped: " + ch.Reason
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// draftUsers 以 "用户名: Key 名称=Key" 的形式列出解析出的用户与令牌，跳过的附带原因
+func draftUsers(draft *importDraft) []string {
+	result := make([]string, 0, len(draft.users))
+	for _, u := range draft.users {
+		line := u.username
+		if u.skip != "" {
+			line += " (" + u.skip + ")"
+		}
+		keys := make([]string, 0, len(u.keys))
+		for _, k := range u.keys {
+			key := k.name + "=" + k.key
+			if k.skip != "" {
+				key += " (" + k.skip + ")"
+			}
+			keys = append(keys, key)
+		}
+		result = append(result, line+": "+strings.Join(keys, ", "))
+	}
+	return result
+}
+
+func TestParseCLIProxyAPIConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		channels []string
+		users    []string
+		warnings int
+		wantErr  bool
+	}{
+		{
+			name: "all sections",
+			content: `
+api-keys: ["client-1", " ", "client-2"]
+gemini-api-key:
+  - api-key: g-key
+    models: [{name: gemini-2.5-pro, alias: gp}, {name: " "}]
+claude-api-key:
+  - api-key: c-key
+    base-url: https://claude.example.com/v1/
+    headers: {X-Team: a}
+codex-api-key:
+  - api-key: x-key
+openai-compatibility:
+  - name: openrouter
+    base-url: https://openrouter.ai/api/v1
+    api-keys: [or-1]
+    api-key-entries: [{api-key: or-2}]
+    models: [{name: moonshot/kimi, alias: kimi}]
+`,
+			channels: []string{
+				"gemini-api-key-1|gemini|generate_content|https://generativelanguage.googleapis.com|g-key|gp->gemini-2.5-pro",
+				"claude-api-key-1|claude|messages|https://claude.example.com|c-key|",
+				"codex-api-key-1|openai|responses|https://api.openai.com|x-key|",
+				"openrouter #1|openai|chat_completions|https://openrouter.ai/api|or-1|kimi->moonshot/kimi",
+				"openrouter #2|openai|chat_completions|https://openrouter.ai/api|or-2|kimi->moonshot/kimi",
+			},
+			users: []string{"cliproxyapi: cliproxyapi-1=client-1, cliproxyapi-3=client-2"},
+		},
+		{
+			name: "legacy scalar keys",
+			content: `
+generative-language-api-key: [legacy-1]
+gemini-api-key: [" scalar-1 "]
+`,
+			channels: []string{
+				"gemini-api-key-1|gemini|generate_content|https://generativelanguage.googleapis.com|scalar-1|",
+				"gemini-api-key-2|gemini|generate_content|https://generativelanguage.googleapis.com|legacy-1|",
+			},
+			users: []string{},
+		},
+		{
+			name: "missing fields",
+			content: `
+claude-api-key:
+  - base-url: https://claude.example.com
+  - api-key: c-key
+openai-compatibility:
+  - name: no-url
+    api-keys: [k]
+  - name: no-keys
+    base-url: https://compat.example.com/v1
+  - base-url: https://unnamed.example.com
+    api-keys: [u-key]
+`,
+			channels: []string{
+				"claude-api-key-2|claude|messages|https://api.anthropic.com|c-key|",
+				"openai-compatibility-3|openai|chat_completions|https://unnamed.example.com|u-key|",
+			},
+			users:    []string{},
+			warnings: 3,
+		},
+		{name: "empty", content: "", channels: []string{}, users: []string{}},
+		{name: "malformed yaml", content: "claude-api-key: [unclosed", wantErr: true},
+		{name: "wrong shape", content: "claude-api-key: {api-key: c-key}", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			draft, err := parseCLIProxyAPIConfig(tc.content)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", draftChannels(draft))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := draftChannels(draft); !reflect.DeepEqual(got, tc.channels) {
+				t.Errorf("channels =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tc.channels, "\n"))
+			}
+			if got := draftUsers(draft); !reflect.DeepEqual(got, tc.users) {
+				t.Errorf("users = %q, want %q", got, tc.users)
+			}
+			if len(draft.warnings) != tc.warnings {
+				t.Errorf("warnings = %q, want %d", draft.warnings, tc.warnings)
+			}
+		})
+	}
+}
+
+func TestParseOneAPIExport(t *testing.T) {
+	expired := time.Now().Add(-time.Hour).Unix()
+	future := time.Now().Add(time.Hour).Unix()
+	cases := []struct {
+		name     string
+		content  string
+		channels []string
+		users    []string
+		warnings int
+		wantErr  bool
+	}{
+		{
+			name: "channel array",
+			content: `[
+				{"id":1,"type":1,"key":"sk-a\n\n sk-b ","name":"main","status":1,"base_url":"https://proxy.example.com/v1","models":"gpt-4o, gpt-4o-mini,gpt-4o","priority":10,"weight":3},
+				{"id":2,"type":14,"key":"ak","name":"","status":2,"models":"claude-sonnet-4"},
+				{"id":3,"type":24,"key":"gk","name":"gem","status":1,"base_url":"","models":"gemini-pro","model_mapping":"{\"gemini-pro\":\"gemini-2.5-pro\",\"flash\":\"gemini-2.5-flash\"}"}
+			]`,
+			channels: []string{
+				"main #1|openai|chat_completions|https://proxy.example.com|sk-a|gpt-4o,gpt-4o-mini",
+				"main #2|openai|chat_completions|https://proxy.example.com|sk-b|gpt-4o,gpt-4o-mini",
+				"channel-2|claude|messages|https://api.anthropic.com|ak|claude-sonnet-4",
+				"gem|gemini|generate_content|https://generativelanguage.googleapis.com|gk|gemini-pro->gemini-2.5-pro,flash->gemini-2.5-flash",
+			},
+			users: []string{},
+		},
+		{
+			name:     "api response wrapper",
+			content:  `{"success":true,"data":[{"id":7,"type":1,"key":"k","name":"wrapped","status":1,"models":""}]}`,
+			channels: []string{"wrapped|openai|chat_completions|https://api.openai.com|k|"},
+			users:    []string{},
+		},
+		{
+			name: "missing fields and unsupported types",
+			content: `{"channels":[
+				{"id":1,"type":1,"key":"  ","name":"no-key","status":1,"models":"gpt-4o"},
+				{"id":2,"type":40,"key":"k2","name":"custom-no-url","status":1,"models":"m"},
+				{"id":3,"type":40,"key":"k3","name":"custom","status":1,"base_url":"https://custom.example.com","models":"m"},
+				{"id":4,"type":3,"key":"k4","name":"azure","status":1,"models":"gpt-4o"},
+				{"id":5,"type":1,"key":"k5","name":"bad-mapping","status":1,"models":"gpt-4o","model_mapping":"not json"}
+			]}`,
+			channels: []string{
+				"no-key|openai|chat_completions|https://api.openai.com||gpt-4o skipped: 缺少 API Key",
+				"custom-no-url|openai|chat_completions|||m skipped: 缺少 base_url",
+				"custom|openai|chat_completions|https://custom.example.com|k3|m",
+				"bad-mapping|openai|chat_completions|https://api.openai.com|k5|gpt-4o",
+			},
+			users: []string{},
+			// 两个未知类型按 OpenAI 兼容导入、Azure 不支持、model_mapping 无法解析
+			warnings: 4,
+		},
+		{
+			name: "users and tokens",
+			content: fmt.Sprintf(`{
+				"users":[{"id":1,"username":"alice","status":1},{"id":2,"username":"bob","status":2},{"id":3,"username":" ","status":1}],
+				"tokens":[
+					{"id":10,"user_id":1,"key":"abc","name":"laptop","status":1},
+					{"id":11,"user_id":1,"key":"sk-def","name":"","status":1,"expired_time":%d},
+					{"id":12,"user_id":1,"key":"ghi","name":"old","status":1,"expired_time":%d},
+					{"id":13,"user_id":1,"key":"jkl","name":"off","status":2},
+					{"id":14,"user_id":1,"key":" ","name":"empty","status":1},
+					{"id":15,"user_id":2,"key":"mno","name":"bob-key","status":1},
+					{"id":16,"user_id":3,"key":"pqr","name":"orphan","status":1},
+					{"id":17,"user_id":9,"key":"stu","name":"unknown","status":1}
+				]}`, future, expired),
+			channels: []string{},
+			users: []string{
+				"alice: laptop=sk-abc, token-11=sk-def, old=sk-ghi (令牌已过期), off=sk-jkl (源系统中令牌已禁用或耗尽)",
+				"bob (源系统中用户已禁用): bob-key=sk-mno",
+			},
+			// 缺少 username 的用户及其令牌、不存在的用户的令牌
+			warnings: 3,
+		},
+		{name: "malformed json", content: `{"channels":[`, wantErr: true},
+		{name: "malformed channel array", content: `[{"id":"one"}]`, wantErr: true},
+		{name: "malformed data array", content: `{"data":[{"id":"one"}]}`, wantErr: true},
+		{name: "not json", content: `channels: []`, wantErr: true},
+	}
+	for _, source := range []model.ChannelImportSource{model.ChannelImportSourceOneAPI, model.ChannelImportSourceNewAPI} {
+		for _, tc := range cases {
+			t.Run(string(source)+"/"+tc.name, func(t *testing.T) {
+				draft, err := parseOneAPIExport(source, tc.content)
+				if tc.wantErr {
+					if err == nil || !strings.Contains(err.Error(), string(source)) {
+						t.Fatalf("error = %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("parse: %v", err)
+				}
+				if got := draftChannels(draft); !reflect.DeepEqual(got, tc.channels) {
+					t.Errorf("channels =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tc.channels, "\n"))
+				}
+				if got := draftUsers(draft); !reflect.DeepEqual(got, tc.users) {
+					t.Errorf("users =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tc.users, "\n"))
+				}
+				if len(draft.warnings) != tc.warnings {
+					t.Errorf("warnings = %q, want %d", draft.warnings, tc.warnings)
+				}
+			})
+		}
+	}
+}
+
+func TestParseOneAPIChannelPriority(t *testing.T) {
+	cases := []struct {
+		priority *int64
+		weight   *int
+		wantPrio int
+		wantW    int
+	}{
+		{nil, nil, 100, 1},
+		{int64Ptr(0), intPtr(0), 100, 1},
+		{int64Ptr(30), intPtr(5), 70, 5},
+		{int64Ptr(-20), intPtr(-1), 120, 1},
+		// one-api 的优先级越大越优先，换算后不小于 1
+		{int64Ptr(500), nil, 1, 1},
+	}
+	for _, tc := range cases {
+		draft := &importDraft{}
+		parseOneAPIChannel(draft, "channels[0]", oneAPIChannel{ID: 1, Type: oneAPIChannelTypeOpenAI, Key: "k", Name: "c", Status: 1, Priority: tc.priority, Weight: tc.weight})
+		ch := draft.channels[0].channel
+		if ch.Priority != tc.wantPrio || ch.Weight != tc.wantW {
+			t.Errorf("priority %v weight %v = %d/%d, want %d/%d", tc.priority, tc.weight, ch.Priority, ch.Weight, tc.wantPrio, tc.wantW)
+		}
+	}
+}
+
+func intPtr(v int) *int       { return &v }
+func int64Ptr(v int64) *int64 { return &v }
+
+// 与已有渠道或导入数据中前面的渠道同名、以及重复的令牌在预览中标记为跳过
+func TestChannelImportDuplicates(t *testing.T) {
+	setupTestDB(t)
+	existing := &model.Channel{Type: model.ChannelTypeOpenAI, Endpoint: model.ChannelEndpointChatCompletions, Name: "taken", BaseURL: "https://api.openai.com", Enabled: true, ModelsJSON: "[]", HeadersJSON: "{}"}
+	if err := repository.NewChannelRepository().Create(existing); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	createTestUser(t, "carol", 0)
+
+	cases := []struct {
+		name    string
+		source  model.ChannelImportSource
+		content string
+		skipped map[string]string
+	}{
+		{
+			name:   "one-api",
+			source: model.ChannelImportSourceOneAPI,
+			content: `{"channels":[
+				{"id":1,"type":1,"key":"k1","name":"taken","status":1,"models":""},
+				{"id":2,"type":1,"key":"k2","name":"fresh","status":1,"models":""},
+				{"id":3,"type":1,"key":"k3","name":"fresh","status":1,"models":""}
+			]}`,
+			skipped: map[string]string{"channels[0]": "同名渠道已存在", "channels[2]": "同名渠道已存在"},
+		},
+		{
+			name:   "cliproxyapi",
+			source: model.ChannelImportSourceCLIProxyAPI,
+			content: `
+openai-compatibility:
+  - name: taken
+    base-url: https://compat.example.com
+    api-keys: [k1]
+  - name: dup
+    base-url: https://a.example.com
+    api-keys: [k2]
+  - name: dup
+    base-url: https://b.example.com
+    api-keys: [k3]
+`,
+			skipped: map[string]string{"openai-compatibility[0][0]": "同名渠道已存在", "openai-compatibility[2][0]": "同名渠道已存在"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := NewChannelImportService().Import(&model.ChannelImportRequest{Source: tc.source, Content: tc.content, DryRun: true})
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			if len(result.Channels) != 3 {
+				t.Fatalf("channels = %+v", result.Channels)
+			}
+			for _, ch := range result.Channels {
+				if reason := tc.skipped[ch.SourceRef]; ch.Skipped != (reason != "") || ch.Reason != reason {
+					t.Errorf("%s skipped = %v (%s), want %q", ch.SourceRef, ch.Skipped, ch.Reason, reason)
+				}
+			}
+			if result.CreatedChannels != 0 {
+				t.Errorf("dry run created %d channels", result.CreatedChannels)
+			}
+		})
+	}
+
+	t.Run("tokens", func(t *testing.T) {
+		content := `{
+			"users":[{"id":1,"username":"alice","status":1},{"id":2,"username":"dave","status":1},{"id":3,"username":"carol","status":1}],
+			"tokens":[
+				{"id":1,"user_id":1,"key":"same","name":"a","status":1},
+				{"id":2,"user_id":2,"key":"sk-same","name":"b","status":1},
+				{"id":3,"user_id":3,"key":"other","name":"c","status":1}
+			]}`
+		result, err := NewChannelImportService().Import(&model.ChannelImportRequest{Source: model.ChannelImportSourceNewAPI, Content: content, DryRun: true})
+		if err != nil {
+			t.Fatalf("import: %v", err)
+		}
+		var got []string
+		for _, u := range result.Users {
+			line := u.Username + " " + u.Reason
+			for _, k := range u.APIKeys {
+				line += " | " + k.Name + " " + k.Reason
+			}
+			got = append(got, strings.TrimSpace(line))
+		}
+		want := []string{
+			"alice  | a",
+			"dave  | b 导入数据中 Key 重复",
+			"carol " + ErrUsernameExists.Error() + " | c 所属用户未导入",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("users =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	})
+
+	if _, err := NewChannelImportService().Import(&model.ChannelImportRequest{Source: "litellm", Content: "x", DryRun: true}); err != ErrUnsupportedImportSource {
+		t.Errorf("unsupported source error = %v", err)
+	}
+	if _, err := NewChannelImportService().Import(&model.ChannelImportRequest{Source: model.ChannelImportSourceOneAPI, Content: "{", DryRun: true}); err == nil || !strings.Contains(err.Error(), ErrImportContentInvalid.Error()) {
+		t.Errorf("malformed content error = %v", err)
+	}
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+var ErrChannelModelsSourceEmpty = errors.New("源渠道未配置模型列表，无法复制")
+
+// BulkAddModels 向多个渠道追加模型，DryRun 时只返回变更预览
+func (s *ChannelService) BulkAddModels(req *model.ChannelModelsBulkAddRequest) (*model.ChannelModelsBulkResult, error) {
+	var additions []model.ChannelModel
+	var touched []string
+	for _, m := range req.Models {
+		name := strings.TrimSpace(m.Name)
+		if name == "" {
+			continue
+		}
+		entry := model.ChannelModel{Name: name, Alias: strings.TrimSpace(m.Alias), Weight: max(m.Weight, 0)}
+		additions = append(additions, entry)
+		touched = append(touched, entry.Name, entry.Alias)
+	}
+
+	return s.applyChannelModelChanges(req.ChannelIDs, req.DryRun, touched, func(_ *model.Channel, current []model.ChannelModel) ([]model.ChannelModel, string) {
+		return mergeChannelModels(current, additions), ""
+	})
+}
+
+// BulkRemoveModels 从多个渠道移除模型名或别名匹配的条目
+func (s *ChannelService) BulkRemoveModels(req *model.ChannelModelsBulkRemoveRequest) (*model.ChannelModelsBulkResult, error) {
+	return s.applyChannelModelChanges(req.ChannelIDs, req.DryRun, req.Models, func(_ *model.Channel, current []model.ChannelModel) ([]model.ChannelModel, string) {
+		after := make([]model.ChannelModel, 0, len(current))
+		for _, m := range current {
+			removed := false
+			for _, target := range req.Models {
+				if strings.EqualFold(m.Name, target) || (m.Alias != "" && strings.EqualFold(m.Alias, target)) {
+					removed = true
+					break
+				}
+			}
+			if !removed {
+				after = append(after, m)
+			}
+		}
+		return after, ""
+	})
+}
+
+// CopyModels 将源渠道的模型列表复制到其他同类型渠道
+func (s *ChannelService) CopyModels(sourceID string, req *model.ChannelModelsCopyRequest) (*model.ChannelModelsBulkResult, error) {
+	source, err := s.repo.GetByID(sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, ErrChannelNotFound
+	}
+	sourceModels, valid := getParsedModels(source.ModelsJSON)
+	if !valid || len(sourceModels) == 0 {
+		return nil, ErrChannelModelsSourceEmpty
+	}
+
+	var touched []string
+	for _, m := range sourceModels {
+		touched = append(touched, m.Name, m.Alias)
+	}
+
+	return s.applyChannelModelChanges(req.TargetChannelIDs, req.DryRun, touched, func(target *model.Channel, current []model.ChannelModel) ([]model.ChannelModel, string) {
+		switch {
+		case target.ID == source.ID:
+			return nil, "目标与源渠道相同"
+		case target.Type != source.Type:
+			return nil, "渠道类型不同"
+		case req.Mode == "merge":
+			return mergeChannelModels(current, sourceModels), ""
+		default:
+			return append([]model.ChannelModel(nil), sourceModels...), ""
+		}
+	})
+}
+
+// applyChannelModelChanges 对指定渠道计算新的模型列表（mutate 返回跳过原因时保持不变），
+// 非 DryRun 时在同一事务内写入，并返回涉及模型在变更后的路由预览
+func (s *ChannelService) applyChannelModelChanges(
+	channelIDs []string,
+	dryRun bool,
+	touchedModels []string,
+	mutate func(channel *model.Channel, current []model.ChannelModel) ([]model.ChannelModel, string),
+) (*model.ChannelModelsBulkResult, error) {
+	channels, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.Channel, len(channels))
+	for _, ch := range channels {
+		byID[ch.ID] = ch
+	}
+
+	result := &model.ChannelModelsBulkResult{DryRun: dryRun, Channels: []model.ChannelModelsChange{}}
+	var updates []*model.Channel
+	seen := make(map[string]bool, len(channelIDs))
+	for _, id := range channelIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		channel, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, id)
+		}
+
+		change := model.ChannelModelsChange{ChannelID: channel.ID, ChannelName: channel.Name, Added: []string{}, Removed: []string{}}
+		current, valid := getParsedModels(channel.ModelsJSON)
+		if current == nil {
+			current = []model.ChannelModel{}
+		}
+		change.Before, change.After = current, current
+		if !valid {
+			change.Skipped, change.Reason = true, "模型配置无法解析"
+			result.Channels = append(result.Channels, change)
+			continue
+		}
+
+		after, skip := mutate(channel, current)
+		if skip != "" {
+			change.Skipped, change.Reason = true, skip
+			result.Channels = append(result.Channels, change)
+			continue
+		}
+		if after == nil {
+			after = []model.ChannelModel{}
+		}
+		change.After = after
+		change.Added, change.Removed = diffChannelModels(current, after)
+		change.Changed = len(change.Added) > 0 || len(change.Removed) > 0
+		switch {
+		case len(current) == 0 && len(after) > 0:
+			change.Warning = "渠道原先按类型默认匹配，变更后只匹配列出的模型"
+		case len(current) > 0 && len(after) == 0:
+			change.Warning = "模型列表已清空，渠道将按类型默认匹配"
+		}
+		result.Channels = append(result.Channels, change)
+
+		if change.Changed {
+			modelsJSON, _ := json.Marshal(after)
+			updated := *channel
+			updated.ModelsJSON = string(modelsJSON)
+			updates = append(updates, &updated)
+		}
+	}
+
+	if !dryRun && len(updates) > 0 {
+		if err := s.repo.UpdateModelsBatch(updates); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				return nil, ErrChannelConflict
+			}
+			return nil, err
+		}
+	}
+
+	// 路由预览基于变更后的渠道状态（DryRun 时为假设状态）
+	for _, updated := range updates {
+		for i, ch := range channels {
+			if ch.ID == updated.ID {
+				channels[i] = updated
+			}
+		}
+	}
+	routing, err := s.previewModelRouting(channels, touchedModels, nil)
+	if err != nil {
+		return nil, err
+	}
+	result.Routing = routing
+	return result, nil
+}
+
+// PreviewModelRouting 预览模型名会被路由到哪些已启用渠道；
+// groupIDs 非 nil 时按该分组集合的用户视角过滤（空切片表示无分组用户）
+func (s *ChannelService) PreviewModelRouting(modelNames []string, groupIDs []string) ([]model.ModelRoutingPreview, error) {
+	channels, err := s.repo.ListEnabled()
+	if err != nil {
+		return nil, err
+	}
+	if len(modelNames) == 0 {
+		for _, ch := range channels {
+			models, _ := getParsedModels(ch.ModelsJSON)
+			for _, m := range models {
+				modelNames = append(modelNames, m.Name, m.Alias)
+			}
+		}
+	}
+	return s.previewModelRouting(channels, modelNames, groupIDs)
+}
+
+func (s *ChannelService) previewModelRouting(channels []*model.Channel, modelNames []string, groupIDs []string) ([]model.ModelRoutingPreview, error) {
+	var enabled []*model.Channel
+	var enabledIDs []string
+	for _, ch := range channels {
+		if ch.Enabled {
+			enabled = append(enabled, ch)
+			enabledIDs = append(enabledIDs, ch.ID)
+		}
+	}
+	channelGroupMap := map[string][]string{}
+	if len(enabledIDs) > 0 {
+		var err error
+		if channelGroupMap, err = s.repo.GetGroupIDsByChannelIDs(enabledIDs); err != nil {
+			return nil, err
+		}
+	}
+	userGroupIDSet := toStringSet(groupIDs)
+
+	// 通配符条目无法代表具体模型名，不参与预览
+	names := make([]string, 0, len(modelNames))
+	seen := make(map[string]bool, len(modelNames))
+	for _, name := range modelNames {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if name == "" || strings.Contains(name, "*") || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	previews := make([]model.ModelRoutingPreview, 0, len(names))
+	for _, name := range names {
+		preview := model.ModelRoutingPreview{Model: name, Channels: []model.ModelRouteCandidate{}}
+		minPriority := 0
+		for _, ch := range enabled {
+			kind, entry, ok := s.describeModelMatch(ch, name)
+			if !ok {
+				continue
+			}
+			chGroupIDs := channelGroupMap[ch.ID]
+			if groupIDs != nil && len(chGroupIDs) > 0 && !hasAnyInSet(userGroupIDSet, chGroupIDs) {
+				continue
+			}
+			if chGroupIDs == nil {
+				chGroupIDs = []string{}
+			}
+			if len(preview.Channels) == 0 || ch.Priority < minPriority {
+				minPriority = ch.Priority
+			}
+			preview.Channels = append(preview.Channels, model.ModelRouteCandidate{
+				ChannelID:    ch.ID,
+				ChannelName:  ch.Name,
+				Type:         ch.Type,
+				Priority:     ch.Priority,
+				GroupIDs:     chGroupIDs,
+				MatchKind:    kind,
+				MatchedEntry: entry,
+				Weight:       s.channelModelWeight(ch, name),
+			})
+		}
+
+		activeWeight := 0
+		for _, c := range preview.Channels {
+			if c.Priority == minPriority {
+				activeWeight += c.Weight
+			}
+		}
+		for i := range preview.Channels {
+			if preview.Channels[i].Priority == minPriority {
+				preview.Channels[i].Active = true
+				preview.Channels[i].TrafficShare = float64(preview.Channels[i].Weight) / float64(activeWeight)
+			}
+		}
+		sort.SliceStable(preview.Channels, func(i, j int) bool {
+			if preview.Channels[i].Priority != preview.Channels[j].Priority {
+				return preview.Channels[i].Priority < preview.Channels[j].Priority
+			}
+			return preview.Channels[i].ChannelName < preview.Channels[j].ChannelName
+		})
+		previews = append(previews, preview)
+	}
+	return previews, nil
+}
+
+// mergeChannelModels 追加 additions 中模型名+别名组合尚不存在的条目
+func mergeChannelModels(current, additions []model.ChannelModel) []model.ChannelModel {
+	merged := append([]model.ChannelModel(nil), current...)
+	exists := make(map[string]bool, len(current)+len(additions))
+	for _, m := range current {
+		exists[channelModelKey(m)] = true
+	}
+	for _, m := range additions {
+		if key := channelModelKey(m); !exists[key] {
+			exists[key] = true
+			merged = append(merged, m)
+		}
+	}
+	return merged
+}
+
+func diffChannelModels(before, after []model.ChannelModel) ([]string, []string) {
+	beforeSet := make(map[string]bool, len(before))
+	for _, m := range before {
+		beforeSet[channelModelKey(m)] = true
+	}
+	afterSet := make(map[string]bool, len(after))
+	added := []string{}
+	for _, m := range after {
+		key := channelModelKey(m)
+		afterSet[key] = true
+		if !beforeSet[key] {
+			added = append(added, channelModelLabel(m))
+		}
+	}
+	removed := []string{}
+	for _, m := range before {
+		if !afterSet[channelModelKey(m)] {
+			removed = append(removed, channelModelLabel(m))
+		}
+	}
+	return added, removed
+}
+
+func channelModelKey(m model.ChannelModel) string {
+	return strings.ToLower(m.Name) + "\x00" + strings.ToLower(m.Alias)
+}
+
+func channelModelLabel(m model.ChannelModel) string {
+	if m.Alias == "" {
+		return m.Name
+	}
+	return m.Alias + " -> " + m.Name
+}
@@ -0,0 +1,502 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/config"
+	"ampmanager/internal/crypto"
+	"ampmanager/internal/health"
+	"ampmanager/internal/model"
+	"ampmanager/internal/realtime"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// anthropicOAuthTokenURL claude.ai OAuth 的令牌接口，与 Claude Code 使用的地址一致
+var anthropicOAuthTokenURL = "https://console.anthropic.com/v1/oauth/token"
+
+const (
+	// anthropicOAuthClientID Claude Code 的公开 OAuth client_id，refresh token 只能由签发它的 client 刷新
+	anthropicOAuthClientID = "9d1c250a-e61b-44d9-88ed-5944d1962f5e"
+	// AnthropicOAuthBeta 以 OAuth 访问令牌调用 Anthropic API 时必需的 beta
+	AnthropicOAuthBeta = "oauth-2025-04-20"
+
+	// channelOAuthRefreshAhead 后台任务在访问令牌过期前多久刷新
+	channelOAuthRefreshAhead = 10 * time.Minute
+	// channelOAuthRequestSkew 请求路径上访问令牌剩余有效期不足该时长时先同步刷新
+	channelOAuthRequestSkew = time.Minute
+	// channelOAuthRefreshInterval 后台刷新任务的检查间隔
+	channelOAuthRefreshInterval = time.Minute
+	channelOAuthRefreshTimeout  = 30 * time.Second
+	// channelOAuthKeyID claude_oauth 渠道在密钥有效性状态中的密钥标识
+	channelOAuthKeyID = "oauth"
+
+	auditActionChannelOAuthUpdate = "channel.oauth_update"
+)
+
+var (
+	ErrChannelNotOAuth           = errors.New("该渠道不是 claude_oauth 类型")
+	ErrChannelOAuthNotConfigured = errors.New("渠道尚未配置 OAuth 令牌")
+	ErrChannelOAuthRefresh       = errors.New("刷新 OAuth 令牌失败")
+)
+
+var channelOAuthRepo = repository.NewChannelOAuthRepository()
+
+// channelOAuthCachedToken 解密后的访问令牌缓存，避免每个请求都查询与解密
+type channelOAuthCachedToken struct {
+	accessToken string
+	expiresAt   time.Time
+}
+
+var channelOAuthState struct {
+	mu    sync.Mutex
+	cache map[string]channelOAuthCachedToken
+	// locks 每个渠道同一时间只有一个刷新请求：refresh token 可能在刷新后轮换，并发刷新会使其中一个失效
+	locks map[string]*sync.Mutex
+}
+
+func init() {
+	channelOAuthState.cache = make(map[string]channelOAuthCachedToken)
+	channelOAuthState.locks = make(map[string]*sync.Mutex)
+}
+
+func channelOAuthLock(channelID string) *sync.Mutex {
+	channelOAuthState.mu.Lock()
+	defer channelOAuthState.mu.Unlock()
+	l, ok := channelOAuthState.locks[channelID]
+	if !ok {
+		l = &sync.Mutex{}
+		channelOAuthState.locks[channelID] = l
+	}
+	return l
+}
+
+func cachedChannelOAuthToken(channelID string, minValid time.Duration) (string, bool) {
+	channelOAuthState.mu.Lock()
+	defer channelOAuthState.mu.Unlock()
+	cached, ok := channelOAuthState.cache[channelID]
+	if !ok || time.Until(cached.expiresAt) < minValid {
+		return "", false
+	}
+	return cached.accessToken, true
+}
+
+func cacheChannelOAuthToken(channelID, accessToken string, expiresAt *time.Time) {
+	channelOAuthState.mu.Lock()
+	defer channelOAuthState.mu.Unlock()
+	if accessToken == "" || expiresAt == nil {
+		delete(channelOAuthState.cache, channelID)
+		return
+	}
+	channelOAuthState.cache[channelID] = channelOAuthCachedToken{accessToken: accessToken, expiresAt: *expiresAt}
+}
+
+// encryptChannelOAuthSecret 与上游 API Key 相同：配置 DATA_ENCRYPTION_KEY 时加密，否则明文存储并告警
+func encryptChannelOAuthSecret(value string) (string, error) {
+	encKey := config.Get().GetEncryptionKey()
+	if value == "" || encKey == nil {
+		if value != "" {
+			log.Warn("channel oauth: DATA_ENCRYPTION_KEY not set, storing OAuth token in plaintext")
+		}
+		return value, nil
+	}
+	encrypted, err := crypto.Encrypt([]byte(value), encKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt oauth token: %w", err)
+	}
+	return encrypted, nil
+}
+
+func decryptChannelOAuthSecret(stored string) string {
+	encKey := config.Get().GetEncryptionKey()
+	if stored == "" || encKey == nil {
+		return stored
+	}
+	decrypted, err := crypto.Decrypt(stored, encKey)
+	if err != nil {
+		// 开启加密前保存的令牌为明文
+		return stored
+	}
+	return string(decrypted)
+}
+
+// loadChannelOAuthToken 读取并解密渠道的令牌
+func loadChannelOAuthToken(channelID string) (*model.ChannelOAuthToken, error) {
+	token, err := channelOAuthRepo.Get(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || token.RefreshToken == "" {
+		return nil, ErrChannelOAuthNotConfigured
+	}
+	token.AccessToken = decryptChannelOAuthSecret(token.AccessToken)
+	token.RefreshToken = decryptChannelOAuthSecret(token.RefreshToken)
+	return token, nil
+}
+
+// saveChannelOAuthToken 加密后写入令牌并更新缓存
+func saveChannelOAuthToken(token *model.ChannelOAuthToken) error {
+	stored := *token
+	var err error
+	if stored.AccessToken, err = encryptChannelOAuthSecret(token.AccessToken); err != nil {
+		return err
+	}
+	if stored.RefreshToken, err = encryptChannelOAuthSecret(token.RefreshToken); err != nil {
+		return err
+	}
+	if err := channelOAuthRepo.Save(&stored); err != nil {
+		return err
+	}
+	cacheChannelOAuthToken(token.ChannelID, token.AccessToken, token.ExpiresAt)
+	return nil
+}
+
+// channelOAuthAccessToken 返回渠道当前可用的访问令牌，即将过期时先刷新
+func channelOAuthAccessToken(channelID string) (string, error) {
+	if token, ok := cachedChannelOAuthToken(channelID, channelOAuthRequestSkew); ok {
+		return token, nil
+	}
+
+	lock := channelOAuthLock(channelID)
+	lock.Lock()
+	defer lock.Unlock()
+	// 等待期间其他请求可能已完成刷新
+	if token, ok := cachedChannelOAuthToken(channelID, channelOAuthRequestSkew); ok {
+		return token, nil
+	}
+
+	token, err := loadChannelOAuthToken(channelID)
+	if err != nil {
+		return "", err
+	}
+	if token.AccessToken != "" && token.ExpiresAt != nil && time.Until(*token.ExpiresAt) >= channelOAuthRequestSkew {
+		cacheChannelOAuthToken(channelID, token.AccessToken, token.ExpiresAt)
+		return token.AccessToken, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), channelOAuthRefreshTimeout)
+	defer cancel()
+	refreshed, err := refreshChannelOAuthTokenLocked(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return refreshed.AccessToken, nil
+}
+
+// anthropicOAuthTokenError 令牌接口返回的错误响应
+type anthropicOAuthTokenError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *anthropicOAuthTokenError) Error() string {
+	return e.Message
+}
+
+// anthropicOAuthTokenResponse 令牌接口的响应，refresh_token 轮换时返回新值
+type anthropicOAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Scope        string `json:"scope"`
+}
+
+// refreshChannelOAuthTokenLocked 用 refresh token 换取新的访问令牌并保存，调用方需持有该渠道的刷新锁。
+// 失败时记录原因并推送 channel_oauth_refresh_failed 事件，原令牌保持不变；令牌接口拒绝 refresh token（HTTP 4xx）时
+// 将渠道标记为认证失败，路由不再选择该渠道，直到刷新成功或密钥有效性检查通过
+func refreshChannelOAuthTokenLocked(ctx context.Context, token *model.ChannelOAuthToken) (*model.ChannelOAuthToken, error) {
+	resp, err := requestAnthropicOAuthToken(ctx, token.RefreshToken)
+	if err != nil {
+		log.Warnf("channel oauth: 渠道 %s 刷新令牌失败: %v", token.ChannelID, err)
+		if recErr := channelOAuthRepo.SetLastError(token.ChannelID, err.Error()); recErr != nil {
+			log.Errorf("channel oauth: 记录渠道 %s 刷新失败原因失败: %v", token.ChannelID, recErr)
+		}
+		// 连接失败或 5xx 无法判断 refresh token 是否有效，不改变渠道状态
+		var tokenErr *anthropicOAuthTokenError
+		if errors.As(err, &tokenErr) && tokenErr.StatusCode >= 400 && tokenErr.StatusCode < 500 {
+			health.RecordKeyCheck(token.ChannelID, 1, []health.KeyCheckResult{{KeyID: channelOAuthKeyID, Conclusive: true, Error: err.Error()}})
+		}
+		realtime.Broadcast("channel_oauth_refresh_failed", map[string]string{"channelId": token.ChannelID, "error": err.Error()})
+		return nil, fmt.Errorf("%w: %v", ErrChannelOAuthRefresh, err)
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(time.Duration(resp.ExpiresIn) * time.Second)
+	refreshed := &model.ChannelOAuthToken{
+		ChannelID:     token.ChannelID,
+		AccessToken:   resp.AccessToken,
+		RefreshToken:  token.RefreshToken,
+		ExpiresAt:     &expiresAt,
+		Scope:         token.Scope,
+		LastRefreshAt: &now,
+	}
+	if resp.RefreshToken != "" {
+		refreshed.RefreshToken = resp.RefreshToken
+	}
+	if resp.Scope != "" {
+		refreshed.Scope = resp.Scope
+	}
+	if err := saveChannelOAuthToken(refreshed); err != nil {
+		return nil, err
+	}
+	health.RecordKeyCheck(token.ChannelID, 1, []health.KeyCheckResult{{KeyID: channelOAuthKeyID, Valid: true, Conclusive: true}})
+	log.Infof("channel oauth: 渠道 %s 令牌已刷新，有效期至 %s", token.ChannelID, expiresAt.Format(time.RFC3339))
+	return refreshed, nil
+}
+
+func requestAnthropicOAuthToken(ctx context.Context, refreshToken string) (*anthropicOAuthTokenResponse, error) {
+	body, _ := json.Marshal(map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": refreshToken,
+		"client_id":     anthropicOAuthClientID,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, anthropicOAuthTokenURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌接口失败: %v", err)
+	}
+	defer httpResp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(httpResp.Body, 64<<10))
+	if httpResp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		tokenErr := &anthropicOAuthTokenError{StatusCode: httpResp.StatusCode, Message: fmt.Sprintf("HTTP %d", httpResp.StatusCode)}
+		if json.Unmarshal(respBody, &oauthErr) == nil && oauthErr.Error != "" {
+			tokenErr.Message = fmt.Sprintf("HTTP %d: %s %s", httpResp.StatusCode, oauthErr.Error, oauthErr.ErrorDescription)
+		}
+		return nil, tokenErr
+	}
+
+	var resp anthropicOAuthTokenResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("解析令牌响应失败: %v", err)
+	}
+	if resp.AccessToken == "" || resp.ExpiresIn <= 0 {
+		return nil, errors.New("令牌响应缺少 access_token 或 expires_in")
+	}
+	return &resp, nil
+}
+
+// setAnthropicAuth 设置 Anthropic 渠道的认证请求头：claude_oauth 以 Bearer 发送访问令牌并声明 OAuth beta
+func setAnthropicAuth(req *http.Request, channelType model.ChannelType, key string) {
+	if channelType == model.ChannelTypeClaudeOAuth {
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("anthropic-beta", AnthropicOAuthBeta)
+	} else {
+		req.Header.Set("x-api-key", key)
+	}
+	req.Header.Set("anthropic-version", "2023-06-01")
+}
+
+// ChannelOAuthService 管理 claude_oauth 渠道的令牌
+type ChannelOAuthService struct {
+	channelRepo *repository.ChannelRepository
+}
+
+func NewChannelOAuthService() *ChannelOAuthService {
+	return &ChannelOAuthService{channelRepo: repository.NewChannelRepository()}
+}
+
+func (s *ChannelOAuthService) getOAuthChannel(channelID string) (*model.Channel, error) {
+	channel, err := s.channelRepo.GetByID(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, ErrChannelNotFound
+	}
+	if channel.Type != model.ChannelTypeClaudeOAuth {
+		return nil, ErrChannelNotOAuth
+	}
+	return channel, nil
+}
+
+// Status 返回渠道的令牌状态
+func (s *ChannelOAuthService) Status(channelID string) (*model.ChannelOAuthStatus, error) {
+	if _, err := s.getOAuthChannel(channelID); err != nil {
+		return nil, err
+	}
+	token, err := channelOAuthRepo.Get(channelID)
+	if err != nil {
+		return nil, err
+	}
+	status := &model.ChannelOAuthStatus{ChannelID: channelID}
+	if token != nil && token.RefreshToken != "" {
+		status.Configured = true
+		status.ExpiresAt = token.ExpiresAt
+		status.Scope = token.Scope
+		status.LastRefreshAt = token.LastRefreshAt
+		status.LastError = token.LastError
+	}
+	return status, nil
+}
+
+// SetToken 保存管理员提供的令牌，未提供访问令牌或过期时间时立即刷新一次以验证 refresh token
+func (s *ChannelOAuthService) SetToken(actor, channelID string, req *model.SetChannelOAuthTokenRequest) (*model.ChannelOAuthStatus, error) {
+	if _, err := s.getOAuthChannel(channelID); err != nil {
+		return nil, err
+	}
+
+	token := &model.ChannelOAuthToken{
+		ChannelID:    channelID,
+		AccessToken:  strings.TrimSpace(req.AccessToken),
+		RefreshToken: strings.TrimSpace(req.RefreshToken),
+		Scope:        strings.Join(req.Scopes, " "),
+	}
+	if req.ExpiresAt > 0 {
+		expiresAt := time.UnixMilli(req.ExpiresAt).UTC()
+		token.ExpiresAt = &expiresAt
+	}
+	if token.AccessToken == "" {
+		token.ExpiresAt = nil
+	}
+
+	lock := channelOAuthLock(channelID)
+	lock.Lock()
+	if err := saveChannelOAuthToken(token); err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	var refreshErr error
+	refreshNow := token.ExpiresAt == nil || time.Until(*token.ExpiresAt) < channelOAuthRefreshAhead
+	if refreshNow {
+		ctx, cancel := context.WithTimeout(context.Background(), channelOAuthRefreshTimeout)
+		_, refreshErr = refreshChannelOAuthTokenLocked(ctx, token)
+		cancel()
+	}
+	lock.Unlock()
+
+	recordAudit(actor, auditActionChannelOAuthUpdate, auditTargetChannel, channelID, map[string]interface{}{
+		"scope":     token.Scope,
+		"refreshed": refreshNow && refreshErr == nil,
+	})
+	if refreshErr != nil {
+		return nil, refreshErr
+	}
+	return s.Status(channelID)
+}
+
+// Refresh 立即刷新渠道的访问令牌
+func (s *ChannelOAuthService) Refresh(ctx context.Context, channelID string) (*model.ChannelOAuthStatus, error) {
+	if _, err := s.getOAuthChannel(channelID); err != nil {
+		return nil, err
+	}
+	lock := channelOAuthLock(channelID)
+	lock.Lock()
+	token, err := loadChannelOAuthToken(channelID)
+	if err == nil {
+		_, err = refreshChannelOAuthTokenLocked(ctx, token)
+	}
+	lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.Status(channelID)
+}
+
+// checkChannelOAuth 密钥有效性检查：claude_oauth 渠道以当前访问令牌探测一次，令牌刷新失败同样视为认证失败
+func checkChannelOAuth(channel *model.Channel, timeout time.Duration) (model.ChannelAuthStatus, bool) {
+	wasFailed := health.IsAuthFailed(channel.ID)
+	result := health.KeyCheckResult{KeyID: channelOAuthKeyID, Conclusive: true}
+	accessToken, err := channelOAuthAccessToken(channel.ID)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		probe, statusCode := probeChannelKey(channel, accessToken, timeout)
+		switch {
+		case isAuthFailureStatus(statusCode):
+			result.Error = probe.Message
+		case statusCode >= 200 && statusCode < 300:
+			result.Valid = true
+		default:
+			result.Conclusive = false
+			result.Error = probe.Message
+		}
+	}
+	status, _ := health.RecordKeyCheck(channel.ID, 1, []health.KeyCheckResult{result})
+	status.ChannelName = channel.Name
+	// 刷新失败时已先记录认证失败，按检查前的状态判断是否为新发现的失效
+	return status, result.Conclusive && !result.Valid && !wasFailed
+}
+
+// refreshExpiringChannelOAuthTokens 刷新即将过期的访问令牌，使请求路径上不必同步刷新
+func refreshExpiringChannelOAuthTokens() {
+	tokens, err := channelOAuthRepo.ListExpiringBefore(time.Now().UTC().Add(channelOAuthRefreshAhead))
+	if err != nil {
+		log.Errorf("channel oauth: 查询即将过期的令牌失败: %v", err)
+		return
+	}
+	for _, stored := range tokens {
+		lock := channelOAuthLock(stored.ChannelID)
+		lock.Lock()
+		token, err := loadChannelOAuthToken(stored.ChannelID)
+		// 持锁后重新读取，期间可能已被请求路径刷新
+		if err == nil && (token.ExpiresAt == nil || time.Until(*token.ExpiresAt) < channelOAuthRefreshAhead) {
+			ctx, cancel := context.WithTimeout(context.Background(), channelOAuthRefreshTimeout)
+			_, _ = refreshChannelOAuthTokenLocked(ctx, token)
+			cancel()
+		}
+		lock.Unlock()
+	}
+}
+
+// ChannelOAuthRefresher 定期在访问令牌过期前刷新 claude_oauth 渠道的令牌
+type ChannelOAuthRefresher struct {
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+var globalChannelOAuthRefresher *ChannelOAuthRefresher
+
+// InitChannelOAuthRefresher 启动全局 OAuth 令牌刷新任务
+func InitChannelOAuthRefresher() {
+	globalChannelOAuthRefresher = &ChannelOAuthRefresher{stopChan: make(chan struct{})}
+	globalChannelOAuthRefresher.wg.Add(1)
+	go globalChannelOAuthRefresher.run()
+	log.Info("channel oauth: refresher started")
+}
+
+// StopChannelOAuthRefresher 停止全局 OAuth 令牌刷新任务
+func StopChannelOAuthRefresher() {
+	if globalChannelOAuthRefresher == nil {
+		return
+	}
+	globalChannelOAuthRefresher.stopOnce.Do(func() { close(globalChannelOAuthRefresher.stopChan) })
+	globalChannelOAuthRefresher.wg.Wait()
+	log.Info("channel oauth: refresher stopped")
+}
+
+func (r *ChannelOAuthRefresher) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(channelOAuthRefreshInterval)
+	defer ticker.Stop()
+
+	refreshExpiringChannelOAuthTokens()
+	for {
+		select {
+		case <-ticker.C:
+			refreshExpiringChannelOAuthTokens()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
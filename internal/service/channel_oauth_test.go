@@ -0,0 +1,214 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ampmanager/internal/config"
+	"ampmanager/internal/database"
+	"ampmanager/internal/health"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+// setupOAuthChannel 初始化数据库与加密密钥，创建一个 claude_oauth 渠道
+func setupOAuthChannel(t *testing.T) *model.Channel {
+	t.Helper()
+	setupTestDB(t)
+	t.Setenv("DATA_ENCRYPTION_KEY", strings.Repeat("k", 32))
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	channel := &model.Channel{
+		Type:        model.ChannelTypeClaudeOAuth,
+		Endpoint:    model.ChannelEndpointMessages,
+		Name:        "claude-oauth",
+		BaseURL:     "https://api.anthropic.com",
+		Enabled:     true,
+		ModelsJSON:  "[]",
+		HeadersJSON: "{}",
+	}
+	if err := repository.NewChannelRepository().Create(channel); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	return channel
+}
+
+// withOAuthTokenEndpoint 将令牌接口指向测试服务器，返回收到的刷新请求数
+func withOAuthTokenEndpoint(t *testing.T, handler http.HandlerFunc) *int32 {
+	t.Helper()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	prev := anthropicOAuthTokenURL
+	anthropicOAuthTokenURL = srv.URL
+	t.Cleanup(func() { anthropicOAuthTokenURL = prev })
+	return &hits
+}
+
+// saveExpiredOAuthToken 保存一个已过期的访问令牌，下次取用时需要刷新
+func saveExpiredOAuthToken(t *testing.T, channelID string) {
+	t.Helper()
+	expiresAt := time.Now().UTC().Add(-time.Minute)
+	token := &model.ChannelOAuthToken{ChannelID: channelID, AccessToken: "at-old", RefreshToken: "rt-old", ExpiresAt: &expiresAt, Scope: "user:inference"}
+	if err := saveChannelOAuthToken(token); err != nil {
+		t.Fatalf("save token: %v", err)
+	}
+}
+
+func writeTokenResponse(w http.ResponseWriter, accessToken, refreshToken string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    3600,
+	})
+}
+
+func TestChannelOAuthRefresh(t *testing.T) {
+	channel := setupOAuthChannel(t)
+	hits := withOAuthTokenEndpoint(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if r.Method != http.MethodPost || body["grant_type"] != "refresh_token" || body["refresh_token"] != "rt-old" || body["client_id"] != anthropicOAuthClientID {
+			t.Errorf("refresh request = %s %v", r.Method, body)
+		}
+		writeTokenResponse(w, "at-new", "rt-new")
+	})
+	saveExpiredOAuthToken(t, channel.ID)
+	// 之前被标记为认证失败的渠道在刷新成功后恢复
+	health.RecordKeyCheck(channel.ID, 1, []health.KeyCheckResult{{KeyID: channelOAuthKeyID, Conclusive: true, Error: "认证失败 (HTTP 401)"}})
+
+	before := time.Now().UTC()
+	accessToken, err := channelOAuthAccessToken(channel.ID)
+	if err != nil {
+		t.Fatalf("access token: %v", err)
+	}
+	if accessToken != "at-new" {
+		t.Errorf("access token = %q", accessToken)
+	}
+	if health.IsAuthFailed(channel.ID) {
+		t.Error("channel still auth failed after successful refresh")
+	}
+
+	token, err := loadChannelOAuthToken(channel.ID)
+	if err != nil {
+		t.Fatalf("load token: %v", err)
+	}
+	if token.AccessToken != "at-new" || token.RefreshToken != "rt-new" || token.Scope != "user:inference" || token.LastError != "" || token.LastRefreshAt == nil {
+		t.Errorf("stored token = %+v", token)
+	}
+	if token.ExpiresAt == nil || token.ExpiresAt.Before(before.Add(time.Hour-time.Second)) || token.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("expires at = %v", token.ExpiresAt)
+	}
+	var storedAccess, storedRefresh string
+	if err := database.GetDB().QueryRow(`SELECT access_token, refresh_token FROM channel_oauth_tokens WHERE channel_id = ?`, channel.ID).Scan(&storedAccess, &storedRefresh); err != nil {
+		t.Fatalf("read stored token: %v", err)
+	}
+	if storedAccess == "at-new" || storedRefresh == "rt-new" {
+		t.Error("tokens stored in plaintext")
+	}
+
+	// 新令牌在有效期内直接使用，不再刷新
+	if accessToken, err := channelOAuthAccessToken(channel.ID); err != nil || accessToken != "at-new" {
+		t.Errorf("second access token = %q, %v", accessToken, err)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Errorf("refresh requests = %d, want 1", n)
+	}
+}
+
+func TestChannelOAuthRefreshFailure(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		body       string
+		authFailed bool
+	}{
+		// refresh token 被撤销：渠道标记为认证失败，不再参与路由
+		{"rejected", http.StatusBadRequest, `{"error":"invalid_grant","error_description":"Refresh token revoked"}`, true},
+		{"unauthorized", http.StatusUnauthorized, `{}`, true},
+		// 令牌接口暂时不可用时无法判断 refresh token 是否有效
+		{"upstream error", http.StatusServiceUnavailable, `overloaded`, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			channel := setupOAuthChannel(t)
+			withOAuthTokenEndpoint(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			})
+			saveExpiredOAuthToken(t, channel.ID)
+
+			_, err := channelOAuthAccessToken(channel.ID)
+			if !errors.Is(err, ErrChannelOAuthRefresh) {
+				t.Fatalf("error = %v, want ErrChannelOAuthRefresh", err)
+			}
+			if health.IsAuthFailed(channel.ID) != tc.authFailed {
+				t.Errorf("auth failed = %v, want %v (status %+v)", health.IsAuthFailed(channel.ID), tc.authFailed, health.AuthStatus(channel.ID))
+			}
+			if tc.authFailed {
+				if status := health.AuthStatus(channel.ID); status == nil || !strings.Contains(status.LastError, "HTTP ") {
+					t.Errorf("auth status = %+v", status)
+				}
+			}
+
+			// 原令牌保持不变，失败原因可在令牌状态中查看
+			token, err := loadChannelOAuthToken(channel.ID)
+			if err != nil {
+				t.Fatalf("load token: %v", err)
+			}
+			if token.AccessToken != "at-old" || token.RefreshToken != "rt-old" || token.LastRefreshAt != nil {
+				t.Errorf("stored token = %+v", token)
+			}
+			if !strings.Contains(token.LastError, "HTTP ") {
+				t.Errorf("last error = %q", token.LastError)
+			}
+		})
+	}
+}
+
+func TestChannelOAuthConcurrentRefresh(t *testing.T) {
+	channel := setupOAuthChannel(t)
+	hits := withOAuthTokenEndpoint(t, func(w http.ResponseWriter, r *http.Request) {
+		// 放慢响应，让其余请求在刷新进行中到达
+		time.Sleep(50 * time.Millisecond)
+		writeTokenResponse(w, "at-new", "rt-new")
+	})
+	saveExpiredOAuthToken(t, channel.ID)
+
+	const workers = 20
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	tokens := make([]string, workers)
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			tokens[i], errs[i] = channelOAuthAccessToken(channel.ID)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i := range tokens {
+		if errs[i] != nil || tokens[i] != "at-new" {
+			t.Errorf("worker %d = %q, %v", i, tokens[i], errs[i])
+		}
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Errorf("refresh requests = %d, want 1", n)
+	}
+}
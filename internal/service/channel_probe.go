@@ -0,0 +1,303 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/translator"
+)
+
+const (
+	// maxChannelProbeBodyBytes 测试请求读取的上游响应上限
+	maxChannelProbeBodyBytes = 4 << 20
+	// channelTestMaxContentRunes 测试结果中保留的回复长度
+	channelTestMaxContentRunes = 200
+	defaultChannelTestPrompt   = "Reply with the single word: OK"
+)
+
+// channelTestClientFormats 测试时检查翻译的客户端格式
+var channelTestClientFormats = []translator.Format{
+	translator.FormatClaude,
+	translator.FormatOpenAIChat,
+	translator.FormatOpenAIResponses,
+	translator.FormatGemini,
+}
+
+// testModelName 选择测试用的上游模型：优先使用指定的模型（别名解析为上游模型名），
+// 其次为渠道配置的第一个非通配模型，最后为上游模型列表中第一个符合渠道类型的模型
+func (s *ChannelService) testModelName(channel *model.Channel, requested string, detected []string) string {
+	if requested = strings.TrimSpace(requested); requested != "" {
+		if _, m, ok := s.matchChannelModel(channel, requested); ok && m != nil && !strings.Contains(m.Name, "*") {
+			return m.Name
+		}
+		return requested
+	}
+	if models, _ := getParsedModels(channel.ModelsJSON); len(models) > 0 {
+		for _, m := range models {
+			if !strings.Contains(m.Name, "*") {
+				return m.Name
+			}
+		}
+	}
+	for _, id := range detected {
+		if s.defaultModelMatch(channel.Type, id) {
+			return id
+		}
+	}
+	return ""
+}
+
+// channelNativeFormat 渠道上游使用的请求格式
+func channelNativeFormat(channel *model.Channel) translator.Format {
+	switch channel.Type.Protocol() {
+	case model.ChannelTypeClaude:
+		return translator.FormatClaude
+	case model.ChannelTypeGemini:
+		return translator.FormatGemini
+	case model.ChannelTypeOllama:
+		if channel.Endpoint == model.ChannelEndpointGenerate {
+			return translator.FormatOllamaGenerate
+		}
+		return translator.FormatOllamaChat
+	default:
+		if channel.Endpoint == model.ChannelEndpointResponses {
+			return translator.FormatOpenAIResponses
+		}
+		return translator.FormatOpenAIChat
+	}
+}
+
+// buildChannelTestRequest 构造指定格式的简短对话请求，返回请求体与上游路径
+func buildChannelTestRequest(format translator.Format, modelName, prompt string) ([]byte, string) {
+	var payload map[string]interface{}
+	path := ""
+	switch format {
+	case translator.FormatClaude:
+		path = "/v1/messages"
+		payload = map[string]interface{}{
+			"model":      modelName,
+			"max_tokens": 32,
+			"messages":   []interface{}{map[string]interface{}{"role": "user", "content": prompt}},
+		}
+	case translator.FormatOpenAIResponses:
+		path = "/v1/responses"
+		payload = map[string]interface{}{"model": modelName, "input": prompt}
+	case translator.FormatGemini:
+		path = "/v1beta/models/" + url.PathEscape(strings.TrimPrefix(modelName, "models/")) + ":generateContent"
+		payload = map[string]interface{}{
+			"contents": []interface{}{map[string]interface{}{
+				"role":  "user",
+				"parts": []interface{}{map[string]interface{}{"text": prompt}},
+			}},
+		}
+	case translator.FormatOllamaChat:
+		path = "/api/chat"
+		payload = map[string]interface{}{
+			"model":    modelName,
+			"stream":   false,
+			"messages": []interface{}{map[string]interface{}{"role": "user", "content": prompt}},
+		}
+	case translator.FormatOllamaGenerate:
+		path = "/api/generate"
+		payload = map[string]interface{}{"model": modelName, "stream": false, "prompt": prompt}
+	default:
+		path = "/v1/chat/completions"
+		payload = map[string]interface{}{
+			"model":    modelName,
+			"messages": []interface{}{map[string]interface{}{"role": "user", "content": prompt}},
+		}
+	}
+	body, _ := json.Marshal(payload)
+	return body, path
+}
+
+// testChannelCompletion 以渠道的原生格式发送一次非流式对话请求，并检查其他客户端格式的翻译
+func testChannelCompletion(channel *model.Channel, apiKey, modelName, prompt string, timeout time.Duration) *model.ChannelCompletionTest {
+	result := &model.ChannelCompletionTest{Model: modelName}
+	if strings.TrimSpace(prompt) == "" {
+		prompt = defaultChannelTestPrompt
+	}
+	format := channelNativeFormat(channel)
+	body, path := buildChannelTestRequest(format, modelName, prompt)
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(channel.BaseURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		result.Message = fmt.Sprintf("创建请求失败: %v", err)
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var headers map[string]string
+	_ = json.Unmarshal([]byte(channel.HeadersJSON), &headers)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	switch channel.Type.Protocol() {
+	case model.ChannelTypeClaude:
+		setAnthropicAuth(req, channel.Type, apiKey)
+	case model.ChannelTypeGemini:
+		req.Header.Set("x-goog-api-key", apiKey)
+	case model.ChannelTypeOllama:
+		setOllamaAuth(req, apiKey)
+	default:
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	start := time.Now()
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Message = fmt.Sprintf("连接失败: %v", err)
+		return result
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxChannelProbeBodyBytes))
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.StatusCode = resp.StatusCode
+	if err != nil {
+		result.Message = fmt.Sprintf("读取响应失败: %v", err)
+		return result
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Message = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, truncateRunes(strings.TrimSpace(string(respBody)), 500))
+		if channel.SimulateCLI {
+			result.Message += "（渠道启用了客户端模拟，测试请求未模拟客户端，上游可能因此拒绝）"
+		}
+		return result
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		result.Message = "响应不是有效的 JSON"
+		return result
+	}
+	result.Success = true
+	result.Content = truncateRunes(extractTestCompletionText(format, parsed), channelTestMaxContentRunes)
+	result.InputTokens, result.OutputTokens = extractTestCompletionUsage(format, parsed)
+	result.Translations = checkChannelTranslations(format, modelName, prompt, respBody)
+	return result
+}
+
+// checkChannelTranslations 对已注册翻译器的客户端格式，翻译测试请求并把本次上游响应翻译回客户端格式
+func checkChannelTranslations(upstream translator.Format, modelName, prompt string, upstreamBody []byte) []model.ChannelTranslationCheck {
+	var checks []model.ChannelTranslationCheck
+	for _, client := range channelTestClientFormats {
+		if client == upstream || !translator.HasResponseTransformer(client, upstream) {
+			continue
+		}
+		check := model.ChannelTranslationCheck{Format: client.String()}
+		clientBody, _ := buildChannelTestRequest(client, modelName, prompt)
+		converted, err := translator.TranslateRequest(client, upstream, modelName, clientBody, false)
+		if err != nil {
+			check.Error = fmt.Sprintf("请求翻译失败: %v", err)
+			checks = append(checks, check)
+			continue
+		}
+		var param any
+		out, err := translator.TranslateNonStream(context.Background(), client, upstream, modelName, clientBody, converted, upstreamBody, &param)
+		switch {
+		case err != nil:
+			check.Error = fmt.Sprintf("响应翻译失败: %v", err)
+		case !json.Valid([]byte(out)):
+			check.Error = "响应翻译结果不是有效的 JSON"
+		default:
+			check.Success = true
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func extractTestCompletionText(format translator.Format, payload map[string]interface{}) string {
+	var sb strings.Builder
+	switch format {
+	case translator.FormatClaude:
+		for _, block := range jsonArray(payload["content"]) {
+			if text, ok := jsonObject(block)["text"].(string); ok {
+				sb.WriteString(text)
+			}
+		}
+	case translator.FormatOpenAIResponses:
+		if text, ok := payload["output_text"].(string); ok {
+			return text
+		}
+		for _, item := range jsonArray(payload["output"]) {
+			for _, part := range jsonArray(jsonObject(item)["content"]) {
+				if text, ok := jsonObject(part)["text"].(string); ok {
+					sb.WriteString(text)
+				}
+			}
+		}
+	case translator.FormatGemini:
+		candidates := jsonArray(payload["candidates"])
+		if len(candidates) > 0 {
+			for _, part := range jsonArray(jsonObject(jsonObject(candidates[0])["content"])["parts"]) {
+				if text, ok := jsonObject(part)["text"].(string); ok {
+					sb.WriteString(text)
+				}
+			}
+		}
+	case translator.FormatOllamaChat:
+		if text, ok := jsonObject(payload["message"])["content"].(string); ok {
+			return text
+		}
+	case translator.FormatOllamaGenerate:
+		if text, ok := payload["response"].(string); ok {
+			return text
+		}
+	default:
+		choices := jsonArray(payload["choices"])
+		if len(choices) > 0 {
+			if text, ok := jsonObject(jsonObject(choices[0])["message"])["content"].(string); ok {
+				sb.WriteString(text)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func extractTestCompletionUsage(format translator.Format, payload map[string]interface{}) (int, int) {
+	switch format {
+	case translator.FormatClaude, translator.FormatOpenAIResponses:
+		usage := jsonObject(payload["usage"])
+		return jsonInt(usage["input_tokens"]), jsonInt(usage["output_tokens"])
+	case translator.FormatGemini:
+		usage := jsonObject(payload["usageMetadata"])
+		return jsonInt(usage["promptTokenCount"]), jsonInt(usage["candidatesTokenCount"])
+	case translator.FormatOllamaChat, translator.FormatOllamaGenerate:
+		return jsonInt(payload["prompt_eval_count"]), jsonInt(payload["eval_count"])
+	default:
+		usage := jsonObject(payload["usage"])
+		return jsonInt(usage["prompt_tokens"]), jsonInt(usage["completion_tokens"])
+	}
+}
+
+func jsonObject(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func jsonArray(v interface{}) []interface{} {
+	a, _ := v.([]interface{})
+	return a
+}
+
+func jsonInt(v interface{}) int {
+	f, _ := v.(float64)
+	return int(f)
+}
+
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "..."
+}
@@ -0,0 +1,488 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+var (
+	ErrChannelTemplateNotFound       = errors.New("渠道模板不存在")
+	ErrChannelTemplateNameExists     = errors.New("渠道模板名称已存在")
+	ErrChannelTemplateBuiltin        = errors.New("内置模板不可修改或删除")
+	ErrChannelTemplateUnresolved     = errors.New("模板中存在未填写的占位符")
+	ErrChannelTemplateBaseURLInvalid = errors.New("Base URL 无效，请填写 http(s) 地址")
+	ErrBulkCreateSourceInvalid       = errors.New("需指定 templateId 或 sourceChannelId 其中之一")
+)
+
+// builtinChannelTemplates 各上游的默认配置，模型列表留空即按渠道类型默认匹配
+var builtinChannelTemplates = []*model.ChannelTemplate{
+	{
+		ID:          "builtin-gemini",
+		Name:        "Google Gemini",
+		Description: "Gemini API（AI Studio Key）",
+		Type:        model.ChannelTypeGemini,
+		Endpoint:    model.ChannelEndpointGenerateContent,
+		BaseURL:     "https://generativelanguage.googleapis.com",
+	},
+	{
+		ID:          "builtin-claude",
+		Name:        "Anthropic Claude",
+		Description: "Anthropic Messages API",
+		Type:        model.ChannelTypeClaude,
+		Endpoint:    model.ChannelEndpointMessages,
+		BaseURL:     "https://api.anthropic.com",
+	},
+	{
+		ID:          "builtin-openai",
+		Name:        "OpenAI",
+		Description: "OpenAI Responses API",
+		Type:        model.ChannelTypeOpenAI,
+		Endpoint:    model.ChannelEndpointResponses,
+		BaseURL:     "https://api.openai.com",
+	},
+	{
+		ID:          "builtin-openai-compatible",
+		Name:        "OpenAI 兼容接口",
+		Description: "任意 Chat Completions 兼容服务，创建时填写 Base URL",
+		Type:        model.ChannelTypeOpenAI,
+		Endpoint:    model.ChannelEndpointChatCompletions,
+		BaseURL:     model.ChannelTemplatePlaceholderBaseURL,
+	},
+	{
+		ID:          "builtin-ollama",
+		Name:        "Ollama",
+		Description: "本地 Ollama 服务（/api/chat），无需 API Key",
+		Type:        model.ChannelTypeOllama,
+		Endpoint:    model.ChannelEndpointChat,
+		BaseURL:     "http://localhost:11434",
+	},
+}
+
+func init() {
+	for _, tpl := range builtinChannelTemplates {
+		tpl.Builtin = true
+		tpl.Weight = 1
+		tpl.Priority = 100
+		normalizeChannelTemplate(tpl)
+	}
+}
+
+func findBuiltinChannelTemplate(id string) *model.ChannelTemplate {
+	for _, tpl := range builtinChannelTemplates {
+		if tpl.ID == id {
+			return tpl
+		}
+	}
+	return nil
+}
+
+// ChannelTemplateService 渠道模板管理，以及基于模板/现有渠道的复制和批量创建
+type ChannelTemplateService struct {
+	repo           *repository.ChannelTemplateRepository
+	channelRepo    repository.ChannelRepositoryInterface
+	channelService *ChannelService
+}
+
+func NewChannelTemplateService() *ChannelTemplateService {
+	return &ChannelTemplateService{
+		repo:           repository.NewChannelTemplateRepository(),
+		channelRepo:    repository.NewChannelRepository(),
+		channelService: NewChannelService(),
+	}
+}
+
+// List 返回内置模板和自定义模板，内置模板在前
+func (s *ChannelTemplateService) List() ([]*model.ChannelTemplate, error) {
+	custom, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]*model.ChannelTemplate, 0, len(builtinChannelTemplates)+len(custom))
+	templates = append(templates, builtinChannelTemplates...)
+	return append(templates, custom...), nil
+}
+
+func (s *ChannelTemplateService) Get(id string) (*model.ChannelTemplate, error) {
+	if tpl := findBuiltinChannelTemplate(id); tpl != nil {
+		return tpl, nil
+	}
+	tpl, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if tpl == nil {
+		return nil, ErrChannelTemplateNotFound
+	}
+	return tpl, nil
+}
+
+func (s *ChannelTemplateService) Create(req *model.ChannelTemplateRequest) (*model.ChannelTemplate, error) {
+	tpl := &model.ChannelTemplate{}
+	if err := s.applyRequest(tpl, req, ""); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(tpl); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+func (s *ChannelTemplateService) Update(id string, req *model.ChannelTemplateRequest) (*model.ChannelTemplate, error) {
+	if findBuiltinChannelTemplate(id) != nil {
+		return nil, ErrChannelTemplateBuiltin
+	}
+	tpl, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyRequest(tpl, req, id); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(tpl); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+func (s *ChannelTemplateService) Delete(id string) error {
+	if findBuiltinChannelTemplate(id) != nil {
+		return ErrChannelTemplateBuiltin
+	}
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
+}
+
+func (s *ChannelTemplateService) applyRequest(tpl *model.ChannelTemplate, req *model.ChannelTemplateRequest, excludeID string) error {
+	name := strings.TrimSpace(req.Name)
+	exists, err := s.repo.ExistsByName(name, excludeID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrChannelTemplateNameExists
+	}
+
+	endpoint := req.Endpoint
+	if endpoint == "" {
+		endpoint = s.channelService.defaultEndpointForType(req.Type)
+	}
+	weight := req.Weight
+	if weight < 1 {
+		weight = 1
+	}
+	priority := req.Priority
+	if priority < 1 {
+		priority = 100
+	}
+
+	tpl.Name = name
+	tpl.Description = req.Description
+	tpl.Type = req.Type
+	tpl.Endpoint = endpoint
+	tpl.BaseURL = strings.TrimSuffix(strings.TrimSpace(req.BaseURL), "/")
+	tpl.Weight = weight
+	tpl.Priority = priority
+	tpl.ModelWhitelist = req.ModelWhitelist
+	tpl.SimulateCLI = req.SimulateCLI
+	tpl.Models = req.Models
+	tpl.Headers = req.Headers
+	tpl.GroupIDs = req.GroupIDs
+	normalizeChannelTemplate(tpl)
+	return nil
+}
+
+// SaveFromChannel 把现有渠道保存为模板（不保存 API Key）
+func (s *ChannelTemplateService) SaveFromChannel(channelID string, req *model.SaveChannelTemplateRequest) (*model.ChannelTemplate, error) {
+	channel, err := s.channelRepo.GetByID(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, ErrChannelNotFound
+	}
+	tpl, err := s.templateFromChannel(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	exists, err := s.repo.ExistsByName(name, "")
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrChannelTemplateNameExists
+	}
+	tpl.Name = name
+	tpl.Description = req.Description
+	if err := s.repo.Create(tpl); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// Duplicate 复制渠道的全部配置（含分组和 API Key），请求中填写的字段覆盖源渠道
+func (s *ChannelTemplateService) Duplicate(channelID string, req *model.ChannelDuplicateRequest) (*model.ChannelResponse, error) {
+	channel, err := s.channelRepo.GetByID(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, ErrChannelNotFound
+	}
+	tpl, err := s.templateFromChannel(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	channelReq := channelRequestFromTemplate(tpl)
+	channelReq.Name = channel.Name + " (副本)"
+	if name := strings.TrimSpace(req.Name); name != "" {
+		channelReq.Name = name
+	}
+	channelReq.APIKey = channel.APIKey
+	channelReq.KeyStrategy = channel.KeyStrategy
+	if req.APIKey != "" {
+		channelReq.APIKey = strings.TrimSpace(req.APIKey)
+	} else {
+		// 未指定新密钥时连同额外密钥一起复制
+		channelReq.APIKeys = channelExtraAPIKeys(channel)
+	}
+	if req.BaseURL != "" {
+		channelReq.BaseURL = req.BaseURL
+	}
+	if req.Enabled != nil {
+		channelReq.Enabled = *req.Enabled
+	}
+	for k, v := range channelReq.Headers {
+		channelReq.Headers[k] = strings.ReplaceAll(v, model.ChannelTemplatePlaceholderAPIKey, channelReq.APIKey)
+	}
+	copyChannelPolicies(channelReq, channel)
+	return s.channelService.Create(channelReq)
+}
+
+// BulkCreate 以模板或现有渠道为蓝本，为每个 API Key 创建一个渠道。
+// 空 Key、列表内重复的 Key 和已被现有渠道使用的 Key 会被跳过
+func (s *ChannelTemplateService) BulkCreate(req *model.ChannelBulkCreateRequest) (*model.ChannelBulkCreateResult, error) {
+	if (req.TemplateID == "") == (req.SourceChannelID == "") {
+		return nil, ErrBulkCreateSourceInvalid
+	}
+
+	var tpl *model.ChannelTemplate
+	var source *model.Channel
+	if req.TemplateID != "" {
+		found, err := s.Get(req.TemplateID)
+		if err != nil {
+			return nil, err
+		}
+		tpl = found
+	} else {
+		channel, err := s.channelRepo.GetByID(req.SourceChannelID)
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			return nil, ErrChannelNotFound
+		}
+		if tpl, err = s.templateFromChannel(channel); err != nil {
+			return nil, err
+		}
+		source = channel
+	}
+
+	existing, err := s.channelRepo.List()
+	if err != nil {
+		return nil, err
+	}
+	usedKeys := make(map[string]bool, len(existing)+len(req.APIKeys))
+	for _, ch := range existing {
+		for _, key := range channelKeyPool(ch) {
+			usedKeys[key] = true
+		}
+	}
+
+	type pendingKey struct {
+		index int
+		key   string
+	}
+	result := &model.ChannelBulkCreateResult{
+		Channels: []*model.ChannelResponse{},
+		Skipped:  []model.ChannelBulkCreateSkipped{},
+	}
+	var pending []pendingKey
+	seen := make(map[string]bool, len(req.APIKeys))
+	for i, raw := range req.APIKeys {
+		key := strings.TrimSpace(raw)
+		switch {
+		case key == "":
+			result.Skipped = append(result.Skipped, model.ChannelBulkCreateSkipped{Index: i, Reason: "Key 为空"})
+		case seen[key]:
+			result.Skipped = append(result.Skipped, model.ChannelBulkCreateSkipped{Index: i, Reason: "列表中 Key 重复"})
+		case usedKeys[key]:
+			result.Skipped = append(result.Skipped, model.ChannelBulkCreateSkipped{Index: i, Reason: "已有渠道使用该 Key"})
+		default:
+			pending = append(pending, pendingKey{index: i, key: key})
+		}
+		seen[key] = true
+	}
+
+	// 先渲染全部渠道再创建，占位符缺失等错误不会留下一半已创建的渠道
+	requests := make([]*model.ChannelRequest, 0, len(pending))
+	for n, p := range pending {
+		channelReq, err := renderChannelTemplate(tpl, req.BaseURL, p.key, req.Variables)
+		if err != nil {
+			return nil, err
+		}
+		channelReq.Name = req.NamePrefix
+		if len(pending) > 1 {
+			channelReq.Name = fmt.Sprintf("%s #%d", req.NamePrefix, n+1)
+		}
+		channelReq.Enabled = req.Enabled
+		if len(req.GroupIDs) > 0 {
+			channelReq.GroupIDs = req.GroupIDs
+		}
+		if source != nil {
+			copyChannelPolicies(channelReq, source)
+		}
+		requests = append(requests, channelReq)
+	}
+
+	for _, channelReq := range requests {
+		created, err := s.channelService.Create(channelReq)
+		if err != nil {
+			return nil, fmt.Errorf("创建渠道 %s 失败: %w", channelReq.Name, err)
+		}
+		result.Channels = append(result.Channels, created)
+	}
+	return result, nil
+}
+
+// templateFromChannel 将渠道配置转换为（未保存的）模板，不含 API Key，请求头中出现的 Key 替换为 {{apiKey}}
+func (s *ChannelTemplateService) templateFromChannel(channel *model.Channel) (*model.ChannelTemplate, error) {
+	groupIDs, err := s.channelRepo.GetGroupIDs(channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	tpl := &model.ChannelTemplate{
+		Type:           channel.Type,
+		Endpoint:       channel.Endpoint,
+		BaseURL:        channel.BaseURL,
+		Weight:         channel.Weight,
+		Priority:       channel.Priority,
+		ModelWhitelist: channel.ModelWhitelist,
+		SimulateCLI:    channel.SimulateCLI,
+		GroupIDs:       groupIDs,
+	}
+	_ = json.Unmarshal([]byte(channel.ModelsJSON), &tpl.Models)
+	_ = json.Unmarshal([]byte(channel.HeadersJSON), &tpl.Headers)
+	for k, v := range tpl.Headers {
+		if channel.APIKey != "" && strings.Contains(v, channel.APIKey) {
+			tpl.Headers[k] = strings.ReplaceAll(v, channel.APIKey, model.ChannelTemplatePlaceholderAPIKey)
+		}
+	}
+	normalizeChannelTemplate(tpl)
+	return tpl, nil
+}
+
+// copyChannelPolicies 复制源渠道的 Anthropic-Beta、请求头与 DNS 策略（模板不保存策略）
+func copyChannelPolicies(req *model.ChannelRequest, channel *model.Channel) {
+	if channel.AnthropicBetaPolicyJSON != "" {
+		betaPolicy := ChannelAnthropicBetaPolicy(channel)
+		req.AnthropicBetaPolicy = &betaPolicy
+	}
+	if channel.HeaderPolicyJSON != "" {
+		headerPolicy := ChannelHeaderPolicy(channel)
+		req.HeaderPolicy = &headerPolicy
+	}
+	if channel.FederationIssuer != "" {
+		issuer := channel.FederationIssuer
+		req.FederationIssuer = &issuer
+	}
+	if channel.DNSPolicyJSON != "" {
+		dnsPolicy := ChannelDNSPolicy(channel)
+		req.DNSPolicy = &dnsPolicy
+	}
+}
+
+func normalizeChannelTemplate(tpl *model.ChannelTemplate) {
+	if tpl.Models == nil {
+		tpl.Models = []model.ChannelModel{}
+	}
+	if tpl.Headers == nil {
+		tpl.Headers = map[string]string{}
+	}
+	if tpl.GroupIDs == nil {
+		tpl.GroupIDs = []string{}
+	}
+}
+
+func channelRequestFromTemplate(tpl *model.ChannelTemplate) *model.ChannelRequest {
+	headers := make(map[string]string, len(tpl.Headers))
+	for k, v := range tpl.Headers {
+		headers[k] = v
+	}
+	return &model.ChannelRequest{
+		Type:           tpl.Type,
+		Endpoint:       tpl.Endpoint,
+		BaseURL:        tpl.BaseURL,
+		Weight:         tpl.Weight,
+		Priority:       tpl.Priority,
+		ModelWhitelist: tpl.ModelWhitelist,
+		SimulateCLI:    tpl.SimulateCLI,
+		GroupIDs:       append([]string(nil), tpl.GroupIDs...),
+		Models:         append([]model.ChannelModel(nil), tpl.Models...),
+		Headers:        headers,
+	}
+}
+
+// renderChannelTemplate 替换模板中的占位符，生成单个渠道的创建请求。
+// 模板 BaseURL 不含 {{baseUrl}} 时，请求中的 baseURL 直接覆盖模板值
+func renderChannelTemplate(tpl *model.ChannelTemplate, baseURL, apiKey string, variables map[string]string) (*model.ChannelRequest, error) {
+	pairs := []string{
+		model.ChannelTemplatePlaceholderAPIKey, apiKey,
+		model.ChannelTemplatePlaceholderBaseURL, strings.TrimSuffix(baseURL, "/"),
+	}
+	for k, v := range variables {
+		pairs = append(pairs, "{{"+k+"}}", v)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	render := func(value string) (string, error) {
+		rendered := replacer.Replace(value)
+		if strings.Contains(rendered, "{{") {
+			return "", fmt.Errorf("%w: %s", ErrChannelTemplateUnresolved, value)
+		}
+		return rendered, nil
+	}
+
+	req := channelRequestFromTemplate(tpl)
+	req.APIKey = apiKey
+
+	rawBaseURL := tpl.BaseURL
+	if baseURL != "" && !strings.Contains(rawBaseURL, model.ChannelTemplatePlaceholderBaseURL) {
+		rawBaseURL = baseURL
+	}
+	rendered, err := render(rawBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rendered)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrChannelTemplateBaseURLInvalid
+	}
+	req.BaseURL = rendered
+
+	for k, v := range req.Headers {
+		if req.Headers[k], err = render(v); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+// GenerateClientConfig 为用户签发新的 API Key，并生成 Amp CLI / VS Code 扩展的配置包
+func (s *AmpService) GenerateClientConfig(userID, baseURL string, req *model.ClientConfigRequest) (*model.ClientConfigBundle, error) {
+	user, err := repository.NewUserRepository().GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, repository.ErrUserNotFound
+	}
+
+	baseURL = strings.TrimSuffix(strings.TrimSpace(baseURL), "/")
+	if req.BaseURL != "" {
+		baseURL = strings.TrimSuffix(req.BaseURL, "/")
+	}
+
+	name := strings.TrimSpace(req.KeyName)
+	if name == "" {
+		name = "Amp CLI " + time.Now().UTC().Format("2006-01-02")
+	}
+	key, err := s.CreateAPIKey(userID, &model.CreateAPIKeyRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ClientConfigBundle{
+		BaseURL:    baseURL,
+		APIKeyID:   key.ID,
+		APIKeyName: key.Name,
+		APIKey:     key.APIKey,
+		Env: map[string]string{
+			"AMP_URL":     baseURL,
+			"AMP_API_KEY": key.APIKey,
+		},
+		Settings: map[string]any{
+			"amp.url": baseURL,
+		},
+		SettingsPaths: map[string]string{
+			"cli":    "~/.config/amp/settings.json",
+			"vscode": "VS Code 用户设置 (settings.json)",
+		},
+		Snippets:  clientConfigSnippets(baseURL, key.APIKey),
+		CreatedAt: key.CreatedAt,
+	}, nil
+}
+
+func clientConfigSnippets(baseURL, apiKey string) map[string]string {
+	return map[string]string{
+		"bash": fmt.Sprintf("export AMP_URL=%q\nexport AMP_API_KEY=%q\n", baseURL, apiKey),
+		"fish": fmt.Sprintf("set -Ux AMP_URL %q\nset -Ux AMP_API_KEY %q\n", baseURL, apiKey),
+		"powershell": fmt.Sprintf("[Environment]::SetEnvironmentVariable(\"AMP_URL\", \"%s\", \"User\")\n[Environment]::SetEnvironmentVariable(\"AMP_API_KEY\", \"%s\", \"User\")\n",
+			baseURL, apiKey),
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+const demoSeededKey = "demo_seeded"
+
+// DemoAccount 演示模式预置的登录账户
+type DemoAccount struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// DemoAccounts 演示模式下的示例用户（密码公开，仅用于演示）
+var DemoAccounts = []DemoAccount{
+	{Username: "demo-alice", Password: "demo1234"},
+	{Username: "demo-bob", Password: "demo1234"},
+	{Username: "demo-carol", Password: "demo1234"},
+}
+
+// demoModelRates 合成日志使用的模型及其每百万 token 的输入/输出价格（微美元）
+var demoModelRates = []struct {
+	model       string
+	channelType model.ChannelType
+	inputRate   int64
+	outputRate  int64
+}{
+	{"claude-sonnet-4-20250514", model.ChannelTypeClaude, 3_000_000, 15_000_000},
+	{"claude-3-5-haiku-20241022", model.ChannelTypeClaude, 800_000, 4_000_000},
+	{"gpt-4o", model.ChannelTypeOpenAI, 2_500_000, 10_000_000},
+	{"gemini-2.5-pro", model.ChannelTypeGemini, 1_250_000, 10_000_000},
+}
+
+// SeedDemoData 为演示模式写入合成的分组、用户、渠道、请求日志和计费记录；
+// 已写入过时直接返回。渠道指向内置假上游 upstreamBaseURL，不包含任何真实 Key
+func SeedDemoData(upstreamBaseURL string) error {
+	configRepo := repository.NewSystemConfigRepository()
+	seeded, err := configRepo.Get(demoSeededKey)
+	if err != nil {
+		return err
+	}
+	if seeded == "true" {
+		return nil
+	}
+
+	groupRepo := repository.NewGroupRepository()
+	groups := []*model.Group{
+		{Name: "Demo Team", Description: "演示分组", RateMultiplier: 1.0},
+		{Name: "Demo VIP", Description: "演示分组（8 折）", RateMultiplier: 0.8},
+	}
+	for _, g := range groups {
+		if err := groupRepo.Create(g); err != nil {
+			return fmt.Errorf("demo: create group: %w", err)
+		}
+	}
+
+	channelService := NewChannelService()
+	channelIDs := make(map[model.ChannelType]string)
+	for _, ch := range []struct {
+		name        string
+		channelType model.ChannelType
+	}{
+		{"Demo Claude", model.ChannelTypeClaude},
+		{"Demo OpenAI", model.ChannelTypeOpenAI},
+		{"Demo Gemini", model.ChannelTypeGemini},
+	} {
+		created, err := channelService.Create(&model.ChannelRequest{
+			Type:     ch.channelType,
+			Name:     ch.name,
+			BaseURL:  upstreamBaseURL,
+			APIKey:   "demo-key",
+			Enabled:  true,
+			GroupIDs: []string{groups[0].ID, groups[1].ID},
+		})
+		if err != nil {
+			return fmt.Errorf("demo: create channel: %w", err)
+		}
+		channelIDs[ch.channelType] = created.ID
+	}
+
+	userRepo := repository.NewUserRepository()
+	ampService := NewAmpService()
+	var users []demoUser
+	for i, account := range DemoAccounts {
+		hashed, err := HashPassword(account.Password)
+		if err != nil {
+			return err
+		}
+		user := &model.User{Username: account.Username, PasswordHash: hashed, BalanceMicros: 50_000_000}
+		if err := userRepo.Create(user); err != nil {
+			return fmt.Errorf("demo: create user: %w", err)
+		}
+		group := groups[i%len(groups)]
+		if err := userRepo.SetGroups(user.ID, []string{group.ID}); err != nil {
+			return err
+		}
+		// Amp 上游同样指向假上游，保证演示 Key 可以直接发起请求
+		if _, err := ampService.UpdateSettings(user.ID, &model.AmpSettingsRequest{
+			UpstreamURL:    upstreamBaseURL,
+			UpstreamAPIKey: "demo-key",
+			Enabled:        true,
+		}); err != nil {
+			return fmt.Errorf("demo: update amp settings: %w", err)
+		}
+		key, err := ampService.CreateAPIKey(user.ID, &model.CreateAPIKeyRequest{Name: "demo"})
+		if err != nil {
+			return fmt.Errorf("demo: create api key: %w", err)
+		}
+		users = append(users, demoUser{id: user.ID, apiKeyID: key.ID, multiplier: group.RateMultiplier})
+	}
+
+	if err := seedDemoRequestLogs(users, channelIDs); err != nil {
+		return err
+	}
+
+	log.Printf("演示数据已写入: %d 个用户, %d 个渠道", len(users), len(channelIDs))
+	return configRepo.Set(demoSeededKey, "true")
+}
+
+type demoUser struct {
+	id         string
+	apiKeyID   string
+	multiplier float64
+}
+
+// seedDemoRequestLogs 生成最近 14 天的合成请求日志及对应的余额扣费记录
+func seedDemoRequestLogs(users []demoUser, channelIDs map[model.ChannelType]string) error {
+	db := database.GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 固定种子，保证每次生成的演示数据一致，便于截图
+	rng := rand.New(rand.NewSource(42))
+	now := time.Now().UTC()
+	spent := make(map[string]int64)
+
+	for day := 13; day >= 0; day-- {
+		count := 20 + rng.Intn(30)
+		for i := 0; i < count; i++ {
+			user := users[rng.Intn(len(users))]
+			rate := demoModelRates[rng.Intn(len(demoModelRates))]
+			createdAt := now.AddDate(0, 0, -day).Add(-time.Duration(rng.Intn(86400)) * time.Second)
+
+			id := uuid.New().String()
+			status, statusCode := model.RequestLogStatusSuccess, 200
+			var errorType *string
+			if rng.Intn(100) < 5 {
+				status = model.RequestLogStatusError
+				codes := []int{429, 500, 529}
+				statusCode = codes[rng.Intn(len(codes))]
+				t := "upstream_error"
+				errorType = &t
+			}
+			inputTokens := 500 + rng.Intn(20000)
+			outputTokens := 50 + rng.Intn(3000)
+			cacheRead := rng.Intn(inputTokens)
+			latency := 300 + rng.Intn(8000)
+			streaming := rng.Intn(4) != 0
+
+			var costMicros int64
+			var costUsd *string
+			var charged int64
+			billingStatus := "none"
+			if status == model.RequestLogStatusSuccess {
+				costMicros = (int64(inputTokens)*rate.inputRate + int64(outputTokens)*rate.outputRate) / 1_000_000
+				usd := fmt.Sprintf("%.6f", float64(costMicros)/1e6)
+				costUsd = &usd
+				charged = int64(float64(costMicros) * user.multiplier)
+				billingStatus = "settled"
+			} else {
+				inputTokens, outputTokens, cacheRead = 0, 0, 0
+			}
+
+			_, err := tx.Exec(`
+				INSERT INTO request_logs (
+					id, created_at, updated_at, status, user_id, api_key_id, original_model, mapped_model,
+					provider, channel_id, endpoint, method, path, status_code, latency_ms, is_streaming,
+					input_tokens, output_tokens, cache_read_input_tokens, cache_creation_input_tokens,
+					error_type, cost_micros, cost_usd, pricing_model, rate_multiplier,
+					charged_balance_micros, billing_status
+				) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				id, createdAt, createdAt.Add(time.Duration(latency)*time.Millisecond), status, user.id, user.apiKeyID,
+				rate.model, rate.model, string(rate.channelType), channelIDs[rate.channelType], "demo",
+				"POST", demoRequestPath(rate.channelType), statusCode, latency, streaming,
+				inputTokens, outputTokens, cacheRead, 0,
+				errorType, costMicros, costUsd, rate.model, user.multiplier,
+				charged, billingStatus,
+			)
+			if err != nil {
+				return fmt.Errorf("demo: insert request log: %w", err)
+			}
+
+			if charged > 0 {
+				_, err = tx.Exec(
+					`INSERT INTO billing_events (id, request_log_id, user_id, source, event_type, amount_micros, created_at)
+					 VALUES (?, ?, ?, 'balance', 'charge', ?, ?)`,
+					uuid.New().String(), id, user.id, charged, createdAt,
+				)
+				if err != nil {
+					return fmt.Errorf("demo: insert billing event: %w", err)
+				}
+				spent[user.id] += charged
+			}
+		}
+	}
+
+	for userID, amount := range spent {
+		if _, err := tx.Exec(
+			`UPDATE users SET balance_micros = CASE WHEN balance_micros >= ? THEN balance_micros - ? ELSE 0 END WHERE id = ?`,
+			amount, amount, userID,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func demoRequestPath(channelType model.ChannelType) string {
+	switch channelType.Protocol() {
+	case model.ChannelTypeClaude:
+		return "/api/provider/anthropic/v1/messages"
+	case model.ChannelTypeGemini:
+		return "/api/provider/google/v1beta/models/gemini-2.5-pro:streamGenerateContent"
+	default:
+		return "/api/provider/openai/v1/chat/completions"
+	}
+}
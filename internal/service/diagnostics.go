@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/billing"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+	"ampmanager/internal/secrets"
+)
+
+const (
+	// diagnosticProbeTimeout 探测单个渠道 Base URL 的超时
+	diagnosticProbeTimeout = 5 * time.Second
+	// diagnosticProbeConcurrency 同时探测的渠道数
+	diagnosticProbeConcurrency = 8
+)
+
+var (
+	latestDiagnosticMu     sync.RWMutex
+	latestDiagnosticReport *model.DiagnosticReport
+)
+
+// LatestDiagnosticReport 返回最近一次自检报告，尚未执行时返回 nil
+func LatestDiagnosticReport() *model.DiagnosticReport {
+	latestDiagnosticMu.RLock()
+	defer latestDiagnosticMu.RUnlock()
+	return latestDiagnosticReport
+}
+
+// DiagnosticsService 配置自检：在启动时发现渠道、价格、用户设置中的配置问题，而不是等到请求时才失败
+type DiagnosticsService struct {
+	channelRepo      repository.ChannelRepositoryInterface
+	channelModelRepo *repository.ChannelModelRepository
+	ampSettingsRepo  *repository.AmpSettingsRepository
+	userRepo         *repository.UserRepository
+	channels         *ChannelService
+	httpClient       *http.Client
+}
+
+func NewDiagnosticsService() *DiagnosticsService {
+	return &DiagnosticsService{
+		channelRepo:      repository.NewChannelRepository(),
+		channelModelRepo: repository.NewChannelModelRepository(),
+		ampSettingsRepo:  repository.NewAmpSettingsRepository(),
+		userRepo:         repository.NewUserRepository(),
+		channels:         NewChannelService(),
+		httpClient: &http.Client{
+			Timeout: diagnosticProbeTimeout,
+			// 只关心能否连通，不跟随跳转
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+type diagnosticCheck struct {
+	name  string
+	title string
+	run   func(ctx context.Context, d *diagnosticData) ([]model.DiagnosticIssue, error)
+}
+
+// diagnosticData 各项检查共用的数据，只查询一次
+type diagnosticData struct {
+	channels    []*model.Channel
+	ampSettings []*model.AmpSettings
+	usernames   map[string]string
+}
+
+// Run 执行全部检查并保存为最新报告
+func (s *DiagnosticsService) Run(ctx context.Context, trigger string) *model.DiagnosticReport {
+	report := &model.DiagnosticReport{
+		Trigger:   trigger,
+		Status:    model.DiagnosticStatusOK,
+		StartedAt: time.Now(),
+		Checks:    []model.DiagnosticCheck{},
+		Issues:    []model.DiagnosticIssue{},
+	}
+
+	data, loadErr := s.loadData()
+	checks := []diagnosticCheck{
+		{name: "channel_reachability", title: "渠道连通性与密钥", run: s.checkChannels},
+		{name: "model_prices", title: "已配置模型的价格数据", run: s.checkModelPrices},
+		{name: "amp_upstream_key", title: "Amp 上游 API Key", run: s.checkAmpUpstreamKeys},
+		{name: "model_mappings", title: "模型映射目标", run: s.checkModelMappings},
+	}
+
+	for _, check := range checks {
+		start := time.Now()
+		result := model.DiagnosticCheck{Name: check.name, Title: check.title, Status: model.DiagnosticStatusOK}
+
+		var issues []model.DiagnosticIssue
+		err := loadErr
+		if err == nil {
+			issues, err = check.run(ctx, data)
+		}
+		if err != nil {
+			result.Status = model.DiagnosticStatusError
+			result.Error = err.Error()
+		}
+		for i := range issues {
+			issues[i].Check = check.name
+			result.Status = worseDiagnosticStatus(result.Status, issues[i].Severity)
+		}
+		result.IssueCount = len(issues)
+		result.DurationMs = time.Since(start).Milliseconds()
+
+		report.Checks = append(report.Checks, result)
+		report.Issues = append(report.Issues, issues...)
+		report.Status = worseDiagnosticStatus(report.Status, result.Status)
+	}
+
+	report.FinishedAt = time.Now()
+	report.DurationMs = report.FinishedAt.Sub(report.StartedAt).Milliseconds()
+
+	latestDiagnosticMu.Lock()
+	latestDiagnosticReport = report
+	latestDiagnosticMu.Unlock()
+	return report
+}
+
+func worseDiagnosticStatus(current, severity string) string {
+	switch {
+	case current == model.DiagnosticStatusError || severity == model.DiagnosticSeverityError:
+		return model.DiagnosticStatusError
+	case current == model.DiagnosticStatusWarning || severity == model.DiagnosticSeverityWarning:
+		return model.DiagnosticStatusWarning
+	default:
+		return model.DiagnosticStatusOK
+	}
+}
+
+func (s *DiagnosticsService) loadData() (*diagnosticData, error) {
+	channels, err := s.channelRepo.ListEnabled()
+	if err != nil {
+		return nil, fmt.Errorf("查询渠道失败: %w", err)
+	}
+	settings, err := s.ampSettingsRepo.ListEnabled()
+	if err != nil {
+		return nil, fmt.Errorf("查询 Amp 设置失败: %w", err)
+	}
+	usernames := make(map[string]string, len(settings))
+	for _, st := range settings {
+		usernames[st.UserID] = st.UserID
+		if user, err := s.userRepo.GetByID(st.UserID); err == nil && user != nil {
+			usernames[st.UserID] = user.Username
+		}
+	}
+	return &diagnosticData{channels: channels, ampSettings: settings, usernames: usernames}, nil
+}
+
+// checkChannels 探测启用渠道的 Base URL 是否可连通，并检查 API Key 是否配置、密钥引用能否解析
+func (s *DiagnosticsService) checkChannels(ctx context.Context, d *diagnosticData) ([]model.DiagnosticIssue, error) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		issues []model.DiagnosticIssue
+		sem    = make(chan struct{}, diagnosticProbeConcurrency)
+	)
+	add := func(issue model.DiagnosticIssue) {
+		mu.Lock()
+		issues = append(issues, issue)
+		mu.Unlock()
+	}
+
+	for _, ch := range d.channels {
+		subject := "渠道 " + ch.Name
+		// Ollama 默认不需要认证，API Key 可留空
+		if ch.APIKey == "" && ch.Type != model.ChannelTypeOllama {
+			add(model.DiagnosticIssue{
+				Severity: model.DiagnosticSeverityWarning,
+				Subject:  subject,
+				Message:  "未配置 API Key",
+				Hint:     "在渠道设置中填写 API Key，或使用 file:// / vault:// / aws-sm:// 密钥引用",
+			})
+		} else if _, err := secrets.Resolve(ch.APIKey); err != nil {
+			add(model.DiagnosticIssue{
+				Severity: model.DiagnosticSeverityError,
+				Subject:  subject,
+				Message:  err.Error(),
+				Hint:     "检查外部密钥存储的地址、凭证与引用路径",
+			})
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ch *model.Channel, subject string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := s.probeBaseURL(ctx, ch.BaseURL); err != nil {
+				add(model.DiagnosticIssue{
+					Severity: model.DiagnosticSeverityError,
+					Subject:  subject,
+					Message:  fmt.Sprintf("Base URL %s 无法访问: %v", ch.BaseURL, err),
+					Hint:     "检查地址拼写、DNS、防火墙与代理设置",
+				})
+			}
+		}(ch, subject)
+	}
+	wg.Wait()
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Subject < issues[j].Subject })
+	return issues, nil
+}
+
+// probeBaseURL 只要收到任何 HTTP 响应（包括 401/404）即视为可连通
+func (s *DiagnosticsService) probeBaseURL(ctx context.Context, baseURL string) error {
+	if baseURL == "" {
+		return fmt.Errorf("地址为空")
+	}
+	ctx, cancel := context.WithTimeout(ctx, diagnosticProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// checkModelPrices 渠道配置的模型与映射目标缺少价格时，请求会按 0 计费
+func (s *DiagnosticsService) checkModelPrices(_ context.Context, d *diagnosticData) ([]model.DiagnosticIssue, error) {
+	calculator := billing.GetCostCalculator()
+	if calculator == nil {
+		return nil, fmt.Errorf("计费服务未初始化")
+	}
+
+	// 模型名 -> 来源说明
+	configured := map[string]string{}
+	for _, ch := range d.channels {
+		if models, ok := getParsedModels(ch.ModelsJSON); ok {
+			for _, m := range models {
+				configured[m.Name] = "渠道 " + ch.Name
+			}
+		}
+	}
+	available, err := s.channelModelRepo.ListAllWithChannel()
+	if err != nil {
+		return nil, fmt.Errorf("查询渠道模型失败: %w", err)
+	}
+	for _, m := range available {
+		if _, ok := configured[m.ModelID]; !ok {
+			configured[m.ModelID] = "渠道 " + m.ChannelName
+		}
+	}
+	for _, st := range d.ampSettings {
+		for _, mapping := range parseDiagnosticMappings(st) {
+			if !mapping.Regex && !strings.Contains(mapping.To, "$") {
+				if _, ok := configured[mapping.To]; !ok {
+					configured[mapping.To] = "用户 " + d.usernames[st.UserID] + " 的模型映射"
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(configured))
+	for name := range configured {
+		if name != "" && !strings.Contains(name, "*") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var issues []model.DiagnosticIssue
+	for _, name := range names {
+		if calculator.HasPrice(name) {
+			continue
+		}
+		issues = append(issues, model.DiagnosticIssue{
+			Severity: model.DiagnosticSeverityWarning,
+			Subject:  "模型 " + name,
+			Message:  fmt.Sprintf("缺少价格数据（来自%s），请求将按 0 计费", configured[name]),
+			Hint:     "在价格管理中同步 LiteLLM 价格或手动添加该模型价格",
+		})
+	}
+	return issues, nil
+}
+
+// checkAmpUpstreamKeys 启用 Amp 代理但未配置上游 Key 的用户，未命中渠道的请求会失败
+func (s *DiagnosticsService) checkAmpUpstreamKeys(_ context.Context, d *diagnosticData) ([]model.DiagnosticIssue, error) {
+	var issues []model.DiagnosticIssue
+	for _, st := range d.ampSettings {
+		if st.UpstreamAPIKey != "" {
+			continue
+		}
+		issues = append(issues, model.DiagnosticIssue{
+			Severity: model.DiagnosticSeverityWarning,
+			Subject:  "用户 " + d.usernames[st.UserID],
+			Message:  "已启用 Amp 代理但未配置上游 API Key，未匹配到渠道的请求将被上游拒绝",
+			Hint:     "在 Amp 设置中填写上游 API Key，或为该用户可用的模型配置渠道",
+		})
+	}
+	return issues, nil
+}
+
+// checkModelMappings 检查映射正则能否编译，以及映射目标是否有渠道或价格表中的模型对应
+func (s *DiagnosticsService) checkModelMappings(_ context.Context, d *diagnosticData) ([]model.DiagnosticIssue, error) {
+	priceStore := billing.GetPriceStore()
+
+	var issues []model.DiagnosticIssue
+	for _, st := range d.ampSettings {
+		subject := "用户 " + d.usernames[st.UserID]
+		for _, mapping := range parseDiagnosticMappings(st) {
+			if mapping.Regex {
+				if _, err := regexp.Compile(mapping.From); err != nil {
+					issues = append(issues, model.DiagnosticIssue{
+						Severity: model.DiagnosticSeverityError,
+						Subject:  subject,
+						Message:  fmt.Sprintf("映射 %s 的正则无效: %v", mapping.From, err),
+					})
+					continue
+				}
+			}
+			if mapping.To == "" || strings.Contains(mapping.To, "$") {
+				continue
+			}
+			if s.modelServedByChannel(d.channels, mapping.To) {
+				continue
+			}
+			if priceStore != nil {
+				if _, ok := priceStore.GetPrice(mapping.To); ok {
+					continue
+				}
+			}
+			issues = append(issues, model.DiagnosticIssue{
+				Severity: model.DiagnosticSeverityWarning,
+				Subject:  subject,
+				Message:  fmt.Sprintf("映射 %s -> %s 的目标模型不存在：没有渠道提供该模型，价格表中也没有记录", mapping.From, mapping.To),
+				Hint:     "检查目标模型名拼写，或为该模型配置渠道",
+			})
+		}
+	}
+	return issues, nil
+}
+
+func (s *DiagnosticsService) modelServedByChannel(channels []*model.Channel, modelName string) bool {
+	for _, ch := range channels {
+		if s.channels.channelMatchesModel(ch, modelName) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDiagnosticMappings(st *model.AmpSettings) []model.ModelMapping {
+	var mappings []model.ModelMapping
+	if st.ModelMappingsJSON != "" {
+		_ = json.Unmarshal([]byte(st.ModelMappingsJSON), &mappings)
+	}
+	return mappings
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"ampmanager/internal/model"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	errorClusterMaxSamples      = 5000
+	errorClusterExampleIDs      = 5
+	errorClusterMaxPatternChars = 160
+)
+
+// 归一化规则：把请求相关的易变片段替换为占位符，使同类错误得到相同签名
+var errorMessageNormalizers = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), "<uuid>"},
+	{regexp.MustCompile(`(?i)\b(req|msg|chatcmpl|resp|call|toolu)_[a-z0-9_-]+`), "<id>"},
+	{regexp.MustCompile(`(?i)\bsk-[a-z0-9_-]+`), "<key>"},
+	{regexp.MustCompile(`https?://\S+`), "<url>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{16,}\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(\.\d+)?`), "<n>"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// extractErrorMessage 从上游错误响应体中提取错误信息
+func extractErrorMessage(body string) string {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return ""
+	}
+	if gjson.Valid(body) {
+		for _, path := range []string{"error.message", "message", "error.msg", "detail", "error"} {
+			if v := gjson.Get(body, path); v.Exists() && v.Type == gjson.String && v.String() != "" {
+				return v.String()
+			}
+		}
+	}
+	// SSE 或纯文本：取首个非空行
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "data:"))
+		if line == "" || strings.HasPrefix(line, "event:") {
+			continue
+		}
+		if gjson.Valid(line) {
+			if v := gjson.Get(line, "error.message"); v.Exists() {
+				return v.String()
+			}
+		}
+		return line
+	}
+	return ""
+}
+
+// NormalizeErrorMessage 归一化错误信息，去除 ID、数字、URL 等易变内容
+func NormalizeErrorMessage(message string) string {
+	normalized := strings.ToLower(strings.TrimSpace(message))
+	for _, n := range errorMessageNormalizers {
+		normalized = n.pattern.ReplaceAllString(normalized, n.replacement)
+	}
+	normalized = strings.TrimSpace(normalized)
+	if len([]rune(normalized)) > errorClusterMaxPatternChars {
+		normalized = string([]rune(normalized)[:errorClusterMaxPatternChars]) + "…"
+	}
+	return normalized
+}
+
+func errorSignature(errorType string, statusCode int, pattern string) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%d|%s", errorType, statusCode, pattern)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// GetErrorClusters 对指定时间范围内的失败请求按错误签名聚类，返回数量最多的 top 个
+func (s *RequestLogService) GetErrorClusters(since time.Duration, top int) (*model.ErrorClusterReport, error) {
+	now := time.Now().UTC()
+	from := now.Add(-since)
+
+	samples, err := s.repo.ListFailedSince(from, errorClusterMaxSamples)
+	if err != nil {
+		return nil, err
+	}
+
+	type clusterAcc struct {
+		cluster  *model.ErrorCluster
+		models   map[string]struct{}
+		channels map[string]*model.ErrorClusterChannel
+	}
+	clusters := make(map[string]*clusterAcc)
+
+	// samples 按时间倒序，先出现的是最近的请求
+	for _, sample := range samples {
+		errorType := sample.ErrorType
+		if errorType == "" {
+			errorType = "unknown"
+		}
+		pattern := NormalizeErrorMessage(extractErrorMessage(sample.Message))
+		sig := errorSignature(errorType, sample.StatusCode, pattern)
+
+		acc, ok := clusters[sig]
+		if !ok {
+			acc = &clusterAcc{
+				cluster: &model.ErrorCluster{
+					Signature:      sig,
+					ErrorType:      errorType,
+					StatusCode:     sample.StatusCode,
+					MessagePattern: pattern,
+					LastSeen:       sample.CreatedAt,
+					FirstSeen:      sample.CreatedAt,
+				},
+				models:   make(map[string]struct{}),
+				channels: make(map[string]*model.ErrorClusterChannel),
+			}
+			clusters[sig] = acc
+		}
+
+		c := acc.cluster
+		c.Count++
+		if sample.CreatedAt.Before(c.FirstSeen) {
+			c.FirstSeen = sample.CreatedAt
+		}
+		if sample.CreatedAt.After(c.LastSeen) {
+			c.LastSeen = sample.CreatedAt
+		}
+		if len(c.ExampleRequestIDs) < errorClusterExampleIDs {
+			c.ExampleRequestIDs = append(c.ExampleRequestIDs, sample.ID)
+		}
+		if sample.Model != "" {
+			acc.models[sample.Model] = struct{}{}
+		}
+		if sample.ChannelID != "" {
+			ch, ok := acc.channels[sample.ChannelID]
+			if !ok {
+				ch = &model.ErrorClusterChannel{ChannelID: sample.ChannelID, ChannelName: sample.ChannelName}
+				acc.channels[sample.ChannelID] = ch
+			}
+			ch.Count++
+		}
+	}
+
+	result := make([]model.ErrorCluster, 0, len(clusters))
+	for _, acc := range clusters {
+		c := acc.cluster
+		c.Models = make([]string, 0, len(acc.models))
+		for m := range acc.models {
+			c.Models = append(c.Models, m)
+		}
+		sort.Strings(c.Models)
+		c.Channels = make([]model.ErrorClusterChannel, 0, len(acc.channels))
+		for _, ch := range acc.channels {
+			c.Channels = append(c.Channels, *ch)
+		}
+		sort.Slice(c.Channels, func(i, j int) bool { return c.Channels[i].Count > c.Channels[j].Count })
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	if top > 0 && len(result) > top {
+		result = result[:top]
+	}
+
+	return &model.ErrorClusterReport{
+		From:          from,
+		To:            now,
+		TotalFailed:   int64(len(samples)),
+		SampleLimited: len(samples) >= errorClusterMaxSamples,
+		Clusters:      result,
+	}, nil
+}
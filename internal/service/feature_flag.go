@@ -0,0 +1,277 @@
+package service
+
+import (
+	"errors"
+	"hash/fnv"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+var (
+	ErrFeatureFlagNotFound   = errors.New("功能开关不存在")
+	ErrFeatureFlagInvalidKey = errors.New("开关名无效，仅允许小写字母、数字、下划线、点、冒号和连字符（最长 64 字符）")
+)
+
+var featureFlagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:-]{0,63}$`)
+
+type builtinFeatureFlag struct {
+	key         string
+	description string
+	// defaultOn 未在数据库中配置时的状态，已有功能默认开启以保持升级前的行为
+	defaultOn bool
+}
+
+var builtinFeatureFlags = []builtinFeatureFlag{
+	{key: model.FeatureLocalWebSearch, description: "本地/内置免费网页搜索（用户网页搜索模式为 local_duckduckgo 或 builtin_free 时生效，关闭后回退到上游）", defaultOn: true},
+	{key: model.FeatureBalanceBanner, description: "在 Amp 广告位展示账户余额（用户开启 showBalanceInAd 时生效）", defaultOn: true},
+}
+
+// featureFlagCacheTTL 开关缓存有效期；本实例修改会立即生效，其他实例最多延迟该时长
+const featureFlagCacheTTL = 30 * time.Second
+
+var featureFlagCache struct {
+	mu       sync.RWMutex
+	flags    map[string]*model.FeatureFlag
+	loadedAt time.Time
+}
+
+func invalidateFeatureFlagCache() {
+	featureFlagCache.mu.Lock()
+	featureFlagCache.loadedAt = time.Time{}
+	featureFlagCache.mu.Unlock()
+}
+
+type FeatureFlagService struct {
+	repo      *repository.FeatureFlagRepository
+	groupRepo *repository.GroupRepository
+	userRepo  *repository.UserRepository
+}
+
+func NewFeatureFlagService() *FeatureFlagService {
+	return &FeatureFlagService{
+		repo:      repository.NewFeatureFlagRepository(),
+		groupRepo: repository.NewGroupRepository(),
+		userRepo:  repository.NewUserRepository(),
+	}
+}
+
+// IsEnabled 判断开关对指定用户是否开启，用于请求热路径（读缓存）
+func (s *FeatureFlagService) IsEnabled(key, userID string, groupIDs []string) bool {
+	flags := s.cachedFlags()
+	if flag, ok := flags[key]; ok {
+		return evaluateFeatureFlag(flag, userID, groupIDs)
+	}
+	for _, b := range builtinFeatureFlags {
+		if b.key == key {
+			return b.defaultOn
+		}
+	}
+	return false
+}
+
+// EvaluateForUser 返回所有内置及已配置开关对该用户的状态，供前端按需展示功能
+func (s *FeatureFlagService) EvaluateForUser(userID string) (map[string]bool, error) {
+	groupIDs, err := s.userRepo.GetGroupIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]bool)
+	for _, b := range builtinFeatureFlags {
+		result[b.key] = s.IsEnabled(b.key, userID, groupIDs)
+	}
+	for key := range s.cachedFlags() {
+		result[key] = s.IsEnabled(key, userID, groupIDs)
+	}
+	return result, nil
+}
+
+func (s *FeatureFlagService) cachedFlags() map[string]*model.FeatureFlag {
+	featureFlagCache.mu.RLock()
+	flags, loadedAt := featureFlagCache.flags, featureFlagCache.loadedAt
+	featureFlagCache.mu.RUnlock()
+	if flags != nil && time.Since(loadedAt) < featureFlagCacheTTL {
+		return flags
+	}
+
+	list, err := s.repo.List()
+	if err != nil {
+		// 加载失败时沿用旧缓存，避免数据库抖动导致功能被整体关闭
+		log.Printf("[WARN] 加载功能开关失败: %v", err)
+		if flags == nil {
+			return map[string]*model.FeatureFlag{}
+		}
+		return flags
+	}
+	flags = make(map[string]*model.FeatureFlag, len(list))
+	for _, flag := range list {
+		flags[flag.Key] = flag
+	}
+	featureFlagCache.mu.Lock()
+	featureFlagCache.flags = flags
+	featureFlagCache.loadedAt = time.Now()
+	featureFlagCache.mu.Unlock()
+	return flags
+}
+
+// evaluateFeatureFlag 总开关 -> 分组 -> 灰度百分比（按 key+用户 ID 哈希，同一用户结果稳定）
+func evaluateFeatureFlag(flag *model.FeatureFlag, userID string, groupIDs []string) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if len(flag.GroupIDs) > 0 && !hasAnyInSet(toStringSet(flag.GroupIDs), groupIDs) {
+		return false
+	}
+	if flag.RolloutPercent >= 100 {
+		return true
+	}
+	if flag.RolloutPercent <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(flag.Key + ":" + userID))
+	return int(h.Sum32()%100) < flag.RolloutPercent
+}
+
+func (s *FeatureFlagService) List() ([]*model.FeatureFlagResponse, error) {
+	flags, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	configured := make(map[string]*model.FeatureFlag, len(flags))
+	for _, flag := range flags {
+		configured[flag.Key] = flag
+	}
+
+	result := make([]*model.FeatureFlagResponse, 0, len(flags)+len(builtinFeatureFlags))
+	for _, b := range builtinFeatureFlags {
+		if flag, ok := configured[b.key]; ok {
+			result = append(result, s.toResponse(flag))
+			delete(configured, b.key)
+			continue
+		}
+		result = append(result, &model.FeatureFlagResponse{
+			Key:            b.key,
+			Description:    b.description,
+			Enabled:        b.defaultOn,
+			GroupIDs:       []string{},
+			GroupNames:     []string{},
+			RolloutPercent: 100,
+			Builtin:        true,
+		})
+	}
+	for _, flag := range flags {
+		if _, ok := configured[flag.Key]; ok {
+			result = append(result, s.toResponse(flag))
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Builtin != result[j].Builtin {
+			return result[i].Builtin
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+// Put 创建或更新开关；内置开关未填写描述时沿用内置描述
+func (s *FeatureFlagService) Put(key string, req *model.FeatureFlagRequest) (*model.FeatureFlagResponse, error) {
+	if !featureFlagKeyPattern.MatchString(key) {
+		return nil, ErrFeatureFlagInvalidKey
+	}
+	groupIDs := req.GroupIDs
+	if groupIDs == nil {
+		groupIDs = []string{}
+	}
+	if len(groupIDs) > 0 {
+		groups, err := s.groupRepo.GetByIDs(groupIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range groupIDs {
+			if _, ok := groups[id]; !ok {
+				return nil, ErrGroupNotFound
+			}
+		}
+	}
+
+	existing, err := s.repo.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	flag := &model.FeatureFlag{Key: key}
+	if existing != nil {
+		flag.CreatedAt = existing.CreatedAt
+	}
+	flag.Description = req.Description
+	if flag.Description == "" {
+		if b, ok := findBuiltinFeatureFlag(key); ok {
+			flag.Description = b.description
+		}
+	}
+	flag.Enabled = req.Enabled
+	flag.GroupIDs = groupIDs
+	flag.RolloutPercent = 100
+	if req.RolloutPercent != nil {
+		flag.RolloutPercent = *req.RolloutPercent
+	}
+
+	if err := s.repo.Upsert(flag); err != nil {
+		return nil, err
+	}
+	invalidateFeatureFlagCache()
+	return s.toResponse(flag), nil
+}
+
+// Delete 删除开关配置，内置开关恢复默认状态
+func (s *FeatureFlagService) Delete(key string) error {
+	deleted, err := s.repo.Delete(key)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrFeatureFlagNotFound
+	}
+	invalidateFeatureFlagCache()
+	return nil
+}
+
+func findBuiltinFeatureFlag(key string) (builtinFeatureFlag, bool) {
+	for _, b := range builtinFeatureFlags {
+		if b.key == key {
+			return b, true
+		}
+	}
+	return builtinFeatureFlag{}, false
+}
+
+func (s *FeatureFlagService) toResponse(flag *model.FeatureFlag) *model.FeatureFlagResponse {
+	_, builtin := findBuiltinFeatureFlag(flag.Key)
+	updatedAt := flag.UpdatedAt
+	resp := &model.FeatureFlagResponse{
+		Key:            flag.Key,
+		Description:    flag.Description,
+		Enabled:        flag.Enabled,
+		GroupIDs:       flag.GroupIDs,
+		GroupNames:     []string{},
+		RolloutPercent: flag.RolloutPercent,
+		Builtin:        builtin,
+		Configured:     true,
+		UpdatedAt:      &updatedAt,
+	}
+	if len(flag.GroupIDs) > 0 {
+		if groups, err := s.groupRepo.GetByIDs(flag.GroupIDs); err == nil {
+			for _, id := range flag.GroupIDs {
+				if g, ok := groups[id]; ok && g != nil {
+					resp.GroupNames = append(resp.GroupNames, g.Name)
+				}
+			}
+		}
+	}
+	return resp
+}
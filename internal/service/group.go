@@ -1,7 +1,10 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 
 	"ampmanager/internal/model"
 	"ampmanager/internal/repository"
@@ -10,6 +13,17 @@ import (
 var (
 	ErrGroupNotFound   = errors.New("分组不存在")
 	ErrGroupNameExists = errors.New("分组名称已存在")
+	ErrGroupConflict   = errors.New("分组已被其他管理员修改，请刷新后重试")
+	// ErrGroupPipeline 请求流水线配置校验失败
+	ErrGroupPipeline = errors.New("请求流水线配置无效")
+)
+
+// 请求流水线配置限制
+const (
+	maxPipelineSteps      = 4
+	maxPipelineCandidates = 16
+	maxPipelinePrompt     = 4000
+	maxPipelineMaxTokens  = 4096
 )
 
 type GroupService struct {
@@ -39,6 +53,22 @@ func (s *GroupService) Create(req *model.GroupRequest) (*model.GroupResponse, er
 	if group.RateMultiplier == 0 {
 		group.RateMultiplier = 1.0
 	}
+	if req.MaxRequestCostMicros != nil {
+		group.MaxRequestCostMicros = *req.MaxRequestCostMicros
+	}
+	if req.MonthlyBudgetMicros != nil {
+		group.MonthlyBudgetMicros = *req.MonthlyBudgetMicros
+	}
+	if req.SystemPrompt != nil {
+		group.SystemPrompt = strings.TrimSpace(*req.SystemPrompt)
+	}
+	if req.Pipeline != nil {
+		pipelineJSON, err := encodeGroupPipeline(req.Pipeline)
+		if err != nil {
+			return nil, err
+		}
+		group.PipelineJSON = pipelineJSON
+	}
 
 	if err := s.repo.Create(group); err != nil {
 		return nil, err
@@ -100,8 +130,30 @@ func (s *GroupService) Update(id string, req *model.GroupRequest) (*model.GroupR
 	if group.RateMultiplier == 0 {
 		group.RateMultiplier = 1.0
 	}
+	if req.MaxRequestCostMicros != nil {
+		group.MaxRequestCostMicros = *req.MaxRequestCostMicros
+	}
+	if req.MonthlyBudgetMicros != nil {
+		group.MonthlyBudgetMicros = *req.MonthlyBudgetMicros
+	}
+	if req.SystemPrompt != nil {
+		group.SystemPrompt = strings.TrimSpace(*req.SystemPrompt)
+	}
+	if req.Pipeline != nil {
+		pipelineJSON, err := encodeGroupPipeline(req.Pipeline)
+		if err != nil {
+			return nil, err
+		}
+		group.PipelineJSON = pipelineJSON
+	}
+	if req.Version != 0 {
+		group.Version = req.Version
+	}
 
 	if err := s.repo.Update(group); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return nil, ErrGroupConflict
+		}
 		return nil, err
 	}
 
@@ -130,13 +182,118 @@ func (s *GroupService) toResponse(group *model.Group) (*model.GroupResponse, err
 	}
 
 	return &model.GroupResponse{
-		ID:             group.ID,
-		Name:           group.Name,
-		Description:    group.Description,
-		RateMultiplier: group.RateMultiplier,
-		UserCount:      userCount,
-		ChannelCount:   channelCount,
-		CreatedAt:      group.CreatedAt,
-		UpdatedAt:      group.UpdatedAt,
+		ID:                   group.ID,
+		Name:                 group.Name,
+		Description:          group.Description,
+		RateMultiplier:       group.RateMultiplier,
+		MaxRequestCostMicros: group.MaxRequestCostMicros,
+		MonthlyBudgetMicros:  group.MonthlyBudgetMicros,
+		SystemPrompt:         group.SystemPrompt,
+		Pipeline:             ParseGroupPipeline(group.PipelineJSON),
+		UserCount:            userCount,
+		ChannelCount:         channelCount,
+		Version:              group.Version,
+		CreatedAt:            group.CreatedAt,
+		UpdatedAt:            group.UpdatedAt,
 	}, nil
 }
+
+// ParseGroupPipeline 解析分组保存的请求流水线，未配置或无法解析时为空流水线
+func ParseGroupPipeline(raw string) model.RequestPipeline {
+	pipeline := model.RequestPipeline{Pre: []model.PipelineStep{}, Post: []model.PipelineStep{}}
+	if raw == "" {
+		return pipeline
+	}
+	var configured model.RequestPipeline
+	if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+		return pipeline
+	}
+	if configured.Pre != nil {
+		pipeline.Pre = configured.Pre
+	}
+	if configured.Post != nil {
+		pipeline.Post = configured.Post
+	}
+	return pipeline
+}
+
+// encodeGroupPipeline 校验并序列化请求流水线，没有任何步骤时返回空字符串（关闭）
+func encodeGroupPipeline(pipeline *model.RequestPipeline) (string, error) {
+	pre, err := normalizePipelineSteps(pipeline.Pre, "pre", model.PipelineStepRoute, model.PipelineStepTriage)
+	if err != nil {
+		return "", err
+	}
+	post, err := normalizePipelineSteps(pipeline.Post, "post", model.PipelineStepSummarize)
+	if err != nil {
+		return "", err
+	}
+	normalized := model.RequestPipeline{Pre: pre, Post: post}
+	if normalized.IsEmpty() {
+		return "", nil
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// normalizePipelineSteps 去除首尾空白并校验步骤类型、模型与限制，allowed 为该阶段允许的步骤类型
+func normalizePipelineSteps(steps []model.PipelineStep, stage string, allowed ...string) ([]model.PipelineStep, error) {
+	if len(steps) > maxPipelineSteps {
+		return nil, fmt.Errorf("%w: %s 最多 %d 个步骤", ErrGroupPipeline, stage, maxPipelineSteps)
+	}
+	result := make([]model.PipelineStep, 0, len(steps))
+	for i, step := range steps {
+		step.Type = strings.TrimSpace(step.Type)
+		step.Model = strings.TrimSpace(step.Model)
+		step.Prompt = strings.TrimSpace(step.Prompt)
+
+		typeAllowed := false
+		for _, t := range allowed {
+			if step.Type == t {
+				typeAllowed = true
+				break
+			}
+		}
+		if !typeAllowed {
+			return nil, fmt.Errorf("%w: %s[%d] 不支持的步骤类型 %q", ErrGroupPipeline, stage, i, step.Type)
+		}
+		if step.Model == "" {
+			return nil, fmt.Errorf("%w: %s[%d] 未指定模型", ErrGroupPipeline, stage, i)
+		}
+		if len([]rune(step.Prompt)) > maxPipelinePrompt {
+			return nil, fmt.Errorf("%w: %s[%d] 指令不能超过 %d 个字符", ErrGroupPipeline, stage, i, maxPipelinePrompt)
+		}
+		if step.MaxTokens < 0 || step.MaxTokens > maxPipelineMaxTokens {
+			return nil, fmt.Errorf("%w: %s[%d] maxTokens 必须在 0 到 %d 之间", ErrGroupPipeline, stage, i, maxPipelineMaxTokens)
+		}
+
+		candidates := make([]string, 0, len(step.Candidates))
+		seen := make(map[string]struct{}, len(step.Candidates))
+		for _, c := range step.Candidates {
+			c = strings.TrimSpace(c)
+			if c == "" {
+				continue
+			}
+			if _, ok := seen[c]; ok {
+				continue
+			}
+			seen[c] = struct{}{}
+			candidates = append(candidates, c)
+		}
+		if step.Type == model.PipelineStepRoute {
+			if len(candidates) == 0 {
+				return nil, fmt.Errorf("%w: %s[%d] route 步骤需要至少一个候选模型", ErrGroupPipeline, stage, i)
+			}
+			if len(candidates) > maxPipelineCandidates {
+				return nil, fmt.Errorf("%w: %s[%d] 候选模型最多 %d 个", ErrGroupPipeline, stage, i, maxPipelineCandidates)
+			}
+			step.Candidates = candidates
+		} else {
+			step.Candidates = nil
+		}
+		result = append(result, step)
+	}
+	return result, nil
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"errors"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+var (
+	// ErrOutOfAdminScope 目标用户或分组不在当前管理员的管理范围内
+	ErrOutOfAdminScope = errors.New("无权管理该用户或分组")
+	// ErrGroupAdminIsGlobalAdmin 全局管理员无需指定为分组管理员
+	ErrGroupAdminIsGlobalAdmin = errors.New("该用户已是全局管理员")
+)
+
+const (
+	auditActionGroupAdminAdd    = "group.admin_add"
+	auditActionGroupAdminRemove = "group.admin_remove"
+)
+
+// AdminScope 管理操作的权限范围：全局管理员不受限制；
+// 分组管理员只能管理所辖分组内的普通用户（及其 API Key 与模型映射），不能管理渠道与全局配置
+type AdminScope struct {
+	Global   bool     `json:"global"`
+	GroupIDs []string `json:"groupIds"`
+}
+
+// ManagesGroup 是否可以管理该分组的成员
+func (sc *AdminScope) ManagesGroup(groupID string) bool {
+	if sc == nil {
+		return false
+	}
+	if sc.Global {
+		return true
+	}
+	for _, id := range sc.GroupIDs {
+		if id == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// managesAnyGroup 是否管理 groupIDs 中的任一分组
+func (sc *AdminScope) managesAnyGroup(groupIDs []string) bool {
+	for _, id := range groupIDs {
+		if sc.ManagesGroup(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveAdminScope 返回用户的管理权限范围，既不是管理员也不是分组管理员时返回 nil
+func ResolveAdminScope(userID string) (*AdminScope, error) {
+	user, err := repository.NewUserRepository().GetByID(userID)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	if user.IsAdmin {
+		return &AdminScope{Global: true}, nil
+	}
+	groupIDs, err := repository.NewGroupRepository().GetAdminGroupIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+	return &AdminScope{GroupIDs: groupIDs}, nil
+}
+
+// CheckUserInScope 校验目标用户在管理范围内：分组管理员只能管理所辖分组内的普通用户，
+// 全局管理员与其他分组管理员（包括自己）不在范围内，防止分组管理员之间互相修改余额、密码或停用账户
+func CheckUserInScope(scope *AdminScope, userID string) error {
+	if scope == nil {
+		return ErrOutOfAdminScope
+	}
+	userRepo := repository.NewUserRepository()
+	user, err := userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return repository.ErrUserNotFound
+	}
+	if scope.Global {
+		return nil
+	}
+	if user.IsAdmin {
+		return ErrOutOfAdminScope
+	}
+	adminGroupIDs, err := repository.NewGroupRepository().GetAdminGroupIDs(userID)
+	if err != nil {
+		return err
+	}
+	if len(adminGroupIDs) > 0 {
+		return ErrOutOfAdminScope
+	}
+	groupIDs, err := userRepo.GetGroupIDs(userID)
+	if err != nil {
+		return err
+	}
+	if !scope.managesAnyGroup(groupIDs) {
+		return ErrOutOfAdminScope
+	}
+	return nil
+}
+
+// FilterUsersInScope 过滤出管理范围内的用户
+func FilterUsersInScope(scope *AdminScope, users []*model.UserInfo) []*model.UserInfo {
+	if scope != nil && scope.Global {
+		return users
+	}
+	result := make([]*model.UserInfo, 0, len(users))
+	for _, u := range users {
+		if !u.IsAdmin && scope.managesAnyGroup(u.GroupIDs) {
+			result = append(result, u)
+		}
+	}
+	return result
+}
+
+// SetGroupsInScope 在管理范围内设置用户分组：分组管理员只能分配所辖分组，用户在其他分组的成员关系保持不变
+func (s *UserService) SetGroupsInScope(scope *AdminScope, userID string, groupIDs []string) error {
+	if scope != nil && scope.Global {
+		return s.SetGroups(userID, groupIDs)
+	}
+	for _, gid := range groupIDs {
+		if !scope.ManagesGroup(gid) {
+			return ErrOutOfAdminScope
+		}
+	}
+	current, err := s.repo.GetGroupIDs(userID)
+	if err != nil {
+		return err
+	}
+	merged := append([]string{}, groupIDs...)
+	for _, gid := range current {
+		if !scope.ManagesGroup(gid) {
+			merged = append(merged, gid)
+		}
+	}
+	return s.SetGroups(userID, merged)
+}
+
+// ListInScope 列出管理范围内的分组
+func (s *GroupService) ListInScope(scope *AdminScope) ([]*model.GroupResponse, error) {
+	groups, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.GroupResponse, 0, len(groups))
+	for _, g := range groups {
+		if scope.ManagesGroup(g.ID) {
+			result = append(result, g)
+		}
+	}
+	return result, nil
+}
+
+// ListAdmins 列出分组管理员
+func (s *GroupService) ListAdmins(groupID string) ([]*model.GroupAdmin, error) {
+	group, err := s.repo.GetByID(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, ErrGroupNotFound
+	}
+	return s.repo.ListAdmins(groupID)
+}
+
+// AddAdmin 指定分组管理员并写入审计记录
+func (s *GroupService) AddAdmin(actor, groupID, userID string) error {
+	group, err := s.repo.GetByID(groupID)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotFound
+	}
+	user, err := repository.NewUserRepository().GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return repository.ErrUserNotFound
+	}
+	if user.IsAdmin {
+		return ErrGroupAdminIsGlobalAdmin
+	}
+	if err := s.repo.AddAdmin(groupID, userID, actor); err != nil {
+		return err
+	}
+	recordAudit(actor, auditActionGroupAdminAdd, "group", groupID, map[string]interface{}{
+		"userId":   userID,
+		"username": user.Username,
+	})
+	return nil
+}
+
+// RemoveAdmin 撤销分组管理员；用户不是该分组管理员时返回 false
+func (s *GroupService) RemoveAdmin(actor, groupID, userID string) (bool, error) {
+	removed, err := s.repo.RemoveAdmin(groupID, userID)
+	if err != nil || !removed {
+		return false, err
+	}
+	recordAudit(actor, auditActionGroupAdminRemove, "group", groupID, map[string]interface{}{
+		"userId": userID,
+	})
+	return true, nil
+}
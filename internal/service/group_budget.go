@@ -0,0 +1,343 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/realtime"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultGroupBudgetAlertInterval = 600
+	minGroupBudgetAlertInterval     = 60
+	defaultGroupBudgetForecastDays  = 3
+)
+
+// groupBudgetThresholds 实际费用告警的阈值百分比
+var groupBudgetThresholds = []int{50, 80, 100}
+
+var ErrGroupBudgetCheckRunning = errors.New("分组预算检查正在进行中")
+
+var groupBudgetState struct {
+	mu     sync.RWMutex
+	config model.GroupBudgetAlertConfig
+}
+
+// groupBudgetRunMu 保证同一时间只有一次检查（定时任务与手动触发互斥）
+var groupBudgetRunMu sync.Mutex
+
+func init() {
+	groupBudgetState.config = DefaultGroupBudgetAlertConfig()
+}
+
+// DefaultGroupBudgetAlertConfig 默认每 10 分钟检查一次，本月满 3 天后启用预测告警
+func DefaultGroupBudgetAlertConfig() model.GroupBudgetAlertConfig {
+	return model.GroupBudgetAlertConfig{
+		Enabled:         true,
+		IntervalSec:     defaultGroupBudgetAlertInterval,
+		ForecastMinDays: defaultGroupBudgetForecastDays,
+	}
+}
+
+// NormalizeGroupBudgetAlertConfig 填充未设置的字段
+func NormalizeGroupBudgetAlertConfig(cfg model.GroupBudgetAlertConfig) model.GroupBudgetAlertConfig {
+	if cfg.IntervalSec <= 0 {
+		cfg.IntervalSec = defaultGroupBudgetAlertInterval
+	}
+	if cfg.ForecastMinDays <= 0 {
+		cfg.ForecastMinDays = defaultGroupBudgetForecastDays
+	}
+	return cfg
+}
+
+// ValidateGroupBudgetAlertConfig 校验分组预算告警配置（需先 Normalize）
+func ValidateGroupBudgetAlertConfig(cfg model.GroupBudgetAlertConfig) error {
+	if cfg.IntervalSec < minGroupBudgetAlertInterval {
+		return fmt.Errorf("intervalSec 不能小于 %d", minGroupBudgetAlertInterval)
+	}
+	if cfg.ForecastMinDays > 28 {
+		return errors.New("forecastMinDays 不能超过 28")
+	}
+	return nil
+}
+
+// InitGroupBudgetAlertConfig 启动时从持久化配置加载
+func InitGroupBudgetAlertConfig(configJSON string) {
+	var cfg model.GroupBudgetAlertConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("group budget: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+	cfg = NormalizeGroupBudgetAlertConfig(cfg)
+	if err := ValidateGroupBudgetAlertConfig(cfg); err != nil {
+		log.Warnf("group budget: 配置无效，使用默认配置: %v", err)
+		return
+	}
+	UpdateGroupBudgetAlertConfig(cfg)
+}
+
+// UpdateGroupBudgetAlertConfig 更新运行时配置，运行中的定时任务会重置检查间隔
+func UpdateGroupBudgetAlertConfig(cfg model.GroupBudgetAlertConfig) {
+	groupBudgetState.mu.Lock()
+	groupBudgetState.config = cfg
+	groupBudgetState.mu.Unlock()
+
+	if globalGroupBudgetChecker != nil {
+		globalGroupBudgetChecker.notifyReload()
+	}
+}
+
+// GetGroupBudgetAlertConfig 获取当前分组预算告警配置
+func GetGroupBudgetAlertConfig() model.GroupBudgetAlertConfig {
+	groupBudgetState.mu.RLock()
+	defer groupBudgetState.mu.RUnlock()
+	return groupBudgetState.config
+}
+
+// budgetMonth 返回 now 所在自然月（UTC）的起止时间与月份标识
+func budgetMonth(now time.Time) (start, end time.Time, month string) {
+	now = now.UTC()
+	start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0), start.Format("2006-01")
+}
+
+// forecastMonthSpend 按本月至今的平均消耗速度线性外推月末费用
+func forecastMonthSpend(spend int64, start, end, now time.Time) int64 {
+	elapsed := now.Sub(start)
+	if elapsed <= 0 || spend <= 0 {
+		return spend
+	}
+	if !now.Before(end) {
+		return spend
+	}
+	return int64(float64(spend) * float64(end.Sub(start)) / float64(elapsed))
+}
+
+// budgetPercent 费用占预算的百分比，保留两位小数
+func budgetPercent(spend, budget int64) float64 {
+	if budget <= 0 {
+		return 0
+	}
+	return math.Round(float64(spend)/float64(budget)*10000) / 100
+}
+
+// groupBudgetAlertsDue 按本月费用与预测值得出应触发的告警；每种告警是否已触发由存储层去重
+func groupBudgetAlertsDue(group *model.Group, spend, forecast int64, month string, forecastEnabled bool) []*model.GroupBudgetAlert {
+	budget := group.MonthlyBudgetMicros
+	if budget <= 0 {
+		return nil
+	}
+	newAlert := func(kind string, threshold int) *model.GroupBudgetAlert {
+		return &model.GroupBudgetAlert{
+			GroupID:          group.ID,
+			GroupName:        group.Name,
+			Month:            month,
+			Kind:             kind,
+			ThresholdPercent: threshold,
+			BudgetMicros:     budget,
+			SpendMicros:      spend,
+			ForecastMicros:   forecast,
+		}
+	}
+
+	var alerts []*model.GroupBudgetAlert
+	for _, threshold := range groupBudgetThresholds {
+		if spend*100 >= budget*int64(threshold) {
+			alerts = append(alerts, newAlert(model.GroupBudgetAlertThreshold, threshold))
+		}
+	}
+	// 已经超出预算时不再另发预测告警
+	if forecastEnabled && spend < budget && forecast > budget {
+		alerts = append(alerts, newAlert(model.GroupBudgetAlertForecast, 100))
+	}
+	return alerts
+}
+
+type GroupBudgetService struct {
+	groupRepo  repository.GroupRepositoryInterface
+	budgetRepo *repository.GroupBudgetRepository
+}
+
+func NewGroupBudgetService() *GroupBudgetService {
+	return &GroupBudgetService{
+		groupRepo:  repository.NewGroupRepository(),
+		budgetRepo: repository.NewGroupBudgetRepository(),
+	}
+}
+
+// GetStatus 返回分组本月的预算使用情况与已触发的告警
+func (s *GroupBudgetService) GetStatus(groupID string) (*model.GroupBudgetStatus, error) {
+	group, err := s.groupRepo.GetByID(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, ErrGroupNotFound
+	}
+
+	now := time.Now().UTC()
+	start, end, month := budgetMonth(now)
+	spend, err := s.budgetRepo.SumCostSince(group.ID, start)
+	if err != nil {
+		return nil, err
+	}
+	alerts, _, err := s.budgetRepo.List(model.GroupBudgetAlertFilter{GroupID: group.ID, Month: month, Page: 1, PageSize: 20})
+	if err != nil {
+		return nil, err
+	}
+	forecast := forecastMonthSpend(spend, start, end, now)
+	return &model.GroupBudgetStatus{
+		GroupID:         group.ID,
+		GroupName:       group.Name,
+		Month:           month,
+		BudgetMicros:    group.MonthlyBudgetMicros,
+		SpendMicros:     spend,
+		ForecastMicros:  forecast,
+		UsedPercent:     budgetPercent(spend, group.MonthlyBudgetMicros),
+		ForecastPercent: budgetPercent(forecast, group.MonthlyBudgetMicros),
+		Alerts:          alerts,
+	}, nil
+}
+
+// ListAlerts 分页查询告警历史
+func (s *GroupBudgetService) ListAlerts(filter model.GroupBudgetAlertFilter) (*model.GroupBudgetAlertListResponse, error) {
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 200 {
+		filter.PageSize = 50
+	}
+	items, total, err := s.budgetRepo.List(filter)
+	if err != nil {
+		return nil, err
+	}
+	return &model.GroupBudgetAlertListResponse{Items: items, Total: total, Page: filter.Page, PageSize: filter.PageSize}, nil
+}
+
+// RunGroupBudgetCheck 检查所有设置了预算的分组，返回本次新触发的告警
+func RunGroupBudgetCheck() ([]*model.GroupBudgetAlert, error) {
+	if !groupBudgetRunMu.TryLock() {
+		return nil, ErrGroupBudgetCheckRunning
+	}
+	defer groupBudgetRunMu.Unlock()
+	return NewGroupBudgetService().checkAll(time.Now().UTC())
+}
+
+func (s *GroupBudgetService) checkAll(now time.Time) ([]*model.GroupBudgetAlert, error) {
+	cfg := GetGroupBudgetAlertConfig()
+	groups, err := s.groupRepo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, month := budgetMonth(now)
+	forecastEnabled := now.Sub(start) >= time.Duration(cfg.ForecastMinDays)*24*time.Hour
+	fired := []*model.GroupBudgetAlert{}
+	for _, group := range groups {
+		if group.MonthlyBudgetMicros <= 0 {
+			continue
+		}
+		spend, err := s.budgetRepo.SumCostSince(group.ID, start)
+		if err != nil {
+			return fired, fmt.Errorf("group %s: %w", group.ID, err)
+		}
+		forecast := forecastMonthSpend(spend, start, end, now)
+		for _, alert := range groupBudgetAlertsDue(group, spend, forecast, month, forecastEnabled) {
+			created, err := s.budgetRepo.CreateOnce(alert)
+			if err != nil {
+				return fired, fmt.Errorf("group %s: %w", group.ID, err)
+			}
+			if created {
+				notifyGroupBudgetAlert(alert)
+				fired = append(fired, alert)
+			}
+		}
+	}
+	return fired, nil
+}
+
+// notifyGroupBudgetAlert 新触发告警时记录日志并推送给在线的管理端
+func notifyGroupBudgetAlert(alert *model.GroupBudgetAlert) {
+	log.WithFields(log.Fields{
+		"groupId":          alert.GroupID,
+		"groupName":        alert.GroupName,
+		"kind":             alert.Kind,
+		"thresholdPercent": alert.ThresholdPercent,
+		"budgetMicros":     alert.BudgetMicros,
+		"spendMicros":      alert.SpendMicros,
+		"forecastMicros":   alert.ForecastMicros,
+	}).Warnf("group budget: 分组 %s 本月预算告警 (%s %d%%)", alert.GroupName, alert.Kind, alert.ThresholdPercent)
+	realtime.Broadcast("group_budget_alert", alert)
+}
+
+type GroupBudgetChecker struct {
+	reloadChan chan struct{}
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+}
+
+var globalGroupBudgetChecker *GroupBudgetChecker
+
+// InitGroupBudgetChecker 启动全局分组预算检查任务，启动后立即执行一次
+func InitGroupBudgetChecker() {
+	globalGroupBudgetChecker = &GroupBudgetChecker{
+		reloadChan: make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+	}
+	globalGroupBudgetChecker.wg.Add(1)
+	go globalGroupBudgetChecker.run()
+	log.Info("group budget: checker started")
+}
+
+// StopGroupBudgetChecker 停止全局分组预算检查任务
+func StopGroupBudgetChecker() {
+	if globalGroupBudgetChecker == nil {
+		return
+	}
+	globalGroupBudgetChecker.stopOnce.Do(func() { close(globalGroupBudgetChecker.stopChan) })
+	globalGroupBudgetChecker.wg.Wait()
+	log.Info("group budget: checker stopped")
+}
+
+func (g *GroupBudgetChecker) notifyReload() {
+	select {
+	case g.reloadChan <- struct{}{}:
+	default:
+	}
+}
+
+func (g *GroupBudgetChecker) run() {
+	defer g.wg.Done()
+	g.check()
+
+	ticker := time.NewTicker(time.Duration(GetGroupBudgetAlertConfig().IntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.check()
+		case <-g.reloadChan:
+			ticker.Reset(time.Duration(GetGroupBudgetAlertConfig().IntervalSec) * time.Second)
+		case <-g.stopChan:
+			return
+		}
+	}
+}
+
+func (g *GroupBudgetChecker) check() {
+	if !GetGroupBudgetAlertConfig().Enabled {
+		return
+	}
+	if _, err := RunGroupBudgetCheck(); err != nil && !errors.Is(err, ErrGroupBudgetCheckRunning) {
+		log.Errorf("group budget: %v", err)
+	}
+}
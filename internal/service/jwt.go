@@ -44,7 +44,7 @@ func (s *JWTService) GenerateToken(userID, username string) (string, error) {
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(cfg.JWTSecret))
+	return token.SignedString([]byte(cfg.GetJWTSecret()))
 }
 
 func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
@@ -54,7 +54,7 @@ func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrInvalidToken
 		}
-		return []byte(cfg.JWTSecret), nil
+		return []byte(cfg.GetJWTSecret()), nil
 	})
 
 	if err != nil {
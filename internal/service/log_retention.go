@@ -0,0 +1,131 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// requestLogsPrunedBeforeKey 早于该时间（RFC3339，UTC 零点）的请求日志已被保留策略清理
+const requestLogsPrunedBeforeKey = "request_logs_pruned_before"
+
+// RequestLogsPrunedBefore 返回请求日志已清理到的时间，从未清理过时返回 nil
+func RequestLogsPrunedBefore() *time.Time {
+	value, err := repository.NewSystemConfigRepository().Get(requestLogsPrunedBeforeKey)
+	if err != nil {
+		log.Warnf("log retention: load pruned marker failed: %v", err)
+		return nil
+	}
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// MarkRequestLogsPrunedBefore 记录请求日志已清理到 before，只会向后推进
+func MarkRequestLogsPrunedBefore(before time.Time) error {
+	before = before.UTC()
+	if current := RequestLogsPrunedBefore(); current != nil && !before.After(*current) {
+		return nil
+	}
+	return repository.NewSystemConfigRepository().Set(requestLogsPrunedBeforeKey, before.Format(time.RFC3339))
+}
+
+// mergePrunedRollups 将已清理范围内 usage_rollups 的汇总计入仪表盘的统计与每日趋势。
+// 每日趋势按 params.Location 的自然日分组，小时桶按其起始时间换算到该时区的日期；超出小时桶保留期的部分只有 UTC 天桶，
+// 按该 UTC 日正午所在的本地日期计入。汇总只包含请求数、错误数、token 与费用，热门模型与缓存命中率仍只统计原始日志
+func mergePrunedRollups(summary *repository.DashboardSummary, params repository.DashboardSummaryParams) error {
+	prunedBefore := RequestLogsPrunedBefore()
+	if prunedBefore == nil || !params.From.Before(*prunedBefore) {
+		return nil
+	}
+	loc := params.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	start := params.From.UTC().Truncate(time.Hour)
+	end := prunedBefore.UTC()
+	if to := params.To.UTC().Truncate(time.Hour).Add(time.Hour); to.Before(end) {
+		end = to
+	}
+	rollups := repository.NewUsageRollupRepository()
+
+	byDate := make(map[string]int, len(summary.DailyTrend))
+	for i, d := range summary.DailyTrend {
+		byDate[d.Date] = i
+	}
+	merge := func(date string, row repository.UsageRollupPoint) {
+		summary.Period.RequestCount += row.Requests
+		summary.Period.ErrorCount += row.Errors
+		summary.Period.InputTokensSum += row.InputTokens
+		summary.Period.OutputTokensSum += row.OutputTokens
+		summary.Period.CostMicrosSum += row.CostMicros
+
+		if i, ok := byDate[date]; ok {
+			summary.DailyTrend[i].Requests += row.Requests
+			summary.DailyTrend[i].CostMicros += row.CostMicros
+			return
+		}
+		byDate[date] = len(summary.DailyTrend)
+		summary.DailyTrend = append(summary.DailyTrend, repository.DashboardDailyTrend{
+			Date:       date,
+			CostMicros: row.CostMicros,
+			Requests:   row.Requests,
+		})
+	}
+
+	// 小时桶只保留最近 usageRollupHourRetention，从其后第一个完整的 UTC 日开始使用
+	hourFrom := utcDayStart(time.Now().Add(-usageRollupHourRetention)).AddDate(0, 0, 1)
+	if start.Before(hourFrom) {
+		dayEnd := end
+		if hourFrom.Before(dayEnd) {
+			dayEnd = hourFrom
+		}
+		rows, err := rollups.Series(repository.UsageRollupDay, utcDayStart(start).Format(repository.UsageRollupDayLayout),
+			utcDayStart(dayEnd.Add(-time.Nanosecond)).AddDate(0, 0, 1).Format(repository.UsageRollupDayLayout), params.UserID)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			day, err := time.Parse(repository.UsageRollupDayLayout, row.Bucket)
+			if err != nil {
+				continue
+			}
+			merge(day.Add(12*time.Hour).In(loc).Format(repository.UsageRollupDayLayout), row)
+		}
+		start = hourFrom
+	}
+	if start.Before(end) {
+		rows, err := rollups.Series(repository.UsageRollupHour, start.Format(repository.UsageRollupHourLayout),
+			end.Format(repository.UsageRollupHourLayout), params.UserID)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			hour, err := time.Parse(repository.UsageRollupHourLayout, row.Bucket)
+			if err != nil {
+				continue
+			}
+			merge(hour.In(loc).Format(repository.UsageRollupDayLayout), row)
+		}
+	}
+
+	sort.Slice(summary.DailyTrend, func(i, j int) bool {
+		return summary.DailyTrend[i].Date < summary.DailyTrend[j].Date
+	})
+	return nil
+}
+
+// utcDayStart 返回 t 所在 UTC 自然日的零点
+func utcDayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"ampmanager/internal/database"
+	"ampmanager/internal/repository"
+)
+
+func insertUsageRequestLog(t *testing.T, id, userID string, createdAt time.Time, costMicros int64, statusCode int) {
+	t.Helper()
+	_, err := database.GetDB().Exec(`
+		INSERT INTO request_logs (id, created_at, user_id, api_key_id, method, path, status_code, latency_ms, input_tokens, output_tokens, cost_micros)
+		VALUES (?, ?, ?, 'key-1', 'POST', '/v1/messages', ?, 10, 100, 20, ?)`,
+		id, createdAt, userID, statusCode, costMicros,
+	)
+	if err != nil {
+		t.Fatalf("insert request log %s: %v", id, err)
+	}
+}
+
+// pruneRequestLogs 模拟保留策略：删除 cutoff 之前的请求日志并记录清理位置
+func pruneRequestLogs(t *testing.T, cutoff time.Time) {
+	t.Helper()
+	if _, err := database.GetDB().Exec(`DELETE FROM request_logs WHERE created_at < ?`, cutoff); err != nil {
+		t.Fatalf("delete request logs: %v", err)
+	}
+	if err := MarkRequestLogsPrunedBefore(cutoff); err != nil {
+		t.Fatalf("mark pruned: %v", err)
+	}
+}
+
+func trendRequests(trend []repository.DashboardDailyTrend) map[string]int64 {
+	result := make(map[string]int64, len(trend))
+	for _, d := range trend {
+		result[d.Date] = d.Requests
+	}
+	return result
+}
+
+func TestMarkRequestLogsPrunedBefore(t *testing.T) {
+	setupTestDB(t)
+	if got := RequestLogsPrunedBefore(); got != nil {
+		t.Fatalf("pruned before = %v, want nil", got)
+	}
+
+	cutoff := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	if err := MarkRequestLogsPrunedBefore(cutoff.In(mustLocation(t, "Asia/Shanghai"))); err != nil {
+		t.Fatalf("mark: %v", err)
+	}
+	if got := RequestLogsPrunedBefore(); got == nil || !got.Equal(cutoff) {
+		t.Fatalf("pruned before = %v, want %v", got, cutoff)
+	}
+
+	// 清理位置只会向后推进
+	if err := MarkRequestLogsPrunedBefore(cutoff.AddDate(0, 0, -1)); err != nil {
+		t.Fatalf("mark earlier: %v", err)
+	}
+	if got := RequestLogsPrunedBefore(); !got.Equal(cutoff) {
+		t.Errorf("pruned before moved back to %v", got)
+	}
+	if err := MarkRequestLogsPrunedBefore(cutoff.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("mark later: %v", err)
+	}
+	if got := RequestLogsPrunedBefore(); !got.Equal(cutoff.AddDate(0, 0, 1)) {
+		t.Errorf("pruned before = %v, want %v", got, cutoff.AddDate(0, 0, 1))
+	}
+}
+
+func TestUsageRollupRunOnce(t *testing.T) {
+	setupTestDB(t)
+	now := time.Date(2026, 3, 11, 6, 30, 0, 0, time.UTC)
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	insertUsageRequestLog(t, "r1", "u1", day.Add(1*time.Hour+10*time.Minute), 100, 200)
+	insertUsageRequestLog(t, "r2", "u1", day.Add(1*time.Hour+50*time.Minute), 200, 500)
+	insertUsageRequestLog(t, "r3", "u2", day.Add(23*time.Hour), 400, 200)
+	insertUsageRequestLog(t, "r4", "u1", day.Add(25*time.Hour), 800, 200)
+	// pending 请求不计入汇总
+	if _, err := database.GetDB().Exec(`INSERT INTO request_logs (id, created_at, user_id, api_key_id, method, path, status_code, latency_ms, status, cost_micros)
+		VALUES ('r5', ?, 'u1', 'key-1', 'POST', '/v1/messages', 0, 0, 'pending', 1600)`, day.Add(2*time.Hour)); err != nil {
+		t.Fatalf("insert pending log: %v", err)
+	}
+
+	svc := NewUsageRollupService()
+	if err := svc.RunOnce(now, nil); err != nil {
+		t.Fatalf("run once: %v", err)
+	}
+	if wm, err := svc.Watermark(); err != nil || wm == nil || !wm.Equal(now) {
+		t.Fatalf("watermark = %v, %v", wm, err)
+	}
+
+	rollups := repository.NewUsageRollupRepository()
+	hours, err := rollups.Series(repository.UsageRollupHour, "2026-03-10 00", "2026-03-12 00", "")
+	if err != nil {
+		t.Fatalf("hour series: %v", err)
+	}
+	wantHours := []repository.UsageRollupPoint{
+		{Bucket: "2026-03-10 01", Requests: 2, Errors: 1, InputTokens: 200, OutputTokens: 40, CostMicros: 300},
+		{Bucket: "2026-03-10 23", Requests: 1, InputTokens: 100, OutputTokens: 20, CostMicros: 400},
+		{Bucket: "2026-03-11 01", Requests: 1, InputTokens: 100, OutputTokens: 20, CostMicros: 800},
+	}
+	if !reflect.DeepEqual(hours, wantHours) {
+		t.Errorf("hour buckets = %+v, want %+v", hours, wantHours)
+	}
+
+	days, err := rollups.Series(repository.UsageRollupDay, "2026-03-10", "2026-03-12", "u1")
+	if err != nil {
+		t.Fatalf("day series: %v", err)
+	}
+	wantDays := []repository.UsageRollupPoint{
+		{Bucket: "2026-03-10", Requests: 2, Errors: 1, InputTokens: 200, OutputTokens: 40, CostMicros: 300},
+		{Bucket: "2026-03-11", Requests: 1, InputTokens: 100, OutputTokens: 20, CostMicros: 800},
+	}
+	if !reflect.DeepEqual(days, wantDays) {
+		t.Errorf("u1 day buckets = %+v, want %+v", days, wantDays)
+	}
+}
+
+// 已清理的日志由汇总补足，每日趋势与原始日志一样按用户时区的自然日分组
+func TestDashboardSummaryMergesPrunedRollupsInLocation(t *testing.T) {
+	setupTestDB(t)
+	shanghai := mustLocation(t, "Asia/Shanghai")
+	now := time.Now().UTC()
+	day := utcDayStart(now).AddDate(0, 0, -40)
+	cutoff := day.AddDate(0, 0, 1)
+
+	// UTC 02:00 与 20:00 同属一个 UTC 日，在 UTC+8 分属两天
+	insertUsageRequestLog(t, "early", "u1", day.Add(2*time.Hour), 100, 200)
+	insertUsageRequestLog(t, "late", "u1", day.Add(20*time.Hour), 200, 500)
+	// 清理位置之后的原始日志，UTC+8 与 late 同一天
+	insertUsageRequestLog(t, "kept", "u1", cutoff.Add(3*time.Hour), 400, 200)
+	if err := NewUsageRollupService().RunOnce(now, nil); err != nil {
+		t.Fatalf("run once: %v", err)
+	}
+	pruneRequestLogs(t, cutoff)
+
+	localDay := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, shanghai)
+	params := repository.DashboardSummaryParams{UserID: "u1", From: localDay, To: localDay.AddDate(0, 0, 2).Add(-time.Second), Location: shanghai}
+	summary, err := NewRequestLogService().GetDashboardSummary(params)
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if summary.Period.RequestCount != 3 || summary.Period.ErrorCount != 1 || summary.Period.CostMicrosSum != 700 {
+		t.Errorf("period = %+v", summary.Period)
+	}
+	want := map[string]int64{
+		day.Format(repository.UsageRollupDayLayout):    1,
+		cutoff.Format(repository.UsageRollupDayLayout): 2,
+	}
+	if got := trendRequests(summary.DailyTrend); !reflect.DeepEqual(got, want) {
+		t.Errorf("daily trend = %v, want %v", got, want)
+	}
+
+	// UTC 视角下两条已清理的请求在同一天，未清理的请求在下一天
+	params.Location = nil
+	params.From, params.To = day, cutoff.AddDate(0, 0, 1).Add(-time.Second)
+	summary, err = NewRequestLogService().GetDashboardSummary(params)
+	if err != nil {
+		t.Fatalf("utc summary: %v", err)
+	}
+	want = map[string]int64{
+		day.Format(repository.UsageRollupDayLayout):    2,
+		cutoff.Format(repository.UsageRollupDayLayout): 1,
+	}
+	if got := trendRequests(summary.DailyTrend); !reflect.DeepEqual(got, want) {
+		t.Errorf("utc daily trend = %v, want %v", got, want)
+	}
+
+	// 范围只覆盖本地日期的后半天时，不计入更早的小时
+	params.Location = shanghai
+	params.From, params.To = localDay.Add(12*time.Hour), localDay.AddDate(0, 0, 1).Add(-time.Second)
+	summary, err = NewRequestLogService().GetDashboardSummary(params)
+	if err != nil {
+		t.Fatalf("partial summary: %v", err)
+	}
+	if summary.Period.RequestCount != 0 || len(summary.DailyTrend) != 0 {
+		t.Errorf("partial range period = %+v, trend = %v", summary.Period, summary.DailyTrend)
+	}
+}
+
+// 超出小时桶保留期的部分只有 UTC 天桶，按该日正午所在的本地日期计入
+func TestDashboardSummaryMergesDayRollupsBeyondHourRetention(t *testing.T) {
+	setupTestDB(t)
+	newYork := mustLocation(t, "America/New_York")
+	now := time.Now().UTC()
+	day := utcDayStart(now).AddDate(0, 0, -120)
+
+	insertUsageRequestLog(t, "old-1", "u1", day.Add(2*time.Hour), 100, 200)
+	insertUsageRequestLog(t, "old-2", "u1", day.Add(20*time.Hour), 200, 200)
+	if err := NewUsageRollupService().RunOnce(now, nil); err != nil {
+		t.Fatalf("run once: %v", err)
+	}
+	pruneRequestLogs(t, day.AddDate(0, 0, 1))
+
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, newYork).AddDate(0, 0, -1)
+	summary, err := NewRequestLogService().GetDashboardSummary(repository.DashboardSummaryParams{
+		UserID: "u1", From: from, To: from.AddDate(0, 0, 3), Location: newYork,
+	})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if summary.Period.RequestCount != 2 || summary.Period.CostMicrosSum != 300 {
+		t.Errorf("period = %+v", summary.Period)
+	}
+	want := map[string]int64{day.Format(repository.UsageRollupDayLayout): 2}
+	if got := trendRequests(summary.DailyTrend); !reflect.DeepEqual(got, want) {
+		t.Errorf("daily trend = %v, want %v", got, want)
+	}
+}
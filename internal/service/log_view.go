@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+var (
+	ErrLogViewNotFound      = errors.New("视图不存在")
+	ErrLogViewNameExists    = errors.New("视图名称已存在")
+	ErrLogViewInvalidWindow = errors.New("lastDuration 格式无效，应为 Go duration（如 1h、30m）")
+	ErrLogViewInvalidStatus = errors.New("status 无效，允许值: pending, success, error")
+)
+
+type SavedLogViewService struct {
+	repo *repository.SavedLogViewRepository
+}
+
+func NewSavedLogViewService() *SavedLogViewService {
+	return &SavedLogViewService{
+		repo: repository.NewSavedLogViewRepository(),
+	}
+}
+
+func (s *SavedLogViewService) List(userID string, pinnedOnly bool) ([]*model.SavedLogView, error) {
+	return s.repo.ListByUser(userID, pinnedOnly)
+}
+
+func (s *SavedLogViewService) Get(userID, id string) (*model.SavedLogView, error) {
+	view, err := s.repo.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if view == nil {
+		return nil, ErrLogViewNotFound
+	}
+	return view, nil
+}
+
+func (s *SavedLogViewService) Create(userID string, req *model.SavedLogViewRequest) (*model.SavedLogView, error) {
+	name := strings.TrimSpace(req.Name)
+	if err := validateLogFilters(&req.Filters); err != nil {
+		return nil, err
+	}
+	exists, err := s.repo.ExistsByName(userID, name, "")
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrLogViewNameExists
+	}
+
+	view := &model.SavedLogView{
+		UserID:  userID,
+		Name:    name,
+		Filters: req.Filters,
+		Pinned:  req.Pinned,
+	}
+	if err := s.repo.Create(view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+func (s *SavedLogViewService) Update(userID, id string, req *model.SavedLogViewRequest) (*model.SavedLogView, error) {
+	view, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if err := validateLogFilters(&req.Filters); err != nil {
+		return nil, err
+	}
+	exists, err := s.repo.ExistsByName(userID, name, id)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrLogViewNameExists
+	}
+
+	view.Name = name
+	view.Filters = req.Filters
+	view.Pinned = req.Pinned
+	if err := s.repo.Update(view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+func (s *SavedLogViewService) SetPinned(userID, id string, pinned bool) (*model.SavedLogView, error) {
+	view, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	view.Pinned = pinned
+	if err := s.repo.Update(view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+func (s *SavedLogViewService) Delete(userID, id string) error {
+	if _, err := s.Get(userID, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(userID, id)
+}
+
+// ApplyToParams 将视图过滤条件写入列表查询参数
+// adminScope 为 false 时忽略视图中的 userId，避免普通用户越权查询
+func (s *SavedLogViewService) ApplyToParams(view *model.SavedLogView, params *ListRequestLogsParams, adminScope bool) {
+	f := view.Filters
+	if adminScope && f.UserID != "" {
+		params.UserID = f.UserID
+	}
+	params.APIKeyID = f.APIKeyID
+	params.Model = f.Model
+	params.StatusCode = f.StatusCode
+	params.Status = f.Status
+	params.IsStreaming = f.IsStreaming
+	params.MinCost = f.MinCost
+	params.From = f.From
+	params.To = f.To
+	if f.LastDuration != "" {
+		if d, err := time.ParseDuration(f.LastDuration); err == nil {
+			from := time.Now().UTC().Add(-d)
+			params.From = &from
+			params.To = nil
+		}
+	}
+}
+
+func validateLogFilters(f *model.LogFilterDefinition) error {
+	if f.LastDuration != "" {
+		d, err := time.ParseDuration(f.LastDuration)
+		if err != nil || d <= 0 {
+			return ErrLogViewInvalidWindow
+		}
+	}
+	switch model.RequestLogStatus(f.Status) {
+	case "", model.RequestLogStatusPending, model.RequestLogStatusSuccess, model.RequestLogStatusError:
+	default:
+		return ErrLogViewInvalidStatus
+	}
+	return nil
+}
@@ -26,6 +26,7 @@ func NewModelService() *ModelService {
 	}
 }
 
+// FetchAndSaveModels 立即从上游拉取渠道模型并同步，返回上游当前提供的模型数
 func (s *ModelService) FetchAndSaveModels(channelID string) (int, error) {
 	channel, err := s.channelRepo.GetByID(channelID)
 	if err != nil {
@@ -35,27 +36,53 @@ func (s *ModelService) FetchAndSaveModels(channelID string) (int, error) {
 		return 0, fmt.Errorf("渠道不存在")
 	}
 
-	models, err := s.fetchModelsFromProvider(channel)
+	result, err := s.syncChannelModels(channel)
 	if err != nil {
 		return 0, err
 	}
+	return result.Total, nil
+}
+
+// syncChannelModels 拉取上游模型列表并同步到 channel_models，上游不再返回的模型标记为已移除
+func (s *ModelService) syncChannelModels(channel *model.Channel) (*model.ModelSyncChannelResult, error) {
+	if channel.FederationIssuer != "" {
+		return nil, fmt.Errorf("联邦渠道不支持获取上游模型")
+	}
+	// 解析密钥会改写 APIKey，使用副本避免影响调用方
+	resolved := *channel
+	if _, err := resolveChannelKey(&resolved); err != nil {
+		return nil, err
+	}
+
+	models, err := s.fetchModelsFromProvider(&resolved)
+	if err != nil {
+		return nil, err
+	}
 
 	filteredModels := s.filterModelsByType(channel.Type, models)
 
 	channelModels := make([]model.ChannelModel2, len(filteredModels))
 	for i, m := range filteredModels {
 		channelModels[i] = model.ChannelModel2{
-			ChannelID:   channelID,
+			ChannelID:   channel.ID,
 			ModelID:     m.ID,
 			DisplayName: m.DisplayName,
 		}
 	}
 
-	if err := s.channelModelRepo.ReplaceModels(channelID, channelModels); err != nil {
-		return 0, err
+	added, removed, restored, err := s.channelModelRepo.SyncModels(channel.ID, channelModels)
+	if err != nil {
+		return nil, err
 	}
 
-	return len(channelModels), nil
+	return &model.ModelSyncChannelResult{
+		ChannelID:   channel.ID,
+		ChannelName: channel.Name,
+		Total:       len(channelModels),
+		Added:       nonNilStrings(added),
+		Removed:     nonNilStrings(removed),
+		Restored:    nonNilStrings(restored),
+	}, nil
 }
 
 type fetchedModel struct {
@@ -72,7 +99,7 @@ func (s *ModelService) fetchModelsFromProvider(channel *model.Channel) ([]fetche
 		err error
 	)
 
-	switch channel.Type {
+	switch channel.Type.Protocol() {
 	case model.ChannelTypeOpenAI:
 		url = strings.TrimSuffix(channel.BaseURL, "/") + "/v1/models"
 		req, err = http.NewRequest("GET", url, nil)
@@ -87,8 +114,7 @@ func (s *ModelService) fetchModelsFromProvider(channel *model.Channel) ([]fetche
 		if err != nil {
 			return nil, err
 		}
-		req.Header.Set("x-api-key", channel.APIKey)
-		req.Header.Set("anthropic-version", "2023-06-01")
+		setAnthropicAuth(req, channel.Type, channel.APIKey)
 
 	case model.ChannelTypeGemini:
 		url = strings.TrimSuffix(channel.BaseURL, "/") + "/v1beta/models?key=" + channel.APIKey
@@ -98,6 +124,14 @@ func (s *ModelService) fetchModelsFromProvider(channel *model.Channel) ([]fetche
 		}
 		req.Header.Set("x-goog-api-key", channel.APIKey)
 
+	case model.ChannelTypeOllama:
+		url = strings.TrimSuffix(channel.BaseURL, "/") + "/api/tags"
+		req, err = http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		setOllamaAuth(req, channel.APIKey)
+
 	default:
 		return nil, fmt.Errorf("不支持的渠道类型: %s", channel.Type)
 	}
@@ -118,11 +152,12 @@ func (s *ModelService) fetchModelsFromProvider(channel *model.Channel) ([]fetche
 		return nil, err
 	}
 
-	return s.parseModelsResponse(channel.Type, bodyBytes)
+	return parseModelsResponse(channel.Type, bodyBytes)
 }
 
-func (s *ModelService) parseModelsResponse(channelType model.ChannelType, body []byte) ([]fetchedModel, error) {
-	switch channelType {
+// parseModelsResponse 解析各类型上游模型列表接口的响应
+func parseModelsResponse(channelType model.ChannelType, body []byte) ([]fetchedModel, error) {
+	switch channelType.Protocol() {
 	case model.ChannelTypeOpenAI:
 		var resp struct {
 			Data []struct {
@@ -182,6 +217,27 @@ func (s *ModelService) parseModelsResponse(channelType model.ChannelType, body [
 		}
 		return models, nil
 
+	case model.ChannelTypeOllama:
+		// /api/tags 列出本地已下载的模型，name 形如 llama3.2:latest
+		var resp struct {
+			Models []struct {
+				Name  string `json:"name"`
+				Model string `json:"model"`
+			} `json:"models"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		models := make([]fetchedModel, len(resp.Models))
+		for i, m := range resp.Models {
+			modelID := m.Model
+			if modelID == "" {
+				modelID = m.Name
+			}
+			models[i] = fetchedModel{ID: modelID, DisplayName: m.Name}
+		}
+		return models, nil
+
 	default:
 		return nil, fmt.Errorf("不支持的渠道类型")
 	}
@@ -193,7 +249,7 @@ func (s *ModelService) filterModelsByType(channelType model.ChannelType, models
 	for _, m := range models {
 		idLower := strings.ToLower(m.ID)
 
-		switch channelType {
+		switch channelType.Protocol() {
 		case model.ChannelTypeOpenAI:
 			if strings.HasPrefix(idLower, "gpt") ||
 				strings.HasPrefix(idLower, "o1") ||
@@ -212,6 +268,10 @@ func (s *ModelService) filterModelsByType(channelType model.ChannelType, models
 			if strings.HasPrefix(idLower, "gemini") {
 				filtered = append(filtered, m)
 			}
+
+		case model.ChannelTypeOllama:
+			// 本地模型名不固定，全部保留
+			filtered = append(filtered, m)
 		}
 	}
 
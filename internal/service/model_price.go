@@ -0,0 +1,186 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ampmanager/internal/billing"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+var (
+	ErrModelNotAccessible = errors.New("模型不存在或当前账户无权调用")
+	ErrPriceUnavailable   = errors.New("价格服务未初始化")
+)
+
+// ModelPriceService 按用户分组倍率计算可调用模型的实际价格与费用估算，计价规则与请求结算一致
+type ModelPriceService struct {
+	channelService *ChannelService
+	groupRepo      *repository.GroupRepository
+	settingsRepo   *repository.AmpSettingsRepository
+}
+
+func NewModelPriceService() *ModelPriceService {
+	return &ModelPriceService{
+		channelService: NewChannelService(),
+		groupRepo:      repository.NewGroupRepository(),
+		settingsRepo:   repository.NewAmpSettingsRepository(),
+	}
+}
+
+// userModelEntry 用户可调用的模型及其计价模型
+type userModelEntry struct {
+	id           string
+	channelType  model.ChannelType
+	pricingModel string
+}
+
+// ListUserModelPrices 列出用户分组可访问渠道的模型及精确模型映射的价格
+func (s *ModelPriceService) ListUserModelPrices(userID string) (*model.UserModelPriceList, error) {
+	calc := billing.GetCostCalculator()
+	if calc == nil {
+		return nil, ErrPriceUnavailable
+	}
+	multiplier, entries, err := s.userModels(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.UserModelPriceList{
+		RateMultiplier: effectiveRateMultiplier(multiplier),
+		Models:         make([]model.UserModelPrice, 0, len(entries)),
+	}
+	for _, e := range entries {
+		item := model.UserModelPrice{Model: e.id, ChannelType: e.channelType, PricingModel: e.pricingModel}
+		if price, found := calc.LookupPrice(e.pricingModel); found {
+			item.PriceFound = true
+			item.BasePrice = tokenPrice(price, 1)
+			item.EffectivePrice = tokenPrice(price, result.RateMultiplier)
+		}
+		result.Models = append(result.Models, item)
+	}
+	return result, nil
+}
+
+// Quote 按预计 token 数估算调用费用（与请求结算相同：价格表单价计费后乘以分组倍率）
+func (s *ModelPriceService) Quote(userID string, req model.ModelQuoteRequest) (*model.ModelQuote, error) {
+	calc := billing.GetCostCalculator()
+	if calc == nil {
+		return nil, ErrPriceUnavailable
+	}
+	multiplier, entries, err := s.userModels(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *userModelEntry
+	for i := range entries {
+		if strings.EqualFold(entries[i].id, strings.TrimSpace(req.Model)) {
+			entry = &entries[i]
+			break
+		}
+	}
+	if entry == nil {
+		return nil, ErrModelNotAccessible
+	}
+
+	usage := billing.TokenUsage{
+		InputTokens:              req.InputTokens,
+		OutputTokens:             req.OutputTokens,
+		CacheReadInputTokens:     req.CacheReadTokens,
+		CacheCreationInputTokens: req.CacheCreationTokens,
+	}
+	var cost billing.CostResult
+	if req.Batch {
+		cost = calc.CalculateBatch(entry.pricingModel, usage)
+	} else {
+		cost = calc.Calculate(entry.pricingModel, usage)
+	}
+
+	quote := &model.ModelQuote{
+		Model:          entry.id,
+		PricingModel:   entry.pricingModel,
+		PriceFound:     cost.PriceFound,
+		RateMultiplier: effectiveRateMultiplier(multiplier),
+		BaseCostMicros: cost.CostMicros,
+		CostMicros:     billing.ApplyRateMultiplier(cost.CostMicros, multiplier),
+	}
+	quote.CostUsd = fmt.Sprintf("%.6f", float64(quote.CostMicros)/1e6)
+	return quote, nil
+}
+
+// userModels 返回用户的分组倍率与可调用模型。用户的精确模型映射在请求时先于渠道选择生效，
+// 因此被映射的模型按映射目标计价；目标不可访问的映射不列出
+func (s *ModelPriceService) userModels(userID string) (float64, []userModelEntry, error) {
+	multiplier, groupIDs, err := s.groupRepo.GetMinRateMultiplierByUserID(userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	accessible, err := s.channelService.ListAccessibleModels(groupIDs)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	entries := make([]userModelEntry, 0, len(accessible))
+	index := make(map[string]int, len(accessible))
+	byID := make(map[string]model.AccessibleModel, len(accessible))
+	for _, m := range accessible {
+		index[strings.ToLower(m.ID)] = len(entries)
+		byID[strings.ToLower(m.ID)] = m
+		entries = append(entries, userModelEntry{id: m.ID, channelType: m.ChannelType, pricingModel: m.ID})
+	}
+
+	settings, err := s.settingsRepo.GetByUserID(userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if settings == nil || settings.ModelMappingsJSON == "" {
+		return multiplier, entries, nil
+	}
+	var mappings []model.ModelMapping
+	if err := json.Unmarshal([]byte(settings.ModelMappingsJSON), &mappings); err != nil {
+		return multiplier, entries, nil
+	}
+	// 与请求时一致，同一模型只取第一条匹配的映射
+	mapped := make(map[string]bool)
+	for _, mapping := range mappings {
+		if mapping.From == "" || mapping.To == "" || mapping.Regex || mapping.AmpOnly || strings.EqualFold(mapping.From, mapping.To) {
+			continue
+		}
+		if mapped[strings.ToLower(mapping.From)] {
+			continue
+		}
+		mapped[strings.ToLower(mapping.From)] = true
+		target, ok := byID[strings.ToLower(mapping.To)]
+		if !ok {
+			continue
+		}
+		if i, exists := index[strings.ToLower(mapping.From)]; exists {
+			entries[i].pricingModel = target.ID
+			continue
+		}
+		index[strings.ToLower(mapping.From)] = len(entries)
+		entries = append(entries, userModelEntry{id: mapping.From, channelType: target.ChannelType, pricingModel: target.ID})
+	}
+	return multiplier, entries, nil
+}
+
+// effectiveRateMultiplier 倍率为 0 时结算按原价，展示为 1
+func effectiveRateMultiplier(multiplier float64) float64 {
+	if multiplier == 0 {
+		return 1
+	}
+	return multiplier
+}
+
+func tokenPrice(p billing.PriceData, multiplier float64) *model.TokenPrice {
+	return &model.TokenPrice{
+		InputCostPerToken:      p.InputCostPerToken * multiplier,
+		OutputCostPerToken:     p.OutputCostPerToken * multiplier,
+		CacheReadInputPerToken: p.CacheReadInputPerToken * multiplier,
+		CacheCreationPerToken:  p.CacheCreationPerToken * multiplier,
+	}
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultModelSyncIntervalMinutes = 360
+	minModelSyncIntervalMinutes     = 10
+	maxModelSyncIntervalMinutes     = 7 * 24 * 60
+)
+
+// 同步触发方式
+const (
+	ModelSyncTriggerScheduled = "scheduled"
+	ModelSyncTriggerManual    = "manual"
+)
+
+// ErrModelSyncRunning 已有同步在执行
+var ErrModelSyncRunning = errors.New("模型同步正在进行中")
+
+var modelSyncState struct {
+	mu         sync.RWMutex
+	config     model.ModelSyncConfig
+	lastReport *model.ModelSyncReport
+}
+
+// modelSyncRunMu 保证定时同步与手动同步不会同时执行
+var modelSyncRunMu sync.Mutex
+
+func init() {
+	modelSyncState.config = DefaultModelSyncConfig()
+}
+
+// DefaultModelSyncConfig 默认不自动同步，开启后每 6 小时同步一次
+func DefaultModelSyncConfig() model.ModelSyncConfig {
+	return model.ModelSyncConfig{IntervalMinutes: defaultModelSyncIntervalMinutes}
+}
+
+// NormalizeModelSyncConfig 填充未设置的字段
+func NormalizeModelSyncConfig(cfg model.ModelSyncConfig) model.ModelSyncConfig {
+	if cfg.IntervalMinutes <= 0 {
+		cfg.IntervalMinutes = defaultModelSyncIntervalMinutes
+	}
+	return cfg
+}
+
+// ValidateModelSyncConfig 校验模型同步配置（需先 Normalize）
+func ValidateModelSyncConfig(cfg model.ModelSyncConfig) error {
+	if cfg.IntervalMinutes < minModelSyncIntervalMinutes || cfg.IntervalMinutes > maxModelSyncIntervalMinutes {
+		return fmt.Errorf("intervalMinutes 必须在 %d 到 %d 之间", minModelSyncIntervalMinutes, maxModelSyncIntervalMinutes)
+	}
+	return nil
+}
+
+// InitModelSyncConfig 启动时从持久化配置加载
+func InitModelSyncConfig(configJSON string) {
+	var cfg model.ModelSyncConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("model sync: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+	cfg = NormalizeModelSyncConfig(cfg)
+	if err := ValidateModelSyncConfig(cfg); err != nil {
+		log.Warnf("model sync: 配置无效，使用默认配置: %v", err)
+		return
+	}
+	UpdateModelSyncConfig(cfg)
+}
+
+// UpdateModelSyncConfig 更新运行时配置，运行中的定时任务会重置同步间隔
+func UpdateModelSyncConfig(cfg model.ModelSyncConfig) {
+	modelSyncState.mu.Lock()
+	modelSyncState.config = cfg
+	modelSyncState.mu.Unlock()
+
+	if globalModelSyncRunner != nil {
+		globalModelSyncRunner.notifyReload()
+	}
+}
+
+// GetModelSyncConfig 获取当前模型同步配置
+func GetModelSyncConfig() model.ModelSyncConfig {
+	modelSyncState.mu.RLock()
+	defer modelSyncState.mu.RUnlock()
+	return modelSyncState.config
+}
+
+// GetLastModelSyncReport 最近一次同步结果，尚未同步过时返回 nil
+func GetLastModelSyncReport() *model.ModelSyncReport {
+	modelSyncState.mu.RLock()
+	defer modelSyncState.mu.RUnlock()
+	return modelSyncState.lastReport
+}
+
+// SyncAllChannelModels 依次同步所有启用渠道的上游模型列表（联邦渠道除外），
+// 单个渠道失败不影响其他渠道；已有同步在执行时返回 ErrModelSyncRunning
+func (s *ModelService) SyncAllChannelModels(trigger string) (*model.ModelSyncReport, error) {
+	if !modelSyncRunMu.TryLock() {
+		return nil, ErrModelSyncRunning
+	}
+	defer modelSyncRunMu.Unlock()
+
+	channels, err := s.channelRepo.ListEnabled()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := GetModelSyncConfig()
+	report := &model.ModelSyncReport{
+		Trigger:   trigger,
+		StartedAt: time.Now().UTC(),
+		Channels:  []model.ModelSyncChannelResult{},
+	}
+	channelService := NewChannelService()
+	for _, ch := range channels {
+		if ch.FederationIssuer != "" {
+			continue
+		}
+		result, err := s.syncChannelModels(ch)
+		if err != nil {
+			log.Warnf("model sync: 渠道 %s 同步失败: %v", ch.Name, err)
+			report.FailedCount++
+			report.Channels = append(report.Channels, model.ModelSyncChannelResult{
+				ChannelID:   ch.ID,
+				ChannelName: ch.Name,
+				Added:       []string{},
+				Removed:     []string{},
+				Restored:    []string{},
+				Error:       err.Error(),
+			})
+			continue
+		}
+
+		if cfg.AppendToModels {
+			discovered := append(append([]string{}, result.Added...), result.Restored...)
+			appended, err := channelService.appendDiscoveredModels(ch.ID, discovered)
+			if err != nil {
+				result.Error = fmt.Sprintf("追加到模型列表失败: %v", err)
+			}
+			result.AppendedToModels = appended
+		}
+		if len(result.Added) > 0 || len(result.Removed) > 0 {
+			log.Infof("model sync: 渠道 %s 新增 %d 个模型，移除 %d 个模型", ch.Name, len(result.Added), len(result.Removed))
+		}
+		report.AddedCount += len(result.Added)
+		report.RemovedCount += len(result.Removed)
+		report.Channels = append(report.Channels, *result)
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	modelSyncState.mu.Lock()
+	modelSyncState.lastReport = report
+	modelSyncState.mu.Unlock()
+	return report, nil
+}
+
+// appendDiscoveredModels 将新发现的模型追加到渠道模型列表；
+// 列表为空（按类型默认匹配）的渠道不追加，已被现有条目（含通配符）匹配的模型跳过
+func (s *ChannelService) appendDiscoveredModels(channelID string, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	result, err := s.applyChannelModelChanges([]string{channelID}, false, names, func(channel *model.Channel, current []model.ChannelModel) ([]model.ChannelModel, string) {
+		if len(current) == 0 {
+			return nil, "渠道按类型默认匹配"
+		}
+		var additions []model.ChannelModel
+		for _, name := range names {
+			if _, _, ok := s.matchChannelModel(channel, name); ok {
+				continue
+			}
+			additions = append(additions, model.ChannelModel{Name: name})
+		}
+		return mergeChannelModels(current, additions), ""
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Channels) == 0 {
+		return nil, nil
+	}
+	return result.Channels[0].Added, nil
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// ModelSyncRunner 开启自动同步时按配置的间隔同步上游模型
+type ModelSyncRunner struct {
+	reloadChan chan struct{}
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+}
+
+var globalModelSyncRunner *ModelSyncRunner
+
+// InitModelSyncRunner 启动全局上游模型同步任务
+func InitModelSyncRunner() {
+	globalModelSyncRunner = &ModelSyncRunner{
+		reloadChan: make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+	}
+	globalModelSyncRunner.wg.Add(1)
+	go globalModelSyncRunner.run()
+	log.Info("model sync: started")
+}
+
+// StopModelSyncRunner 停止全局上游模型同步任务
+func StopModelSyncRunner() {
+	if globalModelSyncRunner == nil {
+		return
+	}
+	globalModelSyncRunner.stopOnce.Do(func() { close(globalModelSyncRunner.stopChan) })
+	globalModelSyncRunner.wg.Wait()
+	log.Info("model sync: stopped")
+}
+
+func (r *ModelSyncRunner) notifyReload() {
+	select {
+	case r.reloadChan <- struct{}{}:
+	default:
+	}
+}
+
+func (r *ModelSyncRunner) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(time.Duration(GetModelSyncConfig().IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.sync()
+		case <-r.reloadChan:
+			ticker.Reset(time.Duration(GetModelSyncConfig().IntervalMinutes) * time.Minute)
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+func (r *ModelSyncRunner) sync() {
+	if !GetModelSyncConfig().Enabled {
+		return
+	}
+	report, err := NewModelService().SyncAllChannelModels(ModelSyncTriggerScheduled)
+	if err != nil {
+		if !errors.Is(err, ErrModelSyncRunning) {
+			log.Errorf("model sync: %v", err)
+		}
+		return
+	}
+	if report.FailedCount > 0 {
+		log.Warnf("model sync: %d 个渠道同步失败", report.FailedCount)
+	}
+}
@@ -0,0 +1,426 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	auditActionNewUserDefaults = "user.new_user_defaults"
+
+	// 新用户默认配置的来源
+	NewUserSourceRegister = "register"
+	NewUserSourceOIDC     = "oidc"
+	NewUserSourceImport   = "import"
+	NewUserSourceEmail    = "email_verify"
+
+	maxNewUserPlanDurationDays = 3650
+)
+
+var newUserDefaultsState struct {
+	mu     sync.RWMutex
+	config model.NewUserDefaultsConfig
+	// patterns 与 config.Rules 一一对应的已编译用户名正则，未设置时为 nil
+	patterns []*regexp.Regexp
+}
+
+func init() {
+	newUserDefaultsState.config = DefaultNewUserDefaultsConfig()
+}
+
+// DefaultNewUserDefaultsConfig 默认不启用，新用户不自动分配分组、套餐与设置
+func DefaultNewUserDefaultsConfig() model.NewUserDefaultsConfig {
+	return model.NewUserDefaultsConfig{
+		Rules:           []model.NewUserAssignmentRule{},
+		DefaultGroupIDs: []string{},
+	}
+}
+
+// NormalizeNewUserDefaultsConfig 去除空白与重复的 ID，邮箱域名转为小写
+func NormalizeNewUserDefaultsConfig(cfg model.NewUserDefaultsConfig) model.NewUserDefaultsConfig {
+	rules := make([]model.NewUserAssignmentRule, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		rule.Name = strings.TrimSpace(rule.Name)
+		rule.UsernamePattern = strings.TrimSpace(rule.UsernamePattern)
+		rule.EmailDomain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(rule.EmailDomain), "@"))
+		rule.GroupIDs = normalizeIDList(rule.GroupIDs)
+		rule.PlanID = strings.TrimSpace(rule.PlanID)
+		rules = append(rules, rule)
+	}
+	cfg.Rules = rules
+	cfg.DefaultGroupIDs = normalizeIDList(cfg.DefaultGroupIDs)
+	cfg.DefaultPlanID = strings.TrimSpace(cfg.DefaultPlanID)
+	if cfg.PlanDurationDays < 0 {
+		cfg.PlanDurationDays = 0
+	}
+	if cfg.AmpSettings != nil {
+		amp := *cfg.AmpSettings
+		amp.UpstreamURL = strings.TrimRight(strings.TrimSpace(amp.UpstreamURL), "/")
+		if amp.UpstreamURL == "" {
+			amp.UpstreamURL = "https://ampcode.com"
+		}
+		if amp.WebSearchMode == "" {
+			amp.WebSearchMode = model.WebSearchModeUpstream
+		}
+		amp.SettingsTemplateIDs = normalizeIDList(amp.SettingsTemplateIDs)
+		cfg.AmpSettings = &amp
+	}
+	return cfg
+}
+
+func normalizeIDList(ids []string) []string {
+	result := []string{}
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id != "" && !containsString(result, id) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// ValidateNewUserDefaultsConfig 校验新用户默认配置（需先 Normalize），引用的分组、套餐与设置模板必须存在
+func ValidateNewUserDefaultsConfig(cfg model.NewUserDefaultsConfig) error {
+	groupIDs := append([]string{}, cfg.DefaultGroupIDs...)
+	planIDs := []string{}
+	if cfg.DefaultPlanID != "" {
+		planIDs = append(planIDs, cfg.DefaultPlanID)
+	}
+	for i, rule := range cfg.Rules {
+		label := rule.Name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.UsernamePattern == "" && rule.EmailDomain == "" {
+			return fmt.Errorf("规则 %s 需设置 usernamePattern 或 emailDomain", label)
+		}
+		if rule.UsernamePattern != "" {
+			if _, err := regexp.Compile(rule.UsernamePattern); err != nil {
+				return fmt.Errorf("规则 %s 的 usernamePattern 无效: %v", label, err)
+			}
+		}
+		if len(rule.GroupIDs) == 0 && rule.PlanID == "" {
+			return fmt.Errorf("规则 %s 需设置 groupIds 或 planId", label)
+		}
+		groupIDs = append(groupIDs, rule.GroupIDs...)
+		if rule.PlanID != "" {
+			planIDs = append(planIDs, rule.PlanID)
+		}
+	}
+	if cfg.PlanDurationDays > maxNewUserPlanDurationDays {
+		return fmt.Errorf("planDurationDays 不能超过 %d", maxNewUserPlanDurationDays)
+	}
+
+	groupIDs = normalizeIDList(groupIDs)
+	if len(groupIDs) > 0 {
+		groups, err := repository.NewGroupRepository().GetByIDs(groupIDs)
+		if err != nil {
+			return err
+		}
+		for _, id := range groupIDs {
+			if groups[id] == nil {
+				return fmt.Errorf("分组 %s 不存在", id)
+			}
+		}
+	}
+	planRepo := repository.NewSubscriptionPlanRepository()
+	for _, id := range normalizeIDList(planIDs) {
+		plan, _, err := planRepo.GetByID(id)
+		if err != nil {
+			return err
+		}
+		if plan == nil {
+			return fmt.Errorf("订阅套餐 %s 不存在", id)
+		}
+		if !plan.Enabled {
+			return fmt.Errorf("订阅套餐 %s 已停用", id)
+		}
+	}
+
+	if amp := cfg.AmpSettings; amp != nil {
+		if u, err := url.Parse(amp.UpstreamURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("ampSettings.upstreamUrl 必须是 http(s) 地址")
+		}
+		switch amp.WebSearchMode {
+		case model.WebSearchModeUpstream, model.WebSearchModeBuiltinFree, model.WebSearchModeLocalDDG:
+		default:
+			return fmt.Errorf("ampSettings.webSearchMode 无效: %s", amp.WebSearchMode)
+		}
+		templateRepo := repository.NewSettingsTemplateRepository()
+		for _, id := range amp.SettingsTemplateIDs {
+			tpl, err := templateRepo.GetByID(id)
+			if err != nil {
+				return err
+			}
+			if tpl == nil {
+				return fmt.Errorf("设置模板 %s 不存在", id)
+			}
+		}
+	}
+	return nil
+}
+
+// InitNewUserDefaultsConfig 启动时从持久化配置加载
+func InitNewUserDefaultsConfig(configJSON string) {
+	var cfg model.NewUserDefaultsConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("new user defaults: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+	cfg = NormalizeNewUserDefaultsConfig(cfg)
+	if err := ValidateNewUserDefaultsConfig(cfg); err != nil {
+		log.Warnf("new user defaults: 配置无效，使用默认配置: %v", err)
+		return
+	}
+	UpdateNewUserDefaultsConfig(cfg)
+}
+
+// UpdateNewUserDefaultsConfig 更新运行时配置（需先校验）
+func UpdateNewUserDefaultsConfig(cfg model.NewUserDefaultsConfig) {
+	patterns := make([]*regexp.Regexp, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		if rule.UsernamePattern != "" {
+			patterns[i] = regexp.MustCompile(rule.UsernamePattern)
+		}
+	}
+	newUserDefaultsState.mu.Lock()
+	defer newUserDefaultsState.mu.Unlock()
+	newUserDefaultsState.config = cfg
+	newUserDefaultsState.patterns = patterns
+}
+
+// GetNewUserDefaultsConfig 获取当前新用户默认配置
+func GetNewUserDefaultsConfig() model.NewUserDefaultsConfig {
+	newUserDefaultsState.mu.RLock()
+	defer newUserDefaultsState.mu.RUnlock()
+	return newUserDefaultsState.config
+}
+
+// newUserRuleMatcher 在加锁状态下取出配置快照，逐条判断规则是否匹配
+type newUserRuleMatcher struct {
+	cfg      model.NewUserDefaultsConfig
+	patterns []*regexp.Regexp
+}
+
+func currentNewUserRuleMatcher() newUserRuleMatcher {
+	newUserDefaultsState.mu.RLock()
+	defer newUserDefaultsState.mu.RUnlock()
+	return newUserRuleMatcher{cfg: newUserDefaultsState.config, patterns: newUserDefaultsState.patterns}
+}
+
+// matches 判断第 i 条规则是否匹配；domain 为已验证邮箱的域名，未验证时为空
+func (m newUserRuleMatcher) matches(i int, username, domain string) bool {
+	rule := m.cfg.Rules[i]
+	if rule.EmailDomain != "" && rule.EmailDomain != domain {
+		return false
+	}
+	if i < len(m.patterns) && m.patterns[i] != nil && !m.patterns[i].MatchString(username) {
+		return false
+	}
+	return true
+}
+
+func newUserRuleName(rule model.NewUserAssignmentRule, i int) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+func verifiedEmailDomain(email string, verified bool) string {
+	if !verified {
+		return ""
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// collect 合并匹配规则的结果：分组取并集，套餐取第一条设置了套餐的匹配规则
+func (m newUserRuleMatcher) collect(result *model.NewUserDefaultsResult, include func(i int) bool) {
+	for i, rule := range m.cfg.Rules {
+		if !include(i) {
+			continue
+		}
+		result.MatchedRules = append(result.MatchedRules, newUserRuleName(rule, i))
+		for _, id := range rule.GroupIDs {
+			if !containsString(result.GroupIDs, id) {
+				result.GroupIDs = append(result.GroupIDs, id)
+			}
+		}
+		if result.PlanID == "" {
+			result.PlanID = rule.PlanID
+		}
+	}
+}
+
+// resolveNewUserDefaults 按规则计算用户应加入的分组与套餐，没有规则匹配时使用默认分组，
+// 没有匹配规则提供套餐时使用默认套餐
+func resolveNewUserDefaults(username, email string, emailVerified bool) model.NewUserDefaultsResult {
+	m := currentNewUserRuleMatcher()
+	domain := verifiedEmailDomain(email, emailVerified)
+
+	result := model.NewUserDefaultsResult{MatchedRules: []string{}, GroupIDs: []string{}}
+	m.collect(&result, func(i int) bool { return m.matches(i, username, domain) })
+	if len(result.MatchedRules) == 0 {
+		result.GroupIDs = append(result.GroupIDs, m.cfg.DefaultGroupIDs...)
+	}
+	if result.PlanID == "" {
+		result.PlanID = m.cfg.DefaultPlanID
+	}
+	if m.cfg.AmpSettings != nil {
+		result.AmpSettings = true
+		result.SettingsTemplateIDs = m.cfg.AmpSettings.SettingsTemplateIDs
+	}
+	return result
+}
+
+// PreviewNewUserDefaults 预览按当前配置会为该用户名与邮箱分配的分组、套餐与设置，不做任何修改
+func PreviewNewUserDefaults(req *model.NewUserDefaultsPreviewRequest) model.NewUserDefaultsResult {
+	return resolveNewUserDefaults(strings.TrimSpace(req.Username), normalizeEmail(req.Email), req.EmailVerified)
+}
+
+// ApplyNewUserDefaults 在创建用户后分配分组、套餐并写入默认 Amp 设置。未启用时不做任何事；
+// 失败只记录日志，不影响用户创建。keepGroups 为 true 时保留调用方已指定的分组（如批量导入时选择的分组）
+func ApplyNewUserDefaults(user *model.User, source string, keepGroups bool) {
+	cfg := GetNewUserDefaultsConfig()
+	if !cfg.Enabled || user == nil {
+		return
+	}
+	result := resolveNewUserDefaults(user.Username, user.Email, user.EmailVerifiedAt != nil)
+	if keepGroups {
+		result.GroupIDs = []string{}
+	}
+
+	if err := addUserGroups(user.ID, result.GroupIDs); err != nil {
+		log.Warnf("new user defaults: 为用户 %s 分配分组失败: %v", user.ID, err)
+	}
+	if result.PlanID != "" {
+		if err := assignNewUserPlan(user.ID, result.PlanID, cfg.PlanDurationDays); err != nil {
+			log.Warnf("new user defaults: 为用户 %s 分配套餐失败: %v", user.ID, err)
+			result.PlanID = ""
+		}
+	}
+	if cfg.AmpSettings != nil {
+		if err := applyNewUserAmpSettings(user.ID, *cfg.AmpSettings); err != nil {
+			log.Warnf("new user defaults: 为用户 %s 写入默认设置失败: %v", user.ID, err)
+			result.AmpSettings = false
+		}
+	}
+
+	recordAudit(user.ID, auditActionNewUserDefaults, "user", user.ID, map[string]interface{}{
+		"source": source,
+		"result": result,
+	})
+}
+
+// ApplyVerifiedEmailDefaults 用户验证邮箱后补充应用邮箱域名规则：自助注册时邮箱尚未验证，域名规则在验证后才生效。
+// 只追加分组，已有有效订阅时不分配套餐，不修改 Amp 设置
+func ApplyVerifiedEmailDefaults(userID, username, email string) {
+	m := currentNewUserRuleMatcher()
+	if !m.cfg.Enabled {
+		return
+	}
+	domain := verifiedEmailDomain(email, true)
+	if domain == "" {
+		return
+	}
+
+	result := model.NewUserDefaultsResult{MatchedRules: []string{}, GroupIDs: []string{}}
+	m.collect(&result, func(i int) bool {
+		return m.cfg.Rules[i].EmailDomain != "" && m.matches(i, username, domain)
+	})
+	if len(result.MatchedRules) == 0 {
+		return
+	}
+
+	if err := addUserGroups(userID, result.GroupIDs); err != nil {
+		log.Warnf("new user defaults: 为用户 %s 分配分组失败: %v", userID, err)
+	}
+	if result.PlanID != "" {
+		active, err := NewUserSubscriptionService().GetActive(userID)
+		if err != nil || active != nil {
+			result.PlanID = ""
+		} else if err := assignNewUserPlan(userID, result.PlanID, m.cfg.PlanDurationDays); err != nil {
+			log.Warnf("new user defaults: 为用户 %s 分配套餐失败: %v", userID, err)
+			result.PlanID = ""
+		}
+	}
+
+	recordAudit(userID, auditActionNewUserDefaults, "user", userID, map[string]interface{}{
+		"source": NewUserSourceEmail,
+		"result": result,
+	})
+}
+
+// addUserGroups 把分组追加到用户现有分组中
+func addUserGroups(userID string, groupIDs []string) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	userRepo := repository.NewUserRepository()
+	current, err := userRepo.GetGroupIDs(userID)
+	if err != nil {
+		return err
+	}
+	merged := append([]string{}, current...)
+	for _, id := range groupIDs {
+		if !containsString(merged, id) {
+			merged = append(merged, id)
+		}
+	}
+	if len(merged) == len(current) {
+		return nil
+	}
+	return userRepo.SetGroups(userID, merged)
+}
+
+func assignNewUserPlan(userID, planID string, durationDays int) error {
+	req := &model.AssignSubscriptionRequest{PlanID: planID}
+	if durationDays > 0 {
+		expiresAt := time.Now().UTC().AddDate(0, 0, durationDays)
+		req.ExpiresAt = &expiresAt
+	}
+	_, err := NewUserSubscriptionService().Assign(userID, req)
+	return err
+}
+
+// applyNewUserAmpSettings 用户还没有 Amp 设置时写入默认设置，再依次应用设置模板
+func applyNewUserAmpSettings(userID string, defaults model.NewUserAmpDefaults) error {
+	settingsRepo := repository.NewAmpSettingsRepository()
+	existing, err := settingsRepo.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		settings := &model.AmpSettings{
+			UserID:        userID,
+			UpstreamURL:   defaults.UpstreamURL,
+			Enabled:       defaults.Enabled,
+			WebSearchMode: defaults.WebSearchMode,
+		}
+		if err := settingsRepo.Upsert(settings); err != nil {
+			return err
+		}
+	}
+	templates := NewSettingsTemplateService()
+	for _, id := range defaults.SettingsTemplateIDs {
+		if _, err := templates.Apply(userID, id, &model.ApplySettingsTemplateRequest{}); err != nil {
+			return fmt.Errorf("应用设置模板 %s: %w", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+func withNewUserDefaults(t *testing.T, cfg model.NewUserDefaultsConfig) {
+	t.Helper()
+	prev := GetNewUserDefaultsConfig()
+	UpdateNewUserDefaultsConfig(NormalizeNewUserDefaultsConfig(cfg))
+	t.Cleanup(func() { UpdateNewUserDefaultsConfig(prev) })
+}
+
+func TestResolveNewUserDefaults(t *testing.T) {
+	withNewUserDefaults(t, model.NewUserDefaultsConfig{
+		Enabled: true,
+		Rules: []model.NewUserAssignmentRule{
+			{Name: "contractors", UsernamePattern: `^ext-`, GroupIDs: []string{"g-ext"}},
+			{Name: "staff", EmailDomain: "@Example.COM ", GroupIDs: []string{"g-staff", "g-ext"}, PlanID: "plan-staff"},
+			{Name: "staff-dev", UsernamePattern: `-dev$`, EmailDomain: "example.com", GroupIDs: []string{"g-dev"}, PlanID: "plan-dev"},
+			{UsernamePattern: `^[a-z]+\.[a-z]+@`, GroupIDs: []string{"g-mail"}},
+		},
+		DefaultGroupIDs: []string{"g-default"},
+		DefaultPlanID:   "plan-default",
+	})
+
+	cases := []struct {
+		name     string
+		username string
+		email    string
+		verified bool
+		rules    []string
+		groups   []string
+		plan     string
+	}{
+		{"no match uses defaults", "alice", "", false, []string{}, []string{"g-default"}, "plan-default"},
+		{"username pattern", "ext-bob", "", false, []string{"contractors"}, []string{"g-ext"}, "plan-default"},
+		{"pattern is not anchored by default", "bob-ext-1", "", false, []string{}, []string{"g-default"}, "plan-default"},
+		{"verified domain", "carol", "carol@example.com", true, []string{"staff"}, []string{"g-staff", "g-ext"}, "plan-staff"},
+		{"domain is case insensitive", "carol", " Carol@EXAMPLE.com ", true, []string{"staff"}, []string{"g-staff", "g-ext"}, "plan-staff"},
+		{"unverified email on matching domain", "carol", "carol@example.com", false, []string{}, []string{"g-default"}, "plan-default"},
+		{"subdomain does not match", "carol", "carol@corp.example.com", true, []string{}, []string{"g-default"}, "plan-default"},
+		{"lookalike domain does not match", "carol", "carol@example.com.evil.io", true, []string{}, []string{"g-default"}, "plan-default"},
+		// 多条规则匹配时分组按规则顺序取并集，套餐取第一条设置了套餐的规则
+		{"rule order decides plan", "ext-carol-dev", "carol@example.com", true, []string{"contractors", "staff", "staff-dev"}, []string{"g-ext", "g-staff", "g-dev"}, "plan-staff"},
+		{"pattern and domain both required", "ext-carol-dev", "carol@other.org", true, []string{"contractors"}, []string{"g-ext"}, "plan-default"},
+		{"email-shaped username pattern", "jane.doe@partner.io", "", false, []string{"#4"}, []string{"g-mail"}, "plan-default"},
+		{"email-shaped username pattern rejects other shapes", "JaneDoe@partner.io", "", false, []string{}, []string{"g-default"}, "plan-default"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := PreviewNewUserDefaults(&model.NewUserDefaultsPreviewRequest{Username: tc.username, Email: tc.email, EmailVerified: tc.verified})
+			if !reflect.DeepEqual(got.MatchedRules, tc.rules) {
+				t.Errorf("matched rules = %q, want %q", got.MatchedRules, tc.rules)
+			}
+			if !reflect.DeepEqual(got.GroupIDs, tc.groups) {
+				t.Errorf("groups = %q, want %q", got.GroupIDs, tc.groups)
+			}
+			if got.PlanID != tc.plan {
+				t.Errorf("plan = %q, want %q", got.PlanID, tc.plan)
+			}
+		})
+	}
+}
+
+func TestValidateNewUserDefaultsRules(t *testing.T) {
+	cases := []struct {
+		name    string
+		rule    model.NewUserAssignmentRule
+		wantErr string
+	}{
+		{"invalid regex", model.NewUserAssignmentRule{Name: "broken", UsernamePattern: `^(dev`, PlanID: "p"}, "规则 broken 的 usernamePattern 无效"},
+		{"no condition", model.NewUserAssignmentRule{GroupIDs: []string{"g"}}, "规则 #1 需设置 usernamePattern 或 emailDomain"},
+		{"no assignment", model.NewUserAssignmentRule{EmailDomain: "example.com"}, "规则 #1 需设置 groupIds 或 planId"},
+		{"blank domain only", model.NewUserAssignmentRule{EmailDomain: " @ ", GroupIDs: []string{"g"}}, "需设置 usernamePattern 或 emailDomain"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NormalizeNewUserDefaultsConfig(model.NewUserDefaultsConfig{Rules: []model.NewUserAssignmentRule{tc.rule}})
+			err := ValidateNewUserDefaultsConfig(cfg)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// 持久化配置中的正则无效时不加载，保持默认配置
+func TestInitNewUserDefaultsConfigRejectsInvalidRegex(t *testing.T) {
+	withNewUserDefaults(t, DefaultNewUserDefaultsConfig())
+	InitNewUserDefaultsConfig(`{"enabled":true,"rules":[{"name":"broken","usernamePattern":"[a-","planId":"p"}]}`)
+	if cfg := GetNewUserDefaultsConfig(); cfg.Enabled || len(cfg.Rules) != 0 {
+		t.Fatalf("config = %+v", cfg)
+	}
+	got := PreviewNewUserDefaults(&model.NewUserDefaultsPreviewRequest{Username: "[a-"})
+	if len(got.MatchedRules) != 0 || got.PlanID != "" {
+		t.Errorf("preview = %+v", got)
+	}
+}
+
+// 自助注册时邮箱未验证，域名规则在验证邮箱后才补充生效，只按用户名匹配的规则不重复应用
+func TestApplyVerifiedEmailDefaults(t *testing.T) {
+	setupTestDB(t)
+	groups := repository.NewGroupRepository()
+	ids := map[string]string{}
+	for _, name := range []string{"ext", "staff", "default"} {
+		group := &model.Group{Name: name}
+		if err := groups.Create(group); err != nil {
+			t.Fatalf("create group: %v", err)
+		}
+		ids[name] = group.ID
+	}
+	withNewUserDefaults(t, model.NewUserDefaultsConfig{
+		Enabled: true,
+		Rules: []model.NewUserAssignmentRule{
+			{Name: "contractors", UsernamePattern: `^ext-`, GroupIDs: []string{ids["ext"]}},
+			{Name: "staff", EmailDomain: "example.com", GroupIDs: []string{ids["staff"]}},
+		},
+		DefaultGroupIDs: []string{ids["default"]},
+	})
+
+	users := repository.NewUserRepository()
+	user := &model.User{Username: "ext-dana", PasswordHash: "x", Email: "dana@example.com"}
+	if err := users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	ApplyNewUserDefaults(user, NewUserSourceRegister, false)
+	if got, _ := users.GetGroupIDs(user.ID); !reflect.DeepEqual(got, []string{ids["ext"]}) {
+		t.Fatalf("groups after register = %v, want [ext]", got)
+	}
+
+	ApplyVerifiedEmailDefaults(user.ID, user.Username, "dana@other.org")
+	if got, _ := users.GetGroupIDs(user.ID); len(got) != 1 {
+		t.Fatalf("groups after verifying other domain = %v", got)
+	}
+	ApplyVerifiedEmailDefaults(user.ID, user.Username, "Dana@Example.com")
+	got, _ := users.GetGroupIDs(user.ID)
+	if len(got) != 2 || !containsString(got, ids["ext"]) || !containsString(got, ids["staff"]) {
+		t.Fatalf("groups after verifying = %v, want [ext staff]", got)
+	}
+}
@@ -0,0 +1,880 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"ampmanager/internal/config"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+	"ampmanager/internal/secrets"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrOIDCDisabled          = errors.New("未开启 SSO 登录")
+	ErrOIDCInvalidState      = errors.New("SSO 登录状态无效或已过期，请重新登录")
+	ErrOIDCLoginFailed       = errors.New("SSO 登录失败")
+	ErrOIDCNotProvisioned    = errors.New("该 SSO 账户尚未开通，请联系管理员")
+	ErrOIDCGroupDenied       = errors.New("该 SSO 账户不在允许登录的分组中")
+	ErrOIDCInvalidTicket     = errors.New("登录票据无效或已过期，请重新登录")
+	ErrPasswordLoginDisabled = errors.New("已关闭密码登录，请使用 SSO 登录")
+)
+
+const (
+	auditActionOIDCProvision = "user.oidc_provision"
+	auditActionOIDCLink      = "user.oidc_link"
+
+	// OIDCCallbackPath IdP 回调地址的路径，未配置 redirectUrl 时与 PUBLIC_URL 拼接
+	OIDCCallbackPath = "/api/manage/auth/oidc/callback"
+
+	oidcStateTTL     = 10 * time.Minute
+	oidcTicketTTL    = 2 * time.Minute
+	oidcHTTPTimeout  = 10 * time.Second
+	oidcDiscoveryTTL = time.Hour
+	// oidcJWKSMinRefresh 遇到未知 kid 时重新拉取 JWKS 的最短间隔，防止伪造 kid 放大请求
+	oidcJWKSMinRefresh = time.Minute
+	oidcMaxResponse    = 1 << 20
+	oidcStateAudience  = "ampmanager-oidc-state"
+)
+
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+var oidcState struct {
+	mu     sync.RWMutex
+	config model.OIDCConfig
+}
+
+// oidcProvider 按签发方缓存的发现文档与签名公钥
+var oidcProvider struct {
+	mu            sync.Mutex
+	issuer        string
+	metadata      oidcMetadata
+	fetchedAt     time.Time
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcStateClaims 发起登录时写入 Cookie 的状态，回调时校验 state 并取回 nonce 与 PKCE verifier
+type oidcStateClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+	jwt.RegisteredClaims
+}
+
+var oidcHTTPClient = &http.Client{Timeout: oidcHTTPTimeout}
+
+func init() {
+	oidcState.config = NormalizeOIDCConfig(model.OIDCConfig{AutoProvision: true})
+}
+
+// NormalizeOIDCConfig 去除首尾空白并填充默认的 scope、声明名称与回调地址
+func NormalizeOIDCConfig(cfg model.OIDCConfig) model.OIDCConfig {
+	cfg.DisplayName = strings.TrimSpace(cfg.DisplayName)
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = "SSO"
+	}
+	cfg.Issuer = strings.TrimSuffix(strings.TrimSpace(cfg.Issuer), "/")
+	cfg.ClientID = strings.TrimSpace(cfg.ClientID)
+	cfg.ClientSecret = strings.TrimSpace(cfg.ClientSecret)
+	cfg.ClientSecretSet = false
+	cfg.RedirectURL = strings.TrimSpace(cfg.RedirectURL)
+	if cfg.RedirectURL == "" {
+		if c := config.Get(); c != nil && c.PublicURL != "" {
+			cfg.RedirectURL = c.PublicURL + OIDCCallbackPath
+		}
+	}
+
+	scopes := []string{"openid"}
+	for _, scope := range cfg.Scopes {
+		if scope = strings.TrimSpace(scope); scope != "" && !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 1 {
+		scopes = append(scopes, "profile", "email")
+	}
+	cfg.Scopes = scopes
+
+	cfg.UsernameClaim = strings.TrimSpace(cfg.UsernameClaim)
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	cfg.GroupsClaim = strings.TrimSpace(cfg.GroupsClaim)
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	cfg.AllowedGroups = trimStrings(cfg.AllowedGroups)
+	cfg.AdminGroups = trimStrings(cfg.AdminGroups)
+	mappings := make([]model.OIDCGroupMapping, 0, len(cfg.GroupMappings))
+	for _, m := range cfg.GroupMappings {
+		m.Claim = strings.TrimSpace(m.Claim)
+		m.GroupID = strings.TrimSpace(m.GroupID)
+		if m.Claim != "" || m.GroupID != "" {
+			mappings = append(mappings, m)
+		}
+	}
+	cfg.GroupMappings = mappings
+	return cfg
+}
+
+// ValidateOIDCConfig 校验 SSO 配置（需先 Normalize）
+func ValidateOIDCConfig(cfg model.OIDCConfig) error {
+	if cfg.DisablePasswordLogin && !cfg.Enabled {
+		return errors.New("关闭密码登录前需先开启 SSO 登录")
+	}
+	if cfg.Enabled {
+		if err := validateOIDCURL("issuer", cfg.Issuer); err != nil {
+			return err
+		}
+		if cfg.ClientID == "" {
+			return errors.New("clientId 不能为空")
+		}
+		if cfg.RedirectURL == "" {
+			return errors.New("redirectUrl 不能为空（或设置 PUBLIC_URL 自动生成）")
+		}
+		if err := validateOIDCURL("redirectUrl", cfg.RedirectURL); err != nil {
+			return err
+		}
+	}
+
+	groupIDs := make([]string, 0, len(cfg.GroupMappings))
+	for i, m := range cfg.GroupMappings {
+		if m.Claim == "" || m.GroupID == "" {
+			return fmt.Errorf("groupMappings[%d] 的 claim 与 groupId 不能为空", i)
+		}
+		groupIDs = append(groupIDs, m.GroupID)
+	}
+	if len(groupIDs) > 0 {
+		groups, err := repository.NewGroupRepository().GetByIDs(groupIDs)
+		if err != nil {
+			return err
+		}
+		for _, id := range groupIDs {
+			if groups[id] == nil {
+				return fmt.Errorf("分组 %s 不存在", id)
+			}
+		}
+	}
+	return nil
+}
+
+// validateOIDCURL 要求 https；http 只允许本机地址，便于本地调试
+func validateOIDCURL(field, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%s 不是有效的 URL", field)
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	host := u.Hostname()
+	if u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1") {
+		return nil
+	}
+	return fmt.Errorf("%s 必须使用 https", field)
+}
+
+// MergeOIDCClientSecret 未填写客户端密钥时沿用当前配置中的密钥
+func MergeOIDCClientSecret(cfg model.OIDCConfig) model.OIDCConfig {
+	if cfg.ClientSecret == "" {
+		cfg.ClientSecret = GetOIDCConfig().ClientSecret
+	}
+	return cfg
+}
+
+// InitOIDCConfig 从数据库 JSON 加载 SSO 配置
+func InitOIDCConfig(configJSON string) {
+	if configJSON == "" {
+		return
+	}
+	var cfg model.OIDCConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("oidc: 解析配置失败，SSO 登录不可用: %v", err)
+		return
+	}
+	cfg = NormalizeOIDCConfig(cfg)
+	if err := ValidateOIDCConfig(cfg); err != nil {
+		log.Warnf("oidc: 配置无效，SSO 登录不可用: %v", err)
+		return
+	}
+	UpdateOIDCConfig(cfg)
+}
+
+// UpdateOIDCConfig 更新 SSO 配置，立即生效；签发方变化时重新发现端点与公钥
+func UpdateOIDCConfig(cfg model.OIDCConfig) {
+	oidcState.mu.Lock()
+	oidcState.config = cfg
+	oidcState.mu.Unlock()
+
+	oidcProvider.mu.Lock()
+	if oidcProvider.issuer != cfg.Issuer {
+		oidcProvider.issuer = ""
+		oidcProvider.keys = nil
+	}
+	oidcProvider.mu.Unlock()
+}
+
+// GetOIDCConfig 返回当前 SSO 配置（含客户端密钥）
+func GetOIDCConfig() model.OIDCConfig {
+	oidcState.mu.RLock()
+	defer oidcState.mu.RUnlock()
+	return oidcState.config
+}
+
+// GetOIDCConfigMasked 返回用于展示的 SSO 配置：密钥引用原样返回，明文密钥不返回
+func GetOIDCConfigMasked() model.OIDCConfig {
+	cfg := GetOIDCConfig()
+	cfg.ClientSecretSet = cfg.ClientSecret != ""
+	if !secrets.IsReference(cfg.ClientSecret) {
+		cfg.ClientSecret = ""
+	}
+	return cfg
+}
+
+// GetOIDCLoginOptions 登录页展示的登录方式
+func GetOIDCLoginOptions() model.OIDCLoginOptions {
+	cfg := GetOIDCConfig()
+	opts := model.OIDCLoginOptions{Enabled: cfg.Enabled, PasswordLoginEnabled: !(cfg.Enabled && cfg.DisablePasswordLogin)}
+	if cfg.Enabled {
+		opts.DisplayName = cfg.DisplayName
+	}
+	return opts
+}
+
+// PasswordLoginAllowed 强制 SSO 时只有初始管理员账户可以使用密码登录，用于 IdP 故障时应急
+func PasswordLoginAllowed(username string) bool {
+	cfg := GetOIDCConfig()
+	if !cfg.Enabled || !cfg.DisablePasswordLogin {
+		return true
+	}
+	c := config.Get()
+	return c != nil && username == c.AdminUsername
+}
+
+// OIDCBeginLogin 生成 IdP 授权地址；state、nonce 与 PKCE verifier 签名后作为 Cookie 返回，回调时校验。
+// redirectPath 为登录完成后前端跳转的站内路径
+func OIDCBeginLogin(ctx context.Context, redirectPath string) (string, string, error) {
+	cfg := GetOIDCConfig()
+	if !cfg.Enabled {
+		return "", "", ErrOIDCDisabled
+	}
+	meta, err := oidcDiscover(ctx, cfg.Issuer)
+	if err != nil {
+		log.Warnf("oidc: 发现 %s 的端点失败: %v", cfg.Issuer, err)
+		return "", "", ErrOIDCLoginFailed
+	}
+
+	claims := oidcStateClaims{
+		State:    randomURLToken(),
+		Nonce:    randomURLToken(),
+		Verifier: randomURLToken(),
+		Redirect: sanitizeRedirectPath(redirectPath),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcStateAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+		},
+	}
+	stateCookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(oidcStateKey())
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(claims.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {cfg.RedirectURL},
+		"scope":                 {strings.Join(cfg.Scopes, " ")},
+		"state":                 {claims.State},
+		"nonce":                 {claims.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL := meta.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + query.Encode()
+	} else {
+		authURL += "?" + query.Encode()
+	}
+	return authURL, stateCookie, nil
+}
+
+// OIDCCompleteLogin 校验回调的 state，用授权码换取并校验 ID Token，按声明找到或创建本地账户。
+// 返回登录页换取登录 Token 的一次性票据，以及登录完成后跳转的站内路径
+func OIDCCompleteLogin(ctx context.Context, code, state, stateCookie string) (string, string, error) {
+	cfg := GetOIDCConfig()
+	if !cfg.Enabled {
+		return "", "", ErrOIDCDisabled
+	}
+
+	var claims oidcStateClaims
+	_, err := jwt.ParseWithClaims(stateCookie, &claims, func(*jwt.Token) (interface{}, error) {
+		return oidcStateKey(), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithAudience(oidcStateAudience), jwt.WithExpirationRequired())
+	if err != nil || state == "" || !hmac.Equal([]byte(claims.State), []byte(state)) {
+		return "", "", ErrOIDCInvalidState
+	}
+	if code == "" {
+		return "", "", ErrOIDCLoginFailed
+	}
+
+	meta, err := oidcDiscover(ctx, cfg.Issuer)
+	if err != nil {
+		log.Warnf("oidc: 发现 %s 的端点失败: %v", cfg.Issuer, err)
+		return "", "", ErrOIDCLoginFailed
+	}
+	rawIDToken, err := oidcExchangeCode(ctx, cfg, meta, code, claims.Verifier)
+	if err != nil {
+		log.Warnf("oidc: 授权码换取 Token 失败: %v", err)
+		return "", "", ErrOIDCLoginFailed
+	}
+	idClaims, err := oidcVerifyIDToken(ctx, cfg, meta, rawIDToken, claims.Nonce)
+	if err != nil {
+		log.Warnf("oidc: ID Token 校验失败: %v", err)
+		return "", "", ErrOIDCLoginFailed
+	}
+
+	user, err := provisionOIDCUser(cfg, idClaims)
+	if err != nil {
+		return "", "", err
+	}
+	ticket, err := issueEmailToken(user.ID, model.EmailTokenOIDCLogin, "", oidcTicketTTL)
+	if err != nil {
+		return "", "", err
+	}
+	return ticket, claims.Redirect, nil
+}
+
+// OIDCExchangeTicket 用一次性票据换取登录 Token，与密码登录返回相同的结果
+func (s *UserService) OIDCExchangeTicket(ticket string) (*model.User, string, error) {
+	token, err := repository.NewEmailTokenRepository().Consume(hashEmailToken(ticket), model.EmailTokenOIDCLogin)
+	if err != nil {
+		return nil, "", err
+	}
+	if token == nil {
+		return nil, "", ErrOIDCInvalidTicket
+	}
+	user, err := s.repo.GetByID(token.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+	if user == nil {
+		return nil, "", ErrOIDCInvalidTicket
+	}
+	if suspension := ActiveSuspension(user.ID); suspension != nil {
+		return nil, "", &SuspendedError{Suspension: suspension}
+	}
+	jwtToken, err := NewJWTService().GenerateToken(user.ID, user.Username)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, jwtToken, nil
+}
+
+// provisionOIDCUser 按签发方与 subject 找到已绑定的账户；未绑定时按已验证邮箱绑定现有账户，
+// 或在开启自动开通时创建账户（不设置本地密码）。每次登录按分组映射同步分组与管理员权限
+func provisionOIDCUser(cfg model.OIDCConfig, claims jwt.MapClaims) (*model.User, error) {
+	subject := claimString(claims, "sub")
+	if subject == "" {
+		return nil, ErrOIDCLoginFailed
+	}
+	email := normalizeEmail(claimString(claims, "email"))
+	emailVerified := claimBool(claims, "email_verified")
+	groups := claimStrings(claims, cfg.GroupsClaim)
+
+	if len(cfg.AllowedGroups) > 0 && !intersects(groups, cfg.AllowedGroups) {
+		return nil, ErrOIDCGroupDenied
+	}
+
+	userRepo := repository.NewUserRepository()
+	identityRepo := repository.NewUserIdentityRepository()
+	identity, err := identityRepo.GetBySubject(cfg.Issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *model.User
+	if identity != nil {
+		if user, err = userRepo.GetByID(identity.UserID); err != nil {
+			return nil, err
+		}
+	}
+	if user == nil {
+		if email != "" && emailVerified {
+			if user, err = userRepo.GetByVerifiedEmail(email); err != nil {
+				return nil, err
+			}
+			if user != nil {
+				recordAudit(user.ID, auditActionOIDCLink, "user", user.ID, map[string]interface{}{"issuer": cfg.Issuer, "subject": subject})
+			}
+		}
+		if user == nil {
+			if !cfg.AutoProvision {
+				return nil, ErrOIDCNotProvisioned
+			}
+			if user, err = createOIDCUser(cfg, claims, subject, email, emailVerified); err != nil {
+				return nil, err
+			}
+		}
+		identity = &model.UserIdentity{UserID: user.ID, Issuer: cfg.Issuer, Subject: subject, Email: email}
+		if err := identityRepo.Create(identity); err != nil {
+			return nil, err
+		}
+	}
+	if err := identityRepo.TouchLogin(identity.ID, email); err != nil {
+		log.Warnf("oidc: 记录用户 %s 的登录时间失败: %v", user.ID, err)
+	}
+
+	if err := syncOIDCGroups(cfg, user, groups); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func createOIDCUser(cfg model.OIDCConfig, claims jwt.MapClaims, subject, email string, emailVerified bool) (*model.User, error) {
+	userRepo := repository.NewUserRepository()
+	username, err := oidcUsername(cfg, claims, subject, email)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{Username: username, Email: email}
+	if err := userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	if email != "" && emailVerified {
+		if _, err := userRepo.MarkEmailVerified(user.ID, email); err != nil {
+			log.Warnf("oidc: 标记用户 %s 的邮箱已验证失败: %v", user.ID, err)
+		} else {
+			now := time.Now().UTC()
+			user.EmailVerifiedAt = &now
+		}
+	}
+	recordAudit(user.ID, auditActionOIDCProvision, "user", user.ID, map[string]interface{}{
+		"issuer":   cfg.Issuer,
+		"subject":  subject,
+		"username": username,
+	})
+	log.Infof("oidc: 已为 %s 自动开通账户 %s", subject, username)
+	ApplyNewUserDefaults(user, NewUserSourceOIDC, false)
+	return user, nil
+}
+
+// oidcUsername 新账户的用户名：优先使用配置的声明，其次邮箱；与现有账户重名时追加 subject 哈希后缀
+func oidcUsername(cfg model.OIDCConfig, claims jwt.MapClaims, subject, email string) (string, error) {
+	base := strings.TrimSpace(claimString(claims, cfg.UsernameClaim))
+	if base == "" {
+		base = email
+	}
+	hash := sha256.Sum256([]byte(cfg.Issuer + "|" + subject))
+	suffix := hex.EncodeToString(hash[:4])
+	if base == "" {
+		base = "sso-" + suffix
+	}
+	if len(base) > 64 {
+		base = base[:64]
+	}
+
+	userRepo := repository.NewUserRepository()
+	for _, candidate := range []string{base, base + "-" + suffix} {
+		exists, err := userRepo.ExistsByUsername(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("oidc: 用户名 %s 已被占用", base)
+}
+
+// syncOIDCGroups 配置了分组映射时按映射覆盖用户分组；配置了管理员分组时同步管理员权限（初始管理员除外）
+func syncOIDCGroups(cfg model.OIDCConfig, user *model.User, groups []string) error {
+	userRepo := repository.NewUserRepository()
+	if len(cfg.GroupMappings) > 0 {
+		groupIDs := []string{}
+		for _, m := range cfg.GroupMappings {
+			if containsString(groups, m.Claim) && !containsString(groupIDs, m.GroupID) {
+				groupIDs = append(groupIDs, m.GroupID)
+			}
+		}
+		if err := userRepo.SetGroups(user.ID, groupIDs); err != nil {
+			return err
+		}
+	}
+	if len(cfg.AdminGroups) > 0 {
+		if c := config.Get(); c != nil && user.Username == c.AdminUsername {
+			return nil
+		}
+		isAdmin := intersects(groups, cfg.AdminGroups)
+		if isAdmin != user.IsAdmin {
+			if err := userRepo.SetAdmin(user.ID, isAdmin); err != nil {
+				return err
+			}
+			user.IsAdmin = isAdmin
+		}
+	}
+	return nil
+}
+
+// oidcDiscover 获取签发方的发现文档，缓存 1 小时
+func oidcDiscover(ctx context.Context, issuer string) (oidcMetadata, error) {
+	oidcProvider.mu.Lock()
+	if oidcProvider.issuer == issuer && time.Since(oidcProvider.fetchedAt) < oidcDiscoveryTTL {
+		meta := oidcProvider.metadata
+		oidcProvider.mu.Unlock()
+		return meta, nil
+	}
+	oidcProvider.mu.Unlock()
+
+	var meta oidcMetadata
+	if err := oidcGetJSON(ctx, issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return meta, err
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return meta, fmt.Errorf("发现文档的 issuer %q 与配置不一致", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return meta, errors.New("发现文档缺少授权、Token 或 JWKS 端点")
+	}
+
+	oidcProvider.mu.Lock()
+	if oidcProvider.issuer != issuer {
+		oidcProvider.keys = nil
+	}
+	oidcProvider.issuer = issuer
+	oidcProvider.metadata = meta
+	oidcProvider.fetchedAt = time.Now()
+	oidcProvider.mu.Unlock()
+	return meta, nil
+}
+
+// oidcExchangeCode 用授权码与 PKCE verifier 换取 ID Token；配置了客户端密钥时使用 client_secret_basic
+func oidcExchangeCode(ctx context.Context, cfg model.OIDCConfig, meta oidcMetadata, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {cfg.RedirectURL},
+		"client_id":     {cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if secret := cfg.ClientSecret; secret != "" {
+		if secrets.IsReference(secret) {
+			if secret, err = secrets.Resolve(secret); err != nil {
+				return "", fmt.Errorf("解析客户端密钥失败: %w", err)
+			}
+		}
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(secret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponse))
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("Token 端点返回 %d，响应无法解析", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || result.Error != "" {
+		return "", fmt.Errorf("Token 端点返回 %d: %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+	if result.IDToken == "" {
+		return "", errors.New("Token 端点未返回 id_token")
+	}
+	return result.IDToken, nil
+}
+
+// oidcVerifyIDToken 校验 ID Token 的签名、签发方、受众、有效期与 nonce
+func oidcVerifyIDToken(ctx context.Context, cfg model.OIDCConfig, meta oidcMetadata, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return oidcSigningKey(ctx, meta.JWKSURI, kid)
+	},
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(claimString(claims, "nonce")), []byte(nonce)) {
+		return nil, errors.New("nonce 不匹配")
+	}
+	return claims, nil
+}
+
+// oidcSigningKey 按 kid 查找签名公钥，未找到时（IdP 轮换密钥）限频重新拉取 JWKS
+func oidcSigningKey(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	oidcProvider.mu.Lock()
+	keys, fetchedAt := oidcProvider.keys, oidcProvider.keysFetchedAt
+	oidcProvider.mu.Unlock()
+
+	if key := pickOIDCKey(keys, kid); key != nil {
+		return key, nil
+	}
+	if keys != nil && time.Since(fetchedAt) < oidcJWKSMinRefresh {
+		return nil, fmt.Errorf("未找到 kid %q 对应的公钥", kid)
+	}
+
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := oidcGetJSON(ctx, jwksURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys = make(map[string]interface{}, len(jwks.Keys))
+	for _, rawKey := range jwks.Keys {
+		keyID, key, err := parseJWK(rawKey)
+		if err != nil {
+			log.Debugf("oidc: 跳过无法解析的 JWK: %v", err)
+			continue
+		}
+		if key != nil {
+			keys[keyID] = key
+		}
+	}
+
+	oidcProvider.mu.Lock()
+	oidcProvider.keys = keys
+	oidcProvider.keysFetchedAt = time.Now()
+	oidcProvider.mu.Unlock()
+
+	if key := pickOIDCKey(keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未找到 kid %q 对应的公钥", kid)
+}
+
+// pickOIDCKey 按 kid 取公钥；ID Token 未携带 kid 且 JWKS 只有一把公钥时使用该公钥
+func pickOIDCKey(keys map[string]interface{}, kid string) interface{} {
+	if key, ok := keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// parseJWK 解析签名用途的 RSA / EC 公钥，其它用途或类型返回 nil
+func parseJWK(raw json.RawMessage) (string, interface{}, error) {
+	var jwk struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return jwk.Kid, nil, nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return "", nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return "", nil, errors.New("RSA 指数无效")
+		}
+		return jwk.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return "", nil, fmt.Errorf("不支持的曲线 %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return "", nil, errors.New("EC 公钥不在曲线上")
+		}
+		return jwk.Kid, key, nil
+	default:
+		return jwk.Kid, nil, nil
+	}
+}
+
+func oidcGetJSON(ctx context.Context, rawURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s 返回 %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponse)).Decode(out)
+}
+
+// oidcStateKey 登录状态 Cookie 的签名密钥，由 JWT 密钥派生，与登录 Token 的密钥相互独立
+func oidcStateKey() []byte {
+	key := sha256.Sum256([]byte("oidc-state:" + config.Get().GetJWTSecret()))
+	return key[:]
+}
+
+func randomURLToken() string {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// sanitizeRedirectPath 只允许站内路径，防止登录后跳转到外部站点；浏览器会删除 URL 中的制表符与换行，含控制字符的路径同样拒绝
+func sanitizeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	if strings.IndexFunc(path, unicode.IsControl) >= 0 {
+		return "/"
+	}
+	return path
+}
+
+func claimString(claims jwt.MapClaims, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return ""
+	}
+}
+
+func claimBool(claims jwt.MapClaims, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
+
+// claimStrings 读取字符串数组声明，单个字符串视为只有一个元素
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func trimStrings(values []string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func intersects(a, b []string) bool {
+	for _, v := range a {
+		if containsString(b, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ampmanager/internal/config"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testOIDCClientID = "amp-client"
+
+// fakeIDP 最小化的 OIDC 提供方：发现文档、JWKS 与校验 PKCE 的 Token 端点
+type fakeIDP struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu sync.Mutex
+	// codes 授权码对应的 code_challenge 与 nonce，由 authorize 模拟用户在 IdP 完成登录
+	codes map[string]fakeIDPGrant
+	// mutate 签发 ID Token 前修改声明，用于构造异常的 ID Token
+	mutate func(jwt.MapClaims)
+}
+
+type fakeIDPGrant struct {
+	challenge, nonce string
+}
+
+func newFakeIDP(t *testing.T) *fakeIDP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	idp := &fakeIDP{key: key, codes: map[string]fakeIDPGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+func (idp *fakeIDP) authorize(code, challenge, nonce string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codes[code] = fakeIDPGrant{challenge: challenge, nonce: nonce}
+}
+
+func (idp *fakeIDP) token(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	mutate := idp.mutate
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != testOIDCClientID ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                idp.srv.URL,
+		"aud":                testOIDCClientID,
+		"sub":                "user-123",
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              grant.nonce,
+		"preferred_username": "sso-alice",
+	}
+	if mutate != nil {
+		mutate(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, _ := token.SignedString(idp.key)
+	_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+// setupOIDC 开启指向 fakeIDP 的 SSO 登录
+func setupOIDC(t *testing.T) *fakeIDP {
+	t.Helper()
+	setupTestDB(t)
+	t.Setenv("JWT_SECRET", "oidc-test-secret")
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	idp := newFakeIDP(t)
+	prev := GetOIDCConfig()
+	UpdateOIDCConfig(NormalizeOIDCConfig(model.OIDCConfig{
+		Enabled:       true,
+		Issuer:        idp.srv.URL,
+		ClientID:      testOIDCClientID,
+		RedirectURL:   "http://localhost" + OIDCCallbackPath,
+		AutoProvision: true,
+	}))
+	t.Cleanup(func() { UpdateOIDCConfig(prev) })
+	return idp
+}
+
+// beginOIDCLogin 发起登录并模拟用户在 IdP 完成授权，返回授权码、state 与状态 Cookie
+func beginOIDCLogin(t *testing.T, idp *fakeIDP, code, redirect string) (string, string) {
+	t.Helper()
+	authURL, cookie, err := OIDCBeginLogin(context.Background(), redirect)
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil || !strings.HasPrefix(authURL, idp.srv.URL+"/authorize?") {
+		t.Fatalf("auth url = %q", authURL)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != testOIDCClientID || q.Get("state") == "" || q.Get("nonce") == "" {
+		t.Fatalf("auth query = %v", q)
+	}
+	idp.authorize(code, q.Get("code_challenge"), q.Get("nonce"))
+	return q.Get("state"), cookie
+}
+
+func signOIDCState(t *testing.T, claims oidcStateClaims, key []byte) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign state: %v", err)
+	}
+	return signed
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := setupOIDC(t)
+	state, cookie := beginOIDCLogin(t, idp, "code-1", "/settings?tab=keys")
+
+	ticket, redirect, err := OIDCCompleteLogin(context.Background(), "code-1", state, cookie)
+	if err != nil {
+		t.Fatalf("complete login: %v", err)
+	}
+	if ticket == "" || redirect != "/settings?tab=keys" {
+		t.Errorf("ticket = %q, redirect = %q", ticket, redirect)
+	}
+	user, _, err := NewUserService().OIDCExchangeTicket(ticket)
+	if err != nil || user.Username != "sso-alice" || user.PasswordHash != "" {
+		t.Fatalf("exchange ticket = %+v, %v", user, err)
+	}
+	// 票据只能使用一次
+	if _, _, err := NewUserService().OIDCExchangeTicket(ticket); !errors.Is(err, ErrOIDCInvalidTicket) {
+		t.Errorf("reused ticket error = %v", err)
+	}
+}
+
+func TestOIDCStateValidation(t *testing.T) {
+	setupOIDC(t)
+	valid := func() oidcStateClaims {
+		return oidcStateClaims{
+			State:    "state-1",
+			Nonce:    "nonce-1",
+			Verifier: "verifier-1",
+			Redirect: "/",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{oidcStateAudience},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+			},
+		}
+	}
+
+	expired := valid()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Second))
+	wrongAudience := valid()
+	wrongAudience.Audience = jwt.ClaimStrings{"ampmanager-users"}
+	noExpiry := valid()
+	noExpiry.ExpiresAt = nil
+
+	cases := []struct {
+		name   string
+		cookie string
+		state  string
+	}{
+		{"expired", signOIDCState(t, expired, oidcStateKey()), "state-1"},
+		// 登录 Token 的受众不能当作登录状态使用
+		{"audience mismatch", signOIDCState(t, wrongAudience, oidcStateKey()), "state-1"},
+		{"missing expiry", signOIDCState(t, noExpiry, oidcStateKey()), "state-1"},
+		// 以 JWT 密钥本身签名（而非派生密钥）同样无效
+		{"wrong key", signOIDCState(t, valid(), []byte(config.Get().GetJWTSecret())), "state-1"},
+		{"state mismatch", signOIDCState(t, valid(), oidcStateKey()), "state-2"},
+		{"empty state", signOIDCState(t, valid(), oidcStateKey()), ""},
+		{"garbage cookie", "not-a-jwt", "state-1"},
+	}
+	for _, tc := range cases {
+		if _, _, err := OIDCCompleteLogin(context.Background(), "code-1", tc.state, tc.cookie); !errors.Is(err, ErrOIDCInvalidState) {
+			t.Errorf("%s: error = %v, want ErrOIDCInvalidState", tc.name, err)
+		}
+	}
+}
+
+func TestOIDCNonceMismatch(t *testing.T) {
+	idp := setupOIDC(t)
+	idp.mutate = func(claims jwt.MapClaims) { claims["nonce"] = "attacker-nonce" }
+	state, cookie := beginOIDCLogin(t, idp, "code-1", "/")
+
+	if _, _, err := OIDCCompleteLogin(context.Background(), "code-1", state, cookie); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Fatalf("error = %v, want ErrOIDCLoginFailed", err)
+	}
+	if exists, _ := repository.NewUserRepository().ExistsByUsername("sso-alice"); exists {
+		t.Error("user provisioned despite nonce mismatch")
+	}
+}
+
+func TestOIDCIDTokenValidation(t *testing.T) {
+	cases := map[string]func(jwt.MapClaims){
+		"audience mismatch": func(c jwt.MapClaims) { c["aud"] = "other-client" },
+		"issuer mismatch":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":           func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() },
+		"missing nonce":     func(c jwt.MapClaims) { delete(c, "nonce") },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			idp := setupOIDC(t)
+			idp.mutate = mutate
+			state, cookie := beginOIDCLogin(t, idp, "code-1", "/")
+			if _, _, err := OIDCCompleteLogin(context.Background(), "code-1", state, cookie); !errors.Is(err, ErrOIDCLoginFailed) {
+				t.Errorf("error = %v, want ErrOIDCLoginFailed", err)
+			}
+		})
+	}
+}
+
+// 授权码绑定发起登录时的 code_challenge：换用另一次登录的状态 Cookie（verifier 不同）时 IdP 拒绝换取
+func TestOIDCPKCEVerifier(t *testing.T) {
+	idp := setupOIDC(t)
+	_, victimCookie := beginOIDCLogin(t, idp, "victim-code", "/")
+	attackerState, attackerCookie := beginOIDCLogin(t, idp, "attacker-code", "/")
+	if victimCookie == attackerCookie {
+		t.Fatal("state cookies should differ between logins")
+	}
+
+	if _, _, err := OIDCCompleteLogin(context.Background(), "victim-code", attackerState, attackerCookie); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Fatalf("error = %v, want ErrOIDCLoginFailed", err)
+	}
+	if exists, _ := repository.NewUserRepository().ExistsByUsername("sso-alice"); exists {
+		t.Error("user provisioned with a mismatched PKCE verifier")
+	}
+
+	// 同一次登录的 verifier 与 code_challenge 匹配
+	if _, _, err := OIDCCompleteLogin(context.Background(), "attacker-code", attackerState, attackerCookie); err != nil {
+		t.Errorf("matching verifier: %v", err)
+	}
+}
+
+func TestSanitizeRedirectPath(t *testing.T) {
+	cases := map[string]string{
+		"":                        "/",
+		"/":                       "/",
+		"/settings?tab=keys":      "/settings?tab=keys",
+		"/a//b":                   "/a//b",
+		"//evil.com":              "/",
+		"//evil.com/path":         "/",
+		"/\\evil.com":             "/",
+		"/\t/evil.com":            "/",
+		"/\n/evil.com":            "/",
+		"https://evil.com":        "/",
+		"http://evil.com/login":   "/",
+		"evil.com":                "/",
+		"javascript:alert(1)":     "/",
+		"\\\\evil.com":            "/",
+		" /settings":              "/",
+		"/login?next=//evil.com":  "/login?next=//evil.com",
+		"/%2F%2Fevil.com":         "/%2F%2Fevil.com",
+		"/settings#https://x.com": "/settings#https://x.com",
+	}
+	for input, want := range cases {
+		if got := sanitizeRedirectPath(input); got != want {
+			t.Errorf("sanitizeRedirectPath(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	// 发起登录时传入的外部地址不会写入状态 Cookie
+	setupOIDC(t)
+	for _, redirect := range []string{"//evil.com", "https://evil.com"} {
+		_, cookie, err := OIDCBeginLogin(context.Background(), redirect)
+		if err != nil {
+			t.Fatalf("begin login: %v", err)
+		}
+		var claims oidcStateClaims
+		if _, err := jwt.ParseWithClaims(cookie, &claims, func(*jwt.Token) (interface{}, error) { return oidcStateKey(), nil }); err != nil {
+			t.Fatalf("parse state: %v", err)
+		}
+		if claims.Redirect != "/" {
+			t.Errorf("%q stored as %q", redirect, claims.Redirect)
+		}
+	}
+}
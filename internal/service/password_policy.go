@@ -0,0 +1,403 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"ampmanager/internal/config"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordPolicyError 新密码不符合密码策略，Violations 为各项未满足的要求
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "密码不符合安全策略：" + strings.Join(e.Violations, "；")
+}
+
+// ErrPasswordReused 新密码与当前密码相同
+var ErrPasswordReused = errors.New("新密码不能与当前密码相同")
+
+const (
+	auditActionPasswordForceChange = "user.password_force_change"
+
+	minPasswordLength = 6
+	maxPasswordLength = 128
+	maxBcryptCost     = 14
+
+	// passwordStatusTTL 强制修改密码状态的缓存时长，多实例部署时管理员设置最多延迟该时长生效
+	passwordStatusTTL = 30 * time.Second
+)
+
+var passwordPolicyState struct {
+	mu     sync.RWMutex
+	config model.PasswordPolicyConfig
+}
+
+func init() {
+	passwordPolicyState.config = DefaultPasswordPolicyConfig()
+}
+
+// DefaultPasswordPolicyConfig 默认至少 6 位并拒绝常见弱密码，不要求字符类别，不限制密码有效期
+func DefaultPasswordPolicyConfig() model.PasswordPolicyConfig {
+	return model.PasswordPolicyConfig{
+		MinLength:   minPasswordLength,
+		BreachCheck: true,
+		BcryptCost:  bcrypt.DefaultCost,
+	}
+}
+
+// NormalizePasswordPolicyConfig 未设置的长度与 bcrypt cost 使用默认值
+func NormalizePasswordPolicyConfig(cfg model.PasswordPolicyConfig) model.PasswordPolicyConfig {
+	if cfg.MinLength == 0 {
+		cfg.MinLength = minPasswordLength
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = bcrypt.DefaultCost
+	}
+	return cfg
+}
+
+// ValidatePasswordPolicyConfig 校验密码策略（需先 Normalize）
+func ValidatePasswordPolicyConfig(cfg model.PasswordPolicyConfig) error {
+	if cfg.MinLength < minPasswordLength || cfg.MinLength > maxPasswordLength {
+		return fmt.Errorf("minLength 必须在 %d-%d 之间", minPasswordLength, maxPasswordLength)
+	}
+	if cfg.BcryptCost < bcrypt.DefaultCost || cfg.BcryptCost > maxBcryptCost {
+		return fmt.Errorf("bcryptCost 必须在 %d-%d 之间", bcrypt.DefaultCost, maxBcryptCost)
+	}
+	if cfg.MaxAgeDays < 0 || cfg.MaxAgeDays > 3650 {
+		return errors.New("maxAgeDays 必须在 0-3650 之间（0 表示不限制）")
+	}
+	return nil
+}
+
+// InitPasswordPolicyConfig 启动时从持久化配置加载
+func InitPasswordPolicyConfig(configJSON string) {
+	var cfg model.PasswordPolicyConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("password policy: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+	cfg = NormalizePasswordPolicyConfig(cfg)
+	if err := ValidatePasswordPolicyConfig(cfg); err != nil {
+		log.Warnf("password policy: 配置无效，使用默认配置: %v", err)
+		return
+	}
+	UpdatePasswordPolicyConfig(cfg)
+}
+
+// UpdatePasswordPolicyConfig 更新运行时配置，已有密码不受影响，下次设置密码时按新策略校验
+func UpdatePasswordPolicyConfig(cfg model.PasswordPolicyConfig) {
+	passwordPolicyState.mu.Lock()
+	defer passwordPolicyState.mu.Unlock()
+	passwordPolicyState.config = cfg
+}
+
+// GetPasswordPolicyConfig 获取当前密码策略
+func GetPasswordPolicyConfig() model.PasswordPolicyConfig {
+	passwordPolicyState.mu.RLock()
+	defer passwordPolicyState.mu.RUnlock()
+	return passwordPolicyState.config
+}
+
+// GetPasswordPolicyStatus 返回密码策略与泄露密码库加载情况
+func GetPasswordPolicyStatus() model.PasswordPolicyStatus {
+	hashes, file := loadBreachList()
+	return model.PasswordPolicyStatus{
+		Config:            GetPasswordPolicyConfig(),
+		BreachListEntries: len(hashes),
+		BreachListFile:    file,
+	}
+}
+
+// commonPasswords 内置的常见弱密码，未配置 PASSWORD_BREACH_LIST 时同样生效
+var commonPasswords = []string{
+	"123456", "1234567", "12345678", "123456789", "1234567890", "654321", "111111", "000000",
+	"123123", "112233", "666666", "888888", "121212", "abc123", "abcdef", "a123456",
+	"password", "password1", "password123", "passw0rd", "p@ssw0rd", "qwerty", "qwerty123",
+	"qwertyuiop", "1q2w3e4r", "1qaz2wsx", "zxcvbnm", "asdfgh", "iloveyou", "welcome",
+	"letmein", "monkey", "dragon", "football", "baseball", "sunshine", "princess",
+	"admin", "admin123", "administrator", "root", "changeme", "secret", "test123", "woaini1314",
+}
+
+var breachList struct {
+	once   sync.Once
+	hashes map[string]struct{}
+	file   string
+}
+
+// loadBreachList 首次使用时加载内置弱密码与 PASSWORD_BREACH_LIST 文件，以大写 SHA-1 十六进制保存。
+// 文件每行为明文密码或 SHA-1 哈希（可带 HIBP 的 :COUNT 后缀），空行与 # 开头的行忽略
+func loadBreachList() (map[string]struct{}, string) {
+	breachList.once.Do(func() {
+		hashes := make(map[string]struct{}, len(commonPasswords))
+		for _, p := range commonPasswords {
+			hashes[sha1Upper(p)] = struct{}{}
+		}
+		if cfg := config.Get(); cfg != nil && cfg.PasswordBreachList != "" {
+			breachList.file = cfg.PasswordBreachList
+			count, err := readBreachListFile(cfg.PasswordBreachList, hashes)
+			if err != nil {
+				log.Warnf("password policy: 读取泄露密码库 %s 失败，仅使用内置弱密码: %v", cfg.PasswordBreachList, err)
+			} else {
+				log.Infof("password policy: 已加载泄露密码库 %s（%d 条）", cfg.PasswordBreachList, count)
+			}
+		}
+		breachList.hashes = hashes
+	})
+	return breachList.hashes, breachList.file
+}
+
+func readBreachListFile(path string, hashes map[string]struct{}) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, ok := parseSHA1Line(line); ok {
+			hashes[hash] = struct{}{}
+		} else {
+			hashes[sha1Upper(line)] = struct{}{}
+		}
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// parseSHA1Line 识别 40 位十六进制 SHA-1（可带 :COUNT 后缀）
+func parseSHA1Line(line string) (string, bool) {
+	hash := line
+	if i := strings.IndexByte(line, ':'); i == 40 {
+		hash = line[:40]
+	}
+	if len(hash) != 40 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	return strings.ToUpper(hash), true
+}
+
+func sha1Upper(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// ValidatePassword 按当前密码策略校验新密码，不满足时返回 *PasswordPolicyError
+func ValidatePassword(password, username string) error {
+	cfg := GetPasswordPolicyConfig()
+	var violations []string
+
+	if n := len([]rune(password)); n < cfg.MinLength {
+		violations = append(violations, fmt.Sprintf("长度至少 %d 个字符", cfg.MinLength))
+	} else if n > maxPasswordLength {
+		violations = append(violations, fmt.Sprintf("长度不能超过 %d 个字符", maxPasswordLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || r == ' ':
+			hasSymbol = true
+		}
+	}
+	if cfg.RequireUppercase && !hasUpper {
+		violations = append(violations, "需包含大写字母")
+	}
+	if cfg.RequireLowercase && !hasLower {
+		violations = append(violations, "需包含小写字母")
+	}
+	if cfg.RequireDigit && !hasDigit {
+		violations = append(violations, "需包含数字")
+	}
+	if cfg.RequireSymbol && !hasSymbol {
+		violations = append(violations, "需包含符号")
+	}
+
+	if cfg.DisallowUsername && username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		violations = append(violations, "不能包含用户名")
+	}
+	if cfg.BreachCheck {
+		hashes, _ := loadBreachList()
+		// 同时按小写形式匹配，覆盖 Password、QWERTY 等大小写变体
+		_, breached := hashes[sha1Upper(password)]
+		if !breached {
+			_, breached = hashes[sha1Upper(strings.ToLower(password))]
+		}
+		if breached {
+			violations = append(violations, "该密码过于常见或已出现在泄露密码库中")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// HashPassword 按密码策略中的 bcrypt cost 生成哈希
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), GetPasswordPolicyConfig().BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// passwordNeedsRehash 已有哈希的 cost 低于当前策略时返回 true
+func passwordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < GetPasswordPolicyConfig().BcryptCost
+}
+
+// PasswordChangeDue 用户被要求修改密码，或密码已超过策略规定的有效期
+func PasswordChangeDue(mustChange bool, changedAt, now time.Time) bool {
+	if mustChange {
+		return true
+	}
+	maxAge := GetPasswordPolicyConfig().MaxAgeDays
+	return maxAge > 0 && now.Sub(changedAt) > time.Duration(maxAge)*24*time.Hour
+}
+
+// UserPasswordChangeDue 同 PasswordChangeDue；只通过 SSO 登录、没有本地密码的账户不受密码有效期约束
+func UserPasswordChangeDue(user *model.User, now time.Time) bool {
+	return user.PasswordHash != "" && PasswordChangeDue(user.PasswordMustChange, user.PasswordChangedAt, now)
+}
+
+type passwordStatusEntry struct {
+	mustChange  bool
+	changedAt   time.Time
+	hasPassword bool
+	expires     time.Time
+}
+
+// passwordStatusCache key: userID, value: passwordStatusEntry
+var passwordStatusCache sync.Map
+
+// PasswordChangeRequired 用户是否需要先修改密码才能继续使用管理接口（查询失败时不拦截请求）
+func PasswordChangeRequired(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	now := time.Now()
+	if cached, ok := passwordStatusCache.Load(userID); ok {
+		entry := cached.(passwordStatusEntry)
+		if now.Before(entry.expires) {
+			return entry.hasPassword && PasswordChangeDue(entry.mustChange, entry.changedAt, now)
+		}
+	}
+
+	user, err := repository.NewUserRepository().GetByID(userID)
+	if err != nil || user == nil {
+		if err != nil {
+			log.Warnf("password policy: load user %s failed: %v", userID, err)
+		}
+		return false
+	}
+	passwordStatusCache.Store(userID, passwordStatusEntry{
+		mustChange:  user.PasswordMustChange,
+		changedAt:   user.PasswordChangedAt,
+		hasPassword: user.PasswordHash != "",
+		expires:     now.Add(passwordStatusTTL),
+	})
+	return UserPasswordChangeDue(user, now)
+}
+
+// setPassword 按策略校验并保存新密码，清除强制修改标记
+func (s *UserService) setPassword(user *model.User, newPassword string) error {
+	if err := ValidatePassword(newPassword, user.Username); err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(newPassword)) == nil {
+		return ErrPasswordReused
+	}
+	hashed, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(user.ID, hashed); err != nil {
+		return err
+	}
+	passwordStatusCache.Delete(user.ID)
+	return nil
+}
+
+// SetPasswordMustChange 管理员要求用户（或取消要求）在继续使用前修改密码
+func (s *UserService) SetPasswordMustChange(actor, userID string, required bool) error {
+	if err := s.repo.SetPasswordMustChange(userID, required); err != nil {
+		return err
+	}
+	passwordStatusCache.Delete(userID)
+	recordAudit(actor, auditActionPasswordForceChange, "user", userID, map[string]interface{}{"required": required})
+	return nil
+}
+
+// CredentialHygieneReport 列出超过 passwordDays 天未修改密码（或被要求修改）的账户，
+// 以及创建超过 keyDays 天仍从未使用的有效 API Key
+func CredentialHygieneReport(passwordDays, keyDays int) (*model.CredentialHygieneReport, error) {
+	now := time.Now().UTC()
+	report := &model.CredentialHygieneReport{
+		PasswordAgeDays: passwordDays,
+		KeyAgeDays:      keyDays,
+		GeneratedAt:     now,
+		StalePasswords:  []model.StalePasswordEntry{},
+		UnusedAPIKeys:   []model.UnusedAPIKeyEntry{},
+	}
+
+	users, err := repository.NewUserRepository().ListStalePasswords(now.AddDate(0, 0, -passwordDays))
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		report.StalePasswords = append(report.StalePasswords, model.StalePasswordEntry{
+			UserID:            u.ID,
+			Username:          u.Username,
+			IsAdmin:           u.IsAdmin,
+			PasswordChangedAt: u.PasswordChangedAt,
+			AgeDays:           int(now.Sub(u.PasswordChangedAt).Hours() / 24),
+			MustChange:        u.PasswordMustChange,
+		})
+	}
+
+	keys, err := repository.NewAPIKeyRepository().ListNeverUsed(now.AddDate(0, 0, -keyDays))
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		k.AgeDays = int(now.Sub(k.CreatedAt).Hours() / 24)
+		report.UnusedAPIKeys = append(report.UnusedAPIKeys, k)
+	}
+	return report, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ampmanager/internal/model"
+)
+
+func withPasswordPolicy(t *testing.T, cfg model.PasswordPolicyConfig) {
+	t.Helper()
+	prev := GetPasswordPolicyConfig()
+	UpdatePasswordPolicyConfig(NormalizePasswordPolicyConfig(cfg))
+	t.Cleanup(func() { UpdatePasswordPolicyConfig(prev) })
+}
+
+// withBreachListFile 在已加载的泄露密码库基础上追加 path 中的条目
+func withBreachListFile(t *testing.T, path string) int {
+	t.Helper()
+	loaded, _ := loadBreachList()
+	hashes := make(map[string]struct{}, len(loaded))
+	for hash := range loaded {
+		hashes[hash] = struct{}{}
+	}
+	count, err := readBreachListFile(path, hashes)
+	if err != nil {
+		t.Fatalf("read breach list: %v", err)
+	}
+	breachList.hashes = hashes
+	t.Cleanup(func() { breachList.hashes = loaded })
+	return count
+}
+
+func policyViolations(t *testing.T, password, username string) []string {
+	t.Helper()
+	err := ValidatePassword(password, username)
+	if err == nil {
+		return nil
+	}
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("ValidatePassword(%q) error = %v", password, err)
+	}
+	return policyErr.Violations
+}
+
+func TestValidatePassword(t *testing.T) {
+	classes := model.PasswordPolicyConfig{RequireUppercase: true, RequireLowercase: true, RequireDigit: true, RequireSymbol: true}
+	cases := []struct {
+		name     string
+		cfg      model.PasswordPolicyConfig
+		password string
+		username string
+		want     []string
+	}{
+		// 长度按字符而非字节计算
+		{"default ok", model.PasswordPolicyConfig{}, "kf83hq", "", nil},
+		{"too short", model.PasswordPolicyConfig{}, "kf83h", "", []string{"长度至少 6 个字符"}},
+		{"custom min length", model.PasswordPolicyConfig{MinLength: 12}, "kf83hq-zt9x", "", []string{"长度至少 12 个字符"}},
+		{"custom min length met", model.PasswordPolicyConfig{MinLength: 12}, "kf83hq-zt9xw", "", nil},
+		{"multibyte counts runes", model.PasswordPolicyConfig{}, "密码强度测试", "", nil},
+		{"too long", model.PasswordPolicyConfig{}, strings.Repeat("k", maxPasswordLength+1), "", []string{"长度不能超过 128 个字符"}},
+
+		{"all classes", classes, "Kf8#hqzt", "", nil},
+		{"missing uppercase", classes, "kf8#hqzt", "", []string{"需包含大写字母"}},
+		{"missing lowercase", classes, "KF8#HQZT", "", []string{"需包含小写字母"}},
+		{"missing digit", classes, "Kfx#hqzt", "", []string{"需包含数字"}},
+		{"missing symbol", classes, "Kf8xhqzt", "", []string{"需包含符号"}},
+		{"space counts as symbol", classes, "Kf8 hqzt", "", nil},
+		{"unicode letters", classes, "Ñandú8#x", "", nil},
+		{"only digits", classes, "83920174", "", []string{"需包含大写字母", "需包含小写字母", "需包含符号"}},
+		{"classes not required by default", model.PasswordPolicyConfig{}, "83920174", "", nil},
+
+		{"contains username", model.PasswordPolicyConfig{DisallowUsername: true}, "xxAlice2024", "alice", []string{"不能包含用户名"}},
+		{"username allowed when not configured", model.PasswordPolicyConfig{}, "xxAlice2024", "alice", nil},
+		{"empty username ignored", model.PasswordPolicyConfig{DisallowUsername: true}, "kf83hq", "", nil},
+
+		{"common password", model.PasswordPolicyConfig{BreachCheck: true}, "password123", "", []string{"该密码过于常见或已出现在泄露密码库中"}},
+		{"common password case variant", model.PasswordPolicyConfig{BreachCheck: true}, "QWERTY123", "", []string{"该密码过于常见或已出现在泄露密码库中"}},
+		{"common password allowed without breach check", model.PasswordPolicyConfig{}, "password123", "", nil},
+		{"multiple violations", model.PasswordPolicyConfig{RequireDigit: true, DisallowUsername: true, BreachCheck: true}, "admin", "admin",
+			[]string{"长度至少 6 个字符", "需包含数字", "不能包含用户名", "该密码过于常见或已出现在泄露密码库中"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			withPasswordPolicy(t, tc.cfg)
+			if got := policyViolations(t, tc.password, tc.username); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("violations = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordBreachListFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := strings.Join([]string{
+		"# 注释行与空行忽略",
+		"",
+		"correct horse battery",
+		// "Tr0ub4dor&3" 的 SHA-1，HIBP 格式小写并带出现次数
+		strings.ToLower(sha1Upper("Tr0ub4dor&3")) + ":42",
+		sha1Upper("hunter2-hunter2"),
+		// 40 位但不是十六进制，按明文处理
+		strings.Repeat("z", 40),
+	}, "\n")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write breach list: %v", err)
+	}
+	if count := withBreachListFile(t, path); count != 4 {
+		t.Errorf("loaded entries = %d, want 4", count)
+	}
+
+	withPasswordPolicy(t, model.PasswordPolicyConfig{BreachCheck: true})
+	for _, password := range []string{"correct horse battery", "Correct Horse Battery", "Tr0ub4dor&3", "hunter2-hunter2", strings.Repeat("z", 40)} {
+		if got := policyViolations(t, password, ""); len(got) != 1 {
+			t.Errorf("%q violations = %q, want breached", password, got)
+		}
+	}
+	for _, password := range []string{"correct horse", "Tr0ub4dor&4"} {
+		if got := policyViolations(t, password, ""); got != nil {
+			t.Errorf("%q violations = %q, want none", password, got)
+		}
+	}
+
+	if _, err := readBreachListFile(filepath.Join(t.TempDir(), "missing.txt"), map[string]struct{}{}); err == nil {
+		t.Error("expected error for missing breach list file")
+	}
+}
+
+func TestValidatePasswordPolicyConfig(t *testing.T) {
+	cases := []struct {
+		cfg   model.PasswordPolicyConfig
+		valid bool
+	}{
+		{model.PasswordPolicyConfig{}, true},
+		{model.PasswordPolicyConfig{MinLength: 5}, false},
+		{model.PasswordPolicyConfig{MinLength: maxPasswordLength + 1}, false},
+		{model.PasswordPolicyConfig{BcryptCost: maxBcryptCost + 1}, false},
+		{model.PasswordPolicyConfig{MaxAgeDays: -1}, false},
+		{model.PasswordPolicyConfig{MinLength: 16, BcryptCost: 12, MaxAgeDays: 90}, true},
+	}
+	for _, tc := range cases {
+		err := ValidatePasswordPolicyConfig(NormalizePasswordPolicyConfig(tc.cfg))
+		if (err == nil) != tc.valid {
+			t.Errorf("%+v error = %v", tc.cfg, err)
+		}
+	}
+}
@@ -37,32 +37,77 @@ func NewQuotaServiceWithRepo(
 	return &QuotaService{eventRepo: eventRepo, subRepo: subRepo, planRepo: planRepo}
 }
 
-func GetWindowBounds(limitType model.LimitType, windowMode model.WindowMode, now time.Time, subscriptionStartsAt time.Time) (start, end time.Time, err error) {
+// QuotaResetBoundary 固定窗口的重置边界：每日/每周/每月窗口在 Location 的 Hour 点重置
+type QuotaResetBoundary struct {
+	Location *time.Location
+	Hour     int
+}
+
+// PlanResetBoundary 返回套餐的固定窗口重置边界，套餐未设置重置时区时使用 userLoc（订阅用户的报表时区）
+func PlanResetBoundary(plan *model.SubscriptionPlan, userLoc *time.Location) QuotaResetBoundary {
+	boundary := QuotaResetBoundary{Location: userLoc}
+	if plan == nil {
+		return boundary
+	}
+	if plan.ResetTimezone != "" {
+		if loc, err := ParseTimezone(plan.ResetTimezone); err == nil {
+			boundary.Location = loc
+		}
+	}
+	if plan.ResetHour > 0 && plan.ResetHour < 24 {
+		boundary.Hour = plan.ResetHour
+	}
+	return boundary
+}
+
+// GetWindowBounds 计算限额窗口的起止时间。每日/每周（周一）/每月（1 日）固定窗口在 boundary 指定时区的整点重置
+// （未指定时区时为 UTC），返回的时间均为 UTC
+func GetWindowBounds(limitType model.LimitType, windowMode model.WindowMode, now time.Time, subscriptionStartsAt time.Time, boundary QuotaResetBoundary) (start, end time.Time, err error) {
+	loc := boundary.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	year, month, day := local.Date()
+	// 起止时间都由本地日期与整点直接构造，不在已换算的时间上加减天数，重置整点落在夏令时切换时前后窗口仍首尾相接
+	resetAt := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, boundary.Hour, 0, 0, 0, loc)
+	}
 	switch limitType {
 	case model.LimitTypeDaily:
 		if windowMode == model.WindowModeFixed {
-			start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
-			end = start.Add(24 * time.Hour)
+			if resetAt(year, month, day).After(now) {
+				day--
+			}
+			start = resetAt(year, month, day)
+			end = resetAt(year, month, day+1)
 		} else {
 			start = now.Add(-24 * time.Hour)
 			end = now
 		}
 	case model.LimitTypeWeekly:
 		if windowMode == model.WindowModeFixed {
-			weekday := int(now.Weekday())
+			weekday := int(local.Weekday())
 			if weekday == 0 {
 				weekday = 7
 			}
-			start = time.Date(now.Year(), now.Month(), now.Day()-(weekday-1), 0, 0, 0, 0, time.UTC)
-			end = start.AddDate(0, 0, 7)
+			day -= weekday - 1
+			if resetAt(year, month, day).After(now) {
+				day -= 7
+			}
+			start = resetAt(year, month, day)
+			end = resetAt(year, month, day+7)
 		} else {
 			start = now.AddDate(0, 0, -7)
 			end = now
 		}
 	case model.LimitTypeMonthly:
 		if windowMode == model.WindowModeFixed {
-			start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
-			end = start.AddDate(0, 1, 0)
+			if resetAt(year, month, 1).After(now) {
+				month--
+			}
+			start = resetAt(year, month, 1)
+			end = resetAt(year, month+1, 1)
 		} else {
 			start = now.AddDate(0, -1, 0)
 			end = now
@@ -84,7 +129,7 @@ func GetWindowBounds(limitType model.LimitType, windowMode model.WindowMode, now
 	default:
 		return time.Time{}, time.Time{}, ErrUnknownLimitType
 	}
-	return start, end, nil
+	return start.UTC(), end.UTC(), nil
 }
 
 func (s *QuotaService) GetSubscriptionRemaining(userID string) (int64, []model.WindowRemaining, error) {
@@ -96,7 +141,7 @@ func (s *QuotaService) GetSubscriptionRemaining(userID string) (int64, []model.W
 		return 0, nil, nil
 	}
 
-	_, limits, err := s.planRepo.GetByID(sub.PlanID)
+	plan, limits, err := s.planRepo.GetByID(sub.PlanID)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -105,11 +150,12 @@ func (s *QuotaService) GetSubscriptionRemaining(userID string) (int64, []model.W
 	}
 
 	now := time.Now().UTC()
+	boundary := PlanResetBoundary(plan, UserLocation(userID))
 	windows := make([]model.WindowRemaining, 0, len(limits))
 	minRemaining := int64(math.MaxInt64)
 
 	for _, limit := range limits {
-		start, end, err := GetWindowBounds(limit.LimitType, limit.WindowMode, now, sub.StartsAt)
+		start, end, err := GetWindowBounds(limit.LimitType, limit.WindowMode, now, sub.StartsAt, boundary)
 		if err != nil {
 			return 0, nil, err
 		}
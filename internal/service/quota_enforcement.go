@@ -0,0 +1,74 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var quotaEnforcementState struct {
+	mu     sync.RWMutex
+	config model.QuotaEnforcementConfig
+}
+
+func init() {
+	quotaEnforcementState.config = DefaultQuotaEnforcementConfig()
+}
+
+// DefaultQuotaEnforcementConfig 默认额度用尽时拒绝模型调用
+func DefaultQuotaEnforcementConfig() model.QuotaEnforcementConfig {
+	return model.QuotaEnforcementConfig{Mode: model.QuotaEnforcementHard}
+}
+
+// NormalizeQuotaEnforcementConfig 统一大小写，未设置时使用 hard
+func NormalizeQuotaEnforcementConfig(cfg model.QuotaEnforcementConfig) model.QuotaEnforcementConfig {
+	cfg.Mode = strings.ToLower(strings.TrimSpace(cfg.Mode))
+	if cfg.Mode == "" {
+		cfg.Mode = model.QuotaEnforcementHard
+	}
+	return cfg
+}
+
+// ValidateQuotaEnforcementConfig 校验额度预检配置（需先 Normalize）
+func ValidateQuotaEnforcementConfig(cfg model.QuotaEnforcementConfig) error {
+	switch cfg.Mode {
+	case model.QuotaEnforcementHard, model.QuotaEnforcementSoft, model.QuotaEnforcementOff:
+		return nil
+	default:
+		return fmt.Errorf("mode 必须为 %s、%s 或 %s", model.QuotaEnforcementHard, model.QuotaEnforcementSoft, model.QuotaEnforcementOff)
+	}
+}
+
+// InitQuotaEnforcementConfig 启动时从持久化配置加载
+func InitQuotaEnforcementConfig(configJSON string) {
+	var cfg model.QuotaEnforcementConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("quota enforcement: 解析配置失败，使用默认配置: %v", err)
+		return
+	}
+	cfg = NormalizeQuotaEnforcementConfig(cfg)
+	if err := ValidateQuotaEnforcementConfig(cfg); err != nil {
+		log.Warnf("quota enforcement: 配置无效，使用默认配置: %v", err)
+		return
+	}
+	UpdateQuotaEnforcementConfig(cfg)
+}
+
+// UpdateQuotaEnforcementConfig 更新运行时配置
+func UpdateQuotaEnforcementConfig(cfg model.QuotaEnforcementConfig) {
+	quotaEnforcementState.mu.Lock()
+	defer quotaEnforcementState.mu.Unlock()
+	quotaEnforcementState.config = cfg
+}
+
+// GetQuotaEnforcementConfig 获取当前额度预检配置
+func GetQuotaEnforcementConfig() model.QuotaEnforcementConfig {
+	quotaEnforcementState.mu.RLock()
+	defer quotaEnforcementState.mu.RUnlock()
+	return quotaEnforcementState.config
+}
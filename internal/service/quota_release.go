@@ -0,0 +1,132 @@
+package service
+
+import (
+	"time"
+
+	"ampmanager/internal/model"
+)
+
+// maxCapacityReleases 单个窗口返回的释放计划条数上限
+const maxCapacityReleases = 200
+
+// GetReleaseSchedule 计算当前订阅各额度窗口的释放计划：滑动窗口中每笔扣费在窗口长度后移出窗口，
+// 按分钟合并（向上取整，避免提前显示可用）；固定窗口在窗口结束时全部释放；总量额度不释放
+func (s *QuotaService) GetReleaseSchedule(userID string, now time.Time) (*model.QuotaReleaseScheduleResponse, error) {
+	now = now.UTC()
+	resp := &model.QuotaReleaseScheduleResponse{Now: now, Windows: []model.WindowReleaseSchedule{}}
+
+	sub, err := s.subRepo.GetActiveByUserID(userID)
+	if err != nil || sub == nil {
+		return resp, err
+	}
+	resp.SubscriptionID = sub.ID
+
+	plan, limits, err := s.planRepo.GetByID(sub.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	boundary := PlanResetBoundary(plan, UserLocation(userID))
+
+	for _, limit := range limits {
+		start, end, err := GetWindowBounds(limit.LimitType, limit.WindowMode, now, sub.StartsAt, boundary)
+		if err != nil {
+			return nil, err
+		}
+		used, err := s.eventRepo.GetUsageInWindow(sub.ID, start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		window := model.WindowReleaseSchedule{
+			WindowRemaining: model.WindowRemaining{
+				LimitType:   limit.LimitType,
+				WindowMode:  limit.WindowMode,
+				LimitMicros: limit.LimitMicros,
+				UsedMicros:  used,
+				LeftMicros:  clampLeft(limit.LimitMicros, used),
+				WindowStart: start,
+				WindowEnd:   end,
+			},
+			Releases: []model.CapacityRelease{},
+		}
+
+		switch {
+		case limit.LimitType == model.LimitTypeTotal || used <= 0:
+		case limit.WindowMode == model.WindowModeFixed:
+			window.Releases = append(window.Releases, model.CapacityRelease{
+				ReleaseAt:       end,
+				AmountMicros:    used,
+				LeftAfterMicros: limit.LimitMicros,
+			})
+		default:
+			if err := s.fillRollingReleases(&window, sub.ID, start, end); err != nil {
+				return nil, err
+			}
+		}
+		if len(window.Releases) > 0 {
+			next := window.Releases[0].ReleaseAt
+			window.NextReleaseAt = &next
+		}
+		resp.Windows = append(resp.Windows, window)
+	}
+	return resp, nil
+}
+
+// fillRollingReleases 按窗口内事件计算滑动窗口的释放计划，与 windowResetTime 一致：事件在 created_at + 窗口长度时移出
+func (s *QuotaService) fillRollingReleases(window *model.WindowReleaseSchedule, subscriptionID string, start, end time.Time) error {
+	events, err := s.eventRepo.ListSubscriptionEventsInWindow(subscriptionID, start, end)
+	if err != nil {
+		return err
+	}
+
+	length := end.Sub(start)
+	used := window.UsedMicros
+	for _, e := range events {
+		amount := e.AmountMicros
+		if e.EventType == model.BillingEventRefund {
+			amount = -amount
+		}
+		releaseAt := ceilMinute(e.CreatedAt.Add(length).UTC())
+		used -= amount
+
+		n := len(window.Releases)
+		if n > 0 && window.Releases[n-1].ReleaseAt.Equal(releaseAt) {
+			window.Releases[n-1].AmountMicros += amount
+			window.Releases[n-1].LeftAfterMicros = clampLeft(window.LimitMicros, used)
+			continue
+		}
+		if n == maxCapacityReleases {
+			window.Truncated = true
+			break
+		}
+		window.Releases = append(window.Releases, model.CapacityRelease{
+			ReleaseAt:       releaseAt,
+			AmountMicros:    amount,
+			LeftAfterMicros: clampLeft(window.LimitMicros, used),
+		})
+	}
+
+	// 同一分钟内扣费与退款相互抵消的时间点不返回
+	releases := window.Releases[:0]
+	for _, r := range window.Releases {
+		if r.AmountMicros != 0 {
+			releases = append(releases, r)
+		}
+	}
+	window.Releases = releases
+	return nil
+}
+
+func clampLeft(limit, used int64) int64 {
+	if left := limit - used; left > 0 {
+		return left
+	}
+	return 0
+}
+
+func ceilMinute(t time.Time) time.Time {
+	if truncated := t.Truncate(time.Minute); truncated.Before(t) {
+		return truncated.Add(time.Minute)
+	}
+	return t
+}
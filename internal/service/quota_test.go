@@ -0,0 +1,167 @@
+package service
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"ampmanager/internal/model"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := ParseTimezone(name)
+	if err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	return loc
+}
+
+func utc(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed.UTC()
+}
+
+func TestGetWindowBoundsFixed(t *testing.T) {
+	cases := []struct {
+		name      string
+		limitType model.LimitType
+		tz        string
+		hour      int
+		now       string
+		start     string
+		end       string
+	}{
+		// 重置点在 UTC 午夜之前/之后
+		{"daily utc midnight", model.LimitTypeDaily, "UTC", 0, "2024-05-10T12:00:00Z", "2024-05-10T00:00:00Z", "2024-05-11T00:00:00Z"},
+		{"daily utc before reset hour", model.LimitTypeDaily, "UTC", 4, "2024-05-10T03:59:59Z", "2024-05-09T04:00:00Z", "2024-05-10T04:00:00Z"},
+		{"daily utc at reset hour", model.LimitTypeDaily, "UTC", 4, "2024-05-10T04:00:00Z", "2024-05-10T04:00:00Z", "2024-05-11T04:00:00Z"},
+		{"daily east of utc resets before utc midnight", model.LimitTypeDaily, "Asia/Shanghai", 4, "2024-05-09T21:00:00Z", "2024-05-09T20:00:00Z", "2024-05-10T20:00:00Z"},
+		{"daily east of utc just before reset", model.LimitTypeDaily, "Asia/Shanghai", 4, "2024-05-09T19:59:00Z", "2024-05-08T20:00:00Z", "2024-05-09T20:00:00Z"},
+		{"daily west of utc resets after utc midnight", model.LimitTypeDaily, "America/Los_Angeles", 22, "2024-05-10T04:30:00Z", "2024-05-09T05:00:00Z", "2024-05-10T05:00:00Z"},
+		{"daily west of utc local day differs from utc day", model.LimitTypeDaily, "America/Los_Angeles", 22, "2024-05-10T05:30:00Z", "2024-05-10T05:00:00Z", "2024-05-11T05:00:00Z"},
+		{"daily local midnight on utc previous day", model.LimitTypeDaily, "Asia/Tokyo", 0, "2024-05-09T16:00:00Z", "2024-05-09T15:00:00Z", "2024-05-10T15:00:00Z"},
+
+		// 夏令时切换：America/New_York 2024-03-10 02:00 -> 03:00，2024-11-03 02:00 -> 01:00
+		{"daily spring forward day is 23h", model.LimitTypeDaily, "America/New_York", 0, "2024-03-10T12:00:00Z", "2024-03-10T05:00:00Z", "2024-03-11T04:00:00Z"},
+		{"daily fall back day is 25h", model.LimitTypeDaily, "America/New_York", 0, "2024-11-03T12:00:00Z", "2024-11-03T04:00:00Z", "2024-11-04T05:00:00Z"},
+		{"daily day after reset hour gap", model.LimitTypeDaily, "America/New_York", 2, "2024-03-11T12:00:00Z", "2024-03-11T06:00:00Z", "2024-03-12T06:00:00Z"},
+		{"daily reset hour repeated on fall back", model.LimitTypeDaily, "America/New_York", 1, "2024-11-03T12:00:00Z", "2024-11-03T05:00:00Z", "2024-11-04T06:00:00Z"},
+		{"weekly across spring forward", model.LimitTypeWeekly, "America/New_York", 0, "2024-03-12T12:00:00Z", "2024-03-11T04:00:00Z", "2024-03-18T04:00:00Z"},
+		{"weekly containing spring forward", model.LimitTypeWeekly, "America/New_York", 0, "2024-03-08T12:00:00Z", "2024-03-04T05:00:00Z", "2024-03-11T04:00:00Z"},
+
+		// 周窗口从周一开始，周日属于上一周
+		{"weekly sunday", model.LimitTypeWeekly, "UTC", 0, "2024-05-12T23:00:00Z", "2024-05-06T00:00:00Z", "2024-05-13T00:00:00Z"},
+		{"weekly monday before reset hour", model.LimitTypeWeekly, "UTC", 6, "2024-05-13T05:00:00Z", "2024-05-06T06:00:00Z", "2024-05-13T06:00:00Z"},
+
+		// 月窗口跨月、跨年、闰年二月
+		{"monthly mid month", model.LimitTypeMonthly, "UTC", 0, "2024-05-15T00:00:00Z", "2024-05-01T00:00:00Z", "2024-06-01T00:00:00Z"},
+		{"monthly first day before reset hour", model.LimitTypeMonthly, "UTC", 4, "2024-03-01T03:00:00Z", "2024-02-01T04:00:00Z", "2024-03-01T04:00:00Z"},
+		{"monthly year rollover", model.LimitTypeMonthly, "UTC", 4, "2025-01-01T02:00:00Z", "2024-12-01T04:00:00Z", "2025-01-01T04:00:00Z"},
+		{"monthly leap february", model.LimitTypeMonthly, "UTC", 0, "2024-02-29T23:00:00Z", "2024-02-01T00:00:00Z", "2024-03-01T00:00:00Z"},
+		{"monthly local month ahead of utc", model.LimitTypeMonthly, "Asia/Shanghai", 0, "2024-05-31T17:00:00Z", "2024-05-31T16:00:00Z", "2024-06-30T16:00:00Z"},
+		{"monthly local month behind utc", model.LimitTypeMonthly, "America/Los_Angeles", 0, "2024-06-01T03:00:00Z", "2024-05-01T07:00:00Z", "2024-06-01T07:00:00Z"},
+		{"monthly across dst", model.LimitTypeMonthly, "America/New_York", 0, "2024-03-20T00:00:00Z", "2024-03-01T05:00:00Z", "2024-04-01T04:00:00Z"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			boundary := QuotaResetBoundary{Location: mustLocation(t, tc.tz), Hour: tc.hour}
+			start, end, err := GetWindowBounds(tc.limitType, model.WindowModeFixed, utc(tc.now), time.Time{}, boundary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !start.Equal(utc(tc.start)) || !end.Equal(utc(tc.end)) {
+				t.Errorf("window = [%s, %s), want [%s, %s)", start.Format(time.RFC3339), end.Format(time.RFC3339), tc.start, tc.end)
+			}
+		})
+	}
+}
+
+// 连续的固定窗口首尾相接：每个窗口的结束时间即下一个窗口的开始时间，跨夏令时切换也不重叠、不留空隙
+func TestGetWindowBoundsContiguous(t *testing.T) {
+	for _, tz := range []string{"UTC", "America/New_York", "Europe/London", "Australia/Lord_Howe", "Asia/Shanghai"} {
+		for _, hour := range []int{0, 1, 2, 23} {
+			for _, limitType := range []model.LimitType{model.LimitTypeDaily, model.LimitTypeWeekly, model.LimitTypeMonthly} {
+				boundary := QuotaResetBoundary{Location: mustLocation(t, tz), Hour: hour}
+				now := utc("2024-01-01T00:00:00Z")
+				_, end, _ := GetWindowBounds(limitType, model.WindowModeFixed, now, time.Time{}, boundary)
+				for now.Year() < 2025 {
+					start, nextEnd, err := GetWindowBounds(limitType, model.WindowModeFixed, end, time.Time{}, boundary)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !start.Equal(end) || !nextEnd.After(start) {
+						t.Fatalf("%s %s hour %d: window after %s = [%s, %s)", tz, limitType, hour, end.Format(time.RFC3339), start.Format(time.RFC3339), nextEnd.Format(time.RFC3339))
+					}
+					now, end = start, nextEnd
+				}
+			}
+		}
+	}
+}
+
+// 逐小时检查当前时间总在所在窗口内，覆盖重置整点落在夏令时跳过或重复的一小时内的情况
+func TestGetWindowBoundsContainsNow(t *testing.T) {
+	for _, tz := range []string{"America/New_York", "Europe/London", "Australia/Lord_Howe"} {
+		for _, hour := range []int{0, 1, 2} {
+			boundary := QuotaResetBoundary{Location: mustLocation(t, tz), Hour: hour}
+			for now := utc("2024-01-01T00:30:00Z"); now.Year() < 2025; now = now.Add(time.Hour) {
+				for _, limitType := range []model.LimitType{model.LimitTypeDaily, model.LimitTypeWeekly, model.LimitTypeMonthly} {
+					start, end, _ := GetWindowBounds(limitType, model.WindowModeFixed, now, time.Time{}, boundary)
+					if now.Before(start) || !now.Before(end) {
+						t.Fatalf("%s %s hour %d: %s outside window [%s, %s)", tz, limitType, hour, now.Format(time.RFC3339), start.Format(time.RFC3339), end.Format(time.RFC3339))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPlanResetBoundary(t *testing.T) {
+	shanghai := mustLocation(t, "Asia/Shanghai")
+
+	boundary := PlanResetBoundary(nil, shanghai)
+	if boundary.Location != shanghai || boundary.Hour != 0 {
+		t.Errorf("nil plan = %+v", boundary)
+	}
+	// 套餐未设置时区时使用用户时区
+	boundary = PlanResetBoundary(&model.SubscriptionPlan{ResetHour: 4}, shanghai)
+	if boundary.Location != shanghai || boundary.Hour != 4 {
+		t.Errorf("user timezone = %+v", boundary)
+	}
+	boundary = PlanResetBoundary(&model.SubscriptionPlan{ResetTimezone: "America/New_York", ResetHour: 23}, shanghai)
+	if boundary.Location.String() != "America/New_York" || boundary.Hour != 23 {
+		t.Errorf("plan timezone = %+v", boundary)
+	}
+	// 无效时区与越界整点回退到默认值
+	boundary = PlanResetBoundary(&model.SubscriptionPlan{ResetTimezone: "Mars/Base", ResetHour: 24}, shanghai)
+	if boundary.Location != shanghai || boundary.Hour != 0 {
+		t.Errorf("invalid plan = %+v", boundary)
+	}
+}
+
+func TestGetWindowBoundsRollingAndTotal(t *testing.T) {
+	now := utc("2024-05-10T07:30:00Z")
+	startsAt := utc("2024-01-01T00:00:00Z")
+	boundary := QuotaResetBoundary{Location: mustLocation(t, "Asia/Shanghai"), Hour: 4}
+
+	// 滑动窗口与 5 小时固定窗口（按 Unix 时间对齐）不受重置时区影响
+	start, end, _ := GetWindowBounds(model.LimitTypeDaily, model.WindowModeSliding, now, startsAt, boundary)
+	if !start.Equal(now.Add(-24*time.Hour)) || !end.Equal(now) {
+		t.Errorf("sliding daily = [%s, %s)", start, end)
+	}
+	start, end, _ = GetWindowBounds(model.LimitTypeRolling5h, model.WindowModeFixed, now, startsAt, boundary)
+	if !start.Equal(utc("2024-05-10T03:00:00Z")) || !end.Equal(utc("2024-05-10T08:00:00Z")) {
+		t.Errorf("fixed 5h = [%s, %s)", start, end)
+	}
+	start, end, _ = GetWindowBounds(model.LimitTypeTotal, model.WindowModeFixed, now, startsAt, boundary)
+	if !start.Equal(startsAt) || !end.Equal(farFuture) {
+		t.Errorf("total = [%s, %s)", start, end)
+	}
+	if _, _, err := GetWindowBounds("yearly", model.WindowModeFixed, now, startsAt, boundary); err != ErrUnknownLimitType {
+		t.Errorf("unknown limit type error = %v", err)
+	}
+}
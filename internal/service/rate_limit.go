@@ -0,0 +1,178 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+var (
+	ErrRateLimitInvalidScope   = errors.New("限流范围无效，仅支持 user、api_key、group")
+	ErrRateLimitTargetNotFound = errors.New("限流对象不存在")
+	ErrRateLimitEmpty          = errors.New("每分钟请求数、token 数与并发数至少设置一项")
+	ErrRateLimitNotFound       = errors.New("限流规则不存在")
+)
+
+// rateLimitCacheTTL 限流规则缓存有效期；本实例修改会立即生效，其他实例最多延迟该时长
+const rateLimitCacheTTL = 30 * time.Second
+
+var rateLimitCache struct {
+	mu       sync.RWMutex
+	limits   map[string]*model.RateLimit
+	loadedAt time.Time
+}
+
+func invalidateRateLimitCache() {
+	rateLimitCache.mu.Lock()
+	rateLimitCache.loadedAt = time.Time{}
+	rateLimitCache.mu.Unlock()
+}
+
+func rateLimitCacheKey(scope, targetID string) string {
+	return scope + ":" + targetID
+}
+
+type RateLimitService struct {
+	repo       *repository.RateLimitRepository
+	userRepo   *repository.UserRepository
+	groupRepo  *repository.GroupRepository
+	apiKeyRepo *repository.APIKeyRepository
+}
+
+func NewRateLimitService() *RateLimitService {
+	return &RateLimitService{
+		repo:       repository.NewRateLimitRepository(),
+		userRepo:   repository.NewUserRepository(),
+		groupRepo:  repository.NewGroupRepository(),
+		apiKeyRepo: repository.NewAPIKeyRepository(),
+	}
+}
+
+func (s *RateLimitService) List() ([]*model.RateLimit, error) {
+	limits, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	if limits == nil {
+		limits = []*model.RateLimit{}
+	}
+	return limits, nil
+}
+
+// Put 创建或更新限流规则，本实例立即生效
+func (s *RateLimitService) Put(scope, targetID string, req *model.RateLimitRequest) (*model.RateLimit, error) {
+	if err := s.checkTarget(scope, targetID); err != nil {
+		return nil, err
+	}
+	if req.RequestsPerMinute == 0 && req.TokensPerMinute == 0 && req.MaxConcurrent == 0 {
+		return nil, ErrRateLimitEmpty
+	}
+
+	limit := &model.RateLimit{
+		Scope:             scope,
+		TargetID:          targetID,
+		RequestsPerMinute: req.RequestsPerMinute,
+		TokensPerMinute:   req.TokensPerMinute,
+		MaxConcurrent:     req.MaxConcurrent,
+	}
+	if err := s.repo.Upsert(limit); err != nil {
+		return nil, err
+	}
+	invalidateRateLimitCache()
+	return limit, nil
+}
+
+func (s *RateLimitService) Delete(scope, targetID string) error {
+	deleted, err := s.repo.Delete(scope, targetID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrRateLimitNotFound
+	}
+	invalidateRateLimitCache()
+	return nil
+}
+
+func (s *RateLimitService) checkTarget(scope, targetID string) error {
+	var exists bool
+	switch scope {
+	case model.RateLimitScopeUser:
+		user, err := s.userRepo.GetByID(targetID)
+		if err != nil {
+			return err
+		}
+		exists = user != nil
+	case model.RateLimitScopeAPIKey:
+		key, err := s.apiKeyRepo.GetByID(targetID)
+		if err != nil {
+			return err
+		}
+		exists = key != nil
+	case model.RateLimitScopeGroup:
+		group, err := s.groupRepo.GetByID(targetID)
+		if err != nil {
+			return err
+		}
+		exists = group != nil
+	default:
+		return ErrRateLimitInvalidScope
+	}
+	if !exists {
+		return ErrRateLimitTargetNotFound
+	}
+	return nil
+}
+
+// LimitsFor 返回适用于本次请求的限流规则（用户、API Key 及所属分组），用于请求热路径（读缓存）
+func (s *RateLimitService) LimitsFor(userID, apiKeyID string, groupIDs []string) []*model.RateLimit {
+	limits := s.cachedLimits()
+	if len(limits) == 0 {
+		return nil
+	}
+	var result []*model.RateLimit
+	if limit, ok := limits[rateLimitCacheKey(model.RateLimitScopeUser, userID)]; ok {
+		result = append(result, limit)
+	}
+	if limit, ok := limits[rateLimitCacheKey(model.RateLimitScopeAPIKey, apiKeyID)]; ok {
+		result = append(result, limit)
+	}
+	for _, groupID := range groupIDs {
+		if limit, ok := limits[rateLimitCacheKey(model.RateLimitScopeGroup, groupID)]; ok {
+			result = append(result, limit)
+		}
+	}
+	return result
+}
+
+func (s *RateLimitService) cachedLimits() map[string]*model.RateLimit {
+	rateLimitCache.mu.RLock()
+	limits, loadedAt := rateLimitCache.limits, rateLimitCache.loadedAt
+	rateLimitCache.mu.RUnlock()
+	if limits != nil && time.Since(loadedAt) < rateLimitCacheTTL {
+		return limits
+	}
+
+	list, err := s.repo.List()
+	if err != nil {
+		// 加载失败时沿用旧缓存，避免数据库抖动导致限流整体失效
+		log.Printf("[WARN] 加载限流规则失败: %v", err)
+		if limits == nil {
+			return map[string]*model.RateLimit{}
+		}
+		return limits
+	}
+	limits = make(map[string]*model.RateLimit, len(list))
+	for _, limit := range list {
+		limits[rateLimitCacheKey(limit.Scope, limit.TargetID)] = limit
+	}
+	rateLimitCache.mu.Lock()
+	rateLimitCache.limits = limits
+	rateLimitCache.loadedAt = time.Now()
+	rateLimitCache.mu.Unlock()
+	return limits
+}
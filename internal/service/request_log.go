@@ -26,25 +26,42 @@ type ListRequestLogsParams struct {
 	IsStreaming *bool
 	From        *time.Time
 	To          *time.Time
-	Page        int
-	PageSize    int
+	Status      string
+	MinCost     *int64
+	// TraceID 按分布式追踪 trace ID 精确查找
+	TraceID  string
+	Page     int
+	PageSize int
+	// UseCursor 为 true 时使用 keyset 游标分页，不计算总数
+	UseCursor bool
+	Cursor    string
+}
+
+func (p ListRequestLogsParams) toRepoParams() repository.ListParams {
+	return repository.ListParams{
+		UserID:      p.UserID,
+		APIKeyID:    p.APIKeyID,
+		Model:       p.Model,
+		StatusCode:  p.StatusCode,
+		IsStreaming: p.IsStreaming,
+		From:        p.From,
+		To:          p.To,
+		Status:      p.Status,
+		MinCost:     p.MinCost,
+		TraceID:     p.TraceID,
+		Page:        p.Page,
+		PageSize:    p.PageSize,
+		Cursor:      p.Cursor,
+	}
 }
 
 // List 查询请求日志列表
 func (s *RequestLogService) List(params ListRequestLogsParams) (*model.RequestLogListResponse, error) {
-	repoParams := repository.ListParams{
-		UserID:      params.UserID,
-		APIKeyID:    params.APIKeyID,
-		Model:       params.Model,
-		StatusCode:  params.StatusCode,
-		IsStreaming: params.IsStreaming,
-		From:        params.From,
-		To:          params.To,
-		Page:        params.Page,
-		PageSize:    params.PageSize,
+	if params.UseCursor {
+		return s.listByCursor(params)
 	}
 
-	logs, total, err := s.repo.List(repoParams)
+	logs, total, err := s.repo.List(params.toRepoParams())
 	if err != nil {
 		return nil, err
 	}
@@ -57,9 +74,27 @@ func (s *RequestLogService) List(params ListRequestLogsParams) (*model.RequestLo
 	}, nil
 }
 
-// GetUsageSummary 获取用量统计（用户自身）
+func (s *RequestLogService) listByCursor(params ListRequestLogsParams) (*model.RequestLogListResponse, error) {
+	logs, nextCursor, err := s.repo.ListByCursor(params.toRepoParams())
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.RequestLogListResponse{
+		Items:      logs,
+		PageSize:   params.PageSize,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// Export 流式遍历满足条件的全部日志
+func (s *RequestLogService) Export(params ListRequestLogsParams, fn func(model.RequestLog) error) error {
+	return s.repo.Iterate(params.toRepoParams(), 0, fn)
+}
+
+// GetUsageSummary 获取用量统计（用户自身），按天分组时使用用户的报表时区
 func (s *RequestLogService) GetUsageSummary(userID string, from, to *time.Time, groupBy string, modelFilter string) (*model.UsageSummaryResponse, error) {
-	summaries, err := s.repo.GetUsageSummary(&userID, from, to, groupBy, modelFilter)
+	summaries, err := s.repo.GetUsageSummary(&userID, from, to, groupBy, modelFilter, UserLocation(userID))
 	if err != nil {
 		return nil, err
 	}
@@ -69,9 +104,9 @@ func (s *RequestLogService) GetUsageSummary(userID string, from, to *time.Time,
 	}, nil
 }
 
-// GetUsageSummaryAdmin 获取用量统计（管理员，查看所有用户）
-func (s *RequestLogService) GetUsageSummaryAdmin(userID *string, from, to *time.Time, groupBy string, modelFilter string) (*model.UsageSummaryResponse, error) {
-	summaries, err := s.repo.GetUsageSummary(userID, from, to, groupBy, modelFilter)
+// GetUsageSummaryAdmin 获取用量统计（管理员，查看所有用户），按天分组时使用 loc
+func (s *RequestLogService) GetUsageSummaryAdmin(userID *string, from, to *time.Time, groupBy string, modelFilter string, loc *time.Location) (*model.UsageSummaryResponse, error) {
+	summaries, err := s.repo.GetUsageSummary(userID, from, to, groupBy, modelFilter, loc)
 	if err != nil {
 		return nil, err
 	}
@@ -83,19 +118,12 @@ func (s *RequestLogService) GetUsageSummaryAdmin(userID *string, from, to *time.
 
 // ListAdmin 管理员查询请求日志列表（可选按用户过滤）
 func (s *RequestLogService) ListAdmin(params ListRequestLogsParams) (*model.RequestLogListResponse, error) {
-	repoParams := repository.ListParams{
-		UserID:      params.UserID, // UserID 可为空
-		APIKeyID:    params.APIKeyID,
-		Model:       params.Model,
-		StatusCode:  params.StatusCode,
-		IsStreaming: params.IsStreaming,
-		From:        params.From,
-		To:          params.To,
-		Page:        params.Page,
-		PageSize:    params.PageSize,
+	// UserID 可为空
+	if params.UseCursor {
+		return s.listByCursor(params)
 	}
 
-	logs, total, err := s.repo.List(repoParams)
+	logs, total, err := s.repo.List(params.toRepoParams())
 	if err != nil {
 		return nil, err
 	}
@@ -123,9 +151,9 @@ func (s *RequestLogService) GetDistinctAPIKeys(userID string) ([]repository.Dist
 	return s.repo.GetDistinctAPIKeys(userID)
 }
 
-// GetDashboardStats 获取仪表盘统计数据
+// GetDashboardStats 获取仪表盘统计数据，按用户的报表时区计算今日与每日趋势
 func (s *RequestLogService) GetDashboardStats(userID string) (today, week, month repository.DashboardPeriodStats, topModels []repository.DashboardTopModel, dailyTrend []repository.DashboardDailyTrend, err error) {
-	return s.repo.GetDashboardStats(userID)
+	return s.repo.GetDashboardStats(userID, UserLocation(userID))
 }
 
 // GetCacheHitRateByProvider 按提供商获取缓存命中率
@@ -133,9 +161,9 @@ func (s *RequestLogService) GetCacheHitRateByProvider(userID string) ([]reposito
 	return s.repo.GetCacheHitRateByProvider(userID)
 }
 
-// GetAdminDashboardStats 获取管理员仪表盘统计数据
-func (s *RequestLogService) GetAdminDashboardStats() (today, week, month repository.DashboardPeriodStats, topModels []repository.DashboardTopModel, dailyTrend []repository.DashboardDailyTrend, err error) {
-	return s.repo.GetAdminDashboardStats()
+// GetAdminDashboardStats 获取管理员仪表盘统计数据，按 loc 计算今日与每日趋势
+func (s *RequestLogService) GetAdminDashboardStats(loc *time.Location) (today, week, month repository.DashboardPeriodStats, topModels []repository.DashboardTopModel, dailyTrend []repository.DashboardDailyTrend, err error) {
+	return s.repo.GetAdminDashboardStats(loc)
 }
 
 // GetAdminCacheHitRateByProvider 管理员全局缓存命中率
@@ -157,3 +185,21 @@ func (s *RequestLogService) GetByID(id, userID string) (*model.RequestLog, error
 
 	return log, nil
 }
+
+// GetAttempts 获取请求的重试历史
+func (s *RequestLogService) GetAttempts(id string) ([]model.RequestAttempt, error) {
+	return s.repo.GetAttempts(id)
+}
+
+// GetDashboardSummary 获取聚合仪表盘数据（userID 为空时统计全局）。
+// 范围内已被保留策略清理的部分由用量汇总表补足
+func (s *RequestLogService) GetDashboardSummary(params repository.DashboardSummaryParams) (*repository.DashboardSummary, error) {
+	summary, err := s.repo.GetDashboardSummary(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := mergePrunedRollups(summary, params); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+	"runtime"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var runtimeDebugState struct {
+	mu     sync.RWMutex
+	config model.RuntimeDebugConfig
+}
+
+// processStartedAt 进程启动时间，用于计算运行时长
+var processStartedAt = time.Now().UTC()
+
+// InitRuntimeDebugConfig 启动时从持久化配置加载运行时诊断开关
+func InitRuntimeDebugConfig(configJSON string) {
+	var cfg model.RuntimeDebugConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		log.Warnf("runtime debug: 解析配置失败，保持关闭: %v", err)
+		return
+	}
+	UpdateRuntimeDebugConfig(cfg)
+}
+
+// UpdateRuntimeDebugConfig 更新运行时诊断开关，立即生效
+func UpdateRuntimeDebugConfig(cfg model.RuntimeDebugConfig) {
+	runtimeDebugState.mu.Lock()
+	defer runtimeDebugState.mu.Unlock()
+	runtimeDebugState.config = cfg
+}
+
+// GetRuntimeDebugConfig 获取当前运行时诊断开关
+func GetRuntimeDebugConfig() model.RuntimeDebugConfig {
+	runtimeDebugState.mu.RLock()
+	defer runtimeDebugState.mu.RUnlock()
+	return runtimeDebugState.config
+}
+
+// RuntimeDebugEnabled 是否允许访问 pprof、运行时指标与 goroutine 堆栈
+func RuntimeDebugEnabled() bool {
+	return GetRuntimeDebugConfig().Enabled
+}
+
+// CollectRuntimeStats 采集当前的 goroutine、堆内存与 GC 指标（ReadMemStats 会短暂 STW，不宜高频调用）
+func CollectRuntimeStats() model.RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	now := time.Now().UTC()
+	stats := model.RuntimeStats{
+		GoVersion:  runtime.Version(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		StartedAt:  processStartedAt,
+		UptimeSec:  int64(now.Sub(processStartedAt).Seconds()),
+
+		HeapAllocBytes:    ms.HeapAlloc,
+		HeapInuseBytes:    ms.HeapInuse,
+		HeapIdleBytes:     ms.HeapIdle,
+		HeapReleasedBytes: ms.HeapReleased,
+		HeapObjects:       ms.HeapObjects,
+		StackInuseBytes:   ms.StackInuse,
+		SysBytes:          ms.Sys,
+
+		NumGC:         ms.NumGC,
+		NextGCBytes:   ms.NextGC,
+		PauseTotalNs:  ms.PauseTotalNs,
+		GCCPUFraction: ms.GCCPUFraction,
+	}
+	if ms.NumGC > 0 {
+		lastGC := time.Unix(0, int64(ms.LastGC)).UTC()
+		stats.LastGC = &lastGC
+		stats.LastPauseNs = ms.PauseNs[(ms.NumGC+255)%256]
+	}
+	return stats
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// scheduledChangeInterval 检查到期变更的间隔
+const scheduledChangeInterval = 30 * time.Second
+
+var (
+	ErrScheduledChangeNotFound   = errors.New("定时变更不存在")
+	ErrScheduledChangeNotPending = errors.New("只能取消尚未生效的定时变更")
+	ErrScheduledChangeInvalid    = errors.New("定时变更参数无效")
+)
+
+// 审计记录的目标类型与操作
+const (
+	auditTargetUserSettings = "user_settings"
+	auditTargetChannel      = "channel"
+
+	auditActionScheduledCreate = "scheduled_change.create"
+	auditActionScheduledCancel = "scheduled_change.cancel"
+	auditActionScheduledApply  = "scheduled_change.apply"
+	auditActionScheduledRevert = "scheduled_change.revert"
+	auditActionScheduledFail   = "scheduled_change.fail"
+)
+
+// ScheduledChangeService 管理定时生效的模型映射与渠道启停变更，用于计划内的上游维护或定时迁移
+type ScheduledChangeService struct {
+	repo         *repository.ScheduledChangeRepository
+	settingsRepo *repository.AmpSettingsRepository
+	channelRepo  *repository.ChannelRepository
+	userRepo     *repository.UserRepository
+}
+
+func NewScheduledChangeService() *ScheduledChangeService {
+	return &ScheduledChangeService{
+		repo:         repository.NewScheduledChangeRepository(),
+		settingsRepo: repository.NewAmpSettingsRepository(),
+		channelRepo:  repository.NewChannelRepository(),
+		userRepo:     repository.NewUserRepository(),
+	}
+}
+
+func (s *ScheduledChangeService) List(status string) ([]*model.ScheduledChange, error) {
+	return s.repo.List(status)
+}
+
+func (s *ScheduledChangeService) Get(id string) (*model.ScheduledChange, error) {
+	change, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if change == nil {
+		return nil, ErrScheduledChangeNotFound
+	}
+	return change, nil
+}
+
+// Create 创建定时变更，生效时间已过的变更在下一次检查时立即执行
+func (s *ScheduledChangeService) Create(actor string, req *model.ScheduledChangeRequest) (*model.ScheduledChange, error) {
+	if req.RevertAt != nil && !req.RevertAt.After(req.ApplyAt) {
+		return nil, fmt.Errorf("%w: 恢复时间必须晚于生效时间", ErrScheduledChangeInvalid)
+	}
+
+	payload := model.ScheduledChangePayload{}
+	switch req.Kind {
+	case model.ScheduledChangeModelMappings:
+		if err := validateScheduledMappings(req.Payload.ModelMappings); err != nil {
+			return nil, err
+		}
+		user, err := s.userRepo.GetByID(req.TargetID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, fmt.Errorf("%w: 用户不存在", ErrScheduledChangeInvalid)
+		}
+		payload.ModelMappings = req.Payload.ModelMappings
+	case model.ScheduledChangeChannelEnabled:
+		if req.Payload.Enabled == nil {
+			return nil, fmt.Errorf("%w: 缺少 payload.enabled", ErrScheduledChangeInvalid)
+		}
+		channel, err := s.channelRepo.GetByID(req.TargetID)
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			return nil, fmt.Errorf("%w: 渠道不存在", ErrScheduledChangeInvalid)
+		}
+		payload.Enabled = req.Payload.Enabled
+	}
+
+	applyAt := req.ApplyAt.UTC()
+	change := &model.ScheduledChange{
+		Kind:      req.Kind,
+		TargetID:  req.TargetID,
+		Payload:   payload,
+		Note:      strings.TrimSpace(req.Note),
+		ApplyAt:   applyAt,
+		CreatedBy: actor,
+	}
+	if req.RevertAt != nil {
+		revertAt := req.RevertAt.UTC()
+		change.RevertAt = &revertAt
+	}
+	if err := s.repo.Create(change); err != nil {
+		return nil, err
+	}
+	recordAudit(actor, auditActionScheduledCreate, scheduledChangeTargetType(change.Kind), change.TargetID, change)
+	notifyScheduledChangeRunner()
+	return change, nil
+}
+
+// Cancel 取消尚未生效的变更；已生效的变更不能取消，需另行创建变更恢复
+func (s *ScheduledChangeService) Cancel(actor, id string) error {
+	change, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	cancelled, err := s.repo.Cancel(id)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return ErrScheduledChangeNotPending
+	}
+	recordAudit(actor, auditActionScheduledCancel, scheduledChangeTargetType(change.Kind), change.TargetID, map[string]interface{}{"changeId": id})
+	return nil
+}
+
+// RunDue 执行到期的生效与恢复
+func (s *ScheduledChangeService) RunDue(now time.Time) {
+	changes, err := s.repo.ListDue(now)
+	if err != nil {
+		log.Errorf("scheduled change: 查询到期变更失败: %v", err)
+		return
+	}
+	for _, change := range changes {
+		switch change.Status {
+		case model.ScheduledChangePending:
+			s.apply(change, now)
+		case model.ScheduledChangeApplied:
+			s.revert(change, now)
+		}
+	}
+}
+
+func (s *ScheduledChangeService) apply(change *model.ScheduledChange, now time.Time) {
+	previous, err := s.write(change.Kind, change.TargetID, &change.Payload, nil)
+	if err != nil {
+		s.fail(change, model.ScheduledChangePending, "生效失败: "+err.Error())
+		return
+	}
+	if ok, err := s.repo.MarkApplied(change.ID, previous, now); err != nil || !ok {
+		log.Warnf("scheduled change: 变更 %s 已生效但更新状态失败: %v", change.ID, err)
+		return
+	}
+	log.Infof("scheduled change: %s %s 已生效", change.Kind, change.TargetID)
+	recordAudit(AuditActorScheduler, auditActionScheduledApply, scheduledChangeTargetType(change.Kind), change.TargetID, map[string]interface{}{
+		"changeId": change.ID, "previous": previous, "payload": change.Payload,
+	})
+}
+
+func (s *ScheduledChangeService) revert(change *model.ScheduledChange, now time.Time) {
+	if change.Previous == nil {
+		s.fail(change, model.ScheduledChangeApplied, "恢复失败: 缺少生效前的值")
+		return
+	}
+	// 生效期间被手动修改过的配置保持不动，避免覆盖管理员或用户的新设置
+	if _, err := s.write(change.Kind, change.TargetID, change.Previous, &change.Payload); err != nil {
+		s.fail(change, model.ScheduledChangeApplied, "恢复失败: "+err.Error())
+		return
+	}
+	if ok, err := s.repo.MarkReverted(change.ID, now); err != nil || !ok {
+		log.Warnf("scheduled change: 变更 %s 已恢复但更新状态失败: %v", change.ID, err)
+		return
+	}
+	log.Infof("scheduled change: %s %s 已恢复", change.Kind, change.TargetID)
+	recordAudit(AuditActorScheduler, auditActionScheduledRevert, scheduledChangeTargetType(change.Kind), change.TargetID, map[string]interface{}{
+		"changeId": change.ID, "restored": change.Previous,
+	})
+}
+
+func (s *ScheduledChangeService) fail(change *model.ScheduledChange, from model.ScheduledChangeStatus, reason string) {
+	log.Warnf("scheduled change: %s %s: %s", change.Kind, change.TargetID, reason)
+	if _, err := s.repo.MarkFailed(change.ID, from, reason); err != nil {
+		log.Errorf("scheduled change: 更新变更 %s 状态失败: %v", change.ID, err)
+	}
+	recordAudit(AuditActorScheduler, auditActionScheduledFail, scheduledChangeTargetType(change.Kind), change.TargetID, map[string]interface{}{
+		"changeId": change.ID, "error": reason,
+	})
+}
+
+// write 写入变更内容并返回写入前的值；expected 非空时要求当前值与其一致，否则不写入
+func (s *ScheduledChangeService) write(kind model.ScheduledChangeKind, targetID string, value, expected *model.ScheduledChangePayload) (*model.ScheduledChangePayload, error) {
+	switch kind {
+	case model.ScheduledChangeModelMappings:
+		settings, err := s.settingsRepo.GetByUserID(targetID)
+		if err != nil {
+			return nil, err
+		}
+		if settings == nil {
+			return nil, errors.New("用户未配置代理设置")
+		}
+		current := decodeModelMappings(settings.ModelMappingsJSON)
+		if expected != nil && !sameModelMappings(current, expected.ModelMappings) {
+			return nil, errors.New("模型映射在生效期间已被修改")
+		}
+		mappings := value.ModelMappings
+		if mappings == nil {
+			mappings = []model.ModelMapping{}
+		}
+		mappingsJSON, err := json.Marshal(mappings)
+		if err != nil {
+			return nil, err
+		}
+		settings.ModelMappingsJSON = string(mappingsJSON)
+		if err := s.settingsRepo.Upsert(settings); err != nil {
+			return nil, err
+		}
+		return &model.ScheduledChangePayload{ModelMappings: current}, nil
+	case model.ScheduledChangeChannelEnabled:
+		channel, err := s.channelRepo.GetByID(targetID)
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			return nil, ErrChannelNotFound
+		}
+		if value.Enabled == nil {
+			return nil, errors.New("缺少 enabled")
+		}
+		if expected != nil && expected.Enabled != nil && channel.Enabled != *expected.Enabled {
+			return nil, errors.New("渠道启用状态在生效期间已被修改")
+		}
+		if err := s.channelRepo.SetEnabled(targetID, *value.Enabled); err != nil {
+			return nil, err
+		}
+		enabled := channel.Enabled
+		return &model.ScheduledChangePayload{Enabled: &enabled}, nil
+	}
+	return nil, fmt.Errorf("未知的变更类型: %s", kind)
+}
+
+func sameModelMappings(a, b []model.ModelMapping) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func validateScheduledMappings(mappings []model.ModelMapping) error {
+	for i, m := range mappings {
+		if strings.TrimSpace(m.From) == "" {
+			return fmt.Errorf("%w: 第 %d 条映射缺少 from", ErrScheduledChangeInvalid, i+1)
+		}
+		if m.Regex {
+			if _, err := regexp.Compile("(?i)" + m.From); err != nil {
+				return fmt.Errorf("%w: 第 %d 条映射的正则无效: %v", ErrScheduledChangeInvalid, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func scheduledChangeTargetType(kind model.ScheduledChangeKind) string {
+	if kind == model.ScheduledChangeChannelEnabled {
+		return auditTargetChannel
+	}
+	return auditTargetUserSettings
+}
+
+// ScheduledChangeRunner 定期执行到期的定时变更
+type ScheduledChangeRunner struct {
+	service  *ScheduledChangeService
+	wakeChan chan struct{}
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+var globalScheduledChangeRunner *ScheduledChangeRunner
+
+// InitScheduledChangeRunner 启动全局定时变更执行任务
+func InitScheduledChangeRunner() {
+	globalScheduledChangeRunner = &ScheduledChangeRunner{
+		service:  NewScheduledChangeService(),
+		wakeChan: make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+	globalScheduledChangeRunner.wg.Add(1)
+	go globalScheduledChangeRunner.run()
+	log.Info("scheduled change: started")
+}
+
+// StopScheduledChangeRunner 停止全局定时变更执行任务
+func StopScheduledChangeRunner() {
+	if globalScheduledChangeRunner == nil {
+		return
+	}
+	globalScheduledChangeRunner.stopOnce.Do(func() { close(globalScheduledChangeRunner.stopChan) })
+	globalScheduledChangeRunner.wg.Wait()
+	log.Info("scheduled change: stopped")
+}
+
+// notifyScheduledChangeRunner 新建变更后立即检查一次，已到期的变更无需等待下一个周期
+func notifyScheduledChangeRunner() {
+	if globalScheduledChangeRunner == nil {
+		return
+	}
+	select {
+	case globalScheduledChangeRunner.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+func (r *ScheduledChangeRunner) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(scheduledChangeInterval)
+	defer ticker.Stop()
+
+	r.service.RunDue(time.Now().UTC())
+	for {
+		select {
+		case <-ticker.C:
+			r.service.RunDue(time.Now().UTC())
+		case <-r.wakeChan:
+			r.service.RunDue(time.Now().UTC())
+		case <-r.stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+)
+
+const maxSettingsTemplatePromptRunes = 20000
+
+var (
+	ErrSettingsTemplateNotFound       = errors.New("设置模板不存在")
+	ErrSettingsTemplateNameExists     = errors.New("设置模板名称已存在")
+	ErrSettingsTemplateKindChange     = errors.New("不能修改设置模板的类型")
+	ErrSettingsTemplateVersionMissing = errors.New("设置模板版本不存在")
+	ErrSettingsTemplateNotApplied     = errors.New("未应用该设置模板")
+	ErrSettingsTemplateInvalid        = errors.New("设置模板内容无效")
+)
+
+// SettingsTemplateService 管理员维护的设置模板库：系统提示词、模型映射集与思维等级预设。
+// 用户应用模板后记录所用版本，模板内容更新时同步给未锁定版本的用户
+type SettingsTemplateService struct {
+	repo         *repository.SettingsTemplateRepository
+	settingsRepo *repository.AmpSettingsRepository
+}
+
+func NewSettingsTemplateService() *SettingsTemplateService {
+	return &SettingsTemplateService{
+		repo:         repository.NewSettingsTemplateRepository(),
+		settingsRepo: repository.NewAmpSettingsRepository(),
+	}
+}
+
+func (s *SettingsTemplateService) List() ([]*model.SettingsTemplate, error) {
+	templates, err := s.repo.List()
+	if templates == nil {
+		templates = []*model.SettingsTemplate{}
+	}
+	return templates, err
+}
+
+func (s *SettingsTemplateService) Get(id string) (*model.SettingsTemplate, error) {
+	tpl, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if tpl == nil {
+		return nil, ErrSettingsTemplateNotFound
+	}
+	return tpl, nil
+}
+
+func (s *SettingsTemplateService) ListVersions(id string) ([]*model.SettingsTemplateVersion, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	versions, err := s.repo.ListVersions(id)
+	if versions == nil {
+		versions = []*model.SettingsTemplateVersion{}
+	}
+	return versions, err
+}
+
+func (s *SettingsTemplateService) Create(req *model.SettingsTemplateRequest) (*model.SettingsTemplate, error) {
+	content, err := normalizeSettingsTemplateContent(req.Kind, req.Content)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	exists, err := s.repo.ExistsByName(name, "")
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrSettingsTemplateNameExists
+	}
+
+	tpl := &model.SettingsTemplate{
+		Name:        name,
+		Description: strings.TrimSpace(req.Description),
+		Kind:        req.Kind,
+		Content:     content,
+	}
+	if err := s.repo.Create(tpl); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// Update 更新模板。内容变化时生成新版本，并同步给应用了该模板且未锁定版本的用户
+func (s *SettingsTemplateService) Update(id string, req *model.SettingsTemplateRequest) (*model.SettingsTemplateUpdateResult, error) {
+	tpl, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Kind != tpl.Kind {
+		return nil, ErrSettingsTemplateKindChange
+	}
+	content, err := normalizeSettingsTemplateContent(req.Kind, req.Content)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	exists, err := s.repo.ExistsByName(name, id)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrSettingsTemplateNameExists
+	}
+
+	contentChanged := !reflect.DeepEqual(tpl.Content, content)
+	tpl.Name = name
+	tpl.Description = strings.TrimSpace(req.Description)
+	tpl.Content = content
+	if err := s.repo.Update(tpl, contentChanged); err != nil {
+		return nil, err
+	}
+
+	result := &model.SettingsTemplateUpdateResult{Template: tpl, Failed: []string{}}
+	if !contentChanged {
+		return result, nil
+	}
+
+	bindings, err := s.repo.ListBindingsByTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range bindings {
+		if binding.Pinned {
+			result.Pinned++
+			continue
+		}
+		if err := s.applyVersion(binding.UserID, tpl, binding, tpl.Version, false); err != nil {
+			result.Failed = append(result.Failed, binding.UserID)
+			continue
+		}
+		result.Propagated++
+	}
+	return result, nil
+}
+
+// Delete 删除模板，已应用到用户设置中的内容保留
+func (s *SettingsTemplateService) Delete(id string) error {
+	deleted, err := s.repo.Delete(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrSettingsTemplateNotFound
+	}
+	return nil
+}
+
+// ListForUser 列出全部模板及当前用户的应用状态
+func (s *SettingsTemplateService) ListForUser(userID string) ([]*model.SettingsTemplateForUser, error) {
+	templates, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := s.repo.ListBindingsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	byTemplate := make(map[string]*model.UserSettingsTemplate, len(bindings))
+	for _, b := range bindings {
+		byTemplate[b.TemplateID] = b
+	}
+
+	result := make([]*model.SettingsTemplateForUser, 0, len(templates))
+	for _, tpl := range templates {
+		result = append(result, &model.SettingsTemplateForUser{SettingsTemplate: *tpl, Applied: byTemplate[tpl.ID]})
+	}
+	return result, nil
+}
+
+// Apply 将模板的指定版本（默认最新）应用到用户设置。已应用过的模板先撤下旧版本写入的内容再写入新版本
+func (s *SettingsTemplateService) Apply(userID, templateID string, req *model.ApplySettingsTemplateRequest) (*model.AmpSettingsResponse, error) {
+	tpl, err := s.Get(templateID)
+	if err != nil {
+		return nil, err
+	}
+	version := req.Version
+	if version <= 0 {
+		version = tpl.Version
+	}
+	binding, err := s.repo.GetBinding(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyVersion(userID, tpl, binding, version, req.Pinned); err != nil {
+		return nil, err
+	}
+	settings, err := s.settingsRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return buildAmpSettingsResponse(settings), nil
+}
+
+// Detach 取消应用模板：不再同步模板更新，已写入用户设置的内容保留
+func (s *SettingsTemplateService) Detach(userID, templateID string) error {
+	deleted, err := s.repo.DeleteBinding(userID, templateID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrSettingsTemplateNotApplied
+	}
+	return nil
+}
+
+// applyVersion 将模板版本写入用户设置并记录应用的版本，previous 为用户当前应用的记录（可为空）
+func (s *SettingsTemplateService) applyVersion(userID string, tpl *model.SettingsTemplate, previous *model.UserSettingsTemplate, version int, pinned bool) error {
+	target, err := s.repo.GetVersion(tpl.ID, version)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return ErrSettingsTemplateVersionMissing
+	}
+	var previousContent *model.SettingsTemplateContent
+	if previous != nil {
+		prev, err := s.repo.GetVersion(tpl.ID, previous.Version)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			previousContent = &prev.Content
+		}
+	}
+
+	settings, err := s.settingsRepo.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		settings = &model.AmpSettings{
+			UserID:        userID,
+			UpstreamURL:   "https://ampcode.com",
+			WebSearchMode: model.WebSearchModeUpstream,
+		}
+	}
+
+	switch tpl.Kind {
+	case model.SettingsTemplateSystemPrompt:
+		settings.SystemPrompt = target.Content.SystemPrompt
+	default:
+		var previousMappings []model.ModelMapping
+		if previousContent != nil {
+			previousMappings = previousContent.ModelMappings
+		}
+		mappings := mergeTemplateMappings(decodeModelMappings(settings.ModelMappingsJSON), previousMappings, target.Content.ModelMappings)
+		mappingsJSON, err := json.Marshal(mappings)
+		if err != nil {
+			return err
+		}
+		settings.ModelMappingsJSON = string(mappingsJSON)
+	}
+
+	if err := s.settingsRepo.Upsert(settings); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return ErrSettingsConflict
+		}
+		return err
+	}
+	return s.repo.UpsertBinding(&model.UserSettingsTemplate{
+		UserID:     userID,
+		TemplateID: tpl.ID,
+		Version:    version,
+		Pinned:     pinned,
+	})
+}
+
+// mergeTemplateMappings 移除旧版本模板写入且未被用户修改过的映射，再把新版本的映射追加到末尾。
+// 映射按顺序匹配，用户自己的映射优先于模板
+func mergeTemplateMappings(current, previous, next []model.ModelMapping) []model.ModelMapping {
+	owned := func(m model.ModelMapping) bool {
+		for _, p := range previous {
+			if reflect.DeepEqual(m, p) {
+				return true
+			}
+		}
+		for _, n := range next {
+			if reflect.DeepEqual(m, n) {
+				return true
+			}
+		}
+		return false
+	}
+
+	merged := make([]model.ModelMapping, 0, len(current)+len(next))
+	for _, m := range current {
+		if !owned(m) {
+			merged = append(merged, m)
+		}
+	}
+	return append(merged, next...)
+}
+
+// normalizeSettingsTemplateContent 按模板类型校验内容并清除无关字段
+func normalizeSettingsTemplateContent(kind model.SettingsTemplateKind, content model.SettingsTemplateContent) (model.SettingsTemplateContent, error) {
+	switch kind {
+	case model.SettingsTemplateSystemPrompt:
+		prompt := strings.TrimSpace(content.SystemPrompt)
+		if prompt == "" {
+			return content, invalidSettingsTemplate("系统提示词不能为空")
+		}
+		if utf8.RuneCountInString(prompt) > maxSettingsTemplatePromptRunes {
+			return content, invalidSettingsTemplate("系统提示词不能超过 %d 个字符", maxSettingsTemplatePromptRunes)
+		}
+		return model.SettingsTemplateContent{SystemPrompt: prompt}, nil
+	case model.SettingsTemplateModelMappings, model.SettingsTemplateThinkingPreset:
+		if len(content.ModelMappings) == 0 {
+			return content, invalidSettingsTemplate("模型映射不能为空")
+		}
+		mappings := make([]model.ModelMapping, 0, len(content.ModelMappings))
+		for i, m := range content.ModelMappings {
+			m.From = strings.TrimSpace(m.From)
+			m.To = strings.TrimSpace(m.To)
+			m.ThinkingLevel = strings.TrimSpace(m.ThinkingLevel)
+			if m.From == "" {
+				return content, invalidSettingsTemplate("第 %d 条映射缺少 from", i+1)
+			}
+			if m.Regex {
+				if _, err := regexp.Compile("(?i)" + m.From); err != nil {
+					return content, invalidSettingsTemplate("第 %d 条映射的正则无效: %v", i+1, err)
+				}
+			}
+			if kind == model.SettingsTemplateThinkingPreset {
+				// 思维等级预设只设置思维等级，不改写模型
+				if m.ThinkingLevel == "" {
+					return content, invalidSettingsTemplate("第 %d 条预设缺少 thinkingLevel", i+1)
+				}
+				m = model.ModelMapping{From: m.From, Regex: m.Regex, ThinkingLevel: m.ThinkingLevel}
+			} else if m.To == "" {
+				return content, invalidSettingsTemplate("第 %d 条映射缺少 to", i+1)
+			}
+			mappings = append(mappings, m)
+		}
+		return model.SettingsTemplateContent{ModelMappings: mappings}, nil
+	}
+	return content, invalidSettingsTemplate("未知的模板类型: %s", kind)
+}
+
+func invalidSettingsTemplate(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrSettingsTemplateInvalid}, args...)...)
+}
@@ -15,6 +15,8 @@ var (
 	ErrPlanHasActiveSubs   = errors.New("该套餐下存在活跃订阅，无法删除")
 	ErrPlanNotFound        = errors.New("套餐不存在")
 	ErrDuplicateLimitType  = errors.New("同一限制类型不能重复")
+	ErrPlanConflict        = errors.New("套餐已被其他管理员修改，请刷新后重试")
+	ErrInvalidResetHour    = errors.New("重置时间必须为 0-23 点")
 )
 
 type SubscriptionPlanService struct {
@@ -66,6 +68,21 @@ func (s *SubscriptionPlanService) validateLimits(limits []model.PlanLimitRequest
 	return nil
 }
 
+// normalizeResetBoundary 校验套餐的重置时区与整点，返回规范化的时区名称，未设置时为空（使用订阅用户的报表时区）
+func normalizeResetBoundary(req *model.SubscriptionPlanRequest) (string, error) {
+	if req.ResetHour < 0 || req.ResetHour > 23 {
+		return "", ErrInvalidResetHour
+	}
+	if req.ResetTimezone == "" {
+		return "", nil
+	}
+	loc, err := ParseTimezone(req.ResetTimezone)
+	if err != nil {
+		return "", err
+	}
+	return loc.String(), nil
+}
+
 func (s *SubscriptionPlanService) Create(req *model.SubscriptionPlanRequest) (*model.SubscriptionPlanResponse, error) {
 	if req.Name == "" {
 		return nil, ErrPlanNameRequired
@@ -73,11 +90,17 @@ func (s *SubscriptionPlanService) Create(req *model.SubscriptionPlanRequest) (*m
 	if err := s.validateLimits(req.Limits); err != nil {
 		return nil, err
 	}
+	resetTimezone, err := normalizeResetBoundary(req)
+	if err != nil {
+		return nil, err
+	}
 
 	plan := &model.SubscriptionPlan{
-		Name:        req.Name,
-		Description: req.Description,
-		Enabled:     req.Enabled,
+		Name:          req.Name,
+		Description:   req.Description,
+		Enabled:       req.Enabled,
+		ResetTimezone: resetTimezone,
+		ResetHour:     req.ResetHour,
 	}
 
 	limits := make([]model.SubscriptionPlanLimit, len(req.Limits))
@@ -93,15 +116,7 @@ func (s *SubscriptionPlanService) Create(req *model.SubscriptionPlanRequest) (*m
 		return nil, err
 	}
 
-	return &model.SubscriptionPlanResponse{
-		ID:          plan.ID,
-		Name:        plan.Name,
-		Description: plan.Description,
-		Enabled:     plan.Enabled,
-		Limits:      limits,
-		CreatedAt:   plan.CreatedAt,
-		UpdatedAt:   plan.UpdatedAt,
-	}, nil
+	return planResponse(plan, limits), nil
 }
 
 func (s *SubscriptionPlanService) GetByID(id string) (*model.SubscriptionPlanResponse, error) {
@@ -113,15 +128,22 @@ func (s *SubscriptionPlanService) GetByID(id string) (*model.SubscriptionPlanRes
 		return nil, ErrPlanNotFound
 	}
 
+	return planResponse(plan, limits), nil
+}
+
+func planResponse(plan *model.SubscriptionPlan, limits []model.SubscriptionPlanLimit) *model.SubscriptionPlanResponse {
 	return &model.SubscriptionPlanResponse{
-		ID:          plan.ID,
-		Name:        plan.Name,
-		Description: plan.Description,
-		Enabled:     plan.Enabled,
-		Limits:      limits,
-		CreatedAt:   plan.CreatedAt,
-		UpdatedAt:   plan.UpdatedAt,
-	}, nil
+		ID:            plan.ID,
+		Name:          plan.Name,
+		Description:   plan.Description,
+		Enabled:       plan.Enabled,
+		Limits:        limits,
+		ResetTimezone: plan.ResetTimezone,
+		ResetHour:     plan.ResetHour,
+		Version:       plan.Version,
+		CreatedAt:     plan.CreatedAt,
+		UpdatedAt:     plan.UpdatedAt,
+	}
 }
 
 func (s *SubscriptionPlanService) List() ([]*model.SubscriptionPlanResponse, error) {
@@ -132,15 +154,7 @@ func (s *SubscriptionPlanService) List() ([]*model.SubscriptionPlanResponse, err
 
 	result := make([]*model.SubscriptionPlanResponse, len(plans))
 	for i, p := range plans {
-		result[i] = &model.SubscriptionPlanResponse{
-			ID:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Enabled:     p.Enabled,
-			Limits:      limitsMap[p.ID],
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
-		}
+		result[i] = planResponse(p, limitsMap[p.ID])
 	}
 	return result, nil
 }
@@ -152,6 +166,10 @@ func (s *SubscriptionPlanService) Update(id string, req *model.SubscriptionPlanR
 	if err := s.validateLimits(req.Limits); err != nil {
 		return nil, err
 	}
+	resetTimezone, err := normalizeResetBoundary(req)
+	if err != nil {
+		return nil, err
+	}
 
 	existing, _, err := s.planRepo.GetByID(id)
 	if err != nil {
@@ -162,9 +180,15 @@ func (s *SubscriptionPlanService) Update(id string, req *model.SubscriptionPlanR
 	}
 
 	plan := &model.SubscriptionPlan{
-		Name:        req.Name,
-		Description: req.Description,
-		Enabled:     req.Enabled,
+		Name:          req.Name,
+		Description:   req.Description,
+		Enabled:       req.Enabled,
+		ResetTimezone: resetTimezone,
+		ResetHour:     req.ResetHour,
+		Version:       existing.Version,
+	}
+	if req.Version != 0 {
+		plan.Version = req.Version
 	}
 
 	limits := make([]model.SubscriptionPlanLimit, len(req.Limits))
@@ -177,6 +201,9 @@ func (s *SubscriptionPlanService) Update(id string, req *model.SubscriptionPlanR
 	}
 
 	if err := s.planRepo.Update(id, plan, limits); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return nil, ErrPlanConflict
+		}
 		return nil, err
 	}
 
@@ -5,10 +5,41 @@ import (
 )
 
 const (
-	retryConfigKey          = "retry_config"
-	requestDetailEnabledKey = "request_detail_enabled"
-	timeoutConfigKey        = "timeout_config"
-	cacheTTLOverrideKey     = "cache_ttl_override"
+	retryConfigKey           = "retry_config"
+	requestDetailEnabledKey  = "request_detail_enabled"
+	timeoutConfigKey         = "timeout_config"
+	cacheTTLOverrideKey      = "cache_ttl_override"
+	pendingCleanerConfigKey  = "pending_cleaner_config"
+	responseValidationKey    = "response_validation_enabled"
+	httpPolicyConfigKey      = "http_policy"
+	maintenanceConfigKey     = "maintenance_config"
+	responseHeaderConfigKey  = "response_header_config"
+	billingShadowConfigKey   = "billing_shadow_mode"
+	billingAuditConfigKey    = "billing_audit_config"
+	channelHealthConfigKey   = "channel_health_config"
+	channelKeyCheckConfigKey = "channel_key_check_config"
+	channelFailoverConfigKey = "channel_failover_config"
+	channelStickyConfigKey   = "channel_sticky_config"
+	channelCapacityConfigKey = "channel_capacity_config"
+	toolLoopConfigKey        = "tool_loop_config"
+	outputFilterConfigKey    = "output_filter_config"
+	translationConfigKey     = "translation_config"
+	requestLogPolicyKey      = "request_log_policy"
+	federationConfigKey      = "federation_config"
+	modelSyncConfigKey       = "model_sync_config"
+	quotaEnforcementKey      = "quota_enforcement_config"
+	logRetentionConfigKey    = "log_retention_config"
+	concurrencyLimitKey      = "concurrency_limit_config"
+	passwordPolicyConfigKey  = "password_policy_config"
+	streamFlushConfigKey     = "stream_flush_config"
+	oidcConfigKey            = "oidc_config"
+	memoryGuardConfigKey     = "memory_guard_config"
+	runtimeDebugConfigKey    = "runtime_debug_config"
+	detailRedactionConfigKey = "detail_redaction_config"
+	piiRedactionConfigKey    = "pii_redaction_config"
+	accessLogConfigKey       = "access_log_config"
+	groupBudgetConfigKey     = "group_budget_alert_config"
+	newUserDefaultsConfigKey = "new_user_defaults_config"
 )
 
 type SystemConfigService struct {
@@ -58,3 +89,162 @@ func (s *SystemConfigService) GetTimeoutConfigJSON() (string, error) {
 func (s *SystemConfigService) GetCacheTTLOverride() (string, error) {
 	return s.repo.Get(cacheTTLOverrideKey)
 }
+
+// GetPendingCleanerConfigJSON 获取 pending 清理配置的 JSON 字符串
+func (s *SystemConfigService) GetPendingCleanerConfigJSON() (string, error) {
+	return s.repo.Get(pendingCleanerConfigKey)
+}
+
+// GetLogRetentionConfigJSON 获取请求日志保留策略的 JSON 字符串
+func (s *SystemConfigService) GetLogRetentionConfigJSON() (string, error) {
+	return s.repo.Get(logRetentionConfigKey)
+}
+
+// GetResponseValidationEnabled 获取上游响应结构校验是否启用（默认关闭）
+func (s *SystemConfigService) GetResponseValidationEnabled() (bool, error) {
+	value, err := s.repo.Get(responseValidationKey)
+	if err != nil {
+		return false, err
+	}
+	return value == "true", nil
+}
+
+// GetHTTPPolicyJSON 获取 CORS 与嵌入策略的 JSON 字符串
+func (s *SystemConfigService) GetHTTPPolicyJSON() (string, error) {
+	return s.repo.Get(httpPolicyConfigKey)
+}
+
+// GetMaintenanceConfigJSON 获取维护模式配置的 JSON 字符串
+func (s *SystemConfigService) GetMaintenanceConfigJSON() (string, error) {
+	return s.repo.Get(maintenanceConfigKey)
+}
+
+// GetResponseHeaderConfigJSON 获取上游响应头策略的 JSON 字符串
+func (s *SystemConfigService) GetResponseHeaderConfigJSON() (string, error) {
+	return s.repo.Get(responseHeaderConfigKey)
+}
+
+// GetBillingShadowConfigJSON 获取计费影子模式配置的 JSON 字符串
+func (s *SystemConfigService) GetBillingShadowConfigJSON() (string, error) {
+	return s.repo.Get(billingShadowConfigKey)
+}
+
+// GetBillingAuditConfigJSON 获取计费一致性检查配置的 JSON 字符串
+func (s *SystemConfigService) GetBillingAuditConfigJSON() (string, error) {
+	return s.repo.Get(billingAuditConfigKey)
+}
+
+// GetChannelHealthConfigJSON 获取渠道健康检查配置的 JSON 字符串
+func (s *SystemConfigService) GetChannelHealthConfigJSON() (string, error) {
+	return s.repo.Get(channelHealthConfigKey)
+}
+
+// GetChannelKeyCheckConfigJSON 获取渠道密钥有效性检查配置的 JSON 字符串
+func (s *SystemConfigService) GetChannelKeyCheckConfigJSON() (string, error) {
+	return s.repo.Get(channelKeyCheckConfigKey)
+}
+
+// GetToolLoopConfigJSON 获取工具调用循环检测配置的 JSON 字符串
+func (s *SystemConfigService) GetToolLoopConfigJSON() (string, error) {
+	return s.repo.Get(toolLoopConfigKey)
+}
+
+// GetRequestLogPolicyJSON 获取请求日志策略的 JSON 字符串
+func (s *SystemConfigService) GetRequestLogPolicyJSON() (string, error) {
+	return s.repo.Get(requestLogPolicyKey)
+}
+
+// GetOutputFilterConfigJSON 获取输出过滤配置的 JSON 字符串
+func (s *SystemConfigService) GetOutputFilterConfigJSON() (string, error) {
+	return s.repo.Get(outputFilterConfigKey)
+}
+
+// GetChannelFailoverConfigJSON 获取渠道故障转移配置的 JSON 字符串
+func (s *SystemConfigService) GetChannelFailoverConfigJSON() (string, error) {
+	return s.repo.Get(channelFailoverConfigKey)
+}
+
+// GetChannelStickyConfigJSON 获取会话粘性配置的 JSON 字符串
+func (s *SystemConfigService) GetChannelStickyConfigJSON() (string, error) {
+	return s.repo.Get(channelStickyConfigKey)
+}
+
+// GetConcurrencyLimitConfigJSON 获取并发上限处理策略的 JSON 字符串
+func (s *SystemConfigService) GetConcurrencyLimitConfigJSON() (string, error) {
+	return s.repo.Get(concurrencyLimitKey)
+}
+
+// GetStreamFlushConfigJSON 获取流式刷新合并配置的 JSON 字符串
+func (s *SystemConfigService) GetStreamFlushConfigJSON() (string, error) {
+	return s.repo.Get(streamFlushConfigKey)
+}
+
+// GetMemoryGuardConfigJSON 获取内存保护配置的 JSON 字符串
+func (s *SystemConfigService) GetMemoryGuardConfigJSON() (string, error) {
+	return s.repo.Get(memoryGuardConfigKey)
+}
+
+// GetRuntimeDebugConfigJSON 获取运行时诊断开关的 JSON 字符串
+func (s *SystemConfigService) GetRuntimeDebugConfigJSON() (string, error) {
+	return s.repo.Get(runtimeDebugConfigKey)
+}
+
+// GetDetailRedactionConfigJSON 获取请求详情脱敏配置的 JSON 字符串
+func (s *SystemConfigService) GetDetailRedactionConfigJSON() (string, error) {
+	return s.repo.Get(detailRedactionConfigKey)
+}
+
+// GetPIIRedactionConfigJSON 获取转发前脱敏配置的 JSON 字符串
+func (s *SystemConfigService) GetPIIRedactionConfigJSON() (string, error) {
+	return s.repo.Get(piiRedactionConfigKey)
+}
+
+// GetGroupBudgetAlertConfigJSON 获取分组预算告警配置的 JSON 字符串
+func (s *SystemConfigService) GetGroupBudgetAlertConfigJSON() (string, error) {
+	return s.repo.Get(groupBudgetConfigKey)
+}
+
+// GetNewUserDefaultsConfigJSON 获取新用户默认配置的 JSON 字符串
+func (s *SystemConfigService) GetNewUserDefaultsConfigJSON() (string, error) {
+	return s.repo.Get(newUserDefaultsConfigKey)
+}
+
+// GetAccessLogConfigJSON 获取 HTTP 访问日志配置的 JSON 字符串
+func (s *SystemConfigService) GetAccessLogConfigJSON() (string, error) {
+	return s.repo.Get(accessLogConfigKey)
+}
+
+// GetTranslationConfigJSON 获取跨格式翻译配置的 JSON 字符串
+func (s *SystemConfigService) GetTranslationConfigJSON() (string, error) {
+	return s.repo.Get(translationConfigKey)
+}
+
+// GetChannelCapacityConfigJSON 获取渠道容量建议配置的 JSON 字符串
+func (s *SystemConfigService) GetChannelCapacityConfigJSON() (string, error) {
+	return s.repo.Get(channelCapacityConfigKey)
+}
+
+// GetQuotaEnforcementConfigJSON 获取额度预检配置的 JSON 字符串
+func (s *SystemConfigService) GetQuotaEnforcementConfigJSON() (string, error) {
+	return s.repo.Get(quotaEnforcementKey)
+}
+
+// GetModelSyncConfigJSON 获取上游模型自动同步配置的 JSON 字符串
+func (s *SystemConfigService) GetModelSyncConfigJSON() (string, error) {
+	return s.repo.Get(modelSyncConfigKey)
+}
+
+// GetFederationConfigJSON 获取联邦配置的 JSON 字符串
+func (s *SystemConfigService) GetFederationConfigJSON() (string, error) {
+	return s.repo.Get(federationConfigKey)
+}
+
+// GetOIDCConfigJSON 获取 SSO 登录配置的 JSON 字符串
+func (s *SystemConfigService) GetOIDCConfigJSON() (string, error) {
+	return s.repo.Get(oidcConfigKey)
+}
+
+// GetPasswordPolicyConfigJSON 获取密码策略的 JSON 字符串
+func (s *SystemConfigService) GetPasswordPolicyConfigJSON() (string, error) {
+	return s.repo.Get(passwordPolicyConfigKey)
+}
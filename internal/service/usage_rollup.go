@@ -0,0 +1,247 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// usageRollupWatermarkKey 已汇总到的时间（RFC3339），首次运行前为空
+const usageRollupWatermarkKey = "usage_rollup_watermark"
+
+const (
+	// usageRollupInterval 汇总任务的执行间隔
+	usageRollupInterval = 5 * time.Minute
+	// usageRollupLookback 每次从水位线往前重新汇总的时长，覆盖汇总时仍为 pending 的请求
+	usageRollupLookback = 2 * time.Hour
+	// usageRollupChunk 回填历史数据时每个事务处理的时长
+	usageRollupChunk = 7 * 24 * time.Hour
+	// usageRollupHourRetention 小时桶的保留时长，更早的数据只保留天桶
+	usageRollupHourRetention = 90 * 24 * time.Hour
+)
+
+const (
+	// usageTrendMaxRange 趋势查询的最大时间范围
+	usageTrendMaxRange = 366 * 24 * time.Hour
+	// usageTrendMaxHourRange 小时粒度的最大时间范围
+	usageTrendMaxHourRange = 31 * 24 * time.Hour
+	// usageTrendAutoHourRange auto 粒度下不超过该范围时使用小时桶
+	usageTrendAutoHourRange = 7 * 24 * time.Hour
+)
+
+// ErrInvalidUsageTrend 趋势查询参数无效
+var ErrInvalidUsageTrend = errors.New("趋势查询参数无效")
+
+type UsageRollupService struct {
+	repo       *repository.UsageRollupRepository
+	configRepo *repository.SystemConfigRepository
+}
+
+func NewUsageRollupService() *UsageRollupService {
+	return &UsageRollupService{
+		repo:       repository.NewUsageRollupRepository(),
+		configRepo: repository.NewSystemConfigRepository(),
+	}
+}
+
+// Watermark 返回已汇总到的时间，尚未汇总过时返回 nil
+func (s *UsageRollupService) Watermark() (*time.Time, error) {
+	value, err := s.configRepo.Get(usageRollupWatermarkKey)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+// RunOnce 从水位线往前 usageRollupLookback 开始汇总到 now，首次运行时从最早的请求日志开始分段回填。
+// stop 关闭时在分段之间退出，已完成的分段会推进水位线，下次从中断处继续
+func (s *UsageRollupService) RunOnce(now time.Time, stop <-chan struct{}) error {
+	now = now.UTC()
+	wm, err := s.Watermark()
+	if err != nil {
+		return err
+	}
+
+	var start time.Time
+	if wm != nil {
+		start = wm.Add(-usageRollupLookback)
+	} else {
+		earliest, err := s.repo.EarliestRequestTime()
+		if err != nil {
+			return err
+		}
+		if earliest == nil {
+			return s.configRepo.Set(usageRollupWatermarkKey, now.Format(time.RFC3339))
+		}
+		start = *earliest
+		log.Infof("usage rollup: backfilling from %s", start.Format(time.RFC3339))
+	}
+
+	for start.Before(now) {
+		end := start.Add(usageRollupChunk)
+		if end.After(now) {
+			end = now
+		}
+		if err := s.repo.Rebuild(start, end); err != nil {
+			return fmt.Errorf("rebuild %s - %s: %w", start.Format(time.RFC3339), end.Format(time.RFC3339), err)
+		}
+		if err := s.configRepo.Set(usageRollupWatermarkKey, end.Format(time.RFC3339)); err != nil {
+			return err
+		}
+		start = end
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+	}
+
+	if pruned, err := s.repo.PruneHours(now.Add(-usageRollupHourRetention)); err != nil {
+		log.Warnf("usage rollup: prune hour buckets failed: %v", err)
+	} else if pruned > 0 {
+		log.Debugf("usage rollup: pruned %d hour buckets", pruned)
+	}
+	return nil
+}
+
+// GetUsageTrend 返回 [from, to] 内按时间桶汇总的请求数、错误数、token 与费用，userID 为空时汇总所有用户。
+// resolution 为空或 auto 时不超过 7 天使用小时桶，否则使用天桶；没有请求的桶补 0
+func (s *UsageRollupService) GetUsageTrend(userID string, from, to time.Time, resolution string) (*model.UsageTrend, error) {
+	from, to = from.UTC(), to.UTC()
+	span := to.Sub(from)
+	if span > usageTrendMaxRange {
+		return nil, fmt.Errorf("%w: 时间范围不能超过 366 天", ErrInvalidUsageTrend)
+	}
+
+	now := time.Now().UTC()
+	switch resolution {
+	case "", model.UsageTrendResolutionAuto:
+		resolution = model.UsageTrendResolutionDay
+		if span <= usageTrendAutoHourRange && from.After(now.Add(-usageRollupHourRetention)) {
+			resolution = model.UsageTrendResolutionHour
+		}
+	case model.UsageTrendResolutionHour:
+		if span > usageTrendMaxHourRange {
+			return nil, fmt.Errorf("%w: 小时粒度的时间范围不能超过 31 天", ErrInvalidUsageTrend)
+		}
+		if from.Before(now.Add(-usageRollupHourRetention)) {
+			return nil, fmt.Errorf("%w: 小时粒度只保留最近 90 天的数据", ErrInvalidUsageTrend)
+		}
+	case model.UsageTrendResolutionDay:
+	default:
+		return nil, fmt.Errorf("%w: resolution 必须为 auto、hour 或 day", ErrInvalidUsageTrend)
+	}
+
+	var first, last time.Time
+	var step func(time.Time) time.Time
+	var layout, bucketResolution string
+	if resolution == model.UsageTrendResolutionHour {
+		first, last = from.Truncate(time.Hour), to.Truncate(time.Hour)
+		step = func(t time.Time) time.Time { return t.Add(time.Hour) }
+		layout, bucketResolution = repository.UsageRollupHourLayout, repository.UsageRollupHour
+	} else {
+		first = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+		last = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+		layout, bucketResolution = repository.UsageRollupDayLayout, repository.UsageRollupDay
+	}
+
+	rows, err := s.repo.Series(bucketResolution, first.Format(layout), step(last).Format(layout), userID)
+	if err != nil {
+		return nil, err
+	}
+	byBucket := make(map[string]repository.UsageRollupPoint, len(rows))
+	for _, row := range rows {
+		byBucket[row.Bucket] = row
+	}
+
+	points := make([]model.UsageTrendPoint, 0)
+	for t := first; !t.After(last); t = step(t) {
+		row := byBucket[t.Format(layout)]
+		points = append(points, model.UsageTrendPoint{
+			Time:            t,
+			Requests:        row.Requests,
+			Errors:          row.Errors,
+			InputTokens:     row.InputTokens,
+			OutputTokens:    row.OutputTokens,
+			CacheReadTokens: row.CacheReadTokens,
+			CostMicros:      row.CostMicros,
+			CostUsd:         fmt.Sprintf("%.6f", float64(row.CostMicros)/1e6),
+		})
+	}
+
+	wm, err := s.Watermark()
+	if err != nil {
+		return nil, err
+	}
+	return &model.UsageTrend{
+		From:       from,
+		To:         to,
+		Resolution: resolution,
+		RolledUpAt: wm,
+		Points:     points,
+	}, nil
+}
+
+// UsageRollupRunner 定期把请求日志汇总到 usage_rollups
+type UsageRollupRunner struct {
+	service  *UsageRollupService
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+var globalUsageRollupRunner *UsageRollupRunner
+
+// InitUsageRollupRunner 启动全局用量汇总任务
+func InitUsageRollupRunner() {
+	globalUsageRollupRunner = &UsageRollupRunner{
+		service:  NewUsageRollupService(),
+		stopChan: make(chan struct{}),
+	}
+	globalUsageRollupRunner.wg.Add(1)
+	go globalUsageRollupRunner.run()
+	log.Info("usage rollup: started")
+}
+
+// StopUsageRollupRunner 停止全局用量汇总任务
+func StopUsageRollupRunner() {
+	if globalUsageRollupRunner == nil {
+		return
+	}
+	globalUsageRollupRunner.stopOnce.Do(func() { close(globalUsageRollupRunner.stopChan) })
+	globalUsageRollupRunner.wg.Wait()
+	log.Info("usage rollup: stopped")
+}
+
+func (r *UsageRollupRunner) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(usageRollupInterval)
+	defer ticker.Stop()
+
+	r.runOnce()
+	for {
+		select {
+		case <-ticker.C:
+			r.runOnce()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+func (r *UsageRollupRunner) runOnce() {
+	if err := r.service.RunOnce(time.Now(), r.stopChan); err != nil {
+		log.Errorf("usage rollup: %v", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"ampmanager/internal/config"
 	"ampmanager/internal/model"
@@ -34,6 +36,9 @@ func NewUserService() *UserService {
 }
 
 func (s *UserService) Register(req *model.RegisterRequest) (*model.User, error) {
+	if !GetOIDCLoginOptions().PasswordLoginEnabled {
+		return nil, ErrPasswordLoginDisabled
+	}
 	exists, err := s.repo.ExistsByUsername(req.Username)
 	if err != nil {
 		return nil, err
@@ -41,26 +46,34 @@ func (s *UserService) Register(req *model.RegisterRequest) (*model.User, error)
 	if exists {
 		return nil, ErrUsernameExists
 	}
+	if err := ValidatePassword(req.Password, req.Username); err != nil {
+		return nil, err
+	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := HashPassword(req.Password)
 	if err != nil {
 		return nil, err
 	}
 
 	user := &model.User{
 		Username:     req.Username,
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
 		IsAdmin:      false,
+		Email:        normalizeEmail(req.Email),
 	}
 
 	if err := s.repo.Create(user); err != nil {
 		return nil, err
 	}
+	ApplyNewUserDefaults(user, NewUserSourceRegister, false)
 
 	return user, nil
 }
 
 func (s *UserService) Login(req *model.LoginRequest) (*model.User, string, error) {
+	if !PasswordLoginAllowed(req.Username) {
+		return nil, "", ErrPasswordLoginDisabled
+	}
 	user, err := s.repo.GetByUsername(req.Username)
 	if err != nil {
 		return nil, "", err
@@ -72,6 +85,17 @@ func (s *UserService) Login(req *model.LoginRequest) (*model.User, string, error
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		return nil, "", ErrInvalidCredentials
 	}
+	if suspension := ActiveSuspension(user.ID); suspension != nil {
+		return nil, "", &SuspendedError{Suspension: suspension}
+	}
+	// 策略提高 bcrypt cost 后，在用户下次登录时用新 cost 重新哈希
+	if passwordNeedsRehash(user.PasswordHash) {
+		if hashed, err := HashPassword(req.Password); err == nil {
+			if err := s.repo.UpdatePasswordHash(user.ID, hashed); err != nil {
+				log.Printf("重新哈希用户 %s 的密码失败: %v", user.ID, err)
+			}
+		}
+	}
 
 	jwtService := NewJWTService()
 	token, err := jwtService.GenerateToken(user.ID, user.Username)
@@ -94,14 +118,14 @@ func (s *UserService) EnsureAdmin() error {
 		return nil
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(cfg.AdminPassword), bcrypt.DefaultCost)
+	hashedPassword, err := HashPassword(cfg.AdminPassword)
 	if err != nil {
 		return err
 	}
 
 	admin := &model.User{
 		Username:     cfg.AdminUsername,
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
 		IsAdmin:      true,
 	}
 
@@ -144,6 +168,12 @@ func (s *UserService) ListUsers() ([]*model.UserInfo, error) {
 		return nil, err
 	}
 
+	suspensions, err := s.repo.ListSuspensions()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
 	result := make([]*model.UserInfo, len(users))
 	for i, u := range users {
 		gids := userGroupMap[u.ID]
@@ -164,8 +194,17 @@ func (s *UserService) ListUsers() ([]*model.UserInfo, error) {
 			BalanceUsd:    fmt.Sprintf("%.6f", float64(u.BalanceMicros)/1e6),
 			GroupIDs:      gids,
 			GroupNames:    groupNames,
+			Timezone:      u.Timezone,
+			Email:         u.Email,
+			EmailVerified: u.Email != "" && u.EmailVerifiedAt != nil,
 			CreatedAt:     u.CreatedAt,
 			UpdatedAt:     u.UpdatedAt,
+
+			PasswordChangedAt:  u.PasswordChangedAt,
+			MustChangePassword: UserPasswordChangeDue(u, now),
+		}
+		if suspension := suspensions[u.ID]; suspensionActive(suspension, now) {
+			result[i].Suspension = suspension
 		}
 	}
 	return result, nil
@@ -184,12 +223,11 @@ func (s *UserService) ChangePassword(userID string, oldPassword, newPassword str
 		return errors.New("旧密码错误")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
-	if err != nil {
+	if err := s.setPassword(user, newPassword); err != nil {
 		return err
 	}
-
-	return s.repo.UpdatePassword(userID, string(hashedPassword))
+	notifyCredentialChange(user, "密码已修改")
+	return nil
 }
 
 func (s *UserService) ChangeUsername(userID string, newUsername string) error {
@@ -200,7 +238,11 @@ func (s *UserService) ChangeUsername(userID string, newUsername string) error {
 	if exists {
 		return ErrUsernameExists
 	}
-	return s.repo.UpdateUsername(userID, newUsername)
+	if err := s.repo.UpdateUsername(userID, newUsername); err != nil {
+		return err
+	}
+	notifyCredentialChangeByID(userID, "登录用户名已修改为 "+newUsername)
+	return nil
 }
 
 func (s *UserService) SetAdmin(userID string, isAdmin bool) error {
@@ -215,20 +257,41 @@ func (s *UserService) DeleteUser(userID string) error {
 	return s.repo.Delete(userID)
 }
 
-func (s *UserService) ResetPassword(userID string, newPassword string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+// ResetPassword 管理员重置密码；forceChange 为 true 时要求用户登录后先修改密码
+func (s *UserService) ResetPassword(actor, userID string, newPassword string, forceChange bool) error {
+	user, err := s.repo.GetByID(userID)
 	if err != nil {
 		return err
 	}
-	return s.repo.UpdatePassword(userID, string(hashedPassword))
+	if user == nil {
+		return repository.ErrUserNotFound
+	}
+	if err := s.setPassword(user, newPassword); err != nil {
+		return err
+	}
+	if forceChange {
+		if err := s.SetPasswordMustChange(actor, userID, true); err != nil {
+			return err
+		}
+	}
+	notifyCredentialChange(user, "密码已被管理员重置")
+	return nil
 }
 
 func (s *UserService) GetBalance(userID string) (int64, error) {
 	return s.repo.GetBalance(userID)
 }
 
-func (s *UserService) TopUp(userID string, amountMicros int64) error {
-	return s.repo.TopUpBalance(userID, amountMicros)
+// defaultTopUpReason 充值未填写原因时记录的调整原因
+const defaultTopUpReason = "管理员充值"
+
+// TopUp 增加用户余额，按余额调整记录计费事件与审计记录
+func (s *UserService) TopUp(actor, userID string, amountMicros int64, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		reason = defaultTopUpReason
+	}
+	_, err := NewBillingService().AdjustBalance(actor, userID, model.BalanceAdjustmentCredit, amountMicros, reason)
+	return err
 }
 
 func (s *UserService) GetTotalBalanceAndUserCount() (int64, int64, error) {
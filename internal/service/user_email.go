@@ -0,0 +1,328 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"ampmanager/internal/config"
+	"ampmanager/internal/mail"
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrMailDisabled 未配置 SMTP，无法发送邮件
+	ErrMailDisabled = errors.New("邮件服务未配置，请联系管理员")
+	// ErrEmailInUse 邮箱已被其他用户验证
+	ErrEmailInUse = errors.New("该邮箱已被其他账户使用")
+	// ErrEmailNotSet 用户未设置邮箱
+	ErrEmailNotSet = errors.New("尚未设置邮箱")
+	// ErrEmailAlreadyVerified 邮箱已验证
+	ErrEmailAlreadyVerified = errors.New("邮箱已验证")
+	// ErrInvalidEmailToken 链接无效、已使用或已过期
+	ErrInvalidEmailToken = errors.New("链接无效或已过期")
+	// ErrEmailSendFailed 发送邮件失败
+	ErrEmailSendFailed = errors.New("发送邮件失败，请稍后重试")
+	// ErrPublicURLNotSet 未配置 PUBLIC_URL，无法生成邮件中的链接
+	ErrPublicURLNotSet = errors.New("服务端未配置对外访问地址 PUBLIC_URL，无法发送邮件链接，请联系管理员")
+)
+
+const (
+	auditActionEmailUpdate   = "user.email_update"
+	auditActionEmailVerify   = "user.email_verify"
+	auditActionPasswordReset = "user.password_reset"
+
+	emailVerifyTokenTTL   = 24 * time.Hour
+	passwordResetTokenTTL = time.Hour
+)
+
+// normalizeEmail 邮箱统一去空白并转小写后保存与比较
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// emailLinkBase 邮件链接使用的对外地址，只取自 PUBLIC_URL：
+// 请求的 Host 与 X-Forwarded-Host 可由客户端伪造，据此生成的找回密码链接会把令牌交给攻击者
+func emailLinkBase() (string, error) {
+	if cfg := config.Get(); cfg != nil && cfg.PublicURL != "" {
+		return cfg.PublicURL, nil
+	}
+	return "", ErrPublicURLNotSet
+}
+
+// issueEmailToken 生成一次性令牌，数据库只保存其 SHA-256 哈希
+func issueEmailToken(userID, purpose, email string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	err := repository.NewEmailTokenRepository().Create(&model.EmailToken{
+		TokenHash: hashEmailToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func hashEmailToken(token string) string {
+	hash := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(hash[:])
+}
+
+// GetEmailStatus 返回用户的邮箱与验证状态
+func (s *UserService) GetEmailStatus(userID string) (*model.EmailStatus, error) {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, repository.ErrUserNotFound
+	}
+	return &model.EmailStatus{
+		Email:       user.Email,
+		Verified:    user.Email != "" && user.EmailVerifiedAt != nil,
+		MailEnabled: mail.Enabled(),
+	}, nil
+}
+
+// UpdateEmail 修改邮箱：新邮箱需重新验证，原已验证邮箱会收到变更通知；
+// 已配置 SMTP 时立即发送验证邮件，发送失败返回 ErrEmailSendFailed、未配置 PUBLIC_URL 返回 ErrPublicURLNotSet
+// （邮箱均已保存，可稍后重新发送）
+func (s *UserService) UpdateEmail(userID, email string) error {
+	email = normalizeEmail(email)
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return repository.ErrUserNotFound
+	}
+	if email == user.Email && (email == "" || user.EmailVerifiedAt != nil) {
+		return nil
+	}
+	if email != "" {
+		inUse, err := s.repo.EmailInUse(email, userID)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrEmailInUse
+		}
+	}
+
+	if err := s.repo.UpdateEmail(userID, email); err != nil {
+		return err
+	}
+	if err := repository.NewEmailTokenRepository().InvalidateUser(userID, model.EmailTokenVerify); err != nil {
+		log.Warnf("user email: 作废用户 %s 的验证令牌失败: %v", userID, err)
+	}
+	recordAudit(userID, auditActionEmailUpdate, "user", userID, map[string]interface{}{
+		"email":         email,
+		"previousEmail": user.Email,
+	})
+	// 通知发往原邮箱，防止账户被盗后悄悄换绑
+	if user.EmailVerifiedAt != nil && user.Email != email {
+		notifyCredentialChange(user, "账户邮箱已修改")
+	}
+
+	if email == "" || !mail.Enabled() {
+		return nil
+	}
+	user.Email = email
+	return s.sendEmailVerification(user)
+}
+
+// SendEmailVerification 重新发送验证邮件，之前发送的验证链接失效
+func (s *UserService) SendEmailVerification(userID string) error {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return repository.ErrUserNotFound
+	}
+	if user.Email == "" {
+		return ErrEmailNotSet
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	if !mail.Enabled() {
+		return ErrMailDisabled
+	}
+	if _, err := emailLinkBase(); err != nil {
+		return err
+	}
+	if err := repository.NewEmailTokenRepository().InvalidateUser(userID, model.EmailTokenVerify); err != nil {
+		return err
+	}
+	return s.sendEmailVerification(user)
+}
+
+func (s *UserService) sendEmailVerification(user *model.User) error {
+	base, err := emailLinkBase()
+	if err != nil {
+		return err
+	}
+	token, err := issueEmailToken(user.ID, model.EmailTokenVerify, user.Email, emailVerifyTokenTTL)
+	if err != nil {
+		return err
+	}
+	link := base + "/verify-email?token=" + url.QueryEscape(token)
+	err = mail.Send(mail.Message{
+		To:      user.Email,
+		Subject: "验证您的邮箱",
+		Body: fmt.Sprintf("您好 %s：\n\n请在 %d 小时内打开以下链接完成邮箱验证：\n\n%s\n\n如果您没有在 AMP Manager 绑定此邮箱，请忽略本邮件。\n",
+			user.Username, int(emailVerifyTokenTTL.Hours()), link),
+	})
+	if err != nil {
+		log.Warnf("user email: 向用户 %s 发送验证邮件失败: %v", user.ID, err)
+		return ErrEmailSendFailed
+	}
+	return nil
+}
+
+// VerifyEmail 使用验证链接中的令牌完成邮箱验证
+func (s *UserService) VerifyEmail(token string) error {
+	record, err := repository.NewEmailTokenRepository().Consume(hashEmailToken(token), model.EmailTokenVerify)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrInvalidEmailToken
+	}
+	inUse, err := s.repo.EmailInUse(record.Email, record.UserID)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrEmailInUse
+	}
+	// 令牌签发后用户又修改了邮箱时不生效
+	verified, err := s.repo.MarkEmailVerified(record.UserID, record.Email)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return ErrInvalidEmailToken
+	}
+	recordAudit(record.UserID, auditActionEmailVerify, "user", record.UserID, map[string]interface{}{"email": record.Email})
+	if user, err := s.repo.GetByID(record.UserID); err == nil && user != nil {
+		ApplyVerifiedEmailDefaults(user.ID, user.Username, record.Email)
+	}
+	return nil
+}
+
+// RequestPasswordReset 向已验证的邮箱发送找回密码链接。
+// 为避免泄露邮箱是否注册，邮箱不存在或未验证时同样返回成功，邮件在后台发送；
+// 未配置 PUBLIC_URL 时拒绝发送，返回 ErrPublicURLNotSet
+func (s *UserService) RequestPasswordReset(email string) error {
+	if !mail.Enabled() {
+		return ErrMailDisabled
+	}
+	base, err := emailLinkBase()
+	if err != nil {
+		return err
+	}
+	user, err := s.repo.GetByVerifiedEmail(normalizeEmail(email))
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		log.Infof("user email: 找回密码请求的邮箱未绑定任何已验证账户")
+		return nil
+	}
+	token, err := issueEmailToken(user.ID, model.EmailTokenPasswordReset, user.Email, passwordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+	link := base + "/reset-password?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "重置您的密码",
+		Body: fmt.Sprintf("您好 %s：\n\n我们收到了重置 AMP Manager 账户密码的请求。请在 %d 分钟内打开以下链接设置新密码：\n\n%s\n\n如果这不是您本人的操作，请忽略本邮件，您的密码不会被修改。\n",
+			user.Username, int(passwordResetTokenTTL.Minutes()), link),
+	}
+	go func() {
+		if err := mail.Send(msg); err != nil {
+			log.Warnf("user email: 向用户 %s 发送找回密码邮件失败: %v", user.ID, err)
+		}
+	}()
+	return nil
+}
+
+// ConfirmPasswordReset 使用找回密码令牌设置新密码，成功后该用户其余未使用的找回密码链接全部失效
+func (s *UserService) ConfirmPasswordReset(token, newPassword string) error {
+	tokenRepo := repository.NewEmailTokenRepository()
+	record, err := tokenRepo.Consume(hashEmailToken(token), model.EmailTokenPasswordReset)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrInvalidEmailToken
+	}
+	user, err := s.repo.GetByID(record.UserID)
+	if err != nil {
+		return err
+	}
+	// 令牌签发后邮箱被修改或解绑时不生效
+	if user == nil || user.Email != record.Email || user.EmailVerifiedAt == nil {
+		return ErrInvalidEmailToken
+	}
+
+	if err := s.setPassword(user, newPassword); err != nil {
+		return err
+	}
+	if err := tokenRepo.InvalidateUser(user.ID, model.EmailTokenPasswordReset); err != nil {
+		log.Warnf("user email: 作废用户 %s 的找回密码令牌失败: %v", user.ID, err)
+	}
+	recordAudit(user.ID, auditActionPasswordReset, "user", user.ID, map[string]interface{}{"email": user.Email})
+	notifyCredentialChange(user, "密码已通过找回密码重置")
+	return nil
+}
+
+// notifyCredentialChange 在后台向用户已验证的邮箱发送凭据变更通知；未配置 SMTP 或邮箱未验证时跳过
+func notifyCredentialChange(user *model.User, change string) {
+	if user == nil || user.Email == "" || user.EmailVerifiedAt == nil || !mail.Enabled() {
+		return
+	}
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "账户安全通知：" + change,
+		Body: fmt.Sprintf("您好 %s：\n\n您的 AMP Manager 账户于 %s 发生以下变更：%s。\n\n如果这不是您本人的操作，请立即修改密码并联系管理员。\n",
+			user.Username, time.Now().UTC().Format("2006-01-02 15:04:05 UTC"), change),
+	}
+	go func() {
+		if err := mail.Send(msg); err != nil {
+			log.Warnf("user email: 向用户 %s 发送凭据变更通知失败: %v", user.ID, err)
+		}
+	}()
+}
+
+// notifyCredentialChangeByID 同 notifyCredentialChange，按用户 ID 查找收件人
+func notifyCredentialChangeByID(userID, change string) {
+	if !mail.Enabled() {
+		return
+	}
+	user, err := repository.NewUserRepository().GetByID(userID)
+	if err != nil {
+		log.Warnf("user email: 查询用户 %s 失败，跳过凭据变更通知: %v", userID, err)
+		return
+	}
+	notifyCredentialChange(user, change)
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/model"
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidSuspension 停用参数无效
+	ErrInvalidSuspension = errors.New("停用参数无效")
+	// ErrCannotSuspendSelf 管理员不能停用自己
+	ErrCannotSuspendSelf = errors.New("不能停用自己")
+)
+
+const (
+	auditActionUserSuspend   = "user.suspend"
+	auditActionUserUnsuspend = "user.unsuspend"
+
+	// userSuspensionTTL 停用状态缓存时长，多实例部署时停用/恢复最多延迟该时长生效
+	userSuspensionTTL = 30 * time.Second
+)
+
+// SuspendedError 账户已停用，Suspension 为当前生效的停用记录
+type SuspendedError struct {
+	Suspension *model.UserSuspension
+}
+
+func (e *SuspendedError) Error() string {
+	return "账户已停用：" + SuspensionDescription(e.Suspension.Reason)
+}
+
+type userSuspensionEntry struct {
+	suspension *model.UserSuspension
+	expires    time.Time
+}
+
+// userSuspensionCache key: userID, value: userSuspensionEntry（未停用时 suspension 为 nil）
+var userSuspensionCache sync.Map
+
+// SuspensionDescription 停用原因的说明文字
+func SuspensionDescription(reason string) string {
+	switch reason {
+	case model.SuspensionReasonNonPayment:
+		return "账户欠费"
+	case model.SuspensionReasonAbuseReview:
+		return "账户正在接受滥用审查"
+	default:
+		return "账户已被管理员停用"
+	}
+}
+
+// SuspensionNotice 构建返回给被停用用户的说明
+func SuspensionNotice(s *model.UserSuspension) model.SuspensionNotice {
+	return model.SuspensionNotice{
+		Reason:      s.Reason,
+		Description: SuspensionDescription(s.Reason),
+		Message:     s.Message,
+		SuspendedAt: s.SuspendedAt,
+		ExpiresAt:   s.ExpiresAt,
+	}
+}
+
+// suspensionActive 停用记录在 now 时是否生效
+func suspensionActive(s *model.UserSuspension, now time.Time) bool {
+	return s != nil && (s.ExpiresAt == nil || now.Before(*s.ExpiresAt))
+}
+
+// ActiveSuspension 返回用户当前生效的停用记录，未停用、已到期或查询失败时返回 nil（查询失败不拦截请求）
+func ActiveSuspension(userID string) *model.UserSuspension {
+	if userID == "" {
+		return nil
+	}
+	now := time.Now()
+	if cached, ok := userSuspensionCache.Load(userID); ok {
+		entry := cached.(userSuspensionEntry)
+		if now.Before(entry.expires) {
+			if suspensionActive(entry.suspension, now) {
+				return entry.suspension
+			}
+			return nil
+		}
+	}
+
+	suspension, err := repository.NewUserRepository().GetSuspension(userID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrUserNotFound) {
+			log.Warnf("user suspension: load for user %s failed: %v", userID, err)
+		}
+		return nil
+	}
+	userSuspensionCache.Store(userID, userSuspensionEntry{suspension: suspension, expires: now.Add(userSuspensionTTL)})
+	if suspensionActive(suspension, now) {
+		return suspension
+	}
+	return nil
+}
+
+// SuspendUser 停用用户并写入审计记录；再次停用会覆盖原因与到期时间
+func (s *UserService) SuspendUser(actor, userID string, req *model.SuspendUserRequest) (*model.UserSuspension, error) {
+	if actor == userID {
+		return nil, ErrCannotSuspendSelf
+	}
+	reason := strings.TrimSpace(req.Reason)
+	switch reason {
+	case model.SuspensionReasonNonPayment, model.SuspensionReasonAbuseReview, model.SuspensionReasonOther:
+	default:
+		return nil, fmt.Errorf("%w: reason 必须为 non_payment、abuse_review 或 other", ErrInvalidSuspension)
+	}
+	now := time.Now().UTC()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expiresAt 必须晚于当前时间", ErrInvalidSuspension)
+	}
+
+	suspension := &model.UserSuspension{
+		Reason:      reason,
+		Message:     strings.TrimSpace(req.Message),
+		SuspendedAt: now,
+		SuspendedBy: actor,
+	}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		suspension.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.SetSuspension(userID, suspension); err != nil {
+		return nil, err
+	}
+	userSuspensionCache.Delete(userID)
+
+	log.Infof("user suspension: %s suspended user %s (%s)", actor, userID, reason)
+	recordAudit(actor, auditActionUserSuspend, "user", userID, map[string]interface{}{
+		"reason":    suspension.Reason,
+		"message":   suspension.Message,
+		"expiresAt": suspension.ExpiresAt,
+	})
+	return suspension, nil
+}
+
+// UnsuspendUser 恢复用户；用户未处于停用状态时不做修改，返回 false
+func (s *UserService) UnsuspendUser(actor, userID string) (bool, error) {
+	previous, err := s.repo.GetSuspension(userID)
+	if err != nil {
+		return false, err
+	}
+	if previous == nil {
+		return false, nil
+	}
+	if err := s.repo.ClearSuspension(userID); err != nil {
+		return false, err
+	}
+	userSuspensionCache.Delete(userID)
+
+	log.Infof("user suspension: %s unsuspended user %s", actor, userID)
+	recordAudit(actor, auditActionUserUnsuspend, "user", userID, map[string]interface{}{
+		"previousReason": previous.Reason,
+		"suspendedAt":    previous.SuspendedAt,
+		"expired":        !suspensionActive(previous, time.Now()),
+	})
+	return true, nil
+}
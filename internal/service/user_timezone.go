@@ -0,0 +1,99 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"ampmanager/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrInvalidTimezone 时区名称无效
+var ErrInvalidTimezone = errors.New("无效的时区，应为 IANA 时区名称（如 Asia/Shanghai）")
+
+// userLocationTTL 用户时区缓存时长，多实例部署时修改最多延迟该时长生效
+const userLocationTTL = time.Minute
+
+type userLocationEntry struct {
+	loc     *time.Location
+	expires time.Time
+}
+
+// userLocationCache key: userID, value: userLocationEntry
+var userLocationCache sync.Map
+
+// ParseTimezone 解析 IANA 时区名称，空字符串为 UTC；不接受依赖服务器环境的 Local
+func ParseTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "UTC" {
+		return time.UTC, nil
+	}
+	if name == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
+
+// UserLocation 返回用户的报表时区，未设置、设置无效或查询失败时为 UTC
+func UserLocation(userID string) *time.Location {
+	if userID == "" {
+		return time.UTC
+	}
+	if cached, ok := userLocationCache.Load(userID); ok {
+		entry := cached.(userLocationEntry)
+		if time.Now().Before(entry.expires) {
+			return entry.loc
+		}
+	}
+
+	name, err := repository.NewUserRepository().GetTimezone(userID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrUserNotFound) {
+			log.Warnf("user timezone: load for user %s failed: %v", userID, err)
+		}
+		return time.UTC
+	}
+	loc, err := ParseTimezone(name)
+	if err != nil {
+		log.Warnf("user timezone: user %s has invalid timezone %q, using UTC", userID, name)
+		loc = time.UTC
+	}
+	userLocationCache.Store(userID, userLocationEntry{loc: loc, expires: time.Now().Add(userLocationTTL)})
+	return loc
+}
+
+// GetTimezone 返回用户设置的报表时区，未设置时为空字符串
+func (s *UserService) GetTimezone(userID string) (string, error) {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", repository.ErrUserNotFound
+	}
+	return user.Timezone, nil
+}
+
+// SetTimezone 设置用户的报表时区，空字符串恢复为 UTC
+func (s *UserService) SetTimezone(userID, timezone string) (string, error) {
+	loc, err := ParseTimezone(timezone)
+	if err != nil {
+		return "", err
+	}
+	name := ""
+	if loc != time.UTC {
+		name = loc.String()
+	}
+	if err := s.repo.UpdateTimezone(userID, name); err != nil {
+		return "", err
+	}
+	userLocationCache.Delete(userID)
+	return name, nil
+}
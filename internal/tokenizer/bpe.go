@@ -0,0 +1,157 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxMergeBytes 超过该长度的片段不做 BPE 合并（合并为平方复杂度），改用启发式估算
+const maxMergeBytes = 1024
+
+var (
+	vocabMu  sync.Mutex
+	vocabDir string
+	// vocabs 已尝试加载的词表，加载失败或未配置目录时值为 nil
+	vocabs = map[Encoding]*vocab{}
+)
+
+type vocab struct {
+	ranks map[string]int
+}
+
+// Init 设置 tiktoken 词表目录（TOKENIZER_DIR），词表在首次计数时按需加载；
+// 目录为空或文件不存在时 BPE 编码退回启发式估算
+func Init(dir string) {
+	vocabMu.Lock()
+	defer vocabMu.Unlock()
+	vocabDir = dir
+	vocabs = map[Encoding]*vocab{}
+}
+
+func loadVocab(enc Encoding) *vocab {
+	vocabMu.Lock()
+	defer vocabMu.Unlock()
+	if v, ok := vocabs[enc]; ok {
+		return v
+	}
+	var v *vocab
+	if vocabDir != "" {
+		path := filepath.Join(vocabDir, string(enc)+".tiktoken")
+		ranks, err := readRankFile(path)
+		if err != nil {
+			log.Warnf("tokenizer: 读取词表 %s 失败，按启发式估算 token: %v", path, err)
+		} else {
+			v = &vocab{ranks: ranks}
+			log.Infof("tokenizer: 已加载词表 %s（%d 个 token）", path, len(ranks))
+		}
+	}
+	vocabs[enc] = v
+	return v
+}
+
+// readRankFile 读取 tiktoken 词表：每行为 base64 编码的 token 与其合并优先级（rank）
+func readRankFile(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("第 %d 行格式错误", lineNo)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行 token 不是有效的 base64: %w", lineNo, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行 rank 不是整数: %w", lineNo, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("词表为空")
+	}
+	return ranks, nil
+}
+
+// countBPE 先按 tiktoken 的规则预切分，再对每个片段做字节对合并；未加载词表时按片段估算
+func countBPE(enc Encoding, text string) int {
+	v := loadVocab(enc)
+	total := 0
+	for _, piece := range pretokenize(text) {
+		if v == nil || len(piece) > maxMergeBytes {
+			total += estimatePiece(piece)
+			continue
+		}
+		if _, ok := v.ranks[piece]; ok {
+			total++
+			continue
+		}
+		total += bytePairMerge([]byte(piece), v.ranks)
+	}
+	return total
+}
+
+// bytePairMerge 从单字节开始，反复合并 rank 最小的相邻片段，返回最终的 token 数
+func bytePairMerge(piece []byte, ranks map[string]int) int {
+	// parts 为各片段的起始位置，末尾为 len(piece)
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+	for len(parts) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(parts); i++ {
+			if rank, ok := ranks[string(piece[parts[i]:parts[i+2]])]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts) - 1
+}
+
+// estimatePiece 没有词表时估算单个预切分片段：常见英文单词（含前导空格）通常为 1 个 token，
+// 每多 6 个 ASCII 字符约多 1 个 token，非 ASCII 字符按 1 字符 1 token
+func estimatePiece(piece string) int {
+	ascii, other := 0, 0
+	for _, r := range piece {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	if ascii == 0 {
+		return other
+	}
+	return 1 + (ascii-1)/6 + other
+}
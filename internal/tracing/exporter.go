@@ -0,0 +1,260 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// exportQueueSize 待导出 span 的缓冲上限，满时丢弃新 span，不阻塞请求
+	exportQueueSize = 4096
+	// exportBatchSize 单次导出的最大 span 数
+	exportBatchSize = 512
+	// exportInterval 定期导出间隔
+	exportInterval = 5 * time.Second
+	// exportTimeout 单次导出请求超时
+	exportTimeout = 10 * time.Second
+
+	statusCodeError = 2
+
+	scopeName = "ampmanager/internal/tracing"
+)
+
+// OTLP/HTTP JSON 编码（opentelemetry-proto 的 JSON 映射：ID 为十六进制，64 位整数为字符串）
+type attribute struct {
+	Key   string         `json:"key"`
+	Value attributeValue `json:"value"`
+}
+
+type attributeValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              SpanKind    `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []attribute `json:"attributes,omitempty"`
+	Status            otlpStatus  `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []attribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func attrValue(value any) attributeValue {
+	switch v := value.(type) {
+	case string:
+		return attributeValue{StringValue: &v}
+	case bool:
+		return attributeValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return attributeValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return attributeValue{IntValue: &s}
+	case float64:
+		return attributeValue{DoubleValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return attributeValue{StringValue: &s}
+	}
+}
+
+func (s *Span) toOTLP() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        append([]attribute(nil), s.attrs...),
+		Status:            otlpStatus{Code: s.statusCode, Message: s.statusMsg},
+	}
+	if s.parent != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	return out
+}
+
+// encodeSpans 将一批 span 编码为 OTLP ExportTraceServiceRequest
+func encodeSpans(serviceName string, spans []*Span) ([]byte, error) {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(spans))}
+	scope.Scope.Name = scopeName
+	for _, s := range spans {
+		scope.Spans = append(scope.Spans, s.toOTLP())
+	}
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	rs.Resource.Attributes = []attribute{{Key: "service.name", Value: attrValue(serviceName)}}
+	return json.Marshal(otlpTraceRequest{ResourceSpans: []otlpResourceSpans{rs}})
+}
+
+// exporter 后台批量导出 span
+type exporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+
+	queue    chan *Span
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	// failing 最近一次导出是否失败，只在状态变化时打印日志，避免 Collector 不可用时刷屏
+	failing bool
+}
+
+func newExporter(endpoint string, headers map[string]string, serviceName string) *exporter {
+	return &exporter{
+		endpoint:    endpoint,
+		headers:     headers,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		queue:       make(chan *Span, exportQueueSize),
+		stopChan:    make(chan struct{}),
+	}
+}
+
+func (e *exporter) start() {
+	e.wg.Add(1)
+	go e.run()
+}
+
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		log.Debug("tracing: export queue full, dropping span")
+	}
+}
+
+func (e *exporter) run() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, exportBatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stopChan:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+					if len(batch) >= exportBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *exporter) export(spans []*Span) {
+	body, err := encodeSpans(e.serviceName, spans)
+	if err != nil {
+		log.Warnf("tracing: encode spans failed: %v", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Warnf("tracing: build export request failed: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("collector returned HTTP %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		if !e.failing {
+			log.Warnf("tracing: export %d spans failed: %v", len(spans), err)
+		}
+		e.failing = true
+		return
+	}
+	if e.failing {
+		log.Info("tracing: export recovered")
+	}
+	e.failing = false
+}
+
+// shutdown 停止接收并导出剩余 span，ctx 到期时放弃等待
+func (e *exporter) shutdown(ctx context.Context) {
+	e.stopOnce.Do(func() { close(e.stopChan) })
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("tracing: shutdown timed out, pending spans dropped")
+	}
+}
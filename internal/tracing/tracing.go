@@ -0,0 +1,391 @@
+// Package tracing 实现与 OpenTelemetry 兼容的分布式追踪：按 W3C Trace Context 传播 traceparent，
+// 并通过 OTLP/HTTP（JSON 编码）把 span 批量导出到 Collector。
+//
+// 未配置导出地址时追踪关闭，Start 返回 nil span，所有 Span 方法对 nil 安全，调用方无需判断。
+package tracing
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TraceparentHeader W3C Trace Context 传播头
+const TraceparentHeader = "traceparent"
+
+// SpanKind span 类型，取值与 OTLP 一致
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Options 追踪配置
+type Options struct {
+	// Endpoint OTLP/HTTP 地址（如 http://otel-collector:4318），未以 /v1/traces 结尾时自动追加；为空时关闭追踪
+	Endpoint string
+	// Headers 导出请求附加的请求头（如鉴权）
+	Headers map[string]string
+	// ServiceName 上报的 service.name
+	ServiceName string
+	// SampleRatio 新建 trace 的采样比例（0~1）；上游已携带 traceparent 时沿用其采样标记
+	SampleRatio float64
+}
+
+// SpanContext 跨进程传播的 span 标识
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid trace ID 与 span ID 均非全零
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceIDString 十六进制 trace ID，无效时为空
+func (sc SpanContext) TraceIDString() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// Traceparent 格式化为 traceparent 头（version 00）
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent 解析 traceparent 头；未知版本按 version 00 的前缀解析，version ff 与全零 ID 视为无效
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	value = strings.TrimSpace(value)
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || parts[1] != strings.ToLower(parts[1]) || parts[2] != strings.ToLower(parts[2]) {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Span 一次操作的计时与属性；nil 表示追踪关闭，所有方法均为空操作
+type Span struct {
+	mu         sync.Mutex
+	name       string
+	kind       SpanKind
+	sc         SpanContext
+	parent     [8]byte
+	start      time.Time
+	end        time.Time
+	attrs      []attribute
+	statusCode int
+	statusMsg  string
+	ended      bool
+	tracer     *tracer
+}
+
+// SpanContext 返回 span 的传播标识
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttr 设置属性，值支持 string / bool / 整数 / 浮点数，其他类型按 fmt 格式化
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	for i := range s.attrs {
+		if s.attrs[i].Key == key {
+			s.attrs[i].Value = attrValue(value)
+			return
+		}
+	}
+	s.attrs = append(s.attrs, attribute{Key: key, Value: attrValue(value)})
+}
+
+// SetError 标记 span 失败；err 为 nil 时不变
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetErrorMessage(err.Error())
+}
+
+// SetErrorMessage 以消息标记 span 失败
+func (s *Span) SetErrorMessage(msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.statusCode = statusCodeError
+	s.statusMsg = msg
+}
+
+// End 结束 span 并提交导出，重复调用只生效一次
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled && s.tracer != nil {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan 将 span 存入 context，后续 Start 以其为父 span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext 返回 context 中的当前 span，没有时返回 nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext 返回当前 span 的标识；只有上游传入的远端父 span 时返回远端标识
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.sc
+	}
+	if ctx != nil {
+		if sc, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+			return sc
+		}
+	}
+	return SpanContext{}
+}
+
+// TraceID 返回 context 所属 trace 的十六进制 ID，没有时为空
+func TraceID(ctx context.Context) string {
+	return SpanContextFromContext(ctx).TraceIDString()
+}
+
+// Extract 从请求头读取 traceparent 作为远端父 span；追踪关闭或头无效时返回原 context
+func Extract(ctx context.Context, header http.Header) context.Context {
+	if current() == nil {
+		return ctx
+	}
+	sc, ok := ParseTraceparent(header.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Inject 将当前 span 写入 traceparent 头，没有 span 时不修改
+func Inject(ctx context.Context, header http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(TraceparentHeader, sc.Traceparent())
+	header.Del("tracestate")
+}
+
+// Start 以 context 中的 span（或远端父 span）为父创建子 span，返回携带新 span 的 context；
+// 追踪关闭时返回原 context 与 nil
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t := current()
+	if t == nil {
+		return ctx, nil
+	}
+	span := t.newSpan(SpanContextFromContext(ctx), name, kind)
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartWithParent 以指定父 span 创建子 span，用于脱离请求 context 的异步阶段（如计费结算）；
+// 父标识无效或追踪关闭时返回 nil
+func StartWithParent(parent SpanContext, name string, kind SpanKind) *Span {
+	t := current()
+	if t == nil || !parent.IsValid() {
+		return nil
+	}
+	return t.newSpan(parent, name, kind)
+}
+
+type tracer struct {
+	sampleRatio float64
+	exporter    *exporter
+}
+
+func (t *tracer) newSpan(parent SpanContext, name string, kind SpanKind) *Span {
+	span := &Span{name: name, kind: kind, start: time.Now(), tracer: t}
+	if parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = t.sampleRatio >= 1 || (t.sampleRatio > 0 && rand.Float64() < t.sampleRatio)
+	}
+	span.sc.SpanID = newSpanID()
+	return span
+}
+
+func newTraceID() [16]byte {
+	var id [16]byte
+	for id == [16]byte{} {
+		_, _ = cryptorand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	for id == [8]byte{} {
+		_, _ = cryptorand.Read(id[:])
+	}
+	return id
+}
+
+var (
+	state   *tracer
+	stateMu sync.RWMutex
+)
+
+func current() *tracer {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	return state
+}
+
+// Enabled 是否已配置导出地址
+func Enabled() bool {
+	return current() != nil
+}
+
+// Init 按配置启动追踪；Endpoint 为空时保持关闭
+func Init(opts Options) error {
+	if strings.TrimSpace(opts.Endpoint) == "" {
+		return nil
+	}
+	endpoint, err := tracesEndpoint(opts.Endpoint)
+	if err != nil {
+		return err
+	}
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return fmt.Errorf("采样比例必须在 0~1 之间: %v", opts.SampleRatio)
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = "ampmanager"
+	}
+
+	t := &tracer{
+		sampleRatio: opts.SampleRatio,
+		exporter:    newExporter(endpoint, opts.Headers, opts.ServiceName),
+	}
+	t.exporter.start()
+
+	stateMu.Lock()
+	previous := state
+	state = t
+	stateMu.Unlock()
+	if previous != nil {
+		previous.exporter.shutdown(context.Background())
+	}
+
+	log.Infof("tracing: exporting spans to %s (service=%s, sampleRatio=%v)", endpoint, opts.ServiceName, opts.SampleRatio)
+	return nil
+}
+
+// Shutdown 关闭追踪并导出缓冲中的 span
+func Shutdown(ctx context.Context) {
+	stateMu.Lock()
+	t := state
+	state = nil
+	stateMu.Unlock()
+	if t != nil {
+		t.exporter.shutdown(ctx)
+	}
+}
+
+func tracesEndpoint(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("OTLP 导出地址必须是 http(s):// URL")
+	}
+	if !strings.HasSuffix(u.Path, "/v1/traces") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// ParseHeaders 解析 OTEL_EXPORTER_OTLP_HEADERS 格式（key1=value1,key2=value2，值可 URL 编码）
+func ParseHeaders(raw string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = decoded
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers
+}
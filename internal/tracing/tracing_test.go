@@ -0,0 +1,138 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || !sc.Sampled {
+		t.Fatalf("expected valid sampled context, got %+v %v", sc, ok)
+	}
+	if sc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected trace id %s", sc.TraceIDString())
+	}
+	if got := sc.Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("round trip mismatch: %s", got)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future"); !ok {
+		t.Errorf("future versions should parse by the version 00 prefix")
+	}
+}
+
+func TestDisabledIsNoop(t *testing.T) {
+	ctx, span := Start(context.Background(), "noop", SpanKindInternal)
+	if span != nil || TraceID(ctx) != "" {
+		t.Fatalf("expected no span when tracing is disabled")
+	}
+	span.SetAttr("k", "v")
+	span.SetError(io.EOF)
+	span.End()
+}
+
+func TestTransportPropagatesAndExports(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		payload otlpTraceRequest
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer t" {
+			t.Errorf("unexpected export request %s %v", r.URL.Path, r.Header)
+		}
+		var req otlpTraceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+		mu.Lock()
+		payload.ResourceSpans = append(payload.ResourceSpans, req.ResourceSpans...)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	var upstreamTraceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get(TraceparentHeader)
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	if err := Init(Options{Endpoint: collector.URL, Headers: ParseHeaders("Authorization=Bearer%20t"), SampleRatio: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	incoming := http.Header{}
+	incoming.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := Extract(context.Background(), incoming)
+	ctx, root := Start(ctx, "POST /v1/messages", SpanKindServer)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL+"/v1/messages", strings.NewReader("{}"))
+	client := &http.Client{Transport: Transport(http.DefaultTransport, "channel.upstream")}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	root.End()
+
+	sc, ok := ParseTraceparent(upstreamTraceparent)
+	if !ok || sc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("upstream got traceparent %q", upstreamTraceparent)
+	}
+	if sc.SpanID == root.SpanContext().SpanID {
+		t.Fatalf("upstream should see the client span, not the server span")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	Shutdown(shutdownCtx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var spans []otlpSpan
+	for _, rs := range payload.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			spans = append(spans, ss.Spans...)
+		}
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 exported spans, got %d", len(spans))
+	}
+	byName := map[string]otlpSpan{}
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+	clientSpan, server := byName["channel.upstream"], byName["POST /v1/messages"]
+	if server.ParentSpanID != "00f067aa0ba902b7" || clientSpan.ParentSpanID != server.SpanID {
+		t.Fatalf("unexpected parent chain: server=%+v client=%+v", server, clientSpan)
+	}
+	if clientSpan.Kind != SpanKindClient || clientSpan.SpanID != hexSpanID(sc) {
+		t.Fatalf("unexpected client span %+v", clientSpan)
+	}
+}
+
+func hexSpanID(sc SpanContext) string {
+	return strings.Split(sc.Traceparent(), "-")[2]
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"io"
+	"net/http"
+)
+
+// Transport 包装 RoundTripper：每次往返创建一个 client span 并注入 traceparent，
+// span 在响应体关闭（流式响应读完）时结束
+func Transport(base http.RoundTripper, name string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &tracedTransport{base: base, name: name}
+}
+
+type tracedTransport struct {
+	base http.RoundTripper
+	name string
+}
+
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), t.name, SpanKindClient)
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+	orig := req
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	span.SetAttr("http.request.method", req.Method)
+	span.SetAttr("server.address", req.URL.Host)
+	span.SetAttr("url.path", req.URL.Path)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return nil, err
+	}
+	// 响应处理（翻译、计费）不属于本次往返，恢复调用方的请求，使其后续 span 挂在原父 span 下
+	if resp.Request == req {
+		resp.Request = orig
+	}
+	span.SetAttr("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		span.SetErrorMessage(resp.Status)
+	}
+	// 协议升级（WebSocket）的响应体需保持 io.ReadWriteCloser，不做包装
+	if resp.StatusCode == http.StatusSwitchingProtocols || resp.Body == nil {
+		span.End()
+		return resp, nil
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+	return resp, nil
+}
+
+// spanBody 在响应体读到 EOF、出错或关闭时结束 span
+type spanBody struct {
+	io.ReadCloser
+	span *Span
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.span.End()
+	} else if err != nil {
+		b.span.SetError(err)
+		b.span.End()
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	b.span.End()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,497 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Claude Messages client -> OpenAI Chat Completions upstream.
+
+// claudeThinkingEffort maps a Claude thinking budget to an OpenAI reasoning effort.
+func claudeThinkingEffort(budget int64) string {
+	switch {
+	case budget <= 0:
+		return "medium"
+	case budget < 4096:
+		return "low"
+	case budget < 16384:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// ConvertClaudeRequestToOpenAIChat converts a Claude /v1/messages request to a
+// /v1/chat/completions request. Thinking blocks are sent back as reasoning_content,
+// tool_result blocks become role "tool" messages.
+func ConvertClaudeRequestToOpenAIChat(model string, rawJSON []byte, stream bool) ([]byte, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return nil, fmt.Errorf("claude request: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	out := `{}`
+
+	if model == "" {
+		model = root.Get("model").String()
+	}
+	out, _ = sjson.Set(out, "model", model)
+
+	var messages []string
+	if system := claudeSystemText(root.Get("system")); system != "" {
+		msg, _ := sjson.Set(`{"role":"system"}`, "content", system)
+		messages = append(messages, msg)
+	}
+	for _, m := range root.Get("messages").Array() {
+		messages = append(messages, claudeMessageToOpenAIChat(m)...)
+	}
+	out, _ = sjson.SetRaw(out, "messages", "["+strings.Join(messages, ",")+"]")
+
+	if v := root.Get("max_tokens"); v.Exists() {
+		out, _ = sjson.Set(out, "max_tokens", v.Int())
+	}
+	for _, key := range []string{"temperature", "top_p"} {
+		if v := root.Get(key); v.Exists() {
+			out, _ = sjson.SetRaw(out, key, v.Raw)
+		}
+	}
+	if stops := root.Get("stop_sequences"); stops.IsArray() && len(stops.Array()) > 0 {
+		out, _ = sjson.SetRaw(out, "stop", stops.Raw)
+	}
+	if user := root.Get("metadata.user_id").String(); user != "" {
+		out, _ = sjson.Set(out, "user", user)
+	}
+
+	if thinking := root.Get("thinking"); thinking.Get("type").String() == "enabled" {
+		out, _ = sjson.Set(out, "reasoning_effort", claudeThinkingEffort(thinking.Get("budget_tokens").Int()))
+	}
+
+	var tools []string
+	for _, tool := range root.Get("tools").Array() {
+		// Server tools (web_search_20250305, bash_20250124, ...) have no function equivalent.
+		if t := tool.Get("type").String(); t != "" && t != "custom" {
+			continue
+		}
+		fn := `{"type":"function","function":{}}`
+		fn, _ = sjson.Set(fn, "function.name", tool.Get("name").String())
+		if desc := tool.Get("description").String(); desc != "" {
+			fn, _ = sjson.Set(fn, "function.description", desc)
+		}
+		if schema := tool.Get("input_schema"); schema.IsObject() {
+			fn, _ = sjson.SetRaw(fn, "function.parameters", schema.Raw)
+		} else {
+			fn, _ = sjson.SetRaw(fn, "function.parameters", `{"type":"object","properties":{}}`)
+		}
+		tools = append(tools, fn)
+	}
+	if len(tools) > 0 {
+		out, _ = sjson.SetRaw(out, "tools", "["+strings.Join(tools, ",")+"]")
+
+		choice := root.Get("tool_choice")
+		switch choice.Get("type").String() {
+		case "auto":
+			out, _ = sjson.Set(out, "tool_choice", "auto")
+		case "any":
+			out, _ = sjson.Set(out, "tool_choice", "required")
+		case "none":
+			out, _ = sjson.Set(out, "tool_choice", "none")
+		case "tool":
+			tc, _ := sjson.Set(`{"type":"function","function":{}}`, "function.name", choice.Get("name").String())
+			out, _ = sjson.SetRaw(out, "tool_choice", tc)
+		}
+		if choice.Get("disable_parallel_tool_use").Bool() {
+			out, _ = sjson.Set(out, "parallel_tool_calls", false)
+		}
+	}
+
+	if stream {
+		out, _ = sjson.Set(out, "stream", true)
+		out, _ = sjson.Set(out, "stream_options.include_usage", true)
+	}
+	return []byte(out), nil
+}
+
+// claudeSystemText flattens a Claude system prompt (string or text blocks).
+func claudeSystemText(system gjson.Result) string {
+	if system.Type == gjson.String {
+		return system.String()
+	}
+	var parts []string
+	for _, block := range system.Array() {
+		if text := block.Get("text").String(); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// claudeImageURL returns the image_url for a Claude image block.
+func claudeImageURL(block gjson.Result) string {
+	source := block.Get("source")
+	switch source.Get("type").String() {
+	case "base64":
+		return "data:" + source.Get("media_type").String() + ";base64," + source.Get("data").String()
+	case "url":
+		return source.Get("url").String()
+	}
+	return ""
+}
+
+// claudeToolResultContent flattens the content of a tool_result block.
+func claudeToolResultContent(block gjson.Result) string {
+	content := block.Get("content")
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	var parts []string
+	for _, item := range content.Array() {
+		switch item.Get("type").String() {
+		case "text":
+			parts = append(parts, item.Get("text").String())
+		case "image":
+			parts = append(parts, "[image]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// claudeMessageToOpenAIChat converts one Claude message to one or more chat messages.
+// Tool results are emitted first because OpenAI requires them right after the
+// assistant message that issued the tool calls.
+func claudeMessageToOpenAIChat(m gjson.Result) []string {
+	role := m.Get("role").String()
+	content := m.Get("content")
+	if content.Type == gjson.String {
+		msg, _ := sjson.Set(`{}`, "role", role)
+		msg, _ = sjson.Set(msg, "content", content.String())
+		return []string{msg}
+	}
+
+	var out []string
+	if role == "assistant" {
+		var text, reasoning strings.Builder
+		var toolCalls []string
+		for _, block := range content.Array() {
+			switch block.Get("type").String() {
+			case "text":
+				text.WriteString(block.Get("text").String())
+			case "thinking":
+				reasoning.WriteString(block.Get("thinking").String())
+			case "tool_use":
+				args := block.Get("input").Raw
+				if args == "" {
+					args = "{}"
+				}
+				call := `{"id":"","type":"function","function":{}}`
+				call, _ = sjson.Set(call, "id", block.Get("id").String())
+				call, _ = sjson.Set(call, "function.name", block.Get("name").String())
+				call, _ = sjson.Set(call, "function.arguments", args)
+				toolCalls = append(toolCalls, call)
+			}
+		}
+		msg := `{"role":"assistant"}`
+		if text.Len() > 0 || len(toolCalls) == 0 {
+			msg, _ = sjson.Set(msg, "content", text.String())
+		} else {
+			msg, _ = sjson.SetRaw(msg, "content", "null")
+		}
+		if reasoning.Len() > 0 {
+			msg, _ = sjson.Set(msg, "reasoning_content", reasoning.String())
+		}
+		if len(toolCalls) > 0 {
+			msg, _ = sjson.SetRaw(msg, "tool_calls", "["+strings.Join(toolCalls, ",")+"]")
+		}
+		return append(out, msg)
+	}
+
+	var parts []string
+	for _, block := range content.Array() {
+		switch block.Get("type").String() {
+		case "text":
+			part, _ := sjson.Set(`{"type":"text"}`, "text", block.Get("text").String())
+			parts = append(parts, part)
+		case "image":
+			if url := claudeImageURL(block); url != "" {
+				part, _ := sjson.Set(`{"type":"image_url","image_url":{}}`, "image_url.url", url)
+				parts = append(parts, part)
+			}
+		case "tool_result":
+			text := claudeToolResultContent(block)
+			if block.Get("is_error").Bool() && text == "" {
+				text = "error"
+			}
+			msg, _ := sjson.Set(`{"role":"tool"}`, "tool_call_id", block.Get("tool_use_id").String())
+			msg, _ = sjson.Set(msg, "content", text)
+			out = append(out, msg)
+		}
+	}
+	if len(parts) > 0 {
+		msg, _ := sjson.Set(`{}`, "role", role)
+		msg, _ = sjson.SetRaw(msg, "content", "["+strings.Join(parts, ",")+"]")
+		out = append(out, msg)
+	}
+	return out
+}
+
+// openAIChatUsageToClaude converts OpenAI usage; cached prompt tokens are reported
+// separately as cache reads, as Claude does.
+func openAIChatUsageToClaude(usage gjson.Result) string {
+	cached := usage.Get("prompt_tokens_details.cached_tokens").Int()
+	input := usage.Get("prompt_tokens").Int() - cached
+	if input < 0 {
+		input = 0
+	}
+	out, _ := sjson.Set(`{}`, "input_tokens", input)
+	out, _ = sjson.Set(out, "output_tokens", usage.Get("completion_tokens").Int())
+	if cached > 0 {
+		out, _ = sjson.Set(out, "cache_read_input_tokens", cached)
+	}
+	return out
+}
+
+// openAIErrorToClaude converts an OpenAI error payload to a Claude error payload.
+func openAIErrorToClaude(errObj gjson.Result) string {
+	errType := errObj.Get("type").String()
+	if errType == "" || errType == "invalid_request_error" {
+		errType = "invalid_request_error"
+	} else if errType != "rate_limit_error" && errType != "authentication_error" && errType != "permission_error" && errType != "not_found_error" && errType != "overloaded_error" {
+		errType = "api_error"
+	}
+	out, _ := sjson.Set(`{"type":"error","error":{}}`, "error.type", errType)
+	out, _ = sjson.Set(out, "error.message", errObj.Get("message").String())
+	return out
+}
+
+// ConvertOpenAIChatResponseToClaudeNonStream converts a chat.completion response to a Claude message.
+func ConvertOpenAIChatResponseToClaudeNonStream(_ context.Context, model string, _, _, rawJSON []byte, _ *any) (string, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return "", fmt.Errorf("openai chat response: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	if errObj := root.Get("error"); errObj.IsObject() {
+		return openAIErrorToClaude(errObj), nil
+	}
+
+	out := `{"id":"","type":"message","role":"assistant","model":"","content":[],"stop_reason":null,"stop_sequence":null}`
+	out, _ = sjson.Set(out, "id", root.Get("id").String())
+	if m := root.Get("model").String(); m != "" {
+		model = m
+	}
+	out, _ = sjson.Set(out, "model", model)
+
+	choice := root.Get("choices.0")
+	message := choice.Get("message")
+	if reasoning := message.Get("reasoning_content").String(); reasoning != "" {
+		block, _ := sjson.Set(`{"type":"thinking","thinking":"","signature":""}`, "thinking", reasoning)
+		out, _ = sjson.SetRaw(out, "content.-1", block)
+	}
+	if text := message.Get("content").String(); text != "" {
+		block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+		out, _ = sjson.SetRaw(out, "content.-1", block)
+	}
+	for _, call := range message.Get("tool_calls").Array() {
+		block := `{"type":"tool_use","id":""}`
+		block, _ = sjson.Set(block, "id", call.Get("id").String())
+		block, _ = sjson.Set(block, "name", call.Get("function.name").String())
+		block, _ = sjson.SetRaw(block, "input", toolArgumentsObject(call.Get("function.arguments").String()))
+		out, _ = sjson.SetRaw(out, "content.-1", block)
+	}
+
+	reason, stopSequence := openAIChatFinish(choice)
+	out, _ = sjson.Set(out, "stop_reason", reason.ClaudeStopReason())
+	if stopSequence != "" {
+		out, _ = sjson.Set(out, "stop_sequence", stopSequence)
+	}
+	out, _ = sjson.SetRaw(out, "usage", openAIChatUsageToClaude(root.Get("usage")))
+	return out, nil
+}
+
+// toolArgumentsObject returns tool call arguments as a JSON object, falling back to
+// an empty object when the model produced invalid JSON.
+func toolArgumentsObject(args string) string {
+	if args = strings.TrimSpace(args); args != "" && gjson.Valid(args) && gjson.Parse(args).IsObject() {
+		return args
+	}
+	return "{}"
+}
+
+// openAIChatToClaudeStreamState tracks the Claude content blocks opened while
+// converting an OpenAI chat stream.
+type openAIChatToClaudeStreamState struct {
+	started bool
+	done    bool
+	// nextIndex is the index of the next Claude content block.
+	nextIndex int
+	// open is the index of the open text/thinking/tool block, -1 when none.
+	open     int
+	openType string
+	// toolBlocks maps OpenAI tool call indexes to Claude block indexes.
+	toolBlocks   map[int64]int
+	stopReason   string
+	stopSequence string
+	usage        gjson.Result
+	messageID    string
+	messageModel string
+	// startUsage is the usage sent in message_start, reused in message_delta
+	// when the upstream never reports usage.
+	startUsage string
+}
+
+// claudeSSE renders one Claude SSE event.
+func claudeSSE(event, data string) string {
+	return FormatSSEEvent(event, data)
+}
+
+func (s *openAIChatToClaudeStreamState) closeBlock(out []string) []string {
+	if s.open < 0 {
+		return out
+	}
+	stop, _ := sjson.Set(`{"type":"content_block_stop"}`, "index", s.open)
+	s.open, s.openType = -1, ""
+	return append(out, claudeSSE("content_block_stop", stop))
+}
+
+func (s *openAIChatToClaudeStreamState) openBlock(out []string, blockType, contentBlock string) []string {
+	out = s.closeBlock(out)
+	s.open, s.openType = s.nextIndex, blockType
+	s.nextIndex++
+	start, _ := sjson.Set(`{"type":"content_block_start"}`, "index", s.open)
+	start, _ = sjson.SetRaw(start, "content_block", contentBlock)
+	return append(out, claudeSSE("content_block_start", start))
+}
+
+func (s *openAIChatToClaudeStreamState) delta(out []string, index int, delta string) []string {
+	ev, _ := sjson.Set(`{"type":"content_block_delta"}`, "index", index)
+	ev, _ = sjson.SetRaw(ev, "delta", delta)
+	return append(out, claudeSSE("content_block_delta", ev))
+}
+
+func (s *openAIChatToClaudeStreamState) finish(out []string) []string {
+	if s.done {
+		return out
+	}
+	s.done = true
+	out = s.closeBlock(out)
+	if s.stopReason == "" {
+		s.stopReason = FinishReasonStop.ClaudeStopReason()
+	}
+	msgDelta := `{"type":"message_delta","delta":{"stop_sequence":null}}`
+	msgDelta, _ = sjson.Set(msgDelta, "delta.stop_reason", s.stopReason)
+	if s.stopSequence != "" {
+		msgDelta, _ = sjson.Set(msgDelta, "delta.stop_sequence", s.stopSequence)
+	}
+	usage := s.startUsage
+	if s.usage.IsObject() {
+		usage = openAIChatUsageToClaude(s.usage)
+	}
+	msgDelta, _ = sjson.SetRaw(msgDelta, "usage", usage)
+	out = append(out, claudeSSE("message_delta", msgDelta))
+	return append(out, claudeSSE("message_stop", `{"type":"message_stop"}`))
+}
+
+// ConvertOpenAIChatResponseToClaude converts one OpenAI chat stream chunk ("[DONE]"
+// marks the end of the stream) to Claude SSE events. Each returned string is a
+// complete SSE event. message_start carries the prompt tokens of the first chunk,
+// or an estimate from the request when the upstream only reports usage at the end.
+func ConvertOpenAIChatResponseToClaude(_ context.Context, model string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) ([]string, error) {
+	if *param == nil {
+		*param = &openAIChatToClaudeStreamState{open: -1, toolBlocks: make(map[int64]int)}
+	}
+	s := (*param).(*openAIChatToClaudeStreamState)
+	if s.done {
+		return nil, nil
+	}
+
+	var out []string
+	if strings.TrimSpace(string(rawJSON)) == "[DONE]" {
+		if !s.started {
+			return nil, nil
+		}
+		return s.finish(out), nil
+	}
+	if !gjson.ValidBytes(rawJSON) {
+		return nil, fmt.Errorf("openai chat stream: invalid JSON chunk")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	if errObj := root.Get("error"); errObj.IsObject() {
+		s.done = true
+		return []string{claudeSSE("error", openAIErrorToClaude(errObj))}, nil
+	}
+
+	if !s.started {
+		s.started = true
+		s.messageID = root.Get("id").String()
+		s.messageModel = root.Get("model").String()
+		if s.messageModel == "" {
+			s.messageModel = model
+		}
+		var firstUsage string
+		if usage := root.Get("usage"); usage.IsObject() {
+			firstUsage = openAIChatUsageToClaude(usage)
+		}
+		s.startUsage = claudeStartUsage(firstUsage, s.messageModel, originalRequestRawJSON, requestRawJSON)
+		start := `{"type":"message_start","message":{"id":"","type":"message","role":"assistant","model":"","content":[],"stop_reason":null,"stop_sequence":null,"usage":{}}}`
+		start, _ = sjson.Set(start, "message.id", s.messageID)
+		start, _ = sjson.Set(start, "message.model", s.messageModel)
+		start, _ = sjson.SetRaw(start, "message.usage", s.startUsage)
+		out = append(out, claudeSSE("message_start", start))
+	}
+
+	if usage := root.Get("usage"); usage.IsObject() {
+		s.usage = usage
+	}
+
+	choice := root.Get("choices.0")
+	delta := choice.Get("delta")
+	reasoning := delta.Get("reasoning_content").String()
+	if reasoning == "" {
+		reasoning = delta.Get("reasoning").String()
+	}
+	if reasoning != "" {
+		if s.openType != "thinking" {
+			out = s.openBlock(out, "thinking", `{"type":"thinking","thinking":"","signature":""}`)
+		}
+		d, _ := sjson.Set(`{"type":"thinking_delta"}`, "thinking", reasoning)
+		out = s.delta(out, s.open, d)
+	}
+	if text := delta.Get("content").String(); text != "" {
+		if s.openType != "text" {
+			out = s.openBlock(out, "text", `{"type":"text","text":""}`)
+		}
+		d, _ := sjson.Set(`{"type":"text_delta"}`, "text", text)
+		out = s.delta(out, s.open, d)
+	}
+	for _, call := range delta.Get("tool_calls").Array() {
+		toolIndex := call.Get("index").Int()
+		blockIndex, seen := s.toolBlocks[toolIndex]
+		if !seen {
+			block := `{"type":"tool_use","id":"","name":"","input":{}}`
+			block, _ = sjson.Set(block, "id", call.Get("id").String())
+			block, _ = sjson.Set(block, "name", call.Get("function.name").String())
+			out = s.openBlock(out, "tool_use", block)
+			blockIndex = s.open
+			s.toolBlocks[toolIndex] = blockIndex
+		}
+		// OpenAI streams tool calls one after another; arguments for an earlier
+		// call are still addressed to its own block index.
+		if args := call.Get("function.arguments").String(); args != "" {
+			d, _ := sjson.Set(`{"type":"input_json_delta"}`, "partial_json", args)
+			out = s.delta(out, blockIndex, d)
+		}
+	}
+
+	if fr := choice.Get("finish_reason"); fr.Exists() && fr.Type != gjson.Null {
+		reason, stopSequence := openAIChatFinish(choice)
+		s.stopReason, s.stopSequence = reason.ClaudeStopReason(), stopSequence
+		out = s.closeBlock(out)
+	}
+	return out, nil
+}
+
+// ConvertOpenAIChatTokenCountToClaude renders a token count as a Claude count_tokens response.
+func ConvertOpenAIChatTokenCountToClaude(_ context.Context, count int64) string {
+	return fmt.Sprintf(`{"input_tokens":%d}`, count)
+}
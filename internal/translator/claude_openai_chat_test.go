@@ -0,0 +1,149 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertClaudeRequestToOpenAIChat(t *testing.T) {
+	in := `{
+		"model": "claude-sonnet-4",
+		"max_tokens": 1024,
+		"system": [{"type":"text","text":"be brief"}],
+		"thinking": {"type":"enabled","budget_tokens":8000},
+		"tools": [{"name":"read","description":"read a file","input_schema":{"type":"object","properties":{"path":{"type":"string"}}}},{"type":"web_search_20250305","name":"web_search"}],
+		"tool_choice": {"type":"any","disable_parallel_tool_use":true},
+		"messages": [
+			{"role":"user","content":"open a.txt"},
+			{"role":"assistant","content":[{"type":"thinking","thinking":"need the file","signature":"s"},{"type":"tool_use","id":"toolu_1","name":"read","input":{"path":"a.txt"}}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"hello"}]},{"type":"text","text":"summarize"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAA"}}]}
+		]
+	}`
+	out, err := ConvertClaudeRequestToOpenAIChat("gpt-4o", []byte(in), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.ParseBytes(out)
+	checks := map[string]string{
+		"model":                                 "gpt-4o",
+		"max_tokens":                            "1024",
+		"reasoning_effort":                      "medium",
+		"tool_choice":                           "required",
+		"parallel_tool_calls":                   "false",
+		"stream_options.include_usage":          "true",
+		"tools.#":                               "1",
+		"tools.0.function.name":                 "read",
+		"messages.#":                            "5",
+		"messages.0.role":                       "system",
+		"messages.0.content":                    "be brief",
+		"messages.2.content":                    "",
+		"messages.2.reasoning_content":          "need the file",
+		"messages.2.tool_calls.0.id":            "toolu_1",
+		"messages.2.tool_calls.0.function.name": "read",
+		"messages.3.role":                       "tool",
+		"messages.3.tool_call_id":               "toolu_1",
+		"messages.3.content":                    "hello",
+		"messages.4.role":                       "user",
+		"messages.4.content.0.text":             "summarize",
+		"messages.4.content.1.image_url.url":    "data:image/png;base64,AAA",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if args := res.Get("messages.2.tool_calls.0.function.arguments").String(); gjson.Get(args, "path").String() != "a.txt" {
+		t.Errorf("unexpected tool arguments %s", args)
+	}
+}
+
+func TestConvertOpenAIChatResponseToClaudeNonStream(t *testing.T) {
+	in := `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"let me check","reasoning_content":"hmm","tool_calls":[{"id":"call_1","type":"function","function":{"name":"read","arguments":"{\"path\":\"a.txt\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":100,"completion_tokens":20,"prompt_tokens_details":{"cached_tokens":60}}}`
+	out, err := ConvertOpenAIChatResponseToClaudeNonStream(context.Background(), "m", nil, nil, []byte(in), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.Parse(out)
+	checks := map[string]string{
+		"type":                          "message",
+		"stop_reason":                   "tool_use",
+		"content.0.type":                "thinking",
+		"content.0.thinking":            "hmm",
+		"content.1.text":                "let me check",
+		"content.2.type":                "tool_use",
+		"content.2.id":                  "call_1",
+		"content.2.input.path":          "a.txt",
+		"usage.input_tokens":            "40",
+		"usage.cache_read_input_tokens": "60",
+		"usage.output_tokens":           "20",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+
+	errOut, _ := ConvertOpenAIChatResponseToClaudeNonStream(context.Background(), "m", nil, nil, []byte(`{"error":{"message":"slow down","type":"rate_limit_error"}}`), nil)
+	if gjson.Get(errOut, "type").String() != "error" || gjson.Get(errOut, "error.type").String() != "rate_limit_error" {
+		t.Errorf("unexpected error conversion %s", errOut)
+	}
+}
+
+// claudeEvents parses the SSE events produced by a stream translator.
+func claudeEvents(t *testing.T, chunks []string) []gjson.Result {
+	t.Helper()
+	var events []gjson.Result
+	for _, chunk := range chunks {
+		for _, line := range strings.Split(chunk, "\n") {
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				events = append(events, gjson.Parse(data))
+			}
+		}
+	}
+	return events
+}
+
+func TestConvertOpenAIChatResponseToClaudeStream(t *testing.T) {
+	chunks := []string{
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"think"}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read","arguments":""}}]}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":"}}]}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"a\"}"}}]}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"id":"c1","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5}}`,
+		`[DONE]`,
+		`[DONE]`,
+	}
+	var param any
+	var out []string
+	for _, chunk := range chunks {
+		got, err := ConvertOpenAIChatResponseToClaude(context.Background(), "m", nil, nil, []byte(chunk), &param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, got...)
+	}
+
+	var types []string
+	var args strings.Builder
+	for _, ev := range claudeEvents(t, out) {
+		types = append(types, ev.Get("type").String())
+		args.WriteString(ev.Get("delta.partial_json").String())
+	}
+	want := "message_start content_block_start content_block_delta content_block_stop content_block_start content_block_delta content_block_stop content_block_start content_block_delta content_block_delta content_block_stop message_delta message_stop"
+	if got := strings.Join(types, " "); got != want {
+		t.Fatalf("events:\n got %s\nwant %s", got, want)
+	}
+	if args.String() != `{"path":"a"}` {
+		t.Errorf("tool arguments = %s", args.String())
+	}
+	last := claudeEvents(t, out)
+	msgDelta := last[len(last)-2]
+	if msgDelta.Get("delta.stop_reason").String() != "tool_use" || msgDelta.Get("usage.output_tokens").Int() != 5 {
+		t.Errorf("unexpected message_delta %s", msgDelta.Raw)
+	}
+}
@@ -0,0 +1,487 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Claude Messages client -> OpenAI Responses upstream.
+
+// ConvertClaudeRequestToOpenAIResponses converts a Claude /v1/messages request to a
+// /v1/responses request. The system prompt becomes instructions, tool_use blocks
+// become function_call items and tool_result blocks become function_call_output
+// items. Thinking blocks are dropped since Responses only accepts reasoning items
+// it produced itself.
+func ConvertClaudeRequestToOpenAIResponses(model string, rawJSON []byte, stream bool) ([]byte, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return nil, fmt.Errorf("claude request: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	out := `{}`
+
+	if model == "" {
+		model = root.Get("model").String()
+	}
+	out, _ = sjson.Set(out, "model", model)
+
+	if system := claudeSystemText(root.Get("system")); system != "" {
+		out, _ = sjson.Set(out, "instructions", system)
+	}
+	var input []string
+	for _, m := range root.Get("messages").Array() {
+		input = append(input, claudeMessageToOpenAIResponses(m)...)
+	}
+	out, _ = sjson.SetRaw(out, "input", "["+strings.Join(input, ",")+"]")
+
+	if v := root.Get("max_tokens"); v.Exists() {
+		out, _ = sjson.Set(out, "max_output_tokens", v.Int())
+	}
+	for _, key := range []string{"temperature", "top_p"} {
+		if v := root.Get(key); v.Exists() {
+			out, _ = sjson.SetRaw(out, key, v.Raw)
+		}
+	}
+	if user := root.Get("metadata.user_id").String(); user != "" {
+		out, _ = sjson.Set(out, "user", user)
+	}
+
+	if thinking := root.Get("thinking"); thinking.Get("type").String() == "enabled" {
+		out, _ = sjson.Set(out, "reasoning.effort", claudeThinkingEffort(thinking.Get("budget_tokens").Int()))
+		// Without a summary the upstream returns no readable reasoning to map back.
+		out, _ = sjson.Set(out, "reasoning.summary", "auto")
+	}
+
+	var tools []string
+	for _, tool := range root.Get("tools").Array() {
+		if t := tool.Get("type").String(); t != "" && t != "custom" {
+			continue
+		}
+		// Responses defaults function tools to strict schemas, which Claude schemas rarely satisfy.
+		fn := `{"type":"function","name":"","strict":false}`
+		fn, _ = sjson.Set(fn, "name", tool.Get("name").String())
+		if desc := tool.Get("description").String(); desc != "" {
+			fn, _ = sjson.Set(fn, "description", desc)
+		}
+		if schema := tool.Get("input_schema"); schema.IsObject() {
+			fn, _ = sjson.SetRaw(fn, "parameters", schema.Raw)
+		} else {
+			fn, _ = sjson.SetRaw(fn, "parameters", `{"type":"object","properties":{}}`)
+		}
+		tools = append(tools, fn)
+	}
+	if len(tools) > 0 {
+		out, _ = sjson.SetRaw(out, "tools", "["+strings.Join(tools, ",")+"]")
+
+		choice := root.Get("tool_choice")
+		switch choice.Get("type").String() {
+		case "auto":
+			out, _ = sjson.Set(out, "tool_choice", "auto")
+		case "any":
+			out, _ = sjson.Set(out, "tool_choice", "required")
+		case "none":
+			out, _ = sjson.Set(out, "tool_choice", "none")
+		case "tool":
+			tc, _ := sjson.Set(`{"type":"function"}`, "name", choice.Get("name").String())
+			out, _ = sjson.SetRaw(out, "tool_choice", tc)
+		}
+		if choice.Get("disable_parallel_tool_use").Bool() {
+			out, _ = sjson.Set(out, "parallel_tool_calls", false)
+		}
+	}
+
+	if stream {
+		out, _ = sjson.Set(out, "stream", true)
+	}
+	return []byte(out), nil
+}
+
+// claudeMessageToOpenAIResponses converts one Claude message to Responses input items,
+// keeping the order of text and tool blocks. Tool results are emitted first because
+// they answer the function calls of the previous assistant turn.
+func claudeMessageToOpenAIResponses(m gjson.Result) []string {
+	role := m.Get("role").String()
+	content := m.Get("content")
+	if content.Type == gjson.String {
+		item, _ := sjson.Set(`{"type":"message"}`, "role", role)
+		item, _ = sjson.Set(item, "content", content.String())
+		return []string{item}
+	}
+
+	var out []string
+	if role == "assistant" {
+		var text strings.Builder
+		flush := func() {
+			if text.Len() == 0 {
+				return
+			}
+			item, _ := sjson.Set(`{"type":"message","role":"assistant","content":[{"type":"output_text"}]}`, "content.0.text", text.String())
+			out = append(out, item)
+			text.Reset()
+		}
+		for _, block := range content.Array() {
+			switch block.Get("type").String() {
+			case "text":
+				text.WriteString(block.Get("text").String())
+			case "tool_use":
+				flush()
+				args := block.Get("input").Raw
+				if args == "" {
+					args = "{}"
+				}
+				item := `{"type":"function_call","call_id":""}`
+				item, _ = sjson.Set(item, "call_id", block.Get("id").String())
+				item, _ = sjson.Set(item, "name", block.Get("name").String())
+				item, _ = sjson.Set(item, "arguments", args)
+				out = append(out, item)
+			}
+		}
+		flush()
+		return out
+	}
+
+	var parts []string
+	for _, block := range content.Array() {
+		switch block.Get("type").String() {
+		case "text":
+			part, _ := sjson.Set(`{"type":"input_text"}`, "text", block.Get("text").String())
+			parts = append(parts, part)
+		case "image":
+			if url := claudeImageURL(block); url != "" {
+				part, _ := sjson.Set(`{"type":"input_image"}`, "image_url", url)
+				parts = append(parts, part)
+			}
+		case "tool_result":
+			text := claudeToolResultContent(block)
+			if block.Get("is_error").Bool() && text == "" {
+				text = "error"
+			}
+			item, _ := sjson.Set(`{"type":"function_call_output"}`, "call_id", block.Get("tool_use_id").String())
+			item, _ = sjson.Set(item, "output", text)
+			out = append(out, item)
+		}
+	}
+	if len(parts) > 0 {
+		item, _ := sjson.Set(`{"type":"message"}`, "role", role)
+		item, _ = sjson.SetRaw(item, "content", "["+strings.Join(parts, ",")+"]")
+		out = append(out, item)
+	}
+	return out
+}
+
+// openAIResponsesUsageToClaude converts Responses usage; cached input tokens are
+// reported separately as cache reads, as Claude does.
+func openAIResponsesUsageToClaude(usage gjson.Result) string {
+	cached := usage.Get("input_tokens_details.cached_tokens").Int()
+	input := usage.Get("input_tokens").Int() - cached
+	if input < 0 {
+		input = 0
+	}
+	out, _ := sjson.Set(`{}`, "input_tokens", input)
+	out, _ = sjson.Set(out, "output_tokens", usage.Get("output_tokens").Int())
+	if cached > 0 {
+		out, _ = sjson.Set(out, "cache_read_input_tokens", cached)
+	}
+	return out
+}
+
+// openAIResponsesReasoningText joins the summary (or raw reasoning) text of a reasoning item.
+func openAIResponsesReasoningText(item gjson.Result) string {
+	var parts []string
+	for _, part := range item.Get("summary").Array() {
+		if text := part.Get("text").String(); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 {
+		for _, part := range item.Get("content").Array() {
+			if text := part.Get("text").String(); text != "" {
+				parts = append(parts, text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// openAIResponsesMessageText joins the output_text and refusal parts of a message item.
+func openAIResponsesMessageText(item gjson.Result) string {
+	var text strings.Builder
+	for _, part := range item.Get("content").Array() {
+		switch part.Get("type").String() {
+		case "output_text":
+			text.WriteString(part.Get("text").String())
+		case "refusal":
+			text.WriteString(part.Get("refusal").String())
+		}
+	}
+	return text.String()
+}
+
+// ConvertOpenAIResponsesResponseToClaudeNonStream converts a response object to a Claude message.
+func ConvertOpenAIResponsesResponseToClaudeNonStream(_ context.Context, model string, _, _, rawJSON []byte, _ *any) (string, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return "", fmt.Errorf("openai responses response: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	if errObj := root.Get("error"); errObj.IsObject() {
+		return openAIErrorToClaude(errObj), nil
+	}
+
+	out := `{"id":"","type":"message","role":"assistant","model":"","content":[],"stop_reason":null,"stop_sequence":null}`
+	out, _ = sjson.Set(out, "id", root.Get("id").String())
+	if m := root.Get("model").String(); m != "" {
+		model = m
+	}
+	out, _ = sjson.Set(out, "model", model)
+
+	sawFunctionCall := false
+	for _, item := range root.Get("output").Array() {
+		switch item.Get("type").String() {
+		case "reasoning":
+			if text := openAIResponsesReasoningText(item); text != "" {
+				block, _ := sjson.Set(`{"type":"thinking","thinking":"","signature":""}`, "thinking", text)
+				out, _ = sjson.SetRaw(out, "content.-1", block)
+			}
+		case "message":
+			if text := openAIResponsesMessageText(item); text != "" {
+				block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+				out, _ = sjson.SetRaw(out, "content.-1", block)
+			}
+		case "function_call":
+			sawFunctionCall = true
+			block := `{"type":"tool_use","id":""}`
+			block, _ = sjson.Set(block, "id", item.Get("call_id").String())
+			block, _ = sjson.Set(block, "name", item.Get("name").String())
+			block, _ = sjson.SetRaw(block, "input", toolArgumentsObject(item.Get("arguments").String()))
+			out, _ = sjson.SetRaw(out, "content.-1", block)
+		}
+	}
+
+	out, _ = sjson.Set(out, "stop_reason", FinishReasonFromOpenAIResponses(root, sawFunctionCall).ClaudeStopReason())
+	out, _ = sjson.SetRaw(out, "usage", openAIResponsesUsageToClaude(root.Get("usage")))
+	return out, nil
+}
+
+// openAIResponsesToClaudeStreamState tracks the Claude content blocks opened while
+// converting a Responses event stream. Claude blocks cannot interleave, so a new
+// output item closes the previous block.
+type openAIResponsesToClaudeStreamState struct {
+	started bool
+	done    bool
+	// nextIndex is the index of the next Claude content block.
+	nextIndex int
+	// open is the index of the open block, -1 when none.
+	open     int
+	openType string
+	// items maps Responses output indexes to their Claude blocks.
+	items           map[int64]*responsesItemBlock
+	sawFunctionCall bool
+	// startUsage is the usage sent in message_start, reused in message_delta
+	// when the upstream never reports usage.
+	startUsage string
+}
+
+// responsesItemBlock is the Claude block opened for one Responses output item.
+type responsesItemBlock struct {
+	index int
+	// streamed reports whether deltas were forwarded; otherwise the content of
+	// output_item.done is sent in one delta.
+	streamed bool
+}
+
+func (s *openAIResponsesToClaudeStreamState) closeBlock(out []string) []string {
+	if s.open < 0 {
+		return out
+	}
+	stop, _ := sjson.Set(`{"type":"content_block_stop"}`, "index", s.open)
+	s.open, s.openType = -1, ""
+	return append(out, claudeSSE("content_block_stop", stop))
+}
+
+func (s *openAIResponsesToClaudeStreamState) openBlock(out []string, outputIndex int64, blockType, contentBlock string) ([]string, *responsesItemBlock) {
+	out = s.closeBlock(out)
+	s.open, s.openType = s.nextIndex, blockType
+	s.nextIndex++
+	item := &responsesItemBlock{index: s.open}
+	s.items[outputIndex] = item
+	start, _ := sjson.Set(`{"type":"content_block_start"}`, "index", s.open)
+	start, _ = sjson.SetRaw(start, "content_block", contentBlock)
+	return append(out, claudeSSE("content_block_start", start)), item
+}
+
+// block returns the block for an output item, opening one of blockType for deltas
+// that arrive without a preceding output_item.added.
+func (s *openAIResponsesToClaudeStreamState) block(out []string, outputIndex int64, blockType, contentBlock string) ([]string, *responsesItemBlock) {
+	if item, ok := s.items[outputIndex]; ok {
+		return out, item
+	}
+	return s.openBlock(out, outputIndex, blockType, contentBlock)
+}
+
+func (s *openAIResponsesToClaudeStreamState) delta(out []string, item *responsesItemBlock, delta string) []string {
+	item.streamed = true
+	ev, _ := sjson.Set(`{"type":"content_block_delta"}`, "index", item.index)
+	ev, _ = sjson.SetRaw(ev, "delta", delta)
+	return append(out, claudeSSE("content_block_delta", ev))
+}
+
+func (s *openAIResponsesToClaudeStreamState) finish(out []string, response gjson.Result) []string {
+	if s.done {
+		return out
+	}
+	s.done = true
+	out = s.closeBlock(out)
+	msgDelta := `{"type":"message_delta","delta":{"stop_sequence":null}}`
+	msgDelta, _ = sjson.Set(msgDelta, "delta.stop_reason", FinishReasonFromOpenAIResponses(response, s.sawFunctionCall).ClaudeStopReason())
+	usage := s.startUsage
+	if u := response.Get("usage"); u.IsObject() {
+		usage = openAIResponsesUsageToClaude(u)
+	}
+	msgDelta, _ = sjson.SetRaw(msgDelta, "usage", usage)
+	out = append(out, claudeSSE("message_delta", msgDelta))
+	return append(out, claudeSSE("message_stop", `{"type":"message_stop"}`))
+}
+
+// ConvertOpenAIResponsesResponseToClaude converts one Responses stream event ("[DONE]"
+// marks the end of the stream) to Claude SSE events. Each returned string is a
+// complete SSE event. message_start carries the input tokens of the first event,
+// or an estimate from the request when the upstream only reports usage at the end.
+func ConvertOpenAIResponsesResponseToClaude(_ context.Context, model string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) ([]string, error) {
+	if *param == nil {
+		*param = &openAIResponsesToClaudeStreamState{open: -1, items: make(map[int64]*responsesItemBlock)}
+	}
+	s := (*param).(*openAIResponsesToClaudeStreamState)
+	if s.done {
+		return nil, nil
+	}
+
+	var out []string
+	if strings.TrimSpace(string(rawJSON)) == "[DONE]" {
+		if !s.started {
+			return nil, nil
+		}
+		return s.finish(out, gjson.Result{}), nil
+	}
+	if !gjson.ValidBytes(rawJSON) {
+		return nil, fmt.Errorf("openai responses stream: invalid JSON event")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	eventType := root.Get("type").String()
+
+	switch eventType {
+	case "error":
+		s.done = true
+		return []string{claudeSSE("error", openAIErrorToClaude(root))}, nil
+	case "response.failed":
+		s.done = true
+		errObj := root.Get("response.error")
+		if !errObj.IsObject() {
+			return []string{claudeSSE("error", `{"type":"error","error":{"type":"api_error","message":"upstream response failed"}}`)}, nil
+		}
+		return []string{claudeSSE("error", openAIErrorToClaude(errObj))}, nil
+	}
+
+	if !s.started {
+		s.started = true
+		response := root.Get("response")
+		messageModel := response.Get("model").String()
+		if messageModel == "" {
+			messageModel = model
+		}
+		var firstUsage string
+		if usage := response.Get("usage"); usage.IsObject() {
+			firstUsage = openAIResponsesUsageToClaude(usage)
+		}
+		s.startUsage = claudeStartUsage(firstUsage, messageModel, originalRequestRawJSON, requestRawJSON)
+		start := `{"type":"message_start","message":{"id":"","type":"message","role":"assistant","model":"","content":[],"stop_reason":null,"stop_sequence":null,"usage":{}}}`
+		start, _ = sjson.Set(start, "message.id", response.Get("id").String())
+		start, _ = sjson.Set(start, "message.model", messageModel)
+		start, _ = sjson.SetRaw(start, "message.usage", s.startUsage)
+		out = append(out, claudeSSE("message_start", start))
+	}
+
+	outputIndex := root.Get("output_index").Int()
+	switch eventType {
+	case "response.output_item.added":
+		item := root.Get("item")
+		switch item.Get("type").String() {
+		case "reasoning":
+			out, _ = s.openBlock(out, outputIndex, "thinking", `{"type":"thinking","thinking":"","signature":""}`)
+		case "message":
+			out, _ = s.openBlock(out, outputIndex, "text", `{"type":"text","text":""}`)
+		case "function_call":
+			s.sawFunctionCall = true
+			block := `{"type":"tool_use","id":"","name":"","input":{}}`
+			block, _ = sjson.Set(block, "id", item.Get("call_id").String())
+			block, _ = sjson.Set(block, "name", item.Get("name").String())
+			out, _ = s.openBlock(out, outputIndex, "tool_use", block)
+		}
+
+	case "response.output_text.delta", "response.refusal.delta":
+		var item *responsesItemBlock
+		out, item = s.block(out, outputIndex, "text", `{"type":"text","text":""}`)
+		if text := root.Get("delta").String(); text != "" {
+			d, _ := sjson.Set(`{"type":"text_delta"}`, "text", text)
+			out = s.delta(out, item, d)
+		}
+
+	case "response.reasoning_summary_part.added":
+		// Separate summary parts the way the non-stream conversion joins them.
+		if item, ok := s.items[outputIndex]; ok && root.Get("summary_index").Int() > 0 {
+			out = s.delta(out, item, `{"type":"thinking_delta","thinking":"\n\n"}`)
+		}
+
+	case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+		var item *responsesItemBlock
+		out, item = s.block(out, outputIndex, "thinking", `{"type":"thinking","thinking":"","signature":""}`)
+		if text := root.Get("delta").String(); text != "" {
+			d, _ := sjson.Set(`{"type":"thinking_delta"}`, "thinking", text)
+			out = s.delta(out, item, d)
+		}
+
+	case "response.function_call_arguments.delta":
+		if item, ok := s.items[outputIndex]; ok {
+			if args := root.Get("delta").String(); args != "" {
+				d, _ := sjson.Set(`{"type":"input_json_delta"}`, "partial_json", args)
+				out = s.delta(out, item, d)
+			}
+		}
+
+	case "response.output_item.done":
+		doneItem := root.Get("item")
+		item, ok := s.items[outputIndex]
+		if !ok {
+			break
+		}
+		// Upstreams that skip deltas only send the complete item here.
+		if !item.streamed {
+			switch doneItem.Get("type").String() {
+			case "reasoning":
+				if text := openAIResponsesReasoningText(doneItem); text != "" {
+					d, _ := sjson.Set(`{"type":"thinking_delta"}`, "thinking", text)
+					out = s.delta(out, item, d)
+				}
+			case "message":
+				if text := openAIResponsesMessageText(doneItem); text != "" {
+					d, _ := sjson.Set(`{"type":"text_delta"}`, "text", text)
+					out = s.delta(out, item, d)
+				}
+			case "function_call":
+				if args := doneItem.Get("arguments").String(); args != "" {
+					d, _ := sjson.Set(`{"type":"input_json_delta"}`, "partial_json", args)
+					out = s.delta(out, item, d)
+				}
+			}
+		}
+		if s.open == item.index {
+			out = s.closeBlock(out)
+		}
+
+	case "response.completed", "response.incomplete":
+		return s.finish(out, root.Get("response")), nil
+	}
+	return out, nil
+}
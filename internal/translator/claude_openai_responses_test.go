@@ -0,0 +1,165 @@
+package translator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertClaudeRequestToOpenAIResponses(t *testing.T) {
+	in := `{
+		"model": "claude-sonnet-4",
+		"max_tokens": 2048,
+		"system": [{"type":"text","text":"be brief"}],
+		"thinking": {"type":"enabled","budget_tokens":2000},
+		"tools": [{"name":"read","input_schema":{"type":"object","properties":{"path":{"type":"string"}}}},{"type":"web_search_20250305","name":"web_search"}],
+		"tool_choice": {"type":"any","disable_parallel_tool_use":true},
+		"messages": [
+			{"role":"user","content":[{"type":"text","text":"open a.txt"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAA"}}]},
+			{"role":"assistant","content":[{"type":"thinking","thinking":"hmm","signature":"s"},{"type":"text","text":"reading"},{"type":"tool_use","id":"toolu_1","name":"read","input":{"path":"a.txt"}}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"hello"}]},{"type":"text","text":"summarize"}]}
+		]
+	}`
+	out, err := ConvertClaudeRequestToOpenAIResponses("gpt-5", []byte(in), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.ParseBytes(out)
+	checks := map[string]string{
+		"model":                       "gpt-5",
+		"instructions":                "be brief",
+		"max_output_tokens":           "2048",
+		"reasoning.effort":            "low",
+		"stream":                      "true",
+		"tools.#":                     "1",
+		"tools.0.name":                "read",
+		"tools.0.strict":              "false",
+		"tool_choice":                 "required",
+		"parallel_tool_calls":         "false",
+		"input.#":                     "5",
+		"input.0.content.0.type":      "input_text",
+		"input.0.content.1.type":      "input_image",
+		"input.0.content.1.image_url": "data:image/png;base64,AAA",
+		"input.1.role":                "assistant",
+		"input.1.content.0.text":      "reading",
+		"input.2.type":                "function_call",
+		"input.2.call_id":             "toolu_1",
+		"input.3.type":                "function_call_output",
+		"input.3.output":              "hello",
+		"input.4.content.0.text":      "summarize",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if args := res.Get("input.2.arguments").String(); gjson.Get(args, "path").String() != "a.txt" {
+		t.Errorf("unexpected function call arguments %s", args)
+	}
+}
+
+func TestConvertOpenAIResponsesResponseToClaudeNonStream(t *testing.T) {
+	in := `{"id":"resp_1","object":"response","status":"completed","model":"gpt-5","output":[
+		{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"a"},{"type":"summary_text","text":"b"}]},
+		{"type":"message","id":"msg_1","role":"assistant","content":[{"type":"output_text","text":"checking"}]},
+		{"type":"function_call","id":"fc_1","call_id":"call_1","name":"read","arguments":"{\"path\":\"a.txt\"}"}
+	],"usage":{"input_tokens":40,"input_tokens_details":{"cached_tokens":30},"output_tokens":7}}`
+	out, err := ConvertOpenAIResponsesResponseToClaudeNonStream(context.Background(), "m", nil, nil, []byte(in), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.Parse(out)
+	checks := map[string]string{
+		"id":                            "resp_1",
+		"model":                         "gpt-5",
+		"content.0.thinking":            "a\n\nb",
+		"content.1.text":                "checking",
+		"content.2.id":                  "call_1",
+		"content.2.input.path":          "a.txt",
+		"stop_reason":                   "tool_use",
+		"usage.input_tokens":            "10",
+		"usage.cache_read_input_tokens": "30",
+		"usage.output_tokens":           "7",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+
+	incomplete := `{"id":"resp_2","object":"response","status":"incomplete","incomplete_details":{"reason":"max_output_tokens"},"output":[],"usage":{"input_tokens":1,"output_tokens":1}}`
+	out, err = ConvertOpenAIResponsesResponseToClaudeNonStream(context.Background(), "m", nil, nil, []byte(incomplete), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gjson.Get(out, "stop_reason").String(); got != "max_tokens" {
+		t.Errorf("stop_reason = %q, want max_tokens", got)
+	}
+}
+
+func TestConvertOpenAIResponsesResponseToClaudeStream(t *testing.T) {
+	events := []string{
+		`{"type":"response.created","sequence_number":0,"response":{"id":"resp_1","model":"gpt-5","status":"in_progress","output":[]}}`,
+		`{"type":"response.in_progress","sequence_number":1,"response":{"id":"resp_1","status":"in_progress"}}`,
+		`{"type":"response.output_item.added","output_index":0,"item":{"id":"rs_1","type":"reasoning","summary":[]}}`,
+		`{"type":"response.reasoning_summary_text.delta","item_id":"rs_1","output_index":0,"summary_index":0,"delta":"think"}`,
+		`{"type":"response.output_item.done","output_index":0,"item":{"id":"rs_1","type":"reasoning","summary":[{"type":"summary_text","text":"think"}]}}`,
+		`{"type":"response.output_item.added","output_index":1,"item":{"id":"msg_1","type":"message","role":"assistant","content":[]}}`,
+		`{"type":"response.content_part.added","item_id":"msg_1","output_index":1,"content_index":0,"part":{"type":"output_text","text":""}}`,
+		`{"type":"response.output_text.delta","item_id":"msg_1","output_index":1,"content_index":0,"delta":"Hi"}`,
+		`{"type":"response.output_text.done","item_id":"msg_1","output_index":1,"content_index":0,"text":"Hi"}`,
+		`{"type":"response.output_item.done","output_index":1,"item":{"id":"msg_1","type":"message","content":[{"type":"output_text","text":"Hi"}]}}`,
+		// Arguments arrive only with output_item.done.
+		`{"type":"response.output_item.added","output_index":2,"item":{"id":"fc_1","type":"function_call","call_id":"call_1","name":"read","arguments":""}}`,
+		`{"type":"response.output_item.done","output_index":2,"item":{"id":"fc_1","type":"function_call","call_id":"call_1","name":"read","arguments":"{\"path\":\"a\"}"}}`,
+		`{"type":"response.completed","response":{"id":"resp_1","status":"completed","usage":{"input_tokens":10,"output_tokens":5}}}`,
+		`[DONE]`,
+	}
+	var param any
+	var out []string
+	for _, ev := range events {
+		got, err := ConvertOpenAIResponsesResponseToClaude(context.Background(), "m", nil, nil, []byte(ev), &param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, got...)
+	}
+
+	var types []string
+	var thinking, text, args, toolID string
+	var final gjson.Result
+	for _, ev := range claudeEvents(t, out) {
+		types = append(types, ev.Get("type").String())
+		thinking += ev.Get("delta.thinking").String()
+		text += ev.Get("delta.text").String()
+		args += ev.Get("delta.partial_json").String()
+		if id := ev.Get("content_block.id").String(); id != "" {
+			toolID = id
+		}
+		if ev.Get("type").String() == "message_delta" {
+			final = ev
+		}
+	}
+	if thinking != "think" || text != "Hi" || args != `{"path":"a"}` || toolID != "call_1" {
+		t.Fatalf("thinking %q text %q args %q tool %q", thinking, text, args, toolID)
+	}
+	if types[0] != "message_start" || types[len(types)-1] != "message_stop" {
+		t.Fatalf("unexpected event order %v", types)
+	}
+	starts, stops := 0, 0
+	for _, typ := range types {
+		switch typ {
+		case "content_block_start":
+			starts++
+		case "content_block_stop":
+			stops++
+		}
+	}
+	if starts != 3 || stops != 3 {
+		t.Fatalf("expected 3 balanced blocks, got %d starts and %d stops", starts, stops)
+	}
+	if final.Get("delta.stop_reason").String() != "tool_use" || final.Get("usage.output_tokens").Int() != 5 {
+		t.Fatalf("unexpected message_delta %s", final.Raw)
+	}
+}
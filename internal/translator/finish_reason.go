@@ -0,0 +1,144 @@
+package translator
+
+import "github.com/tidwall/gjson"
+
+// FinishReason is the format-independent reason a model stopped generating.
+// Response translators parse the upstream reason into a FinishReason and render
+// the client reason from it, so one upstream reason always reaches every client
+// format the same way.
+type FinishReason string
+
+const (
+	// FinishReasonStop is a natural end of turn.
+	FinishReasonStop FinishReason = "stop"
+	// FinishReasonStopSequence means a caller-provided stop sequence matched.
+	FinishReasonStopSequence FinishReason = "stop_sequence"
+	// FinishReasonLength means the output token limit or context window was reached.
+	FinishReasonLength FinishReason = "length"
+	// FinishReasonToolUse means the model is waiting for tool results.
+	FinishReasonToolUse FinishReason = "tool_use"
+	// FinishReasonContentFilter covers refusals, safety, recitation and blocklist stops.
+	FinishReasonContentFilter FinishReason = "content_filter"
+	// FinishReasonMalformedToolCall means the model produced a tool call that could not be parsed.
+	FinishReasonMalformedToolCall FinishReason = "malformed_tool_call"
+	// FinishReasonPause is a server tool loop paused mid-turn (Claude pause_turn).
+	FinishReasonPause FinishReason = "pause"
+)
+
+// finishReasonNames are the wire values of a FinishReason in each format. An
+// empty responses value means the response completes normally.
+type finishReasonNames struct {
+	claude     string
+	openAIChat string
+	responses  string
+	gemini     string
+}
+
+var finishReasonTable = map[FinishReason]finishReasonNames{
+	FinishReasonStop:              {claude: "end_turn", openAIChat: "stop", gemini: "STOP"},
+	FinishReasonStopSequence:      {claude: "stop_sequence", openAIChat: "stop", gemini: "STOP"},
+	FinishReasonLength:            {claude: "max_tokens", openAIChat: "length", responses: "max_output_tokens", gemini: "MAX_TOKENS"},
+	FinishReasonToolUse:           {claude: "tool_use", openAIChat: "tool_calls", gemini: "STOP"},
+	FinishReasonContentFilter:     {claude: "refusal", openAIChat: "content_filter", responses: "content_filter", gemini: "SAFETY"},
+	FinishReasonMalformedToolCall: {claude: "end_turn", openAIChat: "stop", gemini: "MALFORMED_FUNCTION_CALL"},
+	FinishReasonPause:             {claude: "pause_turn", openAIChat: "stop", gemini: "STOP"},
+}
+
+func (r FinishReason) names() finishReasonNames {
+	if names, ok := finishReasonTable[r]; ok {
+		return names
+	}
+	return finishReasonTable[FinishReasonStop]
+}
+
+// ClaudeStopReason renders the reason as a Claude stop_reason.
+func (r FinishReason) ClaudeStopReason() string { return r.names().claude }
+
+// OpenAIChatFinishReason renders the reason as an OpenAI chat finish_reason.
+func (r FinishReason) OpenAIChatFinishReason() string { return r.names().openAIChat }
+
+// OpenAIResponsesIncompleteReason renders the reason as a Responses
+// incomplete_details.reason, or "" when the response completes normally.
+func (r FinishReason) OpenAIResponsesIncompleteReason() string { return r.names().responses }
+
+// GeminiFinishReason renders the reason as a Gemini candidate finishReason.
+func (r FinishReason) GeminiFinishReason() string { return r.names().gemini }
+
+// FinishReasonFromClaude parses a Claude stop_reason.
+func FinishReasonFromClaude(stopReason string) FinishReason {
+	switch stopReason {
+	case "stop_sequence":
+		return FinishReasonStopSequence
+	case "max_tokens", "model_context_window_exceeded":
+		return FinishReasonLength
+	case "tool_use":
+		return FinishReasonToolUse
+	case "refusal":
+		return FinishReasonContentFilter
+	case "pause_turn":
+		return FinishReasonPause
+	default:
+		return FinishReasonStop
+	}
+}
+
+// FinishReasonFromOpenAIChat parses an OpenAI chat finish_reason.
+func FinishReasonFromOpenAIChat(finishReason string) FinishReason {
+	switch finishReason {
+	case "length":
+		return FinishReasonLength
+	case "tool_calls", "function_call":
+		return FinishReasonToolUse
+	case "content_filter":
+		return FinishReasonContentFilter
+	default:
+		return FinishReasonStop
+	}
+}
+
+// FinishReasonFromOpenAIResponses derives the reason from a Responses response
+// object; Responses has no tool stop reason, so sawFunctionCall reports whether
+// the output contained a function call.
+func FinishReasonFromOpenAIResponses(response gjson.Result, sawFunctionCall bool) FinishReason {
+	if response.Get("status").String() == "incomplete" {
+		switch response.Get("incomplete_details.reason").String() {
+		case "max_output_tokens":
+			return FinishReasonLength
+		case "content_filter":
+			return FinishReasonContentFilter
+		}
+	}
+	if sawFunctionCall {
+		return FinishReasonToolUse
+	}
+	return FinishReasonStop
+}
+
+// FinishReasonFromGemini parses a Gemini candidate finishReason. Gemini reports
+// STOP for function calls; callers seeing a functionCall part should use
+// FinishReasonToolUse instead.
+func FinishReasonFromGemini(finishReason string) FinishReason {
+	switch finishReason {
+	case "MAX_TOKENS":
+		return FinishReasonLength
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY", "LANGUAGE":
+		return FinishReasonContentFilter
+	case "MALFORMED_FUNCTION_CALL", "UNEXPECTED_TOOL_CALL":
+		return FinishReasonMalformedToolCall
+	default:
+		return FinishReasonStop
+	}
+}
+
+// openAIChatFinish parses the finish reason of an OpenAI chat choice. OpenAI
+// does not say which stop sequence matched; OpenAI-compatible servers such as
+// vLLM report it as a string choice stop_reason, which is propagated.
+func openAIChatFinish(choice gjson.Result) (FinishReason, string) {
+	reason := FinishReasonFromOpenAIChat(choice.Get("finish_reason").String())
+	if reason == FinishReasonStop {
+		if matched := choice.Get("stop_reason"); matched.Type == gjson.String && matched.String() != "" {
+			return FinishReasonStopSequence, matched.String()
+		}
+	}
+	return reason, ""
+}
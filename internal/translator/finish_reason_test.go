@@ -0,0 +1,128 @@
+package translator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestFinishReasonTable(t *testing.T) {
+	tests := []struct {
+		reason     FinishReason
+		claude     string
+		openAIChat string
+		responses  string
+		gemini     string
+	}{
+		{FinishReasonStop, "end_turn", "stop", "", "STOP"},
+		{FinishReasonStopSequence, "stop_sequence", "stop", "", "STOP"},
+		{FinishReasonLength, "max_tokens", "length", "max_output_tokens", "MAX_TOKENS"},
+		{FinishReasonToolUse, "tool_use", "tool_calls", "", "STOP"},
+		{FinishReasonContentFilter, "refusal", "content_filter", "content_filter", "SAFETY"},
+		{FinishReasonMalformedToolCall, "end_turn", "stop", "", "MALFORMED_FUNCTION_CALL"},
+		{FinishReasonPause, "pause_turn", "stop", "", "STOP"},
+		{FinishReason("unknown"), "end_turn", "stop", "", "STOP"},
+	}
+	for _, tt := range tests {
+		if got := tt.reason.ClaudeStopReason(); got != tt.claude {
+			t.Errorf("%s claude = %q, want %q", tt.reason, got, tt.claude)
+		}
+		if got := tt.reason.OpenAIChatFinishReason(); got != tt.openAIChat {
+			t.Errorf("%s openai chat = %q, want %q", tt.reason, got, tt.openAIChat)
+		}
+		if got := tt.reason.OpenAIResponsesIncompleteReason(); got != tt.responses {
+			t.Errorf("%s responses = %q, want %q", tt.reason, got, tt.responses)
+		}
+		if got := tt.reason.GeminiFinishReason(); got != tt.gemini {
+			t.Errorf("%s gemini = %q, want %q", tt.reason, got, tt.gemini)
+		}
+	}
+}
+
+func TestFinishReasonParsing(t *testing.T) {
+	claude := map[string]FinishReason{
+		"end_turn":                      FinishReasonStop,
+		"stop_sequence":                 FinishReasonStopSequence,
+		"max_tokens":                    FinishReasonLength,
+		"model_context_window_exceeded": FinishReasonLength,
+		"tool_use":                      FinishReasonToolUse,
+		"refusal":                       FinishReasonContentFilter,
+		"pause_turn":                    FinishReasonPause,
+	}
+	for in, want := range claude {
+		if got := FinishReasonFromClaude(in); got != want {
+			t.Errorf("claude %q = %s, want %s", in, got, want)
+		}
+	}
+	openAI := map[string]FinishReason{
+		"stop":           FinishReasonStop,
+		"length":         FinishReasonLength,
+		"tool_calls":     FinishReasonToolUse,
+		"function_call":  FinishReasonToolUse,
+		"content_filter": FinishReasonContentFilter,
+	}
+	for in, want := range openAI {
+		if got := FinishReasonFromOpenAIChat(in); got != want {
+			t.Errorf("openai chat %q = %s, want %s", in, got, want)
+		}
+	}
+	gemini := map[string]FinishReason{
+		"STOP":                    FinishReasonStop,
+		"MAX_TOKENS":              FinishReasonLength,
+		"SAFETY":                  FinishReasonContentFilter,
+		"RECITATION":              FinishReasonContentFilter,
+		"BLOCKLIST":               FinishReasonContentFilter,
+		"PROHIBITED_CONTENT":      FinishReasonContentFilter,
+		"MALFORMED_FUNCTION_CALL": FinishReasonMalformedToolCall,
+	}
+	for in, want := range gemini {
+		if got := FinishReasonFromGemini(in); got != want {
+			t.Errorf("gemini %q = %s, want %s", in, got, want)
+		}
+	}
+
+	incomplete := gjson.Parse(`{"status":"incomplete","incomplete_details":{"reason":"content_filter"}}`)
+	if got := FinishReasonFromOpenAIResponses(incomplete, true); got != FinishReasonContentFilter {
+		t.Errorf("responses content_filter = %s", got)
+	}
+	if got := FinishReasonFromOpenAIResponses(gjson.Parse(`{"status":"completed"}`), true); got != FinishReasonToolUse {
+		t.Errorf("responses function call = %s", got)
+	}
+}
+
+func TestOpenAIChatToClaudePropagatesMatchedStopSequence(t *testing.T) {
+	body := `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"one two"},"finish_reason":"stop","stop_reason":"END"}]}`
+	out, err := ConvertOpenAIChatResponseToClaudeNonStream(context.Background(), "m", nil, nil, []byte(body), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gjson.Get(out, "stop_reason").String() != "stop_sequence" || gjson.Get(out, "stop_sequence").String() != "END" {
+		t.Errorf("non-stream: %s", out)
+	}
+
+	var param any
+	var events []string
+	for _, chunk := range []string{
+		`{"id":"c1","choices":[{"index":0,"delta":{"content":"one two"}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop","stop_reason":"END"}]}`,
+		`[DONE]`,
+	} {
+		got, err := ConvertOpenAIChatResponseToClaude(context.Background(), "m", nil, nil, []byte(chunk), &param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, got...)
+	}
+	delta := claudeEventOfType(t, events, "message_delta")
+	if delta.Get("delta.stop_reason").String() != "stop_sequence" || delta.Get("delta.stop_sequence").String() != "END" {
+		t.Errorf("stream: %s", delta.Raw)
+	}
+
+	// A token id stop_reason is not a stop sequence.
+	body = `{"id":"c1","choices":[{"index":0,"message":{"content":"x"},"finish_reason":"stop","stop_reason":151645}]}`
+	out, _ = ConvertOpenAIChatResponseToClaudeNonStream(context.Background(), "m", nil, nil, []byte(body), nil)
+	if gjson.Get(out, "stop_reason").String() != "end_turn" || gjson.Get(out, "stop_sequence").Type != gjson.Null {
+		t.Errorf("token stop: %s", out)
+	}
+}
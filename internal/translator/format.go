@@ -14,23 +14,25 @@ func (f Format) String() string {
 }
 
 // Platform returns the platform family of the format.
-// OpenAI, OpenAI-Chat, OpenAI-Responses all belong to "openai" platform.
+// OpenAI, OpenAI-Chat, OpenAI-Responses, OpenAI-Embeddings, OpenAI-Audio all belong to "openai" platform.
 func (f Format) Platform() string {
 	switch f {
-	case FormatOpenAI, FormatOpenAIChat, FormatOpenAIResponses:
+	case FormatOpenAI, FormatOpenAIChat, FormatOpenAIResponses, FormatOpenAIEmbeddings, FormatOpenAIAudio:
 		return "openai"
 	case FormatClaude:
 		return "claude"
 	case FormatGemini:
 		return "gemini"
+	case FormatOllamaChat, FormatOllamaGenerate:
+		return "ollama"
 	default:
 		return string(f)
 	}
 }
 
 // IsSamePlatform checks if two formats belong to the same platform.
-// Same-platform format conversion is allowed (e.g., OpenAI Chat ↔ OpenAI Responses).
-// Cross-platform conversion is NOT allowed (e.g., OpenAI ↔ Claude).
+// Cross-platform conversion (e.g., OpenAI ↔ Claude) is only possible for the
+// pairs registered in RegisterAll.
 func IsSamePlatform(from, to Format) bool {
 	return from.Platform() == to.Platform()
 }
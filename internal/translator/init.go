@@ -1,19 +1,49 @@
-// Package translator provides format detection for different AI API schemas.
-// NOTE: Cross-platform and cross-format translation has been removed.
-// Only same-platform, same-format requests are supported.
+// Package translator provides format detection and request/response translation
+// between the AI API schemas handled by the proxy.
+// Only the pairs registered in RegisterAll can be routed across formats; other
+// cross-format requests are rejected by the channel router.
 package translator
 
 // Format constants
 const (
-	FormatOpenAI          Format = "openai"           // Generic OpenAI (for backward compatibility)
-	FormatOpenAIChat      Format = "openai-chat"      // /v1/chat/completions
-	FormatOpenAIResponses Format = "openai-responses" // /v1/responses
-	FormatClaude          Format = "claude"
-	FormatGemini          Format = "gemini"
+	FormatOpenAI           Format = "openai"            // Generic OpenAI (for backward compatibility)
+	FormatOpenAIChat       Format = "openai-chat"       // /v1/chat/completions
+	FormatOpenAIResponses  Format = "openai-responses"  // /v1/responses
+	FormatOpenAIEmbeddings Format = "openai-embeddings" // /v1/embeddings (passthrough only)
+	FormatOpenAIAudio      Format = "openai-audio"      // /v1/audio/* (passthrough only)
+	FormatClaude           Format = "claude"
+	FormatGemini           Format = "gemini"
+	FormatOllamaChat       Format = "ollama-chat"     // Ollama /api/chat
+	FormatOllamaGenerate   Format = "ollama-generate" // Ollama /api/generate
 )
 
-// RegisterAll is a no-op since translation is no longer supported.
-// Only same-platform, same-format requests are allowed.
+// RegisterAll registers the built-in translators. For a pair (from, to), from is
+// the client format and to is the upstream format: the request transform converts
+// from -> to and the response transform converts upstream responses back to from.
 func RegisterAll(registry *Registry) {
-	// No translators registered - cross-format conversion is not supported
+	registry.Register(FormatClaude, FormatOpenAIChat, ConvertClaudeRequestToOpenAIChat, ResponseTransform{
+		Stream:     ConvertOpenAIChatResponseToClaude,
+		NonStream:  ConvertOpenAIChatResponseToClaudeNonStream,
+		TokenCount: ConvertOpenAIChatTokenCountToClaude,
+	})
+	registry.Register(FormatOpenAIChat, FormatClaude, ConvertOpenAIChatRequestToClaude, ResponseTransform{
+		Stream:    ConvertClaudeResponseToOpenAIChat,
+		NonStream: ConvertClaudeResponseToOpenAIChatNonStream,
+	})
+	registry.Register(FormatClaude, FormatOpenAIResponses, ConvertClaudeRequestToOpenAIResponses, ResponseTransform{
+		Stream:    ConvertOpenAIResponsesResponseToClaude,
+		NonStream: ConvertOpenAIResponsesResponseToClaudeNonStream,
+	})
+	registry.Register(FormatOpenAIResponses, FormatClaude, ConvertOpenAIResponsesRequestToClaude, ResponseTransform{
+		Stream:    ConvertClaudeResponseToOpenAIResponses,
+		NonStream: ConvertClaudeResponseToOpenAIResponsesNonStream,
+	})
+	registry.Register(FormatOpenAIChat, FormatOllamaChat, ConvertOpenAIChatRequestToOllamaChat, ResponseTransform{
+		Stream:    ConvertOllamaResponseToOpenAIChat,
+		NonStream: ConvertOllamaResponseToOpenAIChatNonStream,
+	})
+	registry.Register(FormatOpenAIChat, FormatOllamaGenerate, ConvertOpenAIChatRequestToOllamaGenerate, ResponseTransform{
+		Stream:    ConvertOllamaResponseToOpenAIChat,
+		NonStream: ConvertOllamaResponseToOpenAIChatNonStream,
+	})
 }
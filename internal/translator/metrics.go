@@ -0,0 +1,212 @@
+package translator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Operation names recorded in translator metrics.
+const (
+	OperationRequest    = "request"
+	OperationStream     = "stream"
+	OperationNonStream  = "non_stream"
+	OperationTokenCount = "token_count"
+)
+
+// Error classes recorded in translator metrics.
+const (
+	ErrorClassInvalidJSON = "invalid_json"
+	ErrorClassCanceled    = "canceled"
+	ErrorClassTimeout     = "timeout"
+	ErrorClassOther       = "error"
+)
+
+// maxLastErrorLength bounds the error message kept per pair.
+const maxLastErrorLength = 300
+
+// ClassifiedError lets a translator report its own error class (e.g. "unsupported_content").
+type ClassifiedError interface {
+	error
+	ErrorClass() string
+}
+
+// PairMetrics is a snapshot of the counters for one (from, to, operation) path.
+// Calls counts every invocation; stream translation is invoked once per chunk.
+type PairMetrics struct {
+	From      Format `json:"from"`
+	To        Format `json:"to"`
+	Operation string `json:"operation"`
+	Calls     int64  `json:"calls"`
+	// Translated invocations handled by a registered translator.
+	Translated int64 `json:"translated"`
+	// Passthrough invocations that silently returned the original data because
+	// no translator is registered for the pair.
+	Passthrough int64            `json:"passthrough"`
+	Errors      map[string]int64 `json:"errors,omitempty"`
+	ErrorRate   float64          `json:"errorRate"`
+	LastError   string           `json:"lastError,omitempty"`
+	LastErrorAt *time.Time       `json:"lastErrorAt,omitempty"`
+}
+
+// MetricsReport lists per-pair translator metrics collected since Since.
+type MetricsReport struct {
+	Since time.Time     `json:"since"`
+	Pairs []PairMetrics `json:"pairs"`
+}
+
+type metricsKey struct {
+	from, to  Format
+	operation string
+}
+
+type pairCounters struct {
+	calls       int64
+	translated  int64
+	passthrough int64
+	errors      map[string]int64
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// metrics collects translator usage; same-format calls are not recorded since
+// they are not conversions.
+type metrics struct {
+	mu    sync.Mutex
+	since time.Time
+	pairs map[metricsKey]*pairCounters
+}
+
+func newMetrics() *metrics {
+	return &metrics{since: time.Now().UTC(), pairs: make(map[metricsKey]*pairCounters)}
+}
+
+func (m *metrics) record(from, to Format, operation string, translated bool, err error) {
+	if from == to {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := metricsKey{from: from, to: to, operation: operation}
+	c, ok := m.pairs[key]
+	if !ok {
+		c = &pairCounters{}
+		m.pairs[key] = c
+	}
+	c.calls++
+	if !translated {
+		c.passthrough++
+		return
+	}
+	c.translated++
+	if err == nil {
+		return
+	}
+	if c.errors == nil {
+		c.errors = make(map[string]int64)
+	}
+	c.errors[ErrorClass(err)]++
+	c.lastError = err.Error()
+	if len(c.lastError) > maxLastErrorLength {
+		c.lastError = c.lastError[:maxLastErrorLength]
+	}
+	c.lastErrorAt = time.Now().UTC()
+}
+
+func (m *metrics) report() MetricsReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := MetricsReport{Since: m.since, Pairs: make([]PairMetrics, 0, len(m.pairs))}
+	for key, c := range m.pairs {
+		pm := PairMetrics{
+			From:        key.from,
+			To:          key.to,
+			Operation:   key.operation,
+			Calls:       c.calls,
+			Translated:  c.translated,
+			Passthrough: c.passthrough,
+			LastError:   c.lastError,
+		}
+		var failed int64
+		if len(c.errors) > 0 {
+			pm.Errors = make(map[string]int64, len(c.errors))
+			for class, n := range c.errors {
+				pm.Errors[class] = n
+				failed += n
+			}
+		}
+		if c.translated > 0 {
+			pm.ErrorRate = float64(failed) / float64(c.translated)
+		}
+		if !c.lastErrorAt.IsZero() {
+			at := c.lastErrorAt
+			pm.LastErrorAt = &at
+		}
+		report.Pairs = append(report.Pairs, pm)
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		a, b := report.Pairs[i], report.Pairs[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Operation < b.Operation
+	})
+	return report
+}
+
+func (m *metrics) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.since = time.Now().UTC()
+	m.pairs = make(map[metricsKey]*pairCounters)
+}
+
+// ErrorClass maps a translation error to the class used in metrics.
+func ErrorClass(err error) string {
+	var classified ClassifiedError
+	if errors.As(err, &classified) {
+		if class := classified.ErrorClass(); class != "" {
+			return class
+		}
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ErrorClassInvalidJSON
+	default:
+		return ErrorClassOther
+	}
+}
+
+// Metrics returns a snapshot of the translator metrics of the registry.
+func (r *Registry) Metrics() MetricsReport {
+	return r.metrics.report()
+}
+
+// ResetMetrics clears the translator metrics of the registry.
+func (r *Registry) ResetMetrics() {
+	r.metrics.reset()
+}
+
+// Metrics returns a snapshot of the default registry's translator metrics.
+func Metrics() MetricsReport {
+	return DefaultRegistry().Metrics()
+}
+
+// ResetMetrics clears the default registry's translator metrics.
+func ResetMetrics() {
+	DefaultRegistry().ResetMetrics()
+}
@@ -0,0 +1,68 @@
+package translator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestRegistryMetricsCountsTranslationsFallbacksAndErrors(t *testing.T) {
+	r := NewRegistry()
+	r.Register(FormatClaude, FormatOpenAIChat, func(model string, rawJSON []byte, stream bool) ([]byte, error) {
+		if string(rawJSON) == "bad" {
+			var v any
+			return nil, json.Unmarshal(rawJSON, &v)
+		}
+		return rawJSON, nil
+	}, ResponseTransform{})
+
+	_, _ = r.TranslateRequest(FormatClaude, FormatOpenAIChat, "m", []byte(`{}`), false)
+	_, _ = r.TranslateRequest(FormatClaude, FormatOpenAIChat, "m", []byte("bad"), false)
+	_, _ = r.TranslateRequest(FormatGemini, FormatClaude, "m", []byte(`{}`), false)
+	_, _ = r.TranslateNonStream(context.Background(), FormatClaude, FormatOpenAIChat, "m", nil, nil, []byte(`{}`), nil)
+	_, _ = r.TranslateRequest(FormatClaude, FormatClaude, "m", []byte(`{}`), false)
+
+	byPath := make(map[string]PairMetrics)
+	for _, pm := range r.Metrics().Pairs {
+		byPath[fmt.Sprintf("%s>%s:%s", pm.From, pm.To, pm.Operation)] = pm
+	}
+	if len(byPath) != 3 {
+		t.Fatalf("same-format calls must not be recorded, got %v", byPath)
+	}
+
+	req := byPath["claude>openai-chat:request"]
+	if req.Calls != 2 || req.Translated != 2 || req.Errors[ErrorClassInvalidJSON] != 1 || req.ErrorRate != 0.5 || req.LastErrorAt == nil {
+		t.Fatalf("unexpected request metrics %+v", req)
+	}
+	if fb := byPath["gemini>claude:request"]; fb.Passthrough != 1 || fb.Translated != 0 {
+		t.Fatalf("missing translator should count as passthrough, got %+v", fb)
+	}
+	if ns := byPath["claude>openai-chat:non_stream"]; ns.Passthrough != 1 {
+		t.Fatalf("nil response transform should count as passthrough, got %+v", ns)
+	}
+
+	r.ResetMetrics()
+	if len(r.Metrics().Pairs) != 0 {
+		t.Fatal("reset should clear all pairs")
+	}
+}
+
+type unsupportedError struct{}
+
+func (unsupportedError) Error() string      { return "unsupported block" }
+func (unsupportedError) ErrorClass() string { return "unsupported_content" }
+
+func TestErrorClass(t *testing.T) {
+	cases := map[error]string{
+		fmt.Errorf("wrap: %w", unsupportedError{}): "unsupported_content",
+		fmt.Errorf("wrap: %w", context.Canceled):   ErrorClassCanceled,
+		context.DeadlineExceeded:                   ErrorClassTimeout,
+		fmt.Errorf("plain"):                        ErrorClassOther,
+	}
+	for err, want := range cases {
+		if got := ErrorClass(err); got != want {
+			t.Errorf("ErrorClass(%v) = %s, want %s", err, got, want)
+		}
+	}
+}
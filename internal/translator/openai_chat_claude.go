@@ -0,0 +1,463 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// OpenAI Chat Completions client -> Claude Messages upstream.
+
+// defaultClaudeMaxTokens is used when the chat request does not set max_tokens,
+// which Claude requires.
+const defaultClaudeMaxTokens = 8192
+
+// reasoningEffortBudget maps an OpenAI reasoning effort to a Claude thinking budget.
+func reasoningEffortBudget(effort string) int64 {
+	switch effort {
+	case "low":
+		return 1024
+	case "medium":
+		return 8192
+	case "high":
+		return 24576
+	}
+	return 0
+}
+
+// ConvertOpenAIChatRequestToClaude converts a /v1/chat/completions request to a
+// Claude /v1/messages request. System and developer messages become the system
+// prompt, role "tool" messages become tool_result blocks and consecutive messages
+// of the same role are merged, as Claude requires alternating roles.
+// reasoning_content of earlier turns is dropped since Claude rejects unsigned thinking blocks.
+func ConvertOpenAIChatRequestToClaude(model string, rawJSON []byte, stream bool) ([]byte, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return nil, fmt.Errorf("openai chat request: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	out := `{}`
+
+	if model == "" {
+		model = root.Get("model").String()
+	}
+	out, _ = sjson.Set(out, "model", model)
+
+	maxTokens := root.Get("max_completion_tokens").Int()
+	if maxTokens == 0 {
+		maxTokens = root.Get("max_tokens").Int()
+	}
+	if maxTokens == 0 {
+		maxTokens = defaultClaudeMaxTokens
+	}
+
+	var system []string
+	var messages []chatToClaudeMessage
+	for _, m := range root.Get("messages").Array() {
+		role := m.Get("role").String()
+		switch role {
+		case "system", "developer":
+			if text := openAIChatContentText(m.Get("content")); text != "" {
+				block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+				system = append(system, block)
+			}
+		case "tool":
+			block := `{"type":"tool_result"}`
+			block, _ = sjson.Set(block, "tool_use_id", m.Get("tool_call_id").String())
+			block, _ = sjson.Set(block, "content", openAIChatContentText(m.Get("content")))
+			messages = appendClaudeMessage(messages, "user", block)
+		case "assistant":
+			blocks := openAIChatContentBlocks(m.Get("content"))
+			for _, call := range m.Get("tool_calls").Array() {
+				block := `{"type":"tool_use"}`
+				block, _ = sjson.Set(block, "id", call.Get("id").String())
+				block, _ = sjson.Set(block, "name", call.Get("function.name").String())
+				block, _ = sjson.SetRaw(block, "input", toolArgumentsObject(call.Get("function.arguments").String()))
+				blocks = append(blocks, block)
+			}
+			messages = appendClaudeMessage(messages, "assistant", blocks...)
+		default:
+			messages = appendClaudeMessage(messages, "user", openAIChatContentBlocks(m.Get("content"))...)
+		}
+	}
+	if len(system) > 0 {
+		out, _ = sjson.SetRaw(out, "system", "["+strings.Join(system, ",")+"]")
+	}
+	rendered := make([]string, 0, len(messages))
+	for _, m := range messages {
+		msg, _ := sjson.Set(`{}`, "role", m.role)
+		msg, _ = sjson.SetRaw(msg, "content", "["+strings.Join(m.blocks, ",")+"]")
+		rendered = append(rendered, msg)
+	}
+	out, _ = sjson.SetRaw(out, "messages", "["+strings.Join(rendered, ",")+"]")
+
+	budget := reasoningEffortBudget(root.Get("reasoning_effort").String())
+	if budget > 0 {
+		// Claude requires max_tokens > budget_tokens and does not accept sampling
+		// parameters together with extended thinking.
+		if maxTokens <= budget {
+			maxTokens = budget + defaultClaudeMaxTokens
+		}
+		out, _ = sjson.Set(out, "thinking.type", "enabled")
+		out, _ = sjson.Set(out, "thinking.budget_tokens", budget)
+	} else {
+		for _, key := range []string{"temperature", "top_p"} {
+			if v := root.Get(key); v.Exists() {
+				out, _ = sjson.SetRaw(out, key, v.Raw)
+			}
+		}
+	}
+	out, _ = sjson.Set(out, "max_tokens", maxTokens)
+
+	switch stop := root.Get("stop"); {
+	case stop.Type == gjson.String && stop.String() != "":
+		out, _ = sjson.Set(out, "stop_sequences", []string{stop.String()})
+	case stop.IsArray() && len(stop.Array()) > 0:
+		out, _ = sjson.SetRaw(out, "stop_sequences", stop.Raw)
+	}
+	if user := root.Get("user").String(); user != "" {
+		out, _ = sjson.Set(out, "metadata.user_id", user)
+	}
+
+	var tools []string
+	for _, tool := range root.Get("tools").Array() {
+		if tool.Get("type").String() != "function" {
+			continue
+		}
+		fn := tool.Get("function")
+		t, _ := sjson.Set(`{}`, "name", fn.Get("name").String())
+		if desc := fn.Get("description").String(); desc != "" {
+			t, _ = sjson.Set(t, "description", desc)
+		}
+		if params := fn.Get("parameters"); params.IsObject() {
+			t, _ = sjson.SetRaw(t, "input_schema", params.Raw)
+		} else {
+			t, _ = sjson.SetRaw(t, "input_schema", `{"type":"object","properties":{}}`)
+		}
+		tools = append(tools, t)
+	}
+	if len(tools) > 0 {
+		out, _ = sjson.SetRaw(out, "tools", "["+strings.Join(tools, ",")+"]")
+
+		choice := root.Get("tool_choice")
+		switch {
+		case choice.String() == "auto":
+			out, _ = sjson.Set(out, "tool_choice.type", "auto")
+		case choice.String() == "required":
+			out, _ = sjson.Set(out, "tool_choice.type", "any")
+		case choice.String() == "none":
+			out, _ = sjson.Set(out, "tool_choice.type", "none")
+		case choice.IsObject() && choice.Get("function.name").String() != "":
+			out, _ = sjson.Set(out, "tool_choice.type", "tool")
+			out, _ = sjson.Set(out, "tool_choice.name", choice.Get("function.name").String())
+		}
+		if ptc := root.Get("parallel_tool_calls"); ptc.Exists() && !ptc.Bool() {
+			if !gjson.Get(out, "tool_choice").Exists() {
+				out, _ = sjson.Set(out, "tool_choice.type", "auto")
+			}
+			out, _ = sjson.Set(out, "tool_choice.disable_parallel_tool_use", true)
+		}
+	}
+
+	if stream {
+		out, _ = sjson.Set(out, "stream", true)
+	}
+	return []byte(out), nil
+}
+
+type chatToClaudeMessage struct {
+	role   string
+	blocks []string
+}
+
+// appendClaudeMessage appends blocks, merging into the previous message when the role repeats.
+func appendClaudeMessage(messages []chatToClaudeMessage, role string, blocks ...string) []chatToClaudeMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].role == role {
+		messages[n-1].blocks = append(messages[n-1].blocks, blocks...)
+		return messages
+	}
+	return append(messages, chatToClaudeMessage{role: role, blocks: blocks})
+}
+
+// openAIChatContentText flattens chat message content (string or parts) to text.
+func openAIChatContentText(content gjson.Result) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	var parts []string
+	for _, part := range content.Array() {
+		if part.Get("type").String() == "text" {
+			parts = append(parts, part.Get("text").String())
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// openAIChatContentBlocks converts chat message content to Claude content blocks.
+func openAIChatContentBlocks(content gjson.Result) []string {
+	if content.Type == gjson.String {
+		if content.String() == "" {
+			return nil
+		}
+		block, _ := sjson.Set(`{"type":"text"}`, "text", content.String())
+		return []string{block}
+	}
+	var blocks []string
+	for _, part := range content.Array() {
+		switch part.Get("type").String() {
+		case "text":
+			if text := part.Get("text").String(); text != "" {
+				block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+				blocks = append(blocks, block)
+			}
+		case "image_url":
+			if block := claudeImageBlock(part.Get("image_url.url").String()); block != "" {
+				blocks = append(blocks, block)
+			}
+		}
+	}
+	return blocks
+}
+
+// claudeImageBlock converts an image URL (data: URLs included) to a Claude image block.
+func claudeImageBlock(url string) string {
+	if url == "" {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		mediaType, data, found := strings.Cut(rest, ";base64,")
+		if !found {
+			return ""
+		}
+		block, _ := sjson.Set(`{"type":"image","source":{"type":"base64"}}`, "source.media_type", mediaType)
+		block, _ = sjson.Set(block, "source.data", data)
+		return block
+	}
+	block, _ := sjson.Set(`{"type":"image","source":{"type":"url"}}`, "source.url", url)
+	return block
+}
+
+// claudeUsageToOpenAIChat converts Claude usage; prompt_tokens includes cache reads
+// and writes, as OpenAI reports cached tokens as part of the prompt.
+func claudeUsageToOpenAIChat(input, output, cacheRead, cacheCreation int64) string {
+	prompt := input + cacheRead + cacheCreation
+	out, _ := sjson.Set(`{}`, "prompt_tokens", prompt)
+	out, _ = sjson.Set(out, "completion_tokens", output)
+	out, _ = sjson.Set(out, "total_tokens", prompt+output)
+	if cacheRead > 0 {
+		out, _ = sjson.Set(out, "prompt_tokens_details.cached_tokens", cacheRead)
+	}
+	return out
+}
+
+// claudeErrorToOpenAI converts a Claude error payload to an OpenAI error payload.
+func claudeErrorToOpenAI(errObj gjson.Result) string {
+	out, _ := sjson.Set(`{"error":{}}`, "error.message", errObj.Get("message").String())
+	out, _ = sjson.Set(out, "error.type", errObj.Get("type").String())
+	return out
+}
+
+// chatCompletionID prefixes a Claude message id like OpenAI completion ids.
+func chatCompletionID(id string) string {
+	if id == "" || strings.HasPrefix(id, "chatcmpl-") {
+		return id
+	}
+	return "chatcmpl-" + id
+}
+
+// ConvertClaudeResponseToOpenAIChatNonStream converts a Claude message to a chat.completion response.
+func ConvertClaudeResponseToOpenAIChatNonStream(_ context.Context, model string, _, _, rawJSON []byte, _ *any) (string, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return "", fmt.Errorf("claude response: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	if root.Get("type").String() == "error" {
+		return claudeErrorToOpenAI(root.Get("error")), nil
+	}
+
+	out := `{"id":"","object":"chat.completion","created":0,"model":"","choices":[{"index":0,"message":{"role":"assistant"}}]}`
+	out, _ = sjson.Set(out, "id", chatCompletionID(root.Get("id").String()))
+	out, _ = sjson.Set(out, "created", time.Now().Unix())
+	if m := root.Get("model").String(); m != "" {
+		model = m
+	}
+	out, _ = sjson.Set(out, "model", model)
+
+	var text, reasoning strings.Builder
+	var toolCalls []string
+	for _, block := range root.Get("content").Array() {
+		switch block.Get("type").String() {
+		case "text":
+			text.WriteString(block.Get("text").String())
+		case "thinking":
+			reasoning.WriteString(block.Get("thinking").String())
+		case "tool_use":
+			call := `{"id":"","type":"function","function":{}}`
+			call, _ = sjson.Set(call, "id", block.Get("id").String())
+			call, _ = sjson.Set(call, "function.name", block.Get("name").String())
+			call, _ = sjson.Set(call, "function.arguments", block.Get("input").Raw)
+			toolCalls = append(toolCalls, call)
+		}
+	}
+	if text.Len() > 0 || len(toolCalls) == 0 {
+		out, _ = sjson.Set(out, "choices.0.message.content", text.String())
+	} else {
+		out, _ = sjson.SetRaw(out, "choices.0.message.content", "null")
+	}
+	if reasoning.Len() > 0 {
+		out, _ = sjson.Set(out, "choices.0.message.reasoning_content", reasoning.String())
+	}
+	if len(toolCalls) > 0 {
+		out, _ = sjson.SetRaw(out, "choices.0.message.tool_calls", "["+strings.Join(toolCalls, ",")+"]")
+	}
+	out, _ = sjson.Set(out, "choices.0.finish_reason", FinishReasonFromClaude(root.Get("stop_reason").String()).OpenAIChatFinishReason())
+
+	usage := root.Get("usage")
+	out, _ = sjson.SetRaw(out, "usage", claudeUsageToOpenAIChat(
+		usage.Get("input_tokens").Int(),
+		usage.Get("output_tokens").Int(),
+		usage.Get("cache_read_input_tokens").Int(),
+		usage.Get("cache_creation_input_tokens").Int(),
+	))
+	return out, nil
+}
+
+// claudeToOpenAIChatStreamState tracks a Claude stream converted to chat chunks.
+type claudeToOpenAIChatStreamState struct {
+	id      string
+	model   string
+	created int64
+	done    bool
+	// toolIndexes maps Claude block indexes to OpenAI tool call indexes.
+	toolIndexes   map[int64]int
+	inputTokens   int64
+	outputTokens  int64
+	cacheRead     int64
+	cacheCreation int64
+}
+
+func (s *claudeToOpenAIChatStreamState) chunk(delta string, finishReason string) string {
+	out := `{"id":"","object":"chat.completion.chunk","created":0,"model":"","choices":[{"index":0}]}`
+	out, _ = sjson.Set(out, "id", s.id)
+	out, _ = sjson.Set(out, "created", s.created)
+	out, _ = sjson.Set(out, "model", s.model)
+	out, _ = sjson.SetRaw(out, "choices.0.delta", delta)
+	if finishReason != "" {
+		out, _ = sjson.Set(out, "choices.0.finish_reason", finishReason)
+	} else {
+		out, _ = sjson.SetRaw(out, "choices.0.finish_reason", "null")
+	}
+	return FormatSSEEvent("", out)
+}
+
+// ConvertClaudeResponseToOpenAIChat converts one Claude SSE event payload to chat
+// completion chunks. Each returned string is a complete SSE event; "data: [DONE]"
+// is emitted after message_stop or when called with "[DONE]" at the end of the stream.
+// A usage chunk is sent only when the client asked for stream_options.include_usage.
+func ConvertClaudeResponseToOpenAIChat(_ context.Context, model string, originalRequestRawJSON, _, rawJSON []byte, param *any) ([]string, error) {
+	if *param == nil {
+		*param = &claudeToOpenAIChatStreamState{model: model, created: time.Now().Unix(), toolIndexes: make(map[int64]int)}
+	}
+	s := (*param).(*claudeToOpenAIChatStreamState)
+	if s.done {
+		return nil, nil
+	}
+	if strings.TrimSpace(string(rawJSON)) == "[DONE]" {
+		s.done = true
+		return []string{FormatSSEDone()}, nil
+	}
+	if !gjson.ValidBytes(rawJSON) {
+		return nil, fmt.Errorf("claude stream: invalid JSON event")
+	}
+	root := gjson.ParseBytes(rawJSON)
+
+	switch root.Get("type").String() {
+	case "message_start":
+		msg := root.Get("message")
+		s.id = chatCompletionID(msg.Get("id").String())
+		if m := msg.Get("model").String(); m != "" {
+			s.model = m
+		}
+		s.inputTokens = msg.Get("usage.input_tokens").Int()
+		s.outputTokens = msg.Get("usage.output_tokens").Int()
+		s.cacheRead = msg.Get("usage.cache_read_input_tokens").Int()
+		s.cacheCreation = msg.Get("usage.cache_creation_input_tokens").Int()
+		return []string{s.chunk(`{"role":"assistant","content":""}`, "")}, nil
+
+	case "content_block_start":
+		block := root.Get("content_block")
+		if block.Get("type").String() != "tool_use" {
+			return nil, nil
+		}
+		index := len(s.toolIndexes)
+		s.toolIndexes[root.Get("index").Int()] = index
+		call := `{"index":0,"id":"","type":"function","function":{"name":"","arguments":""}}`
+		call, _ = sjson.Set(call, "index", index)
+		call, _ = sjson.Set(call, "id", block.Get("id").String())
+		call, _ = sjson.Set(call, "function.name", block.Get("name").String())
+		return []string{s.chunk(`{"tool_calls":[`+call+`]}`, "")}, nil
+
+	case "content_block_delta":
+		delta := root.Get("delta")
+		switch delta.Get("type").String() {
+		case "text_delta":
+			d, _ := sjson.Set(`{}`, "content", delta.Get("text").String())
+			return []string{s.chunk(d, "")}, nil
+		case "thinking_delta":
+			d, _ := sjson.Set(`{}`, "reasoning_content", delta.Get("thinking").String())
+			return []string{s.chunk(d, "")}, nil
+		case "input_json_delta":
+			index, ok := s.toolIndexes[root.Get("index").Int()]
+			if !ok {
+				return nil, nil
+			}
+			call, _ := sjson.Set(`{"index":0,"function":{}}`, "index", index)
+			call, _ = sjson.Set(call, "function.arguments", delta.Get("partial_json").String())
+			return []string{s.chunk(`{"tool_calls":[`+call+`]}`, "")}, nil
+		}
+		return nil, nil
+
+	case "message_delta":
+		usage := root.Get("usage")
+		if v := usage.Get("output_tokens"); v.Exists() {
+			s.outputTokens = v.Int()
+		}
+		if v := usage.Get("input_tokens"); v.Exists() {
+			s.inputTokens = v.Int()
+		}
+		if v := usage.Get("cache_read_input_tokens"); v.Exists() {
+			s.cacheRead = v.Int()
+		}
+		if v := usage.Get("cache_creation_input_tokens"); v.Exists() {
+			s.cacheCreation = v.Int()
+		}
+		if stopReason := root.Get("delta.stop_reason").String(); stopReason != "" {
+			return []string{s.chunk(`{}`, FinishReasonFromClaude(stopReason).OpenAIChatFinishReason())}, nil
+		}
+		return nil, nil
+
+	case "message_stop":
+		s.done = true
+		var out []string
+		if gjson.GetBytes(originalRequestRawJSON, "stream_options.include_usage").Bool() {
+			usage := `{"id":"","object":"chat.completion.chunk","created":0,"model":"","choices":[]}`
+			usage, _ = sjson.Set(usage, "id", s.id)
+			usage, _ = sjson.Set(usage, "created", s.created)
+			usage, _ = sjson.Set(usage, "model", s.model)
+			usage, _ = sjson.SetRaw(usage, "usage", claudeUsageToOpenAIChat(s.inputTokens, s.outputTokens, s.cacheRead, s.cacheCreation))
+			out = append(out, FormatSSEEvent("", usage))
+		}
+		return append(out, FormatSSEDone()), nil
+
+	case "error":
+		s.done = true
+		return []string{FormatSSEEvent("", claudeErrorToOpenAI(root.Get("error"))), FormatSSEDone()}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,161 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertOpenAIChatRequestToClaude(t *testing.T) {
+	in := `{
+		"model": "gpt-4o",
+		"temperature": 0.2,
+		"stop": "END",
+		"tools": [{"type":"function","function":{"name":"read","parameters":{"type":"object","properties":{"path":{"type":"string"}}}}}],
+		"tool_choice": {"type":"function","function":{"name":"read"}},
+		"messages": [
+			{"role":"system","content":"be brief"},
+			{"role":"user","content":[{"type":"text","text":"open a.txt"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAA"}}]},
+			{"role":"assistant","content":null,"reasoning_content":"ignored","tool_calls":[{"id":"call_1","type":"function","function":{"name":"read","arguments":"{\"path\":\"a.txt\"}"}}]},
+			{"role":"tool","tool_call_id":"call_1","content":"hello"},
+			{"role":"user","content":"summarize"}
+		]
+	}`
+	out, err := ConvertOpenAIChatRequestToClaude("claude-sonnet-4", []byte(in), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.ParseBytes(out)
+	checks := map[string]string{
+		"model":                            "claude-sonnet-4",
+		"max_tokens":                       "8192",
+		"temperature":                      "0.2",
+		"stop_sequences.0":                 "END",
+		"system.0.text":                    "be brief",
+		"tools.0.name":                     "read",
+		"tools.0.input_schema.type":        "object",
+		"tool_choice.type":                 "tool",
+		"tool_choice.name":                 "read",
+		"messages.#":                       "3",
+		"messages.0.content.1.source.data": "AAA",
+		"messages.1.role":                  "assistant",
+		"messages.1.content.#":             "1",
+		"messages.1.content.0.input.path":  "a.txt",
+		"messages.2.role":                  "user",
+		"messages.2.content.0.type":        "tool_result",
+		"messages.2.content.0.tool_use_id": "call_1",
+		"messages.2.content.1.text":        "summarize",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if res.Get("stream").Exists() {
+		t.Error("stream must not be set for non-streaming requests")
+	}
+}
+
+func TestConvertOpenAIChatRequestToClaude_ReasoningEffort(t *testing.T) {
+	in := `{"model":"gpt-4o","max_tokens":1000,"temperature":0.5,"reasoning_effort":"high","messages":[{"role":"user","content":"hi"}]}`
+	out, err := ConvertOpenAIChatRequestToClaude("", []byte(in), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.ParseBytes(out)
+	if res.Get("thinking.budget_tokens").Int() != 24576 || res.Get("max_tokens").Int() <= 24576 {
+		t.Fatalf("max_tokens must exceed the thinking budget: %s", out)
+	}
+	if res.Get("temperature").Exists() {
+		t.Fatal("temperature must be dropped with extended thinking")
+	}
+}
+
+func TestConvertClaudeResponseToOpenAIChatNonStream(t *testing.T) {
+	in := `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"thinking","thinking":"hmm","signature":"s"},{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_1","name":"read","input":{"path":"a.txt"}}],"stop_reason":"tool_use","usage":{"input_tokens":10,"cache_read_input_tokens":30,"output_tokens":7}}`
+	out, err := ConvertClaudeResponseToOpenAIChatNonStream(context.Background(), "m", nil, nil, []byte(in), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.Parse(out)
+	checks := map[string]string{
+		"id":                                        "chatcmpl-msg_1",
+		"object":                                    "chat.completion",
+		"choices.0.message.content":                 "checking",
+		"choices.0.message.reasoning_content":       "hmm",
+		"choices.0.message.tool_calls.0.id":         "toolu_1",
+		"choices.0.finish_reason":                   "tool_calls",
+		"usage.prompt_tokens":                       "40",
+		"usage.prompt_tokens_details.cached_tokens": "30",
+		"usage.total_tokens":                        "47",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if args := res.Get("choices.0.message.tool_calls.0.function.arguments").String(); gjson.Get(args, "path").String() != "a.txt" {
+		t.Errorf("unexpected tool arguments %s", args)
+	}
+}
+
+func TestConvertClaudeResponseToOpenAIChatStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"read","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\":\"a\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"ping"}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`,
+		`{"type":"message_stop"}`,
+		`[DONE]`,
+	}
+	var param any
+	var out []string
+	original := []byte(`{"stream":true,"stream_options":{"include_usage":true}}`)
+	for _, ev := range events {
+		got, err := ConvertClaudeResponseToOpenAIChat(context.Background(), "m", original, nil, []byte(ev), &param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, got...)
+	}
+	joined := strings.Join(out, "")
+	if strings.Count(joined, "data: [DONE]") != 1 {
+		t.Fatalf("expected exactly one [DONE], got:\n%s", joined)
+	}
+	var content strings.Builder
+	var finish string
+	var usage gjson.Result
+	for _, chunk := range claudeEvents(t, out) {
+		content.WriteString(chunk.Get("choices.0.delta.content").String())
+		if fr := chunk.Get("choices.0.finish_reason").String(); fr != "" {
+			finish = fr
+		}
+		if u := chunk.Get("usage"); u.Exists() {
+			usage = u
+		}
+	}
+	if content.String() != "Hi" || finish != "tool_calls" {
+		t.Fatalf("content %q finish %q", content.String(), finish)
+	}
+	var toolID, toolArgs string
+	for _, chunk := range claudeEvents(t, out) {
+		call := chunk.Get("choices.0.delta.tool_calls.0")
+		if id := call.Get("id").String(); id != "" {
+			toolID = id
+		}
+		toolArgs += call.Get("function.arguments").String()
+	}
+	if toolID != "toolu_1" || toolArgs != `{"path":"a"}` {
+		t.Fatalf("tool call %q %q:\n%s", toolID, toolArgs, joined)
+	}
+	if usage.Get("prompt_tokens").Int() != 10 || usage.Get("completion_tokens").Int() != 12 {
+		t.Fatalf("unexpected usage %s", usage.Raw)
+	}
+}
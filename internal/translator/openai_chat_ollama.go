@@ -0,0 +1,436 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// OpenAI Chat Completions client -> Ollama /api/chat and /api/generate upstream.
+//
+// Ollama streams newline-delimited JSON; the proxy frames each line as an SSE
+// data event before translation, so the stream transform sees one Ollama chunk
+// per call like any other upstream format.
+
+// ConvertOpenAIChatRequestToOllamaChat converts a /v1/chat/completions request
+// to an Ollama /api/chat request. Developer messages become system messages,
+// data: URL images move to the message images list, tool call arguments are
+// sent as JSON objects and tool results carry the name of the call they answer.
+// Sampling parameters go to options; stream is always set explicitly because
+// Ollama streams by default.
+func ConvertOpenAIChatRequestToOllamaChat(model string, rawJSON []byte, stream bool) ([]byte, error) {
+	root, out, err := ollamaRequestBase(model, rawJSON, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	toolNames := make(map[string]string)
+	messages := make([]string, 0, len(root.Get("messages").Array()))
+	for _, m := range root.Get("messages").Array() {
+		role := m.Get("role").String()
+		if role == "developer" {
+			role = "system"
+		}
+		msg, _ := sjson.Set(`{}`, "role", role)
+		msg, _ = sjson.Set(msg, "content", openAIChatContentText(m.Get("content")))
+		images, err := ollamaImages(m.Get("content"))
+		if err != nil {
+			return nil, err
+		}
+		if len(images) > 0 {
+			msg, _ = sjson.Set(msg, "images", images)
+		}
+		if reasoning := m.Get("reasoning_content").String(); reasoning != "" && role == "assistant" {
+			msg, _ = sjson.Set(msg, "thinking", reasoning)
+		}
+		for _, tc := range m.Get("tool_calls").Array() {
+			name := tc.Get("function.name").String()
+			toolNames[tc.Get("id").String()] = name
+			args := strings.TrimSpace(tc.Get("function.arguments").String())
+			if args == "" {
+				args = "{}"
+			}
+			if !gjson.Valid(args) || !gjson.Parse(args).IsObject() {
+				return nil, fmt.Errorf("openai chat request: tool call %q arguments are not a JSON object", name)
+			}
+			call, _ := sjson.Set(`{"function":{}}`, "function.name", name)
+			call, _ = sjson.SetRaw(call, "function.arguments", args)
+			msg, _ = sjson.SetRaw(msg, "tool_calls.-1", call)
+		}
+		if role == "tool" {
+			if name := toolNames[m.Get("tool_call_id").String()]; name != "" {
+				msg, _ = sjson.Set(msg, "tool_name", name)
+			}
+		}
+		messages = append(messages, msg)
+	}
+	out, _ = sjson.SetRaw(out, "messages", "["+strings.Join(messages, ",")+"]")
+
+	if tools := root.Get("tools"); tools.IsArray() && len(tools.Array()) > 0 {
+		var converted []string
+		for _, tool := range tools.Array() {
+			if tool.Get("type").String() != "function" {
+				continue
+			}
+			converted = append(converted, tool.Raw)
+		}
+		if len(converted) > 0 {
+			out, _ = sjson.SetRaw(out, "tools", "["+strings.Join(converted, ",")+"]")
+		}
+	}
+	return []byte(out), nil
+}
+
+// ConvertOpenAIChatRequestToOllamaGenerate converts a /v1/chat/completions
+// request to an Ollama /api/generate request. System messages become the system
+// prompt; a single user message is sent as the prompt and longer conversations
+// are rendered as a role-prefixed transcript. Tools are rejected since
+// /api/generate cannot call them.
+func ConvertOpenAIChatRequestToOllamaGenerate(model string, rawJSON []byte, stream bool) ([]byte, error) {
+	root, out, err := ollamaRequestBase(model, rawJSON, stream)
+	if err != nil {
+		return nil, err
+	}
+	if tools := root.Get("tools"); tools.IsArray() && len(tools.Array()) > 0 {
+		return nil, fmt.Errorf("openai chat request: tools are not supported by the ollama generate endpoint")
+	}
+
+	var system []string
+	var turns []gjson.Result
+	var images []string
+	for _, m := range root.Get("messages").Array() {
+		switch m.Get("role").String() {
+		case "system", "developer":
+			system = append(system, openAIChatContentText(m.Get("content")))
+		default:
+			turns = append(turns, m)
+			msgImages, err := ollamaImages(m.Get("content"))
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, msgImages...)
+		}
+	}
+
+	var prompt string
+	if len(turns) == 1 {
+		prompt = openAIChatContentText(turns[0].Get("content"))
+	} else {
+		var b strings.Builder
+		for _, m := range turns {
+			role := m.Get("role").String()
+			if role == "" {
+				role = "user"
+			}
+			b.WriteString(strings.ToUpper(role[:1]) + role[1:])
+			b.WriteString(": ")
+			b.WriteString(openAIChatContentText(m.Get("content")))
+			b.WriteString("\n\n")
+		}
+		b.WriteString("Assistant:")
+		prompt = b.String()
+	}
+	out, _ = sjson.Set(out, "prompt", prompt)
+	if len(system) > 0 {
+		out, _ = sjson.Set(out, "system", strings.Join(system, "\n\n"))
+	}
+	if len(images) > 0 {
+		out, _ = sjson.Set(out, "images", images)
+	}
+	return []byte(out), nil
+}
+
+// ollamaRequestBase sets the fields shared by /api/chat and /api/generate:
+// model, stream, format, think and the sampling options.
+func ollamaRequestBase(model string, rawJSON []byte, stream bool) (gjson.Result, string, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return gjson.Result{}, "", fmt.Errorf("openai chat request: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	out := `{}`
+
+	if model == "" {
+		model = root.Get("model").String()
+	}
+	out, _ = sjson.Set(out, "model", model)
+	out, _ = sjson.Set(out, "stream", stream)
+
+	options := `{}`
+	for _, field := range [][2]string{
+		{"temperature", "temperature"},
+		{"top_p", "top_p"},
+		{"seed", "seed"},
+		{"frequency_penalty", "frequency_penalty"},
+		{"presence_penalty", "presence_penalty"},
+	} {
+		if v := root.Get(field[0]); v.Exists() && v.Type != gjson.Null {
+			options, _ = sjson.SetRaw(options, field[1], v.Raw)
+		}
+	}
+	maxTokens := root.Get("max_completion_tokens").Int()
+	if maxTokens == 0 {
+		maxTokens = root.Get("max_tokens").Int()
+	}
+	if maxTokens > 0 {
+		options, _ = sjson.Set(options, "num_predict", maxTokens)
+	}
+	switch stop := root.Get("stop"); {
+	case stop.Type == gjson.String && stop.String() != "":
+		options, _ = sjson.Set(options, "stop", []string{stop.String()})
+	case stop.IsArray() && len(stop.Array()) > 0:
+		options, _ = sjson.SetRaw(options, "stop", stop.Raw)
+	}
+	if options != `{}` {
+		out, _ = sjson.SetRaw(out, "options", options)
+	}
+
+	switch format := root.Get("response_format"); format.Get("type").String() {
+	case "json_object":
+		out, _ = sjson.Set(out, "format", "json")
+	case "json_schema":
+		if schema := format.Get("json_schema.schema"); schema.IsObject() {
+			out, _ = sjson.SetRaw(out, "format", schema.Raw)
+		} else {
+			out, _ = sjson.Set(out, "format", "json")
+		}
+	}
+
+	if effort := root.Get("reasoning_effort").String(); effort != "" {
+		out, _ = sjson.Set(out, "think", effort != "none" && effort != "minimal")
+	}
+	return root, out, nil
+}
+
+// ollamaImages returns the base64 payloads of data: URL image parts. Ollama
+// cannot fetch remote images, so other URLs are an error.
+func ollamaImages(content gjson.Result) ([]string, error) {
+	if !content.IsArray() {
+		return nil, nil
+	}
+	var images []string
+	for _, part := range content.Array() {
+		if part.Get("type").String() != "image_url" {
+			continue
+		}
+		url := part.Get("image_url.url").String()
+		rest, ok := strings.CutPrefix(url, "data:")
+		if !ok {
+			return nil, fmt.Errorf("openai chat request: ollama accepts only base64 data: URL images")
+		}
+		_, data, found := strings.Cut(rest, ";base64,")
+		if !found {
+			return nil, fmt.Errorf("openai chat request: image data URL is not base64 encoded")
+		}
+		images = append(images, data)
+	}
+	return images, nil
+}
+
+// FinishReasonFromOllama parses an Ollama done_reason. Ollama reports "stop"
+// when the model calls tools; callers that saw tool calls should use
+// FinishReasonToolUse instead.
+func FinishReasonFromOllama(doneReason string) FinishReason {
+	if doneReason == "length" {
+		return FinishReasonLength
+	}
+	return FinishReasonStop
+}
+
+// ollamaUsageToOpenAIChat converts Ollama prompt_eval_count/eval_count.
+func ollamaUsageToOpenAIChat(chunk gjson.Result) string {
+	prompt := chunk.Get("prompt_eval_count").Int()
+	completion := chunk.Get("eval_count").Int()
+	out, _ := sjson.Set(`{}`, "prompt_tokens", prompt)
+	out, _ = sjson.Set(out, "completion_tokens", completion)
+	out, _ = sjson.Set(out, "total_tokens", prompt+completion)
+	return out
+}
+
+// ollamaErrorToOpenAI converts an Ollama {"error":"..."} payload. Error objects
+// that are already in OpenAI form are returned unchanged.
+func ollamaErrorToOpenAI(errValue gjson.Result) string {
+	if errValue.IsObject() {
+		out, _ := sjson.SetRaw(`{}`, "error", errValue.Raw)
+		return out
+	}
+	out, _ := sjson.Set(`{"error":{"type":"api_error"}}`, "error.message", errValue.String())
+	return out
+}
+
+// ollamaCreated parses created_at, falling back to the current time.
+func ollamaCreated(chunk gjson.Result) int64 {
+	if t, err := time.Parse(time.RFC3339Nano, chunk.Get("created_at").String()); err == nil {
+		return t.Unix()
+	}
+	return time.Now().Unix()
+}
+
+// ollamaText returns the generated text of a /api/chat or /api/generate chunk.
+func ollamaText(chunk gjson.Result) string {
+	if v := chunk.Get("message.content"); v.Exists() {
+		return v.String()
+	}
+	return chunk.Get("response").String()
+}
+
+// ollamaThinking returns the reasoning text of a /api/chat or /api/generate chunk.
+func ollamaThinking(chunk gjson.Result) string {
+	if v := chunk.Get("message.thinking"); v.Exists() {
+		return v.String()
+	}
+	return chunk.Get("thinking").String()
+}
+
+// ollamaToolCall converts an Ollama tool call to an OpenAI one. Ollama does not
+// assign call ids, so one is generated.
+func ollamaToolCall(tc gjson.Result) string {
+	args := tc.Get("function.arguments").Raw
+	if args == "" {
+		args = "{}"
+	}
+	call := `{"id":"","type":"function","function":{}}`
+	call, _ = sjson.Set(call, "id", "call_"+strings.ReplaceAll(uuid.NewString(), "-", "")[:24])
+	call, _ = sjson.Set(call, "function.name", tc.Get("function.name").String())
+	call, _ = sjson.Set(call, "function.arguments", args)
+	return call
+}
+
+// ConvertOllamaResponseToOpenAIChatNonStream converts an Ollama /api/chat or
+// /api/generate response to a chat.completion response.
+func ConvertOllamaResponseToOpenAIChatNonStream(_ context.Context, model string, _, _, rawJSON []byte, _ *any) (string, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return "", fmt.Errorf("ollama response: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	if errValue := root.Get("error"); errValue.Exists() {
+		return ollamaErrorToOpenAI(errValue), nil
+	}
+
+	out := `{"id":"","object":"chat.completion","created":0,"model":"","choices":[{"index":0,"message":{"role":"assistant"}}]}`
+	out, _ = sjson.Set(out, "id", "chatcmpl-"+uuid.NewString())
+	out, _ = sjson.Set(out, "created", ollamaCreated(root))
+	if m := root.Get("model").String(); m != "" {
+		model = m
+	}
+	out, _ = sjson.Set(out, "model", model)
+
+	var toolCalls []string
+	for _, tc := range root.Get("message.tool_calls").Array() {
+		toolCalls = append(toolCalls, ollamaToolCall(tc))
+	}
+	text := ollamaText(root)
+	if text != "" || len(toolCalls) == 0 {
+		out, _ = sjson.Set(out, "choices.0.message.content", text)
+	} else {
+		out, _ = sjson.SetRaw(out, "choices.0.message.content", "null")
+	}
+	if thinking := ollamaThinking(root); thinking != "" {
+		out, _ = sjson.Set(out, "choices.0.message.reasoning_content", thinking)
+	}
+	reason := FinishReasonFromOllama(root.Get("done_reason").String())
+	if len(toolCalls) > 0 {
+		out, _ = sjson.SetRaw(out, "choices.0.message.tool_calls", "["+strings.Join(toolCalls, ",")+"]")
+		reason = FinishReasonToolUse
+	}
+	out, _ = sjson.Set(out, "choices.0.finish_reason", reason.OpenAIChatFinishReason())
+	out, _ = sjson.SetRaw(out, "usage", ollamaUsageToOpenAIChat(root))
+	return out, nil
+}
+
+// ollamaToOpenAIChatStreamState tracks an Ollama stream converted to chat chunks.
+type ollamaToOpenAIChatStreamState struct {
+	id        string
+	model     string
+	created   int64
+	started   bool
+	done      bool
+	toolCalls int
+}
+
+func (s *ollamaToOpenAIChatStreamState) chunk(delta string, finishReason string) string {
+	out := `{"id":"","object":"chat.completion.chunk","created":0,"model":"","choices":[{"index":0}]}`
+	out, _ = sjson.Set(out, "id", s.id)
+	out, _ = sjson.Set(out, "created", s.created)
+	out, _ = sjson.Set(out, "model", s.model)
+	out, _ = sjson.SetRaw(out, "choices.0.delta", delta)
+	if finishReason != "" {
+		out, _ = sjson.Set(out, "choices.0.finish_reason", finishReason)
+	} else {
+		out, _ = sjson.SetRaw(out, "choices.0.finish_reason", "null")
+	}
+	return FormatSSEEvent("", out)
+}
+
+// ConvertOllamaResponseToOpenAIChat converts one Ollama stream chunk (a single
+// NDJSON line) to chat completion chunks. The first chunk carries the assistant
+// role, the chunk with done=true carries the finish reason and "data: [DONE]"
+// follows it. A usage chunk is sent only when the client asked for
+// stream_options.include_usage.
+func ConvertOllamaResponseToOpenAIChat(_ context.Context, model string, originalRequestRawJSON, _, rawJSON []byte, param *any) ([]string, error) {
+	if *param == nil {
+		*param = &ollamaToOpenAIChatStreamState{id: "chatcmpl-" + uuid.NewString(), model: model, created: time.Now().Unix()}
+	}
+	s := (*param).(*ollamaToOpenAIChatStreamState)
+	if s.done {
+		return nil, nil
+	}
+	if strings.TrimSpace(string(rawJSON)) == "[DONE]" {
+		s.done = true
+		return []string{FormatSSEDone()}, nil
+	}
+	if !gjson.ValidBytes(rawJSON) {
+		return nil, fmt.Errorf("ollama stream: invalid JSON chunk")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	if errValue := root.Get("error"); errValue.Exists() {
+		s.done = true
+		return []string{FormatSSEEvent("", ollamaErrorToOpenAI(errValue)), FormatSSEDone()}, nil
+	}
+
+	var out []string
+	if !s.started {
+		s.started = true
+		s.created = ollamaCreated(root)
+		if m := root.Get("model").String(); m != "" {
+			s.model = m
+		}
+		out = append(out, s.chunk(`{"role":"assistant","content":""}`, ""))
+	}
+	if thinking := ollamaThinking(root); thinking != "" {
+		d, _ := sjson.Set(`{}`, "reasoning_content", thinking)
+		out = append(out, s.chunk(d, ""))
+	}
+	if text := ollamaText(root); text != "" {
+		d, _ := sjson.Set(`{}`, "content", text)
+		out = append(out, s.chunk(d, ""))
+	}
+	for _, tc := range root.Get("message.tool_calls").Array() {
+		call, _ := sjson.Set(ollamaToolCall(tc), "index", s.toolCalls)
+		s.toolCalls++
+		out = append(out, s.chunk(`{"tool_calls":[`+call+`]}`, ""))
+	}
+
+	if !root.Get("done").Bool() {
+		return out, nil
+	}
+	s.done = true
+	reason := FinishReasonFromOllama(root.Get("done_reason").String())
+	if s.toolCalls > 0 {
+		reason = FinishReasonToolUse
+	}
+	out = append(out, s.chunk(`{}`, reason.OpenAIChatFinishReason()))
+	if gjson.GetBytes(originalRequestRawJSON, "stream_options.include_usage").Bool() {
+		usage := `{"id":"","object":"chat.completion.chunk","created":0,"model":"","choices":[]}`
+		usage, _ = sjson.Set(usage, "id", s.id)
+		usage, _ = sjson.Set(usage, "created", s.created)
+		usage, _ = sjson.Set(usage, "model", s.model)
+		usage, _ = sjson.SetRaw(usage, "usage", ollamaUsageToOpenAIChat(root))
+		out = append(out, FormatSSEEvent("", usage))
+	}
+	return append(out, FormatSSEDone()), nil
+}
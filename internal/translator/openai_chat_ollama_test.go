@@ -0,0 +1,218 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertOpenAIChatRequestToOllamaChat(t *testing.T) {
+	in := `{
+		"model": "gpt-4o",
+		"temperature": 0.2,
+		"max_tokens": 256,
+		"stop": "END",
+		"response_format": {"type":"json_object"},
+		"tools": [{"type":"function","function":{"name":"read","parameters":{"type":"object"}}}],
+		"messages": [
+			{"role":"developer","content":"be brief"},
+			{"role":"user","content":[{"type":"text","text":"open a.txt"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAA"}}]},
+			{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"read","arguments":"{\"path\":\"a.txt\"}"}}]},
+			{"role":"tool","tool_call_id":"call_1","content":"hello"}
+		]
+	}`
+	out, err := ConvertOpenAIChatRequestToOllamaChat("llama3.2", []byte(in), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.ParseBytes(out)
+	checks := map[string]string{
+		"model":                                 "llama3.2",
+		"stream":                                "false",
+		"format":                                "json",
+		"options.temperature":                   "0.2",
+		"options.num_predict":                   "256",
+		"options.stop.0":                        "END",
+		"tools.0.function.name":                 "read",
+		"messages.0.role":                       "system",
+		"messages.1.content":                    "open a.txt",
+		"messages.1.images.0":                   "AAA",
+		"messages.2.tool_calls.0.function.name": "read",
+		"messages.2.tool_calls.0.function.arguments.path": "a.txt",
+		"messages.3.role":      "tool",
+		"messages.3.tool_name": "read",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+
+	remote := `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`
+	if _, err := ConvertOpenAIChatRequestToOllamaChat("llama3.2", []byte(remote), true); err == nil {
+		t.Fatal("remote image URLs must be rejected")
+	}
+}
+
+func TestConvertOpenAIChatRequestToOllamaGenerate(t *testing.T) {
+	in := `{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`
+	out, err := ConvertOpenAIChatRequestToOllamaGenerate("llama3.2", []byte(in), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.ParseBytes(out)
+	if res.Get("prompt").String() != "hi" || res.Get("system").String() != "be brief" || !res.Get("stream").Bool() {
+		t.Fatalf("unexpected generate request %s", out)
+	}
+
+	multi := `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"bye"}]}`
+	out, err = ConvertOpenAIChatRequestToOllamaGenerate("llama3.2", []byte(multi), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "User: hi\n\nAssistant: hello\n\nUser: bye\n\nAssistant:"; gjson.GetBytes(out, "prompt").String() != want {
+		t.Fatalf("prompt = %q, want %q", gjson.GetBytes(out, "prompt").String(), want)
+	}
+
+	tools := `{"tools":[{"type":"function","function":{"name":"read"}}],"messages":[{"role":"user","content":"hi"}]}`
+	if _, err := ConvertOpenAIChatRequestToOllamaGenerate("llama3.2", []byte(tools), false); err == nil {
+		t.Fatal("tools must be rejected for /api/generate")
+	}
+}
+
+func TestConvertOllamaResponseToOpenAIChatNonStream(t *testing.T) {
+	in := `{"model":"llama3.2","created_at":"2026-10-15T10:00:00Z","message":{"role":"assistant","content":"","thinking":"hmm","tool_calls":[{"function":{"name":"read","arguments":{"path":"a.txt"}}}]},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":5}`
+	out, err := ConvertOllamaResponseToOpenAIChatNonStream(context.Background(), "m", nil, nil, []byte(in), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.Parse(out)
+	checks := map[string]string{
+		"object":                              "chat.completion",
+		"model":                               "llama3.2",
+		"choices.0.message.reasoning_content": "hmm",
+		"choices.0.message.tool_calls.0.function.name": "read",
+		"choices.0.finish_reason":                      "tool_calls",
+		"usage.prompt_tokens":                          "12",
+		"usage.completion_tokens":                      "5",
+		"usage.total_tokens":                           "17",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if res.Get("choices.0.message.content").Type != gjson.Null {
+		t.Errorf("content must be null for tool-only responses: %s", out)
+	}
+
+	generate := `{"model":"llama3.2","response":"Hi","done":true,"done_reason":"length","prompt_eval_count":3,"eval_count":1}`
+	out, err = ConvertOllamaResponseToOpenAIChatNonStream(context.Background(), "m", nil, nil, []byte(generate), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gjson.Get(out, "choices.0.message.content").String() != "Hi" || gjson.Get(out, "choices.0.finish_reason").String() != "length" {
+		t.Fatalf("unexpected generate response %s", out)
+	}
+
+	out, err = ConvertOllamaResponseToOpenAIChatNonStream(context.Background(), "m", nil, nil, []byte(`{"error":"model \"x\" not found"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gjson.Get(out, "error.message").String() != `model "x" not found` {
+		t.Fatalf("unexpected error response %s", out)
+	}
+}
+
+func TestConvertOllamaResponseToOpenAIChatStream(t *testing.T) {
+	chunks := []string{
+		`{"model":"llama3.2","created_at":"2026-10-15T10:00:00Z","message":{"role":"assistant","content":"","thinking":"hm"},"done":false}`,
+		`{"model":"llama3.2","created_at":"2026-10-15T10:00:00Z","message":{"role":"assistant","content":"Hi"},"done":false}`,
+		`{"model":"llama3.2","created_at":"2026-10-15T10:00:00Z","message":{"role":"assistant","content":" there"},"done":false}`,
+		`{"model":"llama3.2","created_at":"2026-10-15T10:00:01Z","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":8,"eval_count":3}`,
+		`[DONE]`,
+	}
+	var param any
+	var out []string
+	original := []byte(`{"stream":true,"stream_options":{"include_usage":true}}`)
+	for _, c := range chunks {
+		got, err := ConvertOllamaResponseToOpenAIChat(context.Background(), "m", original, nil, []byte(c), &param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, got...)
+	}
+	joined := strings.Join(out, "")
+	if strings.Count(joined, "data: [DONE]") != 1 {
+		t.Fatalf("expected exactly one [DONE], got:\n%s", joined)
+	}
+	var content, reasoning strings.Builder
+	var role, finish string
+	var usage gjson.Result
+	ids := make(map[string]bool)
+	for _, chunk := range claudeEvents(t, out) {
+		if id := chunk.Get("id").String(); id != "" {
+			ids[id] = true
+		}
+		if r := chunk.Get("choices.0.delta.role").String(); r != "" {
+			role = r
+		}
+		content.WriteString(chunk.Get("choices.0.delta.content").String())
+		reasoning.WriteString(chunk.Get("choices.0.delta.reasoning_content").String())
+		if fr := chunk.Get("choices.0.finish_reason").String(); fr != "" {
+			finish = fr
+		}
+		if u := chunk.Get("usage"); u.Exists() {
+			usage = u
+		}
+	}
+	if role != "assistant" || content.String() != "Hi there" || reasoning.String() != "hm" || finish != "length" {
+		t.Fatalf("role %q content %q reasoning %q finish %q", role, content.String(), reasoning.String(), finish)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("chunks must share one completion id, got %v", ids)
+	}
+	if usage.Get("prompt_tokens").Int() != 8 || usage.Get("completion_tokens").Int() != 3 {
+		t.Fatalf("unexpected usage %s", usage.Raw)
+	}
+}
+
+func TestConvertOllamaResponseToOpenAIChatStream_ToolCallsAndError(t *testing.T) {
+	var param any
+	got, err := ConvertOllamaResponseToOpenAIChat(context.Background(), "m", nil, nil,
+		[]byte(`{"model":"llama3.2","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"read","arguments":{"path":"a"}}}]},"done":true,"done_reason":"stop"}`), &param)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var finish, args string
+	for _, chunk := range claudeEvents(t, got) {
+		if fr := chunk.Get("choices.0.finish_reason").String(); fr != "" {
+			finish = fr
+		}
+		args += chunk.Get("choices.0.delta.tool_calls.0.function.arguments").String()
+	}
+	if finish != "tool_calls" || gjson.Get(args, "path").String() != "a" {
+		t.Fatalf("finish %q args %q", finish, args)
+	}
+	if strings.Contains(strings.Join(got, ""), `"usage"`) {
+		t.Fatal("usage chunk must only be sent when include_usage is requested")
+	}
+
+	param = nil
+	got, err = ConvertOllamaResponseToOpenAIChat(context.Background(), "m", nil, nil, []byte(`{"error":"out of memory"}`), &param)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(got, "")
+	if !strings.Contains(joined, `"message":"out of memory"`) || !strings.HasSuffix(joined, "data: [DONE]\n\n") {
+		t.Fatalf("unexpected error events:\n%s", joined)
+	}
+}
+
+func TestFinishReasonFromOllama(t *testing.T) {
+	if FinishReasonFromOllama("length") != FinishReasonLength || FinishReasonFromOllama("stop") != FinishReasonStop || FinishReasonFromOllama("") != FinishReasonStop {
+		t.Fatal("unexpected ollama finish reason mapping")
+	}
+}
@@ -0,0 +1,581 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// OpenAI Responses client -> Claude Messages upstream.
+
+// ConvertOpenAIResponsesRequestToClaude converts a /v1/responses request to a Claude
+// /v1/messages request. Instructions and system/developer messages become the system
+// prompt, function_call items become tool_use blocks and function_call_output items
+// become tool_result blocks. Reasoning items are dropped since Claude rejects
+// unsigned thinking blocks.
+func ConvertOpenAIResponsesRequestToClaude(model string, rawJSON []byte, stream bool) ([]byte, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return nil, fmt.Errorf("openai responses request: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	out := `{}`
+
+	if model == "" {
+		model = root.Get("model").String()
+	}
+	out, _ = sjson.Set(out, "model", model)
+
+	maxTokens := root.Get("max_output_tokens").Int()
+	if maxTokens == 0 {
+		maxTokens = defaultClaudeMaxTokens
+	}
+
+	var system []string
+	if text := root.Get("instructions").String(); text != "" {
+		block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+		system = append(system, block)
+	}
+	var messages []chatToClaudeMessage
+	input := root.Get("input")
+	if input.Type == gjson.String {
+		messages = appendClaudeMessage(messages, "user", openAIResponsesContentBlocks(input)...)
+	}
+	for _, item := range input.Array() {
+		switch item.Get("type").String() {
+		case "message", "":
+			switch role := item.Get("role").String(); role {
+			case "system", "developer":
+				if text := openAIResponsesContentText(item.Get("content")); text != "" {
+					block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+					system = append(system, block)
+				}
+			case "assistant":
+				messages = appendClaudeMessage(messages, "assistant", openAIResponsesContentBlocks(item.Get("content"))...)
+			default:
+				messages = appendClaudeMessage(messages, "user", openAIResponsesContentBlocks(item.Get("content"))...)
+			}
+		case "function_call":
+			block := `{"type":"tool_use"}`
+			block, _ = sjson.Set(block, "id", item.Get("call_id").String())
+			block, _ = sjson.Set(block, "name", item.Get("name").String())
+			block, _ = sjson.SetRaw(block, "input", toolArgumentsObject(item.Get("arguments").String()))
+			messages = appendClaudeMessage(messages, "assistant", block)
+		case "function_call_output":
+			block := `{"type":"tool_result"}`
+			block, _ = sjson.Set(block, "tool_use_id", item.Get("call_id").String())
+			block, _ = sjson.Set(block, "content", openAIResponsesContentText(item.Get("output")))
+			messages = appendClaudeMessage(messages, "user", block)
+		}
+	}
+	if len(system) > 0 {
+		out, _ = sjson.SetRaw(out, "system", "["+strings.Join(system, ",")+"]")
+	}
+	rendered := make([]string, 0, len(messages))
+	for _, m := range messages {
+		msg, _ := sjson.Set(`{}`, "role", m.role)
+		msg, _ = sjson.SetRaw(msg, "content", "["+strings.Join(m.blocks, ",")+"]")
+		rendered = append(rendered, msg)
+	}
+	out, _ = sjson.SetRaw(out, "messages", "["+strings.Join(rendered, ",")+"]")
+
+	budget := reasoningEffortBudget(root.Get("reasoning.effort").String())
+	if budget > 0 {
+		// Claude requires max_tokens > budget_tokens and does not accept sampling
+		// parameters together with extended thinking.
+		if maxTokens <= budget {
+			maxTokens = budget + defaultClaudeMaxTokens
+		}
+		out, _ = sjson.Set(out, "thinking.type", "enabled")
+		out, _ = sjson.Set(out, "thinking.budget_tokens", budget)
+	} else {
+		for _, key := range []string{"temperature", "top_p"} {
+			if v := root.Get(key); v.Exists() {
+				out, _ = sjson.SetRaw(out, key, v.Raw)
+			}
+		}
+	}
+	out, _ = sjson.Set(out, "max_tokens", maxTokens)
+
+	if user := root.Get("user").String(); user != "" {
+		out, _ = sjson.Set(out, "metadata.user_id", user)
+	}
+
+	var tools []string
+	for _, tool := range root.Get("tools").Array() {
+		// Built-in tools (web_search, file_search, ...) have no Claude function equivalent.
+		if tool.Get("type").String() != "function" {
+			continue
+		}
+		t, _ := sjson.Set(`{}`, "name", tool.Get("name").String())
+		if desc := tool.Get("description").String(); desc != "" {
+			t, _ = sjson.Set(t, "description", desc)
+		}
+		if params := tool.Get("parameters"); params.IsObject() {
+			t, _ = sjson.SetRaw(t, "input_schema", params.Raw)
+		} else {
+			t, _ = sjson.SetRaw(t, "input_schema", `{"type":"object","properties":{}}`)
+		}
+		tools = append(tools, t)
+	}
+	if len(tools) > 0 {
+		out, _ = sjson.SetRaw(out, "tools", "["+strings.Join(tools, ",")+"]")
+
+		choice := root.Get("tool_choice")
+		switch {
+		case choice.String() == "auto":
+			out, _ = sjson.Set(out, "tool_choice.type", "auto")
+		case choice.String() == "required":
+			out, _ = sjson.Set(out, "tool_choice.type", "any")
+		case choice.String() == "none":
+			out, _ = sjson.Set(out, "tool_choice.type", "none")
+		case choice.IsObject() && choice.Get("name").String() != "":
+			out, _ = sjson.Set(out, "tool_choice.type", "tool")
+			out, _ = sjson.Set(out, "tool_choice.name", choice.Get("name").String())
+		}
+		if ptc := root.Get("parallel_tool_calls"); ptc.Exists() && !ptc.Bool() {
+			if !gjson.Get(out, "tool_choice").Exists() {
+				out, _ = sjson.Set(out, "tool_choice.type", "auto")
+			}
+			out, _ = sjson.Set(out, "tool_choice.disable_parallel_tool_use", true)
+		}
+	}
+
+	if stream {
+		out, _ = sjson.Set(out, "stream", true)
+	}
+	return []byte(out), nil
+}
+
+// openAIResponsesContentText flattens Responses content (string or parts) to text.
+func openAIResponsesContentText(content gjson.Result) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	var parts []string
+	for _, part := range content.Array() {
+		switch part.Get("type").String() {
+		case "input_text", "output_text", "text":
+			parts = append(parts, part.Get("text").String())
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// openAIResponsesContentBlocks converts Responses message content to Claude content blocks.
+func openAIResponsesContentBlocks(content gjson.Result) []string {
+	if content.Type == gjson.String {
+		if content.String() == "" {
+			return nil
+		}
+		block, _ := sjson.Set(`{"type":"text"}`, "text", content.String())
+		return []string{block}
+	}
+	var blocks []string
+	for _, part := range content.Array() {
+		var text string
+		switch part.Get("type").String() {
+		case "input_text", "output_text", "text":
+			text = part.Get("text").String()
+		case "refusal":
+			text = part.Get("refusal").String()
+		case "input_image":
+			if block := claudeImageBlock(part.Get("image_url").String()); block != "" {
+				blocks = append(blocks, block)
+			}
+		}
+		if text != "" {
+			block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// responsesID derives a Responses id from a Claude message id.
+func responsesID(id string) string {
+	if id == "" || strings.HasPrefix(id, "resp_") {
+		return id
+	}
+	return "resp_" + strings.TrimPrefix(id, "msg_")
+}
+
+// responsesItemID derives a stable output item id from the response id.
+func responsesItemID(prefix, responseID string, outputIndex int) string {
+	return fmt.Sprintf("%s_%s_%d", prefix, strings.TrimPrefix(responseID, "resp_"), outputIndex)
+}
+
+// claudeUsageToOpenAIResponses converts Claude usage; input_tokens includes cache
+// reads and writes, as OpenAI reports cached tokens as part of the input.
+func claudeUsageToOpenAIResponses(input, output, cacheRead, cacheCreation int64) string {
+	prompt := input + cacheRead + cacheCreation
+	out := `{"input_tokens":0,"input_tokens_details":{"cached_tokens":0},"output_tokens":0,"output_tokens_details":{"reasoning_tokens":0},"total_tokens":0}`
+	out, _ = sjson.Set(out, "input_tokens", prompt)
+	out, _ = sjson.Set(out, "input_tokens_details.cached_tokens", cacheRead)
+	out, _ = sjson.Set(out, "output_tokens", output)
+	out, _ = sjson.Set(out, "total_tokens", prompt+output)
+	return out
+}
+
+// claudeResponsesObject renders a response object; stop_reason max_tokens and refusal
+// mark the response incomplete as OpenAI does.
+func claudeResponsesObject(id, model string, createdAt int64, stopReason string, output []string, usage string) string {
+	out := `{"id":"","object":"response","created_at":0,"status":"completed","error":null,"incomplete_details":null,"model":"","output":[]}`
+	out, _ = sjson.Set(out, "id", id)
+	out, _ = sjson.Set(out, "created_at", createdAt)
+	out, _ = sjson.Set(out, "model", model)
+	if stopReason == "" {
+		out, _ = sjson.Set(out, "status", "in_progress")
+	} else if reason := FinishReasonFromClaude(stopReason).OpenAIResponsesIncompleteReason(); reason != "" {
+		out, _ = sjson.Set(out, "status", "incomplete")
+		out, _ = sjson.Set(out, "incomplete_details.reason", reason)
+	}
+	if len(output) > 0 {
+		out, _ = sjson.SetRaw(out, "output", "["+strings.Join(output, ",")+"]")
+	}
+	if usage != "" {
+		out, _ = sjson.SetRaw(out, "usage", usage)
+	}
+	return out
+}
+
+// claudeBlockToResponsesItem converts a complete Claude content block to a Responses output item.
+func claudeBlockToResponsesItem(block gjson.Result, itemID string) string {
+	switch block.Get("type").String() {
+	case "text":
+		item := `{"id":"","type":"message","status":"completed","role":"assistant","content":[{"type":"output_text","text":"","annotations":[]}]}`
+		item, _ = sjson.Set(item, "id", itemID)
+		item, _ = sjson.Set(item, "content.0.text", block.Get("text").String())
+		return item
+	case "thinking":
+		item := `{"id":"","type":"reasoning","summary":[{"type":"summary_text","text":""}]}`
+		item, _ = sjson.Set(item, "id", itemID)
+		item, _ = sjson.Set(item, "summary.0.text", block.Get("thinking").String())
+		return item
+	case "tool_use":
+		args := block.Get("input").Raw
+		if args == "" {
+			args = "{}"
+		}
+		item := `{"id":"","type":"function_call","status":"completed","arguments":"","call_id":"","name":""}`
+		item, _ = sjson.Set(item, "id", itemID)
+		item, _ = sjson.Set(item, "arguments", args)
+		item, _ = sjson.Set(item, "call_id", block.Get("id").String())
+		item, _ = sjson.Set(item, "name", block.Get("name").String())
+		return item
+	}
+	return ""
+}
+
+// responsesItemPrefix is the OpenAI id prefix for the item produced from a Claude block type.
+func responsesItemPrefix(blockType string) string {
+	switch blockType {
+	case "thinking":
+		return "rs"
+	case "tool_use":
+		return "fc"
+	}
+	return "msg"
+}
+
+// ConvertClaudeResponseToOpenAIResponsesNonStream converts a Claude message to a response object.
+func ConvertClaudeResponseToOpenAIResponsesNonStream(_ context.Context, model string, _, _, rawJSON []byte, _ *any) (string, error) {
+	if !gjson.ValidBytes(rawJSON) {
+		return "", fmt.Errorf("claude response: invalid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	if root.Get("type").String() == "error" {
+		return claudeErrorToOpenAI(root.Get("error")), nil
+	}
+
+	id := responsesID(root.Get("id").String())
+	if m := root.Get("model").String(); m != "" {
+		model = m
+	}
+	var output []string
+	for _, block := range root.Get("content").Array() {
+		if item := claudeBlockToResponsesItem(block, responsesItemID(responsesItemPrefix(block.Get("type").String()), id, len(output))); item != "" {
+			output = append(output, item)
+		}
+	}
+
+	stopReason := root.Get("stop_reason").String()
+	if stopReason == "" {
+		stopReason = FinishReasonStop.ClaudeStopReason()
+	}
+	usage := root.Get("usage")
+	return claudeResponsesObject(id, model, time.Now().Unix(), stopReason, output, claudeUsageToOpenAIResponses(
+		usage.Get("input_tokens").Int(),
+		usage.Get("output_tokens").Int(),
+		usage.Get("cache_read_input_tokens").Int(),
+		usage.Get("cache_creation_input_tokens").Int(),
+	)), nil
+}
+
+// claudeToOpenAIResponsesStreamState tracks a Claude stream converted to Responses
+// events. Completed output items are collected for the final response.completed event.
+type claudeToOpenAIResponsesStreamState struct {
+	id        string
+	model     string
+	createdAt int64
+	started   bool
+	done      bool
+	seq       int64
+	output    []string
+	// blocks maps Claude block indexes to the output items being streamed.
+	blocks        map[int64]*claudeResponsesItem
+	stopReason    string
+	inputTokens   int64
+	outputTokens  int64
+	cacheRead     int64
+	cacheCreation int64
+}
+
+// claudeResponsesItem accumulates one Claude content block streamed as an output item.
+type claudeResponsesItem struct {
+	outputIndex int
+	id          string
+	blockType   string
+	callID      string
+	name        string
+	text        strings.Builder
+}
+
+// event renders one Responses SSE event, numbering it in stream order. type and
+// sequence_number lead the payload as in OpenAI's own streams.
+func (s *claudeToOpenAIResponsesStreamState) event(eventType, data string) string {
+	head, _ := sjson.Set(`{"type":""}`, "type", eventType)
+	head, _ = sjson.Set(head, "sequence_number", s.seq)
+	if body := strings.TrimSpace(data); len(body) > 2 {
+		data = head[:len(head)-1] + "," + body[1:]
+	} else {
+		data = head
+	}
+	s.seq++
+	return FormatSSEEvent(eventType, data)
+}
+
+func (s *claudeToOpenAIResponsesStreamState) response(stopReason string) string {
+	usage := ""
+	if stopReason != "" {
+		usage = claudeUsageToOpenAIResponses(s.inputTokens, s.outputTokens, s.cacheRead, s.cacheCreation)
+	}
+	return claudeResponsesObject(s.id, s.model, s.createdAt, stopReason, s.output, usage)
+}
+
+func (s *claudeToOpenAIResponsesStreamState) itemEvent(eventType string, item *claudeResponsesItem, data string) string {
+	data, _ = sjson.Set(data, "item_id", item.id)
+	data, _ = sjson.Set(data, "output_index", item.outputIndex)
+	return s.event(eventType, data)
+}
+
+func (s *claudeToOpenAIResponsesStreamState) startBlock(index int64, block gjson.Result) []string {
+	blockType := block.Get("type").String()
+	if blockType != "text" && blockType != "thinking" && blockType != "tool_use" {
+		return nil
+	}
+	outputIndex := len(s.output) + len(s.blocks)
+	item := &claudeResponsesItem{
+		outputIndex: outputIndex,
+		id:          responsesItemID(responsesItemPrefix(blockType), s.id, outputIndex),
+		blockType:   blockType,
+		callID:      block.Get("id").String(),
+		name:        block.Get("name").String(),
+	}
+	s.blocks[index] = item
+
+	var added string
+	switch blockType {
+	case "text":
+		added = `{"id":"","type":"message","status":"in_progress","role":"assistant","content":[]}`
+	case "thinking":
+		added = `{"id":"","type":"reasoning","summary":[]}`
+	case "tool_use":
+		added = `{"id":"","type":"function_call","status":"in_progress","arguments":"","call_id":"","name":""}`
+		added, _ = sjson.Set(added, "call_id", item.callID)
+		added, _ = sjson.Set(added, "name", item.name)
+	}
+	added, _ = sjson.Set(added, "id", item.id)
+	ev, _ := sjson.Set(`{}`, "output_index", outputIndex)
+	ev, _ = sjson.SetRaw(ev, "item", added)
+	out := []string{s.event("response.output_item.added", ev)}
+
+	switch blockType {
+	case "text":
+		out = append(out, s.itemEvent("response.content_part.added", item, `{"content_index":0,"part":{"type":"output_text","text":"","annotations":[]}}`))
+	case "thinking":
+		out = append(out, s.itemEvent("response.reasoning_summary_part.added", item, `{"summary_index":0,"part":{"type":"summary_text","text":""}}`))
+	}
+	return out
+}
+
+func (s *claudeToOpenAIResponsesStreamState) blockDelta(index int64, delta gjson.Result) []string {
+	item, ok := s.blocks[index]
+	if !ok {
+		return nil
+	}
+	var text, eventType, data string
+	switch delta.Get("type").String() {
+	case "text_delta":
+		text, eventType, data = delta.Get("text").String(), "response.output_text.delta", `{"content_index":0}`
+	case "thinking_delta":
+		text, eventType, data = delta.Get("thinking").String(), "response.reasoning_summary_text.delta", `{"summary_index":0}`
+	case "input_json_delta":
+		text, eventType, data = delta.Get("partial_json").String(), "response.function_call_arguments.delta", `{}`
+	default:
+		return nil
+	}
+	if text == "" {
+		return nil
+	}
+	item.text.WriteString(text)
+	data, _ = sjson.Set(data, "delta", text)
+	return []string{s.itemEvent(eventType, item, data)}
+}
+
+func (s *claudeToOpenAIResponsesStreamState) stopBlock(index int64) []string {
+	item, ok := s.blocks[index]
+	if !ok {
+		return nil
+	}
+	delete(s.blocks, index)
+
+	var out []string
+	var block string
+	text := item.text.String()
+	switch item.blockType {
+	case "text":
+		d, _ := sjson.Set(`{"content_index":0}`, "text", text)
+		out = append(out, s.itemEvent("response.output_text.done", item, d))
+		part, _ := sjson.Set(`{"content_index":0,"part":{"type":"output_text","annotations":[]}}`, "part.text", text)
+		out = append(out, s.itemEvent("response.content_part.done", item, part))
+		block, _ = sjson.Set(`{"type":"text"}`, "text", text)
+	case "thinking":
+		d, _ := sjson.Set(`{"summary_index":0}`, "text", text)
+		out = append(out, s.itemEvent("response.reasoning_summary_text.done", item, d))
+		part, _ := sjson.Set(`{"summary_index":0,"part":{"type":"summary_text"}}`, "part.text", text)
+		out = append(out, s.itemEvent("response.reasoning_summary_part.done", item, part))
+		block, _ = sjson.Set(`{"type":"thinking"}`, "thinking", text)
+	case "tool_use":
+		args := toolArgumentsObject(text)
+		d, _ := sjson.Set(`{}`, "arguments", args)
+		out = append(out, s.itemEvent("response.function_call_arguments.done", item, d))
+		block, _ = sjson.Set(`{"type":"tool_use"}`, "id", item.callID)
+		block, _ = sjson.Set(block, "name", item.name)
+		block, _ = sjson.SetRaw(block, "input", args)
+	}
+
+	done := claudeBlockToResponsesItem(gjson.Parse(block), item.id)
+	ev, _ := sjson.Set(`{}`, "output_index", item.outputIndex)
+	ev, _ = sjson.SetRaw(ev, "item", done)
+	out = append(out, s.event("response.output_item.done", ev))
+	// Items complete in order since Claude blocks do not interleave.
+	s.output = append(s.output, done)
+	return out
+}
+
+func (s *claudeToOpenAIResponsesStreamState) finish() []string {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	var out []string
+	for index := range s.blocks {
+		out = append(out, s.stopBlock(index)...)
+	}
+	if s.stopReason == "" {
+		s.stopReason = FinishReasonStop.ClaudeStopReason()
+	}
+	response := s.response(s.stopReason)
+	eventType := "response.completed"
+	if gjson.Get(response, "status").String() == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	ev, _ := sjson.SetRaw(`{}`, "response", response)
+	return append(out, s.event(eventType, ev))
+}
+
+// ConvertClaudeResponseToOpenAIResponses converts one Claude SSE event payload to
+// Responses stream events. Each returned string is a complete SSE event; the
+// stream ends with response.completed (or response.incomplete), which carries
+// the aggregated output items and usage.
+func ConvertClaudeResponseToOpenAIResponses(_ context.Context, model string, _, _, rawJSON []byte, param *any) ([]string, error) {
+	if *param == nil {
+		*param = &claudeToOpenAIResponsesStreamState{model: model, createdAt: time.Now().Unix(), blocks: make(map[int64]*claudeResponsesItem)}
+	}
+	s := (*param).(*claudeToOpenAIResponsesStreamState)
+	if s.done {
+		return nil, nil
+	}
+	if strings.TrimSpace(string(rawJSON)) == "[DONE]" {
+		if !s.started {
+			return nil, nil
+		}
+		return s.finish(), nil
+	}
+	if !gjson.ValidBytes(rawJSON) {
+		return nil, fmt.Errorf("claude stream: invalid JSON event")
+	}
+	root := gjson.ParseBytes(rawJSON)
+
+	switch root.Get("type").String() {
+	case "message_start":
+		if s.started {
+			return nil, nil
+		}
+		s.started = true
+		msg := root.Get("message")
+		s.id = responsesID(msg.Get("id").String())
+		if m := msg.Get("model").String(); m != "" {
+			s.model = m
+		}
+		s.inputTokens = msg.Get("usage.input_tokens").Int()
+		s.outputTokens = msg.Get("usage.output_tokens").Int()
+		s.cacheRead = msg.Get("usage.cache_read_input_tokens").Int()
+		s.cacheCreation = msg.Get("usage.cache_creation_input_tokens").Int()
+		ev, _ := sjson.SetRaw(`{}`, "response", s.response(""))
+		return []string{s.event("response.created", ev), s.event("response.in_progress", ev)}, nil
+
+	case "content_block_start":
+		return s.startBlock(root.Get("index").Int(), root.Get("content_block")), nil
+
+	case "content_block_delta":
+		return s.blockDelta(root.Get("index").Int(), root.Get("delta")), nil
+
+	case "content_block_stop":
+		return s.stopBlock(root.Get("index").Int()), nil
+
+	case "message_delta":
+		usage := root.Get("usage")
+		if v := usage.Get("output_tokens"); v.Exists() {
+			s.outputTokens = v.Int()
+		}
+		if v := usage.Get("input_tokens"); v.Exists() {
+			s.inputTokens = v.Int()
+		}
+		if v := usage.Get("cache_read_input_tokens"); v.Exists() {
+			s.cacheRead = v.Int()
+		}
+		if v := usage.Get("cache_creation_input_tokens"); v.Exists() {
+			s.cacheCreation = v.Int()
+		}
+		if stopReason := root.Get("delta.stop_reason").String(); stopReason != "" {
+			s.stopReason = stopReason
+		}
+		return nil, nil
+
+	case "message_stop":
+		return s.finish(), nil
+
+	case "error":
+		s.done = true
+		errObj := root.Get("error")
+		ev, _ := sjson.Set(`{}`, "code", errObj.Get("type").String())
+		ev, _ = sjson.Set(ev, "message", errObj.Get("message").String())
+		return []string{s.event("error", ev)}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,180 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertOpenAIResponsesRequestToClaude(t *testing.T) {
+	in := `{
+		"model": "gpt-5",
+		"instructions": "be brief",
+		"max_output_tokens": 1000,
+		"reasoning": {"effort":"medium","summary":"auto"},
+		"temperature": 0.3,
+		"tools": [{"type":"function","name":"read","parameters":{"type":"object","properties":{"path":{"type":"string"}}}},{"type":"web_search"}],
+		"tool_choice": {"type":"function","name":"read"},
+		"input": [
+			{"type":"message","role":"developer","content":"use tools"},
+			{"role":"user","content":[{"type":"input_text","text":"open a.txt"},{"type":"input_image","image_url":"https://example.com/a.png"}]},
+			{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"ignored"}],"encrypted_content":"x"},
+			{"type":"message","role":"assistant","content":[{"type":"output_text","text":"reading"}]},
+			{"type":"function_call","call_id":"call_1","name":"read","arguments":"{\"path\":\"a.txt\"}"},
+			{"type":"function_call_output","call_id":"call_1","output":"hello"},
+			{"role":"user","content":"summarize"}
+		]
+	}`
+	out, err := ConvertOpenAIResponsesRequestToClaude("claude-sonnet-4", []byte(in), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.ParseBytes(out)
+	checks := map[string]string{
+		"model":                            "claude-sonnet-4",
+		"system.0.text":                    "be brief",
+		"system.1.text":                    "use tools",
+		"thinking.budget_tokens":           "8192",
+		"tools.#":                          "1",
+		"tools.0.input_schema.type":        "object",
+		"tool_choice.type":                 "tool",
+		"tool_choice.name":                 "read",
+		"messages.#":                       "3",
+		"messages.0.content.1.source.url":  "https://example.com/a.png",
+		"messages.1.role":                  "assistant",
+		"messages.1.content.0.text":        "reading",
+		"messages.1.content.1.type":        "tool_use",
+		"messages.1.content.1.input.path":  "a.txt",
+		"messages.2.content.0.type":        "tool_result",
+		"messages.2.content.0.tool_use_id": "call_1",
+		"messages.2.content.0.content":     "hello",
+		"messages.2.content.1.text":        "summarize",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if res.Get("max_tokens").Int() <= 8192 {
+		t.Errorf("max_tokens must exceed the thinking budget: %s", out)
+	}
+	if res.Get("temperature").Exists() {
+		t.Error("temperature must be dropped with extended thinking")
+	}
+}
+
+func TestConvertOpenAIResponsesRequestToClaude_StringInput(t *testing.T) {
+	out, err := ConvertOpenAIResponsesRequestToClaude("", []byte(`{"model":"gpt-5","input":"hi","stream":true}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.ParseBytes(out)
+	if res.Get("messages.0.content.0.text").String() != "hi" || res.Get("max_tokens").Int() != defaultClaudeMaxTokens || !res.Get("stream").Bool() {
+		t.Fatalf("unexpected request %s", out)
+	}
+}
+
+func TestConvertClaudeResponseToOpenAIResponsesNonStream(t *testing.T) {
+	in := `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"thinking","thinking":"hmm","signature":"s"},{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_1","name":"read","input":{"path":"a.txt"}}],"stop_reason":"tool_use","usage":{"input_tokens":10,"cache_read_input_tokens":30,"output_tokens":7}}`
+	out, err := ConvertClaudeResponseToOpenAIResponsesNonStream(context.Background(), "m", nil, nil, []byte(in), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := gjson.Parse(out)
+	checks := map[string]string{
+		"id":                      "resp_1",
+		"object":                  "response",
+		"status":                  "completed",
+		"output.0.type":           "reasoning",
+		"output.0.summary.0.text": "hmm",
+		"output.1.content.0.text": "checking",
+		"output.2.type":           "function_call",
+		"output.2.call_id":        "toolu_1",
+		"usage.input_tokens":      "40",
+		"usage.input_tokens_details.cached_tokens": "30",
+		"usage.total_tokens":                       "47",
+	}
+	for path, want := range checks {
+		if got := res.Get(path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if args := res.Get("output.2.arguments").String(); gjson.Get(args, "path").String() != "a.txt" {
+		t.Errorf("unexpected function call arguments %s", args)
+	}
+}
+
+func TestConvertClaudeResponseToOpenAIResponsesStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"s"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"read","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"a\"}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`,
+		`{"type":"message_stop"}`,
+		`[DONE]`,
+	}
+	var param any
+	var out []string
+	for _, ev := range events {
+		got, err := ConvertClaudeResponseToOpenAIResponses(context.Background(), "m", nil, nil, []byte(ev), &param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, got...)
+	}
+
+	var types []string
+	var text, args string
+	var completed gjson.Result
+	for i, ev := range claudeEvents(t, out) {
+		if ev.Get("sequence_number").Int() != int64(i) {
+			t.Fatalf("event %d has sequence_number %d", i, ev.Get("sequence_number").Int())
+		}
+		types = append(types, ev.Get("type").String())
+		switch ev.Get("type").String() {
+		case "response.output_text.delta":
+			text += ev.Get("delta").String()
+		case "response.function_call_arguments.delta":
+			args += ev.Get("delta").String()
+		case "response.completed":
+			completed = ev.Get("response")
+		}
+	}
+	if text != "Hi" || args != `{"path":"a"}` {
+		t.Fatalf("text %q args %q", text, args)
+	}
+	if types[0] != "response.created" || types[len(types)-1] != "response.completed" {
+		t.Fatalf("unexpected event order %v", types)
+	}
+	if n := strings.Count(strings.Join(types, " "), "response.output_item.done"); n != 3 {
+		t.Fatalf("expected 3 output_item.done events, got %d", n)
+	}
+	checks := map[string]string{
+		"id":                      "resp_1",
+		"status":                  "completed",
+		"output.#":                "3",
+		"output.0.summary.0.text": "hmm",
+		"output.1.content.0.text": "Hi",
+		"output.2.call_id":        "toolu_1",
+		"usage.output_tokens":     "12",
+	}
+	for path, want := range checks {
+		if got := completed.Get(path).String(); got != want {
+			t.Errorf("response.%s = %q, want %q", path, got, want)
+		}
+	}
+	if gjson.Get(completed.Get("output.2.arguments").String(), "path").String() != "a" {
+		t.Errorf("unexpected arguments in completed response: %s", completed.Raw)
+	}
+}
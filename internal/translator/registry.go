@@ -10,6 +10,7 @@ type Registry struct {
 	mu        sync.RWMutex
 	requests  map[Format]map[Format]RequestTransform
 	responses map[Format]map[Format]ResponseTransform
+	metrics   *metrics
 }
 
 // NewRegistry constructs an empty translator registry.
@@ -17,6 +18,7 @@ func NewRegistry() *Registry {
 	return &Registry{
 		requests:  make(map[Format]map[Format]RequestTransform),
 		responses: make(map[Format]map[Format]ResponseTransform),
+		metrics:   newMetrics(),
 	}
 }
 
@@ -46,9 +48,12 @@ func (r *Registry) TranslateRequest(from, to Format, model string, rawJSON []byt
 
 	if byTarget, ok := r.requests[from]; ok {
 		if fn, isOk := byTarget[to]; isOk && fn != nil {
-			return fn(model, rawJSON, stream)
+			out, err := fn(model, rawJSON, stream)
+			r.metrics.record(from, to, OperationRequest, true, err)
+			return out, err
 		}
 	}
+	r.metrics.record(from, to, OperationRequest, false, nil)
 	return rawJSON, nil
 }
 
@@ -72,9 +77,12 @@ func (r *Registry) TranslateStream(ctx context.Context, from, to Format, model s
 
 	if byTarget, ok := r.responses[from]; ok {
 		if fn, isOk := byTarget[to]; isOk && fn.Stream != nil {
-			return fn.Stream(ctx, model, originalRequestRawJSON, requestRawJSON, rawJSON, param)
+			out, err := fn.Stream(ctx, model, originalRequestRawJSON, requestRawJSON, rawJSON, param)
+			r.metrics.record(from, to, OperationStream, true, err)
+			return out, err
 		}
 	}
+	r.metrics.record(from, to, OperationStream, false, nil)
 	return []string{string(rawJSON)}, nil
 }
 
@@ -85,9 +93,12 @@ func (r *Registry) TranslateNonStream(ctx context.Context, from, to Format, mode
 
 	if byTarget, ok := r.responses[from]; ok {
 		if fn, isOk := byTarget[to]; isOk && fn.NonStream != nil {
-			return fn.NonStream(ctx, model, originalRequestRawJSON, requestRawJSON, rawJSON, param)
+			out, err := fn.NonStream(ctx, model, originalRequestRawJSON, requestRawJSON, rawJSON, param)
+			r.metrics.record(from, to, OperationNonStream, true, err)
+			return out, err
 		}
 	}
+	r.metrics.record(from, to, OperationNonStream, false, nil)
 	return string(rawJSON), nil
 }
 
@@ -98,9 +109,11 @@ func (r *Registry) TranslateTokenCount(ctx context.Context, from, to Format, cou
 
 	if byTarget, ok := r.responses[from]; ok {
 		if fn, isOk := byTarget[to]; isOk && fn.TokenCount != nil {
+			r.metrics.record(from, to, OperationTokenCount, true, nil)
 			return fn.TokenCount(ctx, count)
 		}
 	}
+	r.metrics.record(from, to, OperationTokenCount, false, nil)
 	return string(rawJSON)
 }
 
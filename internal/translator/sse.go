@@ -0,0 +1,100 @@
+package translator
+
+import (
+	"io"
+	"strings"
+)
+
+// sseDone is the OpenAI-style end-of-stream marker.
+const sseDone = "[DONE]"
+
+// SSEEventWriter writes server-sent events to an io.Writer with spec-compliant
+// framing: an optional event line, one data line per payload line (CR, LF and
+// CRLF all split lines), and exactly one blank line terminating the event. Events
+// are written piecewise, so long streams never build intermediate strings. The
+// first write error is sticky and returned by every later call.
+type SSEEventWriter struct {
+	w   io.Writer
+	err error
+}
+
+// NewSSEEventWriter returns an event writer that appends to w.
+func NewSSEEventWriter(w io.Writer) *SSEEventWriter {
+	return &SSEEventWriter{w: w}
+}
+
+// WriteEvent writes one event. An empty event name omits the event line, which
+// clients treat as the default "message" event.
+func (w *SSEEventWriter) WriteEvent(event, data string) error {
+	if event != "" {
+		w.write("event: ")
+		w.write(sanitizeSSEField(event))
+		w.write("\n")
+	}
+	for {
+		i := strings.IndexAny(data, "\r\n")
+		w.write("data: ")
+		if i < 0 {
+			w.write(data)
+			w.write("\n")
+			break
+		}
+		w.write(data[:i])
+		w.write("\n")
+		if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			i++
+		}
+		data = data[i+1:]
+	}
+	w.write("\n")
+	return w.err
+}
+
+// WriteData writes a data-only event.
+func (w *SSEEventWriter) WriteData(data string) error {
+	return w.WriteEvent("", data)
+}
+
+// WriteDone writes the "data: [DONE]" terminator used by OpenAI streams.
+func (w *SSEEventWriter) WriteDone() error {
+	return w.WriteEvent("", sseDone)
+}
+
+// Err returns the first write error, if any.
+func (w *SSEEventWriter) Err() error {
+	return w.err
+}
+
+func (w *SSEEventWriter) write(s string) {
+	if w.err != nil || s == "" {
+		return
+	}
+	_, w.err = io.WriteString(w.w, s)
+}
+
+// sanitizeSSEField drops line breaks, which would otherwise end the field early.
+func sanitizeSSEField(v string) string {
+	if !strings.ContainsAny(v, "\r\n") {
+		return v
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, v)
+}
+
+// FormatSSEEvent renders one event as a string, for stream transforms that return
+// one string per event. An empty event name renders a data-only event.
+func FormatSSEEvent(event, data string) string {
+	var b strings.Builder
+	b.Grow(len(event) + len(data) + 16)
+	_ = NewSSEEventWriter(&b).WriteEvent(event, data)
+	return b.String()
+}
+
+// FormatSSEDone renders the "data: [DONE]" terminator.
+func FormatSSEDone() string {
+	return FormatSSEEvent("", sseDone)
+}
@@ -0,0 +1,89 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSSEEventWriterFraming(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+		data  string
+		want  string
+	}{
+		{"named", "message_start", `{"type":"message_start"}`, "event: message_start\ndata: {\"type\":\"message_start\"}\n\n"},
+		{"data only", "", `{"a":1}`, "data: {\"a\":1}\n\n"},
+		{"multi-line payload", "", "a\nb\r\nc\rd", "data: a\ndata: b\ndata: c\ndata: d\n\n"},
+		{"trailing newline", "", "a\n", "data: a\ndata: \n\n"},
+		{"empty payload", "ping", "", "event: ping\ndata: \n\n"},
+		{"event name with line break", "bad\nname", "x", "event: badname\ndata: x\n\n"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := NewSSEEventWriter(&b).WriteEvent(tt.event, tt.data); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, b.String(), tt.want)
+		}
+		if got := FormatSSEEvent(tt.event, tt.data); got != tt.want {
+			t.Errorf("%s: FormatSSEEvent got %q", tt.name, got)
+		}
+	}
+	if got := FormatSSEDone(); got != "data: [DONE]\n\n" {
+		t.Errorf("FormatSSEDone() = %q", got)
+	}
+}
+
+type failingWriter struct{ writes int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("closed")
+}
+
+func TestSSEEventWriterStickyError(t *testing.T) {
+	fw := &failingWriter{}
+	w := NewSSEEventWriter(fw)
+	if err := w.WriteData("a"); err == nil {
+		t.Fatal("expected write error")
+	}
+	if err := w.WriteDone(); err == nil || w.Err() == nil {
+		t.Fatal("write error should be sticky")
+	}
+	if fw.writes != 1 {
+		t.Errorf("writer called %d times after failing, want 1", fw.writes)
+	}
+}
+
+// Every event produced by the stream transforms must end with exactly one blank line.
+func TestStreamTransformsEmitSpecCompliantEvents(t *testing.T) {
+	for _, ev := range append(
+		streamEvents(t, ConvertOpenAIChatResponseToClaude, `{"id":"c1","choices":[{"index":0,"delta":{"content":"Hi"}}]}`, `{"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`, "[DONE]"),
+		streamEvents(t, ConvertClaudeResponseToOpenAIChat, `{"type":"message_start","message":{"id":"m1","usage":{"input_tokens":1}}}`, `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`, `{"type":"message_stop"}`)...,
+	) {
+		if !strings.HasSuffix(ev, "\n\n") || strings.HasSuffix(ev, "\n\n\n") {
+			t.Errorf("event is not terminated by exactly one blank line: %q", ev)
+		}
+		if strings.Contains(strings.TrimSuffix(ev, "\n\n"), "\n\n") {
+			t.Errorf("string holds more than one event: %q", ev)
+		}
+	}
+}
+
+func streamEvents(t *testing.T, fn ResponseStreamTransform, payloads ...string) []string {
+	t.Helper()
+	var param any
+	var out []string
+	for _, p := range payloads {
+		events, err := fn(context.Background(), "m", []byte(`{"stream":true}`), nil, []byte(p), &param)
+		if err != nil {
+			t.Fatalf("transform %q: %v", p, err)
+		}
+		out = append(out, events...)
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package translator
+
+import (
+	"strings"
+
+	"ampmanager/internal/tokenizer"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Images and other base64 payloads count as a fixed number of tokens, matching
+// the estimate the proxy uses for requests without upstream usage.
+const (
+	estimatedTokensPerBinaryValue = 1600
+	binaryValueMinLength          = 1024
+)
+
+// estimateRequestInputTokens estimates the input tokens of a JSON request body by
+// counting every string value with the model's encoding. It returns 0 when the
+// body is not JSON.
+func estimateRequestInputTokens(model string, rawJSON []byte) int64 {
+	if len(rawJSON) == 0 || !gjson.ValidBytes(rawJSON) {
+		return 0
+	}
+	enc := tokenizer.ForModel(model)
+	if enc == tokenizer.Generic {
+		enc = tokenizer.Claude
+	}
+	return countJSONStringTokens(gjson.ParseBytes(rawJSON), enc)
+}
+
+func countJSONStringTokens(v gjson.Result, enc tokenizer.Encoding) int64 {
+	switch {
+	case v.Type == gjson.String:
+		s := v.String()
+		if strings.HasPrefix(s, "data:") || (len(s) >= binaryValueMinLength && !strings.ContainsAny(s, " \n")) {
+			return estimatedTokensPerBinaryValue
+		}
+		return int64(tokenizer.Count(enc, s))
+	case v.IsObject(), v.IsArray():
+		var total int64
+		v.ForEach(func(_, item gjson.Result) bool {
+			total += countJSONStringTokens(item, enc)
+			return true
+		})
+		return total
+	default:
+		return 0
+	}
+}
+
+// claudeStartUsage builds the usage of a Claude message_start event. Input
+// tokens come from upstream usage already converted to Claude form when the
+// first chunk carries it, otherwise from an estimate of the upstream request
+// (falling back to the client request). Output tokens are always 0 at start;
+// the final message_delta reports the real usage.
+func claudeStartUsage(upstreamUsage, model string, originalRequestRawJSON, requestRawJSON []byte) string {
+	if upstreamUsage != "" && (gjson.Get(upstreamUsage, "input_tokens").Int() > 0 || gjson.Get(upstreamUsage, "cache_read_input_tokens").Int() > 0) {
+		out, _ := sjson.Set(upstreamUsage, "output_tokens", 0)
+		return out
+	}
+	body := requestRawJSON
+	if len(body) == 0 {
+		body = originalRequestRawJSON
+	}
+	out, _ := sjson.Set(`{"input_tokens":0,"output_tokens":0}`, "input_tokens", estimateRequestInputTokens(model, body))
+	return out
+}
@@ -0,0 +1,118 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func claudeEventOfType(t *testing.T, out []string, eventType string) gjson.Result {
+	t.Helper()
+	for _, ev := range claudeEvents(t, out) {
+		if ev.Get("type").String() == eventType {
+			return ev
+		}
+	}
+	t.Fatalf("no %s event in %v", eventType, out)
+	return gjson.Result{}
+}
+
+func TestEstimateRequestInputTokens(t *testing.T) {
+	short := estimateRequestInputTokens("gpt-4o", []byte(`{"messages":[{"role":"user","content":"hello"}]}`))
+	long := estimateRequestInputTokens("gpt-4o", []byte(`{"messages":[{"role":"user","content":"`+strings.Repeat("hello world ", 200)+`"}]}`))
+	if short <= 0 || long <= short {
+		t.Fatalf("short %d long %d", short, long)
+	}
+	image := estimateRequestInputTokens("gpt-4o", []byte(`{"url":"data:image/png;base64,`+strings.Repeat("A", 4096)+`"}`))
+	if image != estimatedTokensPerBinaryValue {
+		t.Errorf("image counted as %d tokens", image)
+	}
+	if got := estimateRequestInputTokens("gpt-4o", []byte("not json")); got != 0 {
+		t.Errorf("invalid body counted as %d tokens", got)
+	}
+}
+
+func TestOpenAIChatToClaudeStreamStartUsage(t *testing.T) {
+	request := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"` + strings.Repeat("count these words ", 50) + `"}]}`)
+	estimate := estimateRequestInputTokens("gpt-4o", request)
+
+	t.Run("estimated until the final chunk", func(t *testing.T) {
+		var param any
+		var out []string
+		for _, chunk := range []string{
+			`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+			`{"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			`{"id":"c1","choices":[],"usage":{"prompt_tokens":120,"completion_tokens":5}}`,
+			`[DONE]`,
+		} {
+			got, err := ConvertOpenAIChatResponseToClaude(context.Background(), "gpt-4o", nil, request, []byte(chunk), &param)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, got...)
+		}
+		start := claudeEventOfType(t, out, "message_start")
+		if got := start.Get("message.usage.input_tokens").Int(); got != estimate || got == 0 {
+			t.Errorf("message_start input_tokens = %d, want estimate %d", got, estimate)
+		}
+		if got := claudeEventOfType(t, out, "message_delta").Get("usage.input_tokens").Int(); got != 120 {
+			t.Errorf("message_delta input_tokens = %d, want 120", got)
+		}
+	})
+
+	t.Run("taken from the first chunk", func(t *testing.T) {
+		var param any
+		out, err := ConvertOpenAIChatResponseToClaude(context.Background(), "gpt-4o", nil, request,
+			[]byte(`{"id":"c1","choices":[{"index":0,"delta":{"content":"Hi"}}],"usage":{"prompt_tokens":120,"completion_tokens":1,"prompt_tokens_details":{"cached_tokens":100}}}`), &param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		usage := claudeEventOfType(t, out, "message_start").Get("message.usage")
+		if usage.Get("input_tokens").Int() != 20 || usage.Get("cache_read_input_tokens").Int() != 100 || usage.Get("output_tokens").Int() != 0 {
+			t.Errorf("message_start usage = %s", usage.Raw)
+		}
+	})
+
+	t.Run("estimate kept without upstream usage", func(t *testing.T) {
+		var param any
+		var out []string
+		for _, chunk := range []string{
+			`{"id":"c1","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+			`[DONE]`,
+		} {
+			got, _ := ConvertOpenAIChatResponseToClaude(context.Background(), "gpt-4o", nil, request, []byte(chunk), &param)
+			out = append(out, got...)
+		}
+		if got := claudeEventOfType(t, out, "message_delta").Get("usage.input_tokens").Int(); got != estimate {
+			t.Errorf("message_delta input_tokens = %d, want estimate %d", got, estimate)
+		}
+	})
+}
+
+func TestOpenAIResponsesToClaudeStreamStartUsage(t *testing.T) {
+	request := []byte(`{"model":"gpt-5","input":[{"role":"user","content":"` + strings.Repeat("count these words ", 50) + `"}]}`)
+	estimate := estimateRequestInputTokens("gpt-5", request)
+
+	var param any
+	var out []string
+	for _, ev := range []string{
+		`{"type":"response.created","response":{"id":"resp_1","model":"gpt-5","status":"in_progress","output":[],"usage":null}}`,
+		`{"type":"response.output_item.added","output_index":0,"item":{"id":"msg_1","type":"message","role":"assistant","content":[]}}`,
+		`{"type":"response.output_text.delta","output_index":0,"delta":"Hi"}`,
+		`{"type":"response.completed","response":{"id":"resp_1","status":"completed","usage":{"input_tokens":130,"output_tokens":5}}}`,
+	} {
+		got, err := ConvertOpenAIResponsesResponseToClaude(context.Background(), "gpt-5", nil, request, []byte(ev), &param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, got...)
+	}
+	if got := claudeEventOfType(t, out, "message_start").Get("message.usage.input_tokens").Int(); got != estimate || got == 0 {
+		t.Errorf("message_start input_tokens = %d, want estimate %d", got, estimate)
+	}
+	if got := claudeEventOfType(t, out, "message_delta").Get("usage.input_tokens").Int(); got != 130 {
+		t.Errorf("message_delta input_tokens = %d, want 130", got)
+	}
+}
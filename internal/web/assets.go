@@ -0,0 +1,153 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipMinSize 小于该大小的文件压缩收益有限，直接返回原文
+const gzipMinSize = 1024
+
+// asset 预处理后的静态文件
+type asset struct {
+	data        []byte
+	gzipped     []byte
+	contentType string
+	etag        string
+}
+
+// assetServer 提供静态文件，cache 为 true 时（内嵌资源不可变）缓存内容、ETag 与 gzip 结果
+type assetServer struct {
+	fsys   fs.FS
+	cache  bool
+	assets sync.Map // name -> *asset
+}
+
+func newAssetServer(fsys fs.FS, cache bool) *assetServer {
+	return &assetServer{fsys: fsys, cache: cache}
+}
+
+func (s *assetServer) load(name string) (*asset, bool) {
+	if s.cache {
+		if v, ok := s.assets.Load(name); ok {
+			return v.(*asset), true
+		}
+	}
+
+	name = path.Clean(name)
+	if !fs.ValidPath(name) {
+		return nil, false
+	}
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil || info.IsDir() {
+		return nil, false
+	}
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return nil, false
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	sum := sha256.Sum256(data)
+	a := &asset{
+		data:        data,
+		contentType: contentType,
+		etag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+	}
+	if s.cache && len(data) >= gzipMinSize && isCompressible(contentType) {
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if _, err := zw.Write(data); err == nil && zw.Close() == nil && buf.Len() < len(data) {
+			a.gzipped = buf.Bytes()
+		}
+	}
+
+	if s.cache {
+		v, _ := s.assets.LoadOrStore(name, a)
+		a = v.(*asset)
+	}
+	return a, true
+}
+
+// serve 写出文件，文件不存在时返回 false 且不写响应
+func (s *assetServer) serve(c *gin.Context, name string) bool {
+	a, ok := s.load(name)
+	if !ok {
+		return false
+	}
+
+	c.Header("Cache-Control", s.cacheControl(name))
+	c.Header("ETag", a.etag)
+	if a.gzipped != nil {
+		c.Header("Vary", "Accept-Encoding")
+	}
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Contains(match, a.etag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+
+	body := a.data
+	if a.gzipped != nil && acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Header("Content-Encoding", "gzip")
+		body = a.gzipped
+	}
+	c.Header("Content-Length", strconv.Itoa(len(body)))
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", a.contentType)
+		c.Status(http.StatusOK)
+		return true
+	}
+	c.Data(http.StatusOK, a.contentType, body)
+	return true
+}
+
+// cacheControl 构建产物 assets/ 下的文件名带内容哈希，可长期缓存；
+// index.html 需每次协商以便发布后立即生效
+func (s *assetServer) cacheControl(name string) string {
+	switch {
+	case !s.cache || name == "index.html":
+		return "no-cache"
+	case strings.HasPrefix(name, "assets/"):
+		return "public, max-age=31536000, immutable"
+	default:
+		return "public, max-age=3600"
+	}
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "javascript"), strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "+xml"), mediaType == "application/wasm":
+		return true
+	}
+	return false
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// gzip;q=0 表示明确拒绝
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
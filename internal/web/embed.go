@@ -3,7 +3,9 @@ package web
 import (
 	"embed"
 	"io/fs"
-	"net/http"
+	"log"
+	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,42 +13,50 @@ import (
 //go:embed all:dist
 var staticFS embed.FS
 
-// RegisterStaticRoutes registers routes to serve the embedded frontend
-func RegisterStaticRoutes(r *gin.Engine) {
-	// Get the dist subdirectory
-	distFS, err := fs.Sub(staticFS, "dist")
-	if err != nil {
-		panic("failed to get dist subdirectory: " + err.Error())
+// RegisterStaticRoutes registers routes to serve the frontend.
+// externalDir 非空时从该目录读取前端文件（开发模式，不缓存），否则使用编译时嵌入的 dist
+func RegisterStaticRoutes(r *gin.Engine, externalDir string) {
+	var server *assetServer
+	if externalDir != "" {
+		if info, err := os.Stat(externalDir); err == nil && info.IsDir() {
+			log.Printf("前端静态文件: 使用外部目录 %s", externalDir)
+			server = newAssetServer(os.DirFS(externalDir), false)
+		} else {
+			log.Printf("警告: 前端目录 %s 不可用，回退到内嵌资源", externalDir)
+		}
+	}
+	if server == nil {
+		// Get the dist subdirectory
+		distFS, err := fs.Sub(staticFS, "dist")
+		if err != nil {
+			panic("failed to get dist subdirectory: " + err.Error())
+		}
+		server = newAssetServer(distFS, true)
 	}
 
-	// Serve static assets
-	r.StaticFS("/assets", http.FS(mustSub(distFS, "assets")))
-
-	// Serve index.html for all non-API routes (SPA fallback)
+	// Serve static assets; SPA fallback to index.html for all non-API routes
 	r.NoRoute(func(c *gin.Context) {
+		path := c.Request.URL.Path
 		// Don't serve index.html for API routes
-		if len(c.Request.URL.Path) >= 4 && c.Request.URL.Path[:4] == "/api" {
+		if strings.HasPrefix(path, "/api") || strings.HasPrefix(path, "/v1") {
 			c.JSON(404, gin.H{"error": "not found"})
 			return
 		}
-		if len(c.Request.URL.Path) >= 3 && c.Request.URL.Path[:3] == "/v1" {
+		if c.Request.Method != "GET" && c.Request.Method != "HEAD" {
 			c.JSON(404, gin.H{"error": "not found"})
 			return
 		}
 
-		indexHTML, err := fs.ReadFile(distFS, "index.html")
-		if err != nil {
-			c.String(500, "failed to read index.html")
+		if name := strings.TrimPrefix(path, "/"); name != "" && server.serve(c, name) {
 			return
 		}
-		c.Data(200, "text/html; charset=utf-8", indexHTML)
+		// 带扩展名的缺失资源直接 404，避免把 index.html 当作 JS/CSS 返回
+		if strings.HasPrefix(path, "/assets/") {
+			c.Status(404)
+			return
+		}
+		if !server.serve(c, "index.html") {
+			c.String(500, "failed to read index.html")
+		}
 	})
 }
-
-func mustSub(fsys fs.FS, dir string) fs.FS {
-	sub, err := fs.Sub(fsys, dir)
-	if err != nil {
-		panic("failed to get subdirectory: " + err.Error())
-	}
-	return sub
-}
@@ -25,6 +25,7 @@ export interface Channel {
   name: string
   baseUrl: string
   apiKeySet: boolean
+  apiKeyRef?: string
   enabled: boolean
   weight: number
   priority: number
@@ -34,10 +35,26 @@ export interface Channel {
   modelWhitelist: boolean
   simulateCli: boolean
   headers: Record<string, string>
+  anthropicBetaPolicy: AnthropicBetaPolicy
+  headerPolicy: ChannelHeaderPolicy
   createdAt: string
   updatedAt: string
 }
 
+export type AnthropicBetaMode = 'deny' | 'allow'
+
+export interface AnthropicBetaPolicy {
+  mode: AnthropicBetaMode
+  betas: string[]
+}
+
+export interface ChannelHeaderPolicy {
+  userAgent: string
+  stripClientHeaders: boolean
+  passthrough: string[]
+  remove: string[]
+}
+
 export interface ChannelRequest {
   type: ChannelType
   endpoint?: ChannelEndpoint
@@ -52,6 +69,8 @@ export interface ChannelRequest {
   modelWhitelist?: boolean
   simulateCli?: boolean
   headers?: Record<string, string>
+  anthropicBetaPolicy?: AnthropicBetaPolicy
+  headerPolicy?: ChannelHeaderPolicy
 }
 
 export interface TestChannelResult {
@@ -15,6 +15,7 @@ export interface Group {
   name: string
   description: string
   rateMultiplier: number
+  maxRequestCostMicros: number
   userCount: number
   channelCount: number
   createdAt: string
@@ -25,6 +26,7 @@ export interface GroupRequest {
   name: string
   description: string
   rateMultiplier: number
+  maxRequestCostMicros?: number
 }
 
 export async function listGroups(): Promise<Group[]> {
@@ -9,6 +9,8 @@ export interface DatabaseInfo {
   databaseURL: string
   databaseURLMasked: string
   archiveMode: string
+  readConnection: 'primary' | 'pool' | 'replica'
+  readDatabaseURLMasked: string
 }
 
 export interface DatabaseMigrationTask {
@@ -279,3 +281,21 @@ export async function updateCacheTTLConfig(cacheTTL: string): Promise<{ message:
 
   return res.json()
 }
+
+// 维护模式横幅
+export interface MaintenanceNotice {
+  enabled: boolean
+  message?: string
+  startedAt?: string
+}
+
+export async function getMaintenanceNotice(): Promise<MaintenanceNotice> {
+  const res = await authFetch(`${API_BASE}/me/maintenance`)
+
+  if (!res.ok) {
+    const data = await res.json()
+    throw new Error(data.error || '获取维护状态失败')
+  }
+
+  return res.json()
+}
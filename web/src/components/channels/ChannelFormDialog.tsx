@@ -16,6 +16,8 @@ import {
   ChannelType,
   ChannelEndpoint,
   ChannelModel,
+  AnthropicBetaMode,
+  ChannelHeaderPolicy,
 } from '@/api/channels'
 import { Group } from '@/api/groups'
 import ModelRulesEditor from './ModelRulesEditor'
@@ -31,6 +33,13 @@ const OPENAI_ENDPOINTS: { value: ChannelEndpoint; label: string }[] = [
   { value: 'responses', label: '/v1/responses' },
 ]
 
+const EMPTY_HEADER_POLICY: ChannelHeaderPolicy = {
+  userAgent: '',
+  stripClientHeaders: false,
+  passthrough: [],
+  remove: [],
+}
+
 interface ChannelFormDialogProps {
   open: boolean
   onOpenChange: (open: boolean) => void
@@ -64,6 +73,13 @@ export function ChannelFormDialog({
     }
   }
 
+  const setHeaderPolicy = (patch: Partial<ChannelHeaderPolicy>) => {
+    setFormData(prev => ({
+      ...prev,
+      headerPolicy: { ...EMPTY_HEADER_POLICY, ...prev.headerPolicy, ...patch },
+    }))
+  }
+
   const handleAddHeader = () => {
     setFormData(prev => ({
       ...prev,
@@ -273,6 +289,44 @@ export function ChannelFormDialog({
             </div>
           )}
 
+          {/* Anthropic-Beta 策略 - 仅 Claude 类型显示 */}
+          {formData.type === 'claude' && (
+            <div className="col-span-2 space-y-2 rounded-lg border p-4">
+              <Label>Anthropic-Beta 策略</Label>
+              <p className="text-sm text-muted-foreground">
+                拒绝列表：移除列出的 beta，其余透传；允许列表：仅保留列出的 beta。支持以 * 结尾的前缀匹配。
+                未设置时默认移除 context-1m-2025-08-07
+              </p>
+              <div className="flex items-center gap-2">
+                <select
+                  value={formData.anthropicBetaPolicy?.mode || 'deny'}
+                  onChange={(e) => setFormData(prev => ({
+                    ...prev,
+                    anthropicBetaPolicy: {
+                      mode: e.target.value as AnthropicBetaMode,
+                      betas: prev.anthropicBetaPolicy?.betas || [],
+                    },
+                  }))}
+                  className="flex h-10 w-32 rounded-md border border-input bg-background px-3 py-2 text-sm ring-offset-background focus-visible:outline-none focus-visible:ring-2 focus-visible:ring-ring"
+                >
+                  <option value="deny">拒绝列表</option>
+                  <option value="allow">允许列表</option>
+                </select>
+                <Input
+                  placeholder="context-1m-2025-08-07, interleaved-thinking-*"
+                  value={(formData.anthropicBetaPolicy?.betas || []).join(',')}
+                  onChange={(e) => setFormData(prev => ({
+                    ...prev,
+                    anthropicBetaPolicy: {
+                      mode: prev.anthropicBetaPolicy?.mode || 'deny',
+                      betas: e.target.value ? e.target.value.split(',') : [],
+                    },
+                  }))}
+                />
+              </div>
+            </div>
+          )}
+
           {/* 模型规则编辑器 */}
           <ModelRulesEditor
             models={formData.models}
@@ -285,6 +339,48 @@ export function ChannelFormDialog({
             onSetModels={(models) => setFormData(prev => ({ ...prev, models }))}
           />
 
+          {/* 请求头策略 */}
+          <div className="col-span-2 space-y-3 rounded-lg border p-4">
+            <div className="flex items-center justify-between">
+              <div className="space-y-0.5">
+                <Label>移除客户端标识请求头</Label>
+                <p className="text-sm text-muted-foreground">
+                  移除 User-Agent、X-Stainless-*、X-Forwarded-For 等客户端请求头，透传列表中的除外
+                </p>
+              </div>
+              <Switch
+                checked={formData.headerPolicy?.stripClientHeaders || false}
+                onCheckedChange={(checked) => setHeaderPolicy({ stripClientHeaders: checked })}
+              />
+            </div>
+            <div className="grid grid-cols-2 gap-2">
+              <div className="col-span-2 space-y-1">
+                <Label>强制 User-Agent</Label>
+                <Input
+                  placeholder="留空则不修改"
+                  value={formData.headerPolicy?.userAgent || ''}
+                  onChange={(e) => setHeaderPolicy({ userAgent: e.target.value })}
+                />
+              </div>
+              <div className="space-y-1">
+                <Label>透传请求头</Label>
+                <Input
+                  placeholder="X-Amp-*, Session_id"
+                  value={(formData.headerPolicy?.passthrough || []).join(',')}
+                  onChange={(e) => setHeaderPolicy({ passthrough: e.target.value ? e.target.value.split(',') : [] })}
+                />
+              </div>
+              <div className="space-y-1">
+                <Label>额外移除请求头</Label>
+                <Input
+                  placeholder="X-Debug, X-Trace-*"
+                  value={(formData.headerPolicy?.remove || []).join(',')}
+                  onChange={(e) => setHeaderPolicy({ remove: e.target.value ? e.target.value.split(',') : [] })}
+                />
+              </div>
+            </div>
+          </div>
+
           {/* 自定义请求头 */}
           <div className="col-span-2 space-y-3">
             <div className="flex items-center justify-between">
@@ -107,6 +107,8 @@ export default function Channels() {
       modelWhitelist: channel.modelWhitelist || false,
       simulateCli: channel.simulateCli || false,
       headers: channel.headers,
+      anthropicBetaPolicy: channel.anthropicBetaPolicy,
+      headerPolicy: channel.headerPolicy,
     })
     setShowForm(true)
   }
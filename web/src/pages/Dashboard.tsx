@@ -1,4 +1,4 @@
-import { useState } from 'react'
+import { useEffect, useState } from 'react'
 import { motion, AnimatePresence, sidebarContainerVariants, sidebarItemVariants } from '@/lib/motion'
 import Overview from './Overview'
 import AdminOverview from './AdminOverview'
@@ -16,6 +16,8 @@ import SubscriptionPlans from './SubscriptionPlans'
 import UserManagement from './UserManagement'
 import AccountSettings from './AccountSettings'
 import { Button } from '@/components/ui/button'
+import { Alert, AlertDescription } from '@/components/ui/alert'
+import { getMaintenanceNotice, MaintenanceNotice } from '@/api/system'
 // Card components available if needed by child pages
 import { Badge } from '@/components/ui/badge'
 import { Separator } from '@/components/ui/separator'
@@ -51,6 +53,7 @@ import {
   FolderOpen,
   LayoutDashboard,
   CreditCard,
+  AlertTriangle,
 } from 'lucide-react'
 
 interface Props {
@@ -83,6 +86,17 @@ export default function Dashboard({ username: initialUsername, isAdmin, onLogout
   const [currentPage, setCurrentPage] = useState<Page>('overview')
   const [username, setUsername] = useState(initialUsername)
   const [collapsed, setCollapsed] = useState(false)
+  const [maintenance, setMaintenance] = useState<MaintenanceNotice | null>(null)
+
+  // 定期拉取维护状态，维护期间在页面顶部展示横幅
+  useEffect(() => {
+    const load = () => {
+      getMaintenanceNotice().then(setMaintenance).catch(() => {})
+    }
+    load()
+    const timer = setInterval(load, 30000)
+    return () => clearInterval(timer)
+  }, [])
 
   const navItems: { key: Page; label: string; adminOnly?: boolean }[] = [
     { key: 'overview', label: '概览' },
@@ -286,6 +300,15 @@ export default function Dashboard({ username: initialUsername, isAdmin, onLogout
 
           {/* Page content */}
           <main className="flex-1 p-6">
+            {maintenance?.enabled && (
+              <Alert className="mb-6 bg-yellow-100 border-yellow-300 dark:bg-yellow-900 dark:border-yellow-700">
+                <AlertTriangle className="h-4 w-4 text-yellow-800 dark:text-yellow-200" />
+                <AlertDescription className="text-yellow-800 dark:text-yellow-200">
+                  {maintenance.message}
+                  {maintenance.startedAt && `（开始于 ${new Date(maintenance.startedAt).toLocaleString()}）`}
+                </AlertDescription>
+              </Alert>
+            )}
             <AnimatePresence mode="wait">
               <motion.div
                 key={currentPage}
@@ -38,7 +38,7 @@ export default function Groups() {
   const [message, setMessage] = useState<{ type: 'success' | 'error'; text: string } | null>(null)
   const [showForm, setShowForm] = useState(false)
   const [editingGroup, setEditingGroup] = useState<Group | null>(null)
-  const [formData, setFormData] = useState<GroupRequest>({ name: '', description: '', rateMultiplier: 1 })
+  const [formData, setFormData] = useState<GroupRequest>({ name: '', description: '', rateMultiplier: 1, maxRequestCostMicros: 0 })
   const [saving, setSaving] = useState(false)
   const [deleteConfirmModal, setDeleteConfirmModal] = useState<Group | null>(null)
 
@@ -64,13 +64,18 @@ export default function Groups() {
 
   const handleCreate = () => {
     setEditingGroup(null)
-    setFormData({ name: '', description: '', rateMultiplier: 1 })
+    setFormData({ name: '', description: '', rateMultiplier: 1, maxRequestCostMicros: 0 })
     setShowForm(true)
   }
 
   const handleEdit = (group: Group) => {
     setEditingGroup(group)
-    setFormData({ name: group.name, description: group.description, rateMultiplier: group.rateMultiplier })
+    setFormData({
+      name: group.name,
+      description: group.description,
+      rateMultiplier: group.rateMultiplier,
+      maxRequestCostMicros: group.maxRequestCostMicros,
+    })
     setShowForm(true)
   }
 
@@ -171,6 +176,7 @@ export default function Groups() {
                         <TableHead>名称</TableHead>
                         <TableHead>描述</TableHead>
                         <TableHead>倍率</TableHead>
+                        <TableHead>单次上限</TableHead>
                         <TableHead>用户数</TableHead>
                         <TableHead>渠道数</TableHead>
                         <TableHead>创建时间</TableHead>
@@ -187,6 +193,9 @@ export default function Groups() {
                               {group.rateMultiplier}x
                             </Badge>
                           </TableCell>
+                          <TableCell className="text-muted-foreground">
+                            {group.maxRequestCostMicros > 0 ? `$${(group.maxRequestCostMicros / 1e6).toFixed(2)}` : '-'}
+                          </TableCell>
                           <TableCell>
                             <Badge variant="secondary">{group.userCount}</Badge>
                           </TableCell>
@@ -269,6 +278,24 @@ export default function Groups() {
                 费用倍率，1.0 表示原价，2.0 表示双倍计费
               </p>
             </div>
+            <div className="space-y-2">
+              <Label htmlFor="groupMaxCost">单次请求费用上限 (USD)</Label>
+              <Input
+                id="groupMaxCost"
+                type="number"
+                step="0.01"
+                min="0"
+                placeholder="0"
+                value={(formData.maxRequestCostMicros || 0) / 1e6}
+                onChange={(e) => setFormData(prev => ({
+                  ...prev,
+                  maxRequestCostMicros: Math.max(0, Math.round((parseFloat(e.target.value) || 0) * 1e6)),
+                }))}
+              />
+              <p className="text-xs text-muted-foreground">
+                按输入与 max_tokens 估算的最高费用（含倍率）超过上限时拒绝请求，0 表示不限制
+              </p>
+            </div>
           </div>
           <DialogFooter>
             <Button variant="outline" onClick={() => setShowForm(false)}>
@@ -456,6 +456,23 @@ export default function SystemSettings() {
                               : '当前模式使用 PostgreSQL dump 导入导出。'}
                           </p>
                         </div>
+                        <div className="rounded-lg border p-4 space-y-2">
+                          <div className="flex items-center justify-between">
+                            <span className="text-sm text-muted-foreground">统计查询连接</span>
+                            <Badge variant="outline">
+                              {databaseInfo.readConnection === 'replica'
+                                ? '只读副本'
+                                : databaseInfo.readConnection === 'pool'
+                                  ? '独立只读连接池'
+                                  : '与写入共用'}
+                            </Badge>
+                          </div>
+                          <p className="text-sm text-muted-foreground">
+                            {databaseInfo.readConnection === 'replica'
+                              ? databaseInfo.readDatabaseURLMasked
+                              : '用量统计与仪表盘查询使用该连接，不阻塞日志写入与计费。'}
+                          </p>
+                        </div>
                       </div>
 
                       <Alert>